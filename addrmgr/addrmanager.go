@@ -17,6 +17,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -47,6 +48,23 @@ type AddrManager struct {
 	lamtx          sync.Mutex
 	localAddresses map[string]*localAddress
 	version        int
+	asmap          *ASMap
+
+	// store is the optional database backend the addresses are persisted
+	// to instead of the peers file.  dirty tracks the keys of the
+	// addresses which changed since they were last written to it.
+	store Store
+	dirty map[string]struct{}
+
+	// weights are the weights used to score addresses when they are
+	// selected and evicted.  See SetScoreWeights.
+	weights ScoreWeights
+
+	// clock is the source of the current time.  deterministic is set when
+	// the source of randomness was injected via SetRandSource, so the
+	// addresses of a bucket are considered in a fixed order.
+	clock         Clock
+	deterministic bool
 }
 
 type serializedKnownAddress struct {
@@ -58,6 +76,11 @@ type serializedKnownAddress struct {
 	LastSuccess int64
 	Services    wire.ServiceFlag
 	SrcServices wire.ServiceFlag
+
+	// Network is the BIP0155 network ID of the address.  It is needed to
+	// tell CJDNS addresses apart from IPv6 addresses since both are
+	// written as IPv6 addresses.
+	Network wire.NetworkID `json:",omitempty"`
 	// no refcount or tried, that is available from context.
 }
 
@@ -67,6 +90,10 @@ type serializedAddrManager struct {
 	Addresses    []*serializedKnownAddress
 	NewBuckets   [newBucketCount][]string // string is NetAddressKey
 	TriedBuckets [triedBucketCount][]string
+
+	// ASMap is the checksum of the AS map the addresses were bucketed
+	// with.  It is empty when no AS map was used.
+	ASMap string `json:",omitempty"`
 }
 
 type localAddress struct {
@@ -158,20 +185,25 @@ const (
 	getAddrPercent = 23
 
 	// serialisationVersion is the current version of the on-disk format.
-	serialisationVersion = 2
+	serialisationVersion = 3
+
+	// storeFlushInterval is the interval used to write the addresses which
+	// changed to the store when one is used.
+	storeFlushInterval = time.Minute
 )
 
 // updateAddress is a helper function to either update an address already known
 // to the address manager, or to add the address if not already known.
-func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddress) {
+func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddressV2) {
 	// Filter out non-routable addresses. Note that non-routable
-	// also includes invalid and local addresses.
-	if !IsRoutable(netAddr) {
+	// also includes invalid and local addresses as well as addresses of
+	// unknown networks.
+	if !isRoutableV2(netAddr) {
 		return
 	}
 
-	addr := NetAddressKey(netAddr)
-	ka := a.find(netAddr)
+	addr := netAddr.String()
+	ka := a.addrIndex[addr]
 	if ka != nil {
 		// TODO: only update addresses periodically.
 		// Update the last seen time and services.
@@ -187,6 +219,7 @@ func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddress) {
 			naCopy.Timestamp = netAddr.Timestamp
 			naCopy.AddService(netAddr.Services)
 			ka.na = &naCopy
+			a.markDirty(addr)
 		}
 
 		// If already in tried, we have nothing to do here.
@@ -212,6 +245,7 @@ func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddress) {
 		netAddrCopy := *netAddr
 		ka = &KnownAddress{na: &netAddrCopy, srcAddr: srcAddr}
 		a.addrIndex[addr] = ka
+		a.markDirty(addr)
 		a.nNew++
 		// XXX time penalty?
 	}
@@ -232,24 +266,29 @@ func (a *AddrManager) updateAddress(netAddr, srcAddr *wire.NetAddress) {
 	// Add to new bucket.
 	ka.refs++
 	a.addrNew[bucket][addr] = ka
+	a.markDirty(addr)
 
 	log.Tracef("Added new address %s for a total of %d addresses", addr,
 		a.nTried+a.nNew)
 }
 
 // expireNew makes space in the new buckets by expiring the really bad entries.
-// If no bad entries are available we look at a few and remove the oldest.
+// If no bad entries are available we look at a few and remove the oldest of
+// the network with the most addresses in the bucket, or the one with the lowest
+// score when scoring is enabled.
 func (a *AddrManager) expireNew(bucket int) {
 	// First see if there are any entries that are so bad we can just throw
 	// them away. otherwise we throw away the oldest entry in the cache.
 	// Bitcoind here chooses four random and just throws the oldest of
 	// those away, but we keep track of oldest in the initial traversal and
 	// use that information instead.
-	var oldest *KnownAddress
+	counts := make(map[wire.NetworkID]int)
+	now := a.now()
 	for k, v := range a.addrNew[bucket] {
-		if v.isBad() {
+		if v.isBad(now) {
 			log.Tracef("expiring bad address %v", k)
 			delete(a.addrNew[bucket], k)
+			a.markDirty(k)
 			v.refs--
 			if v.refs == 0 {
 				a.nNew--
@@ -257,18 +296,26 @@ func (a *AddrManager) expireNew(bucket int) {
 			}
 			continue
 		}
-		if oldest == nil {
-			oldest = v
-		} else if !v.na.Timestamp.After(oldest.na.Timestamp) {
+		counts[v.na.NetworkID]++
+	}
+
+	network := evictionNetwork(counts)
+	var oldest *KnownAddress
+	for _, v := range a.addrNew[bucket] {
+		if v.na.NetworkID != network {
+			continue
+		}
+		if oldest == nil || a.evictBefore(v, oldest) {
 			oldest = v
 		}
 	}
 
 	if oldest != nil {
-		key := NetAddressKey(oldest.na)
+		key := oldest.na.String()
 		log.Tracef("expiring oldest address %v", key)
 
 		delete(a.addrNew[bucket], key)
+		a.markDirty(key)
 		oldest.refs--
 		if oldest.refs == 0 {
 			a.nNew--
@@ -278,14 +325,23 @@ func (a *AddrManager) expireNew(bucket int) {
 }
 
 // pickTried selects an address from the tried bucket to be evicted.
-// We just choose the eldest. Bitcoind selects 4 random entries and throws away
-// the older of them.
+// We just choose the eldest of the network with the most addresses in the
+// bucket, or the one with the lowest score when scoring is enabled. Bitcoind selects 4 random entries and throws away the older of them.
 func (a *AddrManager) pickTried(bucket int) *list.Element {
+	counts := make(map[wire.NetworkID]int)
+	for e := a.addrTried[bucket].Front(); e != nil; e = e.Next() {
+		counts[e.Value.(*KnownAddress).na.NetworkID]++
+	}
+
+	network := evictionNetwork(counts)
 	var oldest *KnownAddress
 	var oldestElem *list.Element
 	for e := a.addrTried[bucket].Front(); e != nil; e = e.Next() {
 		ka := e.Value.(*KnownAddress)
-		if oldest == nil || oldest.na.Timestamp.After(ka.na.Timestamp) {
+		if ka.na.NetworkID != network {
+			continue
+		}
+		if oldest == nil || a.evictBefore(ka, oldest) {
 			oldestElem = e
 			oldest = ka
 		}
@@ -294,14 +350,31 @@ func (a *AddrManager) pickTried(bucket int) *list.Element {
 	return oldestElem
 }
 
-func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddress) int {
+// evictionNetwork returns the network whose addresses are evicted from a full
+// bucket given the number of addresses of each network in the bucket.  It is
+// the network with the most addresses in the bucket, so the addresses of one
+// network can't push the addresses of the other networks out of the buckets
+// they share.  Ties are broken in favor of the lowest network ID.
+func evictionNetwork(counts map[wire.NetworkID]int) wire.NetworkID {
+	var network wire.NetworkID
+	most := 0
+	for id, count := range counts {
+		if count > most || (count == most && id < network) {
+			network = id
+			most = count
+		}
+	}
+	return network
+}
+
+func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddressV2) int {
 	// bitcoind:
 	// doublesha256(key + sourcegroup + int64(doublesha256(key + group + sourcegroup))%bucket_per_source_group) % num_new_buckets
 
 	data1 := []byte{}
 	data1 = append(data1, a.key[:]...)
-	data1 = append(data1, []byte(GroupKey(netAddr))...)
-	data1 = append(data1, []byte(GroupKey(srcAddr))...)
+	data1 = append(data1, []byte(a.groupKeyV2(netAddr))...)
+	data1 = append(data1, []byte(a.groupKeyV2(srcAddr))...)
 	hash1 := chainhash.DoubleHashB(data1)
 	hash64 := binary.LittleEndian.Uint64(hash1)
 	hash64 %= newBucketsPerGroup
@@ -309,19 +382,19 @@ func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddress) int {
 	binary.LittleEndian.PutUint64(hashbuf[:], hash64)
 	data2 := []byte{}
 	data2 = append(data2, a.key[:]...)
-	data2 = append(data2, GroupKey(srcAddr)...)
+	data2 = append(data2, a.groupKeyV2(srcAddr)...)
 	data2 = append(data2, hashbuf[:]...)
 
 	hash2 := chainhash.DoubleHashB(data2)
 	return int(binary.LittleEndian.Uint64(hash2) % newBucketCount)
 }
 
-func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddress) int {
+func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddressV2) int {
 	// bitcoind hashes this as:
 	// doublesha256(key + group + truncate_to_64bits(doublesha256(key)) % buckets_per_group) % num_buckets
 	data1 := []byte{}
 	data1 = append(data1, a.key[:]...)
-	data1 = append(data1, []byte(NetAddressKey(netAddr))...)
+	data1 = append(data1, []byte(netAddr.String())...)
 	hash1 := chainhash.DoubleHashB(data1)
 	hash64 := binary.LittleEndian.Uint64(hash1)
 	hash64 %= triedBucketsPerGroup
@@ -329,7 +402,7 @@ func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddress) int {
 	binary.LittleEndian.PutUint64(hashbuf[:], hash64)
 	data2 := []byte{}
 	data2 = append(data2, a.key[:]...)
-	data2 = append(data2, GroupKey(netAddr)...)
+	data2 = append(data2, a.groupKeyV2(netAddr)...)
 	data2 = append(data2, hashbuf[:]...)
 
 	hash2 := chainhash.DoubleHashB(data2)
@@ -339,7 +412,11 @@ func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddress) int {
 // addressHandler is the main handler for the address manager.  It must be run
 // as a goroutine.
 func (a *AddrManager) addressHandler() {
-	dumpAddressTicker := time.NewTicker(dumpAddressInterval)
+	interval := dumpAddressInterval
+	if a.store != nil {
+		interval = storeFlushInterval
+	}
+	dumpAddressTicker := time.NewTicker(interval)
 	defer dumpAddressTicker.Stop()
 out:
 	for {
@@ -357,8 +434,14 @@ out:
 }
 
 // savePeers saves all the known addresses to a file so they can be read back
-// in at next run.
+// in at next run.  Only the addresses which changed are written when the
+// addresses are persisted to a store.
 func (a *AddrManager) savePeers() {
+	if a.store != nil {
+		a.flushStore()
+		return
+	}
+
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -367,14 +450,18 @@ func (a *AddrManager) savePeers() {
 	sam := new(serializedAddrManager)
 	sam.Version = a.version
 	copy(sam.Key[:], a.key[:])
+	sam.ASMap = a.asmapChecksum()
 
-	sam.Addresses = make([]*serializedKnownAddress, len(a.addrIndex))
-	i := 0
+	sam.Addresses = make([]*serializedKnownAddress, 0, len(a.addrIndex))
 	for k, v := range a.addrIndex {
+		if !a.isSerializable(v.na) {
+			continue
+		}
+
 		ska := new(serializedKnownAddress)
 		ska.Addr = k
 		ska.TimeStamp = v.na.Timestamp.Unix()
-		ska.Src = NetAddressKey(v.srcAddr)
+		ska.Src = v.srcAddr.String()
 		ska.Attempts = v.attempts
 		ska.LastAttempt = v.lastattempt.Unix()
 		ska.LastSuccess = v.lastsuccess.Unix()
@@ -382,26 +469,29 @@ func (a *AddrManager) savePeers() {
 			ska.Services = v.na.Services
 			ska.SrcServices = v.srcAddr.Services
 		}
+		if a.version > 2 {
+			ska.Network = v.na.NetworkID
+		}
 		// Tried and refs are implicit in the rest of the structure
 		// and will be worked out from context on unserialisation.
-		sam.Addresses[i] = ska
-		i++
+		sam.Addresses = append(sam.Addresses, ska)
 	}
 	for i := range a.addrNew {
-		sam.NewBuckets[i] = make([]string, len(a.addrNew[i]))
-		j := 0
-		for k := range a.addrNew[i] {
-			sam.NewBuckets[i][j] = k
-			j++
+		sam.NewBuckets[i] = make([]string, 0, len(a.addrNew[i]))
+		for k, v := range a.addrNew[i] {
+			if a.isSerializable(v.na) {
+				sam.NewBuckets[i] = append(sam.NewBuckets[i], k)
+			}
 		}
 	}
 	for i := range a.addrTried {
-		sam.TriedBuckets[i] = make([]string, a.addrTried[i].Len())
-		j := 0
+		sam.TriedBuckets[i] = make([]string, 0, a.addrTried[i].Len())
 		for e := a.addrTried[i].Front(); e != nil; e = e.Next() {
 			ka := e.Value.(*KnownAddress)
-			sam.TriedBuckets[i][j] = NetAddressKey(ka.na)
-			j++
+			if a.isSerializable(ka.na) {
+				sam.TriedBuckets[i] = append(sam.TriedBuckets[i],
+					ka.na.String())
+			}
 		}
 	}
 
@@ -421,6 +511,11 @@ func (a *AddrManager) savePeers() {
 // loadPeers loads the known address from the saved file.  If empty, missing, or
 // malformed file, just don't load anything and start fresh
 func (a *AddrManager) loadPeers() {
+	if a.store != nil {
+		a.loadStore()
+		return
+	}
+
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -458,6 +553,11 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 		return fmt.Errorf("error reading %s: %v", filePath, err)
 	}
 
+	return a.deserialize(&sam)
+}
+
+// deserialize loads the addresses of the passed serialized address manager.
+func (a *AddrManager) deserialize(sam *serializedAddrManager) error {
 	// Since decoding JSON is backwards compatible (i.e., only decodes
 	// fields it understands), we'll only return an error upon seeing a
 	// version past our latest supported version.
@@ -468,6 +568,7 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 
 	copy(a.key[:], sam.Key[:])
 
+	var err error
 	for _, v := range sam.Addresses {
 		ka := new(KnownAddress)
 
@@ -477,19 +578,34 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 		if sam.Version == 1 {
 			v.Services = wire.SFNodeNetwork
 		}
-		ka.na, err = a.DeserializeNetAddress(v.Addr, v.Services)
+		ka.na, err = a.deserializeNetAddressV2(v.Addr, v.Services)
 		if err != nil {
 			return fmt.Errorf("failed to deserialize netaddress "+
 				"%s: %v", v.Addr, err)
 		}
 
+		// Versions prior to the third one did not store the network of
+		// the addresses, which is only needed for CJDNS addresses as
+		// the network of all other addresses is implied by their host.
+		if v.Network == wire.NetworkCJDNS {
+			ka.na, err = toCJDNS(ka.na)
+			if err != nil {
+				return fmt.Errorf("failed to deserialize "+
+					"netaddress %s: %v", v.Addr, err)
+			}
+		}
+		if v.Network != 0 && v.Network != ka.na.NetworkID {
+			return fmt.Errorf("netaddress %s is not part of "+
+				"network %v", v.Addr, v.Network)
+		}
+
 		// The first version of the serialized address manager was not
 		// aware of the service bits associated with the source address,
 		// so we'll assign a default of SFNodeNetwork to it.
 		if sam.Version == 1 {
 			v.SrcServices = wire.SFNodeNetwork
 		}
-		ka.srcAddr, err = a.DeserializeNetAddress(v.Src, v.SrcServices)
+		ka.srcAddr, err = a.deserializeNetAddressV2(v.Src, v.SrcServices)
 		if err != nil {
 			return fmt.Errorf("failed to deserialize netaddress "+
 				"%s: %v", v.Src, err)
@@ -498,7 +614,16 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 		ka.attempts = v.Attempts
 		ka.lastattempt = time.Unix(v.LastAttempt, 0)
 		ka.lastsuccess = time.Unix(v.LastSuccess, 0)
-		a.addrIndex[NetAddressKey(ka.na)] = ka
+		a.addrIndex[ka.na.String()] = ka
+	}
+
+	// The buckets depend on the group keys of the addresses, so they are
+	// recalculated when the addresses were bucketed with a different AS
+	// map.
+	rebucket := sam.ASMap != a.asmapChecksum()
+	if rebucket {
+		log.Infof("AS map changed since the addresses were saved, " +
+			"rebucketing them")
 	}
 
 	for i := range sam.NewBuckets {
@@ -509,11 +634,20 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 					"none in address list", val)
 			}
 
+			bucket := i
+			if rebucket {
+				bucket = a.getNewBucket(ka.na, ka.srcAddr)
+				if _, ok := a.addrNew[bucket][val]; ok ||
+					len(a.addrNew[bucket]) >= newBucketSize {
+
+					continue
+				}
+			}
 			if ka.refs == 0 {
 				a.nNew++
 			}
 			ka.refs++
-			a.addrNew[i][val] = ka
+			a.addrNew[bucket][val] = ka
 		}
 	}
 	for i := range sam.TriedBuckets {
@@ -524,9 +658,29 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 					"none in address list", val)
 			}
 
+			bucket := i
+			if rebucket {
+				bucket = a.getTriedBucket(ka.na)
+				if a.addrTried[bucket].Len() >= triedBucketSize {
+					// Drop the address since it no longer
+					// fits into its tried bucket.
+					delete(a.addrIndex, val)
+					continue
+				}
+			}
 			ka.tried = true
 			a.nTried++
-			a.addrTried[i].PushBack(ka)
+			a.addrTried[bucket].PushBack(ka)
+		}
+	}
+
+	// New addresses which did not fit into any of their recalculated
+	// buckets are dropped.
+	if rebucket {
+		for k, v := range a.addrIndex {
+			if v.refs == 0 && !v.tried {
+				delete(a.addrIndex, k)
+			}
 		}
 	}
 
@@ -562,6 +716,53 @@ func (a *AddrManager) DeserializeNetAddress(addr string,
 	return a.HostToNetAddress(host, uint16(port), services)
 }
 
+// deserializeNetAddressV2 converts a given address string to a
+// *wire.NetAddressV2.  Unlike DeserializeNetAddress, it also handles the host
+// names of Tor v3 and I2P addresses.
+func (a *AddrManager) deserializeNetAddressV2(addr string,
+	services wire.ServiceFlag) (*wire.NetAddressV2, error) {
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	networkID, hostAddr, ok := wire.ParseNetAddressV2Host(host)
+	if ok && networkID != wire.NetworkTorV2 {
+		return wire.NewNetAddressV2(networkID, hostAddr, uint16(port),
+			services), nil
+	}
+
+	na, err := a.HostToNetAddress(host, uint16(port), services)
+	if err != nil {
+		return nil, err
+	}
+	return wire.NetAddressV2FromLegacy(na), nil
+}
+
+// toCJDNS returns the CJDNS address with the same IPv6 address as the passed
+// address.
+func toCJDNS(na *wire.NetAddressV2) (*wire.NetAddressV2, error) {
+	cjdns := *na
+	cjdns.NetworkID = wire.NetworkCJDNS
+	if na.NetworkID != wire.NetworkIPv6 || !cjdns.IsKnownNetwork() {
+		return nil, fmt.Errorf("%s is not a CJDNS address", na)
+	}
+	return &cjdns, nil
+}
+
+// isSerializable returns whether the passed address can be written to the
+// peers file.  CJDNS addresses can't be told apart from IPv6 addresses by
+// their address string, so they are only kept in memory by versions of the
+// on-disk format which don't store the network of the addresses.
+func (a *AddrManager) isSerializable(na *wire.NetAddressV2) bool {
+	return a.version > 2 || na.NetworkID != wire.NetworkCJDNS
+}
+
 // Start begins the core address handler which manages a pool of known
 // addresses, timeouts, and interval based writes.
 func (a *AddrManager) Start() {
@@ -591,6 +792,9 @@ func (a *AddrManager) Stop() error {
 	log.Infof("Address manager shutting down")
 	close(a.quit)
 	a.wg.Wait()
+	if a.store != nil {
+		return a.store.Close()
+	}
 	return nil
 }
 
@@ -601,8 +805,24 @@ func (a *AddrManager) AddAddresses(addrs []*wire.NetAddress, srcAddr *wire.NetAd
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
+	srcAddrV2 := wire.NetAddressV2FromLegacy(srcAddr)
 	for _, na := range addrs {
-		a.updateAddress(na, srcAddr)
+		a.updateAddress(wire.NetAddressV2FromLegacy(na), srcAddrV2)
+	}
+}
+
+// AddAddressesV2 adds new addresses received in an addrv2 message to the
+// address manager.  Unlike AddAddresses, it is able to store the addresses of
+// networks which can't be represented by a wire.NetAddress, such as Tor v3,
+// I2P, and CJDNS.  Addresses of unknown networks are ignored.  It is safe for
+// concurrent access.
+func (a *AddrManager) AddAddressesV2(addrs []*wire.NetAddressV2, srcAddr *wire.NetAddress) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	srcAddrV2 := wire.NetAddressV2FromLegacy(srcAddr)
+	for _, na := range addrs {
+		a.updateAddress(na, srcAddrV2)
 	}
 }
 
@@ -613,7 +833,8 @@ func (a *AddrManager) AddAddress(addr, srcAddr *wire.NetAddress) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
-	a.updateAddress(addr, srcAddr)
+	a.updateAddress(wire.NetAddressV2FromLegacy(addr),
+		wire.NetAddressV2FromLegacy(srcAddr))
 }
 
 // AddAddressByIP adds an address where we are given an ip:port and not a
@@ -661,11 +882,46 @@ func (a *AddrManager) NeedMoreAddresses() bool {
 }
 
 // AddressCache returns the current address cache.  It must be treated as
-// read-only (but since it is a copy now, this is not as dangerous).
+// read-only (but since it is a copy now, this is not as dangerous).  Only the
+// addresses which can be represented by a wire.NetAddress are included.
 func (a *AddrManager) AddressCache() []*wire.NetAddress {
-	allAddr := a.getAddresses()
+	allAddr := a.getAddresses(true)
 
-	numAddresses := len(allAddr) * getAddrPercent / 100
+	a.mtx.Lock()
+	numAddresses := sampleAddresses(a.rand, len(allAddr), func(i, j int) {
+		allAddr[i], allAddr[j] = allAddr[j], allAddr[i]
+	})
+	a.mtx.Unlock()
+
+	// slice off the limit we are willing to share.
+	addrs := make([]*wire.NetAddress, 0, numAddresses)
+	for _, na := range allAddr[0:numAddresses] {
+		addrs = append(addrs, na.ToLegacy())
+	}
+	return addrs
+}
+
+// AddressCacheV2 returns the current address cache including the addresses of
+// networks which can't be represented by a wire.NetAddress for peers which
+// want addrv2 messages.  It must be treated as read-only.
+func (a *AddrManager) AddressCacheV2() []*wire.NetAddressV2 {
+	allAddr := a.getAddresses(false)
+
+	a.mtx.Lock()
+	numAddresses := sampleAddresses(a.rand, len(allAddr), func(i, j int) {
+		allAddr[i], allAddr[j] = allAddr[j], allAddr[i]
+	})
+	a.mtx.Unlock()
+
+	// slice off the limit we are willing to share.
+	return allAddr[0:numAddresses]
+}
+
+// sampleAddresses determines the number of addresses to share out of the
+// passed total and moves a random selection of them, drawn from the passed
+// source of randomness, to the front using the passed swap function.
+func sampleAddresses(rng *rand.Rand, total int, swap func(i, j int)) int {
+	numAddresses := total * getAddrPercent / 100
 	if numAddresses > getAddrMax {
 		numAddresses = getAddrMax
 	}
@@ -674,17 +930,17 @@ func (a *AddrManager) AddressCache() []*wire.NetAddress {
 	// `numAddresses' since we are throwing the rest.
 	for i := 0; i < numAddresses; i++ {
 		// pick a number between current index and the end
-		j := rand.Intn(len(allAddr)-i) + i
-		allAddr[i], allAddr[j] = allAddr[j], allAddr[i]
+		j := rng.Intn(total-i) + i
+		swap(i, j)
 	}
 
-	// slice off the limit we are willing to share.
-	return allAddr[0:numAddresses]
+	return numAddresses
 }
 
 // getAddresses returns all of the addresses currently found within the
-// manager's address cache.
-func (a *AddrManager) getAddresses() []*wire.NetAddress {
+// manager's address cache.  Only the addresses which can be represented by a
+// wire.NetAddress are returned when legacyOnly is set.
+func (a *AddrManager) getAddresses(legacyOnly bool) []*wire.NetAddressV2 {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -693,11 +949,21 @@ func (a *AddrManager) getAddresses() []*wire.NetAddress {
 		return nil
 	}
 
-	addrs := make([]*wire.NetAddress, 0, addrIndexLen)
+	addrs := make([]*wire.NetAddressV2, 0, addrIndexLen)
 	for _, v := range a.addrIndex {
+		if legacyOnly && !v.na.IsLegacy() {
+			continue
+		}
 		addrs = append(addrs, v.na)
 	}
 
+	// Order the addresses for the same reason as nthNewAddress does.
+	if a.deterministic {
+		sort.Slice(addrs, func(i, j int) bool {
+			return addrs[i].String() < addrs[j].String()
+		})
+	}
+
 	return addrs
 }
 
@@ -706,6 +972,7 @@ func (a *AddrManager) getAddresses() []*wire.NetAddress {
 func (a *AddrManager) reset() {
 
 	a.addrIndex = make(map[string]*KnownAddress)
+	a.dirty = make(map[string]struct{})
 
 	// fill key with bytes from a good random source.
 	io.ReadFull(crand.Reader, a.key[:])
@@ -772,7 +1039,11 @@ func NetAddressKey(na *wire.NetAddress) string {
 // GetAddress returns a single address that should be routable.  It picks a
 // random one from the possible addresses with preference given to ones that
 // have not been used recently and should not pick 'close' addresses
-// consecutively.
+// consecutively.  When scoring is enabled via SetScoreWeights, the preference
+// is further biased toward addresses which recently succeeded, have a low
+// latency, and advertise the preferred services.  The returned address may
+// belong to a network which can't be represented by a wire.NetAddress, in which
+// case its NetAddress method returns nil.
 func (a *AddrManager) GetAddress() *KnownAddress {
 	// Protect concurrent access.
 	a.mtx.Lock()
@@ -781,6 +1052,7 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 	if a.numAddresses() == 0 {
 		return nil
 	}
+	now := a.now()
 
 	// Use a 50% chance for choosing between tried and new table entries.
 	if a.nTried > 0 && (a.nNew == 0 || a.rand.Intn(2) == 0) {
@@ -802,9 +1074,9 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 			}
 			ka := e.Value.(*KnownAddress)
 			randval := a.rand.Intn(large)
-			if float64(randval) < (factor * ka.chance() * float64(large)) {
+			if float64(randval) < (factor * ka.score(&a.weights, now) * float64(large)) {
 				log.Tracef("Selected %v from tried bucket",
-					NetAddressKey(ka.na))
+					ka.na)
 				return ka
 			}
 			factor *= 1.2
@@ -821,18 +1093,12 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 				continue
 			}
 			// Then, a random entry in it.
-			var ka *KnownAddress
 			nth := a.rand.Intn(len(a.addrNew[bucket]))
-			for _, value := range a.addrNew[bucket] {
-				if nth == 0 {
-					ka = value
-				}
-				nth--
-			}
+			ka := a.nthNewAddress(bucket, nth)
 			randval := a.rand.Intn(large)
-			if float64(randval) < (factor * ka.chance() * float64(large)) {
+			if float64(randval) < (factor * ka.score(&a.weights, now) * float64(large)) {
 				log.Tracef("Selected %v from new bucket",
-					NetAddressKey(ka.na))
+					ka.na)
 				return ka
 			}
 			factor *= 1.2
@@ -840,6 +1106,31 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 	}
 }
 
+// nthNewAddress returns the nth address of the passed new bucket.  The order
+// of the addresses is the random order of map iteration unless the source of
+// randomness was injected via SetRandSource, in which case they are ordered by
+// their keys.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) nthNewAddress(bucket, nth int) *KnownAddress {
+	if a.deterministic {
+		keys := make([]string, 0, len(a.addrNew[bucket]))
+		for k := range a.addrNew[bucket] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return a.addrNew[bucket][keys[nth]]
+	}
+
+	for _, value := range a.addrNew[bucket] {
+		if nth == 0 {
+			return value
+		}
+		nth--
+	}
+	return nil
+}
+
 func (a *AddrManager) find(addr *wire.NetAddress) *KnownAddress {
 	return a.addrIndex[NetAddressKey(addr)]
 }
@@ -847,6 +1138,17 @@ func (a *AddrManager) find(addr *wire.NetAddress) *KnownAddress {
 // Attempt increases the given address' attempt counter and updates
 // the last attempt time.
 func (a *AddrManager) Attempt(addr *wire.NetAddress) {
+	a.AttemptEvent(addr, AddressEvent{Reason: ReasonUnspecified})
+}
+
+// AttemptEvent reports an attempt to connect to the given address.  Events
+// without a failure reason, such as ReasonConnecting, increase the address'
+// attempt counter and update the last attempt time like Attempt.  Events with a
+// failure reason, such as ReasonTimeout or ReasonMisbehavior, describe the
+// outcome of the last attempt rather than another one and record the reason,
+// which further lowers the chance of the address to be selected until the next
+// successful connection.
+func (a *AddrManager) AttemptEvent(addr *wire.NetAddress, ev AddressEvent) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -856,9 +1158,16 @@ func (a *AddrManager) Attempt(addr *wire.NetAddress) {
 	if ka == nil {
 		return
 	}
+	if ev.Reason.isFailure() {
+		log.Debugf("Attempt to connect to %s failed: %v", ka.na,
+			ev.Reason)
+		ka.lastFailure = ev.Reason
+		return
+	}
 	// set last tried time to now
 	ka.attempts++
-	ka.lastattempt = time.Now()
+	ka.lastattempt = a.now()
+	a.markDirty(ka.na.String())
 }
 
 // Connected Marks the given address as currently connected and working at the
@@ -875,12 +1184,13 @@ func (a *AddrManager) Connected(addr *wire.NetAddress) {
 
 	// Update the time as long as it has been 20 minutes since last we did
 	// so.
-	now := time.Now()
+	now := a.now()
 	if now.After(ka.na.Timestamp.Add(time.Minute * 20)) {
 		// ka.na is immutable, so replace it.
 		naCopy := *ka.na
-		naCopy.Timestamp = time.Now()
+		naCopy.Timestamp = now
 		ka.na = &naCopy
+		a.markDirty(ka.na.String())
 	}
 }
 
@@ -888,6 +1198,13 @@ func (a *AddrManager) Connected(addr *wire.NetAddress) {
 // connection and version exchange.  If the address is unknown to the address
 // manager it will be ignored.
 func (a *AddrManager) Good(addr *wire.NetAddress) {
+	a.GoodEvent(addr, AddressEvent{Reason: ReasonUnspecified})
+}
+
+// GoodEvent marks the given address as good like Good and records the latency
+// of the connection when the event has one, so it is taken into account when
+// addresses are scored.  Any failure reason of the last attempt is cleared.
+func (a *AddrManager) GoodEvent(addr *wire.NetAddress, ev AddressEvent) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
@@ -898,10 +1215,15 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 
 	// ka.Timestamp is not updated here to avoid leaking information
 	// about currently connected peers.
-	now := time.Now()
+	now := a.now()
 	ka.lastsuccess = now
 	ka.lastattempt = now
 	ka.attempts = 0
+	ka.lastFailure = ReasonUnspecified
+	if ev.Latency > 0 {
+		ka.latency = ev.Latency
+	}
+	a.markDirty(ka.na.String())
 
 	// move to tried set, optionally evicting other addresses if neeed.
 	if ka.tried {
@@ -966,11 +1288,12 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 	// something back.
 	a.nNew++
 
-	rmkey := NetAddressKey(rmka.na)
+	rmkey := rmka.na.String()
 	log.Tracef("Replacing %s with %s in tried", rmkey, addrKey)
 
 	// We made sure there is space here just above.
 	a.addrNew[newBucket][rmkey] = rmka
+	a.markDirty(rmkey)
 }
 
 // SetServices sets the services for the giiven address to the provided value.
@@ -989,6 +1312,7 @@ func (a *AddrManager) SetServices(addr *wire.NetAddress, services wire.ServiceFl
 		naCopy := *ka.na
 		naCopy.Services = services
 		ka.na = &naCopy
+		a.markDirty(ka.na.String())
 	}
 }
 
@@ -1135,6 +1459,43 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *wire.NetAddress) *wire.Net
 	return bestAddress
 }
 
+// SetASMap sets the AS map used to group addresses by the autonomous system
+// which announces them.  See ASGroupKey for details.  Addresses are grouped by
+// their prefix when no AS map is set.
+//
+// This function must be called before Start.
+func (a *AddrManager) SetASMap(asmap *ASMap) {
+	a.mtx.Lock()
+	a.asmap = asmap
+	a.mtx.Unlock()
+}
+
+// asmapChecksum returns the checksum of the AS map of the address manager or
+// an empty string when it does not have one.
+func (a *AddrManager) asmapChecksum() string {
+	if a.asmap == nil {
+		return ""
+	}
+	return a.asmap.Checksum()
+}
+
+// GroupKey returns a string representing the network group the passed address
+// is part of.  It takes the AS map of the address manager into account, so
+// callers which limit the number of connections per network group, such as
+// outbound peer diversification, group addresses the same way the address
+// manager buckets them.  See ASGroupKey for details.
+//
+// This function is safe for concurrent access after Start.
+func (a *AddrManager) GroupKey(na *wire.NetAddress) string {
+	return ASGroupKey(na, a.asmap)
+}
+
+// groupKeyV2 returns a string representing the network group the passed
+// address is part of taking the AS map of the address manager into account.
+func (a *AddrManager) groupKeyV2(na *wire.NetAddressV2) string {
+	return groupKeyV2(na, a.asmap)
+}
+
 // New returns a new bitcoin address manager.
 // Use Start to begin processing asynchronous address updates.
 func New(dataDir string, lookupFunc func(string) ([]net.IP, error)) *AddrManager {
@@ -1145,6 +1506,7 @@ func New(dataDir string, lookupFunc func(string) ([]net.IP, error)) *AddrManager
 		quit:           make(chan struct{}),
 		localAddresses: make(map[string]*localAddress),
 		version:        serialisationVersion,
+		clock:          systemClock{},
 	}
 	am.reset()
 	return &am
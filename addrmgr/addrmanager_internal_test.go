@@ -5,7 +5,9 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/wire"
 )
@@ -53,6 +55,16 @@ func assertAddr(t *testing.T, got, expected *wire.NetAddress) {
 	}
 }
 
+// legacyAddresses returns the addresses in the manager's address cache which
+// can be represented by a *wire.NetAddress.
+func legacyAddresses(addrMgr *AddrManager) []*wire.NetAddress {
+	var addrs []*wire.NetAddress
+	for _, na := range addrMgr.getAddresses(true) {
+		addrs = append(addrs, na.ToLegacy())
+	}
+	return addrs
+}
+
 // assertAddrs ensures that the manager's address cache matches the given
 // expected addresses.
 func assertAddrs(t *testing.T, addrMgr *AddrManager,
@@ -60,7 +72,7 @@ func assertAddrs(t *testing.T, addrMgr *AddrManager,
 
 	t.Helper()
 
-	addrs := addrMgr.getAddresses()
+	addrs := legacyAddresses(addrMgr)
 
 	if len(addrs) != len(expectedAddrs) {
 		t.Fatalf("expected to find %d addresses, found %d",
@@ -160,7 +172,7 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 	// that this default is set, we'll override each addresses' services
 	// with the original value from when they were created.
 	addrMgr.loadPeers()
-	addrs := addrMgr.getAddresses()
+	addrs := legacyAddresses(addrMgr)
 	if len(addrs) != len(expectedAddrs) {
 		t.Fatalf("expected to find %d adddresses, found %d",
 			len(expectedAddrs), len(addrs))
@@ -192,3 +204,299 @@ func TestAddrManagerV1ToV2(t *testing.T) {
 	addrMgr.loadPeers()
 	assertAddrs(t, addrMgr, expectedAddrs)
 }
+
+// TestAddrManagerAddrV2 ensures addresses of networks which can't be
+// represented by a *wire.NetAddress are stored, only returned to callers which
+// understand them, and that Tor v3, I2P, and CJDNS addresses are persisted.
+func TestAddrManagerAddrV2(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "addrmgr")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	addrMgr := New(tempDir, nil)
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	cjdns := make([]byte, 16)
+	rand.Read(cjdns)
+	cjdns[0] = 0xfc
+	addrs := []*wire.NetAddressV2{
+		wire.NewNetAddressV2(wire.NetworkTorV3, key, 8333,
+			wire.SFNodeNetwork),
+		wire.NewNetAddressV2(wire.NetworkI2P, key, 0,
+			wire.SFNodeNetwork),
+		wire.NewNetAddressV2(wire.NetworkCJDNS, cjdns, 8333,
+			wire.SFNodeNetwork),
+		wire.NewNetAddressV2(wire.NetworkIPv4, []byte{173, 194, 115, 66},
+			8333, wire.SFNodeNetwork),
+
+		// Addresses of unknown networks are ignored.
+		wire.NewNetAddressV2(wire.NetworkID(0x42), key, 8333,
+			wire.SFNodeNetwork),
+	}
+	srcAddr := wire.NewNetAddressIPPort(net.ParseIP("173.194.115.67"),
+		8333, wire.SFNodeNetwork)
+	addrMgr.AddAddressesV2(addrs, srcAddr)
+
+	assertKeys := func(got []*wire.NetAddressV2, want []*wire.NetAddressV2) {
+		t.Helper()
+
+		wantKeys := make(map[string]struct{}, len(want))
+		for _, na := range want {
+			wantKeys[na.String()] = struct{}{}
+		}
+		if len(got) != len(wantKeys) {
+			t.Fatalf("expected to find %d addresses, found %d",
+				len(wantKeys), len(got))
+		}
+		for _, na := range got {
+			if _, ok := wantKeys[na.String()]; !ok {
+				t.Fatalf("unexpected address %v", na)
+			}
+		}
+	}
+	assertKeys(addrMgr.getAddresses(false), addrs[:4])
+
+	// Only the IPv4 address can be returned to legacy callers.
+	legacy := legacyAddresses(addrMgr)
+	if len(legacy) != 1 || NetAddressKey(legacy[0]) != addrs[3].String() {
+		t.Fatalf("unexpected legacy addresses %v", legacy)
+	}
+
+	// All of the addresses survive a restart and keep their network.
+	addrMgr.savePeers()
+	addrMgr = New(tempDir, nil)
+	addrMgr.loadPeers()
+	assertKeys(addrMgr.getAddresses(false), addrs[:4])
+	for _, na := range addrMgr.getAddresses(false) {
+		if na.Services != wire.SFNodeNetwork {
+			t.Fatalf("unexpected services for address %v - got %v, "+
+				"want %v", na, na.Services, wire.SFNodeNetwork)
+		}
+		if na.String() == addrs[2].String() &&
+			na.NetworkID != wire.NetworkCJDNS {
+
+			t.Fatalf("unexpected network for address %v - got %v, "+
+				"want %v", na, na.NetworkID, wire.NetworkCJDNS)
+		}
+	}
+
+	// CJDNS addresses are only kept in memory by the second version of the
+	// on-disk format since it can't tell them apart from IPv6 addresses.
+	addrMgr.version = 2
+	addrMgr.savePeers()
+	addrMgr = New(tempDir, nil)
+	addrMgr.loadPeers()
+	assertKeys(addrMgr.getAddresses(false), []*wire.NetAddressV2{
+		addrs[0], addrs[1], addrs[3],
+	})
+}
+
+// TestAddrManagerEvictionNetwork ensures addresses are evicted from full
+// buckets by the network with the most addresses in the bucket, so the
+// addresses of one network can't push out the addresses of another network.
+func TestAddrManagerEvictionNetwork(t *testing.T) {
+	t.Parallel()
+
+	addrMgr := New("", nil)
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	// Fill a new and a tried bucket with an I2P address which is older
+	// than the IPv4 addresses sharing the bucket with it.
+	now := time.Now()
+	i2p := &KnownAddress{
+		na: wire.NewNetAddressV2(wire.NetworkI2P, key, 0,
+			wire.SFNodeNetwork),
+	}
+	i2p.na.Timestamp = now.Add(-time.Hour)
+	kas := []*KnownAddress{i2p}
+	for i := 0; i < 3; i++ {
+		ka := &KnownAddress{
+			na: wire.NewNetAddressV2(wire.NetworkIPv4,
+				[]byte{173, 194, 115, byte(i)}, 8333,
+				wire.SFNodeNetwork),
+		}
+		ka.na.Timestamp = now.Add(time.Duration(i) * time.Minute)
+		kas = append(kas, ka)
+	}
+	for _, ka := range kas {
+		ka.refs = 1
+		ka.lastsuccess = now
+		addrMgr.addrIndex[ka.na.String()] = ka
+		addrMgr.addrNew[0][ka.na.String()] = ka
+		addrMgr.addrTried[0].PushBack(ka)
+	}
+	addrMgr.nNew = len(kas)
+
+	// The oldest IPv4 address is evicted rather than the I2P address.
+	addrMgr.expireNew(0)
+	if _, ok := addrMgr.addrNew[0][i2p.na.String()]; !ok {
+		t.Fatal("I2P address was evicted from new bucket")
+	}
+	if _, ok := addrMgr.addrNew[0][kas[1].na.String()]; ok {
+		t.Fatal("oldest IPv4 address was not evicted from new bucket")
+	}
+
+	elem := addrMgr.pickTried(0)
+	if elem.Value.(*KnownAddress) != kas[1] {
+		t.Fatalf("picked %v for eviction from tried bucket, want %v",
+			elem.Value.(*KnownAddress).na, kas[1].na)
+	}
+}
+
+// TestAddrManagerASMapRebucket ensures the addresses are moved to the buckets
+// determined by their AS when the AS map changes between restarts.
+func TestAddrManagerASMapRebucket(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "addrmgr")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	addrMgr := New(tempDir, nil)
+	srcAddr := wire.NewNetAddressIPPort(net.ParseIP("173.1.2.3"), 8333, 0)
+	expectedAddrs := make(map[string]*wire.NetAddress)
+	for i := 1; i <= 20; i++ {
+		addr := wire.NewNetAddressIPPort(net.IPv4(byte(i*10+1), 1, 2, 3),
+			8333, wire.SFNodeNetwork)
+		expectedAddrs[NetAddressKey(addr)] = addr
+		addrMgr.AddAddress(addr, srcAddr)
+		if i%2 == 0 {
+			addrMgr.Good(addr)
+		}
+	}
+	addrMgr.savePeers()
+
+	// Restart the address manager with an AS map and ensure all of the
+	// addresses are in the buckets determined by their AS.
+	asmap := testASMap(t)
+	addrMgr = New(tempDir, nil)
+	addrMgr.SetASMap(asmap)
+	addrMgr.loadPeers()
+	assertAddrs(t, addrMgr, expectedAddrs)
+	for i := range addrMgr.addrNew {
+		for _, ka := range addrMgr.addrNew[i] {
+			if bucket := addrMgr.getNewBucket(ka.na, ka.srcAddr); bucket != i {
+				t.Fatalf("new address %v in bucket %d, want %d",
+					ka.na, i, bucket)
+			}
+		}
+	}
+	for i := range addrMgr.addrTried {
+		for e := addrMgr.addrTried[i].Front(); e != nil; e = e.Next() {
+			ka := e.Value.(*KnownAddress)
+			if bucket := addrMgr.getTriedBucket(ka.na); bucket != i {
+				t.Fatalf("tried address %v in bucket %d, want %d",
+					ka.na, i, bucket)
+			}
+		}
+	}
+	if addrMgr.nTried != 10 {
+		t.Fatalf("got %d tried addresses, want 10", addrMgr.nTried)
+	}
+	if key := addrMgr.GroupKey(srcAddr); key != "as200" {
+		t.Fatalf("unexpected group key %q", key)
+	}
+
+	// The AS map is persisted along with the addresses.
+	addrMgr.savePeers()
+	addrMgr = New(tempDir, nil)
+	addrMgr.SetASMap(asmap)
+	if err := addrMgr.deserializePeers(addrMgr.peersFile); err != nil {
+		t.Fatalf("unable to load peers: %v", err)
+	}
+	assertAddrs(t, addrMgr, expectedAddrs)
+}
+
+// TestAddrManagerLevelDBStore ensures the addresses are imported from the peers
+// file into an empty leveldb store and that changes to them are written to
+// the store incrementally.
+func TestAddrManagerLevelDBStore(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "addrmgr")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	storePath := filepath.Join(tempDir, "peers.ldb")
+
+	// newStoreAddrManager returns an address manager which loaded its
+	// addresses from the store.
+	newStoreAddrManager := func() *AddrManager {
+		t.Helper()
+
+		store, err := OpenLevelDBStore(storePath)
+		if err != nil {
+			t.Fatalf("unable to open store: %v", err)
+		}
+		addrMgr := New(tempDir, nil)
+		addrMgr.SetStore(store)
+		addrMgr.loadPeers()
+		return addrMgr
+	}
+
+	addrMgr := New(tempDir, nil)
+	srcAddr := wire.NewNetAddressIPPort(net.ParseIP("173.1.2.3"), 8333, 0)
+	expectedAddrs := make(map[string]*wire.NetAddress)
+	for i := 1; i <= 10; i++ {
+		addr := wire.NewNetAddressIPPort(net.IPv4(byte(i*10+1), 1, 2, 3),
+			8333, wire.SFNodeNetwork)
+		expectedAddrs[NetAddressKey(addr)] = addr
+		addrMgr.AddAddress(addr, srcAddr)
+		if i%2 == 0 {
+			addrMgr.Good(addr)
+		}
+	}
+	addrMgr.savePeers()
+
+	// The addresses of the peers file are imported into the empty store.
+	addrMgr = newStoreAddrManager()
+	assertAddrs(t, addrMgr, expectedAddrs)
+	addrMgr.savePeers()
+	if err := addrMgr.store.Close(); err != nil {
+		t.Fatalf("unable to close store: %v", err)
+	}
+	if err := os.Remove(addrMgr.peersFile); err != nil {
+		t.Fatalf("unable to remove peers file: %v", err)
+	}
+
+	// The addresses are loaded from the store along with their buckets.
+	addrMgr = newStoreAddrManager()
+	assertAddrs(t, addrMgr, expectedAddrs)
+	if addrMgr.nTried != 5 {
+		t.Fatalf("got %d tried addresses, want 5", addrMgr.nTried)
+	}
+
+	// Only the changed addresses are written to the store.
+	addr := wire.NewNetAddressIPPort(net.ParseIP("173.194.115.66"), 8333,
+		wire.SFNodeNetwork)
+	expectedAddrs[NetAddressKey(addr)] = addr
+	addrMgr.AddAddress(addr, srcAddr)
+	addrMgr.Attempt(addr)
+	if len(addrMgr.dirty) != 1 {
+		t.Fatalf("got %d changed addresses, want 1", len(addrMgr.dirty))
+	}
+	addrMgr.savePeers()
+	if len(addrMgr.dirty) != 0 {
+		t.Fatalf("got %d changed addresses after saving, want 0",
+			len(addrMgr.dirty))
+	}
+	if err := addrMgr.store.Close(); err != nil {
+		t.Fatalf("unable to close store: %v", err)
+	}
+
+	addrMgr = newStoreAddrManager()
+	defer addrMgr.store.Close()
+	assertAddrs(t, addrMgr, expectedAddrs)
+	if ka := addrMgr.find(addr); ka == nil || ka.attempts != 1 {
+		t.Fatalf("unexpected address %v after restart", ka)
+	}
+}
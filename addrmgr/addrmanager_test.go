@@ -7,6 +7,7 @@ package addrmgr_test
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"reflect"
 	"testing"
@@ -230,6 +231,115 @@ func TestAttempt(t *testing.T) {
 	}
 }
 
+// TestAttemptEvent ensures failure reasons are recorded without counting as
+// another attempt and that a good event clears them and records the latency.
+func TestAttemptEvent(t *testing.T) {
+	n := addrmgr.New("testattemptevent", lookupFunc)
+
+	err := n.AddAddressByIP(someIP + ":8333")
+	if err != nil {
+		t.Fatalf("Adding address failed: %v", err)
+	}
+	ka := n.GetAddress()
+	na := ka.NetAddress()
+
+	n.AttemptEvent(na, addrmgr.AddressEvent{Reason: addrmgr.ReasonConnecting})
+	if ka.LastAttempt().IsZero() {
+		t.Fatal("Address should have an attempt, but does not")
+	}
+	chance := addrmgr.TstKnownAddressChance(ka)
+
+	n.AttemptEvent(na, addrmgr.AddressEvent{Reason: addrmgr.ReasonMisbehavior})
+	if ka.LastFailure() != addrmgr.ReasonMisbehavior {
+		t.Fatalf("Last failure is %v, want %v", ka.LastFailure(),
+			addrmgr.ReasonMisbehavior)
+	}
+	if got := addrmgr.TstKnownAddressChance(ka); got >= chance {
+		t.Fatalf("Chance after misbehavior %f is not below %f", got,
+			chance)
+	}
+
+	n.GoodEvent(na, addrmgr.AddressEvent{
+		Reason:  addrmgr.ReasonHandshake,
+		Latency: 150 * time.Millisecond,
+	})
+	if ka.LastFailure() != addrmgr.ReasonUnspecified {
+		t.Fatalf("Last failure %v was not cleared", ka.LastFailure())
+	}
+	if ka.Latency() != 150*time.Millisecond {
+		t.Fatalf("Latency is %v, want %v", ka.Latency(),
+			150*time.Millisecond)
+	}
+
+	// Good events without a latency keep the last one.
+	n.Good(na)
+	if ka.Latency() != 150*time.Millisecond {
+		t.Fatalf("Latency is %v, want %v", ka.Latency(),
+			150*time.Millisecond)
+	}
+}
+
+// fakeClock is an addrmgr.Clock which returns a time controlled by the tests.
+type fakeClock struct {
+	now time.Time
+}
+
+// Now returns the current time of the fake clock.
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// TestDeterministicMode ensures address managers with the same injected source
+// of randomness and clock make the same selections.
+func TestDeterministicMode(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	newManager := func() (*addrmgr.AddrManager, *fakeClock) {
+		clock := &fakeClock{now: start}
+		n := addrmgr.New("testdeterministicmode", lookupFunc)
+		n.SetClock(clock)
+		n.SetRandSource(rand.NewSource(1))
+
+		srcAddr := wire.NewNetAddressIPPort(net.ParseIP(someIP), 8333, 0)
+		addrs := make([]*wire.NetAddress, 0, 200)
+		for i := 0; i < 200; i++ {
+			ip := net.IPv4(byte(30+i%60), byte(i), 2, 3)
+			addr := wire.NewNetAddressIPPort(ip, 8333,
+				wire.SFNodeNetwork)
+			addr.Timestamp = start.Add(-time.Duration(i) * time.Minute)
+			addrs = append(addrs, addr)
+		}
+		n.AddAddresses(addrs, srcAddr)
+		for i := 0; i < len(addrs); i += 7 {
+			n.Good(addrs[i])
+		}
+		return n, clock
+	}
+
+	n1, clock1 := newManager()
+	n2, clock2 := newManager()
+	for i := 0; i < 50; i++ {
+		ka1, ka2 := n1.GetAddress(), n2.GetAddress()
+		if ka1.NetAddressV2().String() != ka2.NetAddressV2().String() {
+			t.Fatalf("selection %d differs: %v != %v", i,
+				ka1.NetAddressV2(), ka2.NetAddressV2())
+		}
+
+		// Attempts are recorded with the time of the injected clock.
+		n1.Attempt(ka1.NetAddress())
+		n2.Attempt(ka2.NetAddress())
+		if !ka1.LastAttempt().Equal(clock1.now) {
+			t.Fatalf("last attempt %v is not the time %v of the "+
+				"clock", ka1.LastAttempt(), clock1.now)
+		}
+		clock1.now = clock1.now.Add(time.Minute)
+		clock2.now = clock2.now.Add(time.Minute)
+	}
+
+	if !reflect.DeepEqual(n1.AddressCache(), n2.AddressCache()) {
+		t.Fatal("address caches differ")
+	}
+}
+
 func TestConnected(t *testing.T) {
 	n := addrmgr.New("testconnected", lookupFunc)
 
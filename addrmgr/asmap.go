@@ -0,0 +1,298 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"math/bits"
+	"net"
+)
+
+// asmapInvalid is returned by the asmap decoding functions when the value
+// being decoded straddles the end of the map.
+const asmapInvalid = 0xffffffff
+
+// asmapOpcode describes an instruction of the asmap program.
+type asmapOpcode uint32
+
+const (
+	// asmapReturn returns the ASN which follows it.
+	asmapReturn asmapOpcode = 0
+
+	// asmapJump consumes a bit of the address and skips the number of
+	// bits of the program which follows it when the bit is set.
+	asmapJump asmapOpcode = 1
+
+	// asmapMatch compares the bits of the address with the bits which
+	// follow it and returns the default ASN when they differ.
+	asmapMatch asmapOpcode = 2
+
+	// asmapDefault sets the default ASN to the one which follows it.
+	asmapDefault asmapOpcode = 3
+)
+
+// These are the sizes of the exponent classes the different types of values
+// in the asmap program are encoded with.
+var (
+	asmapTypeBitSizes  = []uint8{0, 0, 1}
+	asmapASNBitSizes   = []uint8{15, 16, 17, 18, 19, 20, 21, 22, 23, 24}
+	asmapMatchBitSizes = []uint8{1, 2, 3, 4, 5, 6, 7, 8}
+	asmapJumpBitSizes  = []uint8{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
+		17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30}
+)
+
+// ASMap maps IP addresses to the autonomous system (AS) which announces
+// them.  It uses the compact binary format of the asmap files used by Bitcoin
+// Core, which encodes the map as a program which is run against the bits of
+// the 16 byte representation of the address.
+//
+// Grouping addresses by the AS they belong to rather than by their /16 or /32
+// prefix makes it much harder for a single hosting provider, which typically
+// controls many prefixes, to occupy all of the outbound connections of a node.
+type ASMap struct {
+	data     []byte
+	checksum string
+}
+
+// NewASMap returns an ASMap for the passed serialized map.  An error is
+// returned when the map is malformed.
+func NewASMap(data []byte) (*ASMap, error) {
+	m := &ASMap{data: data}
+	if !m.sanityCheck() {
+		return nil, errors.New("malformed asmap")
+	}
+	sum := sha256.Sum256(data)
+	m.checksum = hex.EncodeToString(sum[:])
+	return m, nil
+}
+
+// LoadASMap returns the ASMap stored in the file at the passed path.
+func LoadASMap(path string) (*ASMap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewASMap(data)
+}
+
+// Checksum returns the hex encoded SHA256 of the serialized map which can be
+// used to identify it.
+func (m *ASMap) Checksum() string {
+	return m.checksum
+}
+
+// Lookup returns the AS number which announces the passed IP address or 0 when
+// the address is not part of the map.
+func (m *ASMap) Lookup(ip net.IP) uint32 {
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return 0
+	}
+	ipBit := func(i int) bool {
+		return ip16[i/8]>>(7-uint(i%8))&1 == 1
+	}
+
+	pos, end := 0, len(m.data)*8
+	left := len(ip16) * 8
+	var defaultASN uint32
+	for pos < end {
+		switch asmapOpcode(m.decodeBits(&pos, 0, asmapTypeBitSizes)) {
+		case asmapReturn:
+			asn := m.decodeBits(&pos, 1, asmapASNBitSizes)
+			if asn == asmapInvalid {
+				return 0
+			}
+			return asn
+
+		case asmapJump:
+			jump := m.decodeBits(&pos, 17, asmapJumpBitSizes)
+			if jump == asmapInvalid || left == 0 ||
+				int64(jump) >= int64(end-pos) {
+
+				return 0
+			}
+			if ipBit(len(ip16)*8 - left) {
+				pos += int(jump)
+			}
+			left--
+
+		case asmapMatch:
+			match := m.decodeBits(&pos, 2, asmapMatchBitSizes)
+			if match == asmapInvalid {
+				return 0
+			}
+			matchLen := bits.Len32(match) - 1
+			if left < matchLen {
+				return 0
+			}
+			for i := 0; i < matchLen; i++ {
+				want := match>>uint(matchLen-1-i)&1 == 1
+				if ipBit(len(ip16)*8-left) != want {
+					return defaultASN
+				}
+				left--
+			}
+
+		case asmapDefault:
+			defaultASN = m.decodeBits(&pos, 1, asmapASNBitSizes)
+			if defaultASN == asmapInvalid {
+				return 0
+			}
+
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// bit returns whether the bit at the passed position of the map is set.  The
+// bits of each byte are ordered from the least to the most significant one.
+func (m *ASMap) bit(pos int) bool {
+	return m.data[pos/8]>>uint(pos%8)&1 == 1
+}
+
+// decodeBits decodes a value encoded with the passed exponent class sizes
+// starting at the passed position and advances the position past it.  It
+// returns asmapInvalid when the value straddles the end of the map.
+func (m *ASMap) decodeBits(pos *int, minVal uint32, sizes []uint8) uint32 {
+	end := len(m.data) * 8
+	val := minVal
+	for i, size := range sizes {
+		var bit bool
+		if i+1 != len(sizes) {
+			if *pos == end {
+				break
+			}
+			bit = m.bit(*pos)
+			*pos++
+		}
+		if bit {
+			val += 1 << size
+			continue
+		}
+		for b := uint8(0); b < size; b++ {
+			if *pos == end {
+				return asmapInvalid
+			}
+			if m.bit(*pos) {
+				val += 1 << (size - 1 - b)
+			}
+			*pos++
+		}
+		return val
+	}
+	return asmapInvalid
+}
+
+// sanityCheck returns whether the map is a well formed program which returns
+// an AS number for every possible address, so Lookup never runs past its end.
+func (m *ASMap) sanityCheck() bool {
+	type jumpTarget struct {
+		pos  int
+		left int
+	}
+
+	pos, end := 0, len(m.data)*8
+	left := net.IPv6len * 8
+	var jumps []jumpTarget
+	prevOpcode := asmapJump
+	hadIncompleteMatch := false
+	for pos < end {
+		if len(jumps) > 0 && pos >= jumps[len(jumps)-1].pos {
+			// Jump into the middle of the previous instruction.
+			return false
+		}
+
+		opcode := asmapOpcode(m.decodeBits(&pos, 0, asmapTypeBitSizes))
+		switch opcode {
+		case asmapReturn:
+			// A default followed by a return could be a single return.
+			if prevOpcode == asmapDefault {
+				return false
+			}
+			if m.decodeBits(&pos, 1, asmapASNBitSizes) == asmapInvalid {
+				return false
+			}
+			if len(jumps) == 0 {
+				// The remaining bits must be zero padding.
+				if end-pos > 7 {
+					return false
+				}
+				for ; pos < end; pos++ {
+					if m.bit(pos) {
+						return false
+					}
+				}
+				return true
+			}
+
+			// Continue as if the last jump was taken which requires
+			// it to target the next instruction.
+			target := jumps[len(jumps)-1]
+			if pos != target.pos {
+				return false
+			}
+			left = target.left
+			jumps = jumps[:len(jumps)-1]
+			prevOpcode = asmapJump
+
+		case asmapJump:
+			jump := m.decodeBits(&pos, 17, asmapJumpBitSizes)
+			if jump == asmapInvalid || int64(jump) > int64(end-pos) ||
+				left == 0 {
+
+				return false
+			}
+			left--
+			target := pos + int(jump)
+			if len(jumps) > 0 && target >= jumps[len(jumps)-1].pos {
+				// Intersecting jumps.
+				return false
+			}
+			jumps = append(jumps, jumpTarget{pos: target, left: left})
+			prevOpcode = asmapJump
+
+		case asmapMatch:
+			match := m.decodeBits(&pos, 2, asmapMatchBitSizes)
+			if match == asmapInvalid {
+				return false
+			}
+			matchLen := bits.Len32(match) - 1
+			if prevOpcode != asmapMatch {
+				hadIncompleteMatch = false
+			}
+			// Only one match of a sequence may be incomplete.
+			if matchLen < 8 && hadIncompleteMatch {
+				return false
+			}
+			hadIncompleteMatch = matchLen < 8
+			if left < matchLen {
+				return false
+			}
+			left -= matchLen
+			prevOpcode = asmapMatch
+
+		case asmapDefault:
+			// Successive defaults could be a single default.
+			if prevOpcode == asmapDefault {
+				return false
+			}
+			if m.decodeBits(&pos, 1, asmapASNBitSizes) == asmapInvalid {
+				return false
+			}
+			prevOpcode = asmapDefault
+
+		default:
+			return false
+		}
+	}
+
+	// Reached the end without a return.
+	return false
+}
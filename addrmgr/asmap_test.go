@@ -0,0 +1,147 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"net"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// asmapBuilder assembles asmap programs for tests.
+type asmapBuilder struct {
+	bits []bool
+}
+
+// encode appends the passed value encoded with the passed exponent class
+// sizes.
+func (b *asmapBuilder) encode(val, minVal uint32, sizes []uint8) {
+	val -= minVal
+	for i, size := range sizes {
+		if i+1 != len(sizes) {
+			if val >= 1<<size {
+				b.bits = append(b.bits, true)
+				val -= 1 << size
+				continue
+			}
+			b.bits = append(b.bits, false)
+		}
+		for bit := int(size) - 1; bit >= 0; bit-- {
+			b.bits = append(b.bits, val>>uint(bit)&1 == 1)
+		}
+		return
+	}
+}
+
+// ret appends a return instruction for the passed ASN.
+func (b *asmapBuilder) ret(asn uint32) {
+	b.encode(uint32(asmapReturn), 0, asmapTypeBitSizes)
+	b.encode(asn, 1, asmapASNBitSizes)
+}
+
+// jump appends a jump instruction which skips the passed number of bits.
+func (b *asmapBuilder) jump(offset uint32) {
+	b.encode(uint32(asmapJump), 0, asmapTypeBitSizes)
+	b.encode(offset, 17, asmapJumpBitSizes)
+}
+
+// matchByte appends a match instruction for all 8 bits of the passed byte.
+func (b *asmapBuilder) matchByte(v byte) {
+	b.encode(uint32(asmapMatch), 0, asmapTypeBitSizes)
+	b.encode(1<<8|uint32(v), 2, asmapMatchBitSizes)
+}
+
+// bytes returns the serialized program.
+func (b *asmapBuilder) bytes() []byte {
+	data := make([]byte, (len(b.bits)+7)/8)
+	for i, bit := range b.bits {
+		if bit {
+			data[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return data
+}
+
+// testASMap returns a map which assigns IPv4 addresses below 128.0.0.0 to AS
+// 100 and the remaining IPv4 addresses to AS 200.  IPv6 addresses are not
+// mapped.
+func testASMap(t *testing.T) *ASMap {
+	t.Helper()
+
+	var b asmapBuilder
+	for _, v := range net.IPv4(0, 0, 0, 0)[:12] {
+		b.matchByte(v)
+	}
+	b.jump(17)
+	b.ret(100)
+	b.ret(200)
+
+	asmap, err := NewASMap(b.bytes())
+	if err != nil {
+		t.Fatalf("NewASMap: unexpected error: %v", err)
+	}
+	return asmap
+}
+
+// TestASMap ensures the AS map looks up addresses and rejects malformed maps
+// as expected.
+func TestASMap(t *testing.T) {
+	asmap := testASMap(t)
+	tests := []struct {
+		ip   string
+		want uint32
+	}{
+		{"1.2.3.4", 100},
+		{"127.255.255.255", 100},
+		{"128.0.0.0", 200},
+		{"200.1.1.1", 200},
+		{"2602:100::1", 0},
+	}
+	for _, test := range tests {
+		if asn := asmap.Lookup(net.ParseIP(test.ip)); asn != test.want {
+			t.Errorf("Lookup %s: got %d, want %d", test.ip, asn,
+				test.want)
+		}
+	}
+
+	data := asmap.data
+	for _, malformed := range [][]byte{nil, data[:len(data)-1],
+		append(append([]byte{}, data...), 0)} {
+
+		if _, err := NewASMap(malformed); err == nil {
+			t.Errorf("NewASMap %x: malformed map was not rejected",
+				malformed)
+		}
+	}
+}
+
+// TestASGroupKey ensures addresses are grouped by their AS when an AS map is
+// provided.
+func TestASGroupKey(t *testing.T) {
+	asmap := testASMap(t)
+	tests := []struct {
+		ip    string
+		asmap *ASMap
+		want  string
+	}{
+		{"12.1.2.3", asmap, "as100"},
+		{"173.1.2.3", asmap, "as200"},
+		{"173.1.2.3", nil, "173.1.0.0"},
+		{"2002:c801:0101::", asmap, "as200"},
+		{"10.1.2.3", asmap, "unroutable"},
+		{"127.0.0.1", asmap, "local"},
+		{"2602:100::1", asmap, "2602:100::"},
+		{"fd87:d87e:eb43:1234::5678", asmap, "tor:2"},
+	}
+	for _, test := range tests {
+		na := wire.NewNetAddressIPPort(net.ParseIP(test.ip), 8333,
+			wire.SFNodeNetwork)
+		if key := ASGroupKey(na, test.asmap); key != test.want {
+			t.Errorf("ASGroupKey %s: got %q, want %q", test.ip, key,
+				test.want)
+		}
+	}
+}
@@ -28,11 +28,49 @@ generally helps provide greater peer diversity, and perhaps more importantly,
 drastically reduces the chances an attacker is able to coerce your peer into
 only connecting to nodes they control.
 
+By default, addresses are grouped by their /16 (IPv4) or /32 (IPv6) prefix.
+An AS map may be provided via SetASMap to instead group them by the autonomous
+system which announces them, since a single hosting provider typically controls
+many prefixes.  The AS aware group key is available via GroupKey so callers can
+apply the same grouping when limiting connections per group.
+
 The address manager also understands routability and Tor addresses and tries
 hard to only return routable addresses.  In addition, it uses the information
 provided by the caller about connected, known good, and attempted addresses to
 periodically purge peers which no longer appear to be good peers as well as
 bias the selection toward known good peers.  The general idea is to make a best
 effort at only providing usable addresses.
+
+Addresses received in addrv2 messages (BIP0155) are stored alongside the ones
+received in addr messages.  This includes the addresses of networks which can't
+be encoded in addr messages, such as Tor v3, I2P, and CJDNS, which are only
+returned by the functions dealing with wire.NetAddressV2, such as
+AddressCacheV2, so they are relayed to peers which understand them.
+
+The addresses of all networks are persisted along with their network and share
+the same new and tried buckets.  Each network is grouped separately, and when a
+bucket is full, the address which is evicted belongs to the network with the
+most addresses in the bucket, so a flood of addresses of one network can't push
+the addresses of the other networks out of the address manager.
+
+By default, the addresses are periodically written to a peers file as a whole.
+A Store, such as the leveldb backed one returned by OpenLevelDBStore, may be
+provided via SetStore to instead write only the addresses which changed, which
+is considerably faster for large address tables and doesn't lose them when the
+process crashes.
+
+The outcomes of connections may be reported with reason codes via GoodEvent
+and AttemptEvent rather than Good and Attempt.  Addresses whose last attempt
+failed because the peer did not complete the handshake or misbehaved are
+selected less often, and the latency reported with good events is remembered.
+Scoring weights may be provided via SetScoreWeights to further bias the
+selection toward addresses which recently succeeded, have a low latency, and
+advertise the preferred services.  When scoring is enabled, the address with
+the lowest score rather than the oldest one is evicted from a full bucket.
+
+The source of randomness and the clock may be injected via SetRandSource and
+SetClock, which makes the selection behavior deterministic so it can be tested
+and simulated.  This must never be done for the address manager of a real node
+since its selections become predictable.
 */
 package addrmgr
@@ -0,0 +1,71 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Clock is the source of the current time of the address manager.  It is used
+// for all timestamp comparisons, such as when deciding whether an address is
+// bad or how likely it is to be selected, and for the times recorded for
+// attempts and successful connections.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// systemClock is a Clock which returns the time of the system clock.
+type systemClock struct{}
+
+// Now returns the current time of the system clock.
+//
+// This is part of the Clock interface.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SetClock sets the clock the address manager uses in place of the system
+// clock.  Together with SetRandSource, it allows the selection behavior of the
+// address manager to be tested deterministically and simulated at a faster
+// pace than real time.
+//
+// This function must be called before Start.
+func (a *AddrManager) SetClock(clock Clock) {
+	a.mtx.Lock()
+	a.clock = clock
+	a.mtx.Unlock()
+}
+
+// SetRandSource sets the source of the randomness the address manager uses to
+// select buckets and addresses, to decide whether to add an address to more new
+// buckets, and to sample the addresses returned by AddressCache.  When no
+// addresses are known yet, the secret key the buckets are derived with is drawn
+// from the source as well.  The addresses of a bucket are also considered in a
+// fixed order from then on rather than in the random order of map iteration, so
+// the same source, clock, and sequence of calls always yield the same
+// selections.
+//
+// Since the selections become predictable, this is only intended for tests and
+// simulations and must never be used with a source which is not
+// cryptographically random for an address manager used by a real node.
+//
+// This function must be called before Start.
+func (a *AddrManager) SetRandSource(src rand.Source) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.rand = rand.New(src)
+	a.deterministic = true
+	if a.numAddresses() == 0 {
+		a.rand.Read(a.key[:])
+	}
+}
+
+// now returns the current time of the clock of the address manager.
+func (a *AddrManager) now() time.Time {
+	return a.clock.Now()
+}
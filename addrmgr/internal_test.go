@@ -11,15 +11,24 @@ import (
 )
 
 func TstKnownAddressIsBad(ka *KnownAddress) bool {
-	return ka.isBad()
+	return ka.isBad(time.Now())
 }
 
 func TstKnownAddressChance(ka *KnownAddress) float64 {
-	return ka.chance()
+	return ka.chance(time.Now())
+}
+
+func TstKnownAddressScore(ka *KnownAddress, weights ScoreWeights) float64 {
+	return ka.score(&weights, time.Now())
+}
+
+func TstSetKnownAddressLatency(ka *KnownAddress, latency time.Duration) {
+	ka.latency = latency
 }
 
 func TstNewKnownAddress(na *wire.NetAddress, attempts int,
 	lastattempt, lastsuccess time.Time, tried bool, refs int) *KnownAddress {
-	return &KnownAddress{na: na, attempts: attempts, lastattempt: lastattempt,
+	return &KnownAddress{na: wire.NetAddressV2FromLegacy(na),
+		attempts: attempts, lastattempt: lastattempt,
 		lastsuccess: lastsuccess, tried: tried, refs: refs}
 }
@@ -13,18 +13,33 @@ import (
 // KnownAddress tracks information about a known network address that is used
 // to determine how viable an address is.
 type KnownAddress struct {
-	na          *wire.NetAddress
-	srcAddr     *wire.NetAddress
+	na          *wire.NetAddressV2
+	srcAddr     *wire.NetAddressV2
 	attempts    int
 	lastattempt time.Time
 	lastsuccess time.Time
 	tried       bool
 	refs        int // reference count of new buckets
+
+	// latency is the latency of the last successful connection to the
+	// address or zero when it was not measured.
+	latency time.Duration
+
+	// lastFailure is the reason the last attempt to connect to the address
+	// failed.  It is reset by a successful connection.
+	lastFailure EventReason
 }
 
-// NetAddress returns the underlying wire.NetAddress associated with the
-// known address.
+// NetAddress returns the wire.NetAddress associated with the known address.
+// It returns nil for addresses which can't be represented by a
+// wire.NetAddress, such as Tor v3, I2P, and CJDNS addresses.
 func (ka *KnownAddress) NetAddress() *wire.NetAddress {
+	return ka.na.ToLegacy()
+}
+
+// NetAddressV2 returns the underlying wire.NetAddressV2 associated with the
+// known address.
+func (ka *KnownAddress) NetAddressV2() *wire.NetAddressV2 {
 	return ka.na
 }
 
@@ -33,6 +48,19 @@ func (ka *KnownAddress) LastAttempt() time.Time {
 	return ka.lastattempt
 }
 
+// Latency returns the latency of the last successful connection to the known
+// address or zero when it was not measured.
+func (ka *KnownAddress) Latency() time.Duration {
+	return ka.latency
+}
+
+// LastFailure returns the reason the last attempt to connect to the known
+// address failed or ReasonUnspecified when it did not fail since the last
+// successful connection.
+func (ka *KnownAddress) LastFailure() EventReason {
+	return ka.lastFailure
+}
+
 // Services returns the services supported by the peer with the known address.
 func (ka *KnownAddress) Services() wire.ServiceFlag {
 	return ka.na.Services
@@ -40,9 +68,9 @@ func (ka *KnownAddress) Services() wire.ServiceFlag {
 
 // chance returns the selection probability for a known address.  The priority
 // depends upon how recently the address has been seen, how recently it was last
-// attempted and how often attempts to connect to it have failed.
-func (ka *KnownAddress) chance() float64 {
-	now := time.Now()
+// attempted, how often attempts to connect to it have failed, and why the last
+// attempt failed, relative to the passed current time.
+func (ka *KnownAddress) chance(now time.Time) float64 {
 	lastAttempt := now.Sub(ka.lastattempt)
 
 	if lastAttempt < 0 {
@@ -61,6 +89,9 @@ func (ka *KnownAddress) chance() float64 {
 		c /= 1.5
 	}
 
+	// Peers which failed the handshake or misbehaved deprioritise further.
+	c /= ka.lastFailure.failurePenalty()
+
 	return c
 }
 
@@ -71,19 +102,20 @@ func (ka *KnownAddress) chance() float64 {
 // 3) It has failed at least three times and never succeeded
 // 4) It has failed ten times in the last week
 // All addresses that meet these criteria are assumed to be worthless and not
-// worth keeping hold of.
-func (ka *KnownAddress) isBad() bool {
-	if ka.lastattempt.After(time.Now().Add(-1 * time.Minute)) {
+// worth keeping hold of.  The criteria are evaluated relative to the passed
+// current time.
+func (ka *KnownAddress) isBad(now time.Time) bool {
+	if ka.lastattempt.After(now.Add(-1 * time.Minute)) {
 		return false
 	}
 
 	// From the future?
-	if ka.na.Timestamp.After(time.Now().Add(10 * time.Minute)) {
+	if ka.na.Timestamp.After(now.Add(10 * time.Minute)) {
 		return true
 	}
 
 	// Over a month old?
-	if ka.na.Timestamp.Before(time.Now().Add(-1 * numMissingDays * time.Hour * 24)) {
+	if ka.na.Timestamp.Before(now.Add(-1 * numMissingDays * time.Hour * 24)) {
 		return true
 	}
 
@@ -93,7 +125,7 @@ func (ka *KnownAddress) isBad() bool {
 	}
 
 	// Hasn't succeeded in too long?
-	if !ka.lastsuccess.After(time.Now().Add(-1*minBadDays*time.Hour*24)) &&
+	if !ka.lastsuccess.After(now.Add(-1*minBadDays*time.Hour*24)) &&
 		ka.attempts >= maxFailures {
 		return true
 	}
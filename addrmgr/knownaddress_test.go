@@ -56,6 +56,72 @@ func TestChance(t *testing.T) {
 	}
 }
 
+// TestScore ensures the weighted properties of an address raise its score
+// relative to its chance without ever exceeding it.
+func TestScore(t *testing.T) {
+	now := time.Now()
+	na := &wire.NetAddress{
+		Timestamp: now.Add(-35 * time.Second),
+		Services:  wire.SFNodeNetwork | wire.SFNodeWitness,
+	}
+	preferred := wire.SFNodeNetwork | wire.SFNodeWitness
+	recent := addrmgr.TstNewKnownAddress(na, 0, now.Add(-30*time.Minute),
+		now, true, 0)
+	addrmgr.TstSetKnownAddressLatency(recent, 100*time.Millisecond)
+	stale := addrmgr.TstNewKnownAddress(na, 0, now.Add(-30*time.Minute),
+		time.Time{}, false, 0)
+
+	tests := []struct {
+		name     string
+		addr     *addrmgr.KnownAddress
+		weights  addrmgr.ScoreWeights
+		expected float64
+	}{{
+		name:     "scoring disabled",
+		addr:     stale,
+		expected: 1.0,
+	}, {
+		name: "all properties",
+		addr: recent,
+		weights: addrmgr.ScoreWeights{
+			LastSuccess:       1,
+			Latency:           1,
+			Services:          1,
+			PreferredServices: preferred,
+		},
+		expected: (1 + 1 + 0.95 + 1) / 4.0,
+	}, {
+		name: "no properties",
+		addr: stale,
+		weights: addrmgr.ScoreWeights{
+			LastSuccess: 1,
+			Latency:     1,
+		},
+		expected: 1 / 3.0,
+	}, {
+		name: "missing preferred services",
+		addr: stale,
+		weights: addrmgr.ScoreWeights{
+			Services:          2,
+			PreferredServices: preferred | wire.SFNodeCF,
+		},
+		expected: 1 / 3.0,
+	}}
+
+	const err = .0001
+	for _, test := range tests {
+		score := addrmgr.TstKnownAddressScore(test.addr, test.weights)
+		if math.Abs(test.expected-score) >= err {
+			t.Errorf("%s: got %f, expected %f", test.name, score,
+				test.expected)
+		}
+		if score > addrmgr.TstKnownAddressChance(test.addr) {
+			t.Errorf("%s: score %f exceeds chance %f", test.name,
+				score, addrmgr.TstKnownAddressChance(test.addr))
+		}
+	}
+}
+
 func TestIsBad(t *testing.T) {
 	now := time.Unix(time.Now().Unix(), 0)
 	future := now.Add(35 * time.Minute)
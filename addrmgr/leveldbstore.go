@@ -0,0 +1,134 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/btcsuite/goleveldb/leveldb"
+	"github.com/btcsuite/goleveldb/leveldb/util"
+)
+
+var (
+	// levelDBMetaKey is the key the state of the address manager which is
+	// not specific to any address is stored under.
+	levelDBMetaKey = []byte("meta")
+
+	// levelDBAddrPrefix is the prefix of the keys the addresses are stored
+	// under.  The rest of the key is the key of the address.
+	levelDBAddrPrefix = []byte("addr:")
+)
+
+// LevelDBStore is a Store backed by a leveldb database.  The state and each
+// address are stored as a JSON encoded value, and every update is written with
+// a single batch, so the database always reflects a consistent address table.
+type LevelDBStore struct {
+	db *leveldb.DB
+}
+
+// Ensure the LevelDBStore type implements the Store interface.
+var _ Store = (*LevelDBStore)(nil)
+
+// OpenLevelDBStore opens the leveldb address store at the passed path, creating
+// it when it does not exist.
+func OpenLevelDBStore(path string) (*LevelDBStore, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &LevelDBStore{db: db}, nil
+}
+
+// addrKey returns the database key of the address with the passed key.
+func (s *LevelDBStore) addrKey(key string) []byte {
+	dbKey := make([]byte, 0, len(levelDBAddrPrefix)+len(key))
+	dbKey = append(dbKey, levelDBAddrPrefix...)
+	return append(dbKey, key...)
+}
+
+// Load returns the state and all of the addresses persisted to the store.  The
+// returned state is nil when the store is empty.
+//
+// This is part of the Store interface.
+func (s *LevelDBStore) Load() (*StoreMeta, []*StoredAddress, error) {
+	metaBytes, err := s.db.Get(levelDBMetaKey, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var meta StoreMeta
+	if err := json.Unmarshal(metaBytes, &meta); err != nil {
+		return nil, nil, fmt.Errorf("malformed address store state: %v",
+			err)
+	}
+
+	var addrs []*StoredAddress
+	iter := s.db.NewIterator(util.BytesPrefix(levelDBAddrPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		var sa StoredAddress
+		if err := json.Unmarshal(iter.Value(), &sa); err != nil {
+			return nil, nil, fmt.Errorf("malformed address %s: %v",
+				iter.Key()[len(levelDBAddrPrefix):], err)
+		}
+		addrs = append(addrs, &sa)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, nil, err
+	}
+
+	return &meta, addrs, nil
+}
+
+// Update atomically replaces the persisted state with the passed one, adds or
+// replaces the passed addresses, and removes the addresses with the passed
+// keys.
+//
+// This is part of the Store interface.
+func (s *LevelDBStore) Update(meta *StoreMeta, put []*StoredAddress, remove []string) error {
+	var batch leveldb.Batch
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	batch.Put(levelDBMetaKey, metaBytes)
+	for _, sa := range put {
+		saBytes, err := json.Marshal(sa)
+		if err != nil {
+			return err
+		}
+		batch.Put(s.addrKey(sa.Addr), saBytes)
+	}
+	for _, key := range remove {
+		batch.Delete(s.addrKey(key))
+	}
+	return s.db.Write(&batch, nil)
+}
+
+// Reset removes everything persisted to the store.
+//
+// This is part of the Store interface.
+func (s *LevelDBStore) Reset() error {
+	var batch leveldb.Batch
+	iter := s.db.NewIterator(nil, nil)
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return s.db.Write(&batch, nil)
+}
+
+// Close closes the store.
+//
+// This is part of the Store interface.
+func (s *LevelDBStore) Close() error {
+	return s.db.Close()
+}
@@ -241,27 +241,7 @@ func GroupKey(na *wire.NetAddress) string {
 	if !IsRoutable(na) {
 		return "unroutable"
 	}
-	if IsIPv4(na) {
-		return na.IP.Mask(net.CIDRMask(16, 32)).String()
-	}
-	if IsRFC6145(na) || IsRFC6052(na) {
-		// last four bytes are the ip address
-		ip := na.IP[12:16]
-		return ip.Mask(net.CIDRMask(16, 32)).String()
-	}
-
-	if IsRFC3964(na) {
-		ip := na.IP[2:6]
-		return ip.Mask(net.CIDRMask(16, 32)).String()
-
-	}
-	if IsRFC4380(na) {
-		// teredo tunnels have the last 4 bytes as the v4 address XOR
-		// 0xff.
-		ip := net.IP(make([]byte, 4))
-		for i, byte := range na.IP[12:16] {
-			ip[i] = byte ^ 0xff
-		}
+	if ip := embeddedIPv4(na); ip != nil {
 		return ip.Mask(net.CIDRMask(16, 32)).String()
 	}
 	if IsOnionCatTor(na) {
@@ -279,3 +259,88 @@ func GroupKey(na *wire.NetAddress) string {
 
 	return na.IP.Mask(net.CIDRMask(bits, 128)).String()
 }
+
+// embeddedIPv4 returns the IPv4 address of the passed address, including the
+// ones embedded in IPv6 addresses by the various translation and tunneling
+// mechanisms.  It returns nil for other addresses.
+func embeddedIPv4(na *wire.NetAddress) net.IP {
+	switch {
+	case IsIPv4(na):
+		return na.IP.To4()
+
+	case IsRFC6145(na) || IsRFC6052(na):
+		// last four bytes are the ip address
+		return na.IP[12:16]
+
+	case IsRFC3964(na):
+		return na.IP[2:6]
+
+	case IsRFC4380(na):
+		// teredo tunnels have the last 4 bytes as the v4 address XOR
+		// 0xff.
+		ip := net.IP(make([]byte, 4))
+		for i, byte := range na.IP[12:16] {
+			ip[i] = byte ^ 0xff
+		}
+		return ip
+	}
+	return nil
+}
+
+// ASGroupKey returns a string representing the network group an address is
+// part of using the passed AS map.  Routable IP addresses which are part of the
+// map are grouped by the autonomous system which announces them as the string
+// "as<number>", so all of the prefixes of a hosting provider form a single
+// group.  IPv4 addresses embedded in IPv6 addresses are looked up by their
+// IPv4 address.  The group key of all other addresses, as well as of all
+// addresses when the map is nil, is the same as the one returned by GroupKey.
+func ASGroupKey(na *wire.NetAddress, asmap *ASMap) string {
+	if asmap != nil && IsRoutable(na) && !IsOnionCatTor(na) {
+		ip := embeddedIPv4(na)
+		if ip == nil {
+			ip = na.IP
+		}
+		if asn := asmap.Lookup(ip); asn != 0 {
+			return fmt.Sprintf("as%d", asn)
+		}
+	}
+	return GroupKey(na)
+}
+
+// isRoutableV2 returns whether or not the passed address is routable.
+// Addresses which can be represented by a wire.NetAddress are checked the
+// same way as by IsRoutable, while Tor v3, I2P, and CJDNS addresses are
+// routable over their respective networks as long as they are well formed.
+func isRoutableV2(na *wire.NetAddressV2) bool {
+	if legacy := na.ToLegacy(); legacy != nil {
+		return IsRoutable(legacy)
+	}
+
+	return na.IsKnownNetwork()
+}
+
+// groupKeyV2 returns a string representing the network group an address is
+// part of.  It is the same as ASGroupKey for addresses which can be
+// represented by a wire.NetAddress.  Tor v3, I2P, and CJDNS addresses are
+// derived from public keys, so like Tor v2 addresses, they are keyed off the
+// network and the first 4 bits of the key.
+func groupKeyV2(na *wire.NetAddressV2, asmap *ASMap) string {
+	if legacy := na.ToLegacy(); legacy != nil {
+		return ASGroupKey(legacy, asmap)
+	}
+	if !na.IsKnownNetwork() {
+		return "unroutable"
+	}
+
+	switch na.NetworkID {
+	case wire.NetworkTorV3:
+		return fmt.Sprintf("torv3:%d", na.Addr[0]&((1<<4)-1))
+
+	case wire.NetworkI2P:
+		return fmt.Sprintf("i2p:%d", na.Addr[0]&((1<<4)-1))
+	}
+
+	// CJDNS addresses all share the 0xfc prefix, so the key starts at the
+	// second byte.
+	return fmt.Sprintf("cjdns:%d", na.Addr[1]&((1<<4)-1))
+}
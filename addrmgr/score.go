@@ -0,0 +1,222 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// scoreSuccessWindow is the amount of time after the last successful
+	// connection to an address during which the address gets a bonus for
+	// the success.  The bonus decreases linearly over the window.
+	scoreSuccessWindow = minBadDays * 24 * time.Hour
+
+	// scoreMaxLatency is the connection latency at and beyond which an
+	// address no longer gets a bonus for its latency.  The bonus decreases
+	// linearly from a latency of zero.
+	scoreMaxLatency = 2 * time.Second
+)
+
+// EventReason identifies the reason of an event reported to the address
+// manager about an address via GoodEvent or AttemptEvent.
+type EventReason uint8
+
+const (
+	// ReasonUnspecified is the reason of the events reported via Good and
+	// Attempt.
+	ReasonUnspecified EventReason = iota
+
+	// ReasonHandshake is the reason of a good event after the version
+	// handshake with the peer at the address completed.
+	ReasonHandshake
+
+	// ReasonFeeler is the reason of a good event after a short lived
+	// connection to test the address succeeded.
+	ReasonFeeler
+
+	// ReasonConnecting is the reason of an attempt event before a
+	// connection to the address is made.
+	ReasonConnecting
+
+	// ReasonTimeout is the reason of an attempt event after a connection to
+	// the address timed out.
+	ReasonTimeout
+
+	// ReasonRefused is the reason of an attempt event after a connection to
+	// the address was refused.
+	ReasonRefused
+
+	// ReasonHandshakeFailed is the reason of an attempt event after the
+	// connection to the address was closed before the version handshake
+	// completed.
+	ReasonHandshakeFailed
+
+	// ReasonMisbehavior is the reason of an attempt event after the peer
+	// at the address was disconnected for misbehaving.
+	ReasonMisbehavior
+)
+
+// Map of event reasons back to their constant names for pretty printing.
+var eventReasonStrings = map[EventReason]string{
+	ReasonUnspecified:     "ReasonUnspecified",
+	ReasonHandshake:       "ReasonHandshake",
+	ReasonFeeler:          "ReasonFeeler",
+	ReasonConnecting:      "ReasonConnecting",
+	ReasonTimeout:         "ReasonTimeout",
+	ReasonRefused:         "ReasonRefused",
+	ReasonHandshakeFailed: "ReasonHandshakeFailed",
+	ReasonMisbehavior:     "ReasonMisbehavior",
+}
+
+// String returns the EventReason in human-readable form.
+func (r EventReason) String() string {
+	if s, ok := eventReasonStrings[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown EventReason (%d)", uint8(r))
+}
+
+// isFailure returns whether the reason describes a failed attempt to connect to
+// an address.
+func (r EventReason) isFailure() bool {
+	return r >= ReasonTimeout
+}
+
+// failurePenalty returns the factor the selection probability of an address is
+// divided by when the last attempt to connect to it failed for the reason.
+// Failures which are likely to be temporary are already accounted for by the
+// number of attempts, while peers which failed the handshake or misbehaved
+// are unlikely to be useful when they are connected to again.
+func (r EventReason) failurePenalty() float64 {
+	switch r {
+	case ReasonHandshakeFailed:
+		return 2
+	case ReasonMisbehavior:
+		return 10
+	}
+	return 1
+}
+
+// AddressEvent is an event about an address reported to the address manager
+// via GoodEvent or AttemptEvent.
+type AddressEvent struct {
+	// Reason is the reason of the event.
+	Reason EventReason
+
+	// Latency is the latency measured for the connection to the address.
+	// It is only used by good events and ignored when zero.
+	Latency time.Duration
+}
+
+// ScoreWeights are the weights of the properties of an address which bias the
+// selection of addresses by GetAddress toward reliable peers.  The selection
+// probability of an address, which is based upon how recently and how often it
+// was attempted, is raised by the sum of the weights of the properties it has,
+// relative to the sum of all weights.  The zero value disables the scoring.
+type ScoreWeights struct {
+	// LastSuccess is the weight of a recent successful connection.  The
+	// bonus decreases linearly over a week after the last success.
+	LastSuccess float64
+
+	// Latency is the weight of a low connection latency.  The bonus
+	// decreases linearly up to a latency of two seconds.
+	Latency float64
+
+	// Services is the weight of advertising all of PreferredServices.
+	Services float64
+
+	// PreferredServices are the services an address must advertise to get
+	// the bonus weighted by Services.
+	PreferredServices wire.ServiceFlag
+}
+
+// total returns the sum of the weights.
+func (w *ScoreWeights) total() float64 {
+	return w.LastSuccess + w.Latency + w.Services
+}
+
+// SetScoreWeights sets the weights used to score addresses when they are
+// selected by GetAddress and evicted from full buckets.  Negative weights are
+// treated as zero.
+//
+// This function is safe for concurrent access.
+func (a *AddrManager) SetScoreWeights(weights ScoreWeights) {
+	if weights.LastSuccess < 0 {
+		weights.LastSuccess = 0
+	}
+	if weights.Latency < 0 {
+		weights.Latency = 0
+	}
+	if weights.Services < 0 {
+		weights.Services = 0
+	}
+
+	a.mtx.Lock()
+	a.weights = weights
+	a.mtx.Unlock()
+}
+
+// score returns the selection probability of the known address raised by the
+// bonuses for its properties weighted by the passed weights relative to the
+// passed current time.  It is the same as chance when all of the weights are
+// zero and never exceeds it otherwise, so the scored probabilities stay within
+// the range of chance.
+func (ka *KnownAddress) score(w *ScoreWeights, now time.Time) float64 {
+	c := ka.chance(now)
+	total := w.total()
+	if total == 0 {
+		return c
+	}
+
+	var bonus float64
+	if w.LastSuccess > 0 && !ka.lastsuccess.IsZero() {
+		age := now.Sub(ka.lastsuccess)
+		if age < 0 {
+			age = 0
+		}
+		if age < scoreSuccessWindow {
+			bonus += w.LastSuccess * (1 - float64(age)/
+				float64(scoreSuccessWindow))
+		}
+	}
+	if w.Latency > 0 && ka.latency > 0 && ka.latency < scoreMaxLatency {
+		bonus += w.Latency * (1 - float64(ka.latency)/
+			float64(scoreMaxLatency))
+	}
+	if w.Services > 0 && ka.na.Services&w.PreferredServices ==
+		w.PreferredServices {
+
+		bonus += w.Services
+	}
+
+	return c * (1 + bonus) / (1 + total)
+}
+
+// evictBefore returns whether the first passed address should be evicted from
+// a full bucket before the second one.  The address with the lower score is
+// evicted first when scoring is enabled, and the one which was seen the longest
+// time ago otherwise or when both have the same score.  Addresses which were
+// seen at the same time are ordered by their keys when the source of
+// randomness was injected via SetRandSource.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) evictBefore(ka, other *KnownAddress) bool {
+	if a.weights.total() > 0 {
+		now := a.now()
+		kaScore := ka.score(&a.weights, now)
+		otherScore := other.score(&a.weights, now)
+		if kaScore != otherScore {
+			return kaScore < otherScore
+		}
+	}
+	if a.deterministic && ka.na.Timestamp.Equal(other.na.Timestamp) {
+		return ka.na.String() < other.na.String()
+	}
+	return ka.na.Timestamp.Before(other.na.Timestamp)
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package addrmgr
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// StoreMeta is the state of the address manager persisted to a store which is
+// not specific to any address.
+type StoreMeta struct {
+	// Version is the version of the serialized address manager.
+	Version int
+
+	// Key is the secret key the buckets of the addresses are derived with.
+	Key [32]byte
+
+	// ASMap is the checksum of the AS map the addresses were bucketed
+	// with.  It is empty when no AS map was used.
+	ASMap string `json:",omitempty"`
+}
+
+// StoredAddress is an address known to the address manager as persisted to a
+// store.
+type StoredAddress struct {
+	Addr        string
+	Src         string
+	Network     wire.NetworkID `json:",omitempty"`
+	Attempts    int
+	TimeStamp   int64
+	LastAttempt int64
+	LastSuccess int64
+	Services    wire.ServiceFlag
+	SrcServices wire.ServiceFlag
+
+	// NewBuckets are the new buckets the address is part of.  They are
+	// empty when the address is tried.
+	NewBuckets []int `json:",omitempty"`
+
+	// TriedBucket is the tried bucket the address is part of or -1 when
+	// the address is new.
+	TriedBucket int
+}
+
+// Store is the interface of the database backends the address manager is able
+// to persist its addresses to.  Unlike the peers file, which is rewritten as a
+// whole, a store is updated with the addresses which changed since the last
+// update, so it is suited for large address tables and doesn't lose them when
+// the process crashes.
+type Store interface {
+	// Load returns the state and all of the addresses persisted to the
+	// store.  The returned state is nil when the store is empty.
+	Load() (*StoreMeta, []*StoredAddress, error)
+
+	// Update atomically replaces the persisted state with the passed one,
+	// adds or replaces the passed addresses, and removes the addresses
+	// with the passed keys.
+	Update(meta *StoreMeta, put []*StoredAddress, remove []string) error
+
+	// Reset removes everything persisted to the store.
+	Reset() error
+
+	// Close closes the store.
+	Close() error
+}
+
+// SetStore sets the store the addresses are persisted to instead of the peers
+// file.  The address manager takes ownership of the store and closes it when it
+// is stopped.  When the store is empty, the addresses of the peers file are
+// imported into it.
+//
+// This function must be called before Start.
+func (a *AddrManager) SetStore(store Store) {
+	a.mtx.Lock()
+	a.store = store
+	a.mtx.Unlock()
+}
+
+// markDirty marks the address with the passed key as changed, so it is written
+// to the store when the addresses are saved next time.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) markDirty(key string) {
+	if a.store != nil {
+		a.dirty[key] = struct{}{}
+	}
+}
+
+// flushStore writes the addresses which changed since they were last written
+// to the store.  The addresses which are no longer known are removed from it.
+func (a *AddrManager) flushStore() {
+	a.mtx.Lock()
+	meta := &StoreMeta{
+		Version: a.version,
+		Key:     a.key,
+		ASMap:   a.asmapChecksum(),
+	}
+
+	// Find the new buckets of the changed addresses with a single pass
+	// over the buckets rather than scanning them for every address.
+	newBuckets := make(map[string][]int, len(a.dirty))
+	for i := range a.addrNew {
+		for k := range a.addrNew[i] {
+			if _, ok := a.dirty[k]; ok {
+				newBuckets[k] = append(newBuckets[k], i)
+			}
+		}
+	}
+
+	var put []*StoredAddress
+	var remove []string
+	dirty := a.dirty
+	for k := range dirty {
+		ka, ok := a.addrIndex[k]
+		if !ok || (!ka.tried && len(newBuckets[k]) == 0) {
+			remove = append(remove, k)
+			continue
+		}
+
+		sa := &StoredAddress{
+			Addr:        k,
+			Src:         ka.srcAddr.String(),
+			Network:     ka.na.NetworkID,
+			Attempts:    ka.attempts,
+			TimeStamp:   ka.na.Timestamp.Unix(),
+			LastAttempt: ka.lastattempt.Unix(),
+			LastSuccess: ka.lastsuccess.Unix(),
+			Services:    ka.na.Services,
+			SrcServices: ka.srcAddr.Services,
+			NewBuckets:  newBuckets[k],
+			TriedBucket: -1,
+		}
+		if ka.tried {
+			sa.TriedBucket = a.getTriedBucket(ka.na)
+		}
+		put = append(put, sa)
+	}
+	a.dirty = make(map[string]struct{})
+	a.mtx.Unlock()
+
+	if len(put) == 0 && len(remove) == 0 {
+		return
+	}
+	if err := a.store.Update(meta, put, remove); err != nil {
+		log.Errorf("Failed to update address store: %v", err)
+
+		// Retry with the next flush.
+		a.mtx.Lock()
+		for k := range dirty {
+			a.dirty[k] = struct{}{}
+		}
+		a.mtx.Unlock()
+		return
+	}
+	log.Debugf("Wrote %d and removed %d addresses from the address store",
+		len(put), len(remove))
+}
+
+// loadStore loads the known addresses from the store.  The addresses of the
+// peers file are imported when the store is empty.  When the store is
+// malformed, it is reset and nothing is loaded.
+func (a *AddrManager) loadStore() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	meta, addrs, err := a.store.Load()
+	if err == nil && meta == nil {
+		err = a.importPeersFile()
+	} else if err == nil {
+		err = a.deserializeStore(meta, addrs)
+	}
+	if err != nil {
+		log.Errorf("Failed to load address store: %v", err)
+		if err := a.store.Reset(); err != nil {
+			log.Warnf("Failed to reset corrupt address store: %v",
+				err)
+		}
+		a.reset()
+		return
+	}
+	log.Infof("Loaded %d addresses from the address store",
+		a.numAddresses())
+}
+
+// importPeersFile loads the addresses of the peers file and marks all of them
+// as changed so they are written to the empty store.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) importPeersFile() error {
+	if _, err := os.Stat(a.peersFile); os.IsNotExist(err) {
+		return nil
+	}
+	if err := a.deserializePeers(a.peersFile); err != nil {
+		return err
+	}
+	for k := range a.addrIndex {
+		a.markDirty(k)
+	}
+	log.Infof("Importing %d addresses from file '%s' into the address "+
+		"store", len(a.addrIndex), a.peersFile)
+	return nil
+}
+
+// deserializeStore loads the passed addresses persisted to the store.
+//
+// This function MUST be called with the address manager lock held.
+func (a *AddrManager) deserializeStore(meta *StoreMeta, addrs []*StoredAddress) error {
+	sam := serializedAddrManager{
+		Version:   meta.Version,
+		Key:       meta.Key,
+		ASMap:     meta.ASMap,
+		Addresses: make([]*serializedKnownAddress, 0, len(addrs)),
+	}
+	for _, sa := range addrs {
+		sam.Addresses = append(sam.Addresses, &serializedKnownAddress{
+			Addr:        sa.Addr,
+			Src:         sa.Src,
+			Attempts:    sa.Attempts,
+			TimeStamp:   sa.TimeStamp,
+			LastAttempt: sa.LastAttempt,
+			LastSuccess: sa.LastSuccess,
+			Services:    sa.Services,
+			SrcServices: sa.SrcServices,
+			Network:     sa.Network,
+		})
+		for _, bucket := range sa.NewBuckets {
+			if bucket < 0 || bucket >= newBucketCount {
+				return fmt.Errorf("address %s in invalid new "+
+					"bucket %d", sa.Addr, bucket)
+			}
+			sam.NewBuckets[bucket] = append(sam.NewBuckets[bucket],
+				sa.Addr)
+		}
+		if sa.TriedBucket >= triedBucketCount {
+			return fmt.Errorf("address %s in invalid tried bucket "+
+				"%d", sa.Addr, sa.TriedBucket)
+		}
+		if sa.TriedBucket >= 0 {
+			sam.TriedBuckets[sa.TriedBucket] = append(
+				sam.TriedBuckets[sa.TriedBucket], sa.Addr)
+		}
+	}
+	if err := a.deserialize(&sam); err != nil {
+		return err
+	}
+
+	// The addresses were moved to other buckets or dropped when they were
+	// rebucketed, so all of them need to be written again.
+	if sam.ASMap != a.asmapChecksum() {
+		for _, sa := range addrs {
+			a.markDirty(sa.Addr)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// attestationKeyFilename is the name of the file in the data directory
+	// which holds the hex encoded private key attestations are signed with.
+	attestationKeyFilename = "attestation.key"
+
+	// attestationTag prefixes the message signed by an attestation so the
+	// signature can not be mistaken for a signature over anything else.
+	attestationTag = "btcd chain attestation v1"
+
+	// attestationRecordSize is the size of a serialized attestation.
+	attestationRecordSize = 8 + 4 + 2*chainhash.HashSize + 8 + 8 + 65
+)
+
+// attestationBucketName is the name of the database bucket used to persist the
+// attestations.  The records are keyed by their big endian sequence number so
+// they are iterated in the order they were made.
+var attestationBucketName = []byte("attestations")
+
+// attestationRecord describes a signed attestation of the best block of the
+// main chain and the unspent transaction output set as of that block.
+type attestationRecord struct {
+	ID        uint64
+	Time      time.Time
+	State     blockchain.UtxoSetHash
+	Signature []byte
+}
+
+// message returns the hash of the message signed by the attestation on the
+// passed network.  It commits to everything in the attestation except its ID,
+// which is local to the database it is stored in.
+func (r *attestationRecord) message(net wire.BitcoinNet) chainhash.Hash {
+	var buf bytes.Buffer
+	buf.WriteString(attestationTag)
+	var scratch [8]byte
+	binary.LittleEndian.PutUint32(scratch[:4], uint32(net))
+	buf.Write(scratch[:4])
+	binary.LittleEndian.PutUint64(scratch[:], uint64(r.Time.Unix()))
+	buf.Write(scratch[:])
+	binary.LittleEndian.PutUint32(scratch[:4], uint32(r.State.Height))
+	buf.Write(scratch[:4])
+	buf.Write(r.State.Hash[:])
+	buf.Write(r.State.MuHash[:])
+	binary.LittleEndian.PutUint64(scratch[:], r.State.TxOuts)
+	buf.Write(scratch[:])
+	binary.LittleEndian.PutUint64(scratch[:], uint64(r.State.TotalAmount))
+	buf.Write(scratch[:])
+	return chainhash.DoubleHashH(buf.Bytes())
+}
+
+// serialize returns the serialized attestation.  The ID is not part of the
+// record since it is used as the key.
+func (r *attestationRecord) serialize() []byte {
+	serialized := make([]byte, attestationRecordSize)
+	binary.LittleEndian.PutUint64(serialized, uint64(r.Time.Unix()))
+	binary.LittleEndian.PutUint32(serialized[8:], uint32(r.State.Height))
+	offset := 12
+	copy(serialized[offset:], r.State.Hash[:])
+	offset += chainhash.HashSize
+	copy(serialized[offset:], r.State.MuHash[:])
+	offset += chainhash.HashSize
+	binary.LittleEndian.PutUint64(serialized[offset:], r.State.TxOuts)
+	offset += 8
+	binary.LittleEndian.PutUint64(serialized[offset:],
+		uint64(r.State.TotalAmount))
+	offset += 8
+	copy(serialized[offset:], r.Signature)
+	return serialized
+}
+
+// deserializeAttestationRecord returns the attestation with the passed ID
+// described by the passed serialized bytes.
+func deserializeAttestationRecord(id uint64, serialized []byte) (*attestationRecord, error) {
+	if len(serialized) != attestationRecordSize {
+		return nil, errors.New("malformed attestation record")
+	}
+	r := &attestationRecord{ID: id}
+	r.Time = time.Unix(int64(binary.LittleEndian.Uint64(serialized)), 0)
+	r.State.Height = int32(binary.LittleEndian.Uint32(serialized[8:]))
+	offset := 12
+	copy(r.State.Hash[:], serialized[offset:])
+	offset += chainhash.HashSize
+	copy(r.State.MuHash[:], serialized[offset:])
+	offset += chainhash.HashSize
+	r.State.TxOuts = binary.LittleEndian.Uint64(serialized[offset:])
+	offset += 8
+	r.State.TotalAmount = int64(binary.LittleEndian.Uint64(
+		serialized[offset:]))
+	offset += 8
+	r.Signature = append([]byte(nil), serialized[offset:]...)
+	return r, nil
+}
+
+// loadPrivateKey returns the private key stored hex encoded in the passed file.
+// A new key is generated and stored in the file when it does not exist.
+func loadPrivateKey(path string) (*btcec.PrivateKey, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			return nil, err
+		}
+		encoded := hex.EncodeToString(key.Serialize()) + "\n"
+		err = ioutil.WriteFile(path, []byte(encoded), 0600)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	serialized, err := hex.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil || len(serialized) != btcec.PrivKeyBytesLen {
+		return nil, fmt.Errorf("malformed private key %s", path)
+	}
+	key, _ := btcec.PrivKeyFromBytes(btcec.S256(), serialized)
+	return key, nil
+}
+
+// attestor periodically signs attestations of the best block of the main chain
+// and the MuHash3072 of the unspent transaction output set as of that block
+// with a node-local key and persists them to the database.  Comparing the
+// attestations of several nodes, or of one node over time, reveals a node whose
+// view of the chain silently diverged or whose storage was tampered with.
+type attestor struct {
+	chain    *blockchain.BlockChain
+	db       database.DB
+	net      wire.BitcoinNet
+	key      *btcec.PrivateKey
+	interval time.Duration
+
+	mtx    sync.Mutex
+	nextID uint64
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newAttestor returns a new attestor which signs attestations of the passed
+// chain with the passed key at the passed interval and persists them to the
+// passed database.
+func newAttestor(chain *blockchain.BlockChain, db database.DB,
+	net wire.BitcoinNet, key *btcec.PrivateKey,
+	interval time.Duration) (*attestor, error) {
+
+	a := &attestor{
+		chain:    chain,
+		db:       db,
+		net:      net,
+		key:      key,
+		interval: interval,
+		nextID:   1,
+		quit:     make(chan struct{}),
+	}
+	err := db.Update(func(dbTx database.Tx) error {
+		bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+			attestationBucketName)
+		if err != nil {
+			return err
+		}
+		cursor := bucket.Cursor()
+		if cursor.Last() {
+			a.nextID = binary.BigEndian.Uint64(cursor.Key()) + 1
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// PubKey returns the public key attestations are signed with.
+func (a *attestor) PubKey() *btcec.PublicKey {
+	return a.key.PubKey()
+}
+
+// Attest computes, signs, and persists an attestation of the current best
+// block.  Computing the MuHash3072 of the unspent transaction output set reads
+// the entire set, so it may be cancelled by closing the passed interrupt
+// channel.
+//
+// This function is safe for concurrent access.
+func (a *attestor) Attest(interrupt <-chan struct{}) (*attestationRecord, error) {
+	state, err := a.chain.UtxoSetMuHash(interrupt)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	record := &attestationRecord{
+		ID:    a.nextID,
+		Time:  time.Unix(time.Now().Unix(), 0),
+		State: *state,
+	}
+	message := record.message(a.net)
+	record.Signature, err = btcec.SignCompact(btcec.S256(), a.key,
+		message[:], true)
+	if err != nil {
+		return nil, err
+	}
+
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], record.ID)
+	err = a.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(attestationBucketName)
+		return bucket.Put(key[:], record.serialize())
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.nextID++
+	return record, nil
+}
+
+// attestHandler signs an attestation every interval while the chain is
+// current.  It must be run as a goroutine.
+func (a *attestor) attestHandler() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.quit:
+			return
+		}
+
+		if !a.chain.IsCurrent() {
+			continue
+		}
+		record, err := a.Attest(a.quit)
+		if err != nil {
+			select {
+			case <-a.quit:
+				return
+			default:
+			}
+			srvrLog.Errorf("Unable to attest to the chain state: %v", err)
+			continue
+		}
+		srvrLog.Infof("Attested to block %v (height %d) with UTXO set "+
+			"muhash %v", record.State.Hash, record.State.Height,
+			record.State.MuHash)
+	}
+}
+
+// Records returns up to count attestations starting after skipping the passed
+// number of attestations along with the total number of attestations.  The
+// attestations are ordered from the most recent to the oldest unless reverse
+// is set.
+//
+// This function is safe for concurrent access.
+func (a *attestor) Records(skip, count int, reverse bool) ([]*attestationRecord, int, error) {
+	var records []*attestationRecord
+	var total int
+	err := a.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(attestationBucketName)
+		cursor := bucket.Cursor()
+		first, next := cursor.Last, cursor.Prev
+		if reverse {
+			first, next = cursor.First, cursor.Next
+		}
+		for ok := first(); ok; ok = next() {
+			total++
+			if total <= skip || len(records) >= count {
+				continue
+			}
+			id := binary.BigEndian.Uint64(cursor.Key())
+			record, err := deserializeAttestationRecord(id,
+				cursor.Value())
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// Start begins signing attestations periodically.
+func (a *attestor) Start() {
+	a.wg.Add(1)
+	go a.attestHandler()
+}
+
+// Stop stops signing attestations and waits for the handler to exit.
+func (a *attestor) Stop() {
+	close(a.quit)
+	a.wg.Wait()
+}
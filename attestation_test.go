@@ -0,0 +1,119 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestAttestationRecordSerialization ensures attestations survive a round trip
+// through their serialized form.
+func TestAttestationRecordSerialization(t *testing.T) {
+	signature := make([]byte, 65)
+	for i := range signature {
+		signature[i] = byte(i)
+	}
+	want := &attestationRecord{
+		ID:   3,
+		Time: time.Unix(1600000000, 0),
+		State: blockchain.UtxoSetHash{
+			Hash:        chainhash.Hash{0x01},
+			Height:      652513,
+			MuHash:      chainhash.Hash{0x02},
+			TxOuts:      68741209,
+			TotalAmount: 1851847215000000,
+		},
+		Signature: signature,
+	}
+
+	serialized := want.serialize()
+	got, err := deserializeAttestationRecord(want.ID, serialized)
+	if err != nil {
+		t.Fatalf("unexpected deserialize error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mismatched record - got %+v, want %+v", got, want)
+	}
+
+	if _, err := deserializeAttestationRecord(1, serialized[:40]); err == nil {
+		t.Fatal("truncated record was not rejected")
+	}
+}
+
+// TestAttestationSignature ensures the attestation key is generated once and
+// reloaded afterwards, and that the signature of an attestation recovers to
+// its public key only for the network and state it was made for.
+func TestAttestationSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attestation")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, attestationKeyFilename)
+	key, err := loadPrivateKey(keyFile)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	reloaded, err := loadPrivateKey(keyFile)
+	if err != nil {
+		t.Fatalf("unable to reload key: %v", err)
+	}
+	if reloaded.D.Cmp(key.D) != 0 {
+		t.Fatal("reloaded key does not match the generated key")
+	}
+
+	record := &attestationRecord{
+		Time: time.Unix(1600000000, 0),
+		State: blockchain.UtxoSetHash{
+			Hash:   chainhash.Hash{0x01},
+			Height: 100,
+			MuHash: chainhash.Hash{0x02},
+			TxOuts: 10,
+		},
+	}
+	message := record.message(wire.MainNet)
+	record.Signature, err = btcec.SignCompact(btcec.S256(), key,
+		message[:], true)
+	if err != nil {
+		t.Fatalf("unable to sign: %v", err)
+	}
+
+	pubKey, _, err := btcec.RecoverCompact(btcec.S256(), record.Signature,
+		message[:])
+	if err != nil {
+		t.Fatalf("unable to recover public key: %v", err)
+	}
+	if !pubKey.IsEqual(key.PubKey()) {
+		t.Fatal("signature does not recover to the attestation key")
+	}
+
+	// The message must commit to the network and the chain state.
+	if record.message(wire.TestNet3) == message {
+		t.Fatal("message does not commit to the network")
+	}
+	record.State.MuHash[0] ^= 0xff
+	if record.message(wire.MainNet) == message {
+		t.Fatal("message does not commit to the muhash")
+	}
+
+	// A malformed key file must be rejected rather than replaced.
+	if err := ioutil.WriteFile(keyFile, []byte("zz"), 0600); err != nil {
+		t.Fatalf("unable to write key file: %v", err)
+	}
+	if _, err := loadPrivateKey(keyFile); err == nil {
+		t.Fatal("malformed key was not rejected")
+	}
+}
@@ -6,7 +6,6 @@ package blockchain
 
 import (
 	"math/big"
-	"sort"
 	"sync"
 	"time"
 
@@ -183,38 +182,7 @@ func (node *blockNode) RelativeAncestor(distance int32) *blockNode {
 //
 // This function is safe for concurrent access.
 func (node *blockNode) CalcPastMedianTime() time.Time {
-	// Create a slice of the previous few block timestamps used to calculate
-	// the median per the number defined by the constant medianTimeBlocks.
-	timestamps := make([]int64, medianTimeBlocks)
-	numNodes := 0
-	iterNode := node
-	for i := 0; i < medianTimeBlocks && iterNode != nil; i++ {
-		timestamps[i] = iterNode.timestamp
-		numNodes++
-
-		iterNode = iterNode.parent
-	}
-
-	// Prune the slice to the actual number of available timestamps which
-	// will be fewer than desired near the beginning of the block chain
-	// and sort them.
-	timestamps = timestamps[:numNodes]
-	sort.Sort(timeSorter(timestamps))
-
-	// NOTE: The consensus rules incorrectly calculate the median for even
-	// numbers of blocks.  A true median averages the middle two elements
-	// for a set with an even number of elements in it.   Since the constant
-	// for the previous number of blocks to be used is odd, this is only an
-	// issue for a few blocks near the beginning of the chain.  I suspect
-	// this is an optimization even though the result is slightly wrong for
-	// a few of the first blocks since after the first few blocks, there
-	// will always be an odd number of blocks in the set per the constant.
-	//
-	// This code follows suit to ensure the same rules are used, however, be
-	// aware that should the medianTimeBlocks constant ever be changed to an
-	// even number, this code will be wrong.
-	medianTimestamp := timestamps[numNodes/2]
-	return time.Unix(medianTimestamp, 0)
+	return CalcPastMedianTime(node)
 }
 
 // blockIndex provides facilities for keeping track of an in-memory index of the
@@ -232,6 +200,10 @@ type blockIndex struct {
 	sync.RWMutex
 	index map[chainhash.Hash]*blockNode
 	dirty map[*blockNode]struct{}
+
+	// tips holds the nodes in the index which have no children, which are
+	// the tips of the main chain and of all known forks.
+	tips map[*blockNode]struct{}
 }
 
 // newBlockIndex returns a new empty instance of a block index.  The index will
@@ -243,6 +215,7 @@ func newBlockIndex(db database.DB, chainParams *chaincfg.Params) *blockIndex {
 		chainParams: chainParams,
 		index:       make(map[chainhash.Hash]*blockNode),
 		dirty:       make(map[*blockNode]struct{}),
+		tips:        make(map[*blockNode]struct{}),
 	}
 }
 
@@ -279,11 +252,14 @@ func (bi *blockIndex) AddNode(node *blockNode) {
 }
 
 // addNode adds the provided node to the block index, but does not mark it as
-// dirty. This can be used while initializing the block index.
+// dirty. This can be used while initializing the block index.  Since nodes are
+// always added after their parent, the node replaces its parent as a tip.
 //
 // This function is NOT safe for concurrent access.
 func (bi *blockIndex) addNode(node *blockNode) {
 	bi.index[node.hash] = node
+	delete(bi.tips, node.parent)
+	bi.tips[node] = struct{}{}
 }
 
 // NodeStatus provides concurrent-safe access to the status field of a node.
@@ -0,0 +1,271 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+// FeeRatePercentiles are the percentiles of the transaction weight in a block
+// at which BlockStats reports the fee rate.
+var FeeRatePercentiles = [5]int{10, 25, 50, 75, 90}
+
+// BlockStats houses statistics about the transactions of a block.  Unless
+// noted otherwise, the statistics exclude the coinbase transaction.  Amounts
+// are in satoshi and fee rates are in satoshi per virtual byte.
+type BlockStats struct {
+	Hash       chainhash.Hash
+	Height     int32
+	Time       time.Time
+	MedianTime time.Time
+
+	// Txs is the number of transactions including the coinbase
+	// transaction, Inputs the number of inputs and Outputs the number of
+	// outputs including the ones of the coinbase transaction.
+	Txs     int
+	Inputs  int
+	Outputs int
+
+	// The following fields describe the serialized size and weight of the
+	// transactions.
+	TotalSize   int64
+	TotalWeight int64
+	MinTxSize   int64
+	MaxTxSize   int64
+	AvgTxSize   int64
+
+	// The following fields describe the transactions which have witness
+	// data.
+	SegwitTxs         int
+	SegwitTotalSize   int64
+	SegwitTotalWeight int64
+
+	// TotalOut is the total amount of the outputs and Subsidy is the block
+	// subsidy the coinbase transaction is allowed to claim in addition to
+	// the fees.
+	TotalOut int64
+	Subsidy  int64
+
+	// The following fields describe the fees paid by the transactions.
+	TotalFee  int64
+	MinFee    int64
+	MaxFee    int64
+	AvgFee    int64
+	MedianFee int64
+
+	// The following fields describe the fee rates of the transactions.
+	// The percentiles are weighted by the transaction weight and reported
+	// at FeeRatePercentiles.
+	MinFeeRate         int64
+	MaxFeeRate         int64
+	AvgFeeRate         int64
+	FeeRatePercentiles [5]int64
+
+	// UtxoIncrease is the change in the number of unspent outputs and
+	// UtxoSizeIncrease the change in their serialized size caused by the
+	// block including its coinbase transaction.
+	UtxoIncrease     int64
+	UtxoSizeIncrease int64
+}
+
+// utxoSize returns the size of the serialized utxo entry of the output with
+// the passed amount and script created at the passed height.
+func utxoSize(amount int64, pkScript []byte, height int32, isCoinBase bool) int64 {
+	headerCode := heightCoinbaseCode(height, isCoinBase)
+	return int64(serializeSizeVLQ(headerCode) +
+		compressedTxOutSize(uint64(amount), pkScript))
+}
+
+// CalcBlockStats calculates the statistics of the passed block given the
+// outputs spent by it, which must be in the order of the spend journal.  The
+// height of the block must be set.  The median time of the block is not known
+// from the block alone, so it is left unset.
+func CalcBlockStats(block *btcutil.Block, stxos []SpentTxOut,
+	params *chaincfg.Params) (*BlockStats, error) {
+
+	height := block.Height()
+	if height == btcutil.BlockHeightUnknown {
+		return nil, AssertError("CalcBlockStats called for a block " +
+			"with an unknown height")
+	}
+	txns := block.Transactions()
+	stats := &BlockStats{
+		Hash:    *block.Hash(),
+		Height:  height,
+		Time:    block.MsgBlock().Header.Timestamp,
+		Txs:     len(txns),
+		Subsidy: CalcBlockSubsidy(height, params),
+	}
+
+	type txFeeRate struct {
+		feeRate int64
+		weight  int64
+	}
+	fees := make([]int64, 0, len(txns))
+	feeRates := make([]txFeeRate, 0, len(txns))
+	stxoIdx := 0
+	for i, tx := range txns {
+		msgTx := tx.MsgTx()
+		stats.Outputs += len(msgTx.TxOut)
+
+		// Account for the outputs which are added to the utxo set.
+		var totalOut int64
+		for _, txOut := range msgTx.TxOut {
+			totalOut += txOut.Value
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			stats.UtxoIncrease++
+			stats.UtxoSizeIncrease += utxoSize(txOut.Value,
+				txOut.PkScript, height, i == 0)
+		}
+		if i == 0 {
+			continue
+		}
+
+		// Account for the outputs which are spent by the inputs.
+		var totalIn int64
+		for range msgTx.TxIn {
+			if stxoIdx >= len(stxos) {
+				return nil, AssertError(fmt.Sprintf("missing spent "+
+					"outputs for block %v", block.Hash()))
+			}
+			stxo := &stxos[stxoIdx]
+			stxoIdx++
+			totalIn += stxo.Amount
+			stats.UtxoIncrease--
+			stats.UtxoSizeIncrease -= utxoSize(stxo.Amount,
+				stxo.PkScript, stxo.Height, stxo.IsCoinBase)
+		}
+		stats.Inputs += len(msgTx.TxIn)
+		stats.TotalOut += totalOut
+
+		size := int64(msgTx.SerializeSize())
+		weight := GetTransactionWeight(tx)
+		stats.TotalSize += size
+		stats.TotalWeight += weight
+		if stats.MinTxSize == 0 || size < stats.MinTxSize {
+			stats.MinTxSize = size
+		}
+		if size > stats.MaxTxSize {
+			stats.MaxTxSize = size
+		}
+		if msgTx.HasWitness() {
+			stats.SegwitTxs++
+			stats.SegwitTotalSize += size
+			stats.SegwitTotalWeight += weight
+		}
+
+		fee := totalIn - totalOut
+		feeRate := fee * WitnessScaleFactor / weight
+		stats.TotalFee += fee
+		if len(fees) == 0 || fee < stats.MinFee {
+			stats.MinFee = fee
+		}
+		if fee > stats.MaxFee {
+			stats.MaxFee = fee
+		}
+		if len(fees) == 0 || feeRate < stats.MinFeeRate {
+			stats.MinFeeRate = feeRate
+		}
+		if feeRate > stats.MaxFeeRate {
+			stats.MaxFeeRate = feeRate
+		}
+		fees = append(fees, fee)
+		feeRates = append(feeRates, txFeeRate{feeRate, weight})
+	}
+	if stxoIdx != len(stxos) {
+		return nil, AssertError(fmt.Sprintf("block %v spends %d outputs, "+
+			"but %d spent outputs were provided", block.Hash(),
+			stxoIdx, len(stxos)))
+	}
+	if len(fees) == 0 {
+		return stats, nil
+	}
+
+	numTxns := int64(len(fees))
+	stats.AvgTxSize = stats.TotalSize / numTxns
+	stats.AvgFee = stats.TotalFee / numTxns
+	stats.AvgFeeRate = stats.TotalFee * WitnessScaleFactor /
+		stats.TotalWeight
+
+	// The median fee is the average of the two middle fees when there is
+	// an even number of transactions.
+	sort.Slice(fees, func(i, j int) bool { return fees[i] < fees[j] })
+	if len(fees)%2 == 0 {
+		stats.MedianFee = (fees[len(fees)/2-1] + fees[len(fees)/2]) / 2
+	} else {
+		stats.MedianFee = fees[len(fees)/2]
+	}
+
+	// Walk the transactions in order of their fee rates and record the fee
+	// rate of the transaction at which the cumulative weight reaches each
+	// of the percentiles of the total weight.
+	sort.SliceStable(feeRates, func(i, j int) bool {
+		return feeRates[i].feeRate < feeRates[j].feeRate
+	})
+	next := 0
+	var cumulativeWeight int64
+	for _, txRate := range feeRates {
+		cumulativeWeight += txRate.weight
+		for next < len(FeeRatePercentiles) && cumulativeWeight*100 >=
+			stats.TotalWeight*int64(FeeRatePercentiles[next]) {
+
+			stats.FeeRatePercentiles[next] = txRate.feeRate
+			next++
+		}
+	}
+	for ; next < len(FeeRatePercentiles); next++ {
+		stats.FeeRatePercentiles[next] = feeRates[len(feeRates)-1].feeRate
+	}
+
+	return stats, nil
+}
+
+// BlockStatsByHash returns the statistics of the block of the main chain with
+// the passed hash.  The block and its spend journal entry must be available,
+// so statistics are not available for pruned blocks.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockStatsByHash(hash *chainhash.Hash) (*BlockStats, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil || !b.bestChain.Contains(node) {
+		str := fmt.Sprintf("block %s is not in the main chain", hash)
+		return nil, errNotInMainChain(str)
+	}
+
+	var block *btcutil.Block
+	var stxos []SpentTxOut
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		block, err = dbFetchBlockByNode(dbTx, node)
+		if err != nil {
+			return err
+		}
+		stxos, err = b.fetchSpendJournalEntry(dbTx, block)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := CalcBlockStats(block, stxos, b.chainParams)
+	if err != nil {
+		return nil, err
+	}
+	stats.MedianTime = node.CalcPastMedianTime()
+	return stats, nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestCalcBlockStats ensures the statistics of a block are calculated from its
+// transactions and the outputs they spend.
+func TestCalcBlockStats(t *testing.T) {
+	p2pkh := []byte{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_DATA_20}
+	p2pkh = append(p2pkh, make([]byte, 20)...)
+	p2pkh = append(p2pkh, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG)
+	nullData := []byte{txscript.OP_RETURN, txscript.OP_DATA_1, 0x01}
+
+	newTx := func(numInputs int, witness bool, outputs ...int64) *wire.MsgTx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		for i := 0; i < numInputs; i++ {
+			txIn := wire.NewTxIn(&wire.OutPoint{
+				Hash:  chainhash.Hash{byte(i + 1)},
+				Index: uint32(i),
+			}, nil, nil)
+			if witness {
+				txIn.Witness = wire.TxWitness{make([]byte, 72),
+					make([]byte, 33)}
+			} else {
+				txIn.SignatureScript = make([]byte, 106)
+			}
+			tx.AddTxIn(txIn)
+		}
+		for _, value := range outputs {
+			tx.AddTxOut(wire.NewTxOut(value, p2pkh))
+		}
+		return tx
+	}
+
+	// The coinbase creates a spendable and an unspendable output, the
+	// first transaction pays a fee of 100 and the second one, which has
+	// witness data, pays a fee of 1000.
+	coinbase := newTx(1, false, 5000000000)
+	coinbase.TxIn[0].PreviousOutPoint = wire.OutPoint{Index: wire.MaxPrevOutIndex}
+	coinbase.AddTxOut(wire.NewTxOut(0, nullData))
+	tx1 := newTx(1, false, 900)
+	tx2 := newTx(2, true, 1500, 2500)
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{})
+	for _, tx := range []*wire.MsgTx{coinbase, tx1, tx2} {
+		msgBlock.AddTransaction(tx)
+	}
+	block := btcutil.NewBlock(msgBlock)
+	stxos := []SpentTxOut{
+		{Amount: 1000, PkScript: p2pkh, Height: 10},
+		{Amount: 3000, PkScript: p2pkh, Height: 20, IsCoinBase: true},
+		{Amount: 2000, PkScript: p2pkh, Height: 30},
+	}
+	params := &chaincfg.MainNetParams
+
+	// The height of the block is required.
+	if _, err := CalcBlockStats(block, stxos, params); err == nil {
+		t.Fatal("CalcBlockStats: accepted a block without a height")
+	}
+	block.SetHeight(100)
+
+	// The number of spent outputs must match the inputs.
+	if _, err := CalcBlockStats(block, stxos[:2], params); err == nil {
+		t.Fatal("CalcBlockStats: accepted missing spent outputs")
+	}
+	extra := append(stxos[:len(stxos):len(stxos)], stxos[0])
+	if _, err := CalcBlockStats(block, extra, params); err == nil {
+		t.Fatal("CalcBlockStats: accepted extra spent outputs")
+	}
+
+	stats, err := CalcBlockStats(block, stxos, params)
+	if err != nil {
+		t.Fatalf("CalcBlockStats: %v", err)
+	}
+
+	size1 := int64(tx1.SerializeSize())
+	size2 := int64(tx2.SerializeSize())
+	weight1 := GetTransactionWeight(btcutil.NewTx(tx1))
+	weight2 := GetTransactionWeight(btcutil.NewTx(tx2))
+	feeRate1 := 100 * WitnessScaleFactor / weight1
+	feeRate2 := 1000 * WitnessScaleFactor / weight2
+	spentSize := utxoSize(1000, p2pkh, 10, false) +
+		utxoSize(3000, p2pkh, 20, true) + utxoSize(2000, p2pkh, 30, false)
+	createdSize := utxoSize(5000000000, p2pkh, 100, true) +
+		utxoSize(900, p2pkh, 100, false) +
+		utxoSize(1500, p2pkh, 100, false) +
+		utxoSize(2500, p2pkh, 100, false)
+
+	// The first transaction has the lower fee rate and makes up between
+	// 25 and 50 percent of the total weight, so it determines the 10th and
+	// 25th percentiles.
+	want := BlockStats{
+		Hash:               *block.Hash(),
+		Height:             100,
+		Time:               msgBlock.Header.Timestamp,
+		Txs:                3,
+		Inputs:             3,
+		Outputs:            5,
+		TotalSize:          size1 + size2,
+		TotalWeight:        weight1 + weight2,
+		MinTxSize:          size1,
+		MaxTxSize:          size2,
+		AvgTxSize:          (size1 + size2) / 2,
+		SegwitTxs:          1,
+		SegwitTotalSize:    size2,
+		SegwitTotalWeight:  weight2,
+		TotalOut:           4900,
+		Subsidy:            5000000000,
+		TotalFee:           1100,
+		MinFee:             100,
+		MaxFee:             1000,
+		AvgFee:             550,
+		MedianFee:          550,
+		MinFeeRate:         feeRate1,
+		MaxFeeRate:         feeRate2,
+		AvgFeeRate:         1100 * WitnessScaleFactor / (weight1 + weight2),
+		UtxoIncrease:       1,
+		UtxoSizeIncrease:   createdSize - spentSize,
+		FeeRatePercentiles: [5]int64{feeRate1, feeRate1, feeRate2, feeRate2, feeRate2},
+	}
+	totalWeight := weight1 + weight2
+	if feeRate1 >= feeRate2 || weight1*100 < totalWeight*25 ||
+		weight1*100 >= totalWeight*50 {
+
+		t.Fatalf("test transaction weights changed: %d, %d", weight1,
+			weight2)
+	}
+	if *stats != want {
+		t.Fatalf("CalcBlockStats: unexpected stats\ngot:  %+v\nwant: %+v",
+			*stats, want)
+	}
+}
@@ -20,9 +20,17 @@ import (
 )
 
 const (
-	// maxOrphanBlocks is the maximum number of orphan blocks that can be
-	// queued.
-	maxOrphanBlocks = 100
+	// DefaultMaxOrphanBlocks is the default maximum number of orphan blocks
+	// that can be queued.
+	DefaultMaxOrphanBlocks = 100
+
+	// DefaultMaxOrphanBlockBytes is the default maximum total serialized
+	// size of the orphan blocks that can be queued.
+	DefaultMaxOrphanBlockBytes = 64 * 1024 * 1024
+
+	// DefaultOrphanBlockExpiry is the default time orphan blocks are kept
+	// before they expire.
+	DefaultOrphanBlockExpiry = time.Hour
 )
 
 // BlockLocator is used to help locate a specific block.  The algorithm for
@@ -54,9 +62,42 @@ type BlockLocator []*chainhash.Hash
 // 这是一个正常的块, 加上一个到期时间以防止永远缓存该孤儿.
 type orphanBlock struct {
 	block      *btcutil.Block
+	size       int64
 	expiration time.Time
 }
 
+// orphanRemoval identifies the reason an orphan block is removed from the
+// orphan pool.
+type orphanRemoval int
+
+const (
+	// orphanConnected indicates the parent of the orphan block arrived
+	// so it is no longer an orphan.
+	orphanConnected orphanRemoval = iota
+
+	// orphanExpired indicates the orphan block expired.
+	orphanExpired
+
+	// orphanEvicted indicates the orphan block was evicted to make room
+	// for a new one.
+	orphanEvicted
+)
+
+// OrphanBlockStats houses the state of the orphan block pool along with the
+// number of orphan blocks which went through it since the chain instance was
+// created.
+type OrphanBlockStats struct {
+	Count     int
+	Bytes     int64
+	MaxCount  int
+	MaxBytes  int64
+	Expiry    time.Duration
+	Added     uint64
+	Connected uint64
+	Expired   uint64
+	Evicted   uint64
+}
+
 // BestState houses information about the current best block and other info
 // related to the state of the main chain as it exists from the point of view of
 // the current best block.
@@ -113,8 +154,7 @@ type BlockChain struct {
 	// separate mutex.
 	//
 	// 以下字段在创建实例时设置, 以后无法更改, 因此无需使用单独的互斥锁来保护它们.
-	checkpoints         []chaincfg.Checkpoint
-	checkpointsByHeight map[int32]*chaincfg.Checkpoint
+	checkpointMode      CheckpointMode
 	db                  database.DB
 	chainParams         *chaincfg.Params
 	timeSource          MedianTimeSource
@@ -148,15 +188,63 @@ type BlockChain struct {
 	//
 	// bestChain tracks the current active chain by making use of an
 	// efficient chain view into the block index.
-	index     *blockIndex
-	bestChain *chainView
+	//
+	// headerIndex is a copy of the headers of the best chain guarded by its
+	// own lock which is used to serve headers without waiting for the chain
+	// lock.  It is updated along with bestChain.
+	index       *blockIndex
+	bestChain   *chainView
+	headerIndex *headerIndex
+
+	// utxoCache caches the unspent transaction outputs in front of the
+	// utxo set in the database.  It has its own lock, however it is also
+	// protected by the chain lock so its state matches the best chain.
+	utxoCache *utxoCache
+
+	// snapshotValidation tracks the background validation of the blocks
+	// before a loaded utxo set snapshot.  It is nil when no snapshot is
+	// being validated and is protected by the chain lock.
+	snapshotValidation *snapshotValidation
+
+	// utxoSetState houses the statistics of the utxo set which are
+	// maintained incrementally.  It is nil when they are not maintained
+	// and is protected by the chain lock.  It is replaced rather than
+	// modified as blocks are connected and disconnected.
+	utxoSetState *utxoSetState
+
+	// pruneDepth is the number of blocks below the best chain tip whose
+	// data is retained, or zero when pruning is disabled.  It is set when
+	// the instance is created.
+	//
+	// prunedHeight is the height of the most recent block of the main
+	// chain which has been pruned.  It is protected by the chain lock.
+	pruneDepth   int32
+	prunedHeight int32
+
+	// scriptPool validates the scripts of the inputs of the blocks which
+	// are connected.  It is set when the instance is created.
+	scriptPool *scriptValidatorPool
 
 	// These fields are related to handling of orphan blocks.  They are
 	// protected by a combination of the chain lock and the orphan lock.
-	orphanLock   sync.RWMutex
-	orphans      map[chainhash.Hash]*orphanBlock
-	prevOrphans  map[chainhash.Hash][]*orphanBlock
-	oldestOrphan *orphanBlock
+	// The limits are set when the instance is created and can't be
+	// changed afterwards.
+	maxOrphanBlocks int
+	maxOrphanBytes  int64
+	orphanExpiry    time.Duration
+	orphanLock      sync.RWMutex
+	orphans         map[chainhash.Hash]*orphanBlock
+	prevOrphans     map[chainhash.Hash][]*orphanBlock
+	orphanStats     OrphanBlockStats
+
+	// These fields hold the checkpoints the chain is validated against.
+	// Local checkpoints may be added while the chain is running, so they
+	// are protected by the checkpoints lock.  Modifying them also requires
+	// the chain lock to be held so code running with the chain lock held
+	// may read them directly.
+	checkpointsLock     sync.RWMutex
+	checkpoints         []chaincfg.Checkpoint
+	checkpointsByHeight map[int32]*chaincfg.Checkpoint
 
 	// These fields are related to checkpoint handling.  They are protected
 	// by the chain lock.
@@ -209,6 +297,13 @@ type BlockChain struct {
 	// certain blockchain events.
 	notificationsLock sync.RWMutex
 	notifications     []NotificationCallback
+
+	// subscriptions holds the typed subscriptions to the notifications
+	// and notificationSeq the sequence number of the last notification
+	// published to them.
+	subscriptionsLock sync.Mutex
+	subscriptions     []*Subscription
+	notificationSeq   uint64
 }
 
 // HaveBlock returns whether or not the chain instance has the block represented
@@ -270,9 +365,50 @@ func (b *BlockChain) GetOrphanRoot(hash *chainhash.Hash) *chainhash.Hash {
 	return orphanRoot
 }
 
+// OrphanRoots returns the hashes of the orphan blocks whose parents are not
+// orphan blocks themselves and have not expired.  The parents of these blocks
+// are the blocks which are missing to connect the orphan blocks.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) OrphanRoots() []*chainhash.Hash {
+	b.orphanLock.RLock()
+	defer b.orphanLock.RUnlock()
+
+	now := time.Now()
+	var roots []*chainhash.Hash
+	for hash, orphan := range b.orphans {
+		if now.After(orphan.expiration) {
+			continue
+		}
+		prevHash := &orphan.block.MsgBlock().Header.PrevBlock
+		if _, exists := b.orphans[*prevHash]; exists {
+			continue
+		}
+		hash := hash
+		roots = append(roots, &hash)
+	}
+	return roots
+}
+
+// OrphanStats returns the current state of the orphan block pool along with
+// the number of orphan blocks which were added to it and removed from it.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) OrphanStats() OrphanBlockStats {
+	b.orphanLock.RLock()
+	stats := b.orphanStats
+	stats.Count = len(b.orphans)
+	b.orphanLock.RUnlock()
+
+	stats.MaxCount = b.maxOrphanBlocks
+	stats.MaxBytes = b.maxOrphanBytes
+	stats.Expiry = b.orphanExpiry
+	return stats
+}
+
 // removeOrphanBlock removes the passed orphan block from the orphan pool and
-// previous orphan index.
-func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock) {
+// previous orphan index for the passed reason.
+func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock, reason orphanRemoval) {
 	// Protect concurrent access.
 	b.orphanLock.Lock()
 	defer b.orphanLock.Unlock()
@@ -280,6 +416,15 @@ func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock) {
 	// Remove the orphan block from the orphan pool.
 	orphanHash := orphan.block.Hash()
 	delete(b.orphans, *orphanHash)
+	b.orphanStats.Bytes -= orphan.size
+	switch reason {
+	case orphanConnected:
+		b.orphanStats.Connected++
+	case orphanExpired:
+		b.orphanStats.Expired++
+	case orphanEvicted:
+		b.orphanStats.Evicted++
+	}
 
 	// Remove the reference from the previous orphan index too.  An indexing
 	// for loop is intentionally used over a range here as range does not
@@ -308,29 +453,40 @@ func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock) {
 // addOrphanBlock adds the passed block (which is already determined to be
 // an orphan prior calling this function) to the orphan pool.  It lazily cleans
 // up any expired blocks so a separate cleanup poller doesn't need to be run.
-// It also imposes a maximum limit on the number of outstanding orphan
-// blocks and will remove the oldest received orphan block if the limit is
-// exceeded.
+// It also imposes maximum limits on the number and the total size of the
+// outstanding orphan blocks and will remove the oldest received orphan blocks
+// as long as the limits are exceeded.  A block which exceeds the size limit
+// on its own is not added.
 func (b *BlockChain) addOrphanBlock(block *btcutil.Block) {
 	// Remove expired orphan blocks.
+	now := time.Now()
 	for _, oBlock := range b.orphans {
-		if time.Now().After(oBlock.expiration) {
-			b.removeOrphanBlock(oBlock)
-			continue
+		if now.After(oBlock.expiration) {
+			b.removeOrphanBlock(oBlock, orphanExpired)
 		}
+	}
 
-		// Update the oldest orphan block pointer so it can be discarded
-		// in case the orphan pool fills up.
-		if b.oldestOrphan == nil || oBlock.expiration.Before(b.oldestOrphan.expiration) {
-			b.oldestOrphan = oBlock
-		}
+	size := int64(block.MsgBlock().SerializeSize())
+	if size > b.maxOrphanBytes || b.maxOrphanBlocks <= 0 {
+		log.Debugf("Not adding orphan block %v of %d bytes which "+
+			"exceeds the orphan pool limits", block.Hash(), size)
+		return
 	}
 
 	// Limit orphan blocks to prevent memory exhaustion.
-	if len(b.orphans)+1 > maxOrphanBlocks {
+	for len(b.orphans)+1 > b.maxOrphanBlocks ||
+		b.orphanStats.Bytes+size > b.maxOrphanBytes {
+
 		// Remove the oldest orphan to make room for the new one.
-		b.removeOrphanBlock(b.oldestOrphan)
-		b.oldestOrphan = nil
+		var oldest *orphanBlock
+		for _, oBlock := range b.orphans {
+			if oldest == nil || oBlock.expiration.Before(oldest.expiration) {
+				oldest = oBlock
+			}
+		}
+		log.Debugf("Evicting orphan block %v to make room for %v",
+			oldest.block.Hash(), block.Hash())
+		b.removeOrphanBlock(oldest, orphanEvicted)
 	}
 
 	// Protect concurrent access.  This is intentionally done here instead
@@ -340,13 +496,15 @@ func (b *BlockChain) addOrphanBlock(block *btcutil.Block) {
 	defer b.orphanLock.Unlock()
 
 	// Insert the block into the orphan map with an expiration time
-	// 1 hour from now.
-	expiration := time.Now().Add(time.Hour)
+	// after the configured expiry.
 	oBlock := &orphanBlock{
 		block:      block,
-		expiration: expiration,
+		size:       size,
+		expiration: now.Add(b.orphanExpiry),
 	}
 	b.orphans[*block.Hash()] = oBlock
+	b.orphanStats.Bytes += size
+	b.orphanStats.Added++
 
 	// Add to previous hash lookup index for faster dependency lookups.
 	prevHash := &block.MsgBlock().Header.PrevBlock
@@ -632,6 +790,21 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 	state := newBestState(node, blockSize, blockWeight, numTxns,
 		curTotalTxns+numTxns, node.CalcPastMedianTime())
 
+	// Defer writing the spend journal entry to the next flush of the utxo
+	// cache while the chain is syncing.
+	batchSpendJournal := !b.isCurrent()
+
+	// Update the statistics of the utxo set for the block when they are
+	// maintained.
+	var utxoSetState *utxoSetState
+	if b.utxoSetState != nil {
+		utxoSetState, err = b.utxoSetStateAfterConnect(node, block,
+			stxos)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Atomically insert info into the database.
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
@@ -647,19 +820,21 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 			return err
 		}
 
-		// Update the utxo set using the state of the utxo view.  This
-		// entails removing all of the utxos spent and adding the new
-		// ones created by the block.
-		err = dbPutUtxoView(dbTx, view)
-		if err != nil {
-			return err
+		if utxoSetState != nil {
+			err = dbPutUtxoSetState(dbTx, utxoSetState)
+			if err != nil {
+				return err
+			}
 		}
 
 		// Update the transaction spend journal by adding a record for
 		// the block that contains all txos spent by it.
-		err = dbPutSpendJournalEntry(dbTx, block.Hash(), stxos)
-		if err != nil {
-			return err
+		if !batchSpendJournal {
+			err = dbPutSpendJournalEntry(dbTx, block.Hash(),
+				node.height, stxos)
+			if err != nil {
+				return err
+			}
 		}
 
 		// Allow the index manager to call each of the currently active
@@ -678,12 +853,32 @@ func (b *BlockChain) connectBlock(node *blockNode, block *btcutil.Block,
 		return err
 	}
 
+	// Update the utxo cache using the state of the utxo view.  This
+	// entails removing all of the utxos spent and adding the new ones
+	// created by the block.  The cache writes them to the database when it
+	// is flushed, along with the spend journal entry when it was deferred.
+	// Should the node not shut down cleanly before then, the entry is
+	// recreated when the block is replayed.
+	if batchSpendJournal {
+		b.utxoCache.addSpendJournalEntry(block.Hash(),
+			serializeSpendJournalEntry(stxos, node.height))
+	}
+	b.utxoCache.commit(view)
+	err = b.utxoCache.flush(FlushPeriodic, &node.hash)
+	if err != nil {
+		return err
+	}
+
 	// Prune fully spent entries and mark all entries in the view unmodified
-	// now that the modifications have been committed to the database.
+	// now that the modifications have been committed to the utxo cache.
 	view.commit()
 
 	// This node is now the end of the best chain.
 	b.bestChain.SetTip(node)
+	b.headerIndex.setTip(node)
+	if utxoSetState != nil {
+		b.utxoSetState = utxoSetState
+	}
 
 	// Update the state for the best block.  Notice how this replaces the
 	// entire struct instead of updating the existing one.  This effectively
@@ -745,6 +940,7 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 	state := newBestState(prevNode, blockSize, blockWeight, numTxns,
 		newTotalTxns, prevNode.CalcPastMedianTime())
 
+	var utxoSetState *utxoSetState
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
 		err := dbPutBestState(dbTx, state, node.workSum)
@@ -761,22 +957,40 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 
 		// Update the utxo set using the state of the utxo view.  This
 		// entails restoring all of the utxos spent and removing the new
-		// ones created by the block.
+		// ones created by the block.  The utxo cache was flushed before
+		// the reorganization, so the utxo set in the database is
+		// updated directly.
 		err = dbPutUtxoView(dbTx, view)
 		if err != nil {
 			return err
 		}
+		err = dbPutUtxoStateConsistency(dbTx, &prevNode.hash)
+		if err != nil {
+			return err
+		}
 
 		// Before we delete the spend journal entry for this back,
 		// we'll fetch it as is so the indexers can utilize if needed.
-		stxos, err := dbFetchSpendJournalEntry(dbTx, block)
+		stxos, err := b.fetchSpendJournalEntry(dbTx, block)
 		if err != nil {
 			return err
 		}
 
+		// Update the statistics of the utxo set for the block when
+		// they are maintained.
+		if b.utxoSetState != nil {
+			utxoSetState = b.utxoSetState.clone()
+			utxoSetState.disconnectBlock(block, node.height, stxos,
+				&prevNode.hash)
+			err = dbPutUtxoSetState(dbTx, utxoSetState)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Update the transaction spend journal by removing the record
 		// that contains all txos spent by the block.
-		err = dbRemoveSpendJournalEntry(dbTx, block.Hash())
+		err = b.removeSpendJournalEntry(dbTx, block.Hash())
 		if err != nil {
 			return err
 		}
@@ -797,12 +1011,18 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *btcutil.Block, view
 		return err
 	}
 
-	// Prune fully spent entries and mark all entries in the view unmodified
-	// now that the modifications have been committed to the database.
+	// Drop the entries of the utxo cache which are outdated now that the
+	// modifications have been committed to the database.  Then prune fully
+	// spent entries and mark all entries in the view unmodified.
+	b.utxoCache.evictView(view, &prevNode.hash)
 	view.commit()
 
 	// This node's parent is now the end of the best chain.
 	b.bestChain.SetTip(node.parent)
+	b.headerIndex.setTip(node.parent)
+	if utxoSetState != nil {
+		b.utxoSetState = utxoSetState
+	}
 
 	// Update the state for the best block.  Notice how this replaces the
 	// entire struct instead of updating the existing one.  This effectively
@@ -873,6 +1093,41 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		}
 	}
 
+	// The blocks before a loaded utxo set snapshot are not available until
+	// they have been validated in the background, so they can't be
+	// disconnected.
+	if sv := b.snapshotValidation; sv != nil && detachNodes.Len() != 0 {
+		lastDetachNode := detachNodes.Back().Value.(*blockNode)
+		if lastDetachNode.height <= sv.base.height {
+			str := fmt.Sprintf("block %v forks the main chain before "+
+				"the utxo snapshot at height %d",
+				&lastDetachNode.hash, sv.base.height)
+			return ruleError(ErrForkTooOld, str)
+		}
+	}
+
+	// The blocks which have been pruned can't be disconnected.
+	if detachNodes.Len() != 0 {
+		lastDetachNode := detachNodes.Back().Value.(*blockNode)
+		if lastDetachNode.height <= b.prunedHeight {
+			str := fmt.Sprintf("block %v forks the main chain before "+
+				"the pruned height %d", &lastDetachNode.hash,
+				b.prunedHeight)
+			return ruleError(ErrForkTooOld, str)
+		}
+	}
+
+	// Flush the utxo cache before disconnecting any blocks since their
+	// modifications are written to the utxo set in the database directly
+	// and restoring outputs from legacy spend journal entries relies on
+	// it.
+	if detachNodes.Len() != 0 {
+		err := b.utxoCache.flush(FlushRequired, &tip.hash)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Track the old and new best chains heads.
 	oldBest := tip
 	newBest := tip
@@ -911,7 +1166,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err = view.fetchInputUtxos(b.db, block)
+		err = view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -920,7 +1175,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// journal.
 		var stxos []SpentTxOut
 		err = b.db.View(func(dbTx database.Tx) error {
-			stxos, err = dbFetchSpendJournalEntry(dbTx, block)
+			stxos, err = b.fetchSpendJournalEntry(dbTx, block)
 			return err
 		})
 		if err != nil {
@@ -978,7 +1233,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// checkConnectBlock gets skipped, we still need to update the UTXO
 		// view.
 		if b.index.NodeStatus(n).KnownValid() {
-			err = view.fetchInputUtxos(b.db, block)
+			err = view.fetchInputUtxos(b.utxoCache, block)
 			if err != nil {
 				return err
 			}
@@ -999,7 +1254,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// In the case the block is determined to be invalid due to a
 		// rule violation, mark it as invalid and mark all of its
 		// descendants as having an invalid ancestor.
-		err = b.checkConnectBlock(n, block, view, nil)
+		err = b.checkConnectBlock(n, block, view, nil, b.utxoCache)
 		if err != nil {
 			if _, ok := err.(RuleError); ok {
 				b.index.SetStatusFlags(n, statusValidateFailed)
@@ -1015,6 +1270,36 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		newBest = n
 	}
 
+	// Notify the caller that the reorganization, which passed the checks
+	// above, is about to modify the main chain.  The fork point is the
+	// parent of the last block to detach, or the current best chain head
+	// when blocks are only attached.
+	fork := oldBest
+	if detachNodes.Len() > 0 {
+		fork = detachNodes.Back().Value.(*blockNode).parent
+	}
+	reorg := &Reorganization{
+		ForkHash:       fork.hash,
+		ForkHeight:     fork.height,
+		OldTipHash:     oldBest.hash,
+		OldTipHeight:   oldBest.height,
+		NewTipHash:     newBest.hash,
+		NewTipHeight:   newBest.height,
+		DetachedBlocks: len(detachBlocks),
+		AttachedBlocks: len(attachBlocks),
+		Time:           time.Now(),
+	}
+	for _, block := range detachBlocks {
+		reorg.DetachedTxns += len(block.Transactions())
+	}
+	for _, block := range attachBlocks {
+		reorg.AttachedTxns += len(block.Transactions())
+	}
+	started := *reorg
+	b.chainLock.Unlock()
+	b.sendNotification(NTReorganizationStarted, &started)
+	b.chainLock.Lock()
+
 	// Reset the view for the actual connection code below.  This is
 	// required because the view was previously modified when checking if
 	// the reorg would be successful and the connection code requires the
@@ -1030,7 +1315,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
+		err := view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1057,7 +1342,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := view.fetchInputUtxos(b.db, block)
+		err := view.fetchInputUtxos(b.utxoCache, block)
 		if err != nil {
 			return err
 		}
@@ -1090,6 +1375,12 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	log.Infof("REORGANIZE: New best chain head is %v (height %v)",
 		newBest.hash, newBest.height)
 
+	// Notify the caller of the reorganization as a whole.
+	reorg.Time = time.Now()
+	b.chainLock.Unlock()
+	b.sendNotification(NTReorganization, reorg)
+	b.chainLock.Lock()
+
 	return nil
 }
 
@@ -1135,7 +1426,8 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 		view.SetBestHash(parentHash)
 		stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
 		if !fastAdd {
-			err := b.checkConnectBlock(node, block, view, &stxos)
+			err := b.checkConnectBlock(node, block, view, &stxos,
+				b.utxoCache)
 			if err == nil {
 				b.index.SetStatusFlags(node, statusValid)
 			} else if _, ok := err.(RuleError); ok {
@@ -1156,7 +1448,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 		// utxos, spend them, and add the new utxos being created by
 		// this block.
 		if fastAdd {
-			err := view.fetchInputUtxos(b.db, block)
+			err := view.fetchInputUtxos(b.utxoCache, block)
 			if err != nil {
 				return false, err
 			}
@@ -1249,8 +1541,8 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *btcutil.Block, fla
 // This function MUST be called with the chain state lock held (for reads).
 func (b *BlockChain) isCurrent() bool {
 	// Not current if the latest main (best) chain height is before the
-	// latest known good checkpoint (when checkpoints are enabled).
-	checkpoint := b.LatestCheckpoint()
+	// latest known good checkpoint (when checkpoints are enforced).
+	checkpoint := b.enforcedLatestCheckpoint()
 	if checkpoint != nil && b.bestChain.Tip().height < checkpoint.Height {
 		return false
 	}
@@ -1312,6 +1604,16 @@ func (b *BlockChain) MainChainHasBlock(hash *chainhash.Hash) bool {
 	return node != nil && b.bestChain.Contains(node)
 }
 
+// IsKnownInvalid returns whether or not the block with the given hash is known
+// to be invalid, either because it failed validation or because one of its
+// ancestors did.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsKnownInvalid(hash *chainhash.Hash) bool {
+	node := b.index.LookupNode(hash)
+	return node != nil && b.index.NodeStatus(node).KnownInvalid()
+}
+
 // BlockLocatorFromHash returns a block locator for the passed block hash.
 // See BlockLocator for details on the algorithm used to create a block locator.
 //
@@ -1642,12 +1944,34 @@ func (b *BlockChain) locateHeaders(locator BlockLocator, hashStop *chainhash.Has
 // - When locators are provided, but none of them are known, headers starting
 //   after the genesis block will be returned
 //
+// The headers are served from the header index of the best chain, so this
+// function doesn't wait for blocks which are being processed.
+//
 // This function is safe for concurrent access.
 func (b *BlockChain) LocateHeaders(locator BlockLocator, hashStop *chainhash.Hash) []wire.BlockHeader {
-	b.chainLock.RLock()
-	headers := b.locateHeaders(locator, hashStop, wire.MaxBlockHeadersPerMsg)
-	b.chainLock.RUnlock()
-	return headers
+	return b.LocateHeadersInto(locator, hashStop, nil)
+}
+
+// LocateHeadersInto is like LocateHeaders except the headers are appended to
+// the passed buffer, which is returned.  It allows callers serving headers to
+// many peers to reuse preallocated buffers of wire.MaxBlockHeadersPerMsg
+// headers rather than allocating a new slice for every request.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) LocateHeadersInto(locator BlockLocator, hashStop *chainhash.Hash, buf []wire.BlockHeader) []wire.BlockHeader {
+	// A request for the header of a specific block may refer to a block
+	// which is not part of the best chain, so it is looked up in the block
+	// index, which has its own lock.
+	if len(locator) == 0 {
+		node := b.index.LookupNode(hashStop)
+		if node == nil {
+			return buf
+		}
+		return append(buf, node.Header())
+	}
+
+	return b.headerIndex.locate(locator, hashStop,
+		wire.MaxBlockHeadersPerMsg, buf)
 }
 
 // IndexManager provides a generic interface that the is called when blocks are
@@ -1716,6 +2040,12 @@ type Config struct {
 	// checkpoints.
 	Checkpoints []chaincfg.Checkpoint
 
+	// CheckpointMode specifies how blocks which conflict with the
+	// checkpoints are handled.
+	//
+	// The zero value enforces the checkpoints.
+	CheckpointMode CheckpointMode
+
 	// TimeSource defines the median time source to use for things such as
 	// block processing and determining whether or not the chain is current.
 	//
@@ -1749,6 +2079,69 @@ type Config struct {
 	// This field can be nil if the caller is not interested in using a
 	// signature cache.
 	HashCache *txscript.HashCache
+
+	// MaxOrphanBlocks is the maximum number of orphan blocks that can be
+	// queued.
+	//
+	// The zero value uses DefaultMaxOrphanBlocks.
+	MaxOrphanBlocks int
+
+	// MaxOrphanBlockBytes is the maximum total serialized size of the
+	// orphan blocks that can be queued.
+	//
+	// The zero value uses DefaultMaxOrphanBlockBytes.
+	MaxOrphanBlockBytes int64
+
+	// OrphanBlockExpiry is the time orphan blocks are kept before they
+	// expire.
+	//
+	// The zero value uses DefaultOrphanBlockExpiry.
+	OrphanBlockExpiry time.Duration
+
+	// UtxoCacheMaxSize is the maximum size in bytes of the cache of unspent
+	// transaction outputs in front of the database.  The cache is flushed
+	// to the database when it grows larger, periodically, and when
+	// FlushUtxoCache is called.
+	//
+	// The zero value disables the cache, so the modifications made by
+	// every block are written to the database when it is connected.
+	UtxoCacheMaxSize uint64
+
+	// PruneDepth is the number of blocks below the best chain tip whose
+	// data is retained.  The data of the blocks of the main chain which
+	// are buried deeper is deleted along with their spend journal entries,
+	// so reorganizations deeper than that are not possible.  It must be
+	// at least MinPruneDepth when pruning is enabled.
+	//
+	// The zero value disables pruning.
+	PruneDepth int32
+
+	// MaintainUtxoSetStats maintains the statistics of the unspent
+	// transaction output set, including its MuHash3072, incrementally as
+	// blocks are connected and disconnected, so UtxoSetStats and
+	// UtxoSetMuHash report them without reading the entire set.  It costs
+	// a MuHash3072 update for every output which is created or spent.
+	MaintainUtxoSetStats bool
+
+	// ScriptValidationWorkers is the number of goroutines which validate
+	// the scripts of the inputs of a block in parallel with the goroutine
+	// connecting it.  The workers are persistent and owned by the chain
+	// instance.
+	//
+	// The zero value uses a pool of DefaultScriptValidationWorkers which is
+	// shared with ValidateTransactionScripts unless one of the options
+	// below is set.
+	ScriptValidationWorkers int
+
+	// ScriptSchedule defines how the script validation workers are
+	// scheduled.
+	ScriptSchedule ScriptSchedule
+
+	// ScriptWorkerCPUs are the CPUs the script validation workers are
+	// pinned to in a round-robin fashion.  Pinning requires the
+	// ScriptSchedulePool schedule and is only supported when
+	// ScriptWorkerPinningSupported is set.
+	ScriptWorkerCPUs []int
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -1763,6 +2156,25 @@ func New(config *Config) (*BlockChain, error) {
 	if config.TimeSource == nil {
 		return nil, AssertError("blockchain.New timesource is nil")
 	}
+	if config.ScriptValidationWorkers < 0 {
+		return nil, AssertError("blockchain.New script validation " +
+			"workers is negative")
+	}
+	if len(config.ScriptWorkerCPUs) > 0 {
+		if !ScriptWorkerPinningSupported {
+			return nil, AssertError("blockchain.New pinning script " +
+				"validation workers is not supported")
+		}
+		if config.ScriptSchedule != ScriptSchedulePool {
+			return nil, AssertError("blockchain.New pinning script " +
+				"validation workers requires the pool schedule")
+		}
+	}
+	if config.PruneDepth != 0 && config.PruneDepth < MinPruneDepth {
+		return nil, AssertError(fmt.Sprintf("blockchain.New prune "+
+			"depth %d is below the minimum of %d", config.PruneDepth,
+			MinPruneDepth))
+	}
 
 	// Generate a checkpoint by height map from the provided checkpoints
 	// and assert the provided checkpoints are sorted by height as required.
@@ -1782,11 +2194,25 @@ func New(config *Config) (*BlockChain, error) {
 		}
 	}
 
+	maxOrphanBlocks := config.MaxOrphanBlocks
+	if maxOrphanBlocks == 0 {
+		maxOrphanBlocks = DefaultMaxOrphanBlocks
+	}
+	maxOrphanBytes := config.MaxOrphanBlockBytes
+	if maxOrphanBytes == 0 {
+		maxOrphanBytes = DefaultMaxOrphanBlockBytes
+	}
+	orphanExpiry := config.OrphanBlockExpiry
+	if orphanExpiry == 0 {
+		orphanExpiry = DefaultOrphanBlockExpiry
+	}
+
 	params := config.ChainParams
 	targetTimespan := int64(params.TargetTimespan / time.Second)
 	targetTimePerBlock := int64(params.TargetTimePerBlock / time.Second)
 	adjustmentFactor := params.RetargetAdjustmentFactor
 	b := BlockChain{
+		checkpointMode:      config.CheckpointMode,
 		checkpoints:         config.Checkpoints,
 		checkpointsByHeight: checkpointsByHeight,
 		db:                  config.DB,
@@ -1800,10 +2226,27 @@ func New(config *Config) (*BlockChain, error) {
 		index:               newBlockIndex(config.DB, params),
 		hashCache:           config.HashCache,
 		bestChain:           newChainView(nil),
+		headerIndex:         newHeaderIndex(),
+		maxOrphanBlocks:     maxOrphanBlocks,
+		maxOrphanBytes:      maxOrphanBytes,
+		orphanExpiry:        orphanExpiry,
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
 		warningCaches:       newThresholdCaches(vbNumBits),
 		deploymentCaches:    newThresholdCaches(chaincfg.DefinedDeployments),
+		pruneDepth:          config.PruneDepth,
+	}
+	scriptWorkers := config.ScriptValidationWorkers
+	if scriptWorkers == 0 && (config.ScriptSchedule != ScriptSchedulePool ||
+		len(config.ScriptWorkerCPUs) > 0) {
+
+		scriptWorkers = DefaultScriptValidationWorkers()
+	}
+	if scriptWorkers > 0 {
+		b.scriptPool = newScriptValidatorPool(scriptWorkers,
+			config.ScriptSchedule, config.ScriptWorkerCPUs)
+	} else {
+		b.scriptPool = sharedScriptPool()
 	}
 
 	// Initialize the chain state from the passed database.  When the db
@@ -1818,6 +2261,43 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, err
 	}
 
+	// Load the height of the most recent block which has been pruned.
+	err := b.db.View(func(dbTx database.Tx) error {
+		b.prunedHeight = dbFetchPrunedHeight(dbTx)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Resume the background validation of a loaded utxo set snapshot as
+	// needed.  Since the optional indexes need the blocks before the
+	// snapshot, they can't be used until it has been validated.
+	err = b.initSnapshotValidation(config.UtxoCacheMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	if b.snapshotValidation != nil && config.IndexManager != nil {
+		return nil, fmt.Errorf("optional indexes can not be enabled " +
+			"until the blocks before the loaded utxo snapshot have " +
+			"been validated")
+	}
+
+	// Initialize the utxo cache, recovering the utxo set first when the
+	// node was not shut down cleanly.
+	err = b.initUtxoCache(config.UtxoCacheMaxSize, config.Interrupt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start maintaining the statistics of the utxo set as needed, which
+	// requires the recovered utxo set when they have to be computed.
+	if config.MaintainUtxoSetStats {
+		if err := b.initUtxoSetState(config.Interrupt); err != nil {
+			return nil, err
+		}
+	}
+
 	// Initialize and catch up all of the currently active optional indexes
 	// as needed.
 	if config.IndexManager != nil {
@@ -479,6 +479,7 @@ func TestLocateInventory(t *testing.T) {
 		chain.index.AddNode(node)
 	}
 	chain.bestChain.SetTip(tip(branch0Nodes))
+	chain.headerIndex.setTip(tip(branch0Nodes))
 
 	// Create chain views for different branches of the overall chain to
 	// simulate a local and remote node on different parts of the chain.
@@ -964,3 +965,82 @@ func TestIntervalBlockHashes(t *testing.T) {
 		}
 	}
 }
+
+// TestOrphanBlockLimits ensures the orphan block pool enforces its count and
+// size limits by evicting the oldest orphans, expires orphans, and reports the
+// roots of the orphan chains along with accurate statistics.
+func TestOrphanBlockLimits(t *testing.T) {
+	chain := newFakeChain(&chaincfg.RegressionNetParams)
+	chain.orphans = make(map[chainhash.Hash]*orphanBlock)
+	chain.prevOrphans = make(map[chainhash.Hash][]*orphanBlock)
+	chain.maxOrphanBlocks = 3
+	chain.orphanExpiry = time.Hour
+
+	// Create a chain of orphan blocks which each extend the previous one
+	// along with an unrelated orphan block.
+	var prevHash chainhash.Hash
+	blocks := make([]*btcutil.Block, 0, 4)
+	for i := 0; i < 4; i++ {
+		block := btcutil.NewBlock(wire.NewMsgBlock(&wire.BlockHeader{
+			PrevBlock: prevHash,
+			Nonce:     uint32(i),
+		}))
+		blocks = append(blocks, block)
+		prevHash = *block.Hash()
+	}
+	other := btcutil.NewBlock(wire.NewMsgBlock(&wire.BlockHeader{
+		PrevBlock: chainhash.Hash{0x01},
+	}))
+	blockSize := int64(blocks[0].MsgBlock().SerializeSize())
+	chain.maxOrphanBytes = 10 * blockSize
+
+	// Adding a block over the count limit evicts the oldest one.
+	for _, block := range blocks {
+		chain.addOrphanBlock(block)
+		time.Sleep(time.Millisecond)
+	}
+	if chain.IsKnownOrphan(blocks[0].Hash()) {
+		t.Fatal("oldest orphan block was not evicted")
+	}
+	roots := chain.OrphanRoots()
+	if len(roots) != 1 || !roots[0].IsEqual(blocks[1].Hash()) {
+		t.Fatalf("unexpected orphan roots %v", roots)
+	}
+
+	// Adding a block over the size limit evicts the oldest ones until it
+	// fits.
+	chain.maxOrphanBlocks = 10
+	chain.maxOrphanBytes = 2 * blockSize
+	chain.addOrphanBlock(other)
+	if chain.IsKnownOrphan(blocks[1].Hash()) ||
+		chain.IsKnownOrphan(blocks[2].Hash()) ||
+		!chain.IsKnownOrphan(blocks[3].Hash()) {
+
+		t.Fatal("orphan blocks were not evicted to fit the size limit")
+	}
+
+	// A block which exceeds the size limit on its own is not added and
+	// expired blocks are removed.
+	chain.maxOrphanBytes = blockSize - 1
+	for _, orphan := range chain.orphans {
+		orphan.expiration = time.Now().Add(-time.Second)
+	}
+	chain.addOrphanBlock(blocks[0])
+	chain.addOrphanBlock(blocks[1])
+	if chain.IsKnownOrphan(blocks[0].Hash()) {
+		t.Fatal("orphan block over the size limit was added")
+	}
+
+	want := OrphanBlockStats{
+		Count:    0,
+		MaxCount: 10,
+		MaxBytes: blockSize - 1,
+		Expiry:   time.Hour,
+		Added:    5,
+		Expired:  2,
+		Evicted:  3,
+	}
+	if stats := chain.OrphanStats(); stats != want {
+		t.Fatalf("unexpected stats %+v, want %+v", stats, want)
+	}
+}
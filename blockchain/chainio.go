@@ -31,7 +31,7 @@ const (
 	// latestSpendJournalBucketVersion is the current version of the spend
 	// journal bucket that is used to track all spent transactions for use
 	// in reorgs.
-	latestSpendJournalBucketVersion = 1
+	latestSpendJournalBucketVersion = 2
 )
 
 var (
@@ -57,7 +57,7 @@ var (
 
 	// spendJournalBucketName is the name of the db bucket used to house
 	// transactions outputs that are spent in each block.
-	spendJournalBucketName = []byte("spendjournal")
+	spendJournalBucketName = []byte("spendjournalv2")
 
 	// utxoSetVersionKeyName is the name of the db key used to store the
 	// version of the utxo set currently in the database.
@@ -67,6 +67,12 @@ var (
 	// unspent transaction output set.
 	utxoSetBucketName = []byte("utxosetv2")
 
+	// utxoStateConsistencyKeyName is the name of the db key used to store
+	// the hash of the block the utxo set in the database is consistent
+	// with.  It lags behind the best chain state while the utxo cache holds
+	// modifications which were not flushed yet.
+	utxoStateConsistencyKeyName = []byte("utxostateconsistency")
+
 	// byteOrder is the preferred byte order used for serializing numeric
 	// fields for storage in the database.
 	byteOrder = binary.LittleEndian
@@ -165,43 +171,43 @@ func dbFetchOrCreateVersion(dbTx database.Tx, key []byte, defaultVersion uint32)
 // blockchain.
 //
 // NOTE: This format is NOT self describing.  The additional details such as
-// the number of entries (transaction inputs) are expected to come from the
-// block itself and the utxo set (for legacy entries).  The rationale in doing
+// the number of entries (transaction inputs) and the height of the spending
+// block are expected to come from the block itself.  The rationale in doing
 // this is to save space.  This is also the reason the spent outputs are
 // serialized in the reverse order they are spent because later transactions are
 // allowed to spend outputs from earlier ones in the same block.
 //
-// The reserved field below used to keep track of the version of the containing
-// transaction when the height in the header code was non-zero, however the
-// height is always non-zero now, but keeping the extra reserved field allows
-// backwards compatibility.
+// Rather than the height of the block that contains the spent output, the
+// header code encodes how many blocks prior to the spending block it was
+// included in.  The vast majority of outputs are spent relatively soon after
+// they are created, so the delta typically needs far fewer bytes than the
+// absolute height does.  The header code and compressed txout are encoded with
+// the same routines used by the utxo set.
 //
 // The serialized format is:
 //
-//   [<header code><reserved><compressed txout>],...
+//   [<header code><compressed txout>],...
 //
 //   Field                Type     Size
 //   header code          VLQ      variable
-//   reserved             byte     1
 //   compressed txout
 //     compressed amount  VLQ      variable
 //     compressed script  []byte   variable
 //
 // The serialized header code format is:
 //   bit 0 - containing transaction is a coinbase
-//   bits 1-x - height of the block that contains the spent txout
+//   bits 1-x - height of the spending block minus the height of the block that
+//     contains the spent txout
 //
 // Example 1:
 // From block 170 in main blockchain.
 //
-//    1300320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c
-//    <><><------------------------------------------------------------------>
-//     | |                                  |
-//     | reserved                  compressed txout
-//    header code
+//    8143320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c
+//    <--><------------------------------------------------------------------>
+//     |                                  |
+//    header code                compressed txout
 //
-//  - header code: 0x13 (coinbase, height 9)
-//  - reserved: 0x00
+//  - header code: 0x8143 (coinbase, 161 blocks prior, so height 9)
 //  - compressed txout 0:
 //    - 0x32: VLQ-encoded compressed amount for 5000000000 (50 BTC)
 //    - 0x05: special script type pay-to-pubkey
@@ -210,26 +216,28 @@ func dbFetchOrCreateVersion(dbTx database.Tx, key []byte, defaultVersion uint32)
 // Example 2:
 // Adapted from block 100025 in main blockchain.
 //
-//    8b99700091f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e868b99700086c64700b2fb57eadf61e106a100a7445a8c3f67898841ec
-//    <----><><----------------------------------------------><----><><---------------------------------------------->
-//     |    |                         |                        |    |                         |
-//     |    reserved         compressed txout                  |    reserved         compressed txout
-//    header code                                          header code
+//    0291f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e860286c64700b2fb57eadf61e106a100a7445a8c3f67898841ec
+//    <><---------------------------------------------><><---------------------------------------------->
+//    |                         |                      |                         |
+//    header code      compressed txout          header code            compressed txout
 //
 //  - Last spent output:
-//    - header code: 0x8b9970 (not coinbase, height 100024)
-//    - reserved: 0x00
+//    - header code: 0x02 (not coinbase, 1 block prior, so height 100024)
 //    - compressed txout:
 //      - 0x91f20f: VLQ-encoded compressed amount for 34405000000 (344.05 BTC)
 //      - 0x00: special script type pay-to-pubkey-hash
 //      - 0x6e...86: pubkey hash
 //  - Second to last spent output:
-//    - header code: 0x8b9970 (not coinbase, height 100024)
-//    - reserved: 0x00
+//    - header code: 0x02 (not coinbase, 1 block prior, so height 100024)
 //    - compressed txout:
 //      - 0x86c647: VLQ-encoded compressed amount for 13761000000 (137.61 BTC)
 //      - 0x00: special script type pay-to-pubkey-hash
 //      - 0xb2...ec: pubkey hash
+//
+// NOTE: Entries written prior to version 2 of the spend journal used a legacy
+// format which encoded the absolute height.  Those entries are migrated to the
+// format described above in the background and are transparently converted
+// when they are loaded before then.  See upgrade.go for details.
 // -----------------------------------------------------------------------------
 
 // SpentTxOut contains a spent transaction output and potentially additional
@@ -263,11 +271,22 @@ func (b *BlockChain) FetchSpendJournal(targetBlock *btcutil.Block) ([]SpentTxOut
 	b.chainLock.RLock()
 	defer b.chainLock.RUnlock()
 
+	// The spend journal entries are encoded relative to the height of the
+	// block, so look it up when the caller did not provide it.
+	if targetBlock.Height() == btcutil.BlockHeightUnknown {
+		node := b.index.LookupNode(targetBlock.Hash())
+		if node == nil {
+			return nil, fmt.Errorf("block %s is not known",
+				targetBlock.Hash())
+		}
+		targetBlock.SetHeight(node.height)
+	}
+
 	var spendEntries []SpentTxOut
 	err := b.db.View(func(dbTx database.Tx) error {
 		var err error
 
-		spendEntries, err = dbFetchSpendJournalEntry(dbTx, targetBlock)
+		spendEntries, err = b.fetchSpendJournalEntry(dbTx, targetBlock)
 		return err
 	})
 	if err != nil {
@@ -278,53 +297,39 @@ func (b *BlockChain) FetchSpendJournal(targetBlock *btcutil.Block) ([]SpentTxOut
 }
 
 // spentTxOutHeaderCode returns the calculated header code to be used when
-// serializing the provided stxo entry.
-func spentTxOutHeaderCode(stxo *SpentTxOut) uint64 {
+// serializing the provided stxo entry spent by a block at the passed height.
+func spentTxOutHeaderCode(stxo *SpentTxOut, spendHeight int32) uint64 {
 	// As described in the serialization format comments, the header code
-	// encodes the height shifted over one bit and the coinbase flag in the
-	// lowest bit.
-	headerCode := uint64(stxo.Height) << 1
-	if stxo.IsCoinBase {
-		headerCode |= 0x01
-	}
-
-	return headerCode
+	// encodes the number of blocks between the spending block and the
+	// block containing the output shifted over one bit and the coinbase
+	// flag in the lowest bit.
+	return heightCoinbaseCode(spendHeight-stxo.Height, stxo.IsCoinBase)
 }
 
 // spentTxOutSerializeSize returns the number of bytes it would take to
-// serialize the passed stxo according to the format described above.
-func spentTxOutSerializeSize(stxo *SpentTxOut) int {
-	size := serializeSizeVLQ(spentTxOutHeaderCode(stxo))
-	if stxo.Height > 0 {
-		// The legacy v1 spend journal format conditionally tracked the
-		// containing transaction version when the height was non-zero,
-		// so this is required for backwards compat.
-		size += serializeSizeVLQ(0)
-	}
+// serialize the passed stxo spent by a block at the passed height according
+// to the format described above.
+func spentTxOutSerializeSize(stxo *SpentTxOut, spendHeight int32) int {
+	size := serializeSizeVLQ(spentTxOutHeaderCode(stxo, spendHeight))
 	return size + compressedTxOutSize(uint64(stxo.Amount), stxo.PkScript)
 }
 
-// putSpentTxOut serializes the passed stxo according to the format described
-// above directly into the passed target byte slice.  The target byte slice must
-// be at least large enough to handle the number of bytes returned by the
-// SpentTxOutSerializeSize function or it will panic.
-func putSpentTxOut(target []byte, stxo *SpentTxOut) int {
-	headerCode := spentTxOutHeaderCode(stxo)
+// putSpentTxOut serializes the passed stxo spent by a block at the passed
+// height according to the format described above directly into the passed
+// target byte slice.  The target byte slice must be at least large enough to
+// handle the number of bytes returned by the SpentTxOutSerializeSize function
+// or it will panic.
+func putSpentTxOut(target []byte, stxo *SpentTxOut, spendHeight int32) int {
+	headerCode := spentTxOutHeaderCode(stxo, spendHeight)
 	offset := putVLQ(target, headerCode)
-	if stxo.Height > 0 {
-		// The legacy v1 spend journal format conditionally tracked the
-		// containing transaction version when the height was non-zero,
-		// so this is required for backwards compat.
-		offset += putVLQ(target[offset:], 0)
-	}
 	return offset + putCompressedTxOut(target[offset:], uint64(stxo.Amount),
 		stxo.PkScript)
 }
 
-// decodeSpentTxOut decodes the passed serialized stxo entry, possibly followed
-// by other data, into the passed stxo struct.  It returns the number of bytes
-// read.
-func decodeSpentTxOut(serialized []byte, stxo *SpentTxOut) (int, error) {
+// decodeSpentTxOut decodes the passed serialized stxo entry spent by a block at
+// the passed height, possibly followed by other data, into the passed stxo
+// struct.  It returns the number of bytes read.
+func decodeSpentTxOut(serialized []byte, stxo *SpentTxOut, spendHeight int32) (int, error) {
 	// Ensure there are bytes to decode.
 	if len(serialized) == 0 {
 		return 0, errDeserialize("no serialized bytes")
@@ -340,20 +345,16 @@ func decodeSpentTxOut(serialized []byte, stxo *SpentTxOut) (int, error) {
 	// Decode the header code.
 	//
 	// Bit 0 indicates containing transaction is a coinbase.
-	// Bits 1-x encode height of containing transaction.
-	stxo.IsCoinBase = code&0x01 != 0
-	stxo.Height = int32(code >> 1)
-	if stxo.Height > 0 {
-		// The legacy v1 spend journal format conditionally tracked the
-		// containing transaction version when the height was non-zero,
-		// so this is required for backwards compat.
-		_, bytesRead := deserializeVLQ(serialized[offset:])
-		offset += bytesRead
-		if offset >= len(serialized) {
-			return offset, errDeserialize("unexpected end of data " +
-				"after reserved")
-		}
+	// Bits 1-x encode the number of blocks prior to the spending block
+	// the containing transaction was included in.
+	delta, isCoinBase := decodeHeightCoinbaseCode(code)
+	if delta < 0 || delta > spendHeight {
+		return offset, errDeserialize(fmt.Sprintf("height delta %d "+
+			"is invalid for spending block height %d", delta,
+			spendHeight))
 	}
+	stxo.IsCoinBase = isCoinBase
+	stxo.Height = spendHeight - delta
 
 	// Decode the compressed txout.
 	amount, pkScript, bytesRead, err := decodeCompressedTxOut(
@@ -373,8 +374,8 @@ func decodeSpentTxOut(serialized []byte, stxo *SpentTxOut) (int, error) {
 //
 // Since the serialization format is not self describing, as noted in the
 // format comments, this function also requires the transactions that spend the
-// txouts.
-func deserializeSpendJournalEntry(serialized []byte, txns []*wire.MsgTx) ([]SpentTxOut, error) {
+// txouts and the height of the block that contains them.
+func deserializeSpendJournalEntry(serialized []byte, txns []*wire.MsgTx, spendHeight int32) ([]SpentTxOut, error) {
 	// Calculate the total number of stxos.
 	var numStxos int
 	for _, tx := range txns {
@@ -410,7 +411,8 @@ func deserializeSpendJournalEntry(serialized []byte, txns []*wire.MsgTx) ([]Spen
 			stxo := &stxos[stxoIdx]
 			stxoIdx--
 
-			n, err := decodeSpentTxOut(serialized[offset:], stxo)
+			n, err := decodeSpentTxOut(serialized[offset:], stxo,
+				spendHeight)
 			offset += n
 			if err != nil {
 				return nil, errDeserialize(fmt.Sprintf("unable "+
@@ -423,9 +425,10 @@ func deserializeSpendJournalEntry(serialized []byte, txns []*wire.MsgTx) ([]Spen
 	return stxos, nil
 }
 
-// serializeSpendJournalEntry serializes all of the passed spent txouts into a
-// single byte slice according to the format described in detail above.
-func serializeSpendJournalEntry(stxos []SpentTxOut) []byte {
+// serializeSpendJournalEntry serializes all of the passed spent txouts spent by
+// a block at the passed height into a single byte slice according to the
+// format described in detail above.
+func serializeSpendJournalEntry(stxos []SpentTxOut, spendHeight int32) []byte {
 	if len(stxos) == 0 {
 		return nil
 	}
@@ -433,7 +436,7 @@ func serializeSpendJournalEntry(stxos []SpentTxOut) []byte {
 	// Calculate the size needed to serialize the entire journal entry.
 	var size int
 	for i := range stxos {
-		size += spentTxOutSerializeSize(&stxos[i])
+		size += spentTxOutSerializeSize(&stxos[i], spendHeight)
 	}
 	serialized := make([]byte, size)
 
@@ -441,24 +444,48 @@ func serializeSpendJournalEntry(stxos []SpentTxOut) []byte {
 	// order one after the other.
 	var offset int
 	for i := len(stxos) - 1; i > -1; i-- {
-		offset += putSpentTxOut(serialized[offset:], &stxos[i])
+		offset += putSpentTxOut(serialized[offset:], &stxos[i],
+			spendHeight)
 	}
 
 	return serialized
 }
 
 // dbFetchSpendJournalEntry fetches the spend journal entry for the passed block
-// and deserializes it into a slice of spent txout entries.
+// and deserializes it into a slice of spent txout entries.  The height of the
+// passed block must be set.
 //
-// NOTE: Legacy entries will not have the coinbase flag or height set unless it
-// was the final output spend in the containing transaction.  It is up to the
-// caller to handle this properly by looking the information up in the utxo set.
+// Entries which have not been migrated from the legacy version 1 format yet
+// are converted on the fly.
 func dbFetchSpendJournalEntry(dbTx database.Tx, block *btcutil.Block) ([]SpentTxOut, error) {
+	blockHeight := block.Height()
+	if blockHeight == btcutil.BlockHeightUnknown {
+		return nil, AssertError(fmt.Sprintf("attempt to fetch spend "+
+			"journal entry for block %v with unknown height",
+			block.Hash()))
+	}
+
+	meta := dbTx.Metadata()
+	serialized := meta.Bucket(spendJournalBucketName).Get(block.Hash()[:])
+	var err error
+	if serialized == nil {
+		serialized, err = dbFetchSpendJournalEntryV1(dbTx, block.Hash(),
+			blockHeight)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return decodeSpendJournalEntry(serialized, block)
+}
+
+// decodeSpendJournalEntry deserializes the passed serialized spend journal
+// entry of the passed block, whose height must be set, into a slice of spent
+// txout entries.
+func decodeSpendJournalEntry(serialized []byte, block *btcutil.Block) ([]SpentTxOut, error) {
 	// Exclude the coinbase transaction since it can't spend anything.
-	spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
-	serialized := spendBucket.Get(block.Hash()[:])
 	blockTxns := block.MsgBlock().Transactions[1:]
-	stxos, err := deserializeSpendJournalEntry(serialized, blockTxns)
+	stxos, err := deserializeSpendJournalEntry(serialized, blockTxns,
+		block.Height())
 	if err != nil {
 		// Ensure any deserialization errors are returned as database
 		// corruption errors.
@@ -478,19 +505,45 @@ func dbFetchSpendJournalEntry(dbTx database.Tx, block *btcutil.Block) ([]SpentTx
 }
 
 // dbPutSpendJournalEntry uses an existing database transaction to update the
-// spend journal entry for the given block hash using the provided slice of
-// spent txouts.   The spent txouts slice must contain an entry for every txout
-// the transactions in the block spend in the order they are spent.
-func dbPutSpendJournalEntry(dbTx database.Tx, blockHash *chainhash.Hash, stxos []SpentTxOut) error {
+// spend journal entry for the given block hash and height using the provided
+// slice of spent txouts.   The spent txouts slice must contain an entry for
+// every txout the transactions in the block spend in the order they are spent.
+func dbPutSpendJournalEntry(dbTx database.Tx, blockHash *chainhash.Hash, blockHeight int32, stxos []SpentTxOut) error {
 	spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
-	serialized := serializeSpendJournalEntry(stxos)
+	serialized := serializeSpendJournalEntry(stxos, blockHeight)
 	return spendBucket.Put(blockHash[:], serialized)
 }
 
+// fetchSpendJournalEntry returns the spend journal entry for the passed block,
+// whose height must be set, from the entries the utxo cache has yet to write to
+// the database or from the database.
+func (b *BlockChain) fetchSpendJournalEntry(dbTx database.Tx, block *btcutil.Block) ([]SpentTxOut, error) {
+	if serialized, ok := b.utxoCache.spendJournalEntry(block.Hash()); ok {
+		return decodeSpendJournalEntry(serialized, block)
+	}
+	return dbFetchSpendJournalEntry(dbTx, block)
+}
+
+// removeSpendJournalEntry removes the spend journal entry for the passed block
+// hash from the entries the utxo cache has yet to write to the database and
+// from the database.
+func (b *BlockChain) removeSpendJournalEntry(dbTx database.Tx, blockHash *chainhash.Hash) error {
+	b.utxoCache.removeSpendJournalEntry(blockHash)
+	return dbRemoveSpendJournalEntry(dbTx, blockHash)
+}
+
 // dbRemoveSpendJournalEntry uses an existing database transaction to remove the
-// spend journal entry for the passed block hash.
+// spend journal entry for the passed block hash.  Any entry for the block that
+// has not been migrated from the legacy version 1 format yet is removed as
+// well.
 func dbRemoveSpendJournalEntry(dbTx database.Tx, blockHash *chainhash.Hash) error {
-	spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+	meta := dbTx.Metadata()
+	if v1Bucket := meta.Bucket(spendJournalV1BucketName); v1Bucket != nil {
+		if err := v1Bucket.Delete(blockHash[:]); err != nil {
+			return err
+		}
+	}
+	spendBucket := meta.Bucket(spendJournalBucketName)
 	return spendBucket.Delete(blockHash[:])
 }
 
@@ -619,12 +672,7 @@ func utxoEntryHeaderCode(entry *UtxoEntry) (uint64, error) {
 	// As described in the serialization format comments, the header code
 	// encodes the height shifted over one bit and the coinbase flag in the
 	// lowest bit.
-	headerCode := uint64(entry.BlockHeight()) << 1
-	if entry.IsCoinBase() {
-		headerCode |= 0x01
-	}
-
-	return headerCode, nil
+	return heightCoinbaseCode(entry.BlockHeight(), entry.IsCoinBase()), nil
 }
 
 // serializeUtxoEntry returns the entry serialized to a format that is suitable
@@ -669,8 +717,7 @@ func deserializeUtxoEntry(serialized []byte) (*UtxoEntry, error) {
 	//
 	// Bit 0 indicates whether the containing transaction is a coinbase.
 	// Bits 1-x encode height of containing transaction.
-	isCoinBase := code&0x01 != 0
-	blockHeight := int32(code >> 1)
+	blockHeight, isCoinBase := decodeHeightCoinbaseCode(code)
 
 	// Decode the compressed unspent transaction output.
 	amount, pkScript, _, err := decodeCompressedTxOut(serialized[offset:])
@@ -730,10 +777,20 @@ func dbFetchUtxoEntryByHash(dbTx database.Tx, hash *chainhash.Hash) (*UtxoEntry,
 // When there is no entry for the provided output, nil will be returned for both
 // the entry and the error.
 func dbFetchUtxoEntry(dbTx database.Tx, outpoint wire.OutPoint) (*UtxoEntry, error) {
+	return dbFetchUtxoEntryInBucket(dbTx, utxoSetBucketName, outpoint)
+}
+
+// dbFetchUtxoEntryInBucket uses an existing database transaction to fetch the
+// specified transaction output from the utxo set stored in the bucket with the
+// passed name.
+//
+// When there is no entry for the provided output, nil will be returned for both
+// the entry and the error.
+func dbFetchUtxoEntryInBucket(dbTx database.Tx, bucketName []byte, outpoint wire.OutPoint) (*UtxoEntry, error) {
 	// Fetch the unspent transaction output information for the passed
 	// transaction output.  Return now when there is no entry.
 	key := outpointKey(outpoint)
-	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	utxoBucket := dbTx.Metadata().Bucket(bucketName)
 	serializedUtxo := utxoBucket.Get(*key)
 	recycleOutpointKey(key)
 	if serializedUtxo == nil {
@@ -771,8 +828,23 @@ func dbFetchUtxoEntry(dbTx database.Tx, outpoint wire.OutPoint) (*UtxoEntry, err
 // particular, only the entries that have been marked as modified are written
 // to the database.
 func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) error {
-	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
-	for outpoint, entry := range view.entries {
+	return dbPutUtxoEntries(dbTx, view.entries)
+}
+
+// dbPutUtxoEntries uses an existing database transaction to update the utxo set
+// in the database based on the provided utxo entries.  Only the entries that
+// have been marked as modified are written to the database.
+func dbPutUtxoEntries(dbTx database.Tx, entries map[wire.OutPoint]*UtxoEntry) error {
+	return dbPutUtxoEntriesInBucket(dbTx, utxoSetBucketName, entries)
+}
+
+// dbPutUtxoEntriesInBucket uses an existing database transaction to update the
+// utxo set stored in the bucket with the passed name based on the provided utxo
+// entries.  Only the entries that have been marked as modified are written to
+// the database.
+func dbPutUtxoEntriesInBucket(dbTx database.Tx, bucketName []byte, entries map[wire.OutPoint]*UtxoEntry) error {
+	utxoBucket := dbTx.Metadata().Bucket(bucketName)
+	for outpoint, entry := range entries {
 		// No need to update the database if the entry was not modified.
 		if entry == nil || !entry.isModified() {
 			continue
@@ -984,6 +1056,25 @@ func deserializeBestChainState(serializedData []byte) (bestChainState, error) {
 	return state, nil
 }
 
+// dbFetchUtxoStateConsistency uses an existing database transaction to fetch
+// the hash of the block the utxo set in the database is consistent with.  Nil
+// is returned when the database does not record it yet.
+func dbFetchUtxoStateConsistency(dbTx database.Tx) *chainhash.Hash {
+	serialized := dbTx.Metadata().Get(utxoStateConsistencyKeyName)
+	if len(serialized) != chainhash.HashSize {
+		return nil
+	}
+	var hash chainhash.Hash
+	copy(hash[:], serialized)
+	return &hash
+}
+
+// dbPutUtxoStateConsistency uses an existing database transaction to record the
+// hash of the block the utxo set in the database is consistent with.
+func dbPutUtxoStateConsistency(dbTx database.Tx, hash *chainhash.Hash) error {
+	return dbTx.Metadata().Put(utxoStateConsistencyKeyName, hash[:])
+}
+
 // dbPutBestState uses an existing database transaction to update the best chain
 // state with the given parameters.
 func dbPutBestState(dbTx database.Tx, snapshot *BestState, workSum *big.Int) error {
@@ -1010,6 +1101,7 @@ func (b *BlockChain) createChainState() error {
 	node := newBlockNode(header, nil)
 	node.status = statusDataStored | statusValid
 	b.bestChain.SetTip(node)
+	b.headerIndex.setTip(node)
 
 	// Add the new node to the index which is used for faster lookups.
 	b.index.addNode(node)
@@ -1209,6 +1301,7 @@ func (b *BlockChain) initChainState() error {
 				"chain tip %s in block index", state.hash))
 		}
 		b.bestChain.SetTip(tip)
+		b.headerIndex.setTip(tip)
 
 		// Load the raw block bytes for the best block.
 		blockBytes, err := dbTx.FetchBlock(&state.hash)
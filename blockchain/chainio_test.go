@@ -43,9 +43,10 @@ func TestStxoSerialization(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
-		name       string
-		stxo       SpentTxOut
-		serialized []byte
+		name        string
+		stxo        SpentTxOut
+		spendHeight int32
+		serialized  []byte
 	}{
 		// From block 170 in main blockchain.
 		{
@@ -56,7 +57,8 @@ func TestStxoSerialization(t *testing.T) {
 				IsCoinBase: true,
 				Height:     9,
 			},
-			serialized: hexToBytes("1300320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
+			spendHeight: 170,
+			serialized:  hexToBytes("8143320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
 		},
 		// Adapted from block 100025 in main blockchain.
 		{
@@ -67,23 +69,25 @@ func TestStxoSerialization(t *testing.T) {
 				IsCoinBase: false,
 				Height:     100024,
 			},
-			serialized: hexToBytes("8b99700086c64700b2fb57eadf61e106a100a7445a8c3f67898841ec"),
+			spendHeight: 100025,
+			serialized:  hexToBytes("0286c64700b2fb57eadf61e106a100a7445a8c3f67898841ec"),
 		},
 		// Adapted from block 100025 in main blockchain.
 		{
-			name: "Does not spend last output, legacy format",
+			name: "Does not spend last output, unknown height",
 			stxo: SpentTxOut{
 				Amount:   34405000000,
 				PkScript: hexToBytes("76a9146edbc6c4d31bae9f1ccc38538a114bf42de65e8688ac"),
 			},
-			serialized: hexToBytes("0091f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
+			spendHeight: 100025,
+			serialized:  hexToBytes("8b997291f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
 		},
 	}
 
 	for _, test := range tests {
 		// Ensure the function to calculate the serialized size without
 		// actually serializing it is calculated properly.
-		gotSize := spentTxOutSerializeSize(&test.stxo)
+		gotSize := spentTxOutSerializeSize(&test.stxo, test.spendHeight)
 		if gotSize != len(test.serialized) {
 			t.Errorf("SpentTxOutSerializeSize (%s): did not get "+
 				"expected size - got %d, want %d", test.name,
@@ -93,7 +97,8 @@ func TestStxoSerialization(t *testing.T) {
 
 		// Ensure the stxo serializes to the expected value.
 		gotSerialized := make([]byte, gotSize)
-		gotBytesWritten := putSpentTxOut(gotSerialized, &test.stxo)
+		gotBytesWritten := putSpentTxOut(gotSerialized, &test.stxo,
+			test.spendHeight)
 		if !bytes.Equal(gotSerialized, test.serialized) {
 			t.Errorf("putSpentTxOut (%s): did not get expected "+
 				"bytes - got %x, want %x", test.name,
@@ -111,7 +116,8 @@ func TestStxoSerialization(t *testing.T) {
 		// Ensure the serialized bytes are decoded back to the expected
 		// stxo.
 		var gotStxo SpentTxOut
-		gotBytesRead, err := decodeSpentTxOut(test.serialized, &gotStxo)
+		gotBytesRead, err := decodeSpentTxOut(test.serialized, &gotStxo,
+			test.spendHeight)
 		if err != nil {
 			t.Errorf("decodeSpentTxOut (%s): unexpected error: %v",
 				test.name, err)
@@ -137,53 +143,51 @@ func TestStxoDecodeErrors(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
-		name       string
-		stxo       SpentTxOut
-		serialized []byte
-		bytesRead  int // Expected number of bytes read.
-		errType    error
+		name        string
+		stxo        SpentTxOut
+		spendHeight int32
+		serialized  []byte
+		bytesRead   int // Expected number of bytes read.
+		errType     error
 	}{
 		{
-			name:       "nothing serialized",
-			stxo:       SpentTxOut{},
-			serialized: hexToBytes(""),
-			errType:    errDeserialize(""),
-			bytesRead:  0,
+			name:        "nothing serialized",
+			stxo:        SpentTxOut{},
+			spendHeight: 170,
+			serialized:  hexToBytes(""),
+			errType:     errDeserialize(""),
+			bytesRead:   0,
 		},
 		{
-			name:       "no data after header code w/o reserved",
-			stxo:       SpentTxOut{},
-			serialized: hexToBytes("00"),
-			errType:    errDeserialize(""),
-			bytesRead:  1,
+			name:        "no data after header code",
+			stxo:        SpentTxOut{},
+			spendHeight: 170,
+			serialized:  hexToBytes("8143"),
+			errType:     errDeserialize(""),
+			bytesRead:   2,
 		},
 		{
-			name:       "no data after header code with reserved",
-			stxo:       SpentTxOut{},
-			serialized: hexToBytes("13"),
-			errType:    errDeserialize(""),
-			bytesRead:  1,
+			name:        "height delta exceeds spending block height",
+			stxo:        SpentTxOut{},
+			spendHeight: 160,
+			serialized:  hexToBytes("8143320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
+			errType:     errDeserialize(""),
+			bytesRead:   2,
 		},
 		{
-			name:       "no data after reserved",
-			stxo:       SpentTxOut{},
-			serialized: hexToBytes("1300"),
-			errType:    errDeserialize(""),
-			bytesRead:  2,
-		},
-		{
-			name:       "incomplete compressed txout",
-			stxo:       SpentTxOut{},
-			serialized: hexToBytes("1332"),
-			errType:    errDeserialize(""),
-			bytesRead:  2,
+			name:        "incomplete compressed txout",
+			stxo:        SpentTxOut{},
+			spendHeight: 170,
+			serialized:  hexToBytes("814332"),
+			errType:     errDeserialize(""),
+			bytesRead:   3,
 		},
 	}
 
 	for _, test := range tests {
 		// Ensure the expected error type is returned.
 		gotBytesRead, err := decodeSpentTxOut(test.serialized,
-			&test.stxo)
+			&test.stxo, test.spendHeight)
 		if reflect.TypeOf(err) != reflect.TypeOf(test.errType) {
 			t.Errorf("decodeSpentTxOut (%s): expected error type "+
 				"does not match - got %T, want %T", test.name,
@@ -207,17 +211,19 @@ func TestSpendJournalSerialization(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
-		name       string
-		entry      []SpentTxOut
-		blockTxns  []*wire.MsgTx
-		serialized []byte
+		name        string
+		entry       []SpentTxOut
+		blockTxns   []*wire.MsgTx
+		blockHeight int32
+		serialized  []byte
 	}{
 		// From block 2 in main blockchain.
 		{
-			name:       "No spends",
-			entry:      nil,
-			blockTxns:  nil,
-			serialized: nil,
+			name:        "No spends",
+			entry:       nil,
+			blockTxns:   nil,
+			blockHeight: 2,
+			serialized:  nil,
 		},
 		// From block 170 in main blockchain.
 		{
@@ -247,7 +253,8 @@ func TestSpendJournalSerialization(t *testing.T) {
 				}},
 				LockTime: 0,
 			}},
-			serialized: hexToBytes("1300320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
+			blockHeight: 170,
+			serialized:  hexToBytes("8143320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
 		},
 		// Adapted from block 100025 in main blockchain.
 		{
@@ -300,13 +307,15 @@ func TestSpendJournalSerialization(t *testing.T) {
 				}},
 				LockTime: 0,
 			}},
-			serialized: hexToBytes("8b99700086c64700b2fb57eadf61e106a100a7445a8c3f67898841ec8b99700091f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
+			blockHeight: 100025,
+			serialized:  hexToBytes("0286c64700b2fb57eadf61e106a100a7445a8c3f67898841ec0291f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
 		},
 	}
 
 	for i, test := range tests {
 		// Ensure the journal entry serializes to the expected value.
-		gotBytes := serializeSpendJournalEntry(test.entry)
+		gotBytes := serializeSpendJournalEntry(test.entry,
+			test.blockHeight)
 		if !bytes.Equal(gotBytes, test.serialized) {
 			t.Errorf("serializeSpendJournalEntry #%d (%s): "+
 				"mismatched bytes - got %x, want %x", i,
@@ -316,7 +325,7 @@ func TestSpendJournalSerialization(t *testing.T) {
 
 		// Deserialize to a spend journal entry.
 		gotEntry, err := deserializeSpendJournalEntry(test.serialized,
-			test.blockTxns)
+			test.blockTxns, test.blockHeight)
 		if err != nil {
 			t.Errorf("deserializeSpendJournalEntry #%d (%s) "+
 				"unexpected error: %v", i, test.name, err)
@@ -377,7 +386,7 @@ func TestSpendJournalErrors(t *testing.T) {
 				}},
 				LockTime: 0,
 			}},
-			serialized: hexToBytes("1301320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a"),
+			serialized: hexToBytes("8143320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a"),
 			errType:    errDeserialize(""),
 		},
 	}
@@ -386,7 +395,7 @@ func TestSpendJournalErrors(t *testing.T) {
 		// Ensure the expected error type is returned and the returned
 		// slice is nil.
 		stxos, err := deserializeSpendJournalEntry(test.serialized,
-			test.blockTxns)
+			test.blockTxns, 170)
 		if reflect.TypeOf(err) != reflect.TypeOf(test.errType) {
 			t.Errorf("deserializeSpendJournalEntry (%s): expected "+
 				"error type does not match - got %T, want %T",
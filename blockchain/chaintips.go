@@ -0,0 +1,140 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ChainTipStatus describes the state of the branch ending at a chain tip.
+type ChainTipStatus int
+
+const (
+	// ChainTipActive indicates the tip is the tip of the main chain.
+	ChainTipActive ChainTipStatus = iota
+
+	// ChainTipValidFork indicates all blocks of the branch are available
+	// and were fully validated, but the branch is not part of the main
+	// chain.
+	ChainTipValidFork
+
+	// ChainTipValidHeaders indicates all blocks of the branch are available
+	// and none of them is known to be invalid, but not all of them were
+	// fully validated.
+	ChainTipValidHeaders
+
+	// ChainTipHeadersOnly indicates the headers of the branch are known,
+	// but the data of some of its blocks is not available.
+	ChainTipHeadersOnly
+
+	// ChainTipInvalid indicates the branch contains at least one block
+	// which is known to be invalid.
+	ChainTipInvalid
+)
+
+// chainTipStatusStrings is a map of chain tip statuses back to their constant
+// names as used by the getchaintips RPC for pretty printing.
+var chainTipStatusStrings = map[ChainTipStatus]string{
+	ChainTipActive:       "active",
+	ChainTipValidFork:    "valid-fork",
+	ChainTipValidHeaders: "valid-headers",
+	ChainTipHeadersOnly:  "headers-only",
+	ChainTipInvalid:      "invalid",
+}
+
+// String returns the ChainTipStatus as a human-readable name.
+func (s ChainTipStatus) String() string {
+	if str, ok := chainTipStatusStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown ChainTipStatus (%d)", int(s))
+}
+
+// ChainTip describes a block known to the chain which has no known children.
+type ChainTip struct {
+	Hash   chainhash.Hash
+	Height int32
+
+	// BranchLen is the number of blocks from the tip back to the block of
+	// the main chain the branch forks from.  It is zero for the tip of the
+	// main chain.
+	BranchLen int32
+
+	Status ChainTipStatus
+}
+
+// chainTipStatus returns the status of the branch ending at the passed node
+// which forks from the main chain at the passed fork node.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) chainTipStatus(node, forkNode *blockNode) ChainTipStatus {
+	if node == b.bestChain.Tip() {
+		return ChainTipActive
+	}
+
+	status := ChainTipValidFork
+	for n := node; n != nil && n != forkNode; n = n.parent {
+		nodeStatus := b.index.NodeStatus(n)
+		switch {
+		case nodeStatus.KnownInvalid():
+			return ChainTipInvalid
+		case !nodeStatus.HaveData():
+			status = ChainTipHeadersOnly
+		case !nodeStatus.KnownValid() && status == ChainTipValidFork:
+			status = ChainTipValidHeaders
+		}
+	}
+	return status
+}
+
+// ChainTips returns all of the known chain tips, which are the tip of the main
+// chain along with the tips of all of the known forks from it, ordered by
+// height from the highest to the lowest.  The tips of competing forks can be
+// told apart from the ones of stale or invalid forks by their status.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainTips() []ChainTip {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	// The tip of the main chain is not a tip of the block index when it is
+	// extended by blocks which are not part of the main chain, such as
+	// invalid ones, but is reported regardless.
+	tip := b.bestChain.Tip()
+	b.index.RLock()
+	nodes := make([]*blockNode, 0, len(b.index.tips)+1)
+	for node := range b.index.tips {
+		nodes = append(nodes, node)
+	}
+	if _, ok := b.index.tips[tip]; !ok {
+		nodes = append(nodes, tip)
+	}
+	b.index.RUnlock()
+
+	tips := make([]ChainTip, 0, len(nodes))
+	for _, node := range nodes {
+		forkNode := b.bestChain.FindFork(node)
+		var branchLen int32
+		if forkNode != nil {
+			branchLen = node.height - forkNode.height
+		}
+		tips = append(tips, ChainTip{
+			Hash:      node.hash,
+			Height:    node.height,
+			BranchLen: branchLen,
+			Status:    b.chainTipStatus(node, forkNode),
+		})
+	}
+	sort.Slice(tips, func(i, j int) bool {
+		if tips[i].Height != tips[j].Height {
+			return tips[i].Height > tips[j].Height
+		}
+		return tips[i].Status < tips[j].Status
+	})
+	return tips
+}
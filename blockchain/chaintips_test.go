@@ -0,0 +1,77 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestChainTips ensures the tips of the main chain and of the forks from it are
+// tracked by the block index and reported with the status of their branch.
+func TestChainTips(t *testing.T) {
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	genesis := chain.bestChain.Genesis()
+	chain.index.SetStatusFlags(genesis, statusDataStored|statusValid)
+
+	// Build the following block tree, where the main chain ends at a4 and
+	// the other branches fork from it:
+	//
+	//   genesis -> a1 -> a2 -> a3 -> a4 -> e5  (active a4, invalid e5)
+	//                     a2 -> b3 -> b4        (valid fork)
+	//               a1 -> c2 -> c3              (valid headers)
+	//               a1 -> d2                    (headers only)
+	addBranch := func(parent *blockNode, n int, status blockStatus) []*blockNode {
+		nodes := chainedNodes(parent, n)
+		for _, node := range nodes {
+			node.status = status
+			chain.index.AddNode(node)
+		}
+		return nodes
+	}
+	const validStatus = statusDataStored | statusValid
+	branchA := addBranch(genesis, 4, validStatus)
+	chain.bestChain.SetTip(tstTip(branchA))
+	branchB := addBranch(branchA[1], 2, validStatus)
+	branchC := addBranch(branchA[0], 2, statusDataStored)
+	branchC[0].status = validStatus
+	branchD := addBranch(branchA[0], 1, statusNone)
+
+	// The active tip is still reported once it was extended by an invalid
+	// block.
+	if tips := chain.ChainTips(); len(tips) != 4 {
+		t.Fatalf("got %d tips, want 4", len(tips))
+	}
+	branchE := addBranch(branchA[3], 1, statusDataStored|statusValidateFailed)
+
+	want := []ChainTip{
+		{Hash: branchE[0].hash, Height: 5, BranchLen: 1,
+			Status: ChainTipInvalid},
+		{Hash: branchA[3].hash, Height: 4, BranchLen: 0,
+			Status: ChainTipActive},
+		{Hash: branchB[1].hash, Height: 4, BranchLen: 2,
+			Status: ChainTipValidFork},
+		{Hash: branchC[1].hash, Height: 3, BranchLen: 2,
+			Status: ChainTipValidHeaders},
+		{Hash: branchD[0].hash, Height: 2, BranchLen: 1,
+			Status: ChainTipHeadersOnly},
+	}
+	if tips := chain.ChainTips(); !reflect.DeepEqual(tips, want) {
+		t.Fatalf("unexpected chain tips:\ngot:  %+v\nwant: %+v", tips,
+			want)
+	}
+
+	// Invalid ancestors make the branch invalid.
+	chain.index.SetStatusFlags(branchB[0], statusValidateFailed)
+	tips := chain.ChainTips()
+	if tips[2].Hash != branchB[1].hash || tips[2].Status != ChainTipInvalid {
+		t.Fatalf("unexpected tip with invalid ancestor: %+v", tips[2])
+	}
+	if got := ChainTipValidFork.String(); got != "valid-fork" {
+		t.Fatalf("unexpected status string %q", got)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ChainTxStats houses statistics about the number of transactions in the main
+// chain up to a block and in a window of blocks ending with it.
+type ChainTxStats struct {
+	Hash   chainhash.Hash
+	Height int32
+	Time   time.Time
+
+	// TxCount is the total number of transactions in the main chain up to
+	// and including the block.
+	TxCount uint64
+
+	// WindowBlocks is the number of blocks in the window, which ends with
+	// the block, and WindowTxCount is the number of transactions in them.
+	// WindowInterval is the elapsed time between the timestamps of the
+	// block and of the block before the window.
+	WindowBlocks   int32
+	WindowTxCount  uint64
+	WindowInterval time.Duration
+}
+
+// dbFetchBlockTxCount returns the number of transactions of the block with the
+// passed hash.  Only the transaction count which follows the header of the
+// serialized block is loaded rather than the whole block.
+func dbFetchBlockTxCount(dbTx database.Tx, hash *chainhash.Hash) (uint64, error) {
+	// The serialized block is always far larger than the header along with
+	// the largest possible transaction count.
+	region := database.BlockRegion{
+		Hash:   hash,
+		Offset: wire.MaxBlockHeaderPayload,
+		Len:    wire.MaxVarIntPayload,
+	}
+	countBytes, err := dbTx.FetchBlockRegion(&region)
+	if err != nil {
+		return 0, err
+	}
+	return wire.ReadVarInt(bytes.NewReader(countBytes), 0)
+}
+
+// ChainTxStats returns the statistics about the number of transactions in the
+// main chain up to the block with the passed hash and in the window of the
+// passed number of blocks ending with it.  The window may not extend to the
+// genesis block.
+//
+// The transaction counts are determined from the blocks in the window and the
+// ones after the block, so the cost grows with both and the blocks must be
+// available, which is not the case for pruned blocks.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainTxStats(hash *chainhash.Hash, windowBlocks int32) (*ChainTxStats, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil || !b.bestChain.Contains(node) {
+		str := fmt.Sprintf("block %s is not in the main chain", hash)
+		return nil, errNotInMainChain(str)
+	}
+	if windowBlocks < 0 || (windowBlocks > 0 && windowBlocks >= node.height) {
+		return nil, fmt.Errorf("window of %d blocks is not between 0 "+
+			"and the height of the block minus one", windowBlocks)
+	}
+
+	// The total number of transactions is only tracked for the tip of the
+	// main chain, so the transactions of the blocks after the block are
+	// subtracted from it.
+	stats := &ChainTxStats{
+		Hash:         node.hash,
+		Height:       node.height,
+		Time:         time.Unix(node.timestamp, 0),
+		TxCount:      b.stateSnapshot.TotalTxns,
+		WindowBlocks: windowBlocks,
+	}
+	err := b.db.View(func(dbTx database.Tx) error {
+		for n := b.bestChain.Tip(); n != node; n = n.parent {
+			count, err := dbFetchBlockTxCount(dbTx, &n.hash)
+			if err != nil {
+				return err
+			}
+			stats.TxCount -= count
+		}
+
+		n := node
+		for i := int32(0); i < windowBlocks; i++ {
+			count, err := dbFetchBlockTxCount(dbTx, &n.hash)
+			if err != nil {
+				return err
+			}
+			stats.WindowTxCount += count
+			n = n.parent
+		}
+		stats.WindowInterval = time.Duration(node.timestamp-n.timestamp) *
+			time.Second
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestChainTxStats ensures the transaction counts of the main chain up to a
+// block and in the window ending with it are determined from the blocks.
+func TestChainTxStats(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	chain, teardownFunc, err := chainSetup("chaintxstats",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	chain.TstSetCoinbaseMaturity(1)
+	for i := 1; i < len(blocks); i++ {
+		if _, _, err := chain.ProcessBlock(blocks[i], BFNone); err != nil {
+			t.Fatalf("ProcessBlock fail on block %d: %v", i, err)
+		}
+	}
+
+	// The expected counts are derived from the transactions of the blocks.
+	txCount := func(first, last int32) uint64 {
+		var count uint64
+		for i := first; i <= last; i++ {
+			count += uint64(len(blocks[i].Transactions()))
+		}
+		return count
+	}
+	tests := []struct {
+		height       int32
+		windowBlocks int32
+	}{
+		{4, 3},
+		{4, 0},
+		{3, 2},
+		{2, 1},
+	}
+	for _, test := range tests {
+		block := blocks[test.height]
+		stats, err := chain.ChainTxStats(block.Hash(), test.windowBlocks)
+		if err != nil {
+			t.Errorf("ChainTxStats(%d, %d): unexpected error: %v",
+				test.height, test.windowBlocks, err)
+			continue
+		}
+		wantTxCount := txCount(0, test.height)
+		wantWindowTxCount := txCount(test.height-test.windowBlocks+1,
+			test.height)
+		windowStart := blocks[test.height-test.windowBlocks]
+		wantInterval := block.MsgBlock().Header.Timestamp.Sub(
+			windowStart.MsgBlock().Header.Timestamp)
+		if stats.Height != test.height || stats.TxCount != wantTxCount ||
+			stats.WindowTxCount != wantWindowTxCount ||
+			stats.WindowInterval != wantInterval ||
+			!stats.Time.Equal(block.MsgBlock().Header.Timestamp) {
+
+			t.Errorf("ChainTxStats(%d, %d): got %+v", test.height,
+				test.windowBlocks, stats)
+		}
+	}
+
+	if _, err := chain.ChainTxStats(blocks[2].Hash(), 2); err == nil {
+		t.Errorf("ChainTxStats: window reaching the genesis block was " +
+			"not rejected")
+	}
+}
@@ -6,6 +6,7 @@ package blockchain
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
@@ -18,6 +19,53 @@ import (
 // best block chain that a good checkpoint candidate must be.
 const CheckpointConfirmations = 2016
 
+// CheckpointMode specifies how blocks which conflict with the checkpoints are
+// handled.
+type CheckpointMode int
+
+const (
+	// CheckpointEnforce rejects blocks which do not match the checkpoint at
+	// their height as well as blocks which fork the main chain before the
+	// most recent checkpoint.  Scripts are not validated for blocks before
+	// the latest checkpoint.
+	CheckpointEnforce CheckpointMode = iota
+
+	// CheckpointAdvisory logs a warning for blocks which do not match the
+	// checkpoint at their height, but otherwise validates them as if there
+	// were no checkpoints.
+	CheckpointAdvisory
+
+	// CheckpointDisabled ignores the checkpoints entirely.
+	CheckpointDisabled
+)
+
+// checkpointModeStrings is a map of checkpoint modes back to their constant
+// names for pretty printing.
+var checkpointModeStrings = map[CheckpointMode]string{
+	CheckpointEnforce:  "enforce",
+	CheckpointAdvisory: "advisory",
+	CheckpointDisabled: "disabled",
+}
+
+// String returns the CheckpointMode in human-readable form.
+func (m CheckpointMode) String() string {
+	if s, ok := checkpointModeStrings[m]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown CheckpointMode (%d)", int(m))
+}
+
+// ParseCheckpointMode returns the checkpoint mode described by the passed
+// string as returned by its String method.
+func ParseCheckpointMode(s string) (CheckpointMode, error) {
+	for mode, str := range checkpointModeStrings {
+		if s == str {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown checkpoint mode %q", s)
+}
+
 // newHashFromStr converts the passed big-endian hex string into a
 // chainhash.Hash.  It only differs from the one available in chainhash in that
 // it ignores the error since it will only (and must only) be called with
@@ -31,16 +79,29 @@ func newHashFromStr(hexStr string) *chainhash.Hash {
 // already known).  When there are no checkpoints for the chain, it will return
 // nil.
 //
+// The returned slice must not be modified.
+//
 // This function is safe for concurrent access.
 func (b *BlockChain) Checkpoints() []chaincfg.Checkpoint {
-	return b.checkpoints
+	b.checkpointsLock.RLock()
+	checkpoints := b.checkpoints
+	b.checkpointsLock.RUnlock()
+	return checkpoints
 }
 
 // HasCheckpoints returns whether this BlockChain has checkpoints defined.
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) HasCheckpoints() bool {
-	return len(b.checkpoints) > 0
+	return len(b.Checkpoints()) > 0
+}
+
+// CheckpointMode returns how blocks which conflict with the checkpoints are
+// handled.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckpointMode() CheckpointMode {
+	return b.checkpointMode
 }
 
 // LatestCheckpoint returns the most recent checkpoint (regardless of whether it
@@ -49,17 +110,90 @@ func (b *BlockChain) HasCheckpoints() bool {
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) LatestCheckpoint() *chaincfg.Checkpoint {
-	if !b.HasCheckpoints() {
+	checkpoints := b.Checkpoints()
+	if len(checkpoints) == 0 {
+		return nil
+	}
+	return &checkpoints[len(checkpoints)-1]
+}
+
+// enforcedLatestCheckpoint returns the most recent checkpoint when the
+// checkpoints are enforced and nil otherwise.
+func (b *BlockChain) enforcedLatestCheckpoint() *chaincfg.Checkpoint {
+	if b.checkpointMode != CheckpointEnforce {
 		return nil
 	}
-	return &b.checkpoints[len(b.checkpoints)-1]
+	return b.LatestCheckpoint()
+}
+
+// AddCheckpoint adds the passed checkpoint to the checkpoints the chain is
+// validated against, replacing any existing checkpoint at the same height.
+// When checkpoints are enforced, a checkpoint which conflicts with the block
+// at its height in the main chain is rejected.
+//
+// Checkpoints added this way are not persisted.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AddCheckpoint(checkpoint chaincfg.Checkpoint) error {
+	if checkpoint.Hash == nil || checkpoint.Height <= 0 {
+		return fmt.Errorf("invalid checkpoint at height %d",
+			checkpoint.Height)
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.bestChain.NodeByHeight(checkpoint.Height)
+	if node != nil && node.hash != *checkpoint.Hash {
+		str := fmt.Sprintf("checkpoint %s at height %d conflicts with "+
+			"main chain block %s", checkpoint.Hash, checkpoint.Height,
+			node.hash)
+		if b.checkpointMode == CheckpointEnforce {
+			return ruleError(ErrBadCheckpoint, str)
+		}
+		log.Warnf("Adding %s", str)
+	}
+
+	// Copy the checkpoints rather than modifying them in place since
+	// callers of Checkpoints may still hold a reference to them.
+	checkpoints := make([]chaincfg.Checkpoint, 0, len(b.checkpoints)+1)
+	for _, existing := range b.checkpoints {
+		if existing.Height != checkpoint.Height {
+			checkpoints = append(checkpoints, existing)
+		}
+	}
+	checkpoints = append(checkpoints, checkpoint)
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].Height < checkpoints[j].Height
+	})
+	checkpointsByHeight := make(map[int32]*chaincfg.Checkpoint,
+		len(checkpoints))
+	for i := range checkpoints {
+		checkpointsByHeight[checkpoints[i].Height] = &checkpoints[i]
+	}
+
+	b.checkpointsLock.Lock()
+	b.checkpoints = checkpoints
+	b.checkpointsByHeight = checkpointsByHeight
+	b.checkpointsLock.Unlock()
+
+	// Clear the cached checkpoint lockin so it is found again among the
+	// new checkpoints.
+	b.checkpointNode = nil
+	b.nextCheckpoint = nil
+
+	log.Infof("Added checkpoint at height %d/block %s", checkpoint.Height,
+		checkpoint.Hash)
+	return nil
 }
 
 // verifyCheckpoint returns whether the passed block height and hash combination
 // match the checkpoint data.  It also returns true if there is no checkpoint
-// data for the passed block height.
+// data for the passed block height or the checkpoints are disabled.
+//
+// This function MUST be called with the chain state lock held (for reads).
 func (b *BlockChain) verifyCheckpoint(height int32, hash *chainhash.Hash) bool {
-	if !b.HasCheckpoints() {
+	if b.checkpointMode == CheckpointDisabled || len(b.checkpoints) == 0 {
 		return true
 	}
 
@@ -81,11 +215,12 @@ func (b *BlockChain) verifyCheckpoint(height int32, hash *chainhash.Hash) bool {
 // findPreviousCheckpoint finds the most recent checkpoint that is already
 // available in the downloaded portion of the block chain and returns the
 // associated block node.  It returns nil if a checkpoint can't be found (this
-// should really only happen for blocks before the first checkpoint).
+// should really only happen for blocks before the first checkpoint) or when
+// the checkpoints are not enforced.
 //
 // This function MUST be called with the chain lock held (for reads).
 func (b *BlockChain) findPreviousCheckpoint() (*blockNode, error) {
-	if !b.HasCheckpoints() {
+	if b.checkpointMode != CheckpointEnforce || len(b.checkpoints) == 0 {
 		return nil, nil
 	}
 
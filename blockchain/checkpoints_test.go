@@ -0,0 +1,139 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestCheckpointModeStringer tests the stringized output and parsing of the
+// CheckpointMode type.
+func TestCheckpointModeStringer(t *testing.T) {
+	tests := []struct {
+		in   CheckpointMode
+		want string
+	}{
+		{CheckpointEnforce, "enforce"},
+		{CheckpointAdvisory, "advisory"},
+		{CheckpointDisabled, "disabled"},
+		{0xffff, "Unknown CheckpointMode (65535)"},
+	}
+
+	for i, test := range tests {
+		result := test.in.String()
+		if result != test.want {
+			t.Errorf("String #%d\n got: %s want: %s", i, result,
+				test.want)
+			continue
+		}
+		if test.in > CheckpointDisabled {
+			if _, err := ParseCheckpointMode(result); err == nil {
+				t.Errorf("ParseCheckpointMode #%d: unexpected "+
+					"success", i)
+			}
+			continue
+		}
+		mode, err := ParseCheckpointMode(result)
+		if err != nil || mode != test.in {
+			t.Errorf("ParseCheckpointMode #%d: got %v (%v), want %v",
+				i, mode, err, test.in)
+		}
+	}
+}
+
+// TestAddCheckpoint ensures checkpoints added to a running chain are enforced
+// according to the checkpoint mode of the chain.
+func TestAddCheckpoint(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> ... -> 10
+	// 	                    \-> 3a
+	tip := tstTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	mainNodes := chainedNodes(chain.bestChain.Genesis(), 10)
+	sideNodes := chainedNodes(mainNodes[1], 1)
+	for _, node := range mainNodes {
+		chain.index.AddNode(node)
+	}
+	chain.index.AddNode(sideNodes[0])
+	chain.bestChain.SetTip(tip(mainNodes))
+
+	// A checkpoint which conflicts with the main chain must be rejected
+	// when checkpoints are enforced.
+	err := chain.AddCheckpoint(chaincfg.Checkpoint{
+		Height: 3,
+		Hash:   &sideNodes[0].hash,
+	})
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrBadCheckpoint {
+		t.Fatalf("conflicting checkpoint: unexpected error %v", err)
+	}
+	if chain.HasCheckpoints() {
+		t.Fatal("conflicting checkpoint was added")
+	}
+
+	// Add checkpoints out of order and ensure they are kept sorted and the
+	// latest known checkpoint is used to prevent old forks.
+	for _, i := range []int{7, 4} {
+		err := chain.AddCheckpoint(chaincfg.Checkpoint{
+			Height: mainNodes[i].height,
+			Hash:   &mainNodes[i].hash,
+		})
+		if err != nil {
+			t.Fatalf("AddCheckpoint: unexpected error %v", err)
+		}
+	}
+	snapshot := chain.Checkpoints()
+	if len(snapshot) != 2 || snapshot[0].Height != 5 ||
+		snapshot[1].Height != 8 {
+
+		t.Fatalf("unexpected checkpoints %v", snapshot)
+	}
+	node, err := chain.findPreviousCheckpoint()
+	if err != nil || node != mainNodes[7] {
+		t.Fatalf("findPreviousCheckpoint: got %v (%v), want %v", node,
+			err, mainNodes[7])
+	}
+	if chain.verifyCheckpoint(3, &sideNodes[0].hash) != true {
+		t.Fatal("block without checkpoint was not verified")
+	}
+	if chain.verifyCheckpoint(5, &mainNodes[3].hash) != false {
+		t.Fatal("block not matching checkpoint was verified")
+	}
+
+	// Conflicting checkpoints are accepted, but not used to prevent forks
+	// in advisory mode.  Replacing a checkpoint must not modify previously
+	// returned ones.
+	chain.checkpointMode = CheckpointAdvisory
+	err = chain.AddCheckpoint(chaincfg.Checkpoint{
+		Height: 8,
+		Hash:   &sideNodes[0].hash,
+	})
+	if err != nil {
+		t.Fatalf("advisory AddCheckpoint: unexpected error %v", err)
+	}
+	checkpoints := chain.Checkpoints()
+	if len(checkpoints) != 2 || checkpoints[1].Hash != &sideNodes[0].hash {
+		t.Fatalf("unexpected checkpoints after replace %v", checkpoints)
+	}
+	if snapshot[1].Hash != &mainNodes[7].hash {
+		t.Fatal("previously returned checkpoints were modified")
+	}
+	node, err = chain.findPreviousCheckpoint()
+	if err != nil || node != nil {
+		t.Fatalf("advisory findPreviousCheckpoint: got %v (%v), want nil",
+			node, err)
+	}
+	if chain.enforcedLatestCheckpoint() != nil {
+		t.Fatal("advisory latest checkpoint is enforced")
+	}
+
+	// All blocks are verified when checkpoints are disabled.
+	chain.checkpointMode = CheckpointDisabled
+	if !chain.verifyCheckpoint(5, &mainNodes[3].hash) {
+		t.Fatal("block was not verified with checkpoints disabled")
+	}
+}
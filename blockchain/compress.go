@@ -584,3 +584,35 @@ func decodeCompressedTxOut(serialized []byte) (uint64, []byte, int, error) {
 	script := decompressScript(serialized[bytesRead : bytesRead+scriptSize])
 	return amount, script, bytesRead + scriptSize, nil
 }
+
+// -----------------------------------------------------------------------------
+// Both the utxo set and the spend journal prefix each compressed transaction
+// output with a header code that packs a height along with a flag indicating
+// whether or not the containing transaction is a coinbase into a single value
+// that is then serialized as a VLQ.
+//
+// The header code format is:
+//   bit 0 - containing transaction is a coinbase
+//   bits 1-x - height
+//
+// The utxo set stores the height of the block that contains the output while
+// the spend journal stores the number of blocks between the spending block and
+// the block that contains the output.  The latter is typically much smaller
+// which allows it to be encoded with fewer bytes.
+// -----------------------------------------------------------------------------
+
+// heightCoinbaseCode returns the header code for the passed height and coinbase
+// flag according to the format described above.
+func heightCoinbaseCode(height int32, isCoinBase bool) uint64 {
+	code := uint64(height) << 1
+	if isCoinBase {
+		code |= 0x01
+	}
+	return code
+}
+
+// decodeHeightCoinbaseCode decodes the passed header code into the height and
+// coinbase flag it encodes according to the format described above.
+func decodeHeightCoinbaseCode(code uint64) (int32, bool) {
+	return int32(code >> 1), code&0x01 != 0
+}
@@ -8,6 +8,7 @@ import (
 	"math/big"
 	"time"
 
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
@@ -190,29 +191,6 @@ func (b *BlockChain) calcEasiestDifficulty(bits uint32, duration time.Duration)
 	return BigToCompact(newTarget)
 }
 
-// findPrevTestNetDifficulty returns the difficulty of the previous block which
-// did not have the special testnet minimum difficulty rule applied.
-//
-// This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) findPrevTestNetDifficulty(startNode *blockNode) uint32 {
-	// Search backwards through the chain for the last block without
-	// the special rule applied.
-	iterNode := startNode
-	for iterNode != nil && iterNode.height%b.blocksPerRetarget != 0 &&
-		iterNode.bits == b.chainParams.PowLimitBits {
-
-		iterNode = iterNode.parent
-	}
-
-	// Return the found difficulty or the minimum difficulty if no
-	// appropriate block was found.
-	lastBits := b.chainParams.PowLimitBits
-	if iterNode != nil {
-		lastBits = iterNode.bits
-	}
-	return lastBits
-}
-
 // calcNextRequiredDifficulty calculates the required difficulty for the block
 // after the passed previous block node based on the difficulty retarget rules.
 // This function differs from the exported CalcNextRequiredDifficulty in that
@@ -223,80 +201,7 @@ func (b *BlockChain) calcNextRequiredDifficulty(lastNode *blockNode, newBlockTim
 	if lastNode == nil {
 		return b.chainParams.PowLimitBits, nil
 	}
-
-	// Return the previous block's difficulty requirements if this block
-	// is not at a difficulty retarget interval.
-	if (lastNode.height+1)%b.blocksPerRetarget != 0 {
-		// For networks that support it, allow special reduction of the
-		// required difficulty once too much time has elapsed without
-		// mining a block.
-		if b.chainParams.ReduceMinDifficulty {
-			// Return minimum difficulty when more than the desired
-			// amount of time has elapsed without mining a block.
-			reductionTime := int64(b.chainParams.MinDiffReductionTime /
-				time.Second)
-			allowMinTime := lastNode.timestamp + reductionTime
-			if newBlockTime.Unix() > allowMinTime {
-				return b.chainParams.PowLimitBits, nil
-			}
-
-			// The block was mined within the desired timeframe, so
-			// return the difficulty for the last block which did
-			// not have the special minimum difficulty rule applied.
-			return b.findPrevTestNetDifficulty(lastNode), nil
-		}
-
-		// For the main network (or any unrecognized networks), simply
-		// return the previous block's difficulty requirements.
-		return lastNode.bits, nil
-	}
-
-	// Get the block node at the previous retarget (targetTimespan days
-	// worth of blocks).
-	firstNode := lastNode.RelativeAncestor(b.blocksPerRetarget - 1)
-	if firstNode == nil {
-		return 0, AssertError("unable to obtain previous retarget block")
-	}
-
-	// Limit the amount of adjustment that can occur to the previous
-	// difficulty.
-	actualTimespan := lastNode.timestamp - firstNode.timestamp
-	adjustedTimespan := actualTimespan
-	if actualTimespan < b.minRetargetTimespan {
-		adjustedTimespan = b.minRetargetTimespan
-	} else if actualTimespan > b.maxRetargetTimespan {
-		adjustedTimespan = b.maxRetargetTimespan
-	}
-
-	// Calculate new target difficulty as:
-	//  currentDifficulty * (adjustedTimespan / targetTimespan)
-	// The result uses integer division which means it will be slightly
-	// rounded down.  Bitcoind also uses integer division to calculate this
-	// result.
-	oldTarget := CompactToBig(lastNode.bits)
-	newTarget := new(big.Int).Mul(oldTarget, big.NewInt(adjustedTimespan))
-	targetTimeSpan := int64(b.chainParams.TargetTimespan / time.Second)
-	newTarget.Div(newTarget, big.NewInt(targetTimeSpan))
-
-	// Limit new value to the proof of work limit.
-	if newTarget.Cmp(b.chainParams.PowLimit) > 0 {
-		newTarget.Set(b.chainParams.PowLimit)
-	}
-
-	// Log new target difficulty and return it.  The new target logging is
-	// intentionally converting the bits back to a number instead of using
-	// newTarget since conversion to the compact representation loses
-	// precision.
-	newTargetBits := BigToCompact(newTarget)
-	log.Debugf("Difficulty retarget at block height %d", lastNode.height+1)
-	log.Debugf("Old target %08x (%064x)", lastNode.bits, oldTarget)
-	log.Debugf("New target %08x (%064x)", newTargetBits, CompactToBig(newTargetBits))
-	log.Debugf("Actual timespan %v, adjusted timespan %v, target timespan %v",
-		time.Duration(actualTimespan)*time.Second,
-		time.Duration(adjustedTimespan)*time.Second,
-		b.chainParams.TargetTimespan)
-
-	return newTargetBits, nil
+	return CalcNextRequiredBits(lastNode, newBlockTime, b.chainParams)
 }
 
 // CalcNextRequiredDifficulty calculates the required difficulty for the block
@@ -310,3 +215,47 @@ func (b *BlockChain) CalcNextRequiredDifficulty(timestamp time.Time) (uint32, er
 	b.chainLock.Unlock()
 	return difficulty, err
 }
+
+// IsPermittedDifficultyTransition returns whether the difficulty bits of a
+// block at the passed height may follow the passed difficulty bits of its
+// parent according to the difficulty retarget rules of the passed network.
+//
+// Unlike the full difficulty check performed when a block is connected, it does
+// not require the ancestors of the block, which makes it suitable to sanity
+// check headers which are not connected to the block index yet, such as while
+// headers are pre-synchronized.  Consequently, any target within the range the
+// retarget adjustment factor permits is allowed at retarget intervals, and any
+// target is allowed on networks which allow minimum difficulty blocks.
+func IsPermittedDifficultyTransition(params *chaincfg.Params, height int32,
+	oldBits, newBits uint32) bool {
+
+	if params.ReduceMinDifficulty {
+		return true
+	}
+
+	// The difficulty may only change at retarget intervals.
+	blocksPerRetarget := int32(params.TargetTimespan / params.TargetTimePerBlock)
+	if height%blocksPerRetarget != 0 {
+		return newBits == oldBits
+	}
+
+	// Calculate the targets for the minimum and maximum adjusted timespans
+	// the same way as the next required difficulty, including the loss of
+	// precision of the compact representation, and ensure the new target
+	// is within them.
+	targetTimespan := int64(params.TargetTimespan / time.Second)
+	adjustmentFactor := params.RetargetAdjustmentFactor
+	retarget := func(adjustedTimespan int64) *big.Int {
+		target := CompactToBig(oldBits)
+		target.Mul(target, big.NewInt(adjustedTimespan))
+		target.Div(target, big.NewInt(targetTimespan))
+		if target.Cmp(params.PowLimit) > 0 {
+			target.Set(params.PowLimit)
+		}
+		return CompactToBig(BigToCompact(target))
+	}
+	minTarget := retarget(targetTimespan / adjustmentFactor)
+	maxTarget := retarget(targetTimespan * adjustmentFactor)
+	newTarget := CompactToBig(newBits)
+	return newTarget.Cmp(minTarget) >= 0 && newTarget.Cmp(maxTarget) <= 0
+}
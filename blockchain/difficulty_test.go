@@ -7,6 +7,8 @@ package blockchain
 import (
 	"math/big"
 	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
 // TestBigToCompact ensures BigToCompact converts big integers to the expected
@@ -73,3 +75,35 @@ func TestCalcWork(t *testing.T) {
 		}
 	}
 }
+
+// TestIsPermittedDifficultyTransition ensures difficulty transitions are only
+// permitted within the bounds of the retarget rules of the network.
+func TestIsPermittedDifficultyTransition(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  *chaincfg.Params
+		height  int32
+		oldBits uint32
+		newBits uint32
+		want    bool
+	}{
+		{"unchanged", &chaincfg.MainNetParams, 2015, 0x1b0404cb, 0x1b0404cb, true},
+		{"changed between retargets", &chaincfg.MainNetParams, 2015, 0x1b0404cb, 0x1b0404ca, false},
+		{"unchanged at retarget", &chaincfg.MainNetParams, 2016, 0x1b0404cb, 0x1b0404cb, true},
+		{"max increase", &chaincfg.MainNetParams, 2016, 0x1b0404cb, 0x1b010132, true},
+		{"excessive increase", &chaincfg.MainNetParams, 2016, 0x1b0404cb, 0x1b010131, false},
+		{"max decrease", &chaincfg.MainNetParams, 2016, 0x1b0404cb, 0x1b10132c, true},
+		{"excessive decrease", &chaincfg.MainNetParams, 2016, 0x1b0404cb, 0x1b10132d, false},
+		{"pow limit", &chaincfg.MainNetParams, 4032, 0x1d00ffff, 0x1d00ffff, true},
+		{"above pow limit", &chaincfg.MainNetParams, 4032, 0x1d00ffff, 0x1d01fffe, false},
+		{"min difficulty", &chaincfg.TestNet3Params, 2015, 0x1b0404cb, 0x1d00ffff, true},
+	}
+
+	for _, test := range tests {
+		got := IsPermittedDifficultyTransition(test.params, test.height,
+			test.oldBits, test.newBits)
+		if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -24,7 +24,12 @@ Since this package does not deal with other bitcoin specifics such as network
 communication or wallets, it provides a notification system which gives the
 caller a high level of flexibility in how they want to react to certain events
 such as orphan blocks which need their parents requested and newly connected
-main chain blocks which might result in wallet updates.
+main chain blocks which might result in wallet updates.  Notifications are
+delivered synchronously to the callbacks registered with Subscribe, and
+asynchronously over buffered, typed channels to the subscriptions created with
+SubscribeBlockConnected, SubscribeBlockDisconnected, SubscribeReorganizations,
+and SubscribeTxAccepted, which drop, block, or end when their subscriber falls
+behind according to their SlowConsumerPolicy.
 
 Bitcoin Chain Processing Overview
 
@@ -61,6 +61,12 @@ func isSupportedDbType(dbType string) bool {
 // block already inserted.  In addition to the new chain instance, it returns
 // a teardown function the caller should invoke when done testing to clean up.
 func chainSetup(dbName string, params *chaincfg.Params) (*blockchain.BlockChain, func(), error) {
+	return chainSetupWithUtxoCache(dbName, params, 0)
+}
+
+// chainSetupWithUtxoCache is chainSetup with a utxo cache of the passed
+// maximum size in front of the database.
+func chainSetupWithUtxoCache(dbName string, params *chaincfg.Params, utxoCacheMaxSize uint64) (*blockchain.BlockChain, func(), error) {
 	if !isSupportedDbType(testDbType) {
 		return nil, nil, fmt.Errorf("unsupported db type %v", testDbType)
 	}
@@ -115,11 +121,12 @@ func chainSetup(dbName string, params *chaincfg.Params) (*blockchain.BlockChain,
 
 	// Create the main chain instance.
 	chain, err := blockchain.New(&blockchain.Config{
-		DB:          db,
-		ChainParams: &paramsCopy,
-		Checkpoints: nil,
-		TimeSource:  blockchain.NewMedianTime(),
-		SigCache:    txscript.NewSigCache(1000),
+		DB:               db,
+		ChainParams:      &paramsCopy,
+		Checkpoints:      nil,
+		TimeSource:       blockchain.NewMedianTime(),
+		SigCache:         txscript.NewSigCache(1000),
+		UtxoCacheMaxSize: utxoCacheMaxSize,
 	})
 	if err != nil {
 		teardown()
@@ -132,20 +139,64 @@ func chainSetup(dbName string, params *chaincfg.Params) (*blockchain.BlockChain,
 // TestFullBlocks ensures all tests generated by the fullblocktests package
 // have the expected result when processed via ProcessBlock.
 func TestFullBlocks(t *testing.T) {
+	testFullBlocks(t, "fullblocktest", 0)
+}
+
+// TestFullBlocksUtxoCache ensures all tests generated by the fullblocktests
+// package have the expected result when processed via ProcessBlock with a utxo
+// cache which is small enough to be flushed and evicted many times, including
+// around reorganizations.
+func TestFullBlocksUtxoCache(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the full block tests with a utxo cache in " +
+			"short mode")
+	}
+	testFullBlocks(t, "fullblockutxocachetest", 16*1024)
+}
+
+// testFullBlocks runs all tests generated by the fullblocktests package
+// against a chain instance with a utxo cache of the passed maximum size.
+func testFullBlocks(t *testing.T, dbName string, utxoCacheMaxSize uint64) {
 	tests, err := fullblocktests.Generate(false)
 	if err != nil {
 		t.Fatalf("failed to generate tests: %v", err)
 	}
 
 	// Create a new database and chain instance to run tests against.
-	chain, teardownFunc, err := chainSetup("fullblocktest",
-		&chaincfg.RegressionNetParams)
+	chain, teardownFunc, err := chainSetupWithUtxoCache(dbName,
+		&chaincfg.RegressionNetParams, utxoCacheMaxSize)
 	if err != nil {
 		t.Errorf("Failed to setup chain instance: %v", err)
 		return
 	}
 	defer teardownFunc()
 
+	// Ensure the reorganization notifications are consistent with the
+	// state of the chain.
+	var numReorgs int
+	chain.Subscribe(func(n *blockchain.Notification) {
+		if n.Type != blockchain.NTReorganization {
+			return
+		}
+		numReorgs++
+		reorg := n.Data.(*blockchain.Reorganization)
+		best := chain.BestSnapshot()
+		if reorg.NewTipHash != best.Hash ||
+			reorg.NewTipHeight != best.Height {
+
+			t.Errorf("reorganization new tip %v (height %d) does "+
+				"not match best chain %v (height %d)",
+				reorg.NewTipHash, reorg.NewTipHeight, best.Hash,
+				best.Height)
+		}
+		if int(reorg.OldTipHeight-reorg.ForkHeight) != reorg.DetachedBlocks ||
+			int(reorg.NewTipHeight-reorg.ForkHeight) != reorg.AttachedBlocks {
+
+			t.Errorf("reorganization %+v has inconsistent number of "+
+				"blocks", reorg)
+		}
+	})
+
 	// testAcceptedBlock attempts to process the block in the provided test
 	// instance and ensures that it was accepted according to the flags
 	// specified in the test.
@@ -307,4 +358,8 @@ func TestFullBlocks(t *testing.T) {
 			}
 		}
 	}
+
+	if numReorgs == 0 {
+		t.Error("no reorganization notifications were sent")
+	}
 }
@@ -0,0 +1,352 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// HeaderCtx is the view of a block header within a chain of headers which the
+// contextual header checks require.  It allows light clients, which only keep
+// headers, to verify them with the same consensus code as the block chain.
+type HeaderCtx interface {
+	// Height returns the height of the header.
+	Height() int32
+
+	// Bits returns the difficulty bits of the header.
+	Bits() uint32
+
+	// Timestamp returns the timestamp of the header in seconds since the
+	// Unix epoch.
+	Timestamp() int64
+
+	// Parent returns the previous header in the chain or nil for the
+	// genesis header.
+	Parent() HeaderCtx
+
+	// RelativeAncestorCtx returns the ancestor the passed number of headers
+	// before this one or nil when it does not exist.
+	RelativeAncestorCtx(distance int32) HeaderCtx
+}
+
+// Ensure blockNode implements the HeaderCtx interface.
+var _ HeaderCtx = (*blockNode)(nil)
+
+// Height returns the height of the block node.
+//
+// This function is safe for concurrent access.
+func (node *blockNode) Height() int32 {
+	return node.height
+}
+
+// Bits returns the difficulty bits of the block node.
+//
+// This function is safe for concurrent access.
+func (node *blockNode) Bits() uint32 {
+	return node.bits
+}
+
+// Timestamp returns the timestamp of the block node.
+//
+// This function is safe for concurrent access.
+func (node *blockNode) Timestamp() int64 {
+	return node.timestamp
+}
+
+// Parent returns the parent of the block node or nil for the genesis block.
+//
+// This function is safe for concurrent access.
+func (node *blockNode) Parent() HeaderCtx {
+	if node.parent == nil {
+		return nil
+	}
+	return node.parent
+}
+
+// RelativeAncestorCtx returns the ancestor block node a relative 'distance'
+// blocks before this node or nil when it does not exist.
+//
+// This function is safe for concurrent access.
+func (node *blockNode) RelativeAncestorCtx(distance int32) HeaderCtx {
+	ancestor := node.RelativeAncestor(distance)
+	if ancestor == nil {
+		return nil
+	}
+	return ancestor
+}
+
+// HeaderNode is a minimal HeaderCtx implementation for callers which keep a
+// chain of headers without a block chain, such as light clients.
+type HeaderNode struct {
+	header wire.BlockHeader
+	height int32
+	parent *HeaderNode
+}
+
+// Ensure HeaderNode implements the HeaderCtx interface.
+var _ HeaderCtx = (*HeaderNode)(nil)
+
+// NewHeaderNode returns a new header node for the passed header which extends
+// the passed parent.  The parent must be nil for the genesis header.
+func NewHeaderNode(header *wire.BlockHeader, parent *HeaderNode) *HeaderNode {
+	node := &HeaderNode{header: *header, parent: parent}
+	if parent != nil {
+		node.height = parent.height + 1
+	}
+	return node
+}
+
+// Header returns the header of the node.
+func (node *HeaderNode) Header() wire.BlockHeader {
+	return node.header
+}
+
+// Height returns the height of the header.
+func (node *HeaderNode) Height() int32 {
+	return node.height
+}
+
+// Bits returns the difficulty bits of the header.
+func (node *HeaderNode) Bits() uint32 {
+	return node.header.Bits
+}
+
+// Timestamp returns the timestamp of the header.
+func (node *HeaderNode) Timestamp() int64 {
+	return node.header.Timestamp.Unix()
+}
+
+// Parent returns the previous header node or nil for the genesis header.
+func (node *HeaderNode) Parent() HeaderCtx {
+	if node.parent == nil {
+		return nil
+	}
+	return node.parent
+}
+
+// RelativeAncestorCtx returns the header node the passed number of headers
+// before this one or nil when it does not exist.
+func (node *HeaderNode) RelativeAncestorCtx(distance int32) HeaderCtx {
+	if distance < 0 || distance > node.height {
+		return nil
+	}
+	n := node
+	for ; n != nil && distance > 0; distance-- {
+		n = n.parent
+	}
+	if n == nil {
+		return nil
+	}
+	return n
+}
+
+// CalcPastMedianTime calculates the median time of the previous few headers
+// prior to, and including, the passed header.
+func CalcPastMedianTime(header HeaderCtx) time.Time {
+	// Create a slice of the previous few header timestamps used to
+	// calculate the median per the number defined by the constant
+	// medianTimeBlocks.
+	timestamps := make([]int64, 0, medianTimeBlocks)
+	for iter := header; iter != nil && len(timestamps) < medianTimeBlocks; iter = iter.Parent() {
+		timestamps = append(timestamps, iter.Timestamp())
+	}
+	sort.Sort(timeSorter(timestamps))
+
+	// NOTE: The consensus rules incorrectly calculate the median for even
+	// numbers of blocks.  A true median averages the middle two elements
+	// for a set with an even number of elements in it.   Since the constant
+	// for the previous number of blocks to be used is odd, this is only an
+	// issue for a few blocks near the beginning of the chain.  I suspect
+	// this is an optimization even though the result is slightly wrong for
+	// a few of the first blocks since after the first few blocks, there
+	// will always be an odd number of blocks in the set per the constant.
+	//
+	// This code follows suit to ensure the same rules are used, however, be
+	// aware that should the medianTimeBlocks constant ever be changed to an
+	// even number, this code will be wrong.
+	medianTimestamp := timestamps[len(timestamps)/2]
+	return time.Unix(medianTimestamp, 0)
+}
+
+// findPrevTestNetDifficulty returns the difficulty of the previous header which
+// did not have the special testnet minimum difficulty rule applied.
+func findPrevTestNetDifficulty(startHeader HeaderCtx, params *chaincfg.Params) uint32 {
+	// Search backwards through the chain for the last header without the
+	// special rule applied.
+	blocksPerRetarget := int32(params.TargetTimespan / params.TargetTimePerBlock)
+	iter := startHeader
+	for iter != nil && iter.Height()%blocksPerRetarget != 0 &&
+		iter.Bits() == params.PowLimitBits {
+
+		iter = iter.Parent()
+	}
+
+	// Return the found difficulty or the minimum difficulty if no
+	// appropriate header was found.
+	lastBits := params.PowLimitBits
+	if iter != nil {
+		lastBits = iter.Bits()
+	}
+	return lastBits
+}
+
+// CalcNextRequiredBits calculates the required difficulty bits for the header
+// after the passed last header based on the difficulty retarget rules of the
+// passed network.  The last header must be nil for the genesis header.
+//
+// It is the same calculation the block chain performs, so light clients can
+// use it to verify the difficulty of headers.
+func CalcNextRequiredBits(lastHeader HeaderCtx, newBlockTime time.Time, params *chaincfg.Params) (uint32, error) {
+	// Genesis block.
+	if lastHeader == nil {
+		return params.PowLimitBits, nil
+	}
+
+	// Return the previous header's difficulty requirements if this header
+	// is not at a difficulty retarget interval.
+	blocksPerRetarget := int32(params.TargetTimespan / params.TargetTimePerBlock)
+	if (lastHeader.Height()+1)%blocksPerRetarget != 0 {
+		// For networks that support it, allow special reduction of the
+		// required difficulty once too much time has elapsed without
+		// mining a block.
+		if params.ReduceMinDifficulty {
+			// Return minimum difficulty when more than the desired
+			// amount of time has elapsed without mining a block.
+			reductionTime := int64(params.MinDiffReductionTime /
+				time.Second)
+			allowMinTime := lastHeader.Timestamp() + reductionTime
+			if newBlockTime.Unix() > allowMinTime {
+				return params.PowLimitBits, nil
+			}
+
+			// The block was mined within the desired timeframe, so
+			// return the difficulty for the last header which did
+			// not have the special minimum difficulty rule applied.
+			return findPrevTestNetDifficulty(lastHeader, params), nil
+		}
+
+		// For the main network (or any unrecognized networks), simply
+		// return the previous header's difficulty requirements.
+		return lastHeader.Bits(), nil
+	}
+
+	// Get the header at the previous retarget (targetTimespan days worth
+	// of blocks).
+	firstHeader := lastHeader.RelativeAncestorCtx(blocksPerRetarget - 1)
+	if firstHeader == nil {
+		return 0, AssertError("unable to obtain previous retarget block")
+	}
+
+	// Limit the amount of adjustment that can occur to the previous
+	// difficulty.
+	targetTimespan := int64(params.TargetTimespan / time.Second)
+	minRetargetTimespan := targetTimespan / params.RetargetAdjustmentFactor
+	maxRetargetTimespan := targetTimespan * params.RetargetAdjustmentFactor
+	actualTimespan := lastHeader.Timestamp() - firstHeader.Timestamp()
+	adjustedTimespan := actualTimespan
+	if actualTimespan < minRetargetTimespan {
+		adjustedTimespan = minRetargetTimespan
+	} else if actualTimespan > maxRetargetTimespan {
+		adjustedTimespan = maxRetargetTimespan
+	}
+
+	// Calculate new target difficulty as:
+	//  currentDifficulty * (adjustedTimespan / targetTimespan)
+	// The result uses integer division which means it will be slightly
+	// rounded down.  Bitcoind also uses integer division to calculate this
+	// result.
+	oldTarget := CompactToBig(lastHeader.Bits())
+	newTarget := new(big.Int).Mul(oldTarget, big.NewInt(adjustedTimespan))
+	newTarget.Div(newTarget, big.NewInt(targetTimespan))
+
+	// Limit new value to the proof of work limit.
+	if newTarget.Cmp(params.PowLimit) > 0 {
+		newTarget.Set(params.PowLimit)
+	}
+
+	// Log new target difficulty and return it.  The new target logging is
+	// intentionally converting the bits back to a number instead of using
+	// newTarget since conversion to the compact representation loses
+	// precision.
+	newTargetBits := BigToCompact(newTarget)
+	log.Debugf("Difficulty retarget at block height %d", lastHeader.Height()+1)
+	log.Debugf("Old target %08x (%064x)", lastHeader.Bits(), oldTarget)
+	log.Debugf("New target %08x (%064x)", newTargetBits, CompactToBig(newTargetBits))
+	log.Debugf("Actual timespan %v, adjusted timespan %v, target timespan %v",
+		time.Duration(actualTimespan)*time.Second,
+		time.Duration(adjustedTimespan)*time.Second,
+		params.TargetTimespan)
+
+	return newTargetBits, nil
+}
+
+// checkHeaderTime ensures the difficulty bits of the passed header match the
+// difficulty retarget rules and its timestamp is after the median time of the
+// headers before it.
+func checkHeaderTime(header *wire.BlockHeader, prevHeader HeaderCtx, params *chaincfg.Params) error {
+	// Ensure the difficulty specified in the block header matches the
+	// calculated difficulty based on the previous header and difficulty
+	// retarget rules.
+	expectedDifficulty, err := CalcNextRequiredBits(prevHeader,
+		header.Timestamp, params)
+	if err != nil {
+		return err
+	}
+	blockDifficulty := header.Bits
+	if blockDifficulty != expectedDifficulty {
+		str := "block difficulty of %d is not the expected value of %d"
+		str = fmt.Sprintf(str, blockDifficulty, expectedDifficulty)
+		return ruleError(ErrUnexpectedDifficulty, str)
+	}
+
+	// Ensure the timestamp for the block header is after the median time
+	// of the last several blocks (medianTimeBlocks).
+	medianTime := CalcPastMedianTime(prevHeader)
+	if !header.Timestamp.After(medianTime) {
+		str := "block timestamp of %v is not after expected %v"
+		str = fmt.Sprintf(str, header.Timestamp, medianTime)
+		return ruleError(ErrTimeTooOld, str)
+	}
+	return nil
+}
+
+// checkHeaderVersion rejects outdated block versions at the passed height once
+// a majority of the network has upgraded.  These were originally voted on by
+// BIP0034, BIP0065, and BIP0066.
+func checkHeaderVersion(header *wire.BlockHeader, blockHeight int32, params *chaincfg.Params) error {
+	if header.Version < 2 && blockHeight >= params.BIP0034Height ||
+		header.Version < 3 && blockHeight >= params.BIP0066Height ||
+		header.Version < 4 && blockHeight >= params.BIP0065Height {
+
+		str := "new blocks with version %d are no longer valid"
+		str = fmt.Sprintf(str, header.Version)
+		return ruleError(ErrBlockVersionTooOld, str)
+	}
+	return nil
+}
+
+// CheckBlockHeaderContext performs the checks of the passed header which depend
+// on the passed previous header and network, which must not be nil, without a
+// block chain: the difficulty retarget rules, the median time past and the
+// block version rules.  Along with CheckBlockHeaderSanity, it allows light
+// clients to verify headers with the same consensus code as the block chain.
+//
+// Checkpoints are not verified since they depend on the chain the headers are
+// verified against.  The difficulty and median time are not checked either when
+// the BFFastAdd flag is set.
+func CheckBlockHeaderContext(header *wire.BlockHeader, prevHeader HeaderCtx, params *chaincfg.Params, flags BehaviorFlags) error {
+	if flags&BFFastAdd != BFFastAdd {
+		if err := checkHeaderTime(header, prevHeader, params); err != nil {
+			return err
+		}
+	}
+	return checkHeaderVersion(header, prevHeader.Height()+1, params)
+}
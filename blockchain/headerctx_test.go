@@ -0,0 +1,134 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestCheckBlockHeaderContext ensures headers are verified against a chain of
+// header nodes without a block chain.
+func TestCheckBlockHeaderContext(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	params := &chaincfg.MainNetParams
+	tip := NewHeaderNode(&blocks[0].MsgBlock().Header, nil)
+	for i := 1; i < len(blocks); i++ {
+		header := blocks[i].MsgBlock().Header
+		err := CheckBlockHeaderContext(&header, tip, params, BFNone)
+		if err != nil {
+			t.Fatalf("header %d rejected: %v", i, err)
+		}
+		tip = NewHeaderNode(&header, tip)
+	}
+	if tip.Height() != int32(len(blocks)-1) {
+		t.Fatalf("tip height is %d, want %d", tip.Height(), len(blocks)-1)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(header *wire.BlockHeader)
+		flags   BehaviorFlags
+		wantErr ErrorCode
+	}{{
+		name: "unexpected difficulty",
+		modify: func(header *wire.BlockHeader) {
+			header.Bits--
+		},
+		wantErr: ErrUnexpectedDifficulty,
+	}, {
+		name: "timestamp not after median time",
+		modify: func(header *wire.BlockHeader) {
+			header.Timestamp = CalcPastMedianTime(tip)
+		},
+		wantErr: ErrTimeTooOld,
+	}, {
+		name: "fast add skips difficulty",
+		modify: func(header *wire.BlockHeader) {
+			header.Bits--
+		},
+		flags:   BFFastAdd,
+		wantErr: -1,
+	}}
+	for _, test := range tests {
+		header := wire.BlockHeader{
+			Version:   1,
+			PrevBlock: tip.header.BlockHash(),
+			Timestamp: time.Unix(tip.Timestamp()+600, 0),
+			Bits:      tip.Bits(),
+		}
+		test.modify(&header)
+		err := CheckBlockHeaderContext(&header, tip, params, test.flags)
+		if test.wantErr == -1 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", test.name, err,
+				test.wantErr)
+		}
+	}
+}
+
+// TestCalcNextRequiredBits ensures the difficulty retarget calculated for a
+// chain of header nodes matches the one for the equivalent block nodes.
+func TestCalcNextRequiredBits(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	blocksPerRetarget := int(params.TargetTimespan / params.TargetTimePerBlock)
+
+	// Create a retarget interval of blocks found twice as fast as desired.
+	bits := uint32(0x1b0404cb)
+	start := time.Unix(1500000000, 0)
+	var headerTip *HeaderNode
+	var nodeTip *blockNode
+	for i := 0; i < blocksPerRetarget; i++ {
+		header := wire.BlockHeader{
+			Version:   4,
+			Timestamp: start.Add(time.Duration(i) * params.TargetTimePerBlock / 2),
+			Bits:      bits,
+		}
+		headerTip = NewHeaderNode(&header, headerTip)
+		nodeTip = newBlockNode(&header, nodeTip)
+	}
+
+	newBlockTime := headerTip.header.Timestamp.Add(params.TargetTimePerBlock)
+	got, err := CalcNextRequiredBits(headerTip, newBlockTime, params)
+	if err != nil {
+		t.Fatalf("CalcNextRequiredBits: %v", err)
+	}
+	want, err := CalcNextRequiredBits(nodeTip, newBlockTime, params)
+	if err != nil {
+		t.Fatalf("CalcNextRequiredBits: %v", err)
+	}
+	if got != want {
+		t.Fatalf("header nodes retarget to %08x, block nodes to %08x",
+			got, want)
+	}
+	if CompactToBig(got).Cmp(CompactToBig(bits)) >= 0 {
+		t.Fatalf("retarget to %08x did not increase the difficulty of "+
+			"%08x", got, bits)
+	}
+
+	// Headers which are not at a retarget interval keep the difficulty.
+	got, err = CalcNextRequiredBits(headerTip.parent, newBlockTime, params)
+	if err != nil {
+		t.Fatalf("CalcNextRequiredBits: %v", err)
+	}
+	if got != bits {
+		t.Fatalf("difficulty changed to %08x outside of a retarget", got)
+	}
+	if CalcPastMedianTime(headerTip) != nodeTip.CalcPastMedianTime() {
+		t.Fatal("median time of header and block nodes differs")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// headerIndex is a dedicated index of the headers of the main chain which is
+// guarded by its own lock rather than the chain lock.  It is used to serve
+// getheaders requests, so the many peers syncing headers don't contend with
+// block validation, which holds the chain lock for a long time, nor with the
+// lookups of the block index.
+//
+// The main chain block nodes are kept by height along with a map of the first
+// eight bytes of their hashes to their heights.  The prefixes are used instead
+// of the full hashes to keep the memory footprint of the map small, and the
+// full hash of the node found via a prefix is always compared, so a colliding
+// prefix is treated like an unknown hash.
+type headerIndex struct {
+	mtx     sync.RWMutex
+	nodes   []*blockNode
+	heights map[uint64]int32
+}
+
+// newHeaderIndex returns a new empty header index.  The tip is set via setTip.
+func newHeaderIndex() *headerIndex {
+	return &headerIndex{heights: make(map[uint64]int32)}
+}
+
+// hashPrefix returns the key of the passed hash in the map of heights.
+func hashPrefix(hash *chainhash.Hash) uint64 {
+	return binary.LittleEndian.Uint64(hash[:8])
+}
+
+// setTip updates the header index to the main chain ending with the passed
+// block node.  Like chainView.setTip, only the nodes which differ from the
+// current main chain are replaced, so following the tip is efficient.
+//
+// This function is safe for concurrent access.
+func (hi *headerIndex) setTip(node *blockNode) {
+	hi.mtx.Lock()
+	defer hi.mtx.Unlock()
+
+	// Remove the nodes beyond the new tip.
+	needed := int32(0)
+	if node != nil {
+		needed = node.height + 1
+	}
+	for i := needed; i < int32(len(hi.nodes)); i++ {
+		hi.removeNode(hi.nodes[i])
+		hi.nodes[i] = nil
+	}
+	if int32(cap(hi.nodes)) < needed {
+		nodes := make([]*blockNode, len(hi.nodes), needed+approxNodesPerWeek)
+		copy(nodes, hi.nodes)
+		hi.nodes = nodes
+	}
+	hi.nodes = hi.nodes[:needed]
+
+	// Replace the nodes which differ from the new main chain.
+	for node != nil && hi.nodes[node.height] != node {
+		if old := hi.nodes[node.height]; old != nil {
+			hi.removeNode(old)
+		}
+		hi.nodes[node.height] = node
+		hi.heights[hashPrefix(&node.hash)] = node.height
+		node = node.parent
+	}
+}
+
+// removeNode removes the passed node from the map of heights unless the entry
+// for its hash prefix belongs to another node.
+//
+// This function MUST be called with the header index lock held (for writes).
+func (hi *headerIndex) removeNode(node *blockNode) {
+	key := hashPrefix(&node.hash)
+	if height, ok := hi.heights[key]; ok && height == node.height {
+		delete(hi.heights, key)
+	}
+}
+
+// lookup returns the main chain node with the passed hash or nil when the
+// hash is not part of the main chain.
+//
+// This function MUST be called with the header index lock held (for reads).
+func (hi *headerIndex) lookup(hash *chainhash.Hash) *blockNode {
+	height, ok := hi.heights[hashPrefix(hash)]
+	if !ok || height >= int32(len(hi.nodes)) {
+		return nil
+	}
+	node := hi.nodes[height]
+	if node == nil || node.hash != *hash {
+		return nil
+	}
+	return node
+}
+
+// locate appends the headers of the main chain blocks after the first known
+// block in the locator until the provided stop hash is reached, or up to the
+// provided max number of headers, to the passed buffer and returns it.  Unlike
+// BlockChain.locateInventory, the locator must not be empty, since requests for
+// the header of a specific block may refer to blocks which are not part of the
+// main chain.
+//
+// This function is safe for concurrent access.
+func (hi *headerIndex) locate(locator BlockLocator, hashStop *chainhash.Hash,
+	maxHeaders uint32, buf []wire.BlockHeader) []wire.BlockHeader {
+
+	hi.mtx.RLock()
+	defer hi.mtx.RUnlock()
+
+	if len(hi.nodes) == 0 {
+		return buf
+	}
+
+	// Find the most recent locator block hash in the main chain.  In the
+	// case none of the hashes in the locator are in the main chain, fall
+	// back to the genesis block.
+	startHeight := int32(0)
+	for _, hash := range locator {
+		if node := hi.lookup(hash); node != nil {
+			startHeight = node.height
+			break
+		}
+	}
+
+	// Start at the block after the most recently known block.  When there
+	// is no next block it means the most recently known block is the tip of
+	// the main chain, so there is nothing more to do.
+	startHeight++
+	tipHeight := int32(len(hi.nodes)) - 1
+	if startHeight > tipHeight {
+		return buf
+	}
+
+	// Calculate how many headers are needed.
+	total := uint32(tipHeight - startHeight + 1)
+	if stopNode := hi.lookup(hashStop); stopNode != nil &&
+		stopNode.height >= startHeight {
+
+		total = uint32(stopNode.height - startHeight + 1)
+	}
+	if total > maxHeaders {
+		total = maxHeaders
+	}
+
+	// Grow the buffer at once when it is unable to hold the headers.
+	if cap(buf)-len(buf) < int(total) {
+		grown := make([]wire.BlockHeader, len(buf), len(buf)+int(total))
+		copy(grown, buf)
+		buf = grown
+	}
+
+	for _, node := range hi.nodes[startHeight : startHeight+int32(total)] {
+		buf = append(buf, node.Header())
+	}
+	return buf
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestHeaderIndex ensures the header index follows the tip of the main chain
+// across reorganizations and locates the same headers as the chain view.
+func TestHeaderIndex(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> ... -> 15 -> 16  -> 17  -> 18
+	// 	                              \-> 16a -> 17a -> 18a -> 19a
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedNodes(chain.bestChain.Genesis(), 18)
+	branch1Nodes := chainedNodes(branch0Nodes[14], 4)
+	for _, node := range branch0Nodes {
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.AddNode(node)
+	}
+
+	hi := newHeaderIndex()
+	assertTip := func(tip *blockNode, known, unknown []*blockNode) {
+		t.Helper()
+
+		chain.bestChain.SetTip(tip)
+		hi.setTip(tip)
+		for _, node := range known {
+			if hi.lookup(&node.hash) != node {
+				t.Fatalf("node %v is not in the header index", node)
+			}
+		}
+		for _, node := range unknown {
+			if hi.lookup(&node.hash) != nil {
+				t.Fatalf("node %v is in the header index", node)
+			}
+		}
+		if len(hi.heights) != len(hi.nodes) {
+			t.Fatalf("header index has %d heights for %d nodes",
+				len(hi.heights), len(hi.nodes))
+		}
+
+		// The located headers must match the ones located via the
+		// chain view for a variety of locators.
+		locators := []BlockLocator{
+			locatorHashes(branch0Nodes, 10),
+			locatorHashes(branch0Nodes, 17),
+			locatorHashes(branch1Nodes, 3, 1),
+			zipLocators(locatorHashes(branch1Nodes, 2),
+				locatorHashes(branch0Nodes, 12)),
+			{&chainhash.Hash{0x01}},
+		}
+		stops := []*chainhash.Hash{
+			{},
+			&branch0Nodes[16].hash,
+			&branch1Nodes[2].hash,
+			&branch0Nodes[2].hash,
+		}
+		for _, locator := range locators {
+			for _, stop := range stops {
+				for _, max := range []uint32{3, 100} {
+					want := chain.locateHeaders(locator, stop, max)
+					got := hi.locate(locator, stop, max, nil)
+					if !reflect.DeepEqual(got, want) {
+						t.Fatalf("located %d headers, want %d",
+							len(got), len(want))
+					}
+				}
+			}
+		}
+	}
+
+	assertTip(tstTip(branch0Nodes), branch0Nodes, branch1Nodes)
+	assertTip(tstTip(branch1Nodes), branch1Nodes, branch0Nodes[15:])
+	assertTip(branch0Nodes[10], branch0Nodes[:11], branch0Nodes[11:])
+	assertTip(tstTip(branch0Nodes), branch0Nodes, branch1Nodes)
+
+	// Located headers are appended to the passed buffer.
+	buf := make([]wire.BlockHeader, 1, wire.MaxBlockHeadersPerMsg)
+	buf = hi.locate(locatorHashes(branch0Nodes, 15), &chainhash.Hash{},
+		wire.MaxBlockHeadersPerMsg, buf)
+	if len(buf) != 3 || buf[1] != branch0Nodes[16].Header() {
+		t.Fatalf("unexpected located headers %v", buf)
+	}
+
+	hi.setTip(nil)
+	if len(hi.nodes) != 0 || len(hi.heights) != 0 {
+		t.Fatalf("header index is not empty without a tip")
+	}
+}
+
+// benchmarkLocateHeaders benchmarks locating headers for many simultaneous
+// syncing peers while blocks are validated, which is simulated by holding the
+// chain lock for a millisecond at a time.
+func benchmarkLocateHeaders(b *testing.B, locate func(*BlockChain,
+	BlockLocator, []wire.BlockHeader) []wire.BlockHeader) {
+
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	nodes := chainedNodes(chain.bestChain.Genesis(), 20000)
+	for _, node := range nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(tstTip(nodes))
+	chain.headerIndex.setTip(tstTip(nodes))
+	locator := chain.bestChain.BlockLocator(nodes[10000])
+
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+			}
+			chain.chainLock.Lock()
+			time.Sleep(time.Millisecond)
+			chain.chainLock.Unlock()
+		}
+	}()
+
+	b.ReportAllocs()
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		buf := make([]wire.BlockHeader, 0, wire.MaxBlockHeadersPerMsg)
+		for pb.Next() {
+			buf = locate(chain, locator, buf[:0])
+			if len(buf) != wire.MaxBlockHeadersPerMsg {
+				b.Fatalf("located %d headers", len(buf))
+			}
+		}
+	})
+	b.StopTimer()
+	close(quit)
+	<-done
+}
+
+// BenchmarkLocateHeadersChainLock benchmarks locating headers via the chain
+// view, which requires the chain lock.
+func BenchmarkLocateHeadersChainLock(b *testing.B) {
+	benchmarkLocateHeaders(b, func(chain *BlockChain, locator BlockLocator,
+		_ []wire.BlockHeader) []wire.BlockHeader {
+
+		chain.chainLock.RLock()
+		headers := chain.locateHeaders(locator, &chainhash.Hash{},
+			wire.MaxBlockHeadersPerMsg)
+		chain.chainLock.RUnlock()
+		return headers
+	})
+}
+
+// BenchmarkLocateHeadersIndex benchmarks locating headers via the header index
+// into preallocated buffers.
+func BenchmarkLocateHeadersIndex(b *testing.B) {
+	benchmarkLocateHeaders(b, func(chain *BlockChain, locator BlockLocator,
+		buf []wire.BlockHeader) []wire.BlockHeader {
+
+		return chain.LocateHeadersInto(locator, &chainhash.Hash{}, buf)
+	})
+}
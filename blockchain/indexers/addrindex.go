@@ -66,6 +66,17 @@ const (
 	// Size of a transaction entry.  It consists of 4 bytes block id + 4
 	// bytes offset + 4 bytes length.
 	txEntrySize = 4 + 4 + 4
+
+	// txEntryReceivedFlag and txEntrySpentFlag are stored in the two most
+	// significant bits of the tx length of a transaction entry to record
+	// whether the transaction pays to or spends from the address.  They
+	// are free to use since transactions are much smaller than 1 GiB.
+	txEntryReceivedFlag = 1 << 31
+	txEntrySpentFlag    = 1 << 30
+
+	// txEntryLenMask extracts the tx length from the tx length field of a
+	// transaction entry.
+	txEntryLenMask = txEntrySpentFlag - 1
 )
 
 var (
@@ -134,28 +145,50 @@ var (
 //   tx length       uint32    4 bytes
 //   -----
 //   Total: 12 bytes per indexed tx
+//
+// The most significant bit of the tx length is set when the transaction creates
+// an output paying to the address and the next bit is set when it spends an
+// output which paid to it.  Entries written by versions which did not record
+// the direction have neither bit set.
 // -----------------------------------------------------------------------------
 
+// AddrIndexEntry describes a confirmed transaction which involves an address.
+type AddrIndexEntry struct {
+	// Region identifies the transaction within its block.  Its hash is the
+	// hash of the block, which determines the confirmations of the
+	// transaction.
+	Region database.BlockRegion
+
+	// Received is set when the transaction creates an output paying to the
+	// address.
+	Received bool
+
+	// Spent is set when the transaction spends an output which paid to the
+	// address.
+	Spent bool
+}
+
 // fetchBlockHashFunc defines a callback function to use in order to convert a
 // serialized block ID to an associated block hash.
 type fetchBlockHashFunc func(serializedID []byte) (*chainhash.Hash, error)
 
-// serializeAddrIndexEntry serializes the provided block id and transaction
-// location according to the format described in detail above.
-func serializeAddrIndexEntry(blockID uint32, txLoc wire.TxLoc) []byte {
+// serializeAddrIndexEntry serializes the provided block id, transaction
+// location and direction flags according to the format described in detail
+// above.
+func serializeAddrIndexEntry(blockID uint32, txLoc wire.TxLoc, flags uint32) []byte {
 	// Serialize the entry.
 	serialized := make([]byte, 12)
 	byteOrder.PutUint32(serialized, blockID)
 	byteOrder.PutUint32(serialized[4:], uint32(txLoc.TxStart))
-	byteOrder.PutUint32(serialized[8:], uint32(txLoc.TxLen))
+	byteOrder.PutUint32(serialized[8:], uint32(txLoc.TxLen)|flags)
 	return serialized
 }
 
 // deserializeAddrIndexEntry decodes the passed serialized byte slice into the
-// provided region struct according to the format described in detail above and
+// provided entry struct according to the format described in detail above and
 // uses the passed block hash fetching function in order to conver the block ID
 // to the associated block hash.
-func deserializeAddrIndexEntry(serialized []byte, region *database.BlockRegion, fetchBlockHash fetchBlockHashFunc) error {
+func deserializeAddrIndexEntry(serialized []byte, entry *AddrIndexEntry, fetchBlockHash fetchBlockHashFunc) error {
 	// Ensure there are enough bytes to decode.
 	if len(serialized) < txEntrySize {
 		return errDeserialize("unexpected end of data")
@@ -165,9 +198,12 @@ func deserializeAddrIndexEntry(serialized []byte, region *database.BlockRegion,
 	if err != nil {
 		return err
 	}
-	region.Hash = hash
-	region.Offset = byteOrder.Uint32(serialized[4:8])
-	region.Len = byteOrder.Uint32(serialized[8:12])
+	txLen := byteOrder.Uint32(serialized[8:12])
+	entry.Region.Hash = hash
+	entry.Region.Offset = byteOrder.Uint32(serialized[4:8])
+	entry.Region.Len = txLen & txEntryLenMask
+	entry.Received = txLen&txEntryReceivedFlag != 0
+	entry.Spent = txLen&txEntrySpentFlag != 0
 	return nil
 }
 
@@ -182,14 +218,14 @@ func keyForLevel(addrKey [addrKeySize]byte, level uint8) [levelKeySize]byte {
 
 // dbPutAddrIndexEntry updates the address index to include the provided entry
 // according to the level-based scheme described in detail above.
-func dbPutAddrIndexEntry(bucket internalBucket, addrKey [addrKeySize]byte, blockID uint32, txLoc wire.TxLoc) error {
+func dbPutAddrIndexEntry(bucket internalBucket, addrKey [addrKeySize]byte, blockID uint32, txLoc wire.TxLoc, flags uint32) error {
 	// Start with level 0 and its initial max number of entries.
 	curLevel := uint8(0)
 	maxLevelBytes := level0MaxEntries * txEntrySize
 
 	// Simply append the new entry to level 0 and return now when it will
 	// fit.  This is the most common path.
-	newData := serializeAddrIndexEntry(blockID, txLoc)
+	newData := serializeAddrIndexEntry(blockID, txLoc, flags)
 	level0Key := keyForLevel(addrKey, 0)
 	level0Data := bucket.Get(level0Key[:])
 	if len(level0Data)+len(newData) <= maxLevelBytes {
@@ -249,11 +285,11 @@ func dbPutAddrIndexEntry(bucket internalBucket, addrKey [addrKeySize]byte, block
 	return bucket.Put(level0Key[:], newData)
 }
 
-// dbFetchAddrIndexEntries returns block regions for transactions referenced by
-// the given address key and the number of entries skipped since it could have
-// been less in the case where there are less total entries than the requested
-// number of entries to skip.
-func dbFetchAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool, fetchBlockHash fetchBlockHashFunc) ([]database.BlockRegion, uint32, error) {
+// dbFetchAddrIndexEntries returns the entries for transactions referenced by the
+// given address key and the number of entries skipped since it could have been
+// less in the case where there are less total entries than the requested number
+// of entries to skip.
+func dbFetchAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool, fetchBlockHash fetchBlockHashFunc) ([]AddrIndexEntry, uint32, error) {
 	// When the reverse flag is not set, all levels need to be fetched
 	// because numToSkip and numRequested are counted from the oldest
 	// transactions (highest level) and thus the total count is needed.
@@ -299,7 +335,7 @@ func dbFetchAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, n
 
 	// Start the offset after all skipped entries and load the calculated
 	// number.
-	results := make([]database.BlockRegion, numToLoad)
+	results := make([]AddrIndexEntry, numToLoad)
 	for i := uint32(0); i < numToLoad; i++ {
 		// Calculate the read offset according to the reverse flag.
 		var offset uint32
@@ -650,16 +686,23 @@ func (idx *AddrIndex) Create(dbTx database.Tx) error {
 	return err
 }
 
+// indexedTx identifies a transaction of a block which involves an address along
+// with the direction flags of the involvement.
+type indexedTx struct {
+	txIdx int
+	flags uint32
+}
+
 // writeIndexData represents the address index data to be written for one block.
 // It consists of the address mapped to an ordered list of the transactions
 // that involve the address in block.  It is ordered so the transactions can be
 // stored in the order they appear in the block.
-type writeIndexData map[[addrKeySize]byte][]int
+type writeIndexData map[[addrKeySize]byte][]indexedTx
 
 // indexPkScript extracts all standard addresses from the passed public key
-// script and maps each of them to the associated transaction using the passed
-// map.
-func (idx *AddrIndex) indexPkScript(data writeIndexData, pkScript []byte, txIdx int) {
+// script and maps each of them to the associated transaction along with the
+// passed direction flag using the passed map.
+func (idx *AddrIndex) indexPkScript(data writeIndexData, pkScript []byte, txIdx int, flag uint32) {
 	// Nothing to index if the script is non-standard or otherwise doesn't
 	// contain any addresses.
 	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript,
@@ -678,13 +721,15 @@ func (idx *AddrIndex) indexPkScript(data writeIndexData, pkScript []byte, txIdx
 		// Avoid inserting the transaction more than once.  Since the
 		// transactions are indexed serially any duplicates will be
 		// indexed in a row, so checking the most recent entry for the
-		// address is enough to detect duplicates.
+		// address is enough to detect duplicates.  The directions of
+		// the duplicates are merged.
 		indexedTxns := data[addrKey]
 		numTxns := len(indexedTxns)
-		if numTxns > 0 && indexedTxns[numTxns-1] == txIdx {
+		if numTxns > 0 && indexedTxns[numTxns-1].txIdx == txIdx {
+			indexedTxns[numTxns-1].flags |= flag
 			continue
 		}
-		indexedTxns = append(indexedTxns, txIdx)
+		indexedTxns = append(indexedTxns, indexedTx{txIdx, flag})
 		data[addrKey] = indexedTxns
 	}
 }
@@ -707,7 +752,8 @@ func (idx *AddrIndex) indexBlock(data writeIndexData, block *btcutil.Block,
 				// transactions spent in this block properly
 				// ordered to fetch the previous input script.
 				pkScript := stxos[stxoIndex].PkScript
-				idx.indexPkScript(data, pkScript, txIdx)
+				idx.indexPkScript(data, pkScript, txIdx,
+					txEntrySpentFlag)
 
 				// With an input indexed, we'll advance the
 				// stxo coutner.
@@ -716,7 +762,8 @@ func (idx *AddrIndex) indexBlock(data writeIndexData, block *btcutil.Block,
 		}
 
 		for _, txOut := range tx.MsgTx().TxOut {
-			idx.indexPkScript(data, txOut.PkScript, txIdx)
+			idx.indexPkScript(data, txOut.PkScript, txIdx,
+				txEntryReceivedFlag)
 		}
 	}
 }
@@ -748,10 +795,10 @@ func (idx *AddrIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
 
 	// Add all of the index entries for each address.
 	addrIdxBucket := dbTx.Metadata().Bucket(addrIndexKey)
-	for addrKey, txIdxs := range addrsToTxns {
-		for _, txIdx := range txIdxs {
+	for addrKey, txns := range addrsToTxns {
+		for _, tx := range txns {
 			err := dbPutAddrIndexEntry(addrIdxBucket, addrKey,
-				blockID, txLocs[txIdx])
+				blockID, txLocs[tx.txIdx], tx.flags)
 			if err != nil {
 				return err
 			}
@@ -775,8 +822,8 @@ func (idx *AddrIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
 
 	// Remove all of the index entries for each address.
 	bucket := dbTx.Metadata().Bucket(addrIndexKey)
-	for addrKey, txIdxs := range addrsToTxns {
-		err := dbRemoveAddrIndexEntries(bucket, addrKey, len(txIdxs))
+	for addrKey, txns := range addrsToTxns {
+		err := dbRemoveAddrIndexEntries(bucket, addrKey, len(txns))
 		if err != nil {
 			return err
 		}
@@ -797,12 +844,30 @@ func (idx *AddrIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
 //
 // This function is safe for concurrent access.
 func (idx *AddrIndex) TxRegionsForAddress(dbTx database.Tx, addr btcutil.Address, numToSkip, numRequested uint32, reverse bool) ([]database.BlockRegion, uint32, error) {
+	entries, skipped, err := idx.EntriesForAddress(addr, numToSkip,
+		numRequested, reverse)
+	if err != nil {
+		return nil, 0, err
+	}
+	regions := make([]database.BlockRegion, len(entries))
+	for i := range entries {
+		regions[i] = entries[i].Region
+	}
+	return regions, skipped, nil
+}
+
+// EntriesForAddress returns the entries of the transactions which involve the
+// passed address like TxRegionsForAddress, along with whether each transaction
+// pays to the address, spends from it or both.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddress(addr btcutil.Address, numToSkip, numRequested uint32, reverse bool) ([]AddrIndexEntry, uint32, error) {
 	addrKey, err := addrToKey(addr)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	var regions []database.BlockRegion
+	var entries []AddrIndexEntry
 	var skipped uint32
 	err = idx.db.View(func(dbTx database.Tx) error {
 		// Create closure to lookup the block hash given the ID using
@@ -814,13 +879,13 @@ func (idx *AddrIndex) TxRegionsForAddress(dbTx database.Tx, addr btcutil.Address
 
 		var err error
 		addrIdxBucket := dbTx.Metadata().Bucket(addrIndexKey)
-		regions, skipped, err = dbFetchAddrIndexEntries(addrIdxBucket,
+		entries, skipped, err = dbFetchAddrIndexEntries(addrIdxBucket,
 			addrKey, numToSkip, numRequested, reverse,
 			fetchBlockHash)
 		return err
 	})
 
-	return regions, skipped, err
+	return entries, skipped, err
 }
 
 // indexUnconfirmedAddresses modifies the unconfirmed (memory-only) address
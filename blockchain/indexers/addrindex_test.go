@@ -7,9 +7,15 @@ package indexers
 import (
 	"bytes"
 	"fmt"
+	"reflect"
 	"testing"
 
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
 )
 
 // addrIndexBucket provides a mock address index database bucket by implementing
@@ -222,7 +228,7 @@ nextTest:
 		for i := 0; i < test.numInsert; i++ {
 			txLoc := wire.TxLoc{TxStart: i * 2}
 			err := dbPutAddrIndexEntry(populatedBucket, test.key,
-				uint32(i), txLoc)
+				uint32(i), txLoc, txEntryReceivedFlag)
 			if err != nil {
 				t.Errorf("dbPutAddrIndexEntry #%d (%s) - "+
 					"unexpected error: %v", testNum,
@@ -274,3 +280,91 @@ nextTest:
 		}
 	}
 }
+
+// TestAddrIndexDirections ensures the address index records whether the
+// transactions pay to an address, spend from it or both.
+func TestAddrIndexDirections(t *testing.T) {
+	addr, err := btcutil.NewAddressPubKeyHash(make([]byte, 20),
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressPubKeyHash: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: %v", err)
+	}
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		t.Fatalf("addrToKey: %v", err)
+	}
+
+	// Create a block whose coinbase pays to the address, whose second
+	// transaction spends from and pays back to it and whose third
+	// transaction only spends from it.
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{})
+	coinbase.AddTxOut(wire.NewTxOut(5000, pkScript))
+	change := wire.NewMsgTx(wire.TxVersion)
+	change.AddTxIn(&wire.TxIn{})
+	change.AddTxOut(wire.NewTxOut(4000, pkScript))
+	spend := wire.NewMsgTx(wire.TxVersion)
+	spend.AddTxIn(&wire.TxIn{})
+	spend.AddTxOut(wire.NewTxOut(3000, []byte{txscript.OP_TRUE}))
+	block := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase, change, spend},
+	})
+	stxos := []blockchain.SpentTxOut{
+		{Amount: 5000, PkScript: pkScript},
+		{Amount: 4000, PkScript: pkScript},
+	}
+
+	idx := NewAddrIndex(nil, &chaincfg.MainNetParams)
+	data := make(writeIndexData)
+	idx.indexBlock(data, block, stxos)
+	want := []indexedTx{
+		{0, txEntryReceivedFlag},
+		{1, txEntryReceivedFlag | txEntrySpentFlag},
+		{2, txEntrySpentFlag},
+	}
+	if got := data[addrKey]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("indexed transactions %v, want %v", got, want)
+	}
+
+	// Ensure the directions survive a round trip through the index while
+	// the transaction lengths are unaffected.
+	bucket := &addrIndexBucket{levels: make(map[[levelKeySize]byte][]byte)}
+	for i, tx := range want {
+		txLoc := wire.TxLoc{TxStart: i * 100, TxLen: 100 + i}
+		err := dbPutAddrIndexEntry(bucket, addrKey, 7, txLoc, tx.flags)
+		if err != nil {
+			t.Fatalf("dbPutAddrIndexEntry: %v", err)
+		}
+	}
+	blockHash := chainhash.Hash{0x01}
+	fetchBlockHash := func([]byte) (*chainhash.Hash, error) {
+		return &blockHash, nil
+	}
+	entries, _, err := dbFetchAddrIndexEntries(bucket, addrKey, 0, 10,
+		false, fetchBlockHash)
+	if err != nil {
+		t.Fatalf("dbFetchAddrIndexEntries: %v", err)
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("fetched %d entries, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if entry.Region.Len != uint32(100+i) ||
+			entry.Region.Offset != uint32(i*100) ||
+			*entry.Region.Hash != blockHash {
+
+			t.Fatalf("entry %d has region %+v", i, entry.Region)
+		}
+		wantReceived := want[i].flags&txEntryReceivedFlag != 0
+		wantSpent := want[i].flags&txEntrySpentFlag != 0
+		if entry.Received != wantReceived || entry.Spent != wantSpent {
+			t.Fatalf("entry %d received %v spent %v, want %v %v", i,
+				entry.Received, entry.Spent, wantReceived,
+				wantSpent)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"sync"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// backfillBatchSize is the maximum number of blocks whose index
+	// entries are committed in a single database transaction while
+	// catching up the indexes.
+	backfillBatchSize = 50
+
+	// backfillBlocksPerWorker is the number of blocks each backfill worker
+	// may load ahead of the block being committed.  It bounds the memory
+	// used by blocks which are waiting on the commit of earlier ones.
+	backfillBlocksPerWorker = 4
+)
+
+// blockPreparer is implemented by indexes which do expensive computation for a
+// block that does not depend on the state of the database, such as building a
+// filter.  The manager invokes prepareBlock concurrently for multiple blocks
+// while catching up the indexes and passes the result to connectPreparedBlock,
+// which is invoked in block order, instead of calling ConnectBlock.
+type blockPreparer interface {
+	prepareBlock(block *btcutil.Block, stxos []blockchain.SpentTxOut) (interface{}, error)
+	connectPreparedBlock(dbTx database.Tx, block *btcutil.Block,
+		stxos []blockchain.SpentTxOut, prepared interface{}) error
+}
+
+// backfillFetcher loads the main chain block at the passed height along with
+// its spent outputs when needInputs is set.
+type backfillFetcher func(height int32, needInputs bool) (*btcutil.Block,
+	[]blockchain.SpentTxOut, error)
+
+// chainBackfillFetcher returns a backfillFetcher which loads the blocks and
+// spent outputs from the passed chain.
+func chainBackfillFetcher(chain *blockchain.BlockChain) backfillFetcher {
+	return func(height int32, needInputs bool) (*btcutil.Block,
+		[]blockchain.SpentTxOut, error) {
+
+		block, err := chain.BlockByHeight(height)
+		if err != nil || !needInputs {
+			return block, nil, err
+		}
+		stxos, err := chain.FetchSpendJournal(block)
+		return block, stxos, err
+	}
+}
+
+// backfillBlock houses a block loaded by a backfill worker along with its spent
+// outputs and the results of the indexes which prepare blocks.
+type backfillBlock struct {
+	height   int32
+	block    *btcutil.Block
+	stxos    []blockchain.SpentTxOut
+	prepared []interface{}
+	err      error
+}
+
+// backfillIndexes catches up the enabled indexes, whose tips are at the passed
+// heights, through the passed end height.
+//
+// The blocks are loaded and prepared by a pool of workers, while the index
+// entries are committed in block order in batches of up to backfillBatchSize
+// blocks.  The tip of each index is updated along with its entries, so an
+// interrupted backfill resumes after the last committed block.
+func (m *Manager) backfillIndexes(fetch backfillFetcher, indexerHeights []int32,
+	end int32, interrupt <-chan struct{}) error {
+
+	// Determine the first block any index needs.  An index needs a block
+	// when its tip is below the height of the block.
+	start := end + 1
+	for _, height := range indexerHeights {
+		if height+1 < start {
+			start = height + 1
+		}
+	}
+	if start > end {
+		return nil
+	}
+	needsBlock := func(i int, height int32) bool {
+		return indexerHeights[i] < height
+	}
+
+	numWorkers := m.backfillWorkers
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	quit := make(chan struct{})
+	results := make(chan chan *backfillBlock, numWorkers*backfillBlocksPerWorker)
+	var wg sync.WaitGroup
+	defer func() {
+		close(quit)
+		wg.Wait()
+	}()
+
+	// Dispatch the heights to the workers and queue a result channel for
+	// each of them in block order for the commit loop below.
+	type backfillJob struct {
+		height int32
+		result chan *backfillBlock
+	}
+	work := make(chan backfillJob)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(work)
+		defer close(results)
+		for height := start; height <= end; height++ {
+			job := backfillJob{height, make(chan *backfillBlock, 1)}
+			select {
+			case results <- job.result:
+			case <-quit:
+				return
+			}
+			select {
+			case work <- job:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range work {
+				job.result <- m.loadBackfillBlock(fetch, job.height,
+					needsBlock)
+			}
+		}()
+	}
+
+	progressLogger := newBlockProgressLogger("Indexed", log)
+	progressLogger.targetHeight = end
+
+	// Commit the index entries in block order.
+	batch := make([]*backfillBlock, 0, backfillBatchSize)
+	for result := range results {
+		var bf *backfillBlock
+		select {
+		case bf = <-result:
+		case <-interrupt:
+			return errInterruptRequested
+		}
+		if bf.err != nil {
+			return bf.err
+		}
+
+		batch = append(batch, bf)
+		if len(batch) < backfillBatchSize && bf.height < end {
+			continue
+		}
+		err := m.db.Update(func(dbTx database.Tx) error {
+			for _, bf := range batch {
+				err := m.dbBackfillBlock(dbTx, bf, needsBlock)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, bf := range batch {
+			progressLogger.LogBlockHeight(bf.block)
+		}
+		batch = batch[:0]
+
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+	}
+
+	return nil
+}
+
+// loadBackfillBlock loads the block at the passed height and prepares it for
+// the indexes which need it.
+//
+// This function is safe for concurrent access.
+func (m *Manager) loadBackfillBlock(fetch backfillFetcher, height int32,
+	needsBlock func(int, int32) bool) *backfillBlock {
+
+	var needInputs bool
+	for i, indexer := range m.enabledIndexes {
+		if needsBlock(i, height) && indexNeedsInputs(indexer) {
+			needInputs = true
+			break
+		}
+	}
+	block, stxos, err := fetch(height, needInputs)
+	if err != nil {
+		return &backfillBlock{height: height, err: err}
+	}
+
+	bf := &backfillBlock{
+		height:   height,
+		block:    block,
+		stxos:    stxos,
+		prepared: make([]interface{}, len(m.enabledIndexes)),
+	}
+	for i, indexer := range m.enabledIndexes {
+		preparer, ok := indexer.(blockPreparer)
+		if !ok || !needsBlock(i, height) {
+			continue
+		}
+		bf.prepared[i], err = preparer.prepareBlock(block, stxos)
+		if err != nil {
+			bf.err = err
+			return bf
+		}
+	}
+	return bf
+}
+
+// dbBackfillBlock connects the passed loaded block to the indexes which need it
+// and updates their tips accordingly.
+func (m *Manager) dbBackfillBlock(dbTx database.Tx, bf *backfillBlock,
+	needsBlock func(int, int32) bool) error {
+
+	for i, indexer := range m.enabledIndexes {
+		if !needsBlock(i, bf.height) {
+			continue
+		}
+		err := dbIndexConnectPreparedBlock(dbTx, indexer, bf.block,
+			bf.stxos, bf.prepared[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
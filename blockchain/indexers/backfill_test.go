@@ -0,0 +1,216 @@
+// Copyright (c) 2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testBackfillIndex is an index which records the heights of the blocks it is
+// connected to.
+type testBackfillIndex struct {
+	key         []byte
+	needsInputs bool
+	prepare     bool
+	heights     []int32
+}
+
+func (idx *testBackfillIndex) NeedsInputs() bool             { return idx.needsInputs }
+func (idx *testBackfillIndex) Init() error                   { return nil }
+func (idx *testBackfillIndex) Key() []byte                   { return idx.key }
+func (idx *testBackfillIndex) Name() string                  { return string(idx.key) }
+func (idx *testBackfillIndex) Create(dbTx database.Tx) error { return nil }
+
+func (idx *testBackfillIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	if idx.prepare {
+		return errors.New("ConnectBlock called for a preparing index")
+	}
+	if idx.needsInputs && stxos == nil {
+		return errors.New("missing spent outputs")
+	}
+	idx.heights = append(idx.heights, block.Height())
+	return nil
+}
+
+func (idx *testBackfillIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	return nil
+}
+
+// testPreparingIndex is a testBackfillIndex which prepares the blocks.
+type testPreparingIndex struct {
+	*testBackfillIndex
+	prepared int32
+}
+
+func (idx *testPreparingIndex) prepareBlock(block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) (interface{}, error) {
+
+	atomic.AddInt32(&idx.prepared, 1)
+	return block.Height(), nil
+}
+
+func (idx *testPreparingIndex) connectPreparedBlock(dbTx database.Tx,
+	block *btcutil.Block, stxos []blockchain.SpentTxOut,
+	prepared interface{}) error {
+
+	if prepared.(int32) != block.Height() {
+		return errors.New("prepared result of another block")
+	}
+	idx.heights = append(idx.heights, block.Height())
+	return nil
+}
+
+// TestBackfillIndexes ensures the indexes are caught up in block order from
+// their tips and that an interrupted backfill resumes after the last committed
+// block.
+func TestBackfillIndexes(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "backfill")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", filepath.Join(dbPath, "db"),
+		wire.SimNet)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Create a chain of blocks.
+	const endHeight = 2*backfillBatchSize + 30
+	blocks := make([]*btcutil.Block, 0, endHeight+1)
+	var prevHash chainhash.Hash
+	for height := int32(0); height <= endHeight; height++ {
+		block := btcutil.NewBlock(wire.NewMsgBlock(&wire.BlockHeader{
+			PrevBlock: prevHash,
+			Nonce:     uint32(height),
+		}))
+		block.SetHeight(height)
+		blocks = append(blocks, block)
+		prevHash = *block.Hash()
+	}
+
+	// The plain index needs the inputs and starts from scratch, while the
+	// preparing index is already caught up through the first batch.
+	plain := &testBackfillIndex{key: []byte("plain"), needsInputs: true}
+	preparing := &testPreparingIndex{testBackfillIndex: &testBackfillIndex{
+		key: []byte("preparing"), prepare: true,
+	}}
+	m := NewManager(db, []Indexer{plain, preparing})
+	m.backfillWorkers = 4
+	err = db.Update(func(dbTx database.Tx) error {
+		_, err := dbTx.Metadata().CreateBucket(indexTipsBucketName)
+		if err != nil {
+			return err
+		}
+		err = dbPutIndexerTip(dbTx, plain.key, &chainhash.Hash{}, -1)
+		if err != nil {
+			return err
+		}
+		return dbPutIndexerTip(dbTx, preparing.key,
+			blocks[backfillBatchSize-1].Hash(), backfillBatchSize-1)
+	})
+	if err != nil {
+		t.Fatalf("unable to set index tips: %v", err)
+	}
+
+	// fetchHeights returns the heights of the index tips.
+	fetchHeights := func() []int32 {
+		t.Helper()
+		heights := make([]int32, len(m.enabledIndexes))
+		err := db.View(func(dbTx database.Tx) error {
+			for i, indexer := range m.enabledIndexes {
+				_, height, err := dbFetchIndexerTip(dbTx,
+					indexer.Key())
+				if err != nil {
+					return err
+				}
+				heights[i] = height
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to fetch index tips: %v", err)
+		}
+		return heights
+	}
+
+	// Fail the backfill while loading a block of the third batch, which
+	// leaves the index tips at the end of the second one.
+	failHeight := int32(2*backfillBatchSize + 10)
+	errFetch := errors.New("fetch failed")
+	fetch := func(height int32, needInputs bool) (*btcutil.Block,
+		[]blockchain.SpentTxOut, error) {
+
+		if height == failHeight {
+			return nil, nil, errFetch
+		}
+		if !needInputs {
+			return blocks[height], nil, nil
+		}
+		return blocks[height], []blockchain.SpentTxOut{}, nil
+	}
+	err = m.backfillIndexes(fetch, fetchHeights(), endHeight, nil)
+	if err != errFetch {
+		t.Fatalf("backfill returned %v, want %v", err, errFetch)
+	}
+	wantTip := int32(2*backfillBatchSize - 1)
+	for i, height := range fetchHeights() {
+		if height != wantTip {
+			t.Fatalf("index %d tip at height %d, want %d", i, height,
+				wantTip)
+		}
+	}
+
+	// Resume the backfill from the index tips.
+	failHeight = -1
+	if err := m.backfillIndexes(fetch, fetchHeights(), endHeight, nil); err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	for i, height := range fetchHeights() {
+		if height != endHeight {
+			t.Fatalf("index %d tip at height %d, want %d", i, height,
+				endHeight)
+		}
+	}
+
+	// Each index must have been connected to every block after its initial
+	// tip exactly once and in order.
+	checkHeights := func(idx *testBackfillIndex, start int32) {
+		t.Helper()
+		if len(idx.heights) != int(endHeight-start+1) {
+			t.Fatalf("%s connected %d blocks, want %d", idx.key,
+				len(idx.heights), endHeight-start+1)
+		}
+		for i, height := range idx.heights {
+			if height != start+int32(i) {
+				t.Fatalf("%s connected block %d at position %d",
+					idx.key, height, i)
+			}
+		}
+	}
+	checkHeights(plain, 0)
+	checkHeights(preparing.testBackfillIndex, backfillBatchSize)
+	if atomic.LoadInt32(&preparing.prepared) < int32(len(preparing.heights)) {
+		t.Fatalf("prepared %d blocks, connected %d", preparing.prepared,
+			len(preparing.heights))
+	}
+}
@@ -5,6 +5,7 @@
 package indexers
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -22,6 +23,10 @@ type blockProgressLogger struct {
 
 	subsystemLogger btclog.Logger
 	progressAction  string
+
+	// targetHeight is the height the action completes at.  It is included
+	// in the progress messages when set.
+	targetHeight int32
 	sync.Mutex
 }
 
@@ -66,9 +71,14 @@ func (b *blockProgressLogger) LogBlockHeight(block *btcutil.Block) {
 	if b.receivedLogTx == 1 {
 		txStr = "transaction"
 	}
-	b.subsystemLogger.Infof("%s %d %s in the last %s (%d %s, height %d, %s)",
+	heightStr := fmt.Sprintf("height %d", block.Height())
+	if b.targetHeight > 0 {
+		heightStr = fmt.Sprintf("height %d of %d", block.Height(),
+			b.targetHeight)
+	}
+	b.subsystemLogger.Infof("%s %d %s in the last %s (%d %s, %s, %s)",
 		b.progressAction, b.receivedLogBlocks, blockStr, tDuration, b.receivedLogTx,
-		txStr, block.Height(), block.MsgBlock().Header.Timestamp)
+		txStr, heightStr, block.MsgBlock().Header.Timestamp)
 
 	b.receivedLogBlocks = 0
 	b.receivedLogTx = 0
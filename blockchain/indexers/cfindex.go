@@ -5,7 +5,9 @@
 package indexers
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
 
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -24,7 +26,9 @@ const (
 
 // Committed filters come in one flavor currently: basic. They are generated
 // and dropped in pairs, and both are indexed by a block's hash.  Besides
-// holding different content, they also live in different buckets.
+// holding different content, they also live in different buckets.  The filter
+// headers of the main chain blocks at each checkpoint interval are additionally
+// indexed by height so cfcheckpt requests are served with a single cursor scan.
 var (
 	// cfIndexParentBucketKey is the name of the parent bucket used to
 	// house the index. The rest of the buckets live below this bucket.
@@ -48,6 +52,13 @@ var (
 		[]byte("cf0hashbyhashidx"),
 	}
 
+	// cfCheckptKeys is an array of db bucket names used to house indexes
+	// of the heights of the main chain blocks at each checkpoint interval
+	// to their block hashes and cf headers.
+	cfCheckptKeys = [][]byte{
+		[]byte("cf0checkptbyheightidx"),
+	}
+
 	maxFilterType = uint8(len(cfHeaderKeys) - 1)
 
 	// zeroHash is the chainhash.Hash value of all zero bytes, defined here
@@ -74,10 +85,30 @@ func dbDeleteFilterIdxEntry(dbTx database.Tx, key []byte, h *chainhash.Hash) err
 	return idx.Delete(h[:])
 }
 
+// cfCheckptKey returns the key of the checkpoint at the passed height in the
+// checkpoint buckets.  The height is serialized big endian so a cursor visits
+// the checkpoints in height order.
+func cfCheckptKey(height int32) []byte {
+	var key [4]byte
+	binary.BigEndian.PutUint32(key[:], uint32(height))
+	return key[:]
+}
+
+// isCfCheckptHeight returns whether the passed height is at a checkpoint
+// interval.
+func isCfCheckptHeight(height int32) bool {
+	return height > 0 && height%wire.CFCheckptInterval == 0
+}
+
 // CfIndex implements a committed filter (cf) by hash index.
 type CfIndex struct {
 	db          database.DB
 	chainParams *chaincfg.Params
+
+	// backfillCheckpts is set by Init when the checkpoint buckets were
+	// created for an existing index, so they are backfilled once the
+	// index is consistent with the main chain.
+	backfillCheckpts bool
 }
 
 // Ensure the CfIndex type implements the Indexer interface.
@@ -94,10 +125,70 @@ func (idx *CfIndex) NeedsInputs() bool {
 	return true
 }
 
-// Init initializes the hash-based cf index. This is part of the Indexer
-// interface.
+// Init initializes the hash-based cf index.  It creates the checkpoint buckets
+// for indexes which were created before the filter headers at checkpoint
+// intervals were recorded.  This is part of the Indexer interface.
 func (idx *CfIndex) Init() error {
-	return nil // Nothing to do.
+	return idx.db.Update(func(dbTx database.Tx) error {
+		parent := dbTx.Metadata().Bucket(cfIndexParentBucketKey)
+		for _, bucketName := range cfCheckptKeys {
+			if parent.Bucket(bucketName) != nil {
+				continue
+			}
+			if _, err := parent.CreateBucket(bucketName); err != nil {
+				return err
+			}
+			idx.backfillCheckpts = true
+		}
+		return nil
+	})
+}
+
+// backfill records the filter headers at each checkpoint interval of the main
+// chain up to the tip of the index when Init created the checkpoint buckets.
+//
+// This is part of the chainBackfiller interface.
+func (idx *CfIndex) backfill(chain *blockchain.BlockChain, interrupt <-chan struct{}) error {
+	if !idx.backfillCheckpts {
+		return nil
+	}
+
+	var tipHeight int32
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		_, tipHeight, err = dbFetchIndexerTip(dbTx, cfIndexParentBucketKey)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Recording %s checkpoints up to height %d", cfIndexName,
+		tipHeight)
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		for height := int32(wire.CFCheckptInterval); height <= tipHeight; height += wire.CFCheckptInterval {
+			if interruptRequested(interrupt) {
+				return errInterruptRequested
+			}
+			hash, err := chain.BlockHashByHeight(height)
+			if err != nil {
+				return err
+			}
+			for filterType := range cfCheckptKeys {
+				err := storeCheckpt(dbTx, wire.FilterType(filterType),
+					height, hash)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	idx.backfillCheckpts = false
+	return nil
 }
 
 // Key returns the database key to use for the index as a byte slice. This is
@@ -144,9 +235,37 @@ func (idx *CfIndex) Create(dbTx database.Tx) error {
 		}
 	}
 
+	for _, bucketName := range cfCheckptKeys {
+		_, err = cfIndexParentBucket.CreateBucket(bucketName)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// storeCheckpt records the already stored filter header of the passed type of
+// the block with the passed hash as the checkpoint at the passed height.
+func storeCheckpt(dbTx database.Tx, filterType wire.FilterType, height int32,
+	hash *chainhash.Hash) error {
+
+	header, err := dbFetchFilterIdxEntry(dbTx, cfHeaderKeys[filterType], hash)
+	if err != nil {
+		return err
+	}
+	if len(header) != chainhash.HashSize {
+		return AssertError(fmt.Sprintf("missing cf header for block %v",
+			hash))
+	}
+	value := make([]byte, 2*chainhash.HashSize)
+	copy(value, hash[:])
+	copy(value[chainhash.HashSize:], header)
+	bucket := dbTx.Metadata().Bucket(cfIndexParentBucketKey).
+		Bucket(cfCheckptKeys[filterType])
+	return bucket.Put(cfCheckptKey(height), value)
+}
+
 // storeFilter stores a given filter, and performs the steps needed to
 // generate the filter's header.
 func storeFilter(dbTx database.Tx, block *btcutil.Block, f *gcs.Filter,
@@ -203,7 +322,17 @@ func storeFilter(dbTx database.Tx, block *btcutil.Block, f *gcs.Filter,
 	if err != nil {
 		return err
 	}
-	return dbStoreFilterIdxEntry(dbTx, hkey, h, fh[:])
+	err = dbStoreFilterIdxEntry(dbTx, hkey, h, fh[:])
+	if err != nil {
+		return err
+	}
+
+	// Finally, record the filter header as a checkpoint when the block is
+	// at a checkpoint interval.
+	if !isCfCheckptHeight(block.Height()) {
+		return nil
+	}
+	return storeCheckpt(dbTx, filterType, block.Height(), h)
 }
 
 // ConnectBlock is invoked by the index manager when a new block has been
@@ -212,17 +341,36 @@ func storeFilter(dbTx database.Tx, block *btcutil.Block, f *gcs.Filter,
 func (idx *CfIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
 	stxos []blockchain.SpentTxOut) error {
 
+	f, err := idx.prepareBlock(block, stxos)
+	if err != nil {
+		return err
+	}
+	return idx.connectPreparedBlock(dbTx, block, stxos, f)
+}
+
+// prepareBlock builds the basic filter of the passed block.
+//
+// This is part of the blockPreparer interface.
+func (idx *CfIndex) prepareBlock(block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) (interface{}, error) {
+
 	prevScripts := make([][]byte, len(stxos))
 	for i, stxo := range stxos {
 		prevScripts[i] = stxo.PkScript
 	}
 
-	f, err := builder.BuildBasicFilter(block.MsgBlock(), prevScripts)
-	if err != nil {
-		return err
-	}
+	return builder.BuildBasicFilter(block.MsgBlock(), prevScripts)
+}
+
+// connectPreparedBlock stores the basic filter of the passed block built by
+// prepareBlock.
+//
+// This is part of the blockPreparer interface.
+func (idx *CfIndex) connectPreparedBlock(dbTx database.Tx, block *btcutil.Block,
+	_ []blockchain.SpentTxOut, prepared interface{}) error {
 
-	return storeFilter(dbTx, block, f, wire.GCSFilterRegular)
+	return storeFilter(dbTx, block, prepared.(*gcs.Filter),
+		wire.GCSFilterRegular)
 }
 
 // DisconnectBlock is invoked by the index manager when a block has been
@@ -252,6 +400,16 @@ func (idx *CfIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
 		}
 	}
 
+	if isCfCheckptHeight(block.Height()) {
+		parent := dbTx.Metadata().Bucket(cfIndexParentBucketKey)
+		for _, key := range cfCheckptKeys {
+			err := parent.Bucket(key).Delete(cfCheckptKey(block.Height()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -340,6 +498,57 @@ func (idx *CfIndex) FilterHashesByBlockHashes(blockHashes []*chainhash.Hash,
 	return idx.entriesByBlockHashes(cfHashKeys, filterType, blockHashes)
 }
 
+// FilterCheckpoints returns the filter headers of the passed type of the main
+// chain blocks at each checkpoint interval up to the passed stop height, which
+// must not exceed the height of the main chain.  They are recorded as blocks are
+// connected, so serving cfcheckpt requests does not need to look up the blocks
+// of the main chain.
+func (idx *CfIndex) FilterCheckpoints(stopHeight int32,
+	filterType wire.FilterType) ([]chainhash.Hash, error) {
+
+	if uint8(filterType) > maxFilterType {
+		return nil, errors.New("unsupported filter type")
+	}
+	if stopHeight < 0 {
+		return nil, nil
+	}
+
+	numCheckpts := int(stopHeight / wire.CFCheckptInterval)
+	headers := make([]chainhash.Hash, 0, numCheckpts)
+	err := idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(cfIndexParentBucketKey).
+			Bucket(cfCheckptKeys[filterType])
+		cursor := bucket.Cursor()
+		for ok := cursor.First(); ok && len(headers) < numCheckpts; ok = cursor.Next() {
+			key, value := cursor.Key(), cursor.Value()
+			wantHeight := int32(len(headers)+1) * wire.CFCheckptInterval
+			if len(key) != 4 || int32(binary.BigEndian.Uint32(key)) != wantHeight ||
+				len(value) != 2*chainhash.HashSize {
+
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: fmt.Sprintf("corrupt %s "+
+						"checkpoint at height %d",
+						cfIndexName, wantHeight),
+				}
+			}
+			var header chainhash.Hash
+			copy(header[:], value[chainhash.HashSize:])
+			headers = append(headers, header)
+		}
+		if len(headers) != numCheckpts {
+			return fmt.Errorf("%s has %d checkpoints, but %d are "+
+				"needed for height %d", cfIndexName,
+				len(headers), numCheckpts, stopHeight)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
 // NewCfIndex returns a new instance of an indexer that is used to create a
 // mapping of the hashes of all blocks in the blockchain to their respective
 // committed filters.
@@ -0,0 +1,156 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestCfIndexCheckpoints ensures the committed filter index records the filter
+// headers at each checkpoint interval as blocks are connected and disconnected.
+func TestCfIndexCheckpoints(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "cfindex")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", filepath.Join(dbPath, "db"),
+		wire.SimNet)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+
+	idx := NewCfIndex(db, &chaincfg.SimNetParams)
+	if err := db.Update(idx.Create); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := idx.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if idx.backfillCheckpts {
+		t.Fatal("new index marked for checkpoint backfill")
+	}
+
+	// Connect a chain of blocks through the second checkpoint interval.
+	tipHeight := int32(2 * wire.CFCheckptInterval)
+	blocks := make([]*btcutil.Block, 0, tipHeight+1)
+	var prevHash chainhash.Hash
+	for height := int32(0); height <= tipHeight; height++ {
+		coinbase := wire.NewMsgTx(wire.TxVersion)
+		coinbase.AddTxIn(wire.NewTxIn(&wire.OutPoint{
+			Index: wire.MaxPrevOutIndex,
+		}, []byte{byte(height), byte(height >> 8)}, nil))
+		coinbase.AddTxOut(wire.NewTxOut(5000, []byte{txscript.OP_TRUE}))
+		msgBlock := wire.NewMsgBlock(&wire.BlockHeader{
+			PrevBlock: prevHash,
+			Nonce:     uint32(height),
+		})
+		msgBlock.AddTransaction(coinbase)
+		block := btcutil.NewBlock(msgBlock)
+		block.SetHeight(height)
+		blocks = append(blocks, block)
+		prevHash = *block.Hash()
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		for _, block := range blocks {
+			if err := idx.ConnectBlock(dbTx, block, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to connect blocks: %v", err)
+	}
+
+	// headerAt returns the filter header of the block at the passed height.
+	headerAt := func(height int32) chainhash.Hash {
+		t.Helper()
+		header, err := idx.FilterHeaderByBlockHash(blocks[height].Hash(),
+			wire.GCSFilterRegular)
+		if err != nil {
+			t.Fatalf("FilterHeaderByBlockHash: %v", err)
+		}
+		var hash chainhash.Hash
+		copy(hash[:], header)
+		return hash
+	}
+	tests := []struct {
+		stopHeight int32
+		want       []int32
+	}{
+		{stopHeight: 0},
+		{stopHeight: wire.CFCheckptInterval - 1},
+		{stopHeight: wire.CFCheckptInterval, want: []int32{1000}},
+		{stopHeight: tipHeight - 1, want: []int32{1000}},
+		{stopHeight: tipHeight, want: []int32{1000, 2000}},
+	}
+	for _, test := range tests {
+		got, err := idx.FilterCheckpoints(test.stopHeight,
+			wire.GCSFilterRegular)
+		if err != nil {
+			t.Fatalf("FilterCheckpoints(%d): %v", test.stopHeight, err)
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("FilterCheckpoints(%d): got %d checkpoints, "+
+				"want %d", test.stopHeight, len(got),
+				len(test.want))
+		}
+		for i, height := range test.want {
+			if got[i] != headerAt(height) {
+				t.Fatalf("FilterCheckpoints(%d): checkpoint %d "+
+					"is %v, want %v", test.stopHeight, i,
+					got[i], headerAt(height))
+			}
+		}
+	}
+
+	// Disconnecting the tip removes its checkpoint, so it can no longer be
+	// served.
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.DisconnectBlock(dbTx, blocks[tipHeight], nil)
+	})
+	if err != nil {
+		t.Fatalf("DisconnectBlock: %v", err)
+	}
+	if _, err := idx.FilterCheckpoints(tipHeight, wire.GCSFilterRegular); err == nil {
+		t.Fatal("FilterCheckpoints served a disconnected checkpoint")
+	}
+	got, err := idx.FilterCheckpoints(tipHeight-1, wire.GCSFilterRegular)
+	if err != nil {
+		t.Fatalf("FilterCheckpoints: %v", err)
+	}
+	if len(got) != 1 || got[0] != headerAt(wire.CFCheckptInterval) {
+		t.Fatalf("unexpected checkpoints %v after disconnect", got)
+	}
+
+	// Removing the checkpoint bucket of an existing index marks it to be
+	// backfilled by Init.
+	err = db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Bucket(cfIndexParentBucketKey).
+			DeleteBucket(cfCheckptKeys[wire.GCSFilterRegular])
+	})
+	if err != nil {
+		t.Fatalf("unable to delete checkpoint bucket: %v", err)
+	}
+	if err := idx.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if !idx.backfillCheckpts {
+		t.Fatal("index without checkpoints not marked for backfill")
+	}
+}
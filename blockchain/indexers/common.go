@@ -63,6 +63,14 @@ type Indexer interface {
 	DisconnectBlock(database.Tx, *btcutil.Block, []blockchain.SpentTxOut) error
 }
 
+// chainBackfiller is implemented by indexes which record data from the main
+// chain which may be missing from indexes created by older versions.  The
+// manager invokes it once the tip of the index is in the main chain and before
+// the index is caught up.
+type chainBackfiller interface {
+	backfill(chain *blockchain.BlockChain, interrupt <-chan struct{}) error
+}
+
 // AssertError identifies an error that indicates an internal code consistency
 // issue and should be treated as a critical and unrecoverable error.
 type AssertError string
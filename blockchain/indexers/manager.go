@@ -7,6 +7,7 @@ package indexers
 import (
 	"bytes"
 	"fmt"
+	"runtime"
 
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -94,6 +95,41 @@ func dbIndexConnectBlock(dbTx database.Tx, indexer Indexer, block *btcutil.Block
 	return dbPutIndexerTip(dbTx, idxKey, block.Hash(), block.Height())
 }
 
+// dbIndexConnectPreparedBlock is the same as dbIndexConnectBlock except it
+// connects the block with the passed result of prepareBlock when the indexer
+// is a blockPreparer.
+func dbIndexConnectPreparedBlock(dbTx database.Tx, indexer Indexer,
+	block *btcutil.Block, stxo []blockchain.SpentTxOut,
+	prepared interface{}) error {
+
+	preparer, ok := indexer.(blockPreparer)
+	if !ok {
+		return dbIndexConnectBlock(dbTx, indexer, block, stxo)
+	}
+
+	// Assert that the block being connected properly connects to the
+	// current tip of the index.
+	idxKey := indexer.Key()
+	curTipHash, _, err := dbFetchIndexerTip(dbTx, idxKey)
+	if err != nil {
+		return err
+	}
+	if !curTipHash.IsEqual(&block.MsgBlock().Header.PrevBlock) {
+		return AssertError(fmt.Sprintf("dbIndexConnectPreparedBlock "+
+			"must be called with a block that extends the current "+
+			"index tip (%s, tip %s, block %s)", indexer.Name(),
+			curTipHash, block.Hash()))
+	}
+
+	err = preparer.connectPreparedBlock(dbTx, block, stxo, prepared)
+	if err != nil {
+		return err
+	}
+
+	// Update the current index tip.
+	return dbPutIndexerTip(dbTx, idxKey, block.Hash(), block.Height())
+}
+
 // dbIndexDisconnectBlock removes all of the index entries associated with the
 // given block using the provided indexer and updates the tip of the indexer
 // accordingly.  An error will be returned if the current tip for the indexer is
@@ -132,6 +168,10 @@ func dbIndexDisconnectBlock(dbTx database.Tx, indexer Indexer, block *btcutil.Bl
 type Manager struct {
 	db             database.DB
 	enabledIndexes []Indexer
+
+	// backfillWorkers is the number of workers which load and prepare
+	// blocks while catching up the indexes.
+	backfillWorkers int
 }
 
 // Ensure the Manager type implements the blockchain.IndexManager interface.
@@ -361,6 +401,18 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 		}
 	}
 
+	// Give the indexes which backfill data from the main chain the chance
+	// to do so now that their tips are in the main chain.
+	for _, indexer := range m.enabledIndexes {
+		backfiller, ok := indexer.(chainBackfiller)
+		if !ok {
+			continue
+		}
+		if err := backfiller.backfill(chain, interrupt); err != nil {
+			return err
+		}
+	}
+
 	// Fetch the current tip heights for each index along with tracking the
 	// lowest one so the catchup code only needs to start at the earliest
 	// block and is able to skip connecting the block for the indexes that
@@ -394,62 +446,15 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 		return nil
 	}
 
-	// Create a progress logger for the indexing process below.
-	progressLogger := newBlockProgressLogger("Indexed", log)
-
 	// At this point, one or more indexes are behind the current best chain
-	// tip and need to be caught up, so log the details and loop through
-	// each block that needs to be indexed.
+	// tip and need to be caught up, so log the details and index the blocks
+	// from the earliest one any of the indexes needs.
 	log.Infof("Catching up indexes from height %d to %d", lowestHeight,
 		bestHeight)
-	for height := lowestHeight + 1; height <= bestHeight; height++ {
-		// Load the block for the height since it is required to index
-		// it.
-		block, err := chain.BlockByHeight(height)
-		if err != nil {
-			return err
-		}
-
-		if interruptRequested(interrupt) {
-			return errInterruptRequested
-		}
-
-		// Connect the block for all indexes that need it.
-		var spentTxos []blockchain.SpentTxOut
-		for i, indexer := range m.enabledIndexes {
-			// Skip indexes that don't need to be updated with this
-			// block.
-			if indexerHeights[i] >= height {
-				continue
-			}
-
-			// When the index requires all of the referenced txouts
-			// and they haven't been loaded yet, they need to be
-			// retrieved from the spend journal.
-			if spentTxos == nil && indexNeedsInputs(indexer) {
-				spentTxos, err = chain.FetchSpendJournal(block)
-				if err != nil {
-					return err
-				}
-			}
-
-			err := m.db.Update(func(dbTx database.Tx) error {
-				return dbIndexConnectBlock(
-					dbTx, indexer, block, spentTxos,
-				)
-			})
-			if err != nil {
-				return err
-			}
-			indexerHeights[i] = height
-		}
-
-		// Log indexing progress.
-		progressLogger.LogBlockHeight(block)
-
-		if interruptRequested(interrupt) {
-			return errInterruptRequested
-		}
+	err = m.backfillIndexes(chainBackfillFetcher(chain), indexerHeights,
+		bestHeight, interrupt)
+	if err != nil {
+		return err
 	}
 
 	log.Infof("Indexes caught up to height %d", bestHeight)
@@ -539,8 +544,9 @@ func (m *Manager) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
 // cleanly plugs into the normal blockchain processing path.
 func NewManager(db database.DB, enabledIndexes []Indexer) *Manager {
 	return &Manager{
-		db:             db,
-		enabledIndexes: enabledIndexes,
+		db:              db,
+		enabledIndexes:  enabledIndexes,
+		backfillWorkers: runtime.NumCPU(),
 	}
 }
 
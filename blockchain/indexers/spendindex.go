@@ -0,0 +1,211 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// spendIndexName is the human-readable name for the index.
+	spendIndexName = "spent output index"
+
+	// spendKeySize is the size of a key in the spent output index.  It
+	// consists of the 32 byte hash of the transaction and the 4 byte output
+	// index.
+	spendKeySize = chainhash.HashSize + 4
+
+	// spendValueSize is the size of a value in the spent output index.  It
+	// consists of the 32 byte hash of the spending transaction, the 4 byte
+	// input index and the 4 byte block height.
+	spendValueSize = chainhash.HashSize + 4 + 4
+)
+
+var (
+	// spendIndexKey is the key of the spent output index and the db bucket
+	// used to house it.
+	spendIndexKey = []byte("spendbyoutpointidx")
+)
+
+// -----------------------------------------------------------------------------
+// The spent output index maps each output spent by a transaction in the main
+// chain to the transaction which spends it:
+//
+//   <tx hash><output index> = <spending tx hash><input index><height>
+//
+//   Field               Type              Size
+//   tx hash             chainhash.Hash    32 bytes
+//   output index        uint32            4 bytes
+//   spending tx hash    chainhash.Hash    32 bytes
+//   input index         uint32            4 bytes
+//   height              uint32            4 bytes
+//   -----
+//   Total: 76 bytes
+//
+// The entries are removed when the block containing the spending transaction is
+// disconnected, so the index always reflects the spends of the main chain.
+// -----------------------------------------------------------------------------
+
+// SpendEntry describes the transaction input in the main chain which spends an
+// output in the spent output index.
+type SpendEntry struct {
+	TxHash chainhash.Hash
+	TxIn   uint32
+	Height int32
+}
+
+// spendKey returns the key of the passed outpoint in the spent output index.
+func spendKey(outpoint *wire.OutPoint) []byte {
+	key := make([]byte, spendKeySize)
+	copy(key, outpoint.Hash[:])
+	byteOrder.PutUint32(key[chainhash.HashSize:], outpoint.Index)
+	return key
+}
+
+// serializeSpendEntry returns the serialized value of the passed entry.
+func serializeSpendEntry(entry *SpendEntry) []byte {
+	serialized := make([]byte, spendValueSize)
+	copy(serialized, entry.TxHash[:])
+	byteOrder.PutUint32(serialized[chainhash.HashSize:], entry.TxIn)
+	byteOrder.PutUint32(serialized[chainhash.HashSize+4:],
+		uint32(entry.Height))
+	return serialized
+}
+
+// SpendIndex implements an index of the outputs spent by the transactions in
+// the main chain to the inputs which spend them.
+type SpendIndex struct {
+	db database.DB
+}
+
+// Ensure the SpendIndex type implements the Indexer interface.
+var _ Indexer = (*SpendIndex)(nil)
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Key() []byte {
+	return spendIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Name() string {
+	return spendIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(spendIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer maps the outputs spent by the
+// block to the inputs which spend them.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	_ []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(spendIndexKey)
+	for _, tx := range block.Transactions()[1:] {
+		entry := SpendEntry{TxHash: *tx.Hash(), Height: block.Height()}
+		for txInIdx, txIn := range tx.MsgTx().TxIn {
+			entry.TxIn = uint32(txInIdx)
+			err := bucket.Put(spendKey(&txIn.PreviousOutPoint),
+				serializeSpendEntry(&entry))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the entries of the
+// outputs spent by the block, which are unspent again.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	_ []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(spendIndexKey)
+	for _, tx := range block.Transactions()[1:] {
+		for _, txIn := range tx.MsgTx().TxIn {
+			err := bucket.Delete(spendKey(&txIn.PreviousOutPoint))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SpendingTx returns the input in the main chain which spends the passed
+// outpoint.  It returns nil when the output is unspent or does not exist.
+//
+// This function is safe for concurrent access.
+func (idx *SpendIndex) SpendingTx(outpoint *wire.OutPoint) (*SpendEntry, error) {
+	var entry *SpendEntry
+	err := idx.db.View(func(dbTx database.Tx) error {
+		key := spendKey(outpoint)
+		serialized := dbTx.Metadata().Bucket(spendIndexKey).Get(key)
+		if serialized == nil {
+			return nil
+		}
+		if len(serialized) != spendValueSize {
+			return database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("corrupt spent output "+
+					"index entry for %v", outpoint),
+			}
+		}
+
+		entry = new(SpendEntry)
+		copy(entry.TxHash[:], serialized)
+		entry.TxIn = byteOrder.Uint32(serialized[chainhash.HashSize:])
+		entry.Height = int32(byteOrder.Uint32(
+			serialized[chainhash.HashSize+4:]))
+		return nil
+	})
+	return entry, err
+}
+
+// NewSpendIndex returns a new instance of an indexer that is used to map the
+// outputs spent in the main chain to the transactions which spend them.
+//
+// It implements the Indexer interface which plugs into the IndexManager that
+// in turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewSpendIndex(db database.DB) *SpendIndex {
+	return &SpendIndex{db: db}
+}
+
+// DropSpendIndex drops the spent output index from the provided database if it
+// exists.
+func DropSpendIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, spendIndexKey, spendIndexName, interrupt)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestSpendIndex ensures the spent output index maps the outputs spent by the
+// connected blocks to their spending inputs and forgets them when the blocks
+// are disconnected.
+func TestSpendIndex(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "spendindex")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", filepath.Join(dbPath, "db"),
+		wire.SimNet)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+
+	idx := NewSpendIndex(db)
+	if err := db.Update(idx.Create); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Create a block which spends two outputs of one transaction in its
+	// second input and its first input.
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(&wire.OutPoint{
+		Index: wire.MaxPrevOutIndex,
+	}, []byte{0x01}, nil))
+	coinbase.AddTxOut(wire.NewTxOut(5000, nil))
+	prevHash := chainhash.Hash{0x01}
+	spent1 := wire.OutPoint{Hash: prevHash, Index: 1}
+	spent0 := wire.OutPoint{Hash: prevHash, Index: 0}
+	unspent := wire.OutPoint{Hash: prevHash, Index: 2}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&spent1, nil, nil))
+	tx.AddTxIn(wire.NewTxIn(&spent0, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(4000, nil))
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{})
+	msgBlock.AddTransaction(coinbase)
+	msgBlock.AddTransaction(tx)
+	block := btcutil.NewBlock(msgBlock)
+	block.SetHeight(7)
+
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.ConnectBlock(dbTx, block, nil)
+	})
+	if err != nil {
+		t.Fatalf("ConnectBlock: %v", err)
+	}
+
+	tests := []struct {
+		outpoint wire.OutPoint
+		want     *SpendEntry
+	}{
+		{spent0, &SpendEntry{TxHash: tx.TxHash(), TxIn: 1, Height: 7}},
+		{spent1, &SpendEntry{TxHash: tx.TxHash(), TxIn: 0, Height: 7}},
+		{unspent, nil},
+		{wire.OutPoint{Index: wire.MaxPrevOutIndex}, nil},
+	}
+	for _, test := range tests {
+		got, err := idx.SpendingTx(&test.outpoint)
+		if err != nil {
+			t.Fatalf("SpendingTx(%v): %v", test.outpoint, err)
+		}
+		if (got == nil) != (test.want == nil) ||
+			(got != nil && *got != *test.want) {
+
+			t.Fatalf("SpendingTx(%v) = %+v, want %+v", test.outpoint,
+				got, test.want)
+		}
+	}
+
+	// Disconnecting the block makes the outputs unspent again.
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.DisconnectBlock(dbTx, block, nil)
+	})
+	if err != nil {
+		t.Fatalf("DisconnectBlock: %v", err)
+	}
+	for _, outpoint := range []wire.OutPoint{spent0, spent1} {
+		got, err := idx.SpendingTx(&outpoint)
+		if err != nil || got != nil {
+			t.Fatalf("SpendingTx(%v) after disconnect = %+v, %v",
+				outpoint, got, err)
+		}
+	}
+}
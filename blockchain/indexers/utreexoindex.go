@@ -0,0 +1,467 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/utreexo"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// utreexoIndexName is the human-readable name for the index.
+	utreexoIndexName = "utreexo index"
+)
+
+var (
+	// utreexoIndexKey is the key of the utreexo index and the db bucket
+	// used to house it.
+	utreexoIndexKey = []byte("utreexoidx")
+
+	// utreexoLeavesBucketName is the name of the db bucket used to house
+	// the leaves of the accumulator by their position.
+	utreexoLeavesBucketName = []byte("leaves")
+
+	// utreexoBlocksBucketName is the name of the db bucket used to house the
+	// proofs and roots of each block by its hash.
+	utreexoBlocksBucketName = []byte("blocks")
+)
+
+// -----------------------------------------------------------------------------
+// The utreexo index maintains a utreexo accumulator of the unspent transaction
+// output set and records, for each block of the main chain, the proofs needed
+// to apply the block to the roots of the accumulator.  This enables clients
+// which only keep the roots, rather than the whole unspent transaction output
+// set, to follow the chain.
+//
+// A block is applied to the accumulator by first adding the leaves of all of
+// its spendable outputs in the order they appear in the block and then
+// deleting the leaves of the outputs spent by its inputs, in the order of the
+// inputs.  Outputs which are created and spent in the same block are thus
+// added and deleted again.
+//
+// The leaves are stored in the leaves bucket by their position:
+//   <position> = <leaf>
+//
+//   Field           Type              Size
+//   position        uint64            8 bytes (big endian)
+//   leaf            chainhash.Hash    32 bytes
+//   -----
+//   Total: 40 bytes
+//
+// The leaves are loaded into a utreexo.Forest when the index is initialized,
+// so the memory needed by the index grows with the size of the unspent
+// transaction output set.
+//
+// The proofs and roots of each block are stored in the blocks bucket:
+//   <hash> = <stump><num adds><num deletions><deletions>
+//
+//   Field           Type              Size
+//   hash            chainhash.Hash    32 bytes
+//   stump           utreexo.Stump     variable
+//   num adds        uint32            4 bytes
+//   num deletions   uint32            4 bytes
+//   deletions       []utreexo.Deletion variable
+//
+// The stump is the state of the accumulator after the block.  The deletions
+// are valid against the state of the accumulator after the preceding ones and
+// also serve to undo the block when it is disconnected.
+// -----------------------------------------------------------------------------
+
+// UtreexoBlockProof houses the data needed to apply a block to the roots of
+// the utreexo accumulator of the unspent transaction output set.
+type UtreexoBlockProof struct {
+	// Roots is the state of the accumulator after the block was applied.
+	Roots utreexo.Stump
+
+	// NumAdds is the number of leaves added by the block, which are the
+	// leaves of its spendable outputs.
+	NumAdds uint32
+
+	// Deletions are the deletions of the leaves of the outputs spent by
+	// the block in the order of its inputs.
+	Deletions []utreexo.Deletion
+}
+
+// serialize returns the serialization of the block proof for the blocks
+// bucket.
+func (p *UtreexoBlockProof) serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := p.Roots.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	var counts [8]byte
+	byteOrder.PutUint32(counts[:4], p.NumAdds)
+	byteOrder.PutUint32(counts[4:], uint32(len(p.Deletions)))
+	buf.Write(counts[:])
+	for i := range p.Deletions {
+		if err := p.Deletions[i].Serialize(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// deserialize decodes a block proof from the passed serialization.
+func (p *UtreexoBlockProof) deserialize(serialized []byte) error {
+	r := bytes.NewReader(serialized)
+	if err := p.Roots.Deserialize(r); err != nil {
+		return errDeserialize(fmt.Sprintf("corrupt utreexo roots: %v",
+			err))
+	}
+	var counts [8]byte
+	if _, err := io.ReadFull(r, counts[:]); err != nil {
+		return errDeserialize("corrupt utreexo block proof counts")
+	}
+	p.NumAdds = byteOrder.Uint32(counts[:4])
+	numDeletions := byteOrder.Uint32(counts[4:])
+	if uint64(numDeletions) > uint64(len(serialized)) {
+		return errDeserialize("corrupt utreexo block proof counts")
+	}
+	p.Deletions = make([]utreexo.Deletion, numDeletions)
+	for i := range p.Deletions {
+		if err := p.Deletions[i].Deserialize(r); err != nil {
+			return errDeserialize(fmt.Sprintf("corrupt utreexo "+
+				"deletion: %v", err))
+		}
+	}
+	return nil
+}
+
+// UtxoLeafHash returns the hash of the leaf of the passed unspent transaction
+// output in the utreexo accumulator maintained by the utreexo index.  It is the
+// single SHA256 of the outpoint, the height shifted left one bit with the
+// coinbase flag in the lowest bit, the amount and the public key script.
+func UtxoLeafHash(outpoint *wire.OutPoint, amount int64, pkScript []byte,
+	height int32, isCoinBase bool) chainhash.Hash {
+
+	var buf bytes.Buffer
+	var scratch [8]byte
+	buf.Write(outpoint.Hash[:])
+	binary.LittleEndian.PutUint32(scratch[:4], outpoint.Index)
+	buf.Write(scratch[:4])
+
+	code := uint32(height) << 1
+	if isCoinBase {
+		code |= 0x01
+	}
+	binary.LittleEndian.PutUint32(scratch[:4], code)
+	buf.Write(scratch[:4])
+
+	binary.LittleEndian.PutUint64(scratch[:], uint64(amount))
+	buf.Write(scratch[:])
+	wire.WriteVarBytes(&buf, 0, pkScript)
+	return chainhash.HashH(buf.Bytes())
+}
+
+// utreexoLeafKey returns the key of the leaf at the passed position in the
+// leaves bucket.
+func utreexoLeafKey(position uint64) []byte {
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], position)
+	return key[:]
+}
+
+// UtreexoIndex implements a utreexo accumulator of the unspent transaction
+// output set along with the proofs needed to apply each block of the main
+// chain to its roots.
+type UtreexoIndex struct {
+	db database.DB
+
+	mtx    sync.RWMutex
+	forest *utreexo.Forest
+}
+
+// Ensure the UtreexoIndex type implements the Indexer interface.
+var _ Indexer = (*UtreexoIndex)(nil)
+
+// Ensure the UtreexoIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*UtreexoIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *UtreexoIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init loads the leaves of the accumulator into memory.  This is part of the
+// Indexer interface.
+func (idx *UtreexoIndex) Init() error {
+	forest := utreexo.NewForest()
+	err := idx.db.View(func(dbTx database.Tx) error {
+		leaves := dbTx.Metadata().Bucket(utreexoIndexKey).
+			Bucket(utreexoLeavesBucketName)
+		cursor := leaves.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			key, value := cursor.Key(), cursor.Value()
+			if len(key) != 8 || len(value) != chainhash.HashSize ||
+				binary.BigEndian.Uint64(key) != forest.NumLeaves() {
+
+				return database.Error{
+					ErrorCode:   database.ErrCorruption,
+					Description: "corrupt utreexo leaf",
+				}
+			}
+			var leaf chainhash.Hash
+			copy(leaf[:], value)
+			forest.Add(&leaf)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	idx.mtx.Lock()
+	idx.forest = forest
+	idx.mtx.Unlock()
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *UtreexoIndex) Key() []byte {
+	return utreexoIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *UtreexoIndex) Name() string {
+	return utreexoIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the index and
+// the buckets for the leaves and the block proofs.
+//
+// This is part of the Indexer interface.
+func (idx *UtreexoIndex) Create(dbTx database.Tx) error {
+	bucket, err := dbTx.Metadata().CreateBucket(utreexoIndexKey)
+	if err != nil {
+		return err
+	}
+	if _, err := bucket.CreateBucket(utreexoLeavesBucketName); err != nil {
+		return err
+	}
+	_, err = bucket.CreateBucket(utreexoBlocksBucketName)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer applies the block to the
+// accumulator and stores the proofs of its deletions.
+//
+// This is part of the Indexer interface.
+func (idx *UtreexoIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+
+	bucket := dbTx.Metadata().Bucket(utreexoIndexKey)
+	leaves := bucket.Bucket(utreexoLeavesBucketName)
+
+	// Add the leaves of the spendable outputs.
+	var proof UtreexoBlockProof
+	for i, tx := range block.Transactions() {
+		outpoint := wire.OutPoint{Hash: *tx.Hash()}
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			outpoint.Index = uint32(txOutIdx)
+			leaf := UtxoLeafHash(&outpoint, txOut.Value,
+				txOut.PkScript, block.Height(), i == 0)
+			position := idx.forest.Add(&leaf)
+			err := leaves.Put(utreexoLeafKey(position), leaf[:])
+			if err != nil {
+				return err
+			}
+			proof.NumAdds++
+		}
+	}
+
+	// Delete the leaves of the spent outputs.
+	stxoIdx := 0
+	for _, tx := range block.Transactions()[1:] {
+		for _, txIn := range tx.MsgTx().TxIn {
+			if stxoIdx >= len(stxos) {
+				return AssertError(fmt.Sprintf("missing spent "+
+					"outputs for block %v", block.Hash()))
+			}
+			stxo := &stxos[stxoIdx]
+			stxoIdx++
+			leaf := UtxoLeafHash(&txIn.PreviousOutPoint, stxo.Amount,
+				stxo.PkScript, stxo.Height, stxo.IsCoinBase)
+			d, err := idx.forest.Delete(&leaf)
+			if err != nil {
+				return AssertError(fmt.Sprintf("unable to delete "+
+					"utreexo leaf of %v: %v",
+					txIn.PreviousOutPoint, err))
+			}
+			proof.Deletions = append(proof.Deletions, *d)
+
+			// The last leaf was moved into the position of the
+			// deleted one unless it was the one deleted.
+			lastPos := idx.forest.NumLeaves()
+			if d.Proof.Position != lastPos {
+				err := leaves.Put(utreexoLeafKey(d.Proof.Position),
+					d.Last[:])
+				if err != nil {
+					return err
+				}
+			}
+			if err := leaves.Delete(utreexoLeafKey(lastPos)); err != nil {
+				return err
+			}
+		}
+	}
+
+	proof.Roots = idx.forest.Stump()
+	serialized, err := proof.serialize()
+	if err != nil {
+		return err
+	}
+	return bucket.Bucket(utreexoBlocksBucketName).Put(block.Hash()[:],
+		serialized)
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer undoes the changes of the
+// block to the accumulator and removes its proofs.
+//
+// This is part of the Indexer interface.
+func (idx *UtreexoIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	_ []blockchain.SpentTxOut) error {
+
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+
+	bucket := dbTx.Metadata().Bucket(utreexoIndexKey)
+	leaves := bucket.Bucket(utreexoLeavesBucketName)
+	blocks := bucket.Bucket(utreexoBlocksBucketName)
+	serialized := blocks.Get(block.Hash()[:])
+	if serialized == nil {
+		return AssertError(fmt.Sprintf("missing utreexo proof for "+
+			"block %v", block.Hash()))
+	}
+	var proof UtreexoBlockProof
+	if err := proof.deserialize(serialized); err != nil {
+		return err
+	}
+
+	// Undo the deletions in reverse order.
+	for i := len(proof.Deletions) - 1; i >= 0; i-- {
+		d := &proof.Deletions[i]
+		lastPos := idx.forest.NumLeaves()
+		if err := idx.forest.UndoDelete(d); err != nil {
+			return AssertError(fmt.Sprintf("unable to undo utreexo "+
+				"deletion of block %v: %v", block.Hash(), err))
+		}
+		err := leaves.Put(utreexoLeafKey(lastPos), d.Last[:])
+		if err != nil {
+			return err
+		}
+		err = leaves.Put(utreexoLeafKey(d.Proof.Position), d.Leaf[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Undo the additions, which are the last leaves of the forest.
+	for i := uint32(0); i < proof.NumAdds; i++ {
+		lastPos := idx.forest.NumLeaves() - 1
+		leaf := idx.forest.Leaf(lastPos)
+		if err := idx.forest.UndoAdd(&leaf); err != nil {
+			return err
+		}
+		if err := leaves.Delete(utreexoLeafKey(lastPos)); err != nil {
+			return err
+		}
+	}
+
+	return blocks.Delete(block.Hash()[:])
+}
+
+// BlockProof returns the proofs needed to apply the block with the passed hash
+// to the roots of the accumulator along with the resulting roots.  It returns
+// nil when the index has no entry for the block.
+//
+// This function is safe for concurrent access.
+func (idx *UtreexoIndex) BlockProof(hash *chainhash.Hash) (*UtreexoBlockProof, error) {
+	var proof *UtreexoBlockProof
+	err := idx.db.View(func(dbTx database.Tx) error {
+		serialized := dbTx.Metadata().Bucket(utreexoIndexKey).
+			Bucket(utreexoBlocksBucketName).Get(hash[:])
+		if serialized == nil {
+			return nil
+		}
+		proof = new(UtreexoBlockProof)
+		return proof.deserialize(serialized)
+	})
+	return proof, err
+}
+
+// ProveUtxo returns the proof that the passed unspent transaction output is
+// part of the accumulator along with the roots it is valid against, which are
+// the roots after the block most recently connected to the index.
+//
+// This function is safe for concurrent access.
+func (idx *UtreexoIndex) ProveUtxo(outpoint *wire.OutPoint,
+	entry *blockchain.UtxoEntry) (*utreexo.Proof, *utreexo.Stump, error) {
+
+	leaf := UtxoLeafHash(outpoint, entry.Amount(), entry.PkScript(),
+		entry.BlockHeight(), entry.IsCoinBase())
+	return idx.ProveLeaf(&leaf)
+}
+
+// ProveLeaf returns the proof that the passed leaf is part of the accumulator
+// along with the roots it is valid against.  See UtxoLeafHash for the leaves
+// of unspent transaction outputs.
+//
+// This function is safe for concurrent access.
+func (idx *UtreexoIndex) ProveLeaf(leaf *chainhash.Hash) (*utreexo.Proof,
+	*utreexo.Stump, error) {
+
+	idx.mtx.RLock()
+	defer idx.mtx.RUnlock()
+	proof, err := idx.forest.Prove(leaf)
+	if err != nil {
+		return nil, nil, err
+	}
+	stump := idx.forest.Stump()
+	return proof, &stump, nil
+}
+
+// NewUtreexoIndex returns a new instance of an indexer that is used to
+// maintain a utreexo accumulator of the unspent transaction output set along
+// with the proofs of all blocks in the main chain.
+//
+// It implements the Indexer interface which plugs into the IndexManager that
+// in turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewUtreexoIndex(db database.DB) *UtreexoIndex {
+	return &UtreexoIndex{db: db}
+}
+
+// DropUtreexoIndex drops the utreexo index from the provided database if it
+// exists.
+func DropUtreexoIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, utreexoIndexKey, utreexoIndexName, interrupt)
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/utreexo"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestUtreexoIndex ensures the utreexo index produces block proofs which apply
+// the blocks to the roots of the accumulator, proves unspent outputs, and
+// restores the accumulator when blocks are disconnected or the index is
+// reloaded.
+func TestUtreexoIndex(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "utreexoindex")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", filepath.Join(dbPath, "db"),
+		wire.SimNet)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+
+	idx := NewUtreexoIndex(db)
+	if err := db.Update(idx.Create); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := idx.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	p2pkh := []byte{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_DATA_20}
+	p2pkh = append(p2pkh, make([]byte, 20)...)
+	p2pkh = append(p2pkh, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG)
+	nullData := []byte{txscript.OP_RETURN, txscript.OP_DATA_1, 0x01}
+
+	// newBlock returns a block at the passed height with a coinbase paying
+	// to the passed outputs and a transaction spending the passed
+	// outpoints to two outputs.
+	newBlock := func(height int32, spends ...wire.OutPoint) *btcutil.Block {
+		coinbase := wire.NewMsgTx(wire.TxVersion)
+		coinbase.AddTxIn(wire.NewTxIn(&wire.OutPoint{
+			Index: wire.MaxPrevOutIndex,
+		}, []byte{byte(height)}, nil))
+		coinbase.AddTxOut(wire.NewTxOut(5000, p2pkh))
+		coinbase.AddTxOut(wire.NewTxOut(0, nullData))
+		msgBlock := wire.NewMsgBlock(&wire.BlockHeader{
+			Nonce: uint32(height),
+		})
+		msgBlock.AddTransaction(coinbase)
+		if len(spends) > 0 {
+			tx := wire.NewMsgTx(wire.TxVersion)
+			for i := range spends {
+				tx.AddTxIn(wire.NewTxIn(&spends[i], nil, nil))
+			}
+			tx.AddTxOut(wire.NewTxOut(1000, p2pkh))
+			tx.AddTxOut(wire.NewTxOut(2000, p2pkh))
+			msgBlock.AddTransaction(tx)
+		}
+		block := btcutil.NewBlock(msgBlock)
+		block.SetHeight(height)
+		return block
+	}
+	connect := func(block *btcutil.Block, stxos []blockchain.SpentTxOut) {
+		t.Helper()
+		err := db.Update(func(dbTx database.Tx) error {
+			return idx.ConnectBlock(dbTx, block, stxos)
+		})
+		if err != nil {
+			t.Fatalf("ConnectBlock: %v", err)
+		}
+	}
+	coinbaseStxo := blockchain.SpentTxOut{Amount: 5000, PkScript: p2pkh,
+		IsCoinBase: true}
+
+	// Connect two blocks with spendable coinbase outputs and a block which
+	// spends both of them along with an output created in the same block.
+	block1 := newBlock(1)
+	block2 := newBlock(2)
+	connect(block1, nil)
+	connect(block2, nil)
+	rootsBefore := idx.forest.Stump()
+
+	cb1 := wire.OutPoint{Hash: *block1.Transactions()[0].Hash()}
+	cb2 := wire.OutPoint{Hash: *block2.Transactions()[0].Hash()}
+	block3 := newBlock(3, cb1, cb2)
+	spendTx := wire.NewMsgTx(wire.TxVersion)
+	spendTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{
+		Hash: *block3.Transactions()[1].Hash(),
+	}, nil, nil))
+	spendTx.AddTxOut(wire.NewTxOut(900, p2pkh))
+	block3.MsgBlock().AddTransaction(spendTx)
+	block3 = btcutil.NewBlock(block3.MsgBlock())
+	block3.SetHeight(3)
+	stxo1, stxo2 := coinbaseStxo, coinbaseStxo
+	stxo1.Height, stxo2.Height = 1, 2
+	connect(block3, []blockchain.SpentTxOut{stxo1, stxo2,
+		{Amount: 1000, PkScript: p2pkh, Height: 3}})
+
+	// Apply the block proof to the roots before the block.
+	proof, err := idx.BlockProof(block3.Hash())
+	if err != nil || proof == nil {
+		t.Fatalf("BlockProof: %v, %v", proof, err)
+	}
+	if proof.NumAdds != 4 || len(proof.Deletions) != 3 {
+		t.Fatalf("BlockProof: %d adds and %d deletions", proof.NumAdds,
+			len(proof.Deletions))
+	}
+	stump := utreexo.Stump{
+		NumLeaves: rootsBefore.NumLeaves,
+		Roots:     append([]chainhash.Hash(nil), rootsBefore.Roots...),
+	}
+	for _, tx := range block3.Transactions() {
+		for i, txOut := range tx.MsgTx().TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			op := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(i)}
+			leaf := UtxoLeafHash(&op, txOut.Value, txOut.PkScript, 3,
+				tx == block3.Transactions()[0])
+			stump.Add(&leaf)
+		}
+	}
+	for i := range proof.Deletions {
+		if err := stump.Delete(&proof.Deletions[i]); err != nil {
+			t.Fatalf("Delete #%d: %v", i, err)
+		}
+	}
+	if !reflect.DeepEqual(stump, proof.Roots) ||
+		!reflect.DeepEqual(stump, idx.forest.Stump()) {
+
+		t.Fatalf("roots after applying block proof %+v do not match "+
+			"%+v", stump, proof.Roots)
+	}
+
+	// Prove an unspent output of the block.
+	op := wire.OutPoint{Hash: *block3.Transactions()[2].Hash()}
+	leaf := UtxoLeafHash(&op, 900, p2pkh, 3, false)
+	utxoProof, roots, err := idx.ProveLeaf(&leaf)
+	if err != nil {
+		t.Fatalf("ProveLeaf: %v", err)
+	}
+	if err := roots.Verify(&leaf, utxoProof); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	spent := UtxoLeafHash(&cb1, 5000, p2pkh, 1, true)
+	if _, _, err := idx.ProveLeaf(&spent); err != utreexo.ErrUnknownLeaf {
+		t.Fatalf("ProveLeaf: proved spent output")
+	}
+
+	// Reloading the index restores the accumulator.
+	if err := idx.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if !reflect.DeepEqual(idx.forest.Stump(), proof.Roots) {
+		t.Fatalf("reloaded roots %+v do not match %+v",
+			idx.forest.Stump(), proof.Roots)
+	}
+
+	// Disconnecting the block restores the roots before it, including
+	// after reloading the index.
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.DisconnectBlock(dbTx, block3, nil)
+	})
+	if err != nil {
+		t.Fatalf("DisconnectBlock: %v", err)
+	}
+	if !reflect.DeepEqual(idx.forest.Stump(), rootsBefore) {
+		t.Fatalf("roots after disconnect %+v do not match %+v",
+			idx.forest.Stump(), rootsBefore)
+	}
+	if err := idx.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if !reflect.DeepEqual(idx.forest.Stump(), rootsBefore) {
+		t.Fatalf("reloaded roots after disconnect %+v do not match %+v",
+			idx.forest.Stump(), rootsBefore)
+	}
+	if proof, err := idx.BlockProof(block3.Hash()); err != nil || proof != nil {
+		t.Fatalf("BlockProof: disconnected block has proof")
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// utxoScriptIndexName is the human-readable name for the index.
+	utxoScriptIndexName = "unspent output by script index"
+
+	// utxoScriptKeySize is the size of a key in the unspent output by
+	// script index.  It consists of the 32 byte script hash, the 32 byte
+	// hash of the transaction and the 4 byte output index.
+	utxoScriptKeySize = chainhash.HashSize + chainhash.HashSize + 4
+
+	// utxoScriptValueSize is the size of a value in the unspent output by
+	// script index.  It consists of the 8 byte amount and the 4 byte height
+	// and coinbase code.
+	utxoScriptValueSize = 8 + 4
+)
+
+var (
+	// utxoScriptIndexKey is the key of the unspent output by script index
+	// and the db bucket used to house it.
+	utxoScriptIndexKey = []byte("utxobyscriptidx")
+)
+
+// -----------------------------------------------------------------------------
+// The unspent output by script index maps the hashes of public key scripts to
+// the outputs of the current unspent transaction output set which pay to them.
+// The script hash is the single SHA256 of the script, which is the script hash
+// used by the Electrum protocol, so any script can be looked up regardless of
+// whether it encodes a standard address.
+//
+// The outputs paying to a script are stored under keys prefixed with its
+// hash, so they are found with a single cursor seek:
+//
+//   <script hash><tx hash><output index> = <amount><height code>
+//
+//   Field           Type              Size
+//   script hash     chainhash.Hash    32 bytes
+//   tx hash         chainhash.Hash    32 bytes
+//   output index    uint32            4 bytes
+//   amount          uint64            8 bytes
+//   height code     uint32            4 bytes
+//   -----
+//   Total: 80 bytes
+//
+// The height code is the height of the block containing the output shifted left
+// one bit with the coinbase flag in the lowest bit.
+// -----------------------------------------------------------------------------
+
+// ScriptUtxo describes an unspent transaction output paying to a script in the
+// unspent output by script index.
+type ScriptUtxo struct {
+	OutPoint   wire.OutPoint
+	Amount     int64
+	Height     int32
+	IsCoinBase bool
+}
+
+// ScriptHash returns the hash the unspent output by script index uses for the
+// passed public key script, which is its single SHA256.
+func ScriptHash(pkScript []byte) chainhash.Hash {
+	return chainhash.Hash(sha256.Sum256(pkScript))
+}
+
+// utxoScriptKey returns the key of the passed outpoint paying to the script
+// with the passed hash.
+func utxoScriptKey(scriptHash *chainhash.Hash, outpoint *wire.OutPoint) []byte {
+	key := make([]byte, utxoScriptKeySize)
+	copy(key, scriptHash[:])
+	copy(key[chainhash.HashSize:], outpoint.Hash[:])
+	byteOrder.PutUint32(key[2*chainhash.HashSize:], outpoint.Index)
+	return key
+}
+
+// serializeUtxoScriptValue returns the value of an output with the passed
+// amount, height and coinbase flag.
+func serializeUtxoScriptValue(amount int64, height int32, isCoinBase bool) []byte {
+	code := uint32(height) << 1
+	if isCoinBase {
+		code |= 0x01
+	}
+	serialized := make([]byte, utxoScriptValueSize)
+	byteOrder.PutUint64(serialized, uint64(amount))
+	byteOrder.PutUint32(serialized[8:], code)
+	return serialized
+}
+
+// dbPutScriptUtxo adds the passed output to the index.
+func dbPutScriptUtxo(bucket internalBucket, outpoint *wire.OutPoint, pkScript []byte,
+	amount int64, height int32, isCoinBase bool) error {
+
+	scriptHash := ScriptHash(pkScript)
+	return bucket.Put(utxoScriptKey(&scriptHash, outpoint),
+		serializeUtxoScriptValue(amount, height, isCoinBase))
+}
+
+// dbRemoveScriptUtxo removes the passed output paying to the passed script from
+// the index.
+func dbRemoveScriptUtxo(bucket internalBucket, outpoint *wire.OutPoint, pkScript []byte) error {
+	scriptHash := ScriptHash(pkScript)
+	return bucket.Delete(utxoScriptKey(&scriptHash, outpoint))
+}
+
+// UtxoScriptIndex implements an index of the unspent transaction outputs by the
+// hash of the public key script they pay to.
+type UtxoScriptIndex struct {
+	db database.DB
+}
+
+// Ensure the UtxoScriptIndex type implements the Indexer interface.
+var _ Indexer = (*UtxoScriptIndex)(nil)
+
+// Ensure the UtxoScriptIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*UtxoScriptIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *UtxoScriptIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoScriptIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoScriptIndex) Key() []byte {
+	return utxoScriptIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoScriptIndex) Name() string {
+	return utxoScriptIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the index.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoScriptIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(utxoScriptIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer removes the outputs spent by the
+// block and adds the spendable outputs it creates.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoScriptIndex) ConnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	bucket := dbTx.Metadata().Bucket(utxoScriptIndexKey)
+	stxoIdx := 0
+	for i, tx := range block.Transactions() {
+		// Remove the spent outputs first since transactions may spend
+		// outputs created earlier in the same block.
+		if i != 0 {
+			for _, txIn := range tx.MsgTx().TxIn {
+				if stxoIdx >= len(stxos) {
+					return AssertError(fmt.Sprintf("missing "+
+						"spent outputs for block %v",
+						block.Hash()))
+				}
+				err := dbRemoveScriptUtxo(bucket,
+					&txIn.PreviousOutPoint,
+					stxos[stxoIdx].PkScript)
+				if err != nil {
+					return err
+				}
+				stxoIdx++
+			}
+		}
+
+		outpoint := wire.OutPoint{Hash: *tx.Hash()}
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			outpoint.Index = uint32(txOutIdx)
+			err := dbPutScriptUtxo(bucket, &outpoint, txOut.PkScript,
+				txOut.Value, block.Height(), i == 0)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the outputs created
+// by the block and restores the outputs it spent.
+//
+// This is part of the Indexer interface.
+func (idx *UtxoScriptIndex) DisconnectBlock(dbTx database.Tx, block *btcutil.Block,
+	stxos []blockchain.SpentTxOut) error {
+
+	// Undo the transactions in reverse order so outputs created and spent
+	// in the block are handled correctly.
+	bucket := dbTx.Metadata().Bucket(utxoScriptIndexKey)
+	stxoIdx := len(stxos) - 1
+	txns := block.Transactions()
+	for i := len(txns) - 1; i >= 0; i-- {
+		tx := txns[i]
+		outpoint := wire.OutPoint{Hash: *tx.Hash()}
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			outpoint.Index = uint32(txOutIdx)
+			err := dbRemoveScriptUtxo(bucket, &outpoint,
+				txOut.PkScript)
+			if err != nil {
+				return err
+			}
+		}
+		if i == 0 {
+			break
+		}
+
+		txIns := tx.MsgTx().TxIn
+		for txInIdx := len(txIns) - 1; txInIdx >= 0; txInIdx-- {
+			if stxoIdx < 0 {
+				return AssertError(fmt.Sprintf("missing spent "+
+					"outputs for block %v", block.Hash()))
+			}
+			stxo := &stxos[stxoIdx]
+			stxoIdx--
+			err := dbPutScriptUtxo(bucket,
+				&txIns[txInIdx].PreviousOutPoint, stxo.PkScript,
+				stxo.Amount, stxo.Height, stxo.IsCoinBase)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UnspentOutputsByScriptHash returns the unspent transaction outputs paying to
+// the script with the passed hash.  See ScriptHash for the hash of a script.
+//
+// This function is safe for concurrent access.
+func (idx *UtxoScriptIndex) UnspentOutputsByScriptHash(scriptHash *chainhash.Hash) ([]ScriptUtxo, error) {
+	var utxos []ScriptUtxo
+	err := idx.db.View(func(dbTx database.Tx) error {
+		cursor := dbTx.Metadata().Bucket(utxoScriptIndexKey).Cursor()
+		prefix := scriptHash[:]
+		for ok := cursor.Seek(prefix); ok; ok = cursor.Next() {
+			key, value := cursor.Key(), cursor.Value()
+			if len(key) != utxoScriptKeySize ||
+				string(key[:chainhash.HashSize]) != string(prefix) {
+
+				break
+			}
+			if len(value) != utxoScriptValueSize {
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: fmt.Sprintf("corrupt unspent "+
+						"output by script index entry "+
+						"%x", key),
+				}
+			}
+
+			var utxo ScriptUtxo
+			copy(utxo.OutPoint.Hash[:], key[chainhash.HashSize:])
+			utxo.OutPoint.Index = byteOrder.Uint32(
+				key[2*chainhash.HashSize:])
+			utxo.Amount = int64(byteOrder.Uint64(value))
+			code := byteOrder.Uint32(value[8:])
+			utxo.Height = int32(code >> 1)
+			utxo.IsCoinBase = code&0x01 != 0
+			utxos = append(utxos, utxo)
+		}
+		return nil
+	})
+	return utxos, err
+}
+
+// UnspentOutputsForScript returns the unspent transaction outputs paying to the
+// passed public key script.
+//
+// This function is safe for concurrent access.
+func (idx *UtxoScriptIndex) UnspentOutputsForScript(pkScript []byte) ([]ScriptUtxo, error) {
+	scriptHash := ScriptHash(pkScript)
+	return idx.UnspentOutputsByScriptHash(&scriptHash)
+}
+
+// NewUtxoScriptIndex returns a new instance of an indexer that is used to map
+// public key scripts to the unspent transaction outputs which pay to them.
+//
+// It implements the Indexer interface which plugs into the IndexManager that
+// in turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewUtxoScriptIndex(db database.DB) *UtxoScriptIndex {
+	return &UtxoScriptIndex{db: db}
+}
+
+// DropUtxoScriptIndex drops the unspent output by script index from the
+// provided database if it exists.
+func DropUtxoScriptIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, utxoScriptIndexKey, utxoScriptIndexName, interrupt)
+}
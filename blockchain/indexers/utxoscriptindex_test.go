@@ -0,0 +1,151 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestUtxoScriptIndex ensures the unspent output by script index tracks the
+// unspent outputs paying to a script as blocks are connected and disconnected.
+func TestUtxoScriptIndex(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "utxoscriptindex")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", filepath.Join(dbPath, "db"),
+		wire.SimNet)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+
+	idx := NewUtxoScriptIndex(db)
+	if err := db.Update(idx.Create); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	p2pkh := []byte{txscript.OP_DUP, txscript.OP_HASH160, txscript.OP_DATA_20}
+	p2pkh = append(p2pkh, make([]byte, 20)...)
+	p2pkh = append(p2pkh, txscript.OP_EQUALVERIFY, txscript.OP_CHECKSIG)
+	other := []byte{txscript.OP_TRUE}
+	nullData := []byte{txscript.OP_RETURN, txscript.OP_DATA_1, 0x01}
+
+	// newBlock returns a block at the passed height with a coinbase paying
+	// to the script and a null data output followed by the passed
+	// transactions.
+	newBlock := func(height int32, txns ...*wire.MsgTx) *btcutil.Block {
+		coinbase := wire.NewMsgTx(wire.TxVersion)
+		coinbase.AddTxIn(wire.NewTxIn(&wire.OutPoint{
+			Index: wire.MaxPrevOutIndex,
+		}, []byte{byte(height)}, nil))
+		coinbase.AddTxOut(wire.NewTxOut(5000, p2pkh))
+		coinbase.AddTxOut(wire.NewTxOut(0, nullData))
+		msgBlock := wire.NewMsgBlock(&wire.BlockHeader{
+			Nonce: uint32(height),
+		})
+		msgBlock.AddTransaction(coinbase)
+		for _, tx := range txns {
+			msgBlock.AddTransaction(tx)
+		}
+		block := btcutil.NewBlock(msgBlock)
+		block.SetHeight(height)
+		return block
+	}
+	update := func(f func(database.Tx) error) {
+		t.Helper()
+		if err := db.Update(f); err != nil {
+			t.Fatalf("unable to update index: %v", err)
+		}
+	}
+	check := func(want []ScriptUtxo) {
+		t.Helper()
+		got, err := idx.UnspentOutputsForScript(p2pkh)
+		if err != nil {
+			t.Fatalf("UnspentOutputsForScript: %v", err)
+		}
+		sort.Slice(want, func(i, j int) bool {
+			return string(want[i].OutPoint.Hash[:]) <
+				string(want[j].OutPoint.Hash[:])
+		})
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unspent outputs %+v, want %+v", got, want)
+		}
+	}
+
+	block1 := newBlock(1)
+	block2 := newBlock(2)
+	for _, block := range []*btcutil.Block{block1, block2} {
+		block := block
+		update(func(dbTx database.Tx) error {
+			return idx.ConnectBlock(dbTx, block, nil)
+		})
+	}
+	cb1 := wire.OutPoint{Hash: *block1.Transactions()[0].Hash()}
+	cb2 := wire.OutPoint{Hash: *block2.Transactions()[0].Hash()}
+	before := []ScriptUtxo{
+		{OutPoint: cb1, Amount: 5000, Height: 1, IsCoinBase: true},
+		{OutPoint: cb2, Amount: 5000, Height: 2, IsCoinBase: true},
+	}
+	check(before)
+
+	// Spend both coinbases along with an output created in the same
+	// block and pay to the script and another one.
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&cb1, nil, nil))
+	tx.AddTxIn(wire.NewTxIn(&cb2, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, p2pkh))
+	tx.AddTxOut(wire.NewTxOut(2000, other))
+	spendTx := wire.NewMsgTx(wire.TxVersion)
+	spendTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: tx.TxHash()}, nil,
+		nil))
+	spendTx.AddTxOut(wire.NewTxOut(900, p2pkh))
+	block3 := newBlock(3, tx, spendTx)
+	stxos := []blockchain.SpentTxOut{
+		{Amount: 5000, PkScript: p2pkh, Height: 1, IsCoinBase: true},
+		{Amount: 5000, PkScript: p2pkh, Height: 2, IsCoinBase: true},
+		{Amount: 1000, PkScript: p2pkh, Height: 3},
+	}
+	update(func(dbTx database.Tx) error {
+		return idx.ConnectBlock(dbTx, block3, stxos)
+	})
+	check([]ScriptUtxo{{
+		OutPoint:   wire.OutPoint{Hash: *block3.Transactions()[0].Hash()},
+		Amount:     5000,
+		Height:     3,
+		IsCoinBase: true,
+	}, {
+		OutPoint: wire.OutPoint{Hash: spendTx.TxHash()},
+		Amount:   900,
+		Height:   3,
+	}})
+	utxos, err := idx.UnspentOutputsForScript(other)
+	if err != nil || len(utxos) != 1 || utxos[0].Amount != 2000 {
+		t.Fatalf("UnspentOutputsForScript: %+v, %v", utxos, err)
+	}
+
+	// Disconnecting the block restores the outputs before it.
+	update(func(dbTx database.Tx) error {
+		return idx.DisconnectBlock(dbTx, block3, stxos)
+	})
+	check(before)
+	utxos, err = idx.UnspentOutputsForScript(other)
+	if err != nil || len(utxos) != 0 {
+		t.Fatalf("UnspentOutputsForScript: %+v, %v", utxos, err)
+	}
+}
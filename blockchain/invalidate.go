@@ -0,0 +1,228 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// descendants returns the nodes in the block index which descend from the
+// passed node.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) descendants(node *blockNode) []*blockNode {
+	var nodes []*blockNode
+	b.index.RLock()
+	for _, n := range b.index.index {
+		if n.height > node.height && n.Ancestor(node.height) == node {
+			nodes = append(nodes, n)
+		}
+	}
+	b.index.RUnlock()
+	return nodes
+}
+
+// canActivate returns whether the chain ending at the passed node can become
+// the main chain, which requires the data of all of its blocks after the fork
+// point with the main chain to be available and none of them to be known to be
+// invalid.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) canActivate(node *blockNode) bool {
+	forkNode := b.bestChain.FindFork(node)
+	for n := node; n != nil && n != forkNode; n = n.parent {
+		status := b.index.NodeStatus(n)
+		if !status.HaveData() || status.KnownInvalid() {
+			return false
+		}
+	}
+	return true
+}
+
+// bestChainCandidates returns the nodes which have more cumulative work than
+// the current best chain tip and whose chains can become the main chain,
+// ordered by their cumulative work from the most to the least.  The nodes in
+// the passed exclusion set are not returned.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) bestChainCandidates(excluded map[*blockNode]struct{}) []*blockNode {
+	tip := b.bestChain.Tip()
+	var candidates []*blockNode
+	b.index.RLock()
+	for _, n := range b.index.index {
+		if n.workSum.Cmp(tip.workSum) <= 0 {
+			continue
+		}
+		if _, ok := excluded[n]; ok {
+			continue
+		}
+		candidates = append(candidates, n)
+	}
+	b.index.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].workSum.Cmp(candidates[j].workSum) > 0
+	})
+	usable := candidates[:0]
+	for _, n := range candidates {
+		if b.canActivate(n) {
+			usable = append(usable, n)
+		}
+	}
+	return usable
+}
+
+// activateBestChain reorganizes the chain to the valid chain with the most
+// cumulative work among the blocks which are available.  Chains which turn out
+// to be invalid while attempting to reorganize to them are skipped in favor of
+// the one with the next most work.
+//
+// This function may modify node statuses in the block index without flushing.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) activateBestChain() error {
+	excluded := make(map[*blockNode]struct{})
+	for {
+		candidates := b.bestChainCandidates(excluded)
+		if len(candidates) == 0 {
+			return nil
+		}
+		node := candidates[0]
+
+		detachNodes, attachNodes := b.getReorganizeNodes(node)
+		if attachNodes.Len() == 0 {
+			excluded[node] = struct{}{}
+			continue
+		}
+
+		log.Infof("REORGANIZE: Block %v is the tip of the valid chain "+
+			"with the most work", node.hash)
+		err := b.reorganizeChain(detachNodes, attachNodes)
+		if err != nil {
+			// The chain is not modified when a rule violation is
+			// detected, so try the chain with the next most work.
+			if _, ok := err.(RuleError); ok {
+				log.Warnf("Unable to reorganize to block %v: %v",
+					node.hash, err)
+				excluded[node] = struct{}{}
+				continue
+			}
+			return err
+		}
+	}
+}
+
+// InvalidateBlock manually marks the block with the passed hash and all of its
+// descendants as invalid.  When the block is part of the main chain, the chain
+// is reorganized away from it onto the valid chain with the most cumulative
+// work, which is the chain ending at its parent when there is no better one.
+//
+// The status of the blocks is persisted in the block index, so they remain
+// invalid across restarts until ReconsiderBlock is called.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is not known", hash)
+	}
+	if node.parent == nil {
+		return fmt.Errorf("block %s is the genesis block and can not be "+
+			"invalidated", hash)
+	}
+
+	// Mark the block and its descendants as invalid while keeping track
+	// of their previous status so it can be restored when the chain can't
+	// be reorganized away from the block.
+	prevStatus := make(map[*blockNode]blockStatus)
+	prevStatus[node] = b.index.NodeStatus(node)
+	b.index.SetStatusFlags(node, statusValidateFailed)
+	for _, n := range b.descendants(node) {
+		prevStatus[n] = b.index.NodeStatus(n)
+		b.index.SetStatusFlags(n, statusInvalidAncestor)
+	}
+
+	var err error
+	if b.bestChain.Contains(node) {
+		// Disconnect the block along with all of the blocks after it
+		// and then attach the best remaining valid chain.
+		detachNodes := list.New()
+		for n := b.bestChain.Tip(); n != node.parent; n = n.parent {
+			detachNodes.PushBack(n)
+		}
+		log.Infof("Invalidating block %v at height %d in the main chain",
+			node.hash, node.height)
+		err = b.reorganizeChain(detachNodes, list.New())
+		if err != nil && b.bestChain.Contains(node) {
+			for n, status := range prevStatus {
+				b.index.UnsetStatusFlags(n, statusValidateFailed|
+					statusInvalidAncestor)
+				b.index.SetStatusFlags(n, status)
+			}
+		}
+		if err == nil {
+			err = b.activateBestChain()
+		}
+	} else {
+		log.Infof("Invalidating block %v at height %d", node.hash,
+			node.height)
+	}
+
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v",
+			writeErr)
+		if err == nil {
+			err = writeErr
+		}
+	}
+	return err
+}
+
+// ReconsiderBlock removes the invalid status from the block with the passed
+// hash along with its ancestors and descendants, typically after it was marked
+// invalid by InvalidateBlock, and reorganizes the chain to the valid chain with
+// the most cumulative work.  Blocks which actually violate the rules are
+// marked invalid again once they are validated.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReconsiderBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return fmt.Errorf("block %s is not known", hash)
+	}
+
+	const invalidFlags = statusValidateFailed | statusInvalidAncestor
+	for n := node; n != nil; n = n.parent {
+		if b.index.NodeStatus(n).KnownInvalid() {
+			b.index.UnsetStatusFlags(n, invalidFlags)
+		}
+	}
+	for _, n := range b.descendants(node) {
+		if b.index.NodeStatus(n).KnownInvalid() {
+			b.index.UnsetStatusFlags(n, invalidFlags)
+		}
+	}
+	log.Infof("Reconsidering block %v at height %d", node.hash, node.height)
+
+	err := b.activateBestChain()
+	if writeErr := b.index.flushToDB(); writeErr != nil {
+		log.Warnf("Error flushing block index changes to disk: %v",
+			writeErr)
+		if err == nil {
+			err = writeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/database"
+)
+
+// TestInvalidateReconsiderBlock ensures manually invalidating a block of the
+// main chain reorganizes the chain away from it, that the invalid status is
+// persisted, and that reconsidering the block restores the chain.
+func TestInvalidateReconsiderBlock(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	chain, teardownFunc, err := chainSetup("invalidateblock",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+
+	for _, block := range blocks[1:] {
+		if _, _, err := chain.ProcessBlock(block, BFNone); err != nil {
+			t.Fatalf("ProcessBlock: %v", err)
+		}
+	}
+
+	checkTip := func(want int32) {
+		t.Helper()
+		best := chain.BestSnapshot()
+		if best.Height != want || best.Hash != *blocks[want].Hash() {
+			t.Fatalf("unexpected tip: got %v (height %d), want "+
+				"height %d", best.Hash, best.Height, want)
+		}
+	}
+	storedStatus := func(height int) blockStatus {
+		t.Helper()
+		var status blockStatus
+		err := chain.db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(blockIndexBucketName)
+			key := blockIndexKey(blocks[height].Hash(), uint32(height))
+			var err error
+			_, status, err = deserializeBlockRow(bucket.Get(key))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unable to load block index entry: %v", err)
+		}
+		return status
+	}
+
+	// The genesis block and unknown blocks can't be invalidated.
+	if err := chain.InvalidateBlock(blocks[0].Hash()); err == nil {
+		t.Fatal("InvalidateBlock: invalidated the genesis block")
+	}
+	unknown := *blocks[0].Hash()
+	unknown[0] ^= 0xff
+	if err := chain.InvalidateBlock(&unknown); err == nil {
+		t.Fatal("InvalidateBlock: invalidated an unknown block")
+	}
+
+	// Invalidate block 3 and ensure the chain is reorganized to block 2
+	// while blocks 3 and 4 are persisted as invalid.
+	if err := chain.InvalidateBlock(blocks[3].Hash()); err != nil {
+		t.Fatalf("InvalidateBlock: %v", err)
+	}
+	checkTip(2)
+	if status := storedStatus(3); status&statusValidateFailed == 0 {
+		t.Fatalf("block 3 not stored as invalid: %v", status)
+	}
+	if status := storedStatus(4); status&statusInvalidAncestor == 0 {
+		t.Fatalf("block 4 not stored with an invalid ancestor: %v",
+			status)
+	}
+	if storedStatus(2).KnownInvalid() {
+		t.Fatal("block 2 stored as invalid")
+	}
+	if !chain.IsKnownInvalid(blocks[4].Hash()) ||
+		chain.IsKnownInvalid(blocks[2].Hash()) ||
+		chain.IsKnownInvalid(&unknown) {
+
+		t.Fatal("IsKnownInvalid: unexpected validity of blocks")
+	}
+
+	// Reconsidering a descendant of the invalid block also reconsiders
+	// the block itself and restores the chain.
+	if err := chain.ReconsiderBlock(blocks[4].Hash()); err != nil {
+		t.Fatalf("ReconsiderBlock: %v", err)
+	}
+	checkTip(4)
+	for height := 3; height <= 4; height++ {
+		if storedStatus(height).KnownInvalid() {
+			t.Fatalf("block %d still stored as invalid", height)
+		}
+	}
+
+	// Invalidating the tip reorganizes the chain to its parent.
+	if err := chain.InvalidateBlock(blocks[4].Hash()); err != nil {
+		t.Fatalf("InvalidateBlock: %v", err)
+	}
+	checkTip(3)
+	if err := chain.ReconsiderBlock(blocks[4].Hash()); err != nil {
+		t.Fatalf("ReconsiderBlock: %v", err)
+	}
+	checkTip(4)
+}
@@ -154,6 +154,39 @@ func BuildMerkleTreeStore(transactions []*btcutil.Tx, witness bool) []*chainhash
 	return merkles
 }
 
+// BuildMerkleBranch returns the merkle branch of the first of the passed
+// transactions, which are the hashes its hash has to be combined with in order
+// to calculate the merkle root of all of them.  The hash of the first
+// transaction is always the left node and is not used to build the branch, so
+// mining software is able to change the coinbase transaction and recalculate
+// the merkle root without access to the other transactions.
+func BuildMerkleBranch(transactions []*btcutil.Tx) []*chainhash.Hash {
+	if len(transactions) <= 1 {
+		return nil
+	}
+
+	// Each level of the merkle tree is reduced while keeping a placeholder
+	// for the node which contains the first transaction.
+	level := make([]*chainhash.Hash, len(transactions))
+	for i, tx := range transactions[1:] {
+		level[i+1] = tx.Hash()
+	}
+	var branch []*chainhash.Hash
+	for len(level) > 1 {
+		branch = append(branch, level[1])
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([]*chainhash.Hash, 1, len(level)/2)
+		for i := 2; i < len(level); i += 2 {
+			next = append(next, HashMerkleBranches(level[i],
+				level[i+1]))
+		}
+		level = next
+	}
+	return branch
+}
+
 // ExtractWitnessCommitment attempts to locate, and return the witness
 // commitment for a block. The witness commitment is of the form:
 // SHA256(witness root || witness nonce). The function additionally returns a
@@ -7,6 +7,7 @@ package blockchain
 import (
 	"testing"
 
+	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 )
 
@@ -21,3 +22,40 @@ func TestMerkle(t *testing.T) {
 			"got %v, want %v", calculatedMerkleRoot, wantMerkle)
 	}
 }
+
+// TestMerkleBranch ensures the merkle root calculated from the merkle branch of
+// the first transaction matches the merkle root of all transactions, even when
+// the first transaction is changed.
+func TestMerkleBranch(t *testing.T) {
+	// Reuse the transactions of the test block to build blocks with up to
+	// twelve transactions.
+	var msgTxns []*wire.MsgTx
+	for i := 0; len(msgTxns) < 12; i++ {
+		tx := Block100000.Transactions[i%len(Block100000.Transactions)].Copy()
+		tx.LockTime = uint32(i)
+		msgTxns = append(msgTxns, tx)
+	}
+
+	for numTxns := 1; numTxns <= len(msgTxns); numTxns++ {
+		txns := btcutil.NewBlock(&wire.MsgBlock{
+			Transactions: msgTxns[:numTxns],
+		}).Transactions()
+		branch := BuildMerkleBranch(txns)
+
+		// Replace the first transaction after building the branch.
+		first := msgTxns[0].Copy()
+		first.LockTime = 0xffffffff
+		txns[0] = btcutil.NewTx(first)
+		merkles := BuildMerkleTreeStore(txns, false)
+		want := merkles[len(merkles)-1]
+
+		got := txns[0].Hash()
+		for _, hash := range branch {
+			got = HashMerkleBranches(got, hash)
+		}
+		if !got.IsEqual(want) {
+			t.Errorf("BuildMerkleBranch: merkle root mismatch for %d "+
+				"transactions - got %v, want %v", numTxns, got, want)
+		}
+	}
+}
@@ -6,6 +6,9 @@ package blockchain
 
 import (
 	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
 // NotificationType represents the type of a notification message.
@@ -29,6 +32,17 @@ const (
 	// NTBlockDisconnected indicates the associated block was disconnected
 	// from the main chain.
 	NTBlockDisconnected
+
+	// NTReorganization indicates the main chain was reorganized.  It is
+	// sent after the notifications of the disconnected and connected
+	// blocks.
+	NTReorganization
+
+	// NTReorganizationStarted indicates the main chain is about to be
+	// reorganized.  It is sent before the notifications of the disconnected
+	// and connected blocks once the blocks to connect passed the checks
+	// which are done before the main chain is modified.
+	NTReorganizationStarted
 )
 
 // notificationTypeStrings is a map of notification types back to their constant
@@ -37,6 +51,9 @@ var notificationTypeStrings = map[NotificationType]string{
 	NTBlockAccepted:     "NTBlockAccepted",
 	NTBlockConnected:    "NTBlockConnected",
 	NTBlockDisconnected: "NTBlockDisconnected",
+	NTReorganization:    "NTReorganization",
+
+	NTReorganizationStarted: "NTReorganizationStarted",
 }
 
 // String returns the NotificationType in human-readable form.
@@ -53,11 +70,46 @@ func (n NotificationType) String() string {
 // 	- NTBlockAccepted:     *btcutil.Block
 // 	- NTBlockConnected:    *btcutil.Block
 // 	- NTBlockDisconnected: *btcutil.Block
+// 	- NTReorganization:    *Reorganization
+// 	- NTReorganizationStarted: *Reorganization
 type Notification struct {
 	Type NotificationType
 	Data interface{}
 }
 
+// Reorganization describes a reorganization of the main chain.  It is the data
+// of NTReorganizationStarted and NTReorganization notifications.
+type Reorganization struct {
+	// ForkHash and ForkHeight identify the last block the old and new main
+	// chains have in common.
+	ForkHash   chainhash.Hash
+	ForkHeight int32
+
+	// OldTipHash and OldTipHeight identify the tip of the main chain before
+	// the reorganization.
+	OldTipHash   chainhash.Hash
+	OldTipHeight int32
+
+	// NewTipHash and NewTipHeight identify the tip of the main chain after
+	// the reorganization.
+	NewTipHash   chainhash.Hash
+	NewTipHeight int32
+
+	// DetachedBlocks and AttachedBlocks are the number of blocks which were
+	// disconnected from and connected to the main chain.
+	DetachedBlocks int
+	AttachedBlocks int
+
+	// DetachedTxns and AttachedTxns are the number of transactions in the
+	// disconnected and connected blocks.
+	DetachedTxns int
+	AttachedTxns int
+
+	// Time is when the reorganization completed, or when it started for
+	// NTReorganizationStarted notifications.
+	Time time.Time
+}
+
 // Subscribe to block chain notifications. Registers a callback to be executed
 // when various events take place. See the documentation on Notification and
 // NotificationType for details on the types and contents of notifications.
@@ -67,9 +119,8 @@ func (b *BlockChain) Subscribe(callback NotificationCallback) {
 	b.notificationsLock.Unlock()
 }
 
-// sendNotification sends a notification with the passed type and data if the
-// caller requested notifications by providing a callback function in the call
-// to New.
+// sendNotification sends a notification with the passed type and data to the
+// registered callbacks and typed subscriptions.
 func (b *BlockChain) sendNotification(typ NotificationType, data interface{}) {
 	// Generate and send the notification.
 	n := Notification{Type: typ, Data: data}
@@ -78,4 +129,6 @@ func (b *BlockChain) sendNotification(typ NotificationType, data interface{}) {
 		callback(&n)
 	}
 	b.notificationsLock.RUnlock()
+
+	b.publishNotification(&n)
 }
@@ -118,7 +118,7 @@ func (b *BlockChain) processOrphans(hash *chainhash.Hash, flags BehaviorFlags) e
 
 			// Remove the orphan from the orphan pool.
 			orphanHash := orphan.block.Hash()
-			b.removeOrphanBlock(orphan)
+			b.removeOrphanBlock(orphan, orphanConnected)
 			i--
 
 			// Potentially accept the block into the block chain.
@@ -251,6 +251,13 @@ func (b *BlockChain) ProcessBlock(block *btcutil.Block, flags BehaviorFlags) (bo
 		return false, false, err
 	}
 
+	// Prune the blocks which are now buried deeply enough.  Failing to do
+	// so does not affect the validity of the block, so the error is only
+	// logged.
+	if err := b.maybePruneBlocks(); err != nil {
+		log.Errorf("Failed to prune blocks: %v", err)
+	}
+
 	log.Debugf("Accepted block %v", blockHash)
 
 	return isMainChain, false, nil
@@ -0,0 +1,157 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/database"
+)
+
+const (
+	// MinPruneDepth is the minimum number of blocks below the best chain
+	// tip whose data is retained when pruning is enabled.  The retained
+	// blocks and their spend journal entries allow reorganizations up to
+	// that depth.
+	MinPruneDepth = 288
+
+	// pruneInterval is the minimum number of blocks which have to be
+	// buried deeply enough before they are pruned.  Blocks are pruned in
+	// batches since pruning flushes the utxo cache and the database has to
+	// find the block files which are no longer in use.
+	pruneInterval = 1000
+
+	// pruneBatchSize is the maximum number of blocks which are pruned in a
+	// single database transaction.
+	pruneBatchSize = 10000
+)
+
+var (
+	// prunedHeightKeyName is the name of the db key used to store the
+	// height of the most recent block of the main chain which has been
+	// pruned.
+	prunedHeightKeyName = []byte("prunedheight")
+)
+
+// dbFetchPrunedHeight uses an existing database transaction to fetch the
+// height of the most recent block which has been pruned.  It returns zero when
+// no blocks have been pruned.
+func dbFetchPrunedHeight(dbTx database.Tx) int32 {
+	serialized := dbTx.Metadata().Get(prunedHeightKeyName)
+	if len(serialized) != 4 {
+		return 0
+	}
+	return int32(byteOrder.Uint32(serialized))
+}
+
+// dbPutPrunedHeight uses an existing database transaction to store the height
+// of the most recent block which has been pruned.
+func dbPutPrunedHeight(dbTx database.Tx, height int32) error {
+	var serialized [4]byte
+	byteOrder.PutUint32(serialized[:], uint32(height))
+	return dbTx.Metadata().Put(prunedHeightKeyName, serialized[:])
+}
+
+// PrunedHeight returns the height of the most recent block of the main chain
+// whose data has been pruned.  The blocks at or below it are no longer
+// available, while their effects on the utxo set are retained.  It returns zero
+// when no blocks have been pruned.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PrunedHeight() int32 {
+	b.chainLock.RLock()
+	prunedHeight := b.prunedHeight
+	b.chainLock.RUnlock()
+	return prunedHeight
+}
+
+// maybePruneBlocks prunes the blocks of the main chain which are buried more
+// than the prune depth below the best chain tip once enough of them have
+// accumulated.  Blocks are not pruned while the blocks before a loaded utxo
+// set snapshot are validated in the background.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) maybePruneBlocks() error {
+	if b.pruneDepth == 0 || b.snapshotValidation != nil {
+		return nil
+	}
+
+	pruneHeight := b.bestChain.Tip().height - b.pruneDepth
+	if pruneHeight-b.prunedHeight < pruneInterval {
+		return nil
+	}
+	return b.pruneBlocks(pruneHeight)
+}
+
+// pruneBlocks deletes the data of the blocks of the main chain after the most
+// recently pruned block up to and including the passed height along with their
+// spend journal entries.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) pruneBlocks(height int32) error {
+	if height >= b.bestChain.Tip().height {
+		return AssertError(fmt.Sprintf("pruneBlocks called with height "+
+			"%d which is not below the best chain tip", height))
+	}
+
+	// The utxo set in the database must not rely on replaying the pruned
+	// blocks when it is recovered after an unclean shutdown, so the cache
+	// is flushed first.
+	err := b.utxoCache.flush(FlushRequired, &b.bestChain.Tip().hash)
+	if err != nil {
+		return err
+	}
+
+	for b.prunedHeight < height {
+		batchHeight := b.prunedHeight + pruneBatchSize
+		if batchHeight > height {
+			batchHeight = height
+		}
+
+		// Only the blocks which have their data stored are deleted since
+		// the blocks before a loaded utxo set snapshot might not be
+		// available.
+		var nodes []*blockNode
+		for h := b.prunedHeight + 1; h <= batchHeight; h++ {
+			node := b.bestChain.NodeByHeight(h)
+			if b.index.NodeStatus(node).HaveData() {
+				nodes = append(nodes, node)
+			}
+		}
+
+		// Update the status of the nodes along with deleting their data
+		// so the block index never claims data which is not available.
+		for _, node := range nodes {
+			b.index.UnsetStatusFlags(node, statusDataStored)
+		}
+		err := b.db.Update(func(dbTx database.Tx) error {
+			for _, node := range nodes {
+				if err := dbTx.DeleteBlock(&node.hash); err != nil {
+					return err
+				}
+				err := b.removeSpendJournalEntry(dbTx, &node.hash)
+				if err != nil {
+					return err
+				}
+				if err := dbStoreBlockNode(dbTx, node); err != nil {
+					return err
+				}
+			}
+			return dbPutPrunedHeight(dbTx, batchHeight)
+		})
+		if err != nil {
+			for _, node := range nodes {
+				b.index.SetStatusFlags(node, statusDataStored)
+			}
+			return err
+		}
+
+		log.Infof("Pruned %d blocks up to height %d", len(nodes),
+			batchHeight)
+		b.prunedHeight = batchHeight
+	}
+
+	return nil
+}
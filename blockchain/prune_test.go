@@ -0,0 +1,113 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// TestPruneBlocks ensures pruning deletes the data of the blocks buried deeply
+// enough along with their spend journal entries while retaining the rest of
+// the chain.
+func TestPruneBlocks(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	chain, teardownFunc, err := chainSetup("pruneblocks",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+
+	// Blocks must not be pruned until enough of them are buried deeply
+	// enough.
+	chain.pruneDepth = 2
+	for _, block := range blocks[1:] {
+		if _, _, err := chain.ProcessBlock(block, BFNone); err != nil {
+			t.Fatalf("ProcessBlock: %v", err)
+		}
+	}
+	if height := chain.PrunedHeight(); height != 0 {
+		t.Fatalf("PrunedHeight: got %d before the prune interval", height)
+	}
+
+	// Prune the blocks up to height 2.
+	chain.chainLock.Lock()
+	err = chain.pruneBlocks(2)
+	chain.chainLock.Unlock()
+	if err != nil {
+		t.Fatalf("pruneBlocks: %v", err)
+	}
+	checkPruned := func(chain *BlockChain) {
+		t.Helper()
+
+		if height := chain.PrunedHeight(); height != 2 {
+			t.Fatalf("PrunedHeight: got %d, want 2", height)
+		}
+		for i, block := range blocks[1:] {
+			height := int32(i + 1)
+			pruned := height <= 2
+			node := chain.index.LookupNode(block.Hash())
+			if chain.index.NodeStatus(node).HaveData() == pruned {
+				t.Fatalf("block %d: unexpected data status", height)
+			}
+			_, err := chain.BlockByHash(block.Hash())
+			if (err != nil) != pruned {
+				t.Fatalf("BlockByHash %d: unexpected error %v",
+					height, err)
+			}
+			if !pruned {
+				continue
+			}
+			err = chain.db.View(func(dbTx database.Tx) error {
+				bucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+				if bucket.Get(block.Hash()[:]) != nil {
+					t.Errorf("block %d: spend journal entry "+
+						"not removed", height)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("View: %v", err)
+			}
+		}
+	}
+	checkPruned(chain)
+
+	// The pruned state must be loaded by a new instance.
+	if err := chain.FlushUtxoCache(FlushRequired); err != nil {
+		t.Fatalf("FlushUtxoCache: %v", err)
+	}
+	chain, err = New(&Config{
+		DB:          chain.db,
+		ChainParams: chain.chainParams,
+		TimeSource:  NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+		PruneDepth:  MinPruneDepth,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	checkPruned(chain)
+
+	// Prune depths below the minimum must be rejected.
+	_, err = New(&Config{
+		DB:          chain.db,
+		ChainParams: chain.chainParams,
+		TimeSource:  NewMedianTime(),
+		PruneDepth:  MinPruneDepth - 1,
+	})
+	if err == nil {
+		t.Fatal("New: accepted prune depth below the minimum")
+	}
+}
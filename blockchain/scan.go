@@ -0,0 +1,144 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcutil"
+)
+
+// ScanToken identifies the last block processed by a scan of the main chain so
+// the scan can be resumed with ResumeScan, even after the block was disconnected
+// by a reorganization.
+type ScanToken struct {
+	Height int32
+	Hash   chainhash.Hash
+}
+
+// ScannedBlock describes a block visited by a scan of the main chain.
+type ScannedBlock struct {
+	// Block is the scanned block with its height set.
+	Block *btcutil.Block
+
+	// Matches are the transactions of the block accepted by the filter of
+	// the scan, in block order.
+	Matches []*btcutil.Tx
+
+	// Reorged is set when blocks which were previously scanned at the
+	// height of this block or later were disconnected by a reorganization
+	// before it, so the results for them must be discarded.
+	Reorged bool
+}
+
+// ScanBlocks visits the blocks of the main chain from the passed start height
+// through the passed end height, or the current best height when it is lower or
+// negative, and invokes the passed callback with the transactions of each block
+// the passed filter accepts.  A nil filter accepts no transactions.
+//
+// Reorganizations which happen during the scan are detected before each block:
+// the scan continues after the fork point and the next block is marked as
+// Reorged.  The token of the last block the callback completed without error is
+// returned, also when the callback returns an error to stop the scan, so the
+// scan can be continued with ResumeScan later.  It is nil when no block was
+// completed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ScanBlocks(start, end int32, filter func(*btcutil.Tx) bool,
+	fn func(*ScannedBlock) error) (*ScanToken, error) {
+
+	if start < 0 {
+		return nil, fmt.Errorf("invalid scan start height %d", start)
+	}
+
+	// Anchor the scan at the parent of the start block so a reorganization
+	// before the first block is detected as well.
+	var last *ScanToken
+	if start > 0 {
+		parent := b.bestChain.NodeByHeight(start - 1)
+		if parent == nil {
+			str := fmt.Sprintf("no block at height %d exists", start-1)
+			return nil, errNotInMainChain(str)
+		}
+		last = &ScanToken{Height: parent.height, Hash: parent.hash}
+	}
+	token, err := b.scanBlocks(last, end, filter, fn)
+	if token == last {
+		token = nil
+	}
+	return token, err
+}
+
+// ResumeScan continues a scan started by ScanBlocks after the block the passed
+// token refers to.  When that block is no longer part of the main chain, the
+// scan resumes after the fork point and the first block is marked as Reorged.
+// See ScanBlocks for the remaining semantics.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ResumeScan(token *ScanToken, end int32, filter func(*btcutil.Tx) bool,
+	fn func(*ScannedBlock) error) (*ScanToken, error) {
+
+	if b.index.LookupNode(&token.Hash) == nil {
+		return nil, fmt.Errorf("unknown scan block %v", token.Hash)
+	}
+	return b.scanBlocks(token, end, filter, fn)
+}
+
+// scanBlocks visits the main chain blocks after the block the passed token
+// refers to, or from the genesis block when it is nil, through the passed end
+// height and returns the token of the last visited block.
+func (b *BlockChain) scanBlocks(last *ScanToken, end int32, filter func(*btcutil.Tx) bool,
+	fn func(*ScannedBlock) error) (*ScanToken, error) {
+
+	for {
+		// Continue after the last scanned block when it is still part
+		// of the main chain and after the fork point otherwise.
+		next := int32(0)
+		reorged := false
+		if last != nil {
+			lastNode := b.index.LookupNode(&last.Hash)
+			fork := b.bestChain.FindFork(lastNode)
+			if fork == nil {
+				return last, AssertError(fmt.Sprintf("scan block "+
+					"%v does not share an ancestor with the "+
+					"main chain", last.Hash))
+			}
+			reorged = fork != lastNode
+			next = fork.height + 1
+		}
+		if end >= 0 && next > end {
+			return last, nil
+		}
+		node := b.bestChain.NodeByHeight(next)
+		if node == nil {
+			return last, nil
+		}
+
+		var block *btcutil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, node)
+			return err
+		})
+		if err != nil {
+			return last, err
+		}
+
+		scanned := &ScannedBlock{Block: block, Reorged: reorged}
+		if filter != nil {
+			for _, tx := range block.Transactions() {
+				if filter(tx) {
+					scanned.Matches = append(scanned.Matches, tx)
+				}
+			}
+		}
+		if err := fn(scanned); err != nil {
+			return last, err
+		}
+		last = &ScanToken{Height: node.height, Hash: node.hash}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestScanBlocks ensures scans visit the main chain blocks in order, detect
+// reorganizations during the scan and can be resumed.
+func TestScanBlocks(t *testing.T) {
+	// Load up blocks such that there is a side chain which becomes the
+	// main chain once 4a is processed.
+	// (genesis block) -> 1 -> 2 -> 3 -> 4
+	//                          \-> 3a -> 4a
+	var blocks []*btcutil.Block
+	for _, file := range []string{"blk_0_to_4.dat.bz2", "blk_3A.dat.bz2",
+		"blk_4A.dat.bz2"} {
+
+		blockTmp, err := loadBlocks(file)
+		if err != nil {
+			t.Fatalf("Error loading file: %v\n", err)
+		}
+		blocks = append(blocks, blockTmp...)
+	}
+
+	chain, teardownFunc, err := chainSetup("scanblocks",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+	for i := 1; i <= 3; i++ {
+		if _, _, err := chain.ProcessBlock(blocks[i], BFNone); err != nil {
+			t.Fatalf("ProcessBlock fail on block %d: %v", i, err)
+		}
+	}
+
+	// Scan the chain and reorganize it to the side chain once block 3 was
+	// scanned.  The scan must continue with block 3a.
+	type visit struct {
+		height  int32
+		reorged bool
+	}
+	var visits []visit
+	coinbaseOnly := func(tx *btcutil.Tx) bool { return IsCoinBase(tx) }
+	token, err := chain.ScanBlocks(1, -1, coinbaseOnly, func(sb *ScannedBlock) error {
+		if len(sb.Matches) != 1 || !IsCoinBase(sb.Matches[0]) {
+			t.Fatalf("block %d has unexpected matches %v",
+				sb.Block.Height(), sb.Matches)
+		}
+		visits = append(visits, visit{sb.Block.Height(), sb.Reorged})
+		if *sb.Block.Hash() == *blocks[3].Hash() {
+			for _, block := range blocks[5:] {
+				_, _, err := chain.ProcessBlock(block, BFNone)
+				if err != nil {
+					t.Fatalf("ProcessBlock fail: %v", err)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ScanBlocks: %v", err)
+	}
+	want := []visit{{1, false}, {2, false}, {3, false}, {3, true}, {4, false}}
+	if len(visits) != len(want) {
+		t.Fatalf("scan visited %v, want %v", visits, want)
+	}
+	for i := range want {
+		if visits[i] != want[i] {
+			t.Fatalf("scan visited %v, want %v", visits, want)
+		}
+	}
+	if token.Hash != *blocks[len(blocks)-1].Hash() || token.Height != 4 {
+		t.Fatalf("scan ended at %v (%d)", token.Hash, token.Height)
+	}
+
+	// Stop a scan after the first block and resume it.
+	errStop := errors.New("stop")
+	token, err = chain.ScanBlocks(1, 2, nil, func(sb *ScannedBlock) error {
+		if sb.Block.Height() == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || token == nil || token.Height != 1 {
+		t.Fatalf("stopped scan returned token %v, error %v", token, err)
+	}
+	var heights []int32
+	token, err = chain.ResumeScan(token, -1, nil, func(sb *ScannedBlock) error {
+		heights = append(heights, sb.Block.Height())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ResumeScan: %v", err)
+	}
+	if len(heights) != 3 || heights[0] != 2 || token.Height != 4 {
+		t.Fatalf("resumed scan visited %v and ended at %d", heights,
+			token.Height)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// ScriptWorkerPinningSupported reports whether the script validation workers
+// can be pinned to CPUs on this platform.
+const ScriptWorkerPinningSupported = true
+
+// pinThreadToCPU restricts the thread of the calling goroutine to the passed
+// CPU.  The goroutine must be locked to its thread.
+func pinThreadToCPU(cpu int) error {
+	var mask [16]uint64
+	if cpu < 0 || cpu >= len(mask)*64 {
+		return syscall.EINVAL
+	}
+	mask[cpu/64] |= 1 << uint(cpu%64)
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0,
+		uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package blockchain
+
+import (
+	"errors"
+)
+
+// ScriptWorkerPinningSupported reports whether the script validation workers
+// can be pinned to CPUs on this platform.
+const ScriptWorkerPinningSupported = false
+
+// pinThreadToCPU always returns an error since pinning threads to CPUs is not
+// supported on this platform.
+func pinThreadToCPU(cpu int) error {
+	return errors.New("pinning threads to CPUs is not supported on this " +
+		"platform")
+}
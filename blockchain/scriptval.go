@@ -8,6 +8,9 @@ import (
 	"fmt"
 	"math"
 	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/btcsuite/btcd/txscript"
@@ -23,171 +26,437 @@ type txValidateItem struct {
 	sigHashes *txscript.TxSigHashes
 }
 
-// txValidator provides a type which asynchronously validates transaction
-// inputs.  It provides several channels for communication and a processing
-// function that is intended to be in run multiple goroutines.
-type txValidator struct {
-	validateChan chan *txValidateItem
-	quitChan     chan struct{}
-	resultChan   chan error
-	utxoView     *UtxoViewpoint
-	flags        txscript.ScriptFlags
-	sigCache     *txscript.SigCache
-	hashCache    *txscript.HashCache
+// sigOpValidationCost is the expected cost of checking a single signature
+// relative to processing a single byte of script.  It is only used to order the
+// inputs of a batch so the most expensive ones are validated first.
+const sigOpValidationCost = 500
+
+// ScriptSchedule identifies how the goroutines which validate the scripts of
+// the inputs of a block are scheduled.
+type ScriptSchedule int
+
+const (
+	// ScriptSchedulePool validates the scripts with a persistent pool of
+	// workers.  The workers which are idle join the validation of a block,
+	// so concurrent validations share the workers.
+	ScriptSchedulePool ScriptSchedule = iota
+
+	// ScriptSchedulePerBlock starts the workers for every block and stops
+	// them once the scripts of the block are validated, so every block is
+	// validated with all of the workers.
+	ScriptSchedulePerBlock
+)
+
+// scriptScheduleStrings is a map of ScriptSchedule values back to their
+// names for pretty printing.
+var scriptScheduleStrings = map[ScriptSchedule]string{
+	ScriptSchedulePool:     "pool",
+	ScriptSchedulePerBlock: "perblock",
 }
 
-// sendResult sends the result of a script pair validation on the internal
-// result channel while respecting the quit channel.  This allows orderly
-// shutdown when the validation process is aborted early due to a validation
-// error in one of the other goroutines.
-func (v *txValidator) sendResult(result error) {
-	select {
-	case v.resultChan <- result:
-	case <-v.quitChan:
+// String returns the ScriptSchedule as a human-readable name.
+func (s ScriptSchedule) String() string {
+	if str := scriptScheduleStrings[s]; str != "" {
+		return str
 	}
+	return fmt.Sprintf("Unknown ScriptSchedule (%d)", int(s))
 }
 
-// validateHandler consumes items to validate from the internal validate channel
-// and returns the result of the validation on the internal result channel. It
-// must be run as a goroutine.
-func (v *txValidator) validateHandler() {
-out:
-	for {
-		select {
-		case txVI := <-v.validateChan:
-			// Ensure the referenced input utxo is available.
-			txIn := txVI.txIn
-			utxo := v.utxoView.LookupEntry(txIn.PreviousOutPoint)
-			if utxo == nil {
-				str := fmt.Sprintf("unable to find unspent "+
-					"output %v referenced from "+
-					"transaction %s:%d",
-					txIn.PreviousOutPoint, txVI.tx.Hash(),
-					txVI.txInIndex)
-				err := ruleError(ErrMissingTxOut, str)
-				v.sendResult(err)
-				break out
-			}
+// ParseScriptSchedule returns the script schedule described by the passed
+// string as returned by its String method.
+func ParseScriptSchedule(s string) (ScriptSchedule, error) {
+	for schedule, str := range scriptScheduleStrings {
+		if s == str {
+			return schedule, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown script schedule %q", s)
+}
 
-			// Create a new script engine for the script pair.
-			sigScript := txIn.SignatureScript
-			witness := txIn.Witness
-			pkScript := utxo.PkScript()
-			inputAmount := utxo.Amount()
-			vm, err := txscript.NewEngine(pkScript, txVI.tx.MsgTx(),
-				txVI.txInIndex, v.flags, v.sigCache, txVI.sigHashes,
-				inputAmount)
-			if err != nil {
-				str := fmt.Sprintf("failed to parse input "+
-					"%s:%d which references output %v - "+
-					"%v (input witness %x, input script "+
-					"bytes %x, prev output script bytes %x)",
-					txVI.tx.Hash(), txVI.txInIndex,
-					txIn.PreviousOutPoint, err, witness,
-					sigScript, pkScript)
-				err := ruleError(ErrScriptMalformed, str)
-				v.sendResult(err)
-				break out
-			}
+// ScriptValidationStats describes the configuration and the activity of the
+// goroutines which validate scripts.
+type ScriptValidationStats struct {
+	// Workers is the number of workers, Schedule is how they are scheduled
+	// and PinnedCPUs are the CPUs the workers are pinned to, if any.
+	Workers    int
+	Schedule   ScriptSchedule
+	PinnedCPUs []int
+
+	// QueueDepth is the number of inputs which are waiting to be
+	// validated and BusyWorkers is the number of goroutines which are
+	// validating inputs, including the ones requesting the validations.
+	QueueDepth  int64
+	BusyWorkers int32
+
+	// Batches and Inputs are the total number of validations requested
+	// and inputs validated since the pool was created.
+	Batches uint64
+	Inputs  uint64
+}
 
-			// Execute the script pair.
-			if err := vm.Execute(); err != nil {
-				str := fmt.Sprintf("failed to validate input "+
-					"%s:%d which references output %v - "+
-					"%v (input witness %x, input script "+
-					"bytes %x, prev output script bytes %x)",
-					txVI.tx.Hash(), txVI.txInIndex,
-					txIn.PreviousOutPoint, err, witness,
-					sigScript, pkScript)
-				err := ruleError(ErrScriptValidation, str)
-				v.sendResult(err)
-				break out
-			}
+// DefaultScriptValidationWorkers returns the default number of goroutines
+// which validate scripts in parallel.  It is based on the number of processor
+// cores, which helps ensure the system stays reasonably responsive under heavy
+// load.
+func DefaultScriptValidationWorkers() int {
+	workers := runtime.NumCPU() * 3
+	if workers <= 0 {
+		workers = 1
+	}
+	return workers
+}
+
+// defaultScriptPool is the script validation pool which is shared by the
+// chain instances which do not configure their own pool size as well as by
+// ValidateTransactionScripts.  It is created the first time it is needed.
+var (
+	defaultScriptPool     *scriptValidatorPool
+	defaultScriptPoolOnce sync.Once
+)
 
-			// Validation succeeded.
-			v.sendResult(nil)
+// sharedScriptPool returns the default script validation pool, creating it
+// when needed.
+func sharedScriptPool() *scriptValidatorPool {
+	defaultScriptPoolOnce.Do(func() {
+		defaultScriptPool = newScriptValidatorPool(
+			DefaultScriptValidationWorkers(), ScriptSchedulePool, nil)
+	})
+	return defaultScriptPool
+}
+
+// scriptValidationBatch houses the state of a single call to validate the
+// scripts of a set of transaction inputs.  The goroutines working on a batch
+// claim the inputs in order until all of them are claimed or one of them
+// failed to validate.
+type scriptValidationBatch struct {
+	next     int32 // atomic, index of the next item to claim
+	canceled int32 // atomic, set once an input failed to validate
+
+	items    []*txValidateItem
+	utxoView *UtxoViewpoint
+	flags    txscript.ScriptFlags
+	sigCache *txscript.SigCache
+	pool     *scriptValidatorPool
+
+	errOnce sync.Once
+	err     error
+	wg      sync.WaitGroup
+}
 
-		case <-v.quitChan:
-			break out
+// validate claims and validates the inputs of the batch until there are no
+// inputs left or the batch has been canceled.  The first validation error
+// cancels the batch so the other goroutines stop claiming inputs.
+func (b *scriptValidationBatch) validate() {
+	atomic.AddInt32(&b.pool.busy, 1)
+	defer atomic.AddInt32(&b.pool.busy, -1)
+
+	for atomic.LoadInt32(&b.canceled) == 0 {
+		i := int(atomic.AddInt32(&b.next, 1)) - 1
+		if i >= len(b.items) {
+			return
+		}
+		atomic.AddInt64(&b.pool.queued, -1)
+		atomic.AddUint64(&b.pool.inputs, 1)
+
+		err := validateTxIn(b.items[i], b.utxoView, b.flags, b.sigCache)
+		if err != nil {
+			b.errOnce.Do(func() {
+				b.err = err
+				atomic.StoreInt32(&b.canceled, 1)
+			})
+			return
 		}
 	}
 }
 
-// Validate validates the scripts for all of the passed transaction inputs using
-// multiple goroutines.
-func (v *txValidator) Validate(items []*txValidateItem) error {
-	if len(items) == 0 {
-		return nil
+// validateTxIn validates the script of the passed transaction input against the
+// output it references in the passed view.
+func validateTxIn(txVI *txValidateItem, utxoView *UtxoViewpoint,
+	flags txscript.ScriptFlags, sigCache *txscript.SigCache) error {
+
+	// Ensure the referenced input utxo is available.
+	txIn := txVI.txIn
+	utxo := utxoView.LookupEntry(txIn.PreviousOutPoint)
+	if utxo == nil {
+		str := fmt.Sprintf("unable to find unspent output %v "+
+			"referenced from transaction %s:%d",
+			txIn.PreviousOutPoint, txVI.tx.Hash(), txVI.txInIndex)
+		return ruleError(ErrMissingTxOut, str)
+	}
+
+	// Create a new script engine for the script pair.
+	sigScript := txIn.SignatureScript
+	witness := txIn.Witness
+	pkScript := utxo.PkScript()
+	inputAmount := utxo.Amount()
+	vm, err := txscript.NewEngine(pkScript, txVI.tx.MsgTx(),
+		txVI.txInIndex, flags, sigCache, txVI.sigHashes, inputAmount)
+	if err != nil {
+		str := fmt.Sprintf("failed to parse input %s:%d which "+
+			"references output %v - %v (input witness %x, input "+
+			"script bytes %x, prev output script bytes %x)",
+			txVI.tx.Hash(), txVI.txInIndex, txIn.PreviousOutPoint,
+			err, witness, sigScript, pkScript)
+		return ruleError(ErrScriptMalformed, str)
+	}
+
+	// Execute the script pair and release the engine so its buffers are
+	// reused by the validation of later inputs.
+	err = vm.Execute()
+	vm.Release()
+	if err != nil {
+		str := fmt.Sprintf("failed to validate input %s:%d which "+
+			"references output %v - %v (input witness %x, input "+
+			"script bytes %x, prev output script bytes %x)",
+			txVI.tx.Hash(), txVI.txInIndex, txIn.PreviousOutPoint,
+			err, witness, sigScript, pkScript)
+		return ruleError(ErrScriptValidation, str)
+	}
+
+	return nil
+}
+
+// txInValidationCost returns the expected relative cost of validating the
+// script of the passed transaction input, which is dominated by the number of
+// signatures it checks.  Inputs which reference unknown outputs are assigned
+// the highest cost since they fail right away and cancel the whole batch.
+func txInValidationCost(txVI *txValidateItem, utxoView *UtxoViewpoint) int {
+	txIn := txVI.txIn
+	utxo := utxoView.LookupEntry(txIn.PreviousOutPoint)
+	if utxo == nil {
+		return math.MaxInt32
+	}
+
+	pkScript := utxo.PkScript()
+	numSigOps := txscript.GetPreciseSigOpCount(txIn.SignatureScript,
+		pkScript, true)
+	numSigOps += txscript.GetWitnessSigOpCount(txIn.SignatureScript,
+		pkScript, txIn.Witness)
+
+	cost := numSigOps*sigOpValidationCost + len(txIn.SignatureScript) +
+		len(pkScript)
+	for _, item := range txIn.Witness {
+		cost += len(item)
 	}
+	return cost
+}
 
-	// Limit the number of goroutines to do script validation based on the
-	// number of processor cores.  This helps ensure the system stays
-	// reasonably responsive under heavy load.
-	maxGoRoutines := runtime.NumCPU() * 3
-	if maxGoRoutines <= 0 {
-		maxGoRoutines = 1
+// sortByValidationCost sorts the passed items in place so the inputs which are
+// expected to be the most expensive to validate come first.  Starting with them
+// keeps a single expensive input from being validated alone after all of the
+// others are done, and surfaces invalid inputs which reference unknown outputs
+// early.
+func sortByValidationCost(items []*txValidateItem, utxoView *UtxoViewpoint) {
+	costs := make(map[*txValidateItem]int, len(items))
+	for _, item := range items {
+		costs[item] = txInValidationCost(item, utxoView)
 	}
-	if maxGoRoutines > len(items) {
-		maxGoRoutines = len(items)
+	sort.SliceStable(items, func(i, j int) bool {
+		return costs[items[i]] > costs[items[j]]
+	})
+}
+
+// scriptValidatorPool provides a pool of goroutines which validate transaction
+// input scripts in parallel.  The goroutine which requests the validation of a
+// batch of inputs always works on the batch as well.
+//
+// With the ScriptSchedulePool schedule, it is joined by the persistent workers
+// which are idle at the time, so batches make progress even when all of the
+// workers are busy with other batches.  With the ScriptSchedulePerBlock
+// schedule, workers are started for every batch instead.
+type scriptValidatorPool struct {
+	queued  int64  // atomic, number of inputs waiting to be validated
+	busy    int32  // atomic, number of goroutines validating inputs
+	batched uint64 // atomic, number of batches validated
+	inputs  uint64 // atomic, number of inputs validated
+
+	schedule ScriptSchedule
+	cpus     []int
+	batches  chan *scriptValidationBatch
+
+	mtx     sync.Mutex
+	workers int
+	nextCPU int
+	stop    chan struct{}
+}
+
+// newScriptValidatorPool returns a new script validation pool with the passed
+// number of workers scheduled as passed.  The persistent workers of the
+// ScriptSchedulePool schedule are started right away and remain idle while
+// there is nothing to validate.  When CPUs are passed, the workers are pinned
+// to them in a round-robin fashion, which is only supported with the
+// ScriptSchedulePool schedule.
+func newScriptValidatorPool(workers int, schedule ScriptSchedule,
+	cpus []int) *scriptValidatorPool {
+
+	p := &scriptValidatorPool{
+		schedule: schedule,
+		cpus:     cpus,
+		batches:  make(chan *scriptValidationBatch),
+		stop:     make(chan struct{}),
+	}
+	p.Resize(workers)
+	return p
+}
+
+// Resize changes the number of workers of the pool.  Workers which are busy
+// when the pool shrinks stop once they finish their current batch.
+//
+// This function is safe for concurrent access.
+func (p *scriptValidatorPool) Resize(workers int) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.schedule == ScriptSchedulePool {
+		for i := p.workers; i < workers; i++ {
+			cpu := -1
+			if len(p.cpus) > 0 {
+				cpu = p.cpus[p.nextCPU%len(p.cpus)]
+				p.nextCPU++
+			}
+			go p.validateHandler(cpu)
+		}
+		for i := workers; i < p.workers; i++ {
+			go func() { p.stop <- struct{}{} }()
+		}
 	}
+	p.workers = workers
+}
 
-	// Start up validation handlers that are used to asynchronously
-	// validate each transaction input.
-	for i := 0; i < maxGoRoutines; i++ {
-		go v.validateHandler()
+// Stats returns the configuration and the activity of the pool.
+//
+// This function is safe for concurrent access.
+func (p *scriptValidatorPool) Stats() *ScriptValidationStats {
+	p.mtx.Lock()
+	workers := p.workers
+	p.mtx.Unlock()
+
+	return &ScriptValidationStats{
+		Workers:     workers,
+		Schedule:    p.schedule,
+		PinnedCPUs:  append([]int(nil), p.cpus...),
+		QueueDepth:  atomic.LoadInt64(&p.queued),
+		BusyWorkers: atomic.LoadInt32(&p.busy),
+		Batches:     atomic.LoadUint64(&p.batched),
+		Inputs:      atomic.LoadUint64(&p.inputs),
 	}
+}
 
-	// Validate each of the inputs.  The quit channel is closed when any
-	// errors occur so all processing goroutines exit regardless of which
-	// input had the validation error.
-	numInputs := len(items)
-	currentItem := 0
-	processedItems := 0
-	for processedItems < numInputs {
-		// Only send items while there are still items that need to
-		// be processed.  The select statement will never select a nil
-		// channel.
-		var validateChan chan *txValidateItem
-		var item *txValidateItem
-		if currentItem < numInputs {
-			validateChan = v.validateChan
-			item = items[currentItem]
+// validateHandler works on the batches handed to the pool until it is told to
+// stop.  When a CPU is passed, the goroutine is locked to its thread which is
+// pinned to the CPU.  It must be run as a goroutine.
+func (p *scriptValidatorPool) validateHandler(cpu int) {
+	if cpu >= 0 {
+		runtime.LockOSThread()
+		if err := pinThreadToCPU(cpu); err != nil {
+			log.Warnf("Unable to pin script validation worker to "+
+				"CPU %d: %v", cpu, err)
 		}
+	}
 
+	for {
 		select {
-		case validateChan <- item:
-			currentItem++
-
-		case err := <-v.resultChan:
-			processedItems++
-			if err != nil {
-				close(v.quitChan)
-				return err
+		case batch := <-p.batches:
+			batch.validate()
+			batch.wg.Done()
+
+		case <-p.stop:
+			// Pinned threads are terminated along with the
+			// goroutine rather than returned to the scheduler since
+			// they remain locked.
+			return
+		}
+	}
+}
+
+// Validate validates the scripts for all of the passed transaction inputs using
+// the calling goroutine along with the idle workers of the pool.  The inputs
+// are validated in order of their expected cost and the validation stops as
+// soon as one of them fails, in which case its error is returned.
+func (p *scriptValidatorPool) Validate(items []*txValidateItem,
+	utxoView *UtxoViewpoint, flags txscript.ScriptFlags,
+	sigCache *txscript.SigCache) error {
+
+	if len(items) == 0 {
+		return nil
+	}
+	sortByValidationCost(items, utxoView)
+
+	batch := &scriptValidationBatch{
+		items:    items,
+		utxoView: utxoView,
+		flags:    flags,
+		sigCache: sigCache,
+		pool:     p,
+	}
+	atomic.AddUint64(&p.batched, 1)
+	atomic.AddInt64(&p.queued, int64(len(items)))
+
+	if p.schedule == ScriptSchedulePerBlock {
+		// Start as many workers as there are inputs besides the one
+		// the calling goroutine is about to claim.
+		p.mtx.Lock()
+		helpers := p.workers
+		p.mtx.Unlock()
+		if helpers > len(items)-1 {
+			helpers = len(items) - 1
+		}
+		batch.wg.Add(helpers)
+		for i := 0; i < helpers; i++ {
+			go func() {
+				batch.validate()
+				batch.wg.Done()
+			}()
+		}
+	} else {
+		// Hand the batch to as many idle workers as there are inputs
+		// besides the one the calling goroutine is about to claim.
+	out:
+		for helpers := 0; helpers < len(items)-1; helpers++ {
+			batch.wg.Add(1)
+			select {
+			case p.batches <- batch:
+			default:
+				batch.wg.Done()
+				break out
 			}
 		}
 	}
 
-	close(v.quitChan)
-	return nil
+	batch.validate()
+	batch.wg.Wait()
+
+	// The inputs which were not claimed because the batch was canceled are
+	// no longer waiting to be validated.
+	if claimed := int(atomic.LoadInt32(&batch.next)); claimed < len(items) {
+		atomic.AddInt64(&p.queued, -int64(len(items)-claimed))
+	}
+	return batch.err
 }
 
-// newTxValidator returns a new instance of txValidator to be used for
-// validating transaction scripts asynchronously.
-func newTxValidator(utxoView *UtxoViewpoint, flags txscript.ScriptFlags,
-	sigCache *txscript.SigCache, hashCache *txscript.HashCache) *txValidator {
-	return &txValidator{
-		validateChan: make(chan *txValidateItem),
-		quitChan:     make(chan struct{}),
-		resultChan:   make(chan error),
-		utxoView:     utxoView,
-		sigCache:     sigCache,
-		hashCache:    hashCache,
-		flags:        flags,
+// ScriptValidationStats returns the configuration and the activity of the
+// goroutines which validate the scripts of the blocks connected to the chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ScriptValidationStats() *ScriptValidationStats {
+	return b.scriptPool.Stats()
+}
+
+// SetScriptValidationWorkers changes the number of goroutines which validate
+// the scripts of the blocks connected to the chain.  When the chain uses the
+// default pool, the pool shared with ValidateTransactionScripts is resized.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SetScriptValidationWorkers(workers int) error {
+	if workers < 1 {
+		return AssertError("script validation workers must be positive")
 	}
+	b.scriptPool.Resize(workers)
+	return nil
 }
 
 // ValidateTransactionScripts validates the scripts for the passed transaction
-// using multiple goroutines.
+// using the shared script validation pool.
 func ValidateTransactionScripts(tx *btcutil.Tx, utxoView *UtxoViewpoint,
 	flags txscript.ScriptFlags, sigCache *txscript.SigCache,
 	hashCache *txscript.HashCache) error {
@@ -234,15 +503,14 @@ func ValidateTransactionScripts(tx *btcutil.Tx, utxoView *UtxoViewpoint,
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, flags, sigCache, hashCache)
-	return validator.Validate(txValItems)
+	return sharedScriptPool().Validate(txValItems, utxoView, flags, sigCache)
 }
 
 // checkBlockScripts executes and validates the scripts for all transactions in
-// the passed block using multiple goroutines.
+// the passed block using the passed script validation pool.
 func checkBlockScripts(block *btcutil.Block, utxoView *UtxoViewpoint,
 	scriptFlags txscript.ScriptFlags, sigCache *txscript.SigCache,
-	hashCache *txscript.HashCache) error {
+	hashCache *txscript.HashCache, pool *scriptValidatorPool) error {
 
 	// First determine if segwit is active according to the scriptFlags. If
 	// it isn't then we don't need to interact with the HashCache.
@@ -295,9 +563,9 @@ func checkBlockScripts(block *btcutil.Block, utxoView *UtxoViewpoint,
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, scriptFlags, sigCache, hashCache)
 	start := time.Now()
-	if err := validator.Validate(txValItems); err != nil {
+	err := pool.Validate(txValItems, utxoView, scriptFlags, sigCache)
+	if err != nil {
 		return err
 	}
 	elapsed := time.Since(start)
@@ -6,6 +6,7 @@ package blockchain
 
 import (
 	"fmt"
+	"math"
 	"runtime"
 	"testing"
 
@@ -41,9 +42,101 @@ func TestCheckBlockScripts(t *testing.T) {
 	}
 
 	scriptFlags := txscript.ScriptBip16
-	err = checkBlockScripts(blocks[0], view, scriptFlags, nil, nil)
+	for _, schedule := range []ScriptSchedule{ScriptSchedulePool,
+		ScriptSchedulePerBlock} {
+
+		for _, workers := range []int{0, 1, 4} {
+			pool := newScriptValidatorPool(workers, schedule, nil)
+			err = checkBlockScripts(blocks[0], view, scriptFlags,
+				nil, nil, pool)
+			if err != nil {
+				t.Errorf("Transaction script validation with "+
+					"%d %v workers failed: %v\n", workers,
+					schedule, err)
+				return
+			}
+			stats := pool.Stats()
+			if stats.QueueDepth != 0 || stats.BusyWorkers != 0 ||
+				stats.Batches != 1 || stats.Inputs == 0 {
+
+				t.Errorf("Unexpected stats with %d %v workers: "+
+					"%+v", workers, schedule, stats)
+				return
+			}
+		}
+	}
+}
+
+// TestScriptValidatorPoolFailure ensures the script validation pool orders the
+// inputs by their expected cost and stops validating a batch once one of its
+// inputs fails.
+func TestScriptValidatorPoolFailure(t *testing.T) {
+	blocks, err := loadBlocks("277647.dat.bz2")
 	if err != nil {
-		t.Errorf("Transaction script validation failed: %v\n", err)
-		return
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+	view, err := loadUtxoView("277647.utxostore.bz2")
+	if err != nil {
+		t.Fatalf("Error loading txstore: %v\n", err)
+	}
+
+	var items []*txValidateItem
+	for _, tx := range blocks[0].Transactions()[1:] {
+		for txInIdx, txIn := range tx.MsgTx().TxIn {
+			items = append(items, &txValidateItem{
+				txInIndex: txInIdx,
+				txIn:      txIn,
+				tx:        tx,
+			})
+		}
+	}
+
+	// Ensure the inputs are ordered by their expected cost.
+	sortByValidationCost(items, view)
+	for i := 1; i < len(items); i++ {
+		prevCost := txInValidationCost(items[i-1], view)
+		cost := txInValidationCost(items[i], view)
+		if prevCost < cost {
+			t.Fatalf("item %d with cost %d is ordered after item "+
+				"with cost %d", i, cost, prevCost)
+		}
+	}
+
+	// Remove the output spent by one of the inputs from the view and
+	// ensure the missing output is reported and is validated first.
+	missing := items[len(items)-1]
+	delete(view.entries, missing.txIn.PreviousOutPoint)
+	if cost := txInValidationCost(missing, view); cost != math.MaxInt32 {
+		t.Fatalf("unexpected cost for missing output: got %d, want %d",
+			cost, math.MaxInt32)
+	}
+
+	pool := newScriptValidatorPool(4, ScriptSchedulePool, nil)
+	err = pool.Validate(items, view, txscript.ScriptBip16, nil)
+	rerr, ok := err.(RuleError)
+	if !ok || rerr.ErrorCode != ErrMissingTxOut {
+		t.Fatalf("unexpected error: got %v, want %v", err,
+			ErrMissingTxOut)
+	}
+	if items[0] != missing {
+		t.Fatalf("input referencing a missing output was not " +
+			"validated first")
+	}
+	if depth := pool.Stats().QueueDepth; depth != 0 {
+		t.Fatalf("queue depth %d after the batch was canceled", depth)
+	}
+
+	// Ensure the pool keeps validating after it is resized.
+	for _, workers := range []int{1, 8} {
+		pool.Resize(workers)
+		if got := pool.Stats().Workers; got != workers {
+			t.Fatalf("resized pool has %d workers, want %d", got,
+				workers)
+		}
+		err := pool.Validate(items[1:], view, txscript.ScriptBip16, nil)
+		if err != nil {
+			t.Fatalf("validation with %d workers failed: %v",
+				workers, err)
+		}
 	}
 }
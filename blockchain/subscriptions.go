@@ -0,0 +1,448 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+)
+
+// SlowConsumerPolicy determines what happens to the events of a subscription
+// whose buffer is full because the subscriber does not keep up with them.
+type SlowConsumerPolicy int
+
+const (
+	// PolicyDropNewest discards the events which arrive while the buffer
+	// of the subscription is full.
+	PolicyDropNewest SlowConsumerPolicy = iota
+
+	// PolicyDropOldest discards the oldest buffered event to make room for
+	// an event which arrives while the buffer of the subscription is full.
+	PolicyDropOldest
+
+	// PolicyBlock waits for the subscriber to make room for the event.
+	// Since events are published from the chain processing, a subscriber
+	// which stops receiving events stalls the chain, so this policy is
+	// only suitable for subscribers which must not miss any event and are
+	// guaranteed to keep receiving them.  The subscriber must not call
+	// into the chain from the goroutine which receives the events.
+	PolicyBlock
+
+	// PolicyClose ends the subscription and closes its channel when an
+	// event arrives while the buffer of the subscription is full.  It
+	// allows subscribers which must not miss any event to detect that they
+	// did and to recover, such as by resubscribing and resynchronizing.
+	PolicyClose
+)
+
+// slowConsumerPolicyStrings is a map of slow consumer policies back to their
+// constant names for pretty printing.
+var slowConsumerPolicyStrings = map[SlowConsumerPolicy]string{
+	PolicyDropNewest: "PolicyDropNewest",
+	PolicyDropOldest: "PolicyDropOldest",
+	PolicyBlock:      "PolicyBlock",
+	PolicyClose:      "PolicyClose",
+}
+
+// String returns the SlowConsumerPolicy in human-readable form.
+func (p SlowConsumerPolicy) String() string {
+	if s, ok := slowConsumerPolicyStrings[p]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown SlowConsumerPolicy (%d)", int(p))
+}
+
+// BlockConnectedEvent is published when a block is connected to the main
+// chain.
+type BlockConnectedEvent struct {
+	Sequence uint64
+	Block    *btcutil.Block
+}
+
+// BlockDisconnectedEvent is published when a block is disconnected from the
+// main chain.
+type BlockDisconnectedEvent struct {
+	Sequence uint64
+	Block    *btcutil.Block
+}
+
+// ReorgEvent is published when a reorganization of the main chain starts and
+// when it completes.  The blocks are disconnected and connected in between.
+type ReorgEvent struct {
+	Sequence uint64
+	Reorganization
+}
+
+// TxAcceptedEvent is published for every transaction of a block which is
+// connected to the main chain.
+type TxAcceptedEvent struct {
+	Sequence    uint64
+	Tx          *btcutil.Tx
+	TxIndex     int
+	BlockHash   chainhash.Hash
+	BlockHeight int32
+}
+
+// Subscription is the part of the typed subscriptions which is common to all
+// of them.  Each typed subscription delivers its events on buffered channels
+// of their own type.
+//
+// Every event carries the sequence number of the notification it was created
+// from.  Sequence numbers increase by one for every notification, so they
+// order the events across subscriptions, and events created from the same
+// notification, such as the transactions of a connected block, share it.
+type Subscription struct {
+	chain   *BlockChain
+	policy  SlowConsumerPolicy
+	dropped uint64 // Atomic access only.
+
+	// quit is closed when the subscription ends to release a publisher
+	// which waits for room in the buffer.
+	quit     chan struct{}
+	quitOnce sync.Once
+
+	// publish delivers the events for the passed notification with the
+	// passed sequence number and returns false when the subscription has
+	// to end.  closeChan closes the channel of the events.  They are only
+	// called with the subscriptions lock held.
+	publish   func(n *Notification, seq uint64) bool
+	closeChan func()
+}
+
+// Dropped returns the number of events which were discarded because the
+// buffer of the subscription was full.
+//
+// This function is safe for concurrent access.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe ends the subscription and closes its channel.  Events which are
+// still buffered may be received until the channel is closed.
+//
+// This function is safe for concurrent access.
+func (s *Subscription) Unsubscribe() {
+	s.quitOnce.Do(func() { close(s.quit) })
+	s.chain.removeSubscription(s)
+}
+
+// deliver hands an event to the subscriber according to the slow consumer
+// policy of the subscription using the passed functions, which attempt to send
+// it without waiting, send it while waiting until the passed channel is
+// closed, and discard the oldest buffered event respectively.  It returns false
+// when the subscription has to end.
+func (s *Subscription) deliver(trySend func() bool,
+	send func(quit <-chan struct{}) bool, dropOldest func()) bool {
+
+	if trySend() {
+		return true
+	}
+
+	switch s.policy {
+	case PolicyDropOldest:
+		dropOldest()
+		if trySend() {
+			atomic.AddUint64(&s.dropped, 1)
+			return true
+		}
+
+	case PolicyBlock:
+		return send(s.quit)
+
+	case PolicyClose:
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+
+	atomic.AddUint64(&s.dropped, 1)
+	return true
+}
+
+// newSubscription returns a subscription of the chain with the passed policy
+// whose event channel is closed by the passed function.  It must be added to
+// the chain once its publish function is set.
+func (b *BlockChain) newSubscription(policy SlowConsumerPolicy, closeChan func()) *Subscription {
+	return &Subscription{
+		chain:     b,
+		policy:    policy,
+		quit:      make(chan struct{}),
+		closeChan: closeChan,
+	}
+}
+
+// addSubscription starts publishing notifications to the passed subscription.
+func (b *BlockChain) addSubscription(s *Subscription) {
+	b.subscriptionsLock.Lock()
+	b.subscriptions = append(b.subscriptions, s)
+	b.subscriptionsLock.Unlock()
+}
+
+// removeSubscription stops publishing notifications to the passed subscription
+// and closes its channel unless that already happened.
+func (b *BlockChain) removeSubscription(s *Subscription) {
+	b.subscriptionsLock.Lock()
+	b.removeSubscriptionLocked(s)
+	b.subscriptionsLock.Unlock()
+}
+
+// removeSubscriptionLocked stops publishing notifications to the passed
+// subscription and closes its channel unless that already happened.
+//
+// This function MUST be called with the subscriptions lock held.
+func (b *BlockChain) removeSubscriptionLocked(s *Subscription) {
+	for i, sub := range b.subscriptions {
+		if sub != s {
+			continue
+		}
+		copy(b.subscriptions[i:], b.subscriptions[i+1:])
+		b.subscriptions[len(b.subscriptions)-1] = nil
+		b.subscriptions = b.subscriptions[:len(b.subscriptions)-1]
+		s.quitOnce.Do(func() { close(s.quit) })
+		s.closeChan()
+		return
+	}
+}
+
+// publishNotification publishes the events for the passed notification to the
+// typed subscriptions under the next sequence number.
+func (b *BlockChain) publishNotification(n *Notification) {
+	b.subscriptionsLock.Lock()
+	defer b.subscriptionsLock.Unlock()
+
+	b.notificationSeq++
+	seq := b.notificationSeq
+	var ended []*Subscription
+	for _, s := range b.subscriptions {
+		if !s.publish(n, seq) {
+			ended = append(ended, s)
+		}
+	}
+	for _, s := range ended {
+		log.Debugf("Ending chain subscription with policy %v which "+
+			"fell behind", s.policy)
+		b.removeSubscriptionLocked(s)
+	}
+}
+
+// BlockConnectedSubscription is a subscription to the blocks connected to the
+// main chain.
+type BlockConnectedSubscription struct {
+	*Subscription
+	C <-chan *BlockConnectedEvent
+}
+
+// SubscribeBlockConnected returns a subscription which receives an event for
+// every block connected to the main chain.  Up to bufferSize events are
+// buffered for the subscriber before the passed policy applies.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SubscribeBlockConnected(bufferSize int, policy SlowConsumerPolicy) *BlockConnectedSubscription {
+	c := make(chan *BlockConnectedEvent, bufferSize)
+	s := b.newSubscription(policy, func() { close(c) })
+	s.publish = func(n *Notification, seq uint64) bool {
+		if n.Type != NTBlockConnected {
+			return true
+		}
+		event := &BlockConnectedEvent{
+			Sequence: seq,
+			Block:    n.Data.(*btcutil.Block),
+		}
+		return s.deliver(func() bool {
+			select {
+			case c <- event:
+				return true
+			default:
+				return false
+			}
+		}, func(quit <-chan struct{}) bool {
+			select {
+			case c <- event:
+				return true
+			case <-quit:
+				return false
+			}
+		}, func() {
+			select {
+			case <-c:
+			default:
+			}
+		})
+	}
+	b.addSubscription(s)
+	return &BlockConnectedSubscription{Subscription: s, C: c}
+}
+
+// BlockDisconnectedSubscription is a subscription to the blocks disconnected
+// from the main chain.
+type BlockDisconnectedSubscription struct {
+	*Subscription
+	C <-chan *BlockDisconnectedEvent
+}
+
+// SubscribeBlockDisconnected returns a subscription which receives an event
+// for every block disconnected from the main chain.  Up to bufferSize events
+// are buffered for the subscriber before the passed policy applies.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SubscribeBlockDisconnected(bufferSize int, policy SlowConsumerPolicy) *BlockDisconnectedSubscription {
+	c := make(chan *BlockDisconnectedEvent, bufferSize)
+	s := b.newSubscription(policy, func() { close(c) })
+	s.publish = func(n *Notification, seq uint64) bool {
+		if n.Type != NTBlockDisconnected {
+			return true
+		}
+		event := &BlockDisconnectedEvent{
+			Sequence: seq,
+			Block:    n.Data.(*btcutil.Block),
+		}
+		return s.deliver(func() bool {
+			select {
+			case c <- event:
+				return true
+			default:
+				return false
+			}
+		}, func(quit <-chan struct{}) bool {
+			select {
+			case c <- event:
+				return true
+			case <-quit:
+				return false
+			}
+		}, func() {
+			select {
+			case <-c:
+			default:
+			}
+		})
+	}
+	b.addSubscription(s)
+	return &BlockDisconnectedSubscription{Subscription: s, C: c}
+}
+
+// ReorgSubscription is a subscription to the reorganizations of the main
+// chain.  Started and Completed receive the events of the start and completion
+// of the reorganizations respectively.
+type ReorgSubscription struct {
+	*Subscription
+	Started   <-chan *ReorgEvent
+	Completed <-chan *ReorgEvent
+}
+
+// SubscribeReorganizations returns a subscription which receives an event when
+// a reorganization of the main chain starts and when it completes.  Up to
+// bufferSize events of each kind are buffered for the subscriber before the
+// passed policy applies.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SubscribeReorganizations(bufferSize int, policy SlowConsumerPolicy) *ReorgSubscription {
+	started := make(chan *ReorgEvent, bufferSize)
+	completed := make(chan *ReorgEvent, bufferSize)
+	s := b.newSubscription(policy, func() {
+		close(started)
+		close(completed)
+	})
+	s.publish = func(n *Notification, seq uint64) bool {
+		var c chan *ReorgEvent
+		switch n.Type {
+		case NTReorganizationStarted:
+			c = started
+		case NTReorganization:
+			c = completed
+		default:
+			return true
+		}
+		event := &ReorgEvent{
+			Sequence:       seq,
+			Reorganization: *n.Data.(*Reorganization),
+		}
+		return s.deliver(func() bool {
+			select {
+			case c <- event:
+				return true
+			default:
+				return false
+			}
+		}, func(quit <-chan struct{}) bool {
+			select {
+			case c <- event:
+				return true
+			case <-quit:
+				return false
+			}
+		}, func() {
+			select {
+			case <-c:
+			default:
+			}
+		})
+	}
+	b.addSubscription(s)
+	return &ReorgSubscription{Subscription: s, Started: started,
+		Completed: completed}
+}
+
+// TxAcceptedSubscription is a subscription to the transactions of the blocks
+// connected to the main chain.
+type TxAcceptedSubscription struct {
+	*Subscription
+	C <-chan *TxAcceptedEvent
+}
+
+// SubscribeTxAccepted returns a subscription which receives an event for every
+// transaction of every block connected to the main chain in the order of the
+// transactions in the block.  Up to bufferSize events are buffered for the
+// subscriber before the passed policy applies.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SubscribeTxAccepted(bufferSize int, policy SlowConsumerPolicy) *TxAcceptedSubscription {
+	c := make(chan *TxAcceptedEvent, bufferSize)
+	s := b.newSubscription(policy, func() { close(c) })
+	s.publish = func(n *Notification, seq uint64) bool {
+		if n.Type != NTBlockConnected {
+			return true
+		}
+		block := n.Data.(*btcutil.Block)
+		for i, tx := range block.Transactions() {
+			event := &TxAcceptedEvent{
+				Sequence:    seq,
+				Tx:          tx,
+				TxIndex:     i,
+				BlockHash:   *block.Hash(),
+				BlockHeight: block.Height(),
+			}
+			ok := s.deliver(func() bool {
+				select {
+				case c <- event:
+					return true
+				default:
+					return false
+				}
+			}, func(quit <-chan struct{}) bool {
+				select {
+				case c <- event:
+					return true
+				case <-quit:
+					return false
+				}
+			}, func() {
+				select {
+				case <-c:
+				default:
+				}
+			})
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+	b.addSubscription(s)
+	return &TxAcceptedSubscription{Subscription: s, C: c}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestSubscriptions ensures the typed subscriptions receive the events of the
+// chain in order and apply their slow consumer policies.
+func TestSubscriptions(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	chain, teardownFunc, err := chainSetup("subscriptions",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+
+	connected := chain.SubscribeBlockConnected(10, PolicyDropNewest)
+	dropNewest := chain.SubscribeBlockConnected(1, PolicyDropNewest)
+	dropOldest := chain.SubscribeBlockConnected(1, PolicyDropOldest)
+	closeFull := chain.SubscribeBlockConnected(1, PolicyClose)
+	txns := chain.SubscribeTxAccepted(10, PolicyBlock)
+	unsubscribed := chain.SubscribeBlockConnected(10, PolicyBlock)
+	unsubscribed.Unsubscribe()
+	if _, ok := <-unsubscribed.C; ok {
+		t.Fatal("channel of ended subscription not closed")
+	}
+
+	for _, block := range blocks[1:] {
+		if _, _, err := chain.ProcessBlock(block, BFNone); err != nil {
+			t.Fatalf("ProcessBlock: %v", err)
+		}
+	}
+
+	// All of the connected blocks are received in order.
+	var lastSeq uint64
+	for _, block := range blocks[1:] {
+		event := <-connected.C
+		if *event.Block.Hash() != *block.Hash() {
+			t.Fatalf("connected block %v, want %v", event.Block.Hash(),
+				block.Hash())
+		}
+		if event.Sequence <= lastSeq {
+			t.Fatalf("sequence %d not after %d", event.Sequence,
+				lastSeq)
+		}
+		lastSeq = event.Sequence
+
+		for i, tx := range block.Transactions() {
+			txEvent := <-txns.C
+			if txEvent.Sequence != event.Sequence ||
+				txEvent.BlockHash != *block.Hash() ||
+				txEvent.BlockHeight != block.Height() ||
+				txEvent.TxIndex != i || txEvent.Tx != tx {
+
+				t.Fatalf("unexpected transaction event %+v",
+					txEvent)
+			}
+		}
+	}
+	if connected.Dropped() != 0 || txns.Dropped() != 0 {
+		t.Fatal("events dropped from subscriptions with room")
+	}
+
+	// The subscriptions with full buffers keep the first or last block or
+	// end, depending on their policy.
+	if event := <-dropNewest.C; *event.Block.Hash() != *blocks[1].Hash() {
+		t.Fatalf("kept block %v, want the first block", event.Block.Hash())
+	}
+	if event := <-dropOldest.C; *event.Block.Hash() != *blocks[4].Hash() {
+		t.Fatalf("kept block %v, want the last block", event.Block.Hash())
+	}
+	if dropNewest.Dropped() != 3 || dropOldest.Dropped() != 3 {
+		t.Fatalf("dropped %d and %d events, want 3", dropNewest.Dropped(),
+			dropOldest.Dropped())
+	}
+	<-closeFull.C
+	if _, ok := <-closeFull.C; ok {
+		t.Fatal("subscription which fell behind not closed")
+	}
+
+	// Invalidating a block of the main chain reorganizes the chain, which
+	// is reported by the start and completion events around the events of
+	// the disconnected blocks.
+	reorgs := chain.SubscribeReorganizations(1, PolicyBlock)
+	disconnected := chain.SubscribeBlockDisconnected(10, PolicyDropNewest)
+	if err := chain.InvalidateBlock(blocks[3].Hash()); err != nil {
+		t.Fatalf("InvalidateBlock: %v", err)
+	}
+	started := <-reorgs.Started
+	completed := <-reorgs.Completed
+	if started.OldTipHash != *blocks[4].Hash() ||
+		started.NewTipHash != *blocks[2].Hash() ||
+		started.DetachedBlocks != 2 || completed.NewTipHeight != 2 {
+
+		t.Fatalf("unexpected reorganization events %+v, %+v", started,
+			completed)
+	}
+	for _, height := range []int{4, 3} {
+		event := <-disconnected.C
+		if *event.Block.Hash() != *blocks[height].Hash() ||
+			event.Sequence <= started.Sequence ||
+			event.Sequence >= completed.Sequence {
+
+			t.Fatalf("unexpected disconnected block event %+v",
+				event)
+		}
+	}
+	reorgs.Unsubscribe()
+	disconnected.Unsubscribe()
+	txns.Unsubscribe()
+}
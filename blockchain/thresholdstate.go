@@ -7,6 +7,7 @@ package blockchain
 import (
 	"fmt"
 
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
@@ -83,6 +84,10 @@ type thresholdConditionChecker interface {
 	// state retarget window.
 	MinerConfirmationWindow() uint32
 
+	// MinActivationHeight is the height of the first block for which a
+	// rule change which is locked in may become active.
+	MinActivationHeight() uint32
+
 	// Condition returns whether or not the rule change activation condition
 	// has been met.  This typically involves checking whether or not the
 	// bit associated with the condition is set, but can be more complex as
@@ -207,43 +212,40 @@ func (b *BlockChain) thresholdState(prevNode *blockNode, checker thresholdCondit
 			}
 
 		case ThresholdStarted:
-			// The deployment of the rule change fails if it expires
-			// before it is accepted and locked in.
-			medianTime := prevNode.CalcPastMedianTime()
-			if uint64(medianTime.Unix()) >= checker.EndTime() {
-				state = ThresholdFailed
-				break
-			}
-
 			// At this point, the rule change is still being voted
 			// on by the miners, so iterate backwards through the
 			// confirmation window to count all of the votes in it.
-			var count uint32
-			countNode := prevNode
-			for i := int32(0); i < confirmationWindow; i++ {
-				condition, err := checker.Condition(countNode)
-				if err != nil {
-					return ThresholdFailed, err
-				}
-				if condition {
-					count++
-				}
-
-				// Get the previous block node.
-				countNode = countNode.parent
+			count, err := countThresholdVotes(prevNode, checker,
+				confirmationWindow)
+			if err != nil {
+				return ThresholdFailed, err
 			}
 
 			// The state is locked in if the number of blocks in the
 			// period that voted for the rule change meets the
-			// activation threshold.
+			// activation threshold.  This takes precedence over the
+			// expiration so a window which ends after the deadline
+			// still locks the rule change in, as is required for
+			// speedy trial deployments.
 			if count >= checker.RuleChangeActivationThreshold() {
 				state = ThresholdLockedIn
+				break
+			}
+
+			// The deployment of the rule change fails if it expires
+			// before it is accepted and locked in.
+			medianTime := prevNode.CalcPastMedianTime()
+			if uint64(medianTime.Unix()) >= checker.EndTime() {
+				state = ThresholdFailed
 			}
 
 		case ThresholdLockedIn:
 			// The new rule becomes active when its previous state
-			// was locked in.
-			state = ThresholdActive
+			// was locked in unless the deployment requires a later
+			// activation height.
+			if uint32(prevNode.height+1) >= checker.MinActivationHeight() {
+				state = ThresholdActive
+			}
 
 		// Nothing to do if the previous state is active or failed since
 		// they are both terminal states.
@@ -259,6 +261,28 @@ func (b *BlockChain) thresholdState(prevNode *blockNode, checker thresholdCondit
 	return state, nil
 }
 
+// countThresholdVotes returns the number of blocks which satisfy the condition
+// of the passed checker among the passed number of blocks ending with the
+// passed node.
+func countThresholdVotes(node *blockNode, checker thresholdConditionChecker,
+	numBlocks int32) (uint32, error) {
+
+	var count uint32
+	for i := int32(0); i < numBlocks && node != nil; i++ {
+		condition, err := checker.Condition(node)
+		if err != nil {
+			return 0, err
+		}
+		if condition {
+			count++
+		}
+
+		// Get the previous block node.
+		node = node.parent
+	}
+	return count, nil
+}
+
 // ThresholdState returns the current rule change threshold state of the given
 // deployment ID for the block AFTER the end of the current best chain.
 //
@@ -286,6 +310,134 @@ func (b *BlockChain) IsDeploymentActive(deploymentID uint32) (bool, error) {
 	return state == ThresholdActive, nil
 }
 
+// DeploymentStats describes the signalling for a deployment in the current
+// confirmation window.
+type DeploymentStats struct {
+	// Period is the number of blocks in a confirmation window and
+	// Threshold is the number of them which must signal for the
+	// deployment to be locked in.
+	Period    uint32
+	Threshold uint32
+
+	// Elapsed is the number of blocks of the current window up to the
+	// given block and Count is the number of them which signal for the
+	// deployment.
+	Elapsed uint32
+	Count   uint32
+
+	// Possible is whether the deployment can still be locked in at the end
+	// of the current window.
+	Possible bool
+}
+
+// DeploymentInfo describes the parameters and the status of a deployment as
+// of the block AFTER a given block, such as the end of the current best chain.
+type DeploymentInfo struct {
+	// Deployment holds the parameters of the deployment.
+	Deployment chaincfg.ConsensusDeployment
+
+	// State is the threshold state of the deployment and Since is the
+	// height of the first block for which the deployment is in the state.
+	State ThresholdState
+	Since int32
+
+	// Stats describes the signalling in the current window.  It is only
+	// set while the deployment is in the ThresholdStarted state.
+	Stats *DeploymentStats
+}
+
+// DeploymentInfo returns the parameters, the status and the signalling
+// statistics of the given deployment ID for the block AFTER the end of the
+// current best chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DeploymentInfo(deploymentID uint32) (*DeploymentInfo, error) {
+	if deploymentID >= uint32(len(b.chainParams.Deployments)) {
+		return nil, DeploymentError(deploymentID)
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	return b.deploymentInfo(b.bestChain.Tip(), deploymentID)
+}
+
+// DeploymentInfoByHash returns the parameters, the status and the signalling
+// statistics of the given deployment ID for the block AFTER the block of the
+// main chain with the passed hash.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DeploymentInfoByHash(hash *chainhash.Hash, deploymentID uint32) (*DeploymentInfo, error) {
+	if deploymentID >= uint32(len(b.chainParams.Deployments)) {
+		return nil, DeploymentError(deploymentID)
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil || !b.bestChain.Contains(node) {
+		str := fmt.Sprintf("block %s is not in the main chain", hash)
+		return nil, errNotInMainChain(str)
+	}
+	return b.deploymentInfo(node, deploymentID)
+}
+
+// deploymentInfo returns the parameters, the status and the signalling
+// statistics of the given deployment ID for the block AFTER the passed node.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) deploymentInfo(tip *blockNode, deploymentID uint32) (*DeploymentInfo, error) {
+	deployment := &b.chainParams.Deployments[deploymentID]
+	checker := deploymentChecker{deployment: deployment, chain: b}
+	cache := &b.deploymentCaches[deploymentID]
+	state, err := b.thresholdState(tip, checker, cache)
+	if err != nil {
+		return nil, err
+	}
+	info := &DeploymentInfo{
+		Deployment: *deployment,
+		State:      state,
+	}
+
+	// The state only changes at the start of a confirmation window, so
+	// walk back through the windows until the state differs to find when
+	// the deployment entered it.
+	window := int32(checker.MinerConfirmationWindow())
+	nextHeight := tip.height + 1
+	since := nextHeight - nextHeight%window
+	for since > 0 {
+		prevState, err := b.thresholdState(tip.Ancestor(since-window-1),
+			checker, cache)
+		if err != nil {
+			return nil, err
+		}
+		if prevState != state {
+			break
+		}
+		since -= window
+	}
+	info.Since = since
+
+	if state == ThresholdStarted {
+		elapsed := nextHeight % window
+		count, err := countThresholdVotes(tip, checker, elapsed)
+		if err != nil {
+			return nil, err
+		}
+		threshold := checker.RuleChangeActivationThreshold()
+		info.Stats = &DeploymentStats{
+			Period:    uint32(window),
+			Threshold: threshold,
+			Elapsed:   uint32(elapsed),
+			Count:     count,
+			Possible:  count+uint32(window-elapsed) >= threshold,
+		}
+	}
+
+	return info, nil
+}
+
 // deploymentState returns the current rule change threshold for a given
 // deploymentID. The threshold is evaluated from the point of view of the block
 // node passed in as the first argument to this method.
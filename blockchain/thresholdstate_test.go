@@ -5,8 +5,11 @@
 package blockchain
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 )
 
@@ -132,3 +135,116 @@ nextTest:
 		}
 	}
 }
+
+// TestDeploymentInfo ensures speedy trial deployments lock in when the window
+// that reaches the threshold ends after the expiration, activate no earlier
+// than their minimum activation height, and that the reported status and
+// signalling statistics are correct.
+func TestDeploymentInfo(t *testing.T) {
+	t.Parallel()
+
+	params := chaincfg.RegressionNetParams
+	genesisTime := params.GenesisBlock.Header.Timestamp
+	expireTime := uint64(genesisTime.Unix()) + 200*600
+
+	// The dummy deployment is a speedy trial which expires during the
+	// window in which it locks in, the CSV deployment expires without
+	// enough signalling, and the segwit deployment uses the threshold of
+	// the network and activates right after it locks in.
+	params.Deployments[chaincfg.DeploymentTestDummy] = chaincfg.ConsensusDeployment{
+		BitNumber:           28,
+		ExpireTime:          expireTime,
+		MinActivationHeight: 576,
+		ActivationThreshold: 130,
+	}
+	params.Deployments[chaincfg.DeploymentCSV] = chaincfg.ConsensusDeployment{
+		BitNumber:           0,
+		ExpireTime:          expireTime,
+		ActivationThreshold: 130,
+	}
+	params.Deployments[chaincfg.DeploymentSegwit] = chaincfg.ConsensusDeployment{
+		BitNumber:  1,
+		ExpireTime: expireTime,
+	}
+	chain := newFakeChain(&params)
+
+	// Exactly the threshold of blocks in the second window signal for the
+	// dummy and segwit deployments.
+	nodes := []*blockNode{chain.bestChain.Genesis()}
+	for height := int32(1); height <= 700; height++ {
+		version := int32(vbTopBits)
+		if height >= 144 && height < 274 {
+			version |= 1<<28 | 1<<1
+		}
+		node := newFakeNode(nodes[height-1], version, 0,
+			genesisTime.Add(time.Duration(height)*10*time.Minute))
+		chain.index.AddNode(node)
+		nodes = append(nodes, node)
+	}
+
+	tests := []struct {
+		tip          int32
+		deploymentID uint32
+		state        ThresholdState
+		since        int32
+		stats        *DeploymentStats
+	}{
+		{142, chaincfg.DeploymentTestDummy, ThresholdDefined, 0, nil},
+		{199, chaincfg.DeploymentTestDummy, ThresholdStarted, 144,
+			&DeploymentStats{Period: 144, Threshold: 130,
+				Elapsed: 56, Count: 56, Possible: true}},
+		{280, chaincfg.DeploymentCSV, ThresholdStarted, 144,
+			&DeploymentStats{Period: 144, Threshold: 130,
+				Elapsed: 137, Count: 0, Possible: false}},
+		{287, chaincfg.DeploymentTestDummy, ThresholdLockedIn, 288, nil},
+		{287, chaincfg.DeploymentCSV, ThresholdFailed, 288, nil},
+		{287, chaincfg.DeploymentSegwit, ThresholdLockedIn, 288, nil},
+		{500, chaincfg.DeploymentTestDummy, ThresholdLockedIn, 288, nil},
+		{500, chaincfg.DeploymentSegwit, ThresholdActive, 432, nil},
+		{574, chaincfg.DeploymentTestDummy, ThresholdLockedIn, 288, nil},
+		{575, chaincfg.DeploymentTestDummy, ThresholdActive, 576, nil},
+		{700, chaincfg.DeploymentTestDummy, ThresholdActive, 576, nil},
+		{700, chaincfg.DeploymentCSV, ThresholdFailed, 288, nil},
+	}
+	for i, test := range tests {
+		chain.bestChain.SetTip(nodes[test.tip])
+		info, err := chain.DeploymentInfo(test.deploymentID)
+		if err != nil {
+			t.Errorf("DeploymentInfo #%d: unexpected error: %v", i,
+				err)
+			continue
+		}
+		if info.State != test.state || info.Since != test.since {
+			t.Errorf("DeploymentInfo #%d: got state %v since %d, "+
+				"want %v since %d", i, info.State, info.Since,
+				test.state, test.since)
+		}
+		if !reflect.DeepEqual(info.Stats, test.stats) {
+			t.Errorf("DeploymentInfo #%d: got stats %+v, want %+v",
+				i, info.Stats, test.stats)
+		}
+	}
+
+	if _, err := chain.DeploymentInfo(chaincfg.DefinedDeployments); err == nil {
+		t.Error("DeploymentInfo: unknown deployment was not rejected")
+	}
+
+	// The deployment info as of an earlier block matches the one from when
+	// it was the tip.
+	info, err := chain.DeploymentInfoByHash(&nodes[199].hash,
+		chaincfg.DeploymentTestDummy)
+	if err != nil {
+		t.Fatalf("DeploymentInfoByHash: unexpected error: %v", err)
+	}
+	if info.State != ThresholdStarted || info.Since != 144 ||
+		!reflect.DeepEqual(info.Stats, tests[1].stats) {
+
+		t.Errorf("DeploymentInfoByHash: got state %v since %d with "+
+			"stats %+v", info.State, info.Since, info.Stats)
+	}
+	var unknown chainhash.Hash
+	_, err = chain.DeploymentInfoByHash(&unknown, chaincfg.DeploymentTestDummy)
+	if err == nil {
+		t.Error("DeploymentInfoByHash: unknown block was not rejected")
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxTimeAdjustment is the default maximum amount of time in
+	// either direction the local clock will be adjusted by the time
+	// manager.
+	DefaultMaxTimeAdjustment = maxAllowedOffsetSecs * time.Second
+
+	// minTimeSamples is the minimum number of time samples needed before
+	// the time manager adjusts the local clock or warns about it.
+	minTimeSamples = 5
+
+	// outlierMADFactor is the number of median absolute deviations a time
+	// sample must be away from the median of all samples to be rejected as
+	// an outlier.
+	outlierMADFactor = 3
+
+	// minOutlierDistance is the minimum distance a time sample must be away
+	// from the median of all samples to be rejected as an outlier.  It
+	// prevents well synchronized samples from being rejected when all of
+	// the samples are close to each other.
+	minOutlierDistance = time.Minute
+
+	// clockWarningDistance is the distance from the local clock beyond
+	// which a time sample disagrees with the local clock.
+	clockWarningDistance = similarTimeSecs * time.Second
+)
+
+// TimeSample is a time sample of the time manager.
+type TimeSample struct {
+	// ID identifies the source of the sample, such as the address of a
+	// peer.
+	ID string
+
+	// Offset is the offset of the clock of the source from the local
+	// clock.
+	Offset time.Duration
+
+	// Added is the time the sample was added.
+	Added time.Time
+
+	// Outlier is whether the sample was rejected as an outlier when
+	// determining the offset of the local clock.
+	Outlier bool
+}
+
+// TimeManager provides an implementation of the MedianTimeSource interface
+// which is more robust against peers with wrong clocks than the one returned by
+// NewMedianTime.
+//
+// Samples which are far away from the median of all samples are rejected as
+// outliers, and the offset is the median of the remaining samples.  The local
+// clock is never adjusted by more than the configured maximum, and a warning is
+// logged and made available via Warning when most of the samples disagree with
+// the local clock.  Unlike the median time source, the offset is recalculated
+// for every change of the samples, and samples may be updated with more
+// accurate offsets or removed when their source goes away.
+type TimeManager struct {
+	mtx           sync.Mutex
+	maxAdjustment time.Duration
+	samples       []*TimeSample
+	offset        time.Duration
+	warning       string
+}
+
+// Ensure the TimeManager type implements the MedianTimeSource interface.
+var _ MedianTimeSource = (*TimeManager)(nil)
+
+// AdjustedTime returns the current time adjusted by the offset as calculated
+// from the time samples.
+//
+// This function is safe for concurrent access and is part of the
+// MedianTimeSource interface implementation.
+func (m *TimeManager) AdjustedTime() time.Time {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	// Limit the adjusted time to 1 second precision.
+	now := time.Unix(time.Now().Unix(), 0)
+	return now.Add(m.offset)
+}
+
+// AddTimeSample adds a time sample that is used when determining the offset of
+// the local clock.  Samples from a source which already has a sample are
+// ignored.
+//
+// This function is safe for concurrent access and is part of the
+// MedianTimeSource interface implementation.
+func (m *TimeManager) AddTimeSample(sourceID string, timeVal time.Time) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	// Don't add time data from the same source.
+	if m.findSample(sourceID) != -1 {
+		return
+	}
+
+	// Replace the oldest sample once the maximum number of samples is
+	// reached.
+	if len(m.samples) == maxMedianTimeEntries && maxMedianTimeEntries > 0 {
+		m.samples = m.samples[1:]
+	}
+
+	now := time.Unix(time.Now().Unix(), 0)
+	offset := time.Duration(timeVal.Sub(now).Seconds()) * time.Second
+	m.samples = append(m.samples, &TimeSample{
+		ID:     sourceID,
+		Offset: offset,
+		Added:  time.Now(),
+	})
+	log.Debugf("Added time sample of %v (total: %v)", offset,
+		len(m.samples))
+
+	m.update()
+}
+
+// UpdateTimeSample replaces the offset of the time sample of the passed source
+// with the passed offset, such as a more accurate estimate of the offset of
+// the clock of a peer.  It does nothing when there is no sample for the
+// source, so a source is unable to add more than one sample.
+//
+// This function is safe for concurrent access.
+func (m *TimeManager) UpdateTimeSample(sourceID string, offset time.Duration) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	i := m.findSample(sourceID)
+	if i == -1 {
+		return
+	}
+	m.samples[i].Offset = offset
+	m.update()
+}
+
+// RemoveTimeSample removes the time sample of the passed source.
+//
+// This function is safe for concurrent access.
+func (m *TimeManager) RemoveTimeSample(sourceID string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	i := m.findSample(sourceID)
+	if i == -1 {
+		return
+	}
+	m.samples = append(m.samples[:i], m.samples[i+1:]...)
+	m.update()
+}
+
+// Offset returns the amount of time to adjust the local clock by based upon
+// the median of the time samples which are not outliers.
+//
+// This function is safe for concurrent access and is part of the
+// MedianTimeSource interface implementation.
+func (m *TimeManager) Offset() time.Duration {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return m.offset
+}
+
+// MaxAdjustment returns the maximum amount of time in either direction the
+// local clock is adjusted by.
+//
+// This function is safe for concurrent access.
+func (m *TimeManager) MaxAdjustment() time.Duration {
+	return m.maxAdjustment
+}
+
+// Samples returns a copy of the current time samples ordered by the time they
+// were added.
+//
+// This function is safe for concurrent access.
+func (m *TimeManager) Samples() []TimeSample {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	samples := make([]TimeSample, 0, len(m.samples))
+	for _, sample := range m.samples {
+		samples = append(samples, *sample)
+	}
+	return samples
+}
+
+// Warning returns a warning about the local clock when most of the time
+// samples disagree with it or an empty string otherwise.
+//
+// This function is safe for concurrent access.
+func (m *TimeManager) Warning() string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return m.warning
+}
+
+// findSample returns the index of the time sample of the passed source or -1
+// when there is none.
+//
+// This function MUST be called with the time manager lock held.
+func (m *TimeManager) findSample(sourceID string) int {
+	for i, sample := range m.samples {
+		if sample.ID == sourceID {
+			return i
+		}
+	}
+	return -1
+}
+
+// update recalculates the offset of the local clock and the clock warning from
+// the current time samples.
+//
+// This function MUST be called with the time manager lock held.
+func (m *TimeManager) update() {
+	for _, sample := range m.samples {
+		sample.Outlier = false
+	}
+	if len(m.samples) < minTimeSamples {
+		m.setOffset(0)
+		m.setWarning("")
+		return
+	}
+
+	// Reject the samples which are further away from the median than the
+	// given multiple of the median absolute deviation of the samples.
+	offsets := make([]time.Duration, 0, len(m.samples))
+	for _, sample := range m.samples {
+		offsets = append(offsets, sample.Offset)
+	}
+	median := medianDuration(offsets)
+	deviations := make([]time.Duration, 0, len(m.samples))
+	for _, sample := range m.samples {
+		deviations = append(deviations, absDuration(sample.Offset-median))
+	}
+	maxDeviation := outlierMADFactor * medianDuration(deviations)
+	if maxDeviation < minOutlierDistance {
+		maxDeviation = minOutlierDistance
+	}
+	inliers := offsets[:0]
+	var disagreeing int
+	for _, sample := range m.samples {
+		if absDuration(sample.Offset) > clockWarningDistance {
+			disagreeing++
+		}
+		if absDuration(sample.Offset-median) > maxDeviation {
+			sample.Outlier = true
+			continue
+		}
+		inliers = append(inliers, sample.Offset)
+	}
+
+	// Only adjust the local clock when the median offset of the remaining
+	// samples is within the allowed range.  This effectively limits how far
+	// the local clock can be skewed by peers.
+	offset := medianDuration(inliers).Truncate(time.Second)
+	if absDuration(offset) > m.maxAdjustment {
+		offset = 0
+	}
+	m.setOffset(offset)
+
+	// Warn when most of the samples disagree with the local clock.
+	var warning string
+	if disagreeing*2 > len(m.samples) {
+		warning = fmt.Sprintf("The clocks of %d of %d peers differ "+
+			"from the local clock by more than %v -- please check "+
+			"your date and time are correct!  btcd will not work "+
+			"properly with an invalid time", disagreeing,
+			len(m.samples), clockWarningDistance)
+	}
+	m.setWarning(warning)
+}
+
+// setOffset sets the offset of the local clock and logs it when it changed.
+//
+// This function MUST be called with the time manager lock held.
+func (m *TimeManager) setOffset(offset time.Duration) {
+	if offset != m.offset {
+		log.Debugf("New time offset: %v", offset)
+	}
+	m.offset = offset
+}
+
+// setWarning sets the clock warning and logs it when it changed.
+//
+// This function MUST be called with the time manager lock held.
+func (m *TimeManager) setWarning(warning string) {
+	switch {
+	case warning != "" && m.warning == "":
+		log.Warn(warning)
+	case warning == "" && m.warning != "":
+		log.Infof("The local clock agrees with the clocks of the "+
+			"peers again (offset: %v)", m.offset)
+	}
+	m.warning = warning
+}
+
+// medianDuration returns the median of the passed durations, which are sorted
+// in place, or 0 when there are none.  The upper of the two middle values is
+// used for an even number of durations.
+func medianDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+	return durations[len(durations)/2]
+}
+
+// absDuration returns the absolute value of the passed duration.
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// NewTimeManager returns a new time manager which adjusts the local clock by at
+// most the passed amount of time in either direction.  A maximum adjustment of
+// 0 disables the adjustment of the local clock while still keeping track of
+// the samples and warning about the local clock.  The samples are expected to
+// be added from the timestamp field of the version message received from
+// remote peers that successfully connect and negotiate.
+func NewTimeManager(maxAdjustment time.Duration) *TimeManager {
+	return &TimeManager{
+		maxAdjustment: maxAdjustment,
+		samples:       make([]*TimeSample, 0, maxMedianTimeEntries),
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestTimeManager tests the TimeManager implementation.
+func TestTimeManager(t *testing.T) {
+	tests := []struct {
+		name         string
+		in           []int64
+		wantOffset   int64
+		wantOutliers int
+		wantWarning  bool
+	}{{
+		name:       "not enough samples",
+		in:         []int64{10, 10, 10, 10},
+		wantOffset: 0,
+	}, {
+		name:       "median of samples",
+		in:         []int64{-13, 47, -4, -23, -12},
+		wantOffset: -12,
+	}, {
+		name:         "median of remaining samples",
+		in:           []int64{-13, 57, -4, -23, -12},
+		wantOffset:   -12,
+		wantOutliers: 1,
+	}, {
+		name:         "even number of samples",
+		in:           []int64{55, -13, 61, -52, 39, 55},
+		wantOffset:   55,
+		wantOutliers: 2,
+	}, {
+		name:         "outliers rejected",
+		in:           []int64{20, 21, 22, 23, 24, -3600, 3600, 3000},
+		wantOffset:   23,
+		wantOutliers: 3,
+	}, {
+		name:         "offset beyond max adjustment",
+		in:           []int64{4201, 4202, 4203, 4204, -4205},
+		wantOffset:   0,
+		wantOutliers: 1,
+		wantWarning:  true,
+	}, {
+		name:         "most peers disagree",
+		in:           []int64{400, 410, 420, 0, 0},
+		wantOffset:   410,
+		wantOutliers: 2,
+		wantWarning:  true,
+	}, {
+		name:         "some peers disagree",
+		in:           []int64{400, 410, 0, 0, 0},
+		wantOffset:   0,
+		wantOutliers: 2,
+	}}
+
+	for _, test := range tests {
+		m := NewTimeManager(DefaultMaxTimeAdjustment)
+		for j, offset := range test.in {
+			now := time.Unix(time.Now().Unix(), 0)
+			m.AddTimeSample(strconv.Itoa(j),
+				now.Add(time.Duration(offset)*time.Second))
+		}
+
+		// Since it is possible that the time.Now call in AddTimeSample
+		// and the time.Now calls here in the tests will be off by one
+		// second, allow a fudge factor to compensate.
+		gotOffset := m.Offset()
+		wantOffset := time.Duration(test.wantOffset) * time.Second
+		wantOffset2 := wantOffset - time.Second
+		if test.wantOffset == 0 {
+			wantOffset2 = 0
+		}
+		if gotOffset != wantOffset && gotOffset != wantOffset2 {
+			t.Errorf("%s: unexpected offset -- got %v, want %v",
+				test.name, gotOffset, wantOffset)
+			continue
+		}
+
+		var outliers int
+		for _, sample := range m.Samples() {
+			if sample.Outlier {
+				outliers++
+			}
+		}
+		if outliers != test.wantOutliers {
+			t.Errorf("%s: unexpected number of outliers -- got %d, "+
+				"want %d", test.name, outliers, test.wantOutliers)
+			continue
+		}
+
+		if (m.Warning() != "") != test.wantWarning {
+			t.Errorf("%s: unexpected warning %q", test.name,
+				m.Warning())
+			continue
+		}
+	}
+}
+
+// TestTimeManagerUpdate ensures time samples can be updated and removed and
+// that the offset follows them.
+func TestTimeManagerUpdate(t *testing.T) {
+	m := NewTimeManager(10 * time.Minute)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		m.AddTimeSample(strconv.Itoa(i), now)
+	}
+
+	// Duplicate samples are ignored.
+	m.AddTimeSample("0", now.Add(time.Hour))
+	if len(m.Samples()) != 5 {
+		t.Fatalf("got %d samples, want 5", len(m.Samples()))
+	}
+
+	for i := 0; i < 3; i++ {
+		m.UpdateTimeSample(strconv.Itoa(i), 5*time.Minute)
+	}
+	if m.Offset() != 5*time.Minute {
+		t.Fatalf("got offset %v, want %v", m.Offset(), 5*time.Minute)
+	}
+
+	// Updating unknown samples does not add them.
+	m.UpdateTimeSample("unknown", time.Minute)
+	if len(m.Samples()) != 5 {
+		t.Fatalf("got %d samples, want 5", len(m.Samples()))
+	}
+
+	// The offset is reset once there are not enough samples.
+	m.RemoveTimeSample("4")
+	if m.Offset() != 0 {
+		t.Fatalf("got offset %v, want 0", m.Offset())
+	}
+	if len(m.Samples()) != 4 {
+		t.Fatalf("got %d samples, want 4", len(m.Samples()))
+	}
+
+	// Offsets beyond the max adjustment are not applied.
+	m.AddTimeSample("4", now.Add(20*time.Minute))
+	for i := 0; i < 5; i++ {
+		m.UpdateTimeSample(strconv.Itoa(i), 20*time.Minute)
+	}
+	if m.Offset() != 0 {
+		t.Fatalf("got offset %v, want 0", m.Offset())
+	}
+	if m.Warning() == "" {
+		t.Fatal("no warning for skewed local clock")
+	}
+}
@@ -577,16 +577,25 @@ func upgradeUtxoSetToV2(db database.DB, interrupt <-chan struct{}) error {
 // package and performs any needed upgrades to bring them to the latest version.
 //
 // All buckets used by this package are guaranteed to be the latest version if
-// this function returns without error.
+// this function returns without error.  The one exception is the spend journal
+// whose existing entries are migrated in the background by MigrateSpendJournal.
 func (b *BlockChain) maybeUpgradeDbBuckets(interrupt <-chan struct{}) error {
 	// Load or create bucket versions as needed.
-	var utxoSetVersion uint32
+	var utxoSetVersion, spendJournalVersion uint32
 	err := b.db.Update(func(dbTx database.Tx) error {
 		// Load the utxo set version from the database or create it and
 		// initialize it to version 1 if it doesn't exist.
 		var err error
 		utxoSetVersion, err = dbFetchOrCreateVersion(dbTx,
 			utxoSetVersionKeyName, 1)
+		if err != nil {
+			return err
+		}
+
+		// Load the spend journal version from the database or create it
+		// and initialize it to version 1 if it doesn't exist.
+		spendJournalVersion, err = dbFetchOrCreateVersion(dbTx,
+			spendJournalVersionKeyName, 1)
 		return err
 	})
 	if err != nil {
@@ -600,5 +609,274 @@ func (b *BlockChain) maybeUpgradeDbBuckets(interrupt <-chan struct{}) error {
 		}
 	}
 
+	// Create the bucket for the v2 spend journal if needed.  The existing
+	// entries are migrated in the background by MigrateSpendJournal since
+	// they are converted on the fly in the mean time.
+	if spendJournalVersion < 2 {
+		err := b.db.Update(func(dbTx database.Tx) error {
+			_, err := dbTx.Metadata().CreateBucketIfNotExists(
+				spendJournalBucketName)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// spendJournalV1BucketName is the name of the db bucket that housed the spend
+// journal entries prior to version 2.  The bucket is removed once all of its
+// entries have been migrated.
+var spendJournalV1BucketName = []byte("spendjournal")
+
+// decodeSpentTxOutV1 decodes the passed serialized stxo entry, possibly
+// followed by other data, according to the legacy version 1 format into the
+// passed stxo struct.  It returns the number of bytes read.
+//
+// The legacy format is as follows:
+//
+//   [<header code><reserved><compressed txout>],...
+//
+//   Field                Type     Size
+//   header code          VLQ      variable
+//   reserved             byte     1 (only present when the height is non-zero)
+//   compressed txout
+//     compressed amount  VLQ      variable
+//     compressed script  []byte   variable
+//
+// The serialized header code format is:
+//   bit 0 - containing transaction is a coinbase
+//   bits 1-x - height of the block that contains the spent txout
+//
+// Example:
+// From block 170 in main blockchain.
+//
+//    1300320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c
+//    <><><------------------------------------------------------------------>
+//     | |                                  |
+//     | reserved                  compressed txout
+//    header code
+//
+//  - header code: 0x13 (coinbase, height 9)
+//  - reserved: 0x00
+//  - compressed txout 0:
+//    - 0x32: VLQ-encoded compressed amount for 5000000000 (50 BTC)
+//    - 0x05: special script type pay-to-pubkey
+//    - 0x11...5c: x-coordinate of the pubkey
+func decodeSpentTxOutV1(serialized []byte, stxo *SpentTxOut) (int, error) {
+	// Ensure there are bytes to decode.
+	if len(serialized) == 0 {
+		return 0, errDeserialize("no serialized bytes")
+	}
+
+	// Deserialize the header code.
+	code, offset := deserializeVLQ(serialized)
+	if offset >= len(serialized) {
+		return offset, errDeserialize("unexpected end of data after " +
+			"header code")
+	}
+
+	// Decode the header code and skip the reserved field when the height
+	// is non-zero.
+	stxo.Height, stxo.IsCoinBase = decodeHeightCoinbaseCode(code)
+	if stxo.Height > 0 {
+		_, bytesRead := deserializeVLQ(serialized[offset:])
+		offset += bytesRead
+		if offset >= len(serialized) {
+			return offset, errDeserialize("unexpected end of data " +
+				"after reserved")
+		}
+	}
+
+	// Decode the compressed txout.
+	amount, pkScript, bytesRead, err := decodeCompressedTxOut(
+		serialized[offset:])
+	offset += bytesRead
+	if err != nil {
+		return offset, errDeserialize(fmt.Sprintf("unable to decode "+
+			"txout: %v", err))
+	}
+	stxo.Amount = int64(amount)
+	stxo.PkScript = pkScript
+	return offset, nil
+}
+
+// transcodeSpendJournalEntryV1 converts the passed spend journal entry from
+// the legacy version 1 format to the current format for the block at the
+// passed height.
+//
+// Both formats serialize the spent txouts one after the other in the same
+// order and each legacy stxo is self delimiting, so the entry is converted
+// without requiring the block that spends the txouts.
+func transcodeSpendJournalEntryV1(serialized []byte, blockHeight int32) ([]byte, error) {
+	var stxos []SpentTxOut
+	for offset := 0; offset < len(serialized); {
+		var stxo SpentTxOut
+		n, err := decodeSpentTxOutV1(serialized[offset:], &stxo)
+		if err != nil {
+			return nil, err
+		}
+		if stxo.Height > blockHeight {
+			return nil, errDeserialize(fmt.Sprintf("stxo height %d "+
+				"is after spending block height %d", stxo.Height,
+				blockHeight))
+		}
+		offset += n
+		stxos = append(stxos, stxo)
+	}
+
+	// The stxos were read in serialized order, which is the reverse of the
+	// order serializeSpendJournalEntry expects.
+	for i, j := 0, len(stxos)-1; i < j; i, j = i+1, j-1 {
+		stxos[i], stxos[j] = stxos[j], stxos[i]
+	}
+	return serializeSpendJournalEntry(stxos, blockHeight), nil
+}
+
+// dbFetchSpendJournalEntryV1 fetches the legacy version 1 spend journal entry
+// for the passed block hash, if there is one that has not been migrated yet,
+// and returns it converted to the current format for the block at the passed
+// height.
+//
+// Nil is returned when there is no legacy entry for the block.
+func dbFetchSpendJournalEntryV1(dbTx database.Tx, blockHash *chainhash.Hash, blockHeight int32) ([]byte, error) {
+	v1Bucket := dbTx.Metadata().Bucket(spendJournalV1BucketName)
+	if v1Bucket == nil {
+		return nil, nil
+	}
+	serialized := v1Bucket.Get(blockHash[:])
+	if serialized == nil {
+		return nil, nil
+	}
+	return transcodeSpendJournalEntryV1(serialized, blockHeight)
+}
+
+// migrateSpendJournalBatch converts up to the passed number of legacy version
+// 1 spend journal entries to the current format and moves them to the current
+// spend journal bucket.  Legacy entries for blocks that are no longer part of
+// the main chain are removed since they can never be used.  Once there are no
+// legacy entries left, the legacy bucket is removed and the spend journal
+// version is updated.
+//
+// It returns the number of entries processed and whether or not the migration
+// is complete.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) migrateSpendJournalBatch(maxEntries int) (int, bool, error) {
+	var numEntries int
+	var done bool
+	err := b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		v1Bucket := meta.Bucket(spendJournalV1BucketName)
+		if v1Bucket == nil {
+			done = true
+			return nil
+		}
+
+		spendBucket := meta.Bucket(spendJournalBucketName)
+		v1Cursor := v1Bucket.Cursor()
+		for ok := v1Cursor.First(); ok && numEntries < maxEntries; ok =
+			v1Cursor.Next() {
+
+			key := v1Cursor.Key()
+			var hash chainhash.Hash
+			copy(hash[:], key)
+
+			// Convert the entry and add it to the new bucket when
+			// the block is still part of the main chain.
+			node := b.index.LookupNode(&hash)
+			if node != nil && b.bestChain.Contains(node) {
+				serialized, err := transcodeSpendJournalEntryV1(
+					v1Cursor.Value(), node.height)
+				if err != nil {
+					return database.Error{
+						ErrorCode: database.ErrCorruption,
+						Description: fmt.Sprintf("corrupt "+
+							"spend information for %v: %v",
+							hash, err),
+					}
+				}
+				err = spendBucket.Put(hash[:], serialized)
+				if err != nil {
+					return err
+				}
+			}
+
+			// Remove old entry.
+			if err := v1Bucket.Delete(key); err != nil {
+				return err
+			}
+
+			numEntries++
+		}
+		if numEntries > 0 {
+			return nil
+		}
+
+		// Remove the legacy bucket and mark the spend journal as the
+		// latest version once all of the entries have been migrated.
+		if err := meta.DeleteBucket(spendJournalV1BucketName); err != nil {
+			return err
+		}
+		done = true
+		return dbPutVersion(dbTx, spendJournalVersionKeyName,
+			latestSpendJournalBucketVersion)
+	})
+	return numEntries, done, err
+}
+
+// MigrateSpendJournal converts all spend journal entries that are still stored
+// in the legacy version 1 format, which encodes the absolute height of every
+// spent output, to the current format that encodes heights relative to the
+// spending block.  It returns immediately when there is nothing to migrate.
+//
+// The migration is performed in small batches that each hold the chain state
+// lock only briefly, so it is intended to be run in the background while the
+// chain continues to process blocks.  Entries that have not been migrated yet
+// are transparently converted whenever they are loaded in the mean time.
+//
+// The migration stops without error when the passed interrupt channel is
+// closed and picks up where it left off the next time it is run.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) MigrateSpendJournal(interrupt <-chan struct{}) error {
+	// Spend journal entries can be fairly large for blocks that spend a lot
+	// of outputs, so keep the batches small enough to avoid holding the
+	// chain lock for long periods.
+	const maxEntries = 500
+
+	var totalEntries int
+	start := time.Now()
+	for {
+		if interruptRequested(interrupt) {
+			log.Infof("Spend journal migration interrupted after "+
+				"%d entries.  It will resume on the next start.",
+				totalEntries)
+			return nil
+		}
+
+		b.chainLock.Lock()
+		numEntries, done, err := b.migrateSpendJournalBatch(maxEntries)
+		b.chainLock.Unlock()
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+		if totalEntries == 0 {
+			log.Infof("Migrating spend journal to v2 in the " +
+				"background")
+		}
+		totalEntries += numEntries
+	}
+
+	if totalEntries > 0 {
+		seconds := int64(time.Since(start) / time.Second)
+		log.Infof("Done migrating spend journal.  Total entries: %d in "+
+			"%d seconds", totalEntries, seconds)
+	}
 	return nil
 }
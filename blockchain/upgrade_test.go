@@ -5,8 +5,13 @@
 package blockchain
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
 )
 
 // TestDeserializeUtxoEntryV0 ensures deserializing unspent trasaction output
@@ -114,3 +119,244 @@ func TestDeserializeUtxoEntryV0(t *testing.T) {
 		}
 	}
 }
+
+// TestTranscodeSpendJournalEntryV1 ensures converting spend journal entries
+// from the legacy version 1 format to the current format works as expected.
+func TestTranscodeSpendJournalEntryV1(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		blockHeight int32
+		serialized  []byte
+		transcoded  []byte
+	}{
+		// From block 2 in main blockchain.
+		{
+			name:        "No spends",
+			blockHeight: 2,
+			serialized:  nil,
+			transcoded:  nil,
+		},
+		// From block 170 in main blockchain.
+		{
+			name:        "One tx with one input spends last output of coinbase",
+			blockHeight: 170,
+			serialized:  hexToBytes("1300320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
+			transcoded:  hexToBytes("8143320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
+		},
+		// Adapted from block 100025 in main blockchain.
+		{
+			name:        "Two txns when one spends last output, one doesn't",
+			blockHeight: 100025,
+			serialized:  hexToBytes("8b99700086c64700b2fb57eadf61e106a100a7445a8c3f67898841ec8b99700091f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
+			transcoded:  hexToBytes("0286c64700b2fb57eadf61e106a100a7445a8c3f67898841ec0291f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
+		},
+		// Adapted from block 100025 in main blockchain.
+		{
+			name:        "Legacy entry without height",
+			blockHeight: 100025,
+			serialized:  hexToBytes("0091f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
+			transcoded:  hexToBytes("8b997291f20f006edbc6c4d31bae9f1ccc38538a114bf42de65e86"),
+		},
+	}
+
+	for i, test := range tests {
+		got, err := transcodeSpendJournalEntryV1(test.serialized,
+			test.blockHeight)
+		if err != nil {
+			t.Errorf("transcodeSpendJournalEntryV1 #%d (%s) "+
+				"unexpected error: %v", i, test.name, err)
+			continue
+		}
+		if !bytes.Equal(got, test.transcoded) {
+			t.Errorf("transcodeSpendJournalEntryV1 #%d (%s): "+
+				"mismatched bytes - got %x, want %x", i,
+				test.name, got, test.transcoded)
+			continue
+		}
+	}
+
+	// Ensure malformed legacy entries are rejected.
+	errTests := []struct {
+		name        string
+		blockHeight int32
+		serialized  []byte
+	}{
+		{
+			name:        "no data after reserved",
+			blockHeight: 170,
+			serialized:  hexToBytes("1300"),
+		},
+		{
+			name:        "incomplete compressed txout",
+			blockHeight: 170,
+			serialized:  hexToBytes("1300320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a"),
+		},
+		{
+			name:        "height after spending block",
+			blockHeight: 8,
+			serialized:  hexToBytes("1300320511db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5c"),
+		},
+	}
+	for _, test := range errTests {
+		_, err := transcodeSpendJournalEntryV1(test.serialized,
+			test.blockHeight)
+		if !isDeserializeErr(err) {
+			t.Errorf("transcodeSpendJournalEntryV1 (%s): expected "+
+				"deserialize error, got %v", test.name, err)
+		}
+	}
+}
+
+// serializeSpendJournalEntryV1 serializes the passed spent txouts according to
+// the legacy version 1 spend journal format.
+func serializeSpendJournalEntryV1(stxos []SpentTxOut) []byte {
+	var serialized []byte
+	for i := len(stxos) - 1; i > -1; i-- {
+		stxo := &stxos[i]
+		code := heightCoinbaseCode(stxo.Height, stxo.IsCoinBase)
+		size := serializeSizeVLQ(code) +
+			compressedTxOutSize(uint64(stxo.Amount), stxo.PkScript)
+		if stxo.Height > 0 {
+			size++
+		}
+		buf := make([]byte, size)
+		offset := putVLQ(buf, code)
+		if stxo.Height > 0 {
+			offset += putVLQ(buf[offset:], 0)
+		}
+		putCompressedTxOut(buf[offset:], uint64(stxo.Amount),
+			stxo.PkScript)
+		serialized = append(serialized, buf...)
+	}
+	return serialized
+}
+
+// TestMigrateSpendJournal ensures spend journal entries stored in the legacy
+// version 1 format are loaded properly before they are migrated and that the
+// background migration converts all of them to the current format.
+func TestMigrateSpendJournal(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	chain, teardownFunc, err := chainSetup("migratespendjournal",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+	for i := 1; i < len(blocks); i++ {
+		_, _, err := chain.ProcessBlock(blocks[i], BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock fail on block %d: %v", i, err)
+		}
+	}
+
+	// Load the spend journal entries for all of the blocks and ensure some
+	// of them actually spend outputs.
+	want := make([][]SpentTxOut, len(blocks))
+	var numStxos int
+	for i := 1; i < len(blocks); i++ {
+		want[i], err = chain.FetchSpendJournal(blocks[i])
+		if err != nil {
+			t.Fatalf("FetchSpendJournal #%d: %v", i, err)
+		}
+		numStxos += len(want[i])
+	}
+	if numStxos == 0 {
+		t.Fatal("test blocks do not spend any outputs")
+	}
+
+	// Move all of the entries to the legacy bucket in the legacy format
+	// along with an entry for a block that is not part of the main chain.
+	var staleHash chainhash.Hash
+	staleHash[0] = 0x01
+	err = chain.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		v1Bucket, err := meta.CreateBucket(spendJournalV1BucketName)
+		if err != nil {
+			return err
+		}
+		spendBucket := meta.Bucket(spendJournalBucketName)
+		for i := 1; i < len(blocks); i++ {
+			hash := blocks[i].Hash()
+			err := v1Bucket.Put(hash[:],
+				serializeSpendJournalEntryV1(want[i]))
+			if err != nil {
+				return err
+			}
+			if err := spendBucket.Delete(hash[:]); err != nil {
+				return err
+			}
+		}
+		err = v1Bucket.Put(staleHash[:],
+			serializeSpendJournalEntryV1(want[len(want)-1]))
+		if err != nil {
+			return err
+		}
+		return dbPutVersion(dbTx, spendJournalVersionKeyName, 1)
+	})
+	if err != nil {
+		t.Fatalf("unable to store legacy spend journal: %v", err)
+	}
+
+	// checkEntries ensures the spend journal entries for all of the blocks
+	// match the original ones.
+	checkEntries := func(desc string) {
+		t.Helper()
+		for i := 1; i < len(blocks); i++ {
+			got, err := chain.FetchSpendJournal(blocks[i])
+			if err != nil {
+				t.Fatalf("FetchSpendJournal #%d %s: %v", i,
+					desc, err)
+			}
+			if !reflect.DeepEqual(got, want[i]) {
+				t.Fatalf("FetchSpendJournal #%d %s: mismatched "+
+					"entries - got %v, want %v", i, desc,
+					got, want[i])
+			}
+		}
+	}
+	checkEntries("before migration")
+
+	// Ensure an interrupted migration leaves the legacy entries in place.
+	interrupt := make(chan struct{})
+	close(interrupt)
+	if err := chain.MigrateSpendJournal(interrupt); err != nil {
+		t.Fatalf("MigrateSpendJournal: %v", err)
+	}
+	checkEntries("after interrupted migration")
+
+	if err := chain.MigrateSpendJournal(nil); err != nil {
+		t.Fatalf("MigrateSpendJournal: %v", err)
+	}
+	checkEntries("after migration")
+
+	// Ensure the legacy bucket is gone, the stale entry was not migrated,
+	// and the version was updated.
+	err = chain.db.View(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if meta.Bucket(spendJournalV1BucketName) != nil {
+			t.Error("legacy spend journal bucket still exists")
+		}
+		if meta.Bucket(spendJournalBucketName).Get(staleHash[:]) != nil {
+			t.Error("stale spend journal entry was migrated")
+		}
+		version := dbFetchVersion(dbTx, spendJournalVersionKeyName)
+		if version != latestSpendJournalBucketVersion {
+			t.Errorf("spend journal version is %d, want %d",
+				version, latestSpendJournalBucketVersion)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to check spend journal: %v", err)
+	}
+}
@@ -0,0 +1,472 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// utxoFlushPeriodicInterval is the interval at which the utxo cache is
+	// flushed to the database even when it is below its maximum size.  It
+	// bounds the number of blocks which have to be replayed to recover the
+	// utxo set after an unclean shutdown.
+	utxoFlushPeriodicInterval = 10 * time.Minute
+
+	// utxoEntryOverhead is the approximate memory used by an entry in the
+	// cache in addition to its public key script.  It accounts for the
+	// outpoint and pointer stored in the map, the bookkeeping of the map,
+	// and the entry itself.
+	utxoEntryOverhead = 36 + 8 + 16 + 40
+
+	// maxPendingSpendJournalSize is the size in bytes of the spend journal
+	// entries deferred to the next flush of the cache above which the cache
+	// is flushed regardless of its own size.
+	maxPendingSpendJournalSize = 32 * 1024 * 1024
+)
+
+// FlushMode specifies when the utxo cache is flushed to the database.
+type FlushMode uint8
+
+const (
+	// FlushRequired flushes the cache unconditionally.
+	FlushRequired FlushMode = iota
+
+	// FlushPeriodic flushes the cache when it exceeds its maximum size or
+	// it was not flushed for utxoFlushPeriodicInterval.
+	FlushPeriodic
+
+	// FlushIfNeeded flushes the cache only when it exceeds its maximum
+	// size.
+	FlushIfNeeded
+)
+
+// utxoCache is a cache of unspent transaction outputs in front of the utxo set
+// in the database.  The modifications made by connected blocks are applied to
+// the cache and only written to the database when the cache is flushed, which
+// avoids a round trip to the database for every block and never writes outputs
+// which are created and spent between two flushes.
+//
+// The database records the hash of the block its utxo set is consistent with,
+// which lags behind the best chain state between flushes.  When the node does
+// not shut down cleanly, the blocks after it are replayed on startup to recover
+// the utxo set.
+//
+// While the chain is syncing, the spend journal entries of connected blocks are
+// deferred as well and written in the same transaction as the utxos.  Since
+// they are only needed to disconnect blocks, this batches the journal writes
+// of many blocks at once without affecting consistency: the entries of replayed
+// blocks are recreated.
+//
+// The cache is safe for concurrent access.
+type utxoCache struct {
+	db      database.DB
+	maxSize uint64
+
+	// bucketName and stateKeyName are the names of the bucket which
+	// houses the utxo set in the database and of the key which records the
+	// hash of the block it is consistent with.
+	bucketName   []byte
+	stateKeyName []byte
+
+	mtx           sync.Mutex
+	entries       map[wire.OutPoint]*UtxoEntry
+	totalSize     uint64
+	lastFlushHash chainhash.Hash
+	lastFlushTime time.Time
+
+	// journal houses the serialized spend journal entries which have yet
+	// to be written to the database keyed by block hash.
+	journal     map[chainhash.Hash][]byte
+	journalSize uint64
+}
+
+// newUtxoCache returns a new empty utxo cache in front of the utxo set in the
+// passed database which is flushed when it exceeds the passed size in bytes.
+func newUtxoCache(db database.DB, maxSize uint64) *utxoCache {
+	return newUtxoCacheForBucket(db, maxSize, utxoSetBucketName,
+		utxoStateConsistencyKeyName)
+}
+
+// newUtxoCacheForBucket returns a new empty utxo cache like newUtxoCache, but in
+// front of the utxo set housed in the bucket with the passed name whose state
+// is recorded with the key with the passed name.
+func newUtxoCacheForBucket(db database.DB, maxSize uint64, bucketName, stateKeyName []byte) *utxoCache {
+	return &utxoCache{
+		db:            db,
+		maxSize:       maxSize,
+		bucketName:    bucketName,
+		stateKeyName:  stateKeyName,
+		entries:       make(map[wire.OutPoint]*UtxoEntry),
+		lastFlushTime: time.Now(),
+		journal:       make(map[chainhash.Hash][]byte),
+	}
+}
+
+// entrySize returns the approximate memory used by the passed entry in the
+// cache.
+func entrySize(entry *UtxoEntry) uint64 {
+	return utxoEntryOverhead + uint64(len(entry.pkScript))
+}
+
+// add stores the passed entry for the passed outpoint, replacing any existing
+// entry.
+//
+// This function MUST be called with the cache lock held.
+func (c *utxoCache) add(outpoint wire.OutPoint, entry *UtxoEntry) {
+	c.remove(outpoint)
+	c.entries[outpoint] = entry
+	c.totalSize += entrySize(entry)
+}
+
+// remove removes the entry for the passed outpoint, if any.
+//
+// This function MUST be called with the cache lock held.
+func (c *utxoCache) remove(outpoint wire.OutPoint) {
+	if entry, ok := c.entries[outpoint]; ok {
+		c.totalSize -= entrySize(entry)
+		delete(c.entries, outpoint)
+	}
+}
+
+// addSpendJournalEntry defers writing the passed serialized spend journal entry
+// of the block with the passed hash to the next flush.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) addSpendJournalEntry(blockHash *chainhash.Hash, serialized []byte) {
+	c.mtx.Lock()
+	c.removeJournalEntry(blockHash)
+	c.journal[*blockHash] = serialized
+	c.journalSize += uint64(len(serialized))
+	c.mtx.Unlock()
+}
+
+// spendJournalEntry returns the serialized spend journal entry of the block
+// with the passed hash when it has yet to be written to the database.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) spendJournalEntry(blockHash *chainhash.Hash) ([]byte, bool) {
+	c.mtx.Lock()
+	serialized, ok := c.journal[*blockHash]
+	c.mtx.Unlock()
+	return serialized, ok
+}
+
+// removeSpendJournalEntry discards the spend journal entry of the block with the
+// passed hash when it has yet to be written to the database.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) removeSpendJournalEntry(blockHash *chainhash.Hash) {
+	c.mtx.Lock()
+	c.removeJournalEntry(blockHash)
+	c.mtx.Unlock()
+}
+
+// removeJournalEntry discards the deferred spend journal entry of the block
+// with the passed hash, if any.
+//
+// This function MUST be called with the cache lock held.
+func (c *utxoCache) removeJournalEntry(blockHash *chainhash.Hash) {
+	if serialized, ok := c.journal[*blockHash]; ok {
+		c.journalSize -= uint64(len(serialized))
+		delete(c.journal, *blockHash)
+	}
+}
+
+// fetchEntries stores copies of the unspent outputs for the passed outpoints in
+// the passed entries.  Outputs which are not in the cache are loaded from the
+// database and cached as long as the cache has room for them.  Outputs which
+// are spent or do not exist result in nil entries.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) fetchEntries(outpoints map[wire.OutPoint]struct{}, entries map[wire.OutPoint]*UtxoEntry) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var missing []wire.OutPoint
+	for outpoint := range outpoints {
+		entry, ok := c.entries[outpoint]
+		if !ok {
+			missing = append(missing, outpoint)
+			continue
+		}
+
+		// Spent entries are kept until the spend is flushed, but the
+		// outputs no longer exist.
+		if entry.IsSpent() {
+			entries[outpoint] = nil
+			continue
+		}
+		entry = entry.Clone()
+		entry.packedFlags &^= tfModified | tfFresh
+		entries[outpoint] = entry
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return c.db.View(func(dbTx database.Tx) error {
+		for _, outpoint := range missing {
+			entry, err := dbFetchUtxoEntryInBucket(dbTx,
+				c.bucketName, outpoint)
+			if err != nil {
+				return err
+			}
+			entries[outpoint] = entry
+			if entry == nil {
+				continue
+			}
+
+			if c.totalSize+entrySize(entry) <= c.maxSize {
+				c.add(outpoint, entry.Clone())
+			}
+		}
+		return nil
+	})
+}
+
+// commit applies the modifications of the entries in the passed view to the
+// cache.  Outputs which are both created and spent since the last flush are
+// simply removed from the cache.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) commit(view *UtxoViewpoint) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for outpoint, entry := range view.entries {
+		if entry == nil || !entry.isModified() {
+			continue
+		}
+
+		cached := c.entries[outpoint]
+		if entry.IsSpent() {
+			// Outputs which never made it to the database don't need
+			// to be deleted from it.
+			if cached != nil && cached.isFresh() {
+				c.remove(outpoint)
+				continue
+			}
+			if cached == nil && entry.isFresh() {
+				continue
+			}
+
+			// Keep a marker to delete the output from the database on
+			// the next flush.  The script is not needed for it.
+			c.add(outpoint, &UtxoEntry{
+				packedFlags: entry.packedFlags&tfCoinBase |
+					tfSpent | tfModified,
+			})
+			continue
+		}
+
+		// The entry is only fresh when the view created it and the
+		// cache does not know about a version of it in the database.
+		packedFlags := entry.packedFlags&tfCoinBase | tfModified
+		if entry.isFresh() && (cached == nil || cached.isFresh()) {
+			packedFlags |= tfFresh
+		}
+
+		// Copy the script since it usually references the memory of the
+		// entire transaction which created the output.
+		c.add(outpoint, &UtxoEntry{
+			amount:      entry.amount,
+			pkScript:    append([]byte(nil), entry.pkScript...),
+			blockHeight: entry.blockHeight,
+			packedFlags: packedFlags,
+		})
+	}
+}
+
+// flush writes the modified entries of the cache and the deferred spend journal
+// entries to the database along with the passed hash of the block the cache is
+// consistent with, depending on the passed mode.  The entire cache is evicted
+// when it exceeds its maximum size.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) flush(mode FlushMode, bestHash *chainhash.Hash) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	overSize := c.totalSize > c.maxSize
+	needed := overSize || c.journalSize > maxPendingSpendJournalSize
+	switch mode {
+	case FlushIfNeeded:
+		if !needed {
+			return nil
+		}
+	case FlushPeriodic:
+		if !needed && time.Since(c.lastFlushTime) < utxoFlushPeriodicInterval {
+			return nil
+		}
+	}
+
+	var modified int
+	for _, entry := range c.entries {
+		if entry.isModified() {
+			modified++
+		}
+	}
+	if modified > 0 || len(c.journal) > 0 || c.lastFlushHash != *bestHash {
+		err := c.db.Update(func(dbTx database.Tx) error {
+			err := dbPutUtxoEntriesInBucket(dbTx, c.bucketName,
+				c.entries)
+			if err != nil {
+				return err
+			}
+			spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+			for blockHash, serialized := range c.journal {
+				blockHash := blockHash
+				err := spendBucket.Put(blockHash[:], serialized)
+				if err != nil {
+					return err
+				}
+			}
+			return dbTx.Metadata().Put(c.stateKeyName, bestHash[:])
+		})
+		if err != nil {
+			return err
+		}
+		log.Debugf("Flushed %d modified utxos of %d cached (%d bytes) "+
+			"and %d spend journal entries (%d bytes) at block %v",
+			modified, len(c.entries), c.totalSize, len(c.journal),
+			c.journalSize, bestHash)
+	}
+	c.journal = make(map[chainhash.Hash][]byte)
+	c.journalSize = 0
+	c.lastFlushHash = *bestHash
+	c.lastFlushTime = time.Now()
+
+	// Start over with an empty cache when it is too large.  Otherwise keep
+	// the unspent entries which are now in the database.
+	if overSize {
+		c.entries = make(map[wire.OutPoint]*UtxoEntry)
+		c.totalSize = 0
+		return nil
+	}
+	for outpoint, entry := range c.entries {
+		if entry.IsSpent() {
+			c.remove(outpoint)
+			continue
+		}
+		entry.packedFlags &^= tfModified | tfFresh
+	}
+	return nil
+}
+
+// evictView removes the entries of the passed view which were modified from
+// the cache and records the passed hash of the block the utxo set in the
+// database is consistent with.  It is used after the modifications of the view
+// were written to the database directly, which requires the cache to be flushed
+// beforehand.
+//
+// This function is safe for concurrent access.
+func (c *utxoCache) evictView(view *UtxoViewpoint, bestHash *chainhash.Hash) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for outpoint, entry := range view.entries {
+		if entry != nil && entry.isModified() {
+			c.remove(outpoint)
+		}
+	}
+	c.lastFlushHash = *bestHash
+}
+
+// initUtxoCache creates the utxo cache and recovers the utxo set when the node
+// did not shut down cleanly by replaying the blocks of the main chain after the
+// block the utxo set in the database is consistent with.
+func (b *BlockChain) initUtxoCache(maxSize uint64, interrupt <-chan struct{}) error {
+	b.utxoCache = newUtxoCache(b.db, maxSize)
+
+	tip := b.bestChain.Tip()
+	var consistentHash *chainhash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		consistentHash = dbFetchUtxoStateConsistency(dbTx)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Databases which predate the utxo cache always update the utxo set
+	// along with the best chain state.
+	if consistentHash == nil {
+		return b.utxoCache.flush(FlushRequired, &tip.hash)
+	}
+	b.utxoCache.lastFlushHash = *consistentHash
+	if *consistentHash == tip.hash {
+		return nil
+	}
+
+	node := b.index.LookupNode(consistentHash)
+	if node == nil || !b.bestChain.Contains(node) {
+		return AssertError(fmt.Sprintf("the utxo set is consistent with "+
+			"block %v which is not in the main chain", consistentHash))
+	}
+
+	log.Infof("Replaying %d blocks from height %d to recover the utxo set",
+		tip.height-node.height, node.height+1)
+	for n := b.bestChain.Next(node); n != nil; n = b.bestChain.Next(n) {
+		if interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+
+		var block *btcutil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByNode(dbTx, n)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		view := NewUtxoViewpoint()
+		err = view.fetchInputUtxos(b.utxoCache, block)
+		if err != nil {
+			return err
+		}
+		stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
+		err = view.connectTransactions(block, &stxos)
+		if err != nil {
+			return err
+		}
+
+		// Recreate the spend journal entry of the block in case it was
+		// deferred and lost.
+		b.utxoCache.addSpendJournalEntry(&n.hash,
+			serializeSpendJournalEntry(stxos, n.height))
+		b.utxoCache.commit(view)
+		err = b.utxoCache.flush(FlushIfNeeded, &n.hash)
+		if err != nil {
+			return err
+		}
+	}
+	return b.utxoCache.flush(FlushRequired, &tip.hash)
+}
+
+// FlushUtxoCache flushes the utxo cache to the database depending on the passed
+// mode.  It must be called with FlushRequired before the database is closed so
+// the utxo set does not have to be recovered on the next start.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FlushUtxoCache(mode FlushMode) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+	if sv := b.snapshotValidation; sv != nil {
+		if err := sv.cache.flush(mode, &sv.tip.hash); err != nil {
+			return err
+		}
+	}
+	return b.utxoCache.flush(mode, &b.bestChain.Tip().hash)
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// fetchUtxoStateConsistency returns the hash of the block the utxo set in the
+// database of the passed chain is consistent with.
+func fetchUtxoStateConsistency(t *testing.T, chain *BlockChain) chainhash.Hash {
+	var hash *chainhash.Hash
+	err := chain.db.View(func(dbTx database.Tx) error {
+		hash = dbFetchUtxoStateConsistency(dbTx)
+		return nil
+	})
+	if err != nil || hash == nil {
+		t.Fatalf("unable to fetch utxo state consistency: %v", err)
+	}
+	return *hash
+}
+
+// TestUtxoCacheRecovery ensures blocks connected while the utxo cache is not
+// flushed are replayed to recover the utxo set when the cache is lost.
+func TestUtxoCacheRecovery(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	chain, teardownFunc, err := chainSetup("utxocacherecovery",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+
+	// Use a cache large enough to never be flushed while connecting the
+	// blocks.
+	genesisHash := *blocks[0].Hash()
+	chain.utxoCache = newUtxoCache(chain.db, 1<<30)
+	chain.utxoCache.lastFlushHash = genesisHash
+	for i := 1; i < len(blocks); i++ {
+		_, _, err := chain.ProcessBlock(blocks[i], BFNone)
+		if err != nil {
+			t.Fatalf("ProcessBlock fail on block %d: %v", i, err)
+		}
+	}
+	if hash := fetchUtxoStateConsistency(t, chain); hash != genesisHash {
+		t.Fatalf("utxo set was flushed at block %v", hash)
+	}
+
+	// Drop the cache as if the node crashed and ensure the utxo set is
+	// recovered by replaying the blocks.
+	if err := chain.initUtxoCache(1<<30, nil); err != nil {
+		t.Fatalf("unable to recover utxo set: %v", err)
+	}
+	tipHash := *blocks[len(blocks)-1].Hash()
+	if hash := fetchUtxoStateConsistency(t, chain); hash != tipHash {
+		t.Fatalf("recovered utxo set is consistent with %v, want %v",
+			hash, tipHash)
+	}
+	got, err := chain.UtxoSetMuHash(nil)
+	if err != nil {
+		t.Fatalf("UtxoSetMuHash: %v", err)
+	}
+	const want = "0570643f3e80b3b1c44e8e467cbb56237ebfcbd2c5a2bfea91d110f59d57f135"
+	if got.MuHash.String() != want {
+		t.Fatalf("recovered utxo set has muhash %v, want %v",
+			got.MuHash, want)
+	}
+}
+
+// TestUtxoCacheFreshEntries ensures outputs created and spent between two
+// flushes never reach the database while spending flushed outputs deletes them
+// from it.
+func TestUtxoCacheFreshEntries(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("utxocachefresh",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	cache := newUtxoCache(chain.db, 1<<30)
+	bestHash := chainhash.Hash{0x01}
+	inDB := func(outpoint wire.OutPoint) bool {
+		var entry *UtxoEntry
+		err := chain.db.View(func(dbTx database.Tx) error {
+			var err error
+			entry, err = dbFetchUtxoEntry(dbTx, outpoint)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unable to fetch utxo: %v", err)
+		}
+		return entry != nil
+	}
+
+	// Create two outputs and flush only the first one.
+	txOut := &wire.TxOut{Value: 5000, PkScript: []byte{0x51}}
+	flushed := wire.OutPoint{Hash: chainhash.Hash{0x02}}
+	fresh := wire.OutPoint{Hash: chainhash.Hash{0x03}}
+	view := NewUtxoViewpoint()
+	view.addTxOut(flushed, txOut, false, 1)
+	cache.commit(view)
+	if err := cache.flush(FlushRequired, &bestHash); err != nil {
+		t.Fatalf("unable to flush: %v", err)
+	}
+	view = NewUtxoViewpoint()
+	view.addTxOut(fresh, txOut, false, 2)
+	cache.commit(view)
+	if !inDB(flushed) || inDB(fresh) {
+		t.Fatal("unexpected outputs in the database after the flush")
+	}
+
+	// Spend both outputs.  Only the flushed one needs to be deleted from
+	// the database.
+	view = NewUtxoViewpoint()
+	err = cache.fetchEntries(map[wire.OutPoint]struct{}{
+		flushed: {}, fresh: {},
+	}, view.entries)
+	if err != nil {
+		t.Fatalf("unable to fetch entries: %v", err)
+	}
+	view.LookupEntry(flushed).Spend()
+	view.LookupEntry(fresh).Spend()
+	cache.commit(view)
+	if _, ok := cache.entries[fresh]; ok {
+		t.Fatal("spent fresh output is still cached")
+	}
+	if entry := cache.entries[flushed]; entry == nil || !entry.IsSpent() {
+		t.Fatal("spent flushed output is not marked for deletion")
+	}
+
+	// The spent outputs must not be returned by the cache.
+	entries := make(map[wire.OutPoint]*UtxoEntry)
+	err = cache.fetchEntries(map[wire.OutPoint]struct{}{
+		flushed: {}, fresh: {},
+	}, entries)
+	if err != nil {
+		t.Fatalf("unable to fetch entries: %v", err)
+	}
+	if entries[flushed] != nil || entries[fresh] != nil {
+		t.Fatal("cache returned spent outputs")
+	}
+
+	if err := cache.flush(FlushRequired, &bestHash); err != nil {
+		t.Fatalf("unable to flush: %v", err)
+	}
+	if inDB(flushed) || inDB(fresh) {
+		t.Fatal("spent outputs remain in the database")
+	}
+	if len(cache.entries) != 0 || cache.totalSize != 0 {
+		t.Fatalf("cache holds %d entries (%d bytes) after flushing spends",
+			len(cache.entries), cache.totalSize)
+	}
+}
+
+// TestUtxoCacheSpendJournal ensures deferred spend journal entries are served by
+// the cache until they are written to the database by the next flush.
+func TestUtxoCacheSpendJournal(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("utxocachejournal",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	fetchDB := func(blockHash *chainhash.Hash) []byte {
+		var serialized []byte
+		err := chain.db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+			serialized = bucket.Get(blockHash[:])
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to fetch spend journal entry: %v", err)
+		}
+		return serialized
+	}
+
+	cache := newUtxoCache(chain.db, 1<<30)
+	kept := chainhash.Hash{0x01}
+	removed := chainhash.Hash{0x02}
+	cache.addSpendJournalEntry(&kept, []byte{0x01, 0x02})
+	cache.addSpendJournalEntry(&removed, []byte{0x03})
+	cache.addSpendJournalEntry(&removed, []byte{0x04, 0x05, 0x06})
+	if cache.journalSize != 5 {
+		t.Fatalf("journal size is %d, want 5", cache.journalSize)
+	}
+	if fetchDB(&kept) != nil {
+		t.Fatal("deferred spend journal entry written before the flush")
+	}
+	serialized, ok := cache.spendJournalEntry(&removed)
+	if !ok || !bytes.Equal(serialized, []byte{0x04, 0x05, 0x06}) {
+		t.Fatalf("unexpected deferred spend journal entry %x", serialized)
+	}
+
+	// Only the remaining entry may be written by the flush.
+	cache.removeSpendJournalEntry(&removed)
+	if _, ok := cache.spendJournalEntry(&removed); ok {
+		t.Fatal("removed spend journal entry is still deferred")
+	}
+	bestHash := chainhash.Hash{0x03}
+	if err := cache.flush(FlushRequired, &bestHash); err != nil {
+		t.Fatalf("unable to flush: %v", err)
+	}
+	if !bytes.Equal(fetchDB(&kept), []byte{0x01, 0x02}) {
+		t.Fatal("deferred spend journal entry was not flushed")
+	}
+	if fetchDB(&removed) != nil {
+		t.Fatal("removed spend journal entry was flushed")
+	}
+	if len(cache.journal) != 0 || cache.journalSize != 0 {
+		t.Fatalf("cache holds %d spend journal entries (%d bytes) after "+
+			"the flush", len(cache.journal), cache.journalSize)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/muhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// UtxoSetHash describes the MuHash3072 digest of the unspent transaction output
+// set as of a block of the main chain.
+type UtxoSetHash struct {
+	// Hash and Height identify the block the unspent transaction output
+	// set is the one as of.
+	Hash   chainhash.Hash
+	Height int32
+
+	// MuHash is the MuHash3072 digest of the unspent transaction output
+	// set.  Its string representation matches the muhash Bitcoin Core
+	// reports for the same set.
+	MuHash chainhash.Hash
+
+	// TxOuts is the number of unspent transaction outputs and TotalAmount
+	// the sum of their amounts.
+	TxOuts      uint64
+	TotalAmount int64
+}
+
+// serializeUtxoForMuHash returns the serialization of the passed unspent
+// transaction output which is added to the MuHash3072 of the unspent
+// transaction output set.  It is the serialization used by Bitcoin Core: the
+// outpoint, the height shifted left one bit with the coinbase flag in the
+// lowest bit, and the transaction output.
+func serializeUtxoForMuHash(w *bytes.Buffer, outpoint *wire.OutPoint, entry *UtxoEntry) {
+	serializeTxOutForMuHash(w, outpoint, entry.Amount(), entry.PkScript(),
+		entry.BlockHeight(), entry.IsCoinBase())
+}
+
+// serializeTxOutForMuHash is like serializeUtxoForMuHash, but for an output
+// with the passed details rather than a utxo entry, such as a spent output.
+func serializeTxOutForMuHash(w *bytes.Buffer, outpoint *wire.OutPoint, amount int64, pkScript []byte, height int32, isCoinBase bool) {
+	w.Reset()
+	var buf [8]byte
+	w.Write(outpoint.Hash[:])
+	binary.LittleEndian.PutUint32(buf[:4], outpoint.Index)
+	w.Write(buf[:4])
+
+	code := uint32(height) << 1
+	if isCoinBase {
+		code |= 0x01
+	}
+	binary.LittleEndian.PutUint32(buf[:4], code)
+	w.Write(buf[:4])
+
+	binary.LittleEndian.PutUint64(buf[:], uint64(amount))
+	w.Write(buf[:])
+	wire.WriteVarBytes(w, 0, pkScript)
+}
+
+// UtxoSetMuHash computes the MuHash3072 digest of the unspent transaction output
+// set as of the current best block.  When the statistics of the set are
+// maintained incrementally, the digest is taken from them.  Otherwise the set
+// is read as described for UtxoSetStats, which is an expensive operation that
+// can be cancelled by closing the passed interrupt channel.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoSetMuHash(interrupt <-chan struct{}) (*UtxoSetHash, error) {
+	stats, err := b.UtxoSetStats(UtxoSetHashMuHash, interrupt)
+	if err != nil {
+		return nil, err
+	}
+	return &UtxoSetHash{
+		Hash:        stats.Hash,
+		Height:      stats.Height,
+		MuHash:      stats.Digest,
+		TxOuts:      stats.TxOuts,
+		TotalAmount: stats.TotalAmount,
+	}, nil
+}
+
+// viewUtxoSet calls the passed function with a database transaction which views
+// the utxo set as of the current best block, which is passed as well.  The utxo
+// cache is flushed first and the chain lock is held until the database snapshot
+// is taken, so the set is consistent with the block even when blocks are
+// connected while the function runs.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) viewUtxoSet(fn func(dbTx database.Tx, tip *blockNode) error) error {
+	b.chainLock.Lock()
+	locked := true
+	defer func() {
+		if locked {
+			b.chainLock.Unlock()
+		}
+	}()
+	tip := b.bestChain.Tip()
+	if err := b.utxoCache.flush(FlushRequired, &tip.hash); err != nil {
+		return err
+	}
+
+	return b.db.View(func(dbTx database.Tx) error {
+		b.chainLock.Unlock()
+		locked = false
+
+		return fn(dbTx, tip)
+	})
+}
+
+// dbForEachUtxo uses an existing database transaction to call the passed
+// function with every unspent transaction output stored in the bucket with the
+// passed name in the order of their outpoints.  The outputs of a transaction
+// are therefore visited one after the other.  Iterating stops when the function
+// returns an error or the passed interrupt channel is closed.
+func dbForEachUtxo(dbTx database.Tx, bucketName []byte, interrupt <-chan struct{}, fn func(outpoint *wire.OutPoint, entry *UtxoEntry) error) error {
+	var numUtxos uint64
+	cursor := dbTx.Metadata().Bucket(bucketName).Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		if numUtxos%10000 == 0 && interruptRequested(interrupt) {
+			return errInterruptRequested
+		}
+		numUtxos++
+
+		key := cursor.Key()
+		if len(key) <= chainhash.HashSize {
+			return database.Error{
+				ErrorCode:   database.ErrCorruption,
+				Description: "corrupt utxo set key",
+			}
+		}
+		var outpoint wire.OutPoint
+		copy(outpoint.Hash[:], key[:chainhash.HashSize])
+		index, _ := deserializeVLQ(key[chainhash.HashSize:])
+		outpoint.Index = uint32(index)
+
+		entry, err := deserializeUtxoEntry(cursor.Value())
+		if err != nil {
+			return err
+		}
+		if err := fn(&outpoint, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbUtxoSetMuHash uses an existing database transaction to compute the
+// MuHash3072 digest of the utxo set stored in the bucket with the passed name
+// and stores it along with the number and total amount of the outputs in the
+// passed result.
+func dbUtxoSetMuHash(dbTx database.Tx, bucketName []byte, result *UtxoSetHash, interrupt <-chan struct{}) error {
+	h := muhash.New()
+	var serialized bytes.Buffer
+	err := dbForEachUtxo(dbTx, bucketName, interrupt,
+		func(outpoint *wire.OutPoint, entry *UtxoEntry) error {
+			serializeUtxoForMuHash(&serialized, outpoint, entry)
+			h.Add(serialized.Bytes())
+			result.TxOuts++
+			result.TotalAmount += entry.Amount()
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	result.MuHash = chainhash.Hash(h.Digest())
+	return nil
+}
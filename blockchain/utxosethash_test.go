@@ -0,0 +1,84 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestUtxoSetMuHash ensures the MuHash3072 of the unspent transaction output
+// set is computed as Bitcoin Core computes it as blocks are connected.
+func TestUtxoSetMuHash(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	chain, teardownFunc, err := chainSetup("utxosetmuhash",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// Since we're not dealing with the real block chain, set the coinbase
+	// maturity to 1.
+	chain.TstSetCoinbaseMaturity(1)
+
+	tests := []struct {
+		muHash      string
+		txOuts      uint64
+		totalAmount int64
+	}{
+		// The outputs of the genesis block are not spendable, so the set
+		// is empty.
+		{"dd5ad2a105c2d29495f577245c357409002329b9f4d6182c0af3dc2f462555c8", 0, 0},
+		{"2128c32d77f24a536e75f0c0f676b96f435dc9addb8214fc2a06e4dde1df37b4", 1, 5000000000},
+		{"5fe209f0d8ac8dfb24055e05a07630eff6998a9017abc483f073cef490a336c1", 3, 10000000000},
+		{"f82b9c4db93453b8e9ece2d016995af77bc72ad749490340b35f78c04e73c717", 4, 15000000000},
+		{"0570643f3e80b3b1c44e8e467cbb56237ebfcbd2c5a2bfea91d110f59d57f135", 5, 20000000000},
+	}
+	for height, test := range tests {
+		if height > 0 {
+			_, _, err := chain.ProcessBlock(blocks[height], BFNone)
+			if err != nil {
+				t.Fatalf("ProcessBlock fail on block %d: %v", height,
+					err)
+			}
+		}
+
+		got, err := chain.UtxoSetMuHash(nil)
+		if err != nil {
+			t.Fatalf("UtxoSetMuHash at height %d: %v", height, err)
+		}
+		if got.Height != int32(height) ||
+			got.Hash != *blocks[height].Hash() {
+
+			t.Fatalf("UtxoSetMuHash at height %d: unexpected block "+
+				"%v (height %d)", height, got.Hash, got.Height)
+		}
+		if got.MuHash.String() != test.muHash {
+			t.Fatalf("UtxoSetMuHash at height %d: got muhash %v, "+
+				"want %v", height, got.MuHash, test.muHash)
+		}
+		if got.TxOuts != test.txOuts ||
+			got.TotalAmount != test.totalAmount {
+
+			t.Fatalf("UtxoSetMuHash at height %d: got %d outputs "+
+				"worth %d, want %d worth %d", height, got.TxOuts,
+				got.TotalAmount, test.txOuts, test.totalAmount)
+		}
+	}
+
+	// Closing the interrupt channel must abort the computation.
+	interrupt := make(chan struct{})
+	close(interrupt)
+	if _, err := chain.UtxoSetMuHash(interrupt); err != errInterruptRequested {
+		t.Fatalf("UtxoSetMuHash with closed interrupt: got %v, want %v",
+			err, errInterruptRequested)
+	}
+}
@@ -0,0 +1,459 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/muhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+var (
+	// utxoSetStatsKeyName is the name of the db key used to store the
+	// incrementally maintained statistics of the utxo set along with the
+	// hash of the block they are as of.
+	utxoSetStatsKeyName = []byte("utxosetstats")
+)
+
+// utxoSetStateSize is the size of a serialized utxo set state: the block hash,
+// the number of outputs, their total amount, their bogo size, and the state of
+// the MuHash3072.
+const utxoSetStateSize = chainhash.HashSize + 8 + 8 + 8 + muhash.SerializedSize
+
+// UtxoSetHashType identifies the hash of the unspent transaction output set
+// which is computed along with its statistics.
+type UtxoSetHashType uint8
+
+const (
+	// UtxoSetHashNone computes no hash of the set.
+	UtxoSetHashNone UtxoSetHashType = iota
+
+	// UtxoSetHashMuHash computes the MuHash3072 digest of the set, which
+	// Bitcoin Core reports as muhash.
+	UtxoSetHashMuHash
+
+	// UtxoSetHashSerialized computes the double SHA256 of the hash of the
+	// block the set is as of followed by the outputs in the order of their
+	// outpoints, each serialized as for the MuHash3072.  Bitcoin Core
+	// reports it as hash_serialized_3.
+	UtxoSetHashSerialized
+)
+
+// UtxoSetStats describes the unspent transaction output set as of a block of
+// the main chain.
+type UtxoSetStats struct {
+	// Hash and Height identify the block the unspent transaction output
+	// set is the one as of.
+	Hash   chainhash.Hash
+	Height int32
+
+	// TxOuts is the number of unspent transaction outputs and TotalAmount
+	// the sum of their amounts.  BogoSize is the size of the set which
+	// does not depend on how it is stored, where every output counts as
+	// 50 bytes plus its public key script as in Bitcoin Core.
+	TxOuts      uint64
+	TotalAmount int64
+	BogoSize    uint64
+
+	// Transactions is the number of transactions with unspent outputs.  It
+	// is only counted when the set is read and zero otherwise.
+	Transactions uint64
+
+	// Digest is the hash of the set of the requested type.  It is zero
+	// when no hash was requested.
+	Digest chainhash.Hash
+}
+
+// utxoBogoSize returns the size an unspent transaction output with the passed
+// public key script contributes to the bogo size of the utxo set.  It accounts
+// for the outpoint, the height and coinbase flag, the amount, and the script
+// along with its length.
+func utxoBogoSize(pkScript []byte) uint64 {
+	return 32 + 4 + 4 + 8 + 2 + uint64(len(pkScript))
+}
+
+// utxoSetState houses the statistics of the utxo set which are maintained
+// incrementally as blocks are connected and disconnected, including the state
+// of its MuHash3072, along with the hash of the block they are as of.
+type utxoSetState struct {
+	hash        chainhash.Hash
+	txOuts      uint64
+	totalAmount int64
+	bogoSize    uint64
+	muHash      *muhash.MuHash3072
+}
+
+// clone returns a deep copy of the state.
+func (s *utxoSetState) clone() *utxoSetState {
+	clone := *s
+	clone.muHash = muhash.New()
+	clone.muHash.Combine(s.muHash)
+	return &clone
+}
+
+// addTxOut adds the output with the passed details to the state.  The passed
+// buffer is used to serialize the output.
+func (s *utxoSetState) addTxOut(buf *bytes.Buffer, outpoint *wire.OutPoint, amount int64, pkScript []byte, height int32, isCoinBase bool) {
+	serializeTxOutForMuHash(buf, outpoint, amount, pkScript, height,
+		isCoinBase)
+	s.muHash.Add(buf.Bytes())
+	s.txOuts++
+	s.totalAmount += amount
+	s.bogoSize += utxoBogoSize(pkScript)
+}
+
+// removeTxOut removes the output with the passed details from the state.  The
+// passed buffer is used to serialize the output.
+func (s *utxoSetState) removeTxOut(buf *bytes.Buffer, outpoint *wire.OutPoint, amount int64, pkScript []byte, height int32, isCoinBase bool) {
+	serializeTxOutForMuHash(buf, outpoint, amount, pkScript, height,
+		isCoinBase)
+	s.muHash.Remove(buf.Bytes())
+	s.txOuts--
+	s.totalAmount -= amount
+	s.bogoSize -= utxoBogoSize(pkScript)
+}
+
+// connectBlock updates the state for the passed block at the passed height
+// being connected.  The passed spent outputs must be in the order of the spend
+// journal.  The passed replaced outputs are the unspent outputs which the
+// outputs of the coinbase transaction overwrite, which only exist for the two
+// blocks which violate BIP0030.
+func (s *utxoSetState) connectBlock(block *btcutil.Block, height int32, stxos []SpentTxOut, replaced map[wire.OutPoint]*UtxoEntry) {
+	var buf bytes.Buffer
+	for outpoint, entry := range replaced {
+		if entry == nil {
+			continue
+		}
+		s.removeTxOut(&buf, &outpoint, entry.Amount(), entry.PkScript(),
+			entry.BlockHeight(), entry.IsCoinBase())
+	}
+
+	// Outputs which are created and spent by the block are added and
+	// removed again, which leaves the state unchanged.
+	stxoIdx := 0
+	for i, tx := range block.Transactions() {
+		isCoinBase := i == 0
+		if !isCoinBase {
+			for _, txIn := range tx.MsgTx().TxIn {
+				stxo := &stxos[stxoIdx]
+				stxoIdx++
+				s.removeTxOut(&buf, &txIn.PreviousOutPoint,
+					stxo.Amount, stxo.PkScript, stxo.Height,
+					stxo.IsCoinBase)
+			}
+		}
+
+		outpoint := wire.OutPoint{Hash: *tx.Hash()}
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			outpoint.Index = uint32(txOutIdx)
+			s.addTxOut(&buf, &outpoint, txOut.Value, txOut.PkScript,
+				height, isCoinBase)
+		}
+	}
+	s.hash = *block.Hash()
+}
+
+// disconnectBlock updates the state for the passed block at the passed height
+// being disconnected, which makes the block with the passed hash the one the
+// state is as of.  The passed spent outputs must be in the order of the spend
+// journal.
+func (s *utxoSetState) disconnectBlock(block *btcutil.Block, height int32, stxos []SpentTxOut, prevHash *chainhash.Hash) {
+	var buf bytes.Buffer
+	stxoIdx := 0
+	for i, tx := range block.Transactions() {
+		isCoinBase := i == 0
+		if !isCoinBase {
+			for _, txIn := range tx.MsgTx().TxIn {
+				stxo := &stxos[stxoIdx]
+				stxoIdx++
+				s.addTxOut(&buf, &txIn.PreviousOutPoint,
+					stxo.Amount, stxo.PkScript, stxo.Height,
+					stxo.IsCoinBase)
+			}
+		}
+
+		outpoint := wire.OutPoint{Hash: *tx.Hash()}
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			outpoint.Index = uint32(txOutIdx)
+			s.removeTxOut(&buf, &outpoint, txOut.Value,
+				txOut.PkScript, height, isCoinBase)
+		}
+	}
+	s.hash = *prevHash
+}
+
+// serializeUtxoSetState returns the serialization of the passed utxo set state.
+func serializeUtxoSetState(s *utxoSetState) []byte {
+	serialized := make([]byte, utxoSetStateSize)
+	offset := copy(serialized, s.hash[:])
+	byteOrder.PutUint64(serialized[offset:], s.txOuts)
+	offset += 8
+	byteOrder.PutUint64(serialized[offset:], uint64(s.totalAmount))
+	offset += 8
+	byteOrder.PutUint64(serialized[offset:], s.bogoSize)
+	offset += 8
+	muHash := s.muHash.Serialize()
+	copy(serialized[offset:], muHash[:])
+	return serialized
+}
+
+// deserializeUtxoSetState returns the utxo set state from its serialization.
+func deserializeUtxoSetState(serialized []byte) (*utxoSetState, error) {
+	if len(serialized) != utxoSetStateSize {
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt utxo set statistics",
+		}
+	}
+	var s utxoSetState
+	offset := copy(s.hash[:], serialized)
+	s.txOuts = byteOrder.Uint64(serialized[offset:])
+	offset += 8
+	s.totalAmount = int64(byteOrder.Uint64(serialized[offset:]))
+	offset += 8
+	s.bogoSize = byteOrder.Uint64(serialized[offset:])
+	offset += 8
+	muHash, err := muhash.Deserialize(serialized[offset:])
+	if err != nil {
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt utxo set statistics: %v", err),
+		}
+	}
+	s.muHash = muHash
+	return &s, nil
+}
+
+// dbFetchUtxoSetState uses an existing database transaction to fetch the
+// incrementally maintained statistics of the utxo set.  It returns nil when
+// they have never been stored.
+func dbFetchUtxoSetState(dbTx database.Tx) (*utxoSetState, error) {
+	serialized := dbTx.Metadata().Get(utxoSetStatsKeyName)
+	if serialized == nil {
+		return nil, nil
+	}
+	return deserializeUtxoSetState(serialized)
+}
+
+// dbPutUtxoSetState uses an existing database transaction to store the
+// incrementally maintained statistics of the utxo set.
+func dbPutUtxoSetState(dbTx database.Tx, s *utxoSetState) error {
+	return dbTx.Metadata().Put(utxoSetStatsKeyName, serializeUtxoSetState(s))
+}
+
+// initUtxoSetState loads the incrementally maintained statistics of the utxo
+// set and starts maintaining them.  When they have never been stored or are not
+// as of the current best block, they are computed from the entire utxo set
+// first, which can be interrupted by closing the passed channel.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) initUtxoSetState(interrupt <-chan struct{}) error {
+	tip := b.bestChain.Tip()
+	var state *utxoSetState
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		state, err = dbFetchUtxoSetState(dbTx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if state != nil && state.hash == tip.hash {
+		b.utxoSetState = state
+		return nil
+	}
+
+	log.Infof("Computing the statistics of the utxo set as of height %d",
+		tip.height)
+	if err := b.utxoCache.flush(FlushRequired, &tip.hash); err != nil {
+		return err
+	}
+	state = &utxoSetState{hash: tip.hash, muHash: muhash.New()}
+	err = b.db.View(func(dbTx database.Tx) error {
+		var buf bytes.Buffer
+		return dbForEachUtxo(dbTx, utxoSetBucketName, interrupt,
+			func(outpoint *wire.OutPoint, entry *UtxoEntry) error {
+				state.addTxOut(&buf, outpoint, entry.Amount(),
+					entry.PkScript(), entry.BlockHeight(),
+					entry.IsCoinBase())
+				return nil
+			})
+	})
+	if err != nil {
+		return err
+	}
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbPutUtxoSetState(dbTx, state)
+	})
+	if err != nil {
+		return err
+	}
+	b.utxoSetState = state
+	return nil
+}
+
+// utxoSetStateAfterConnect returns the incrementally maintained statistics of
+// the utxo set updated for the passed block being connected, which spends the
+// passed outputs.  It must be called before the modifications of the block are
+// committed to the utxo cache.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) utxoSetStateAfterConnect(node *blockNode, block *btcutil.Block, stxos []SpentTxOut) (*utxoSetState, error) {
+	// The outputs of the coinbase transactions of the blocks which violate
+	// BIP0030 overwrite the unspent outputs of earlier ones, which are
+	// still in the utxo set.
+	var replaced map[wire.OutPoint]*UtxoEntry
+	if isBIP0030Node(node) {
+		coinbase := block.Transactions()[0]
+		outpoints := make(map[wire.OutPoint]struct{})
+		for txOutIdx := range coinbase.MsgTx().TxOut {
+			outpoint := wire.OutPoint{
+				Hash:  *coinbase.Hash(),
+				Index: uint32(txOutIdx),
+			}
+			outpoints[outpoint] = struct{}{}
+		}
+		replaced = make(map[wire.OutPoint]*UtxoEntry, len(outpoints))
+		err := b.utxoCache.fetchEntries(outpoints, replaced)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state := b.utxoSetState.clone()
+	state.connectBlock(block, node.height, stxos, replaced)
+	return state, nil
+}
+
+// UtxoSetStats returns the statistics of the unspent transaction output set as
+// of the current best block along with the hash of the passed type.
+//
+// When the statistics are maintained incrementally, they are returned right
+// away unless the serialized hash is requested.  Otherwise the utxo cache is
+// flushed and the set is read from a single database snapshot, so the
+// statistics are consistent with the block they are reported for even when
+// blocks are connected while they are computed.  Since every unspent
+// transaction output is read, this is an expensive operation which can be
+// cancelled by closing the passed interrupt channel.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoSetStats(hashType UtxoSetHashType, interrupt <-chan struct{}) (*UtxoSetStats, error) {
+	if hashType != UtxoSetHashSerialized {
+		b.chainLock.RLock()
+		state := b.utxoSetState
+		tip := b.bestChain.Tip()
+		b.chainLock.RUnlock()
+
+		// The state is replaced rather than modified when a block is
+		// connected or disconnected, so it can be used without the lock.
+		if state != nil {
+			stats := &UtxoSetStats{
+				Hash:        tip.hash,
+				Height:      tip.height,
+				TxOuts:      state.txOuts,
+				TotalAmount: state.totalAmount,
+				BogoSize:    state.bogoSize,
+			}
+			if hashType == UtxoSetHashMuHash {
+				stats.Digest = chainhash.Hash(state.muHash.Digest())
+			}
+			return stats, nil
+		}
+	}
+
+	var stats *UtxoSetStats
+	err := b.viewUtxoSet(func(dbTx database.Tx, tip *blockNode) error {
+		stats = &UtxoSetStats{Hash: tip.hash, Height: tip.height}
+		return dbUtxoSetStats(dbTx, hashType, stats, interrupt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// dbUtxoSetStats uses an existing database transaction to compute the
+// statistics of the utxo set along with the hash of the passed type and stores
+// them in the passed stats, whose block must be set.
+func dbUtxoSetStats(dbTx database.Tx, hashType UtxoSetHashType, stats *UtxoSetStats, interrupt <-chan struct{}) error {
+	var muHash *muhash.MuHash3072
+	hasher := sha256.New()
+	switch hashType {
+	case UtxoSetHashMuHash:
+		muHash = muhash.New()
+	case UtxoSetHashSerialized:
+		hasher.Write(stats.Hash[:])
+	}
+
+	var serialized bytes.Buffer
+	var prevHash chainhash.Hash
+	err := dbForEachUtxo(dbTx, utxoSetBucketName, interrupt,
+		func(outpoint *wire.OutPoint, entry *UtxoEntry) error {
+			// The outputs of a transaction are visited one after
+			// the other.
+			if stats.Transactions == 0 || outpoint.Hash != prevHash {
+				stats.Transactions++
+				prevHash = outpoint.Hash
+			}
+			stats.TxOuts++
+			stats.TotalAmount += entry.Amount()
+			stats.BogoSize += utxoBogoSize(entry.PkScript())
+
+			switch hashType {
+			case UtxoSetHashMuHash:
+				serializeUtxoForMuHash(&serialized, outpoint, entry)
+				muHash.Add(serialized.Bytes())
+			case UtxoSetHashSerialized:
+				serializeUtxoForMuHash(&serialized, outpoint, entry)
+				hasher.Write(serialized.Bytes())
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+
+	switch hashType {
+	case UtxoSetHashMuHash:
+		stats.Digest = chainhash.Hash(muHash.Digest())
+	case UtxoSetHashSerialized:
+		stats.Digest = chainhash.HashH(hasher.Sum(nil))
+	}
+	return nil
+}
+
+// ScanUtxoSet calls the passed function with every unspent transaction output
+// of the set as of the current best block in the order of their outpoints and
+// returns the hash and height of the block.  The utxo set is read as described
+// for UtxoSetStats, so this is an expensive operation which can be cancelled by
+// closing the passed interrupt channel.  Scanning stops when the function
+// returns an error.  The hash and height of the block are also returned when
+// the scan is cancelled or stopped, along with the error.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ScanUtxoSet(fn func(outpoint *wire.OutPoint, entry *UtxoEntry) error, interrupt <-chan struct{}) (*chainhash.Hash, int32, error) {
+	var tip *blockNode
+	err := b.viewUtxoSet(func(dbTx database.Tx, t *blockNode) error {
+		tip = t
+		return dbForEachUtxo(dbTx, utxoSetBucketName, interrupt, fn)
+	})
+	if tip == nil {
+		return nil, 0, err
+	}
+	return &tip.hash, tip.height, err
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/muhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestUtxoSetState ensures the incrementally maintained statistics of the utxo
+// set match the ones of the set built from scratch as blocks are connected and
+// disconnected, and that they survive serialization.
+func TestUtxoSetState(t *testing.T) {
+	spent := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 2}
+	stxo := SpentTxOut{
+		Amount:     3000,
+		PkScript:   []byte{0x51},
+		Height:     7,
+		IsCoinBase: true,
+	}
+
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+	})
+	coinbase.AddTxOut(wire.NewTxOut(5000, []byte{0x52}))
+	coinbase.AddTxOut(wire.NewTxOut(0, []byte{0x6a, 0x01, 0x02}))
+
+	// The second transaction spends the output above and creates one which
+	// the third transaction spends within the block.
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(&spent, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{0x53}))
+	tx.AddTxOut(wire.NewTxOut(1500, []byte{0x54, 0x55}))
+	spendingTx := wire.NewMsgTx(1)
+	spendingTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{
+		Hash: tx.TxHash(), Index: 1}, nil, nil))
+	spendingTx.AddTxOut(wire.NewTxOut(1400, []byte{0x56}))
+	block := btcutil.NewBlock(&wire.MsgBlock{
+		Transactions: []*wire.MsgTx{coinbase, tx, spendingTx},
+	})
+	stxos := []SpentTxOut{stxo, {
+		Amount:   1500,
+		PkScript: []byte{0x54, 0x55},
+		Height:   8,
+	}}
+
+	// stateOf returns the state of the utxo set with the passed outputs
+	// built from scratch.
+	type utxo struct {
+		outpoint   wire.OutPoint
+		amount     int64
+		pkScript   []byte
+		height     int32
+		isCoinBase bool
+	}
+	stateOf := func(hash chainhash.Hash, utxos ...utxo) *utxoSetState {
+		state := &utxoSetState{hash: hash, muHash: muhash.New()}
+		var buf bytes.Buffer
+		for _, u := range utxos {
+			state.addTxOut(&buf, &u.outpoint, u.amount, u.pkScript,
+				u.height, u.isCoinBase)
+		}
+		return state
+	}
+	prevHash := chainhash.Hash{0x02}
+	before := stateOf(prevHash, utxo{spent, 3000, []byte{0x51}, 7, true})
+	after := stateOf(*block.Hash(),
+		utxo{wire.OutPoint{Hash: coinbase.TxHash()}, 5000,
+			[]byte{0x52}, 8, true},
+		utxo{wire.OutPoint{Hash: tx.TxHash()}, 1000, []byte{0x53},
+			8, false},
+		utxo{wire.OutPoint{Hash: spendingTx.TxHash()}, 1400,
+			[]byte{0x56}, 8, false})
+
+	checkState := func(desc string, got, want *utxoSetState) {
+		t.Helper()
+		if got.hash != want.hash || got.txOuts != want.txOuts ||
+			got.totalAmount != want.totalAmount ||
+			got.bogoSize != want.bogoSize ||
+			got.muHash.Digest() != want.muHash.Digest() {
+
+			t.Fatalf("%s: got %d outputs worth %d (bogo size %d) as "+
+				"of %v, want %d worth %d (bogo size %d) as of %v",
+				desc, got.txOuts, got.totalAmount, got.bogoSize,
+				got.hash, want.txOuts, want.totalAmount,
+				want.bogoSize, want.hash)
+		}
+	}
+
+	state := before.clone()
+	state.connectBlock(block, 8, stxos, nil)
+	checkState("connect", state, after)
+	checkState("original after connect", before, stateOf(prevHash,
+		utxo{spent, 3000, []byte{0x51}, 7, true}))
+
+	restored, err := deserializeUtxoSetState(serializeUtxoSetState(state))
+	if err != nil {
+		t.Fatalf("deserializeUtxoSetState: unexpected error: %v", err)
+	}
+	checkState("deserialize", restored, after)
+
+	restored.disconnectBlock(block, 8, stxos, &prevHash)
+	checkState("disconnect", restored, before)
+
+	if _, err := deserializeUtxoSetState(nil); err == nil {
+		t.Fatal("deserializeUtxoSetState: empty state was not rejected")
+	}
+}
+
+// TestUtxoSetStats ensures the incrementally maintained statistics of the utxo
+// set match the ones computed from the entire set as blocks are connected and
+// disconnected.
+func TestUtxoSetStats(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	chain, teardownFunc, err := chainSetup("utxosetstats",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+	if err := chain.initUtxoSetState(nil); err != nil {
+		t.Fatalf("initUtxoSetState: %v", err)
+	}
+
+	checkStats := func(height int32) {
+		t.Helper()
+		got, err := chain.UtxoSetStats(UtxoSetHashMuHash, nil)
+		if err != nil {
+			t.Fatalf("UtxoSetStats at height %d: %v", height, err)
+		}
+		var want *UtxoSetStats
+		err = chain.viewUtxoSet(func(dbTx database.Tx, tip *blockNode) error {
+			want = &UtxoSetStats{Hash: tip.hash, Height: tip.height}
+			return dbUtxoSetStats(dbTx, UtxoSetHashMuHash, want, nil)
+		})
+		if err != nil {
+			t.Fatalf("dbUtxoSetStats at height %d: %v", height, err)
+		}
+
+		// The number of transactions is only counted when the set is
+		// read.
+		want.Transactions = 0
+		if got.Height != height || !reflect.DeepEqual(got, want) {
+			t.Fatalf("UtxoSetStats at height %d: got %+v, want %+v",
+				height, got, want)
+		}
+
+		// The stored statistics are the ones as of the block.
+		var stored *utxoSetState
+		err = chain.db.View(func(dbTx database.Tx) error {
+			stored, err = dbFetchUtxoSetState(dbTx)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("dbFetchUtxoSetState at height %d: %v", height,
+				err)
+		}
+		if stored.hash != got.Hash ||
+			chainhash.Hash(stored.muHash.Digest()) != got.Digest {
+
+			t.Fatalf("stored statistics at height %d do not match",
+				height)
+		}
+	}
+
+	checkStats(0)
+	for i := 1; i < len(blocks); i++ {
+		if _, _, err := chain.ProcessBlock(blocks[i], BFNone); err != nil {
+			t.Fatalf("ProcessBlock fail on block %d: %v", i, err)
+		}
+		checkStats(int32(i))
+	}
+
+	// Disconnecting blocks restores the statistics of the earlier set.
+	if err := chain.InvalidateBlock(blocks[3].Hash()); err != nil {
+		t.Fatalf("InvalidateBlock: %v", err)
+	}
+	checkStats(2)
+
+	// Reading the set counts the transactions with unspent outputs.
+	serialized, err := chain.UtxoSetStats(UtxoSetHashSerialized, nil)
+	if err != nil {
+		t.Fatalf("UtxoSetStats: %v", err)
+	}
+	if serialized.Transactions == 0 ||
+		serialized.Transactions > serialized.TxOuts ||
+		serialized.Digest == (chainhash.Hash{}) {
+
+		t.Fatalf("UtxoSetStats: unexpected serialized hash stats %+v",
+			serialized)
+	}
+}
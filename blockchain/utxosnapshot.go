@@ -0,0 +1,902 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/muhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// utxoSnapshotVersion is the current version of the utxo set snapshot
+	// format.
+	utxoSnapshotVersion = 1
+
+	// utxoSnapshotHeaderSize is the size of the header of a utxo set
+	// snapshot.
+	utxoSnapshotHeaderSize = 4 + 2 + 4 + chainhash.HashSize + 4 + 8
+
+	// maxSnapshotUtxoSize is the maximum size of a serialized utxo entry in
+	// a utxo set snapshot.
+	maxSnapshotUtxoSize = 1 << 20
+
+	// snapshotBatchSize is the number of database entries which are
+	// written or removed in a single database transaction while loading a
+	// utxo set snapshot or removing it.
+	snapshotBatchSize = 50000
+
+	// snapshotValidationStateSize is the size of the serialized state of
+	// the background validation of a utxo set snapshot.
+	snapshotValidationStateSize = chainhash.HashSize + 4 +
+		chainhash.HashSize + 1
+)
+
+var (
+	// utxoSnapshotMagic is the magic which starts every utxo set snapshot.
+	utxoSnapshotMagic = [4]byte{'u', 't', 'x', 'o'}
+
+	// snapshotLoadKeyName is the name of the db key which is present while
+	// a utxo set snapshot is loaded into the utxo set.
+	snapshotLoadKeyName = []byte("utxosnapshotload")
+
+	// snapshotValidationKeyName is the name of the db key used to store the
+	// state of the background validation of a loaded utxo set snapshot.
+	snapshotValidationKeyName = []byte("utxosnapshotvalidation")
+
+	// snapshotUtxoSetBucketName is the name of the db bucket used to house
+	// the utxo set which the background validation of a loaded utxo set
+	// snapshot builds from the blocks before the snapshot.
+	snapshotUtxoSetBucketName = []byte("utxosetsnapshotvalidation")
+
+	// snapshotUtxoStateKeyName is the name of the db key used to store the
+	// hash of the block the utxo set built by the background validation is
+	// consistent with.
+	snapshotUtxoStateKeyName = []byte("utxosetsnapshotvalidationstate")
+)
+
+// -----------------------------------------------------------------------------
+// A utxo set snapshot contains the unspent transaction output set as of a block
+// of the main chain along with everything needed to make that block the tip of
+// a chain which only has the genesis block, so a node can sync the rest of the
+// chain right away and validate the blocks before the snapshot in the
+// background.  Only snapshots listed in the assumeutxo parameters of the
+// network are accepted.
+//
+// The serialized format is:
+//
+//   <magic><version><net><hash><height><num utxos><headers><block>[<utxo>,...]
+//
+//   Field              Type              Size
+//   magic              [4]byte           4 ("utxo")
+//   version            uint16            2
+//   net                uint32            4
+//   hash               chainhash.Hash    32
+//   height             uint32            4
+//   num utxos          uint64            8
+//   headers            []wire.BlockHeader 80 * height (heights 1 to height)
+//   block              wire.MsgBlock     variable (the block at height)
+//   utxo
+//     outpoint hash    chainhash.Hash    32
+//     outpoint index   uint32            4
+//     entry            varint + []byte   variable
+//
+// All integers are encoded in little endian and the utxo entries are
+// serialized like they are in the utxo set.
+// -----------------------------------------------------------------------------
+
+// UtxoSnapshot describes a utxo set snapshot.
+type UtxoSnapshot struct {
+	// Hash and Height identify the block the snapshot is the one as of.
+	Hash   chainhash.Hash
+	Height int32
+
+	// MuHash is the MuHash3072 digest of the unspent transaction output
+	// set and Utxos the number of outputs in it.
+	MuHash chainhash.Hash
+	Utxos  uint64
+}
+
+// SnapshotValidation describes the progress of the background validation of
+// the blocks before a loaded utxo set snapshot.
+type SnapshotValidation struct {
+	// Hash and Height identify the block of the snapshot.
+	Hash   chainhash.Hash
+	Height int32
+
+	// ValidatedHeight is the height of the last block which was validated
+	// in the background.
+	ValidatedHeight int32
+
+	// Failed is set when the utxo set built by the background validation
+	// does not match the snapshot.
+	Failed bool
+}
+
+// snapshotValidation tracks the background validation of the blocks before the
+// block of a loaded utxo set snapshot.  The blocks are connected to a separate
+// utxo set, which must match the snapshot once the block of the snapshot is
+// connected to it.
+type snapshotValidation struct {
+	base   *blockNode
+	muHash chainhash.Hash
+	tip    *blockNode
+	cache  *utxoCache
+	failed bool
+}
+
+// serializeSnapshotValidation returns the serialization of the state of the
+// passed background validation which is stored in the database.
+func serializeSnapshotValidation(sv *snapshotValidation) []byte {
+	serialized := make([]byte, snapshotValidationStateSize)
+	copy(serialized, sv.base.hash[:])
+	offset := chainhash.HashSize
+	byteOrder.PutUint32(serialized[offset:], uint32(sv.base.height))
+	offset += 4
+	copy(serialized[offset:], sv.muHash[:])
+	offset += chainhash.HashSize
+	if sv.failed {
+		serialized[offset] = 1
+	}
+	return serialized
+}
+
+// dbPutSnapshotValidation uses an existing database transaction to store the
+// state of the passed background validation.
+func dbPutSnapshotValidation(dbTx database.Tx, sv *snapshotValidation) error {
+	return dbTx.Metadata().Put(snapshotValidationKeyName,
+		serializeSnapshotValidation(sv))
+}
+
+// dbClearBucket removes all of the entries of the bucket with the passed name in
+// batches and then the bucket itself.  It is used to remove utxo sets which
+// are too large to be removed in a single database transaction.
+func dbClearBucket(db database.DB, bucketName []byte) error {
+	for done := false; !done; {
+		err := db.Update(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(bucketName)
+			if bucket == nil {
+				done = true
+				return nil
+			}
+
+			var numDeleted int
+			cursor := bucket.Cursor()
+			for ok := cursor.First(); ok && numDeleted < snapshotBatchSize; ok = cursor.Next() {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+				numDeleted++
+			}
+			if numDeleted > 0 {
+				return nil
+			}
+
+			done = true
+			return dbTx.Metadata().DeleteBucket(bucketName)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assumeUtxo returns the assumeutxo parameters of the network for the block
+// with the passed hash and height or nil when there are none.
+func (b *BlockChain) assumeUtxo(hash *chainhash.Hash, height int32) *chaincfg.AssumeUtxo {
+	for i := range b.chainParams.AssumeUtxo {
+		au := &b.chainParams.AssumeUtxo[i]
+		if au.Height == height && au.Hash.IsEqual(hash) {
+			return au
+		}
+	}
+	return nil
+}
+
+// DumpUtxoSnapshot writes a snapshot of the utxo set as of the current best
+// block to the passed writer in the format described above.  The snapshot can
+// only be created once the entire chain has been validated, so it can not be
+// created while a loaded snapshot is being validated in the background.
+//
+// The snapshot can be loaded by nodes which list it in the assumeutxo
+// parameters of the network, which must match the returned description.  Since
+// every unspent transaction output is written, this is an expensive operation
+// which can be cancelled by closing the passed interrupt channel.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DumpUtxoSnapshot(w io.Writer, interrupt <-chan struct{}) (*UtxoSnapshot, error) {
+	// Hold the chain lock until the database snapshot is taken so no block
+	// is connected after the cache is flushed.
+	b.chainLock.Lock()
+	locked := true
+	defer func() {
+		if locked {
+			b.chainLock.Unlock()
+		}
+	}()
+	if b.snapshotValidation != nil {
+		return nil, fmt.Errorf("the blocks before the utxo snapshot "+
+			"at height %d have not been validated yet",
+			b.snapshotValidation.base.height)
+	}
+	tip := b.bestChain.Tip()
+	if err := b.utxoCache.flush(FlushRequired, &tip.hash); err != nil {
+		return nil, err
+	}
+	nodes := make([]*blockNode, 0, tip.height)
+	for node := tip; node.parent != nil; node = node.parent {
+		nodes = append(nodes, node)
+	}
+
+	snapshot := &UtxoSnapshot{Hash: tip.hash, Height: tip.height}
+	bw := bufio.NewWriter(w)
+	err := b.db.View(func(dbTx database.Tx) error {
+		b.chainLock.Unlock()
+		locked = false
+
+		// The number of outputs is part of the header, so count them
+		// first.
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		cursor := utxoBucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			snapshot.Utxos++
+		}
+
+		var header [utxoSnapshotHeaderSize]byte
+		copy(header[:], utxoSnapshotMagic[:])
+		offset := len(utxoSnapshotMagic)
+		binary.LittleEndian.PutUint16(header[offset:], utxoSnapshotVersion)
+		offset += 2
+		binary.LittleEndian.PutUint32(header[offset:],
+			uint32(b.chainParams.Net))
+		offset += 4
+		copy(header[offset:], tip.hash[:])
+		offset += chainhash.HashSize
+		binary.LittleEndian.PutUint32(header[offset:], uint32(tip.height))
+		offset += 4
+		binary.LittleEndian.PutUint64(header[offset:], snapshot.Utxos)
+		if _, err := bw.Write(header[:]); err != nil {
+			return err
+		}
+
+		// Write the headers from the one after the genesis block up to
+		// and including the tip followed by the tip block.
+		for i := len(nodes) - 1; i >= 0; i-- {
+			header := nodes[i].Header()
+			if err := header.Serialize(bw); err != nil {
+				return err
+			}
+		}
+		block, err := dbFetchBlockByNode(dbTx, tip)
+		if err != nil {
+			return err
+		}
+		if err := block.MsgBlock().Serialize(bw); err != nil {
+			return err
+		}
+
+		// Write the outputs while computing the digest of the set.
+		h := muhash.New()
+		var serialized bytes.Buffer
+		var numUtxos uint64
+		var index [4]byte
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			if numUtxos%10000 == 0 && interruptRequested(interrupt) {
+				return errInterruptRequested
+			}
+
+			key := cursor.Key()
+			if len(key) <= chainhash.HashSize {
+				return database.Error{
+					ErrorCode:   database.ErrCorruption,
+					Description: "corrupt utxo set key",
+				}
+			}
+			var outpoint wire.OutPoint
+			copy(outpoint.Hash[:], key[:chainhash.HashSize])
+			idx, _ := deserializeVLQ(key[chainhash.HashSize:])
+			outpoint.Index = uint32(idx)
+
+			entry, err := deserializeUtxoEntry(cursor.Value())
+			if err != nil {
+				return err
+			}
+			serializeUtxoForMuHash(&serialized, &outpoint, entry)
+			h.Add(serialized.Bytes())
+			numUtxos++
+
+			if _, err := bw.Write(outpoint.Hash[:]); err != nil {
+				return err
+			}
+			binary.LittleEndian.PutUint32(index[:], outpoint.Index)
+			if _, err := bw.Write(index[:]); err != nil {
+				return err
+			}
+			err = wire.WriteVarBytes(bw, 0, cursor.Value())
+			if err != nil {
+				return err
+			}
+		}
+		snapshot.MuHash = chainhash.Hash(h.Digest())
+		return bw.Flush()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// LoadUtxoSnapshot loads the utxo set snapshot in the format described above
+// from the passed reader and makes its block the tip of the main chain, so the
+// rest of the chain can be synced right away.  The blocks before it are
+// validated in the background as they are passed to ValidateSnapshotBlock.
+//
+// The snapshot must be listed in the assumeutxo parameters of the network, it
+// can only be loaded while the chain only has the genesis block, and it can
+// not be used along with optional indexes.  The headers in the snapshot are
+// fully validated and the digest of the utxo set must match the one in the
+// parameters.
+//
+// Loading the snapshot can be cancelled by closing the passed interrupt
+// channel.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) LoadUtxoSnapshot(r io.Reader, interrupt <-chan struct{}) (*UtxoSnapshot, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	genesis := b.bestChain.Tip()
+	if genesis.height != 0 {
+		return nil, fmt.Errorf("utxo snapshots can only be loaded into a " +
+			"chain which only has the genesis block")
+	}
+	if b.indexManager != nil {
+		return nil, fmt.Errorf("utxo snapshots can not be loaded while " +
+			"optional indexes are enabled")
+	}
+
+	// Read and check the header of the snapshot.
+	br := bufio.NewReader(r)
+	var header [utxoSnapshotHeaderSize]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(utxoSnapshotMagic)], utxoSnapshotMagic[:]) {
+		return nil, fmt.Errorf("not a utxo snapshot")
+	}
+	offset := len(utxoSnapshotMagic)
+	version := binary.LittleEndian.Uint16(header[offset:])
+	if version != utxoSnapshotVersion {
+		return nil, fmt.Errorf("unsupported utxo snapshot version %d",
+			version)
+	}
+	offset += 2
+	net := wire.BitcoinNet(binary.LittleEndian.Uint32(header[offset:]))
+	if net != b.chainParams.Net {
+		return nil, fmt.Errorf("utxo snapshot is for network %v", net)
+	}
+	offset += 4
+	snapshot := &UtxoSnapshot{}
+	copy(snapshot.Hash[:], header[offset:])
+	offset += chainhash.HashSize
+	snapshot.Height = int32(binary.LittleEndian.Uint32(header[offset:]))
+	offset += 4
+	snapshot.Utxos = binary.LittleEndian.Uint64(header[offset:])
+	au := b.assumeUtxo(&snapshot.Hash, snapshot.Height)
+	if au == nil || snapshot.Height <= 0 {
+		return nil, fmt.Errorf("utxo snapshot for block %v at height %d "+
+			"is not a known snapshot", snapshot.Hash, snapshot.Height)
+	}
+
+	// Read and validate the headers.  The nodes are only added to the block
+	// index once the whole snapshot has been loaded.
+	log.Infof("Loading utxo snapshot for block %v (height %d, %d utxos)",
+		snapshot.Hash, snapshot.Height, snapshot.Utxos)
+	nodes := make([]*blockNode, 0, snapshot.Height)
+	prevNode := genesis
+	for height := int32(1); height <= snapshot.Height; height++ {
+		if height%2016 == 0 && interruptRequested(interrupt) {
+			return nil, errInterruptRequested
+		}
+
+		var header wire.BlockHeader
+		if err := header.Deserialize(br); err != nil {
+			return nil, err
+		}
+		if header.PrevBlock != prevNode.hash {
+			return nil, fmt.Errorf("utxo snapshot header at height "+
+				"%d does not connect to the previous one", height)
+		}
+		err := checkBlockHeaderSanity(&header, b.chainParams.PowLimit,
+			b.timeSource, BFNone)
+		if err != nil {
+			return nil, err
+		}
+		err = b.checkBlockHeaderContext(&header, prevNode, BFNone)
+		if err != nil {
+			return nil, err
+		}
+
+		node := newBlockNode(&header, prevNode)
+		node.status = statusValid
+		nodes = append(nodes, node)
+		prevNode = node
+	}
+	baseNode := prevNode
+	if baseNode.hash != snapshot.Hash {
+		return nil, fmt.Errorf("utxo snapshot headers end with block %v "+
+			"instead of %v", baseNode.hash, snapshot.Hash)
+	}
+	baseNode.status = statusDataStored | statusValid
+
+	// Read and check the block of the snapshot.
+	var msgBlock wire.MsgBlock
+	if err := msgBlock.Deserialize(br); err != nil {
+		return nil, err
+	}
+	block := btcutil.NewBlock(&msgBlock)
+	block.SetHeight(snapshot.Height)
+	if !block.Hash().IsEqual(&snapshot.Hash) {
+		return nil, fmt.Errorf("utxo snapshot contains block %v instead "+
+			"of %v", block.Hash(), snapshot.Hash)
+	}
+	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource,
+		BFNone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the outputs into the utxo set, which only contains the
+	// unspendable genesis coinbase output at this point.  The marker key
+	// ensures a partially loaded set is removed on the next start.
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Put(snapshotLoadKeyName, snapshot.Hash[:])
+	})
+	if err != nil {
+		return nil, err
+	}
+	muHash, err := b.loadSnapshotUtxos(br, snapshot, interrupt)
+	if err == nil && muHash != *au.MuHash {
+		err = fmt.Errorf("utxo snapshot has muhash %v instead of %v",
+			muHash, au.MuHash)
+	}
+	if err != nil {
+		if clearErr := b.clearSnapshotLoad(); clearErr != nil {
+			log.Errorf("Unable to remove partially loaded utxo "+
+				"snapshot: %v", clearErr)
+		}
+		return nil, err
+	}
+	snapshot.MuHash = muHash
+
+	// Make the block of the snapshot the tip of the main chain and start
+	// the background validation of the blocks before it.
+	sv := &snapshotValidation{
+		base:   baseNode,
+		muHash: muHash,
+		tip:    genesis,
+		cache: newUtxoCacheForBucket(b.db, b.utxoCache.maxSize,
+			snapshotUtxoSetBucketName, snapshotUtxoStateKeyName),
+	}
+	sv.cache.lastFlushHash = genesis.hash
+	blockSize := uint64(msgBlock.SerializeSize())
+	blockWeight := uint64(GetBlockWeight(block))
+	state := newBestState(baseNode, blockSize, blockWeight,
+		uint64(len(msgBlock.Transactions)), au.ChainTxCount,
+		baseNode.CalcPastMedianTime())
+	err = b.db.Update(func(dbTx database.Tx) error {
+		if err := dbStoreBlock(dbTx, block); err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if err := dbStoreBlockNode(dbTx, node); err != nil {
+				return err
+			}
+			err := dbPutBlockIndex(dbTx, &node.hash, node.height)
+			if err != nil {
+				return err
+			}
+		}
+		err := dbPutBestState(dbTx, state, baseNode.workSum)
+		if err != nil {
+			return err
+		}
+		if err := dbPutUtxoStateConsistency(dbTx, &baseNode.hash); err != nil {
+			return err
+		}
+		_, err = dbTx.Metadata().CreateBucketIfNotExists(
+			snapshotUtxoSetBucketName)
+		if err != nil {
+			return err
+		}
+		err = dbTx.Metadata().Put(snapshotUtxoStateKeyName,
+			genesis.hash[:])
+		if err != nil {
+			return err
+		}
+		if err := dbPutSnapshotValidation(dbTx, sv); err != nil {
+			return err
+		}
+		return dbTx.Metadata().Delete(snapshotLoadKeyName)
+	})
+	if err != nil {
+		if clearErr := b.clearSnapshotLoad(); clearErr != nil {
+			log.Errorf("Unable to remove partially loaded utxo "+
+				"snapshot: %v", clearErr)
+		}
+		return nil, err
+	}
+
+	b.index.Lock()
+	for _, node := range nodes {
+		b.index.addNode(node)
+	}
+	b.index.Unlock()
+	b.bestChain.SetTip(baseNode)
+	b.headerIndex.setTip(baseNode)
+	b.utxoCache.lastFlushHash = baseNode.hash
+	b.snapshotValidation = sv
+	b.stateLock.Lock()
+	b.stateSnapshot = state
+	b.stateLock.Unlock()
+
+	// The maintained statistics of the utxo set are replaced by the ones
+	// of the loaded set.  Should they not be computed, they are no longer
+	// maintained until they are computed on the next start.
+	if b.utxoSetState != nil {
+		if err := b.initUtxoSetState(interrupt); err != nil {
+			log.Errorf("Unable to compute the statistics of the "+
+				"loaded utxo set: %v", err)
+			b.utxoSetState = nil
+		}
+	}
+
+	log.Infof("Loaded utxo snapshot for block %v (height %d).  The blocks "+
+		"before it will be validated in the background", snapshot.Hash,
+		snapshot.Height)
+	return snapshot, nil
+}
+
+// loadSnapshotUtxos reads the outputs of the passed snapshot from the passed
+// reader and stores them in the utxo set in batches.  It returns the digest of
+// the outputs.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) loadSnapshotUtxos(r io.Reader, snapshot *UtxoSnapshot, interrupt <-chan struct{}) (chainhash.Hash, error) {
+	h := muhash.New()
+	var serialized bytes.Buffer
+	var numUtxos uint64
+	for numUtxos < snapshot.Utxos {
+		if interruptRequested(interrupt) {
+			return chainhash.Hash{}, errInterruptRequested
+		}
+
+		err := b.db.Update(func(dbTx database.Tx) error {
+			utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+			var index [4]byte
+			for n := 0; n < snapshotBatchSize &&
+				numUtxos < snapshot.Utxos; n++ {
+
+				var outpoint wire.OutPoint
+				_, err := io.ReadFull(r, outpoint.Hash[:])
+				if err != nil {
+					return err
+				}
+				if _, err := io.ReadFull(r, index[:]); err != nil {
+					return err
+				}
+				outpoint.Index = binary.LittleEndian.Uint32(index[:])
+				value, err := wire.ReadVarBytes(r, 0,
+					maxSnapshotUtxoSize, "utxo entry")
+				if err != nil {
+					return err
+				}
+
+				entry, err := deserializeUtxoEntry(value)
+				if err != nil {
+					return fmt.Errorf("utxo snapshot entry "+
+						"for %v: %v", outpoint, err)
+				}
+				if entry.BlockHeight() > snapshot.Height {
+					return fmt.Errorf("utxo snapshot entry "+
+						"for %v is after the snapshot",
+						outpoint)
+				}
+				serializeUtxoForMuHash(&serialized, &outpoint,
+					entry)
+				h.Add(serialized.Bytes())
+				numUtxos++
+
+				key := outpointKey(outpoint)
+				err = utxoBucket.Put(*key, value)
+				// NOTE: The key is intentionally not recycled
+				// here since the database interface contract
+				// prohibits modifications.
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return chainhash.Hash{}, err
+		}
+		log.Debugf("Loaded %d of %d utxos of the utxo snapshot",
+			numUtxos, snapshot.Utxos)
+	}
+	return chainhash.Hash(h.Digest()), nil
+}
+
+// clearSnapshotLoad removes a partially loaded utxo set snapshot from the utxo
+// set, which only contains the outputs of the snapshot since snapshots are
+// only loaded into a chain which only has the genesis block.
+func (b *BlockChain) clearSnapshotLoad() error {
+	if err := dbClearBucket(b.db, utxoSetBucketName); err != nil {
+		return err
+	}
+	return b.db.Update(func(dbTx database.Tx) error {
+		_, err := dbTx.Metadata().CreateBucket(utxoSetBucketName)
+		if err != nil {
+			return err
+		}
+		return dbTx.Metadata().Delete(snapshotLoadKeyName)
+	})
+}
+
+// initSnapshotValidation removes the utxo set snapshot which was being loaded
+// when the node was not shut down cleanly, if any, and resumes the background
+// validation of the blocks before a loaded snapshot when it is not complete.
+// The utxo set built by the background validation is cached with a cache of
+// the passed size in bytes.
+func (b *BlockChain) initSnapshotValidation(maxSize uint64) error {
+	var loading bool
+	var serialized, stateHash []byte
+	err := b.db.View(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		loading = meta.Get(snapshotLoadKeyName) != nil
+		serialized = copySliceBytes(meta.Get(snapshotValidationKeyName))
+		stateHash = copySliceBytes(meta.Get(snapshotUtxoStateKeyName))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if loading {
+		log.Warnf("Removing partially loaded utxo snapshot")
+		if err := b.clearSnapshotLoad(); err != nil {
+			return err
+		}
+	}
+	if serialized == nil {
+		return nil
+	}
+	if len(serialized) != snapshotValidationStateSize {
+		return database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt utxo snapshot validation state",
+		}
+	}
+
+	var baseHash, muHash chainhash.Hash
+	copy(baseHash[:], serialized)
+	offset := chainhash.HashSize + 4
+	copy(muHash[:], serialized[offset:])
+	offset += chainhash.HashSize
+	base := b.index.LookupNode(&baseHash)
+	if base == nil || !b.bestChain.Contains(base) {
+		return AssertError(fmt.Sprintf("utxo snapshot block %v is not "+
+			"in the main chain", baseHash))
+	}
+	tip := b.bestChain.Genesis()
+	if len(stateHash) == chainhash.HashSize {
+		var hash chainhash.Hash
+		copy(hash[:], stateHash)
+		tip = b.index.LookupNode(&hash)
+		if tip == nil || !b.bestChain.Contains(tip) ||
+			tip.height > base.height {
+
+			return AssertError(fmt.Sprintf("utxo snapshot "+
+				"validation is at unexpected block %v", hash))
+		}
+	}
+
+	sv := &snapshotValidation{
+		base:   base,
+		muHash: muHash,
+		tip:    tip,
+		cache: newUtxoCacheForBucket(b.db, maxSize,
+			snapshotUtxoSetBucketName, snapshotUtxoStateKeyName),
+		failed: serialized[offset] != 0,
+	}
+	sv.cache.lastFlushHash = tip.hash
+	b.snapshotValidation = sv
+	if sv.failed {
+		log.Errorf("The blocks before the utxo snapshot at height %d "+
+			"do not match the snapshot.  The chain state must be "+
+			"rebuilt without the snapshot", base.height)
+		return nil
+	}
+	log.Infof("Resuming background validation of the blocks before the "+
+		"utxo snapshot at height %d from height %d", base.height,
+		tip.height)
+	return nil
+}
+
+// copySliceBytes returns a copy of the passed byte slice or nil when it is nil.
+func copySliceBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+// SnapshotValidation returns the progress of the background validation of the
+// blocks before the loaded utxo set snapshot or nil when no snapshot is being
+// validated.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SnapshotValidation() *SnapshotValidation {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	sv := b.snapshotValidation
+	if sv == nil {
+		return nil
+	}
+	return &SnapshotValidation{
+		Hash:            sv.base.hash,
+		Height:          sv.base.height,
+		ValidatedHeight: sv.tip.height,
+		Failed:          sv.failed,
+	}
+}
+
+// SnapshotValidationBlocks returns the hashes of up to the passed number of
+// blocks which are the next to be passed to ValidateSnapshotBlock, in the order
+// they have to be validated.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SnapshotValidationBlocks(maxHashes int) []chainhash.Hash {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	sv := b.snapshotValidation
+	if sv == nil || sv.failed {
+		return nil
+	}
+	var hashes []chainhash.Hash
+	node := b.bestChain.Next(sv.tip)
+	for ; node != nil && len(hashes) < maxHashes; node = b.bestChain.Next(node) {
+		if node.height > sv.base.height {
+			break
+		}
+		hashes = append(hashes, node.hash)
+	}
+	return hashes
+}
+
+// ValidateSnapshotBlock fully validates the passed block before the loaded
+// utxo set snapshot, which must be the next one returned by
+// SnapshotValidationBlocks, and connects it to the utxo set built by the
+// background validation.  The block is stored along with its spend journal
+// entry, so the chain behaves as if it had been synced without the snapshot
+// once all of the blocks were validated.
+//
+// Once the block of the snapshot is connected, the utxo set built by the
+// background validation is compared to the snapshot.  An error is returned when
+// they do not match, in which case the chain state derived from the snapshot
+// can't be trusted.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ValidateSnapshotBlock(block *btcutil.Block) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	sv := b.snapshotValidation
+	if sv == nil || sv.failed {
+		return fmt.Errorf("no utxo snapshot is being validated")
+	}
+	node := b.bestChain.Next(sv.tip)
+	if node == nil || node.height > sv.base.height ||
+		!node.hash.IsEqual(block.Hash()) {
+
+		return fmt.Errorf("block %v is not the next block to validate",
+			block.Hash())
+	}
+	block.SetHeight(node.height)
+
+	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource,
+		BFNone)
+	if err != nil {
+		return err
+	}
+	if err := b.checkBlockContext(block, node.parent, BFNone); err != nil {
+		return err
+	}
+	view := NewUtxoViewpoint()
+	view.SetBestHash(&sv.tip.hash)
+	stxos := make([]SpentTxOut, 0, countSpentOutputs(block))
+	err = b.checkConnectBlock(node, block, view, &stxos, sv.cache)
+	if err != nil {
+		return err
+	}
+
+	// Store the block and its spend journal entry and connect it to the
+	// utxo set of the background validation.
+	err = b.db.Update(func(dbTx database.Tx) error {
+		if err := dbStoreBlock(dbTx, block); err != nil {
+			return err
+		}
+		return dbPutSpendJournalEntry(dbTx, block.Hash(), node.height,
+			stxos)
+	})
+	if err != nil {
+		return err
+	}
+	b.index.SetStatusFlags(node, statusDataStored|statusValid)
+	if err := b.index.flushToDB(); err != nil {
+		return err
+	}
+	sv.cache.commit(view)
+	sv.tip = node
+	if node != sv.base {
+		return sv.cache.flush(FlushPeriodic, &node.hash)
+	}
+
+	// Compare the utxo set built from the blocks to the snapshot.
+	if err := sv.cache.flush(FlushRequired, &node.hash); err != nil {
+		return err
+	}
+	result := &UtxoSetHash{Hash: node.hash, Height: node.height}
+	err = b.db.View(func(dbTx database.Tx) error {
+		return dbUtxoSetMuHash(dbTx, snapshotUtxoSetBucketName, result,
+			nil)
+	})
+	if err != nil {
+		return err
+	}
+	if result.MuHash != sv.muHash {
+		sv.failed = true
+		err := b.db.Update(func(dbTx database.Tx) error {
+			return dbPutSnapshotValidation(dbTx, sv)
+		})
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("the utxo set as of block %v has muhash %v "+
+			"instead of the muhash %v of the utxo snapshot",
+			node.hash, result.MuHash, sv.muHash)
+	}
+
+	// The snapshot is valid, so the utxo set built by the background
+	// validation is no longer needed.
+	if err := dbClearBucket(b.db, snapshotUtxoSetBucketName); err != nil {
+		return err
+	}
+	err = b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.Delete(snapshotUtxoStateKeyName); err != nil {
+			return err
+		}
+		return meta.Delete(snapshotValidationKeyName)
+	})
+	if err != nil {
+		return err
+	}
+	b.snapshotValidation = nil
+	log.Infof("Validated the blocks before the utxo snapshot at height %d",
+		node.height)
+	return nil
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// TestUtxoSnapshot ensures a utxo set snapshot created by a fully validated
+// chain can be loaded into a new chain, which can then extend it right away
+// and validate the blocks before it in the background.
+func TestUtxoSnapshot(t *testing.T) {
+	blocks, err := loadBlocks("blk_0_to_4.dat.bz2")
+	if err != nil {
+		t.Fatalf("Error loading file: %v\n", err)
+	}
+
+	// Create a snapshot as of block 2.  The source chain is torn down once
+	// the snapshot is created since the teardown removes the directory of
+	// all test databases.
+	src, teardownSrc, err := chainSetup("utxosnapshotsrc",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	src.TstSetCoinbaseMaturity(1)
+	for _, block := range blocks[1:3] {
+		if _, _, err := src.ProcessBlock(block, BFNone); err != nil {
+			teardownSrc()
+			t.Fatalf("ProcessBlock: %v", err)
+		}
+	}
+	var buf bytes.Buffer
+	snapshot, err := src.DumpUtxoSnapshot(&buf, nil)
+	teardownSrc()
+	if err != nil {
+		t.Fatalf("DumpUtxoSnapshot: %v", err)
+	}
+	wantMuHash := "5fe209f0d8ac8dfb24055e05a07630eff6998a9017abc483f073cef490a336c1"
+	if snapshot.Hash != *blocks[2].Hash() || snapshot.Height != 2 ||
+		snapshot.Utxos != 3 || snapshot.MuHash.String() != wantMuHash {
+
+		t.Fatalf("DumpUtxoSnapshot: unexpected snapshot %+v", snapshot)
+	}
+
+	// Snapshots which are not listed in the parameters must be rejected.
+	// The chain instance copies the parameters, however the assumeutxo
+	// entries are shared, so they are modified below.
+	var badMuHash chainhash.Hash
+	params := chaincfg.MainNetParams
+	params.AssumeUtxo = []chaincfg.AssumeUtxo{{
+		Height:       snapshot.Height + 1,
+		Hash:         &snapshot.Hash,
+		MuHash:       &badMuHash,
+		ChainTxCount: 3,
+	}}
+	chain, teardownFunc, err := chainSetup("utxosnapshot", &params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	chain.TstSetCoinbaseMaturity(1)
+	_, err = chain.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes()), nil)
+	if err == nil {
+		t.Fatal("LoadUtxoSnapshot: loaded unknown snapshot")
+	}
+
+	// A snapshot with a different utxo set must be rejected and leave the
+	// chain untouched.
+	params.AssumeUtxo[0].Height = snapshot.Height
+	_, err = chain.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes()), nil)
+	if err == nil {
+		t.Fatal("LoadUtxoSnapshot: loaded snapshot with bad muhash")
+	}
+	if height := chain.BestSnapshot().Height; height != 0 {
+		t.Fatalf("LoadUtxoSnapshot: chain at height %d after failed "+
+			"load", height)
+	}
+	got, err := chain.UtxoSetMuHash(nil)
+	if err != nil {
+		t.Fatalf("UtxoSetMuHash: %v", err)
+	}
+	if got.TxOuts != 0 {
+		t.Fatalf("LoadUtxoSnapshot: %d outputs left after failed load",
+			got.TxOuts)
+	}
+
+	// Load the snapshot.
+	params.AssumeUtxo[0].MuHash = &snapshot.MuHash
+	_, err = chain.LoadUtxoSnapshot(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("LoadUtxoSnapshot: %v", err)
+	}
+	best := chain.BestSnapshot()
+	if best.Hash != snapshot.Hash || best.Height != 2 || best.TotalTxns != 3 {
+		t.Fatalf("LoadUtxoSnapshot: unexpected best state %+v", best)
+	}
+	got, err = chain.UtxoSetMuHash(nil)
+	if err != nil {
+		t.Fatalf("UtxoSetMuHash: %v", err)
+	}
+	if got.MuHash != snapshot.MuHash {
+		t.Fatalf("LoadUtxoSnapshot: got muhash %v, want %v", got.MuHash,
+			snapshot.MuHash)
+	}
+	if _, err := chain.DumpUtxoSnapshot(&bytes.Buffer{}, nil); err == nil {
+		t.Fatal("DumpUtxoSnapshot: dumped unvalidated snapshot")
+	}
+
+	// The chain must be extended from the snapshot right away.
+	for _, block := range blocks[3:] {
+		if _, _, err := chain.ProcessBlock(block, BFNone); err != nil {
+			t.Fatalf("ProcessBlock: %v", err)
+		}
+	}
+	if height := chain.BestSnapshot().Height; height != 4 {
+		t.Fatalf("ProcessBlock: chain at height %d, want 4", height)
+	}
+
+	// Validate the blocks before the snapshot in the background.
+	hashes := chain.SnapshotValidationBlocks(10)
+	if len(hashes) != 2 || hashes[0] != *blocks[1].Hash() ||
+		hashes[1] != *blocks[2].Hash() {
+
+		t.Fatalf("SnapshotValidationBlocks: unexpected hashes %v", hashes)
+	}
+	if err := chain.ValidateSnapshotBlock(blocks[2]); err == nil {
+		t.Fatal("ValidateSnapshotBlock: validated block out of order")
+	}
+	if err := chain.ValidateSnapshotBlock(blocks[1]); err != nil {
+		t.Fatalf("ValidateSnapshotBlock: %v", err)
+	}
+	sv := chain.SnapshotValidation()
+	if sv == nil || sv.Height != 2 || sv.ValidatedHeight != 1 || sv.Failed {
+		t.Fatalf("SnapshotValidation: unexpected state %+v", sv)
+	}
+
+	// The background validation must be resumed by a new instance.
+	if err := chain.FlushUtxoCache(FlushRequired); err != nil {
+		t.Fatalf("FlushUtxoCache: %v", err)
+	}
+	chain, err = New(&Config{
+		DB:          chain.db,
+		ChainParams: chain.chainParams,
+		TimeSource:  NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	chain.TstSetCoinbaseMaturity(1)
+	if got := chain.SnapshotValidation(); got == nil || *got != *sv {
+		t.Fatalf("SnapshotValidation: got %+v after restart, want %+v",
+			got, sv)
+	}
+	if best := chain.BestSnapshot(); best.Height != 4 {
+		t.Fatalf("New: chain at height %d after restart", best.Height)
+	}
+	if err := chain.ValidateSnapshotBlock(blocks[2]); err != nil {
+		t.Fatalf("ValidateSnapshotBlock: %v", err)
+	}
+	if sv := chain.SnapshotValidation(); sv != nil {
+		t.Fatalf("SnapshotValidation: validation not complete %+v", sv)
+	}
+
+	// The validated blocks and their spend journal entries must be
+	// available now.
+	if _, err := chain.BlockByHash(blocks[1].Hash()); err != nil {
+		t.Fatalf("BlockByHash: %v", err)
+	}
+	if _, err := chain.FetchSpendJournal(blocks[2]); err != nil {
+		t.Fatalf("FetchSpendJournal: %v", err)
+	}
+	if _, err := chain.DumpUtxoSnapshot(&bytes.Buffer{}, nil); err != nil {
+		t.Fatalf("DumpUtxoSnapshot: %v", err)
+	}
+}
@@ -138,6 +138,19 @@ func TestCheckConnectBlockTemplate(t *testing.T) {
 			"block 4 with bad nonce: %v", err)
 	}
 
+	// Block 4 should only fail to connect with the bad nonce when the proof
+	// of work is checked.
+	err = chain.CheckConnectBlock(blocks[4], BFNone)
+	if err != nil {
+		t.Fatalf("CheckConnectBlock: Received unexpected error on "+
+			"block 4: %v", err)
+	}
+	err = chain.CheckConnectBlock(btcutil.NewBlock(&invalidPowBlock), BFNone)
+	if rerr, ok := err.(RuleError); !ok || rerr.ErrorCode != ErrHighHash {
+		t.Fatalf("CheckConnectBlock: Did not receive expected error "+
+			"on block 4 with bad nonce: %v", err)
+	}
+
 	// Invalid block building on chain tip should fail to connect.
 	invalidBlock := *blocks[4].MsgBlock()
 	invalidBlock.Header.Bits--
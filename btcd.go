@@ -15,8 +15,10 @@ import (
 	"runtime/debug"
 	"runtime/pprof"
 
+	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/blockchain/indexers"
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/database/ffldb"
 	"github.com/btcsuite/btcd/limits"
 )
 
@@ -150,6 +152,32 @@ func btcdMain(serverChan chan<- *server) error {
 
 		return nil
 	}
+	if cfg.DropUtreexoIndex {
+		if err := indexers.DropUtreexoIndex(db, interrupt); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
+	if cfg.DropUtxoScriptIndex {
+		err := indexers.DropUtxoScriptIndex(db, interrupt)
+		if err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
+	if cfg.DropSpendIndex {
+		err := indexers.DropSpendIndex(db, interrupt)
+		if err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
 
 	// Create server and start it.
 	server, err := newServer(cfg.Listeners, cfg.AgentBlacklist,
@@ -164,6 +192,15 @@ func btcdMain(serverChan chan<- *server) error {
 		btcdLog.Infof("Gracefully shutting down the server...")
 		server.Stop()
 		server.WaitForShutdown()
+
+		// Write the UTXO cache to the database now that no more blocks
+		// are processed so it does not have to be recovered on the next
+		// start.
+		btcdLog.Infof("Flushing UTXO cache to the database...")
+		err := server.chain.FlushUtxoCache(blockchain.FlushRequired)
+		if err != nil {
+			btcdLog.Errorf("Unable to flush UTXO cache: %v", err)
+		}
 		srvrLog.Infof("Server shutdown complete")
 	}()
 	server.Start()
@@ -278,7 +315,15 @@ func loadBlockDB() (database.DB, error) {
 	removeRegressionDB(dbPath)
 
 	btcdLog.Infof("Loading block database from '%s'", dbPath)
-	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net)
+	dbOpts := &ffldb.Options{
+		MmapReads:       cfg.DbMmap,
+		CompactIdleTime: cfg.DbCompactIdle,
+		CompactRate:     cfg.DbCompactRate,
+		BlockFileSize:   cfg.DbBlockFileSize * 1024 * 1024,
+		WriteBufferSize: cfg.DbWriteBuffer * 1024,
+		Preallocate:     cfg.DbPreallocate,
+	}
+	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net, dbOpts)
 	if err != nil {
 		// Return the error if it's not because the database doesn't
 		// exist.
@@ -293,7 +338,8 @@ func loadBlockDB() (database.DB, error) {
 		if err != nil {
 			return nil, err
 		}
-		db, err = database.Create(cfg.DbType, dbPath, activeNetParams.Net)
+		db, err = database.Create(cfg.DbType, dbPath, activeNetParams.Net,
+			dbOpts)
 		if err != nil {
 			return nil, err
 		}
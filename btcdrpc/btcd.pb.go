@@ -0,0 +1,1299 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: btcd.proto
+
+package btcdrpc
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type BlockEvent_Type int32
+
+const (
+	BlockEvent_CONNECTED    BlockEvent_Type = 0
+	BlockEvent_DISCONNECTED BlockEvent_Type = 1
+)
+
+var BlockEvent_Type_name = map[int32]string{
+	0: "CONNECTED",
+	1: "DISCONNECTED",
+}
+
+var BlockEvent_Type_value = map[string]int32{
+	"CONNECTED":    0,
+	"DISCONNECTED": 1,
+}
+
+func (x BlockEvent_Type) String() string {
+	return proto.EnumName(BlockEvent_Type_name, int32(x))
+}
+
+func (BlockEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{9, 0}
+}
+
+type MempoolEvent_Type int32
+
+const (
+	MempoolEvent_ADDED    MempoolEvent_Type = 0
+	MempoolEvent_REMOVED  MempoolEvent_Type = 1
+	MempoolEvent_REPLACED MempoolEvent_Type = 2
+)
+
+var MempoolEvent_Type_name = map[int32]string{
+	0: "ADDED",
+	1: "REMOVED",
+	2: "REPLACED",
+}
+
+var MempoolEvent_Type_value = map[string]int32{
+	"ADDED":    0,
+	"REMOVED":  1,
+	"REPLACED": 2,
+}
+
+func (x MempoolEvent_Type) String() string {
+	return proto.EnumName(MempoolEvent_Type_name, int32(x))
+}
+
+func (MempoolEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{13, 0}
+}
+
+type GetBestBlockRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetBestBlockRequest) Reset()         { *m = GetBestBlockRequest{} }
+func (m *GetBestBlockRequest) String() string { return proto.CompactTextString(m) }
+func (*GetBestBlockRequest) ProtoMessage()    {}
+func (*GetBestBlockRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{0}
+}
+
+func (m *GetBestBlockRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetBestBlockRequest.Unmarshal(m, b)
+}
+func (m *GetBestBlockRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetBestBlockRequest.Marshal(b, m, deterministic)
+}
+func (m *GetBestBlockRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetBestBlockRequest.Merge(m, src)
+}
+func (m *GetBestBlockRequest) XXX_Size() int {
+	return xxx_messageInfo_GetBestBlockRequest.Size(m)
+}
+func (m *GetBestBlockRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetBestBlockRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetBestBlockRequest proto.InternalMessageInfo
+
+type GetBestBlockResponse struct {
+	Hash                 []byte   `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	Height               int32    `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetBestBlockResponse) Reset()         { *m = GetBestBlockResponse{} }
+func (m *GetBestBlockResponse) String() string { return proto.CompactTextString(m) }
+func (*GetBestBlockResponse) ProtoMessage()    {}
+func (*GetBestBlockResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{1}
+}
+
+func (m *GetBestBlockResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetBestBlockResponse.Unmarshal(m, b)
+}
+func (m *GetBestBlockResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetBestBlockResponse.Marshal(b, m, deterministic)
+}
+func (m *GetBestBlockResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetBestBlockResponse.Merge(m, src)
+}
+func (m *GetBestBlockResponse) XXX_Size() int {
+	return xxx_messageInfo_GetBestBlockResponse.Size(m)
+}
+func (m *GetBestBlockResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetBestBlockResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetBestBlockResponse proto.InternalMessageInfo
+
+func (m *GetBestBlockResponse) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+func (m *GetBestBlockResponse) GetHeight() int32 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+type GetBlockRequest struct {
+	// The hash of the block.  The block at the height is returned when the
+	// hash is not set.
+	Hash                 []byte   `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	Height               int32    `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetBlockRequest) Reset()         { *m = GetBlockRequest{} }
+func (m *GetBlockRequest) String() string { return proto.CompactTextString(m) }
+func (*GetBlockRequest) ProtoMessage()    {}
+func (*GetBlockRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{2}
+}
+
+func (m *GetBlockRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetBlockRequest.Unmarshal(m, b)
+}
+func (m *GetBlockRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetBlockRequest.Marshal(b, m, deterministic)
+}
+func (m *GetBlockRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetBlockRequest.Merge(m, src)
+}
+func (m *GetBlockRequest) XXX_Size() int {
+	return xxx_messageInfo_GetBlockRequest.Size(m)
+}
+func (m *GetBlockRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetBlockRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetBlockRequest proto.InternalMessageInfo
+
+func (m *GetBlockRequest) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+func (m *GetBlockRequest) GetHeight() int32 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+type GetBlockResponse struct {
+	Block                []byte   `protobuf:"bytes,1,opt,name=block,proto3" json:"block,omitempty"`
+	Height               int32    `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	Confirmations        int32    `protobuf:"varint,3,opt,name=confirmations,proto3" json:"confirmations,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetBlockResponse) Reset()         { *m = GetBlockResponse{} }
+func (m *GetBlockResponse) String() string { return proto.CompactTextString(m) }
+func (*GetBlockResponse) ProtoMessage()    {}
+func (*GetBlockResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{3}
+}
+
+func (m *GetBlockResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetBlockResponse.Unmarshal(m, b)
+}
+func (m *GetBlockResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetBlockResponse.Marshal(b, m, deterministic)
+}
+func (m *GetBlockResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetBlockResponse.Merge(m, src)
+}
+func (m *GetBlockResponse) XXX_Size() int {
+	return xxx_messageInfo_GetBlockResponse.Size(m)
+}
+func (m *GetBlockResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetBlockResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetBlockResponse proto.InternalMessageInfo
+
+func (m *GetBlockResponse) GetBlock() []byte {
+	if m != nil {
+		return m.Block
+	}
+	return nil
+}
+
+func (m *GetBlockResponse) GetHeight() int32 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func (m *GetBlockResponse) GetConfirmations() int32 {
+	if m != nil {
+		return m.Confirmations
+	}
+	return 0
+}
+
+type GetTransactionRequest struct {
+	Txid                 []byte   `protobuf:"bytes,1,opt,name=txid,proto3" json:"txid,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetTransactionRequest) Reset()         { *m = GetTransactionRequest{} }
+func (m *GetTransactionRequest) String() string { return proto.CompactTextString(m) }
+func (*GetTransactionRequest) ProtoMessage()    {}
+func (*GetTransactionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{4}
+}
+
+func (m *GetTransactionRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTransactionRequest.Unmarshal(m, b)
+}
+func (m *GetTransactionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTransactionRequest.Marshal(b, m, deterministic)
+}
+func (m *GetTransactionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTransactionRequest.Merge(m, src)
+}
+func (m *GetTransactionRequest) XXX_Size() int {
+	return xxx_messageInfo_GetTransactionRequest.Size(m)
+}
+func (m *GetTransactionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTransactionRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTransactionRequest proto.InternalMessageInfo
+
+func (m *GetTransactionRequest) GetTxid() []byte {
+	if m != nil {
+		return m.Txid
+	}
+	return nil
+}
+
+type GetTransactionResponse struct {
+	Transaction []byte `protobuf:"bytes,1,opt,name=transaction,proto3" json:"transaction,omitempty"`
+	// The block containing the transaction.  They are not set for
+	// transactions in the memory pool.
+	BlockHash            []byte   `protobuf:"bytes,2,opt,name=block_hash,json=blockHash,proto3" json:"block_hash,omitempty"`
+	BlockHeight          int32    `protobuf:"varint,3,opt,name=block_height,json=blockHeight,proto3" json:"block_height,omitempty"`
+	Confirmations        int32    `protobuf:"varint,4,opt,name=confirmations,proto3" json:"confirmations,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetTransactionResponse) Reset()         { *m = GetTransactionResponse{} }
+func (m *GetTransactionResponse) String() string { return proto.CompactTextString(m) }
+func (*GetTransactionResponse) ProtoMessage()    {}
+func (*GetTransactionResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{5}
+}
+
+func (m *GetTransactionResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTransactionResponse.Unmarshal(m, b)
+}
+func (m *GetTransactionResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTransactionResponse.Marshal(b, m, deterministic)
+}
+func (m *GetTransactionResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTransactionResponse.Merge(m, src)
+}
+func (m *GetTransactionResponse) XXX_Size() int {
+	return xxx_messageInfo_GetTransactionResponse.Size(m)
+}
+func (m *GetTransactionResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTransactionResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTransactionResponse proto.InternalMessageInfo
+
+func (m *GetTransactionResponse) GetTransaction() []byte {
+	if m != nil {
+		return m.Transaction
+	}
+	return nil
+}
+
+func (m *GetTransactionResponse) GetBlockHash() []byte {
+	if m != nil {
+		return m.BlockHash
+	}
+	return nil
+}
+
+func (m *GetTransactionResponse) GetBlockHeight() int32 {
+	if m != nil {
+		return m.BlockHeight
+	}
+	return 0
+}
+
+func (m *GetTransactionResponse) GetConfirmations() int32 {
+	if m != nil {
+		return m.Confirmations
+	}
+	return 0
+}
+
+type SubmitTransactionRequest struct {
+	Transaction          []byte   `protobuf:"bytes,1,opt,name=transaction,proto3" json:"transaction,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubmitTransactionRequest) Reset()         { *m = SubmitTransactionRequest{} }
+func (m *SubmitTransactionRequest) String() string { return proto.CompactTextString(m) }
+func (*SubmitTransactionRequest) ProtoMessage()    {}
+func (*SubmitTransactionRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{6}
+}
+
+func (m *SubmitTransactionRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubmitTransactionRequest.Unmarshal(m, b)
+}
+func (m *SubmitTransactionRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubmitTransactionRequest.Marshal(b, m, deterministic)
+}
+func (m *SubmitTransactionRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubmitTransactionRequest.Merge(m, src)
+}
+func (m *SubmitTransactionRequest) XXX_Size() int {
+	return xxx_messageInfo_SubmitTransactionRequest.Size(m)
+}
+func (m *SubmitTransactionRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubmitTransactionRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubmitTransactionRequest proto.InternalMessageInfo
+
+func (m *SubmitTransactionRequest) GetTransaction() []byte {
+	if m != nil {
+		return m.Transaction
+	}
+	return nil
+}
+
+type SubmitTransactionResponse struct {
+	Txid                 []byte   `protobuf:"bytes,1,opt,name=txid,proto3" json:"txid,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubmitTransactionResponse) Reset()         { *m = SubmitTransactionResponse{} }
+func (m *SubmitTransactionResponse) String() string { return proto.CompactTextString(m) }
+func (*SubmitTransactionResponse) ProtoMessage()    {}
+func (*SubmitTransactionResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{7}
+}
+
+func (m *SubmitTransactionResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubmitTransactionResponse.Unmarshal(m, b)
+}
+func (m *SubmitTransactionResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubmitTransactionResponse.Marshal(b, m, deterministic)
+}
+func (m *SubmitTransactionResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubmitTransactionResponse.Merge(m, src)
+}
+func (m *SubmitTransactionResponse) XXX_Size() int {
+	return xxx_messageInfo_SubmitTransactionResponse.Size(m)
+}
+func (m *SubmitTransactionResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubmitTransactionResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubmitTransactionResponse proto.InternalMessageInfo
+
+func (m *SubmitTransactionResponse) GetTxid() []byte {
+	if m != nil {
+		return m.Txid
+	}
+	return nil
+}
+
+type SubscribeBlocksRequest struct {
+	// Whether to include the full block in the events rather than only
+	// its header.
+	IncludeBlock         bool     `protobuf:"varint,1,opt,name=include_block,json=includeBlock,proto3" json:"include_block,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscribeBlocksRequest) Reset()         { *m = SubscribeBlocksRequest{} }
+func (m *SubscribeBlocksRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeBlocksRequest) ProtoMessage()    {}
+func (*SubscribeBlocksRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{8}
+}
+
+func (m *SubscribeBlocksRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeBlocksRequest.Unmarshal(m, b)
+}
+func (m *SubscribeBlocksRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeBlocksRequest.Marshal(b, m, deterministic)
+}
+func (m *SubscribeBlocksRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeBlocksRequest.Merge(m, src)
+}
+func (m *SubscribeBlocksRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeBlocksRequest.Size(m)
+}
+func (m *SubscribeBlocksRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeBlocksRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeBlocksRequest proto.InternalMessageInfo
+
+func (m *SubscribeBlocksRequest) GetIncludeBlock() bool {
+	if m != nil {
+		return m.IncludeBlock
+	}
+	return false
+}
+
+type BlockEvent struct {
+	// The sequence number of the chain notification the event was created
+	// from.  It orders the events of the block and transaction streams.
+	Sequence uint64          `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Type     BlockEvent_Type `protobuf:"varint,2,opt,name=type,proto3,enum=btcdrpc.BlockEvent_Type" json:"type,omitempty"`
+	Hash     []byte          `protobuf:"bytes,3,opt,name=hash,proto3" json:"hash,omitempty"`
+	Height   int32           `protobuf:"varint,4,opt,name=height,proto3" json:"height,omitempty"`
+	Header   []byte          `protobuf:"bytes,5,opt,name=header,proto3" json:"header,omitempty"`
+	// The full block, which is only set when it was requested.
+	Block                []byte   `protobuf:"bytes,6,opt,name=block,proto3" json:"block,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BlockEvent) Reset()         { *m = BlockEvent{} }
+func (m *BlockEvent) String() string { return proto.CompactTextString(m) }
+func (*BlockEvent) ProtoMessage()    {}
+func (*BlockEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{9}
+}
+
+func (m *BlockEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BlockEvent.Unmarshal(m, b)
+}
+func (m *BlockEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BlockEvent.Marshal(b, m, deterministic)
+}
+func (m *BlockEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BlockEvent.Merge(m, src)
+}
+func (m *BlockEvent) XXX_Size() int {
+	return xxx_messageInfo_BlockEvent.Size(m)
+}
+func (m *BlockEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_BlockEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BlockEvent proto.InternalMessageInfo
+
+func (m *BlockEvent) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *BlockEvent) GetType() BlockEvent_Type {
+	if m != nil {
+		return m.Type
+	}
+	return BlockEvent_CONNECTED
+}
+
+func (m *BlockEvent) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+func (m *BlockEvent) GetHeight() int32 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
+func (m *BlockEvent) GetHeader() []byte {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *BlockEvent) GetBlock() []byte {
+	if m != nil {
+		return m.Block
+	}
+	return nil
+}
+
+type SubscribeTransactionsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscribeTransactionsRequest) Reset()         { *m = SubscribeTransactionsRequest{} }
+func (m *SubscribeTransactionsRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeTransactionsRequest) ProtoMessage()    {}
+func (*SubscribeTransactionsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{10}
+}
+
+func (m *SubscribeTransactionsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeTransactionsRequest.Unmarshal(m, b)
+}
+func (m *SubscribeTransactionsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeTransactionsRequest.Marshal(b, m, deterministic)
+}
+func (m *SubscribeTransactionsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeTransactionsRequest.Merge(m, src)
+}
+func (m *SubscribeTransactionsRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeTransactionsRequest.Size(m)
+}
+func (m *SubscribeTransactionsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeTransactionsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeTransactionsRequest proto.InternalMessageInfo
+
+type TransactionEvent struct {
+	Sequence    uint64 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Transaction []byte `protobuf:"bytes,2,opt,name=transaction,proto3" json:"transaction,omitempty"`
+	BlockHash   []byte `protobuf:"bytes,3,opt,name=block_hash,json=blockHash,proto3" json:"block_hash,omitempty"`
+	BlockHeight int32  `protobuf:"varint,4,opt,name=block_height,json=blockHeight,proto3" json:"block_height,omitempty"`
+	// The index of the transaction in the block.
+	Index                uint32   `protobuf:"varint,5,opt,name=index,proto3" json:"index,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TransactionEvent) Reset()         { *m = TransactionEvent{} }
+func (m *TransactionEvent) String() string { return proto.CompactTextString(m) }
+func (*TransactionEvent) ProtoMessage()    {}
+func (*TransactionEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{11}
+}
+
+func (m *TransactionEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TransactionEvent.Unmarshal(m, b)
+}
+func (m *TransactionEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TransactionEvent.Marshal(b, m, deterministic)
+}
+func (m *TransactionEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TransactionEvent.Merge(m, src)
+}
+func (m *TransactionEvent) XXX_Size() int {
+	return xxx_messageInfo_TransactionEvent.Size(m)
+}
+func (m *TransactionEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_TransactionEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TransactionEvent proto.InternalMessageInfo
+
+func (m *TransactionEvent) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *TransactionEvent) GetTransaction() []byte {
+	if m != nil {
+		return m.Transaction
+	}
+	return nil
+}
+
+func (m *TransactionEvent) GetBlockHash() []byte {
+	if m != nil {
+		return m.BlockHash
+	}
+	return nil
+}
+
+func (m *TransactionEvent) GetBlockHeight() int32 {
+	if m != nil {
+		return m.BlockHeight
+	}
+	return 0
+}
+
+func (m *TransactionEvent) GetIndex() uint32 {
+	if m != nil {
+		return m.Index
+	}
+	return 0
+}
+
+type SubscribeMempoolRequest struct {
+	// Whether to send an ADDED event for every transaction in the pool
+	// before the changes, so the pool can be mirrored by applying them.
+	Snapshot bool `protobuf:"varint,1,opt,name=snapshot,proto3" json:"snapshot,omitempty"`
+	// Whether to include the transactions in the ADDED events rather than
+	// only their hashes.
+	IncludeTransactions  bool     `protobuf:"varint,2,opt,name=include_transactions,json=includeTransactions,proto3" json:"include_transactions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscribeMempoolRequest) Reset()         { *m = SubscribeMempoolRequest{} }
+func (m *SubscribeMempoolRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeMempoolRequest) ProtoMessage()    {}
+func (*SubscribeMempoolRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{12}
+}
+
+func (m *SubscribeMempoolRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeMempoolRequest.Unmarshal(m, b)
+}
+func (m *SubscribeMempoolRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeMempoolRequest.Marshal(b, m, deterministic)
+}
+func (m *SubscribeMempoolRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeMempoolRequest.Merge(m, src)
+}
+func (m *SubscribeMempoolRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeMempoolRequest.Size(m)
+}
+func (m *SubscribeMempoolRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeMempoolRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeMempoolRequest proto.InternalMessageInfo
+
+func (m *SubscribeMempoolRequest) GetSnapshot() bool {
+	if m != nil {
+		return m.Snapshot
+	}
+	return false
+}
+
+func (m *SubscribeMempoolRequest) GetIncludeTransactions() bool {
+	if m != nil {
+		return m.IncludeTransactions
+	}
+	return false
+}
+
+type MempoolEvent struct {
+	// The sequence number increases by one for every change of the pool.
+	// The events of the snapshot carry the sequence number of the last
+	// change before it was taken.
+	Sequence uint64            `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Type     MempoolEvent_Type `protobuf:"varint,2,opt,name=type,proto3,enum=btcdrpc.MempoolEvent_Type" json:"type,omitempty"`
+	// The transaction which was added or removed.  For REPLACED events it
+	// is the replacement.
+	Txid        []byte `protobuf:"bytes,3,opt,name=txid,proto3" json:"txid,omitempty"`
+	Transaction []byte `protobuf:"bytes,4,opt,name=transaction,proto3" json:"transaction,omitempty"`
+	Fee         int64  `protobuf:"varint,5,opt,name=fee,proto3" json:"fee,omitempty"`
+	Vsize       int64  `protobuf:"varint,6,opt,name=vsize,proto3" json:"vsize,omitempty"`
+	// Why the transaction was removed, such as "block", "conflict",
+	// "reorg", "sizelimit", "expiry", "replaced", or "rejected".
+	Reason string `protobuf:"bytes,7,opt,name=reason,proto3" json:"reason,omitempty"`
+	// The transactions which were replaced by REPLACED events.
+	Replaced             [][]byte `protobuf:"bytes,8,rep,name=replaced,proto3" json:"replaced,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MempoolEvent) Reset()         { *m = MempoolEvent{} }
+func (m *MempoolEvent) String() string { return proto.CompactTextString(m) }
+func (*MempoolEvent) ProtoMessage()    {}
+func (*MempoolEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bccd1321292f9e57, []int{13}
+}
+
+func (m *MempoolEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MempoolEvent.Unmarshal(m, b)
+}
+func (m *MempoolEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MempoolEvent.Marshal(b, m, deterministic)
+}
+func (m *MempoolEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MempoolEvent.Merge(m, src)
+}
+func (m *MempoolEvent) XXX_Size() int {
+	return xxx_messageInfo_MempoolEvent.Size(m)
+}
+func (m *MempoolEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_MempoolEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MempoolEvent proto.InternalMessageInfo
+
+func (m *MempoolEvent) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *MempoolEvent) GetType() MempoolEvent_Type {
+	if m != nil {
+		return m.Type
+	}
+	return MempoolEvent_ADDED
+}
+
+func (m *MempoolEvent) GetTxid() []byte {
+	if m != nil {
+		return m.Txid
+	}
+	return nil
+}
+
+func (m *MempoolEvent) GetTransaction() []byte {
+	if m != nil {
+		return m.Transaction
+	}
+	return nil
+}
+
+func (m *MempoolEvent) GetFee() int64 {
+	if m != nil {
+		return m.Fee
+	}
+	return 0
+}
+
+func (m *MempoolEvent) GetVsize() int64 {
+	if m != nil {
+		return m.Vsize
+	}
+	return 0
+}
+
+func (m *MempoolEvent) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+func (m *MempoolEvent) GetReplaced() [][]byte {
+	if m != nil {
+		return m.Replaced
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("btcdrpc.BlockEvent_Type", BlockEvent_Type_name, BlockEvent_Type_value)
+	proto.RegisterEnum("btcdrpc.MempoolEvent_Type", MempoolEvent_Type_name, MempoolEvent_Type_value)
+	proto.RegisterType((*GetBestBlockRequest)(nil), "btcdrpc.GetBestBlockRequest")
+	proto.RegisterType((*GetBestBlockResponse)(nil), "btcdrpc.GetBestBlockResponse")
+	proto.RegisterType((*GetBlockRequest)(nil), "btcdrpc.GetBlockRequest")
+	proto.RegisterType((*GetBlockResponse)(nil), "btcdrpc.GetBlockResponse")
+	proto.RegisterType((*GetTransactionRequest)(nil), "btcdrpc.GetTransactionRequest")
+	proto.RegisterType((*GetTransactionResponse)(nil), "btcdrpc.GetTransactionResponse")
+	proto.RegisterType((*SubmitTransactionRequest)(nil), "btcdrpc.SubmitTransactionRequest")
+	proto.RegisterType((*SubmitTransactionResponse)(nil), "btcdrpc.SubmitTransactionResponse")
+	proto.RegisterType((*SubscribeBlocksRequest)(nil), "btcdrpc.SubscribeBlocksRequest")
+	proto.RegisterType((*BlockEvent)(nil), "btcdrpc.BlockEvent")
+	proto.RegisterType((*SubscribeTransactionsRequest)(nil), "btcdrpc.SubscribeTransactionsRequest")
+	proto.RegisterType((*TransactionEvent)(nil), "btcdrpc.TransactionEvent")
+	proto.RegisterType((*SubscribeMempoolRequest)(nil), "btcdrpc.SubscribeMempoolRequest")
+	proto.RegisterType((*MempoolEvent)(nil), "btcdrpc.MempoolEvent")
+}
+
+func init() { proto.RegisterFile("btcd.proto", fileDescriptor_bccd1321292f9e57) }
+
+var fileDescriptor_bccd1321292f9e57 = []byte{
+	// 767 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x56, 0xcd, 0x6e, 0xd3, 0x40,
+	0x10, 0xc6, 0xb1, 0xd3, 0x26, 0x53, 0xa7, 0x0d, 0xdb, 0xa4, 0xb8, 0x51, 0x7f, 0xd2, 0x05, 0x44,
+	0x24, 0xaa, 0xb4, 0x94, 0x2b, 0x15, 0x6a, 0x9a, 0x28, 0x54, 0xd0, 0x16, 0xdc, 0x8a, 0x43, 0x39,
+	0x54, 0xfe, 0xd9, 0x36, 0x16, 0x89, 0x6d, 0xbc, 0x9b, 0xaa, 0xe5, 0x51, 0x38, 0x72, 0xe2, 0x19,
+	0x78, 0x13, 0xde, 0x06, 0x79, 0xb3, 0x71, 0x1c, 0xdb, 0x21, 0xe2, 0xb6, 0x33, 0x3b, 0x33, 0x9e,
+	0xf9, 0xe6, 0xdb, 0x4f, 0x06, 0x30, 0x99, 0x65, 0x37, 0xfd, 0xc0, 0x63, 0x1e, 0x5a, 0x0c, 0xcf,
+	0x81, 0x6f, 0xe1, 0x2a, 0xac, 0x76, 0x09, 0x6b, 0x11, 0xca, 0x5a, 0x7d, 0xcf, 0xfa, 0xaa, 0x93,
+	0x6f, 0x43, 0x42, 0x19, 0x6e, 0x41, 0x65, 0xda, 0x4d, 0x7d, 0xcf, 0xa5, 0x04, 0x21, 0x50, 0x7a,
+	0x06, 0xed, 0x69, 0x52, 0x5d, 0x6a, 0xa8, 0x3a, 0x3f, 0xa3, 0x35, 0x58, 0xe8, 0x11, 0xe7, 0xb6,
+	0xc7, 0xb4, 0x5c, 0x5d, 0x6a, 0xe4, 0x75, 0x61, 0xe1, 0x43, 0x58, 0xe9, 0x92, 0x71, 0x3e, 0x2f,
+	0xfb, 0x5f, 0xe9, 0x37, 0x50, 0xee, 0x92, 0xc4, 0xe7, 0x2b, 0x90, 0x37, 0x43, 0x87, 0x28, 0x30,
+	0x32, 0x66, 0x55, 0x40, 0xcf, 0xa0, 0x64, 0x79, 0xee, 0x8d, 0x13, 0x0c, 0x0c, 0xe6, 0x78, 0x2e,
+	0xd5, 0x64, 0x7e, 0x3d, 0xed, 0xc4, 0x2f, 0xa1, 0xda, 0x25, 0xec, 0x32, 0x30, 0x5c, 0x6a, 0x58,
+	0xa1, 0x2b, 0xd6, 0x2c, 0xbb, 0x77, 0xec, 0x71, 0xb3, 0xe1, 0x19, 0xff, 0x94, 0x60, 0x2d, 0x19,
+	0x2d, 0x7a, 0xab, 0xc3, 0x12, 0x9b, 0xb8, 0x45, 0x56, 0xdc, 0x85, 0x36, 0x01, 0x78, 0xc3, 0xd7,
+	0x1c, 0x83, 0x1c, 0x0f, 0x28, 0x72, 0xcf, 0xbb, 0x10, 0x88, 0x1d, 0x50, 0xc5, 0xf5, 0x68, 0x98,
+	0x51, 0xb7, 0x4b, 0xa3, 0x80, 0x19, 0x13, 0x29, 0x59, 0x13, 0xbd, 0x01, 0xed, 0x62, 0x68, 0x0e,
+	0x9c, 0xac, 0xa1, 0xe6, 0x76, 0x89, 0xf7, 0x60, 0x3d, 0x23, 0x7b, 0xb2, 0xff, 0x14, 0x26, 0x87,
+	0xb0, 0x76, 0x31, 0x34, 0xa9, 0x15, 0x38, 0x26, 0xe1, 0xeb, 0xa2, 0xe3, 0x8f, 0x3d, 0x85, 0x92,
+	0xe3, 0x5a, 0xfd, 0xa1, 0x4d, 0xae, 0x27, 0x6b, 0x2b, 0xe8, 0xaa, 0x70, 0xf2, 0x60, 0xfc, 0x47,
+	0x02, 0xe0, 0xa7, 0xce, 0x1d, 0x71, 0x19, 0xaa, 0x41, 0x81, 0x86, 0xe9, 0xae, 0x45, 0x78, 0xb8,
+	0xa2, 0x47, 0x36, 0xda, 0x05, 0x85, 0x3d, 0xf8, 0x84, 0x43, 0xb7, 0x7c, 0xa0, 0x35, 0x05, 0x89,
+	0x9b, 0x93, 0xf4, 0xe6, 0xe5, 0x83, 0x4f, 0x74, 0x1e, 0x15, 0x91, 0x4d, 0xce, 0x24, 0x9b, 0x32,
+	0x45, 0x15, 0xee, 0x37, 0x6c, 0x12, 0x68, 0x79, 0x1e, 0x2d, 0xac, 0x09, 0xe1, 0x16, 0x62, 0x84,
+	0xc3, 0x2f, 0x40, 0x09, 0xbf, 0x83, 0x4a, 0x50, 0x3c, 0x3e, 0x3f, 0x3b, 0xeb, 0x1c, 0x5f, 0x76,
+	0xda, 0xe5, 0x47, 0xa8, 0x0c, 0x6a, 0xfb, 0xe4, 0x62, 0xe2, 0x91, 0xf0, 0x16, 0x6c, 0x44, 0xd0,
+	0xc4, 0xe0, 0x1c, 0x03, 0x84, 0x7f, 0x49, 0x50, 0x8e, 0xf9, 0xe7, 0x23, 0x90, 0x58, 0x5f, 0x6e,
+	0x1e, 0xc9, 0xe4, 0x79, 0x24, 0x53, 0xd2, 0x24, 0xab, 0x40, 0xde, 0x71, 0x6d, 0x72, 0xcf, 0xa1,
+	0x28, 0xe9, 0x23, 0x03, 0xf7, 0xe0, 0x49, 0x34, 0xca, 0x29, 0x19, 0xf8, 0x9e, 0xd7, 0x1f, 0xaf,
+	0x39, 0x6c, 0xd8, 0x35, 0x7c, 0xda, 0xf3, 0x98, 0xd8, 0x70, 0x64, 0xa3, 0x57, 0x50, 0x19, 0x53,
+	0x20, 0xd6, 0x25, 0xe5, 0x9d, 0x17, 0xf4, 0x55, 0x71, 0x17, 0xc7, 0x06, 0xff, 0xc8, 0x81, 0x2a,
+	0xbe, 0x30, 0x1f, 0x90, 0xe6, 0x14, 0x25, 0x6a, 0x11, 0x25, 0xe2, 0x05, 0x12, 0xa4, 0xe0, 0x04,
+	0x96, 0x27, 0x04, 0x4e, 0x82, 0xaa, 0xa4, 0x41, 0x2d, 0x83, 0x7c, 0x43, 0x08, 0x07, 0x44, 0xd6,
+	0xc3, 0x63, 0x08, 0xd2, 0x1d, 0x75, 0xbe, 0x13, 0x4e, 0x0c, 0x59, 0x1f, 0x19, 0x21, 0x8d, 0x02,
+	0x62, 0x50, 0xcf, 0xd5, 0x16, 0xeb, 0x52, 0xa3, 0xa8, 0x0b, 0x2b, 0x9c, 0x20, 0x20, 0x7e, 0xdf,
+	0xb0, 0x88, 0xad, 0x15, 0xea, 0x72, 0x43, 0xd5, 0x23, 0x1b, 0xef, 0x0a, 0x32, 0x15, 0x21, 0x7f,
+	0xd4, 0x6e, 0x73, 0x22, 0x2d, 0xc1, 0xa2, 0xde, 0x39, 0x3d, 0xff, 0x1c, 0x72, 0x08, 0xa9, 0x50,
+	0xd0, 0x3b, 0x1f, 0x3f, 0x1c, 0x1d, 0x77, 0xda, 0xe5, 0xdc, 0xc1, 0x6f, 0x05, 0x94, 0x16, 0xb3,
+	0x6c, 0xf4, 0x1e, 0xd4, 0xb8, 0x42, 0xa3, 0x8d, 0x68, 0xf4, 0x0c, 0x3d, 0xaf, 0x6d, 0xce, 0xb8,
+	0x15, 0xcf, 0xfa, 0x2d, 0x14, 0xc6, 0x5a, 0x8b, 0xb4, 0xa9, 0xd0, 0x78, 0x91, 0xf5, 0x8c, 0x1b,
+	0x51, 0xe0, 0x13, 0x2c, 0x4f, 0xcb, 0x22, 0xda, 0x8a, 0x07, 0xa7, 0x85, 0xa8, 0xb6, 0x3d, 0xf3,
+	0x5e, 0x94, 0xbc, 0x82, 0xc7, 0x29, 0x1d, 0x42, 0x3b, 0x51, 0xd6, 0x2c, 0x85, 0xab, 0xe1, 0x7f,
+	0x85, 0x88, 0xda, 0x27, 0xb0, 0x92, 0x90, 0x2c, 0xb4, 0x1d, 0x4f, 0xcb, 0x10, 0xb3, 0xda, 0x6a,
+	0x86, 0xdc, 0xec, 0x4b, 0xe8, 0x0b, 0x54, 0x33, 0x9f, 0x38, 0x7a, 0x9e, 0x2e, 0x98, 0x21, 0x01,
+	0x31, 0x50, 0x93, 0x42, 0xb0, 0x2f, 0xa1, 0x53, 0x28, 0x27, 0x1f, 0x1d, 0xaa, 0xa7, 0xeb, 0x4e,
+	0xbf, 0xc7, 0x5a, 0x35, 0xf3, 0x15, 0xec, 0x4b, 0x2d, 0x7c, 0x55, 0xbf, 0x75, 0x58, 0x6f, 0x68,
+	0x36, 0x2d, 0x6f, 0xb0, 0x67, 0x32, 0x8b, 0x0e, 0x1d, 0x46, 0xc2, 0x83, 0xbd, 0x27, 0x52, 0xcc,
+	0x05, 0xfe, 0x83, 0xf0, 0xfa, 0xef, 0x00, 0xff, 0x9d, 0x7d, 0x8c, 0x2e, 0x08, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// BtcdClient is the client API for Btcd service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type BtcdClient interface {
+	// GetBestBlock returns the hash and height of the best block of the
+	// main chain.
+	GetBestBlock(ctx context.Context, in *GetBestBlockRequest, opts ...grpc.CallOption) (*GetBestBlockResponse, error)
+	// GetBlock returns a block of the main chain by hash or height.
+	GetBlock(ctx context.Context, in *GetBlockRequest, opts ...grpc.CallOption) (*GetBlockResponse, error)
+	// GetTransaction returns a transaction from the memory pool or, when
+	// the transaction index is enabled, from the main chain.
+	GetTransaction(ctx context.Context, in *GetTransactionRequest, opts ...grpc.CallOption) (*GetTransactionResponse, error)
+	// SubmitTransaction adds a transaction to the memory pool and relays it
+	// to the network.
+	SubmitTransaction(ctx context.Context, in *SubmitTransactionRequest, opts ...grpc.CallOption) (*SubmitTransactionResponse, error)
+	// SubscribeBlocks streams the blocks which are connected to and
+	// disconnected from the main chain.
+	SubscribeBlocks(ctx context.Context, in *SubscribeBlocksRequest, opts ...grpc.CallOption) (Btcd_SubscribeBlocksClient, error)
+	// SubscribeTransactions streams the transactions of the blocks which are
+	// connected to the main chain.
+	SubscribeTransactions(ctx context.Context, in *SubscribeTransactionsRequest, opts ...grpc.CallOption) (Btcd_SubscribeTransactionsClient, error)
+	// SubscribeMempool streams the transactions which are added to,
+	// removed from, and replaced in the memory pool.
+	SubscribeMempool(ctx context.Context, in *SubscribeMempoolRequest, opts ...grpc.CallOption) (Btcd_SubscribeMempoolClient, error)
+}
+
+type btcdClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewBtcdClient(cc *grpc.ClientConn) BtcdClient {
+	return &btcdClient{cc}
+}
+
+func (c *btcdClient) GetBestBlock(ctx context.Context, in *GetBestBlockRequest, opts ...grpc.CallOption) (*GetBestBlockResponse, error) {
+	out := new(GetBestBlockResponse)
+	err := c.cc.Invoke(ctx, "/btcdrpc.Btcd/GetBestBlock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *btcdClient) GetBlock(ctx context.Context, in *GetBlockRequest, opts ...grpc.CallOption) (*GetBlockResponse, error) {
+	out := new(GetBlockResponse)
+	err := c.cc.Invoke(ctx, "/btcdrpc.Btcd/GetBlock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *btcdClient) GetTransaction(ctx context.Context, in *GetTransactionRequest, opts ...grpc.CallOption) (*GetTransactionResponse, error) {
+	out := new(GetTransactionResponse)
+	err := c.cc.Invoke(ctx, "/btcdrpc.Btcd/GetTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *btcdClient) SubmitTransaction(ctx context.Context, in *SubmitTransactionRequest, opts ...grpc.CallOption) (*SubmitTransactionResponse, error) {
+	out := new(SubmitTransactionResponse)
+	err := c.cc.Invoke(ctx, "/btcdrpc.Btcd/SubmitTransaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *btcdClient) SubscribeBlocks(ctx context.Context, in *SubscribeBlocksRequest, opts ...grpc.CallOption) (Btcd_SubscribeBlocksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Btcd_serviceDesc.Streams[0], "/btcdrpc.Btcd/SubscribeBlocks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &btcdSubscribeBlocksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Btcd_SubscribeBlocksClient interface {
+	Recv() (*BlockEvent, error)
+	grpc.ClientStream
+}
+
+type btcdSubscribeBlocksClient struct {
+	grpc.ClientStream
+}
+
+func (x *btcdSubscribeBlocksClient) Recv() (*BlockEvent, error) {
+	m := new(BlockEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *btcdClient) SubscribeTransactions(ctx context.Context, in *SubscribeTransactionsRequest, opts ...grpc.CallOption) (Btcd_SubscribeTransactionsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Btcd_serviceDesc.Streams[1], "/btcdrpc.Btcd/SubscribeTransactions", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &btcdSubscribeTransactionsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Btcd_SubscribeTransactionsClient interface {
+	Recv() (*TransactionEvent, error)
+	grpc.ClientStream
+}
+
+type btcdSubscribeTransactionsClient struct {
+	grpc.ClientStream
+}
+
+func (x *btcdSubscribeTransactionsClient) Recv() (*TransactionEvent, error) {
+	m := new(TransactionEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *btcdClient) SubscribeMempool(ctx context.Context, in *SubscribeMempoolRequest, opts ...grpc.CallOption) (Btcd_SubscribeMempoolClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Btcd_serviceDesc.Streams[2], "/btcdrpc.Btcd/SubscribeMempool", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &btcdSubscribeMempoolClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Btcd_SubscribeMempoolClient interface {
+	Recv() (*MempoolEvent, error)
+	grpc.ClientStream
+}
+
+type btcdSubscribeMempoolClient struct {
+	grpc.ClientStream
+}
+
+func (x *btcdSubscribeMempoolClient) Recv() (*MempoolEvent, error) {
+	m := new(MempoolEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BtcdServer is the server API for Btcd service.
+type BtcdServer interface {
+	// GetBestBlock returns the hash and height of the best block of the
+	// main chain.
+	GetBestBlock(context.Context, *GetBestBlockRequest) (*GetBestBlockResponse, error)
+	// GetBlock returns a block of the main chain by hash or height.
+	GetBlock(context.Context, *GetBlockRequest) (*GetBlockResponse, error)
+	// GetTransaction returns a transaction from the memory pool or, when
+	// the transaction index is enabled, from the main chain.
+	GetTransaction(context.Context, *GetTransactionRequest) (*GetTransactionResponse, error)
+	// SubmitTransaction adds a transaction to the memory pool and relays it
+	// to the network.
+	SubmitTransaction(context.Context, *SubmitTransactionRequest) (*SubmitTransactionResponse, error)
+	// SubscribeBlocks streams the blocks which are connected to and
+	// disconnected from the main chain.
+	SubscribeBlocks(*SubscribeBlocksRequest, Btcd_SubscribeBlocksServer) error
+	// SubscribeTransactions streams the transactions of the blocks which are
+	// connected to the main chain.
+	SubscribeTransactions(*SubscribeTransactionsRequest, Btcd_SubscribeTransactionsServer) error
+	// SubscribeMempool streams the transactions which are added to,
+	// removed from, and replaced in the memory pool.
+	SubscribeMempool(*SubscribeMempoolRequest, Btcd_SubscribeMempoolServer) error
+}
+
+// UnimplementedBtcdServer can be embedded to have forward compatible implementations.
+type UnimplementedBtcdServer struct {
+}
+
+func (*UnimplementedBtcdServer) GetBestBlock(ctx context.Context, req *GetBestBlockRequest) (*GetBestBlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBestBlock not implemented")
+}
+func (*UnimplementedBtcdServer) GetBlock(ctx context.Context, req *GetBlockRequest) (*GetBlockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlock not implemented")
+}
+func (*UnimplementedBtcdServer) GetTransaction(ctx context.Context, req *GetTransactionRequest) (*GetTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTransaction not implemented")
+}
+func (*UnimplementedBtcdServer) SubmitTransaction(ctx context.Context, req *SubmitTransactionRequest) (*SubmitTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitTransaction not implemented")
+}
+func (*UnimplementedBtcdServer) SubscribeBlocks(req *SubscribeBlocksRequest, srv Btcd_SubscribeBlocksServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeBlocks not implemented")
+}
+func (*UnimplementedBtcdServer) SubscribeTransactions(req *SubscribeTransactionsRequest, srv Btcd_SubscribeTransactionsServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeTransactions not implemented")
+}
+func (*UnimplementedBtcdServer) SubscribeMempool(req *SubscribeMempoolRequest, srv Btcd_SubscribeMempoolServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeMempool not implemented")
+}
+
+func RegisterBtcdServer(s *grpc.Server, srv BtcdServer) {
+	s.RegisterService(&_Btcd_serviceDesc, srv)
+}
+
+func _Btcd_GetBestBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBestBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BtcdServer).GetBestBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/btcdrpc.Btcd/GetBestBlock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BtcdServer).GetBestBlock(ctx, req.(*GetBestBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Btcd_GetBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BtcdServer).GetBlock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/btcdrpc.Btcd/GetBlock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BtcdServer).GetBlock(ctx, req.(*GetBlockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Btcd_GetTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BtcdServer).GetTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/btcdrpc.Btcd/GetTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BtcdServer).GetTransaction(ctx, req.(*GetTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Btcd_SubmitTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BtcdServer).SubmitTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/btcdrpc.Btcd/SubmitTransaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BtcdServer).SubmitTransaction(ctx, req.(*SubmitTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Btcd_SubscribeBlocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeBlocksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BtcdServer).SubscribeBlocks(m, &btcdSubscribeBlocksServer{stream})
+}
+
+type Btcd_SubscribeBlocksServer interface {
+	Send(*BlockEvent) error
+	grpc.ServerStream
+}
+
+type btcdSubscribeBlocksServer struct {
+	grpc.ServerStream
+}
+
+func (x *btcdSubscribeBlocksServer) Send(m *BlockEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Btcd_SubscribeTransactions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeTransactionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BtcdServer).SubscribeTransactions(m, &btcdSubscribeTransactionsServer{stream})
+}
+
+type Btcd_SubscribeTransactionsServer interface {
+	Send(*TransactionEvent) error
+	grpc.ServerStream
+}
+
+type btcdSubscribeTransactionsServer struct {
+	grpc.ServerStream
+}
+
+func (x *btcdSubscribeTransactionsServer) Send(m *TransactionEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Btcd_SubscribeMempool_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeMempoolRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BtcdServer).SubscribeMempool(m, &btcdSubscribeMempoolServer{stream})
+}
+
+type Btcd_SubscribeMempoolServer interface {
+	Send(*MempoolEvent) error
+	grpc.ServerStream
+}
+
+type btcdSubscribeMempoolServer struct {
+	grpc.ServerStream
+}
+
+func (x *btcdSubscribeMempoolServer) Send(m *MempoolEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Btcd_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "btcdrpc.Btcd",
+	HandlerType: (*BtcdServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetBestBlock",
+			Handler:    _Btcd_GetBestBlock_Handler,
+		},
+		{
+			MethodName: "GetBlock",
+			Handler:    _Btcd_GetBlock_Handler,
+		},
+		{
+			MethodName: "GetTransaction",
+			Handler:    _Btcd_GetTransaction_Handler,
+		},
+		{
+			MethodName: "SubmitTransaction",
+			Handler:    _Btcd_SubmitTransaction_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeBlocks",
+			Handler:       _Btcd_SubscribeBlocks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubscribeTransactions",
+			Handler:       _Btcd_SubscribeTransactions_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubscribeMempool",
+			Handler:       _Btcd_SubscribeMempool_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "btcd.proto",
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package btcdrpc provides the protobuf messages along with the client and server
+bindings of the gRPC interface of btcd.
+
+Overview
+
+The gRPC interface is an alternative to the websocket extensions of the
+JSON-RPC API for services which integrate with btcd.  It serves queries of the
+chain, submits transactions, and streams the blocks connected to and
+disconnected from the main chain, the transactions of the connected blocks, and
+the changes of the memory pool.  It is enabled by specifying the interfaces to
+serve it on with the grpclisten option and uses the TLS certificate and the
+credentials of the RPC server.
+
+The service is defined in btcd.proto, from which btcd.pb.go is generated with
+protoc and the protoc-gen-go plugin of github.com/golang/protobuf v1.3.2, so
+changes must be made to btcd.proto and the bindings regenerated with go
+generate.
+
+Authentication
+
+Every call must carry the RPC credentials in the authorization metadata in the
+same form as the HTTP Authorization header of the JSON-RPC API.  For example:
+
+	login := user + ":" + pass
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", auth)
+*/
+package btcdrpc
+
+//go:generate protoc -I. btcd.proto --go_out=plugins=grpc,paths=source_relative:.
@@ -0,0 +1,289 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcec
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// EllSwiftEncodingSize is the size of an ElligatorSwift encoded public key as
+// defined by BIP0324.  It consists of the two 32-byte big-endian field elements
+// u and t.
+const EllSwiftEncodingSize = 64
+
+var (
+	// fieldP is the prime of the secp256k1 field.
+	fieldP = S256().P
+
+	// fieldSqrtExp is (p+1)/4 which is used to compute square roots in the
+	// field since p = 3 mod 4.
+	fieldSqrtExp = new(big.Int).Rsh(new(big.Int).Add(fieldP, big.NewInt(1)), 2)
+
+	// minus3Sqrt is the square root of -3 in the field as used by the
+	// SwiftEC mapping.
+	minus3Sqrt = fieldSqrt(fieldMod(big.NewInt(-3)))
+
+	// curveB is the b coefficient of the secp256k1 curve equation
+	// y^2 = x^3 + b.
+	curveB = big.NewInt(7)
+)
+
+// fieldMod reduces the passed value modulo the field prime in place and
+// returns it.
+func fieldMod(a *big.Int) *big.Int {
+	return a.Mod(a, fieldP)
+}
+
+// fieldMul returns a*b mod p.
+func fieldMul(a, b *big.Int) *big.Int {
+	return fieldMod(new(big.Int).Mul(a, b))
+}
+
+// fieldAdd returns a+b mod p.
+func fieldAdd(a, b *big.Int) *big.Int {
+	return fieldMod(new(big.Int).Add(a, b))
+}
+
+// fieldSub returns a-b mod p.
+func fieldSub(a, b *big.Int) *big.Int {
+	return fieldMod(new(big.Int).Sub(a, b))
+}
+
+// fieldNeg returns -a mod p.
+func fieldNeg(a *big.Int) *big.Int {
+	return fieldMod(new(big.Int).Neg(a))
+}
+
+// fieldInv returns the multiplicative inverse of a mod p.  The caller must
+// ensure a is not zero.
+func fieldInv(a *big.Int) *big.Int {
+	return new(big.Int).ModInverse(a, fieldP)
+}
+
+// fieldDiv returns a/b mod p.  The caller must ensure b is not zero.
+func fieldDiv(a, b *big.Int) *big.Int {
+	return fieldMul(a, fieldInv(b))
+}
+
+// fieldSqrt returns a square root of a mod p or nil when a is not a quadratic
+// residue.
+func fieldSqrt(a *big.Int) *big.Int {
+	r := new(big.Int).Exp(a, fieldSqrtExp, fieldP)
+	if fieldMul(r, r).Cmp(fieldMod(new(big.Int).Set(a))) != 0 {
+		return nil
+	}
+	return r
+}
+
+// curveRHS returns x^3 + 7 mod p.
+func curveRHS(x *big.Int) *big.Int {
+	return fieldAdd(fieldMul(fieldMul(x, x), x), curveB)
+}
+
+// isValidX returns whether or not the passed value is the x coordinate of a
+// point on the secp256k1 curve.
+func isValidX(x *big.Int) bool {
+	return fieldSqrt(curveRHS(x)) != nil
+}
+
+// xswiftec decodes the field elements u and t into the x coordinate of a
+// point on the curve as defined by the SwiftEC mapping used in BIP0324.
+func xswiftec(u, t *big.Int) *big.Int {
+	u = fieldMod(new(big.Int).Set(u))
+	t = fieldMod(new(big.Int).Set(t))
+	if u.Sign() == 0 {
+		u.SetInt64(1)
+	}
+	if t.Sign() == 0 {
+		t.SetInt64(1)
+	}
+	if fieldAdd(curveRHS(u), fieldMul(t, t)).Sign() == 0 {
+		t = fieldAdd(t, t)
+	}
+
+	// X = (u^3 + 7 - t^2) / (2t)
+	// Y = (X + t) / (sqrt(-3) * u)
+	x := fieldDiv(fieldSub(curveRHS(u), fieldMul(t, t)), fieldAdd(t, t))
+	y := fieldDiv(fieldAdd(x, t), fieldMul(minus3Sqrt, u))
+
+	// Candidates are u + 4Y^2, (-X/Y - u)/2 and (X/Y - u)/2 and the first
+	// one which is a valid x coordinate is returned.
+	two := big.NewInt(2)
+	xOverY := fieldDiv(x, y)
+	candidates := []*big.Int{
+		fieldAdd(u, fieldMul(big.NewInt(4), fieldMul(y, y))),
+		fieldDiv(fieldSub(fieldNeg(xOverY), u), two),
+		fieldDiv(fieldSub(xOverY, u), two),
+	}
+	for _, candidate := range candidates {
+		if isValidX(candidate) {
+			return candidate
+		}
+	}
+
+	// This is impossible for a correct implementation of the mapping since
+	// at least one of the candidates is always on the curve.
+	panic("xswiftec: no valid candidate")
+}
+
+// xswiftecInvCandidates returns all values of t for which xswiftec(u, t)
+// decodes to the passed x coordinate.
+func xswiftecInvCandidates(x, u *big.Int) []*big.Int {
+	var tries []*big.Int
+
+	// Solutions decoding via the first candidate satisfy Y^2 = (x-u)/4 and
+	// t^2 - 2*sqrt(-3)*u*Y*t + u^3 + 7 = 0.
+	if w := fieldSqrt(fieldSub(x, u)); w != nil {
+		halfW := fieldDiv(w, big.NewInt(2))
+		for _, y := range []*big.Int{halfW, fieldNeg(halfW)} {
+			cuy := fieldMul(fieldMul(minus3Sqrt, u), y)
+			disc := fieldSub(fieldMul(cuy, cuy), curveRHS(u))
+			if r := fieldSqrt(disc); r != nil {
+				tries = append(tries, fieldAdd(cuy, r),
+					fieldSub(cuy, r))
+			}
+		}
+	}
+
+	// Solutions decoding via the second or third candidate satisfy
+	// X/Y = k with k = +-(2x + u), Y^2 = -(u^3 + 7) / (3u^2 + k^2) and
+	// t = (sqrt(-3)*u - k) * Y.
+	k := fieldAdd(fieldAdd(x, x), u)
+	for _, k := range []*big.Int{k, fieldNeg(k)} {
+		denom := fieldAdd(fieldMul(big.NewInt(3), fieldMul(u, u)),
+			fieldMul(k, k))
+		if denom.Sign() == 0 {
+			continue
+		}
+		ySq := fieldDiv(fieldNeg(curveRHS(u)), denom)
+		y := fieldSqrt(ySq)
+		if y == nil {
+			continue
+		}
+		cuk := fieldSub(fieldMul(minus3Sqrt, u), k)
+		tries = append(tries, fieldMul(cuk, y), fieldMul(cuk, fieldNeg(y)))
+	}
+
+	// Only keep the values which actually decode to x since the earlier
+	// candidates in the decoding take precedence.
+	candidates := tries[:0]
+	for _, t := range tries {
+		if t.Sign() != 0 && u.Sign() != 0 && xswiftec(u, t).Cmp(x) == 0 {
+			candidates = append(candidates, t)
+		}
+	}
+	return candidates
+}
+
+// randFieldElement reads a uniformly random non-zero field element from the
+// provided reader.
+func randFieldElement(randReader io.Reader) (*big.Int, error) {
+	var buf [32]byte
+	for {
+		if _, err := io.ReadFull(randReader, buf[:]); err != nil {
+			return nil, err
+		}
+		v := new(big.Int).SetBytes(buf[:])
+		if v.Sign() != 0 && v.Cmp(fieldP) < 0 {
+			return v, nil
+		}
+	}
+}
+
+// EllSwiftEncode returns a random ElligatorSwift encoding of the passed x
+// coordinate using randomness from the provided reader.
+func EllSwiftEncode(x *big.Int, randReader io.Reader) ([EllSwiftEncodingSize]byte, error) {
+	var enc [EllSwiftEncodingSize]byte
+	var choice [1]byte
+	for {
+		u, err := randFieldElement(randReader)
+		if err != nil {
+			return enc, err
+		}
+		candidates := xswiftecInvCandidates(x, u)
+		if len(candidates) == 0 {
+			continue
+		}
+		if _, err := io.ReadFull(randReader, choice[:]); err != nil {
+			return enc, err
+		}
+		t := candidates[int(choice[0])%len(candidates)]
+
+		u.FillBytes(enc[:32])
+		t.FillBytes(enc[32:])
+		return enc, nil
+	}
+}
+
+// EllSwiftDecode returns the x coordinate encoded by the passed ElligatorSwift
+// encoding.  Every encoding decodes to a point on the curve.
+func EllSwiftDecode(enc *[EllSwiftEncodingSize]byte) *big.Int {
+	u := new(big.Int).SetBytes(enc[:32])
+	t := new(big.Int).SetBytes(enc[32:])
+	return xswiftec(u, t)
+}
+
+// NewEllSwiftPrivateKey generates a new private key along with a random
+// ElligatorSwift encoding of its public key.
+func NewEllSwiftPrivateKey(randReader io.Reader) (*PrivateKey, [EllSwiftEncodingSize]byte, error) {
+	privKey, err := NewPrivateKey(S256())
+	if err != nil {
+		return nil, [EllSwiftEncodingSize]byte{}, err
+	}
+	enc, err := EllSwiftEncode(privKey.PubKey().X, randReader)
+	if err != nil {
+		return nil, [EllSwiftEncodingSize]byte{}, err
+	}
+	return privKey, enc, nil
+}
+
+// EllSwiftECDHXOnly returns the x coordinate of the point obtained by
+// multiplying the point encoded by theirs with the passed private key.
+func EllSwiftECDHXOnly(theirs *[EllSwiftEncodingSize]byte, privKey *PrivateKey) ([32]byte, error) {
+	var xOnly [32]byte
+	x := EllSwiftDecode(theirs)
+	y := fieldSqrt(curveRHS(x))
+	if y == nil {
+		return xOnly, errors.New("invalid ellswift encoding")
+	}
+	sx, _ := S256().ScalarMult(x, y, privKey.D.Bytes())
+	sx.FillBytes(xOnly[:])
+	return xOnly, nil
+}
+
+// EllSwiftXDH returns the shared secret of the key exchange between the parties
+// with the passed ElligatorSwift encodings as defined by BIP0324, which hashes
+// the x coordinate of the shared point along with both encodings.  The
+// initiating flag indicates the passed private key belongs to the party with
+// the encoding ellA, which is the initiator of the connection.
+func EllSwiftXDH(ellA, ellB *[EllSwiftEncodingSize]byte, privKey *PrivateKey, initiating bool) ([32]byte, error) {
+	theirs := ellA
+	if initiating {
+		theirs = ellB
+	}
+	ecdh, err := EllSwiftECDHXOnly(theirs, privKey)
+	if err != nil {
+		return ecdh, err
+	}
+	return taggedHash("bip324_ellswift_xonly_ecdh", ellA[:], ellB[:],
+		ecdh[:]), nil
+}
+
+// taggedHash returns the BIP0340 style tagged hash of msg using tag.
+func taggedHash(tag string, msg ...[]byte) [32]byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, m := range msg {
+		h.Write(m)
+	}
+	var out [32]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcec
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+// TestEllswift ensures ElligatorSwift encodings decode to the encoded key and
+// that both sides of the key exchange derive the same secret.
+func TestEllswift(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		privKey, err := NewPrivateKey(S256())
+		if err != nil {
+			t.Fatalf("unable to create private key: %v", err)
+		}
+		enc, err := EllSwiftEncode(privKey.PubKey().X, rand.Reader)
+		if err != nil {
+			t.Fatalf("unable to encode: %v", err)
+		}
+		if x := EllSwiftDecode(&enc); x.Cmp(privKey.PubKey().X) != 0 {
+			t.Fatalf("decoded x mismatch - got %x, want %x", x,
+				privKey.PubKey().X)
+		}
+	}
+
+	// Arbitrary encodings, including out of range and zero field
+	// elements, must decode to a point on the curve.
+	encodings := [][EllSwiftEncodingSize]byte{{}, {}}
+	for i := range encodings[1] {
+		encodings[1][i] = 0xff
+	}
+	for i := 0; i < 10; i++ {
+		var enc [EllSwiftEncodingSize]byte
+		rand.Read(enc[:])
+		encodings = append(encodings, enc)
+	}
+	for _, enc := range encodings {
+		if x := EllSwiftDecode(&enc); !isValidX(x) {
+			t.Fatalf("encoding %x decoded to invalid x %x", enc, x)
+		}
+	}
+
+	privA, ellA, err := NewEllSwiftPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to create key: %v", err)
+	}
+	privB, ellB, err := NewEllSwiftPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to create key: %v", err)
+	}
+	secretA, err := EllSwiftECDHXOnly(&ellB, privA)
+	if err != nil {
+		t.Fatalf("unexpected ECDH error: %v", err)
+	}
+	secretB, err := EllSwiftECDHXOnly(&ellA, privB)
+	if err != nil {
+		t.Fatalf("unexpected ECDH error: %v", err)
+	}
+	if secretA != secretB {
+		t.Fatalf("ECDH mismatch - got %x and %x", secretA, secretB)
+	}
+
+	// Both parties derive the same hashed secret, which differs from the
+	// x coordinate of the shared point.
+	xdhA, err := EllSwiftXDH(&ellA, &ellB, privA, true)
+	if err != nil {
+		t.Fatalf("unexpected XDH error: %v", err)
+	}
+	xdhB, err := EllSwiftXDH(&ellA, &ellB, privB, false)
+	if err != nil {
+		t.Fatalf("unexpected XDH error: %v", err)
+	}
+	if xdhA != xdhB || xdhA == secretA {
+		t.Fatalf("XDH mismatch - got %x and %x", xdhA, xdhB)
+	}
+}
@@ -62,6 +62,15 @@ func (p *PrivateKey) Sign(hash []byte) (*Signature, error) {
 	return signRFC6979(p, hash)
 }
 
+// SignWithOptions generates an ECDSA signature for the provided hash the same
+// way as Sign while applying the passed options, which allow mixing extra
+// entropy into the nonce, grinding for a low R value, and producing signatures
+// without the BIP0062 normalization for comparison with test vectors.  See
+// SignOptions for details.
+func (p *PrivateKey) SignWithOptions(hash []byte, opts *SignOptions) (*Signature, error) {
+	return signRFC6979WithOptions(p, hash, opts)
+}
+
 // PrivKeyBytesLen defines the length in bytes of a serialized private key.
 const PrivKeyBytesLen = 32
 
@@ -0,0 +1,115 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcec
+
+import (
+	"errors"
+	"math/big"
+)
+
+// SchnorrSignatureSize is the size of a BIP0340 Schnorr signature.  It consists
+// of the x coordinate of the nonce point and the 32-byte big-endian scalar s.
+const SchnorrSignatureSize = 64
+
+// SignSchnorr returns the BIP0340 Schnorr signature of the passed message with
+// the passed private key.  Messages of any size are supported, although they
+// are usually 32-byte hashes.  The passed 32 bytes of auxiliary
+// randomness are mixed into the nonce.  The signature is verified against the
+// x-only public key of the private key, which is its x coordinate.
+func SignSchnorr(privKey *PrivateKey, msg, auxRand []byte) ([SchnorrSignatureSize]byte, error) {
+	var sig [SchnorrSignatureSize]byte
+	curve := S256()
+	if privKey.D.Sign() == 0 || privKey.D.Cmp(curve.N) >= 0 {
+		return sig, errors.New("private key is out of range")
+	}
+	if len(auxRand) != 32 {
+		return sig, errors.New("auxiliary randomness must be 32 bytes")
+	}
+
+	// Negate the private key when its public key has an odd y coordinate,
+	// since the x-only public key implies the even one.
+	var dBytes, pxBytes, rxBytes [32]byte
+	px, py := curve.ScalarBaseMult(privKey.D.Bytes())
+	d := new(big.Int).Set(privKey.D)
+	if py.Bit(0) == 1 {
+		d.Sub(curve.N, d)
+	}
+	d.FillBytes(dBytes[:])
+	px.FillBytes(pxBytes[:])
+
+	// Derive the nonce from the private key masked by the auxiliary
+	// randomness, the public key and the message.
+	aux := taggedHash("BIP0340/aux", auxRand)
+	for i := range dBytes {
+		dBytes[i] ^= aux[i]
+	}
+	nonce := taggedHash("BIP0340/nonce", dBytes[:], pxBytes[:], msg)
+	k := new(big.Int).SetBytes(nonce[:])
+	k.Mod(k, curve.N)
+	if k.Sign() == 0 {
+		return sig, errors.New("nonce is zero")
+	}
+	rx, ry := curve.ScalarBaseMult(k.Bytes())
+	if ry.Bit(0) == 1 {
+		k.Sub(curve.N, k)
+	}
+	rx.FillBytes(rxBytes[:])
+
+	// s = k + e*d mod n
+	e := schnorrChallenge(rxBytes[:], pxBytes[:], msg)
+	s := e.Mul(e, d)
+	s.Add(s, k)
+	s.Mod(s, curve.N)
+
+	copy(sig[:32], rxBytes[:])
+	s.FillBytes(sig[32:])
+	return sig, nil
+}
+
+// VerifySchnorr returns whether the passed BIP0340 Schnorr signature of the
+// passed message is valid for the passed 32-byte x-only public key.
+func VerifySchnorr(pubKey, msg, sig []byte) bool {
+	curve := S256()
+	if len(pubKey) != 32 || len(sig) != SchnorrSignatureSize {
+		return false
+	}
+
+	// Lift the x-only public key to the point with the even y coordinate.
+	px := new(big.Int).SetBytes(pubKey)
+	if px.Cmp(fieldP) >= 0 {
+		return false
+	}
+	py := fieldSqrt(curveRHS(px))
+	if py == nil {
+		return false
+	}
+	if py.Bit(0) == 1 {
+		py = fieldNeg(py)
+	}
+
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if r.Cmp(fieldP) >= 0 || s.Cmp(curve.N) >= 0 {
+		return false
+	}
+
+	// R = s*G - e*P must have an even y coordinate and the x coordinate r.
+	e := schnorrChallenge(sig[:32], pubKey, msg)
+	ex, ey := curve.ScalarMult(px, py, e.Bytes())
+	sx, sy := curve.ScalarBaseMult(s.Bytes())
+	rx, ry := curve.Add(sx, sy, ex, fieldNeg(ey))
+	if rx.Sign() == 0 && ry.Sign() == 0 {
+		return false
+	}
+	return ry.Bit(0) == 0 && rx.Cmp(r) == 0
+}
+
+// schnorrChallenge returns the BIP0340 challenge for the passed x coordinate of
+// the nonce point, x-only public key and message.
+func schnorrChallenge(rx, pubKey, msg []byte) *big.Int {
+	hash := taggedHash("BIP0340/challenge", rx, pubKey, msg)
+	e := new(big.Int).SetBytes(hash[:])
+	return e.Mod(e, S256().N)
+}
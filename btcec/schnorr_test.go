@@ -0,0 +1,139 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package btcec
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSchnorr ensures Schnorr signatures match the BIP0340 test vectors and
+// that tampered signatures are rejected.
+func TestSchnorr(t *testing.T) {
+	tests := []struct {
+		privKey string
+		pubKey  string
+		auxRand string
+		msg     string
+		sig     string
+	}{
+		{
+			privKey: "0000000000000000000000000000000000000000000000000000000000000003",
+			pubKey:  "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9",
+			auxRand: "0000000000000000000000000000000000000000000000000000000000000000",
+			msg:     "0000000000000000000000000000000000000000000000000000000000000000",
+			sig: "e907831f80848d1069a5371b402410364bdf1c5f8307b0084c55f1ce2dca8215" +
+				"25f66a4a85ea8b71e482a74f382d2ce5ebeee8fdb2172f477df4900d310536c0",
+		},
+		{
+			privKey: "b7e151628aed2a6abf7158809cf4f3c762e7160f38b4da56a784d9045190cfef",
+			pubKey:  "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659",
+			auxRand: "0000000000000000000000000000000000000000000000000000000000000001",
+			msg:     "243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89",
+			sig: "6896bd60eeae296db48a229ff71dfe071bde413e6d43f917dc8dcf8c78de3341" +
+				"8906d11ac976abccb20b091292bff4ea897efcb639ea871cfa95f6de339e4b0a",
+		},
+	}
+
+	decode := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatalf("unable to decode %s: %v", s, err)
+		}
+		return b
+	}
+	for i, test := range tests {
+		privKey, _ := PrivKeyFromBytes(S256(), decode(test.privKey))
+		pubKey, msg := decode(test.pubKey), decode(test.msg)
+		sig, err := SignSchnorr(privKey, msg, decode(test.auxRand))
+		if err != nil {
+			t.Fatalf("#%d: unexpected error: %v", i, err)
+		}
+		if !bytes.Equal(sig[:], decode(test.sig)) {
+			t.Fatalf("#%d: got signature %x, want %s", i, sig, test.sig)
+		}
+		if !VerifySchnorr(pubKey, msg, sig[:]) {
+			t.Fatalf("#%d: valid signature rejected", i)
+		}
+
+		// Signatures for other messages or keys are rejected.
+		otherMsg := append([]byte(nil), msg...)
+		otherMsg[0] ^= 0x01
+		if VerifySchnorr(pubKey, otherMsg, sig[:]) {
+			t.Fatalf("#%d: signature for other message accepted", i)
+		}
+		otherKey := tests[(i+1)%len(tests)].pubKey
+		if VerifySchnorr(decode(otherKey), msg, sig[:]) {
+			t.Fatalf("#%d: signature for other key accepted", i)
+		}
+		sig[63] ^= 0x01
+		if VerifySchnorr(pubKey, msg, sig[:]) {
+			t.Fatalf("#%d: tampered signature accepted", i)
+		}
+	}
+
+	// Private keys out of range are rejected.
+	outOfRange := &PrivateKey{D: new(big.Int).Set(S256().N)}
+	if _, err := SignSchnorr(outOfRange, make([]byte, 32), make([]byte, 32)); err == nil {
+		t.Fatal("out of range private key accepted")
+	}
+}
+
+// TestSchnorrVectors ensures signing and verification produce the expected
+// results for the test vectors published with BIP0340, which include public
+// keys not on the curve, signatures with r not below the field size or s not
+// below the group order, nonce points with odd y coordinates or at infinity,
+// and messages of other sizes than 32 bytes.
+func TestSchnorrVectors(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "bip0340_test_vectors.csv"))
+	if err != nil {
+		t.Fatalf("unable to open test vectors: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("unable to read test vectors: %v", err)
+	}
+	if len(records) < 2 {
+		t.Fatal("no test vectors")
+	}
+
+	decode := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatalf("unable to decode %s: %v", s, err)
+		}
+		return b
+	}
+	for _, record := range records[1:] {
+		index, secKey, pubKey, auxRand := record[0], record[1],
+			decode(record[2]), record[3]
+		msg, sig, valid, comment := decode(record[4]), decode(record[5]),
+			record[6] == "TRUE", record[7]
+
+		// Only the vectors with a secret key are signing vectors.
+		if secKey != "" {
+			privKey, _ := PrivKeyFromBytes(S256(), decode(secKey))
+			gotSig, err := SignSchnorr(privKey, msg, decode(auxRand))
+			if err != nil {
+				t.Fatalf("#%s: unexpected error: %v", index, err)
+			}
+			if !bytes.Equal(gotSig[:], sig) {
+				t.Fatalf("#%s: got signature %x, want %x", index,
+					gotSig, sig)
+			}
+		}
+
+		if got := VerifySchnorr(pubKey, msg, sig); got != valid {
+			t.Fatalf("#%s (%s): got verification result %v, want %v",
+				index, comment, got, valid)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"hash"
@@ -418,13 +419,86 @@ func RecoverCompact(curve *KoblitzCurve, signature,
 	return key, ((signature[0] - 27) & 4) == 4, nil
 }
 
-// signRFC6979 generates a deterministic ECDSA signature according to RFC 6979 and BIP 62.
+// ExtraEntropyLen is the length in bytes of the extra entropy which may be
+// mixed into the generation of the RFC6979 nonce.
+const ExtraEntropyLen = 32
+
+// SignOptions houses the optional parameters of signing with
+// PrivateKey.SignWithOptions.  The zero value produces the same signatures as
+// PrivateKey.Sign.
+type SignOptions struct {
+	// ExtraEntropy is additional data which is mixed into the generation
+	// of the nonce as described in section 3.6 of RFC6979.  It must either
+	// be empty or ExtraEntropyLen bytes, in which case the nonce matches
+	// the one libsecp256k1 generates when it is passed as the extra data
+	// of its default nonce function.
+	ExtraEntropy []byte
+
+	// GrindLowR repeats the signing with an incrementing counter as extra
+	// entropy until the R value of the signature is below 2^255, which
+	// makes its DER encoding at most 71 bytes.  The counter is encoded the
+	// same way Bitcoin Core encodes it, so the signatures are identical to
+	// the ones it produces.  It may not be combined with ExtraEntropy.
+	GrindLowR bool
+
+	// TestVectorMode disables the BIP0062 normalization of the S value of
+	// the signature to the lower half of the group order, so the signature
+	// is exactly the one specified by section 2.4 of RFC6979.  This is how
+	// most published RFC6979 test vectors were generated.  Such signatures
+	// are not standard on the bitcoin network and, since Serialize always
+	// normalizes the S value, they must be compared by their R and S values.
+	TestVectorMode bool
+}
+
+// signRFC6979 generates a deterministic ECDSA signature according to RFC 6979
+// and BIP 62 with the default options.
 func signRFC6979(privateKey *PrivateKey, hash []byte) (*Signature, error) {
+	return signRFC6979WithOptions(privateKey, hash, &SignOptions{})
+}
+
+// signRFC6979WithOptions generates a deterministic ECDSA signature according to
+// RFC 6979 and, unless disabled by the passed options, BIP 62 while mixing the
+// extra entropy of the passed options into the nonce.  When low R grinding is
+// requested, the signing is repeated with an incrementing counter as extra
+// entropy until the R value of the signature is low.
+func signRFC6979WithOptions(privateKey *PrivateKey, hash []byte, opts *SignOptions) (*Signature, error) {
+	if len(opts.ExtraEntropy) != 0 && len(opts.ExtraEntropy) != ExtraEntropyLen {
+		return nil, fmt.Errorf("extra entropy must be %d bytes instead "+
+			"of %d", ExtraEntropyLen, len(opts.ExtraEntropy))
+	}
+	if opts.GrindLowR && len(opts.ExtraEntropy) != 0 {
+		return nil, errors.New("low R grinding may not be combined " +
+			"with extra entropy")
+	}
+
+	sig, err := signRFC6979Nonce(privateKey, hash, opts.ExtraEntropy,
+		!opts.TestVectorMode)
+	if err != nil || !opts.GrindLowR {
+		return sig, err
+	}
+
+	// The counter is encoded as a little-endian uint32 in the first bytes
+	// of the extra entropy the same way Bitcoin Core does.
+	var extra [ExtraEntropyLen]byte
+	for counter := uint32(1); sig.R.BitLen() > 255; counter++ {
+		binary.LittleEndian.PutUint32(extra[:], counter)
+		sig, err = signRFC6979Nonce(privateKey, hash, extra[:],
+			!opts.TestVectorMode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sig, nil
+}
 
+// signRFC6979Nonce generates an ECDSA signature using the RFC 6979 nonce derived
+// with the passed extra entropy, which may be nil.  The S value is normalized
+// to the lower half of the group order when lowS is set as required by BIP 62.
+func signRFC6979Nonce(privateKey *PrivateKey, hash, extra []byte, lowS bool) (*Signature, error) {
 	privkey := privateKey.ToECDSA()
 	N := S256().N
 	halfOrder := S256().halfOrder
-	k := nonceRFC6979(privkey.D, hash)
+	k := nonceRFC6979(privkey.D, hash, extra)
 	inv := new(big.Int).ModInverse(k, N)
 	r, _ := privkey.Curve.ScalarBaseMult(k.Bytes())
 	r.Mod(r, N)
@@ -439,7 +513,7 @@ func signRFC6979(privateKey *PrivateKey, hash []byte) (*Signature, error) {
 	s.Mul(s, inv)
 	s.Mod(s, N)
 
-	if s.Cmp(halfOrder) == 1 {
+	if lowS && s.Cmp(halfOrder) == 1 {
 		s.Sub(N, s)
 	}
 	if s.Sign() == 0 {
@@ -450,7 +524,9 @@ func signRFC6979(privateKey *PrivateKey, hash []byte) (*Signature, error) {
 
 // nonceRFC6979 generates an ECDSA nonce (`k`) deterministically according to RFC 6979.
 // It takes a 32-byte hash as an input and returns 32-byte nonce to be used in ECDSA algorithm.
-func nonceRFC6979(privkey *big.Int, hash []byte) *big.Int {
+// The optional extra entropy is appended to the input of the HMAC_DRBG as
+// described in section 3.6 of RFC 6979.
+func nonceRFC6979(privkey *big.Int, hash []byte, extra []byte) *big.Int {
 
 	curve := S256()
 	q := curve.Params().N
@@ -461,6 +537,7 @@ func nonceRFC6979(privkey *big.Int, hash []byte) *big.Int {
 	holen := alg().Size()
 	rolen := (qlen + 7) >> 3
 	bx := append(int2octets(x, rolen), bits2octets(hash, curve, rolen)...)
+	bx = append(bx, extra...)
 
 	// Step B
 	v := bytes.Repeat(oneInitializer, holen)
@@ -646,7 +646,7 @@ func TestRFC6979(t *testing.T) {
 		hash := sha256.Sum256([]byte(test.msg))
 
 		// Ensure deterministically generated nonce is the expected value.
-		gotNonce := nonceRFC6979(privKey.D, hash[:]).Bytes()
+		gotNonce := nonceRFC6979(privKey.D, hash[:], nil).Bytes()
 		wantNonce := decodeHex(test.nonce)
 		if !bytes.Equal(gotNonce, wantNonce) {
 			t.Errorf("NonceRFC6979 #%d (%s): Nonce is incorrect: "+
@@ -673,6 +673,127 @@ func TestRFC6979(t *testing.T) {
 	}
 }
 
+// TestSignWithOptions ensures signing with extra entropy, low R grinding, and
+// in test vector mode produces the expected nonces and signatures.
+func TestSignWithOptions(t *testing.T) {
+	extra := bytes.Repeat([]byte{0x01}, ExtraEntropyLen)
+	tests := []struct {
+		key        string
+		msg        string
+		extraNonce string // nonce with extra entropy of all 0x01 bytes
+		extraSig   string // signature with extra entropy of all 0x01 bytes
+		lowRSig    string // signature with low R grinding
+		rawS       string // S value in test vector mode
+	}{
+		{
+			"cca9fbcc1b41e5a95d369eaa6ddcff73b61a4efaa279cfc6567e8daa39cbaf50",
+			"sample",
+			"aabcf8252aeecc046500b247f2820682030f2178f6c13cb5ac4fad7cbdda869c",
+			"304402204780addf0b743d592c44178b2b453194dd55586dd638f00c6311642ea9612e2302203a3f15553b6b38df80c91ff67d4cec582a329183c47cd233b4f2fc939491f96a",
+			"3044022049a2d9262114951d5101ac3a3cd755504e7a606363b317eec856c3277bc4ef3f02202e408c4c944ae57783b3fcf7b23089831c58334b04c7d0edfba63108d8ca8271",
+			"5009fb27f37034a9b24b707b7c6b79ca23ddef9e25f7282e8a797efe53a8f124",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000001",
+			"Satoshi Nakamoto",
+			"ff49282725ee554d481ee92230ebf201d5137cdc427fcda67210387e20a1b90b",
+			"3045022100bb6cf569458d507451271380d2863dad30355387836d5c3287a4efbd5ed1ad8e02204bb4b7899e803f760fe89027e55f5d93768983d6e28af4b5722f6226b345380e",
+			"304402203311d51d1326e30774b2fb1fbfd5e199ebccb43be1db2ce41051eb2d75e4b68f022044d2ea67486df31a242363de1f835d583620fea148ee422c8c80b904b53f5ac3",
+			"dbbd3162d46e9f9bef7feb87c16dc13b4f6568a87f4e83f728e2443ba586675c",
+		},
+		{
+			"fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364140",
+			"Satoshi Nakamoto",
+			"d41ccbeeeb8e01d92825d1941fa6f1cb9fa5f71dbdbce96b0cb6182a950694ec",
+			"304402204982b3c9549e2ba549393c9589364968e4232f1e6b663e2a0760d20f615abec70220549ed99901f056cbb609428ddad11078bcdc1e2024b49df2ca6097605ce3d1b8",
+			"304402203ff13e76253fc99e1485b3d9ffaf2cc02400bb42bdebbd89233bcf5db5ec3d32022008daff56621febad24d5c974dbcd578ea21423d0089cb5220c6aa3f87d21aecd",
+			"94c632f14e4379fc1ea610a3df5a375152549736425ee17cebe10abbc2a2826c",
+		},
+		{
+			// The R value of the signature is already low, so no
+			// grinding is needed.
+			"f8b8af8ce3c7cca5e300d33939540c10d45ce001b8f252bfbc57ba0342904181",
+			"Alan Turing",
+			"a937b2e8cd12f72efd60a4ed1a49425ad35bd12be031d5812cdbdd0696d63e87",
+			"304402207cb89057f30275e756aa0bef5182fd7693a7a1d96a9af2f2ee38bd1053713ee2022022db11d4a672da684578aafdec95c3e265281035a7c4bf1c863ae75e14ad3f1e",
+			"304402207063ae83e7f62bbb171798131b4a0564b956930092b33b07b395615d9ec7e15c022058dfcc1e00a35e1572f366ffe34ba0fc47db1e7189759b9fb233c5b05ab388ea",
+			"a72033e1ff5ca1ea8d0c99001cb45f0272d3be7525d3049c0d9e98dc7582b857",
+		},
+	}
+
+	for i, test := range tests {
+		privKey, pubKey := PrivKeyFromBytes(S256(), decodeHex(test.key))
+		hash := sha256.Sum256([]byte(test.msg))
+
+		gotNonce := nonceRFC6979(privKey.D, hash[:], extra).Bytes()
+		if want := decodeHex(test.extraNonce); !bytes.Equal(gotNonce, want) {
+			t.Errorf("nonceRFC6979 #%d (%s): nonce with extra "+
+				"entropy is %x (expected %x)", i, test.msg,
+				gotNonce, want)
+			continue
+		}
+
+		sigTests := []struct {
+			name string
+			opts SignOptions
+			want string
+		}{
+			{"extra entropy", SignOptions{ExtraEntropy: extra}, test.extraSig},
+			{"low R", SignOptions{GrindLowR: true}, test.lowRSig},
+		}
+		for _, sigTest := range sigTests {
+			sig, err := privKey.SignWithOptions(hash[:], &sigTest.opts)
+			if err != nil {
+				t.Errorf("SignWithOptions #%d (%s, %s): unexpected "+
+					"error: %v", i, test.msg, sigTest.name, err)
+				continue
+			}
+			got := sig.Serialize()
+			if want := decodeHex(sigTest.want); !bytes.Equal(got, want) {
+				t.Errorf("SignWithOptions #%d (%s, %s): mismatched "+
+					"signature: %x (expected %x)", i, test.msg,
+					sigTest.name, got, want)
+				continue
+			}
+			if !sig.Verify(hash[:], pubKey) {
+				t.Errorf("SignWithOptions #%d (%s, %s): signature "+
+					"does not verify", i, test.msg, sigTest.name)
+			}
+			if sigTest.opts.GrindLowR && len(got) > 70 {
+				t.Errorf("SignWithOptions #%d (%s, %s): signature "+
+					"is %d bytes", i, test.msg, sigTest.name,
+					len(got))
+			}
+		}
+
+		// The S value is not normalized in test vector mode.
+		sig, err := privKey.SignWithOptions(hash[:],
+			&SignOptions{TestVectorMode: true})
+		if err != nil {
+			t.Errorf("SignWithOptions #%d (%s, test vector mode): "+
+				"unexpected error: %v", i, test.msg, err)
+			continue
+		}
+		if want := fromHex(test.rawS); sig.S.Cmp(want) != 0 {
+			t.Errorf("SignWithOptions #%d (%s, test vector mode): "+
+				"S is %x (expected %x)", i, test.msg, sig.S, want)
+		}
+	}
+
+	// Invalid options are rejected.
+	privKey, _ := PrivKeyFromBytes(S256(), decodeHex(tests[0].key))
+	hash := sha256.Sum256([]byte(tests[0].msg))
+	invalid := []SignOptions{
+		{ExtraEntropy: extra[:16]},
+		{ExtraEntropy: extra, GrindLowR: true},
+	}
+	for i, opts := range invalid {
+		if _, err := privKey.SignWithOptions(hash[:], &opts); err == nil {
+			t.Errorf("SignWithOptions #%d: invalid options accepted", i)
+		}
+	}
+}
+
 func TestSignatureIsEqual(t *testing.T) {
 	sig1 := &Signature{
 		R: fromHex("0082235e21a2300022738dabb8e1bbd9d19cfb1e7ab8c30a23b0afbb8d178abcf3"),
@@ -44,6 +44,39 @@ func NewNodeCmd(subCmd NodeSubCmd, target string, connectSubCmd *string) *NodeCm
 	}
 }
 
+// AddCheckpointCmd defines the addcheckpoint JSON-RPC command.
+type AddCheckpointCmd struct {
+	Height  int32
+	Hash    string
+	Persist *bool `jsonrpcdefault:"false"`
+}
+
+// NewAddCheckpointCmd returns a new instance which can be used to issue an
+// addcheckpoint JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewAddCheckpointCmd(height int32, hash string, persist *bool) *AddCheckpointCmd {
+	return &AddCheckpointCmd{
+		Height:  height,
+		Hash:    hash,
+		Persist: persist,
+	}
+}
+
+// BackupDatabaseCmd defines the backupdatabase JSON-RPC command.
+type BackupDatabaseCmd struct {
+	Path string
+}
+
+// NewBackupDatabaseCmd returns a new instance which can be used to issue a
+// backupdatabase JSON-RPC command.
+func NewBackupDatabaseCmd(path string) *BackupDatabaseCmd {
+	return &BackupDatabaseCmd{
+		Path: path,
+	}
+}
+
 // DebugLevelCmd defines the debuglevel JSON-RPC command.  This command is not a
 // standard Bitcoin command.  It is an extension for btcd.
 type DebugLevelCmd struct {
@@ -59,6 +92,19 @@ func NewDebugLevelCmd(levelSpec string) *DebugLevelCmd {
 	}
 }
 
+// DumpTxOutSetCmd defines the dumptxoutset JSON-RPC command.
+type DumpTxOutSetCmd struct {
+	Path string
+}
+
+// NewDumpTxOutSetCmd returns a new instance which can be used to issue a
+// dumptxoutset JSON-RPC command.
+func NewDumpTxOutSetCmd(path string) *DumpTxOutSetCmd {
+	return &DumpTxOutSetCmd{
+		Path: path,
+	}
+}
+
 // GenerateCmd defines the generate JSON-RPC command.
 type GenerateCmd struct {
 	NumBlocks uint32
@@ -81,6 +127,15 @@ func NewGetBestBlockCmd() *GetBestBlockCmd {
 	return &GetBestBlockCmd{}
 }
 
+// GetCheckpointsCmd defines the getcheckpoints JSON-RPC command.
+type GetCheckpointsCmd struct{}
+
+// NewGetCheckpointsCmd returns a new instance which can be used to issue a
+// getcheckpoints JSON-RPC command.
+func NewGetCheckpointsCmd() *GetCheckpointsCmd {
+	return &GetCheckpointsCmd{}
+}
+
 // GetCurrentNetCmd defines the getcurrentnet JSON-RPC command.
 type GetCurrentNetCmd struct{}
 
@@ -90,6 +145,16 @@ func NewGetCurrentNetCmd() *GetCurrentNetCmd {
 	return &GetCurrentNetCmd{}
 }
 
+// GetDatabaseStatsCmd defines the getdatabasestats JSON-RPC command.  This
+// command is not a standard Bitcoin command.  It is an extension for btcd.
+type GetDatabaseStatsCmd struct{}
+
+// NewGetDatabaseStatsCmd returns a new instance which can be used to issue a
+// getdatabasestats JSON-RPC command.
+func NewGetDatabaseStatsCmd() *GetDatabaseStatsCmd {
+	return &GetDatabaseStatsCmd{}
+}
+
 // GetHeadersCmd defines the getheaders JSON-RPC command.
 //
 // NOTE: This is a btcsuite extension ported from
@@ -111,6 +176,354 @@ func NewGetHeadersCmd(blockLocators []string, hashStop string) *GetHeadersCmd {
 	}
 }
 
+// GetMempoolClusterCmd defines the getmempoolcluster JSON-RPC command.
+type GetMempoolClusterCmd struct {
+	TxID string
+}
+
+// NewGetMempoolClusterCmd returns a new instance which can be used to issue a
+// getmempoolcluster JSON-RPC command.
+func NewGetMempoolClusterCmd(txID string) *GetMempoolClusterCmd {
+	return &GetMempoolClusterCmd{
+		TxID: txID,
+	}
+}
+
+// GetMempoolDiagramCmd defines the getmempooldiagram JSON-RPC
+// command.
+type GetMempoolDiagramCmd struct{}
+
+// NewGetMempoolDiagramCmd returns a new instance which can be used to
+// issue a getmempooldiagram JSON-RPC command.
+func NewGetMempoolDiagramCmd() *GetMempoolDiagramCmd {
+	return &GetMempoolDiagramCmd{}
+}
+
+// GetMempoolPackageCmd defines the getmempoolpackage JSON-RPC command.
+type GetMempoolPackageCmd struct {
+	TxID string
+}
+
+// NewGetMempoolPackageCmd returns a new instance which can be used to issue a
+// getmempoolpackage JSON-RPC command.
+func NewGetMempoolPackageCmd(txID string) *GetMempoolPackageCmd {
+	return &GetMempoolPackageCmd{
+		TxID: txID,
+	}
+}
+
+// GetOrphanBlockInfoCmd defines the getorphanblockinfo JSON-RPC command.  This
+// command is not a standard Bitcoin command.  It is an extension for btcd.
+type GetOrphanBlockInfoCmd struct{}
+
+// NewGetOrphanBlockInfoCmd returns a new instance which can be used to issue a
+// getorphanblockinfo JSON-RPC command.
+func NewGetOrphanBlockInfoCmd() *GetOrphanBlockInfoCmd {
+	return &GetOrphanBlockInfoCmd{}
+}
+
+// GetRPCRolesCmd defines the getrpcroles JSON-RPC command.  This command is not
+// a standard Bitcoin command.  It is an extension for btcd.
+type GetRPCRolesCmd struct{}
+
+// NewGetRPCRolesCmd returns a new instance which can be used to issue a
+// getrpcroles JSON-RPC command.
+func NewGetRPCRolesCmd() *GetRPCRolesCmd {
+	return &GetRPCRolesCmd{}
+}
+
+// GetScriptValidationInfoCmd defines the getscriptvalidationinfo JSON-RPC
+// command.  This command is not a standard Bitcoin command.  It is an extension
+// for btcd.
+type GetScriptValidationInfoCmd struct{}
+
+// NewGetScriptValidationInfoCmd returns a new instance which can be used to
+// issue a getscriptvalidationinfo JSON-RPC command.
+func NewGetScriptValidationInfoCmd() *GetScriptValidationInfoCmd {
+	return &GetScriptValidationInfoCmd{}
+}
+
+// GetStandbyInfoCmd defines the getstandbyinfo JSON-RPC command.  This command
+// is not a standard Bitcoin command.  It is an extension for btcd.
+type GetStandbyInfoCmd struct{}
+
+// NewGetStandbyInfoCmd returns a new instance which can be used to issue a
+// getstandbyinfo JSON-RPC command.
+func NewGetStandbyInfoCmd() *GetStandbyInfoCmd {
+	return &GetStandbyInfoCmd{}
+}
+
+// GetSyncProgressCmd defines the getsyncprogress JSON-RPC command.  This command
+// is not a standard Bitcoin command.  It is an extension for btcd.
+type GetSyncProgressCmd struct{}
+
+// NewGetSyncProgressCmd returns a new instance which can be used to issue a
+// getsyncprogress JSON-RPC command.
+func NewGetSyncProgressCmd() *GetSyncProgressCmd {
+	return &GetSyncProgressCmd{}
+}
+
+// GetTimeInfoCmd defines the gettimeinfo JSON-RPC command.  This command is
+// not a standard Bitcoin command.  It is an extension for btcd.
+type GetTimeInfoCmd struct{}
+
+// NewGetTimeInfoCmd returns a new instance which can be used to issue a
+// gettimeinfo JSON-RPC command.
+func NewGetTimeInfoCmd() *GetTimeInfoCmd {
+	return &GetTimeInfoCmd{}
+}
+
+// GetWitnessUpgradeInfoCmd defines the getwitnessupgradeinfo JSON-RPC command.
+// This command is not a standard Bitcoin command.  It is an extension for
+// btcd.
+type GetWitnessUpgradeInfoCmd struct{}
+
+// NewGetWitnessUpgradeInfoCmd returns a new instance which can be used to issue
+// a getwitnessupgradeinfo JSON-RPC command.
+func NewGetWitnessUpgradeInfoCmd() *GetWitnessUpgradeInfoCmd {
+	return &GetWitnessUpgradeInfoCmd{}
+}
+
+// GetXpubAccountBalanceCmd defines the getxpubaccountbalance JSON-RPC command.
+type GetXpubAccountBalanceCmd struct {
+	Name    string
+	MinConf *int `jsonrpcdefault:"1"`
+}
+
+// NewGetXpubAccountBalanceCmd returns a new instance which can be used to
+// issue a getxpubaccountbalance JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetXpubAccountBalanceCmd(name string, minConf *int) *GetXpubAccountBalanceCmd {
+	return &GetXpubAccountBalanceCmd{
+		Name:    name,
+		MinConf: minConf,
+	}
+}
+
+// ImportXpubAccountCmd defines the importxpubaccount JSON-RPC command.
+type ImportXpubAccountCmd struct {
+	Name     string
+	XPub     string
+	AddrType *string `jsonrpcdefault:"\"p2pkh\"" jsonrpcusage:"\"p2pkh|p2wpkh|p2sh-p2wpkh\""`
+	GapLimit *uint32 `jsonrpcdefault:"20"`
+}
+
+// NewImportXpubAccountCmd returns a new instance which can be used to issue an
+// importxpubaccount JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewImportXpubAccountCmd(name, xpub string, addrType *string,
+	gapLimit *uint32) *ImportXpubAccountCmd {
+
+	return &ImportXpubAccountCmd{
+		Name:     name,
+		XPub:     xpub,
+		AddrType: addrType,
+		GapLimit: gapLimit,
+	}
+}
+
+// ListAttestationsCmd defines the listattestations JSON-RPC command.
+type ListAttestationsCmd struct {
+	Skip    *int  `jsonrpcdefault:"0"`
+	Count   *int  `jsonrpcdefault:"100"`
+	Reverse *bool `jsonrpcdefault:"false"`
+}
+
+// NewListAttestationsCmd returns a new instance which can be used to issue a
+// listattestations JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewListAttestationsCmd(skip, count *int, reverse *bool) *ListAttestationsCmd {
+	return &ListAttestationsCmd{
+		Skip:    skip,
+		Count:   count,
+		Reverse: reverse,
+	}
+}
+
+// ListReorgsCmd defines the listreorgs JSON-RPC command.
+type ListReorgsCmd struct {
+	Skip    *int  `jsonrpcdefault:"0"`
+	Count   *int  `jsonrpcdefault:"100"`
+	Reverse *bool `jsonrpcdefault:"false"`
+}
+
+// NewListReorgsCmd returns a new instance which can be used to issue a
+// listreorgs JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewListReorgsCmd(skip, count *int, reverse *bool) *ListReorgsCmd {
+	return &ListReorgsCmd{
+		Skip:    skip,
+		Count:   count,
+		Reverse: reverse,
+	}
+}
+
+// ListTemplateComparisonsCmd defines the listtemplatecomparisons JSON-RPC
+// command.
+type ListTemplateComparisonsCmd struct {
+	Skip    *int  `jsonrpcdefault:"0"`
+	Count   *int  `jsonrpcdefault:"100"`
+	Reverse *bool `jsonrpcdefault:"false"`
+}
+
+// NewListTemplateComparisonsCmd returns a new instance which can be used to
+// issue a listtemplatecomparisons JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewListTemplateComparisonsCmd(skip, count *int, reverse *bool) *ListTemplateComparisonsCmd {
+	return &ListTemplateComparisonsCmd{
+		Skip:    skip,
+		Count:   count,
+		Reverse: reverse,
+	}
+}
+
+// ListXpubAccountsCmd defines the listxpubaccounts JSON-RPC command.
+type ListXpubAccountsCmd struct{}
+
+// NewListXpubAccountsCmd returns a new instance which can be used to issue a
+// listxpubaccounts JSON-RPC command.
+func NewListXpubAccountsCmd() *ListXpubAccountsCmd {
+	return &ListXpubAccountsCmd{}
+}
+
+// ListXpubAccountUnspentCmd defines the listxpubaccountunspent JSON-RPC
+// command.
+type ListXpubAccountUnspentCmd struct {
+	Name    string
+	MinConf *int `jsonrpcdefault:"1"`
+}
+
+// NewListXpubAccountUnspentCmd returns a new instance which can be used to
+// issue a listxpubaccountunspent JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewListXpubAccountUnspentCmd(name string, minConf *int) *ListXpubAccountUnspentCmd {
+	return &ListXpubAccountUnspentCmd{
+		Name:    name,
+		MinConf: minConf,
+	}
+}
+
+// LogTraceCmd defines the logtrace JSON-RPC command.
+type LogTraceCmd struct {
+	Action string `jsonrpcusage:"\"add|remove|clear|list\""`
+	Target *string
+}
+
+// NewLogTraceCmd returns a new instance which can be used to issue a logtrace
+// JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewLogTraceCmd(action string, target *string) *LogTraceCmd {
+	return &LogTraceCmd{
+		Action: action,
+		Target: target,
+	}
+}
+
+// ReloadRPCRolesCmd defines the reloadrpcroles JSON-RPC command.  This command
+// is not a standard Bitcoin command.  It is an extension for btcd.
+type ReloadRPCRolesCmd struct{}
+
+// NewReloadRPCRolesCmd returns a new instance which can be used to issue a
+// reloadrpcroles JSON-RPC command.
+func NewReloadRPCRolesCmd() *ReloadRPCRolesCmd {
+	return &ReloadRPCRolesCmd{}
+}
+
+// RemoveXpubAccountCmd defines the removexpubaccount JSON-RPC command.
+type RemoveXpubAccountCmd struct {
+	Name string
+}
+
+// NewRemoveXpubAccountCmd returns a new instance which can be used to issue a
+// removexpubaccount JSON-RPC command.
+func NewRemoveXpubAccountCmd(name string) *RemoveXpubAccountCmd {
+	return &RemoveXpubAccountCmd{
+		Name: name,
+	}
+}
+
+// PromoteStandbyCmd defines the promotestandby JSON-RPC command.  This command
+// is not a standard Bitcoin command.  It is an extension for btcd.
+type PromoteStandbyCmd struct{}
+
+// NewPromoteStandbyCmd returns a new instance which can be used to issue a
+// promotestandby JSON-RPC command.
+func NewPromoteStandbyCmd() *PromoteStandbyCmd {
+	return &PromoteStandbyCmd{}
+}
+
+// SetRPCRoleCmd defines the setrpcrole JSON-RPC command.  This command is not a
+// standard Bitcoin command.  It is an extension for btcd.
+type SetRPCRoleCmd struct {
+	Role      string
+	Methods   []string
+	RateLimit *int  `jsonrpcdefault:"0"`
+	Persist   *bool `jsonrpcdefault:"false"`
+}
+
+// NewSetRPCRoleCmd returns a new instance which can be used to issue a
+// setrpcrole JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewSetRPCRoleCmd(role string, methods []string, rateLimit *int,
+	persist *bool) *SetRPCRoleCmd {
+
+	return &SetRPCRoleCmd{
+		Role:      role,
+		Methods:   methods,
+		RateLimit: rateLimit,
+		Persist:   persist,
+	}
+}
+
+// SetScriptWorkersCmd defines the setscriptworkers JSON-RPC command.  This
+// command is not a standard Bitcoin command.  It is an extension for btcd.
+type SetScriptWorkersCmd struct {
+	Workers int
+}
+
+// NewSetScriptWorkersCmd returns a new instance which can be used to issue a
+// setscriptworkers JSON-RPC command.
+func NewSetScriptWorkersCmd(workers int) *SetScriptWorkersCmd {
+	return &SetScriptWorkersCmd{
+		Workers: workers,
+	}
+}
+
+// ValidateBlockCmd defines the validateblock JSON-RPC command.  This command is
+// not a standard Bitcoin command.  It is an extension for btcd.
+type ValidateBlockCmd struct {
+	HexBlock string
+	CheckPoW *bool `jsonrpcdefault:"true"`
+}
+
+// NewValidateBlockCmd returns a new instance which can be used to issue a
+// validateblock JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewValidateBlockCmd(hexBlock string, checkPoW *bool) *ValidateBlockCmd {
+	return &ValidateBlockCmd{
+		HexBlock: hexBlock,
+		CheckPoW: checkPoW,
+	}
+}
+
 // VersionCmd defines the version JSON-RPC command.
 //
 // NOTE: This is a btcsuite extension ported from
@@ -128,11 +541,40 @@ func init() {
 	// No special flags for commands in this file.
 	flags := UsageFlag(0)
 
+	MustRegisterCmd("addcheckpoint", (*AddCheckpointCmd)(nil), flags)
+	MustRegisterCmd("backupdatabase", (*BackupDatabaseCmd)(nil), flags)
 	MustRegisterCmd("debuglevel", (*DebugLevelCmd)(nil), flags)
+	MustRegisterCmd("dumptxoutset", (*DumpTxOutSetCmd)(nil), flags)
 	MustRegisterCmd("node", (*NodeCmd)(nil), flags)
 	MustRegisterCmd("generate", (*GenerateCmd)(nil), flags)
 	MustRegisterCmd("getbestblock", (*GetBestBlockCmd)(nil), flags)
+	MustRegisterCmd("getcheckpoints", (*GetCheckpointsCmd)(nil), flags)
 	MustRegisterCmd("getcurrentnet", (*GetCurrentNetCmd)(nil), flags)
+	MustRegisterCmd("getdatabasestats", (*GetDatabaseStatsCmd)(nil), flags)
 	MustRegisterCmd("getheaders", (*GetHeadersCmd)(nil), flags)
+	MustRegisterCmd("getmempoolcluster", (*GetMempoolClusterCmd)(nil), flags)
+	MustRegisterCmd("getmempooldiagram", (*GetMempoolDiagramCmd)(nil), flags)
+	MustRegisterCmd("getmempoolpackage", (*GetMempoolPackageCmd)(nil), flags)
+	MustRegisterCmd("getorphanblockinfo", (*GetOrphanBlockInfoCmd)(nil), flags)
+	MustRegisterCmd("getrpcroles", (*GetRPCRolesCmd)(nil), flags)
+	MustRegisterCmd("getscriptvalidationinfo", (*GetScriptValidationInfoCmd)(nil), flags)
+	MustRegisterCmd("getstandbyinfo", (*GetStandbyInfoCmd)(nil), flags)
+	MustRegisterCmd("getsyncprogress", (*GetSyncProgressCmd)(nil), flags)
+	MustRegisterCmd("gettimeinfo", (*GetTimeInfoCmd)(nil), flags)
+	MustRegisterCmd("getwitnessupgradeinfo", (*GetWitnessUpgradeInfoCmd)(nil), flags)
+	MustRegisterCmd("getxpubaccountbalance", (*GetXpubAccountBalanceCmd)(nil), flags)
+	MustRegisterCmd("importxpubaccount", (*ImportXpubAccountCmd)(nil), flags)
+	MustRegisterCmd("listattestations", (*ListAttestationsCmd)(nil), flags)
+	MustRegisterCmd("listreorgs", (*ListReorgsCmd)(nil), flags)
+	MustRegisterCmd("listtemplatecomparisons", (*ListTemplateComparisonsCmd)(nil), flags)
+	MustRegisterCmd("listxpubaccounts", (*ListXpubAccountsCmd)(nil), flags)
+	MustRegisterCmd("listxpubaccountunspent", (*ListXpubAccountUnspentCmd)(nil), flags)
+	MustRegisterCmd("logtrace", (*LogTraceCmd)(nil), flags)
+	MustRegisterCmd("promotestandby", (*PromoteStandbyCmd)(nil), flags)
+	MustRegisterCmd("reloadrpcroles", (*ReloadRPCRolesCmd)(nil), flags)
+	MustRegisterCmd("removexpubaccount", (*RemoveXpubAccountCmd)(nil), flags)
+	MustRegisterCmd("setrpcrole", (*SetRPCRoleCmd)(nil), flags)
+	MustRegisterCmd("setscriptworkers", (*SetScriptWorkersCmd)(nil), flags)
+	MustRegisterCmd("validateblock", (*ValidateBlockCmd)(nil), flags)
 	MustRegisterCmd("version", (*VersionCmd)(nil), flags)
 }
@@ -30,6 +30,37 @@ func TestBtcdExtCmds(t *testing.T) {
 		marshalled   string
 		unmarshalled interface{}
 	}{
+		{
+			name: "addcheckpoint",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("addcheckpoint", 100, "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewAddCheckpointCmd(100, "123", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"addcheckpoint","params":[100,"123"],"id":1}`,
+			unmarshalled: &btcjson.AddCheckpointCmd{
+				Height:  100,
+				Hash:    "123",
+				Persist: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "addcheckpoint optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("addcheckpoint", 100, "123", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewAddCheckpointCmd(100, "123",
+					btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"addcheckpoint","params":[100,"123",true],"id":1}`,
+			unmarshalled: &btcjson.AddCheckpointCmd{
+				Height:  100,
+				Hash:    "123",
+				Persist: btcjson.Bool(true),
+			},
+		},
 		{
 			name: "debuglevel",
 			newCmd: func() (interface{}, error) {
@@ -101,6 +132,32 @@ func TestBtcdExtCmds(t *testing.T) {
 				ConnectSubCmd: btcjson.String("temp"),
 			},
 		},
+		{
+			name: "backupdatabase",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("backupdatabase", "blocks.bak")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewBackupDatabaseCmd("blocks.bak")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"backupdatabase","params":["blocks.bak"],"id":1}`,
+			unmarshalled: &btcjson.BackupDatabaseCmd{
+				Path: "blocks.bak",
+			},
+		},
+		{
+			name: "dumptxoutset",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("dumptxoutset", "utxo.dat")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewDumpTxOutSetCmd("utxo.dat")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"dumptxoutset","params":["utxo.dat"],"id":1}`,
+			unmarshalled: &btcjson.DumpTxOutSetCmd{
+				Path: "utxo.dat",
+			},
+		},
 		{
 			name: "generate",
 			newCmd: func() (interface{}, error) {
@@ -125,6 +182,54 @@ func TestBtcdExtCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getbestblock","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetBestBlockCmd{},
 		},
+		{
+			name: "getcheckpoints",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getcheckpoints")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetCheckpointsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getcheckpoints","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetCheckpointsCmd{},
+		},
+		{
+			name: "getmempoolpackage",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempoolpackage", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolPackageCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolpackage","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolPackageCmd{
+				TxID: "123",
+			},
+		},
+		{
+			name: "getmempoolcluster",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempoolcluster", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolClusterCmd("123")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolcluster","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolClusterCmd{
+				TxID: "123",
+			},
+		},
+		{
+			name: "getmempooldiagram",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmempooldiagram")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMempoolDiagramCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getmempooldiagram","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetMempoolDiagramCmd{},
+		},
 		{
 			name: "getcurrentnet",
 			newCmd: func() (interface{}, error) {
@@ -176,6 +281,394 @@ func TestBtcdExtCmds(t *testing.T) {
 				HashStop: "000000000000000000ba33b33e1fad70b69e234fc24414dd47113bff38f523f7",
 			},
 		},
+		{
+			name: "getorphanblockinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getorphanblockinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetOrphanBlockInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getorphanblockinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetOrphanBlockInfoCmd{},
+		},
+		{
+			name: "getstandbyinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getstandbyinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetStandbyInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getstandbyinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetStandbyInfoCmd{},
+		},
+		{
+			name: "getdatabasestats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getdatabasestats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetDatabaseStatsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getdatabasestats","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetDatabaseStatsCmd{},
+		},
+		{
+			name: "getscriptvalidationinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getscriptvalidationinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetScriptValidationInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getscriptvalidationinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetScriptValidationInfoCmd{},
+		},
+		{
+			name: "getrpcroles",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getrpcroles")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetRPCRolesCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getrpcroles","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetRPCRolesCmd{},
+		},
+		{
+			name: "setrpcrole",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setrpcrole", "monitor", []string{"getblockcount"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetRPCRoleCmd("monitor", []string{"getblockcount"}, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setrpcrole","params":["monitor",["getblockcount"]],"id":1}`,
+			unmarshalled: &btcjson.SetRPCRoleCmd{
+				Role:      "monitor",
+				Methods:   []string{"getblockcount"},
+				RateLimit: btcjson.Int(0),
+				Persist:   btcjson.Bool(false),
+			},
+		},
+		{
+			name: "setrpcrole optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setrpcrole", "monitor", []string{"@limited"}, 60, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetRPCRoleCmd("monitor", []string{"@limited"},
+					btcjson.Int(60), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setrpcrole","params":["monitor",["@limited"],60,true],"id":1}`,
+			unmarshalled: &btcjson.SetRPCRoleCmd{
+				Role:      "monitor",
+				Methods:   []string{"@limited"},
+				RateLimit: btcjson.Int(60),
+				Persist:   btcjson.Bool(true),
+			},
+		},
+		{
+			name: "reloadrpcroles",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("reloadrpcroles")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewReloadRPCRolesCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"reloadrpcroles","params":[],"id":1}`,
+			unmarshalled: &btcjson.ReloadRPCRolesCmd{},
+		},
+		{
+			name: "setscriptworkers",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setscriptworkers", 16)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetScriptWorkersCmd(16)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"setscriptworkers","params":[16],"id":1}`,
+			unmarshalled: &btcjson.SetScriptWorkersCmd{Workers: 16},
+		},
+		{
+			name: "getsyncprogress",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getsyncprogress")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetSyncProgressCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getsyncprogress","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetSyncProgressCmd{},
+		},
+		{
+			name: "gettimeinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("gettimeinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetTimeInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"gettimeinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetTimeInfoCmd{},
+		},
+		{
+			name: "getwitnessupgradeinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getwitnessupgradeinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetWitnessUpgradeInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getwitnessupgradeinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetWitnessUpgradeInfoCmd{},
+		},
+		{
+			name: "getxpubaccountbalance",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getxpubaccountbalance", "savings")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetXpubAccountBalanceCmd("savings", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getxpubaccountbalance","params":["savings"],"id":1}`,
+			unmarshalled: &btcjson.GetXpubAccountBalanceCmd{
+				Name:    "savings",
+				MinConf: btcjson.Int(1),
+			},
+		},
+		{
+			name: "getxpubaccountbalance optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getxpubaccountbalance", "savings", 6)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetXpubAccountBalanceCmd("savings", btcjson.Int(6))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getxpubaccountbalance","params":["savings",6],"id":1}`,
+			unmarshalled: &btcjson.GetXpubAccountBalanceCmd{
+				Name:    "savings",
+				MinConf: btcjson.Int(6),
+			},
+		},
+		{
+			name: "importxpubaccount",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("importxpubaccount", "savings", "xpub")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewImportXpubAccountCmd("savings", "xpub", nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"importxpubaccount","params":["savings","xpub"],"id":1}`,
+			unmarshalled: &btcjson.ImportXpubAccountCmd{
+				Name:     "savings",
+				XPub:     "xpub",
+				AddrType: btcjson.String("p2pkh"),
+				GapLimit: btcjson.Uint32(20),
+			},
+		},
+		{
+			name: "importxpubaccount optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("importxpubaccount", "savings", "xpub", "p2wpkh", 100)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewImportXpubAccountCmd("savings", "xpub",
+					btcjson.String("p2wpkh"), btcjson.Uint32(100))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"importxpubaccount","params":["savings","xpub","p2wpkh",100],"id":1}`,
+			unmarshalled: &btcjson.ImportXpubAccountCmd{
+				Name:     "savings",
+				XPub:     "xpub",
+				AddrType: btcjson.String("p2wpkh"),
+				GapLimit: btcjson.Uint32(100),
+			},
+		},
+		{
+			name: "listattestations",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listattestations", 0, 1)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListAttestationsCmd(btcjson.Int(0),
+					btcjson.Int(1), nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"listattestations","params":[0,1],"id":1}`,
+			unmarshalled: &btcjson.ListAttestationsCmd{
+				Skip:    btcjson.Int(0),
+				Count:   btcjson.Int(1),
+				Reverse: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "listreorgs",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listreorgs")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListReorgsCmd(nil, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"listreorgs","params":[],"id":1}`,
+			unmarshalled: &btcjson.ListReorgsCmd{
+				Skip:    btcjson.Int(0),
+				Count:   btcjson.Int(100),
+				Reverse: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "listreorgs optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listreorgs", 10, 5, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListReorgsCmd(btcjson.Int(10),
+					btcjson.Int(5), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"listreorgs","params":[10,5,true],"id":1}`,
+			unmarshalled: &btcjson.ListReorgsCmd{
+				Skip:    btcjson.Int(10),
+				Count:   btcjson.Int(5),
+				Reverse: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "listtemplatecomparisons",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listtemplatecomparisons")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListTemplateComparisonsCmd(nil, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"listtemplatecomparisons","params":[],"id":1}`,
+			unmarshalled: &btcjson.ListTemplateComparisonsCmd{
+				Skip:    btcjson.Int(0),
+				Count:   btcjson.Int(100),
+				Reverse: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "listtemplatecomparisons optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listtemplatecomparisons", 10, 5, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListTemplateComparisonsCmd(btcjson.Int(10),
+					btcjson.Int(5), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"listtemplatecomparisons","params":[10,5,true],"id":1}`,
+			unmarshalled: &btcjson.ListTemplateComparisonsCmd{
+				Skip:    btcjson.Int(10),
+				Count:   btcjson.Int(5),
+				Reverse: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "listxpubaccounts",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listxpubaccounts")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListXpubAccountsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"listxpubaccounts","params":[],"id":1}`,
+			unmarshalled: &btcjson.ListXpubAccountsCmd{},
+		},
+		{
+			name: "listxpubaccountunspent",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listxpubaccountunspent", "savings", 0)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListXpubAccountUnspentCmd("savings", btcjson.Int(0))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"listxpubaccountunspent","params":["savings",0],"id":1}`,
+			unmarshalled: &btcjson.ListXpubAccountUnspentCmd{
+				Name:    "savings",
+				MinConf: btcjson.Int(0),
+			},
+		},
+		{
+			name: "logtrace",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("logtrace", "list")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewLogTraceCmd("list", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"logtrace","params":["list"],"id":1}`,
+			unmarshalled: &btcjson.LogTraceCmd{
+				Action: "list",
+			},
+		},
+		{
+			name: "logtrace target",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("logtrace", "add", "peer:1.2.3.4")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewLogTraceCmd("add",
+					btcjson.String("peer:1.2.3.4"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"logtrace","params":["add","peer:1.2.3.4"],"id":1}`,
+			unmarshalled: &btcjson.LogTraceCmd{
+				Action: "add",
+				Target: btcjson.String("peer:1.2.3.4"),
+			},
+		},
+		{
+			name: "promotestandby",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("promotestandby")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewPromoteStandbyCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"promotestandby","params":[],"id":1}`,
+			unmarshalled: &btcjson.PromoteStandbyCmd{},
+		},
+		{
+			name: "removexpubaccount",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("removexpubaccount", "savings")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewRemoveXpubAccountCmd("savings")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"removexpubaccount","params":["savings"],"id":1}`,
+			unmarshalled: &btcjson.RemoveXpubAccountCmd{
+				Name: "savings",
+			},
+		},
+		{
+			name: "validateblock",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("validateblock", "00")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewValidateBlockCmd("00", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"validateblock","params":["00"],"id":1}`,
+			unmarshalled: &btcjson.ValidateBlockCmd{
+				HexBlock: "00",
+				CheckPoW: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "validateblock checkpow",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("validateblock", "00", false)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewValidateBlockCmd("00",
+					btcjson.Bool(false))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"validateblock","params":["00",false],"id":1}`,
+			unmarshalled: &btcjson.ValidateBlockCmd{
+				HexBlock: "00",
+				CheckPoW: btcjson.Bool(false),
+			},
+		},
 		{
 			name: "version",
 			newCmd: func() (interface{}, error) {
@@ -18,3 +18,347 @@ type VersionResult struct {
 	Prerelease    string `json:"prerelease"`
 	BuildMetadata string `json:"buildmetadata"`
 }
+
+// GetStandbyInfoResult models the data returned from the getstandbyinfo
+// command.
+type GetStandbyInfoResult struct {
+	Standby             bool   `json:"standby"`
+	Primary             string `json:"primary"`
+	PrimaryReachable    bool   `json:"primaryreachable"`
+	ConsecutiveFailures int    `json:"consecutivefailures"`
+	LastCheck           int64  `json:"lastcheck"`
+	PromotedAt          int64  `json:"promotedat,omitempty"`
+	PromotionReason     string `json:"promotionreason,omitempty"`
+}
+
+// WitnessUpgradeVersionResult models the usage counters of a single unknown
+// witness or tap leaf version returned by the getwitnessupgradeinfo command.
+type WitnessUpgradeVersionResult struct {
+	Version        int    `json:"version"`
+	MempoolOutputs uint64 `json:"mempooloutputs"`
+	MempoolInputs  uint64 `json:"mempoolinputs"`
+	BlockOutputs   uint64 `json:"blockoutputs"`
+	BlockInputs    uint64 `json:"blockinputs"`
+	LastSeen       int64  `json:"lastseen"`
+}
+
+// WitnessUpgradeSampleResult models a single observation of an unknown witness
+// or tap leaf version returned by the getwitnessupgradeinfo command.
+type WitnessUpgradeSampleResult struct {
+	Kind    string `json:"kind"`
+	Version int    `json:"version"`
+	TxID    string `json:"txid"`
+	Index   uint32 `json:"index"`
+	Source  string `json:"source"`
+	Height  int32  `json:"height,omitempty"`
+	Time    int64  `json:"time"`
+}
+
+// GetWitnessUpgradeInfoResult models the data returned from the
+// getwitnessupgradeinfo command.
+type GetWitnessUpgradeInfoResult struct {
+	WitnessVersions []WitnessUpgradeVersionResult `json:"witnessversions"`
+	TapLeafVersions []WitnessUpgradeVersionResult `json:"tapleafversions"`
+	Samples         []WitnessUpgradeSampleResult  `json:"samples"`
+}
+
+// XpubAccountResult models a single account returned by the listxpubaccounts
+// command.
+type XpubAccountResult struct {
+	Name     string `json:"name"`
+	XPub     string `json:"xpub"`
+	AddrType string `json:"addrtype"`
+	GapLimit uint32 `json:"gaplimit"`
+	Created  int64  `json:"created"`
+}
+
+// GetXpubAccountBalanceResult models the data returned from the
+// getxpubaccountbalance command.
+type GetXpubAccountBalanceResult struct {
+	Name             string  `json:"name"`
+	Confirmed        float64 `json:"confirmed"`
+	Unconfirmed      float64 `json:"unconfirmed"`
+	Received         float64 `json:"received"`
+	UnspentCount     int     `json:"unspentcount"`
+	NextReceiveIndex uint32  `json:"nextreceiveindex"`
+	NextChangeIndex  uint32  `json:"nextchangeindex"`
+}
+
+// XpubAccountUnspentResult models a single unspent output returned by the
+// listxpubaccountunspent command.
+type XpubAccountUnspentResult struct {
+	TxID          string  `json:"txid"`
+	Vout          uint32  `json:"vout"`
+	Address       string  `json:"address"`
+	Branch        uint32  `json:"branch"`
+	Index         uint32  `json:"index"`
+	Amount        float64 `json:"amount"`
+	ScriptPubKey  string  `json:"scriptPubKey"`
+	Confirmations int64   `json:"confirmations"`
+}
+
+// AttestationResult models a single attestation returned by the
+// listattestations command.
+type AttestationResult struct {
+	ID          uint64  `json:"id"`
+	Time        int64   `json:"time"`
+	Hash        string  `json:"hash"`
+	Height      int32   `json:"height"`
+	UtxoMuHash  string  `json:"utxomuhash"`
+	TxOuts      uint64  `json:"txouts"`
+	TotalAmount float64 `json:"totalamount"`
+	Message     string  `json:"message"`
+	Signature   string  `json:"signature"`
+}
+
+// ListAttestationsResult models the data returned from the listattestations
+// command.
+type ListAttestationsResult struct {
+	PubKey       string              `json:"pubkey"`
+	Total        int                 `json:"total"`
+	Attestations []AttestationResult `json:"attestations"`
+}
+
+// ReorgResult models a single reorganization returned by the listreorgs
+// command.
+type ReorgResult struct {
+	ID             uint64 `json:"id"`
+	Time           int64  `json:"time"`
+	ForkHash       string `json:"forkhash"`
+	ForkHeight     int32  `json:"forkheight"`
+	OldTipHash     string `json:"oldtiphash"`
+	OldTipHeight   int32  `json:"oldtipheight"`
+	NewTipHash     string `json:"newtiphash"`
+	NewTipHeight   int32  `json:"newtipheight"`
+	Depth          int    `json:"depth"`
+	AttachedBlocks int    `json:"attachedblocks"`
+	DetachedTxns   int    `json:"detachedtxns"`
+	AttachedTxns   int    `json:"attachedtxns"`
+}
+
+// ListReorgsResult models the data returned from the listreorgs command.
+type ListReorgsResult struct {
+	Total  int           `json:"total"`
+	Reorgs []ReorgResult `json:"reorgs"`
+}
+
+// TemplateComparisonResult models a single comparison of a block with the
+// most recent block template returned by the listtemplatecomparisons command.
+type TemplateComparisonResult struct {
+	ID           uint64 `json:"id"`
+	Hash         string `json:"hash"`
+	Height       int32  `json:"height"`
+	Time         int64  `json:"time"`
+	BlockTime    int64  `json:"blocktime"`
+	TemplateTime int64  `json:"templatetime"`
+	TemplateAge  int64  `json:"templateage"`
+	TemplateTxns int    `json:"templatetxns"`
+	BlockTxns    int    `json:"blocktxns"`
+	SharedTxns   int    `json:"sharedtxns"`
+	MissingTxns  int    `json:"missingtxns"`
+	ExtraTxns    int    `json:"extratxns"`
+	TemplateFees int64  `json:"templatefees"`
+	BlockFees    int64  `json:"blockfees"`
+	FeeDiff      int64  `json:"feediff"`
+	MissedFees   int64  `json:"missedfees"`
+}
+
+// ListTemplateComparisonsResult models the data returned from the
+// listtemplatecomparisons command.
+type ListTemplateComparisonsResult struct {
+	Total       int                        `json:"total"`
+	Comparisons []TemplateComparisonResult `json:"comparisons"`
+}
+
+// CheckpointResult models a single checkpoint returned by the getcheckpoints
+// command.
+type CheckpointResult struct {
+	Height int32  `json:"height"`
+	Hash   string `json:"hash"`
+	Local  bool   `json:"local"`
+}
+
+// GetCheckpointsResult models the data returned from the getcheckpoints
+// command.
+type GetCheckpointsResult struct {
+	Mode        string             `json:"mode"`
+	Checkpoints []CheckpointResult `json:"checkpoints"`
+}
+
+// MempoolPackageNodeResult models a transaction of the package returned by the
+// getmempoolpackage command.
+type MempoolPackageNodeResult struct {
+	TxID            string  `json:"txid"`
+	Relation        string  `json:"relation"`
+	Fee             float64 `json:"fee"`
+	VSize           int64   `json:"vsize"`
+	FeeRate         float64 `json:"feerate"`
+	AncestorFee     float64 `json:"ancestorfee"`
+	AncestorVSize   int64   `json:"ancestorvsize"`
+	AncestorFeeRate float64 `json:"ancestorfeerate"`
+	Time            int64   `json:"time"`
+	Height          int64   `json:"height"`
+}
+
+// MempoolPackageEdgeResult models a spend between two transactions of the
+// package returned by the getmempoolpackage command.
+type MempoolPackageEdgeResult struct {
+	Parent string `json:"parent"`
+	Vout   uint32 `json:"vout"`
+	Child  string `json:"child"`
+	Vin    uint32 `json:"vin"`
+}
+
+// GetMempoolPackageResult models the data returned from the getmempoolpackage
+// command.
+type GetMempoolPackageResult struct {
+	TxID  string                     `json:"txid"`
+	Nodes []MempoolPackageNodeResult `json:"nodes"`
+	Edges []MempoolPackageEdgeResult `json:"edges"`
+}
+
+// FeeRateDiagramPointResult models a point of a feerate diagram returned by the
+// getmempoolcluster and getmempooldiagram commands.
+type FeeRateDiagramPointResult struct {
+	VSize int64   `json:"vsize"`
+	Fee   float64 `json:"fee"`
+}
+
+// MempoolClusterChunkResult models a chunk of the cluster returned by the
+// getmempoolcluster command.
+type MempoolClusterChunkResult struct {
+	Fee     float64  `json:"fee"`
+	VSize   int64    `json:"vsize"`
+	FeeRate float64  `json:"feerate"`
+	TxIDs   []string `json:"txids"`
+}
+
+// GetMempoolClusterResult models the data returned from the getmempoolcluster
+// command.
+type GetMempoolClusterResult struct {
+	TxID    string                      `json:"txid"`
+	TxCount int64                       `json:"txcount"`
+	Fee     float64                     `json:"fee"`
+	VSize   int64                       `json:"vsize"`
+	Chunks  []MempoolClusterChunkResult `json:"chunks"`
+	Diagram []FeeRateDiagramPointResult `json:"diagram"`
+}
+
+// TimeSampleResult models a time sample returned by the gettimeinfo command.
+type TimeSampleResult struct {
+	Source  string  `json:"source"`
+	Offset  float64 `json:"offset"`
+	Added   int64   `json:"added"`
+	Outlier bool    `json:"outlier"`
+}
+
+// GetTimeInfoResult models the data returned from the gettimeinfo command.
+type GetTimeInfoResult struct {
+	LocalTime     int64              `json:"localtime"`
+	AdjustedTime  int64              `json:"adjustedtime"`
+	Offset        int64              `json:"offset"`
+	MaxAdjustment int64              `json:"maxadjustment"`
+	Warning       string             `json:"warning"`
+	Samples       []TimeSampleResult `json:"samples"`
+}
+
+// LogTraceTargetResult models a target of the selective trace logging returned
+// by the logtrace command.
+type LogTraceTargetResult struct {
+	Kind         string `json:"kind"`
+	Target       string `json:"target"`
+	Messages     uint64 `json:"messages"`
+	Transactions int    `json:"transactions,omitempty"`
+}
+
+// ValidateBlockResult models the data returned from the validateblock command.
+type ValidateBlockResult struct {
+	Hash         string `json:"hash"`
+	Valid        bool   `json:"valid"`
+	RejectReason string `json:"rejectreason,omitempty"`
+	Rule         string `json:"rule,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+// GetOrphanBlockInfoResult models the data returned from the getorphanblockinfo
+// command.
+type GetOrphanBlockInfoResult struct {
+	Count     int    `json:"count"`
+	Bytes     int64  `json:"bytes"`
+	MaxCount  int    `json:"maxcount"`
+	MaxBytes  int64  `json:"maxbytes"`
+	Expiry    int64  `json:"expiry"`
+	Roots     int    `json:"roots"`
+	Added     uint64 `json:"added"`
+	Connected uint64 `json:"connected"`
+	Expired   uint64 `json:"expired"`
+	Evicted   uint64 `json:"evicted"`
+}
+
+// GetScriptValidationInfoResult models the data returned from the
+// getscriptvalidationinfo command.
+type GetScriptValidationInfoResult struct {
+	Workers     int    `json:"workers"`
+	Schedule    string `json:"schedule"`
+	PinnedCPUs  []int  `json:"pinnedcpus,omitempty"`
+	QueueDepth  int64  `json:"queuedepth"`
+	BusyWorkers int32  `json:"busyworkers"`
+	Batches     uint64 `json:"batches"`
+	Inputs      uint64 `json:"inputs"`
+}
+
+// GetSyncProgressResult models the data returned from the getsyncprogress
+// command.
+type GetSyncProgressResult struct {
+	Time            int64   `json:"time"`
+	HeadersHeight   int32   `json:"headersheight"`
+	PresyncHeight   int32   `json:"presyncheight,omitempty"`
+	BlockHeight     int32   `json:"blockheight"`
+	BlockHash       string  `json:"blockhash"`
+	TargetHeight    int32   `json:"targetheight"`
+	Progress        float64 `json:"progress"`
+	SyncPeerID      int32   `json:"syncpeerid,omitempty"`
+	SyncPeer        string  `json:"syncpeer,omitempty"`
+	BlocksPerSecond float64 `json:"blockspersecond"`
+	ETA             int64   `json:"eta"`
+	Current         bool    `json:"current"`
+}
+
+// BackupDatabaseResult models the data returned from the backupdatabase
+// command.
+type BackupDatabaseResult struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// GetDatabaseStatsResult models the data returned from the getdatabasestats
+// command.
+type GetDatabaseStatsResult struct {
+	MetadataCacheHits    uint64 `json:"metadatacachehits"`
+	MetadataCacheMisses  uint64 `json:"metadatacachemisses"`
+	MetadataBytesRead    uint64 `json:"metadatabytesread"`
+	MetadataBytesWritten uint64 `json:"metadatabyteswritten"`
+	BlockFileHits        uint64 `json:"blockfilehits"`
+	BlockFileMisses      uint64 `json:"blockfilemisses"`
+	BlockBytesRead       uint64 `json:"blockbytesread"`
+	BlockBytesWritten    uint64 `json:"blockbyteswritten"`
+	OpenFiles            int    `json:"openfiles"`
+}
+
+// DumpTxOutSetResult models the data returned from the dumptxoutset command.
+type DumpTxOutSetResult struct {
+	CoinsWritten uint64 `json:"coins_written"`
+	BaseHash     string `json:"base_hash"`
+	BaseHeight   int32  `json:"base_height"`
+	Path         string `json:"path"`
+	TxOutSetHash string `json:"txoutset_hash"`
+}
+
+// RPCRoleResult models a single role returned by the getrpcroles command.
+type RPCRoleResult struct {
+	Name      string   `json:"name"`
+	Methods   []string `json:"methods"`
+	RateLimit int      `json:"ratelimit"`
+	BuiltIn   bool     `json:"builtin"`
+	Users     []string `json:"users"`
+}
@@ -76,14 +76,19 @@ func NewCreateRawTransactionCmd(inputs []TransactionInput, amounts map[string]fl
 
 // DecodeRawTransactionCmd defines the decoderawtransaction JSON-RPC command.
 type DecodeRawTransactionCmd struct {
-	HexTx string
+	HexTx           string
+	IncludePrevOuts *bool `jsonrpcdefault:"false"`
 }
 
 // NewDecodeRawTransactionCmd returns a new instance which can be used to issue
 // a decoderawtransaction JSON-RPC command.
-func NewDecodeRawTransactionCmd(hexTx string) *DecodeRawTransactionCmd {
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewDecodeRawTransactionCmd(hexTx string, includePrevOuts *bool) *DecodeRawTransactionCmd {
 	return &DecodeRawTransactionCmd{
-		HexTx: hexTx,
+		HexTx:           hexTx,
+		IncludePrevOuts: includePrevOuts,
 	}
 }
 
@@ -100,6 +105,40 @@ func NewDecodeScriptCmd(hexScript string) *DecodeScriptCmd {
 	}
 }
 
+// EstimateSmartFeeMode defines the estimation mode to be used with
+// the estimatesmartfee command.
+type EstimateSmartFeeMode string
+
+const (
+	// EstimateModeEconomical indicates that the estimate may follow
+	// short term drops in the fee market more closely, which may lead to
+	// lower fees.
+	EstimateModeEconomical EstimateSmartFeeMode = "ECONOMICAL"
+
+	// EstimateModeConservative indicates that the estimate takes a longer
+	// history into account, so it is less likely to be too low to be
+	// mined within the target.
+	EstimateModeConservative EstimateSmartFeeMode = "CONSERVATIVE"
+)
+
+// EstimateSmartFeeCmd defines the estimatesmartfee JSON-RPC command.
+type EstimateSmartFeeCmd struct {
+	ConfTarget   int64
+	EstimateMode *EstimateSmartFeeMode `jsonrpcdefault:"\"CONSERVATIVE\"" jsonrpcusage:"\"ECONOMICAL|CONSERVATIVE\""`
+}
+
+// NewEstimateSmartFeeCmd returns a new instance which can be used to issue an
+// estimatesmartfee JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewEstimateSmartFeeCmd(confTarget int64, mode *EstimateSmartFeeMode) *EstimateSmartFeeCmd {
+	return &EstimateSmartFeeCmd{
+		ConfTarget:   confTarget,
+		EstimateMode: mode,
+	}
+}
+
 // GetAddedNodeInfoCmd defines the getaddednodeinfo JSON-RPC command.
 type GetAddedNodeInfoCmd struct {
 	DNS  bool
@@ -147,6 +186,21 @@ func NewGetBlockCmd(hash string, verbose, verboseTx *bool) *GetBlockCmd {
 	}
 }
 
+// GetBlockFromPeerCmd defines the getblockfrompeer JSON-RPC command.
+type GetBlockFromPeerCmd struct {
+	BlockHash string
+	PeerID    int32
+}
+
+// NewGetBlockFromPeerCmd returns a new instance which can be used to issue a
+// getblockfrompeer JSON-RPC command.
+func NewGetBlockFromPeerCmd(blockHash string, peerID int32) *GetBlockFromPeerCmd {
+	return &GetBlockFromPeerCmd{
+		BlockHash: blockHash,
+		PeerID:    peerID,
+	}
+}
+
 // GetBlockChainInfoCmd defines the getblockchaininfo JSON-RPC command.
 type GetBlockChainInfoCmd struct{}
 
@@ -193,6 +247,55 @@ func NewGetBlockHeaderCmd(hash string, verbose *bool) *GetBlockHeaderCmd {
 	}
 }
 
+// HashOrHeight identifies a block by either its hash or its height in the main
+// chain.  Value holds either a hash string or an int64 height and is
+// marshalled as a JSON string or number accordingly.
+type HashOrHeight struct {
+	Value interface{}
+}
+
+// MarshalJSON provides a custom Marshal method for HashOrHeight.
+func (h HashOrHeight) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.Value)
+}
+
+// UnmarshalJSON provides a custom Unmarshal method for HashOrHeight.  This is
+// necessary because the value can either be a hash string or a height number.
+func (h *HashOrHeight) UnmarshalJSON(data []byte) error {
+	var height int64
+	if err := json.Unmarshal(data, &height); err == nil {
+		h.Value = height
+		return nil
+	}
+
+	var hash string
+	if err := json.Unmarshal(data, &hash); err != nil {
+		str := "the hash or height must be a string or an integer"
+		return makeError(ErrInvalidType, str)
+	}
+	h.Value = hash
+	return nil
+}
+
+// GetBlockStatsCmd defines the getblockstats JSON-RPC command.
+type GetBlockStatsCmd struct {
+	HashOrHeight HashOrHeight
+	Stats        *[]string
+}
+
+// NewGetBlockStatsCmd returns a new instance which can be used to issue a
+// getblockstats JSON-RPC command.  The hashOrHeight parameter is either a hash
+// string or an int64 height.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetBlockStatsCmd(hashOrHeight interface{}, stats *[]string) *GetBlockStatsCmd {
+	return &GetBlockStatsCmd{
+		HashOrHeight: HashOrHeight{Value: hashOrHeight},
+		Stats:        stats,
+	}
+}
+
 // TemplateRequest is a request object as defined in BIP22
 // (https://en.bitcoin.it/wiki/BIP_0022), it is optionally provided as an
 // pointer argument to GetBlockTemplateCmd.
@@ -321,6 +424,24 @@ func NewGetChainTipsCmd() *GetChainTipsCmd {
 	return &GetChainTipsCmd{}
 }
 
+// GetChainTxStatsCmd defines the getchaintxstats JSON-RPC command.
+type GetChainTxStatsCmd struct {
+	NBlocks   *int32
+	BlockHash *string
+}
+
+// NewGetChainTxStatsCmd returns a new instance which can be used to issue a
+// getchaintxstats JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetChainTxStatsCmd(nBlocks *int32, blockHash *string) *GetChainTxStatsCmd {
+	return &GetChainTxStatsCmd{
+		NBlocks:   nBlocks,
+		BlockHash: blockHash,
+	}
+}
+
 // GetConnectionCountCmd defines the getconnectioncount JSON-RPC command.
 type GetConnectionCountCmd struct{}
 
@@ -330,6 +451,22 @@ func NewGetConnectionCountCmd() *GetConnectionCountCmd {
 	return &GetConnectionCountCmd{}
 }
 
+// GetDeploymentInfoCmd defines the getdeploymentinfo JSON-RPC command.
+type GetDeploymentInfoCmd struct {
+	BlockHash *string
+}
+
+// NewGetDeploymentInfoCmd returns a new instance which can be used to issue a
+// getdeploymentinfo JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetDeploymentInfoCmd(blockHash *string) *GetDeploymentInfoCmd {
+	return &GetDeploymentInfoCmd{
+		BlockHash: blockHash,
+	}
+}
+
 // GetDifficultyCmd defines the getdifficulty JSON-RPC command.
 type GetDifficultyCmd struct{}
 
@@ -442,6 +579,25 @@ func NewGetPeerInfoCmd() *GetPeerInfoCmd {
 	return &GetPeerInfoCmd{}
 }
 
+// GetPrioritisedTransactionsCmd defines the getprioritisedtransactions
+// JSON-RPC command.
+type GetPrioritisedTransactionsCmd struct{}
+
+// NewGetPrioritisedTransactionsCmd returns a new instance which can be used to
+// issue a getprioritisedtransactions JSON-RPC command.
+func NewGetPrioritisedTransactionsCmd() *GetPrioritisedTransactionsCmd {
+	return &GetPrioritisedTransactionsCmd{}
+}
+
+// GetZMQNotificationsCmd defines the getzmqnotifications JSON-RPC command.
+type GetZMQNotificationsCmd struct{}
+
+// NewGetZMQNotificationsCmd returns a new instance which can be used to issue
+// a getzmqnotifications JSON-RPC command.
+func NewGetZMQNotificationsCmd() *GetZMQNotificationsCmd {
+	return &GetZMQNotificationsCmd{}
+}
+
 // GetRawMempoolCmd defines the getmempool JSON-RPC command.
 type GetRawMempoolCmd struct {
 	Verbose *bool `jsonrpcdefault:"false"`
@@ -480,10 +636,14 @@ func NewGetRawTransactionCmd(txHash string, verbose *int) *GetRawTransactionCmd
 }
 
 // GetTxOutCmd defines the gettxout JSON-RPC command.
+//
+// NOTE: IncludeMempoolSpends is a btcd extension.  When it is set, outputs
+// which are spent by transactions in the memory pool are treated as spent.
 type GetTxOutCmd struct {
-	Txid           string
-	Vout           uint32
-	IncludeMempool *bool `jsonrpcdefault:"true"`
+	Txid                 string
+	Vout                 uint32
+	IncludeMempool       *bool `jsonrpcdefault:"true"`
+	IncludeMempoolSpends *bool
 }
 
 // NewGetTxOutCmd returns a new instance which can be used to issue a gettxout
@@ -499,6 +659,19 @@ func NewGetTxOutCmd(txHash string, vout uint32, includeMempool *bool) *GetTxOutC
 	}
 }
 
+// GetTxSpendingPrevOutCmd defines the gettxspendingprevout JSON-RPC command.
+type GetTxSpendingPrevOutCmd struct {
+	Outputs []TransactionInput
+}
+
+// NewGetTxSpendingPrevOutCmd returns a new instance which can be used to issue
+// a gettxspendingprevout JSON-RPC command.
+func NewGetTxSpendingPrevOutCmd(outputs []TransactionInput) *GetTxSpendingPrevOutCmd {
+	return &GetTxSpendingPrevOutCmd{
+		Outputs: outputs,
+	}
+}
+
 // GetTxOutProofCmd defines the gettxoutproof JSON-RPC command.
 type GetTxOutProofCmd struct {
 	TxIDs     []string
@@ -518,12 +691,19 @@ func NewGetTxOutProofCmd(txIDs []string, blockHash *string) *GetTxOutProofCmd {
 }
 
 // GetTxOutSetInfoCmd defines the gettxoutsetinfo JSON-RPC command.
-type GetTxOutSetInfoCmd struct{}
+type GetTxOutSetInfoCmd struct {
+	HashType *string `jsonrpcdefault:"\"hash_serialized_3\"" jsonrpcusage:"\"hash_serialized_3|muhash|none\""`
+}
 
 // NewGetTxOutSetInfoCmd returns a new instance which can be used to issue a
 // gettxoutsetinfo JSON-RPC command.
-func NewGetTxOutSetInfoCmd() *GetTxOutSetInfoCmd {
-	return &GetTxOutSetInfoCmd{}
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetTxOutSetInfoCmd(hashType *string) *GetTxOutSetInfoCmd {
+	return &GetTxOutSetInfoCmd{
+		HashType: hashType,
+	}
 }
 
 // GetWorkCmd defines the getwork JSON-RPC command.
@@ -593,6 +773,25 @@ func NewPreciousBlockCmd(blockHash string) *PreciousBlockCmd {
 	}
 }
 
+// PrioritiseTransactionCmd defines the prioritisetransaction JSON-RPC command.
+//
+// The Dummy parameter only exists for compatibility with Bitcoin Core and must
+// be zero or null.
+type PrioritiseTransactionCmd struct {
+	Txid     string
+	Dummy    float64
+	FeeDelta int64
+}
+
+// NewPrioritiseTransactionCmd returns a new instance which can be used to
+// issue a prioritisetransaction JSON-RPC command.
+func NewPrioritiseTransactionCmd(txid string, feeDelta int64) *PrioritiseTransactionCmd {
+	return &PrioritiseTransactionCmd{
+		Txid:     txid,
+		FeeDelta: feeDelta,
+	}
+}
+
 // ReconsiderBlockCmd defines the reconsiderblock JSON-RPC command.
 type ReconsiderBlockCmd struct {
 	BlockHash string
@@ -606,6 +805,82 @@ func NewReconsiderBlockCmd(blockHash string) *ReconsiderBlockCmd {
 	}
 }
 
+// ScanObject is an output descriptor to scan the unspent transaction output set
+// for.  Range holds the first and last child index of a ranged descriptor.  It
+// is marshalled as a JSON string when it has no range and as an object with the
+// desc and range fields otherwise.
+type ScanObject struct {
+	Desc  string
+	Range *[2]uint32
+}
+
+// MarshalJSON provides a custom Marshal method for ScanObject.
+func (o ScanObject) MarshalJSON() ([]byte, error) {
+	if o.Range == nil {
+		return json.Marshal(o.Desc)
+	}
+	return json.Marshal(struct {
+		Desc  string    `json:"desc"`
+		Range [2]uint32 `json:"range"`
+	}{o.Desc, *o.Range})
+}
+
+// UnmarshalJSON provides a custom Unmarshal method for ScanObject.  This is
+// necessary because the object can either be a descriptor string or an object
+// whose range is either the last child index or the first and the last one.
+func (o *ScanObject) UnmarshalJSON(data []byte) error {
+	var desc string
+	if err := json.Unmarshal(data, &desc); err == nil {
+		*o = ScanObject{Desc: desc}
+		return nil
+	}
+
+	var obj struct {
+		Desc  string          `json:"desc"`
+		Range json.RawMessage `json:"range"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil || obj.Desc == "" {
+		str := "the scan object must be a descriptor string or an " +
+			"object with a descriptor"
+		return makeError(ErrInvalidType, str)
+	}
+	*o = ScanObject{Desc: obj.Desc}
+	if obj.Range == nil {
+		return nil
+	}
+	var end uint32
+	if err := json.Unmarshal(obj.Range, &end); err == nil {
+		o.Range = &[2]uint32{0, end}
+		return nil
+	}
+	var rng [2]uint32
+	if err := json.Unmarshal(obj.Range, &rng); err != nil {
+		str := "the range of a scan object must be an end index or " +
+			"an array of the begin and end index"
+		return makeError(ErrInvalidType, str)
+	}
+	o.Range = &rng
+	return nil
+}
+
+// ScanTxOutSetCmd defines the scantxoutset JSON-RPC command.
+type ScanTxOutSetCmd struct {
+	Action      string        `jsonrpcusage:"\"start|abort|status\""`
+	ScanObjects *[]ScanObject `jsonrpcusage:"[\"descriptor\"|{\"desc\":\"descriptor\",\"range\":[begin,end]},...]"`
+}
+
+// NewScanTxOutSetCmd returns a new instance which can be used to issue a
+// scantxoutset JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewScanTxOutSetCmd(action string, scanObjects *[]ScanObject) *ScanTxOutSetCmd {
+	return &ScanTxOutSetCmd{
+		Action:      action,
+		ScanObjects: scanObjects,
+	}
+}
+
 // SearchRawTransactionsCmd defines the searchrawtransactions JSON-RPC command.
 type SearchRawTransactionsCmd struct {
 	Address     string
@@ -716,6 +991,37 @@ func NewSubmitBlockCmd(hexBlock string, options *SubmitBlockOptions) *SubmitBloc
 	}
 }
 
+// SubmitPackageCmd defines the submitpackage JSON-RPC command.
+type SubmitPackageCmd struct {
+	RawTxs []string
+}
+
+// NewSubmitPackageCmd returns a new instance which can be used to issue a
+// submitpackage JSON-RPC command.
+func NewSubmitPackageCmd(rawTxs []string) *SubmitPackageCmd {
+	return &SubmitPackageCmd{
+		RawTxs: rawTxs,
+	}
+}
+
+// TestMempoolAcceptCmd defines the testmempoolaccept JSON-RPC command.
+type TestMempoolAcceptCmd struct {
+	RawTxs     []string
+	MaxFeeRate *float64 `jsonrpcdefault:"0.10"`
+}
+
+// NewTestMempoolAcceptCmd returns a new instance which can be used to issue a
+// testmempoolaccept JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewTestMempoolAcceptCmd(rawTxs []string, maxFeeRate *float64) *TestMempoolAcceptCmd {
+	return &TestMempoolAcceptCmd{
+		RawTxs:     rawTxs,
+		MaxFeeRate: maxFeeRate,
+	}
+}
+
 // UptimeCmd defines the uptime JSON-RPC command.
 type UptimeCmd struct{}
 
@@ -793,18 +1099,23 @@ func init() {
 	MustRegisterCmd("createrawtransaction", (*CreateRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decoderawtransaction", (*DecodeRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decodescript", (*DecodeScriptCmd)(nil), flags)
+	MustRegisterCmd("estimatesmartfee", (*EstimateSmartFeeCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
 	MustRegisterCmd("getbestblockhash", (*GetBestBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblock", (*GetBlockCmd)(nil), flags)
 	MustRegisterCmd("getblockchaininfo", (*GetBlockChainInfoCmd)(nil), flags)
+	MustRegisterCmd("getblockfrompeer", (*GetBlockFromPeerCmd)(nil), flags)
 	MustRegisterCmd("getblockcount", (*GetBlockCountCmd)(nil), flags)
 	MustRegisterCmd("getblockhash", (*GetBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblockheader", (*GetBlockHeaderCmd)(nil), flags)
+	MustRegisterCmd("getblockstats", (*GetBlockStatsCmd)(nil), flags)
 	MustRegisterCmd("getblocktemplate", (*GetBlockTemplateCmd)(nil), flags)
 	MustRegisterCmd("getcfilter", (*GetCFilterCmd)(nil), flags)
 	MustRegisterCmd("getcfilterheader", (*GetCFilterHeaderCmd)(nil), flags)
 	MustRegisterCmd("getchaintips", (*GetChainTipsCmd)(nil), flags)
+	MustRegisterCmd("getchaintxstats", (*GetChainTxStatsCmd)(nil), flags)
 	MustRegisterCmd("getconnectioncount", (*GetConnectionCountCmd)(nil), flags)
+	MustRegisterCmd("getdeploymentinfo", (*GetDeploymentInfoCmd)(nil), flags)
 	MustRegisterCmd("getdifficulty", (*GetDifficultyCmd)(nil), flags)
 	MustRegisterCmd("getgenerate", (*GetGenerateCmd)(nil), flags)
 	MustRegisterCmd("gethashespersec", (*GetHashesPerSecCmd)(nil), flags)
@@ -816,22 +1127,29 @@ func init() {
 	MustRegisterCmd("getnettotals", (*GetNetTotalsCmd)(nil), flags)
 	MustRegisterCmd("getnetworkhashps", (*GetNetworkHashPSCmd)(nil), flags)
 	MustRegisterCmd("getpeerinfo", (*GetPeerInfoCmd)(nil), flags)
+	MustRegisterCmd("getprioritisedtransactions", (*GetPrioritisedTransactionsCmd)(nil), flags)
 	MustRegisterCmd("getrawmempool", (*GetRawMempoolCmd)(nil), flags)
 	MustRegisterCmd("getrawtransaction", (*GetRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("gettxout", (*GetTxOutCmd)(nil), flags)
 	MustRegisterCmd("gettxoutproof", (*GetTxOutProofCmd)(nil), flags)
 	MustRegisterCmd("gettxoutsetinfo", (*GetTxOutSetInfoCmd)(nil), flags)
+	MustRegisterCmd("gettxspendingprevout", (*GetTxSpendingPrevOutCmd)(nil), flags)
 	MustRegisterCmd("getwork", (*GetWorkCmd)(nil), flags)
+	MustRegisterCmd("getzmqnotifications", (*GetZMQNotificationsCmd)(nil), flags)
 	MustRegisterCmd("help", (*HelpCmd)(nil), flags)
 	MustRegisterCmd("invalidateblock", (*InvalidateBlockCmd)(nil), flags)
 	MustRegisterCmd("ping", (*PingCmd)(nil), flags)
 	MustRegisterCmd("preciousblock", (*PreciousBlockCmd)(nil), flags)
+	MustRegisterCmd("prioritisetransaction", (*PrioritiseTransactionCmd)(nil), flags)
 	MustRegisterCmd("reconsiderblock", (*ReconsiderBlockCmd)(nil), flags)
+	MustRegisterCmd("scantxoutset", (*ScanTxOutSetCmd)(nil), flags)
 	MustRegisterCmd("searchrawtransactions", (*SearchRawTransactionsCmd)(nil), flags)
 	MustRegisterCmd("sendrawtransaction", (*SendRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("setgenerate", (*SetGenerateCmd)(nil), flags)
 	MustRegisterCmd("stop", (*StopCmd)(nil), flags)
 	MustRegisterCmd("submitblock", (*SubmitBlockCmd)(nil), flags)
+	MustRegisterCmd("submitpackage", (*SubmitPackageCmd)(nil), flags)
+	MustRegisterCmd("testmempoolaccept", (*TestMempoolAcceptCmd)(nil), flags)
 	MustRegisterCmd("uptime", (*UptimeCmd)(nil), flags)
 	MustRegisterCmd("validateaddress", (*ValidateAddressCmd)(nil), flags)
 	MustRegisterCmd("verifychain", (*VerifyChainCmd)(nil), flags)
@@ -87,10 +87,28 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("decoderawtransaction", "123")
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewDecodeRawTransactionCmd("123")
+				return btcjson.NewDecodeRawTransactionCmd("123", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"decoderawtransaction","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.DecodeRawTransactionCmd{
+				HexTx:           "123",
+				IncludePrevOuts: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "decoderawtransaction optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("decoderawtransaction", "123", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewDecodeRawTransactionCmd("123",
+					btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"decoderawtransaction","params":["123",true],"id":1}`,
+			unmarshalled: &btcjson.DecodeRawTransactionCmd{
+				HexTx:           "123",
+				IncludePrevOuts: btcjson.Bool(true),
 			},
-			marshalled:   `{"jsonrpc":"1.0","method":"decoderawtransaction","params":["123"],"id":1}`,
-			unmarshalled: &btcjson.DecodeRawTransactionCmd{HexTx: "123"},
 		},
 		{
 			name: "decodescript",
@@ -103,6 +121,34 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"decodescript","params":["00"],"id":1}`,
 			unmarshalled: &btcjson.DecodeScriptCmd{HexScript: "00"},
 		},
+		{
+			name: "estimatesmartfee",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("estimatesmartfee", 6)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewEstimateSmartFeeCmd(6, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatesmartfee","params":[6],"id":1}`,
+			unmarshalled: &btcjson.EstimateSmartFeeCmd{
+				ConfTarget:   6,
+				EstimateMode: btcjson.EstimateSmartFeeModeAddr(btcjson.EstimateModeConservative),
+			},
+		},
+		{
+			name: "estimatesmartfee optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("estimatesmartfee", 6, btcjson.EstimateModeEconomical)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewEstimateSmartFeeCmd(6, btcjson.EstimateSmartFeeModeAddr(btcjson.EstimateModeEconomical))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatesmartfee","params":[6,"ECONOMICAL"],"id":1}`,
+			unmarshalled: &btcjson.EstimateSmartFeeCmd{
+				ConfTarget:   6,
+				EstimateMode: btcjson.EstimateSmartFeeModeAddr(btcjson.EstimateModeEconomical),
+			},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -199,6 +245,20 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getblockchaininfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetBlockChainInfoCmd{},
 		},
+		{
+			name: "getblockfrompeer",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockfrompeer", "123", 1)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockFromPeerCmd("123", 1)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockfrompeer","params":["123",1],"id":1}`,
+			unmarshalled: &btcjson.GetBlockFromPeerCmd{
+				BlockHash: "123",
+				PeerID:    1,
+			},
+		},
 		{
 			name: "getblockcount",
 			newCmd: func() (interface{}, error) {
@@ -235,6 +295,36 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: btcjson.Bool(true),
 			},
 		},
+		{
+			name: "getblockstats height",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockstats", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockStatsCmd(int64(123), nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockstats","params":[123],"id":1}`,
+			unmarshalled: &btcjson.GetBlockStatsCmd{
+				HashOrHeight: btcjson.HashOrHeight{Value: int64(123)},
+			},
+		},
+		{
+			name: "getblockstats hash optional stats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockstats",
+					btcjson.HashOrHeight{Value: "000a"},
+					[]string{"txs", "totalfee"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockStatsCmd("000a",
+					&[]string{"txs", "totalfee"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockstats","params":["000a",["txs","totalfee"]],"id":1}`,
+			unmarshalled: &btcjson.GetBlockStatsCmd{
+				HashOrHeight: btcjson.HashOrHeight{Value: "000a"},
+				Stats:        &[]string{"txs", "totalfee"},
+			},
+		},
 		{
 			name: "getblocktemplate",
 			newCmd: func() (interface{}, error) {
@@ -361,6 +451,32 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getchaintips","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetChainTipsCmd{},
 		},
+		{
+			name: "getchaintxstats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getchaintxstats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetChainTxStatsCmd(nil, nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getchaintxstats","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetChainTxStatsCmd{},
+		},
+		{
+			name: "getchaintxstats optional nblocks and blockhash",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getchaintxstats", 100, "000a")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetChainTxStatsCmd(btcjson.Int32(100),
+					btcjson.String("000a"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getchaintxstats","params":[100,"000a"],"id":1}`,
+			unmarshalled: &btcjson.GetChainTxStatsCmd{
+				NBlocks:   btcjson.Int32(100),
+				BlockHash: btcjson.String("000a"),
+			},
+		},
 		{
 			name: "getconnectioncount",
 			newCmd: func() (interface{}, error) {
@@ -372,6 +488,30 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getconnectioncount","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetConnectionCountCmd{},
 		},
+		{
+			name: "getdeploymentinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getdeploymentinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetDeploymentInfoCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getdeploymentinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetDeploymentInfoCmd{},
+		},
+		{
+			name: "getdeploymentinfo optional blockhash",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getdeploymentinfo", "000a")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetDeploymentInfoCmd(btcjson.String("000a"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getdeploymentinfo","params":["000a"],"id":1}`,
+			unmarshalled: &btcjson.GetDeploymentInfoCmd{
+				BlockHash: btcjson.String("000a"),
+			},
+		},
 		{
 			name: "getdifficulty",
 			newCmd: func() (interface{}, error) {
@@ -526,6 +666,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getpeerinfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetPeerInfoCmd{},
 		},
+		{
+			name: "getprioritisedtransactions",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getprioritisedtransactions")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetPrioritisedTransactionsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getprioritisedtransactions","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetPrioritisedTransactionsCmd{},
+		},
 		{
 			name: "getrawmempool",
 			newCmd: func() (interface{}, error) {
@@ -580,6 +731,24 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: btcjson.Int(1),
 			},
 		},
+		{
+			name: "gettxspendingprevout",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("gettxspendingprevout", `[{"txid":"123","vout":1}]`)
+			},
+			staticCmd: func() interface{} {
+				outputs := []btcjson.TransactionInput{
+					{Txid: "123", Vout: 1},
+				}
+				return btcjson.NewGetTxSpendingPrevOutCmd(outputs)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxspendingprevout","params":[[{"txid":"123","vout":1}]],"id":1}`,
+			unmarshalled: &btcjson.GetTxSpendingPrevOutCmd{
+				Outputs: []btcjson.TransactionInput{
+					{Txid: "123", Vout: 1},
+				},
+			},
+		},
 		{
 			name: "gettxout",
 			newCmd: func() (interface{}, error) {
@@ -610,6 +779,27 @@ func TestChainSvrCmds(t *testing.T) {
 				IncludeMempool: btcjson.Bool(true),
 			},
 		},
+		{
+			name: "gettxout mempool spends",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("gettxout", "123", 1, true, true)
+			},
+			staticCmd: func() interface{} {
+				return &btcjson.GetTxOutCmd{
+					Txid:                 "123",
+					Vout:                 1,
+					IncludeMempool:       btcjson.Bool(true),
+					IncludeMempoolSpends: btcjson.Bool(true),
+				}
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxout","params":["123",1,true,true],"id":1}`,
+			unmarshalled: &btcjson.GetTxOutCmd{
+				Txid:                 "123",
+				Vout:                 1,
+				IncludeMempool:       btcjson.Bool(true),
+				IncludeMempoolSpends: btcjson.Bool(true),
+			},
+		},
 		{
 			name: "gettxoutproof",
 			newCmd: func() (interface{}, error) {
@@ -646,10 +836,25 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("gettxoutsetinfo")
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewGetTxOutSetInfoCmd()
+				return btcjson.NewGetTxOutSetInfoCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetTxOutSetInfoCmd{
+				HashType: btcjson.String("hash_serialized_3"),
+			},
+		},
+		{
+			name: "gettxoutsetinfo optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("gettxoutsetinfo", "muhash")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetTxOutSetInfoCmd(btcjson.String("muhash"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":["muhash"],"id":1}`,
+			unmarshalled: &btcjson.GetTxOutSetInfoCmd{
+				HashType: btcjson.String("muhash"),
 			},
-			marshalled:   `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":[],"id":1}`,
-			unmarshalled: &btcjson.GetTxOutSetInfoCmd{},
 		},
 		{
 			name: "getwork",
@@ -677,6 +882,17 @@ func TestChainSvrCmds(t *testing.T) {
 				Data: btcjson.String("00112233"),
 			},
 		},
+		{
+			name: "getzmqnotifications",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getzmqnotifications")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetZMQNotificationsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getzmqnotifications","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetZMQNotificationsCmd{},
+		},
 		{
 			name: "help",
 			newCmd: func() (interface{}, error) {
@@ -740,6 +956,20 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "0123",
 			},
 		},
+		{
+			name: "prioritisetransaction",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("prioritisetransaction", "0123", 0.0, int64(-1000))
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewPrioritiseTransactionCmd("0123", -1000)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"prioritisetransaction","params":["0123",0,-1000],"id":1}`,
+			unmarshalled: &btcjson.PrioritiseTransactionCmd{
+				Txid:     "0123",
+				FeeDelta: -1000,
+			},
+		},
 		{
 			name: "reconsiderblock",
 			newCmd: func() (interface{}, error) {
@@ -753,6 +983,41 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "scantxoutset",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("scantxoutset", "status")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewScanTxOutSetCmd("status", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"scantxoutset","params":["status"],"id":1}`,
+			unmarshalled: &btcjson.ScanTxOutSetCmd{
+				Action: "status",
+			},
+		},
+		{
+			name: "scantxoutset scan objects",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("scantxoutset", "start",
+					`["raw(51)",{"desc":"pkh(xpub/0/*)","range":[5,10]}]`)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewScanTxOutSetCmd("start", &[]btcjson.ScanObject{
+					{Desc: "raw(51)"},
+					{Desc: "pkh(xpub/0/*)", Range: &[2]uint32{5, 10}},
+				})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"scantxoutset","params":["start",` +
+				`["raw(51)",{"desc":"pkh(xpub/0/*)","range":[5,10]}]],"id":1}`,
+			unmarshalled: &btcjson.ScanTxOutSetCmd{
+				Action: "start",
+				ScanObjects: &[]btcjson.ScanObject{
+					{Desc: "raw(51)"},
+					{Desc: "pkh(xpub/0/*)", Range: &[2]uint32{5, 10}},
+				},
+			},
+		},
 		{
 			name: "searchrawtransactions",
 			newCmd: func() (interface{}, error) {
@@ -992,6 +1257,48 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "submitpackage",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("submitpackage", `["1122","3344"]`)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSubmitPackageCmd([]string{"1122", "3344"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"submitpackage","params":[["1122","3344"]],"id":1}`,
+			unmarshalled: &btcjson.SubmitPackageCmd{
+				RawTxs: []string{"1122", "3344"},
+			},
+		},
+		{
+			name: "testmempoolaccept",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("testmempoolaccept", `["1122"]`)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewTestMempoolAcceptCmd([]string{"1122"}, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"testmempoolaccept","params":[["1122"]],"id":1}`,
+			unmarshalled: &btcjson.TestMempoolAcceptCmd{
+				RawTxs:     []string{"1122"},
+				MaxFeeRate: btcjson.Float64(0.10),
+			},
+		},
+		{
+			name: "testmempoolaccept optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("testmempoolaccept", `["1122"]`, 0.5)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewTestMempoolAcceptCmd([]string{"1122"},
+					btcjson.Float64(0.5))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"testmempoolaccept","params":[["1122"],0.5],"id":1}`,
+			unmarshalled: &btcjson.TestMempoolAcceptCmd{
+				RawTxs:     []string{"1122"},
+				MaxFeeRate: btcjson.Float64(0.5),
+			},
+		},
 		{
 			name: "uptime",
 			newCmd: func() (interface{}, error) {
@@ -1185,6 +1492,18 @@ func TestChainSvrCmdErrors(t *testing.T) {
 			marshalled: `{"sizelimit":"invalid"}`,
 			err:        btcjson.Error{ErrorCode: btcjson.ErrInvalidType},
 		},
+		{
+			name:       "scan object without descriptor",
+			result:     &btcjson.ScanObject{},
+			marshalled: `{"range":10}`,
+			err:        btcjson.Error{ErrorCode: btcjson.ErrInvalidType},
+		},
+		{
+			name:       "invalid scan object range",
+			result:     &btcjson.ScanObject{},
+			marshalled: `{"desc":"raw(51)","range":"invalid"}`,
+			err:        btcjson.Error{ErrorCode: btcjson.ErrInvalidType},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -1207,3 +1526,20 @@ func TestChainSvrCmdErrors(t *testing.T) {
 		}
 	}
 }
+
+// TestScanObject ensures the range of a scan object may be given as the last
+// child index alone.
+func TestScanObject(t *testing.T) {
+	t.Parallel()
+
+	var obj btcjson.ScanObject
+	err := json.Unmarshal([]byte(`{"desc":"raw(51)","range":7}`), &obj)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if obj.Desc != "raw(51)" || obj.Range == nil ||
+		*obj.Range != [2]uint32{0, 7} {
+
+		t.Fatalf("got %+v, want range from 0 to 7", obj)
+	}
+}
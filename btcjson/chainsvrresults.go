@@ -24,6 +24,63 @@ type GetBlockHeaderVerboseResult struct {
 	NextHash      string  `json:"nextblockhash,omitempty"`
 }
 
+// GetChainTipsResult models the data returned from the getchaintips command.
+type GetChainTipsResult struct {
+	Height    int32  `json:"height"`
+	Hash      string `json:"hash"`
+	BranchLen int32  `json:"branchlen"`
+	Status    string `json:"status"`
+}
+
+// GetChainTxStatsResult models the data returned from the getchaintxstats
+// command.  The window fields other than the block count are only set when the
+// window is not empty, and TxRate only when the window spans some time.
+type GetChainTxStatsResult struct {
+	Time                   int64    `json:"time"`
+	TxCount                int64    `json:"txcount"`
+	WindowFinalBlockHash   string   `json:"window_final_block_hash"`
+	WindowFinalBlockHeight int32    `json:"window_final_block_height"`
+	WindowBlockCount       int32    `json:"window_block_count"`
+	WindowTxCount          *int64   `json:"window_tx_count,omitempty"`
+	WindowInterval         *int64   `json:"window_interval,omitempty"`
+	TxRate                 *float64 `json:"txrate,omitempty"`
+}
+
+// GetBlockStatsResult models the data returned from the getblockstats command.
+// Amounts are in satoshi and fee rates are in satoshi per virtual byte.  When
+// only some of the statistics are requested, the others are left out of the
+// reply and unmarshal to their zero values.
+type GetBlockStatsResult struct {
+	AvgFee             int64   `json:"avgfee"`
+	AvgFeeRate         int64   `json:"avgfeerate"`
+	AvgTxSize          int64   `json:"avgtxsize"`
+	BlockHash          string  `json:"blockhash"`
+	FeeRatePercentiles []int64 `json:"feerate_percentiles"`
+	Height             int64   `json:"height"`
+	Ins                int64   `json:"ins"`
+	MaxFee             int64   `json:"maxfee"`
+	MaxFeeRate         int64   `json:"maxfeerate"`
+	MaxTxSize          int64   `json:"maxtxsize"`
+	MedianFee          int64   `json:"medianfee"`
+	MedianTime         int64   `json:"mediantime"`
+	MinFee             int64   `json:"minfee"`
+	MinFeeRate         int64   `json:"minfeerate"`
+	MinTxSize          int64   `json:"mintxsize"`
+	Outs               int64   `json:"outs"`
+	SegWitTotalSize    int64   `json:"swtotal_size"`
+	SegWitTotalWeight  int64   `json:"swtotal_weight"`
+	SegWitTxs          int64   `json:"swtxs"`
+	Subsidy            int64   `json:"subsidy"`
+	Time               int64   `json:"time"`
+	TotalOut           int64   `json:"total_out"`
+	TotalSize          int64   `json:"total_size"`
+	TotalWeight        int64   `json:"total_weight"`
+	TotalFee           int64   `json:"totalfee"`
+	Txs                int64   `json:"txs"`
+	UTXOIncrease       int64   `json:"utxo_increase"`
+	UTXOSizeIncrease   int64   `json:"utxo_size_inc"`
+}
+
 // GetBlockVerboseResult models the data from the getblock command when the
 // verbose flag is set.  When the verbose flag is not set, getblock returns a
 // hex-encoded string.
@@ -63,6 +120,14 @@ type DecodeScriptResult struct {
 	P2sh      string   `json:"p2sh,omitempty"`
 }
 
+// EstimateSmartFeeResult models the data returned from the estimatesmartfee
+// command.
+type EstimateSmartFeeResult struct {
+	FeeRate *float64 `json:"feerate,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+	Blocks  int64    `json:"blocks"`
+}
+
 // GetAddedNodeInfoResultAddr models the data of the addresses portion of the
 // getaddednodeinfo command.
 type GetAddedNodeInfoResultAddr struct {
@@ -96,6 +161,8 @@ type Bip9SoftForkDescription struct {
 	StartTime2 int64  `json:"start_time"`
 	Timeout    int64  `json:"timeout"`
 	Since      int32  `json:"since"`
+
+	MinActivationHeight int32 `json:"min_activation_height"`
 }
 
 // StartTime returns the starting time of the softfork as a Unix epoch.
@@ -130,6 +197,50 @@ type UnifiedSoftForks struct {
 	SoftForks map[string]*UnifiedSoftFork `json:"softforks"`
 }
 
+// Bip9DeploymentStatistics describes the signalling for a BIP0009 deployment in
+// the current confirmation window.
+type Bip9DeploymentStatistics struct {
+	Period    uint32 `json:"period"`
+	Threshold uint32 `json:"threshold"`
+	Elapsed   uint32 `json:"elapsed"`
+	Count     uint32 `json:"count"`
+	Possible  bool   `json:"possible"`
+}
+
+// Bip9DeploymentDescription describes the parameters and the state of a
+// BIP0009 version bits deployment.  Statistics are only set while the
+// deployment is started.
+type Bip9DeploymentDescription struct {
+	Bit                 uint8                     `json:"bit"`
+	StartTime           int64                     `json:"start_time"`
+	Timeout             int64                     `json:"timeout"`
+	MinActivationHeight int32                     `json:"min_activation_height"`
+	Status              string                    `json:"status"`
+	Since               int32                     `json:"since"`
+	Statistics          *Bip9DeploymentStatistics `json:"statistics,omitempty"`
+}
+
+// DeploymentDescription describes a deployment as reported by the
+// getdeploymentinfo command.  Buried deployments, which activate at a fixed
+// height, have the type "buried" while version bits deployments have the type
+// "bip9" and also set Bip9.  Height is the activation height and is only set
+// once it is known.
+type DeploymentDescription struct {
+	Type   string                     `json:"type"`
+	Height int32                      `json:"height,omitempty"`
+	Active bool                       `json:"active"`
+	Bip9   *Bip9DeploymentDescription `json:"bip9,omitempty"`
+}
+
+// GetDeploymentInfoResult models the data returned from the getdeploymentinfo
+// command.  The deployments are described as of the block after the block with
+// the given hash and height.
+type GetDeploymentInfoResult struct {
+	Hash        string                            `json:"hash"`
+	Height      int32                             `json:"height"`
+	Deployments map[string]*DeploymentDescription `json:"deployments"`
+}
+
 // GetBlockChainInfoResult models the data returned from the getblockchaininfo
 // command.
 type GetBlockChainInfoResult struct {
@@ -228,8 +339,12 @@ type GetMempoolEntryResult struct {
 // GetMempoolInfoResult models the data returned from the getmempoolinfo
 // command.
 type GetMempoolInfoResult struct {
-	Size  int64 `json:"size"`
-	Bytes int64 `json:"bytes"`
+	Size             int64   `json:"size"`
+	Bytes            int64   `json:"bytes"`
+	MaxMempool       int64   `json:"maxmempool"`
+	MempoolMinFee    float64 `json:"mempoolminfee"`
+	MinRelayTxFee    float64 `json:"minrelaytxfee"`
+	UnbroadcastCount int64   `json:"unbroadcastcount"`
 }
 
 // NetworksResult models the networks data from the getnetworkinfo command.
@@ -300,11 +415,36 @@ type GetRawMempoolVerboseResult struct {
 	Vsize            int32    `json:"vsize"`
 	Weight           int32    `json:"weight"`
 	Fee              float64  `json:"fee"`
+	ModifiedFee      float64  `json:"modifiedfee"`
 	Time             int64    `json:"time"`
 	Height           int64    `json:"height"`
 	StartingPriority float64  `json:"startingpriority"`
 	CurrentPriority  float64  `json:"currentpriority"`
+	DescendantCount  int64    `json:"descendantcount"`
+	DescendantSize   int64    `json:"descendantsize"`
+	DescendantFees   float64  `json:"descendantfees"`
+	AncestorCount    int64    `json:"ancestorcount"`
+	AncestorSize     int64    `json:"ancestorsize"`
+	AncestorFees     float64  `json:"ancestorfees"`
 	Depends          []string `json:"depends"`
+	CorrelationID    string   `json:"correlationid,omitempty"`
+}
+
+// PrioritisedTransactionResult models the data returned for each transaction
+// from the getprioritisedtransactions command.  The fees are in satoshi and the
+// modified fee is only set when the transaction is in the memory pool.
+type PrioritisedTransactionResult struct {
+	FeeDelta    int64  `json:"fee_delta"`
+	InMempool   bool   `json:"in_mempool"`
+	ModifiedFee *int64 `json:"modified_fee,omitempty"`
+}
+
+// GetZMQNotificationsResult models the data returned for each enabled
+// notification from the getzmqnotifications command.
+type GetZMQNotificationsResult struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	HWM     int    `json:"hwm"`
 }
 
 // ScriptPubKeyResult models the scriptPubKey data of a tx script.  It is
@@ -318,12 +458,112 @@ type ScriptPubKeyResult struct {
 }
 
 // GetTxOutResult models the data from the gettxout command.
+//
+// NOTE: Unconfirmed is a btcd extension which flags outputs created by
+// transactions in the memory pool.
 type GetTxOutResult struct {
 	BestBlock     string             `json:"bestblock"`
 	Confirmations int64              `json:"confirmations"`
 	Value         float64            `json:"value"`
 	ScriptPubKey  ScriptPubKeyResult `json:"scriptPubKey"`
 	Coinbase      bool               `json:"coinbase"`
+	Unconfirmed   bool               `json:"unconfirmed,omitempty"`
+}
+
+// GetTxOutSetInfoResult models the data from the gettxoutsetinfo command.  The
+// hash of the requested type is set, and Transactions only when the unspent
+// transaction output set was read rather than the statistics maintained along
+// with it were used.
+type GetTxOutSetInfoResult struct {
+	Height         int32   `json:"height"`
+	BestBlock      string  `json:"bestblock"`
+	Transactions   int64   `json:"transactions,omitempty"`
+	TxOuts         int64   `json:"txouts"`
+	BogoSize       int64   `json:"bogosize"`
+	HashSerialized string  `json:"hash_serialized_3,omitempty"`
+	MuHash         string  `json:"muhash,omitempty"`
+	TotalAmount    float64 `json:"total_amount"`
+}
+
+// GetTxSpendingPrevOutResult models the data returned for each output from the
+// gettxspendingprevout command.
+//
+// NOTE: SpendingHeight is a btcd extension which is set when the spending
+// transaction was found in the main chain with the spent output index.
+type GetTxSpendingPrevOutResult struct {
+	Txid           string `json:"txid"`
+	Vout           uint32 `json:"vout"`
+	SpendingTxid   string `json:"spendingtxid,omitempty"`
+	SpendingHeight int32  `json:"spendingheight,omitempty"`
+}
+
+// ScanTxOutSetUnspent models an unspent transaction output found by the
+// scantxoutset command along with the descriptor it matched.
+type ScanTxOutSetUnspent struct {
+	TxID         string  `json:"txid"`
+	Vout         uint32  `json:"vout"`
+	ScriptPubKey string  `json:"scriptPubKey"`
+	Desc         string  `json:"desc"`
+	Amount       float64 `json:"amount"`
+	Coinbase     bool    `json:"coinbase"`
+	Height       int32   `json:"height"`
+}
+
+// ScanTxOutSetResult models the data returned from the scantxoutset command
+// when a scan is started.  Success is false when the scan was aborted.
+type ScanTxOutSetResult struct {
+	Success     bool                  `json:"success"`
+	TxOuts      int64                 `json:"txouts"`
+	Height      int32                 `json:"height"`
+	BestBlock   string                `json:"bestblock"`
+	Unspents    []ScanTxOutSetUnspent `json:"unspents"`
+	TotalAmount float64               `json:"total_amount"`
+}
+
+// ScanTxOutSetStatusResult models the data returned from the scantxoutset
+// command for the status of a scan in progress.
+type ScanTxOutSetStatusResult struct {
+	Progress float64 `json:"progress"`
+}
+
+// SubmitPackageTxResult models the data returned for each transaction of the
+// package from the submitpackage command.
+//
+// NOTE: Fee is only set for the transactions which were not in the memory pool
+// before the package was submitted.
+type SubmitPackageTxResult struct {
+	TxID  string   `json:"txid"`
+	VSize int64    `json:"vsize"`
+	Fee   *float64 `json:"fee,omitempty"`
+}
+
+// SubmitPackageResult models the data returned from the submitpackage command.
+// The results of the transactions are keyed by their witness hashes.
+type SubmitPackageResult struct {
+	PackageMsg string                           `json:"package_msg"`
+	TxResults  map[string]SubmitPackageTxResult `json:"tx-results"`
+}
+
+// TestMempoolAcceptFees models the fees of a transaction returned from the
+// testmempoolaccept command.
+type TestMempoolAcceptFees struct {
+	Base float64 `json:"base"`
+}
+
+// TestMempoolAcceptResult models the data returned for each transaction from
+// the testmempoolaccept command.
+//
+// NOTE: SigOpCost and Replaced are btcd extensions which are only set when the
+// transaction is allowed.
+type TestMempoolAcceptResult struct {
+	Txid         string                 `json:"txid"`
+	Wtxid        string                 `json:"wtxid"`
+	Allowed      bool                   `json:"allowed"`
+	VSize        int64                  `json:"vsize,omitempty"`
+	Fees         *TestMempoolAcceptFees `json:"fees,omitempty"`
+	SigOpCost    int64                  `json:"sigopcost,omitempty"`
+	Replaced     []string               `json:"replaced,omitempty"`
+	RejectReason string                 `json:"reject-reason,omitempty"`
 }
 
 // GetNetTotalsResult models the data returned from the getnettotals command.
@@ -571,11 +811,27 @@ type SearchRawTransactionsResult struct {
 
 // TxRawDecodeResult models the data from the decoderawtransaction command.
 type TxRawDecodeResult struct {
-	Txid     string `json:"txid"`
-	Version  int32  `json:"version"`
-	Locktime uint32 `json:"locktime"`
-	Vin      []Vin  `json:"vin"`
-	Vout     []Vout `json:"vout"`
+	Txid     string          `json:"txid"`
+	Version  int32           `json:"version"`
+	Locktime uint32          `json:"locktime"`
+	Vin      []Vin           `json:"vin"`
+	Vout     []Vout          `json:"vout"`
+	PrevOuts []PrevOutResult `json:"prevouts,omitempty"`
+	Fee      *float64        `json:"fee,omitempty"`
+}
+
+// PrevOutResult models the output referenced by a transaction input as
+// returned by the decoderawtransaction command when previous outputs are
+// requested.  The status is one of "mempool", "unspent", "spent", or
+// "missing", and the remaining details are only set when the output was found.
+type PrevOutResult struct {
+	Txid         string              `json:"txid"`
+	Vout         uint32              `json:"vout"`
+	Status       string              `json:"status"`
+	Value        float64             `json:"value,omitempty"`
+	ScriptPubKey *ScriptPubKeyResult `json:"scriptPubKey,omitempty"`
+	Height       int32               `json:"height,omitempty"`
+	Coinbase     bool                `json:"coinbase,omitempty"`
 }
 
 // ValidateAddressChainResult models the data returned by the chain server
@@ -57,6 +57,49 @@ func NewNotifyNewTransactionsCmd(verbose *bool) *NotifyNewTransactionsCmd {
 	}
 }
 
+// NotifyReplacementsCmd defines the notifyreplacements JSON-RPC command.
+type NotifyReplacementsCmd struct {
+	WatchedOnly *bool `jsonrpcdefault:"false"`
+}
+
+// NewNotifyReplacementsCmd returns a new instance which can be used to issue a
+// notifyreplacements JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewNotifyReplacementsCmd(watchedOnly *bool) *NotifyReplacementsCmd {
+	return &NotifyReplacementsCmd{
+		WatchedOnly: watchedOnly,
+	}
+}
+
+// NotifyPartitionAlertsCmd defines the notifypartitionalerts JSON-RPC command.
+type NotifyPartitionAlertsCmd struct{}
+
+// NewNotifyPartitionAlertsCmd returns a new instance which can be used to
+// issue a notifypartitionalerts JSON-RPC command.
+func NewNotifyPartitionAlertsCmd() *NotifyPartitionAlertsCmd {
+	return &NotifyPartitionAlertsCmd{}
+}
+
+// NotifyRawBlocksCmd defines the notifyrawblocks JSON-RPC command.
+type NotifyRawBlocksCmd struct {
+	Compression *string `jsonrpcdefault:"\"none\"" jsonrpcusage:"\"none|deflate\""`
+	MaxQueue    *int    `jsonrpcdefault:"8"`
+}
+
+// NewNotifyRawBlocksCmd returns a new instance which can be used to issue a
+// notifyrawblocks JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewNotifyRawBlocksCmd(compression *string, maxQueue *int) *NotifyRawBlocksCmd {
+	return &NotifyRawBlocksCmd{
+		Compression: compression,
+		MaxQueue:    maxQueue,
+	}
+}
+
 // SessionCmd defines the session JSON-RPC command.
 type SessionCmd struct{}
 
@@ -78,6 +121,35 @@ func NewStopNotifyNewTransactionsCmd() *StopNotifyNewTransactionsCmd {
 	return &StopNotifyNewTransactionsCmd{}
 }
 
+// StopNotifyReplacementsCmd defines the stopnotifyreplacements JSON-RPC
+// command.
+type StopNotifyReplacementsCmd struct{}
+
+// NewStopNotifyReplacementsCmd returns a new instance which can be used to
+// issue a stopnotifyreplacements JSON-RPC command.
+func NewStopNotifyReplacementsCmd() *StopNotifyReplacementsCmd {
+	return &StopNotifyReplacementsCmd{}
+}
+
+// StopNotifyPartitionAlertsCmd defines the stopnotifypartitionalerts JSON-RPC
+// command.
+type StopNotifyPartitionAlertsCmd struct{}
+
+// NewStopNotifyPartitionAlertsCmd returns a new instance which can be used to
+// issue a stopnotifypartitionalerts JSON-RPC command.
+func NewStopNotifyPartitionAlertsCmd() *StopNotifyPartitionAlertsCmd {
+	return &StopNotifyPartitionAlertsCmd{}
+}
+
+// StopNotifyRawBlocksCmd defines the stopnotifyrawblocks JSON-RPC command.
+type StopNotifyRawBlocksCmd struct{}
+
+// NewStopNotifyRawBlocksCmd returns a new instance which can be used to issue
+// a stopnotifyrawblocks JSON-RPC command.
+func NewStopNotifyRawBlocksCmd() *StopNotifyRawBlocksCmd {
+	return &StopNotifyRawBlocksCmd{}
+}
+
 // NotifyReceivedCmd defines the notifyreceived JSON-RPC command.
 //
 // NOTE: Deprecated. Use LoadTxFilterCmd instead.
@@ -229,13 +301,19 @@ func init() {
 	MustRegisterCmd("loadtxfilter", (*LoadTxFilterCmd)(nil), flags)
 	MustRegisterCmd("notifyblocks", (*NotifyBlocksCmd)(nil), flags)
 	MustRegisterCmd("notifynewtransactions", (*NotifyNewTransactionsCmd)(nil), flags)
+	MustRegisterCmd("notifypartitionalerts", (*NotifyPartitionAlertsCmd)(nil), flags)
+	MustRegisterCmd("notifyrawblocks", (*NotifyRawBlocksCmd)(nil), flags)
 	MustRegisterCmd("notifyreceived", (*NotifyReceivedCmd)(nil), flags)
+	MustRegisterCmd("notifyreplacements", (*NotifyReplacementsCmd)(nil), flags)
 	MustRegisterCmd("notifyspent", (*NotifySpentCmd)(nil), flags)
 	MustRegisterCmd("session", (*SessionCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyblocks", (*StopNotifyBlocksCmd)(nil), flags)
 	MustRegisterCmd("stopnotifynewtransactions", (*StopNotifyNewTransactionsCmd)(nil), flags)
+	MustRegisterCmd("stopnotifypartitionalerts", (*StopNotifyPartitionAlertsCmd)(nil), flags)
+	MustRegisterCmd("stopnotifyrawblocks", (*StopNotifyRawBlocksCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyspent", (*StopNotifySpentCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyreceived", (*StopNotifyReceivedCmd)(nil), flags)
+	MustRegisterCmd("stopnotifyreplacements", (*StopNotifyReplacementsCmd)(nil), flags)
 	MustRegisterCmd("rescan", (*RescanCmd)(nil), flags)
 	MustRegisterCmd("rescanblocks", (*RescanBlocksCmd)(nil), flags)
 }
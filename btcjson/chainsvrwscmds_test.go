@@ -100,6 +100,105 @@ func TestChainSvrWsCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifynewtransactions","params":[],"id":1}`,
 			unmarshalled: &btcjson.StopNotifyNewTransactionsCmd{},
 		},
+		{
+			name: "notifyreplacements",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifyreplacements")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyReplacementsCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"notifyreplacements","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyReplacementsCmd{
+				WatchedOnly: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "notifyreplacements optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifyreplacements", true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyReplacementsCmd(btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"notifyreplacements","params":[true],"id":1}`,
+			unmarshalled: &btcjson.NotifyReplacementsCmd{
+				WatchedOnly: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "stopnotifyreplacements",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifyreplacements")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyReplacementsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifyreplacements","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyReplacementsCmd{},
+		},
+		{
+			name: "notifypartitionalerts",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifypartitionalerts")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyPartitionAlertsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"notifypartitionalerts","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyPartitionAlertsCmd{},
+		},
+		{
+			name: "stopnotifypartitionalerts",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifypartitionalerts")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyPartitionAlertsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifypartitionalerts","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyPartitionAlertsCmd{},
+		},
+		{
+			name: "notifyrawblocks",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifyrawblocks")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyRawBlocksCmd(nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"notifyrawblocks","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyRawBlocksCmd{
+				Compression: btcjson.String("none"),
+				MaxQueue:    btcjson.Int(8),
+			},
+		},
+		{
+			name: "notifyrawblocks optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifyrawblocks", "deflate", 2)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyRawBlocksCmd(
+					btcjson.String("deflate"), btcjson.Int(2))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"notifyrawblocks","params":["deflate",2],"id":1}`,
+			unmarshalled: &btcjson.NotifyRawBlocksCmd{
+				Compression: btcjson.String("deflate"),
+				MaxQueue:    btcjson.Int(2),
+			},
+		},
+		{
+			name: "stopnotifyrawblocks",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifyrawblocks")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyRawBlocksCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifyrawblocks","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyRawBlocksCmd{},
+		},
 		{
 			name: "notifyreceived",
 			newCmd: func() (interface{}, error) {
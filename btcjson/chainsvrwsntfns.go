@@ -75,6 +75,32 @@ const (
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantTxAcceptedNtfnMethod = "relevanttxaccepted"
+
+	// TxReplacedNtfnMethod is the method used for notifications from the
+	// chain server that transactions in the mempool were replaced by a
+	// transaction which pays a higher fee.
+	TxReplacedNtfnMethod = "txreplaced"
+
+	// PartitionAlertNtfnMethod is the method used for notifications from
+	// the chain server that it detected or stopped detecting conditions
+	// which suggest it is partitioned from the rest of the network.
+	PartitionAlertNtfnMethod = "partitionalert"
+
+	// RawBlockConnectedNtfnMethod is the method used for notifications
+	// from the chain server that a block has been connected, carrying the
+	// serialized block.
+	RawBlockConnectedNtfnMethod = "rawblockconnected"
+)
+
+// Compression schemes of the serialized blocks sent with rawblockconnected
+// notifications.
+const (
+	// RawBlockCompressionNone sends the serialized blocks as is.
+	RawBlockCompressionNone = "none"
+
+	// RawBlockCompressionDeflate compresses the serialized blocks with the
+	// DEFLATE format of RFC 1951.
+	RawBlockCompressionDeflate = "deflate"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
@@ -285,6 +311,91 @@ func NewRelevantTxAcceptedNtfn(txHex string) *RelevantTxAcceptedNtfn {
 	return &RelevantTxAcceptedNtfn{Transaction: txHex}
 }
 
+// ReplacementTx models a transaction of a mempool replacement.
+type ReplacementTx struct {
+	TxID    string  `json:"txid"`
+	Hex     string  `json:"hex"`
+	VSize   int64   `json:"vsize"`
+	Fee     float64 `json:"fee"`
+	FeeRate float64 `json:"feerate"`
+}
+
+// TxReplacement models the replacement of transactions in the mempool which is
+// sent with the txreplaced notification.  The fees are in BTC and the fee rates
+// in BTC/kvB.  The watched addresses and outpoints are the ones watched by the
+// client which are paid or spent by the replaced or replacing transactions.
+type TxReplacement struct {
+	Replacement      ReplacementTx   `json:"replacement"`
+	Replaced         []ReplacementTx `json:"replaced"`
+	FeeDelta         float64         `json:"feedelta"`
+	FeeRateDelta     float64         `json:"feeratedelta"`
+	WatchedAddresses []string        `json:"watchedaddresses"`
+	WatchedOutPoints []OutPoint      `json:"watchedoutpoints"`
+}
+
+// TxReplacedNtfn defines the txreplaced JSON-RPC notification.
+type TxReplacedNtfn struct {
+	Replacement TxReplacement
+}
+
+// NewTxReplacedNtfn returns a new instance which can be used to issue a
+// txreplaced JSON-RPC notification.
+func NewTxReplacedNtfn(replacement TxReplacement) *TxReplacedNtfn {
+	return &TxReplacedNtfn{
+		Replacement: replacement,
+	}
+}
+
+// PartitionAlert models an alert about a condition which suggests the chain
+// server is partitioned from the rest of the network or eclipsed by its peers.
+// It is sent with the partitionalert notification.  The kind identifies the
+// condition, and an alert with the resolved flag set is sent once a condition
+// which was alerted on no longer holds.
+type PartitionAlert struct {
+	Kind        string `json:"kind"`
+	Severity    string `json:"severity"`
+	Time        int64  `json:"time"`
+	Detail      string `json:"detail"`
+	Remediation string `json:"remediation,omitempty"`
+	Resolved    bool   `json:"resolved"`
+}
+
+// PartitionAlertNtfn defines the partitionalert JSON-RPC notification.
+type PartitionAlertNtfn struct {
+	Alert PartitionAlert
+}
+
+// NewPartitionAlertNtfn returns a new instance which can be used to issue a
+// partitionalert JSON-RPC notification.
+func NewPartitionAlertNtfn(alert PartitionAlert) *PartitionAlertNtfn {
+	return &PartitionAlertNtfn{
+		Alert: alert,
+	}
+}
+
+// RawBlockConnectedNtfn defines the rawblockconnected JSON-RPC notification.
+// The block is the hex-encoded serialized block including its witness data,
+// compressed with the named compression scheme.
+type RawBlockConnectedNtfn struct {
+	Hash        string
+	Height      int32
+	Compression string
+	Block       string
+}
+
+// NewRawBlockConnectedNtfn returns a new instance which can be used to issue a
+// rawblockconnected JSON-RPC notification.
+func NewRawBlockConnectedNtfn(hash string, height int32, compression string,
+	block string) *RawBlockConnectedNtfn {
+
+	return &RawBlockConnectedNtfn{
+		Hash:        hash,
+		Height:      height,
+		Compression: compression,
+		Block:       block,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -301,4 +412,7 @@ func init() {
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(TxReplacedNtfnMethod, (*TxReplacedNtfn)(nil), flags)
+	MustRegisterCmd(PartitionAlertNtfnMethod, (*PartitionAlertNtfn)(nil), flags)
+	MustRegisterCmd(RawBlockConnectedNtfnMethod, (*RawBlockConnectedNtfn)(nil), flags)
 }
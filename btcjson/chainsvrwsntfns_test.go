@@ -225,6 +225,105 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Transaction: "001122",
 			},
 		},
+		{
+			name: "txreplaced",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("txreplaced", `{"replacement":{"txid":"456","hex":"002233","vsize":110,"fee":0.0002,"feerate":0.00181818},"replaced":[{"txid":"123","hex":"001122","vsize":100,"fee":0.0001,"feerate":0.001}],"feedelta":0.0001,"feeratedelta":0.00081818,"watchedaddresses":["1Address"],"watchedoutpoints":[{"hash":"789","index":1}]}`)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewTxReplacedNtfn(btcjson.TxReplacement{
+					Replacement: btcjson.ReplacementTx{
+						TxID:    "456",
+						Hex:     "002233",
+						VSize:   110,
+						Fee:     0.0002,
+						FeeRate: 0.00181818,
+					},
+					Replaced: []btcjson.ReplacementTx{{
+						TxID:    "123",
+						Hex:     "001122",
+						VSize:   100,
+						Fee:     0.0001,
+						FeeRate: 0.001,
+					}},
+					FeeDelta:         0.0001,
+					FeeRateDelta:     0.00081818,
+					WatchedAddresses: []string{"1Address"},
+					WatchedOutPoints: []btcjson.OutPoint{{
+						Hash:  "789",
+						Index: 1,
+					}},
+				})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"txreplaced","params":[{"replacement":{"txid":"456","hex":"002233","vsize":110,"fee":0.0002,"feerate":0.00181818},"replaced":[{"txid":"123","hex":"001122","vsize":100,"fee":0.0001,"feerate":0.001}],"feedelta":0.0001,"feeratedelta":0.00081818,"watchedaddresses":["1Address"],"watchedoutpoints":[{"hash":"789","index":1}]}],"id":null}`,
+			unmarshalled: &btcjson.TxReplacedNtfn{
+				Replacement: btcjson.TxReplacement{
+					Replacement: btcjson.ReplacementTx{
+						TxID:    "456",
+						Hex:     "002233",
+						VSize:   110,
+						Fee:     0.0002,
+						FeeRate: 0.00181818,
+					},
+					Replaced: []btcjson.ReplacementTx{{
+						TxID:    "123",
+						Hex:     "001122",
+						VSize:   100,
+						Fee:     0.0001,
+						FeeRate: 0.001,
+					}},
+					FeeDelta:         0.0001,
+					FeeRateDelta:     0.00081818,
+					WatchedAddresses: []string{"1Address"},
+					WatchedOutPoints: []btcjson.OutPoint{{
+						Hash:  "789",
+						Index: 1,
+					}},
+				},
+			},
+		},
+		{
+			name: "partitionalert",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("partitionalert", `{"kind":"stale-tip","severity":"critical","time":1600000000,"detail":"no block for 3h0m0s","remediation":"connect to trusted peers","resolved":false}`)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewPartitionAlertNtfn(btcjson.PartitionAlert{
+					Kind:        "stale-tip",
+					Severity:    "critical",
+					Time:        1600000000,
+					Detail:      "no block for 3h0m0s",
+					Remediation: "connect to trusted peers",
+				})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"partitionalert","params":[{"kind":"stale-tip","severity":"critical","time":1600000000,"detail":"no block for 3h0m0s","remediation":"connect to trusted peers","resolved":false}],"id":null}`,
+			unmarshalled: &btcjson.PartitionAlertNtfn{
+				Alert: btcjson.PartitionAlert{
+					Kind:        "stale-tip",
+					Severity:    "critical",
+					Time:        1600000000,
+					Detail:      "no block for 3h0m0s",
+					Remediation: "connect to trusted peers",
+				},
+			},
+		},
+		{
+			name: "rawblockconnected",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("rawblockconnected", "123", 100000, "none", "0100")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewRawBlockConnectedNtfn("123", 100000,
+					"none", "0100")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"rawblockconnected","params":["123",100000,"none","0100"],"id":null}`,
+			unmarshalled: &btcjson.RawBlockConnectedNtfn{
+				Hash:        "123",
+				Height:      100000,
+				Compression: "none",
+				Block:       "0100",
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -101,6 +101,18 @@ func TestHelpers(t *testing.T) {
 				return &val
 			}(),
 		},
+		{
+			name: "estimatesmartfeemode",
+			f: func() interface{} {
+				return btcjson.EstimateSmartFeeModeAddr(
+					btcjson.EstimateModeEconomical,
+				)
+			},
+			expected: func() interface{} {
+				val := btcjson.EstimateModeEconomical
+				return &val
+			}(),
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
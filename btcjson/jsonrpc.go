@@ -5,6 +5,9 @@
 package btcjson
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 )
@@ -66,11 +69,68 @@ func IsValidIDType(id interface{}) bool {
 // statically typed command infrastructure which handles creation of these
 // requests, however this struct it being exported in case the caller wants to
 // construct raw requests for some reason.
+//
+// The optional CorrelationID field is a btcd extension which allows the caller
+// to supply an identifier that is attached to the log entries of all
+// subsystems involved in servicing the request.
+//
+// The optional Authorization field is a btcd extension which carries the
+// signatures of the admin keys authorizing a destructive request when the
+// server requires threshold authorization for it.
 type Request struct {
-	Jsonrpc string            `json:"jsonrpc"`
-	Method  string            `json:"method"`
-	Params  []json.RawMessage `json:"params"`
-	ID      interface{}       `json:"id"`
+	Jsonrpc       string                `json:"jsonrpc"`
+	Method        string                `json:"method"`
+	Params        []json.RawMessage     `json:"params"`
+	ID            interface{}           `json:"id"`
+	CorrelationID string                `json:"correlationid,omitempty"`
+	Authorization *RequestAuthorization `json:"authorization,omitempty"`
+}
+
+// RequestAuthorization is the signed envelope which authorizes a request.  The
+// signatures are hex-encoded DER ECDSA signatures of the hash returned by
+// RequestAuthorizationHash for the method and parameters of the request along
+// with the expiration time and nonce of the envelope.
+type RequestAuthorization struct {
+	Expires    int64    `json:"expires"`
+	Nonce      uint64   `json:"nonce"`
+	Signatures []string `json:"signatures"`
+}
+
+// requestAuthorizationTag is prefixed to the data committed to by the hash of
+// a request authorization so the signatures can't be confused with signatures
+// made for other purposes.
+const requestAuthorizationTag = "btcd request authorization"
+
+// RequestAuthorizationHash returns the hash which is signed to authorize the
+// request with the passed method and parameters until the passed expiration
+// time, given as a unix timestamp.  The nonce allows authorizing the same
+// request more than once.  The parameters are committed to exactly as they are
+// serialized in the request.
+func RequestAuthorizationHash(method string, params []json.RawMessage,
+	expires int64, nonce uint64) [sha256.Size]byte {
+
+	var buf bytes.Buffer
+	var scratch [8]byte
+	writeBytes := func(b []byte) {
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(len(b)))
+		buf.Write(scratch[:4])
+		buf.Write(b)
+	}
+
+	writeBytes([]byte(requestAuthorizationTag))
+	writeBytes([]byte(method))
+	binary.LittleEndian.PutUint32(scratch[:4], uint32(len(params)))
+	buf.Write(scratch[:4])
+	for _, param := range params {
+		writeBytes(param)
+	}
+	binary.LittleEndian.PutUint64(scratch[:], uint64(expires))
+	buf.Write(scratch[:])
+	binary.LittleEndian.PutUint64(scratch[:], nonce)
+	buf.Write(scratch[:])
+
+	first := sha256.Sum256(buf.Bytes())
+	return sha256.Sum256(first[:])
 }
 
 // NewRequest returns a new JSON-RPC 1.0 request object given the provided id,
@@ -58,6 +58,24 @@ type Checkpoint struct {
 	Hash   *chainhash.Hash
 }
 
+// AssumeUtxo identifies a known good snapshot of the unspent transaction output
+// set as of a block of the main chain.  A node can load such a snapshot to
+// start syncing from the block right away while the blocks before it are
+// validated in the background.
+type AssumeUtxo struct {
+	// Height and Hash identify the block the snapshot is the one as of.
+	Height int32
+	Hash   *chainhash.Hash
+
+	// MuHash is the MuHash3072 digest of the unspent transaction output
+	// set, which matches the muhash Bitcoin Core reports for it.
+	MuHash *chainhash.Hash
+
+	// ChainTxCount is the total number of transactions in the chain up to
+	// and including the block.
+	ChainTxCount uint64
+}
+
 // DNSSeed identifies a DNS seed.
 type DNSSeed struct {
 	// Host defines the hostname of the seed.
@@ -70,6 +88,11 @@ type DNSSeed struct {
 
 // ConsensusDeployment defines details related to a specific consensus rule
 // change that is voted in.  This is part of BIP0009.
+//
+// A speedy trial deployment, such as the one used for taproot, is described
+// by a short window between StartTime and ExpireTime, a MinActivationHeight
+// which delays the activation of the rules after they are locked in, and
+// optionally an ActivationThreshold which differs from the one of the network.
 type ConsensusDeployment struct {
 	// BitNumber defines the specific bit number within the block version
 	// this particular soft-fork deployment refers to.
@@ -82,6 +105,18 @@ type ConsensusDeployment struct {
 	// ExpireTime is the median block time after which the attempted
 	// deployment expires.
 	ExpireTime uint64
+
+	// MinActivationHeight is the height of the first block for which the
+	// rules of the deployment may become active.  A deployment which is
+	// locked in stays locked in until the confirmation window which starts
+	// at or after this height.  Zero means the rules become active in the
+	// window after the deployment is locked in.
+	MinActivationHeight uint32
+
+	// ActivationThreshold is the number of blocks in a confirmation window
+	// which must signal for the deployment for it to be locked in.  Zero
+	// means the RuleChangeActivationThreshold of the network is used.
+	ActivationThreshold uint32
 }
 
 // Constants that define the deployment offset in the deployments field of the
@@ -210,6 +245,11 @@ type Params struct {
 	// 检查点从最旧到最新的顺序.
 	Checkpoints []Checkpoint
 
+	// AssumeUtxo lists the unspent transaction output set snapshots which
+	// may be loaded in place of validating the chain up to their blocks
+	// before syncing the rest of it.
+	AssumeUtxo []AssumeUtxo
+
 	// These fields are related to voting on consensus rule changes as
 	// defined by BIP0009.
 	//
@@ -0,0 +1,88 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// checkpointFileMtx serializes appending checkpoints to the checkpoint file.
+var checkpointFileMtx sync.Mutex
+
+// loadCheckpointFile returns the checkpoints listed in the passed file.  The
+// file holds one checkpoint per line in the '<height>:<hash>' format.  Blank
+// lines and lines starting with '#' are ignored.  A file which does not exist
+// holds no checkpoints.
+func loadCheckpointFile(path string) ([]chaincfg.Checkpoint, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var checkpoints []chaincfg.Checkpoint
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		checkpoint, err := newCheckpointFromStr(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNum, err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+// appendCheckpointFile appends the passed checkpoint to the passed checkpoint
+// file, creating it when it does not exist.  Checkpoints later in the file
+// replace earlier ones at the same height when it is loaded.
+//
+// This function is safe for concurrent access.
+func appendCheckpointFile(path string, checkpoint chaincfg.Checkpoint) error {
+	checkpointFileMtx.Lock()
+	defer checkpointFileMtx.Unlock()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%d:%s\n", checkpoint.Height, checkpoint.Hash)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// addFileCheckpoints adds the passed checkpoints loaded from the checkpoint
+// file to the passed chain.  Unlike the checkpoints passed via the
+// configuration, they are validated against the blocks already in the main
+// chain, so a checkpoint which conflicts with them is rejected when the
+// checkpoints are enforced.
+func addFileCheckpoints(chain *blockchain.BlockChain, path string,
+	checkpoints []chaincfg.Checkpoint) error {
+
+	for _, checkpoint := range checkpoints {
+		if err := chain.AddCheckpoint(checkpoint); err != nil {
+			return fmt.Errorf("checkpoint file %s: %v", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestCheckpointFile ensures checkpoints appended to a checkpoint file are
+// loaded from it along with the ones written by hand and that malformed files
+// are rejected.
+func TestCheckpointFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpointfile")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoints.txt")
+
+	// A missing file holds no checkpoints.
+	checkpoints, err := loadCheckpointFile(path)
+	if err != nil || len(checkpoints) != 0 {
+		t.Fatalf("loadCheckpointFile: got %v, %v for missing file",
+			checkpoints, err)
+	}
+
+	hash1 := chainhash.Hash{0x01}
+	hash2 := chainhash.Hash{0x02}
+	contents := "# Local checkpoints\n\n  100:" + hash1.String() + "  \n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("unable to write checkpoint file: %v", err)
+	}
+	err = appendCheckpointFile(path, chaincfg.Checkpoint{
+		Height: 200,
+		Hash:   &hash2,
+	})
+	if err != nil {
+		t.Fatalf("appendCheckpointFile: %v", err)
+	}
+	checkpoints, err = loadCheckpointFile(path)
+	if err != nil {
+		t.Fatalf("loadCheckpointFile: %v", err)
+	}
+	want := []chaincfg.Checkpoint{
+		{Height: 100, Hash: &hash1},
+		{Height: 200, Hash: &hash2},
+	}
+	if !reflect.DeepEqual(checkpoints, want) {
+		t.Fatalf("loadCheckpointFile: got %v, want %v", checkpoints,
+			want)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("100\n"), 0644); err != nil {
+		t.Fatalf("unable to write checkpoint file: %v", err)
+	}
+	if _, err := loadCheckpointFile(path); err == nil {
+		t.Fatal("loadCheckpointFile: malformed file was not rejected")
+	}
+}
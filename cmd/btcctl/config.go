@@ -97,6 +97,7 @@ type config struct {
 	ConfigFile    string `short:"C" long:"configfile" description:"Path to configuration file"`
 	RPCUser       string `short:"u" long:"rpcuser" description:"RPC username"`
 	RPCPassword   string `short:"P" long:"rpcpass" default-mask:"-" description:"RPC password"`
+	RPCCookieFile string `long:"rpccookiefile" description:"File containing the RPC authentication cookie of btcd, which is used when no RPC username and password are specified (default: the cookie in the btcd data directory of the network)"`
 	RPCServer     string `short:"s" long:"rpcserver" description:"RPC server to connect to"`
 	RPCCert       string `short:"c" long:"rpccert" description:"RPC server certificate chain for validation"`
 	NoTLS         bool   `long:"notls" description:"Disable TLS"`
@@ -271,6 +272,30 @@ func loadConfig() (*config, []string, error) {
 	// Handle environment variable expansion in the RPC certificate path.
 	cfg.RPCCert = cleanAndExpandPath(cfg.RPCCert)
 
+	// Authenticate with the cookie btcd writes to its data directory when
+	// no credentials are specified.  A missing cookie is only an error
+	// when its file was specified, since the credentials may also be
+	// unnecessary.
+	if !cfg.Wallet && cfg.RPCUser == "" && cfg.RPCPassword == "" {
+		cookieFile := cfg.RPCCookieFile
+		if cookieFile == "" {
+			cookieFile = defaultRPCCookieFile(cfg.TestNet3, cfg.SimNet)
+		} else {
+			cookieFile = cleanAndExpandPath(cookieFile)
+		}
+		user, pass, err := readRPCCookie(cookieFile)
+		switch {
+		case err == nil:
+			cfg.RPCUser, cfg.RPCPassword = user, pass
+
+		case cfg.RPCCookieFile != "" || !os.IsNotExist(err):
+			err := fmt.Errorf("%s: unable to read the RPC "+
+				"authentication cookie: %v", "loadConfig", err)
+			fmt.Fprintln(os.Stderr, err)
+			return nil, nil, err
+		}
+	}
+
 	// Add default port to RPC server based on --testnet and --wallet flags
 	// if needed.
 	cfg.RPCServer = normalizeAddress(cfg.RPCServer, cfg.TestNet3,
@@ -279,6 +304,33 @@ func loadConfig() (*config, []string, error) {
 	return &cfg, remainingArgs, nil
 }
 
+// defaultRPCCookieFile returns the path of the RPC authentication cookie btcd
+// writes to its default data directory for the selected network.
+func defaultRPCCookieFile(useTestNet3, useSimNet bool) string {
+	netName := "mainnet"
+	switch {
+	case useTestNet3:
+		netName = "testnet"
+	case useSimNet:
+		netName = "simnet"
+	}
+	return filepath.Join(btcdHomeDir, "data", netName, ".cookie")
+}
+
+// readRPCCookie returns the username and password of the RPC authentication
+// cookie in the passed file, which has the form user:password.
+func readRPCCookie(path string) (string, string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.SplitN(strings.TrimSpace(string(content)), ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("malformed cookie file %s", path)
+	}
+	return parts[0], parts[1], nil
+}
+
 // createDefaultConfig creates a basic config file at the given destination path.
 // For this it tries to read the config file for the RPC server (either btcd or
 // btcwallet), and extract the RPC user and password from it.
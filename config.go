@@ -8,10 +8,12 @@ import (
 	"bufio"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -21,12 +23,14 @@ import (
 	"time"
 
 	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/connmgr"
 	"github.com/btcsuite/btcd/database"
 	_ "github.com/btcsuite/btcd/database/ffldb"
 	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/peer"
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/go-socks/socks"
@@ -41,12 +45,19 @@ const (
 	defaultLogFilename           = "btcd.log"
 	defaultMaxPeers              = 125
 	defaultBanDuration           = time.Hour * 24
+	defaultAddrStore             = "file"
 	defaultBanThreshold          = 100
+	defaultRateLimitBanScore     = 10
+	defaultMaxPeerValidationCost = 500000
 	defaultConnectTimeout        = time.Second * 30
 	defaultMaxRPCClients         = 10
 	defaultMaxRPCWebsockets      = 25
 	defaultMaxRPCConcurrentReqs  = 20
+	defaultRPCBatchParallelism   = 1
+	defaultZMQHWM                = 1000
 	defaultDbType                = "ffldb"
+	defaultDbBlockFileSize       = 512
+	dbBlockFileSizeMax           = 4095
 	defaultFreeTxRelayLimit      = 15.0
 	defaultTrickleInterval       = peer.DefaultTrickleInterval
 	defaultBlockMinSize          = 0
@@ -57,10 +68,29 @@ const (
 	blockMaxSizeMax              = blockchain.MaxBlockBaseSize - 1000
 	blockMaxWeightMin            = 4000
 	blockMaxWeightMax            = blockchain.MaxBlockWeight - 4000
+	defaultBlockReservedWeight   = 8000
+	defaultBlockReservedSigOps   = 400
 	defaultGenerate              = false
+	defaultStratumPort           = "3333"
+	defaultStratumDifficulty     = 1024
+	defaultStratumShareInterval  = time.Second * 10
+	defaultMaxStratumClients     = 100
+	defaultSV2Port               = "8442"
+	defaultSV2Interval           = time.Second * 30
+	defaultSV2FeeDelta           = 1000
+	defaultMaxSV2Clients         = 10
 	defaultMaxOrphanTransactions = 100
-	defaultMaxOrphanTxSize       = 100000
+	defaultMaxOrphanTxWeight     = 400000
+	defaultMaxOrphanWeight       = blockchain.MaxBlockWeight
+	defaultOrphanTxExpiry        = mempool.DefaultOrphanTTL
+	defaultMempoolExpiry         = mempool.DefaultExpiry
+	defaultMaxOrphanBlocks       = blockchain.DefaultMaxOrphanBlocks
+	defaultMaxOrphanBlockMem     = blockchain.DefaultMaxOrphanBlockBytes / (1024 * 1024)
+	defaultOrphanBlockExpiry     = blockchain.DefaultOrphanBlockExpiry
+	defaultScriptSchedule        = "pool"
+	defaultScriptNUMANode        = -1
 	defaultSigCacheMaxSize       = 100000
+	defaultUtxoCacheMaxSize      = 250
 	sampleConfigFilename         = "sample-btcd.conf"
 	defaultTxIndex               = false
 	defaultAddrIndex             = false
@@ -106,21 +136,47 @@ type config struct {
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
 	Whitelists           []string      `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
+	RateLimits           []string      `long:"ratelimit" description:"Limit the number of messages of a command a peer may send per minute in the form <command>:<count>, overriding the default limit for the command.  Messages beyond the limit are dropped and increase the ban score of the peer.  A count of 0 disables the limit (eg. getaddr:3)"`
+	ASMap                string        `long:"asmap" description:"Group peer addresses by the autonomous system which announces them using the asmap file at the specified path rather than by their /16 (IPv4) or /32 (IPv6) prefix"`
+	AddrStore            string        `long:"addrstore" description:"Storage backend the known peer addresses are persisted to {file, leveldb}.  The leveldb backend writes the changed addresses incrementally, which is faster for large address tables, and imports the addresses of the peers file on first use"`
+	AddrScoreSuccess     float64       `long:"addrscoresuccess" description:"Weight of a successful connection within the last week when selecting the addresses of outbound peers.  The selection is biased toward addresses with a higher total weight.  A value of 0 disables the weight"`
+	AddrScoreLatency     float64       `long:"addrscorelatency" description:"Weight of a low connection latency, as measured by the version handshake, when selecting the addresses of outbound peers.  A value of 0 disables the weight"`
+	AddrScoreServices    float64       `long:"addrscoreservices" description:"Weight of advertising the network and witness services when selecting the addresses of outbound peers.  A value of 0 disables the weight"`
+	MaxValidationCost    uint32        `long:"maxpeervalidationcost" description:"Maximum validation cost, in units of roughly a microsecond of script validation, a peer may waste by relaying transactions which are rejected.  The cost decays by half every minute.  Each rejected transaction relayed beyond it increases the ban score of the peer.  A value of 0 disables the limit"`
+	MaxTimeAdjustment    time.Duration `long:"maxtimeadjustment" description:"Maximum amount of time in either direction the local clock is adjusted by based on the clocks of the peers.  Valid time units are {s, m, h}.  A value of 0 disables the adjustment"`
 	AgentBlacklist       []string      `long:"agentblacklist" description:"A comma separated list of user-agent substrings which will cause btcd to reject any peers whose user-agent contains any of the blacklisted substrings."`
 	AgentWhitelist       []string      `long:"agentwhitelist" description:"A comma separated list of user-agent substrings which will cause btcd to require all peers' user-agents to contain one of the whitelisted substrings. The blacklist is applied before the blacklist, and an empty whitelist will allow all agents that do not fail the blacklist."`
 	RPCUser              string        `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 	RPCPass              string        `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCLimitUser         string        `long:"rpclimituser" description:"Username for limited RPC connections"`
 	RPCLimitPass         string        `long:"rpclimitpass" default-mask:"-" description:"Password for limited RPC connections"`
+	RPCAdminKeys         []string      `long:"rpcadminkey" description:"Hex-encoded public key of an admin whose signature counts towards authorizing destructive RPCs such as stop and invalidateblock -- May be specified multiple times"`
+	RPCAdminThreshold    int           `long:"rpcadminthreshold" description:"Number of distinct admin keys which must sign destructive RPCs -- Requires --rpcadminkey (0 to disable)"`
+	RPCRoleFile          string        `long:"rpcrolefile" description:"JSON file with roles which map additional RPC credentials to the methods they may call and their rate limits -- It can be reloaded with the reloadrpcroles RPC"`
+	RPCCookie            bool          `long:"rpccookie" description:"Write an RPC authentication cookie, which local tools may read to authenticate without configured credentials"`
+	RPCCookieFile        string        `long:"rpccookiefile" description:"File to write the RPC authentication cookie to -- Implies --rpccookie (default: <datadir>/.cookie)"`
 	RPCListeners         []string      `long:"rpclisten" description:"Add an interface/port to listen for RPC connections (default port: 8334, testnet: 18334)"`
 	RPCCert              string        `long:"rpccert" description:"File containing the certificate file"`
 	RPCKey               string        `long:"rpckey" description:"File containing the certificate key"`
 	RPCMaxClients        int           `long:"rpcmaxclients" description:"Max number of RPC clients for standard connections"`
 	RPCMaxWebsockets     int           `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
 	RPCMaxConcurrentReqs int           `long:"rpcmaxconcurrentreqs" description:"Max number of concurrent RPC requests that may be processed concurrently"`
+	RPCBatchParallelism  int           `long:"rpcbatchparallelism" description:"Max number of requests of a JSON-RPC batch that are processed concurrently -- A value of 1 processes them in order"`
 	RPCQuirks            bool          `long:"rpcquirks" description:"Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
-	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
-	DisableTLS           bool          `long:"notls" description:"Disable TLS for the RPC server -- NOTE: This is only allowed if the RPC server is bound to localhost"`
+	REST                 bool          `long:"rest" description:"Accept public REST requests on the RPC listeners -- NOTE: REST requests do not require authentication"`
+	GRPCListeners        []string      `long:"grpclisten" description:"Add an interface/port to serve the gRPC interface on -- It uses the TLS certificate and credentials of the RPC server and is disabled if this option is not specified"`
+	ZMQPubHashBlock      []string      `long:"zmqpubhashblock" description:"Publish the hashes of the blocks connected to the main chain on the specified ZeroMQ address (eg. tcp://127.0.0.1:28332)"`
+	ZMQPubHashBlockHWM   int           `long:"zmqpubhashblockhwm" description:"Maximum number of hashblock messages queued for a ZeroMQ subscriber"`
+	ZMQPubHashTx         []string      `long:"zmqpubhashtx" description:"Publish the hashes of the transactions added to the mempool or included in blocks on the specified ZeroMQ address"`
+	ZMQPubHashTxHWM      int           `long:"zmqpubhashtxhwm" description:"Maximum number of hashtx messages queued for a ZeroMQ subscriber"`
+	ZMQPubRawBlock       []string      `long:"zmqpubrawblock" description:"Publish the blocks connected to the main chain on the specified ZeroMQ address"`
+	ZMQPubRawBlockHWM    int           `long:"zmqpubrawblockhwm" description:"Maximum number of rawblock messages queued for a ZeroMQ subscriber"`
+	ZMQPubRawTx          []string      `long:"zmqpubrawtx" description:"Publish the transactions added to the mempool or included in blocks on the specified ZeroMQ address"`
+	ZMQPubRawTxHWM       int           `long:"zmqpubrawtxhwm" description:"Maximum number of rawtx messages queued for a ZeroMQ subscriber"`
+	ZMQPubSequence       []string      `long:"zmqpubsequence" description:"Publish the blocks connected to and disconnected from the main chain and the transactions added to and removed from the mempool on the specified ZeroMQ address"`
+	ZMQPubSequenceHWM    int           `long:"zmqpubsequencehwm" description:"Maximum number of sequence messages queued for a ZeroMQ subscriber"`
+	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass, rpclimituser/rpclimitpass, rpcrolefile, or rpccookie is specified"`
+	DisableTLS           bool          `long:"notls" description:"Disable TLS for the RPC and gRPC servers -- NOTE: This is only allowed if they are bound to localhost"`
 	DisableDNSSeed       bool          `long:"nodnsseed" description:"Disable DNS seeding for peers"`
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
 	Proxy                string        `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
@@ -135,44 +191,126 @@ type config struct {
 	RegressionTest       bool          `long:"regtest" description:"Use the regression test network"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation test network"`
 	AddCheckpoints       []string      `long:"addcheckpoint" description:"Add a custom checkpoint.  Format: '<height>:<hash>'"`
+	CheckpointFile       string        `long:"checkpointfile" description:"File with additional checkpoints, one '<height>:<hash>' per line, which are validated against the existing chain on start up -- Checkpoints added via the addcheckpoint RPC with persist set are appended to it"`
 	DisableCheckpoints   bool          `long:"nocheckpoints" description:"Disable built-in checkpoints.  Don't do this unless you know what you're doing."`
+	CheckpointModes      []string      `long:"checkpointmode" description:"How blocks which conflict with the checkpoints are handled {enforce, advisory, disabled}.  Prefix with '<network>:' to only apply to the given network -- NOTE: This option can be specified multiple times"`
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
+	DbMmap               bool          `long:"dbmmap" description:"Memory-map the block files of the database for reading when supported by the database backend and platform"`
+	DbCompactIdle        time.Duration `long:"dbcompactidle" description:"Compact the database metadata once no data has been written to the database for this long (0 to disable).  Valid time units are {s, m, h}"`
+	DbCompactRate        uint64        `long:"dbcompactrate" description:"Maximum rate in bytes per second at which the database metadata is compacted during idle compaction (0 for no limit)"`
+	DbBlockFileSize      uint32        `long:"dbblockfilesize" description:"Maximum size in MiB of the files blocks are stored in (1-4095)"`
+	DbWriteBuffer        int           `long:"dbwritebuffer" description:"Size in KiB of the buffer block data is collected in before it is written to the block files (0 to disable)"`
+	DbPreallocate        bool          `long:"dbpreallocate" description:"Allocate the disk space of the block files up front when supported by the platform and file system"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
+	HealthListeners      []string      `long:"healthlisten" description:"Add an interface/port to serve the /healthz liveness and /readyz readiness HTTP endpoints on -- The endpoints are disabled if this option is not specified"`
+	HealthMaxTipAge      time.Duration `long:"healthmaxtipage" description:"Maximum age of the best block for /readyz to report the node as ready (0 to disable the check).  Valid time units are {s, m, h}"`
+	HealthMinPeers       int           `long:"healthminpeers" description:"Minimum number of connected peers for /readyz to report the node as ready (0 to disable the check)"`
+	NoPartitionAlerts    bool          `long:"nopartitionalerts" description:"Disable monitoring the peers and the best block for signs of a network partition or eclipse attack"`
+	PartitionWebhooks    []string      `long:"partitionwebhook" description:"Add an HTTP(S) URL to POST partition alerts to as JSON"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
+	NetLog               string        `long:"netlog" description:"Write the time, peer, direction, command, and size of every message sent to and received from peers to the specified file"`
+	LogTraceTargets      []string      `long:"logtrace" description:"Log the trace and debug messages of all subsystems which mention the specified target at the info level in the form <kind>:<value> where kind is peer, tx, or addr (eg. peer:1.2.3.4, tx:<txid>, addr:<address>)"`
+	Plugins              []string      `long:"plugin" description:"Load the Go plugin built with -buildmode=plugin at the specified path on startup -- NOTE: This option can be specified multiple times"`
+	DisablePlugins       []string      `long:"disableplugin" description:"Do not run the registered plugin with the specified name -- NOTE: This option can be specified multiple times"`
 	DebugLevel           string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
 	Upnp                 bool          `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
 	MinRelayTxFee        float64       `long:"minrelaytxfee" description:"The minimum transaction fee in BTC/kB to be considered a non-zero fee."`
+	DustRelayFee         float64       `long:"dustrelayfee" description:"The fee rate in BTC/kB used to determine whether transaction outputs are dust, which are non-standard.  Defaults to the minrelaytxfee"`
 	FreeTxRelayLimit     float64       `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 	NoRelayPriority      bool          `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
 	TrickleInterval      time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MaxOrphanWeight      int64         `long:"maxorphanweight" description:"Max total weight of the orphan transactions to keep in memory, evicting those of the peer which provided the most weight first"`
+	OrphanTxExpiry       time.Duration `long:"orphantxexpiry" description:"How long to keep orphan transactions whose parents do not arrive.  Valid time units are {s, m, h}.  Minimum 1 second"`
+	MaxMempool           int           `long:"maxmempool" description:"Keep the total size of the transactions in the mempool below this many megabytes by evicting those with the lowest fee rates, which raises the minimum fee rate for accepting transactions while it is full"`
+	NoPersistMempool     bool          `long:"nopersistmempool" description:"Do not save the mempool on shutdown and load it again on startup"`
+	MempoolExpiry        time.Duration `long:"mempoolexpiry" description:"How long to keep transactions in the mempool before evicting them along with their descendants.  Valid time units are {s, m, h}.  Minimum 1 hour"`
+	MaxStdTxWeight       int64         `long:"maxstdtxweight" description:"Max weight of a transaction for it to be considered standard"`
+	MaxTxSigOpCost       int           `long:"maxtxsigopcost" description:"Max total cost of the signature operations of a transaction for it to be relayed and mined"`
+	DataCarrierSize      int           `long:"datacarriersize" description:"Max size in bytes of a nulldata output script, which only carries data, for it to be considered standard -- Set to 0 to consider all nulldata outputs non-standard"`
+	LimitAncestorCount   int           `long:"limitancestorcount" description:"Do not accept transactions into the mempool which have more than this many unconfirmed ancestors in it, including themselves"`
+	LimitAncestorSize    int           `long:"limitancestorsize" description:"Do not accept transactions into the mempool whose unconfirmed ancestors in it, including themselves, exceed this total virtual size in kilobytes"`
+	LimitDescendantCount int           `long:"limitdescendantcount" description:"Do not accept transactions into the mempool which would give any of their unconfirmed ancestors more than this many descendants in it, including themselves"`
+	LimitDescendantSize  int           `long:"limitdescendantsize" description:"Do not accept transactions into the mempool which would make the descendants of any of their unconfirmed ancestors in it, including themselves, exceed this total virtual size in kilobytes"`
+	LimitClusterCount    int           `long:"limitclustercount" description:"Do not accept transactions into the mempool which would make the cluster of unconfirmed transactions connected to them through spends in it contain more than this many transactions, including themselves"`
+	MaxOrphanBlocks      int           `long:"maxorphanblocks" description:"Max number of orphan blocks to keep in memory"`
+	MaxOrphanBlockMem    uint          `long:"maxorphanblockmem" description:"Max total size in MiB of the orphan blocks to keep in memory"`
+	OrphanBlockExpiry    time.Duration `long:"orphanblockexpiry" description:"How long to keep orphan blocks whose parents do not arrive.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	Generate             bool          `long:"generate" description:"Generate (mine) bitcoins using the CPU"`
 	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
+	CoinbasePayouts      []string      `long:"coinbasepayout" description:"Pay a fixed percentage of the value of the coinbase of generated blocks, which is the block subsidy along with the fees, to an address in the form <address>:<percent> -- The remainder is paid to the mining address and the percentages must add up to less than 100 (eg. <address>:2.5)"`
 	BlockMinSize         uint32        `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
 	BlockMaxSize         uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
 	BlockMinWeight       uint32        `long:"blockminweight" description:"Mininum block weight to be used when creating a block"`
 	BlockMaxWeight       uint32        `long:"blockmaxweight" description:"Maximum block weight to be used when creating a block"`
-	BlockPrioritySize    uint32        `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
+	BlockPrioritySize    uint32        `long:"blockprioritysize" description:"DEPRECATED: This option has no effect since blocks are filled by fee rate"`
+	BlockMaxSigOpCost    int64         `long:"blockmaxsigopcost" description:"Maximum signature operation cost to be used when creating a block -- 0 uses the consensus limit"`
+	BlockReservedWeight  uint32        `long:"blockreservedweight" description:"Block weight reserved for the block header and the coinbase transaction when creating a block, which is not filled with transactions"`
+	BlockReservedSigOps  int64         `long:"blockreservedsigopcost" description:"Signature operation cost reserved for the coinbase transaction when creating a block, which is not filled with transactions"`
+	StratumListeners     []string      `long:"stratumlisten" description:"Add an interface/port to listen for stratum connections from miners (default port: 3333) -- Enables the stratum server, which requires at least one mining address"`
+	StratumDifficulty    float64       `long:"stratumdifficulty" description:"Initial share difficulty of stratum clients before it is adjusted to their hash rate"`
+	StratumShareInterval time.Duration `long:"stratumshareinterval" description:"Interval at which each stratum client should submit shares.  Valid time units are {s, m, h}.  Minimum 1 second"`
+	StratumMaxClients    int           `long:"stratummaxclients" description:"Max number of stratum clients"`
+	SV2Listeners         []string      `long:"sv2listen" description:"Add an interface/port to listen for Stratum V2 template distribution connections from pools and job declarators (default port: 8442) -- Enables the template provider"`
+	SV2Interval          time.Duration `long:"sv2interval" description:"Minimum interval between Stratum V2 templates which only add new transactions.  Valid time units are {s, m, h}.  Minimum 1 second"`
+	SV2FeeDelta          int64         `long:"sv2feedelta" description:"Minimum amount in satoshi by which the fees of a Stratum V2 template must exceed those of the previous template for the same block"`
+	SV2MaxClients        int           `long:"sv2maxclients" description:"Max number of Stratum V2 template provider clients"`
 	UserAgentComments    []string      `long:"uacomment" description:"Comment to add to the user agent -- See BIP 14 for more information."`
 	NoPeerBloomFilters   bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
 	NoCFilters           bool          `long:"nocfilters" description:"Disable committed filtering (CF) support"`
+	WitnessTelemetry     bool          `long:"witnesstelemetry" description:"Track the use of unknown witness versions and tap leaf versions in relayed transactions and connected blocks -- Enables the getwitnessupgradeinfo RPC"`
+	V2Transport          bool          `long:"v2transport" description:"Use the BIP0324 encrypted transport for peer connections -- Falls back to the unencrypted v1 transport for peers that do not support it"`
+	TxReconciliation     bool          `long:"txreconciliation" description:"Announce transactions to peers supporting BIP0330 through set reconciliation rather than flooding"`
+	ForkArchive          bool          `long:"forkarchive" description:"Keep an archive of recent stale fork blocks and headers which is queryable via getchaintips and getblock and enables backfilling forks from peers via getblockfrompeer"`
+	ForkArchiveSize      int           `long:"forkarchivesize" description:"Maximum number of blocks retained by the fork archive"`
+	ForkArchiveBlocks    bool          `long:"forkarchiveblocks" description:"Also download the blocks of stale forks whose headers are backfilled from peers"`
+	TemplateCompare      bool          `long:"templatecompare" description:"Compare every block connected to the main chain with the most recent block template generated on top of the same parent and persist the results -- Enables the listtemplatecomparisons RPC"`
+	AttestInterval       time.Duration `long:"attestinterval" description:"Interval at which attestations of the best block and the muhash of the UTXO set are signed with a node-local key and stored -- Enables the listattestations RPC (0 to disable)"`
 	DropCfIndex          bool          `long:"dropcfindex" description:"Deletes the index used for committed filtering (CF) support from the database on start up and then exits."`
 	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
+	ScriptWorkers        int           `long:"scriptworkers" description:"Number of goroutines which validate the scripts of blocks in parallel (0 to use 3 per CPU core)"`
+	ScriptSchedule       string        `long:"scriptschedule" description:"How the script validation goroutines are scheduled -- pool shares persistent goroutines between concurrent validations while perblock starts them for every block {pool, perblock}"`
+	ScriptCPUs           string        `long:"scriptcpus" description:"Pin the script validation goroutines to the listed CPUs in a round-robin fashion, for example 0-7,16-23 -- Requires the pool schedule and is only supported on Linux"`
+	ScriptNUMANode       int           `long:"scriptnumanode" description:"Pin the script validation goroutines to the CPUs of the specified NUMA node -- Requires the pool schedule and is only supported on Linux (-1 to disable)"`
+	UtxoCacheMaxSize     uint          `long:"utxocachemaxsize" description:"The maximum size in MiB of the UTXO cache in front of the database -- 0 writes the UTXO changes of every block to the database immediately"`
+	LoadSnapshot         string        `long:"loadsnapshot" description:"Load the UTXO set snapshot created by the dumptxoutset RPC from the specified file into a chain which only has the genesis block -- The blocks before the snapshot are validated in the background and the snapshot must be known to the active network"`
+	PruneDepth           int32         `long:"prunedepth" description:"Delete the blocks buried more than this many blocks below the best chain tip while retaining the UTXO set -- Reorganizations deeper than this are not possible (0 to disable, otherwise at least 288)"`
+	UtxoSetStats         bool          `long:"utxosetstats" description:"Maintain the statistics and the muhash of the UTXO set as blocks are connected, so the gettxoutsetinfo RPC reports them without reading the entire set"`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
 	TxIndex              bool          `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
 	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
 	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
+	UtreexoIndex         bool          `long:"utreexoindex" description:"Maintain a utreexo accumulator of the UTXO set which proves the inputs of every block and unspent outputs to stateless clients"`
+	DropUtreexoIndex     bool          `long:"droputreexoindex" description:"Deletes the utreexo index from the database on start up and then exits."`
+	UtxoScriptIndex      bool          `long:"utxoscriptindex" description:"Maintain an index of the unspent transaction outputs by the script they pay to for balance queries"`
+	DropUtxoScriptIndex  bool          `long:"droputxoscriptindex" description:"Deletes the unspent output by script index from the database on start up and then exits."`
+	SpendIndex           bool          `long:"spendindex" description:"Maintain an index of the spent outputs to the transactions which spend them, which enables the gettxspendingprevout RPC to find spends in the chain"`
+	DropSpendIndex       bool          `long:"dropspendindex" description:"Deletes the spent output index from the database on start up and then exits."`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
+	RejectBareMultisig   bool          `long:"rejectbaremultisig" description:"Consider transactions with bare multi-signature output scripts, which are not wrapped in pay-to-script-hash, non-standard."`
 	RejectReplacement    bool          `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
+	MempoolFullRBF       bool          `long:"mempoolfullrbf" description:"Accept transactions that replace existing transactions within the mempool by paying a higher fee even when the replaced transactions do not signal replacement (full RBF)."`
+	Standby              bool          `long:"standby" description:"Run as a hot standby which follows the primary specified by --standbyprimary and only begins serving RPC and P2P clients once promoted"`
+	StandbyPrimary       string        `long:"standbyprimary" description:"The P2P address of the primary instance to follow when running in standby mode"`
+	StandbyCheckInterval time.Duration `long:"standbycheckinterval" description:"How often to health check the primary when running in standby mode.  Valid time units are {s, m, h}"`
+	StandbyMaxFailures   int           `long:"standbymaxfailures" description:"Number of consecutive failed health checks of the primary before a standby promotes itself"`
 	lookup               func(string) ([]net.IP, error)
 	oniondial            func(string, string, time.Duration) (net.Conn, error)
 	dial                 func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
+	fileCheckpoints      []chaincfg.Checkpoint
+	checkpointMode       blockchain.CheckpointMode
+	scriptSchedule       blockchain.ScriptSchedule
+	scriptCPUs           []int
 	miningAddrs          []btcutil.Address
+	coinbasePayouts      []mining.CoinbasePayout
+	rpcAdminKeys         []*btcec.PublicKey
 	minRelayTxFee        btcutil.Amount
+	dustRelayFee         btcutil.Amount
 	whitelists           []*net.IPNet
+	rateLimits           map[string]peer.RateLimit
 }
 
 // serviceOptions defines the configuration options for the daemon as a service on
@@ -314,6 +452,53 @@ func normalizeAddress(addr, defaultPort string) string {
 	return addr
 }
 
+// parseRateLimit parses a rate limit in the form <command>:<count> and returns
+// the command along with a limit of count messages per minute.
+func parseRateLimit(rateLimit string) (string, peer.RateLimit, error) {
+	parts := strings.Split(rateLimit, ":")
+	if len(parts) != 2 || parts[0] == "" {
+		return "", peer.RateLimit{}, errors.New("expected " +
+			"<command>:<count>")
+	}
+	count, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return "", peer.RateLimit{}, err
+	}
+	limit := peer.RateLimit{
+		Count:    uint32(count),
+		Interval: time.Minute,
+		BanScore: defaultRateLimitBanScore,
+	}
+	return parts[0], limit, nil
+}
+
+// parseCoinbasePayout parses a coinbase payout in the form <address>:<percent>
+// for the passed network.
+func parseCoinbasePayout(payout string, params *chaincfg.Params) (mining.CoinbasePayout, error) {
+	parts := strings.Split(payout, ":")
+	if len(parts) != 2 || parts[0] == "" {
+		return mining.CoinbasePayout{}, errors.New("expected " +
+			"<address>:<percent>")
+	}
+	addr, err := btcutil.DecodeAddress(parts[0], params)
+	if err != nil {
+		return mining.CoinbasePayout{}, err
+	}
+	if !addr.IsForNet(params) {
+		return mining.CoinbasePayout{}, errors.New("address is on the " +
+			"wrong network")
+	}
+	percent, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return mining.CoinbasePayout{}, err
+	}
+	if !(percent > 0 && percent < 100) {
+		return mining.CoinbasePayout{}, errors.New("percentage must be " +
+			"greater than 0 and less than 100")
+	}
+	return mining.CoinbasePayout{Address: addr, Percent: percent}, nil
+}
+
 // normalizeAddresses returns a new slice with all the passed peer addresses
 // normalized with the given default port, and all duplicates removed.
 func normalizeAddresses(addrs []string, defaultPort string) []string {
@@ -372,6 +557,41 @@ func parseCheckpoints(checkpointStrings []string) ([]chaincfg.Checkpoint, error)
 	return checkpoints, nil
 }
 
+// parseCheckpointMode returns the checkpoint mode for the passed network from
+// the passed checkpoint mode strings in the '[<network>:]<mode>' format.  A mode
+// for the specific network takes precedence over one without a network and the
+// last one specified wins otherwise.  Checkpoints are enforced when no mode
+// applies to the network.
+func parseCheckpointMode(modeStrings []string, netName string) (blockchain.CheckpointMode, error) {
+	mode := blockchain.CheckpointEnforce
+	netSpecific := false
+	for _, modeString := range modeStrings {
+		modeNet, modeName := "", modeString
+		if i := strings.LastIndex(modeString, ":"); i != -1 {
+			modeNet, modeName = modeString[:i], modeString[i+1:]
+			switch modeNet {
+			case mainNetParams.Name, testNet3Params.Name,
+				regressionNetParams.Name, simNetParams.Name:
+			default:
+				return 0, fmt.Errorf("unknown network %q in "+
+					"checkpoint mode %q", modeNet, modeString)
+			}
+		}
+		m, err := blockchain.ParseCheckpointMode(modeName)
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case modeNet == netName:
+			mode, netSpecific = m, true
+		case modeNet == "" && !netSpecific:
+			mode = m
+		}
+	}
+	return mode, nil
+}
+
 // filesExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -414,12 +634,22 @@ func loadConfig() (*config, []string, error) {
 		MaxPeers:             defaultMaxPeers,
 		BanDuration:          defaultBanDuration,
 		BanThreshold:         defaultBanThreshold,
+		MaxValidationCost:    defaultMaxPeerValidationCost,
+		MaxTimeAdjustment:    blockchain.DefaultMaxTimeAdjustment,
+		AddrStore:            defaultAddrStore,
 		RPCMaxClients:        defaultMaxRPCClients,
 		RPCMaxWebsockets:     defaultMaxRPCWebsockets,
 		RPCMaxConcurrentReqs: defaultMaxRPCConcurrentReqs,
+		RPCBatchParallelism:  defaultRPCBatchParallelism,
+		ZMQPubHashBlockHWM:   defaultZMQHWM,
+		ZMQPubHashTxHWM:      defaultZMQHWM,
+		ZMQPubRawBlockHWM:    defaultZMQHWM,
+		ZMQPubRawTxHWM:       defaultZMQHWM,
+		ZMQPubSequenceHWM:    defaultZMQHWM,
 		DataDir:              defaultDataDir,
 		LogDir:               defaultLogDir,
 		DbType:               defaultDbType,
+		DbBlockFileSize:      defaultDbBlockFileSize,
 		RPCKey:               defaultRPCKeyFile,
 		RPCCert:              defaultRPCCertFile,
 		MinRelayTxFee:        mempool.DefaultMinRelayTxFee.ToBTC(),
@@ -430,11 +660,42 @@ func loadConfig() (*config, []string, error) {
 		BlockMinWeight:       defaultBlockMinWeight,
 		BlockMaxWeight:       defaultBlockMaxWeight,
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
+		BlockReservedWeight:  defaultBlockReservedWeight,
+		BlockReservedSigOps:  defaultBlockReservedSigOps,
+		StratumDifficulty:    defaultStratumDifficulty,
+		StratumShareInterval: defaultStratumShareInterval,
+		StratumMaxClients:    defaultMaxStratumClients,
+		SV2Interval:          defaultSV2Interval,
+		SV2FeeDelta:          defaultSV2FeeDelta,
+		SV2MaxClients:        defaultMaxSV2Clients,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
+		MaxOrphanWeight:      defaultMaxOrphanWeight,
+		OrphanTxExpiry:       defaultOrphanTxExpiry,
+		LimitAncestorCount:   mempool.DefaultMaxAncestors,
+		LimitAncestorSize:    mempool.DefaultMaxAncestorVSize / 1000,
+		LimitDescendantCount: mempool.DefaultMaxDescendants,
+		LimitDescendantSize:  mempool.DefaultMaxDescendantVSize / 1000,
+		LimitClusterCount:    mempool.DefaultMaxClusterCount,
+		MaxMempool:           mempool.DefaultMaxPoolSize / 1000000,
+		MempoolExpiry:        defaultMempoolExpiry,
+		MaxStdTxWeight:       mempool.DefaultMaxStandardTxWeight,
+		MaxTxSigOpCost:       blockchain.MaxBlockSigOpsCost / 4,
+		DataCarrierSize:      mempool.DefaultMaxDataCarrierSize,
+		MaxOrphanBlocks:      defaultMaxOrphanBlocks,
+		MaxOrphanBlockMem:    defaultMaxOrphanBlockMem,
+		OrphanBlockExpiry:    defaultOrphanBlockExpiry,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
+		ScriptSchedule:       defaultScriptSchedule,
+		ScriptNUMANode:       defaultScriptNUMANode,
+		UtxoCacheMaxSize:     defaultUtxoCacheMaxSize,
 		Generate:             defaultGenerate,
 		TxIndex:              defaultTxIndex,
 		AddrIndex:            defaultAddrIndex,
+		StandbyCheckInterval: defaultStandbyCheckInterval,
+		StandbyMaxFailures:   defaultStandbyMaxFailures,
+		ForkArchiveSize:      defaultForkArchiveSize,
+		HealthMaxTipAge:      defaultHealthMaxTipAge,
+		HealthMinPeers:       defaultHealthMinPeers,
 	}
 
 	// Service options which are only added on Windows.
@@ -581,6 +842,17 @@ func loadConfig() (*config, []string, error) {
 	}
 	cfg.RelayNonStd = relayNonStd
 
+	// The full replacement policy makes no sense when replacements are
+	// rejected altogether.
+	if cfg.RejectReplacement && cfg.MempoolFullRBF {
+		str := "%s: rejectreplacement and mempoolfullrbf cannot be " +
+			"used together -- choose only one"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Append the network type to the data directory so it is "namespaced"
 	// per network.  In addition to the block database, there are other
 	// pieces of data that are saved to disk such as address manager state.
@@ -595,6 +867,31 @@ func loadConfig() (*config, []string, error) {
 	cfg.LogDir = cleanAndExpandPath(cfg.LogDir)
 	cfg.LogDir = filepath.Join(cfg.LogDir, netName(activeNetParams))
 
+	if cfg.NetLog != "" {
+		cfg.NetLog = cleanAndExpandPath(cfg.NetLog)
+	}
+	if cfg.ASMap != "" {
+		cfg.ASMap = cleanAndExpandPath(cfg.ASMap)
+	}
+	if cfg.LoadSnapshot != "" {
+		cfg.LoadSnapshot = cleanAndExpandPath(cfg.LoadSnapshot)
+	}
+	if cfg.CheckpointFile != "" {
+		cfg.CheckpointFile = cleanAndExpandPath(cfg.CheckpointFile)
+	}
+	if cfg.RPCRoleFile != "" {
+		cfg.RPCRoleFile = cleanAndExpandPath(cfg.RPCRoleFile)
+	}
+
+	// Specifying the file of the RPC authentication cookie enables it.
+	if cfg.RPCCookieFile != "" {
+		cfg.RPCCookie = true
+		cfg.RPCCookieFile = cleanAndExpandPath(cfg.RPCCookieFile)
+	} else {
+		cfg.RPCCookieFile = filepath.Join(cfg.DataDir,
+			defaultRPCCookieFilename)
+	}
+
 	// Special show command to list supported subsystems and exit.
 	if cfg.DebugLevel == "show" {
 		fmt.Println("Supported subsystems", supportedSubsystems())
@@ -613,6 +910,18 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Parse and set the targets of the selective trace logging.
+	for _, targetStr := range cfg.LogTraceTargets {
+		target, err := parseTraceTarget(targetStr, activeNetParams.Params)
+		if err != nil {
+			err := fmt.Errorf("%s: %v", funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		logTraceTargets.Add(target)
+	}
+
 	// Validate database type.
 	if !validDbType(cfg.DbType) {
 		str := "%s: The specified database type [%v] is invalid -- " +
@@ -623,6 +932,38 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Don't allow negative idle compaction times.
+	if cfg.DbCompactIdle < 0 {
+		str := "%s: The dbcompactidle option may not be negative " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.DbCompactIdle)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the block file size to a sane range which also keeps the
+	// offsets into the files within 32 bits.
+	if cfg.DbBlockFileSize < 1 || cfg.DbBlockFileSize > dbBlockFileSizeMax {
+		str := "%s: The dbblockfilesize option must be in the range " +
+			"[1, %d] -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, dbBlockFileSizeMax,
+			cfg.DbBlockFileSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow negative write buffer sizes.
+	if cfg.DbWriteBuffer < 0 {
+		str := "%s: The dbwritebuffer option may not be negative " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.DbWriteBuffer)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Validate profile port number
 	if cfg.Profile != "" {
 		profilePort, err := strconv.Atoi(cfg.Profile)
@@ -644,6 +985,38 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the address store backend.
+	switch cfg.AddrStore {
+	case "file", "leveldb":
+	default:
+		str := "%s: The addrstore option must be either file or leveldb -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.AddrStore)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow negative address score weights.
+	if cfg.AddrScoreSuccess < 0 || cfg.AddrScoreLatency < 0 ||
+		cfg.AddrScoreServices < 0 {
+
+		str := "%s: The addrscore options may not be negative -- parsed [success %v, latency %v, services %v]"
+		err := fmt.Errorf(str, funcName, cfg.AddrScoreSuccess,
+			cfg.AddrScoreLatency, cfg.AddrScoreServices)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't allow negative time adjustments.
+	if cfg.MaxTimeAdjustment < 0 {
+		str := "%s: The maxtimeadjustment option may not be negative -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.MaxTimeAdjustment)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Validate any given whitelisted IP addresses and networks.
 	if len(cfg.Whitelists) > 0 {
 		var ip net.IP
@@ -686,6 +1059,138 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// The health endpoints have no default port, so it must be specified.
+	for _, addr := range cfg.HealthListeners {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			str := "%s: The healthlisten option must specify an " +
+				"interface/port -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, addr)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	if cfg.HealthMaxTipAge < 0 {
+		str := "%s: The healthmaxtipage option may not be negative " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.HealthMaxTipAge)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.HealthMinPeers < 0 {
+		str := "%s: The healthminpeers option may not be negative " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.HealthMinPeers)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Partition alerts are only posted to HTTP(S) URLs.
+	for _, webhook := range cfg.PartitionWebhooks {
+		u, err := url.Parse(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" {
+
+			str := "%s: The partitionwebhook option must be an " +
+				"HTTP or HTTPS URL -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, webhook)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	if cfg.NoPartitionAlerts && len(cfg.PartitionWebhooks) > 0 {
+		str := "%s: The nopartitionalerts and partitionwebhook " +
+			"options may not be activated at the same time"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --standby requires a primary to follow and does not mix with
+	// --connect since a promoted standby must be able to find new peers.
+	if cfg.Standby {
+		if cfg.StandbyPrimary == "" {
+			str := "%s: the --standby option requires a primary to " +
+				"be specified via --standbyprimary"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if len(cfg.ConnectPeers) > 0 {
+			str := "%s: the --standby and --connect options can " +
+				"not be mixed"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.StandbyCheckInterval < time.Second {
+			str := "%s: The standbycheckinterval option may not be " +
+				"less than 1s -- parsed [%v]"
+			err := fmt.Errorf(str, funcName, cfg.StandbyCheckInterval)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.StandbyMaxFailures < 1 {
+			str := "%s: The standbymaxfailures option may not be " +
+				"less than 1 -- parsed [%d]"
+			err := fmt.Errorf(str, funcName, cfg.StandbyMaxFailures)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.StandbyPrimary = normalizeAddress(cfg.StandbyPrimary,
+			activeNetParams.DefaultPort)
+	}
+
+	// Parse the per-command rate limits which override the defaults.
+	cfg.rateLimits = peer.DefaultRateLimits()
+	for _, rateLimit := range cfg.RateLimits {
+		cmd, limit, err := parseRateLimit(rateLimit)
+		if err != nil {
+			str := "%s: The ratelimit value of '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, rateLimit, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if limit.Count == 0 {
+			delete(cfg.rateLimits, cmd)
+			continue
+		}
+		if defaultLimit, ok := cfg.rateLimits[cmd]; ok {
+			limit.BanScore = defaultLimit.BanScore
+		}
+		cfg.rateLimits[cmd] = limit
+	}
+
+	// The fork archive must be able to hold at least one block.
+	if cfg.ForkArchiveSize < 1 {
+		str := "%s: The forkarchivesize option may not be less than 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.ForkArchiveSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Attestations can't be signed more often than once per second since
+	// their times are stored with second precision.
+	if cfg.AttestInterval != 0 && cfg.AttestInterval < time.Second {
+		str := "%s: The attestinterval option may not be less than 1s " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.AttestInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// --proxy or --connect without --listen disables listening.
 	if (cfg.Proxy != "" || len(cfg.ConnectPeers) > 0) &&
 		len(cfg.Listeners) == 0 {
@@ -726,9 +1231,55 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
-	// The RPC server is disabled if no username or password is provided.
+	// Parse the admin keys which authorize destructive RPCs and ensure the
+	// threshold can be met.
+	cfg.rpcAdminKeys = make([]*btcec.PublicKey, 0, len(cfg.RPCAdminKeys))
+	for _, keyHex := range cfg.RPCAdminKeys {
+		keyBytes, err := hex.DecodeString(keyHex)
+		if err == nil {
+			var key *btcec.PublicKey
+			key, err = btcec.ParsePubKey(keyBytes, btcec.S256())
+			cfg.rpcAdminKeys = append(cfg.rpcAdminKeys, key)
+		}
+		if err != nil {
+			str := "%s: admin key '%s' failed to parse: %v"
+			err := fmt.Errorf(str, funcName, keyHex, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+	if cfg.RPCAdminThreshold < 0 ||
+		cfg.RPCAdminThreshold > len(cfg.rpcAdminKeys) ||
+		(cfg.RPCAdminThreshold == 0 && len(cfg.rpcAdminKeys) != 0) {
+
+		str := "%s: the rpcadminthreshold option must be between 1 " +
+			"and the number of admin keys (%d) when admin keys are " +
+			"specified and 0 otherwise -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, len(cfg.rpcAdminKeys),
+			cfg.RPCAdminThreshold)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the roles and users of the role file are valid.
+	if cfg.RPCRoleFile != "" {
+		_, err := newRPCRoles(rpcBuiltInUsers(&cfg), cfg.RPCRoleFile)
+		if err != nil {
+			str := "%s: failed to load the RPC role file: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// The RPC server is disabled if no username or password is provided,
+	// no role file defines users, and no authentication cookie is requested.
 	if (cfg.RPCUser == "" || cfg.RPCPass == "") &&
-		(cfg.RPCLimitUser == "" || cfg.RPCLimitPass == "") {
+		(cfg.RPCLimitUser == "" || cfg.RPCLimitPass == "") &&
+		cfg.RPCRoleFile == "" && !cfg.RPCCookie {
 		cfg.DisableRPC = true
 	}
 
@@ -736,6 +1287,61 @@ func loadConfig() (*config, []string, error) {
 		btcdLog.Infof("RPC service is disabled")
 	}
 
+	// The REST interface is served on the RPC listeners.
+	if cfg.REST && cfg.DisableRPC {
+		str := "%s: The rest option requires the RPC server, which is " +
+			"disabled when norpc is set or no RPC credentials are " +
+			"specified"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The gRPC interface authenticates clients with the RPC credentials
+	// and has no default port, so it must be specified.
+	if len(cfg.GRPCListeners) > 0 && cfg.DisableRPC {
+		str := "%s: The grpclisten option requires the RPC server, " +
+			"which is disabled when norpc is set or no RPC " +
+			"credentials are specified"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	for _, addr := range cfg.GRPCListeners {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			str := "%s: The grpclisten option must specify an " +
+				"interface/port -- parsed [%s]"
+			err := fmt.Errorf(str, funcName, addr)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Validate the addresses and high water marks of the ZMQ notifications.
+	for _, endpoint := range zmqEndpoints(&cfg) {
+		if _, err := parseZMQAddress(endpoint.Address); err != nil {
+			str := "%s: The zmqpub%s option must specify an address " +
+				"of the form tcp://host:port -- parsed [%s]: %v"
+			err := fmt.Errorf(str, funcName, endpoint.Topic,
+				endpoint.Address, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if endpoint.HWM < 1 {
+			str := "%s: The zmqpub%shwm option must be positive " +
+				"-- parsed [%d]"
+			err := fmt.Errorf(str, funcName, endpoint.Topic,
+				endpoint.HWM)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Default RPC to listen on localhost only.
 	if !cfg.DisableRPC && len(cfg.RPCListeners) == 0 {
 		addrs, err := net.LookupHost("localhost")
@@ -758,6 +1364,15 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	if cfg.RPCBatchParallelism < 1 {
+		str := "%s: The rpcbatchparallelism option may not be less " +
+			"than 1 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.RPCBatchParallelism)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Validate the the minrelaytxfee.
 	cfg.minRelayTxFee, err = btcutil.NewAmount(cfg.MinRelayTxFee)
 	if err != nil {
@@ -768,6 +1383,19 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the the dustrelayfee.
+	cfg.dustRelayFee, err = btcutil.NewAmount(cfg.DustRelayFee)
+	if err == nil && cfg.dustRelayFee < 0 {
+		err = fmt.Errorf("fee rate may not be negative")
+	}
+	if err != nil {
+		str := "%s: invalid dustrelayfee: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the max block size to a sane value.
 	if cfg.BlockMaxSize < blockMaxSizeMin || cfg.BlockMaxSize >
 		blockMaxSizeMax {
@@ -794,6 +1422,31 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Limit the max block signature operation cost and the reserved one to
+	// the consensus limit.
+	if cfg.BlockMaxSigOpCost < 0 ||
+		cfg.BlockMaxSigOpCost > blockchain.MaxBlockSigOpsCost {
+
+		str := "%s: The blockmaxsigopcost option must be in between 0 " +
+			"and %d -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, blockchain.MaxBlockSigOpsCost,
+			cfg.BlockMaxSigOpCost)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.BlockReservedSigOps < 0 ||
+		cfg.BlockReservedSigOps > blockchain.MaxBlockSigOpsCost {
+
+		str := "%s: The blockreservedsigopcost option must be in " +
+			"between 0 and %d -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, blockchain.MaxBlockSigOpsCost,
+			cfg.BlockReservedSigOps)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the max orphan count to a sane vlue.
 	if cfg.MaxOrphanTxs < 0 {
 		str := "%s: The maxorphantx option may not be less than 0 " +
@@ -803,6 +1456,124 @@ func loadConfig() (*config, []string, error) {
 		fmt.Fprintln(os.Stderr, usageMessage)
 		return nil, nil, err
 	}
+	if cfg.MaxOrphanWeight < 0 {
+		str := "%s: The maxorphanweight option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxOrphanWeight)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.OrphanTxExpiry < time.Second {
+		str := "%s: The orphantxexpiry option may not be less than " +
+			"1s -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.OrphanTxExpiry)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the unconfirmed packages to sane values.
+	packageLimits := []struct {
+		name  string
+		value int
+	}{
+		{"limitancestorcount", cfg.LimitAncestorCount},
+		{"limitancestorsize", cfg.LimitAncestorSize},
+		{"limitdescendantcount", cfg.LimitDescendantCount},
+		{"limitdescendantsize", cfg.LimitDescendantSize},
+		{"limitclustercount", cfg.LimitClusterCount},
+	}
+	for _, limit := range packageLimits {
+		if limit.value < 1 {
+			str := "%s: The %s option may not be less than 1 " +
+				"-- parsed [%d]"
+			err := fmt.Errorf(str, funcName, limit.name, limit.value)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// The mempool must be able to hold a reasonable number of packages of
+	// the maximum size so they are not evicted right away.
+	minMaxMempool := (cfg.LimitDescendantSize*40 + 999) / 1000
+	if cfg.MaxMempool < minMaxMempool {
+		str := "%s: The maxmempool option may not be less than %d " +
+			"with the configured limitdescendantsize -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, minMaxMempool, cfg.MaxMempool)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Don't expire transactions before they had a chance to be mined.
+	if cfg.MempoolExpiry < time.Hour {
+		str := "%s: The mempoolexpiry option may not be less than " +
+			"1h -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.MempoolExpiry)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the standardness policy to sane values.
+	if cfg.MaxStdTxWeight < blockMaxWeightMin ||
+		cfg.MaxStdTxWeight > blockchain.MaxBlockWeight {
+
+		str := "%s: The maxstdtxweight option must be in between %d " +
+			"and %d -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, blockMaxWeightMin,
+			blockchain.MaxBlockWeight, cfg.MaxStdTxWeight)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.MaxTxSigOpCost < 1 ||
+		cfg.MaxTxSigOpCost > blockchain.MaxBlockSigOpsCost {
+
+		str := "%s: The maxtxsigopcost option must be in between 1 " +
+			"and %d -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, blockchain.MaxBlockSigOpsCost,
+			cfg.MaxTxSigOpCost)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.DataCarrierSize < 0 {
+		str := "%s: The datacarriersize option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.DataCarrierSize)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Limit the orphan block pool to sane values.
+	if cfg.MaxOrphanBlocks < 1 {
+		str := "%s: The maxorphanblocks option may not be less than 1 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxOrphanBlocks)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.MaxOrphanBlockMem < 1 {
+		str := "%s: The maxorphanblockmem option may not be less than " +
+			"1 -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.MaxOrphanBlockMem)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.OrphanBlockExpiry < time.Second {
+		str := "%s: The orphanblockexpiry option may not be less than " +
+			"1s -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.OrphanBlockExpiry)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
 
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
@@ -826,6 +1597,17 @@ func loadConfig() (*config, []string, error) {
 		cfg.BlockMaxWeight = cfg.BlockMaxSize * blockchain.WitnessScaleFactor
 	}
 
+	// The reserved block weight must leave room for transactions.
+	if cfg.BlockReservedWeight >= cfg.BlockMaxWeight {
+		str := "%s: The blockreservedweight option must be less than " +
+			"the max block weight of %d -- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.BlockMaxWeight,
+			cfg.BlockReservedWeight)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Look for illegal characters in the user agent comments.
 	for _, uaComment := range cfg.UserAgentComments {
 		if strings.ContainsAny(uaComment, "/:()") {
@@ -870,6 +1652,135 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --utreexoindex and --droputreexoindex do not mix.
+	if cfg.UtreexoIndex && cfg.DropUtreexoIndex {
+		err := fmt.Errorf("%s: the --utreexoindex and "+
+			"--droputreexoindex options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --utxoscriptindex and --droputxoscriptindex do not mix.
+	if cfg.UtxoScriptIndex && cfg.DropUtxoScriptIndex {
+		err := fmt.Errorf("%s: the --utxoscriptindex and "+
+			"--droputxoscriptindex options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --spendindex and --dropspendindex do not mix.
+	if cfg.SpendIndex && cfg.DropSpendIndex {
+		err := fmt.Errorf("%s: the --spendindex and --dropspendindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --loadsnapshot can not be used along with the optional indexes since
+	// they need the blocks before the snapshot.
+	if cfg.LoadSnapshot != "" && (cfg.TxIndex || cfg.AddrIndex ||
+		cfg.UtreexoIndex || cfg.UtxoScriptIndex || cfg.SpendIndex ||
+		!cfg.NoCFilters) {
+
+		err := fmt.Errorf("%s: the --loadsnapshot option requires the "+
+			"--nocfilters option and may not be activated along "+
+			"with the --txindex, --addrindex, --utreexoindex, "+
+			"--utxoscriptindex, or --spendindex options", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the number of script validation workers is not negative.
+	if cfg.ScriptWorkers < 0 {
+		str := "%s: the scriptworkers option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.ScriptWorkers)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Parse the script validation schedule and the CPUs the script
+	// validation goroutines are pinned to.
+	cfg.scriptSchedule, err = blockchain.ParseScriptSchedule(
+		cfg.ScriptSchedule)
+	if err != nil {
+		str := "%s: Error parsing script schedule: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.ScriptCPUs != "" && cfg.ScriptNUMANode != defaultScriptNUMANode {
+		str := "%s: the scriptcpus and scriptnumanode options may " +
+			"not be activated at the same time"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	switch {
+	case cfg.ScriptCPUs != "":
+		cfg.scriptCPUs, err = parseCPUList(cfg.ScriptCPUs)
+	case cfg.ScriptNUMANode != defaultScriptNUMANode:
+		cfg.scriptCPUs, err = numaNodeCPUs(cfg.ScriptNUMANode)
+	}
+	if err != nil {
+		str := "%s: Error determining the CPUs to pin the script " +
+			"validation goroutines to: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if len(cfg.scriptCPUs) > 0 {
+		if !blockchain.ScriptWorkerPinningSupported {
+			str := "%s: pinning the script validation goroutines " +
+				"to CPUs is not supported on this platform"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.scriptSchedule != blockchain.ScriptSchedulePool {
+			str := "%s: pinning the script validation goroutines " +
+				"to CPUs requires the pool script schedule"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Ensure the prune depth allows reorganizations which are deep enough.
+	if cfg.PruneDepth != 0 && cfg.PruneDepth < blockchain.MinPruneDepth {
+		str := "%s: the prunedepth option must be 0 or at least %d " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, blockchain.MinPruneDepth,
+			cfg.PruneDepth)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prunedepth can not be used along with the transaction and address
+	// indexes since they need all of the blocks.
+	if cfg.PruneDepth != 0 && (cfg.TxIndex || cfg.AddrIndex) {
+		err := fmt.Errorf("%s: the --prunedepth option may not be "+
+			"activated along with the --txindex or --addrindex "+
+			"options", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	cfg.miningAddrs = make([]btcutil.Address, 0, len(cfg.MiningAddrs))
 	for _, strAddr := range cfg.MiningAddrs {
@@ -891,6 +1802,40 @@ func loadConfig() (*config, []string, error) {
 		cfg.miningAddrs = append(cfg.miningAddrs, addr)
 	}
 
+	// Parse the coinbase payouts and ensure they leave a remainder for the
+	// mining address, which also has to be specified since the payouts only
+	// apply to blocks which pay to it.
+	var totalPercent float64
+	for _, strPayout := range cfg.CoinbasePayouts {
+		payout, err := parseCoinbasePayout(strPayout,
+			activeNetParams.Params)
+		if err != nil {
+			str := "%s: The coinbasepayout value of '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, strPayout, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		totalPercent += payout.Percent
+		cfg.coinbasePayouts = append(cfg.coinbasePayouts, payout)
+	}
+	if totalPercent >= 100 {
+		str := "%s: The percentages of the coinbasepayout option must " +
+			"add up to less than 100 -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, totalPercent)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if len(cfg.CoinbasePayouts) > 0 && len(cfg.MiningAddrs) == 0 {
+		str := "%s: the coinbasepayout option is set, but there are no " +
+			"mining addresses specified "
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Ensure there is at least one mining address when the generate flag is
 	// set.
 	if cfg.Generate && len(cfg.MiningAddrs) == 0 {
@@ -902,6 +1847,53 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Ensure there is at least one mining address when the stratum server
+	// is enabled.
+	if len(cfg.StratumListeners) > 0 && len(cfg.MiningAddrs) == 0 {
+		str := "%s: the stratumlisten option is set, but there are no " +
+			"mining addresses specified "
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the stratum difficulty and share interval are sane.
+	if cfg.StratumDifficulty <= 0 {
+		str := "%s: The stratumdifficulty option must be positive -- " +
+			"parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.StratumDifficulty)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.StratumShareInterval < time.Second {
+		str := "%s: The stratumshareinterval option may not be less " +
+			"than 1s -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.StratumShareInterval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Ensure the Stratum V2 template interval and fee delta are sane.
+	if cfg.SV2Interval < time.Second {
+		str := "%s: The sv2interval option may not be less than 1s " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.SV2Interval)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.SV2FeeDelta < 0 {
+		str := "%s: The sv2feedelta option may not be negative " +
+			"-- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.SV2FeeDelta)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Add default port to all listener addresses if needed and remove
 	// duplicate addresses.
 	cfg.Listeners = normalizeAddresses(cfg.Listeners,
@@ -912,6 +1904,15 @@ func loadConfig() (*config, []string, error) {
 	cfg.RPCListeners = normalizeAddresses(cfg.RPCListeners,
 		activeNetParams.rpcPort)
 
+	// Add default port to all stratum listener addresses if needed and
+	// remove duplicate addresses.
+	cfg.StratumListeners = normalizeAddresses(cfg.StratumListeners,
+		defaultStratumPort)
+
+	// Add default port to all Stratum V2 listener addresses if needed and
+	// remove duplicate addresses.
+	cfg.SV2Listeners = normalizeAddresses(cfg.SV2Listeners, defaultSV2Port)
+
 	// Only allow TLS to be disabled if the RPC is bound to localhost
 	// addresses.
 	if !cfg.DisableRPC && cfg.DisableTLS {
@@ -940,6 +1941,18 @@ func loadConfig() (*config, []string, error) {
 				return nil, nil, err
 			}
 		}
+		for _, addr := range cfg.GRPCListeners {
+			host, _, _ := net.SplitHostPort(addr)
+			if _, ok := allowedTLSListeners[host]; !ok {
+				str := "%s: the --notls option may not be used " +
+					"when binding gRPC to non localhost " +
+					"addresses: %s"
+				err := fmt.Errorf(str, funcName, addr)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+		}
 	}
 
 	// Add default port to all added peer addresses if needed and remove
@@ -968,6 +1981,33 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Load the checkpoints from the checkpoint file.
+	if cfg.CheckpointFile != "" {
+		cfg.fileCheckpoints, err = loadCheckpointFile(cfg.CheckpointFile)
+		if err != nil {
+			str := "%s: Error loading checkpoint file: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Determine how checkpoints are handled on the active network.
+	// Disabling the checkpoints is the same as the disabled mode.
+	cfg.checkpointMode, err = parseCheckpointMode(cfg.CheckpointModes,
+		activeNetParams.Name)
+	if err != nil {
+		str := "%s: Error parsing checkpoint mode: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	if cfg.DisableCheckpoints {
+		cfg.checkpointMode = blockchain.CheckpointDisabled
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
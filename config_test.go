@@ -7,6 +7,9 @@ import (
 	"regexp"
 	"runtime"
 	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
 var (
@@ -70,3 +73,94 @@ func TestCreateDefaultConfigFile(t *testing.T) {
 		t.Error("Could not find rpcpass in generated default config file.")
 	}
 }
+
+// TestParseCheckpointMode ensures the checkpoint mode of a network is chosen
+// from the network specific and generic checkpoint mode options as expected.
+func TestParseCheckpointMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		modes   []string
+		netName string
+		want    blockchain.CheckpointMode
+		wantErr bool
+	}{
+		{"default", nil, "mainnet", blockchain.CheckpointEnforce, false},
+		{"generic", []string{"advisory"}, "mainnet",
+			blockchain.CheckpointAdvisory, false},
+		{"last generic wins", []string{"advisory", "disabled"},
+			"mainnet", blockchain.CheckpointDisabled, false},
+		{"other network", []string{"testnet3:disabled"}, "mainnet",
+			blockchain.CheckpointEnforce, false},
+		{"network specific wins", []string{"testnet3:advisory",
+			"disabled"}, "testnet3", blockchain.CheckpointAdvisory,
+			false},
+		{"unknown mode", []string{"lax"}, "mainnet", 0, true},
+		{"unknown network", []string{"foonet:advisory"}, "mainnet", 0,
+			true},
+	}
+
+	for _, test := range tests {
+		mode, err := parseCheckpointMode(test.modes, test.netName)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if mode != test.want {
+			t.Errorf("%s: got mode %v, want %v", test.name, mode,
+				test.want)
+		}
+	}
+}
+
+// TestParseCoinbasePayout ensures coinbase payouts are parsed as expected and
+// invalid ones are rejected.
+func TestParseCoinbasePayout(t *testing.T) {
+	const addr = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+	tests := []struct {
+		name    string
+		payout  string
+		percent float64
+		wantErr bool
+	}{
+		{"integer", addr + ":2", 2, false},
+		{"fraction", addr + ":2.5", 2.5, false},
+		{"missing percentage", addr, 0, true},
+		{"missing address", ":2", 0, true},
+		{"malformed address", "1BvBMSEY:2", 0, true},
+		{"wrong network", "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn:2", 0,
+			true},
+		{"malformed percentage", addr + ":two", 0, true},
+		{"zero", addr + ":0", 0, true},
+		{"negative", addr + ":-1", 0, true},
+		{"everything", addr + ":100", 0, true},
+		{"not a number", addr + ":NaN", 0, true},
+	}
+
+	for _, test := range tests {
+		payout, err := parseCoinbasePayout(test.payout,
+			&chaincfg.MainNetParams)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if payout.Address.EncodeAddress() != addr ||
+			payout.Percent != test.percent {
+
+			t.Errorf("%s: got payout of %v%% to %s, want %v%% to %s",
+				test.name, payout.Percent, payout.Address,
+				test.percent, addr)
+		}
+	}
+}
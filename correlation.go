@@ -0,0 +1,50 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	// correlationIDHeader is the HTTP header an RPC client may use to supply
+	// a correlation id for all requests in the body of an HTTP request.
+	// The correlationid field of a request takes precedence over it.
+	correlationIDHeader = "X-Correlation-ID"
+
+	// maxCorrelationIDLen is the maximum allowed length of a correlation
+	// id.
+	maxCorrelationIDLen = 64
+)
+
+// validateCorrelationID returns an error when the passed client-supplied
+// correlation id is too long or contains characters other than letters,
+// digits, and the punctuation characters '-', '_', '.', and ':'.  The
+// restriction ensures the id can't be used to forge log entries.
+func validateCorrelationID(correlationID string) error {
+	if len(correlationID) > maxCorrelationIDLen {
+		return fmt.Errorf("correlation id is longer than %d characters",
+			maxCorrelationIDLen)
+	}
+	for _, r := range correlationID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == ':':
+		default:
+			return fmt.Errorf("correlation id contains invalid "+
+				"character %q", r)
+		}
+	}
+	return nil
+}
+
+// correlationSuffix returns a suffix for log entries which identifies the
+// passed correlation id or an empty string when there is none.
+func correlationSuffix(correlationID string) string {
+	if correlationID == "" {
+		return ""
+	}
+	return fmt.Sprintf(" [correlation id %s]", correlationID)
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestValidateCorrelationID ensures client-supplied correlation ids are only
+// accepted when they are short enough and consist of allowed characters.
+func TestValidateCorrelationID(t *testing.T) {
+	tests := []struct {
+		name  string
+		id    string
+		valid bool
+	}{
+		{"empty", "", true},
+		{"alphanumeric", "order1234", true},
+		{"punctuation", "svc:order-1234_retry.2", true},
+		{"max length", strings.Repeat("a", maxCorrelationIDLen), true},
+		{"too long", strings.Repeat("a", maxCorrelationIDLen+1), false},
+		{"newline", "order\n1234", false},
+		{"space", "order 1234", false},
+		{"non-ascii", "örder", false},
+	}
+
+	for _, test := range tests {
+		err := validateCorrelationID(test.id)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected result - got %v, want valid %v",
+				test.name, err, test.valid)
+		}
+	}
+}
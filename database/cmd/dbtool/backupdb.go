@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+)
+
+// backupCmd defines the configuration options for the backupdb command.
+type backupCmd struct{}
+
+var (
+	// backupCfg defines the configuration options for the command.
+	backupCfg = backupCmd{}
+)
+
+// Execute is the main entry point for the command.  It's invoked by the parser.
+func (cmd *backupCmd) Execute(args []string) error {
+	// Setup the global config options and ensure they are valid.
+	if err := setupGlobalConfig(); err != nil {
+		return err
+	}
+
+	if len(args) < 1 {
+		return errors.New("required backup file parameter not specified")
+	}
+
+	// Load the block database.
+	db, err := loadBlockDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	log.Infof("Backing up block database to '%s'", args[0])
+	if err := db.BackupToPath(args[0]); err != nil {
+		return err
+	}
+	log.Info("Block database backed up")
+	return nil
+}
+
+// Usage overrides the usage display for the command.
+func (cmd *backupCmd) Usage() string {
+	return "<backup-file>"
+}
@@ -36,6 +36,7 @@ type config struct {
 	TestNet3       bool   `long:"testnet" description:"Use the test network"`
 	RegressionTest bool   `long:"regtest" description:"Use the regression test network"`
 	SimNet         bool   `long:"simnet" description:"Use the simulation test network"`
+	ReadOnly       bool   `long:"readonly" description:"Open the block database read-only, which is possible while btcd is running"`
 }
 
 // fileExists reports whether the named file or directory exists.
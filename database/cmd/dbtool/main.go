@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/database/ffldb"
 	"github.com/btcsuite/btclog"
 	flags "github.com/jessevdk/go-flags"
 )
@@ -31,6 +32,14 @@ func loadBlockDB() (database.DB, error) {
 	dbName := blockDbNamePrefix + "_" + cfg.DbType
 	dbPath := filepath.Join(cfg.DataDir, dbName)
 
+	// Open the database read-only when requested, which requires it to
+	// exist.
+	if cfg.ReadOnly {
+		log.Infof("Loading block database read-only from '%s'", dbPath)
+		opts := &ffldb.Options{ReadOnly: true}
+		return database.Open(cfg.DbType, dbPath, activeNetParams.Net, opts)
+	}
+
 	log.Infof("Loading block database from '%s'", dbPath)
 	db, err := database.Open(cfg.DbType, dbPath, activeNetParams.Net)
 	if err != nil {
@@ -89,6 +98,24 @@ func realMain() error {
 	parser.AddCommand("fetchblockregion",
 		"Fetch the specified block region from the database", "",
 		&blockRegionCfg)
+	parser.AddCommand("backupdb",
+		"Back up the block database to a file", "", &backupCfg)
+	parser.AddCommand("restoredb",
+		"Restore the block database from a backup file",
+		"Restore the block database from a backup file.  The block "+
+			"database must not exist.", &restoreCfg)
+	parser.AddCommand("migratedb",
+		"Migrate the block database to another database backend",
+		"Migrate the block database to another database backend.  "+
+			"The block files are hard linked when possible and the "+
+			"metadata is copied.  btcd must not be running.",
+		&migrateCfg)
+	parser.AddCommand("repairdb",
+		"Scan the block database for corruption and repair it",
+		"Scan the block database for corruption and repair it.  The "+
+			"checksums of all blocks are verified, torn writes are "+
+			"truncated, and blocks with corrupt or missing data are "+
+			"removed.  btcd must not be running.", &repairCfg)
 
 	// Parse command line and invoke the Execute function for the specified
 	// command.
@@ -0,0 +1,57 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/database/ffldb"
+)
+
+// migrateCmd defines the configuration options for the migratedb command.
+type migrateCmd struct {
+	ToDbType string `long:"to" description:"Database backend to migrate the block database to"`
+}
+
+var (
+	// migrateCfg defines the configuration options for the command.
+	migrateCfg = migrateCmd{
+		ToDbType: "pebble",
+	}
+)
+
+// Execute is the main entry point for the command.  It's invoked by the parser.
+func (cmd *migrateCmd) Execute(args []string) error {
+	// Setup the global config options and ensure they are valid.
+	if err := setupGlobalConfig(); err != nil {
+		return err
+	}
+	if !validDbType(cmd.ToDbType) {
+		str := "The specified database type to migrate to [%v] is " +
+			"invalid -- supported types %v"
+		return fmt.Errorf(str, cmd.ToDbType, knownDbTypes)
+	}
+	if cmd.ToDbType == cfg.DbType {
+		return fmt.Errorf("The database is already of type %v",
+			cfg.DbType)
+	}
+
+	// The database names are based on the database type.
+	srcPath := filepath.Join(cfg.DataDir, blockDbNamePrefix+"_"+cfg.DbType)
+	dstPath := filepath.Join(cfg.DataDir, blockDbNamePrefix+"_"+
+		cmd.ToDbType)
+
+	log.Infof("Migrating block database from '%s' to '%s'", srcPath,
+		dstPath)
+	err := ffldb.Migrate(cfg.DbType, srcPath, cmd.ToDbType, dstPath)
+	if err != nil {
+		return err
+	}
+	log.Infof("Block database migrated -- start btcd with --dbtype=%s "+
+		"to use it and remove '%s' once it is no longer needed",
+		cmd.ToDbType, srcPath)
+	return nil
+}
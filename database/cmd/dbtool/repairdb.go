@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/database/ffldb"
+)
+
+// repairCmd defines the configuration options for the repairdb command.
+type repairCmd struct{}
+
+var (
+	// repairCfg defines the configuration options for the command.
+	repairCfg = repairCmd{}
+)
+
+// Execute is the main entry point for the command.  It's invoked by the parser.
+func (cmd *repairCmd) Execute(args []string) error {
+	// Setup the global config options and ensure they are valid.
+	if err := setupGlobalConfig(); err != nil {
+		return err
+	}
+
+	// The database name is based on the database type.
+	dbPath := filepath.Join(cfg.DataDir, blockDbNamePrefix+"_"+cfg.DbType)
+
+	log.Infof("Scanning block database '%s'", dbPath)
+	report, err := ffldb.ScanAndRepair(cfg.DbType, dbPath,
+		activeNetParams.Net)
+	if err != nil {
+		return err
+	}
+	log.Infof("Verified %d block records in %d files", report.RecordsVerified,
+		report.FilesScanned)
+	log.Infof("Found %d corrupt block records", report.CorruptRecords)
+	log.Infof("Truncated %d bytes of torn writes", report.TruncatedBytes)
+	for _, hash := range report.RemovedBlocks {
+		log.Infof("Removed block %s", hash)
+	}
+	log.Infof("Removed %d blocks", len(report.RemovedBlocks))
+	return nil
+}
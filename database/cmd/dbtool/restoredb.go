@@ -0,0 +1,55 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/database/ffldb"
+)
+
+// restoreCmd defines the configuration options for the restoredb command.
+type restoreCmd struct{}
+
+var (
+	// restoreCfg defines the configuration options for the command.
+	restoreCfg = restoreCmd{}
+)
+
+// Execute is the main entry point for the command.  It's invoked by the parser.
+func (cmd *restoreCmd) Execute(args []string) error {
+	// Setup the global config options and ensure they are valid.
+	if err := setupGlobalConfig(); err != nil {
+		return err
+	}
+
+	if len(args) < 1 {
+		return errors.New("required backup file parameter not specified")
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// The database name is based on the database type.
+	dbPath := filepath.Join(cfg.DataDir, blockDbNamePrefix+"_"+cfg.DbType)
+
+	log.Infof("Restoring block database to '%s' from '%s'", dbPath,
+		args[0])
+	err = ffldb.Restore(cfg.DbType, dbPath, activeNetParams.Net, file)
+	if err != nil {
+		return err
+	}
+	log.Info("Block database restored")
+	return nil
+}
+
+// Usage overrides the usage display for the command.
+func (cmd *restoreCmd) Usage() string {
+	return "<backup-file>"
+}
@@ -24,6 +24,10 @@ A quick overview of the features database provides are as follows:
  - Read-only and read-write transactions with both manual and managed modes
  - Nested buckets
  - Supports registration of backend databases
+ - Online backups from consistent snapshots
+ - Detection and repair of corruption after unclean shutdowns
+ - Read-only access while the database is open in another process
+ - Statistics of cache effectiveness and I/O
  - Comprehensive test coverage
 
 Database
@@ -0,0 +1,439 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/database/internal/treap"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/goleveldb/leveldb/util"
+)
+
+// The backup format consists of a header followed by a series of records and
+// a checksum over everything before it:
+//
+//   <magic><version><network>
+//   <record type><record data>...
+//   <end record type><checksum>
+//
+//   Field          Type     Size
+//   magic          []byte   8
+//   version        uint32   4
+//   network        uint32   4
+//   record type    byte     1
+//   checksum       uint32   4
+//
+// A block file record holds the file number, the length of the data, and the
+// data of a flat block file.  A metadata record holds the length of the key,
+// the key, the length of the value, and the value of a key in the metadata
+// store.  All integers are little endian.
+const (
+	// backupVersion is the version of the backup format.
+	backupVersion = 1
+
+	// maxBackupKeySize is the maximum size of a metadata key or value
+	// which is accepted while restoring a backup.
+	maxBackupKeySize = 1 << 28
+)
+
+// Record types of the backup format.
+const (
+	backupRecordEnd       = 0
+	backupRecordBlockFile = 1
+	backupRecordMetadata  = 2
+)
+
+// backupMagic identifies a database backup.
+var backupMagic = []byte("ffldbbak")
+
+// backupWriter writes the fields of a backup while calculating its checksum.
+type backupWriter struct {
+	w      *bufio.Writer
+	hasher hash.Hash32
+	err    error
+}
+
+// write writes the passed bytes unless a previous write failed.
+func (bw *backupWriter) write(b []byte) {
+	if bw.err != nil {
+		return
+	}
+	if _, err := bw.w.Write(b); err != nil {
+		bw.err = err
+		return
+	}
+	bw.hasher.Write(b)
+}
+
+// writeUint32 writes the passed integer unless a previous write failed.
+func (bw *backupWriter) writeUint32(v uint32) {
+	var b [4]byte
+	byteOrder.PutUint32(b[:], v)
+	bw.write(b[:])
+}
+
+// writeBlockFile writes a record with the first length bytes of the passed
+// block file.
+func (bw *backupWriter) writeBlockFile(dbPath string, fileNum, length uint32) {
+	if bw.err != nil {
+		return
+	}
+	file, err := os.Open(blockFilePath(dbPath, fileNum))
+	if err != nil {
+		bw.err = err
+		return
+	}
+	defer file.Close()
+
+	bw.write([]byte{backupRecordBlockFile})
+	bw.writeUint32(fileNum)
+	bw.writeUint32(length)
+	if bw.err != nil {
+		return
+	}
+	n, err := io.Copy(io.MultiWriter(bw.w, bw.hasher),
+		io.LimitReader(file, int64(length)))
+	if err != nil {
+		bw.err = err
+		return
+	}
+	if n != int64(length) {
+		bw.err = fmt.Errorf("block file %d is %d bytes instead of %d",
+			fileNum, n, length)
+	}
+}
+
+// Backup writes a consistent backup of the entire database, including all of
+// the metadata and blocks, to the passed writer.  The database remains usable
+// while the backup is written, but changes which are committed in the mean
+// time are not part of the backup.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Backup(w io.Writer) error {
+	// Start a read transaction and determine the write cursor position
+	// under the write lock so the metadata snapshot of the transaction
+	// matches the block files up to that position.  Block files are not
+	// deleted while a backup is in progress, and the blocks written after
+	// the position are not part of the backup, so the block files can be
+	// read while new blocks are written.
+	db.writeLock.Lock()
+	tx, err := db.begin(false)
+	if err != nil {
+		db.writeLock.Unlock()
+		return err
+	}
+	atomic.AddInt32(&db.backups, 1)
+	wc := db.store.writeCursor
+	wc.RLock()
+	lastFileNum, lastFileLen := wc.curFileNum, wc.curOffset
+	wc.RUnlock()
+	db.writeLock.Unlock()
+	defer func() {
+		atomic.AddInt32(&db.backups, -1)
+		tx.close()
+	}()
+
+	dbPath := db.store.basePath
+	log.Infof("Backing up database %q", dbPath)
+	bw := &backupWriter{
+		w:      bufio.NewWriterSize(w, 1<<20),
+		hasher: crc32.New(castagnoli),
+	}
+	bw.write(backupMagic)
+	bw.writeUint32(backupVersion)
+	bw.writeUint32(uint32(db.store.network))
+
+	// Write all of the block files up to the write cursor position.
+	var numFiles int
+	for _, fileNum := range blockFileNums(dbPath) {
+		if fileNum > lastFileNum {
+			break
+		}
+		length := lastFileLen
+		if fileNum < lastFileNum {
+			fi, err := os.Stat(blockFilePath(dbPath, fileNum))
+			if err != nil {
+				bw.err = err
+				break
+			}
+			length = uint32(fi.Size())
+		}
+		bw.writeBlockFile(dbPath, fileNum, length)
+		numFiles++
+	}
+
+	// Write all of the metadata of the snapshot.
+	var numKeys int
+	iter := tx.snapshot.NewIterator(&util.Range{})
+	for ok := iter.First(); bw.err == nil && ok; ok = iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		bw.write([]byte{backupRecordMetadata})
+		bw.writeUint32(uint32(len(key)))
+		bw.write(key)
+		bw.writeUint32(uint32(len(value)))
+		bw.write(value)
+		numKeys++
+	}
+	if err := iter.Error(); err != nil && bw.err == nil {
+		bw.err = err
+	}
+	iter.Release()
+
+	// Finish with the checksum of everything before it.
+	bw.write([]byte{backupRecordEnd})
+	if bw.err == nil {
+		var b [4]byte
+		byteOrder.PutUint32(b[:], bw.hasher.Sum32())
+		_, bw.err = bw.w.Write(b[:])
+	}
+	if bw.err == nil {
+		bw.err = bw.w.Flush()
+	}
+	if bw.err != nil {
+		str := fmt.Sprintf("failed to back up database: %v", bw.err)
+		return makeDbErr(database.ErrDriverSpecific, str, bw.err)
+	}
+
+	log.Infof("Backed up %d block files and %d metadata entries",
+		numFiles, numKeys)
+	return nil
+}
+
+// BackupToPath writes a backup of the database as described by Backup to a
+// new file at the passed path.  The file only appears at the path once the
+// backup is complete.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) BackupToPath(path string) error {
+	if fileExists(path) {
+		str := fmt.Sprintf("backup %q already exists", path)
+		return makeDbErr(database.ErrDriverSpecific, str, nil)
+	}
+
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+		0600)
+	if err != nil {
+		str := fmt.Sprintf("failed to create backup %q: %v", path, err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	if err := db.Backup(file); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		str := fmt.Sprintf("failed to sync backup %q: %v", path, err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		str := fmt.Sprintf("failed to close backup %q: %v", path, err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		str := fmt.Sprintf("failed to rename backup %q: %v", path, err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	return nil
+}
+
+// backupReader reads the fields of a backup while calculating its checksum.
+type backupReader struct {
+	r      *bufio.Reader
+	hasher hash.Hash32
+}
+
+// read reads exactly len(b) bytes into the passed buffer.
+func (br *backupReader) read(b []byte) error {
+	if _, err := io.ReadFull(br.r, b); err != nil {
+		return err
+	}
+	br.hasher.Write(b)
+	return nil
+}
+
+// readUint32 reads an integer.
+func (br *backupReader) readUint32() (uint32, error) {
+	var b [4]byte
+	if err := br.read(b[:]); err != nil {
+		return 0, err
+	}
+	return byteOrder.Uint32(b[:]), nil
+}
+
+// readBytes reads a length prefixed byte slice.
+func (br *backupReader) readBytes() ([]byte, error) {
+	length, err := br.readUint32()
+	if err != nil {
+		return nil, err
+	}
+	if length > maxBackupKeySize {
+		return nil, fmt.Errorf("metadata entry of %d bytes exceeds "+
+			"the maximum of %d bytes", length, maxBackupKeySize)
+	}
+	b := make([]byte, length)
+	return b, br.read(b)
+}
+
+// restoreBackup restores the backup read from the passed reader into a new
+// database of the passed backend at the passed path.
+func restoreBackup(backend *metadataBackend, dbPath string, network wire.BitcoinNet, r io.Reader) error {
+	br := &backupReader{
+		r:      bufio.NewReaderSize(r, 1<<20),
+		hasher: crc32.New(castagnoli),
+	}
+	magic := make([]byte, len(backupMagic))
+	if err := br.read(magic); err != nil {
+		return err
+	}
+	if !bytes.Equal(magic, backupMagic) {
+		return fmt.Errorf("not a database backup")
+	}
+	version, err := br.readUint32()
+	if err != nil {
+		return err
+	}
+	if version != backupVersion {
+		return fmt.Errorf("unsupported backup version %d", version)
+	}
+	backupNet, err := br.readUint32()
+	if err != nil {
+		return err
+	}
+	if wire.BitcoinNet(backupNet) != network {
+		return fmt.Errorf("backup is for network %v instead of %v",
+			wire.BitcoinNet(backupNet), network)
+	}
+
+	if err := os.MkdirAll(dbPath, 0700); err != nil {
+		return err
+	}
+	meta, err := backend.open(filepath.Join(dbPath, backend.dirName), true)
+	if err != nil {
+		return err
+	}
+	defer meta.Close()
+
+	var numFiles, numKeys int
+	batch := treap.NewMutable()
+	for {
+		var recordType [1]byte
+		if err := br.read(recordType[:]); err != nil {
+			return err
+		}
+
+		switch recordType[0] {
+		case backupRecordBlockFile:
+			fileNum, err := br.readUint32()
+			if err != nil {
+				return err
+			}
+			length, err := br.readUint32()
+			if err != nil {
+				return err
+			}
+			file, err := os.OpenFile(blockFilePath(dbPath, fileNum),
+				os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.CopyN(io.MultiWriter(file, br.hasher), br.r,
+				int64(length))
+			if err == nil {
+				err = file.Sync()
+			}
+			file.Close()
+			if err != nil {
+				return err
+			}
+			numFiles++
+
+		case backupRecordMetadata:
+			key, err := br.readBytes()
+			if err != nil {
+				return err
+			}
+			value, err := br.readBytes()
+			if err != nil {
+				return err
+			}
+			batch.Put(key, value)
+			numKeys++
+			if batch.Len() >= migrateBatchSize {
+				err := meta.Write(batch, treap.NewMutable())
+				if err != nil {
+					return err
+				}
+				batch.Reset()
+			}
+
+		case backupRecordEnd:
+			wantChecksum := br.hasher.Sum32()
+			var b [4]byte
+			if _, err := io.ReadFull(br.r, b[:]); err != nil {
+				return err
+			}
+			if gotChecksum := byteOrder.Uint32(b[:]); gotChecksum !=
+				wantChecksum {
+
+				return fmt.Errorf("backup checksum %08x does not "+
+					"match the expected checksum %08x",
+					gotChecksum, wantChecksum)
+			}
+			if err := meta.Write(batch, treap.NewMutable()); err != nil {
+				return err
+			}
+			log.Infof("Restored %d block files and %d metadata "+
+				"entries", numFiles, numKeys)
+			return nil
+
+		default:
+			return fmt.Errorf("unknown backup record type %d",
+				recordType[0])
+		}
+	}
+}
+
+// Restore restores a backup written by the Backup method of a database of any
+// of the driver types of this package into a new database of the passed driver
+// type at the passed path.  The backup must be for the passed network.
+//
+// database.ErrDbExists is returned if the database already exists, and nothing
+// is left at the path when the backup can't be restored.
+func Restore(dbType, dbPath string, network wire.BitcoinNet, r io.Reader) error {
+	backend, err := backendByType(dbType)
+	if err != nil {
+		return err
+	}
+	if fileExists(dbPath) {
+		str := fmt.Sprintf("database %q already exists", dbPath)
+		return makeDbErr(database.ErrDbExists, str, nil)
+	}
+
+	log.Infof("Restoring database %q", dbPath)
+	if err := restoreBackup(backend, dbPath, network, r); err != nil {
+		_ = os.RemoveAll(dbPath)
+		if dbErr, ok := err.(database.Error); ok {
+			return dbErr
+		}
+		str := fmt.Sprintf("failed to restore database: %v", err)
+		return makeDbErr(database.ErrCorruption, str, err)
+	}
+	return nil
+}
@@ -5,11 +5,14 @@
 package ffldb
 
 import (
+	"math/rand"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcutil"
 )
@@ -95,3 +98,70 @@ func BenchmarkBlock(b *testing.B) {
 	// Don't benchmark teardown.
 	b.StopTimer()
 }
+
+// benchmarkRandomBlockReads benchmarks how long it takes to load random blocks
+// of the test data set from multiple goroutines concurrently.  The blocks are
+// spread over multiple flat files so most of them are read from files which
+// are no longer written to.
+func benchmarkRandomBlockReads(b *testing.B, mmapReads bool) {
+	blocks, err := loadBlocks(b, blockDataFile, blockDataNet)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-benchrandblk")
+	_ = os.RemoveAll(dbPath)
+	idb, err := openDB(dbPath, blockDataNet, true,
+		&Options{MmapReads: mmapReads}, ldbBackend)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer idb.Close()
+
+	// Store the blocks in small flat files so they are spread over several
+	// of them without exceeding the maximum number of open files.
+	idb.(*db).store.maxBlockFileSize = 8192
+	hashes := make([]*chainhash.Hash, 0, len(blocks))
+	for _, block := range blocks {
+		err := idb.Update(func(tx database.Tx) error {
+			return tx.StoreBlock(block)
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		hashes = append(hashes, block.Hash())
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var seed int64
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+		for pb.Next() {
+			hash := hashes[rng.Intn(len(hashes))]
+			err := idb.View(func(tx database.Tx) error {
+				_, err := tx.FetchBlock(hash)
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// Don't benchmark teardown.
+	b.StopTimer()
+}
+
+// BenchmarkRandomBlockReads benchmarks how long it takes to concurrently load
+// random blocks using regular file reads.
+func BenchmarkRandomBlockReads(b *testing.B) {
+	benchmarkRandomBlockReads(b, false)
+}
+
+// BenchmarkRandomBlockReadsMmap benchmarks how long it takes to concurrently
+// load random blocks using memory-mapped file reads.
+func BenchmarkRandomBlockReadsMmap(b *testing.B) {
+	benchmarkRandomBlockReads(b, true)
+}
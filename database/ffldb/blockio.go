@@ -14,8 +14,13 @@ import (
 	"hash/crc32"
 	"io"
 	"os"
+	"io/ioutil"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
@@ -99,11 +104,22 @@ type writeCursor struct {
 	// curOffset is the offset in the current write block file where the
 	// next new block will be written.
 	curOffset uint32
+
+	// buf houses the data which has been written to the current write
+	// block file, but is still buffered.  It ends at curOffset.
+	buf []byte
 }
 
 // blockStore houses information used to handle reading and writing blocks (and
 // part of blocks) into flat files with support for multiple concurrent readers.
 type blockStore struct {
+	// The following variables are statistics which must only be used
+	// atomically.
+	fileHits     uint64 // Reads from block files which were open.
+	fileMisses   uint64 // Reads which opened the block file.
+	bytesRead    uint64 // Bytes of block data read.
+	bytesWritten uint64 // Bytes of block data written.
+
 	// network is the specific network to use in the flat files for each
 	// block.
 	network wire.BitcoinNet
@@ -112,8 +128,8 @@ type blockStore struct {
 	basePath string
 
 	// maxBlockFileSize is the maximum size for each file used to store
-	// blocks.  It is defined on the store so the whitebox tests can
-	// override the value.
+	// blocks.  It is defined on the store so it can be configured and so
+	// the whitebox tests can override the value.
 	maxBlockFileSize uint32
 
 	// The following fields are related to the flat files which hold the
@@ -168,6 +184,20 @@ type blockStore struct {
 	// new blocks are written to.
 	writeCursor *writeCursor
 
+	// mmapReads specifies whether block files which are opened read-only
+	// are memory-mapped.  Files which fail to be mapped fall back to
+	// regular reads.
+	mmapReads bool
+
+	// writeBufSize is the maximum number of bytes which are buffered
+	// before they are written to the current write block file.  Writes
+	// are not buffered when it is zero.
+	writeBufSize int
+
+	// preallocate specifies whether disk space for the maximum block file
+	// size is allocated when a block file is opened for writing.
+	preallocate bool
+
 	// These functions are set to openFile, openWriteFile, and deleteFile by
 	// default, but are exposed here to allow the whitebox tests to replace
 	// them when working with mock files.
@@ -239,6 +269,17 @@ func (s *blockStore) openWriteFile(fileNum uint32) (filer, error) {
 		return nil, makeDbErr(database.ErrDriverSpecific, str, err)
 	}
 
+	// Allocate the space for the whole file up front when requested so
+	// the file is less fragmented on disk.  Not all file systems support
+	// it, so failures are not fatal.
+	if s.preallocate {
+		err := preallocate(file, int64(s.maxBlockFileSize))
+		if err != nil {
+			log.Debugf("Failed to preallocate block file %d: %v",
+				fileNum, err)
+		}
+	}
+
 	return file, nil
 }
 
@@ -259,6 +300,18 @@ func (s *blockStore) openFile(fileNum uint32) (*lockableFile, error) {
 	}
 	blockFile := &lockableFile{file: file}
 
+	// Memory-map the file when enabled, falling back to regular reads when
+	// it can't be mapped.
+	if s.mmapReads {
+		mf, err := newMmapFile(file)
+		if err != nil {
+			log.Debugf("Unable to memory-map block file %d, using "+
+				"regular reads: %v", fileNum, err)
+		} else {
+			blockFile.file = mf
+		}
+	}
+
 	// Close the least recently used file if the file exceeds the max
 	// allowed open files.  This is not done until after the file open in
 	// case the file fails to open, there is no need to close any files.
@@ -307,6 +360,37 @@ func (s *blockStore) deleteFile(fileNum uint32) error {
 	return nil
 }
 
+// removeFiles closes and deletes the block files for the passed flat file
+// numbers.  The files must no longer hold any blocks which are referenced by the
+// block index, so failures are only logged since the files are simply left
+// behind.
+func (s *blockStore) removeFiles(fileNums []uint32) {
+	for _, fileNum := range fileNums {
+		// Close the file when it is open under the write lock for the
+		// file in case any readers are still reading from it.
+		s.obfMutex.Lock()
+		if obf, ok := s.openBlockFiles[fileNum]; ok {
+			s.lruMutex.Lock()
+			s.openBlocksLRU.Remove(s.fileNumToLRUElem[fileNum])
+			delete(s.fileNumToLRUElem, fileNum)
+			s.lruMutex.Unlock()
+
+			obf.Lock()
+			_ = obf.file.Close()
+			obf.Unlock()
+
+			delete(s.openBlockFiles, fileNum)
+		}
+		s.obfMutex.Unlock()
+
+		log.Debugf("Deleting unused block file %d", fileNum)
+		if err := s.deleteFileFunc(fileNum); err != nil {
+			log.Warnf("Failed to delete unused block file %d: %v",
+				fileNum, err)
+		}
+	}
+}
+
 // blockFile attempts to return an existing file handle for the passed flat file
 // number if it is already open as well as marking it as most recently used.  It
 // will also open the file when it's not already open subject to the rules
@@ -325,6 +409,7 @@ func (s *blockStore) blockFile(fileNum uint32) (*lockableFile, error) {
 		obf := wc.curFile
 		obf.RLock()
 		wc.RUnlock()
+		atomic.AddUint64(&s.fileHits, 1)
 		return obf, nil
 	}
 	wc.RUnlock()
@@ -338,6 +423,7 @@ func (s *blockStore) blockFile(fileNum uint32) (*lockableFile, error) {
 
 		obf.RLock()
 		s.obfMutex.RUnlock()
+		atomic.AddUint64(&s.fileHits, 1)
 		return obf, nil
 	}
 	s.obfMutex.RUnlock()
@@ -349,6 +435,7 @@ func (s *blockStore) blockFile(fileNum uint32) (*lockableFile, error) {
 	if obf, ok := s.openBlockFiles[fileNum]; ok {
 		obf.RLock()
 		s.obfMutex.Unlock()
+		atomic.AddUint64(&s.fileHits, 1)
 		return obf, nil
 	}
 
@@ -361,13 +448,15 @@ func (s *blockStore) blockFile(fileNum uint32) (*lockableFile, error) {
 	}
 	obf.RLock()
 	s.obfMutex.Unlock()
+	atomic.AddUint64(&s.fileMisses, 1)
 	return obf, nil
 }
 
 // writeData is a helper function for writeBlock which writes the provided data
 // at the current write offset and updates the write cursor accordingly.  The
-// field name parameter is only used when there is an error to provide a nicer
-// error message.
+// data is buffered when there is room for it in the write buffer.  The field
+// name parameter is only used when there is an error to provide a nicer error
+// message.
 //
 // The write cursor will be advanced the number of bytes actually written in the
 // event of failure.
@@ -377,6 +466,17 @@ func (s *blockStore) blockFile(fileNum uint32) (*lockableFile, error) {
 // locked for writes.  Also, the write cursor current file must NOT be nil.
 func (s *blockStore) writeData(data []byte, fieldName string) error {
 	wc := s.writeCursor
+	if len(wc.buf)+len(data) > s.writeBufSize {
+		if err := s.flushWriteBuf(); err != nil {
+			return err
+		}
+	}
+	if len(data) < s.writeBufSize {
+		wc.buf = append(wc.buf, data...)
+		wc.curOffset += uint32(len(data))
+		return nil
+	}
+
 	n, err := wc.curFile.file.WriteAt(data, int64(wc.curOffset))
 	wc.curOffset += uint32(n)
 	if err != nil {
@@ -389,6 +489,44 @@ func (s *blockStore) writeData(data []byte, fieldName string) error {
 	return nil
 }
 
+// flushWriteBuf writes the buffered data to the current write block file.  The
+// buffer is emptied even when the write fails since the failure leads to a
+// rollback to a position before the buffered data.
+//
+// NOTE: This function MUST be called with the write cursor current file lock
+// held and must only be called during a write transaction so it is effectively
+// locked for writes.  Also, the write cursor current file must NOT be nil when
+// there is buffered data.
+func (s *blockStore) flushWriteBuf() error {
+	wc := s.writeCursor
+	if len(wc.buf) == 0 {
+		return nil
+	}
+
+	offset := wc.curOffset - uint32(len(wc.buf))
+	_, err := wc.curFile.file.WriteAt(wc.buf, int64(offset))
+	wc.buf = wc.buf[:0]
+	if err != nil {
+		str := fmt.Sprintf("failed to write buffered data to file %d at "+
+			"offset %d: %v", wc.curFileNum, offset, err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+
+	return nil
+}
+
+// flushWrites writes any buffered data to the current write block file.  It
+// must be called before the location of the data is made available to readers.
+//
+// NOTE: This function must only be called during a write transaction so it is
+// effectively locked for writes.
+func (s *blockStore) flushWrites() error {
+	wc := s.writeCursor
+	wc.curFile.Lock()
+	defer wc.curFile.Unlock()
+	return s.flushWriteBuf()
+}
+
 // writeBlock appends the specified raw block bytes to the store's write cursor
 // location and increments it accordingly.  When the block would exceed the max
 // file size for the current flat file, this function will close the current
@@ -427,11 +565,16 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 		// any readers currently reading from it.
 		wc.Lock()
 		wc.curFile.Lock()
+		err := s.flushWriteBuf()
 		if wc.curFile.file != nil {
 			_ = wc.curFile.file.Close()
 			wc.curFile.file = nil
 		}
 		wc.curFile.Unlock()
+		if err != nil {
+			wc.Unlock()
+			return blockLocation{}, err
+		}
 
 		// Start writes into next file.
 		wc.curFileNum++
@@ -484,6 +627,7 @@ func (s *blockStore) writeBlock(rawBlock []byte) (blockLocation, error) {
 		return blockLocation{}, err
 	}
 
+	atomic.AddUint64(&s.bytesWritten, uint64(fullLen))
 	loc := blockLocation{
 		blockFileNum: wc.curFileNum,
 		fileOffset:   origOffset,
@@ -514,6 +658,23 @@ func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte,
 		return nil, err
 	}
 
+	// Validate the block record in place when the file is memory-mapped so
+	// only the raw block needs to be copied out of the mapping.  The copy
+	// is required since the mapping is released when the file is closed.
+	if mf, ok := blockFile.file.(*mmapFile); ok {
+		if record, ok := mf.region(loc.fileOffset, loc.blockLen); ok {
+			atomic.AddUint64(&s.bytesRead, uint64(len(record)))
+			var rawBlock []byte
+			err := s.validateBlockRecord(hash, record)
+			if err == nil {
+				rawBlock = make([]byte, len(record)-12)
+				copy(rawBlock, record[8:])
+			}
+			blockFile.RUnlock()
+			return rawBlock, err
+		}
+	}
+
 	serializedData := make([]byte, loc.blockLen)
 	n, err := blockFile.file.ReadAt(serializedData, int64(loc.fileOffset))
 	blockFile.RUnlock()
@@ -523,6 +684,25 @@ func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte,
 			err)
 		return nil, makeDbErr(database.ErrDriverSpecific, str, err)
 	}
+	atomic.AddUint64(&s.bytesRead, uint64(n))
+	if err := s.validateBlockRecord(hash, serializedData[:n]); err != nil {
+		return nil, err
+	}
+
+	// The raw block excludes the network, length of the block, and
+	// checksum.
+	return serializedData[8 : n-4], nil
+}
+
+// validateBlockRecord ensures the integrity of the passed serialized block
+// record by checking that the serialized network matches the current network
+// associated with the block store and comparing the calculated checksum against
+// the one stored in the record.
+//
+// Returns ErrDriverSpecific if the network does not match and ErrCorruption if
+// the checksums do not match.
+func (s *blockStore) validateBlockRecord(hash *chainhash.Hash, serializedData []byte) error {
+	n := len(serializedData)
 
 	// Calculate the checksum of the read data and ensure it matches the
 	// serialized checksum.  This will detect any data corruption in the
@@ -534,7 +714,7 @@ func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte,
 		str := fmt.Sprintf("block data for block %s checksum "+
 			"does not match - got %x, want %x", hash,
 			calculatedChecksum, serializedChecksum)
-		return nil, makeDbErr(database.ErrCorruption, str, nil)
+		return makeDbErr(database.ErrCorruption, str, nil)
 	}
 
 	// The network associated with the block must match the current active
@@ -545,12 +725,10 @@ func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte,
 		str := fmt.Sprintf("block data for block %s is for the "+
 			"wrong network - got %d, want %d", hash, serializedNet,
 			uint32(s.network))
-		return nil, makeDbErr(database.ErrDriverSpecific, str, nil)
+		return makeDbErr(database.ErrDriverSpecific, str, nil)
 	}
 
-	// The raw block excludes the network, length of the block, and
-	// checksum.
-	return serializedData[8 : n-4], nil
+	return nil
 }
 
 // readBlockRegion reads the specified amount of data at the provided offset for
@@ -575,6 +753,14 @@ func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32)
 	// for block length.  Thus, add 8 bytes to adjust.
 	readOffset := loc.fileOffset + 8 + offset
 	serializedData := make([]byte, numBytes)
+	if mf, ok := blockFile.file.(*mmapFile); ok {
+		if region, ok := mf.region(readOffset, numBytes); ok {
+			atomic.AddUint64(&s.bytesRead, uint64(numBytes))
+			copy(serializedData, region)
+			blockFile.RUnlock()
+			return serializedData, nil
+		}
+	}
 	_, err = blockFile.file.ReadAt(serializedData, int64(readOffset))
 	blockFile.RUnlock()
 	if err != nil {
@@ -583,10 +769,27 @@ func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32)
 			numBytes, err)
 		return nil, makeDbErr(database.ErrDriverSpecific, str, err)
 	}
+	atomic.AddUint64(&s.bytesRead, uint64(numBytes))
 
 	return serializedData, nil
 }
 
+// numOpenFiles returns the number of block files which are open, including the
+// current write file.
+func (s *blockStore) numOpenFiles() int {
+	s.obfMutex.RLock()
+	numFiles := len(s.openBlockFiles)
+	s.obfMutex.RUnlock()
+
+	wc := s.writeCursor
+	wc.curFile.RLock()
+	if wc.curFile.file != nil {
+		numFiles++
+	}
+	wc.curFile.RUnlock()
+	return numFiles
+}
+
 // syncBlocks performs a file system sync on the flat file associated with the
 // store's current write cursor.  It is safe to call even when there is not a
 // current write file in which case it will have no effect.
@@ -653,6 +856,12 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 		return
 	}
 
+	// Discard any data which is still buffered since it is being rolled
+	// back.
+	wc.curFile.Lock()
+	wc.buf = wc.buf[:0]
+	wc.curFile.Unlock()
+
 	// Regardless of any failures that happen below, reposition the write
 	// cursor to the old block file and offset.
 	defer func() {
@@ -720,15 +929,17 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 func scanBlockFiles(dbPath string) (int, uint32) {
 	lastFile := -1
 	fileLen := uint32(0)
-	for i := 0; ; i++ {
-		filePath := blockFilePath(dbPath, uint32(i))
-		st, err := os.Stat(filePath)
-		if err != nil {
-			break
-		}
-		lastFile = i
 
-		fileLen = uint32(st.Size())
+	// The files before the most recent one might have been deleted once
+	// their blocks were deleted, so all files in the directory are
+	// considered rather than stopping at the first missing one.
+	if fileNums := blockFileNums(dbPath); len(fileNums) != 0 {
+		fileNum := fileNums[len(fileNums)-1]
+		st, err := os.Stat(blockFilePath(dbPath, fileNum))
+		if err == nil {
+			lastFile = int(fileNum)
+			fileLen = uint32(st.Size())
+		}
 	}
 
 	log.Tracef("Scan found latest block file #%d with length %d", lastFile,
@@ -736,9 +947,38 @@ func scanBlockFiles(dbPath string) (int, uint32) {
 	return lastFile, fileLen
 }
 
+// blockFileNums returns the sorted numbers of all flat block files in the
+// database directory.
+func blockFileNums(dbPath string) []uint32 {
+	files, err := ioutil.ReadDir(dbPath)
+	if err != nil {
+		return nil
+	}
+
+	fileNameLen := len(fmt.Sprintf(blockFilenameTemplate, 0))
+	var fileNums []uint32
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || len(name) != fileNameLen ||
+			!strings.HasSuffix(name, ".fdb") {
+
+			continue
+		}
+		fileNum, err := strconv.ParseUint(name[:len(name)-4], 10, 32)
+		if err != nil {
+			continue
+		}
+		fileNums = append(fileNums, uint32(fileNum))
+	}
+	sort.Slice(fileNums, func(i, j int) bool {
+		return fileNums[i] < fileNums[j]
+	})
+	return fileNums
+}
+
 // newBlockStore returns a new block store with the current block file number
-// and offset set and all fields initialized.
-func newBlockStore(basePath string, network wire.BitcoinNet) *blockStore {
+// and offset set and all fields initialized according to the passed options.
+func newBlockStore(basePath string, network wire.BitcoinNet, opts *Options) *blockStore {
 	// Look for the end of the latest block to file to determine what the
 	// write cursor position is from the viewpoing of the block files on
 	// disk.
@@ -748,10 +988,18 @@ func newBlockStore(basePath string, network wire.BitcoinNet) *blockStore {
 		fileOff = 0
 	}
 
+	blockFileSize := opts.BlockFileSize
+	if blockFileSize == 0 {
+		blockFileSize = maxBlockFileSize
+	}
+
 	store := &blockStore{
 		network:          network,
 		basePath:         basePath,
-		maxBlockFileSize: maxBlockFileSize,
+		maxBlockFileSize: blockFileSize,
+		mmapReads:        opts.MmapReads,
+		writeBufSize:     opts.WriteBufferSize,
+		preallocate:      opts.Preallocate,
 		openBlockFiles:   make(map[uint32]*lockableFile),
 		openBlocksLRU:    list.New(),
 		fileNumToLRUElem: make(map[uint32]*list.Element),
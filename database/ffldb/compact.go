@@ -0,0 +1,226 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// compactChunkSize is the approximate maximum number of on-disk bytes
+	// of metadata compacted at once during an idle compaction.  Compacting
+	// in chunks allows the compaction to be throttled and to be abandoned
+	// quickly once the database is written to again.
+	compactChunkSize = 32 * 1024 * 1024
+
+	// maxCompactPrefixLen is the maximum length of the key prefixes the
+	// key space is split by into chunks.  Ranges with longer common
+	// prefixes are compacted at once regardless of their size.
+	maxCompactPrefixLen = 6
+)
+
+// compactor compacts the metadata store during periods in which no write
+// transactions are committed so compactions are unlikely to coincide with the
+// processing of new blocks.  The compaction I/O may additionally be throttled
+// to a maximum rate.
+type compactor struct {
+	// The following variables must only be used atomically.
+	lastWrite int64 // Unix nanoseconds of the last committed write.
+	dirty     int32 // Whether written to since the last compaction.
+
+	meta     metadataStore
+	idleTime time.Duration
+	rate     uint64 // Bytes per second; zero for unlimited.
+
+	quit     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// newCompactor returns a new compactor for the passed metadata store which
+// compacts it after the passed duration without writes at the passed rate in
+// bytes per second.  A rate of zero disables throttling.
+func newCompactor(meta metadataStore, idleTime time.Duration, rate uint64) *compactor {
+	return &compactor{
+		lastWrite: time.Now().UnixNano(),
+		meta:      meta,
+		idleTime:  idleTime,
+		rate:      rate,
+		quit:      make(chan struct{}),
+	}
+}
+
+// noteWrite records that a write transaction was committed, which abandons any
+// compaction in progress and restarts the idle period.
+//
+// This function is safe for concurrent access.
+func (c *compactor) noteWrite() {
+	atomic.StoreInt64(&c.lastWrite, time.Now().UnixNano())
+	atomic.StoreInt32(&c.dirty, 1)
+}
+
+// idle returns how long it has been since the last committed write.
+func (c *compactor) idle() time.Duration {
+	lastWrite := time.Unix(0, atomic.LoadInt64(&c.lastWrite))
+	return time.Since(lastWrite)
+}
+
+// interrupted returns whether the compactor is shutting down or a write was
+// committed after the passed time.
+func (c *compactor) interrupted(start int64) bool {
+	select {
+	case <-c.quit:
+		return true
+	default:
+	}
+	return atomic.LoadInt64(&c.lastWrite) != start
+}
+
+// prefixLimit returns the smallest key which is greater than all keys with the
+// passed prefix or nil when there is no such key.
+func prefixLimit(prefix []byte) []byte {
+	limit := copySlice(prefix)
+	for i := len(limit) - 1; i >= 0; i-- {
+		limit[i]++
+		if limit[i] != 0 {
+			return limit[:i+1]
+		}
+	}
+	return nil
+}
+
+// compactPrefix compacts all keys with the passed prefix in chunks of roughly
+// compactChunkSize bytes, throttled to the configured rate.  It returns false
+// when the compaction was interrupted before it finished.
+func (c *compactor) compactPrefix(prefix []byte, start int64) (bool, error) {
+	if c.interrupted(start) {
+		return false, nil
+	}
+
+	limit := prefixLimit(prefix)
+	size, err := c.meta.SizeOf(prefix, limit)
+	if err != nil {
+		return false, err
+	}
+
+	// Nothing needs to be compacted in ranges without data on disk.  The
+	// whole key space is always compacted though since the data which is
+	// not on disk yet is flushed to it by compacting.
+	if size == 0 && len(prefix) != 0 {
+		return true, nil
+	}
+
+	// Split the range into the ranges of the next longer prefixes when it
+	// is too large to compact at once.  The key which is equal to the
+	// prefix itself is not covered by any of them, so it is compacted
+	// separately.
+	if size > compactChunkSize && len(prefix) < maxCompactPrefixLen {
+		if len(prefix) != 0 {
+			err := c.meta.CompactRange(prefix, append(prefix, 0))
+			if err != nil {
+				return false, err
+			}
+		}
+		for i := 0; i < 256; i++ {
+			subPrefix := append(copySlice(prefix), byte(i))
+			finished, err := c.compactPrefix(subPrefix, start)
+			if !finished || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	compactStart := time.Now()
+	if err := c.meta.CompactRange(prefix, limit); err != nil {
+		return false, err
+	}
+
+	// Throttle the compaction by waiting until the chunk would have taken
+	// at the configured rate.
+	if c.rate == 0 {
+		return true, nil
+	}
+	target := time.Duration(float64(size) / float64(c.rate) *
+		float64(time.Second))
+	wait := target - time.Since(compactStart)
+	if wait <= 0 {
+		return true, nil
+	}
+	select {
+	case <-time.After(wait):
+	case <-c.quit:
+		return false, nil
+	}
+	return true, nil
+}
+
+// compact compacts the whole metadata store unless it is written to or the
+// compactor is stopped in the mean time.
+func (c *compactor) compact() {
+	start := atomic.LoadInt64(&c.lastWrite)
+	atomic.StoreInt32(&c.dirty, 0)
+
+	log.Debugf("Compacting metadata after %v without writes",
+		c.idle().Truncate(time.Second))
+	compactStart := time.Now()
+	finished, err := c.compactPrefix(nil, start)
+	if err != nil {
+		log.Warnf("Failed to compact metadata: %v", err)
+		return
+	}
+	if !finished {
+		// Try again during the next idle period.
+		atomic.StoreInt32(&c.dirty, 1)
+		log.Debugf("Metadata compaction interrupted after %v",
+			time.Since(compactStart).Truncate(time.Millisecond))
+		return
+	}
+	log.Debugf("Compacted metadata in %v",
+		time.Since(compactStart).Truncate(time.Millisecond))
+}
+
+// compactHandler waits for idle periods and compacts the metadata store when
+// it has been written to since the last compaction.  It must be run as a
+// goroutine.
+func (c *compactor) compactHandler() {
+	defer c.wg.Done()
+
+	timer := time.NewTimer(c.idleTime)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-c.quit:
+			return
+		}
+
+		if idle := c.idle(); idle < c.idleTime {
+			timer.Reset(c.idleTime - idle)
+			continue
+		}
+		if atomic.LoadInt32(&c.dirty) != 0 {
+			c.compact()
+		}
+		timer.Reset(c.idleTime)
+	}
+}
+
+// Start begins compacting the metadata store during idle periods.
+func (c *compactor) Start() {
+	c.wg.Add(1)
+	go c.compactHandler()
+}
+
+// Stop stops the compactor and waits for any compaction of a chunk in
+// progress to finish.  It may be called multiple times.
+func (c *compactor) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.quit)
+		c.wg.Wait()
+	})
+}
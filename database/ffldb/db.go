@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
@@ -22,16 +23,18 @@ import (
 	"github.com/btcsuite/goleveldb/leveldb"
 	"github.com/btcsuite/goleveldb/leveldb/comparer"
 	ldberrors "github.com/btcsuite/goleveldb/leveldb/errors"
-	"github.com/btcsuite/goleveldb/leveldb/filter"
 	"github.com/btcsuite/goleveldb/leveldb/iterator"
-	"github.com/btcsuite/goleveldb/leveldb/opt"
 	"github.com/btcsuite/goleveldb/leveldb/util"
 )
 
 const (
-	// metadataDbName is the name used for the metadata database.
+	// metadataDbName is the name used for the leveldb metadata database.
 	metadataDbName = "metadata"
 
+	// pebbleMetadataDbName is the name used for the Pebble metadata
+	// database.
+	pebbleMetadataDbName = "metadata-pebble"
+
 	// blockHdrSize is the size of a block header.  This is simply the
 	// constant from wire and is only provided here for convenience since
 	// wire.MaxBlockHeaderPayload is quite long.
@@ -140,6 +143,10 @@ func convertErr(desc string, ldbErr error) database.Error {
 	var code = database.ErrDriverSpecific
 
 	switch {
+	// Errors which were already converted by a metadata store.
+	case isDbError(ldbErr):
+		code = ldbErr.(database.Error).ErrorCode
+
 	// Database corruption errors.
 	case ldberrors.IsCorrupted(ldbErr):
 		code = database.ErrCorruption
@@ -158,6 +165,12 @@ func convertErr(desc string, ldbErr error) database.Error {
 	return database.Error{ErrorCode: code, Description: desc, Err: ldbErr}
 }
 
+// isDbError returns whether the passed error is a database.Error.
+func isDbError(err error) bool {
+	_, ok := err.(database.Error)
+	return ok
+}
+
 // copySlice returns a copy of the passed slice.  This is mostly used to copy
 // leveldb iterator keys and values since they are only valid until the iterator
 // is moved instead of during the entirety of the transaction.
@@ -966,6 +979,11 @@ type transaction struct {
 	pendingBlocks    map[chainhash.Hash]int
 	pendingBlockData []pendingBlock
 
+	// deletedBlocks tracks whether stored blocks were deleted, in which
+	// case the block files which no longer hold any blocks are deleted on
+	// commit.
+	deletedBlocks bool
+
 	// Keys that need to be stored or deleted on commit.
 	pendingKeys   *treap.Mutable
 	pendingRemove *treap.Mutable
@@ -1189,6 +1207,82 @@ func (tx *transaction) StoreBlock(block *btcutil.Block) error {
 	return nil
 }
 
+// DeleteBlock removes the block identified by the given hash from the
+// database.  The block is removed from the block index, and the flat block
+// files which no longer hold any blocks are deleted when the transaction is
+// committed.  Since blocks are appended to the files in the order they are
+// stored, the space is reclaimed once all blocks in a file have been deleted.
+//
+// Returns the following errors as required by the interface contract:
+//   - ErrBlockNotFound if the requested block hash does not exist
+//   - ErrTxNotWritable if attempted against a read-only transaction
+//   - ErrTxClosed if the transaction has already been closed
+//
+// This function is part of the database.Tx interface implementation.
+func (tx *transaction) DeleteBlock(hash *chainhash.Hash) error {
+	// Ensure transaction state is valid.
+	if err := tx.checkClosed(); err != nil {
+		return err
+	}
+
+	// Ensure the transaction is writable.
+	if !tx.writable {
+		str := "delete block requires a writable database transaction"
+		return makeDbErr(database.ErrTxNotWritable, str, nil)
+	}
+
+	// Blocks which are pending to be stored by this transaction are simply
+	// no longer written on commit.
+	if idx, exists := tx.pendingBlocks[*hash]; exists {
+		delete(tx.pendingBlocks, *hash)
+		tx.pendingBlockData[idx].bytes = nil
+		return nil
+	}
+
+	if !tx.hasKey(bucketizedKey(blockIdxBucketID, hash[:])) {
+		str := fmt.Sprintf("block %s does not exist", hash)
+		return makeDbErr(database.ErrBlockNotFound, str, nil)
+	}
+	if err := tx.blockIdxBucket.Delete(hash[:]); err != nil {
+		return err
+	}
+	tx.deletedBlocks = true
+	log.Tracef("Deleted block %s", hash)
+
+	return nil
+}
+
+// unusedBlockFiles returns the numbers of the flat block files which do not
+// hold any of the blocks in the block index from the viewpoint of the
+// transaction.  The current write file is never considered unused.
+func (tx *transaction) unusedBlockFiles() ([]uint32, error) {
+	wc := tx.db.store.writeCursor
+	wc.RLock()
+	curFileNum := wc.curFileNum
+	wc.RUnlock()
+
+	usedFiles := make(map[uint32]struct{})
+	err := tx.blockIdxBucket.ForEach(func(k, v []byte) error {
+		loc := deserializeBlockLoc(v)
+		usedFiles[loc.blockFileNum] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var unusedFiles []uint32
+	for _, fileNum := range blockFileNums(tx.db.store.basePath) {
+		if fileNum >= curFileNum {
+			break
+		}
+		if _, ok := usedFiles[fileNum]; !ok {
+			unusedFiles = append(unusedFiles, fileNum)
+		}
+	}
+	return unusedFiles, nil
+}
+
 // HasBlock returns whether or not a block with the given hash exists in the
 // database.
 //
@@ -1638,6 +1732,11 @@ func (tx *transaction) writePendingAndCommit() error {
 
 	// Loop through all of the pending blocks to store and write them.
 	for _, blockData := range tx.pendingBlockData {
+		// Skip blocks which were deleted after they were stored.
+		if blockData.bytes == nil {
+			continue
+		}
+
 		log.Tracef("Storing block %s", blockData.hash)
 		location, err := tx.db.store.writeBlock(blockData.bytes)
 		if err != nil {
@@ -1657,6 +1756,13 @@ func (tx *transaction) writePendingAndCommit() error {
 		}
 	}
 
+	// Write any block data which is still buffered to the block files so
+	// it can be read once the block index is updated.
+	if err := tx.db.store.flushWrites(); err != nil {
+		rollback()
+		return err
+	}
+
 	// Update the metadata for the current write file and offset.
 	writeRow := serializeWriteRow(wc.curFileNum, wc.curOffset)
 	if err := tx.metaBucket.Put(writeLocKeyName, writeRow); err != nil {
@@ -1664,9 +1770,44 @@ func (tx *transaction) writePendingAndCommit() error {
 		return convertErr("failed to store write cursor", err)
 	}
 
+	// Determine the block files which no longer hold any blocks when
+	// blocks were deleted so they can be deleted once the block index is
+	// updated.
+	var unusedFiles []uint32
+	if tx.deletedBlocks {
+		var err error
+		unusedFiles, err = tx.unusedBlockFiles()
+		if err != nil {
+			rollback()
+			return err
+		}
+	}
+
 	// Atomically update the database cache.  The cache automatically
 	// handles flushing to the underlying persistent storage database.
-	return tx.db.cache.commitTx(tx)
+	if err := tx.db.cache.commitTx(tx); err != nil {
+		return err
+	}
+	if tx.db.compactor != nil {
+		tx.db.compactor.noteWrite()
+	}
+
+	// Flush the cache so the block index no longer references the unused
+	// block files in persistent storage before deleting them.  Files left
+	// behind when the process is interrupted are deleted the next time
+	// blocks are deleted.
+	if len(unusedFiles) != 0 {
+		if err := tx.db.cache.flush(); err != nil {
+			return err
+		}
+
+		// Backups in progress might still be reading the files, so
+		// they are left for the next deletion in that case.
+		if atomic.LoadInt32(&tx.db.backups) == 0 {
+			tx.db.store.removeFiles(unusedFiles)
+		}
+	}
+	return nil
 }
 
 // Commit commits all changes that have been made to the root metadata bucket
@@ -1727,11 +1868,23 @@ func (tx *transaction) Rollback() error {
 // the database.DB interface.  All database access is performed through
 // transactions which are obtained through the specific Namespace.
 type db struct {
-	writeLock sync.Mutex   // Limit to one write transaction at a time.
-	closeLock sync.RWMutex // Make database close block while txns active.
-	closed    bool         // Is the database closed?
-	store     *blockStore  // Handles read/writing blocks to flat files.
-	cache     *dbCache     // Cache layer which wraps underlying leveldb DB.
+	writeLock sync.Mutex       // Limit to one write transaction at a time.
+	closeLock sync.RWMutex     // Make database close block while txns active.
+	closed    bool             // Is the database closed?
+	store     *blockStore      // Handles read/writing blocks to flat files.
+	cache     *dbCache         // Cache layer which wraps the metadata store.
+	backend   *metadataBackend // Backend of the metadata store.
+	compactor *compactor       // Compacts the metadata when idle, if any.
+	backups   int32            // Number of backups in progress (atomic).
+	readOnly  bool             // Is the database open read-only?
+
+	// snapshotPath is the path of the snapshot of the metadata store which
+	// is read when the database is open read-only.
+	snapshotPath string
+
+	// repairReport describes the repairs made while opening the database
+	// when it was scanned for corruption.
+	repairReport *RepairReport
 }
 
 // Enforce db implements the database.DB interface.
@@ -1742,7 +1895,28 @@ var _ database.DB = (*db)(nil)
 //
 // This function is part of the database.DB interface implementation.
 func (db *db) Type() string {
-	return dbType
+	return db.backend.dbType
+}
+
+// Stats returns counters which describe the activity of the database since it
+// was opened.  Metadata lookups are counted as cache hits when they are answered
+// by the database cache, and block reads are counted as block file hits when the
+// block file was already open.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Stats() *database.Stats {
+	cache, store := db.cache, db.store
+	return &database.Stats{
+		MetadataCacheHits:    atomic.LoadUint64(&cache.hits),
+		MetadataCacheMisses:  atomic.LoadUint64(&cache.misses),
+		MetadataBytesRead:    atomic.LoadUint64(&cache.bytesRead),
+		MetadataBytesWritten: atomic.LoadUint64(&cache.bytesWritten),
+		BlockFileHits:        atomic.LoadUint64(&store.fileHits),
+		BlockFileMisses:      atomic.LoadUint64(&store.fileMisses),
+		BlockBytesRead:       atomic.LoadUint64(&store.bytesRead),
+		BlockBytesWritten:    atomic.LoadUint64(&store.bytesWritten),
+		OpenFiles:            store.numOpenFiles(),
+	}
 }
 
 // begin is the implementation function for the Begin database method.  See its
@@ -1752,6 +1926,13 @@ func (db *db) Type() string {
 // which is used by the managed transaction code while the database method
 // returns the interface.
 func (db *db) begin(writable bool) (*transaction, error) {
+	// Write transactions are not allowed when the database is open
+	// read-only.
+	if writable && db.readOnly {
+		return nil, makeDbErr(database.ErrTxNotWritable,
+			errDbReadOnlyStr, nil)
+	}
+
 	// Whenever a new writable transaction is started, grab the write lock
 	// to ensure only a single write transaction can be active at the same
 	// time.  This lock will not be released until the transaction is
@@ -1904,6 +2085,12 @@ func (db *db) Update(fn func(database.Tx) error) error {
 //
 // This function is part of the database.DB interface implementation.
 func (db *db) Close() error {
+	// Stop compacting before waiting for the transactions since the
+	// compactor uses the metadata store outside of them.
+	if db.compactor != nil {
+		db.compactor.Stop()
+	}
+
 	// Since all transactions have a read lock on this mutex, this will
 	// cause Close to wait for all readers to complete.
 	db.closeLock.Lock()
@@ -1938,6 +2125,19 @@ func (db *db) Close() error {
 	db.store.openBlocksLRU.Init()
 	db.store.fileNumToLRUElem = nil
 
+	// Mark the database as closed cleanly once everything was synced.
+	// The marker belongs to the process which has the database open for
+	// writing when it is open read-only.
+	if closeErr == nil && !db.readOnly {
+		_ = os.Remove(openMarkerPath(db.store.basePath))
+	}
+
+	// Remove the snapshot of the metadata store a read-only database was
+	// reading.
+	if db.snapshotPath != "" {
+		_ = os.RemoveAll(db.snapshotPath)
+	}
+
 	return closeErr
 }
 
@@ -1953,10 +2153,10 @@ func fileExists(name string) bool {
 
 // initDB creates the initial buckets and values used by the package.  This is
 // mainly in a separate function for testing purposes.
-func initDB(ldb *leveldb.DB) error {
+func initDB(meta metadataStore) error {
 	// The starting block file write cursor location is file num 0, offset
 	// 0.
-	batch := new(leveldb.Batch)
+	batch := treap.NewMutable()
 	batch.Put(bucketizedKey(metadataBucketID, writeLocKeyName),
 		serializeWriteRow(0, 0))
 
@@ -1971,7 +2171,7 @@ func initDB(ldb *leveldb.DB) error {
 	batch.Put(curBucketIDKeyName, blockIdxBucketID[:])
 
 	// Write everything as a single batch.
-	if err := ldb.Write(batch, nil); err != nil {
+	if err := meta.Write(batch, treap.NewMutable()); err != nil {
 		str := fmt.Sprintf("failed to initialize metadata database: %v",
 			err)
 		return convertErr(str, err)
@@ -1980,47 +2180,63 @@ func initDB(ldb *leveldb.DB) error {
 	return nil
 }
 
-// openDB opens the database at the provided path.  database.ErrDbDoesNotExist
-// is returned if the database doesn't exist and the create flag is not set.
-func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, error) {
+// openDB opens the database at the provided path using the passed options and
+// metadata backend.  database.ErrDbDoesNotExist is returned if the database
+// doesn't exist and the create flag is not set.
+func openDB(dbPath string, network wire.BitcoinNet, create bool, dbOpts *Options,
+	backend *metadataBackend) (database.DB, error) {
+
 	// Error if the database doesn't exist and the create flag is not set.
-	metadataDbPath := filepath.Join(dbPath, metadataDbName)
+	metadataDbPath := filepath.Join(dbPath, backend.dirName)
 	dbExists := fileExists(metadataDbPath)
 	if !create && !dbExists {
 		str := fmt.Sprintf("database %q does not exist", metadataDbPath)
 		return nil, makeDbErr(database.ErrDbDoesNotExist, str, nil)
 	}
 
+	// Read-only databases are opened from a snapshot of the metadata.
+	if dbOpts.ReadOnly {
+		if create {
+			str := "a database can't be created read-only"
+			return nil, makeDbErr(database.ErrDriverSpecific, str,
+				nil)
+		}
+		return openReadOnlyDB(dbPath, network, dbOpts, backend)
+	}
+
 	// Ensure the full path to the database exists.
 	if !dbExists {
-		// The error can be ignored here since the call to
-		// leveldb.OpenFile will fail if the directory couldn't be
-		// created.
+		// The error can be ignored here since opening the metadata
+		// store will fail if the directory couldn't be created.
 		_ = os.MkdirAll(dbPath, 0700)
 	}
 
-	// Open the metadata database (will create it if needed).
-	opts := opt.Options{
-		ErrorIfExist: create,
-		Strict:       opt.DefaultStrict,
-		Compression:  opt.NoCompression,
-		Filter:       filter.NewBloomFilter(10),
-	}
-	ldb, err := leveldb.OpenFile(metadataDbPath, &opts)
+	// Open the metadata store (will create it if needed).
+	meta, err := backend.open(metadataDbPath, create)
 	if err != nil {
-		return nil, convertErr(err.Error(), err)
+		return nil, err
 	}
 
 	// Create the block store which includes scanning the existing flat
 	// block files to find what the current write cursor position is
 	// according to the data that is actually on disk.  Also create the
-	// database cache which wraps the underlying leveldb database to provide
+	// database cache which wraps the underlying metadata store to provide
 	// write caching.
-	store := newBlockStore(dbPath, network)
-	cache := newDbCache(ldb, store, defaultCacheSize, defaultFlushSecs)
-	pdb := &db{store: store, cache: cache}
+	store := newBlockStore(dbPath, network, dbOpts)
+	cache := newDbCache(meta, store, defaultCacheSize, defaultFlushSecs)
+	pdb := &db{store: store, cache: cache, backend: backend}
 
 	// Perform any reconciliation needed between the block and metadata as
 	// well as database initialization, if needed.
-	return reconcileDB(pdb, create)
+	if _, err := reconcileDB(pdb, create, dbOpts.fullRepair); err != nil {
+		return nil, err
+	}
+
+	// Compact the metadata during idle periods when requested.
+	if dbOpts.CompactIdleTime > 0 {
+		pdb.compactor = newCompactor(meta, dbOpts.CompactIdleTime,
+			dbOpts.CompactRate)
+		pdb.compactor.Start()
+	}
+	return pdb, nil
 }
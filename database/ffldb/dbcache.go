@@ -6,12 +6,11 @@ package ffldb
 
 import (
 	"bytes"
-	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/btcsuite/btcd/database/internal/treap"
-	"github.com/btcsuite/goleveldb/leveldb"
 	"github.com/btcsuite/goleveldb/leveldb/iterator"
 	"github.com/btcsuite/goleveldb/leveldb/util"
 )
@@ -285,7 +284,8 @@ func (iter *dbCacheIterator) Error() error {
 // dbCacheSnapshot defines a snapshot of the database cache and underlying
 // database at a particular point in time.
 type dbCacheSnapshot struct {
-	dbSnapshot    *leveldb.Snapshot
+	cache         *dbCache
+	dbSnapshot    metadataSnapshot
 	pendingKeys   *treap.Immutable
 	pendingRemove *treap.Immutable
 }
@@ -294,14 +294,17 @@ type dbCacheSnapshot struct {
 func (snap *dbCacheSnapshot) Has(key []byte) bool {
 	// Check the cached entries first.
 	if snap.pendingRemove.Has(key) {
+		atomic.AddUint64(&snap.cache.hits, 1)
 		return false
 	}
 	if snap.pendingKeys.Has(key) {
+		atomic.AddUint64(&snap.cache.hits, 1)
 		return true
 	}
 
 	// Consult the database.
-	hasKey, _ := snap.dbSnapshot.Has(key, nil)
+	atomic.AddUint64(&snap.cache.misses, 1)
+	hasKey, _ := snap.dbSnapshot.Has(key)
 	return hasKey
 }
 
@@ -310,17 +313,21 @@ func (snap *dbCacheSnapshot) Has(key []byte) bool {
 func (snap *dbCacheSnapshot) Get(key []byte) []byte {
 	// Check the cached entries first.
 	if snap.pendingRemove.Has(key) {
+		atomic.AddUint64(&snap.cache.hits, 1)
 		return nil
 	}
 	if value := snap.pendingKeys.Get(key); value != nil {
+		atomic.AddUint64(&snap.cache.hits, 1)
 		return value
 	}
 
 	// Consult the database.
-	value, err := snap.dbSnapshot.Get(key, nil)
+	atomic.AddUint64(&snap.cache.misses, 1)
+	value, err := snap.dbSnapshot.Get(key)
 	if err != nil {
 		return nil
 	}
+	atomic.AddUint64(&snap.cache.bytesRead, uint64(len(value)))
 	return value
 }
 
@@ -340,7 +347,7 @@ func (snap *dbCacheSnapshot) Release() {
 // can be nil if the functionality is not desired.
 func (snap *dbCacheSnapshot) NewIterator(slice *util.Range) *dbCacheIterator {
 	return &dbCacheIterator{
-		dbIter:        snap.dbSnapshot.NewIterator(slice, nil),
+		dbIter:        snap.dbSnapshot.NewIterator(slice),
 		cacheIter:     newLdbCacheIter(snap, slice),
 		cacheSnapshot: snap,
 	}
@@ -354,8 +361,15 @@ func (snap *dbCacheSnapshot) NewIterator(slice *util.Range) *dbCacheIterator {
 // can commit transactions at will without incurring large performance hits due
 // to frequent disk syncs.
 type dbCache struct {
-	// ldb is the underlying leveldb DB for metadata.
-	ldb *leveldb.DB
+	// The following variables are statistics which must only be used
+	// atomically.
+	hits         uint64 // Lookups answered by the cached entries.
+	misses       uint64 // Lookups which consulted the metadata store.
+	bytesRead    uint64 // Bytes of values read from the metadata store.
+	bytesWritten uint64 // Bytes of keys and values written to the store.
+
+	// meta is the underlying key/value store for metadata.
+	meta metadataStore
 
 	// store is used to sync blocks to flat files.
 	store *blockStore
@@ -396,7 +410,7 @@ type dbCache struct {
 //
 // The snapshot must be released after use by calling Release.
 func (c *dbCache) Snapshot() (*dbCacheSnapshot, error) {
-	dbSnapshot, err := c.ldb.GetSnapshot()
+	dbSnapshot, err := c.meta.Snapshot()
 	if err != nil {
 		str := "failed to open transaction"
 		return nil, convertErr(str, err)
@@ -407,6 +421,7 @@ func (c *dbCache) Snapshot() (*dbCacheSnapshot, error) {
 	// which is used to atomically swap the root.
 	c.cacheLock.RLock()
 	cacheSnapshot := &dbCacheSnapshot{
+		cache:         c,
 		dbSnapshot:    dbSnapshot,
 		pendingKeys:   c.cachedKeys,
 		pendingRemove: c.cachedRemove,
@@ -415,30 +430,6 @@ func (c *dbCache) Snapshot() (*dbCacheSnapshot, error) {
 	return cacheSnapshot, nil
 }
 
-// updateDB invokes the passed function in the context of a managed leveldb
-// transaction.  Any errors returned from the user-supplied function will cause
-// the transaction to be rolled back and are returned from this function.
-// Otherwise, the transaction is committed when the user-supplied function
-// returns a nil error.
-func (c *dbCache) updateDB(fn func(ldbTx *leveldb.Transaction) error) error {
-	// Start a leveldb transaction.
-	ldbTx, err := c.ldb.OpenTransaction()
-	if err != nil {
-		return convertErr("failed to open ldb transaction", err)
-	}
-
-	if err := fn(ldbTx); err != nil {
-		ldbTx.Discard()
-		return err
-	}
-
-	// Commit the leveldb transaction and convert any errors as needed.
-	if err := ldbTx.Commit(); err != nil {
-		return convertErr("failed to commit leveldb transaction", err)
-	}
-	return nil
-}
-
 // TreapForEacher is an interface which allows iteration of a treap in ascending
 // order using a user-supplied callback for each key/value pair.  It mainly
 // exists so both mutable and immutable treaps can be atomically committed to
@@ -450,34 +441,22 @@ type TreapForEacher interface {
 // commitTreaps atomically commits all of the passed pending add/update/remove
 // updates to the underlying database.
 func (c *dbCache) commitTreaps(pendingKeys, pendingRemove TreapForEacher) error {
-	// Perform all leveldb updates using an atomic transaction.
-	return c.updateDB(func(ldbTx *leveldb.Transaction) error {
-		var innerErr error
-		pendingKeys.ForEach(func(k, v []byte) bool {
-			if dbErr := ldbTx.Put(k, v, nil); dbErr != nil {
-				str := fmt.Sprintf("failed to put key %q to "+
-					"ldb transaction", k)
-				innerErr = convertErr(str, dbErr)
-				return false
-			}
-			return true
-		})
-		if innerErr != nil {
-			return innerErr
-		}
+	if err := c.meta.Write(pendingKeys, pendingRemove); err != nil {
+		return err
+	}
 
-		pendingRemove.ForEach(func(k, v []byte) bool {
-			if dbErr := ldbTx.Delete(k, nil); dbErr != nil {
-				str := fmt.Sprintf("failed to delete "+
-					"key %q from ldb transaction",
-					k)
-				innerErr = convertErr(str, dbErr)
-				return false
-			}
-			return true
-		})
-		return innerErr
+	// Account for the written keys and values in the statistics.
+	var numBytes uint64
+	pendingKeys.ForEach(func(k, v []byte) bool {
+		numBytes += uint64(len(k) + len(v))
+		return true
+	})
+	pendingRemove.ForEach(func(k, v []byte) bool {
+		numBytes += uint64(len(k))
+		return true
 	})
+	atomic.AddUint64(&c.bytesWritten, numBytes)
+	return nil
 }
 
 // flush flushes the database cache to persistent storage.  This involes syncing
@@ -509,7 +488,7 @@ func (c *dbCache) flush() error {
 		return nil
 	}
 
-	// Perform all leveldb updates using an atomic transaction.
+	// Perform all metadata updates using an atomic write.
 	if err := c.commitTreaps(cachedKeys, cachedRemove); err != nil {
 		return err
 	}
@@ -572,7 +551,7 @@ func (c *dbCache) commitTx(tx *transaction) error {
 			return err
 		}
 
-		// Perform all leveldb updates using an atomic transaction.
+		// Perform all metadata updates using an atomic write.
 		err := c.commitTreaps(tx.pendingKeys, tx.pendingRemove)
 		if err != nil {
 			return err
@@ -621,7 +600,7 @@ func (c *dbCache) commitTx(tx *transaction) error {
 }
 
 // Close cleanly shuts down the database cache by syncing all data and closing
-// the underlying leveldb database.
+// the underlying metadata store.
 //
 // This function MUST be called with the database write lock held.
 func (c *dbCache) Close() error {
@@ -630,26 +609,21 @@ func (c *dbCache) Close() error {
 		// Even if there is an error while flushing, attempt to close
 		// the underlying database.  The error is ignored since it would
 		// mask the flush error.
-		_ = c.ldb.Close()
+		_ = c.meta.Close()
 		return err
 	}
 
-	// Close the underlying leveldb database.
-	if err := c.ldb.Close(); err != nil {
-		str := "failed to close underlying leveldb database"
-		return convertErr(str, err)
-	}
-
-	return nil
+	// Close the underlying metadata store.
+	return c.meta.Close()
 }
 
 // newDbCache returns a new database cache instance backed by the provided
-// leveldb instance.  The cache will be flushed to leveldb when the max size
+// metadata store.  The cache will be flushed to the store when the max size
 // exceeds the provided value or it has been longer than the provided interval
 // since the last flush.
-func newDbCache(ldb *leveldb.DB, store *blockStore, maxSize uint64, flushIntervalSecs uint32) *dbCache {
+func newDbCache(meta metadataStore, store *blockStore, maxSize uint64, flushIntervalSecs uint32) *dbCache {
 	return &dbCache{
-		ldb:           ldb,
+		meta:          meta,
 		store:         store,
 		maxSize:       maxSize,
 		flushInterval: time.Second * time.Duration(flushIntervalSecs),
@@ -25,5 +25,61 @@ database path as a string and the block network:
 	if err != nil {
 		// Handle error
 	}
+
+A second database type of "pebble" is also provided which uses the same flat
+files for block storage, but keeps the metadata in Pebble instead of leveldb.
+It offers higher write throughput on fast storage such as NVMe drives.  An
+existing database may be converted between the two types with Migrate:
+
+	err := ffldb.Migrate("ffldb", "path/to/database", "pebble",
+		"path/to/pebble-database")
+	if err != nil {
+		// Handle error
+	}
+
+The Backup and BackupToPath methods of the database write a consistent backup of
+all metadata and blocks while the database remains in use.  A backup may be
+restored into a new database of either type with Restore:
+
+	err := ffldb.Restore("ffldb", "path/to/database", wire.MainNet, r)
+	if err != nil {
+		// Handle error
+	}
+
+When a database which was not closed cleanly is opened, the end of the current
+block file is scanned for torn writes, which are truncated, and blocks whose data
+was lost are removed.  A full scan which verifies the checksums of all blocks may
+be performed with ScanAndRepair while the database is not open:
+
+	report, err := ffldb.ScanAndRepair("ffldb", "path/to/database",
+		wire.MainNet)
+	if err != nil {
+		// Handle error
+	}
+
+An optional third parameter of type *Options may be provided to change the
+behavior of the driver.  For example, block files which are no longer written
+to can be memory-mapped for reading on supported platforms:
+
+	opts := &ffldb.Options{MmapReads: true}
+	db, err := database.Open("ffldb", "path/to/database", wire.MainNet, opts)
+	if err != nil {
+		// Handle error
+	}
+
+The size of the block files, a buffer block data is collected in before it is
+written, and the preallocation of the disk space of block files may be tuned
+through the options as well to suit the underlying storage.
+
+A database may also be opened read-only while another process has it open for
+writing, such as to run analytics against the data directory of a running node.
+It then provides a view of the data which was flushed to disk when it was
+opened:
+
+	opts := &ffldb.Options{ReadOnly: true}
+	db, err := database.Open("ffldb", "path/to/database", wire.MainNet, opts)
+	if err != nil {
+		// Handle error
+	}
 */
 package ffldb
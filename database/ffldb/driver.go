@@ -6,6 +6,7 @@ package ffldb
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/wire"
@@ -14,53 +15,162 @@ import (
 
 var log = btclog.Disabled
 
-const (
-	dbType = "ffldb"
+// metadataBackend describes a key/value store the metadata of a database can be
+// kept in along with the name of the database driver which uses it.
+type metadataBackend struct {
+	// dbType is the type of the database driver.
+	dbType string
+
+	// dirName is the name of the directory of the metadata store inside
+	// the database directory.
+	dirName string
+
+	// open opens the metadata store at the passed path.  It is created
+	// when it does not exist, and an error is returned when the create
+	// flag is set and it exists.
+	open func(path string, create bool) (metadataStore, error)
+
+	// openReadOnly opens the existing metadata store at the passed path
+	// read-only.
+	openReadOnly func(path string) (metadataStore, error)
+}
+
+var (
+	// ldbBackend keeps the metadata in leveldb.  It is the backend of the
+	// ffldb driver.
+	ldbBackend = &metadataBackend{
+		dbType:       "ffldb",
+		dirName:      metadataDbName,
+		open:         openLdbStore,
+		openReadOnly: openLdbStoreReadOnly,
+	}
+
+	// pebbleBackend keeps the metadata in Pebble.  It is the backend of the
+	// pebble driver.
+	pebbleBackend = &metadataBackend{
+		dbType:       "pebble",
+		dirName:      pebbleMetadataDbName,
+		open:         openPebbleStore,
+		openReadOnly: openPebbleStoreReadOnly,
+	}
+
+	// backends are the metadata backends a driver is registered for.
+	backends = []*metadataBackend{ldbBackend, pebbleBackend}
 )
 
-// parseArgs parses the arguments from the database Open/Create methods.
-func parseArgs(funcName string, args ...interface{}) (string, wire.BitcoinNet, error) {
-	if len(args) != 2 {
-		return "", 0, fmt.Errorf("invalid arguments to %s.%s -- "+
+// Options houses optional settings which may be passed as the third argument
+// to the database Open/Create methods.
+type Options struct {
+	// MmapReads specifies whether block files which are no longer written
+	// to are memory-mapped for reading.  Block files which can't be mapped,
+	// such as on platforms without support for it, fall back to regular
+	// reads.
+	MmapReads bool
+
+	// BlockFileSize is the maximum size in bytes of the flat files blocks
+	// are stored in.  Blocks which don't fit into the current file are
+	// written to a new one, so the size may be changed for an existing
+	// database.  A value of zero selects the default size of 512 MiB.
+	BlockFileSize uint32
+
+	// WriteBufferSize is the number of bytes of block data which is
+	// buffered before it is written to the current block file.  Writes of
+	// the blocks stored by a transaction are combined in the buffer, which
+	// reduces the number of writes on storage with high per write costs
+	// such as network storage.  Buffered data is always written before
+	// the transaction is committed.  A value of zero disables buffering.
+	WriteBufferSize int
+
+	// Preallocate specifies whether the disk space of a block file is
+	// allocated up to BlockFileSize when it is opened for writing, which
+	// reduces fragmentation on file systems with support for it.  The
+	// reported size of the file is not changed.  It has no benefit on copy
+	// on write file systems such as ZFS and btrfs.
+	Preallocate bool
+
+	// ReadOnly specifies whether the database is opened read-only, which
+	// is possible while another process has it open for writing.  The
+	// database then provides a view of the data which was last flushed to
+	// disk by the other process when it was opened, and any attempt to
+	// write to it fails.  Blocks which are deleted by the other process in
+	// the mean time, such as by pruning, can no longer be read.  A
+	// database can't be created read-only.
+	ReadOnly bool
+
+	// CompactIdleTime specifies how long no write transactions must be
+	// committed before the metadata is compacted.  Compacting while idle
+	// keeps the compactions the metadata store performs on its own short
+	// so they are less likely to slow down the processing of new blocks.
+	// A value of zero disables idle compaction.
+	CompactIdleTime time.Duration
+
+	// CompactRate limits the rate in bytes per second at which metadata is
+	// compacted during idle compaction in order to throttle its I/O.  A
+	// value of zero means no limit.
+	CompactRate uint64
+
+	// fullRepair specifies whether a full scan and repair of the database
+	// is performed when it is opened.  It is set by ScanAndRepair.
+	fullRepair bool
+}
+
+// parseArgs parses the arguments from the database Open/Create methods of the
+// passed driver type.
+func parseArgs(dbType, funcName string, args ...interface{}) (string, wire.BitcoinNet, *Options, error) {
+	var opts *Options
+	if len(args) == 3 {
+		opts, _ = args[2].(*Options)
+	}
+	if (len(args) != 2 && len(args) != 3) || (len(args) == 3 && opts == nil) {
+		return "", 0, nil, fmt.Errorf("invalid arguments to %s.%s -- "+
 			"expected database path and block network", dbType,
 			funcName)
 	}
+	if opts == nil {
+		opts = &Options{}
+	}
 
 	dbPath, ok := args[0].(string)
 	if !ok {
-		return "", 0, fmt.Errorf("first argument to %s.%s is invalid -- "+
+		return "", 0, nil, fmt.Errorf("first argument to %s.%s is invalid -- "+
 			"expected database path string", dbType, funcName)
 	}
 
 	network, ok := args[1].(wire.BitcoinNet)
 	if !ok {
-		return "", 0, fmt.Errorf("second argument to %s.%s is invalid -- "+
+		return "", 0, nil, fmt.Errorf("second argument to %s.%s is invalid -- "+
 			"expected block network", dbType, funcName)
 	}
 
-	return dbPath, network, nil
+	return dbPath, network, opts, nil
 }
 
-// openDBDriver is the callback provided during driver registration that opens
-// an existing database for use.
-func openDBDriver(args ...interface{}) (database.DB, error) {
-	dbPath, network, err := parseArgs("Open", args...)
-	if err != nil {
-		return nil, err
-	}
+// openDBDriver returns the callback provided during driver registration that
+// opens an existing database of the passed backend for use.
+func openDBDriver(backend *metadataBackend) func(args ...interface{}) (database.DB, error) {
+	return func(args ...interface{}) (database.DB, error) {
+		dbPath, network, opts, err := parseArgs(backend.dbType, "Open",
+			args...)
+		if err != nil {
+			return nil, err
+		}
 
-	return openDB(dbPath, network, false)
+		return openDB(dbPath, network, false, opts, backend)
+	}
 }
 
-// createDBDriver is the callback provided during driver registration that
-// creates, initializes, and opens a database for use.
-func createDBDriver(args ...interface{}) (database.DB, error) {
-	dbPath, network, err := parseArgs("Create", args...)
-	if err != nil {
-		return nil, err
-	}
+// createDBDriver returns the callback provided during driver registration that
+// creates, initializes, and opens a database of the passed backend for use.
+func createDBDriver(backend *metadataBackend) func(args ...interface{}) (database.DB, error) {
+	return func(args ...interface{}) (database.DB, error) {
+		dbPath, network, opts, err := parseArgs(backend.dbType, "Create",
+			args...)
+		if err != nil {
+			return nil, err
+		}
 
-	return openDB(dbPath, network, true)
+		return openDB(dbPath, network, true, opts, backend)
+	}
 }
 
 // useLogger is the callback provided during driver registration that sets the
@@ -70,15 +180,18 @@ func useLogger(logger btclog.Logger) {
 }
 
 func init() {
-	// Register the driver.
-	driver := database.Driver{
-		DbType:    dbType,
-		Create:    createDBDriver,
-		Open:      openDBDriver,
-		UseLogger: useLogger,
-	}
-	if err := database.RegisterDriver(driver); err != nil {
-		panic(fmt.Sprintf("Failed to regiser database driver '%s': %v",
-			dbType, err))
+	// Register a driver for each metadata backend.  They share the logger
+	// since they share the implementation.
+	for _, backend := range backends {
+		driver := database.Driver{
+			DbType:    backend.dbType,
+			Create:    createDBDriver(backend),
+			Open:      openDBDriver(backend),
+			UseLogger: useLogger,
+		}
+		if err := database.RegisterDriver(driver); err != nil {
+			panic(fmt.Sprintf("Failed to regiser database driver "+
+				"'%s': %v", backend.dbType, err))
+		}
 	}
 }
@@ -5,6 +5,7 @@
 package ffldb_test
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -286,3 +287,381 @@ func TestInterface(t *testing.T) {
 		testInterface(t, db)
 	})
 }
+
+// TestInterfaceMmap performs all interfaces tests for this database driver
+// with memory-mapped block file reads enabled.
+func TestInterfaceMmap(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database to run tests against.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-interfacetest-mmap")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet,
+		&ffldb.Options{MmapReads: true})
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	// Change the maximum file size to a small value to force multiple flat
+	// files with the test data set so blocks are read from files which
+	// are no longer written to and thus memory-mapped.
+	ffldb.TstRunWithMaxBlockFileSize(db, 2048, func() {
+		testInterface(t, db)
+	})
+}
+
+// TestInterfacePebble performs all interfaces tests for the driver which keeps
+// the metadata in Pebble.
+func TestInterfacePebble(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database to run tests against.
+	const pebbleDbType = "pebble"
+	dbPath := filepath.Join(os.TempDir(), "ffldb-interfacetest-pebble")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(pebbleDbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", pebbleDbType,
+			err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	// Ensure the driver type is the expected value.
+	gotDbType := db.Type()
+	if gotDbType != pebbleDbType {
+		t.Errorf("Type: unepxected driver type - got %v, want %v",
+			gotDbType, pebbleDbType)
+		return
+	}
+
+	// Change the maximum file size to a small value to force multiple flat
+	// files with the test data set.
+	ffldb.TstRunWithMaxBlockFileSize(db, 2048, func() {
+		testInterface(t, db)
+	})
+}
+
+// TestMigrate ensures that values and blocks stored in a database are still
+// valid after migrating it to the Pebble backend.
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database to migrate.
+	const pebbleDbType = "pebble"
+	srcPath := filepath.Join(os.TempDir(), "ffldb-migratetest")
+	dstPath := filepath.Join(os.TempDir(), "ffldb-migratetest-pebble")
+	_ = os.RemoveAll(srcPath)
+	_ = os.RemoveAll(dstPath)
+	db, err := database.Create(dbType, srcPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(srcPath)
+	defer os.RemoveAll(dstPath)
+
+	// Put a value and store a block so they can be tested for existence
+	// after the migration.
+	key, value := []byte("migratekey"), []byte("migratevalue")
+	genesisBlock := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	genesisHash := chaincfg.MainNetParams.GenesisHash
+	err = db.Update(func(tx database.Tx) error {
+		if err := tx.Metadata().Put(key, value); err != nil {
+			return fmt.Errorf("Put: unexpected error: %v", err)
+		}
+		return tx.StoreBlock(genesisBlock)
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		db.Close()
+		return
+	}
+	db.Close()
+
+	// Ensure unknown driver types are rejected.
+	wantErrCode := database.ErrDbUnknownType
+	err = ffldb.Migrate(dbType, srcPath, "noexist", dstPath)
+	if !checkDbError(t, "Migrate", err, wantErrCode) {
+		return
+	}
+
+	if err := ffldb.Migrate(dbType, srcPath, pebbleDbType, dstPath); err != nil {
+		t.Errorf("Migrate: unexpected error: %v", err)
+		return
+	}
+
+	// Ensure migrating over an existing database fails.
+	wantErrCode = database.ErrDbExists
+	err = ffldb.Migrate(dbType, srcPath, pebbleDbType, dstPath)
+	if !checkDbError(t, "Migrate", err, wantErrCode) {
+		return
+	}
+
+	// Ensure the value and block exist in the migrated database.
+	db, err = database.Open(pebbleDbType, dstPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to open test database (%s) %v", pebbleDbType,
+			err)
+		return
+	}
+	defer db.Close()
+	err = db.View(func(tx database.Tx) error {
+		gotVal := tx.Metadata().Get(key)
+		if !reflect.DeepEqual(gotVal, value) {
+			return fmt.Errorf("Get: key '%s' does not match "+
+				"expected value - got %s, want %s", key, gotVal,
+				value)
+		}
+
+		genesisBlockBytes, _ := genesisBlock.Bytes()
+		gotBytes, err := tx.FetchBlock(genesisHash)
+		if err != nil {
+			return fmt.Errorf("FetchBlock: unexpected error: %v",
+				err)
+		}
+		if !reflect.DeepEqual(gotBytes, genesisBlockBytes) {
+			return fmt.Errorf("FetchBlock: stored block mismatch")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("View: unexpected error: %v", err)
+	}
+}
+
+// dumpBucket adds all of the key/value pairs of the passed bucket and the
+// buckets nested in it to the passed map, keyed by their path.
+func dumpBucket(bucket database.Bucket, path string, pairs map[string]string) error {
+	err := bucket.ForEach(func(k, v []byte) error {
+		pairs[path+string(k)] = string(v)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return bucket.ForEachBucket(func(k []byte) error {
+		return dumpBucket(bucket.Bucket(k), path+string(k)+"/", pairs)
+	})
+}
+
+// TestBackupRestore ensures that values and blocks stored in a database are
+// restored from a backup while changes made after the backup are not.
+func TestBackupRestore(t *testing.T) {
+	t.Parallel()
+
+	// Create a new database to back up.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-backuptest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	// Put a value and store a block, back up the database, and put another
+	// value which must not be part of the backup.
+	key, value := []byte("backupkey"), []byte("backupvalue")
+	laterKey := []byte("laterkey")
+	genesisBlock := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	genesisHash := chaincfg.MainNetParams.GenesisHash
+	err = db.Update(func(tx database.Tx) error {
+		if err := tx.Metadata().Put(key, value); err != nil {
+			return fmt.Errorf("Put: unexpected error: %v", err)
+		}
+		return tx.StoreBlock(genesisBlock)
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		return
+	}
+	wantMetadata := make(map[string]string)
+	err = db.View(func(tx database.Tx) error {
+		return dumpBucket(tx.Metadata(), "", wantMetadata)
+	})
+	if err != nil {
+		t.Errorf("View: unexpected error: %v", err)
+		return
+	}
+	var backup bytes.Buffer
+	if err := db.Backup(&backup); err != nil {
+		t.Errorf("Backup: unexpected error: %v", err)
+		return
+	}
+	err = db.Update(func(tx database.Tx) error {
+		return tx.Metadata().Put(laterKey, value)
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		return
+	}
+
+	// Ensure corrupted backups are rejected without leaving a database
+	// behind.
+	restorePath := filepath.Join(os.TempDir(), "ffldb-backuptest-restore")
+	_ = os.RemoveAll(restorePath)
+	defer os.RemoveAll(restorePath)
+	corrupted := append([]byte(nil), backup.Bytes()...)
+	corrupted[len(corrupted)/2] ^= 0x10
+	err = ffldb.Restore(dbType, restorePath, blockDataNet,
+		bytes.NewReader(corrupted))
+	if !checkDbError(t, "Restore", err, database.ErrCorruption) {
+		return
+	}
+	if _, err := os.Stat(restorePath); !os.IsNotExist(err) {
+		t.Errorf("Restore: corrupted backup left database behind")
+		return
+	}
+
+	// Restore the backup into both drivers and ensure only the data from
+	// before the backup exists.
+	for _, restoreType := range []string{dbType, "pebble"} {
+		_ = os.RemoveAll(restorePath)
+		err := ffldb.Restore(restoreType, restorePath, blockDataNet,
+			bytes.NewReader(backup.Bytes()))
+		if err != nil {
+			t.Errorf("Restore (%s): unexpected error: %v",
+				restoreType, err)
+			return
+		}
+
+		restoredDb, err := database.Open(restoreType, restorePath,
+			blockDataNet)
+		if err != nil {
+			t.Errorf("Failed to open restored database (%s) %v",
+				restoreType, err)
+			return
+		}
+		err = restoredDb.View(func(tx database.Tx) error {
+			gotVal := tx.Metadata().Get(key)
+			if !reflect.DeepEqual(gotVal, value) {
+				return fmt.Errorf("Get: key '%s' does not "+
+					"match expected value - got %s, want %s",
+					key, gotVal, value)
+			}
+			if tx.Metadata().Get(laterKey) != nil {
+				return fmt.Errorf("Get: key '%s' written "+
+					"after the backup exists", laterKey)
+			}
+
+			// All of the metadata, including the internal state
+			// such as the write cursor, must match the original.
+			gotMetadata := make(map[string]string)
+			err := dumpBucket(tx.Metadata(), "", gotMetadata)
+			if err != nil {
+				return fmt.Errorf("ForEach: unexpected "+
+					"error: %v", err)
+			}
+			if !reflect.DeepEqual(gotMetadata, wantMetadata) {
+				return fmt.Errorf("restored metadata does "+
+					"not match - got %d pairs, want %d",
+					len(gotMetadata), len(wantMetadata))
+			}
+
+			genesisBlockBytes, _ := genesisBlock.Bytes()
+			gotBytes, err := tx.FetchBlock(genesisHash)
+			if err != nil {
+				return fmt.Errorf("FetchBlock: unexpected "+
+					"error: %v", err)
+			}
+			if !reflect.DeepEqual(gotBytes, genesisBlockBytes) {
+				return fmt.Errorf("FetchBlock: stored block " +
+					"mismatch")
+			}
+			return nil
+		})
+		restoredDb.Close()
+		if err != nil {
+			t.Errorf("View (%s): unexpected error: %v", restoreType,
+				err)
+			return
+		}
+	}
+}
+
+// TestStats ensures the statistics of the database account for the metadata
+// lookups and block I/O it performs.
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-statstest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Errorf("Failed to create test database (%s) %v", dbType, err)
+		return
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	// Put a value and store a block, which are both still cached.
+	key, value := []byte("statskey"), []byte("statsvalue")
+	genesisBlock := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	genesisHash := chaincfg.MainNetParams.GenesisHash
+	err = db.Update(func(tx database.Tx) error {
+		if err := tx.Metadata().Put(key, value); err != nil {
+			return fmt.Errorf("Put: unexpected error: %v", err)
+		}
+		return tx.StoreBlock(genesisBlock)
+	})
+	if err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+		return
+	}
+	blockBytes, err := genesisBlock.Bytes()
+	if err != nil {
+		t.Errorf("Bytes: unexpected error: %v", err)
+		return
+	}
+	recordLen := uint64(len(blockBytes) + 12)
+	before := db.Stats()
+	if before.BlockBytesWritten != recordLen {
+		t.Errorf("Stats: unexpected block bytes written - got %d, "+
+			"want %d", before.BlockBytesWritten, recordLen)
+	}
+
+	// Look up the cached value and a key which doesn't exist and read the
+	// block back from the current write file.
+	err = db.View(func(tx database.Tx) error {
+		if got := tx.Metadata().Get(key); !bytes.Equal(got, value) {
+			return fmt.Errorf("Get: got %x, want %x", got, value)
+		}
+		if got := tx.Metadata().Get([]byte("missingkey")); got != nil {
+			return fmt.Errorf("Get: got %x for missing key", got)
+		}
+		_, err := tx.FetchBlock(genesisHash)
+		return err
+	})
+	if err != nil {
+		t.Errorf("View: unexpected error: %v", err)
+		return
+	}
+
+	stats := db.Stats()
+	if got := stats.MetadataCacheHits - before.MetadataCacheHits; got < 1 {
+		t.Errorf("Stats: unexpected metadata cache hits - got %d, "+
+			"want at least 1", got)
+	}
+	if got := stats.MetadataCacheMisses - before.MetadataCacheMisses; got < 1 {
+		t.Errorf("Stats: unexpected metadata cache misses - got %d, "+
+			"want at least 1", got)
+	}
+	if got := stats.BlockBytesRead - before.BlockBytesRead; got != recordLen {
+		t.Errorf("Stats: unexpected block bytes read - got %d, "+
+			"want %d", got, recordLen)
+	}
+	if got := stats.BlockFileHits - before.BlockFileHits; got != 1 {
+		t.Errorf("Stats: unexpected block file hits - got %d, "+
+			"want 1", got)
+	}
+	if stats.OpenFiles != 1 {
+		t.Errorf("Stats: unexpected open files - got %d, want 1",
+			stats.OpenFiles)
+	}
+}
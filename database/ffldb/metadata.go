@@ -0,0 +1,218 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/goleveldb/leveldb"
+	"github.com/btcsuite/goleveldb/leveldb/filter"
+	"github.com/btcsuite/goleveldb/leveldb/iterator"
+	"github.com/btcsuite/goleveldb/leveldb/opt"
+	"github.com/btcsuite/goleveldb/leveldb/util"
+)
+
+// metadataStore describes the persistent key/value store which houses the
+// metadata of the database, while the blocks are stored in the flat files.  It
+// allows the same block storage and database cache to be used with different
+// key/value stores.
+type metadataStore interface {
+	// Snapshot returns a consistent read-only view of the store which
+	// must be released after use.
+	Snapshot() (metadataSnapshot, error)
+
+	// Write atomically stores all of the passed keys to add and removes
+	// all of the passed keys to remove.
+	Write(pendingKeys, pendingRemove TreapForEacher) error
+
+	// SizeOf returns the approximate number of bytes the passed key range
+	// occupies on disk.  A nil limit means the end of the key space.
+	SizeOf(start, limit []byte) (uint64, error)
+
+	// CompactRange compacts the passed key range.  A nil limit means the
+	// end of the key space.
+	CompactRange(start, limit []byte) error
+
+	// Close syncs and closes the store.
+	Close() error
+}
+
+// metadataSnapshot describes a point in time view of a metadataStore.
+type metadataSnapshot interface {
+	// Has returns whether or not the passed key exists.
+	Has(key []byte) (bool, error)
+
+	// Get returns the value for the passed key or nil when the key does
+	// not exist.
+	Get(key []byte) ([]byte, error)
+
+	// NewIterator returns an iterator over the passed key range of the
+	// snapshot.
+	NewIterator(slice *util.Range) iterator.Iterator
+
+	// Release releases the snapshot.
+	Release()
+}
+
+// ldbStore is a metadataStore backed by a leveldb database.
+type ldbStore struct {
+	ldb *leveldb.DB
+}
+
+// Enforce ldbStore implements the metadataStore interface.
+var _ metadataStore = (*ldbStore)(nil)
+
+// ldbSnapshot wraps a leveldb snapshot to implement the metadataSnapshot
+// interface.
+type ldbSnapshot struct {
+	*leveldb.Snapshot
+}
+
+// Has returns whether or not the passed key exists.
+//
+// This is part of the metadataSnapshot interface implementation.
+func (snap ldbSnapshot) Has(key []byte) (bool, error) {
+	return snap.Snapshot.Has(key, nil)
+}
+
+// Get returns the value for the passed key or nil when the key does not exist.
+//
+// This is part of the metadataSnapshot interface implementation.
+func (snap ldbSnapshot) Get(key []byte) ([]byte, error) {
+	value, err := snap.Snapshot.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	}
+	return value, err
+}
+
+// NewIterator returns an iterator over the passed key range of the snapshot.
+//
+// This is part of the metadataSnapshot interface implementation.
+func (snap ldbSnapshot) NewIterator(slice *util.Range) iterator.Iterator {
+	return snap.Snapshot.NewIterator(slice, nil)
+}
+
+// Snapshot returns a consistent read-only view of the store.
+//
+// This is part of the metadataStore interface implementation.
+func (s *ldbStore) Snapshot() (metadataSnapshot, error) {
+	snap, err := s.ldb.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return ldbSnapshot{snap}, nil
+}
+
+// Write atomically stores all of the passed keys to add and removes all of the
+// passed keys to remove using a leveldb transaction.
+//
+// This is part of the metadataStore interface implementation.
+func (s *ldbStore) Write(pendingKeys, pendingRemove TreapForEacher) error {
+	ldbTx, err := s.ldb.OpenTransaction()
+	if err != nil {
+		return convertErr("failed to open ldb transaction", err)
+	}
+
+	var innerErr error
+	pendingKeys.ForEach(func(k, v []byte) bool {
+		if dbErr := ldbTx.Put(k, v, nil); dbErr != nil {
+			str := fmt.Sprintf("failed to put key %q to ldb "+
+				"transaction", k)
+			innerErr = convertErr(str, dbErr)
+			return false
+		}
+		return true
+	})
+	if innerErr == nil {
+		pendingRemove.ForEach(func(k, v []byte) bool {
+			if dbErr := ldbTx.Delete(k, nil); dbErr != nil {
+				str := fmt.Sprintf("failed to delete key %q "+
+					"from ldb transaction", k)
+				innerErr = convertErr(str, dbErr)
+				return false
+			}
+			return true
+		})
+	}
+	if innerErr != nil {
+		ldbTx.Discard()
+		return innerErr
+	}
+
+	// Commit the leveldb transaction and convert any errors as needed.
+	if err := ldbTx.Commit(); err != nil {
+		return convertErr("failed to commit leveldb transaction", err)
+	}
+	return nil
+}
+
+// SizeOf returns the approximate number of bytes the passed key range occupies
+// on disk.
+//
+// This is part of the metadataStore interface implementation.
+func (s *ldbStore) SizeOf(start, limit []byte) (uint64, error) {
+	sizes, err := s.ldb.SizeOf([]util.Range{{Start: start, Limit: limit}})
+	if err != nil {
+		return 0, convertErr("failed to size leveldb range", err)
+	}
+	return uint64(sizes.Sum()), nil
+}
+
+// CompactRange compacts the passed key range.
+//
+// This is part of the metadataStore interface implementation.
+func (s *ldbStore) CompactRange(start, limit []byte) error {
+	err := s.ldb.CompactRange(util.Range{Start: start, Limit: limit})
+	if err != nil {
+		return convertErr("failed to compact leveldb range", err)
+	}
+	return nil
+}
+
+// Close closes the underlying leveldb database.
+//
+// This is part of the metadataStore interface implementation.
+func (s *ldbStore) Close() error {
+	if err := s.ldb.Close(); err != nil {
+		str := "failed to close underlying leveldb database"
+		return convertErr(str, err)
+	}
+	return nil
+}
+
+// openLdbStore opens the leveldb metadata store at the passed path, which is
+// created when it does not exist.  An error is returned when the create flag is
+// set and the store already exists.
+func openLdbStore(path string, create bool) (metadataStore, error) {
+	opts := opt.Options{
+		ErrorIfExist: create,
+		Strict:       opt.DefaultStrict,
+		Compression:  opt.NoCompression,
+		Filter:       filter.NewBloomFilter(10),
+	}
+	ldb, err := leveldb.OpenFile(path, &opts)
+	if err != nil {
+		return nil, convertErr(err.Error(), err)
+	}
+	return &ldbStore{ldb: ldb}, nil
+}
+
+// openLdbStoreReadOnly opens the existing leveldb metadata store at the passed
+// path read-only.
+func openLdbStoreReadOnly(path string) (metadataStore, error) {
+	opts := opt.Options{
+		ErrorIfMissing: true,
+		ReadOnly:       true,
+		Strict:         opt.DefaultStrict,
+		Compression:    opt.NoCompression,
+		Filter:         filter.NewBloomFilter(10),
+	}
+	ldb, err := leveldb.OpenFile(path, &opts)
+	if err != nil {
+		return nil, convertErr(err.Error(), err)
+	}
+	return &ldbStore{ldb: ldb}, nil
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/database/internal/treap"
+)
+
+// migrateBatchSize is the number of metadata keys which are copied to the
+// destination metadata store in a single atomic write during a migration.
+const migrateBatchSize = 50000
+
+// backendByType returns the metadata backend of the passed driver type.
+func backendByType(dbType string) (*metadataBackend, error) {
+	for _, backend := range backends {
+		if backend.dbType == dbType {
+			return backend, nil
+		}
+	}
+	str := fmt.Sprintf("driver %q is not a flat file database driver",
+		dbType)
+	return nil, makeDbErr(database.ErrDbUnknownType, str, nil)
+}
+
+// copyFile copies the file at the source path to the destination path, which
+// must not exist.
+func copyFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+		0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// copyMetadata copies every key/value pair of the source metadata store to the
+// destination metadata store in batches.  It returns the number of copied
+// pairs.
+func copyMetadata(src, dst metadataStore) (uint64, error) {
+	snap, err := src.Snapshot()
+	if err != nil {
+		return 0, convertErr("failed to open source metadata", err)
+	}
+	defer snap.Release()
+
+	iter := snap.NewIterator(nil)
+	defer iter.Release()
+
+	var numKeys uint64
+	batch := treap.NewMutable()
+	for iter.Next() {
+		batch.Put(copySlice(iter.Key()), copySlice(iter.Value()))
+		numKeys++
+		if batch.Len() < migrateBatchSize {
+			continue
+		}
+
+		if err := dst.Write(batch, treap.NewMutable()); err != nil {
+			return 0, err
+		}
+		batch.Reset()
+		log.Infof("Migrated %d metadata entries", numKeys)
+	}
+	if err := iter.Error(); err != nil {
+		return 0, convertErr("failed to iterate source metadata", err)
+	}
+	if err := dst.Write(batch, treap.NewMutable()); err != nil {
+		return 0, err
+	}
+
+	return numKeys, nil
+}
+
+// Migrate converts the database of the passed source driver type at the source
+// path into a new database of the passed destination driver type at the
+// destination path.  The flat block files are hard linked into the destination
+// when possible and copied otherwise, while the metadata is copied into a newly
+// created metadata store of the destination backend.
+//
+// The source database must not be open while it is migrated.  It is left
+// unmodified, so it may be removed once the migrated database has been
+// verified.  database.ErrDbExists is returned if the destination already
+// exists.
+func Migrate(srcType, srcPath, dstType, dstPath string) error {
+	srcBackend, err := backendByType(srcType)
+	if err != nil {
+		return err
+	}
+	dstBackend, err := backendByType(dstType)
+	if err != nil {
+		return err
+	}
+	if fileExists(dstPath) {
+		str := fmt.Sprintf("database %q already exists", dstPath)
+		return makeDbErr(database.ErrDbExists, str, nil)
+	}
+	metadataDbPath := filepath.Join(srcPath, srcBackend.dirName)
+	if !fileExists(metadataDbPath) {
+		str := fmt.Sprintf("database %q does not exist", metadataDbPath)
+		return makeDbErr(database.ErrDbDoesNotExist, str, nil)
+	}
+
+	// Open the source metadata first since it is locked while open, which
+	// ensures the source database is not in use during the migration.
+	src, err := srcBackend.open(metadataDbPath, false)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Link or copy all of the flat block files.
+	if err := os.MkdirAll(dstPath, 0700); err != nil {
+		str := fmt.Sprintf("failed to create database %q: %v", dstPath,
+			err)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	fileNums := blockFileNums(srcPath)
+	for _, fileNum := range fileNums {
+		srcFile := blockFilePath(srcPath, fileNum)
+		dstFile := blockFilePath(dstPath, fileNum)
+		if err := os.Link(srcFile, dstFile); err == nil {
+			continue
+		}
+		if err := copyFile(srcFile, dstFile); err != nil {
+			str := fmt.Sprintf("failed to copy block file %d: %v",
+				fileNum, err)
+			return makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+	}
+	log.Infof("Migrated %d block files", len(fileNums))
+
+	// Copy the metadata into a newly created store of the destination
+	// backend.
+	dst, err := dstBackend.open(filepath.Join(dstPath, dstBackend.dirName),
+		true)
+	if err != nil {
+		return err
+	}
+	numKeys, err := copyMetadata(src, dst)
+	if err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	log.Infof("Migrated %d metadata entries from %s to %s", numKeys,
+		srcType, dstType)
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile is a read-only block file which is memory-mapped in addition to
+// being open.  Reads are served directly from the mapping, which avoids a
+// system call per read and allows the block checksum to be verified in place
+// before the block is copied out of the page cache.
+//
+// The mapping covers the file as it was when it was opened, so reads beyond
+// its end, which is only possible when the file was appended to after it was
+// mapped, fall back to reading from the file.
+type mmapFile struct {
+	*os.File
+	data []byte
+}
+
+// Ensure mmapFile implements the filer interface.
+var _ filer = (*mmapFile)(nil)
+
+// newMmapFile memory-maps the passed file which must be opened read-only.  An
+// error is returned when the file can't be mapped in which case the caller is
+// expected to fall back to regular reads from the file.
+func newMmapFile(file *os.File) (*mmapFile, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size == 0 {
+		return nil, errors.New("empty file")
+	}
+	if int64(int(size)) != size {
+		return nil, errors.New("file is too large to map")
+	}
+
+	data, err := mmap(file, int(size))
+	if err != nil {
+		return nil, err
+	}
+	return &mmapFile{File: file, data: data}, nil
+}
+
+// region returns the mapped data for the passed file offset and length.  The
+// returned slice references the mapping and therefore must not be used after
+// the file is closed.  It returns false when the region is not mapped.
+func (f *mmapFile) region(offset, numBytes uint32) ([]byte, bool) {
+	end := uint64(offset) + uint64(numBytes)
+	if end > uint64(len(f.data)) {
+		return nil, false
+	}
+
+	// Hint that the whole region is about to be accessed so it is read in
+	// at once rather than faulted in page by page.
+	adviseWillNeed(f.data, int(offset), int(end))
+	return f.data[offset:end], true
+}
+
+// ReadAt reads len(b) bytes from the file starting at byte offset off.
+//
+// This is part of the filer interface implementation.
+func (f *mmapFile) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(b)) > int64(len(f.data)) {
+		return f.File.ReadAt(b, off)
+	}
+	return copy(b, f.data[off:]), nil
+}
+
+// Close unmaps and closes the file.
+//
+// This is part of the filer interface implementation.
+func (f *mmapFile) Close() error {
+	unmapErr := munmap(f.data)
+	f.data = nil
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return unmapErr
+}
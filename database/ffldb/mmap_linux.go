@@ -0,0 +1,43 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of the passed file read-only into memory.
+// Since blocks are typically served in random order, the kernel is advised
+// not to read ahead of the accessed pages.
+func mmap(file *os.File, size int) ([]byte, error) {
+	data, err := syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ,
+		syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	// The advice is only a hint, so failures are not fatal.
+	_ = syscall.Madvise(data, syscall.MADV_RANDOM)
+	return data, nil
+}
+
+// munmap unmaps data previously mapped by mmap.
+func munmap(data []byte) error {
+	if data == nil {
+		return nil
+	}
+	return syscall.Munmap(data)
+}
+
+// adviseWillNeed advises the kernel that the mapped data in the range
+// [start, end) will be accessed soon.
+func adviseWillNeed(data []byte, start, end int) {
+	// The start of the advised range must be page aligned.  The mapping
+	// itself starts on a page boundary, so aligning the offset suffices.
+	pageSize := os.Getpagesize()
+	start &^= pageSize - 1
+	_ = syscall.Madvise(data[start:end], syscall.MADV_WILLNEED)
+}
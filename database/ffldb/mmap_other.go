@@ -0,0 +1,29 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package ffldb
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap always returns an error since memory-mapped block files are not
+// supported on this platform, so regular reads are used instead.
+func mmap(file *os.File, size int) ([]byte, error) {
+	return nil, errors.New("memory-mapped files are not supported on " +
+		"this platform")
+}
+
+// munmap does nothing since memory-mapped block files are not supported on
+// this platform.
+func munmap(data []byte) error {
+	return nil
+}
+
+// adviseWillNeed does nothing since memory-mapped block files are not
+// supported on this platform.
+func adviseWillNeed(data []byte, start, end int) {}
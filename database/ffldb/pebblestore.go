@@ -0,0 +1,399 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/goleveldb/leveldb/iterator"
+	"github.com/btcsuite/goleveldb/leveldb/util"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/bloom"
+)
+
+// errPebbleClosed is returned when the Pebble metadata store is used after it
+// has been closed.  Pebble panics in that case rather than returning an error,
+// so the store guards against it.
+var errPebbleClosed = database.Error{
+	ErrorCode:   database.ErrDbNotOpen,
+	Description: "pebble metadata store is closed",
+}
+
+// pebbleStore is a metadataStore backed by a Pebble database.
+type pebbleStore struct {
+	mtx    sync.RWMutex
+	pdb    *pebble.DB
+	closed bool
+}
+
+// Enforce pebbleStore implements the metadataStore interface.
+var _ metadataStore = (*pebbleStore)(nil)
+
+// pebbleSnapshot wraps a Pebble snapshot to implement the metadataSnapshot
+// interface.
+type pebbleSnapshot struct {
+	snap *pebble.Snapshot
+}
+
+// Has returns whether or not the passed key exists.
+//
+// This is part of the metadataSnapshot interface implementation.
+func (snap pebbleSnapshot) Has(key []byte) (bool, error) {
+	value, err := snap.Get(key)
+	return value != nil, err
+}
+
+// Get returns the value for the passed key or nil when the key does not exist.
+//
+// This is part of the metadataSnapshot interface implementation.
+func (snap pebbleSnapshot) Get(key []byte) ([]byte, error) {
+	value, closer, err := snap.snap.Get(key)
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The value returned by Pebble is only valid until the closer is
+	// closed, so copy it.
+	value = copySlice(value)
+	closer.Close()
+	return value, nil
+}
+
+// NewIterator returns an iterator over the passed key range of the snapshot.
+//
+// This is part of the metadataSnapshot interface implementation.
+func (snap pebbleSnapshot) NewIterator(slice *util.Range) iterator.Iterator {
+	var opts pebble.IterOptions
+	if slice != nil {
+		opts.LowerBound = slice.Start
+		opts.UpperBound = slice.Limit
+	}
+	iter, err := snap.snap.NewIter(&opts)
+	if err != nil {
+		return iterator.NewEmptyIterator(err)
+	}
+	return &pebbleIter{iter: iter}
+}
+
+// Release releases the snapshot.
+//
+// This is part of the metadataSnapshot interface implementation.
+func (snap pebbleSnapshot) Release() {
+	snap.snap.Close()
+}
+
+// pebbleIter wraps a Pebble iterator to provide the behavior of the leveldb
+// iterator.Iterator interface.
+type pebbleIter struct {
+	iter       *pebble.Iterator
+	positioned bool
+	released   bool
+	err        error
+}
+
+// Enforce pebbleIter implements the leveldb iterator.Iterator interface.
+var _ iterator.Iterator = (*pebbleIter)(nil)
+
+// First moves the iterator to the first key/value pair.
+//
+// This is part of the leveldb iterator.Iterator interface implementation.
+func (iter *pebbleIter) First() bool {
+	if iter.released {
+		return false
+	}
+	iter.positioned = true
+	return iter.iter.First()
+}
+
+// Last moves the iterator to the last key/value pair.
+//
+// This is part of the leveldb iterator.Iterator interface implementation.
+func (iter *pebbleIter) Last() bool {
+	if iter.released {
+		return false
+	}
+	iter.positioned = true
+	return iter.iter.Last()
+}
+
+// Seek moves the iterator to the first key/value pair whose key is greater
+// than or equal to the given key.
+//
+// This is part of the leveldb iterator.Iterator interface implementation.
+func (iter *pebbleIter) Seek(key []byte) bool {
+	if iter.released {
+		return false
+	}
+	iter.positioned = true
+	return iter.iter.SeekGE(key)
+}
+
+// Next moves the iterator to the next key/value pair.  A freshly created
+// leveldb iterator is positioned before the first pair, so the first call
+// moves to the first pair.
+//
+// This is part of the leveldb iterator.Iterator interface implementation.
+func (iter *pebbleIter) Next() bool {
+	if !iter.positioned {
+		return iter.First()
+	}
+	if iter.released {
+		return false
+	}
+	return iter.iter.Next()
+}
+
+// Prev moves the iterator to the previous key/value pair.  A freshly created
+// leveldb iterator is positioned after the last pair, so the first call moves
+// to the last pair.
+//
+// This is part of the leveldb iterator.Iterator interface implementation.
+func (iter *pebbleIter) Prev() bool {
+	if !iter.positioned {
+		return iter.Last()
+	}
+	if iter.released {
+		return false
+	}
+	return iter.iter.Prev()
+}
+
+// Valid returns whether the iterator is positioned at a key/value pair.
+//
+// This is part of the leveldb iterator.Iterator interface implementation.
+func (iter *pebbleIter) Valid() bool {
+	return !iter.released && iter.positioned && iter.iter.Valid()
+}
+
+// Key returns the key of the current key/value pair or nil if done.
+//
+// This is part of the leveldb iterator.Iterator interface implementation.
+func (iter *pebbleIter) Key() []byte {
+	if !iter.Valid() {
+		return nil
+	}
+	return iter.iter.Key()
+}
+
+// Value returns the value of the current key/value pair or nil if done.
+//
+// This is part of the leveldb iterator.Iterator interface implementation.
+func (iter *pebbleIter) Value() []byte {
+	if !iter.Valid() {
+		return nil
+	}
+	return iter.iter.Value()
+}
+
+// Error returns any accumulated error.
+//
+// This is part of the leveldb iterator.Iterator interface implementation.
+func (iter *pebbleIter) Error() error {
+	if iter.released {
+		return iter.err
+	}
+	return iter.iter.Error()
+}
+
+// SetReleaser is only provided to satisfy the iterator interface as there is no
+// need to override it.
+//
+// This is part of the leveldb iterator.Iterator interface implementation.
+func (iter *pebbleIter) SetReleaser(releaser util.Releaser) {
+}
+
+// Release closes the underlying Pebble iterator.
+//
+// This is part of the leveldb iterator.Iterator interface implementation.
+func (iter *pebbleIter) Release() {
+	if !iter.released {
+		iter.err = iter.iter.Close()
+		iter.released = true
+	}
+}
+
+// Snapshot returns a consistent read-only view of the store.
+//
+// This is part of the metadataStore interface implementation.
+func (s *pebbleStore) Snapshot() (metadataSnapshot, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.closed {
+		return nil, errPebbleClosed
+	}
+
+	return pebbleSnapshot{snap: s.pdb.NewSnapshot()}, nil
+}
+
+// Write atomically stores all of the passed keys to add and removes all of the
+// passed keys to remove using a synced Pebble batch.
+//
+// This is part of the metadataStore interface implementation.
+func (s *pebbleStore) Write(pendingKeys, pendingRemove TreapForEacher) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.closed {
+		return errPebbleClosed
+	}
+
+	batch := s.pdb.NewBatch()
+	defer batch.Close()
+
+	var innerErr error
+	pendingKeys.ForEach(func(k, v []byte) bool {
+		if dbErr := batch.Set(k, v, nil); dbErr != nil {
+			str := fmt.Sprintf("failed to put key %q to pebble "+
+				"batch", k)
+			innerErr = convertErr(str, dbErr)
+			return false
+		}
+		return true
+	})
+	if innerErr == nil {
+		pendingRemove.ForEach(func(k, v []byte) bool {
+			if dbErr := batch.Delete(k, nil); dbErr != nil {
+				str := fmt.Sprintf("failed to delete key %q "+
+					"from pebble batch", k)
+				innerErr = convertErr(str, dbErr)
+				return false
+			}
+			return true
+		})
+	}
+	if innerErr != nil {
+		return innerErr
+	}
+
+	if err := batch.Commit(pebble.Sync); err != nil {
+		return convertErr("failed to commit pebble batch", err)
+	}
+	return nil
+}
+
+// limitKey returns the passed range limit or, when it is nil, a key past the
+// last key of the store since Pebble requires bounded ranges.  The limit is nil
+// when the store is empty.
+//
+// This function MUST be called with the store read lock held.
+func (s *pebbleStore) limitKey(limit []byte) ([]byte, error) {
+	if limit != nil {
+		return limit, nil
+	}
+
+	iter, err := s.pdb.NewIter(nil)
+	if err != nil {
+		return nil, err
+	}
+	if iter.Last() {
+		limit = append(copySlice(iter.Key()), 0)
+	}
+	return limit, iter.Close()
+}
+
+// SizeOf returns the approximate number of bytes the passed key range occupies
+// on disk.
+//
+// This is part of the metadataStore interface implementation.
+func (s *pebbleStore) SizeOf(start, limit []byte) (uint64, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.closed {
+		return 0, errPebbleClosed
+	}
+
+	limit, err := s.limitKey(limit)
+	if err != nil {
+		return 0, convertErr("failed to size pebble range", err)
+	}
+	if limit == nil || bytes.Compare(start, limit) >= 0 {
+		return 0, nil
+	}
+	size, err := s.pdb.EstimateDiskUsage(start, limit)
+	if err != nil {
+		return 0, convertErr("failed to size pebble range", err)
+	}
+	return size, nil
+}
+
+// CompactRange compacts the passed key range.
+//
+// This is part of the metadataStore interface implementation.
+func (s *pebbleStore) CompactRange(start, limit []byte) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.closed {
+		return errPebbleClosed
+	}
+
+	limit, err := s.limitKey(limit)
+	if err != nil {
+		return convertErr("failed to compact pebble range", err)
+	}
+	if limit == nil || bytes.Compare(start, limit) >= 0 {
+		return nil
+	}
+	if err := s.pdb.Compact(start, limit, false); err != nil {
+		return convertErr("failed to compact pebble range", err)
+	}
+	return nil
+}
+
+// Close closes the underlying Pebble database.
+//
+// This is part of the metadataStore interface implementation.
+func (s *pebbleStore) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return errPebbleClosed
+	}
+	s.closed = true
+
+	if err := s.pdb.Close(); err != nil {
+		str := "failed to close underlying pebble database"
+		return convertErr(str, err)
+	}
+	return nil
+}
+
+// openPebbleStore opens the Pebble metadata store at the passed path, which is
+// created when it does not exist.  An error is returned when the create flag is
+// set and the store already exists.
+func openPebbleStore(path string, create bool) (metadataStore, error) {
+	opts := &pebble.Options{
+		ErrorIfExists: create,
+		Levels: []pebble.LevelOptions{{
+			FilterPolicy: bloom.FilterPolicy(10),
+		}},
+	}
+	pdb, err := pebble.Open(path, opts.EnsureDefaults())
+	if err != nil {
+		return nil, convertErr(err.Error(), err)
+	}
+	return &pebbleStore{pdb: pdb}, nil
+}
+
+// openPebbleStoreReadOnly opens the existing Pebble metadata store at the passed
+// path read-only.
+func openPebbleStoreReadOnly(path string) (metadataStore, error) {
+	opts := &pebble.Options{
+		ErrorIfNotExists: true,
+		ReadOnly:         true,
+		Levels: []pebble.LevelOptions{{
+			FilterPolicy: bloom.FilterPolicy(10),
+		}},
+	}
+	pdb, err := pebble.Open(path, opts.EnsureDefaults())
+	if err != nil {
+		return nil, convertErr(err.Error(), err)
+	}
+	return &pebbleStore{pdb: pdb}, nil
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is the fallocate mode which allocates disk space without
+// changing the size of the file.  It is not defined by the syscall package.
+const fallocKeepSize = 0x1
+
+// preallocate allocates the disk space for the first size bytes of the passed
+// file without changing its size, so the size still marks the end of the
+// written data.
+func preallocate(file *os.File, size int64) error {
+	return syscall.Fallocate(int(file.Fd()), fallocKeepSize, 0, size)
+}
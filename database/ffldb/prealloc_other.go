@@ -0,0 +1,19 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package ffldb
+
+import (
+	"errors"
+	"os"
+)
+
+// preallocate always returns an error since allocating disk space without
+// changing the size of a file is not supported on this platform.
+func preallocate(file *os.File, size int64) error {
+	return errors.New("preallocating files is not supported on this " +
+		"platform")
+}
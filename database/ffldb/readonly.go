@@ -0,0 +1,161 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// snapshotAttempts is the number of times taking a snapshot of the
+	// metadata store for a read-only database is attempted.  Taking a
+	// snapshot fails when the files of the store change while it is taken,
+	// which is retried.
+	snapshotAttempts = 5
+
+	// errDbReadOnlyStr is the text to use for the database.ErrTxNotWritable
+	// error code when a write transaction is started on a database which
+	// is open read-only.
+	errDbReadOnlyStr = "database is open read-only"
+)
+
+// isTableFile returns whether the file with the passed name is a table of a
+// metadata store.  Tables are never modified once written, so they can be
+// hard linked into a snapshot rather than copied.
+func isTableFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".ldb" || ext == ".sst"
+}
+
+// snapshotMetadata takes a snapshot of the metadata store in the source
+// directory, which may be open in another process, by copying its files to the
+// destination directory.  The tables are hard linked when possible.  The files
+// which reference the tables are copied first, so a table which is removed by
+// a compaction in the mean time is detected by a failure to link or copy it.
+func snapshotMetadata(srcDir, dstDir string) error {
+	files, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return !isTableFile(files[i].Name()) &&
+			isTableFile(files[j].Name())
+	})
+
+	for _, file := range files {
+		// The lock is held by the process which has the store open.
+		name := file.Name()
+		if file.IsDir() || name == "LOCK" {
+			continue
+		}
+
+		srcPath := filepath.Join(srcDir, name)
+		dstPath := filepath.Join(dstDir, name)
+		if isTableFile(name) {
+			if err := os.Link(srcPath, dstPath); err == nil {
+				continue
+			}
+		}
+		if err := copyFile(srcPath, dstPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openMetadataSnapshot takes a snapshot of the metadata store of the passed
+// backend in the database at the passed path and opens it read-only.  The
+// snapshot is taken in a new directory next to the database so the tables can
+// be hard linked, and the path to it is returned so it can be removed once the
+// store is closed.
+func openMetadataSnapshot(dbPath string, backend *metadataBackend) (metadataStore, string, error) {
+	metadataDbPath := filepath.Join(dbPath, backend.dirName)
+	var lastErr error
+	for attempt := 1; attempt <= snapshotAttempts; attempt++ {
+		snapPath, err := ioutil.TempDir(filepath.Dir(dbPath),
+			filepath.Base(dbPath)+"-readonly-")
+		if err != nil {
+			str := fmt.Sprintf("failed to create metadata snapshot "+
+				"directory: %v", err)
+			return nil, "", makeDbErr(database.ErrDriverSpecific,
+				str, err)
+		}
+
+		err = snapshotMetadata(metadataDbPath, snapPath)
+		if err == nil {
+			var meta metadataStore
+			meta, err = backend.openReadOnly(snapPath)
+			if err == nil {
+				return meta, snapPath, nil
+			}
+		}
+		_ = os.RemoveAll(snapPath)
+
+		log.Debugf("Failed to take metadata snapshot (attempt %d): %v",
+			attempt, err)
+		lastErr = err
+	}
+
+	str := fmt.Sprintf("failed to take snapshot of metadata %q: %v",
+		metadataDbPath, lastErr)
+	return nil, "", makeDbErr(database.ErrDriverSpecific, str, lastErr)
+}
+
+// openReadOnlyDB opens the existing database at the passed path read-only.  The
+// metadata is read from a snapshot of the metadata store, which allows another
+// process to have the database open for writing at the same time, and the
+// blocks are read from the flat files in place.  Since the other process only
+// appends to the flat files, all blocks in the snapshot can be read unless they
+// are deleted in the mean time.
+func openReadOnlyDB(dbPath string, network wire.BitcoinNet, dbOpts *Options,
+	backend *metadataBackend) (database.DB, error) {
+
+	meta, snapPath, err := openMetadataSnapshot(dbPath, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	store := newBlockStore(dbPath, network, dbOpts)
+	cache := newDbCache(meta, store, defaultCacheSize, defaultFlushSecs)
+	pdb := &db{
+		store:        store,
+		cache:        cache,
+		backend:      backend,
+		readOnly:     true,
+		snapshotPath: snapPath,
+	}
+
+	// Position the write cursor where the metadata snapshot expects it
+	// rather than at the end of the flat files, which may have been
+	// appended to since, so backups only include the block data the
+	// snapshot references.
+	var curFileNum, curOffset uint32
+	err = pdb.View(func(tx database.Tx) error {
+		writeRow := tx.Metadata().Get(writeLocKeyName)
+		if writeRow == nil {
+			str := "write cursor does not exist"
+			return makeDbErr(database.ErrCorruption, str, nil)
+		}
+
+		var err error
+		curFileNum, curOffset, err = deserializeWriteRow(writeRow)
+		return err
+	})
+	if err != nil {
+		_ = pdb.Close()
+		return nil, err
+	}
+	store.writeCursor.curFileNum = curFileNum
+	store.writeCursor.curOffset = curOffset
+
+	return pdb, nil
+}
@@ -7,6 +7,7 @@ package ffldb
 import (
 	"fmt"
 	"hash/crc32"
+	"os"
 
 	"github.com/btcsuite/btcd/database"
 )
@@ -48,16 +49,40 @@ func deserializeWriteRow(writeRow []byte) (uint32, uint32, error) {
 }
 
 // reconcileDB reconciles the metadata with the flat block files on disk.  It
-// will also initialize the underlying database if the create flag is set.
-func reconcileDB(pdb *db, create bool) (database.DB, error) {
+// will also initialize the underlying database if the create flag is set.  The
+// database is scanned for corruption and repaired when it was not closed
+// cleanly, or fully when the full repair flag is set.
+func reconcileDB(pdb *db, create, fullRepair bool) (database.DB, error) {
 	// Perform initial internal bucket and value creation during database
 	// creation.
 	if create {
-		if err := initDB(pdb.cache.ldb); err != nil {
+		if err := initDB(pdb.cache.meta); err != nil {
 			return nil, err
 		}
 	}
 
+	// Scan the database for torn writes and corruption when it was not
+	// closed cleanly or a full scan was requested.
+	markerPath := openMarkerPath(pdb.store.basePath)
+	if !create && (fullRepair || fileExists(markerPath)) {
+		if fullRepair {
+			log.Info("Scanning database for corruption...")
+		} else {
+			log.Info("Detected unclean shutdown - Scanning for " +
+				"torn writes...")
+		}
+		report, err := pdb.scanAndRepair(fullRepair)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Database scan complete: verified %d block records "+
+			"in %d files, found %d corrupt records, truncated %d "+
+			"bytes, and removed %d blocks", report.RecordsVerified,
+			report.FilesScanned, report.CorruptRecords,
+			report.TruncatedBytes, len(report.RemovedBlocks))
+		pdb.repairReport = report
+	}
+
 	// Load the current write cursor position from the metadata.
 	var curFileNum, curOffset uint32
 	err := pdb.View(func(tx database.Tx) error {
@@ -113,5 +138,14 @@ func reconcileDB(pdb *db, create bool) (database.DB, error) {
 		return nil, makeDbErr(database.ErrCorruption, str, nil)
 	}
 
+	// Mark the database as open so an unclean shutdown is detected the
+	// next time it is opened.
+	marker, err := os.OpenFile(markerPath, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		str := fmt.Sprintf("failed to create open marker: %v", err)
+		return nil, makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	marker.Close()
+
 	return pdb, nil
 }
@@ -0,0 +1,290 @@
+// Copyright (c) 2015-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// openMarkerName is the name of the file which exists in the database directory
+// while the database is open.  Finding it when the database is opened means it
+// was not closed cleanly.
+const openMarkerName = "open"
+
+// RepairReport describes what a scan of the database by ScanAndRepair found and
+// which repairs were made.
+type RepairReport struct {
+	// FilesScanned is the number of flat block files which were scanned.
+	FilesScanned int
+
+	// RecordsVerified is the number of block records in the scanned files
+	// whose checksums were verified.
+	RecordsVerified int
+
+	// CorruptRecords is the number of block records in the scanned files
+	// whose checksums did not match.
+	CorruptRecords int
+
+	// TruncatedBytes is the number of bytes which were truncated from the
+	// end of the current write file because they were torn writes.
+	TruncatedBytes int64
+
+	// RemovedBlocks are the hashes of the blocks which were removed from
+	// the block index because they referenced block records which were
+	// corrupt or do not exist.
+	RemovedBlocks []chainhash.Hash
+}
+
+// scannedRecord describes a block record found while scanning a block file.
+type scannedRecord struct {
+	recordLen uint32
+	hash      chainhash.Hash
+}
+
+// recordKey returns the key of the record at the passed location in the map of
+// scanned records.
+func recordKey(fileNum, offset uint32) uint64 {
+	return uint64(fileNum)<<32 | uint64(offset)
+}
+
+// scanBlockRecords reads the block records of the passed block file up to the
+// passed limit, verifies their checksums, and adds the valid ones to the passed
+// map.  It returns the offset of the end of the last valid record which is not
+// preceded by any torn or corrupt data, and stops at the first record whose
+// length makes it impossible to continue.
+func (s *blockStore) scanBlockRecords(fileNum, limit uint32, records map[uint64]scannedRecord, report *RepairReport) (uint32, error) {
+	file, err := os.Open(blockFilePath(s.basePath, fileNum))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	r := bufio.NewReaderSize(io.LimitReader(file, int64(limit)), 1<<20)
+	report.FilesScanned++
+
+	var offset, goodEnd uint32
+	intact := true
+	for {
+		// The record consists of the network, the length of the
+		// block, the block, and a checksum.
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return goodEnd, nil
+		}
+		network := byteOrder.Uint32(hdr[0:4])
+		blockLen := byteOrder.Uint32(hdr[4:8])
+		if network != uint32(s.network) || blockLen < blockHdrSize ||
+			uint64(offset)+uint64(blockLen)+12 > uint64(limit) {
+
+			log.Debugf("Scan found invalid block record at file %d, "+
+				"offset %d", fileNum, offset)
+			return goodEnd, nil
+		}
+
+		data := make([]byte, blockLen+4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return goodEnd, nil
+		}
+		recordLen := blockLen + 12
+		hasher := crc32.New(castagnoli)
+		hasher.Write(hdr[:])
+		hasher.Write(data[:blockLen])
+		checksum := binary.BigEndian.Uint32(data[blockLen:])
+		if checksum != hasher.Sum32() {
+			log.Warnf("Scan found corrupt block record at file %d, "+
+				"offset %d", fileNum, offset)
+			report.CorruptRecords++
+			intact = false
+		} else {
+			report.RecordsVerified++
+			records[recordKey(fileNum, offset)] = scannedRecord{
+				recordLen: recordLen,
+				hash:      chainhash.DoubleHashH(data[:blockHdrSize]),
+			}
+		}
+
+		offset += recordLen
+		if intact {
+			goodEnd = offset
+		}
+	}
+}
+
+// scanAndRepair verifies the checksums of the block records in the flat block
+// files and the references to them in the block index, truncates torn writes at
+// the end of the current write file, and removes the blocks which reference
+// corrupt or missing records from the block index.  Only the current write
+// file, where torn writes happen, and the blocks stored in it are considered
+// unless the full flag is set, in which case all files and blocks are.
+//
+// This function MUST only be called while opening the database.
+func (db *db) scanAndRepair(full bool) (*RepairReport, error) {
+	// Load the write cursor position from the metadata.
+	var curFileNum, curOffset uint32
+	err := db.View(func(tx database.Tx) error {
+		writeRow := tx.Metadata().Get(writeLocKeyName)
+		if writeRow == nil {
+			str := "write cursor does not exist"
+			return makeDbErr(database.ErrCorruption, str, nil)
+		}
+
+		var err error
+		curFileNum, curOffset, err = deserializeWriteRow(writeRow)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Scan the block files for valid records.  Everything after the write
+	// cursor is not committed, so it is not scanned.
+	report := &RepairReport{}
+	records := make(map[uint64]scannedRecord)
+	scanned := make(map[uint32]struct{})
+	var goodEnd uint32
+	for _, fileNum := range blockFileNums(db.store.basePath) {
+		if fileNum > curFileNum || (!full && fileNum < curFileNum) {
+			continue
+		}
+		limit := ^uint32(0)
+		if fileNum == curFileNum {
+			limit = curOffset
+		}
+		end, err := db.store.scanBlockRecords(fileNum, limit, records,
+			report)
+		if err != nil {
+			str := fmt.Sprintf("failed to scan block file %d: %v",
+				fileNum, err)
+			return nil, makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+		scanned[fileNum] = struct{}{}
+		if fileNum == curFileNum {
+			goodEnd = end
+		}
+	}
+	if full {
+		// Files which are missing entirely were scanned as well in
+		// the sense that they hold no valid records.
+		for fileNum := uint32(0); fileNum <= curFileNum; fileNum++ {
+			scanned[fileNum] = struct{}{}
+		}
+	} else {
+		scanned[curFileNum] = struct{}{}
+	}
+
+	// Truncate the torn writes at the end of the current write file by
+	// rolling back to the end of the last intact record.  The write
+	// cursor in the metadata is updated along with the block index below.
+	if goodEnd < curOffset {
+		log.Warnf("Truncating %d bytes of torn writes from block file "+
+			"%d", curOffset-goodEnd, curFileNum)
+		report.TruncatedBytes = int64(curOffset - goodEnd)
+		db.store.handleRollback(curFileNum, goodEnd)
+	}
+
+	// Find the blocks in the block index which reference records in the
+	// scanned files that are corrupt or don't exist.
+	err = db.View(func(dbTx database.Tx) error {
+		tx := dbTx.(*transaction)
+		return tx.blockIdxBucket.ForEach(func(k, v []byte) error {
+			loc := deserializeBlockLoc(v)
+			if _, ok := scanned[loc.blockFileNum]; !ok {
+				return nil
+			}
+			key := recordKey(loc.blockFileNum, loc.fileOffset)
+			record, ok := records[key]
+			if ok && record.recordLen == loc.blockLen &&
+				bytes.Equal(record.hash[:], k) {
+
+				return nil
+			}
+
+			var hash chainhash.Hash
+			copy(hash[:], k)
+			report.RemovedBlocks = append(report.RemovedBlocks, hash)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove the blocks from the block index and store the repaired write
+	// cursor, which is done by every commit.
+	if report.TruncatedBytes == 0 && len(report.RemovedBlocks) == 0 {
+		return report, nil
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		tx := dbTx.(*transaction)
+		for i := range report.RemovedBlocks {
+			hash := &report.RemovedBlocks[i]
+			log.Warnf("Removing block %s which references corrupt "+
+				"or missing block data", hash)
+			if err := tx.blockIdxBucket.Delete(hash[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Flush the repairs to the metadata store right away so they do not
+	// depend on another clean shutdown.
+	db.writeLock.Lock()
+	err = db.cache.flush()
+	db.writeLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ScanAndRepair opens the database of the passed driver type at the passed path
+// and performs a full scan of it, which verifies the checksums of all block
+// records in the flat block files and the references to them in the block
+// index, truncates torn writes at the end of the current write file, and
+// removes the blocks which reference corrupt or missing records from the block
+// index.  The database must not be open.
+//
+// A limited scan of the current write file is performed automatically whenever
+// a database which was not closed cleanly is opened.
+func ScanAndRepair(dbType, dbPath string, network wire.BitcoinNet) (*RepairReport, error) {
+	backend, err := backendByType(dbType)
+	if err != nil {
+		return nil, err
+	}
+
+	idb, err := openDB(dbPath, network, false, &Options{fullRepair: true},
+		backend)
+	if err != nil {
+		return nil, err
+	}
+	report := idb.(*db).repairReport
+	if err := idb.Close(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// openMarkerPath returns the path of the file which exists while the database at
+// the passed path is open.
+func openMarkerPath(dbPath string) string {
+	return filepath.Join(dbPath, openMarkerName)
+}
@@ -8,17 +8,23 @@
 package ffldb
 
 import (
+	"bytes"
 	"compress/bzip2"
 	"encoding/binary"
 	"fmt"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/database/internal/treap"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 	"github.com/btcsuite/goleveldb/leveldb"
@@ -39,7 +45,7 @@ var (
 
 // loadBlocks loads the blocks contained in the testdata directory and returns
 // a slice of them.
-func loadBlocks(t *testing.T, dataFile string, network wire.BitcoinNet) ([]*btcutil.Block, error) {
+func loadBlocks(t testing.TB, dataFile string, network wire.BitcoinNet) ([]*btcutil.Block, error) {
 	// Open the file that contains the blocks for reading.
 	fi, err := os.Open(dataFile)
 	if err != nil {
@@ -179,7 +185,8 @@ func TestCornerCases(t *testing.T) {
 	// directory is needed.
 	testName := "openDB: fail due to file at target location"
 	wantErrCode := database.ErrDriverSpecific
-	idb, err := openDB(dbPath, blockDataNet, true)
+	idb, err := openDB(dbPath, blockDataNet, true, &Options{},
+		ldbBackend)
 	if !checkDbError(t, testName, err, wantErrCode) {
 		if err == nil {
 			idb.Close()
@@ -191,7 +198,8 @@ func TestCornerCases(t *testing.T) {
 	// Remove the file and create the database to run tests against.  It
 	// should be successful this time.
 	_ = os.RemoveAll(dbPath)
-	idb, err = openDB(dbPath, blockDataNet, true)
+	idb, err = openDB(dbPath, blockDataNet, true, &Options{},
+		ldbBackend)
 	if err != nil {
 		t.Errorf("openDB: unexpected error: %v", err)
 		return
@@ -215,14 +223,14 @@ func TestCornerCases(t *testing.T) {
 	_ = os.RemoveAll(filePath)
 
 	// Close the underlying leveldb database out from under the database.
-	ldb := idb.(*db).cache.ldb
-	ldb.Close()
+	meta := idb.(*db).cache.meta
+	meta.Close()
 
 	// Ensure initilization errors in the underlying database work as
 	// expected.
 	testName = "initDB: reinitialization"
 	wantErrCode = database.ErrDbNotOpen
-	err = initDB(ldb)
+	err = initDB(meta)
 	if !checkDbError(t, testName, err, wantErrCode) {
 		return
 	}
@@ -605,6 +613,7 @@ func TestFailureScenarios(t *testing.T) {
 	// Create a new database to run tests against.
 	dbPath := filepath.Join(os.TempDir(), "ffldb-failurescenarios")
 	_ = os.RemoveAll(dbPath)
+	dbType := ldbBackend.dbType
 	idb, err := database.Create(dbType, dbPath, blockDataNet)
 	if err != nil {
 		t.Errorf("Failed to create test database (%s) %v", dbType, err)
@@ -704,3 +713,560 @@ func TestFailureScenarios(t *testing.T) {
 	// Test various corruption scenarios.
 	testCorruption(tc)
 }
+
+// TestDeleteBlocks ensures deleting blocks removes them from the block index
+// and deletes the flat block files which no longer hold any blocks.
+func TestDeleteBlocks(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-deleteblocks")
+	_ = os.RemoveAll(dbPath)
+	idb, err := openDB(dbPath, blockDataNet, true, &Options{},
+		ldbBackend)
+	if err != nil {
+		t.Fatalf("openDB: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	if err != nil {
+		idb.Close()
+		t.Fatalf("loadBlocks: unexpected error: %v", err)
+	}
+	extraBlock := blocks[20]
+	blocks = blocks[:20]
+
+	// Store the blocks in small files so they span several of them.
+	store := idb.(*db).store
+	store.maxBlockFileSize = 1024 // 1KiB
+	err = idb.Update(func(tx database.Tx) error {
+		for _, block := range blocks {
+			if err := tx.StoreBlock(block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		idb.Close()
+		t.Fatalf("StoreBlock: unexpected error: %v", err)
+	}
+	numFiles := len(blockFileNums(dbPath))
+	if numFiles < 4 {
+		idb.Close()
+		t.Fatalf("StoreBlock: blocks stored in %d files", numFiles)
+	}
+
+	// Ensure deleting a block which does not exist fails and deleting a
+	// block which is pending in the same transaction does not store it.
+	err = idb.Update(func(tx database.Tx) error {
+		testName := "DeleteBlock: missing block"
+		err := tx.DeleteBlock(extraBlock.Hash())
+		if !checkDbError(t, testName, err, database.ErrBlockNotFound) {
+			return errSubTestFail
+		}
+
+		if err := tx.StoreBlock(extraBlock); err != nil {
+			return err
+		}
+		return tx.DeleteBlock(extraBlock.Hash())
+	})
+	if err != nil {
+		idb.Close()
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+	err = idb.View(func(tx database.Tx) error {
+		has, err := tx.HasBlock(extraBlock.Hash())
+		if err == nil && has {
+			t.Error("DeleteBlock: pending block was stored")
+		}
+		return err
+	})
+	if err != nil {
+		idb.Close()
+		t.Fatalf("View: unexpected error: %v", err)
+	}
+
+	// Delete the first half of the blocks.
+	err = idb.Update(func(tx database.Tx) error {
+		for _, block := range blocks[:10] {
+			if err := tx.DeleteBlock(block.Hash()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		idb.Close()
+		t.Fatalf("DeleteBlock: unexpected error: %v", err)
+	}
+
+	// Ensure the files which only held deleted blocks were deleted and
+	// all of the remaining blocks are still available.
+	checkBlocks := func(idb database.DB) {
+		err := idb.View(func(tx database.Tx) error {
+			for i, block := range blocks {
+				has, err := tx.HasBlock(block.Hash())
+				if err != nil {
+					return err
+				}
+				if has != (i >= 10) {
+					t.Errorf("HasBlock #%d: got %v", i, has)
+				}
+				if i < 10 {
+					continue
+				}
+				if _, err := tx.FetchBlock(block.Hash()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("View: unexpected error: %v", err)
+		}
+	}
+	checkBlocks(idb)
+	fileNums := blockFileNums(dbPath)
+	if len(fileNums) == numFiles || fileNums[0] == 0 {
+		t.Errorf("DeleteBlock: unused files not deleted, got files %v",
+			fileNums)
+	}
+
+	// Ensure the database is reopened with the same write cursor despite
+	// the missing files and the remaining blocks are still available.
+	wc := store.writeCursor
+	curFileNum, curOffset := wc.curFileNum, wc.curOffset
+	idb.Close()
+	idb, err = openDB(dbPath, blockDataNet, false, &Options{},
+		ldbBackend)
+	if err != nil {
+		t.Fatalf("openDB: unexpected error: %v", err)
+	}
+	defer idb.Close()
+	wc = idb.(*db).store.writeCursor
+	if wc.curFileNum != curFileNum || wc.curOffset != curOffset {
+		t.Errorf("openDB: got write cursor %d:%d, want %d:%d",
+			wc.curFileNum, wc.curOffset, curFileNum, curOffset)
+	}
+	checkBlocks(idb)
+}
+
+// TestPrefixLimit ensures the limits of the key ranges with a given prefix are
+// calculated correctly.
+func TestPrefixLimit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		prefix []byte
+		want   []byte
+	}{
+		{nil, nil},
+		{[]byte{0x00}, []byte{0x01}},
+		{[]byte{0x01, 0x02}, []byte{0x01, 0x03}},
+		{[]byte{0x01, 0xff}, []byte{0x02}},
+		{[]byte{0xff, 0xff}, nil},
+	}
+
+	for i, test := range tests {
+		got := prefixLimit(test.prefix)
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("prefixLimit #%d: unexpected limit - got %x, "+
+				"want %x", i, got, test.want)
+		}
+	}
+}
+
+// countingStore wraps a metadataStore to count the compacted ranges.
+type countingStore struct {
+	metadataStore
+	compactions int32
+}
+
+// CompactRange counts the compaction and compacts the passed key range.
+func (s *countingStore) CompactRange(start, limit []byte) error {
+	atomic.AddInt32(&s.compactions, 1)
+	return s.metadataStore.CompactRange(start, limit)
+}
+
+// TestIdleCompaction ensures the metadata is compacted once the database has
+// not been written to for the idle time and only when it was written to.
+func TestIdleCompaction(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-idlecompaction")
+	_ = os.RemoveAll(dbPath)
+	idb, err := openDB(dbPath, blockDataNet, true, &Options{},
+		ldbBackend)
+	if err != nil {
+		t.Fatalf("openDB: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer idb.Close()
+
+	// Write enough data directly to the metadata store so it has a size
+	// on disk.
+	pdb := idb.(*db)
+	batch := treap.NewMutable()
+	for i := 0; i < 10000; i++ {
+		var key [8]byte
+		binary.BigEndian.PutUint64(key[:], uint64(i))
+		batch.Put(key[:], bytes.Repeat(key[:], 16))
+	}
+	if err := pdb.cache.meta.Write(batch, treap.NewMutable()); err != nil {
+		t.Fatalf("Write: unexpected error: %v", err)
+	}
+
+	store := &countingStore{metadataStore: pdb.cache.meta}
+	c := newCompactor(store, 50*time.Millisecond, 0)
+	c.Start()
+	defer c.Stop()
+
+	// Ensure nothing is compacted without writes.
+	time.Sleep(200 * time.Millisecond)
+	if n := atomic.LoadInt32(&store.compactions); n != 0 {
+		t.Fatalf("compactor: unexpected %d compactions without writes",
+			n)
+	}
+
+	// Ensure the metadata is compacted once after a write.
+	c.noteWrite()
+	time.Sleep(300 * time.Millisecond)
+	n := atomic.LoadInt32(&store.compactions)
+	if n == 0 {
+		t.Fatal("compactor: metadata not compacted after write")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got := atomic.LoadInt32(&store.compactions); got != n {
+		t.Fatalf("compactor: unexpected compactions while idle - "+
+			"got %d, want %d", got, n)
+	}
+}
+
+// TestScanAndRepair ensures torn writes are truncated when a database which was
+// not closed cleanly is opened and that a full scan removes the blocks with
+// corrupt data from the block index.
+func TestScanAndRepair(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-scanandrepair")
+	_ = os.RemoveAll(dbPath)
+	idb, err := openDB(dbPath, blockDataNet, true, &Options{},
+		ldbBackend)
+	if err != nil {
+		t.Fatalf("openDB: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+
+	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	if err != nil {
+		idb.Close()
+		t.Fatalf("loadBlocks: unexpected error: %v", err)
+	}
+	blocks = blocks[:10]
+
+	// Store the blocks in small files so they span several of them.
+	idb.(*db).store.maxBlockFileSize = 1024 // 1KiB
+	err = idb.Update(func(tx database.Tx) error {
+		for _, block := range blocks {
+			if err := tx.StoreBlock(block); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		idb.Close()
+		t.Fatalf("StoreBlock: unexpected error: %v", err)
+	}
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	if fileExists(openMarkerPath(dbPath)) {
+		t.Fatal("Close: open marker exists after clean shutdown")
+	}
+
+	// checkBlocks ensures only the blocks which are not in the passed
+	// removed blocks are in the database.
+	checkBlocks := func(idb database.DB, removed map[chainhash.Hash]struct{}) {
+		err := idb.View(func(tx database.Tx) error {
+			for i, block := range blocks {
+				has, err := tx.HasBlock(block.Hash())
+				if err != nil {
+					return err
+				}
+				_, wantRemoved := removed[*block.Hash()]
+				if has == wantRemoved {
+					t.Errorf("HasBlock #%d: got %v, want %v",
+						i, has, !wantRemoved)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("View: unexpected error: %v", err)
+		}
+	}
+
+	// Simulate an unclean shutdown which lost the end of the last block
+	// and ensure the last block is removed once the database is opened.
+	fileNums := blockFileNums(dbPath)
+	lastFile := blockFilePath(dbPath, fileNums[len(fileNums)-1])
+	fi, err := os.Stat(lastFile)
+	if err != nil {
+		t.Fatalf("Stat: unexpected error: %v", err)
+	}
+	if err := os.Truncate(lastFile, fi.Size()-10); err != nil {
+		t.Fatalf("Truncate: unexpected error: %v", err)
+	}
+	marker, err := os.Create(openMarkerPath(dbPath))
+	if err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	marker.Close()
+	idb, err = openDB(dbPath, blockDataNet, false, &Options{}, ldbBackend)
+	if err != nil {
+		t.Fatalf("openDB: unexpected error: %v", err)
+	}
+	report := idb.(*db).repairReport
+	if report == nil || len(report.RemovedBlocks) != 1 ||
+		report.RemovedBlocks[0] != *blocks[9].Hash() {
+
+		idb.Close()
+		t.Fatalf("openDB: unexpected repair report %+v", report)
+	}
+	checkBlocks(idb, map[chainhash.Hash]struct{}{*blocks[9].Hash(): {}})
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+
+	// Corrupt a byte of the first block and ensure a full scan removes it
+	// from the block index.
+	firstFile := blockFilePath(dbPath, 0)
+	data, err := ioutil.ReadFile(firstFile)
+	if err != nil {
+		t.Fatalf("ReadFile: unexpected error: %v", err)
+	}
+	data[100] ^= 0x10
+	if err := ioutil.WriteFile(firstFile, data, 0600); err != nil {
+		t.Fatalf("WriteFile: unexpected error: %v", err)
+	}
+	report, err = ScanAndRepair(ldbBackend.dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("ScanAndRepair: unexpected error: %v", err)
+	}
+	if report.CorruptRecords != 1 || len(report.RemovedBlocks) != 1 ||
+		report.RemovedBlocks[0] != *blocks[0].Hash() {
+
+		t.Fatalf("ScanAndRepair: unexpected repair report %+v", report)
+	}
+	idb, err = openDB(dbPath, blockDataNet, false, &Options{}, ldbBackend)
+	if err != nil {
+		t.Fatalf("openDB: unexpected error: %v", err)
+	}
+	defer idb.Close()
+	checkBlocks(idb, map[chainhash.Hash]struct{}{
+		*blocks[0].Hash(): {},
+		*blocks[9].Hash(): {},
+	})
+}
+
+// TestBlockFileOptions ensures blocks written with a configured block file
+// size, a write buffer, and preallocation can be read back and that the block
+// files end at the write cursor.
+func TestBlockFileOptions(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-blockfileoptions")
+	_ = os.RemoveAll(dbPath)
+	opts := &Options{
+		BlockFileSize:   2048,
+		WriteBufferSize: 512,
+		Preallocate:     true,
+	}
+	idb, err := openDB(dbPath, blockDataNet, true, opts, ldbBackend)
+	if err != nil {
+		t.Fatalf("openDB: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer idb.Close()
+
+	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	if err != nil {
+		t.Fatalf("loadBlocks: unexpected error: %v", err)
+	}
+	blocks = blocks[:20]
+
+	// Store the blocks across several transactions so both buffered and
+	// previously written data is read.
+	for i := 0; i < len(blocks); i += 5 {
+		err := idb.Update(func(tx database.Tx) error {
+			for _, block := range blocks[i : i+5] {
+				if err := tx.StoreBlock(block); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock: unexpected error: %v", err)
+		}
+	}
+
+	err = idb.View(func(tx database.Tx) error {
+		for i, block := range blocks {
+			wantBytes, err := block.Bytes()
+			if err != nil {
+				return err
+			}
+			gotBytes, err := tx.FetchBlock(block.Hash())
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(gotBytes, wantBytes) {
+				t.Errorf("FetchBlock #%d: bytes mismatch", i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: unexpected error: %v", err)
+	}
+
+	// Ensure the blocks were split across files of the configured size
+	// and the last file ends at the write cursor despite preallocation.
+	fileNums := blockFileNums(dbPath)
+	if len(fileNums) < 2 {
+		t.Fatalf("blockFileNums: got %d files, want more than one",
+			len(fileNums))
+	}
+	wc := idb.(*db).store.writeCursor
+	fi, err := os.Stat(blockFilePath(dbPath, wc.curFileNum))
+	if err != nil {
+		t.Fatalf("Stat: unexpected error: %v", err)
+	}
+	if fi.Size() != int64(wc.curOffset) {
+		t.Fatalf("Stat: got size %d, want %d", fi.Size(), wc.curOffset)
+	}
+}
+
+// TestReadOnly ensures a database can be opened read-only while it is open for
+// writing and that the read-only database provides a view of the data which
+// was flushed when it was opened and rejects writes.
+func TestReadOnly(t *testing.T) {
+	t.Parallel()
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-readonly")
+	_ = os.RemoveAll(dbPath)
+	idb, err := openDB(dbPath, blockDataNet, true, &Options{},
+		ldbBackend)
+	if err != nil {
+		t.Fatalf("openDB: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer idb.Close()
+
+	blocks, err := loadBlocks(t, blockDataFile, blockDataNet)
+	if err != nil {
+		t.Fatalf("loadBlocks: unexpected error: %v", err)
+	}
+
+	// storeBlocks stores the passed blocks and flushes them to disk so
+	// they are visible to read-only databases opened afterwards.
+	storeBlocks := func(blocks []*btcutil.Block) {
+		err := idb.Update(func(tx database.Tx) error {
+			for _, block := range blocks {
+				if err := tx.StoreBlock(block); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock: unexpected error: %v", err)
+		}
+
+		pdb := idb.(*db)
+		pdb.writeLock.Lock()
+		err = pdb.cache.flush()
+		pdb.writeLock.Unlock()
+		if err != nil {
+			t.Fatalf("flush: unexpected error: %v", err)
+		}
+	}
+	storeBlocks(blocks[:5])
+
+	// Ensure a database can't be created read-only.
+	_, err = openDB(filepath.Join(os.TempDir(), "ffldb-readonly-create"),
+		blockDataNet, true, &Options{ReadOnly: true}, ldbBackend)
+	if err == nil {
+		t.Fatal("openDB: created database read-only")
+	}
+
+	roDB, err := openDB(dbPath, blockDataNet, false,
+		&Options{ReadOnly: true}, ldbBackend)
+	if err != nil {
+		t.Fatalf("openDB: unexpected read-only error: %v", err)
+	}
+	snapPath := roDB.(*db).snapshotPath
+
+	// Store more blocks after the read-only database was opened, which
+	// it must not see.
+	storeBlocks(blocks[5:10])
+
+	err = roDB.View(func(tx database.Tx) error {
+		for i, block := range blocks[:10] {
+			has, err := tx.HasBlock(block.Hash())
+			if err != nil {
+				return err
+			}
+			if has != (i < 5) {
+				t.Errorf("HasBlock #%d: got %v, want %v", i, has,
+					i < 5)
+				continue
+			}
+			if !has {
+				continue
+			}
+
+			wantBytes, err := block.Bytes()
+			if err != nil {
+				return err
+			}
+			gotBytes, err := tx.FetchBlock(block.Hash())
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(gotBytes, wantBytes) {
+				t.Errorf("FetchBlock #%d: bytes mismatch", i)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		roDB.Close()
+		t.Fatalf("View: unexpected error: %v", err)
+	}
+
+	// Ensure writes are rejected.
+	err = roDB.Update(func(tx database.Tx) error {
+		return nil
+	})
+	if !checkDbError(t, "Update", err, database.ErrTxNotWritable) {
+		roDB.Close()
+		return
+	}
+
+	// Ensure closing the read-only database removes its snapshot and
+	// leaves the database open for writing intact.
+	if err := roDB.Close(); err != nil {
+		t.Fatalf("Close: unexpected read-only error: %v", err)
+	}
+	if fileExists(snapPath) {
+		t.Fatalf("Close: snapshot %q still exists", snapPath)
+	}
+	if !fileExists(openMarkerPath(dbPath)) {
+		t.Fatal("Close: read-only database removed the open marker")
+	}
+	storeBlocks(blocks[10:11])
+}
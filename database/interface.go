@@ -8,6 +8,8 @@
 package database
 
 import (
+	"io"
+
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcutil"
 )
@@ -229,6 +231,20 @@ type Tx interface {
 	// Other errors are possible depending on the implementation.
 	StoreBlock(block *btcutil.Block) error
 
+	// DeleteBlock removes the block identified by the given hash from the
+	// database.  The space used by the block is reclaimed once none of
+	// the remaining blocks share the underlying storage with it, which
+	// allows old blocks to be pruned.
+	//
+	// The interface contract guarantees at least the following errors will
+	// be returned (other implementation-specific errors are possible):
+	//   - ErrBlockNotFound if the requested block hash does not exist
+	//   - ErrTxNotWritable if attempted against a read-only transaction
+	//   - ErrTxClosed if the transaction has already been closed
+	//
+	// Other errors are possible depending on the implementation.
+	DeleteBlock(hash *chainhash.Hash) error
+
 	// HasBlock returns whether or not a block with the given hash exists
 	// in the database.
 	//
@@ -408,6 +424,39 @@ type Tx interface {
 	Rollback() error
 }
 
+// Stats houses counters which describe the activity of a database since it was
+// opened along with the number of files it has open.  Backends which don't
+// distinguish some of the categories leave the related counters at zero.
+type Stats struct {
+	// MetadataCacheHits is the number of metadata lookups which were
+	// answered by the cache of recently written metadata, while
+	// MetadataCacheMisses is the number of lookups which had to consult
+	// the underlying metadata store.
+	MetadataCacheHits   uint64
+	MetadataCacheMisses uint64
+
+	// MetadataBytesRead is the number of bytes of values read from the
+	// underlying metadata store by lookups, while MetadataBytesWritten is
+	// the number of bytes of keys and values written to it.
+	MetadataBytesRead    uint64
+	MetadataBytesWritten uint64
+
+	// BlockFileHits is the number of block reads from files which were
+	// already open, while BlockFileMisses is the number of block reads
+	// which had to open the file.
+	BlockFileHits   uint64
+	BlockFileMisses uint64
+
+	// BlockBytesRead and BlockBytesWritten are the number of bytes of
+	// block data read from and written to the block storage.
+	BlockBytesRead    uint64
+	BlockBytesWritten uint64
+
+	// OpenFiles is the number of file handles to block files which are
+	// currently open.
+	OpenFiles int
+}
+
 // DB provides a generic interface that is used to store bitcoin blocks and
 // related metadata.  This interface is intended to be agnostic to the actual
 // mechanism used for backend data storage.  The RegisterDriver function can be
@@ -459,6 +508,24 @@ type DB interface {
 	// user-supplied function will result in a panic.
 	Update(fn func(tx Tx) error) error
 
+	// Backup writes a consistent backup of the entire database, including
+	// all of the metadata and blocks, to the passed writer.  The database
+	// remains usable while the backup is written, but changes which are
+	// committed in the mean time are not part of the backup.  The format
+	// of the backup is specific to the database driver.
+	Backup(w io.Writer) error
+
+	// BackupToPath writes a backup of the database as described by Backup
+	// to a new file at the passed path.
+	BackupToPath(path string) error
+
+	// Stats returns counters which describe the activity of the database
+	// since it was opened.  It may be used to observe the effectiveness
+	// of caches and the amount of I/O the database performs.
+	//
+	// This function is safe for concurrent access.
+	Stats() *Stats
+
 	// Close cleanly shuts down the database and syncs all data.  It will
 	// block until all database transactions have been finalized (rolled
 	// back or committed).
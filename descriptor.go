@@ -0,0 +1,380 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+const (
+	// descriptorInputCharset is the character set of output descriptors.
+	// The position of a character determines the symbols it contributes
+	// to the checksum.
+	descriptorInputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+		"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+		"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+	// descriptorChecksumCharset is the character set of the checksum of
+	// output descriptors.
+	descriptorChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+	// descriptorChecksumLen is the length of the checksum of output
+	// descriptors.
+	descriptorChecksumLen = 8
+)
+
+// descriptorScript is a public key script an output descriptor expands to
+// along with the descriptor of the script alone, which includes its checksum.
+type descriptorScript struct {
+	pkScript []byte
+	desc     string
+}
+
+// descriptorKey is a public key of a key expression of an output descriptor.
+type descriptorKey struct {
+	serialized []byte
+	compressed bool
+}
+
+// descriptorPolyMod updates the passed checksum state with the passed symbol as
+// defined by BIP0380.
+func descriptorPolyMod(c uint64, val int) uint64 {
+	c0 := c >> 35
+	c = (c&0x7ffffffff)<<5 ^ uint64(val)
+	if c0&1 != 0 {
+		c ^= 0xf5dee51989
+	}
+	if c0&2 != 0 {
+		c ^= 0xa9fdca3312
+	}
+	if c0&4 != 0 {
+		c ^= 0x1bab10e32d
+	}
+	if c0&8 != 0 {
+		c ^= 0x3706b1677a
+	}
+	if c0&16 != 0 {
+		c ^= 0x644d626ffd
+	}
+	return c
+}
+
+// descriptorChecksum returns the checksum of the passed output descriptor,
+// which must not include a checksum, as defined by BIP0380.
+func descriptorChecksum(desc string) (string, error) {
+	c := uint64(1)
+	var class, classCount int
+	for _, ch := range desc {
+		pos := strings.IndexRune(descriptorInputCharset, ch)
+		if pos < 0 {
+			return "", fmt.Errorf("invalid character %q in descriptor",
+				ch)
+		}
+
+		// The lower bits of the position are a symbol of their own,
+		// while the upper bits of every three characters are combined
+		// into one.
+		c = descriptorPolyMod(c, pos&31)
+		class = class*3 + pos>>5
+		classCount++
+		if classCount == 3 {
+			c = descriptorPolyMod(c, class)
+			class, classCount = 0, 0
+		}
+	}
+	if classCount > 0 {
+		c = descriptorPolyMod(c, class)
+	}
+	for i := 0; i < descriptorChecksumLen; i++ {
+		c = descriptorPolyMod(c, 0)
+	}
+	c ^= 1
+
+	checksum := make([]byte, descriptorChecksumLen)
+	for i := range checksum {
+		shift := 5 * uint(descriptorChecksumLen-1-i)
+		checksum[i] = descriptorChecksumCharset[(c>>shift)&31]
+	}
+	return string(checksum), nil
+}
+
+// addDescriptorChecksum returns the passed output descriptor followed by its
+// checksum.
+func addDescriptorChecksum(desc string) (string, error) {
+	checksum, err := descriptorChecksum(desc)
+	if err != nil {
+		return "", err
+	}
+	return desc + "#" + checksum, nil
+}
+
+// expandDescriptor parses the passed output descriptor and returns the public
+// key scripts it expands to.  A ranged descriptor, whose key is derived from an
+// extended public key with a path ending in a wildcard, expands to the scripts
+// of the child indexes from the first to the last one of the passed range.  The
+// checksum of the descriptor is optional, but verified when present.
+//
+// The supported descriptors are addr, raw, pk, pkh, wpkh, sh(wpkh), and combo
+// with keys given in hex or as extended public keys.  Key origins are accepted
+// but ignored.
+func expandDescriptor(desc string, rng [2]uint32, params *chaincfg.Params) ([]descriptorScript, error) {
+	if i := strings.IndexByte(desc, '#'); i >= 0 {
+		checksum, err := descriptorChecksum(desc[:i])
+		if err != nil {
+			return nil, err
+		}
+		if desc[i+1:] != checksum {
+			return nil, fmt.Errorf("invalid descriptor checksum %q, "+
+				"expected %q", desc[i+1:], checksum)
+		}
+		desc = desc[:i]
+	}
+
+	scripts, err := expandDescriptorFunc(desc, rng, params, true)
+	if err != nil {
+		return nil, err
+	}
+	for i := range scripts {
+		scripts[i].desc, err = addDescriptorChecksum(scripts[i].desc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return scripts, nil
+}
+
+// expandDescriptorFunc expands the passed output descriptor without checksum as
+// described by expandDescriptor.  The descriptors of the returned scripts do
+// not have checksums either.  Only top level descriptors may wrap others.
+func expandDescriptorFunc(desc string, rng [2]uint32, params *chaincfg.Params, topLevel bool) ([]descriptorScript, error) {
+	open := strings.IndexByte(desc, '(')
+	if open <= 0 || !strings.HasSuffix(desc, ")") {
+		return nil, fmt.Errorf("invalid descriptor %q", desc)
+	}
+	name, arg := desc[:open], desc[open+1:len(desc)-1]
+
+	switch name {
+	case "addr":
+		addr, err := btcutil.DecodeAddress(arg, params)
+		if err != nil || !addr.IsForNet(params) {
+			return nil, fmt.Errorf("invalid address %q", arg)
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, err
+		}
+		desc := "addr(" + addr.EncodeAddress() + ")"
+		return []descriptorScript{{pkScript, desc}}, nil
+
+	case "raw":
+		pkScript, err := hex.DecodeString(arg)
+		if err != nil || len(pkScript) == 0 {
+			return nil, fmt.Errorf("invalid script %q", arg)
+		}
+		desc := "raw(" + hex.EncodeToString(pkScript) + ")"
+		return []descriptorScript{{pkScript, desc}}, nil
+
+	case "sh":
+		if !topLevel || !strings.HasPrefix(arg, "wpkh(") {
+			return nil, errors.New("sh is only supported at the top " +
+				"level wrapping wpkh")
+		}
+		inner, err := expandDescriptorFunc(arg, rng, params, false)
+		if err != nil {
+			return nil, err
+		}
+		for i := range inner {
+			addr, err := btcutil.NewAddressScriptHash(
+				inner[i].pkScript, params)
+			if err != nil {
+				return nil, err
+			}
+			inner[i].pkScript, err = txscript.PayToAddrScript(addr)
+			if err != nil {
+				return nil, err
+			}
+			inner[i].desc = "sh(" + inner[i].desc + ")"
+		}
+		return inner, nil
+
+	case "pk", "pkh", "wpkh", "combo":
+		if name == "combo" && !topLevel {
+			return nil, errors.New("combo is only supported at the " +
+				"top level")
+		}
+		keys, err := expandDescriptorKey(arg, rng, params)
+		if err != nil {
+			return nil, err
+		}
+
+		// Combo expands to the pay-to-pubkey and pay-to-pubkey-hash
+		// scripts of a key along with the segwit ones for compressed
+		// keys.
+		names := []string{name}
+		if name == "combo" {
+			names = []string{"pk", "pkh", "wpkh", "sh(wpkh"}
+		}
+		var scripts []descriptorScript
+		for _, key := range keys {
+			for _, name := range names {
+				if strings.HasSuffix(name, "wpkh") && !key.compressed {
+					if len(names) > 1 {
+						continue
+					}
+					return nil, errors.New("uncompressed keys " +
+						"are not allowed in segwit descriptors")
+				}
+				script, err := descriptorKeyScript(name, key, params)
+				if err != nil {
+					return nil, err
+				}
+				scripts = append(scripts, script)
+			}
+		}
+		return scripts, nil
+	}
+
+	return nil, fmt.Errorf("unsupported descriptor %q", name)
+}
+
+// descriptorKeyScript returns the script of the passed key for the passed
+// descriptor name, where "sh(wpkh" stands for the wpkh script wrapped in sh.
+func descriptorKeyScript(name string, key descriptorKey, params *chaincfg.Params) (descriptorScript, error) {
+	keyHex := hex.EncodeToString(key.serialized)
+	pkHash := btcutil.Hash160(key.serialized)
+	var addr btcutil.Address
+	var err error
+	switch name {
+	case "pk":
+		addr, err = btcutil.NewAddressPubKey(key.serialized, params)
+
+	case "pkh":
+		addr, err = btcutil.NewAddressPubKeyHash(pkHash, params)
+
+	case "wpkh":
+		addr, err = btcutil.NewAddressWitnessPubKeyHash(pkHash, params)
+
+	case "sh(wpkh":
+		var wpkh btcutil.Address
+		wpkh, err = btcutil.NewAddressWitnessPubKeyHash(pkHash, params)
+		if err != nil {
+			return descriptorScript{}, err
+		}
+		var script []byte
+		script, err = txscript.PayToAddrScript(wpkh)
+		if err != nil {
+			return descriptorScript{}, err
+		}
+		addr, err = btcutil.NewAddressScriptHash(script, params)
+	}
+	if err != nil {
+		return descriptorScript{}, err
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return descriptorScript{}, err
+	}
+	desc := name + "(" + keyHex + strings.Repeat(")",
+		strings.Count(name, "(")+1)
+	return descriptorScript{pkScript, desc}, nil
+}
+
+// expandDescriptorKey parses the passed key expression of an output descriptor
+// and returns the public keys it expands to.  A key expression is either a hex
+// public key or an extended public key followed by a path of unhardened child
+// indexes, whose last index may be a wildcard which expands to the child
+// indexes in the passed range.  It may be preceded by a key origin in brackets.
+func expandDescriptorKey(expr string, rng [2]uint32, params *chaincfg.Params) ([]descriptorKey, error) {
+	if strings.HasPrefix(expr, "[") {
+		end := strings.IndexByte(expr, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid key origin in %q", expr)
+		}
+		expr = expr[end+1:]
+	}
+
+	if serialized, err := hex.DecodeString(expr); err == nil {
+		if _, err := btcec.ParsePubKey(serialized, btcec.S256()); err != nil {
+			return nil, fmt.Errorf("invalid public key %q", expr)
+		}
+		key := descriptorKey{
+			serialized: serialized,
+			compressed: len(serialized) == btcec.PubKeyBytesLenCompressed,
+		}
+		return []descriptorKey{key}, nil
+	}
+
+	path := strings.Split(expr, "/")
+	extKey, err := hdkeychain.NewKeyFromString(path[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %q: %v", path[0], err)
+	}
+	if extKey.IsPrivate() {
+		return nil, errors.New("private keys are not supported")
+	}
+	if !extKey.IsForNet(params) {
+		return nil, fmt.Errorf("extended key is not for %s", params.Name)
+	}
+
+	ranged := len(path) > 1 && path[len(path)-1] == "*"
+	if ranged {
+		path = path[:len(path)-1]
+	}
+	for _, elem := range path[1:] {
+		index, err := strconv.ParseUint(elem, 10, 32)
+		if err != nil || index >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("invalid key path element %q, "+
+				"only unhardened child indexes are supported", elem)
+		}
+		extKey, err = extKey.Child(uint32(index))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// deriveKey returns the public key of the passed extended key.
+	deriveKey := func(extKey *hdkeychain.ExtendedKey) (descriptorKey, error) {
+		pubKey, err := extKey.ECPubKey()
+		if err != nil {
+			return descriptorKey{}, err
+		}
+		return descriptorKey{pubKey.SerializeCompressed(), true}, nil
+	}
+	if !ranged {
+		key, err := deriveKey(extKey)
+		if err != nil {
+			return nil, err
+		}
+		return []descriptorKey{key}, nil
+	}
+	keys := make([]descriptorKey, 0, rng[1]-rng[0]+1)
+	for index := uint64(rng[0]); index <= uint64(rng[1]); index++ {
+		child, err := extKey.Child(uint32(index))
+		if err != nil {
+			// Skip the rare indexes which do not derive a valid
+			// key.
+			if err == hdkeychain.ErrInvalidChild {
+				continue
+			}
+			return nil, err
+		}
+		key, err := deriveKey(child)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
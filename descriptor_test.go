@@ -0,0 +1,165 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// testPubKey is the compressed public key of the generator point, whose
+// pay-to-pubkey-hash address is 1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH.
+const testPubKey = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+
+// testUncompressedPubKey is the uncompressed public key of the generator point.
+const testUncompressedPubKey = "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" +
+	"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"
+
+// TestDescriptorChecksum ensures the checksums of output descriptors match the
+// ones defined by BIP0380.
+func TestDescriptorChecksum(t *testing.T) {
+	tests := []struct {
+		desc     string
+		checksum string
+	}{
+		{"raw(deadbeef)", "89f8spxm"},
+		{"addr(mkmZxiEcEd8ZqjQWVZuC6so5dFMKEFpN2j)", "02wpgw69"},
+	}
+	for _, test := range tests {
+		checksum, err := descriptorChecksum(test.desc)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.desc, err)
+			continue
+		}
+		if checksum != test.checksum {
+			t.Errorf("%s: got checksum %s, want %s", test.desc,
+				checksum, test.checksum)
+		}
+	}
+
+	if _, err := descriptorChecksum("raw(é)"); err == nil {
+		t.Error("invalid character was not rejected")
+	}
+}
+
+// TestExpandDescriptor ensures output descriptors expand to the expected
+// scripts and that invalid and unsupported descriptors are rejected.
+func TestExpandDescriptor(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	rng := [2]uint32{0, 1000}
+
+	// scriptOf returns the script of the passed address.
+	scriptOf := func(encoded string) string {
+		addr, err := btcutil.DecodeAddress(encoded, params)
+		if err != nil {
+			t.Fatalf("DecodeAddress(%s): %v", encoded, err)
+		}
+		script, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			t.Fatalf("PayToAddrScript(%s): %v", encoded, err)
+		}
+		return hex.EncodeToString(script)
+	}
+	p2pkh := scriptOf("1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH")
+	p2wpkh := scriptOf("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4")
+	p2pk := "21" + testPubKey + "ac"
+
+	tests := []struct {
+		desc    string
+		scripts []string
+		descs   []string
+	}{{
+		desc:    "raw(deadbeef)#89f8spxm",
+		scripts: []string{"deadbeef"},
+		descs:   []string{"raw(deadbeef)"},
+	}, {
+		desc:    "addr(1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH)",
+		scripts: []string{p2pkh},
+	}, {
+		desc:    "pkh(" + testPubKey + ")",
+		scripts: []string{p2pkh},
+		descs:   []string{"pkh(" + testPubKey + ")"},
+	}, {
+		desc:    "wpkh([d34db33f/84'/0'/0']" + testPubKey + ")",
+		scripts: []string{p2wpkh},
+		descs:   []string{"wpkh(" + testPubKey + ")"},
+	}, {
+		desc:    "combo(" + testPubKey + ")",
+		scripts: []string{p2pk, p2pkh, p2wpkh, ""},
+		descs: []string{"pk(" + testPubKey + ")",
+			"pkh(" + testPubKey + ")", "wpkh(" + testPubKey + ")",
+			"sh(wpkh(" + testPubKey + "))"},
+	}}
+	for _, test := range tests {
+		scripts, err := expandDescriptor(test.desc, rng, params)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.desc, err)
+			continue
+		}
+		if len(scripts) != len(test.scripts) {
+			t.Errorf("%s: got %d scripts, want %d", test.desc,
+				len(scripts), len(test.scripts))
+			continue
+		}
+		for i, script := range scripts {
+			got := hex.EncodeToString(script.pkScript)
+			if test.scripts[i] != "" && got != test.scripts[i] {
+				t.Errorf("%s: script %d is %s, want %s", test.desc,
+					i, got, test.scripts[i])
+			}
+			if test.descs == nil {
+				continue
+			}
+			want, err := addDescriptorChecksum(test.descs[i])
+			if err != nil || script.desc != want {
+				t.Errorf("%s: descriptor %d is %s, want %s",
+					test.desc, i, script.desc, want)
+			}
+		}
+	}
+
+	// A ranged descriptor expands to the keys of the child indexes in the
+	// range.
+	master, err := hdkeychain.NewKeyFromString(testXpub)
+	if err != nil {
+		t.Fatalf("NewKeyFromString: unexpected error: %v", err)
+	}
+	branch, _ := master.Child(1)
+	child, _ := branch.Child(7)
+	addr, _ := child.Address(params)
+	scripts, err := expandDescriptor("pkh("+testXpub+"/1/*)",
+		[2]uint32{5, 9}, params)
+	if err != nil {
+		t.Fatalf("ranged descriptor: unexpected error: %v", err)
+	}
+	if len(scripts) != 5 || hex.EncodeToString(scripts[2].pkScript) !=
+		scriptOf(addr.EncodeAddress()) {
+
+		t.Fatalf("ranged descriptor: got %d scripts, want the one of "+
+			"child 7 third of 5", len(scripts))
+	}
+
+	rejected := []string{
+		"raw(deadbeef)#89f8spxx",
+		"raw(zz)",
+		"addr(mkmZxiEcEd8ZqjQWVZuC6so5dFMKEFpN2j)",
+		"wpkh(" + testUncompressedPubKey + ")",
+		"sh(pkh(" + testPubKey + "))",
+		"wsh(pk(" + testPubKey + "))",
+		"pkh(" + testXprv + ")",
+		"pkh(" + testXpub + "/1'/*)",
+		"pkh",
+	}
+	for _, desc := range rejected {
+		if _, err := expandDescriptor(desc, rng, params); err == nil {
+			t.Errorf("%s: descriptor was not rejected", desc)
+		}
+	}
+}
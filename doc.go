@@ -41,10 +41,64 @@ Application Options:
                             banning misbehaving peers.
       --whitelist=          Add an IP network or IP that will not be banned.
                             (eg. 192.168.1.0/24 or ::1)
+      --ratelimit=          Limit the number of messages of a command a peer
+                            may send per minute in the form <command>:<count>,
+                            overriding the default limit for the command.
+                            Messages beyond the limit are dropped and increase
+                            the ban score of the peer.  A count of 0 disables
+                            the limit (eg. getaddr:3)
+      --asmap=              Group peer addresses by the autonomous system which
+                            announces them using the asmap file at the
+                            specified path rather than by their /16 (IPv4) or
+                            /32 (IPv6) prefix
+      --addrstore=          Storage backend the known peer addresses are
+                            persisted to {file, leveldb}.  The leveldb backend
+                            writes the changed addresses incrementally, which
+                            is faster for large address tables, and imports the
+                            addresses of the peers file on first use (file)
+      --addrscoresuccess=   Weight of a successful connection within the last
+                            week when selecting the addresses of outbound
+                            peers.  The selection is biased toward addresses
+                            with a higher total weight.  A value of 0 disables
+                            the weight
+      --addrscorelatency=   Weight of a low connection latency, as measured by
+                            the version handshake, when selecting the addresses
+                            of outbound peers.  A value of 0 disables the
+                            weight
+      --addrscoreservices=  Weight of advertising the network and witness
+                            services when selecting the addresses of outbound
+                            peers.  A value of 0 disables the weight
+      --maxpeervalidationcost= Maximum validation cost, in units of roughly a
+                            microsecond of script validation, a peer may waste
+                            by relaying transactions which are rejected.  The
+                            cost decays by half every minute.  Each rejected
+                            transaction relayed beyond it increases the ban
+                            score of the peer.  A value of 0 disables the limit
+                            (500000)
+      --maxtimeadjustment=  Maximum amount of time in either direction the
+                            local clock is adjusted by based on the clocks of
+                            the peers.  Valid time units are {s, m, h}.  A value
+                            of 0 disables the adjustment (1h10m0s)
   -u, --rpcuser=            Username for RPC connections
   -P, --rpcpass=            Password for RPC connections
       --rpclimituser=       Username for limited RPC connections
       --rpclimitpass=       Password for limited RPC connections
+      --rpcadminkey=        Hex-encoded public key of an admin whose signature
+                            counts towards authorizing destructive RPCs such
+                            as stop and invalidateblock -- May be specified
+                            multiple times
+      --rpcadminthreshold=  Number of distinct admin keys which must sign
+                            destructive RPCs -- Requires --rpcadminkey (0 to
+                            disable)
+      --rpcrolefile=        JSON file with roles which map additional RPC
+                            credentials to the methods they may call and their
+                            rate limits -- It can be reloaded with the
+                            reloadrpcroles RPC
+      --rpccookie           Write an RPC authentication cookie, which local
+                            tools may read to authenticate without configured
+                            credentials
+      --rpccookiefile=      File to write the RPC authentication cookie to --
+                            Implies --rpccookie (default: <datadir>/.cookie)
       --rpclisten=          Add an interface/port to listen for RPC connections
                             (default port: 8334, testnet: 18334)
       --rpccert=            File containing the certificate file
@@ -52,14 +106,48 @@ Application Options:
       --rpcmaxclients=      Max number of RPC clients for standard connections
                             (10)
       --rpcmaxwebsockets=   Max number of RPC websocket connections (25)
+      --rpcbatchparallelism= Max number of requests of a JSON-RPC batch that
+                            are processed concurrently -- A value of 1
+                            processes them in order (1)
       --rpcquirks           Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE:
                             Discouraged unless interoperability issues need to
                             be worked around
+      --rest                Accept public REST requests on the RPC listeners --
+                            NOTE: REST requests do not require authentication
+      --grpclisten=         Add an interface/port to serve the gRPC interface on
+                            -- It uses the TLS certificate and credentials of
+                            the RPC server and is disabled if this option is
+                            not specified
+      --zmqpubhashblock=    Publish the hashes of the blocks connected to the
+                            main chain on the specified ZeroMQ address (eg.
+                            tcp://127.0.0.1:28332)
+      --zmqpubhashblockhwm= Maximum number of hashblock messages queued for a
+                            ZeroMQ subscriber (1000)
+      --zmqpubhashtx=       Publish the hashes of the transactions added to the
+                            mempool or included in blocks on the specified
+                            ZeroMQ address
+      --zmqpubhashtxhwm=    Maximum number of hashtx messages queued for a
+                            ZeroMQ subscriber (1000)
+      --zmqpubrawblock=     Publish the blocks connected to the main chain on
+                            the specified ZeroMQ address
+      --zmqpubrawblockhwm=  Maximum number of rawblock messages queued for a
+                            ZeroMQ subscriber (1000)
+      --zmqpubrawtx=        Publish the transactions added to the mempool or
+                            included in blocks on the specified ZeroMQ address
+      --zmqpubrawtxhwm=     Maximum number of rawtx messages queued for a
+                            ZeroMQ subscriber (1000)
+      --zmqpubsequence=     Publish the blocks connected to and disconnected
+                            from the main chain and the transactions added to
+                            and removed from the mempool on the specified
+                            ZeroMQ address
+      --zmqpubsequencehwm=  Maximum number of sequence messages queued for a
+                            ZeroMQ subscriber (1000)
       --norpc               Disable built-in RPC server -- NOTE: The RPC server
-                            is disabled by default if no rpcuser/rpcpass or
-                            rpclimituser/rpclimitpass is specified
-      --notls               Disable TLS for the RPC server -- NOTE: This is only
-                            allowed if the RPC server is bound to localhost
+                            is disabled by default if no rpcuser/rpcpass,
+                            rpclimituser/rpclimitpass, rpcrolefile, or
+                            rpccookie is specified
+      --notls               Disable TLS for the RPC and gRPC servers -- NOTE:
+                            This is only allowed if they are bound to localhost
       --nodnsseed           Disable DNS seeding for peers
       --externalip=         Add an ip to the list of local addresses we claim to
                             listen on to peers
@@ -77,22 +165,79 @@ Application Options:
       --regtest             Use the regression test network
       --simnet              Use the simulation test network
       --addcheckpoint=      Add a custom checkpoint.  Format: '<height>:<hash>'
+      --checkpointfile=     File with additional checkpoints, one
+                            '<height>:<hash>' per line, which are validated
+                            against the existing chain on start up --
+                            Checkpoints added via the addcheckpoint RPC with
+                            persist set are appended to it
       --nocheckpoints       Disable built-in checkpoints.  Don't do this unless
                             you know what you're doing.
+      --checkpointmode=     How blocks which conflict with the checkpoints are
+                            handled {enforce, advisory, disabled}.  Prefix
+                            with '<network>:' to only apply to the given
+                            network -- NOTE: This option can be specified
+                            multiple times
       --uacomment=          Comment to add to the user agent --
                             See BIP 14 for more information.
       --dbtype=             Database backend to use for the Block Chain (ffldb)
+      --dbmmap              Memory-map the block files of the database for
+                            reading when supported by the database backend and
+                            platform
+      --dbcompactidle=      Compact the database metadata once no data has been
+                            written to the database for this long (0 to
+                            disable).  Valid time units are {s, m, h}
+      --dbcompactrate=      Maximum rate in bytes per second at which the
+                            database metadata is compacted during idle
+                            compaction (0 for no limit)
+      --dbblockfilesize=    Maximum size in MiB of the files blocks are stored
+                            in (1-4095) (default: 512)
+      --dbwritebuffer=      Size in KiB of the buffer block data is collected
+                            in before it is written to the block files (0 to
+                            disable)
+      --dbpreallocate       Allocate the disk space of the block files up front
+                            when supported by the platform and file system
       --profile=            Enable HTTP profiling on given port -- NOTE port
                             must be between 1024 and 65536
+      --healthlisten=       Add an interface/port to serve the /healthz
+                            liveness and /readyz readiness HTTP endpoints on
+                            -- The endpoints are disabled if this option is
+                            not specified
+      --healthmaxtipage=    Maximum age of the best block for /readyz to
+                            report the node as ready (0 to disable the
+                            check).  Valid time units are {s, m, h} (1h)
+      --healthminpeers=     Minimum number of connected peers for /readyz to
+                            report the node as ready (0 to disable the check)
+                            (1)
+      --nopartitionalerts   Disable monitoring the peers and the best block
+                            for signs of a network partition or eclipse attack
+      --partitionwebhook=   Add an HTTP(S) URL to POST partition alerts to as
+                            JSON
       --cpuprofile=         Write CPU profile to the specified file
+      --netlog=             Write the time, peer, direction, command, and size
+                            of every message sent to and received from peers to
+                            the specified file
   -d, --debuglevel=         Logging level for all subsystems {trace, debug,
                             info, warn, error, critical} -- You may also specify
                             <subsystem>=<level>,<subsystem2>=<level>,... to set
                             the log level for individual subsystems -- Use show
                             to list available subsystems (info)
+      --logtrace=           Log the trace and debug messages of all subsystems
+                            which mention the specified target at the info
+                            level in the form <kind>:<value> where kind is peer,
+                            tx, or addr (eg. peer:1.2.3.4, tx:<txid>,
+                            addr:<address>)
+      --plugin=             Load the Go plugin built with -buildmode=plugin at
+                            the specified path on startup -- NOTE: This option
+                            can be specified multiple times
+      --disableplugin=      Do not run the registered plugin with the specified
+                            name -- NOTE: This option can be specified multiple
+                            times
       --upnp                Use UPnP to map our listening port outside of NAT
       --minrelaytxfee=      The minimum transaction fee in BTC/kB to be
                             considered a non-zero fee.
+      --dustrelayfee=       The fee rate in BTC/kB used to determine whether
+                            transaction outputs are dust, which are
+                            non-standard.  Defaults to the minrelaytxfee
       --limitfreerelay=     Limit relay of transactions with no transaction fee
                             to the given amount in thousands of bytes per
                             minute (15)
@@ -100,26 +245,178 @@ Application Options:
                             high priority for relaying
       --maxorphantx=        Max number of orphan transactions to keep in memory
                             (100)
+      --maxorphanweight=    Max total weight of the orphan transactions to keep
+                            in memory, evicting those of the peer which
+                            provided the most weight first (4000000)
+      --orphantxexpiry=     How long to keep orphan transactions whose parents
+                            do not arrive.  Valid time units are {s, m, h}.
+                            Minimum 1 second (15m0s)
+      --maxmempool=         Keep the total size of the transactions in the
+                            mempool below this many megabytes by evicting those
+                            with the lowest fee rates, which raises the minimum
+                            fee rate for accepting transactions while it is
+                            full (300)
+      --nopersistmempool    Do not save the mempool on shutdown and load it
+                            again on startup
+      --mempoolexpiry=      How long to keep transactions in the mempool before
+                            evicting them along with their descendants.  Valid
+                            time units are {s, m, h}.  Minimum 1 hour
+                            (336h0m0s)
+      --maxstdtxweight=     Max weight of a transaction for it to be considered
+                            standard (400000)
+      --maxtxsigopcost=     Max total cost of the signature operations of a
+                            transaction for it to be relayed and mined (20000)
+      --datacarriersize=    Max size in bytes of a nulldata output script,
+                            which only carries data, for it to be considered
+                            standard -- Set to 0 to consider all nulldata
+                            outputs non-standard (83)
+      --limitancestorcount= Do not accept transactions into the mempool which
+                            have more than this many unconfirmed ancestors in
+                            it, including themselves (25)
+      --limitancestorsize=  Do not accept transactions into the mempool whose
+                            unconfirmed ancestors in it, including themselves,
+                            exceed this total virtual size in kilobytes (101)
+      --limitdescendantcount= Do not accept transactions into the mempool
+                            which would give any of their unconfirmed
+                            ancestors more than this many descendants in it,
+                            including themselves (25)
+      --limitdescendantsize= Do not accept transactions into the mempool which
+                            would make the descendants of any of their
+                            unconfirmed ancestors in it, including themselves,
+                            exceed this total virtual size in kilobytes (101)
+      --limitclustercount=  Do not accept transactions into the mempool which
+                            would make the cluster of unconfirmed transactions
+                            connected to them through spends in it contain
+                            more than this many transactions, including
+                            themselves (64)
+      --maxorphanblocks=    Max number of orphan blocks to keep in memory (100)
+      --maxorphanblockmem=  Max total size in MiB of the orphan blocks to keep
+                            in memory (64)
+      --orphanblockexpiry=  How long to keep orphan blocks whose parents do not
+                            arrive.  Valid time units are {s, m, h}.  Minimum 1
+                            second (1h0m0s)
       --generate            Generate (mine) bitcoins using the CPU
       --miningaddr=         Add the specified payment address to the list of
                             addresses to use for generated blocks -- At least
                             one address is required if the generate option is
                             set
+      --coinbasepayout=     Pay a fixed percentage of the value of the coinbase
+                            of generated blocks, which is the block subsidy
+                            along with the fees, to an address in the form
+                            <address>:<percent> -- The remainder is paid to the
+                            mining address and the percentages must add up to
+                            less than 100 (eg. <address>:2.5)
       --blockminsize=       Mininum block size in bytes to be used when creating
                             a block
       --blockmaxsize=       Maximum block size in bytes to be used when creating
                             a block (750000)
-      --blockprioritysize=  Size in bytes for high-priority/low-fee transactions
-                            when creating a block (50000)
+      --blockprioritysize=  DEPRECATED: This option has no effect since blocks
+                            are filled by fee rate (50000)
+      --blockmaxsigopcost=  Maximum signature operation cost to be used when
+                            creating a block -- 0 uses the consensus limit
+      --blockreservedweight= Block weight reserved for the block header and the
+                            coinbase transaction when creating a block, which is
+                            not filled with transactions (8000)
+      --blockreservedsigopcost= Signature operation cost reserved for the
+                            coinbase transaction when creating a block, which is
+                            not filled with transactions (400)
+      --stratumlisten=      Add an interface/port to listen for stratum
+                            connections from miners (default port: 3333) --
+                            Enables the stratum server, which requires at least
+                            one mining address
+      --stratumdifficulty=  Initial share difficulty of stratum clients before
+                            it is adjusted to their hash rate (1024)
+      --stratumshareinterval= Interval at which each stratum client should
+                            submit shares.  Valid time units are {s, m, h}.
+                            Minimum 1 second (10s)
+      --stratummaxclients=  Max number of stratum clients (100)
+      --sv2listen=          Add an interface/port to listen for Stratum V2
+                            template distribution connections from pools and
+                            job declarators (default port: 8442) -- Enables
+                            the template provider
+      --sv2interval=        Minimum interval between Stratum V2 templates which
+                            only add new transactions.  Valid time units are
+                            {s, m, h}.  Minimum 1 second (30s)
+      --sv2feedelta=        Minimum amount in satoshi by which the fees of a
+                            Stratum V2 template must exceed those of the
+                            previous template for the same block (1000)
+      --sv2maxclients=      Max number of Stratum V2 template provider clients
+                            (10)
       --nopeerbloomfilters  Disable bloom filtering support.
       --nocfilters          Disable committed filtering (CF) support.
+      --witnesstelemetry    Track the use of unknown witness versions and tap
+                            leaf versions in relayed transactions and connected
+                            blocks -- Enables the getwitnessupgradeinfo RPC.
+      --v2transport         Use the BIP0324 encrypted transport for peer
+                            connections -- Falls back to the unencrypted v1
+                            transport for peers that do not support it.
+      --txreconciliation    Announce transactions to peers supporting BIP0330
+                            through set reconciliation rather than flooding.
+      --forkarchive         Keep an archive of recent stale fork blocks and
+                            headers which is queryable via getchaintips and
+                            getblock and enables backfilling forks from peers
+                            via getblockfrompeer.
+      --forkarchivesize=    Maximum number of blocks retained by the fork
+                            archive (1000)
+      --forkarchiveblocks   Also download the blocks of stale forks whose
+                            headers are backfilled from peers.
+      --templatecompare     Compare every block connected to the main chain
+                            with the most recent block template generated on
+                            top of the same parent and persist the results --
+                            Enables the listtemplatecomparisons RPC
+      --attestinterval=     Interval at which attestations of the best block
+                            and the muhash of the UTXO set are signed with a
+                            node-local key and stored -- Enables the
+                            listattestations RPC (0 to disable)
       --sigcachemaxsize=    The maximum number of entries in the signature
                             verification cache.
+      --scriptworkers=      Number of goroutines which validate the scripts of
+                            blocks in parallel (0 to use 3 per CPU core)
+      --scriptschedule=     How the script validation goroutines are scheduled
+                            -- pool shares persistent goroutines between
+                            concurrent validations while perblock starts them
+                            for every block {pool, perblock} (pool)
+      --scriptcpus=         Pin the script validation goroutines to the listed
+                            CPUs in a round-robin fashion, for example
+                            0-7,16-23 -- Requires the pool schedule and is
+                            only supported on Linux
+      --scriptnumanode=     Pin the script validation goroutines to the CPUs of
+                            the specified NUMA node -- Requires the pool
+                            schedule and is only supported on Linux (-1 to
+                            disable) (-1)
+      --utxocachemaxsize=   The maximum size in MiB of the UTXO cache in front
+                            of the database -- 0 writes the UTXO changes of
+                            every block to the database immediately (250)
+      --loadsnapshot=       Load the UTXO set snapshot created by the
+                            dumptxoutset RPC from the specified file into a
+                            chain which only has the genesis block -- The
+                            blocks before the snapshot are validated in the
+                            background and the snapshot must be known to the
+                            active network
+      --prunedepth=         Delete the blocks buried more than this many
+                            blocks below the best chain tip while retaining
+                            the UTXO set -- Reorganizations deeper than this
+                            are not possible (0 to disable, otherwise at least
+                            288)
+      --utxosetstats        Maintain the statistics and the muhash of the UTXO
+                            set as blocks are connected, so the
+                            gettxoutsetinfo RPC reports them without reading
+                            the entire set
       --blocksonly          Do not accept transactions from remote peers.
       --relaynonstd         Relay non-standard transactions regardless of the
                             default settings for the active network.
       --rejectnonstd        Reject non-standard transactions regardless of the
                             default settings for the active network.
+      --rejectbaremultisig  Consider transactions with bare multi-signature
+                            output scripts, which are not wrapped in
+                            pay-to-script-hash, non-standard.
+      --rejectreplacement   Reject transactions that attempt to replace
+                            existing transactions within the mempool through
+                            the Replace-By-Fee (RBF) signaling policy.
+      --mempoolfullrbf      Accept transactions that replace existing
+                            transactions within the mempool by paying a higher
+                            fee even when the replaced transactions do not
+                            signal replacement (full RBF).
 
 Help Options:
   -h, --help           Show this help message
@@ -0,0 +1,667 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// defaultForkArchiveSize is the default maximum number of fork blocks
+	// retained by the fork archive.
+	defaultForkArchiveSize = 1000
+
+	// maxForkBackfillDepth is the maximum number of headers that are
+	// requested from a peer while walking back a single fork to the point
+	// it branches off from a known block.
+	maxForkBackfillDepth = 144
+
+	// maxForkHeightSearch is the maximum number of blocks walked back
+	// through the block index to determine the height of a side chain
+	// block.
+	maxForkHeightSearch = 1000
+
+	// forkBlockSerializeSize is the size of a serialized fork block record
+	// without the variable length source.
+	forkBlockSerializeSize = wire.MaxBlockHeaderPayload + 4 + 8 + 1
+)
+
+// Flags of a serialized fork block record.
+const (
+	forkBlockFlagHaveData  = 1 << 0
+	forkBlockFlagWasActive = 1 << 1
+)
+
+// Sources of the blocks in the fork archive other than peers.
+const (
+	forkSourceAccepted = "accepted"
+	forkSourceReorg    = "reorg"
+)
+
+// Chain tip statuses of the forks in the archive as reported by getchaintips.
+const (
+	chainTipValidFork   = "valid-fork"
+	chainTipValidHeader = "valid-headers"
+	chainTipHeadersOnly = "headers-only"
+)
+
+// forkArchiveBucketName is the name of the database bucket used to persist
+// the fork archive.
+var forkArchiveBucketName = []byte("forkarchive")
+
+// forkBlock describes a block which is not part of the main chain and is
+// retained by the fork archive.
+type forkBlock struct {
+	Hash      chainhash.Hash
+	Header    wire.BlockHeader
+	Height    int32
+	Source    string
+	FirstSeen time.Time
+
+	// HaveData indicates the full block is stored in the database.
+	HaveData bool
+
+	// WasActive indicates the block was part of the main chain until it
+	// was disconnected by a reorganization.
+	WasActive bool
+}
+
+// serialize returns the serialized fork block record.
+func (b *forkBlock) serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(forkBlockSerializeSize + len(b.Source) + 1)
+	if err := b.Header.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	var scratch [8]byte
+	binary.LittleEndian.PutUint32(scratch[:4], uint32(b.Height))
+	buf.Write(scratch[:4])
+	binary.LittleEndian.PutUint64(scratch[:], uint64(b.FirstSeen.Unix()))
+	buf.Write(scratch[:])
+	var flags byte
+	if b.HaveData {
+		flags |= forkBlockFlagHaveData
+	}
+	if b.WasActive {
+		flags |= forkBlockFlagWasActive
+	}
+	buf.WriteByte(flags)
+	if err := wire.WriteVarString(&buf, 0, b.Source); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deserializeForkBlock returns the fork block record described by the passed
+// serialized bytes.
+func deserializeForkBlock(serialized []byte) (*forkBlock, error) {
+	if len(serialized) < forkBlockSerializeSize {
+		return nil, errors.New("truncated fork block record")
+	}
+	r := bytes.NewReader(serialized)
+	var b forkBlock
+	if err := b.Header.Deserialize(r); err != nil {
+		return nil, err
+	}
+	var scratch [8]byte
+	r.Read(scratch[:4])
+	b.Height = int32(binary.LittleEndian.Uint32(scratch[:4]))
+	r.Read(scratch[:])
+	b.FirstSeen = time.Unix(int64(binary.LittleEndian.Uint64(scratch[:])), 0)
+	flags, _ := r.ReadByte()
+	b.HaveData = flags&forkBlockFlagHaveData != 0
+	b.WasActive = flags&forkBlockFlagWasActive != 0
+	source, err := wire.ReadVarString(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	b.Source = source
+	b.Hash = b.Header.BlockHash()
+	return &b, nil
+}
+
+// chainTip describes the tip of a chain as reported by getchaintips.
+type chainTip struct {
+	Height    int32
+	Hash      chainhash.Hash
+	BranchLen int32
+	Status    string
+}
+
+// pendingForkHeader is a header received from a peer whose parent is not
+// known yet.
+type pendingForkHeader struct {
+	header     *wire.BlockHeader
+	peer       *peer.Peer
+	fetchBlock bool
+}
+
+// forkBackfill tracks the header requested from a peer while walking back a
+// fork.
+type forkBackfill struct {
+	depth      int
+	fetchBlock bool
+}
+
+// forkArchiveItem is a chain notification or header response queued for
+// processing by the fork archive.
+type forkArchiveItem struct {
+	block        *btcutil.Block
+	disconnected bool
+
+	peer   *peer.Peer
+	hash   *chainhash.Hash
+	header *wire.BlockHeader
+}
+
+// forkArchive keeps a bounded, persistent archive of recently seen blocks that
+// are not part of the main chain, such as blocks orphaned by reorganizations,
+// competing blocks accepted to side chains, and headers of stale forks that
+// were backfilled from peers.  It provides operators with the data needed to
+// monitor reorg and selfish mining activity.
+//
+// Headers of stale forks are requested from peers one at a time, walking back
+// from the reported tip until the fork connects to a known block.  When
+// configured to do so, or when explicitly requested via RPC, the blocks
+// themselves are fetched as well and processed as regular side chain blocks.
+//
+// Once the archive is full the oldest records are evicted.  Note that evicting
+// a record does not remove the block data of side chain blocks from the
+// database.
+type forkArchive struct {
+	chain       *blockchain.BlockChain
+	db          database.DB
+	powLimit    *big.Int
+	maxEntries  int
+	fetchBlocks bool
+
+	// requestBlock and requestHeader are used to fetch the blocks and
+	// headers of forks from peers.
+	requestBlock  func(*chainhash.Hash, *peer.Peer) error
+	requestHeader func(*chainhash.Hash, *peer.Peer) error
+
+	mtx       sync.Mutex
+	blocks    map[chainhash.Hash]*forkBlock
+	order     []chainhash.Hash
+	pending   map[chainhash.Hash][]pendingForkHeader
+	backfills map[chainhash.Hash]forkBackfill
+
+	queueMtx sync.Mutex
+	queue    []forkArchiveItem
+	notify   chan struct{}
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// newForkArchive returns a new fork archive which loads previously archived
+// blocks from the passed database and is subscribed to the notifications of
+// the passed chain.  The request functions must be set before starting it.
+func newForkArchive(chain *blockchain.BlockChain, db database.DB,
+	powLimit *big.Int, maxEntries int, fetchBlocks bool) (*forkArchive, error) {
+
+	a := &forkArchive{
+		chain:       chain,
+		db:          db,
+		powLimit:    powLimit,
+		maxEntries:  maxEntries,
+		fetchBlocks: fetchBlocks,
+		blocks:      make(map[chainhash.Hash]*forkBlock),
+		pending:     make(map[chainhash.Hash][]pendingForkHeader),
+		backfills:   make(map[chainhash.Hash]forkBackfill),
+		notify:      make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+	}
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	chain.Subscribe(a.handleBlockchainNotification)
+	return a, nil
+}
+
+// load reads the archived blocks from the database and evicts the oldest
+// ones when there are more than the configured limit.
+func (a *forkArchive) load() error {
+	var blocks []*forkBlock
+	err := a.db.Update(func(dbTx database.Tx) error {
+		bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+			forkArchiveBucketName)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			b, err := deserializeForkBlock(v)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, b)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].FirstSeen.Before(blocks[j].FirstSeen)
+	})
+	for _, b := range blocks {
+		a.blocks[b.Hash] = b
+		a.order = append(a.order, b.Hash)
+	}
+	if evicted := a.evict(); len(evicted) > 0 {
+		return a.db.Update(func(dbTx database.Tx) error {
+			return a.deleteRecords(dbTx, evicted)
+		})
+	}
+	return nil
+}
+
+// evict removes the oldest records until the archive is within its limit and
+// returns the hashes of the removed records.
+//
+// This function MUST be called with the archive lock held or before the
+// archive is started.
+func (a *forkArchive) evict() []chainhash.Hash {
+	var evicted []chainhash.Hash
+	for len(a.order) > a.maxEntries {
+		hash := a.order[0]
+		a.order = a.order[1:]
+		delete(a.blocks, hash)
+		evicted = append(evicted, hash)
+	}
+	return evicted
+}
+
+// deleteRecords removes the records of the passed hashes from the database.
+func (a *forkArchive) deleteRecords(dbTx database.Tx, hashes []chainhash.Hash) error {
+	bucket := dbTx.Metadata().Bucket(forkArchiveBucketName)
+	for i := range hashes {
+		if err := bucket.Delete(hashes[i][:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// store adds or updates the passed record in the archive and the database.
+func (a *forkArchive) store(b *forkBlock) {
+	a.mtx.Lock()
+	if existing, ok := a.blocks[b.Hash]; ok {
+		// Keep when and from where the block was first seen.
+		b.FirstSeen = existing.FirstSeen
+		b.Source = existing.Source
+		b.HaveData = b.HaveData || existing.HaveData
+		b.WasActive = b.WasActive || existing.WasActive
+	} else {
+		a.order = append(a.order, b.Hash)
+	}
+	a.blocks[b.Hash] = b
+	evicted := a.evict()
+	a.mtx.Unlock()
+
+	serialized, err := b.serialize()
+	if err != nil {
+		srvrLog.Errorf("Unable to serialize fork block %v: %v", b.Hash, err)
+		return
+	}
+	err = a.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(forkArchiveBucketName)
+		if err := bucket.Put(b.Hash[:], serialized); err != nil {
+			return err
+		}
+		return a.deleteRecords(dbTx, evicted)
+	})
+	if err != nil {
+		srvrLog.Errorf("Unable to store fork block %v: %v", b.Hash, err)
+	}
+}
+
+// enqueue adds the passed item to the queue of items to process.
+func (a *forkArchive) enqueue(item forkArchiveItem) {
+	a.queueMtx.Lock()
+	a.queue = append(a.queue, item)
+	a.queueMtx.Unlock()
+
+	select {
+	case a.notify <- struct{}{}:
+	default:
+	}
+}
+
+// handleBlockchainNotification queues accepted and disconnected blocks for
+// processing.  The chain may not be queried from here since some
+// notifications are sent with the chain lock held.
+func (a *forkArchive) handleBlockchainNotification(notification *blockchain.Notification) {
+	var disconnected bool
+	switch notification.Type {
+	case blockchain.NTBlockAccepted:
+	case blockchain.NTBlockDisconnected:
+		disconnected = true
+	default:
+		return
+	}
+	block, ok := notification.Data.(*btcutil.Block)
+	if !ok {
+		srvrLog.Warnf("Chain notification is not a block.")
+		return
+	}
+	a.enqueue(forkArchiveItem{block: block, disconnected: disconnected})
+}
+
+// HandleForkHeader queues the response to a fork header request for
+// processing.  It is invoked by the sync manager.
+func (a *forkArchive) HandleForkHeader(p *peer.Peer, hash *chainhash.Hash,
+	header *wire.BlockHeader) {
+
+	a.enqueue(forkArchiveItem{peer: p, hash: hash, header: header})
+}
+
+// processBlock archives the passed block when it is not part of the main chain.
+func (a *forkArchive) processBlock(block *btcutil.Block, disconnected bool) {
+	if a.chain.MainChainHasBlock(block.Hash()) {
+		return
+	}
+
+	source := forkSourceAccepted
+	if disconnected {
+		source = forkSourceReorg
+	}
+	a.store(&forkBlock{
+		Hash:      *block.Hash(),
+		Header:    block.MsgBlock().Header,
+		Height:    block.Height(),
+		Source:    source,
+		FirstSeen: time.Now(),
+		HaveData:  true,
+		WasActive: disconnected,
+	})
+}
+
+// blockHeight returns the height of the block with the passed hash when it is
+// either archived or known to the chain.
+func (a *forkArchive) blockHeight(hash *chainhash.Hash) (int32, bool) {
+	a.mtx.Lock()
+	b, ok := a.blocks[*hash]
+	a.mtx.Unlock()
+	if ok {
+		return b.Height, true
+	}
+
+	// Walk back through the block index until reaching the main chain.
+	for i := int32(0); i < maxForkHeightSearch; i++ {
+		if height, err := a.chain.BlockHeightByHash(hash); err == nil {
+			return height + i, true
+		}
+		header, err := a.chain.HeaderByHash(hash)
+		if err != nil {
+			return 0, false
+		}
+		hash = &header.PrevBlock
+	}
+	return 0, false
+}
+
+// processHeader handles the response to a fork header request.  Headers which
+// connect to a known block are archived, while the parents of the others are
+// requested from the same peer.
+func (a *forkArchive) processHeader(p *peer.Peer, hash *chainhash.Hash,
+	header *wire.BlockHeader) {
+
+	a.mtx.Lock()
+	backfill := a.backfills[*hash]
+	delete(a.backfills, *hash)
+	a.mtx.Unlock()
+
+	if header == nil {
+		srvrLog.Debugf("Peer %v does not know fork block %v", p, hash)
+		a.dropPending(hash)
+		return
+	}
+	if err := blockchain.CheckHeaderProofOfWork(header, a.powLimit); err != nil {
+		srvrLog.Infof("Rejected fork header %v from %v: %v", hash, p, err)
+		a.dropPending(hash)
+		return
+	}
+
+	pending := pendingForkHeader{header, p, backfill.fetchBlock}
+	height, ok := a.blockHeight(&header.PrevBlock)
+	if ok {
+		a.archiveHeader(pending, height+1)
+		return
+	}
+
+	// Walk further back to find where the fork branches off.
+	if backfill.depth >= maxForkBackfillDepth {
+		srvrLog.Infof("Giving up on fork %v from %v after %d headers",
+			hash, p, backfill.depth)
+		a.dropPending(hash)
+		return
+	}
+	a.mtx.Lock()
+	a.pending[header.PrevBlock] = append(a.pending[header.PrevBlock], pending)
+	a.mtx.Unlock()
+	err := a.backfill(&header.PrevBlock, p, backfill.depth+1,
+		backfill.fetchBlock)
+	if err != nil {
+		srvrLog.Debugf("Unable to request fork header %v from %v: %v",
+			header.PrevBlock, p, err)
+		a.dropPending(&header.PrevBlock)
+	}
+}
+
+// archiveHeader archives the passed header at the given height, requests its
+// block when needed and then processes the headers which were waiting for it.
+func (a *forkArchive) archiveHeader(pending pendingForkHeader, height int32) {
+	hash := pending.header.BlockHash()
+	haveBlock, _ := a.chain.HaveBlock(&hash)
+	if !a.chain.MainChainHasBlock(&hash) {
+		a.store(&forkBlock{
+			Hash:      hash,
+			Header:    *pending.header,
+			Height:    height,
+			Source:    pending.peer.Addr(),
+			FirstSeen: time.Now(),
+			HaveData:  haveBlock,
+		})
+		if !haveBlock && (a.fetchBlocks || pending.fetchBlock) {
+			err := a.requestBlock(&hash, pending.peer)
+			if err != nil {
+				srvrLog.Debugf("Unable to request fork block "+
+					"%v from %v: %v", hash, pending.peer, err)
+			}
+		}
+	}
+
+	a.mtx.Lock()
+	children := a.pending[hash]
+	delete(a.pending, hash)
+	a.mtx.Unlock()
+	for _, child := range children {
+		a.archiveHeader(child, height+1)
+	}
+}
+
+// dropPending discards the headers waiting for the passed block along with
+// all of their descendants.
+func (a *forkArchive) dropPending(hash *chainhash.Hash) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	queue := []chainhash.Hash{*hash}
+	for len(queue) > 0 {
+		children := a.pending[queue[0]]
+		delete(a.pending, queue[0])
+		queue = queue[1:]
+		for _, child := range children {
+			queue = append(queue, child.header.BlockHash())
+		}
+	}
+}
+
+// backfill requests the header of the passed block from the peer.
+func (a *forkArchive) backfill(hash *chainhash.Hash, p *peer.Peer, depth int,
+	fetchBlock bool) error {
+
+	a.mtx.Lock()
+	a.backfills[*hash] = forkBackfill{depth: depth, fetchBlock: fetchBlock}
+	a.mtx.Unlock()
+
+	err := a.requestHeader(hash, p)
+	if err != nil {
+		a.mtx.Lock()
+		delete(a.backfills, *hash)
+		a.mtx.Unlock()
+	}
+	return err
+}
+
+// FetchFromPeer requests the block with the passed hash from the peer.  When
+// the header of the block is not known yet, the headers of the fork it is part
+// of are backfilled from the peer first and the blocks of the fork are fetched
+// once they connect to a known block.
+//
+// This function is safe for concurrent access.
+func (a *forkArchive) FetchFromPeer(hash *chainhash.Hash, p *peer.Peer) error {
+	_, archived := a.Block(hash)
+	if _, err := a.chain.HeaderByHash(hash); archived || err == nil {
+		return a.requestBlock(hash, p)
+	}
+	return a.backfill(hash, p, 1, true)
+}
+
+// Block returns the archived record of the block with the passed hash.  It is
+// safe to call on a nil instance in which case no block is found.
+//
+// This function is safe for concurrent access.
+func (a *forkArchive) Block(hash *chainhash.Hash) (forkBlock, bool) {
+	if a == nil {
+		return forkBlock{}, false
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	b, ok := a.blocks[*hash]
+	if !ok {
+		return forkBlock{}, false
+	}
+	return *b, true
+}
+
+// ChainTips returns the tips of the forks in the archive which are not part of
+// the main chain.  It is safe to call on a nil instance in which case there
+// are no tips.
+//
+// This function is safe for concurrent access.
+func (a *forkArchive) ChainTips() []chainTip {
+	if a == nil {
+		return nil
+	}
+
+	// Determine the archived blocks which are still not in the main chain,
+	// since archived blocks may be reorganized back into it.
+	a.mtx.Lock()
+	blocks := make(map[chainhash.Hash]forkBlock, len(a.blocks))
+	for hash, b := range a.blocks {
+		blocks[hash] = *b
+	}
+	a.mtx.Unlock()
+	for hash := range blocks {
+		if a.chain.MainChainHasBlock(&hash) {
+			delete(blocks, hash)
+		}
+	}
+
+	// Any block which is not the parent of another fork block is a tip.
+	hasChild := make(map[chainhash.Hash]struct{}, len(blocks))
+	for _, b := range blocks {
+		hasChild[b.Header.PrevBlock] = struct{}{}
+	}
+	var tips []chainTip
+	for hash, tip := range blocks {
+		if _, ok := hasChild[hash]; ok {
+			continue
+		}
+
+		// Walk back through the branch to determine its length and
+		// status.
+		haveData, wasActive := true, true
+		branchLen := int32(0)
+		for b, ok := tip, true; ok; b, ok = blocks[b.Header.PrevBlock] {
+			branchLen++
+			haveData = haveData && b.HaveData
+			wasActive = wasActive && b.WasActive
+		}
+		status := chainTipValidHeader
+		switch {
+		case !haveData:
+			status = chainTipHeadersOnly
+		case wasActive:
+			status = chainTipValidFork
+		}
+		tips = append(tips, chainTip{
+			Height:    tip.Height,
+			Hash:      hash,
+			BranchLen: branchLen,
+			Status:    status,
+		})
+	}
+	sort.Slice(tips, func(i, j int) bool {
+		return tips[i].Height > tips[j].Height
+	})
+	return tips
+}
+
+// queueHandler processes queued items until the archive is stopped.  It must
+// be run as a goroutine.
+func (a *forkArchive) queueHandler() {
+	defer a.wg.Done()
+
+	for {
+		select {
+		case <-a.notify:
+		case <-a.quit:
+			return
+		}
+
+		a.queueMtx.Lock()
+		queue := a.queue
+		a.queue = nil
+		a.queueMtx.Unlock()
+
+		for _, item := range queue {
+			if item.block != nil {
+				a.processBlock(item.block, item.disconnected)
+				continue
+			}
+			a.processHeader(item.peer, item.hash, item.header)
+		}
+	}
+}
+
+// Start begins processing queued notifications and header responses.
+func (a *forkArchive) Start() {
+	a.wg.Add(1)
+	go a.queueHandler()
+}
+
+// Stop stops processing and waits for the processing goroutine to finish.
+func (a *forkArchive) Stop() {
+	close(a.quit)
+	a.wg.Wait()
+}
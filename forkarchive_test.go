@@ -0,0 +1,74 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestForkBlockSerialization ensures fork archive records survive a round trip
+// through their serialized form.
+func TestForkBlockSerialization(t *testing.T) {
+	header := chaincfg.MainNetParams.GenesisBlock.Header
+	header.Nonce++
+	want := &forkBlock{
+		Hash:      header.BlockHash(),
+		Header:    header,
+		Height:    1234,
+		Source:    "127.0.0.1:8333",
+		FirstSeen: time.Unix(1600000000, 0),
+		HaveData:  true,
+		WasActive: true,
+	}
+
+	serialized, err := want.serialize()
+	if err != nil {
+		t.Fatalf("unexpected serialize error: %v", err)
+	}
+	got, err := deserializeForkBlock(serialized)
+	if err != nil {
+		t.Fatalf("unexpected deserialize error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mismatched record - got %+v, want %+v", got, want)
+	}
+
+	if _, err := deserializeForkBlock(serialized[:20]); err == nil {
+		t.Fatal("truncated record was not rejected")
+	}
+}
+
+// TestForkArchiveEviction ensures the fork archive evicts the oldest records
+// once it exceeds its limit.
+func TestForkArchiveEviction(t *testing.T) {
+	a := &forkArchive{
+		maxEntries: 3,
+		blocks:     make(map[chainhash.Hash]*forkBlock),
+	}
+	var hashes []chainhash.Hash
+	for i := 0; i < 5; i++ {
+		hash := chainhash.Hash{byte(i)}
+		hashes = append(hashes, hash)
+		a.blocks[hash] = &forkBlock{Hash: hash}
+		a.order = append(a.order, hash)
+	}
+
+	evicted := a.evict()
+	if !reflect.DeepEqual(evicted, hashes[:2]) {
+		t.Fatalf("unexpected evicted records - got %v, want %v",
+			evicted, hashes[:2])
+	}
+	for i, hash := range hashes {
+		_, ok := a.Block(&hash)
+		if ok != (i >= 2) {
+			t.Fatalf("record %d: unexpected presence %v", i, ok)
+		}
+	}
+}
@@ -0,0 +1,570 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"sync"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcdrpc"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcSubscriptionBuffer is the number of events buffered for a stream of the
+// gRPC interface.  Streams whose client does not keep up with the events are
+// ended once their buffer is full, so the client can detect that it missed
+// events and resubscribe.
+const grpcSubscriptionBuffer = 1000
+
+// errGRPCFellBehind is returned to clients of streams which were ended because
+// they did not keep up with the events.
+var errGRPCFellBehind = status.Error(codes.ResourceExhausted,
+	"subscriber fell behind")
+
+// grpcMethodRPCs maps the methods of the gRPC interface to the RPC methods
+// whose permission is required to call them.
+var grpcMethodRPCs = map[string]string{
+	"/btcdrpc.Btcd/GetBestBlock":          "getbestblock",
+	"/btcdrpc.Btcd/GetBlock":              "getblock",
+	"/btcdrpc.Btcd/GetTransaction":        "getrawtransaction",
+	"/btcdrpc.Btcd/SubmitTransaction":     "sendrawtransaction",
+	"/btcdrpc.Btcd/SubscribeBlocks":       "notifyblocks",
+	"/btcdrpc.Btcd/SubscribeTransactions": "notifyblocks",
+	"/btcdrpc.Btcd/SubscribeMempool":      "notifynewtransactions",
+}
+
+// grpcServer serves the gRPC interface defined by the btcdrpc package.  It is
+// an alternative to the websocket extensions of the RPC server for services
+// which integrate with the node, so it authenticates clients with the RPC
+// credentials and shares the handlers of the RPC server where possible.
+type grpcServer struct {
+	rpc       *rpcServer
+	server    *grpc.Server
+	listeners []net.Listener
+	wg        sync.WaitGroup
+}
+
+// Ensure grpcServer implements the btcdrpc.BtcdServer interface.
+var _ btcdrpc.BtcdServer = (*grpcServer)(nil)
+
+// newGRPCServer returns a gRPC server which serves the gRPC interface on the
+// passed listeners for the passed RPC server.  The connections are secured
+// with the passed TLS configuration unless it is nil.
+func newGRPCServer(rpc *rpcServer, listeners []net.Listener,
+	tlsConfig *tls.Config) *grpcServer {
+
+	g := &grpcServer{
+		rpc:       rpc,
+		listeners: listeners,
+	}
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(g.unaryInterceptor),
+		grpc.StreamInterceptor(g.streamInterceptor),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	g.server = grpc.NewServer(opts...)
+	btcdrpc.RegisterBtcdServer(g.server, g)
+
+	return g
+}
+
+// Start begins serving the gRPC interface on the listeners.
+func (g *grpcServer) Start() {
+	for _, listener := range g.listeners {
+		g.wg.Add(1)
+		go func(listener net.Listener) {
+			rpcsLog.Infof("gRPC server listening on %s",
+				listener.Addr())
+			g.server.Serve(listener)
+			g.wg.Done()
+		}(listener)
+	}
+}
+
+// Stop stops serving the gRPC interface, which ends the streams of the clients,
+// and waits for the listeners to be closed.
+func (g *grpcServer) Stop() {
+	g.server.Stop()
+	g.wg.Wait()
+}
+
+// checkAuth ensures the client of the call with the passed context provided the
+// credentials of an RPC user in the authorization metadata, in the same form as
+// the HTTP Authorization header of the RPC server, and that their role allows
+// the RPC method which corresponds to the passed gRPC method.  Calls are
+// rejected while the node is a hot standby.
+func (g *grpcServer) checkAuth(ctx context.Context, method string) error {
+	if g.rpc.cfg.Standby.IsStandby() {
+		return status.Error(codes.Unavailable, "node is in standby mode")
+	}
+
+	var authhdr []string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		authhdr = md.Get("authorization")
+	}
+	var authKey [sha256.Size]byte
+	if len(authhdr) > 0 {
+		authKey = rpcAuthKey(authhdr[0])
+	}
+	if len(authhdr) == 0 || !g.rpc.roles.authenticate(authKey) {
+		var addr net.Addr
+		if p, ok := peer.FromContext(ctx); ok {
+			addr = p.Addr
+		}
+		rpcsLog.Warnf("gRPC authentication failure from %v", addr)
+		return status.Error(codes.Unauthenticated, "auth failure")
+	}
+
+	rpcMethod, ok := grpcMethodRPCs[method]
+	if !ok {
+		return status.Error(codes.PermissionDenied,
+			errRPCMethodForbidden.Error())
+	}
+	switch err := g.rpc.roles.authorize(authKey, rpcMethod); err {
+	case nil:
+		return nil
+	case errRPCRateLimited:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errRPCUnknownCredentials:
+		return status.Error(codes.Unauthenticated, err.Error())
+	default:
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+}
+
+// unaryInterceptor authenticates unary calls before they are handled.
+func (g *grpcServer) unaryInterceptor(ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+	if err := g.checkAuth(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor authenticates streaming calls before they are handled.
+func (g *grpcServer) streamInterceptor(srv interface{}, ss grpc.ServerStream,
+	info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+	if err := g.checkAuth(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// grpcRPCError converts an error returned by a handler of the RPC server to the
+// gRPC status with the closest matching code.
+func grpcRPCError(err error) error {
+	rpcErr, ok := err.(*btcjson.RPCError)
+	if !ok {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	// ErrRPCNoTxInfo and ErrRPCDecodeHexString share the codes of
+	// ErrRPCBlockNotFound and ErrRPCDeserialization respectively.
+	code := codes.Internal
+	switch rpcErr.Code {
+	case btcjson.ErrRPCBlockNotFound:
+		code = codes.NotFound
+
+	case btcjson.ErrRPCDeserialization, btcjson.ErrRPCInvalidParameter:
+		code = codes.InvalidArgument
+
+	case btcjson.ErrRPCTxAlreadyInChain:
+		code = codes.AlreadyExists
+
+	case btcjson.ErrRPCTxRejected, btcjson.ErrRPCTxError:
+		code = codes.FailedPrecondition
+	}
+	return status.Error(code, rpcErr.Message)
+}
+
+// serializeTx returns the passed transaction in the wire format including its
+// witness data.
+func serializeTx(msgTx *wire.MsgTx) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(msgTx.SerializeSize())
+	if err := msgTx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GetBestBlock returns the hash and height of the best block of the main chain.
+func (g *grpcServer) GetBestBlock(ctx context.Context,
+	req *btcdrpc.GetBestBlockRequest) (*btcdrpc.GetBestBlockResponse, error) {
+
+	best := g.rpc.cfg.Chain.BestSnapshot()
+	return &btcdrpc.GetBestBlockResponse{
+		Hash:   best.Hash.CloneBytes(),
+		Height: best.Height,
+	}, nil
+}
+
+// GetBlock returns a block of the main chain by hash, or by height when no hash
+// is given.
+func (g *grpcServer) GetBlock(ctx context.Context,
+	req *btcdrpc.GetBlockRequest) (*btcdrpc.GetBlockResponse, error) {
+
+	chain := g.rpc.cfg.Chain
+	var block *btcutil.Block
+	if len(req.Hash) > 0 {
+		hash, err := chainhash.NewHash(req.Hash)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		block, err = chain.BlockByHash(hash)
+		if err != nil {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+	} else {
+		var err error
+		block, err = chain.BlockByHeight(req.Height)
+		if err != nil {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+	}
+
+	blockBytes, err := block.Bytes()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	best := chain.BestSnapshot()
+	return &btcdrpc.GetBlockResponse{
+		Block:         blockBytes,
+		Height:        block.Height(),
+		Confirmations: 1 + best.Height - block.Height(),
+	}, nil
+}
+
+// GetTransaction returns a transaction from the memory pool or, when the
+// transaction index is enabled, from the main chain along with the block which
+// contains it.
+func (g *grpcServer) GetTransaction(ctx context.Context,
+	req *btcdrpc.GetTransactionRequest) (*btcdrpc.GetTransactionResponse, error) {
+
+	txHash, err := chainhash.NewHash(req.Txid)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if tx, err := g.rpc.cfg.TxMemPool.FetchTransaction(txHash); err == nil {
+		txBytes, err := serializeTx(tx.MsgTx())
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &btcdrpc.GetTransactionResponse{Transaction: txBytes}, nil
+	}
+
+	txIndex := g.rpc.cfg.TxIndex
+	if txIndex == nil {
+		return nil, status.Error(codes.NotFound, "transaction is not in "+
+			"the memory pool and the transaction index, which is "+
+			"required to query the blockchain, is disabled")
+	}
+	blockRegion, err := txIndex.TxBlockRegion(txHash)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if blockRegion == nil {
+		return nil, status.Errorf(codes.NotFound, "no information "+
+			"available about transaction %v", txHash)
+	}
+	var txBytes []byte
+	err = g.rpc.cfg.DB.View(func(dbTx database.Tx) error {
+		var err error
+		txBytes, err = dbTx.FetchBlockRegion(blockRegion)
+		return err
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	chain := g.rpc.cfg.Chain
+	blockHeight, err := chain.BlockHeightByHash(blockRegion.Hash)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	best := chain.BestSnapshot()
+	return &btcdrpc.GetTransactionResponse{
+		Transaction:   txBytes,
+		BlockHash:     blockRegion.Hash.CloneBytes(),
+		BlockHeight:   blockHeight,
+		Confirmations: 1 + best.Height - blockHeight,
+	}, nil
+}
+
+// SubmitTransaction adds a transaction to the memory pool and relays it the
+// same way as the sendrawtransaction RPC.
+func (g *grpcServer) SubmitTransaction(ctx context.Context,
+	req *btcdrpc.SubmitTransactionRequest) (*btcdrpc.SubmitTransactionResponse, error) {
+
+	cmd := btcjson.NewSendRawTransactionCmd(hex.EncodeToString(
+		req.Transaction), nil)
+	result, err := handleSendRawTransaction(g.rpc, cmd, nil)
+	if err != nil {
+		return nil, grpcRPCError(err)
+	}
+	txHash, err := chainhash.NewHashFromStr(result.(string))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &btcdrpc.SubmitTransactionResponse{
+		Txid: txHash.CloneBytes(),
+	}, nil
+}
+
+// newBlockEvent returns the gRPC event for the passed block which was connected
+// to or disconnected from the main chain.  The full block is only included
+// when requested.
+func newBlockEvent(seq uint64, typ btcdrpc.BlockEvent_Type,
+	block *btcutil.Block, includeBlock bool) (*btcdrpc.BlockEvent, error) {
+
+	var header bytes.Buffer
+	header.Grow(wire.MaxBlockHeaderPayload)
+	if err := block.MsgBlock().Header.Serialize(&header); err != nil {
+		return nil, err
+	}
+	event := &btcdrpc.BlockEvent{
+		Sequence: seq,
+		Type:     typ,
+		Hash:     block.Hash().CloneBytes(),
+		Height:   block.Height(),
+		Header:   header.Bytes(),
+	}
+	if includeBlock {
+		blockBytes, err := block.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		event.Block = blockBytes
+	}
+	return event, nil
+}
+
+// SubscribeBlocks streams the blocks which are connected to and disconnected
+// from the main chain until the client cancels the call.
+func (g *grpcServer) SubscribeBlocks(req *btcdrpc.SubscribeBlocksRequest,
+	stream btcdrpc.Btcd_SubscribeBlocksServer) error {
+
+	chain := g.rpc.cfg.Chain
+	connected := chain.SubscribeBlockConnected(grpcSubscriptionBuffer,
+		blockchain.PolicyClose)
+	defer connected.Unsubscribe()
+	disconnected := chain.SubscribeBlockDisconnected(grpcSubscriptionBuffer,
+		blockchain.PolicyClose)
+	defer disconnected.Unsubscribe()
+
+	// The events of the two subscriptions are merged in the order of their
+	// sequence numbers.  The events of a notification are delivered to all
+	// subscriptions before the next notification is published, so once an
+	// event is received, any earlier event of the other kind is already
+	// buffered and is picked up without waiting.
+	var nextConnected *blockchain.BlockConnectedEvent
+	var nextDisconnected *blockchain.BlockDisconnectedEvent
+	ctx := stream.Context()
+	for {
+		if nextConnected == nil && nextDisconnected == nil {
+			select {
+			case event, ok := <-connected.C:
+				if !ok {
+					return errGRPCFellBehind
+				}
+				nextConnected = event
+
+			case event, ok := <-disconnected.C:
+				if !ok {
+					return errGRPCFellBehind
+				}
+				nextDisconnected = event
+
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		if nextConnected == nil {
+			select {
+			case event, ok := <-connected.C:
+				if !ok {
+					return errGRPCFellBehind
+				}
+				nextConnected = event
+			default:
+			}
+		}
+		if nextDisconnected == nil {
+			select {
+			case event, ok := <-disconnected.C:
+				if !ok {
+					return errGRPCFellBehind
+				}
+				nextDisconnected = event
+			default:
+			}
+		}
+
+		var event *btcdrpc.BlockEvent
+		var err error
+		if nextDisconnected == nil || (nextConnected != nil &&
+			nextConnected.Sequence < nextDisconnected.Sequence) {
+
+			event, err = newBlockEvent(nextConnected.Sequence,
+				btcdrpc.BlockEvent_CONNECTED, nextConnected.Block,
+				req.IncludeBlock)
+			nextConnected = nil
+		} else {
+			event, err = newBlockEvent(nextDisconnected.Sequence,
+				btcdrpc.BlockEvent_DISCONNECTED,
+				nextDisconnected.Block, req.IncludeBlock)
+			nextDisconnected = nil
+		}
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+}
+
+// SubscribeTransactions streams the transactions of the blocks which are
+// connected to the main chain until the client cancels the call.
+func (g *grpcServer) SubscribeTransactions(req *btcdrpc.SubscribeTransactionsRequest,
+	stream btcdrpc.Btcd_SubscribeTransactionsServer) error {
+
+	sub := g.rpc.cfg.Chain.SubscribeTxAccepted(grpcSubscriptionBuffer,
+		blockchain.PolicyClose)
+	defer sub.Unsubscribe()
+
+	ctx := stream.Context()
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return errGRPCFellBehind
+			}
+			txBytes, err := serializeTx(event.Tx.MsgTx())
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			err = stream.Send(&btcdrpc.TransactionEvent{
+				Sequence:    event.Sequence,
+				Transaction: txBytes,
+				BlockHash:   event.BlockHash.CloneBytes(),
+				BlockHeight: event.BlockHeight,
+				Index:       uint32(event.TxIndex),
+			})
+			if err != nil {
+				return err
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// newMempoolEvent returns the gRPC event for the passed change of the memory
+// pool.  The transactions of ADDED events are only included when requested.
+func newMempoolEvent(event *mempool.TxEvent,
+	includeTx bool) (*btcdrpc.MempoolEvent, error) {
+
+	ntfn := &btcdrpc.MempoolEvent{Sequence: event.Sequence}
+	txD := event.TxDesc
+	switch event.Type {
+	case mempool.TxEventAdded:
+		ntfn.Type = btcdrpc.MempoolEvent_ADDED
+		if includeTx {
+			txBytes, err := serializeTx(txD.Tx.MsgTx())
+			if err != nil {
+				return nil, err
+			}
+			ntfn.Transaction = txBytes
+		}
+
+	case mempool.TxEventRemoved:
+		ntfn.Type = btcdrpc.MempoolEvent_REMOVED
+		ntfn.Reason = event.Reason.String()
+
+	case mempool.TxEventReplaced:
+		ntfn.Type = btcdrpc.MempoolEvent_REPLACED
+		txD = event.Replacement.Replacement
+		ntfn.Replaced = make([][]byte, 0, len(event.Replacement.Replaced))
+		for _, replaced := range event.Replacement.Replaced {
+			ntfn.Replaced = append(ntfn.Replaced,
+				replaced.Tx.Hash().CloneBytes())
+		}
+	}
+	ntfn.Txid = txD.Tx.Hash().CloneBytes()
+	ntfn.Fee = txD.Fee
+	ntfn.Vsize = mempool.GetTxVirtualSize(txD.Tx)
+
+	return ntfn, nil
+}
+
+// SubscribeMempool streams the transactions which are added to, removed from,
+// and replaced in the memory pool until the client cancels the call.  When
+// requested, an ADDED event is sent for every transaction in the pool first.
+func (g *grpcServer) SubscribeMempool(req *btcdrpc.SubscribeMempoolRequest,
+	stream btcdrpc.Btcd_SubscribeMempoolServer) error {
+
+	sub := g.rpc.cfg.TxMemPool.SubscribeTxEvents(grpcSubscriptionBuffer,
+		blockchain.PolicyClose, req.Snapshot)
+	defer sub.Unsubscribe()
+
+	for _, txD := range sub.Snapshot {
+		event, err := newMempoolEvent(&mempool.TxEvent{
+			Sequence: sub.Sequence,
+			Type:     mempool.TxEventAdded,
+			TxDesc:   txD,
+		}, req.IncludeTransactions)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case txEvent, ok := <-sub.C:
+			if !ok {
+				return errGRPCFellBehind
+			}
+			event, err := newMempoolEvent(txEvent,
+				req.IncludeTransactions)
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
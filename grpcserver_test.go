@@ -0,0 +1,212 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcdrpc"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TestGRPCCheckAuth ensures gRPC calls are only allowed with the credentials
+// of an RPC user in the authorization metadata whose role allows the RPC method
+// of the call.
+func TestGRPCCheckAuth(t *testing.T) {
+	basicAuth := func(user, pass string) string {
+		login := user + ":" + pass
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
+	}
+	roles, cleanup := newTestRPCRoles(t, testRPCRoleFile)
+	defer cleanup()
+	g := &grpcServer{rpc: &rpcServer{roles: roles}}
+
+	const (
+		getBestBlock      = "/btcdrpc.Btcd/GetBestBlock"
+		submitTransaction = "/btcdrpc.Btcd/SubmitTransaction"
+	)
+	tests := []struct {
+		name     string
+		auth     []string
+		method   string
+		wantCode codes.Code
+	}{
+		{name: "admin", auth: []string{basicAuth("admin", "pass")},
+			method: submitTransaction, wantCode: codes.OK},
+		{name: "limited", auth: []string{basicAuth("limited", "pass")},
+			method: submitTransaction, wantCode: codes.OK},
+		{name: "monitor", auth: []string{basicAuth("grafana", "secret")},
+			method: getBestBlock, wantCode: codes.OK},
+		{name: "monitor forbidden",
+			auth:     []string{basicAuth("grafana", "secret")},
+			method:   submitTransaction,
+			wantCode: codes.PermissionDenied},
+		{name: "monitor second call",
+			auth:   []string{basicAuth("grafana", "secret")},
+			method: getBestBlock, wantCode: codes.OK},
+		{name: "monitor rate limited",
+			auth:     []string{basicAuth("grafana", "secret")},
+			method:   getBestBlock,
+			wantCode: codes.ResourceExhausted},
+		{name: "unknown method",
+			auth:     []string{basicAuth("admin", "pass")},
+			method:   "/btcdrpc.Btcd/NoSuchMethod",
+			wantCode: codes.PermissionDenied},
+		{name: "wrong password",
+			auth:     []string{basicAuth("admin", "wrong")},
+			method:   getBestBlock,
+			wantCode: codes.Unauthenticated},
+		{name: "no credentials", method: getBestBlock,
+			wantCode: codes.Unauthenticated},
+	}
+	for _, test := range tests {
+		ctx := context.Background()
+		if test.auth != nil {
+			md := metadata.Pairs("authorization", test.auth[0])
+			ctx = metadata.NewIncomingContext(ctx, md)
+		}
+		err := g.checkAuth(ctx, test.method)
+		if code := status.Code(err); code != test.wantCode {
+			t.Errorf("%s: got code %v, want %v", test.name, code,
+				test.wantCode)
+		}
+	}
+}
+
+// TestGRPCRPCError ensures errors of the RPC handlers are converted to the gRPC
+// status with the matching code.
+func TestGRPCRPCError(t *testing.T) {
+	tests := []struct {
+		code     btcjson.RPCErrorCode
+		wantCode codes.Code
+	}{
+		{btcjson.ErrRPCNoTxInfo, codes.NotFound},
+		{btcjson.ErrRPCDeserialization, codes.InvalidArgument},
+		{btcjson.ErrRPCTxAlreadyInChain, codes.AlreadyExists},
+		{btcjson.ErrRPCTxRejected, codes.FailedPrecondition},
+		{btcjson.ErrRPCInternal.Code, codes.Internal},
+	}
+	for _, test := range tests {
+		err := grpcRPCError(btcjson.NewRPCError(test.code, "message"))
+		st, _ := status.FromError(err)
+		if st.Code() != test.wantCode || st.Message() != "message" {
+			t.Errorf("%v: got status %v, want code %v", test.code, st,
+				test.wantCode)
+		}
+	}
+}
+
+// TestGRPCEvents ensures block and memory pool events are converted to the
+// events of the gRPC streams.
+func TestGRPCEvents(t *testing.T) {
+	block := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	block.SetHeight(0)
+	event, err := newBlockEvent(7, btcdrpc.BlockEvent_DISCONNECTED, block,
+		false)
+	if err != nil {
+		t.Fatalf("newBlockEvent: unexpected error: %v", err)
+	}
+	var header bytes.Buffer
+	block.MsgBlock().Header.Serialize(&header)
+	if event.Sequence != 7 || event.Type != btcdrpc.BlockEvent_DISCONNECTED ||
+		!bytes.Equal(event.Hash, block.Hash()[:]) ||
+		!bytes.Equal(event.Header, header.Bytes()) || event.Block != nil {
+
+		t.Fatalf("unexpected block event %+v", event)
+	}
+	event, err = newBlockEvent(8, btcdrpc.BlockEvent_CONNECTED, block, true)
+	if err != nil {
+		t.Fatalf("newBlockEvent: unexpected error: %v", err)
+	}
+	blockBytes, _ := block.Bytes()
+	if !bytes.Equal(event.Block, blockBytes) {
+		t.Fatalf("block event does not include the block")
+	}
+
+	newTxDesc := func(lockTime uint32, fee int64) *mempool.TxDesc {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+		msgTx.AddTxOut(wire.NewTxOut(1000, nil))
+		msgTx.LockTime = lockTime
+		return &mempool.TxDesc{TxDesc: mining.TxDesc{
+			Tx:  btcutil.NewTx(msgTx),
+			Fee: fee,
+		}}
+	}
+	added := newTxDesc(1, 500)
+	replaced := newTxDesc(2, 200)
+	tests := []struct {
+		name        string
+		event       *mempool.TxEvent
+		includeTx   bool
+		wantType    btcdrpc.MempoolEvent_Type
+		wantTxDesc  *mempool.TxDesc
+		wantReason  string
+		wantTx      bool
+		numReplaced int
+	}{{
+		name: "added",
+		event: &mempool.TxEvent{Sequence: 1, Type: mempool.TxEventAdded,
+			TxDesc: added},
+		wantType:   btcdrpc.MempoolEvent_ADDED,
+		wantTxDesc: added,
+	}, {
+		name: "added with transaction",
+		event: &mempool.TxEvent{Sequence: 1, Type: mempool.TxEventAdded,
+			TxDesc: added},
+		includeTx:  true,
+		wantType:   btcdrpc.MempoolEvent_ADDED,
+		wantTxDesc: added,
+		wantTx:     true,
+	}, {
+		name: "removed",
+		event: &mempool.TxEvent{Sequence: 2, Type: mempool.TxEventRemoved,
+			TxDesc: replaced, Reason: mempool.RemovalReasonReplaced},
+		includeTx:  true,
+		wantType:   btcdrpc.MempoolEvent_REMOVED,
+		wantTxDesc: replaced,
+		wantReason: "replaced",
+	}, {
+		name: "replaced",
+		event: &mempool.TxEvent{Sequence: 3, Type: mempool.TxEventReplaced,
+			Replacement: &mempool.TxReplacement{
+				Replacement: added,
+				Replaced:    []*mempool.TxDesc{replaced},
+			}},
+		wantType:    btcdrpc.MempoolEvent_REPLACED,
+		wantTxDesc:  added,
+		numReplaced: 1,
+	}}
+	for _, test := range tests {
+		event, err := newMempoolEvent(test.event, test.includeTx)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		tx := test.wantTxDesc.Tx
+		if event.Sequence != test.event.Sequence ||
+			event.Type != test.wantType ||
+			!bytes.Equal(event.Txid, tx.Hash()[:]) ||
+			event.Fee != test.wantTxDesc.Fee ||
+			event.Vsize != mempool.GetTxVirtualSize(tx) ||
+			event.Reason != test.wantReason ||
+			(event.Transaction != nil) != test.wantTx ||
+			len(event.Replaced) != test.numReplaced {
+
+			t.Errorf("%s: unexpected event %+v", test.name, event)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/database"
+)
+
+const (
+	// defaultHealthMaxTipAge is the default maximum age of the best block
+	// for the node to be reported ready.
+	defaultHealthMaxTipAge = time.Hour
+
+	// defaultHealthMinPeers is the default minimum number of connected
+	// peers for the node to be reported ready.
+	defaultHealthMinPeers = 1
+)
+
+// healthCheck describes the result of checking the state of a single
+// subsystem.
+type healthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// healthReport is the response served by the health endpoints.  The status is
+// "ok" when all of the checks passed and "unavailable" otherwise.
+type healthReport struct {
+	Status string        `json:"status"`
+	Checks []healthCheck `json:"checks"`
+}
+
+// healthServer serves the /healthz and /readyz HTTP endpoints which are meant
+// to be probed by orchestrators such as Kubernetes.  The liveness endpoint only
+// reports whether the database is still open, while the readiness endpoint also
+// requires the chain to be current, enough peers to be connected, and the RPC
+// server to be serving, so traffic is not routed to a node which is still
+// syncing.
+type healthServer struct {
+	maxTipAge time.Duration
+	minPeers  int
+
+	// The following functions report the state of the checked subsystems.
+	// They query the server by default, but are exposed here to allow the
+	// tests to replace them.
+	dbOpen     func() error
+	bestTime   func() (time.Time, error)
+	peerCount  func() int
+	rpcServing func() error
+
+	listeners  []net.Listener
+	httpServer *http.Server
+	wg         sync.WaitGroup
+}
+
+// newHealthServer returns a health server which checks the state of the passed
+// server and serves the health endpoints on the passed listeners.  A maximum
+// tip age or minimum peer count of zero disables the respective check.
+func newHealthServer(s *server, listeners []net.Listener,
+	maxTipAge time.Duration, minPeers int) *healthServer {
+
+	h := &healthServer{
+		maxTipAge: maxTipAge,
+		minPeers:  minPeers,
+		listeners: listeners,
+		dbOpen: func() error {
+			return s.db.View(func(dbTx database.Tx) error {
+				return nil
+			})
+		},
+		bestTime: func() (time.Time, error) {
+			best := s.chain.BestSnapshot()
+			header, err := s.chain.HeaderByHash(&best.Hash)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return header.Timestamp, nil
+		},
+		peerCount: func() int {
+			return int(s.ConnectedCount())
+		},
+		rpcServing: func() error {
+			if s.rpcServer == nil {
+				return nil
+			}
+			if s.standby.IsStandby() {
+				return errors.New("not serving in standby mode")
+			}
+			if atomic.LoadInt32(&s.rpcServer.started) == 0 {
+				return errors.New("not started")
+			}
+			if atomic.LoadInt32(&s.rpcServer.shutdown) != 0 {
+				return errors.New("shutting down")
+			}
+			return nil
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		h.serveReport(w, h.checkDB())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		h.serveReport(w, h.checkDB(), h.checkChain(), h.checkPeers(),
+			h.checkRPC())
+	})
+	h.httpServer = &http.Server{Handler: mux}
+
+	return h
+}
+
+// checkDB checks whether the database is open.
+func (h *healthServer) checkDB() healthCheck {
+	check := healthCheck{Name: "database", OK: true}
+	if err := h.dbOpen(); err != nil {
+		check.OK = false
+		check.Detail = err.Error()
+	}
+	return check
+}
+
+// checkChain checks whether the best block is recent enough for the chain to
+// be considered current.
+func (h *healthServer) checkChain() healthCheck {
+	check := healthCheck{Name: "chain", OK: true}
+	if h.maxTipAge == 0 {
+		return check
+	}
+
+	bestTime, err := h.bestTime()
+	if err != nil {
+		check.OK = false
+		check.Detail = err.Error()
+		return check
+	}
+	age := time.Since(bestTime)
+	if age > h.maxTipAge {
+		check.OK = false
+		check.Detail = fmt.Sprintf("best block is %v old, which is more "+
+			"than %v", age.Truncate(time.Second), h.maxTipAge)
+	}
+	return check
+}
+
+// checkPeers checks whether enough peers are connected.
+func (h *healthServer) checkPeers() healthCheck {
+	check := healthCheck{Name: "peers", OK: true}
+	if peers := h.peerCount(); peers < h.minPeers {
+		check.OK = false
+		check.Detail = fmt.Sprintf("%d peers connected, need at least %d",
+			peers, h.minPeers)
+	}
+	return check
+}
+
+// checkRPC checks whether the RPC server is serving requests.  The check passes
+// when the RPC server is disabled.
+func (h *healthServer) checkRPC() healthCheck {
+	check := healthCheck{Name: "rpc", OK: true}
+	if err := h.rpcServing(); err != nil {
+		check.OK = false
+		check.Detail = err.Error()
+	}
+	return check
+}
+
+// serveReport writes a report of the passed checks.  The status code is 200
+// when all of the checks passed and 503 otherwise.
+func (h *healthServer) serveReport(w http.ResponseWriter, checks ...healthCheck) {
+	report := healthReport{Status: "ok", Checks: checks}
+	status := http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			report.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&report); err != nil {
+		srvrLog.Debugf("Failed to write health report: %v", err)
+	}
+}
+
+// Start begins serving the health endpoints on the listeners.
+func (h *healthServer) Start() {
+	for _, listener := range h.listeners {
+		h.wg.Add(1)
+		go func(listener net.Listener) {
+			srvrLog.Infof("Health server listening on %s",
+				listener.Addr())
+			h.httpServer.Serve(listener)
+			h.wg.Done()
+		}(listener)
+	}
+}
+
+// Stop stops serving the health endpoints and waits for the listeners to be
+// closed.
+func (h *healthServer) Stop() {
+	h.httpServer.Close()
+	h.wg.Wait()
+}
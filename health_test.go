@@ -0,0 +1,108 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestHealthServer ensures the health endpoints report the state of the
+// checked subsystems along with the matching status code.
+func TestHealthServer(t *testing.T) {
+	var (
+		dbErr     error
+		bestTime  = time.Now()
+		peerCount = 8
+		rpcErr    error
+	)
+	h := &healthServer{
+		maxTipAge:  time.Hour,
+		minPeers:   1,
+		dbOpen:     func() error { return dbErr },
+		bestTime:   func() (time.Time, error) { return bestTime, nil },
+		peerCount:  func() int { return peerCount },
+		rpcServing: func() error { return rpcErr },
+	}
+	readyz := func() (int, *healthReport) {
+		rec := httptest.NewRecorder()
+		h.serveReport(rec, h.checkDB(), h.checkChain(), h.checkPeers(),
+			h.checkRPC())
+		var report healthReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		return rec.Code, &report
+	}
+
+	tests := []struct {
+		name      string
+		setup     func()
+		wantCode  int
+		wantCheck string
+	}{{
+		name:     "ready",
+		setup:    func() {},
+		wantCode: http.StatusOK,
+	}, {
+		name:      "syncing",
+		setup:     func() { bestTime = time.Now().Add(-2 * time.Hour) },
+		wantCode:  http.StatusServiceUnavailable,
+		wantCheck: "chain",
+	}, {
+		name:     "tip age check disabled",
+		setup:    func() { h.maxTipAge = 0 },
+		wantCode: http.StatusOK,
+	}, {
+		name:      "no peers",
+		setup:     func() { peerCount = 0 },
+		wantCode:  http.StatusServiceUnavailable,
+		wantCheck: "peers",
+	}, {
+		name: "rpc not serving",
+		setup: func() {
+			peerCount = 1
+			rpcErr = errors.New("not started")
+		},
+		wantCode:  http.StatusServiceUnavailable,
+		wantCheck: "rpc",
+	}, {
+		name: "database closed",
+		setup: func() {
+			rpcErr = nil
+			dbErr = errors.New("database is not open")
+		},
+		wantCode:  http.StatusServiceUnavailable,
+		wantCheck: "database",
+	}}
+
+	for _, test := range tests {
+		test.setup()
+		code, report := readyz()
+		if code != test.wantCode {
+			t.Errorf("%s: got status code %d, want %d", test.name,
+				code, test.wantCode)
+			continue
+		}
+		wantStatus := "ok"
+		if test.wantCheck != "" {
+			wantStatus = "unavailable"
+		}
+		if report.Status != wantStatus {
+			t.Errorf("%s: got status %q, want %q", test.name,
+				report.Status, wantStatus)
+		}
+		for _, check := range report.Checks {
+			if check.OK != (check.Name != test.wantCheck) {
+				t.Errorf("%s: unexpected check result %+v",
+					test.name, check)
+			}
+		}
+	}
+}
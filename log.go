@@ -18,9 +18,13 @@ import (
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/mining/cpuminer"
+	"github.com/btcsuite/btcd/mining/stratum"
+	"github.com/btcsuite/btcd/mining/sv2"
 	"github.com/btcsuite/btcd/netsync"
 	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/plugins"
 	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/zmq"
 
 	"github.com/btcsuite/btclog"
 	"github.com/jrick/logrotate/rotator"
@@ -54,21 +58,24 @@ var (
 	// application shutdown.
 	logRotator *rotator.Rotator
 
-	adxrLog = backendLog.Logger("ADXR")
-	amgrLog = backendLog.Logger("AMGR")
-	cmgrLog = backendLog.Logger("CMGR")
-	bcdbLog = backendLog.Logger("BCDB")
-	btcdLog = backendLog.Logger("BTCD")
-	chanLog = backendLog.Logger("CHAN")
-	discLog = backendLog.Logger("DISC")
-	indxLog = backendLog.Logger("INDX")
-	minrLog = backendLog.Logger("MINR")
-	peerLog = backendLog.Logger("PEER")
-	rpcsLog = backendLog.Logger("RPCS")
-	scrpLog = backendLog.Logger("SCRP")
-	srvrLog = backendLog.Logger("SRVR")
-	syncLog = backendLog.Logger("SYNC")
-	txmpLog = backendLog.Logger("TXMP")
+	// The subsystem loggers elevate the trace and debug messages which
+	// mention one of the targets of the selective trace logging.
+	adxrLog = newTraceLogger(backendLog.Logger("ADXR"), logTraceTargets)
+	amgrLog = newTraceLogger(backendLog.Logger("AMGR"), logTraceTargets)
+	cmgrLog = newTraceLogger(backendLog.Logger("CMGR"), logTraceTargets)
+	bcdbLog = newTraceLogger(backendLog.Logger("BCDB"), logTraceTargets)
+	btcdLog = newTraceLogger(backendLog.Logger("BTCD"), logTraceTargets)
+	chanLog = newTraceLogger(backendLog.Logger("CHAN"), logTraceTargets)
+	discLog = newTraceLogger(backendLog.Logger("DISC"), logTraceTargets)
+	indxLog = newTraceLogger(backendLog.Logger("INDX"), logTraceTargets)
+	minrLog = newTraceLogger(backendLog.Logger("MINR"), logTraceTargets)
+	peerLog = newTraceLogger(backendLog.Logger("PEER"), logTraceTargets)
+	plugLog = newTraceLogger(backendLog.Logger("PLUG"), logTraceTargets)
+	rpcsLog = newTraceLogger(backendLog.Logger("RPCS"), logTraceTargets)
+	scrpLog = newTraceLogger(backendLog.Logger("SCRP"), logTraceTargets)
+	srvrLog = newTraceLogger(backendLog.Logger("SRVR"), logTraceTargets)
+	syncLog = newTraceLogger(backendLog.Logger("SYNC"), logTraceTargets)
+	txmpLog = newTraceLogger(backendLog.Logger("TXMP"), logTraceTargets)
 )
 
 // Initialize package-global logger variables.
@@ -80,10 +87,14 @@ func init() {
 	indexers.UseLogger(indxLog)
 	mining.UseLogger(minrLog)
 	cpuminer.UseLogger(minrLog)
+	stratum.UseLogger(minrLog)
+	sv2.UseLogger(minrLog)
 	peer.UseLogger(peerLog)
+	plugins.UseLogger(plugLog)
 	txscript.UseLogger(scrpLog)
 	netsync.UseLogger(syncLog)
 	mempool.UseLogger(txmpLog)
+	zmq.UseLogger(rpcsLog)
 }
 
 // subsystemLoggers maps each subsystem identifier to its associated logger.
@@ -98,6 +109,7 @@ var subsystemLoggers = map[string]btclog.Logger{
 	"INDX": indxLog,
 	"MINR": minrLog,
 	"PEER": peerLog,
+	"PLUG": plugLog,
 	"RPCS": rpcsLog,
 	"SCRP": scrpLog,
 	"SRVR": srvrLog,
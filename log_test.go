@@ -0,0 +1,17 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain disables the loggers of all subsystems before running the tests
+// since the log rotator the loggers write to is only initialized on startup.
+func TestMain(m *testing.M) {
+	setLogLevels("off")
+	os.Exit(m.Run())
+}
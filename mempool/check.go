@@ -0,0 +1,104 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TxCheckResult describes whether a transaction would be accepted to the pool
+// as determined by CheckTransaction.
+type TxCheckResult struct {
+	// Allowed reports whether the transaction would be accepted to the
+	// pool.
+	Allowed bool
+
+	// RejectCode and RejectReason describe why the transaction would be
+	// rejected when it is not allowed.  They match the rejection of the
+	// transaction when it is processed without allowing orphans.
+	RejectCode   wire.RejectCode
+	RejectReason string
+
+	// MissingParents are the parents of the transaction which are neither
+	// in the main chain nor in the pool when it is an orphan.
+	MissingParents []*chainhash.Hash
+
+	// VSize is the virtual size of the transaction.
+	VSize int64
+
+	// Fee and SigOpCost are the fee the transaction pays in satoshi and the
+	// cost of its signature operations.  They are only set when the
+	// transaction is allowed.
+	Fee       int64
+	SigOpCost int
+
+	// Replaced are the hashes of the transactions in the pool, along with
+	// their descendants, which the transaction would replace, ordered by
+	// hash.
+	Replaced []*chainhash.Hash
+}
+
+// CheckTransaction runs the passed transaction through the same checks as
+// transactions which are submitted to the pool, but without adding it or
+// changing the transactions in the pool in any other way.  This allows clients
+// such as wallets to find out whether a transaction would be accepted before
+// broadcasting it.
+//
+// Transactions which are rejected are reported through the result, so an error
+// is only returned when the checks could not be performed.  Since the pool
+// might evict transactions to stay within its size limit once one is added, an
+// allowed transaction which pays a fee rate close to the minimum fee rate of
+// the pool might still be evicted right away when it is submitted.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) CheckTransaction(tx *btcutil.Tx) (*TxCheckResult, error) {
+	result := &TxCheckResult{
+		VSize: GetTxVirtualSize(tx),
+	}
+
+	// The lock is held for writes since determining the minimum fee rate
+	// of the pool updates its decay.
+	mp.mtx.Lock()
+	v, err := mp.validateTransaction(tx, true, false, true, false)
+	mp.mtx.Unlock()
+	if err != nil {
+		if _, ok := err.(RuleError); !ok {
+			return nil, err
+		}
+		result.RejectCode, result.RejectReason = ErrToRejectErr(err)
+		return result, nil
+	}
+
+	if len(v.missingParents) > 0 {
+		result.MissingParents = v.missingParents
+		result.RejectCode = wire.RejectDuplicate
+		result.RejectReason = fmt.Sprintf("orphan transaction %v "+
+			"references outputs of unknown or fully-spent "+
+			"transaction %v", tx.Hash(), v.missingParents[0])
+		return result, nil
+	}
+
+	result.Allowed = true
+	result.Fee = v.fee
+	result.SigOpCost = v.sigOpCost
+	if len(v.conflicts) > 0 {
+		result.Replaced = make([]*chainhash.Hash, 0, len(v.conflicts))
+		for _, conflict := range v.conflicts {
+			result.Replaced = append(result.Replaced, conflict.Hash())
+		}
+		sort.Slice(result.Replaced, func(i, j int) bool {
+			return bytes.Compare(result.Replaced[i][:],
+				result.Replaced[j][:]) < 0
+		})
+	}
+
+	return result, nil
+}
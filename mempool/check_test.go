@@ -0,0 +1,110 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestCheckTransaction ensures checking transactions reports whether they would
+// be accepted to the pool, along with their fee and the transactions they
+// would replace, without changing the pool.
+func TestCheckTransaction(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	txPool := harness.txPool
+
+	independent := ctx.independentOutputs(outputs, 2)
+	parent := ctx.addSignedTx([]spendableOutput{
+		independent[0],
+	}, 1, 1000, true, false)
+	sub := txPool.SubscribeTxEvents(10, blockchain.PolicyDropNewest, false)
+	defer sub.Unsubscribe()
+
+	// A valid transaction is allowed along with its fee and size, but it is
+	// not added to the pool.
+	tx, err := harness.CreateSignedTx([]spendableOutput{
+		independent[1],
+	}, 1, 2000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	result, err := txPool.CheckTransaction(tx)
+	if err != nil {
+		t.Fatalf("CheckTransaction: unexpected error: %v", err)
+	}
+	if !result.Allowed || result.Fee != 2000 ||
+		result.VSize != GetTxVirtualSize(tx) || result.SigOpCost == 0 ||
+		len(result.Replaced) != 0 {
+
+		t.Fatalf("unexpected result for valid transaction %+v", result)
+	}
+	testPoolMembership(ctx, tx, false, false)
+
+	// A transaction spending an unknown transaction is an orphan.
+	child, err := harness.CreateSignedTx([]spendableOutput{
+		txOutToSpendableOut(tx, 0),
+	}, 1, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	result, err = txPool.CheckTransaction(child)
+	if err != nil {
+		t.Fatalf("CheckTransaction: unexpected error: %v", err)
+	}
+	if result.Allowed || len(result.MissingParents) != 1 ||
+		*result.MissingParents[0] != *tx.Hash() {
+
+		t.Fatalf("unexpected result for orphan %+v", result)
+	}
+	testPoolMembership(ctx, child, false, false)
+
+	// A transaction which is already in the pool is rejected.
+	result, err = txPool.CheckTransaction(parent)
+	if err != nil {
+		t.Fatalf("CheckTransaction: unexpected error: %v", err)
+	}
+	if result.Allowed || result.RejectCode != wire.RejectDuplicate ||
+		result.RejectReason == "" {
+
+		t.Fatalf("unexpected result for duplicate %+v", result)
+	}
+
+	// A replacement which pays a higher fee reports the transaction it
+	// would replace, which stays in the pool.
+	replacement, err := harness.CreateSignedTx([]spendableOutput{
+		independent[0],
+	}, 1, 10000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	result, err = txPool.CheckTransaction(replacement)
+	if err != nil {
+		t.Fatalf("CheckTransaction: unexpected error: %v", err)
+	}
+	if !result.Allowed || len(result.Replaced) != 1 ||
+		*result.Replaced[0] != *parent.Hash() {
+
+		t.Fatalf("unexpected result for replacement %+v", result)
+	}
+	testPoolMembership(ctx, parent, false, true)
+	testPoolMembership(ctx, replacement, false, false)
+
+	// None of the checks changed the transactions in the pool.
+	select {
+	case event := <-sub.C:
+		t.Fatalf("unexpected event %v", event.Type)
+	default:
+	}
+}
@@ -0,0 +1,541 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+)
+
+// maxOptimalLinearizationSize is the maximum number of transactions which are
+// left to linearize in a cluster for the best set of them to mine next to be
+// searched exhaustively.  Otherwise, the best ancestor set of the transactions
+// is picked, which is not always optimal.
+const maxOptimalLinearizationSize = 12
+
+// compareFeeRates compares the fee rate of a fee paid for a virtual size to the
+// fee rate of another one without losing precision.  It returns 1 when the
+// first fee rate is higher, -1 when it is lower, and 0 when they are equal.
+// The virtual sizes must be positive.
+func compareFeeRates(feeA, vsizeA, feeB, vsizeB int64) int {
+	// The fees are compared by sign first so the products below can be
+	// compared as unsigned values.
+	switch {
+	case feeA < 0 && feeB >= 0:
+		return -1
+	case feeA >= 0 && feeB < 0:
+		return 1
+	case feeA < 0 && feeB < 0:
+		return compareFeeRates(-feeB, vsizeB, -feeA, vsizeA)
+	}
+
+	hiA, loA := bits.Mul64(uint64(feeA), uint64(vsizeB))
+	hiB, loB := bits.Mul64(uint64(feeB), uint64(vsizeA))
+	switch {
+	case hiA > hiB || (hiA == hiB && loA > loB):
+		return 1
+	case hiA < hiB || (hiA == hiB && loA < loB):
+		return -1
+	}
+	return 0
+}
+
+// clusterChunk is a group of consecutive transactions in the linearization of
+// a cluster which are mined and evicted together at their combined fee rate.
+type clusterChunk struct {
+	txns  []*TxDesc
+	fee   int64
+	vsize int64
+}
+
+// txCluster is a set of transactions in the pool which are connected through
+// spends along with the order they are mined in.
+//
+// The linearization holds the transactions such that every transaction comes
+// after the transactions it spends and the fee rates of the chunks it is split
+// into decrease, so mining the chunks in order collects the most fees for the
+// block space they take up.  Evicting the chunks in reverse order likewise
+// frees up space at the lowest cost.
+type txCluster struct {
+	linearization []*TxDesc
+	chunks        []clusterChunk
+}
+
+// clusterLinearizer holds the transactions of a cluster while it is
+// linearized, indexed by their position in a topological order.
+type clusterLinearizer struct {
+	txns    []*TxDesc
+	fees    []int64
+	vsizes  []int64
+	parents [][]int
+
+	// remaining marks the transactions which have not been added to the
+	// linearization yet.
+	remaining []bool
+}
+
+// newClusterLinearizer returns a linearizer for the passed transactions, which
+// must form a cluster in the pool, ordered topologically with ties broken by
+// hash so the linearization is deterministic.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) newClusterLinearizer(members []*TxDesc) *clusterLinearizer {
+	sorted := make([]*TxDesc, len(members))
+	copy(sorted, members)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Tx.Hash()[:],
+			sorted[j].Tx.Hash()[:]) < 0
+	})
+
+	// Order the transactions topologically by repeatedly taking those
+	// whose parents in the cluster were all taken already.
+	inCluster := make(map[chainhash.Hash]struct{}, len(sorted))
+	for _, txD := range sorted {
+		inCluster[*txD.Tx.Hash()] = struct{}{}
+	}
+	index := make(map[chainhash.Hash]int, len(sorted))
+	l := &clusterLinearizer{
+		txns:      make([]*TxDesc, 0, len(sorted)),
+		fees:      make([]int64, 0, len(sorted)),
+		vsizes:    make([]int64, 0, len(sorted)),
+		parents:   make([][]int, 0, len(sorted)),
+		remaining: make([]bool, len(sorted)),
+	}
+	for len(l.txns) < len(sorted) {
+		for _, txD := range sorted {
+			if _, ok := index[*txD.Tx.Hash()]; ok {
+				continue
+			}
+
+			var parents []int
+			ready := true
+			for _, txIn := range txD.Tx.MsgTx().TxIn {
+				parentHash := txIn.PreviousOutPoint.Hash
+				if _, ok := inCluster[parentHash]; !ok {
+					continue
+				}
+				i, ok := index[parentHash]
+				if !ok {
+					ready = false
+					break
+				}
+				parents = append(parents, i)
+			}
+			if !ready {
+				continue
+			}
+
+			index[*txD.Tx.Hash()] = len(l.txns)
+			l.remaining[len(l.txns)] = true
+			l.txns = append(l.txns, txD)
+			l.fees = append(l.fees, txD.ModifiedFee())
+			l.vsizes = append(l.vsizes, GetTxVirtualSize(txD.Tx))
+			l.parents = append(l.parents, parents)
+		}
+	}
+
+	return l
+}
+
+// bestCandidate returns the set of remaining transactions with the highest fee
+// rate which includes all of the remaining parents of its transactions, so it
+// can be mined next.  The set is searched exhaustively when only a few
+// transactions remain, and the ancestor sets of the remaining transactions are
+// considered otherwise.
+func (l *clusterLinearizer) bestCandidate() []bool {
+	var order []int
+	for i, remaining := range l.remaining {
+		if remaining {
+			order = append(order, i)
+		}
+	}
+
+	best := make([]bool, len(l.txns))
+	var bestFee, bestVSize int64
+	consider := func(set []bool, fee, vsize int64) {
+		if vsize == 0 {
+			return
+		}
+		if bestVSize != 0 &&
+			compareFeeRates(fee, vsize, bestFee, bestVSize) <= 0 {
+
+			return
+		}
+		copy(best, set)
+		bestFee, bestVSize = fee, vsize
+	}
+
+	if len(order) <= maxOptimalLinearizationSize {
+		// Walk the transactions in topological order and branch on
+		// whether to include each one, which is only possible when all
+		// of its remaining parents are included.
+		included := make([]bool, len(l.txns))
+		var search func(k int, fee, vsize int64)
+		search = func(k int, fee, vsize int64) {
+			if k == len(order) {
+				consider(included, fee, vsize)
+				return
+			}
+			search(k+1, fee, vsize)
+
+			i := order[k]
+			for _, parent := range l.parents[i] {
+				if l.remaining[parent] && !included[parent] {
+					return
+				}
+			}
+			included[i] = true
+			search(k+1, fee+l.fees[i], vsize+l.vsizes[i])
+			included[i] = false
+		}
+		search(0, 0, 0)
+		return best
+	}
+
+	// The ancestors of a transaction come before it in topological order,
+	// so they are marked by walking back from it.
+	ancestors := make([]bool, len(l.txns))
+	for _, i := range order {
+		for j := range ancestors {
+			ancestors[j] = false
+		}
+		ancestors[i] = true
+		fee, vsize := l.fees[i], l.vsizes[i]
+		for j := i; j >= 0; j-- {
+			if !ancestors[j] {
+				continue
+			}
+			for _, parent := range l.parents[j] {
+				if l.remaining[parent] && !ancestors[parent] {
+					ancestors[parent] = true
+					fee += l.fees[parent]
+					vsize += l.vsizes[parent]
+				}
+			}
+		}
+		consider(ancestors, fee, vsize)
+	}
+	return best
+}
+
+// linearize returns the cluster formed by the transactions of the linearizer
+// with their linearization and chunks.
+func (l *clusterLinearizer) linearize() *txCluster {
+	c := &txCluster{
+		linearization: make([]*TxDesc, 0, len(l.txns)),
+	}
+	for len(c.linearization) < len(l.txns) {
+		candidate := l.bestCandidate()
+		for i, include := range candidate {
+			if include {
+				c.linearization = append(c.linearization, l.txns[i])
+				l.remaining[i] = false
+			}
+		}
+	}
+
+	// Every transaction starts a chunk of its own, which is merged with
+	// the chunks before it as long as it pays a higher fee rate than them,
+	// so the fee rates of the chunks decrease.
+	for _, txD := range c.linearization {
+		c.chunks = append(c.chunks, clusterChunk{
+			txns:  []*TxDesc{txD},
+			fee:   txD.ModifiedFee(),
+			vsize: GetTxVirtualSize(txD.Tx),
+		})
+		for len(c.chunks) >= 2 {
+			last := &c.chunks[len(c.chunks)-1]
+			prev := &c.chunks[len(c.chunks)-2]
+			if compareFeeRates(last.fee, last.vsize, prev.fee,
+				prev.vsize) <= 0 {
+
+				break
+			}
+			prev.txns = append(prev.txns, last.txns...)
+			prev.fee += last.fee
+			prev.vsize += last.vsize
+			c.chunks = c.chunks[:len(c.chunks)-1]
+		}
+	}
+
+	return c
+}
+
+// setCluster linearizes the cluster formed by the passed transactions and
+// updates the chunk statistics of the transactions accordingly.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) setCluster(members []*TxDesc) {
+	c := mp.newClusterLinearizer(members).linearize()
+	for _, chunk := range c.chunks {
+		for _, txD := range chunk.txns {
+			txD.ChunkFee = chunk.fee
+			txD.ChunkVSize = chunk.vsize
+			mp.clusters[*txD.Tx.Hash()] = c
+		}
+	}
+}
+
+// addToCluster merges the clusters of the parents of the passed transaction,
+// which was just added to the pool, into a cluster along with it.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addToCluster(txD *TxDesc) {
+	members := []*TxDesc{txD}
+	merged := make(map[*txCluster]struct{})
+	for _, txIn := range txD.Tx.MsgTx().TxIn {
+		c, ok := mp.clusters[txIn.PreviousOutPoint.Hash]
+		if !ok {
+			continue
+		}
+		if _, ok := merged[c]; ok {
+			continue
+		}
+		merged[c] = struct{}{}
+		members = append(members, c.linearization...)
+	}
+	mp.setCluster(members)
+}
+
+// removeFromCluster removes the passed transaction, which was just removed
+// from the pool, from its cluster.  The remaining transactions of the cluster
+// are split into the clusters they still form without it.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) removeFromCluster(txD *TxDesc) {
+	txHash := *txD.Tx.Hash()
+	c, ok := mp.clusters[txHash]
+	if !ok {
+		return
+	}
+	delete(mp.clusters, txHash)
+
+	// Group the remaining transactions by walking the spends between them
+	// in both directions.
+	remaining := make(map[chainhash.Hash]*TxDesc, len(c.linearization))
+	children := make(map[chainhash.Hash][]*TxDesc)
+	for _, member := range c.linearization {
+		if member != txD {
+			remaining[*member.Tx.Hash()] = member
+		}
+	}
+	for _, member := range remaining {
+		for _, txIn := range member.Tx.MsgTx().TxIn {
+			parentHash := txIn.PreviousOutPoint.Hash
+			if _, ok := remaining[parentHash]; ok {
+				children[parentHash] = append(
+					children[parentHash], member)
+			}
+		}
+	}
+	for _, member := range c.linearization {
+		if _, ok := remaining[*member.Tx.Hash()]; !ok {
+			continue
+		}
+
+		var component []*TxDesc
+		queue := []*TxDesc{member}
+		delete(remaining, *member.Tx.Hash())
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			component = append(component, next)
+
+			related := children[*next.Tx.Hash()]
+			for _, txIn := range next.Tx.MsgTx().TxIn {
+				parent, ok := remaining[txIn.PreviousOutPoint.Hash]
+				if ok {
+					related = append(related, parent)
+				}
+			}
+			for _, relative := range related {
+				if _, ok := remaining[*relative.Tx.Hash()]; !ok {
+					continue
+				}
+				delete(remaining, *relative.Tx.Hash())
+				queue = append(queue, relative)
+			}
+		}
+		mp.setCluster(component)
+	}
+}
+
+// clusterCount returns the number of transactions in the cluster the passed
+// transaction would join when it is added to the pool, which merges the
+// clusters of its parents.  The passed conflicts are replaced by the
+// transaction, so they are not counted.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) clusterCount(tx *btcutil.Tx,
+	conflicts map[chainhash.Hash]*btcutil.Tx) int {
+
+	count := 1
+	merged := make(map[*txCluster]struct{})
+	for _, txIn := range tx.MsgTx().TxIn {
+		c, ok := mp.clusters[txIn.PreviousOutPoint.Hash]
+		if !ok {
+			continue
+		}
+		if _, ok := merged[c]; ok {
+			continue
+		}
+		merged[c] = struct{}{}
+		for _, member := range c.linearization {
+			if _, ok := conflicts[*member.Tx.Hash()]; !ok {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// worstChunk returns the chunk with the lowest fee rate in the pool, which is
+// the last chunk of one of the clusters, or nil when the pool is empty.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) worstChunk() *clusterChunk {
+	var worst *clusterChunk
+	for hash, c := range mp.clusters {
+		// Each cluster is only considered once through its last
+		// transaction.
+		last := c.linearization[len(c.linearization)-1]
+		if *last.Tx.Hash() != hash {
+			continue
+		}
+
+		chunk := &c.chunks[len(c.chunks)-1]
+		if worst == nil || compareFeeRates(chunk.fee, chunk.vsize,
+			worst.fee, worst.vsize) < 0 {
+
+			worst = chunk
+		}
+	}
+	return worst
+}
+
+// FeeratePoint is a point of a feerate diagram, which plots the cumulative fee
+// against the cumulative virtual size of the chunks of transactions in the
+// order they are mined in.  The slope between two points is the fee rate of
+// the chunk in between.
+type FeeratePoint struct {
+	VSize int64
+	Fee   int64
+}
+
+// feerateDiagram returns the feerate diagram of the passed chunks, which must
+// be ordered by decreasing fee rate, starting with the origin.
+func feerateDiagram(chunks []*clusterChunk) []FeeratePoint {
+	diagram := make([]FeeratePoint, 1, len(chunks)+1)
+	for _, chunk := range chunks {
+		last := diagram[len(diagram)-1]
+		diagram = append(diagram, FeeratePoint{
+			VSize: last.VSize + chunk.vsize,
+			Fee:   last.Fee + chunk.fee,
+		})
+	}
+	return diagram
+}
+
+// FeerateDiagram returns the feerate diagram of all transactions in the pool,
+// which is formed by the chunks of all clusters ordered by decreasing fee rate.
+// It shows the fees a miner collects by including the transactions in the pool
+// up to any virtual size, ignoring the boundaries of blocks.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FeerateDiagram() []FeeratePoint {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	var chunks []*clusterChunk
+	for hash, c := range mp.clusters {
+		if *c.linearization[0].Tx.Hash() != hash {
+			continue
+		}
+		for i := range c.chunks {
+			chunks = append(chunks, &c.chunks[i])
+		}
+	}
+
+	// The chunks of each cluster are already ordered by decreasing fee
+	// rate, so a stable sort keeps them in order when they pay the same
+	// fee rate.
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return compareFeeRates(chunks[i].fee, chunks[i].vsize,
+			chunks[j].fee, chunks[j].vsize) > 0
+	})
+	return feerateDiagram(chunks)
+}
+
+// ClusterChunk is a group of consecutive transactions in the linearization of
+// a cluster which are mined and evicted together at their combined fee rate.
+type ClusterChunk struct {
+	Txns  []*chainhash.Hash
+	Fee   int64
+	VSize int64
+}
+
+// Cluster is a set of transactions in the pool which are connected through
+// spends along with the order they are mined in.
+type Cluster struct {
+	// Linearization holds copies of the descriptors of the transactions
+	// of the cluster in the order they are mined in, which is such that
+	// every transaction comes after the transactions it spends.
+	Linearization []*TxDesc
+
+	// Chunks are the groups the linearization is split into, which are
+	// ordered by decreasing fee rate.
+	Chunks []ClusterChunk
+
+	// Diagram is the feerate diagram of the chunks.
+	Diagram []FeeratePoint
+}
+
+// Cluster returns the cluster of the transaction with the passed hash.  An
+// error is returned when the transaction is not in the main pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Cluster(hash *chainhash.Hash) (*Cluster, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	c, ok := mp.clusters[*hash]
+	if !ok {
+		return nil, fmt.Errorf("transaction %v is not in the pool", hash)
+	}
+
+	cluster := &Cluster{
+		Linearization: make([]*TxDesc, 0, len(c.linearization)),
+		Chunks:        make([]ClusterChunk, 0, len(c.chunks)),
+	}
+	chunks := make([]*clusterChunk, 0, len(c.chunks))
+	for i := range c.chunks {
+		chunk := &c.chunks[i]
+		chunks = append(chunks, chunk)
+
+		result := ClusterChunk{
+			Txns:  make([]*chainhash.Hash, 0, len(chunk.txns)),
+			Fee:   chunk.fee,
+			VSize: chunk.vsize,
+		}
+		for _, txD := range chunk.txns {
+			// The statistics of the descriptor change as
+			// transactions are added to and removed from the pool,
+			// so it is copied.
+			desc := *txD
+			cluster.Linearization = append(cluster.Linearization,
+				&desc)
+			result.Txns = append(result.Txns, txD.Tx.Hash())
+		}
+		cluster.Chunks = append(cluster.Chunks, result)
+	}
+	cluster.Diagram = feerateDiagram(chunks)
+
+	return cluster, nil
+}
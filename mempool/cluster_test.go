@@ -0,0 +1,241 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestCompareFeeRates ensures fee rates are compared without losing precision,
+// including fees and sizes whose products overflow 64 bits.
+func TestCompareFeeRates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		feeA, vsizeA int64
+		feeB, vsizeB int64
+		want         int
+	}{
+		{1000, 100, 1000, 100, 0},
+		{1000, 100, 2000, 200, 0},
+		{1001, 100, 2000, 200, 1},
+		{999, 100, 2000, 200, -1},
+		{0, 100, 0, 200, 0},
+		{-1, 100, 0, 100, -1},
+		{0, 100, -1, 100, 1},
+		{-100, 100, -100, 200, -1},
+		{-100, 200, -100, 100, 1},
+		{-300, 200, -100, 100, -1},
+		{math.MaxInt64, math.MaxInt64 - 1, math.MaxInt64 - 1,
+			math.MaxInt64 - 1, 1},
+		{math.MaxInt64 - 1, math.MaxInt64, math.MaxInt64 - 1,
+			math.MaxInt64 - 1, -1},
+	}
+
+	for i, test := range tests {
+		got := compareFeeRates(test.feeA, test.vsizeA, test.feeB,
+			test.vsizeB)
+		if got != test.want {
+			t.Errorf("compareFeeRates #%d: got %d, want %d", i, got,
+				test.want)
+		}
+	}
+}
+
+// TestClusterChunks ensures transactions connected through spends are tracked
+// as clusters which are ordered and split into chunks by fee rate, that the
+// clusters are split when transactions are removed, and that the feerate
+// diagrams reflect the chunks.
+func TestClusterChunks(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	txPool := harness.txPool
+
+	independent := ctx.independentOutputs(outputs, 2)
+
+	// A child paying a high fee rate is mined in the same chunk as its
+	// parent paying a low fee rate, while a child paying a low fee rate is
+	// mined in a chunk of its own after them.
+	parent := ctx.addSignedTx([]spendableOutput{
+		independent[0],
+	}, 2, 300, false, false)
+	child := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(parent, 0),
+	}, 1, 5000, false, false)
+	lowChild := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(parent, 1),
+	}, 1, 250, false, false)
+	other := ctx.addSignedTx([]spendableOutput{
+		independent[1],
+	}, 1, 1000, false, false)
+
+	vsize := func(txns ...*btcutil.Tx) int64 {
+		var total int64
+		for _, tx := range txns {
+			total += GetTxVirtualSize(tx)
+		}
+		return total
+	}
+	checkChunks := func(tx *btcutil.Tx, want [][]*btcutil.Tx) {
+		t.Helper()
+
+		cluster, err := txPool.Cluster(tx.Hash())
+		if err != nil {
+			t.Fatalf("Cluster: unexpected error: %v", err)
+		}
+		if len(cluster.Chunks) != len(want) {
+			t.Fatalf("got %d chunks, want %d", len(cluster.Chunks),
+				len(want))
+		}
+		fees := make(map[chainhash.Hash]int64)
+		for _, txD := range cluster.Linearization {
+			fees[*txD.Tx.Hash()] = txD.Fee
+		}
+		var linearization []*chainhash.Hash
+		for i, chunk := range cluster.Chunks {
+			if len(chunk.Txns) != len(want[i]) {
+				t.Fatalf("chunk %d has %d transactions, want %d",
+					i, len(chunk.Txns), len(want[i]))
+			}
+			var fee int64
+			for j, hash := range chunk.Txns {
+				if *hash != *want[i][j].Hash() {
+					t.Fatalf("chunk %d has transaction %v at "+
+						"%d, want %v", i, hash, j,
+						want[i][j].Hash())
+				}
+				fee += fees[*hash]
+			}
+			if chunk.Fee != fee || chunk.VSize != vsize(want[i]...) {
+				t.Fatalf("chunk %d has fee %d and size %d, "+
+					"want %d and %d", i, chunk.Fee,
+					chunk.VSize, fee, vsize(want[i]...))
+			}
+			linearization = append(linearization, chunk.Txns...)
+		}
+		for i, txD := range cluster.Linearization {
+			if *txD.Tx.Hash() != *linearization[i] {
+				t.Fatalf("linearization has %v at %d, want %v",
+					txD.Tx.Hash(), i, linearization[i])
+			}
+			if txD.ChunkFee == 0 || txD.ChunkVSize == 0 {
+				t.Fatalf("chunk of %v not set", txD.Tx.Hash())
+			}
+		}
+		if len(cluster.Diagram) != len(want)+1 {
+			t.Fatalf("diagram has %d points, want %d",
+				len(cluster.Diagram), len(want)+1)
+		}
+	}
+	checkChunks(lowChild, [][]*btcutil.Tx{{parent, child}, {lowChild}})
+	checkChunks(other, [][]*btcutil.Tx{{other}})
+
+	// The descriptors carry the chunks of the transactions.
+	parentDesc := txPool.pool[*parent.Hash()]
+	if parentDesc.ChunkFee != 5300 ||
+		parentDesc.ChunkVSize != vsize(parent, child) {
+
+		t.Fatalf("descriptor has chunk fee %d and size %d, want %d "+
+			"and %d", parentDesc.ChunkFee, parentDesc.ChunkVSize,
+			5300, vsize(parent, child))
+	}
+
+	// The diagram of the pool holds the chunks of all clusters ordered by
+	// decreasing fee rate.
+	diagram := txPool.FeerateDiagram()
+	wantDiagram := []FeeratePoint{
+		{0, 0},
+		{vsize(parent, child), 5300},
+		{vsize(parent, child, other), 6300},
+		{vsize(parent, child, other, lowChild), 6550},
+	}
+	if len(diagram) != len(wantDiagram) {
+		t.Fatalf("got diagram %v, want %v", diagram, wantDiagram)
+	}
+	for i := range diagram {
+		if diagram[i] != wantDiagram[i] {
+			t.Fatalf("got diagram %v, want %v", diagram, wantDiagram)
+		}
+	}
+
+	// Removing the parent, as happens when it is mined, splits its
+	// children into clusters of their own.
+	txPool.RemoveTransaction(parent, false, RemovalReasonBlock)
+	if _, err := txPool.Cluster(parent.Hash()); err == nil {
+		t.Fatal("Cluster: no error for transaction not in the pool")
+	}
+	checkChunks(child, [][]*btcutil.Tx{{child}})
+	checkChunks(lowChild, [][]*btcutil.Tx{{lowChild}})
+
+	// Removing the remaining transactions leaves no clusters behind.
+	for _, tx := range []*btcutil.Tx{child, lowChild, other} {
+		txPool.RemoveTransaction(tx, true, RemovalReasonBlock)
+	}
+	if len(txPool.clusters) != 0 {
+		t.Fatalf("%d clusters left in empty pool", len(txPool.clusters))
+	}
+	if diagram := txPool.FeerateDiagram(); len(diagram) != 1 {
+		t.Fatalf("got diagram %v for empty pool", diagram)
+	}
+}
+
+// TestClusterLimit ensures transactions which would make their cluster exceed
+// the maximum number of transactions are rejected, and that transactions they
+// replace are not counted.
+func TestClusterLimit(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	txPool := harness.txPool
+	txPool.cfg.Policy.MaxClusterCount = 2
+
+	parent := ctx.addSignedTx(outputs, 2, 1000, false, false)
+	ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(parent, 0),
+	}, 1, 1000, true, false)
+
+	// A third transaction in the cluster is rejected.
+	tx, err := harness.CreateSignedTx([]spendableOutput{
+		txOutToSpendableOut(parent, 1),
+	}, 1, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = txPool.ProcessTransaction(tx, false, false, 0)
+	if err == nil || !strings.Contains(err.Error(), "cluster") {
+		t.Fatalf("expected transaction exceeding the cluster limit to "+
+			"be rejected, got %v", err)
+	}
+	testPoolMembership(ctx, tx, false, false)
+
+	// A replacement of the child keeps the cluster within the limit.
+	replacement, err := harness.CreateSignedTx([]spendableOutput{
+		txOutToSpendableOut(parent, 0),
+	}, 1, 5000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = txPool.ProcessTransaction(replacement, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept replacement %v",
+			err)
+	}
+	testPoolMembership(ctx, replacement, false, true)
+}
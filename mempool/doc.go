@@ -48,19 +48,51 @@ be an exhaustive list.
    - Automatic addition of orphan transactions that are no longer orphans as new
      transactions are added to the pool
    - Individual orphan transaction query support
+   - Reporting of the source of orphan transactions which turn out to be
+     invalid once their parents are known
+ - Atomic acceptance of packages of a child transaction along with its
+   unconfirmed parents, which allows the child to pay for its parents
+ - Checking whether transactions would be accepted without changing the pool
+ - Tracking of clusters of transactions connected through spends, which are
+   ordered and split into chunks so the chunks with the lowest fee rates are
+   evicted first
+ - Feerate diagrams of the pool and of its clusters for analysis
+ - Serialization of the pool so it can be restored and revalidated across
+   restarts
+ - Tracking of locally submitted transactions which no peer has requested yet
+   so they can be rebroadcast until one does
+ - Subscriptions to the transactions added to, removed from, and replaced in
+   the pool, including the reasons for their removal, which allow mirroring
+   the pool without polling
+ - Fee estimation based on the confirmation times of the transactions in the
+   pool at different fee rates over short, medium, and long horizons
  - Configurable transaction acceptance policy
    - Option to accept or reject standard transactions
    - Option to accept or reject transactions based on priority calculations
    - Rate limiting of low-fee and free transactions
    - Non-zero fee threshold
    - Max signature operations per transaction
-   - Max orphan transaction size
-   - Max number of orphan transactions allowed
+   - Standardness of transactions, which covers the dust threshold, the max
+     weight, the max size of null data outputs, and whether bare multisig
+     outputs are accepted
+   - Max orphan transaction weight
+   - Max number and total weight of orphan transactions with eviction of the
+     orphans of the source which provided the most weight
+   - Orphan transaction expiration time
+   - Max number and size of unconfirmed ancestors and descendants
+   - Max number of transactions in a cluster
+   - Max total size with eviction of the chunks with the lowest fee rates,
+     which raises the minimum fee rate while the pool is full
+   - Expiration time of transactions, after which they are evicted along with
+     their descendants
+ - Adjustment of the acceptance policy while the pool is running
  - Additional metadata tracking for each transaction
    - Timestamp when the transaction was added to the pool
    - Most recent block height when the transaction was added to the pool
    - The fee the transaction pays
    - The starting priority for the transaction
+   - The number, size, and fees of its unconfirmed ancestors and descendants
+   - The fee and size of the chunk of its cluster
  - Manual control of transaction removal
    - Recursive removal of all dependent transactions
 
@@ -11,39 +11,81 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"math/rand"
 	"sort"
-	"strings"
 	"sync"
 
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
-	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcutil"
 )
 
-// TODO incorporate Alex Morcos' modifications to Gavin's initial model
-// https://lists.linuxfoundation.org/pipermail/bitcoin-dev/2014-October/006824.html
+// The fee estimator follows the model of Bitcoin Core.  Transactions are
+// sorted into exponentially spaced fee rate buckets when they enter the
+// mempool.  For every bucket, it keeps exponentially decaying moving averages
+// of the number of transactions which were mined within a number of blocks, the
+// number of transactions which left the mempool without being mined and the
+// number of transactions which are still waiting to be mined.  Estimates are
+// made by finding the lowest fee rate for which enough transactions were mined
+// within the target number of blocks.
+//
+// The averages are tracked over three horizons which decay at different rates,
+// so estimates for short targets follow the recent fee market closely while
+// estimates for long targets are based on weeks of data.
 
 const (
-	// estimateFeeDepth is the maximum number of blocks before a transaction
-	// is confirmed that we want to track.
-	estimateFeeDepth = 25
-
-	// estimateFeeBinSize is the number of txs stored in each bin.
-	estimateFeeBinSize = 100
-
-	// estimateFeeMaxReplacements is the max number of replacements that
-	// can be made by the txs found in a given block.
-	estimateFeeMaxReplacements = 10
-
-	// DefaultEstimateFeeMaxRollback is the default number of rollbacks
-	// allowed by the fee estimator for orphaned blocks.
-	DefaultEstimateFeeMaxRollback = 2
-
-	// DefaultEstimateFeeMinRegisteredBlocks is the default minimum
-	// number of blocks which must be observed by the fee estimator before
-	// it will provide fee estimations.
-	DefaultEstimateFeeMinRegisteredBlocks = 3
+	// minBucketFeeRate is the upper bound of the lowest fee rate bucket in
+	// satoshi per kilobyte.
+	minBucketFeeRate = 1000
+
+	// maxBucketFeeRate is the upper bound of the highest fee rate bucket
+	// in satoshi per kilobyte, except for the bucket which holds all
+	// higher fee rates.
+	maxBucketFeeRate = 1e7
+
+	// feeBucketSpacing is the ratio of the upper bounds of consecutive fee
+	// rate buckets.
+	feeBucketSpacing = 1.05
+
+	// The number of periods, the number of blocks per period and the decay
+	// per block of the short, medium and long horizons.  The decays result
+	// in half-lives of roughly 18 blocks, 144 blocks and 1008 blocks.
+	shortBlockPeriods = 12
+	shortScale        = 1
+	shortDecay        = .962
+	medBlockPeriods   = 24
+	medScale          = 2
+	medDecay          = .9952
+	longBlockPeriods  = 42
+	longScale         = 24
+	longDecay         = .99931
+
+	// halfSuccessPct, successPct and doubleSuccessPct are the ratios of
+	// transactions which must have been mined within half the target,
+	// within the target and within double the target for a fee rate to be
+	// estimated.
+	halfSuccessPct   = .6
+	successPct       = .85
+	doubleSuccessPct = .95
+
+	// sufficientFeeTxs and sufficientTxsShort are the average number of
+	// transactions per block which must fall into a range of buckets for
+	// it to be considered in the medium and long horizons and in the short
+	// horizon respectively.
+	sufficientFeeTxs   = .1
+	sufficientTxsShort = .5
+
+	// oldestEstimateHistory is the number of blocks after which the block
+	// span of restored data is no longer taken into account to decide the
+	// maximum target which can be estimated.
+	oldestEstimateHistory = 6 * 1008
+
+	// MaxEstimateTarget is the highest number of blocks a fee can be
+	// estimated for by EstimateSmartFee.
+	MaxEstimateTarget = longBlockPeriods * longScale
+
+	// EstimateFeeMaxLag is the maximum number of blocks a restored fee
+	// estimator may be behind the main chain before its data is considered
+	// too old to be used.
+	EstimateFeeMaxLag = 360
 
 	bytePerKb = 1000
 
@@ -90,240 +132,470 @@ func NewSatoshiPerByte(fee btcutil.Amount, size uint32) SatoshiPerByte {
 	return SatoshiPerByte(float64(fee) / float64(size))
 }
 
-// observedTransaction represents an observed transaction and some
-// additional data required for the fee estimation algorithm.
-type observedTransaction struct {
-	// A transaction hash.
-	hash chainhash.Hash
+// txConfirmStats tracks the transactions in every fee rate bucket over a single
+// horizon.  The horizon is divided into periods of scale blocks and the moving
+// averages of the transactions which were mined or left the mempool are kept
+// per period.
+type txConfirmStats struct {
+	// buckets are the upper bounds of the fee rate buckets in satoshi per
+	// kilobyte.  They are shared by all horizons.
+	buckets []float64
+
+	decay float64
+	scale int
+
+	// txCtAvg is the moving average of the number of transactions mined in
+	// every bucket and feeRateAvg the moving average of the sum of their
+	// fee rates.
+	txCtAvg    []float64
+	feeRateAvg []float64
+
+	// confAvg is the moving average of the number of transactions in every
+	// bucket which were mined within the number of periods of its index
+	// plus one.
+	confAvg [][]float64
+
+	// failAvg is the moving average of the number of transactions in every
+	// bucket which left the mempool without being mined after the number of
+	// periods of its index plus one.
+	failAvg [][]float64
+
+	// unconfTxs is the number of transactions in every bucket which are
+	// still in the mempool, indexed by the height they entered it modulo
+	// the number of blocks of the horizon.  oldUnconfTxs is the number of
+	// transactions which have been in the mempool for longer than that.
+	unconfTxs    [][]int
+	oldUnconfTxs []int
+}
 
-	// The fee per byte of the transaction in satoshis.
-	feeRate SatoshiPerByte
+// newTxConfirmStats returns statistics for a horizon of the passed number of
+// periods of scale blocks which decay by the passed factor every block.
+func newTxConfirmStats(buckets []float64, periods, scale int, decay float64) *txConfirmStats {
+	stats := &txConfirmStats{
+		buckets:      buckets,
+		decay:        decay,
+		scale:        scale,
+		txCtAvg:      make([]float64, len(buckets)),
+		feeRateAvg:   make([]float64, len(buckets)),
+		confAvg:      make([][]float64, periods),
+		failAvg:      make([][]float64, periods),
+		unconfTxs:    make([][]int, periods*scale),
+		oldUnconfTxs: make([]int, len(buckets)),
+	}
+	for i := 0; i < periods; i++ {
+		stats.confAvg[i] = make([]float64, len(buckets))
+		stats.failAvg[i] = make([]float64, len(buckets))
+	}
+	for i := range stats.unconfTxs {
+		stats.unconfTxs[i] = make([]int, len(buckets))
+	}
+	return stats
+}
 
-	// The block height when it was observed.
-	observed int32
+// maxConfirms returns the highest number of blocks tracked by the horizon.
+func (s *txConfirmStats) maxConfirms() int {
+	return s.scale * len(s.confAvg)
+}
 
-	// The height of the block in which it was mined.
-	// If the transaction has not yet been mined, it is zero.
-	mined int32
+// unconfIndex returns the index into unconfTxs for the passed height.
+func (s *txConfirmStats) unconfIndex(height int32) int {
+	bins := int32(len(s.unconfTxs))
+	return int((height%bins + bins) % bins)
 }
 
-func (o *observedTransaction) Serialize(w io.Writer) {
-	binary.Write(w, binary.BigEndian, o.hash)
-	binary.Write(w, binary.BigEndian, o.feeRate)
-	binary.Write(w, binary.BigEndian, o.observed)
-	binary.Write(w, binary.BigEndian, o.mined)
+// clearCurrent moves the transactions which entered the mempool as many blocks
+// before the passed height as the horizon tracks to the old unconfirmed
+// transactions, so their slot can be reused for the passed height.
+func (s *txConfirmStats) clearCurrent(height int32) {
+	current := s.unconfTxs[s.unconfIndex(height)]
+	for i := range current {
+		s.oldUnconfTxs[i] += current[i]
+		current[i] = 0
+	}
 }
 
-func deserializeObservedTransaction(r io.Reader) (*observedTransaction, error) {
-	ot := observedTransaction{}
+// record adds a transaction in the passed bucket with the passed fee rate which
+// was mined after the passed number of blocks.
+func (s *txConfirmStats) record(blocksToConfirm int, bucket int, feeRate float64) {
+	if blocksToConfirm < 1 {
+		return
+	}
+	periodsToConfirm := (blocksToConfirm + s.scale - 1) / s.scale
+	for i := periodsToConfirm; i <= len(s.confAvg); i++ {
+		s.confAvg[i-1][bucket]++
+	}
+	s.txCtAvg[bucket]++
+	s.feeRateAvg[bucket] += feeRate
+}
 
-	// The first 32 bytes should be a hash.
-	binary.Read(r, binary.BigEndian, &ot.hash)
+// updateMovingAverages decays all moving averages by one block.
+func (s *txConfirmStats) updateMovingAverages() {
+	for i := range s.buckets {
+		for j := range s.confAvg {
+			s.confAvg[j][i] *= s.decay
+			s.failAvg[j][i] *= s.decay
+		}
+		s.txCtAvg[i] *= s.decay
+		s.feeRateAvg[i] *= s.decay
+	}
+}
 
-	// The next 8 are SatoshiPerByte
-	binary.Read(r, binary.BigEndian, &ot.feeRate)
+// newTx adds a transaction in the passed bucket which entered the mempool at
+// the passed height to the unconfirmed transactions.
+func (s *txConfirmStats) newTx(height int32, bucket int) {
+	s.unconfTxs[s.unconfIndex(height)][bucket]++
+}
 
-	// And next there are two uint32's.
-	binary.Read(r, binary.BigEndian, &ot.observed)
-	binary.Read(r, binary.BigEndian, &ot.mined)
+// removeTx removes a transaction in the passed bucket which entered the mempool
+// at the passed height from the unconfirmed transactions.  When it wasn't
+// mined, it is counted as a failure for every period it has spent in the
+// mempool.
+func (s *txConfirmStats) removeTx(entryHeight, bestHeight int32, bucket int, inBlock bool) {
+	blocksAgo := int(bestHeight - entryHeight)
+	if bestHeight == 0 {
+		blocksAgo = 0
+	}
+	if blocksAgo < 0 {
+		return
+	}
+
+	if blocksAgo >= len(s.unconfTxs) {
+		if s.oldUnconfTxs[bucket] > 0 {
+			s.oldUnconfTxs[bucket]--
+		}
+	} else {
+		unconf := s.unconfTxs[s.unconfIndex(entryHeight)]
+		if unconf[bucket] > 0 {
+			unconf[bucket]--
+		}
+	}
 
-	return &ot, nil
+	// Only count the transaction as a failure for the periods it has
+	// fully spent in the mempool.
+	if !inBlock && blocksAgo >= s.scale {
+		periodsAgo := blocksAgo / s.scale
+		for i := 0; i < periodsAgo && i < len(s.failAvg); i++ {
+			s.failAvg[i][bucket]++
+		}
+	}
 }
 
-// registeredBlock has the hash of a block and the list of transactions
-// it mined which had been previously observed by the FeeEstimator. It
-// is used if Rollback is called to reverse the effect of registering
-// a block.
-type registeredBlock struct {
-	hash         chainhash.Hash
-	transactions []*observedTransaction
+// estimateMedianVal returns the fee rate in satoshi per kilobyte for which the
+// passed ratio of transactions were mined within the passed number of blocks,
+// or -1 when there is no such fee rate.
+//
+// Starting from the highest fee rate, buckets are combined into ranges until
+// every range has enough transactions to be judged on its own.  The answer is
+// the median fee rate of the lowest range which still meets the success ratio,
+// taking transactions which left the mempool without being mined and
+// transactions which are still waiting into account as failures.
+func (s *txConfirmStats) estimateMedianVal(confTarget int, sufficientTxVal,
+	successBreakPoint float64, height int32) float64 {
+
+	var nConf, totalNum, failNum float64
+	var extraNum int
+	periodTarget := (confTarget + s.scale - 1) / s.scale
+	maxBucket := len(s.buckets) - 1
+
+	curNearBucket, bestNearBucket := maxBucket, maxBucket
+	curFarBucket, bestFarBucket := maxBucket, maxBucket
+	foundAnswer := false
+	newBucketRange := true
+
+	for bucket := maxBucket; bucket >= 0; bucket-- {
+		if newBucketRange {
+			curNearBucket = bucket
+			newBucketRange = false
+		}
+		curFarBucket = bucket
+		nConf += s.confAvg[periodTarget-1][bucket]
+		totalNum += s.txCtAvg[bucket]
+		failNum += s.failAvg[periodTarget-1][bucket]
+		for confct := confTarget; confct < s.maxConfirms(); confct++ {
+			index := s.unconfIndex(height - int32(confct))
+			extraNum += s.unconfTxs[index][bucket]
+		}
+		extraNum += s.oldUnconfTxs[bucket]
+
+		// Only judge the range once it has enough mined transactions,
+		// so every target looks at the same amount of data.
+		if totalNum < sufficientTxVal/(1-s.decay) {
+			continue
+		}
+		curPct := nConf / (totalNum + failNum + float64(extraNum))
+		if curPct < successBreakPoint {
+			continue
+		}
+
+		foundAnswer = true
+		nConf, totalNum, failNum, extraNum = 0, 0, 0, 0
+		bestNearBucket = curNearBucket
+		bestFarBucket = curFarBucket
+		newBucketRange = true
+	}
+	if !foundAnswer {
+		return -1
+	}
+
+	// Report the average fee rate of the bucket containing the median
+	// transaction of the best range, since the fee rates of the individual
+	// transactions are not kept.
+	var txSum float64
+	for i := bestFarBucket; i <= bestNearBucket; i++ {
+		txSum += s.txCtAvg[i]
+	}
+	if txSum == 0 {
+		return -1
+	}
+	txSum /= 2
+	for i := bestFarBucket; i <= bestNearBucket; i++ {
+		if s.txCtAvg[i] < txSum {
+			txSum -= s.txCtAvg[i]
+			continue
+		}
+		return s.feeRateAvg[i] / s.txCtAvg[i]
+	}
+	return -1
 }
 
-func (rb *registeredBlock) serialize(w io.Writer, txs map[*observedTransaction]uint32) {
-	binary.Write(w, binary.BigEndian, rb.hash)
+// serialize writes the moving averages of the horizon to w.  The unconfirmed
+// transactions are not written since the mempool is tracked from scratch.
+func (s *txConfirmStats) serialize(w io.Writer) {
+	binary.Write(w, binary.BigEndian, s.decay)
+	binary.Write(w, binary.BigEndian, uint32(s.scale))
+	binary.Write(w, binary.BigEndian, s.feeRateAvg)
+	binary.Write(w, binary.BigEndian, s.txCtAvg)
+	binary.Write(w, binary.BigEndian, uint32(len(s.confAvg)))
+	for i := range s.confAvg {
+		binary.Write(w, binary.BigEndian, s.confAvg[i])
+	}
+	for i := range s.failAvg {
+		binary.Write(w, binary.BigEndian, s.failAvg[i])
+	}
+}
+
+// deserializeTxConfirmStats reads the moving averages of a horizon written by
+// serialize and checks they match the passed parameters.
+func deserializeTxConfirmStats(r io.Reader, buckets []float64, periods, scale int,
+	decay float64) (*txConfirmStats, error) {
+
+	var fileDecay float64
+	var fileScale, filePeriods uint32
+	if err := binary.Read(r, binary.BigEndian, &fileDecay); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &fileScale); err != nil {
+		return nil, err
+	}
+	if fileDecay != decay || int(fileScale) != scale {
+		return nil, fmt.Errorf("horizon with decay %v and scale %d "+
+			"does not match decay %v and scale %d", fileDecay,
+			fileScale, decay, scale)
+	}
 
-	binary.Write(w, binary.BigEndian, uint32(len(rb.transactions)))
-	for _, o := range rb.transactions {
-		binary.Write(w, binary.BigEndian, txs[o])
+	s := newTxConfirmStats(buckets, periods, scale, decay)
+	if err := binary.Read(r, binary.BigEndian, s.feeRateAvg); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.BigEndian, s.txCtAvg); err != nil {
+		return nil, err
 	}
+	if err := binary.Read(r, binary.BigEndian, &filePeriods); err != nil {
+		return nil, err
+	}
+	if int(filePeriods) != periods {
+		return nil, fmt.Errorf("horizon with %d periods does not "+
+			"match %d periods", filePeriods, periods)
+	}
+	for i := range s.confAvg {
+		if err := binary.Read(r, binary.BigEndian, s.confAvg[i]); err != nil {
+			return nil, err
+		}
+	}
+	for i := range s.failAvg {
+		if err := binary.Read(r, binary.BigEndian, s.failAvg[i]); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// trackedTx is a transaction in the mempool which is tracked by the fee
+// estimator.
+type trackedTx struct {
+	// height is the height of the main chain when it entered the mempool.
+	height int32
+
+	// feeRate is its fee rate in satoshi per kilobyte and bucket the index
+	// of the fee rate bucket it falls into.
+	feeRate float64
+	bucket  int
 }
 
 // FeeEstimator manages the data necessary to create
 // fee estimations. It is safe for concurrent access.
 type FeeEstimator struct {
-	maxRollback uint32
-	binSize     int32
+	mtx sync.Mutex
+
+	// buckets are the upper bounds of the fee rate buckets in satoshi per
+	// kilobyte.  The last bucket holds all fee rates above the maximum.
+	buckets []float64
 
-	// The maximum number of replacements that can be made in a single
-	// bin per block. Default is estimateFeeMaxReplacements
-	maxReplacements int32
+	short  *txConfirmStats
+	medium *txConfirmStats
+	long   *txConfirmStats
 
-	// The minimum number of blocks that can be registered with the fee
-	// estimator before it will provide answers.
-	minRegisteredBlocks uint32
+	// tracked holds the transactions in the mempool which are tracked.
+	tracked map[chainhash.Hash]*trackedTx
 
 	// The last known height.
 	lastKnownHeight int32
 
-	// The number of blocks that have been registered.
-	numBlocksRegistered uint32
-
-	mtx      sync.RWMutex
-	observed map[chainhash.Hash]*observedTransaction
-	bin      [estimateFeeDepth][]*observedTransaction
+	// firstRecordedHeight is the height of the first block in which
+	// tracked transactions were mined since the fee estimator was created
+	// or restored.
+	firstRecordedHeight int32
 
-	// The cached estimates.
-	cached []SatoshiPerByte
+	// historicalFirstHeight and historicalBestHeight is the range of
+	// blocks registered with the fee estimator before it was restored.
+	historicalFirstHeight int32
+	historicalBestHeight  int32
+}
 
-	// Transactions that have been removed from the bins. This allows us to
-	// revert in case of an orphaned block.
-	dropped []*registeredBlock
+// feeRateBuckets returns the upper bounds of the fee rate buckets.
+func feeRateBuckets() []float64 {
+	var buckets []float64
+	for bound := float64(minBucketFeeRate); bound <= maxBucketFeeRate; bound *= feeBucketSpacing {
+		buckets = append(buckets, bound)
+	}
+	return append(buckets, math.Inf(1))
 }
 
-// NewFeeEstimator creates a FeeEstimator for which at most maxRollback blocks
-// can be unregistered and which returns an error unless minRegisteredBlocks
-// have been registered with it.
-func NewFeeEstimator(maxRollback, minRegisteredBlocks uint32) *FeeEstimator {
+// NewFeeEstimator creates a FeeEstimator without any data, which provides
+// estimates once enough blocks have been registered with it.
+func NewFeeEstimator() *FeeEstimator {
+	buckets := feeRateBuckets()
 	return &FeeEstimator{
-		maxRollback:         maxRollback,
-		minRegisteredBlocks: minRegisteredBlocks,
-		lastKnownHeight:     mining.UnminedHeight,
-		binSize:             estimateFeeBinSize,
-		maxReplacements:     estimateFeeMaxReplacements,
-		observed:            make(map[chainhash.Hash]*observedTransaction),
-		dropped:             make([]*registeredBlock, 0, maxRollback),
+		buckets: buckets,
+		short: newTxConfirmStats(buckets, shortBlockPeriods,
+			shortScale, shortDecay),
+		medium: newTxConfirmStats(buckets, medBlockPeriods, medScale,
+			medDecay),
+		long: newTxConfirmStats(buckets, longBlockPeriods, longScale,
+			longDecay),
+		tracked: make(map[chainhash.Hash]*trackedTx),
 	}
 }
 
+// bucketIndex returns the index of the bucket the passed fee rate in satoshi
+// per kilobyte falls into.
+func (ef *FeeEstimator) bucketIndex(feeRate float64) int {
+	return sort.SearchFloat64s(ef.buckets, feeRate)
+}
+
 // ObserveTransaction is called when a new transaction is observed in the mempool.
+// Transactions which entered the mempool while the fee estimator is not up to
+// date with the main chain are not tracked, since it is unknown how long they
+// would take to be mined.
 func (ef *FeeEstimator) ObserveTransaction(t *TxDesc) {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
 
-	// If we haven't seen a block yet we don't know when this one arrived,
-	// so we ignore it.
-	if ef.lastKnownHeight == mining.UnminedHeight {
+	hash := *t.Tx.Hash()
+	if _, ok := ef.tracked[hash]; ok {
+		return
+	}
+	if ef.lastKnownHeight == 0 || t.Height != ef.lastKnownHeight {
 		return
 	}
 
-	hash := *t.Tx.Hash()
-	if _, ok := ef.observed[hash]; !ok {
-		size := uint32(GetTxVirtualSize(t.Tx))
-
-		ef.observed[hash] = &observedTransaction{
-			hash:     hash,
-			feeRate:  NewSatoshiPerByte(btcutil.Amount(t.Fee), size),
-			observed: t.Height,
-			mined:    mining.UnminedHeight,
-		}
+	size := GetTxVirtualSize(t.Tx)
+	feeRate := float64(t.Fee) * bytePerKb / float64(size)
+	bucket := ef.bucketIndex(feeRate)
+	ef.tracked[hash] = &trackedTx{
+		height:  t.Height,
+		feeRate: feeRate,
+		bucket:  bucket,
+	}
+	ef.short.newTx(t.Height, bucket)
+	ef.medium.newTx(t.Height, bucket)
+	ef.long.newTx(t.Height, bucket)
+}
+
+// removeTx stops tracking the transaction with the passed hash and returns it,
+// or nil if it wasn't tracked.
+//
+// This function MUST be called with the fee estimator lock held.
+func (ef *FeeEstimator) removeTx(hash *chainhash.Hash, inBlock bool) *trackedTx {
+	tx, ok := ef.tracked[*hash]
+	if !ok {
+		return nil
 	}
+	ef.short.removeTx(tx.height, ef.lastKnownHeight, tx.bucket, inBlock)
+	ef.medium.removeTx(tx.height, ef.lastKnownHeight, tx.bucket, inBlock)
+	ef.long.removeTx(tx.height, ef.lastKnownHeight, tx.bucket, inBlock)
+	delete(ef.tracked, *hash)
+	return tx
+}
+
+// RemoveTransaction is called when a transaction leaves the mempool without
+// being mined, for example because it was replaced, double spent or evicted.
+// It counts as a failure to be mined at its fee rate.  Transactions which were
+// mined must be registered through RegisterBlock before they are removed from
+// the mempool.
+func (ef *FeeEstimator) RemoveTransaction(hash *chainhash.Hash) {
+	ef.mtx.Lock()
+	ef.removeTx(hash, false)
+	ef.mtx.Unlock()
 }
 
 // RegisterBlock informs the fee estimator of a new block to take into account.
-func (ef *FeeEstimator) RegisterBlock(block *btcutil.Block) error {
+// Blocks which are not above the last known height, such as blocks connected
+// during a reorganization, only stop the tracking of their transactions
+// without being recorded.
+func (ef *FeeEstimator) RegisterBlock(block *btcutil.Block) {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
 
-	// The previous sorted list is invalid, so delete it.
-	ef.cached = nil
-
 	height := block.Height()
-	if height != ef.lastKnownHeight+1 && ef.lastKnownHeight != mining.UnminedHeight {
-		return fmt.Errorf("intermediate block not recorded; current height is %d; new height is %d",
-			ef.lastKnownHeight, height)
+	if height <= ef.lastKnownHeight {
+		for _, tx := range block.Transactions() {
+			ef.removeTx(tx.Hash(), true)
+		}
+		return
 	}
 
 	// Update the last known height.
 	ef.lastKnownHeight = height
-	ef.numBlocksRegistered++
-
-	// Randomly order txs in block.
-	transactions := make(map[*btcutil.Tx]struct{})
-	for _, t := range block.Transactions() {
-		transactions[t] = struct{}{}
-	}
-
-	// Count the number of replacements we make per bin so that we don't
-	// replace too many.
-	var replacementCounts [estimateFeeDepth]int
 
-	// Keep track of which txs were dropped in case of an orphan block.
-	dropped := &registeredBlock{
-		hash:         *block.Hash(),
-		transactions: make([]*observedTransaction, 0, 100),
+	for _, stats := range []*txConfirmStats{ef.short, ef.medium, ef.long} {
+		stats.clearCurrent(height)
+		stats.updateMovingAverages()
 	}
 
-	// Go through the txs in the block.
-	for t := range transactions {
-		hash := *t.Hash()
-
-		// Have we observed this tx in the mempool?
-		o, ok := ef.observed[hash]
-		if !ok {
-			continue
-		}
-
-		// Put the observed tx in the oppropriate bin.
-		blocksToConfirm := height - o.observed - 1
-
-		// This shouldn't happen if the fee estimator works correctly,
-		// but return an error if it does.
-		if o.mined != mining.UnminedHeight {
-			log.Error("Estimate fee: transaction ", hash.String(), " has already been mined")
-			return errors.New("Transaction has already been mined")
-		}
-
-		// This shouldn't happen but check just in case to avoid
-		// an out-of-bounds array index later.
-		if blocksToConfirm >= estimateFeeDepth {
+	var numRecorded int
+	for _, tx := range block.Transactions() {
+		tracked := ef.removeTx(tx.Hash(), true)
+		if tracked == nil {
 			continue
 		}
-
-		// Make sure we do not replace too many transactions per min.
-		if replacementCounts[blocksToConfirm] == int(ef.maxReplacements) {
+		blocksToConfirm := int(height - tracked.height)
+		if blocksToConfirm <= 0 {
 			continue
 		}
-
-		o.mined = height
-
-		replacementCounts[blocksToConfirm]++
-
-		bin := ef.bin[blocksToConfirm]
-
-		// Remove a random element and replace it with this new tx.
-		if len(bin) == int(ef.binSize) {
-			// Don't drop transactions we have just added from this same block.
-			l := int(ef.binSize) - replacementCounts[blocksToConfirm]
-			drop := rand.Intn(l)
-			dropped.transactions = append(dropped.transactions, bin[drop])
-
-			bin[drop] = bin[l-1]
-			bin[l-1] = o
-		} else {
-			bin = append(bin, o)
-		}
-		ef.bin[blocksToConfirm] = bin
-	}
-
-	// Go through the mempool for txs that have been in too long.
-	for hash, o := range ef.observed {
-		if o.mined == mining.UnminedHeight && height-o.observed >= estimateFeeDepth {
-			delete(ef.observed, hash)
-		}
-	}
-
-	// Add dropped list to history.
-	if ef.maxRollback == 0 {
-		return nil
+		ef.short.record(blocksToConfirm, tracked.bucket, tracked.feeRate)
+		ef.medium.record(blocksToConfirm, tracked.bucket, tracked.feeRate)
+		ef.long.record(blocksToConfirm, tracked.bucket, tracked.feeRate)
+		numRecorded++
 	}
 
-	if uint32(len(ef.dropped)) == ef.maxRollback {
-		ef.dropped = append(ef.dropped[1:], dropped)
-	} else {
-		ef.dropped = append(ef.dropped, dropped)
+	if numRecorded > 0 && ef.firstRecordedHeight == 0 {
+		ef.firstRecordedHeight = height
 	}
 
-	return nil
+	log.Debugf("Fee estimator recorded %d of %d transactions in block "+
+		"%d, tracking %d", numRecorded, len(block.Transactions())-1,
+		height, len(ef.tracked))
 }
 
 // LastKnownHeight returns the height of the last block which was registered.
@@ -334,344 +606,238 @@ func (ef *FeeEstimator) LastKnownHeight() int32 {
 	return ef.lastKnownHeight
 }
 
-// Rollback unregisters a recently registered block from the FeeEstimator.
-// This can be used to reverse the effect of an orphaned block on the fee
-// estimator. The maximum number of rollbacks allowed is given by
-// maxRollbacks.
+// blockSpan returns the number of blocks for which data was recorded since the
+// fee estimator was created or restored.
 //
-// Note: not everything can be rolled back because some transactions are
-// deleted if they have been observed too long ago. That means the result
-// of Rollback won't always be exactly the same as if the last block had not
-// happened, but it should be close enough.
-func (ef *FeeEstimator) Rollback(hash *chainhash.Hash) error {
-	ef.mtx.Lock()
-	defer ef.mtx.Unlock()
-
-	// Find this block in the stack of recent registered blocks.
-	var n int
-	for n = 1; n <= len(ef.dropped); n++ {
-		if ef.dropped[len(ef.dropped)-n].hash.IsEqual(hash) {
-			break
-		}
+// This function MUST be called with the fee estimator lock held.
+func (ef *FeeEstimator) blockSpan() int {
+	if ef.firstRecordedHeight == 0 {
+		return 0
 	}
+	return int(ef.lastKnownHeight - ef.firstRecordedHeight)
+}
 
-	if n > len(ef.dropped) {
-		return errors.New("no such block was recently registered")
+// historicalBlockSpan returns the number of blocks for which data was recorded
+// before the fee estimator was restored, unless that data is too old.
+//
+// This function MUST be called with the fee estimator lock held.
+func (ef *FeeEstimator) historicalBlockSpan() int {
+	if ef.historicalFirstHeight == 0 {
+		return 0
 	}
-
-	for i := 0; i < n; i++ {
-		ef.rollback()
+	if ef.lastKnownHeight-ef.historicalBestHeight > oldestEstimateHistory {
+		return 0
 	}
-
-	return nil
+	return int(ef.historicalBestHeight - ef.historicalFirstHeight)
 }
 
-// rollback rolls back the effect of the last block in the stack
-// of registered blocks.
-func (ef *FeeEstimator) rollback() {
-	// The previous sorted list is invalid, so delete it.
-	ef.cached = nil
-
-	// pop the last list of dropped txs from the stack.
-	last := len(ef.dropped) - 1
-	if last == -1 {
-		// Cannot really happen because the exported calling function
-		// only rolls back a block already known to be in the list
-		// of dropped transactions.
-		return
+// maxUsableEstimate returns the highest target which can be estimated, which
+// is half the number of blocks for which data was recorded.
+//
+// This function MUST be called with the fee estimator lock held.
+func (ef *FeeEstimator) maxUsableEstimate() int {
+	span := ef.blockSpan()
+	if historical := ef.historicalBlockSpan(); historical > span {
+		span = historical
 	}
+	if maxConfirms := ef.long.maxConfirms(); span/2 > maxConfirms {
+		return maxConfirms
+	}
+	return span / 2
+}
 
-	dropped := ef.dropped[last]
-
-	// where we are in each bin as we replace txs?
-	var replacementCounters [estimateFeeDepth]int
-
-	// Go through the txs in the dropped block.
-	for _, o := range dropped.transactions {
-		// Which bin was this tx in?
-		blocksToConfirm := o.mined - o.observed - 1
-
-		bin := ef.bin[blocksToConfirm]
-
-		var counter = replacementCounters[blocksToConfirm]
-
-		// Continue to go through that bin where we left off.
-		for {
-			if counter >= len(bin) {
-				// Panic, as we have entered an unrecoverable invalid state.
-				panic(errors.New("illegal state: cannot rollback dropped transaction"))
-			}
-
-			prev := bin[counter]
-
-			if prev.mined == ef.lastKnownHeight {
-				prev.mined = mining.UnminedHeight
-
-				bin[counter] = o
-
-				counter++
-				break
-			}
-
-			counter++
+// estimateCombinedFee returns the fee rate in satoshi per kilobyte for which the
+// passed ratio of transactions were mined within the passed target using the
+// shortest horizon which tracks the target, or -1 when there is no such fee
+// rate.  When checkShorterHorizon is set, the highest targets of the shorter
+// horizons are checked as well so estimates increase monotonically.
+//
+// This function MUST be called with the fee estimator lock held.
+func (ef *FeeEstimator) estimateCombinedFee(confTarget int, successThreshold float64,
+	checkShorterHorizon bool) float64 {
+
+	if confTarget < 1 || confTarget > ef.long.maxConfirms() {
+		return -1
+	}
+
+	height := ef.lastKnownHeight
+	var estimate float64
+	switch {
+	case confTarget <= ef.short.maxConfirms():
+		estimate = ef.short.estimateMedianVal(confTarget,
+			sufficientTxsShort, successThreshold, height)
+	case confTarget <= ef.medium.maxConfirms():
+		estimate = ef.medium.estimateMedianVal(confTarget,
+			sufficientFeeTxs, successThreshold, height)
+	default:
+		estimate = ef.long.estimateMedianVal(confTarget,
+			sufficientFeeTxs, successThreshold, height)
+	}
+
+	if !checkShorterHorizon {
+		return estimate
+	}
+	if confTarget > ef.medium.maxConfirms() {
+		medMax := ef.medium.estimateMedianVal(ef.medium.maxConfirms(),
+			sufficientFeeTxs, successThreshold, height)
+		if medMax > 0 && (estimate == -1 || medMax < estimate) {
+			estimate = medMax
 		}
-
-		replacementCounters[blocksToConfirm] = counter
 	}
-
-	// Continue going through bins to find other txs to remove
-	// which did not replace any other when they were entered.
-	for i, j := range replacementCounters {
-		for {
-			l := len(ef.bin[i])
-			if j >= l {
-				break
-			}
-
-			prev := ef.bin[i][j]
-
-			if prev.mined == ef.lastKnownHeight {
-				prev.mined = mining.UnminedHeight
-
-				newBin := append(ef.bin[i][0:j], ef.bin[i][j+1:l]...)
-				// TODO This line should prevent an unintentional memory
-				// leak but it causes a panic when it is uncommented.
-				// ef.bin[i][j] = nil
-				ef.bin[i] = newBin
-
-				continue
-			}
-
-			j++
+	if confTarget > ef.short.maxConfirms() {
+		shortMax := ef.short.estimateMedianVal(ef.short.maxConfirms(),
+			sufficientTxsShort, successThreshold, height)
+		if shortMax > 0 && (estimate == -1 || shortMax < estimate) {
+			estimate = shortMax
 		}
 	}
-
-	ef.dropped = ef.dropped[0:last]
-
-	// The number of blocks the fee estimator has seen is decrimented.
-	ef.numBlocksRegistered--
-	ef.lastKnownHeight--
-}
-
-// estimateFeeSet is a set of txs that can that is sorted
-// by the fee per kb rate.
-type estimateFeeSet struct {
-	feeRate []SatoshiPerByte
-	bin     [estimateFeeDepth]uint32
-}
-
-func (b *estimateFeeSet) Len() int { return len(b.feeRate) }
-
-func (b *estimateFeeSet) Less(i, j int) bool {
-	return b.feeRate[i] > b.feeRate[j]
+	return estimate
 }
 
-func (b *estimateFeeSet) Swap(i, j int) {
-	b.feeRate[i], b.feeRate[j] = b.feeRate[j], b.feeRate[i]
+// estimateConservativeFee returns the highest fee rate in satoshi per kilobyte
+// for which nearly all transactions were mined within the passed target in the
+// medium and long horizons, or -1 when there is no such fee rate.
+//
+// This function MUST be called with the fee estimator lock held.
+func (ef *FeeEstimator) estimateConservativeFee(doubleTarget int) float64 {
+	height := ef.lastKnownHeight
+	estimate := float64(-1)
+	if doubleTarget <= ef.short.maxConfirms() {
+		estimate = ef.medium.estimateMedianVal(doubleTarget,
+			sufficientFeeTxs, doubleSuccessPct, height)
+	}
+	if doubleTarget <= ef.medium.maxConfirms() {
+		longEstimate := ef.long.estimateMedianVal(doubleTarget,
+			sufficientFeeTxs, doubleSuccessPct, height)
+		if longEstimate > estimate {
+			estimate = longEstimate
+		}
+	}
+	return estimate
 }
 
-// estimateFee returns the estimated fee for a transaction
-// to confirm in confirmations blocks from now, given
-// the data set we have collected.
-func (b *estimateFeeSet) estimateFee(confirmations int) SatoshiPerByte {
-	if confirmations <= 0 {
-		return SatoshiPerByte(math.Inf(1))
-	}
+// EstimateSmartFee estimates the fee rate required for a transaction to be
+// mined within the passed number of blocks.  It returns the fee rate along with
+// the number of blocks the estimate is for, which is higher than the passed
+// number when it is 1 or lower when not enough data has been recorded yet.
+//
+// The estimate is the highest of the fee rates which got most transactions
+// mined within half the target, within the target and within double the target.
+// Conservative estimates additionally take the long horizons into account for
+// double the target, so they are less affected by short drops in the fee
+// market, while economical estimates follow it more closely.
+func (ef *FeeEstimator) EstimateSmartFee(numBlocks uint32, conservative bool) (BtcPerKilobyte, uint32, error) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
 
-	if confirmations > estimateFeeDepth {
-		return 0
+	if numBlocks == 0 {
+		return -1, 0, errors.New("cannot confirm transaction in zero blocks")
 	}
-
-	// We don't have any transactions!
-	if len(b.feeRate) == 0 {
-		return 0
+	if numBlocks > MaxEstimateTarget {
+		return -1, 0, fmt.Errorf("can only estimate fees for up to %d "+
+			"blocks from now", MaxEstimateTarget)
 	}
 
-	var min, max int = 0, 0
-	for i := 0; i < confirmations-1; i++ {
-		min += int(b.bin[i])
+	// Transactions are mined in the next block at the earliest, so there
+	// is no data for a single block.
+	confTarget := int(numBlocks)
+	if confTarget == 1 {
+		confTarget = 2
 	}
-
-	max = min + int(b.bin[confirmations-1]) - 1
-	if max < min {
-		max = min
+	if maxUsable := ef.maxUsableEstimate(); confTarget > maxUsable {
+		confTarget = maxUsable
 	}
-	feeIndex := (min + max) / 2
-	if feeIndex >= len(b.feeRate) {
-		feeIndex = len(b.feeRate) - 1
+	if confTarget <= 1 {
+		return -1, 0, errors.New("not enough blocks have been observed")
 	}
 
-	return b.feeRate[feeIndex]
-}
-
-// newEstimateFeeSet creates a temporary data structure that
-// can be used to find all fee estimates.
-func (ef *FeeEstimator) newEstimateFeeSet() *estimateFeeSet {
-	set := &estimateFeeSet{}
-
-	capacity := 0
-	for i, b := range ef.bin {
-		l := len(b)
-		set.bin[i] = uint32(l)
-		capacity += l
+	median := ef.estimateCombinedFee(confTarget/2, halfSuccessPct, true)
+	if actualEst := ef.estimateCombinedFee(confTarget, successPct, true); actualEst > median {
+		median = actualEst
 	}
-
-	set.feeRate = make([]SatoshiPerByte, capacity)
-
-	i := 0
-	for _, b := range ef.bin {
-		for _, o := range b {
-			set.feeRate[i] = o.feeRate
-			i++
+	doubleEst := ef.estimateCombinedFee(2*confTarget, doubleSuccessPct,
+		!conservative)
+	if doubleEst > median {
+		median = doubleEst
+	}
+	if conservative || median == -1 {
+		if consEst := ef.estimateConservativeFee(2 * confTarget); consEst > median {
+			median = consEst
 		}
 	}
-
-	sort.Sort(set)
-
-	return set
-}
-
-// estimates returns the set of all fee estimates from 1 to estimateFeeDepth
-// confirmations from now.
-func (ef *FeeEstimator) estimates() []SatoshiPerByte {
-	set := ef.newEstimateFeeSet()
-
-	estimates := make([]SatoshiPerByte, estimateFeeDepth)
-	for i := 0; i < estimateFeeDepth; i++ {
-		estimates[i] = set.estimateFee(i + 1)
+	if median < 0 {
+		return -1, uint32(confTarget), errors.New("insufficient data " +
+			"or no feerate found")
 	}
 
-	return estimates
+	rate := math.Round(median) * btcPerSatoshi
+	return BtcPerKilobyte(rate), uint32(confTarget), nil
 }
 
-// EstimateFee estimates the fee per byte to have a tx confirmed a given
-// number of blocks from now.
+// EstimateFee estimates the fee per kilobyte to have a tx confirmed a given
+// number of blocks from now based on the medium horizon only.  It returns -1
+// when there is not enough data.  EstimateSmartFee should be preferred.
 func (ef *FeeEstimator) EstimateFee(numBlocks uint32) (BtcPerKilobyte, error) {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
 
-	// If the number of registered blocks is below the minimum, return
-	// an error.
-	if ef.numBlocksRegistered < ef.minRegisteredBlocks {
-		return -1, errors.New("not enough blocks have been observed")
-	}
-
 	if numBlocks == 0 {
 		return -1, errors.New("cannot confirm transaction in zero blocks")
 	}
 
-	if numBlocks > estimateFeeDepth {
+	if numBlocks > uint32(ef.medium.maxConfirms()) {
 		return -1, fmt.Errorf(
 			"can only estimate fees for up to %d blocks from now",
-			estimateFeeBinSize)
+			ef.medium.maxConfirms())
 	}
 
-	// If there are no cached results, generate them.
-	if ef.cached == nil {
-		ef.cached = ef.estimates()
+	median := ef.medium.estimateMedianVal(int(numBlocks), sufficientFeeTxs,
+		doubleSuccessPct, ef.lastKnownHeight)
+	if median < 0 {
+		return -1, nil
 	}
 
-	return ef.cached[int(numBlocks)-1].ToBtcPerKb(), nil
+	return BtcPerKilobyte(math.Round(median) * btcPerSatoshi), nil
 }
 
 // In case the format for the serialized version of the FeeEstimator changes,
 // we use a version number. If the version number changes, it does not make
 // sense to try to upgrade a previous version to a new version. Instead, just
 // start fee estimation over.
-const estimateFeeSaveVersion = 1
-
-func deserializeRegisteredBlock(r io.Reader, txs map[uint32]*observedTransaction) (*registeredBlock, error) {
-	var lenTransactions uint32
-
-	rb := &registeredBlock{}
-	binary.Read(r, binary.BigEndian, &rb.hash)
-	binary.Read(r, binary.BigEndian, &lenTransactions)
-
-	rb.transactions = make([]*observedTransaction, lenTransactions)
-
-	for i := uint32(0); i < lenTransactions; i++ {
-		var index uint32
-		binary.Read(r, binary.BigEndian, &index)
-		rb.transactions[i] = txs[index]
-	}
-
-	return rb, nil
-}
+const estimateFeeSaveVersion = 2
 
 // FeeEstimatorState represents a saved FeeEstimator that can be
 // restored with data from an earlier session of the program.
 type FeeEstimatorState []byte
 
-// observedTxSet is a set of txs that can that is sorted
-// by hash. It exists for serialization purposes so that
-// a serialized state always comes out the same.
-type observedTxSet []*observedTransaction
-
-func (q observedTxSet) Len() int { return len(q) }
-
-func (q observedTxSet) Less(i, j int) bool {
-	return strings.Compare(q[i].hash.String(), q[j].hash.String()) < 0
-}
-
-func (q observedTxSet) Swap(i, j int) {
-	q[i], q[j] = q[j], q[i]
-}
-
 // Save records the current state of the FeeEstimator to a []byte that
-// can be restored later.
+// can be restored later.  The transactions which are currently tracked are
+// not saved.
 func (ef *FeeEstimator) Save() FeeEstimatorState {
 	ef.mtx.Lock()
 	defer ef.mtx.Unlock()
 
-	// TODO figure out what the capacity should be.
 	w := bytes.NewBuffer(make([]byte, 0))
 
 	binary.Write(w, binary.BigEndian, uint32(estimateFeeSaveVersion))
+	binary.Write(w, binary.BigEndian, ef.lastKnownHeight)
 
-	// Insert basic parameters.
-	binary.Write(w, binary.BigEndian, &ef.maxRollback)
-	binary.Write(w, binary.BigEndian, &ef.binSize)
-	binary.Write(w, binary.BigEndian, &ef.maxReplacements)
-	binary.Write(w, binary.BigEndian, &ef.minRegisteredBlocks)
-	binary.Write(w, binary.BigEndian, &ef.lastKnownHeight)
-	binary.Write(w, binary.BigEndian, &ef.numBlocksRegistered)
-
-	// Put all the observed transactions in a sorted list.
-	var txCount uint32
-	ots := make([]*observedTransaction, len(ef.observed))
-	for hash := range ef.observed {
-		ots[txCount] = ef.observed[hash]
-		txCount++
-	}
-
-	sort.Sort(observedTxSet(ots))
-
-	txCount = 0
-	observed := make(map[*observedTransaction]uint32)
-	binary.Write(w, binary.BigEndian, uint32(len(ef.observed)))
-	for _, ot := range ots {
-		ot.Serialize(w)
-		observed[ot] = txCount
-		txCount++
-	}
-
-	// Save all the right bins.
-	for _, list := range ef.bin {
-
-		binary.Write(w, binary.BigEndian, uint32(len(list)))
-
-		for _, o := range list {
-			binary.Write(w, binary.BigEndian, observed[o])
-		}
+	// Save the range of blocks the data was recorded for, using the range
+	// before the fee estimator was restored while it is longer.
+	if ef.blockSpan() > ef.historicalBlockSpan()/2 {
+		binary.Write(w, binary.BigEndian, ef.firstRecordedHeight)
+		binary.Write(w, binary.BigEndian, ef.lastKnownHeight)
+	} else {
+		binary.Write(w, binary.BigEndian, ef.historicalFirstHeight)
+		binary.Write(w, binary.BigEndian, ef.historicalBestHeight)
 	}
 
-	// Dropped transactions.
-	binary.Write(w, binary.BigEndian, uint32(len(ef.dropped)))
-	for _, registered := range ef.dropped {
-		registered.serialize(w, observed)
-	}
+	binary.Write(w, binary.BigEndian, uint32(len(ef.buckets)))
+	binary.Write(w, binary.BigEndian, ef.buckets)
+	ef.medium.serialize(w)
+	ef.short.serialize(w)
+	ef.long.serialize(w)
 
-	// Commit the tx and return.
 	return FeeEstimatorState(w.Bytes())
 }
 
@@ -690,60 +856,55 @@ func RestoreFeeEstimator(data FeeEstimatorState) (*FeeEstimator, error) {
 		return nil, fmt.Errorf("Incorrect version: expected %d found %d", estimateFeeSaveVersion, version)
 	}
 
-	ef := &FeeEstimator{
-		observed: make(map[chainhash.Hash]*observedTransaction),
-	}
-
-	// Read basic parameters.
-	binary.Read(r, binary.BigEndian, &ef.maxRollback)
-	binary.Read(r, binary.BigEndian, &ef.binSize)
-	binary.Read(r, binary.BigEndian, &ef.maxReplacements)
-	binary.Read(r, binary.BigEndian, &ef.minRegisteredBlocks)
-	binary.Read(r, binary.BigEndian, &ef.lastKnownHeight)
-	binary.Read(r, binary.BigEndian, &ef.numBlocksRegistered)
-
-	// Read transactions.
-	var numObserved uint32
-	observed := make(map[uint32]*observedTransaction)
-	binary.Read(r, binary.BigEndian, &numObserved)
-	for i := uint32(0); i < numObserved; i++ {
-		ot, err := deserializeObservedTransaction(r)
-		if err != nil {
+	ef := NewFeeEstimator()
+	var firstHeight, bestHeight int32
+	for _, field := range []*int32{&ef.lastKnownHeight, &firstHeight, &bestHeight} {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
 			return nil, err
 		}
-		observed[i] = ot
-		ef.observed[ot.hash] = ot
-	}
-
-	// Read bins.
-	for i := 0; i < estimateFeeDepth; i++ {
-		var numTransactions uint32
-		binary.Read(r, binary.BigEndian, &numTransactions)
-		bin := make([]*observedTransaction, numTransactions)
-		for j := uint32(0); j < numTransactions; j++ {
-			var index uint32
-			binary.Read(r, binary.BigEndian, &index)
-
-			var exists bool
-			bin[j], exists = observed[index]
-			if !exists {
-				return nil, fmt.Errorf("Invalid transaction reference %d", index)
-			}
-		}
-		ef.bin[i] = bin
 	}
+	if firstHeight > bestHeight || bestHeight > ef.lastKnownHeight {
+		return nil, fmt.Errorf("invalid recorded block range %d to %d",
+			firstHeight, bestHeight)
+	}
+	ef.historicalFirstHeight = firstHeight
+	ef.historicalBestHeight = bestHeight
 
-	// Read dropped transactions.
-	var numDropped uint32
-	binary.Read(r, binary.BigEndian, &numDropped)
-	ef.dropped = make([]*registeredBlock, numDropped)
-	for i := uint32(0); i < numDropped; i++ {
-		var err error
-		ef.dropped[int(i)], err = deserializeRegisteredBlock(r, observed)
-		if err != nil {
-			return nil, err
+	var numBuckets uint32
+	if err := binary.Read(r, binary.BigEndian, &numBuckets); err != nil {
+		return nil, err
+	}
+	if int(numBuckets) != len(ef.buckets) {
+		return nil, fmt.Errorf("%d fee rate buckets do not match %d "+
+			"buckets", numBuckets, len(ef.buckets))
+	}
+	buckets := make([]float64, numBuckets)
+	if err := binary.Read(r, binary.BigEndian, buckets); err != nil {
+		return nil, err
+	}
+	for i := range buckets {
+		if buckets[i] != ef.buckets[i] {
+			return nil, fmt.Errorf("fee rate bucket %d with bound "+
+				"%v does not match bound %v", i, buckets[i],
+				ef.buckets[i])
 		}
 	}
 
+	ef.medium, err = deserializeTxConfirmStats(r, ef.buckets,
+		medBlockPeriods, medScale, medDecay)
+	if err != nil {
+		return nil, err
+	}
+	ef.short, err = deserializeTxConfirmStats(r, ef.buckets,
+		shortBlockPeriods, shortScale, shortDecay)
+	if err != nil {
+		return nil, err
+	}
+	ef.long, err = deserializeTxConfirmStats(r, ef.buckets,
+		longBlockPeriods, longScale, longDecay)
+	if err != nil {
+		return nil, err
+	}
+
 	return ef, nil
 }
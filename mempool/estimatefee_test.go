@@ -6,36 +6,13 @@ package mempool
 
 import (
 	"bytes"
-	"math/rand"
 	"testing"
 
-	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
 )
 
-// newTestFeeEstimator creates a feeEstimator with some different parameters
-// for testing purposes.
-func newTestFeeEstimator(binSize, maxReplacements, maxRollback uint32) *FeeEstimator {
-	return &FeeEstimator{
-		maxRollback:         maxRollback,
-		lastKnownHeight:     0,
-		binSize:             int32(binSize),
-		minRegisteredBlocks: 0,
-		maxReplacements:     int32(maxReplacements),
-		observed:            make(map[chainhash.Hash]*observedTransaction),
-		dropped:             make([]*registeredBlock, 0, maxRollback),
-	}
-}
-
-// lastBlock is a linked list of the block hashes which have been
-// processed by the test FeeEstimator.
-type lastBlock struct {
-	hash *chainhash.Hash
-	prev *lastBlock
-}
-
 // estimateFeeTester interacts with the FeeEstimator to keep track
 // of its expected state.
 type estimateFeeTester struct {
@@ -43,9 +20,10 @@ type estimateFeeTester struct {
 	t       *testing.T
 	version int32
 	height  int32
-	last    *lastBlock
 }
 
+// testTx returns a new transaction with a virtual size of 10 bytes and the
+// passed fee which entered the mempool at the current height.
 func (eft *estimateFeeTester) testTx(fee btcutil.Amount) *TxDesc {
 	eft.version++
 	return &TxDesc{
@@ -60,365 +38,216 @@ func (eft *estimateFeeTester) testTx(fee btcutil.Amount) *TxDesc {
 	}
 }
 
-func expectedFeePerKilobyte(t *TxDesc) BtcPerKilobyte {
-	size := float64(t.TxDesc.Tx.MsgTx().SerializeSize())
-	fee := float64(t.TxDesc.Fee)
-
-	return SatoshiPerByte(fee / size).ToBtcPerKb()
+// observe creates the passed number of transactions with the passed fee and
+// adds them to the fee estimator.
+func (eft *estimateFeeTester) observe(num int, fee btcutil.Amount) []*TxDesc {
+	txns := make([]*TxDesc, 0, num)
+	for i := 0; i < num; i++ {
+		txD := eft.testTx(fee)
+		eft.ef.ObserveTransaction(txD)
+		txns = append(txns, txD)
+	}
+	return txns
 }
 
-func (eft *estimateFeeTester) newBlock(txs []*wire.MsgTx) {
+// newBlock registers a block at the next height with the passed transactions.
+func (eft *estimateFeeTester) newBlock(txns []*TxDesc) {
 	eft.height++
 
+	msgTxns := make([]*wire.MsgTx, 0, len(txns)+1)
+	msgTxns = append(msgTxns, &wire.MsgTx{})
+	for _, txD := range txns {
+		msgTxns = append(msgTxns, txD.Tx.MsgTx())
+	}
 	block := btcutil.NewBlock(&wire.MsgBlock{
-		Transactions: txs,
+		Transactions: msgTxns,
 	})
 	block.SetHeight(eft.height)
 
-	eft.last = &lastBlock{block.Hash(), eft.last}
-
 	eft.ef.RegisterBlock(block)
 }
 
-func (eft *estimateFeeTester) rollback() {
-	if eft.last == nil {
-		return
-	}
+// checkSmartFee ensures EstimateSmartFee returns the passed fee rate in satoshi
+// per kilobyte for the passed target.
+func checkSmartFee(t *testing.T, ef *FeeEstimator, numBlocks uint32,
+	conservative bool, want float64, wantBlocks uint32) {
 
-	err := eft.ef.Rollback(eft.last.hash)
+	t.Helper()
 
+	rate, blocks, err := ef.EstimateSmartFee(numBlocks, conservative)
 	if err != nil {
-		eft.t.Errorf("Could not rollback: %v", err)
+		t.Fatalf("EstimateSmartFee(%d, %v): %v", numBlocks,
+			conservative, err)
+	}
+	if rate != BtcPerKilobyte(want*btcPerSatoshi) || blocks != wantBlocks {
+		t.Fatalf("EstimateSmartFee(%d, %v) = %v for %d blocks, want "+
+			"%v for %d blocks", numBlocks, conservative, rate,
+			blocks, BtcPerKilobyte(want*btcPerSatoshi), wantBlocks)
 	}
+}
 
-	eft.height--
-	eft.last = eft.last.prev
+// runFeeMarket adds transactions at three fee rates to the fee estimator for
+// the passed number of blocks.  The ones with the highest fee rate are mined in
+// the next block, the ones with the medium fee rate after three blocks and the
+// ones with the lowest fee rate are never mined.
+func runFeeMarket(eft *estimateFeeTester, numBlocks int) {
+	var pending [][]*TxDesc
+	for i := 0; i < numBlocks; i++ {
+		high := eft.observe(10, 100)
+		medium := eft.observe(10, 50)
+		eft.observe(10, 11)
+		pending = append(pending, medium)
+
+		mined := high
+		if len(pending) == 3 {
+			mined = append(mined, pending[0]...)
+			pending = pending[1:]
+		}
+		eft.newBlock(mined)
+	}
 }
 
 // TestEstimateFee tests basic functionality in the FeeEstimator.
 func TestEstimateFee(t *testing.T) {
-	ef := newTestFeeEstimator(5, 3, 1)
-	eft := estimateFeeTester{ef: ef, t: t}
-
-	// Try with no txs and get zero for all queries.
-	expected := BtcPerKilobyte(0.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+	eft := estimateFeeTester{ef: NewFeeEstimator(), t: t}
 
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when estimator is empty; got %f", expected, estimated)
-		}
+	// No estimates are made before any data was recorded.
+	_, _, err := eft.ef.EstimateSmartFee(2, true)
+	if err == nil {
+		t.Fatal("EstimateSmartFee: expected error without data")
 	}
 
-	// Now insert a tx.
-	tx := eft.testTx(1000000)
-	ef.ObserveTransaction(tx)
-
-	// Expected should still be zero because this is still in the mempool.
-	expected = BtcPerKilobyte(0.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when estimator has one tx in mempool; got %f", expected, estimated)
-		}
+	// Transactions are only tracked once the fee estimator knows the
+	// height at which they entered the mempool.
+	eft.observe(10, 100)
+	if len(eft.ef.tracked) != 0 {
+		t.Fatalf("tracking %d transactions before the first block",
+			len(eft.ef.tracked))
 	}
+	eft.newBlock(nil)
 
-	// Change minRegisteredBlocks to make sure that works. Error return
-	// value expected.
-	ef.minRegisteredBlocks = 1
-	expected = BtcPerKilobyte(-1.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+	runFeeMarket(&eft, 40)
 
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f before any blocks have been registered; got %f", expected, estimated)
-		}
-	}
+	// Transactions for the next block must pay the highest fee rate, while
+	// the medium fee rate is enough to be mined within six blocks.
+	checkSmartFee(t, eft.ef, 1, true, 10000, 2)
+	checkSmartFee(t, eft.ef, 2, false, 10000, 2)
+	checkSmartFee(t, eft.ef, 6, false, 5000, 6)
+	checkSmartFee(t, eft.ef, 6, true, 5000, 6)
 
-	// Record a block with the new tx.
-	eft.newBlock([]*wire.MsgTx{tx.Tx.MsgTx()})
-	expected = expectedFeePerKilobyte(tx)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
+	// Targets beyond half the number of blocks with data are lowered.
+	checkSmartFee(t, eft.ef, 100, false, 5000, 19)
 
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when one tx is binned; got %f", expected, estimated)
-		}
+	// Targets beyond the longest horizon are rejected.
+	_, _, err = eft.ef.EstimateSmartFee(MaxEstimateTarget+1, true)
+	if err == nil {
+		t.Fatalf("EstimateSmartFee: expected error for target %d",
+			MaxEstimateTarget+1)
 	}
 
-	// Roll back the last block; this was an orphan block.
-	ef.minRegisteredBlocks = 0
-	eft.rollback()
-	expected = BtcPerKilobyte(0.0)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f after rolling back block; got %f", expected, estimated)
-		}
+	// The medium horizon alone also finds the medium fee rate within
+	// six blocks.
+	rate, err := eft.ef.EstimateFee(6)
+	if err != nil {
+		t.Fatalf("EstimateFee: %v", err)
 	}
-
-	// Record an empty block and then a block with the new tx.
-	// This test was made because of a bug that only appeared when there
-	// were no transactions in the first bin.
-	eft.newBlock([]*wire.MsgTx{})
-	eft.newBlock([]*wire.MsgTx{tx.Tx.MsgTx()})
-	expected = expectedFeePerKilobyte(tx)
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f when one tx is binned; got %f", expected, estimated)
-		}
+	if rate != BtcPerKilobyte(5000*btcPerSatoshi) {
+		t.Fatalf("EstimateFee(6) = %v, want %v", rate,
+			BtcPerKilobyte(5000*btcPerSatoshi))
 	}
+}
 
-	// Create some more transactions.
-	txA := eft.testTx(500000)
-	txB := eft.testTx(2000000)
-	txC := eft.testTx(4000000)
-	ef.ObserveTransaction(txA)
-	ef.ObserveTransaction(txB)
-	ef.ObserveTransaction(txC)
+// TestEstimateFeeFailures ensures transactions which leave the mempool without
+// being mined are counted as failures for the periods they spent in it, while
+// transactions mined in blocks which are not recorded are not.
+func TestEstimateFeeFailures(t *testing.T) {
+	eft := estimateFeeTester{ef: NewFeeEstimator(), t: t}
+	eft.newBlock(nil)
 
-	// Record 7 empty blocks.
-	for i := 0; i < 7; i++ {
-		eft.newBlock([]*wire.MsgTx{})
+	removed := eft.observe(1, 100)[0]
+	reorged := eft.observe(1, 100)[0]
+	for i := 0; i < 3; i++ {
+		eft.newBlock(nil)
 	}
+	bucket := eft.ef.tracked[*removed.Tx.Hash()].bucket
 
-	// Mine the first tx.
-	eft.newBlock([]*wire.MsgTx{txA.Tx.MsgTx()})
-
-	// Now the estimated amount should depend on the value
-	// of the argument to estimate fee.
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-		if i > 2 {
-			expected = expectedFeePerKilobyte(txA)
-		} else {
-			expected = expectedFeePerKilobyte(tx)
+	eft.ef.RemoveTransaction(removed.Tx.Hash())
+	for i, failAvg := range eft.ef.short.failAvg {
+		want := float64(0)
+		if i < 3 {
+			want = 1
 		}
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f on round %d; got %f", expected, i, estimated)
+		if failAvg[bucket] != want {
+			t.Fatalf("short failure average for %d blocks is %v, "+
+				"want %v", i+1, failAvg[bucket], want)
 		}
 	}
 
-	// Record 5 more empty blocks.
-	for i := 0; i < 5; i++ {
-		eft.newBlock([]*wire.MsgTx{})
+	// Blocks which are not above the last known height, such as blocks
+	// connected during a reorganization, stop the tracking of their
+	// transactions without recording them.
+	eft.height--
+	eft.newBlock([]*TxDesc{reorged})
+	if len(eft.ef.tracked) != 0 {
+		t.Fatalf("still tracking %d transactions", len(eft.ef.tracked))
 	}
-
-	// Mine the next tx.
-	eft.newBlock([]*wire.MsgTx{txB.Tx.MsgTx()})
-
-	// Now the estimated amount should depend on the value
-	// of the argument to estimate fee.
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-		if i <= 2 {
-			expected = expectedFeePerKilobyte(txB)
-		} else if i <= 8 {
-			expected = expectedFeePerKilobyte(tx)
-		} else {
-			expected = expectedFeePerKilobyte(txA)
-		}
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f on round %d; got %f", expected, i, estimated)
+	for _, confAvg := range eft.ef.short.confAvg {
+		if confAvg[bucket] != 0 {
+			t.Fatal("recorded transaction of reorganized block")
 		}
 	}
-
-	// Record 9 more empty blocks.
-	for i := 0; i < 10; i++ {
-		eft.newBlock([]*wire.MsgTx{})
-	}
-
-	// Mine txC.
-	eft.newBlock([]*wire.MsgTx{txC.Tx.MsgTx()})
-
-	// This should have no effect on the outcome because too
-	// many blocks have been mined for txC to be recorded.
-	for i := uint32(1); i <= estimateFeeDepth; i++ {
-		estimated, _ := ef.EstimateFee(i)
-		if i <= 2 {
-			expected = expectedFeePerKilobyte(txC)
-		} else if i <= 8 {
-			expected = expectedFeePerKilobyte(txB)
-		} else if i <= 8+6 {
-			expected = expectedFeePerKilobyte(tx)
-		} else {
-			expected = expectedFeePerKilobyte(txA)
-		}
-
-		if estimated != expected {
-			t.Errorf("Estimate fee error: expected %f on round %d; got %f", expected, i, estimated)
-		}
+	if eft.ef.short.failAvg[3][bucket] != 0 {
+		t.Fatal("counted mined transaction as a failure")
 	}
 }
 
-func (eft *estimateFeeTester) estimates() [estimateFeeDepth]BtcPerKilobyte {
+// TestDatabase tests saving and restoring to a []byte.
+func TestDatabase(t *testing.T) {
+	eft := estimateFeeTester{ef: NewFeeEstimator(), t: t}
+	eft.newBlock(nil)
+	runFeeMarket(&eft, 40)
 
-	// Generate estimates
-	var estimates [estimateFeeDepth]BtcPerKilobyte
-	for i := 0; i < estimateFeeDepth; i++ {
-		estimates[i], _ = eft.ef.EstimateFee(uint32(i + 1))
+	state := eft.ef.Save()
+	restored, err := RestoreFeeEstimator(state)
+	if err != nil {
+		t.Fatalf("RestoreFeeEstimator: %v", err)
 	}
-
-	// Check that all estimated fee results go in descending order.
-	for i := 1; i < estimateFeeDepth; i++ {
-		if estimates[i] > estimates[i-1] {
-			eft.t.Error("Estimates not in descending order; got ",
-				estimates[i], " for estimate ", i, " and ", estimates[i-1], " for ", (i - 1))
-			panic("invalid state.")
-		}
+	if restored.LastKnownHeight() != eft.ef.LastKnownHeight() {
+		t.Fatalf("restored last known height %d, want %d",
+			restored.LastKnownHeight(), eft.ef.LastKnownHeight())
 	}
-
-	return estimates
-}
-
-func (eft *estimateFeeTester) round(txHistory [][]*TxDesc,
-	estimateHistory [][estimateFeeDepth]BtcPerKilobyte,
-	txPerRound, txPerBlock uint32) ([][]*TxDesc, [][estimateFeeDepth]BtcPerKilobyte) {
-
-	// generate new txs.
-	var newTxs []*TxDesc
-	for i := uint32(0); i < txPerRound; i++ {
-		newTx := eft.testTx(btcutil.Amount(rand.Intn(1000000)))
-		eft.ef.ObserveTransaction(newTx)
-		newTxs = append(newTxs, newTx)
+	if !bytes.Equal(restored.Save(), state) {
+		t.Fatal("restored fee estimator saves different state")
 	}
 
-	// Generate mempool.
-	mempool := make(map[*observedTransaction]*TxDesc)
-	for _, h := range txHistory {
-		for _, t := range h {
-			if o, exists := eft.ef.observed[*t.Tx.Hash()]; exists && o.mined == mining.UnminedHeight {
-				mempool[o] = t
+	// The restored fee estimator makes the same estimates using the span
+	// of blocks recorded before it was saved.
+	for _, numBlocks := range []uint32{2, 6, 12, 100} {
+		for _, conservative := range []bool{false, true} {
+			want, wantBlocks, err := eft.ef.EstimateSmartFee(
+				numBlocks, conservative,
+			)
+			if err != nil {
+				t.Fatalf("EstimateSmartFee: %v", err)
 			}
-		}
-	}
-
-	// generate new block, with no duplicates.
-	i := uint32(0)
-	newBlockList := make([]*wire.MsgTx, 0, txPerBlock)
-	for _, t := range mempool {
-		newBlockList = append(newBlockList, t.TxDesc.Tx.MsgTx())
-		i++
-
-		if i == txPerBlock {
-			break
-		}
-	}
-
-	// Register a new block.
-	eft.newBlock(newBlockList)
-
-	// return results.
-	estimates := eft.estimates()
-
-	// Return results
-	return append(txHistory, newTxs), append(estimateHistory, estimates)
-}
-
-// TestEstimateFeeRollback tests the rollback function, which undoes the
-// effect of a adding a new block.
-func TestEstimateFeeRollback(t *testing.T) {
-	txPerRound := uint32(7)
-	txPerBlock := uint32(5)
-	binSize := uint32(6)
-	maxReplacements := uint32(4)
-	stepsBack := 2
-	rounds := 30
-
-	eft := estimateFeeTester{ef: newTestFeeEstimator(binSize, maxReplacements, uint32(stepsBack)), t: t}
-	var txHistory [][]*TxDesc
-	estimateHistory := [][estimateFeeDepth]BtcPerKilobyte{eft.estimates()}
-
-	for round := 0; round < rounds; round++ {
-		// Go forward a few rounds.
-		for step := 0; step <= stepsBack; step++ {
-			txHistory, estimateHistory =
-				eft.round(txHistory, estimateHistory, txPerRound, txPerBlock)
-		}
-
-		// Now go back.
-		for step := 0; step < stepsBack; step++ {
-			eft.rollback()
-
-			// After rolling back, we should have the same estimated
-			// fees as before.
-			expected := estimateHistory[len(estimateHistory)-step-2]
-			estimates := eft.estimates()
-
-			// Ensure that these are both the same.
-			for i := 0; i < estimateFeeDepth; i++ {
-				if expected[i] != estimates[i] {
-					t.Errorf("Rollback value mismatch. Expected %f, got %f. ",
-						expected[i], estimates[i])
-					return
-				}
+			rate, blocks, err := restored.EstimateSmartFee(
+				numBlocks, conservative,
+			)
+			if err != nil {
+				t.Fatalf("EstimateSmartFee: %v", err)
+			}
+			if rate != want || blocks != wantBlocks {
+				t.Fatalf("restored EstimateSmartFee(%d, %v) = "+
+					"%v for %d blocks, want %v for %d "+
+					"blocks", numBlocks, conservative,
+					rate, blocks, want, wantBlocks)
 			}
 		}
-
-		// Erase history.
-		txHistory = txHistory[0 : len(txHistory)-stepsBack]
-		estimateHistory = estimateHistory[0 : len(estimateHistory)-stepsBack]
-	}
-}
-
-func (eft *estimateFeeTester) checkSaveAndRestore(
-	previousEstimates [estimateFeeDepth]BtcPerKilobyte) {
-
-	// Get the save state.
-	save := eft.ef.Save()
-
-	// Save and restore database.
-	var err error
-	eft.ef, err = RestoreFeeEstimator(save)
-	if err != nil {
-		eft.t.Fatalf("Could not restore database: %s", err)
-	}
-
-	// Save again and check that it matches the previous one.
-	redo := eft.ef.Save()
-	if !bytes.Equal(save, redo) {
-		eft.t.Fatalf("Restored states do not match: %v %v", save, redo)
-	}
-
-	// Check that the results match.
-	newEstimates := eft.estimates()
-
-	for i, prev := range previousEstimates {
-		if prev != newEstimates[i] {
-			eft.t.Error("Mismatch in estimate ", i, " after restore; got ", newEstimates[i], " but expected ", prev)
-		}
-	}
-}
-
-// TestSave tests saving and restoring to a []byte.
-func TestDatabase(t *testing.T) {
-
-	txPerRound := uint32(7)
-	txPerBlock := uint32(5)
-	binSize := uint32(6)
-	maxReplacements := uint32(4)
-	rounds := 8
-
-	eft := estimateFeeTester{ef: newTestFeeEstimator(binSize, maxReplacements, uint32(rounds)+1), t: t}
-	var txHistory [][]*TxDesc
-	estimateHistory := [][estimateFeeDepth]BtcPerKilobyte{eft.estimates()}
-
-	for round := 0; round < rounds; round++ {
-		eft.checkSaveAndRestore(estimateHistory[len(estimateHistory)-1])
-
-		// Go forward one step.
-		txHistory, estimateHistory =
-			eft.round(txHistory, estimateHistory, txPerRound, txPerBlock)
 	}
 
-	// Reverse the process and try again.
-	for round := 1; round <= rounds; round++ {
-		eft.rollback()
-		eft.checkSaveAndRestore(estimateHistory[len(estimateHistory)-round-1])
+	// States of a different version are rejected.
+	state[3]++
+	if _, err := RestoreFeeEstimator(state); err == nil {
+		t.Fatal("RestoreFeeEstimator: restored state of unknown version")
 	}
 }
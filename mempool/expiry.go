@@ -0,0 +1,56 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"time"
+)
+
+const (
+	// DefaultExpiry is the default maximum amount of time a transaction is
+	// allowed to stay in the pool before it expires and is evicted along
+	// with its descendants.
+	DefaultExpiry = time.Hour * 336
+
+	// txExpireScanInterval is the minimum amount of time in between scans
+	// of the pool to evict expired transactions.
+	txExpireScanInterval = time.Minute * 5
+)
+
+// isExpired returns whether a transaction which was added to the pool at the
+// passed time has been in it for longer than the expiry allows.
+func (mp *TxPool) isExpired(added, now time.Time) bool {
+	expiry := mp.cfg.Policy.Expiry
+	return expiry > 0 && now.Sub(added) > expiry
+}
+
+// expireTransactions removes the transactions which have been in the pool for
+// longer than the expiry along with their descendants.  The scan only happens
+// periodically instead of on every call for efficiency.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) expireTransactions() {
+	now := time.Now()
+	if mp.cfg.Policy.Expiry <= 0 || now.Before(mp.nextTxExpireScan) {
+		return
+	}
+	mp.nextTxExpireScan = now.Add(txExpireScanInterval)
+
+	// Removing the descendants of an expired transaction along with it
+	// also removes them from the map before they are visited.
+	origNumTxns := len(mp.pool)
+	for _, txD := range mp.pool {
+		if mp.isExpired(txD.Added, now) {
+			mp.removeTransaction(txD.Tx, true, RemovalReasonExpiry)
+		}
+	}
+
+	numTxns := len(mp.pool)
+	if numExpired := origNumTxns - numTxns; numExpired > 0 {
+		log.Debugf("Expired %d %s (remaining: %d)", numExpired,
+			pickNoun(numExpired, "transaction", "transactions"),
+			numTxns)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestExpiry ensures transactions which have been in the pool for longer than
+// the expiry are evicted along with their descendants once the pool is scanned,
+// and that they are reported as expired.
+func TestExpiry(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	txPool := harness.txPool
+	txPool.cfg.Policy.Expiry = time.Hour
+
+	independent := ctx.independentOutputs(outputs, 4)
+	spend := func(i uint32) []spendableOutput {
+		return []spendableOutput{independent[i]}
+	}
+
+	parent := ctx.addSignedTx(spend(0), 1, 1000, false, false)
+	child := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(parent, 0),
+	}, 1, 1000, false, false)
+	fresh := ctx.addSignedTx(spend(1), 1, 1000, false, false)
+	sub := txPool.SubscribeTxEvents(10, blockchain.PolicyDropNewest, false)
+	defer sub.Unsubscribe()
+
+	// The parent expires while the scan is not due yet, so it stays in the
+	// pool until the next scan.
+	txPool.mtx.Lock()
+	txPool.pool[*parent.Hash()].Added = time.Now().Add(-time.Hour * 2)
+	txPool.nextTxExpireScan = time.Now().Add(time.Minute)
+	txPool.mtx.Unlock()
+	ctx.addSignedTx(spend(2), 1, 1000, false, false)
+	testPoolMembership(ctx, parent, false, true)
+	<-sub.C
+
+	// Processing a transaction once the scan is due evicts the parent
+	// along with the child.
+	txPool.mtx.Lock()
+	txPool.nextTxExpireScan = time.Now().Add(-time.Second)
+	txPool.mtx.Unlock()
+	ctx.addSignedTx(spend(3), 1, 1000, false, false)
+	testPoolMembership(ctx, parent, false, false)
+	testPoolMembership(ctx, child, false, false)
+	testPoolMembership(ctx, fresh, false, true)
+	for i := 0; i < 2; i++ {
+		event := <-sub.C
+		if event.Type != TxEventRemoved ||
+			event.Reason != RemovalReasonExpiry {
+
+			t.Fatalf("unexpected event %v with reason %v",
+				event.Type, event.Reason)
+		}
+	}
+
+	// Transactions spending an expired transaction become orphans.
+	_, err = txPool.ProcessTransaction(child, true, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid orphan %v",
+			err)
+	}
+	testPoolMembership(ctx, child, true, false)
+}
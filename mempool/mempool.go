@@ -5,9 +5,11 @@
 package mempool
 
 import (
+	"bytes"
 	"container/list"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -30,10 +32,10 @@ const (
 	// inclusion when generating block templates.
 	DefaultBlockPrioritySize = 50000
 
-	// orphanTTL is the maximum amount of time an orphan is allowed to
-	// stay in the orphan pool before it expires and is evicted during the
-	// next scan.
-	orphanTTL = time.Minute * 15
+	// DefaultOrphanTTL is the default maximum amount of time an orphan is
+	// allowed to stay in the orphan pool before it expires and is evicted
+	// during the next scan.
+	DefaultOrphanTTL = time.Minute * 15
 
 	// orphanExpireScanInterval is the minimum amount of time in between
 	// scans of the orphan pool to evict expired transactions.
@@ -48,6 +50,29 @@ const (
 	// can be evicted from the mempool when accepting a transaction
 	// replacement.
 	MaxReplacementEvictions = 100
+
+	// DefaultMaxAncestors is the default maximum number of transactions in
+	// the package formed by a transaction along with its unconfirmed
+	// ancestors in the pool.
+	DefaultMaxAncestors = 25
+
+	// DefaultMaxAncestorVSize is the default maximum total virtual size of
+	// a transaction along with its unconfirmed ancestors in the pool.
+	DefaultMaxAncestorVSize = 101000
+
+	// DefaultMaxDescendants is the default maximum number of transactions
+	// in the package formed by a transaction along with its unconfirmed
+	// descendants in the pool.
+	DefaultMaxDescendants = 25
+
+	// DefaultMaxDescendantVSize is the default maximum total virtual size
+	// of a transaction along with its unconfirmed descendants in the pool.
+	DefaultMaxDescendantVSize = 101000
+
+	// DefaultMaxClusterCount is the default maximum number of transactions
+	// in a cluster, which is a set of unconfirmed transactions in the pool
+	// connected through spends.
+	DefaultMaxClusterCount = 64
 )
 
 // Tag represents an identifier to use for tagging orphan transactions.  The
@@ -100,9 +125,24 @@ type Config struct {
 	// This can be nil if the address index is not enabled.
 	AddrIndex *indexers.AddrIndex
 
+	// OrphanRejected defines an optional function which is invoked with
+	// each orphan transaction which is rejected once its missing parents
+	// are available, along with the tag of the source which provided it
+	// and the reason it was rejected.  This allows the source to be held
+	// accountable for providing invalid transactions.  It is invoked with
+	// the mempool lock held, so it must not call back into the pool.
+	OrphanRejected func(tx *btcutil.Tx, tag Tag, err error)
+
 	// FeeEstimatator provides a feeEstimator. If it is not nil, the mempool
-	// records all new transactions it observes into the feeEstimator.
+	// records all new transactions it observes into the feeEstimator along
+	// with the ones which leave the pool without being mined.
 	FeeEstimator *FeeEstimator
+
+	// TxReplaced defines an optional function which is invoked with each
+	// replacement of transactions in the pool under the Replace-By-Fee
+	// (RBF) policy.  It is invoked with the mempool lock held, so it must
+	// not call back into the pool.
+	TxReplaced func(*TxReplacement)
 }
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -130,10 +170,20 @@ type Policy struct {
 	// that can be queued.
 	MaxOrphanTxs int
 
-	// MaxOrphanTxSize is the maximum size allowed for orphan transactions.
-	// This helps prevent memory exhaustion attacks from sending a lot of
-	// of big orphans.
-	MaxOrphanTxSize int
+	// MaxOrphanTxWeight is the maximum weight allowed for orphan
+	// transactions.  This helps prevent memory exhaustion attacks from
+	// sending a lot of big orphans.
+	MaxOrphanTxWeight int64
+
+	// MaxOrphanWeight is the maximum total weight of the orphan
+	// transactions that can be queued.  The orphans of the source which
+	// provided the most weight are evicted first when it is exceeded.  A
+	// value of zero or less disables the limit.
+	MaxOrphanWeight int64
+
+	// OrphanTTL is the maximum amount of time an orphan transaction is
+	// allowed to stay in the orphan pool before it expires.
+	OrphanTTL time.Duration
 
 	// MaxSigOpCostPerTx is the cumulative maximum cost of all the signature
 	// operations in a single transaction we will relay or mine.  It is a
@@ -144,10 +194,69 @@ type Policy struct {
 	// considered a non-zero fee.
 	MinRelayTxFee btcutil.Amount
 
+	// DustRelayFee defines the fee rate in BTC/kB used to determine
+	// whether transaction outputs are dust, which are outputs that cost
+	// more than a third of their value to spend at that rate.  Zero uses
+	// MinRelayTxFee.
+	DustRelayFee btcutil.Amount
+
+	// MaxStandardTxWeight is the maximum weight of a transaction for it to
+	// be considered standard.  Zero disables the limit.
+	MaxStandardTxWeight int64
+
+	// MaxDataCarrierSize is the maximum size of a null data output script,
+	// which only carries data, for it to be considered standard.  Zero
+	// makes all null data outputs non-standard.
+	MaxDataCarrierSize int
+
+	// RejectBareMultisig defines whether to consider transactions with
+	// bare multi-signature output scripts, as opposed to ones wrapped in
+	// pay-to-script-hash, non-standard.
+	RejectBareMultisig bool
+
 	// RejectReplacement, if true, rejects accepting replacement
 	// transactions using the Replace-By-Fee (RBF) signaling policy into
 	// the mempool.
 	RejectReplacement bool
+
+	// FullReplacement, if true, allows any transaction in the mempool to
+	// be replaced by a conflicting transaction which pays a higher fee
+	// regardless of whether it signals replacement as specified by
+	// BIP-125.  It has no effect when RejectReplacement is set.
+	FullReplacement bool
+
+	// MaxAncestors and MaxAncestorVSize are the maximum number and total
+	// virtual size of the transactions in the package formed by a
+	// transaction along with its unconfirmed ancestors in the pool.  Zero
+	// disables the respective limit.
+	MaxAncestors     int
+	MaxAncestorVSize int64
+
+	// MaxDescendants and MaxDescendantVSize are the maximum number and
+	// total virtual size of the transactions in the package formed by a
+	// transaction along with its unconfirmed descendants in the pool.  Zero
+	// disables the respective limit.
+	MaxDescendants     int
+	MaxDescendantVSize int64
+
+	// MaxClusterCount is the maximum number of transactions in a cluster,
+	// which is a set of unconfirmed transactions in the pool connected
+	// through spends.  The transactions of a cluster are ordered for
+	// mining and eviction together, which takes more time as clusters
+	// grow.  Zero disables the limit.
+	MaxClusterCount int
+
+	// MaxPoolSize is the maximum total serialized size in bytes of the
+	// transactions in the pool.  The transactions with the lowest fee
+	// rates are evicted when it is exceeded, which raises the minimum fee
+	// rate required for transactions to be accepted.  Zero disables the
+	// limit.
+	MaxPoolSize int64
+
+	// Expiry is the maximum amount of time a transaction is allowed to
+	// stay in the pool.  Expired transactions are evicted along with their
+	// descendants.  Zero disables expiration.
+	Expiry time.Duration
 }
 
 // TxDesc is a descriptor containing a transaction in the mempool along with
@@ -158,6 +267,84 @@ type TxDesc struct {
 	// StartingPriority is the priority of the transaction when it was added
 	// to the pool.
 	StartingPriority float64
+
+	// CorrelationID is the identifier supplied by the client which
+	// submitted the transaction, if any.  It is included in the log entries
+	// related to the transaction so its submission can be traced through
+	// all subsystems.
+	CorrelationID string
+
+	// DescendantCount, DescendantVSize, and DescendantFee are the number,
+	// total virtual size, and total modified fee of the transaction along
+	// with all of its unconfirmed descendants in the pool.  Along with the
+	// ancestor statistics of the embedded mining descriptor, they are kept
+	// up to date as transactions are added to and removed from the pool.
+	DescendantCount int
+	DescendantVSize int64
+	DescendantFee   int64
+
+	// ChunkFee and ChunkVSize are the total modified fee and virtual size
+	// of the chunk the transaction is part of in the linearization of its
+	// cluster.  The chunks of all clusters are evicted in order of
+	// increasing fee rate when the pool exceeds its maximum size.
+	ChunkFee   int64
+	ChunkVSize int64
+}
+
+// TxReplacement describes the replacement of transactions in the pool by a
+// transaction which spends some of the same outputs under the Replace-By-Fee
+// (RBF) policy.
+type TxReplacement struct {
+	// Replacement is the transaction which was added to the pool.
+	Replacement *TxDesc
+
+	// Replaced are the transactions which were removed from the pool,
+	// which are the transactions which conflict with the replacement
+	// along with their descendants, ordered by hash.
+	Replaced []*TxDesc
+
+	// FeeDelta is the fee of the replacement minus the total fee of the
+	// replaced transactions in satoshi.
+	FeeDelta int64
+
+	// FeeRateDelta is the fee rate of the replacement minus the combined
+	// fee rate of the replaced transactions in satoshi per kilobyte of
+	// virtual size.
+	FeeRateDelta int64
+}
+
+// newTxReplacement returns the description of the replacement of the passed
+// transactions by the passed transaction.
+func newTxReplacement(replacement *TxDesc, replaced []*TxDesc) *TxReplacement {
+	sort.Slice(replaced, func(i, j int) bool {
+		return bytes.Compare(replaced[i].Tx.Hash()[:],
+			replaced[j].Tx.Hash()[:]) < 0
+	})
+
+	var replacedFee, replacedSize int64
+	for _, txD := range replaced {
+		replacedFee += txD.Fee
+		replacedSize += GetTxVirtualSize(txD.Tx)
+	}
+	r := &TxReplacement{
+		Replacement: replacement,
+		Replaced:    replaced,
+		FeeDelta:    replacement.Fee - replacedFee,
+	}
+	r.FeeRateDelta = replacement.FeePerKB
+	if replacedSize > 0 {
+		r.FeeRateDelta -= replacedFee * 1000 / replacedSize
+	}
+	return r
+}
+
+// correlationSuffix returns a suffix for log entries which identifies the
+// passed correlation id or an empty string when there is none.
+func correlationSuffix(correlationID string) string {
+	if correlationID == "" {
+		return ""
+	}
+	return fmt.Sprintf(" [correlation id %s]", correlationID)
 }
 
 // orphanTx is normal transaction that references an ancestor transaction
@@ -166,9 +353,17 @@ type TxDesc struct {
 type orphanTx struct {
 	tx         *btcutil.Tx
 	tag        Tag
+	weight     int64
 	expiration time.Time
 }
 
+// orphanSource tracks the orphan transactions provided by a single source,
+// identified by the tag they were added with, along with their total weight.
+type orphanSource struct {
+	orphans map[chainhash.Hash]*orphanTx
+	weight  int64
+}
+
 // TxPool is used as a source of transactions that need to be mined into blocks
 // and relayed to other peers.  It is safe for concurrent access from multiple
 // peers.
@@ -181,15 +376,58 @@ type TxPool struct {
 	pool          map[chainhash.Hash]*TxDesc
 	orphans       map[chainhash.Hash]*orphanTx
 	orphansByPrev map[wire.OutPoint]map[chainhash.Hash]*btcutil.Tx
+	orphansByTag  map[Tag]*orphanSource
 	outpoints     map[wire.OutPoint]*btcutil.Tx
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
 
+	// poolSize is the total serialized size of the transactions in the
+	// pool, which is limited by the MaxPoolSize policy.
+	poolSize int64
+
+	// rollingMinFee is the minimum fee rate in satoshi per kilobyte
+	// raised by evicting transactions when the pool is full.  It decays
+	// from the time of the last update once a block above the bump height
+	// has been connected.
+	rollingMinFee        float64
+	lastRollingFeeUpdate time.Time
+	rollingFeeBumpHeight int32
+
+	// orphanWeight is the total weight of the transactions in the orphan
+	// pool, which is limited by the MaxOrphanWeight policy.
+	orphanWeight int64
+
 	// nextExpireScan is the time after which the orphan pool will be
 	// scanned in order to evict orphans.  This is NOT a hard deadline as
 	// the scan will only run when an orphan is added to the pool as opposed
 	// to on an unconditional timer.
 	nextExpireScan time.Time
+
+	// nextTxExpireScan is the time after which the pool will be scanned in
+	// order to evict expired transactions.  Like the scan of the orphan
+	// pool, it only runs when a transaction is processed.
+	nextTxExpireScan time.Time
+
+	// unbroadcast is the set of locally submitted transactions in the pool
+	// which no peer has requested yet.
+	unbroadcast map[chainhash.Hash]struct{}
+
+	// feeDeltas are the amounts the fees of transactions are modified by,
+	// which are set through PrioritiseTransaction.  They are kept for
+	// transactions which are not in the pool as well.
+	feeDeltas map[chainhash.Hash]int64
+
+	// clusters maps the transactions in the pool to the cluster they are
+	// part of, which is shared by all transactions of the cluster.
+	clusters map[chainhash.Hash]*txCluster
+
+	// subscriptions holds the subscriptions to the transaction events of
+	// the pool and eventSeq is the sequence number of the last event.
+	// They are protected by the subscriptions lock, and eventSeq is only
+	// modified with the mempool lock held for writes as well.
+	subscriptionsLock sync.Mutex
+	subscriptions     []*TxEventSubscription
+	eventSeq          uint64
 }
 
 // Ensure the TxPool type implements the mining.TxSource interface.
@@ -232,8 +470,17 @@ func (mp *TxPool) removeOrphan(tx *btcutil.Tx, removeRedeemers bool) {
 		}
 	}
 
-	// Remove the transaction from the orphan pool.
+	// Remove the transaction from the orphan pool and the orphans of its
+	// source.
 	delete(mp.orphans, *txHash)
+	mp.orphanWeight -= otx.weight
+	if source, ok := mp.orphansByTag[otx.tag]; ok {
+		delete(source.orphans, *txHash)
+		source.weight -= otx.weight
+		if len(source.orphans) == 0 {
+			delete(mp.orphansByTag, otx.tag)
+		}
+	}
 }
 
 // RemoveOrphan removes the passed orphan transaction from the orphan pool and
@@ -253,88 +500,125 @@ func (mp *TxPool) RemoveOrphan(tx *btcutil.Tx) {
 func (mp *TxPool) RemoveOrphansByTag(tag Tag) uint64 {
 	var numEvicted uint64
 	mp.mtx.Lock()
-	for _, otx := range mp.orphans {
-		if otx.tag == tag {
+	if source, ok := mp.orphansByTag[tag]; ok {
+		numEvicted = uint64(len(source.orphans))
+		for _, otx := range source.orphans {
 			mp.removeOrphan(otx.tx, true)
-			numEvicted++
 		}
 	}
 	mp.mtx.Unlock()
 	return numEvicted
 }
 
-// limitNumOrphans limits the number of orphan transactions by evicting a random
-// orphan if adding a new one would cause it to overflow the max allowed.
+// expireOrphans removes the orphans which have been in the orphan pool for
+// longer than the orphan TTL.  The scan only happens periodically instead of on
+// every call for efficiency.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) limitNumOrphans() error {
-	// Scan through the orphan pool and remove any expired orphans when it's
-	// time.  This is done for efficiency so the scan only happens
-	// periodically instead of on every orphan added to the pool.
-	if now := time.Now(); now.After(mp.nextExpireScan) {
-		origNumOrphans := len(mp.orphans)
-		for _, otx := range mp.orphans {
-			if now.After(otx.expiration) {
-				// Remove redeemers too because the missing
-				// parents are very unlikely to ever materialize
-				// since the orphan has already been around more
-				// than long enough for them to be delivered.
-				mp.removeOrphan(otx.tx, true)
-			}
-		}
-
-		// Set next expiration scan to occur after the scan interval.
-		mp.nextExpireScan = now.Add(orphanExpireScanInterval)
+func (mp *TxPool) expireOrphans() {
+	now := time.Now()
+	if !now.After(mp.nextExpireScan) {
+		return
+	}
 
-		numOrphans := len(mp.orphans)
-		if numExpired := origNumOrphans - numOrphans; numExpired > 0 {
-			log.Debugf("Expired %d %s (remaining: %d)", numExpired,
-				pickNoun(numExpired, "orphan", "orphans"),
-				numOrphans)
+	origNumOrphans := len(mp.orphans)
+	for _, otx := range mp.orphans {
+		if now.After(otx.expiration) {
+			// Remove redeemers too because the missing parents are
+			// very unlikely to ever materialize since the orphan
+			// has already been around more than long enough for
+			// them to be delivered.
+			mp.removeOrphan(otx.tx, true)
 		}
 	}
 
-	// Nothing to do if adding another orphan will not cause the pool to
-	// exceed the limit.
-	if len(mp.orphans)+1 <= mp.cfg.Policy.MaxOrphanTxs {
-		return nil
+	// Set next expiration scan to occur after the scan interval, or the
+	// TTL when it is shorter.
+	scanInterval := orphanExpireScanInterval
+	if mp.cfg.Policy.OrphanTTL < scanInterval {
+		scanInterval = mp.cfg.Policy.OrphanTTL
 	}
+	mp.nextExpireScan = now.Add(scanInterval)
 
-	// Remove a random entry from the map.  For most compilers, Go's
-	// range statement iterates starting at a random item although
-	// that is not 100% guaranteed by the spec.  The iteration order
-	// is not important here because an adversary would have to be
-	// able to pull off preimage attacks on the hashing function in
-	// order to target eviction of specific entries anyways.
-	for _, otx := range mp.orphans {
-		// Don't remove redeemers in the case of a random eviction since
-		// it is quite possible it might be needed again shortly.
-		mp.removeOrphan(otx.tx, false)
-		break
+	numOrphans := len(mp.orphans)
+	if numExpired := origNumOrphans - numOrphans; numExpired > 0 {
+		log.Debugf("Expired %d %s (remaining: %d)", numExpired,
+			pickNoun(numExpired, "orphan", "orphans"), numOrphans)
 	}
+}
 
-	return nil
+// limitOrphans evicts orphans until an orphan of the passed weight can be
+// added without exceeding the maximum number and total weight of orphans.  The
+// orphans are evicted from the source which provided the most weight, so a
+// single source flooding the orphan pool can't evict the orphans provided by
+// others.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) limitOrphans(weight int64) {
+	maxWeight := mp.cfg.Policy.MaxOrphanWeight
+	for len(mp.orphans) > 0 {
+		if len(mp.orphans)+1 <= mp.cfg.Policy.MaxOrphanTxs &&
+			(maxWeight <= 0 || mp.orphanWeight+weight <= maxWeight) {
+
+			return
+		}
+
+		var largest *orphanSource
+		for _, source := range mp.orphansByTag {
+			if largest == nil || source.weight > largest.weight {
+				largest = source
+			}
+		}
+
+		// Remove a random orphan of the source.  For most compilers,
+		// Go's range statement iterates starting at a random item
+		// although that is not 100% guaranteed by the spec.  The
+		// iteration order is not important here because an adversary
+		// would have to be able to pull off preimage attacks on the
+		// hashing function in order to target eviction of specific
+		// entries anyways.
+		for _, otx := range largest.orphans {
+			// Don't remove redeemers in the case of a random
+			// eviction since it is quite possible it might be
+			// needed again shortly.
+			mp.removeOrphan(otx.tx, false)
+			break
+		}
+	}
 }
 
 // addOrphan adds an orphan transaction to the orphan pool.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) addOrphan(tx *btcutil.Tx, tag Tag) {
+func (mp *TxPool) addOrphan(tx *btcutil.Tx, weight int64, tag Tag) {
 	// Nothing to do if no orphans are allowed.
 	if mp.cfg.Policy.MaxOrphanTxs <= 0 {
 		return
 	}
 
-	// Limit the number orphan transactions to prevent memory exhaustion.
-	// This will periodically remove any expired orphans and evict a random
-	// orphan if space is still needed.
-	mp.limitNumOrphans()
+	// Limit the number and weight of orphan transactions to prevent memory
+	// exhaustion.  This will periodically remove any expired orphans and
+	// evict orphans if space is still needed.
+	mp.expireOrphans()
+	mp.limitOrphans(weight)
 
-	mp.orphans[*tx.Hash()] = &orphanTx{
+	otx := &orphanTx{
 		tx:         tx,
 		tag:        tag,
-		expiration: time.Now().Add(orphanTTL),
+		weight:     weight,
+		expiration: time.Now().Add(mp.cfg.Policy.OrphanTTL),
+	}
+	mp.orphans[*tx.Hash()] = otx
+	mp.orphanWeight += weight
+	source, ok := mp.orphansByTag[tag]
+	if !ok {
+		source = &orphanSource{
+			orphans: make(map[chainhash.Hash]*orphanTx),
+		}
+		mp.orphansByTag[tag] = source
 	}
+	source.orphans[*tx.Hash()] = otx
+	source.weight += weight
 	for _, txIn := range tx.MsgTx().TxIn {
 		if _, exists := mp.orphansByPrev[txIn.PreviousOutPoint]; !exists {
 			mp.orphansByPrev[txIn.PreviousOutPoint] =
@@ -343,8 +627,8 @@ func (mp *TxPool) addOrphan(tx *btcutil.Tx, tag Tag) {
 		mp.orphansByPrev[txIn.PreviousOutPoint][*tx.Hash()] = tx
 	}
 
-	log.Debugf("Stored orphan transaction %v (total: %d)", tx.Hash(),
-		len(mp.orphans))
+	log.Debugf("Stored orphan transaction %v (total: %d, weight: %d)",
+		tx.Hash(), len(mp.orphans), mp.orphanWeight)
 }
 
 // maybeAddOrphan potentially adds an orphan to the orphan pool.
@@ -357,20 +641,18 @@ func (mp *TxPool) maybeAddOrphan(tx *btcutil.Tx, tag Tag) error {
 	// it will ultimtely be rebroadcast after the parent transactions
 	// have been mined or otherwise received.
 	//
-	// Note that the number of orphan transactions in the orphan pool is
-	// also limited, so this equates to a maximum memory used of
-	// mp.cfg.Policy.MaxOrphanTxSize * mp.cfg.Policy.MaxOrphanTxs (which is ~5MB
-	// using the default values at the time this comment was written).
-	serializedLen := tx.MsgTx().SerializeSize()
-	if serializedLen > mp.cfg.Policy.MaxOrphanTxSize {
-		str := fmt.Sprintf("orphan transaction size of %d bytes is "+
-			"larger than max allowed size of %d bytes",
-			serializedLen, mp.cfg.Policy.MaxOrphanTxSize)
+	// Note that the number and total weight of orphan transactions in the
+	// orphan pool are also limited.
+	weight := blockchain.GetTransactionWeight(tx)
+	if weight > mp.cfg.Policy.MaxOrphanTxWeight {
+		str := fmt.Sprintf("orphan transaction weight of %d is larger "+
+			"than max allowed weight of %d", weight,
+			mp.cfg.Policy.MaxOrphanTxWeight)
 		return txRuleError(wire.RejectNonstandard, str)
 	}
 
 	// Add the orphan if the none of the above disqualified it.
-	mp.addOrphan(tx, tag)
+	mp.addOrphan(tx, weight, tag)
 
 	return nil
 }
@@ -466,14 +748,16 @@ func (mp *TxPool) HaveTransaction(hash *chainhash.Hash) bool {
 // RemoveTransaction.  See the comment for RemoveTransaction for more details.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool) {
+func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool,
+	reason RemovalReason) {
+
 	txHash := tx.Hash()
 	if removeRedeemers {
 		// Remove any transactions which rely on this one.
 		for i := uint32(0); i < uint32(len(tx.MsgTx().TxOut)); i++ {
 			prevOut := wire.OutPoint{Hash: *txHash, Index: i}
 			if txRedeemer, exists := mp.outpoints[prevOut]; exists {
-				mp.removeTransaction(txRedeemer, true)
+				mp.removeTransaction(txRedeemer, true, reason)
 			}
 		}
 	}
@@ -486,25 +770,99 @@ func (mp *TxPool) removeTransaction(tx *btcutil.Tx, removeRedeemers bool) {
 			mp.cfg.AddrIndex.RemoveUnconfirmedTx(txHash)
 		}
 
+		// Transactions which were mined are no longer tracked by the
+		// fee estimator at this point, so the remaining ones leave
+		// the pool without being mined.
+		if mp.cfg.FeeEstimator != nil {
+			mp.cfg.FeeEstimator.RemoveTransaction(txHash)
+		}
+
+		// The package statistics of the ancestors and descendants of
+		// the transaction include it, so they are updated once it is
+		// removed.
+		related := mp.txAncestors(tx, nil)
+		for hash, descendant := range mp.txDescendants(tx, nil) {
+			related[hash] = descendant
+		}
+
 		// Mark the referenced outpoints as unspent by the pool.
 		for _, txIn := range txDesc.Tx.MsgTx().TxIn {
 			delete(mp.outpoints, txIn.PreviousOutPoint)
 		}
 		delete(mp.pool, *txHash)
+		delete(mp.unbroadcast, *txHash)
+		mp.poolSize -= int64(tx.MsgTx().SerializeSize())
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+
+		mp.updatePackageStats(related)
+		mp.removeFromCluster(txDesc)
+
+		mp.publishTxEvent(TxEventRemoved, txDesc, reason, nil)
+	}
+}
+
+// setPackageStats computes the ancestor and descendant statistics of the passed
+// pool entry from the transactions currently in the pool.  The caches are
+// passed along to txAncestors and txDescendants respectively.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) setPackageStats(txD *TxDesc, ancestorCache,
+	descendantCache map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx) {
+
+	vsize := GetTxVirtualSize(txD.Tx)
+	txD.AncestorCount = 1
+	txD.AncestorVSize = vsize
+	txD.AncestorFee = txD.ModifiedFee()
+	for hash, ancestor := range mp.txAncestors(txD.Tx, ancestorCache) {
+		txD.AncestorCount++
+		txD.AncestorVSize += GetTxVirtualSize(ancestor)
+		txD.AncestorFee += mp.pool[hash].ModifiedFee()
+	}
+
+	txD.DescendantCount = 1
+	txD.DescendantVSize = vsize
+	txD.DescendantFee = txD.ModifiedFee()
+	for hash, descendant := range mp.txDescendants(txD.Tx, descendantCache) {
+		txD.DescendantCount++
+		txD.DescendantVSize += GetTxVirtualSize(descendant)
+		txD.DescendantFee += mp.pool[hash].ModifiedFee()
+	}
+}
+
+// updatePackageStats recomputes the ancestor and descendant statistics of the
+// passed transactions which are still in the pool.  It is used after removing
+// a transaction from the pool since doing so may also break the dependency
+// between other transactions.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) updatePackageStats(txns map[chainhash.Hash]*btcutil.Tx) {
+	ancestorCache := make(map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx)
+	descendantCache := make(map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx)
+	for hash := range txns {
+		if txD, ok := mp.pool[hash]; ok {
+			mp.setPackageStats(txD, ancestorCache, descendantCache)
+		}
 	}
 }
 
 // RemoveTransaction removes the passed transaction from the mempool. When the
 // removeRedeemers flag is set, any transactions that redeem outputs from the
 // removed transaction will also be removed recursively from the mempool, as
-// they would otherwise become orphans.
+// they would otherwise become orphans.  The passed reason is reported to the
+// subscribers of the transaction events of the pool.  The fee delta of the
+// transaction is cleared when it was included in a block, even when it is not
+// in the pool.
 //
 // This function is safe for concurrent access.
-func (mp *TxPool) RemoveTransaction(tx *btcutil.Tx, removeRedeemers bool) {
+func (mp *TxPool) RemoveTransaction(tx *btcutil.Tx, removeRedeemers bool,
+	reason RemovalReason) {
+
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	mp.removeTransaction(tx, removeRedeemers)
+	if reason == RemovalReasonBlock {
+		delete(mp.feeDeltas, *tx.Hash())
+	}
+	mp.removeTransaction(tx, removeRedeemers, reason)
 	mp.mtx.Unlock()
 }
 
@@ -521,7 +879,8 @@ func (mp *TxPool) RemoveDoubleSpends(tx *btcutil.Tx) {
 	for _, txIn := range tx.MsgTx().TxIn {
 		if txRedeemer, ok := mp.outpoints[txIn.PreviousOutPoint]; ok {
 			if !txRedeemer.Hash().IsEqual(tx.Hash()) {
-				mp.removeTransaction(txRedeemer, true)
+				mp.removeTransaction(txRedeemer, true,
+					RemovalReasonConflict)
 			}
 		}
 	}
@@ -533,7 +892,7 @@ func (mp *TxPool) RemoveDoubleSpends(tx *btcutil.Tx) {
 // helper for maybeAcceptTransaction.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil.Tx, height int32, fee int64) *TxDesc {
+func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil.Tx, height int32, fee int64, correlationID string) *TxDesc {
 	// Add the transaction to the pool and mark the referenced outpoints
 	// as spent by the pool.
 	txD := &TxDesc{
@@ -543,16 +902,32 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 			Height:   height,
 			Fee:      fee,
 			FeePerKB: fee * 1000 / GetTxVirtualSize(tx),
+			FeeDelta: mp.feeDeltas[*tx.Hash()],
 		},
 		StartingPriority: mining.CalcPriority(tx.MsgTx(), utxoView, height),
+		CorrelationID:    correlationID,
 	}
 
 	mp.pool[*tx.Hash()] = txD
+	mp.poolSize += int64(tx.MsgTx().SerializeSize())
 	for _, txIn := range tx.MsgTx().TxIn {
 		mp.outpoints[txIn.PreviousOutPoint] = tx
 	}
 	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 
+	// A new transaction has no descendants in the pool, so its own package
+	// statistics only include its ancestors, which in turn include it in
+	// their descendants.
+	mp.setPackageStats(txD, nil, nil)
+	vsize := txD.DescendantVSize
+	for hash := range mp.txAncestors(tx, nil) {
+		ancestor := mp.pool[hash]
+		ancestor.DescendantCount++
+		ancestor.DescendantVSize += vsize
+		ancestor.DescendantFee += txD.ModifiedFee()
+	}
+	mp.addToCluster(txD)
+
 	// Add unconfirmed address index entries associated with the transaction
 	// if enabled.
 	if mp.cfg.AddrIndex != nil {
@@ -564,14 +939,17 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil
 		mp.cfg.FeeEstimator.ObserveTransaction(txD)
 	}
 
+	mp.publishTxEvent(TxEventAdded, txD, 0, nil)
+
 	return txD
 }
 
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
 // If it does, we'll check whether each of those transactions are signaling for
-// replacement. If just one of them isn't, an error is returned. Otherwise, a
-// boolean is returned signaling that the transaction is a replacement. Note it
+// replacement, unless the full replacement policy is enabled. If just one of
+// them isn't, an error is returned. Otherwise, a boolean is returned signaling
+// that the transaction is a replacement. Note it
 // does not check for double spends against transactions already in the main
 // chain.
 //
@@ -585,9 +963,11 @@ func (mp *TxPool) checkPoolDoubleSpend(tx *btcutil.Tx) (bool, error) {
 		}
 
 		// Reject the transaction if we don't accept replacement
-		// transactions or if it doesn't signal replacement.
+		// transactions or if it doesn't signal replacement and the
+		// full replacement policy is not enabled.
 		if mp.cfg.Policy.RejectReplacement ||
-			!mp.signalsReplacement(conflict, nil) {
+			(!mp.cfg.Policy.FullReplacement &&
+				!mp.signalsReplacement(conflict, nil)) {
 			str := fmt.Sprintf("output %v already spent by "+
 				"transaction %v in the memory pool",
 				txIn.PreviousOutPoint, conflict.Hash())
@@ -776,6 +1156,36 @@ func (mp *TxPool) CheckSpend(op wire.OutPoint) *btcutil.Tx {
 	return txR
 }
 
+// FetchUtxoEntry returns the transaction output referenced by the passed
+// outpoint from the viewpoint of the main chain combined with the transaction
+// pool, along with the transaction in the pool which spends it, if any.
+// Outputs created by transactions in the pool are returned as unconfirmed
+// entries with a block height of mining.UnminedHeight.  A nil entry is returned
+// when the output does not exist or is already spent in the main chain.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FetchUtxoEntry(outpoint wire.OutPoint) (*blockchain.UtxoEntry, *btcutil.Tx, error) {
+	// Protect concurrent access.
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	// Load the output through a transaction which spends it, so the view of
+	// the main chain is adjusted for the pool the same way as the inputs of
+	// transactions which are validated.
+	spendTx := wire.NewMsgTx(wire.TxVersion)
+	spendTx.AddTxIn(wire.NewTxIn(&outpoint, nil, nil))
+	utxoView, err := mp.fetchInputUtxos(btcutil.NewTx(spendTx))
+	if err != nil {
+		return nil, nil, err
+	}
+	entry := utxoView.LookupEntry(outpoint)
+	if entry == nil || entry.IsSpent() {
+		return nil, nil, nil
+	}
+
+	return entry, mp.outpoints[outpoint], nil
+}
+
 // fetchInputUtxos loads utxo details about the input transactions referenced by
 // the passed transaction.  First, it loads the details form the viewpoint of
 // the main chain, then it adjusts them based upon the contents of the
@@ -919,12 +1329,111 @@ func (mp *TxPool) validateReplacement(tx *btcutil.Tx,
 	return conflicts, nil
 }
 
-// maybeAcceptTransaction is the internal function which implements the public
-// MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
-// more details.
+// checkPackageLimits ensures that the package formed by the passed transaction,
+// which has the passed virtual size, along with its unconfirmed ancestors in the
+// pool does not exceed the ancestor limits of the policy, and that adding the
+// transaction to the pool does not make the package formed by any of those
+// ancestors along with their descendants exceed the descendant limits, nor the
+// cluster it joins exceed the cluster limit.  The passed conflicts are replaced
+// by the transaction, so they are not counted as descendants of its ancestors
+// or as part of its cluster.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) checkPackageLimits(tx *btcutil.Tx, vsize int64,
+	conflicts map[chainhash.Hash]*btcutil.Tx) error {
+
+	policy := &mp.cfg.Policy
+	ancestors := mp.txAncestors(tx, nil)
+	ancestorCount := len(ancestors) + 1
+	if policy.MaxAncestors > 0 && ancestorCount > policy.MaxAncestors {
+		str := fmt.Sprintf("transaction %v has too many unconfirmed "+
+			"ancestors: max is %d, has %d", tx.Hash(),
+			policy.MaxAncestors-1, ancestorCount-1)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+	ancestorVSize := vsize
+	for _, ancestor := range ancestors {
+		ancestorVSize += GetTxVirtualSize(ancestor)
+	}
+	if policy.MaxAncestorVSize > 0 && ancestorVSize > policy.MaxAncestorVSize {
+		str := fmt.Sprintf("transaction %v along with its unconfirmed "+
+			"ancestors is too large: max is %d, is %d", tx.Hash(),
+			policy.MaxAncestorVSize, ancestorVSize)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	// Determine how many of the descendants of each ancestor are removed
+	// from the pool along with the conflicts.
+	removedCount := make(map[chainhash.Hash]int)
+	removedVSize := make(map[chainhash.Hash]int64)
+	cache := make(map[chainhash.Hash]map[chainhash.Hash]*btcutil.Tx)
+	for _, conflict := range conflicts {
+		conflictVSize := GetTxVirtualSize(conflict)
+		for hash := range mp.txAncestors(conflict, cache) {
+			removedCount[hash]++
+			removedVSize[hash] += conflictVSize
+		}
+	}
+
+	for hash := range ancestors {
+		ancestor := mp.pool[hash]
+		count := ancestor.DescendantCount - removedCount[hash] + 1
+		if policy.MaxDescendants > 0 && count > policy.MaxDescendants {
+			str := fmt.Sprintf("transaction %v exceeds the "+
+				"descendant limit of unconfirmed ancestor %v: "+
+				"max is %d", tx.Hash(), hash,
+				policy.MaxDescendants-1)
+			return txRuleError(wire.RejectNonstandard, str)
+		}
+		size := ancestor.DescendantVSize - removedVSize[hash] + vsize
+		if policy.MaxDescendantVSize > 0 &&
+			size > policy.MaxDescendantVSize {
+
+			str := fmt.Sprintf("transaction %v exceeds the "+
+				"descendant size limit of unconfirmed ancestor "+
+				"%v: max is %d, would be %d", tx.Hash(), hash,
+				policy.MaxDescendantVSize, size)
+			return txRuleError(wire.RejectNonstandard, str)
+		}
+	}
+
+	clusterCount := mp.clusterCount(tx, conflicts)
+	if policy.MaxClusterCount > 0 && clusterCount > policy.MaxClusterCount {
+		str := fmt.Sprintf("transaction %v would join a cluster of %d "+
+			"unconfirmed transactions: max is %d", tx.Hash(),
+			clusterCount, policy.MaxClusterCount)
+		return txRuleError(wire.RejectNonstandard, str)
+	}
+
+	return nil
+}
+
+// txValidation holds the outcome of validating a transaction for acceptance to
+// the pool which is needed to add it.
+type txValidation struct {
+	// missingParents are the parents of the transaction which are neither
+	// in the main chain nor in the pool.  None of the other fields are set
+	// when there are any.
+	missingParents []*chainhash.Hash
+
+	utxoView  *blockchain.UtxoViewpoint
+	height    int32
+	fee       int64
+	vsize     int64
+	sigOpCost int
+
+	// conflicts are the transactions in the pool, along with their
+	// descendants, which the transaction replaces.
+	conflicts map[chainhash.Hash]*btcutil.Tx
+}
+
+// validateTransaction checks whether the passed transaction can be accepted to
+// the pool without changing the transactions in it.  See the comment for
+// maybeAcceptTransaction for the meaning of the flags.  The transaction is an
+// orphan when the result holds any missing parents.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+func (mp *TxPool) validateTransaction(tx *btcutil.Tx, isNew, rateLimit, rejectDupOrphans, inPackage bool) (*txValidation, error) {
 	txHash := tx.Hash()
 
 	// If a transaction has iwtness data, and segwit isn't active yet, If
@@ -933,13 +1442,13 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	if tx.MsgTx().HasWitness() {
 		segwitActive, err := mp.cfg.IsDeploymentActive(chaincfg.DeploymentSegwit)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
 		if !segwitActive {
 			str := fmt.Sprintf("transaction %v has witness data, "+
 				"but segwit isn't active yet", txHash)
-			return nil, nil, txRuleError(wire.RejectNonstandard, str)
+			return nil, txRuleError(wire.RejectNonstandard, str)
 		}
 	}
 
@@ -951,7 +1460,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 		mp.isOrphanInPool(txHash)) {
 
 		str := fmt.Sprintf("already have transaction %v", txHash)
-		return nil, nil, txRuleError(wire.RejectDuplicate, str)
+		return nil, txRuleError(wire.RejectDuplicate, str)
 	}
 
 	// Perform preliminary sanity checks on the transaction.  This makes
@@ -960,16 +1469,16 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	err := blockchain.CheckTransactionSanity(tx)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
-		return nil, nil, err
+		return nil, err
 	}
 
 	// A standalone transaction must not be a coinbase transaction.
 	if blockchain.IsCoinBase(tx) {
 		str := fmt.Sprintf("transaction %v is an individual coinbase",
 			txHash)
-		return nil, nil, txRuleError(wire.RejectInvalid, str)
+		return nil, txRuleError(wire.RejectInvalid, str)
 	}
 
 	// Get the current height of the main chain.  A standalone transaction
@@ -984,8 +1493,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	// forbid their acceptance.
 	if !mp.cfg.Policy.AcceptNonStd {
 		err = checkTransactionStandard(tx, nextBlockHeight,
-			medianTimePast, mp.cfg.Policy.MinRelayTxFee,
-			mp.cfg.Policy.MaxTxVersion)
+			medianTimePast, &mp.cfg.Policy)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
 			// it can be retained.  When not possible, fall back to
@@ -996,7 +1504,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 			}
 			str := fmt.Sprintf("transaction %v is not standard: %v",
 				txHash, err)
-			return nil, nil, txRuleError(rejectCode, str)
+			return nil, txRuleError(rejectCode, str)
 		}
 	}
 
@@ -1011,7 +1519,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	// spend data and prevents double spends.
 	isReplacement, err := mp.checkPoolDoubleSpend(tx)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Fetch all of the unspent transaction outputs referenced by the inputs
@@ -1021,9 +1529,9 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	utxoView, err := mp.fetchInputUtxos(tx)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Don't allow the transaction if it exists in the main chain and is not
@@ -1033,7 +1541,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 		prevOut.Index = uint32(txOutIdx)
 		entry := utxoView.LookupEntry(prevOut)
 		if entry != nil && !entry.IsSpent() {
-			return nil, nil, txRuleError(wire.RejectDuplicate,
+			return nil, txRuleError(wire.RejectDuplicate,
 				"transaction already exists")
 		}
 		utxoView.RemoveEntry(prevOut)
@@ -1055,7 +1563,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 		}
 	}
 	if len(missingParents) > 0 {
-		return missingParents, nil, nil
+		return &txValidation{missingParents: missingParents}, nil
 	}
 
 	// Don't allow the transaction into the mempool unless its sequence
@@ -1064,13 +1572,13 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	sequenceLock, err := mp.cfg.CalcSequenceLock(tx, utxoView)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
-		return nil, nil, err
+		return nil, err
 	}
 	if !blockchain.SequenceLockActive(sequenceLock, nextBlockHeight,
 		medianTimePast) {
-		return nil, nil, txRuleError(wire.RejectNonstandard,
+		return nil, txRuleError(wire.RejectNonstandard,
 			"transaction's sequence locks on inputs not met")
 	}
 
@@ -1082,9 +1590,9 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 		utxoView, mp.cfg.ChainParams)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Don't allow transactions with non-standard inputs if the network
@@ -1101,7 +1609,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 			}
 			str := fmt.Sprintf("transaction %v has a non-standard "+
 				"input: %v", txHash, err)
-			return nil, nil, txRuleError(rejectCode, str)
+			return nil, txRuleError(rejectCode, str)
 		}
 	}
 
@@ -1118,14 +1626,14 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	sigOpCost, err := blockchain.GetSigOpCost(tx, false, utxoView, true, true)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
-		return nil, nil, err
+		return nil, err
 	}
 	if sigOpCost > mp.cfg.Policy.MaxSigOpCostPerTx {
 		str := fmt.Sprintf("transaction %v sigop cost is too high: %d > %d",
 			txHash, sigOpCost, mp.cfg.Policy.MaxSigOpCostPerTx)
-		return nil, nil, txRuleError(wire.RejectNonstandard, str)
+		return nil, txRuleError(wire.RejectNonstandard, str)
 	}
 
 	// Don't allow transactions with fees too low to get into a mined block.
@@ -1142,31 +1650,53 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	serializedSize := GetTxVirtualSize(tx)
 	minFee := calcMinRequiredTxRelayFee(serializedSize,
 		mp.cfg.Policy.MinRelayTxFee)
-	if serializedSize >= (DefaultBlockPrioritySize-1000) && txFee < minFee {
+	if !inPackage && serializedSize >= (DefaultBlockPrioritySize-1000) &&
+		txFee < minFee {
+
 		str := fmt.Sprintf("transaction %v has %d fees which is under "+
 			"the required amount of %d", txHash, txFee,
 			minFee)
-		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+		return nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
+	// Don't allow transactions with fees below the minimum fee rate of the
+	// pool, which is raised above the minimum relay fee while the pool is
+	// full, regardless of their priority.  The combined fee of packages is
+	// checked instead of the fees of their transactions.
+	if poolMinFeeRate := mp.minFeeRate(); !inPackage &&
+		poolMinFeeRate > mp.cfg.Policy.MinRelayTxFee {
+
+		poolMinFee := calcMinRequiredTxRelayFee(serializedSize,
+			poolMinFeeRate)
+		if txFee < poolMinFee {
+			str := fmt.Sprintf("transaction %v has %d fees which is "+
+				"under the required amount of %d for the "+
+				"mempool minimum fee rate of %v", txHash, txFee,
+				poolMinFee, poolMinFeeRate)
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
 	}
 
 	// Require that free transactions have sufficient priority to be mined
 	// in the next block.  Transactions which are being added back to the
 	// memory pool from blocks that have been disconnected during a reorg
 	// are exempted.
-	if isNew && !mp.cfg.Policy.DisableRelayPriority && txFee < minFee {
+	if isNew && !inPackage && !mp.cfg.Policy.DisableRelayPriority &&
+		txFee < minFee {
+
 		currentPriority := mining.CalcPriority(tx.MsgTx(), utxoView,
 			nextBlockHeight)
 		if currentPriority <= mining.MinHighPriority {
 			str := fmt.Sprintf("transaction %v has insufficient "+
 				"priority (%g <= %g)", txHash,
 				currentPriority, mining.MinHighPriority)
-			return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
 		}
 	}
 
 	// Free-to-relay transactions are rate limited here to prevent
 	// penny-flooding with tiny transactions as a form of attack.
-	if rateLimit && txFee < minFee {
+	if rateLimit && !inPackage && txFee < minFee {
 		nowUnix := time.Now().Unix()
 		// Decay passed data with an exponentially decaying ~10 minute
 		// window - matches bitcoind handling.
@@ -1178,7 +1708,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 		if mp.pennyTotal >= mp.cfg.Policy.FreeTxRelayLimit*10*1000 {
 			str := fmt.Sprintf("transaction %v has been rejected "+
 				"by the rate limiter due to low fees", txHash)
-			return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+			return nil, txRuleError(wire.RejectInsufficientFee, str)
 		}
 		oldTotal := mp.pennyTotal
 
@@ -1194,10 +1724,19 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 	if isReplacement {
 		conflicts, err = mp.validateReplacement(tx, txFee)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 	}
 
+	// Don't allow the transaction into the mempool if it would create a
+	// package of unconfirmed transactions which exceeds the limits of the
+	// policy.  Long chains of unconfirmed transactions are expensive to
+	// track and to mine.
+	err = mp.checkPackageLimits(tx, serializedSize, conflicts)
+	if err != nil {
+		return nil, err
+	}
+
 	// Verify crypto signatures for each input and reject the transaction if
 	// any don't verify.
 	err = blockchain.ValidateTransactionScripts(tx, utxoView,
@@ -1205,29 +1744,92 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 		mp.cfg.HashCache)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
-			return nil, nil, chainRuleError(cerr)
+			return nil, chainRuleError(cerr)
 		}
+		return nil, err
+	}
+
+	return &txValidation{
+		utxoView:  utxoView,
+		height:    bestHeight,
+		fee:       txFee,
+		vsize:     serializedSize,
+		sigOpCost: sigOpCost,
+		conflicts: conflicts,
+	}, nil
+}
+
+// maybeAcceptTransaction is the internal function which implements the public
+// MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
+// more details.  The correlation id is attached to the resulting TxDesc and is
+// empty when the transaction was not submitted with one.  The inPackage flag
+// indicates the transaction is accepted as part of a package whose combined
+// fee rate was already checked, so the fee related checks of the transaction
+// on its own are skipped.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejectDupOrphans, inPackage bool, correlationID string) ([]*chainhash.Hash, *TxDesc, error) {
+	txHash := tx.Hash()
+
+	// Periodically evict the transactions which have been in the pool for
+	// too long before the transaction is checked against the pool, so it
+	// becomes an orphan when it spends any of them.
+	mp.expireTransactions()
+
+	v, err := mp.validateTransaction(tx, isNew, rateLimit,
+		rejectDupOrphans, inPackage)
+	if err != nil {
 		return nil, nil, err
 	}
+	if len(v.missingParents) > 0 {
+		return v.missingParents, nil, nil
+	}
 
 	// Now that we've deemed the transaction as valid, we can add it to the
 	// mempool. If it ended up replacing any transactions, we'll remove them
 	// first.
-	for _, conflict := range conflicts {
+	var replaced []*TxDesc
+	if len(v.conflicts) > 0 {
+		replaced = make([]*TxDesc, 0, len(v.conflicts))
+	}
+	for _, conflict := range v.conflicts {
+		replaced = append(replaced, mp.pool[*conflict.Hash()])
 		log.Debugf("Replacing transaction %v (fee_rate=%v sat/kb) "+
-			"with %v (fee_rate=%v sat/kb)\n", conflict.Hash(),
+			"with %v%s (fee_rate=%v sat/kb)\n", conflict.Hash(),
 			mp.pool[*conflict.Hash()].FeePerKB, tx.Hash(),
-			txFee*1000/serializedSize)
+			correlationSuffix(correlationID), v.fee*1000/v.vsize)
 
 		// The conflict set should already include the descendants for
 		// each one, so we don't need to remove the redeemers within
 		// this call as they'll be removed eventually.
-		mp.removeTransaction(conflict, false)
+		mp.removeTransaction(conflict, false, RemovalReasonReplaced)
+	}
+	txD := mp.addTransaction(v.utxoView, tx, v.height, v.fee,
+		correlationID)
+
+	// Evict the transactions with the lowest fee rates when the pool now
+	// exceeds its maximum size, which might include the transaction itself.
+	// Packages are trimmed once all of their transactions were added so
+	// parents are not evicted before the children paying for them.
+	if !inPackage {
+		mp.trimToSize()
+		if !mp.isTransactionInPool(txHash) {
+			str := fmt.Sprintf("transaction %v was evicted since the "+
+				"mempool is full", txHash)
+			return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+		}
 	}
-	txD := mp.addTransaction(utxoView, tx, bestHeight, txFee)
 
-	log.Debugf("Accepted transaction %v (pool size: %v)", txHash,
-		len(mp.pool))
+	log.Debugf("Accepted transaction %v%s (pool size: %v)", txHash,
+		correlationSuffix(correlationID), len(mp.pool))
+
+	if len(replaced) > 0 {
+		r := newTxReplacement(txD, replaced)
+		mp.publishTxEvent(TxEventReplaced, nil, 0, r)
+		if mp.cfg.TxReplaced != nil {
+			mp.cfg.TxReplaced(r)
+		}
+	}
 
 	return nil, txD, nil
 }
@@ -1246,12 +1848,26 @@ func (mp *TxPool) maybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit, rejec
 func (mp *TxPool) MaybeAcceptTransaction(tx *btcutil.Tx, isNew, rateLimit bool) ([]*chainhash.Hash, *TxDesc, error) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true)
+	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true,
+		false, "")
 	mp.mtx.Unlock()
 
 	return hashes, txD, err
 }
 
+// spendsOrphan returns whether the passed transaction spends an output of a
+// transaction in the orphan pool.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) spendsOrphan(tx *btcutil.Tx) bool {
+	for _, txIn := range tx.MsgTx().TxIn {
+		if _, ok := mp.orphans[txIn.PreviousOutPoint.Hash]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 // processOrphans is the internal function which implements the public
 // ProcessOrphans.  See the comment for ProcessOrphans for more details.
 //
@@ -1288,15 +1904,30 @@ func (mp *TxPool) processOrphans(acceptedTx *btcutil.Tx) []*TxDesc {
 
 			// Potentially accept an orphan into the tx pool.
 			for _, tx := range orphans {
+				// Orphans which still spend other orphans
+				// can't be accepted yet, so they are skipped
+				// without validating them.  They are processed
+				// again once their parents are accepted.
+				if mp.spendsOrphan(tx) {
+					continue
+				}
+
 				missing, txD, err := mp.maybeAcceptTransaction(
-					tx, true, true, false)
+					tx, true, true, false, false, "")
 				if err != nil {
 					// The orphan is now invalid, so there
 					// is no way any other orphans which
 					// redeem any of its outputs can be
-					// accepted.  Remove them.
+					// accepted.  Remove them and report
+					// the source of the orphan.  Other
+					// orphans which redeem this output
+					// may still be valid.
+					otx := mp.orphans[*tx.Hash()]
 					mp.removeOrphan(tx, true)
-					break
+					if otx != nil && mp.cfg.OrphanRejected != nil {
+						mp.cfg.OrphanRejected(tx, otx.tag, err)
+					}
+					continue
 				}
 
 				// Transaction is still an orphan.  Try the next
@@ -1365,7 +1996,19 @@ func (mp *TxPool) ProcessOrphans(acceptedTx *btcutil.Tx) []*TxDesc {
 //
 // This function is safe for concurrent access.
 func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
-	log.Tracef("Processing transaction %v", tx.Hash())
+	return mp.ProcessCorrelatedTransaction(tx, allowOrphan, rateLimit, tag, "")
+}
+
+// ProcessCorrelatedTransaction is the same as ProcessTransaction except it
+// also associates the passed correlation id, which is typically supplied by an
+// RPC client, with the transaction.  The id is included in the log entries
+// related to the transaction and carried in its TxDesc so other subsystems
+// can do the same.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ProcessCorrelatedTransaction(tx *btcutil.Tx, allowOrphan, rateLimit bool, tag Tag, correlationID string) ([]*TxDesc, error) {
+	log.Tracef("Processing transaction %v%s", tx.Hash(),
+		correlationSuffix(correlationID))
 
 	// Protect concurrent access.
 	mp.mtx.Lock()
@@ -1373,8 +2016,12 @@ func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, allowOrphan, rateLimit bool
 
 	// Potentially accept the transaction to the memory pool.
 	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, rateLimit,
-		true)
+		true, false, correlationID)
 	if err != nil {
+		if correlationID != "" {
+			log.Debugf("Rejected transaction %v%s: %v", tx.Hash(),
+				correlationSuffix(correlationID), err)
+		}
 		return nil, err
 	}
 
@@ -1417,6 +2064,29 @@ func (mp *TxPool) ProcessTransaction(tx *btcutil.Tx, allowOrphan, rateLimit bool
 	return nil, err
 }
 
+// Policy returns the policy the pool currently applies to transactions.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Policy() Policy {
+	mp.mtx.RLock()
+	policy := mp.cfg.Policy
+	mp.mtx.RUnlock()
+
+	return policy
+}
+
+// SetPolicy replaces the policy the pool applies to transactions, which allows
+// it to be adjusted without restarting.  The new policy only applies to
+// transactions processed from then on, so transactions which are already in
+// the pool are neither checked against it nor evicted.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) SetPolicy(policy Policy) {
+	mp.mtx.Lock()
+	mp.cfg.Policy = policy
+	mp.mtx.Unlock()
+}
+
 // Count returns the number of transactions in the main pool.  It does not
 // include the orphan pool.
 //
@@ -1474,7 +2144,10 @@ func (mp *TxPool) MiningDescs() []*mining.TxDesc {
 	descs := make([]*mining.TxDesc, len(mp.pool))
 	i := 0
 	for _, desc := range mp.pool {
-		descs[i] = &desc.TxDesc
+		// The package statistics change as transactions are added to
+		// and removed from the pool, so copy the descriptor.
+		miningDesc := desc.TxDesc
+		descs[i] = &miningDesc
 		i++
 	}
 	mp.mtx.RUnlock()
@@ -1511,11 +2184,19 @@ func (mp *TxPool) RawMempoolVerbose() map[string]*btcjson.GetRawMempoolVerboseRe
 			Vsize:            int32(GetTxVirtualSize(tx)),
 			Weight:           int32(blockchain.GetTransactionWeight(tx)),
 			Fee:              btcutil.Amount(desc.Fee).ToBTC(),
+			ModifiedFee:      btcutil.Amount(desc.ModifiedFee()).ToBTC(),
 			Time:             desc.Added.Unix(),
 			Height:           int64(desc.Height),
 			StartingPriority: desc.StartingPriority,
 			CurrentPriority:  currentPriority,
+			DescendantCount:  int64(desc.DescendantCount),
+			DescendantSize:   desc.DescendantVSize,
+			DescendantFees:   btcutil.Amount(desc.DescendantFee).ToBTC(),
+			AncestorCount:    int64(desc.AncestorCount),
+			AncestorSize:     desc.AncestorVSize,
+			AncestorFees:     btcutil.Amount(desc.AncestorFee).ToBTC(),
 			Depends:          make([]string, 0),
+			CorrelationID:    desc.CorrelationID,
 		}
 		for _, txIn := range tx.MsgTx().TxIn {
 			hash := &txIn.PreviousOutPoint.Hash
@@ -1547,7 +2228,11 @@ func New(cfg *Config) *TxPool {
 		pool:           make(map[chainhash.Hash]*TxDesc),
 		orphans:        make(map[chainhash.Hash]*orphanTx),
 		orphansByPrev:  make(map[wire.OutPoint]map[chainhash.Hash]*btcutil.Tx),
+		orphansByTag:   make(map[Tag]*orphanSource),
 		nextExpireScan: time.Now().Add(orphanExpireScanInterval),
 		outpoints:      make(map[wire.OutPoint]*btcutil.Tx),
+		unbroadcast:    make(map[chainhash.Hash]struct{}),
+		feeDeltas:      make(map[chainhash.Hash]int64),
+		clusters:       make(map[chainhash.Hash]*txCluster),
 	}
 }
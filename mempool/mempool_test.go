@@ -16,6 +16,7 @@ import (
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -320,9 +321,12 @@ func newPoolHarness(chainParams *chaincfg.Params) (*poolHarness, []spendableOutp
 				DisableRelayPriority: true,
 				FreeTxRelayLimit:     15.0,
 				MaxOrphanTxs:         5,
-				MaxOrphanTxSize:      1000,
+				MaxOrphanTxWeight:    4000,
+				OrphanTTL:            DefaultOrphanTTL,
 				MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
 				MinRelayTxFee:        1000, // 1 Satoshi per byte
+				MaxStandardTxWeight:  DefaultMaxStandardTxWeight,
+				MaxDataCarrierSize:   DefaultMaxDataCarrierSize,
 				MaxTxVersion:         1,
 			},
 			ChainParams:      chainParams,
@@ -421,6 +425,22 @@ func (ctx *testContext) addSignedTx(inputs []spendableOutput,
 	return tx
 }
 
+// independentOutputs adds a confirmed transaction that spends the inputs to
+// the test context's mock chain and returns its given number of outputs, which
+// allows creating transactions that don't depend on each other.
+func (ctx *testContext) independentOutputs(inputs []spendableOutput,
+	numOutputs uint32) []spendableOutput {
+
+	ctx.t.Helper()
+
+	tx := ctx.addSignedTx(inputs, numOutputs, 1000, false, true)
+	outputs := make([]spendableOutput, 0, numOutputs)
+	for i := uint32(0); i < numOutputs; i++ {
+		outputs = append(outputs, txOutToSpendableOut(tx, i))
+	}
+	return outputs
+}
+
 // testPoolMembership tests the transaction pool associated with the provided
 // test context to determine if the passed transaction matches the provided
 // orphan pool and transaction pool status.  It also further determines if it
@@ -560,7 +580,7 @@ func TestOrphanReject(t *testing.T) {
 
 		// Ensure no transactions were reported as accepted.
 		if len(acceptedTxns) != 0 {
-			t.Fatal("ProcessTransaction: reported %d accepted "+
+			t.Fatalf("ProcessTransaction: reported %d accepted "+
 				"transactions from failed orphan attempt",
 				len(acceptedTxns))
 		}
@@ -931,6 +951,85 @@ func TestCheckSpend(t *testing.T) {
 	}
 }
 
+// TestFetchUtxoEntry ensures outputs are fetched from the combined view of the
+// main chain and the transaction pool.
+func TestFetchUtxoEntry(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+
+	// Outputs of the main chain are confirmed and unspent while the pool is
+	// empty.
+	op := outputs[0].outPoint
+	entry, spend, err := harness.txPool.FetchUtxoEntry(op)
+	if err != nil {
+		t.Fatalf("FetchUtxoEntry: %v", err)
+	}
+	if entry == nil || entry.BlockHeight() == mining.UnminedHeight ||
+		spend != nil {
+
+		t.Fatalf("unexpected chain output %v spent by %v", entry, spend)
+	}
+
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	for _, tx := range chainedTxns {
+		_, err := harness.txPool.ProcessTransaction(tx, true, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept tx: %v",
+				err)
+		}
+	}
+
+	// The output of the main chain is now spent by the first transaction.
+	entry, spend, err = harness.txPool.FetchUtxoEntry(op)
+	if err != nil {
+		t.Fatalf("FetchUtxoEntry: %v", err)
+	}
+	if entry == nil || spend != chainedTxns[0] {
+		t.Fatalf("expected %v to be spent by %v, instead got %v", op,
+			chainedTxns[0], spend)
+	}
+
+	// The outputs created by the pool are unconfirmed and the last one is
+	// unspent.
+	for i, tx := range chainedTxns {
+		op := wire.OutPoint{Hash: *tx.Hash(), Index: 0}
+		entry, spend, err := harness.txPool.FetchUtxoEntry(op)
+		if err != nil {
+			t.Fatalf("FetchUtxoEntry: %v", err)
+		}
+		if entry == nil || entry.BlockHeight() != mining.UnminedHeight {
+			t.Fatalf("output %v is not unconfirmed", op)
+		}
+		if entry.Amount() != tx.MsgTx().TxOut[0].Value {
+			t.Fatalf("output %v has amount %v, want %v", op,
+				entry.Amount(), tx.MsgTx().TxOut[0].Value)
+		}
+		wantSpend := (*btcutil.Tx)(nil)
+		if i < len(chainedTxns)-1 {
+			wantSpend = chainedTxns[i+1]
+		}
+		if spend != wantSpend {
+			t.Fatalf("expected %v to be spent by %v, instead got "+
+				"%v", op, wantSpend, spend)
+		}
+	}
+
+	// Unknown outputs do not exist.
+	op = wire.OutPoint{Hash: chainhash.Hash{0x01}}
+	entry, spend, err = harness.txPool.FetchUtxoEntry(op)
+	if err != nil || entry != nil || spend != nil {
+		t.Fatalf("unexpected unknown output %v spent by %v: %v", entry,
+			spend, err)
+	}
+}
+
 // TestSignalsReplacement tests that transactions properly signal they can be
 // replaced using RBF.
 func TestSignalsReplacement(t *testing.T) {
@@ -1110,6 +1209,36 @@ func TestCheckPoolDoubleSpend(t *testing.T) {
 			},
 			isReplacement: false,
 		},
+		{
+			// Transactions that double spend inputs of
+			// transactions which don't signal replacement are
+			// valid if the mempool's policy allows full
+			// replacement.
+			name: "full replacement policy",
+			setup: func(ctx *testContext) *btcutil.Tx {
+				ctx.harness.txPool.cfg.Policy.FullReplacement = true
+
+				coinbase := ctx.addCoinbaseTx(1)
+				coinbaseOut := txOutToSpendableOut(coinbase, 0)
+				outs := []spendableOutput{coinbaseOut}
+				ctx.addSignedTx(outs, 1, 0, false, false)
+
+				// Create another transaction that spends the
+				// same coinbase output. Although the original
+				// spender doesn't signal replacement, it
+				// should be detected as a replacement.
+				tx, err := ctx.harness.CreateSignedTx(
+					outs, 2, 0, false,
+				)
+				if err != nil {
+					ctx.t.Fatalf("unable to create "+
+						"transaction: %v", err)
+				}
+
+				return tx
+			},
+			isReplacement: true,
+		},
 		{
 			// Transactions that double spend inputs and signal
 			// replacement are invalid if the mempool's policy
@@ -1452,6 +1581,134 @@ func TestAncestorsDescendants(t *testing.T) {
 	}
 }
 
+// TestPackageLimits ensures the mempool keeps the ancestor and descendant
+// statistics of its transactions up to date as transactions are added and
+// removed, and that it rejects transactions which exceed the ancestor and
+// descendant limits of its policy.
+func TestPackageLimits(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// We'll be creating the same chain of unconfirmed transactions as in
+	// TestAncestorsDescendants, where each transaction pays the same fee:
+	//
+	//       B ----
+	//     /        \
+	//   A            E
+	//     \        /
+	//       C -- D
+	const fee = 1000
+	a := ctx.addSignedTx(outputs[:1], 2, fee, false, false)
+	b := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(a, 0)}, 1, fee, false,
+		false,
+	)
+	c := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(a, 1)}, 1, fee, false,
+		false,
+	)
+	d := ctx.addSignedTx(
+		[]spendableOutput{txOutToSpendableOut(c, 0)}, 1, fee, false,
+		false,
+	)
+	e := ctx.addSignedTx(
+		[]spendableOutput{
+			txOutToSpendableOut(b, 0), txOutToSpendableOut(d, 0),
+		}, 1, fee, false, false,
+	)
+
+	// assertStats ensures the package statistics of the passed transaction
+	// count the expected number of ancestors and descendants including
+	// itself.
+	assertStats := func(tx *btcutil.Tx, numAncestors, numDescendants int) {
+		t.Helper()
+
+		txD := harness.txPool.pool[*tx.Hash()]
+		if txD.AncestorCount != numAncestors ||
+			txD.AncestorFee != int64(numAncestors*fee) {
+
+			t.Fatalf("transaction %v: got %d ancestors with fee "+
+				"%d, want %d", tx.Hash(), txD.AncestorCount,
+				txD.AncestorFee, numAncestors)
+		}
+		if txD.DescendantCount != numDescendants ||
+			txD.DescendantFee != int64(numDescendants*fee) {
+
+			t.Fatalf("transaction %v: got %d descendants with fee "+
+				"%d, want %d", tx.Hash(), txD.DescendantCount,
+				txD.DescendantFee, numDescendants)
+		}
+	}
+	assertStats(a, 1, 5)
+	assertStats(b, 2, 2)
+	assertStats(c, 2, 3)
+	assertStats(d, 3, 2)
+	assertStats(e, 5, 1)
+
+	// The total size of the whole graph is tracked as the descendants of A
+	// and the ancestors of E.
+	var totalVSize int64
+	for _, tx := range []*btcutil.Tx{a, b, c, d, e} {
+		totalVSize += GetTxVirtualSize(tx)
+	}
+	if vsize := harness.txPool.pool[*a.Hash()].DescendantVSize; vsize != totalVSize {
+		t.Fatalf("got descendant size %d, want %d", vsize, totalVSize)
+	}
+	if vsize := harness.txPool.pool[*e.Hash()].AncestorVSize; vsize != totalVSize {
+		t.Fatalf("got ancestor size %d, want %d", vsize, totalVSize)
+	}
+
+	// Removing E removes it from the descendants of all other transactions.
+	harness.txPool.RemoveTransaction(e, false, RemovalReasonBlock)
+	assertStats(a, 1, 4)
+	assertStats(b, 2, 1)
+	assertStats(c, 2, 2)
+	assertStats(d, 3, 1)
+
+	// Removing A without its descendants, as happens when it is mined,
+	// removes it from the ancestors of all other transactions.
+	harness.txPool.RemoveTransaction(a, false, RemovalReasonBlock)
+	assertStats(b, 1, 1)
+	assertStats(c, 1, 2)
+	assertStats(d, 2, 1)
+
+	// A child of D would have three ancestors including itself, which
+	// exceeds a limit of two.
+	child, err := harness.CreateSignedTx(
+		[]spendableOutput{txOutToSpendableOut(d, 0)}, 1, fee, false,
+	)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	harness.txPool.cfg.Policy.MaxAncestors = 2
+	_, err = harness.txPool.ProcessTransaction(child, false, false, 0)
+	if err == nil || !strings.Contains(err.Error(), "too many unconfirmed") {
+		t.Fatalf("expected ancestor limit error, got %v", err)
+	}
+	harness.txPool.cfg.Policy.MaxAncestors = 0
+
+	// It would also give C three descendants including itself.
+	harness.txPool.cfg.Policy.MaxDescendants = 2
+	_, err = harness.txPool.ProcessTransaction(child, false, false, 0)
+	if err == nil || !strings.Contains(err.Error(), "descendant limit") {
+		t.Fatalf("expected descendant limit error, got %v", err)
+	}
+
+	// The child is accepted once the limits allow it.
+	harness.txPool.cfg.Policy.MaxDescendants = 3
+	_, err = harness.txPool.ProcessTransaction(child, false, false, 0)
+	if err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+	assertStats(c, 1, 3)
+	assertStats(child, 3, 1)
+}
+
 // TestRBF tests the different cases required for a transaction to properly
 // replace its conflicts given that they all signal replacement.
 func TestRBF(t *testing.T) {
@@ -1772,6 +2029,12 @@ func TestRBF(t *testing.T) {
 			ctx := &testContext{t, harness}
 			replacementTx, replacedTxs := testCase.setup(ctx)
 
+			// Record the replacements reported by the pool.
+			var replacements []*TxReplacement
+			harness.txPool.cfg.TxReplaced = func(r *TxReplacement) {
+				replacements = append(replacements, r)
+			}
+
 			// Attempt to process the replacement transaction. If
 			// it's not a valid one, we should see the error
 			// expected by the test.
@@ -1804,9 +2067,154 @@ func TestRBF(t *testing.T) {
 				testPoolMembership(ctx, tx, false, !valid)
 			}
 			testPoolMembership(ctx, replacementTx, false, valid)
+
+			// Valid replacements must be reported along with the
+			// transactions they replaced and the fee deltas.
+			if !valid || len(replacedTxs) == 0 {
+				if len(replacements) != 0 {
+					ctx.t.Fatalf("unexpected replacement "+
+						"reported: %v", replacements)
+				}
+				return
+			}
+			if len(replacements) != 1 {
+				ctx.t.Fatalf("got %d replacements reported, "+
+					"want 1", len(replacements))
+			}
+			r := replacements[0]
+			if r.Replacement.Tx.Hash() != replacementTx.Hash() {
+				ctx.t.Fatalf("unexpected replacement %v",
+					r.Replacement.Tx.Hash())
+			}
+			if len(r.Replaced) != len(replacedTxs) {
+				ctx.t.Fatalf("got %d replaced transactions, "+
+					"want %d", len(r.Replaced),
+					len(replacedTxs))
+			}
+			var replacedFee, replacedSize int64
+			for _, txD := range r.Replaced {
+				replacedFee += txD.Fee
+				replacedSize += GetTxVirtualSize(txD.Tx)
+			}
+			if r.FeeDelta != r.Replacement.Fee-replacedFee {
+				ctx.t.Fatalf("got fee delta %d, want %d",
+					r.FeeDelta, r.Replacement.Fee-replacedFee)
+			}
+			wantRateDelta := r.Replacement.FeePerKB -
+				replacedFee*1000/replacedSize
+			if r.FeeRateDelta != wantRateDelta {
+				ctx.t.Fatalf("got fee rate delta %d, want %d",
+					r.FeeRateDelta, wantRateDelta)
+			}
 		})
 		if !success {
 			break
 		}
 	}
 }
+
+// TestProcessCorrelatedTransaction ensures the correlation id a transaction is
+// submitted with is attached to its descriptor and reported by the verbose raw
+// mempool, while transactions accepted as a result of it do not inherit it.
+func TestProcessCorrelatedTransaction(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+
+	// Create a chain of two transactions and submit the child first so it
+	// becomes an orphan which is accepted along with its parent.
+	chainedTxns, err := harness.CreateTxChain(spendableOuts[0], 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(chainedTxns[1], true, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid orphan %v",
+			err)
+	}
+
+	const correlationID = "order-1234"
+	acceptedTxns, err := harness.txPool.ProcessCorrelatedTransaction(
+		chainedTxns[0], false, false, 0, correlationID)
+	if err != nil {
+		t.Fatalf("ProcessCorrelatedTransaction: failed to accept valid "+
+			"transaction %v", err)
+	}
+	if len(acceptedTxns) != 2 {
+		t.Fatalf("ProcessCorrelatedTransaction: reported %d accepted "+
+			"transactions, want 2", len(acceptedTxns))
+	}
+	if acceptedTxns[0].CorrelationID != correlationID {
+		t.Fatalf("unexpected correlation id of submitted transaction "+
+			"- got %q, want %q", acceptedTxns[0].CorrelationID,
+			correlationID)
+	}
+	if acceptedTxns[1].CorrelationID != "" {
+		t.Fatalf("unexpected correlation id of orphan transaction "+
+			"- got %q, want none", acceptedTxns[1].CorrelationID)
+	}
+
+	verbose := harness.txPool.RawMempoolVerbose()
+	result, ok := verbose[chainedTxns[0].Hash().String()]
+	if !ok {
+		t.Fatal("RawMempoolVerbose: submitted transaction not found")
+	}
+	if result.CorrelationID != correlationID {
+		t.Fatalf("RawMempoolVerbose: unexpected correlation id - got "+
+			"%q, want %q", result.CorrelationID, correlationID)
+	}
+}
+
+// TestSetPolicy ensures the policy of the pool can be adjusted while it is
+// running and that only transactions processed from then on are subject to it.
+func TestSetPolicy(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	txPool := harness.txPool
+
+	parent := ctx.addSignedTx(outputs, 1, 1000, false, false)
+
+	// Lowering the max standard weight below the weight of the child makes
+	// it non-standard while the parent stays in the pool.
+	child, err := harness.CreateSignedTx([]spendableOutput{
+		txOutToSpendableOut(parent, 0),
+	}, 1, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	policy := txPool.Policy()
+	policy.MaxStandardTxWeight = blockchain.GetTransactionWeight(child) - 1
+	txPool.SetPolicy(policy)
+	if txPool.Policy().MaxStandardTxWeight != policy.MaxStandardTxWeight {
+		t.Fatalf("policy not updated - got max standard weight %d, "+
+			"want %d", txPool.Policy().MaxStandardTxWeight,
+			policy.MaxStandardTxWeight)
+	}
+
+	_, err = txPool.ProcessTransaction(child, false, false, 0)
+	if code, _ := extractRejectCode(err); code != wire.RejectNonstandard {
+		t.Fatalf("ProcessTransaction: unexpected result for "+
+			"non-standard transaction - got %v, want reject code %v",
+			err, wire.RejectNonstandard)
+	}
+	testPoolMembership(ctx, parent, false, true)
+	testPoolMembership(ctx, child, false, false)
+
+	// The child is accepted once the limit is raised again.
+	policy.MaxStandardTxWeight = DefaultMaxStandardTxWeight
+	txPool.SetPolicy(policy)
+	_, err = txPool.ProcessTransaction(child, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid "+
+			"transaction %v", err)
+	}
+	testPoolMembership(ctx, child, false, true)
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestOrphanWeightLimit ensures orphans which exceed the maximum weight of a
+// single orphan are rejected and that exceeding the maximum total weight of the
+// orphan pool evicts orphans of the source which provided the most weight.
+func TestOrphanWeightLimit(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	txPool := harness.txPool
+
+	independent := tc.independentOutputs(outputs, 2)
+
+	// Orphans heavier than the maximum orphan transaction weight are
+	// rejected.
+	missing := spendableOutput{
+		outPoint: wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		amount:   btcutil.Amount(100000000),
+	}
+	heavy, err := harness.CreateSignedTx(
+		[]spendableOutput{missing}, 100, 1000, false,
+	)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = txPool.ProcessTransaction(heavy, true, false, 1)
+	if err == nil || !strings.Contains(err.Error(), "max allowed weight") {
+		t.Fatalf("expected heavy orphan to be rejected, got %v", err)
+	}
+	testPoolMembership(tc, heavy, false, false)
+
+	// Create an orphan for one source and a chain of orphans for another,
+	// and limit the total weight of the orphan pool so only three of them
+	// fit at once.
+	single, err := harness.CreateTxChain(independent[0], 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	flood, err := harness.CreateTxChain(independent[1], 6)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	var maxWeight int64
+	for _, tx := range append(single[1:], flood[1:]...) {
+		if weight := blockchain.GetTransactionWeight(tx); weight > maxWeight {
+			maxWeight = weight
+		}
+	}
+	txPool.cfg.Policy.MaxOrphanTxs = 100
+	txPool.cfg.Policy.MaxOrphanWeight = maxWeight*3 + maxWeight/2
+
+	_, err = txPool.ProcessTransaction(single[1], true, false, 1)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid orphan %v",
+			err)
+	}
+	for _, tx := range flood[1:] {
+		_, err := txPool.ProcessTransaction(tx, true, false, 2)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"orphan %v", err)
+		}
+		testPoolMembership(tc, tx, true, false)
+	}
+
+	// Only the orphans of the flooding source are evicted.
+	testPoolMembership(tc, single[1], true, false)
+	if len(txPool.orphans) != 3 {
+		t.Fatalf("orphan pool has %d orphans, want 3",
+			len(txPool.orphans))
+	}
+	if txPool.orphanWeight > txPool.cfg.Policy.MaxOrphanWeight {
+		t.Fatalf("orphan weight %d exceeds the maximum of %d",
+			txPool.orphanWeight, txPool.cfg.Policy.MaxOrphanWeight)
+	}
+	if weight := txPool.orphansByTag[1].weight; weight !=
+		blockchain.GetTransactionWeight(single[1]) {
+
+		t.Fatalf("unexpected weight %d of source 1", weight)
+	}
+
+	// Removing the orphans of a source also releases their weight.
+	if n := txPool.RemoveOrphansByTag(2); n != 2 {
+		t.Fatalf("RemoveOrphansByTag: removed %d orphans, want 2", n)
+	}
+	if _, ok := txPool.orphansByTag[2]; ok {
+		t.Fatal("RemoveOrphansByTag: source is still tracked")
+	}
+	if txPool.orphanWeight != blockchain.GetTransactionWeight(single[1]) {
+		t.Fatalf("unexpected orphan weight %d after removing source",
+			txPool.orphanWeight)
+	}
+}
+
+// TestOrphanExpiry ensures orphans which stayed in the orphan pool for longer
+// than the orphan TTL are evicted along with the orphans which redeem them.
+func TestOrphanExpiry(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	txPool := harness.txPool
+
+	independent := tc.independentOutputs(outputs, 2)
+
+	expiring, err := harness.CreateTxChain(independent[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	fresh, err := harness.CreateTxChain(independent[1], 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+
+	// Add a chain of orphans and make its first orphan expire.
+	for _, tx := range expiring[1:] {
+		_, err := txPool.ProcessTransaction(tx, true, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"orphan %v", err)
+		}
+	}
+	txPool.mtx.Lock()
+	txPool.orphans[*expiring[1].Hash()].expiration = time.Now().Add(-time.Second)
+	txPool.nextExpireScan = time.Now().Add(-time.Second)
+	txPool.mtx.Unlock()
+
+	// Adding another orphan scans the orphan pool and evicts the expired
+	// orphan along with the orphan which redeems it.
+	_, err = txPool.ProcessTransaction(fresh[1], true, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid orphan %v",
+			err)
+	}
+	for _, tx := range expiring[1:] {
+		testPoolMembership(tc, tx, false, false)
+	}
+	testPoolMembership(tc, fresh[1], true, false)
+
+	// The next scan happens no later than the orphan TTL.
+	txPool.mtx.RLock()
+	nextScan := txPool.nextExpireScan
+	txPool.mtx.RUnlock()
+	if nextScan.After(time.Now().Add(orphanExpireScanInterval)) {
+		t.Fatalf("next expiration scan is scheduled at %v", nextScan)
+	}
+}
+
+// TestOrphanRejected ensures orphans which turn out to be invalid once their
+// parents are accepted are reported along with the source which provided them,
+// while the valid orphans spending the same parent are promoted to the pool
+// along with the entire chain of orphans spending them.
+func TestOrphanRejected(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	txPool := harness.txPool
+
+	type rejection struct {
+		tx  *btcutil.Tx
+		tag Tag
+	}
+	var rejected []rejection
+	txPool.cfg.OrphanRejected = func(tx *btcutil.Tx, tag Tag, err error) {
+		rejected = append(rejected, rejection{tx, tag})
+	}
+
+	parent, err := harness.CreateSignedTx(outputs[:1], 2, 1000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+
+	// The invalid orphan claims its input is worth more than it is, which
+	// can't be detected until the parent is known.
+	inflated := txOutToSpendableOut(parent, 0)
+	inflated.amount *= 2
+	invalid := tc.createSignedTx(inflated, 1000)
+	invalidChild := tc.createSignedTx(txOutToSpendableOut(invalid, 0), 1000)
+
+	child := tc.createSignedTx(txOutToSpendableOut(parent, 1), 1000)
+	grandchild := tc.createSignedTx(txOutToSpendableOut(child, 0), 1000)
+
+	// Add the orphans with the descendants first, so the chain can only
+	// be promoted once all of its ancestors are accepted.
+	orphans := []struct {
+		tx  *btcutil.Tx
+		tag Tag
+	}{
+		{invalidChild, 1},
+		{invalid, 1},
+		{grandchild, 2},
+		{child, 2},
+	}
+	for _, orphan := range orphans {
+		_, err := txPool.ProcessTransaction(orphan.tx, true, false,
+			orphan.tag)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"orphan %v", err)
+		}
+		testPoolMembership(tc, orphan.tx, true, false)
+	}
+
+	acceptedTxns, err := txPool.ProcessTransaction(parent, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid "+
+			"transaction %v", err)
+	}
+	if len(acceptedTxns) != 3 {
+		t.Fatalf("ProcessTransaction: accepted %d transactions, want 3",
+			len(acceptedTxns))
+	}
+	for _, tx := range []*btcutil.Tx{parent, child, grandchild} {
+		testPoolMembership(tc, tx, false, true)
+	}
+	for _, tx := range []*btcutil.Tx{invalid, invalidChild} {
+		testPoolMembership(tc, tx, false, false)
+	}
+
+	// Only the invalid orphan is reported, along with its source.
+	if len(rejected) != 1 {
+		t.Fatalf("reported %d rejected orphans, want 1", len(rejected))
+	}
+	if *rejected[0].tx.Hash() != *invalid.Hash() || rejected[0].tag != 1 {
+		t.Fatalf("reported rejected orphan %v from source %d, want %v "+
+			"from source 1", rejected[0].tx.Hash(), rejected[0].tag,
+			invalid.Hash())
+	}
+	if len(txPool.orphans) != 0 || len(txPool.orphansByTag) != 0 {
+		t.Fatalf("orphan pool still has %d orphans",
+			len(txPool.orphans))
+	}
+}
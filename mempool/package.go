@@ -0,0 +1,259 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// MaxPackageCount is the maximum number of transactions in a package
+	// accepted by ProcessPackage.
+	MaxPackageCount = 25
+
+	// MaxPackageVSize is the maximum total virtual size of the
+	// transactions in a package accepted by ProcessPackage.
+	MaxPackageVSize = 101000
+)
+
+// checkPackageSanity performs preliminary checks on the passed package which do
+// not depend on the contents of the pool or the main chain.  The package must
+// consist of a child transaction along with its unconfirmed parents, which are
+// ordered such that every transaction comes after the transactions it spends,
+// and must not exceed the maximum number or size of a package.
+func checkPackageSanity(txns []*btcutil.Tx) error {
+	if len(txns) == 0 {
+		return txRuleError(wire.RejectInvalid, "package is empty")
+	}
+	if len(txns) > MaxPackageCount {
+		str := fmt.Sprintf("package has too many transactions: max is "+
+			"%d, has %d", MaxPackageCount, len(txns))
+		return txRuleError(wire.RejectInvalid, str)
+	}
+
+	var totalVSize int64
+	index := make(map[chainhash.Hash]int, len(txns))
+	for i, tx := range txns {
+		if _, ok := index[*tx.Hash()]; ok {
+			str := fmt.Sprintf("package contains transaction %v "+
+				"more than once", tx.Hash())
+			return txRuleError(wire.RejectInvalid, str)
+		}
+		index[*tx.Hash()] = i
+		totalVSize += GetTxVirtualSize(tx)
+	}
+	if totalVSize > MaxPackageVSize {
+		str := fmt.Sprintf("package is too large: max is %d, is %d",
+			MaxPackageVSize, totalVSize)
+		return txRuleError(wire.RejectInvalid, str)
+	}
+
+	// The transactions must not spend the same outputs and must come after
+	// the transactions of the package they spend.
+	spent := make(map[wire.OutPoint]struct{})
+	for i, tx := range txns {
+		for _, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			if _, ok := spent[prevOut]; ok {
+				str := fmt.Sprintf("output %v is spent by more "+
+					"than one transaction of the package",
+					prevOut)
+				return txRuleError(wire.RejectInvalid, str)
+			}
+			spent[prevOut] = struct{}{}
+
+			if parent, ok := index[prevOut.Hash]; ok && parent > i {
+				str := fmt.Sprintf("transaction %v of the "+
+					"package comes before its parent %v",
+					tx.Hash(), prevOut.Hash)
+				return txRuleError(wire.RejectInvalid, str)
+			}
+		}
+	}
+
+	// Every transaction other than the last one must be a parent of it.
+	child := txns[len(txns)-1]
+	parents := make(map[chainhash.Hash]struct{})
+	for _, txIn := range child.MsgTx().TxIn {
+		parents[txIn.PreviousOutPoint.Hash] = struct{}{}
+	}
+	for _, tx := range txns[:len(txns)-1] {
+		if _, ok := parents[*tx.Hash()]; !ok {
+			str := fmt.Sprintf("transaction %v of the package is not "+
+				"a parent of its child %v", tx.Hash(),
+				child.Hash())
+			return txRuleError(wire.RejectInvalid, str)
+		}
+	}
+
+	return nil
+}
+
+// packageFee returns the total fee and virtual size of the passed transactions,
+// which are ordered such that every transaction comes after the ones it spends.
+// An error is returned when an input is not available from the main chain, the
+// pool, or an earlier transaction.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) packageFee(txns []*btcutil.Tx) (int64, int64, error) {
+	var fee, vsize int64
+	outputs := make(map[wire.OutPoint]int64)
+	for _, tx := range txns {
+		utxoView, err := mp.fetchInputUtxos(tx)
+		if err != nil {
+			if cerr, ok := err.(blockchain.RuleError); ok {
+				return 0, 0, chainRuleError(cerr)
+			}
+			return 0, 0, err
+		}
+
+		for _, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			if amount, ok := outputs[prevOut]; ok {
+				fee += amount
+				continue
+			}
+			entry := utxoView.LookupEntry(prevOut)
+			if entry == nil || entry.IsSpent() {
+				// NOTE: RejectDuplicate is used for the same
+				// reason as for orphan transactions.
+				str := fmt.Sprintf("transaction %v of the "+
+					"package references outputs of unknown "+
+					"or fully-spent transaction %v",
+					tx.Hash(), prevOut.Hash)
+				return 0, 0, txRuleError(wire.RejectDuplicate, str)
+			}
+			fee += entry.Amount()
+		}
+
+		prevOut := wire.OutPoint{Hash: *tx.Hash()}
+		for i, txOut := range tx.MsgTx().TxOut {
+			prevOut.Index = uint32(i)
+			outputs[prevOut] = txOut.Value
+			fee -= txOut.Value
+		}
+		vsize += GetTxVirtualSize(tx)
+	}
+
+	return fee, vsize, nil
+}
+
+// ProcessPackage validates the passed package of transactions and accepts
+// either all of its transactions which are not in the memory pool yet or none
+// of them.  The package must consist of a child transaction along with its
+// unconfirmed parents, ordered such that every transaction comes after the
+// transactions it spends, which is the form packages are relayed in.
+//
+// Unlike with ProcessTransaction, the transactions of the package are not
+// required to pay the minimum relay fee on their own.  Instead, the combined
+// fee rate of those which are not in the pool yet must meet it, or the minimum
+// fee rate of the pool when it is full, which allows a child to pay for a
+// parent whose fee is too low for it to be accepted on its own.  Packages which
+// spend outputs already spent by transactions in the pool are rejected since
+// packages can't replace transactions.
+//
+// It returns a slice of transactions added to the mempool, which are the
+// transactions of the package in order followed by any orphan transactions
+// which were added as a result.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ProcessPackage(txns []*btcutil.Tx) ([]*TxDesc, error) {
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	if err := checkPackageSanity(txns); err != nil {
+		return nil, err
+	}
+
+	// Only the transactions which are not in the pool yet are validated
+	// and pay for the package.
+	newTxns := make([]*btcutil.Tx, 0, len(txns))
+	for _, tx := range txns {
+		if !mp.isTransactionInPool(tx.Hash()) {
+			newTxns = append(newTxns, tx)
+		}
+	}
+	if len(newTxns) == 0 {
+		return nil, nil
+	}
+
+	for _, tx := range newTxns {
+		for _, txIn := range tx.MsgTx().TxIn {
+			conflict, ok := mp.outpoints[txIn.PreviousOutPoint]
+			if !ok {
+				continue
+			}
+			str := fmt.Sprintf("output %v already spent by "+
+				"transaction %v in the memory pool",
+				txIn.PreviousOutPoint, conflict.Hash())
+			return nil, txRuleError(wire.RejectDuplicate, str)
+		}
+	}
+
+	fee, vsize, err := mp.packageFee(newTxns)
+	if err != nil {
+		return nil, err
+	}
+	minFee := calcMinRequiredTxRelayFee(vsize, mp.minFeeRate())
+	if fee < minFee {
+		str := fmt.Sprintf("package has %d fees which is under the "+
+			"required amount of %d", fee, minFee)
+		return nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
+	// Accept the transactions in order so each of them can spend the ones
+	// before it.  The transactions which were already accepted are removed
+	// again when a later one is rejected.
+	acceptedTxns := make([]*TxDesc, 0, len(newTxns))
+	for _, tx := range newTxns {
+		missingParents, txD, err := mp.maybeAcceptTransaction(tx, true,
+			false, true, true, "")
+		if err == nil && len(missingParents) > 0 {
+			str := fmt.Sprintf("transaction %v of the package "+
+				"references outputs of unknown or fully-spent "+
+				"transaction %v", tx.Hash(), missingParents[0])
+			err = txRuleError(wire.RejectDuplicate, str)
+		}
+		if err != nil {
+			for i := len(acceptedTxns) - 1; i >= 0; i-- {
+				mp.removeTransaction(acceptedTxns[i].Tx, true,
+					RemovalReasonRejected)
+			}
+			return nil, err
+		}
+		acceptedTxns = append(acceptedTxns, txD)
+	}
+
+	// Evict the transactions with the lowest fee rates when the pool now
+	// exceeds its maximum size.  The package is removed again when this
+	// evicts its child, which pays for the rest of it.
+	mp.trimToSize()
+	if !mp.isTransactionInPool(txns[len(txns)-1].Hash()) {
+		for i := len(acceptedTxns) - 1; i >= 0; i-- {
+			mp.removeTransaction(acceptedTxns[i].Tx, true,
+				RemovalReasonSizeLimit)
+		}
+		str := fmt.Sprintf("package with child %v was evicted since the "+
+			"mempool is full", txns[len(txns)-1].Hash())
+		return nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
+	log.Debugf("Accepted package of %d transactions with child %v",
+		len(newTxns), txns[len(txns)-1].Hash())
+
+	// Accept any orphan transactions that depend on the transactions of
+	// the package.
+	for _, tx := range newTxns {
+		acceptedTxns = append(acceptedTxns, mp.processOrphans(tx)...)
+	}
+
+	return acceptedTxns, nil
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestProcessPackage ensures packages of a child along with its parents are
+// validated and accepted atomically, with the child paying for parents which
+// could not be accepted on their own.
+func TestProcessPackage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+
+		// setup returns the package to process given a transaction in
+		// the pool with two outputs the package can spend.
+		setup func(ctx *testContext, grandparent *btcutil.Tx) []*btcutil.Tx
+
+		// err is the expected error or empty when the package is
+		// expected to be accepted.
+		err string
+	}{
+		{
+			// A child with a high fee pays for a parent without any
+			// fee, which is rejected on its own due to its low
+			// priority.
+			name: "child pays for parent",
+			setup: func(ctx *testContext, grandparent *btcutil.Tx) []*btcutil.Tx {
+				parent := ctx.createSignedTx(
+					txOutToSpendableOut(grandparent, 0), 0,
+				)
+				_, err := ctx.harness.txPool.ProcessTransaction(
+					parent, false, false, 0,
+				)
+				if err == nil || !strings.Contains(
+					err.Error(), "insufficient priority") {
+
+					ctx.t.Fatalf("expected the parent to be "+
+						"rejected, got %v", err)
+				}
+				child := ctx.createSignedTx(
+					txOutToSpendableOut(parent, 0), 10000,
+				)
+				return []*btcutil.Tx{parent, child}
+			},
+		},
+		{
+			name: "insufficient package fee",
+			setup: func(ctx *testContext, grandparent *btcutil.Tx) []*btcutil.Tx {
+				parent := ctx.createSignedTx(
+					txOutToSpendableOut(grandparent, 0), 0,
+				)
+				child := ctx.createSignedTx(
+					txOutToSpendableOut(parent, 0), 100,
+				)
+				return []*btcutil.Tx{parent, child}
+			},
+			err: "under the required amount",
+		},
+		{
+			name: "child before parent",
+			setup: func(ctx *testContext, grandparent *btcutil.Tx) []*btcutil.Tx {
+				parent := ctx.createSignedTx(
+					txOutToSpendableOut(grandparent, 0), 0,
+				)
+				child := ctx.createSignedTx(
+					txOutToSpendableOut(parent, 0), 10000,
+				)
+				return []*btcutil.Tx{child, parent}
+			},
+			err: "comes before its parent",
+		},
+		{
+			name: "unrelated transaction",
+			setup: func(ctx *testContext, grandparent *btcutil.Tx) []*btcutil.Tx {
+				parent := ctx.createSignedTx(
+					txOutToSpendableOut(grandparent, 0), 0,
+				)
+				unrelated := ctx.createSignedTx(
+					txOutToSpendableOut(grandparent, 1), 1000,
+				)
+				child := ctx.createSignedTx(
+					txOutToSpendableOut(parent, 0), 10000,
+				)
+				return []*btcutil.Tx{parent, unrelated, child}
+			},
+			err: "is not a parent of its child",
+		},
+		{
+			// Packages can't replace transactions in the pool.
+			name: "conflict with pool",
+			setup: func(ctx *testContext, grandparent *btcutil.Tx) []*btcutil.Tx {
+				out := txOutToSpendableOut(grandparent, 0)
+				ctx.addSignedTx(
+					[]spendableOutput{out}, 1, 1000, true,
+					false,
+				)
+				parent := ctx.createSignedTx(out, 0)
+				child := ctx.createSignedTx(
+					txOutToSpendableOut(parent, 0), 10000,
+				)
+				return []*btcutil.Tx{parent, child}
+			},
+			err: "already spent by transaction",
+		},
+		{
+			// The parent is removed again when the child is
+			// rejected after the parent was accepted.
+			name: "invalid child",
+			setup: func(ctx *testContext, grandparent *btcutil.Tx) []*btcutil.Tx {
+				parent := ctx.createSignedTx(
+					txOutToSpendableOut(grandparent, 0), 0,
+				)
+				child := ctx.createSignedTx(
+					txOutToSpendableOut(parent, 0), 10000,
+				)
+				child.MsgTx().Version = 2
+				return []*btcutil.Tx{parent, btcutil.NewTx(child.MsgTx())}
+			},
+			err: "not standard",
+		},
+	}
+
+	for _, test := range tests {
+		success := t.Run(test.name, func(t *testing.T) {
+			harness, outputs, err := newPoolHarness(
+				&chaincfg.MainNetParams,
+			)
+			if err != nil {
+				t.Fatalf("unable to create test pool: %v", err)
+			}
+
+			// Enable relay priority so transactions spending
+			// unconfirmed outputs without a fee are rejected on
+			// their own.
+			harness.txPool.cfg.Policy.DisableRelayPriority = false
+
+			ctx := &testContext{t, harness}
+			grandparent := ctx.addSignedTx(outputs, 2, 1000, false,
+				false)
+			txns := test.setup(ctx, grandparent)
+
+			accepted, err := harness.txPool.ProcessPackage(txns)
+			if test.err != "" {
+				if err == nil || !strings.Contains(
+					err.Error(), test.err) {
+
+					t.Fatalf("expected error %q, got %v",
+						test.err, err)
+				}
+				for _, tx := range txns {
+					testPoolMembership(ctx, tx, false, false)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to process package: %v", err)
+			}
+			if len(accepted) != len(txns) {
+				t.Fatalf("expected %d accepted transactions, "+
+					"got %d", len(txns), len(accepted))
+			}
+			for i, tx := range txns {
+				if *accepted[i].Tx.Hash() != *tx.Hash() {
+					t.Fatalf("accepted transaction %d is %v, "+
+						"want %v", i, accepted[i].Tx.Hash(),
+						tx.Hash())
+				}
+				testPoolMembership(ctx, tx, false, true)
+			}
+
+			// Processing the package again doesn't accept anything
+			// since all of its transactions are in the pool.
+			accepted, err = harness.txPool.ProcessPackage(txns)
+			if err != nil || len(accepted) != 0 {
+				t.Fatalf("expected nothing to be accepted again, "+
+					"got %d transactions, err %v",
+					len(accepted), err)
+			}
+		})
+		if !success {
+			break
+		}
+	}
+}
+
+// createSignedTx creates a transaction with one output which spends the passed
+// output with the passed fee without adding it to the pool.
+func (ctx *testContext) createSignedTx(out spendableOutput,
+	fee btcutil.Amount) *btcutil.Tx {
+
+	ctx.t.Helper()
+
+	tx, err := ctx.harness.CreateSignedTx(
+		[]spendableOutput{out}, 1, fee, false,
+	)
+	if err != nil {
+		ctx.t.Fatalf("unable to create transaction: %v", err)
+	}
+	return tx
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// PackageRelation describes how a transaction in a package graph is related
+// to the transaction the graph was requested for.
+type PackageRelation int
+
+const (
+	// PackageSelf is the transaction the graph was requested for.
+	PackageSelf PackageRelation = iota
+
+	// PackageAncestor is an unconfirmed transaction the transaction the
+	// graph was requested for depends on.
+	PackageAncestor
+
+	// PackageDescendant is an unconfirmed transaction which depends on the
+	// transaction the graph was requested for.
+	PackageDescendant
+)
+
+// packageRelationStrings is a map of package relations back to their names
+// for pretty printing.
+var packageRelationStrings = map[PackageRelation]string{
+	PackageSelf:       "self",
+	PackageAncestor:   "ancestor",
+	PackageDescendant: "descendant",
+}
+
+// String returns the PackageRelation in human-readable form.
+func (r PackageRelation) String() string {
+	if s, ok := packageRelationStrings[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown PackageRelation (%d)", int(r))
+}
+
+// PackageNode is a transaction in a package graph.
+type PackageNode struct {
+	*TxDesc
+
+	// Relation describes how the transaction is related to the transaction
+	// the graph was requested for.
+	Relation PackageRelation
+
+	// VSize is the virtual size of the transaction.
+	VSize int64
+}
+
+// PackageEdge is an output of a transaction in a package graph which is spent
+// by another transaction in the graph.
+type PackageEdge struct {
+	Parent chainhash.Hash
+	Vout   uint32
+	Child  chainhash.Hash
+	Vin    uint32
+}
+
+// PackageGraph is the dependency graph of the package formed by a transaction
+// in the pool along with all of its unconfirmed ancestors and descendants.
+type PackageGraph struct {
+	// Nodes are the transactions of the package ordered such that every
+	// transaction comes after all of the transactions it depends on.
+	Nodes []*PackageNode
+
+	// Edges are the spends between the transactions of the package ordered
+	// by child and input.
+	Edges []PackageEdge
+}
+
+// PackageGraph returns the dependency graph of the package formed by the
+// transaction with the passed hash along with all of its unconfirmed ancestors
+// and descendants in the pool.  An error is returned when the transaction is
+// not in the main pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) PackageGraph(hash *chainhash.Hash) (*PackageGraph, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, ok := mp.pool[*hash]
+	if !ok {
+		return nil, fmt.Errorf("transaction %v is not in the pool", hash)
+	}
+
+	members := map[chainhash.Hash]PackageRelation{*hash: PackageSelf}
+	for ancestorHash := range mp.txAncestors(desc.Tx, nil) {
+		members[ancestorHash] = PackageAncestor
+	}
+	for descendantHash := range mp.txDescendants(desc.Tx, nil) {
+		members[descendantHash] = PackageDescendant
+	}
+
+	// The number of ancestors tracked by the pool is used to order the
+	// members since a transaction always has more ancestors than any of the
+	// transactions it depends on.
+	graph := &PackageGraph{
+		Nodes: make([]*PackageNode, 0, len(members)),
+	}
+	for memberHash, relation := range members {
+		// The package statistics of the descriptor change as
+		// transactions are added to and removed from the pool, so it is
+		// copied.
+		memberDesc := *mp.pool[memberHash]
+		node := &PackageNode{
+			TxDesc:   &memberDesc,
+			Relation: relation,
+			VSize:    GetTxVirtualSize(memberDesc.Tx),
+		}
+		graph.Nodes = append(graph.Nodes, node)
+
+		for i, txIn := range memberDesc.Tx.MsgTx().TxIn {
+			prevOut := &txIn.PreviousOutPoint
+			if _, ok := members[prevOut.Hash]; !ok {
+				continue
+			}
+			graph.Edges = append(graph.Edges, PackageEdge{
+				Parent: prevOut.Hash,
+				Vout:   prevOut.Index,
+				Child:  memberHash,
+				Vin:    uint32(i),
+			})
+		}
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		a, b := graph.Nodes[i], graph.Nodes[j]
+		if a.AncestorCount != b.AncestorCount {
+			return a.AncestorCount < b.AncestorCount
+		}
+		return bytes.Compare(a.Tx.Hash()[:], b.Tx.Hash()[:]) < 0
+	})
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		a, b := &graph.Edges[i], &graph.Edges[j]
+		if a.Child != b.Child {
+			return bytes.Compare(a.Child[:], b.Child[:]) < 0
+		}
+		return a.Vin < b.Vin
+	})
+
+	return graph, nil
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestPackageGraph ensures the package graph of a transaction contains all of
+// its ancestors and descendants along with the spends between them.
+func TestPackageGraph(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+
+	// Create the following chain of unconfirmed transactions where B, C,
+	// and F spend A, D spends C, and E spends B and D.
+	//
+	//       B ----
+	//     /        \
+	//   A -- F       E
+	//     \        /
+	//       C -- D
+	a := ctx.addSignedTx(outputs[:1], 3, 1000, false, false)
+	b := ctx.addSignedTx([]spendableOutput{txOutToSpendableOut(a, 0)}, 1,
+		500, false, false)
+	c := ctx.addSignedTx([]spendableOutput{txOutToSpendableOut(a, 1)}, 1,
+		2000, false, false)
+	d := ctx.addSignedTx([]spendableOutput{txOutToSpendableOut(c, 0)}, 1,
+		3000, false, false)
+	e := ctx.addSignedTx([]spendableOutput{txOutToSpendableOut(b, 0),
+		txOutToSpendableOut(d, 0)}, 1, 4000, false, false)
+	ctx.addSignedTx([]spendableOutput{txOutToSpendableOut(a, 2)}, 1,
+		1000, false, false)
+
+	graph, err := harness.txPool.PackageGraph(c.Hash())
+	if err != nil {
+		t.Fatalf("PackageGraph: unexpected error: %v", err)
+	}
+
+	// B and F are neither ancestors nor descendants of C, so they are not
+	// part of the package, but the fee of B still counts towards the
+	// ancestor fee of E.
+	wantNodes := []struct {
+		hash        *chainhash.Hash
+		relation    PackageRelation
+		ancestorFee int64
+	}{
+		{a.Hash(), PackageAncestor, 1000},
+		{c.Hash(), PackageSelf, 3000},
+		{d.Hash(), PackageDescendant, 6000},
+		{e.Hash(), PackageDescendant, 10500},
+	}
+	if len(graph.Nodes) != len(wantNodes) {
+		t.Fatalf("got %d nodes, want %d", len(graph.Nodes),
+			len(wantNodes))
+	}
+	for i, want := range wantNodes {
+		node := graph.Nodes[i]
+		if *node.Tx.Hash() != *want.hash {
+			t.Fatalf("node %d: got %v, want %v", i, node.Tx.Hash(),
+				want.hash)
+		}
+		if node.Relation != want.relation {
+			t.Fatalf("node %d: got relation %v, want %v", i,
+				node.Relation, want.relation)
+		}
+		if node.AncestorFee != want.ancestorFee {
+			t.Fatalf("node %d: got ancestor fee %d, want %d", i,
+				node.AncestorFee, want.ancestorFee)
+		}
+		if node.VSize != GetTxVirtualSize(node.Tx) {
+			t.Fatalf("node %d: wrong vsize %d", i, node.VSize)
+		}
+	}
+
+	wantEdges := map[PackageEdge]struct{}{
+		{Parent: *a.Hash(), Vout: 1, Child: *c.Hash(), Vin: 0}: {},
+		{Parent: *c.Hash(), Vout: 0, Child: *d.Hash(), Vin: 0}: {},
+		{Parent: *d.Hash(), Vout: 0, Child: *e.Hash(), Vin: 1}: {},
+	}
+	if len(graph.Edges) != len(wantEdges) {
+		t.Fatalf("got %d edges, want %d", len(graph.Edges),
+			len(wantEdges))
+	}
+	for _, edge := range graph.Edges {
+		if _, ok := wantEdges[edge]; !ok {
+			t.Fatalf("unexpected edge %+v", edge)
+		}
+	}
+
+	if _, err := harness.txPool.PackageGraph(&chainhash.Hash{}); err == nil {
+		t.Fatal("PackageGraph: unknown transaction was not rejected")
+	}
+}
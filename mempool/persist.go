@@ -0,0 +1,259 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// dumpVersion is the version of the serialized memory pool written by Dump.
+// Version 3 added the fee deltas.
+const dumpVersion = 3
+
+// errInterruptRequested indicates that loading the memory pool was cancelled
+// due to a user-requested interrupt.
+var errInterruptRequested = errors.New("interrupt requested")
+
+// interruptRequested returns true when the provided channel has been closed.
+// This simplifies early shutdown slightly since the caller can just use an if
+// statement instead of a select.
+func interruptRequested(interrupted <-chan struct{}) bool {
+	select {
+	case <-interrupted:
+		return true
+	default:
+	}
+
+	return false
+}
+
+// IsInterruptRequested returns whether the passed error returned by Load
+// indicates that loading was cancelled by closing the interrupt channel.
+func IsInterruptRequested(err error) bool {
+	return err == errInterruptRequested
+}
+
+// Dump serializes the transactions in the memory pool along with the times they
+// were added to it, the set of locally submitted transactions which no peer has
+// requested yet, and the fee deltas of transactions to the passed writer, so
+// they can be restored by Load, for example across restarts.  Orphan
+// transactions are not included.  Every transaction is written after the
+// transactions in the pool it spends.  It returns the number of transactions
+// written.
+//
+// The serialized format is:
+//
+//	<version><num txns>[<tx><time added>]...<num unbroadcast>[<hash>]...
+//	<num fee deltas>[<hash><fee delta>]...
+//
+//	Field            Type    Size
+//	version          uint32  4 bytes
+//	num txns         VarInt  variable
+//	tx               MsgTx   variable (including witness data)
+//	time added       int64   8 bytes (unix time in seconds)
+//	num unbroadcast  VarInt  variable
+//	hash             Hash    32 bytes
+//	num fee deltas   VarInt  variable
+//	hash             Hash    32 bytes
+//	fee delta        int64   8 bytes (satoshi)
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Dump(w io.Writer) (int, error) {
+	// Copy the fields of the descriptors which are written, since they
+	// are modified under the lock.
+	mp.mtx.RLock()
+	descs := make([]mining.TxDesc, 0, len(mp.pool))
+	for _, desc := range mp.pool {
+		descs = append(descs, desc.TxDesc)
+	}
+	unbroadcast := make([]chainhash.Hash, 0, len(mp.unbroadcast))
+	for hash := range mp.unbroadcast {
+		unbroadcast = append(unbroadcast, hash)
+	}
+	feeDeltas := make(map[chainhash.Hash]int64, len(mp.feeDeltas))
+	for hash, feeDelta := range mp.feeDeltas {
+		feeDeltas[hash] = feeDelta
+	}
+	mp.mtx.RUnlock()
+
+	// A transaction always has more unconfirmed ancestors than any of the
+	// transactions it spends.
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].AncestorCount < descs[j].AncestorCount
+	})
+
+	var buf [8]byte
+	binary.LittleEndian.PutUint32(buf[:4], dumpVersion)
+	if _, err := w.Write(buf[:4]); err != nil {
+		return 0, err
+	}
+	err := wire.WriteVarInt(w, 0, uint64(len(descs)))
+	if err != nil {
+		return 0, err
+	}
+	for _, desc := range descs {
+		if err := desc.Tx.MsgTx().Serialize(w); err != nil {
+			return 0, err
+		}
+		binary.LittleEndian.PutUint64(buf[:], uint64(desc.Added.Unix()))
+		if _, err := w.Write(buf[:]); err != nil {
+			return 0, err
+		}
+	}
+
+	err = wire.WriteVarInt(w, 0, uint64(len(unbroadcast)))
+	if err != nil {
+		return 0, err
+	}
+	for i := range unbroadcast {
+		if _, err := w.Write(unbroadcast[i][:]); err != nil {
+			return 0, err
+		}
+	}
+
+	err = wire.WriteVarInt(w, 0, uint64(len(feeDeltas)))
+	if err != nil {
+		return 0, err
+	}
+	for hash, feeDelta := range feeDeltas {
+		if _, err := w.Write(hash[:]); err != nil {
+			return 0, err
+		}
+		binary.LittleEndian.PutUint64(buf[:], uint64(feeDelta))
+		if _, err := w.Write(buf[:]); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(descs), nil
+}
+
+// Load reads transactions serialized by Dump from the passed reader and adds
+// them to the memory pool, keeping the times they were originally added.  The
+// transactions are fully validated against the current main chain and policy,
+// so the ones which were mined or double spent in the mean time, which expired,
+// or which violate the policy are not added.  The set of locally submitted
+// transactions which no peer has requested yet is restored for the added
+// transactions, and so are the fee deltas.  Dumps of version 2, which don't
+// include fee deltas, are loaded as well.  It returns the number of
+// transactions which were added and which were not.
+//
+// Loading can be cancelled by closing the passed interrupt channel, in which
+// case an error for which IsInterruptRequested returns true is returned.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Load(r io.Reader, interrupt <-chan struct{}) (int, int, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
+		return 0, 0, err
+	}
+	version := binary.LittleEndian.Uint32(buf[:4])
+	if version != dumpVersion && version != 2 {
+		return 0, 0, fmt.Errorf("unsupported mempool dump version %d",
+			version)
+	}
+	numTxns, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var accepted, failed int
+	for i := uint64(0); i < numTxns; i++ {
+		if interruptRequested(interrupt) {
+			return accepted, failed, errInterruptRequested
+		}
+
+		var msgTx wire.MsgTx
+		if err := msgTx.Deserialize(r); err != nil {
+			return accepted, failed, err
+		}
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return accepted, failed, err
+		}
+		added := time.Unix(int64(binary.LittleEndian.Uint64(buf[:])), 0)
+
+		tx := btcutil.NewTx(&msgTx)
+		mp.mtx.Lock()
+		if mp.isExpired(added, time.Now()) {
+			mp.mtx.Unlock()
+			log.Debugf("Not restoring expired transaction %v",
+				tx.Hash())
+			failed++
+			continue
+		}
+		missingParents, txD, err := mp.maybeAcceptTransaction(tx, true,
+			false, true, false, "")
+		if err == nil && len(missingParents) == 0 {
+			txD.Added = added
+
+			// The transaction didn't enter the pool at the current
+			// height, so it can't be used for fee estimation.
+			if mp.cfg.FeeEstimator != nil {
+				mp.cfg.FeeEstimator.RemoveTransaction(tx.Hash())
+			}
+		}
+		mp.mtx.Unlock()
+
+		switch {
+		case err != nil:
+			log.Debugf("Not restoring transaction %v: %v", tx.Hash(),
+				err)
+			failed++
+
+		case len(missingParents) > 0:
+			log.Debugf("Not restoring transaction %v which spends "+
+				"unknown transaction %v", tx.Hash(),
+				missingParents[0])
+			failed++
+
+		default:
+			accepted++
+		}
+	}
+
+	numUnbroadcast, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return accepted, failed, err
+	}
+	for i := uint64(0); i < numUnbroadcast; i++ {
+		var hash chainhash.Hash
+		if _, err := io.ReadFull(r, hash[:]); err != nil {
+			return accepted, failed, err
+		}
+		mp.AddUnbroadcastTx(&hash)
+	}
+	if version < 3 {
+		return accepted, failed, nil
+	}
+
+	numFeeDeltas, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return accepted, failed, err
+	}
+	for i := uint64(0); i < numFeeDeltas; i++ {
+		var hash chainhash.Hash
+		if _, err := io.ReadFull(r, hash[:]); err != nil {
+			return accepted, failed, err
+		}
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return accepted, failed, err
+		}
+		mp.mtx.Lock()
+		mp.setFeeDelta(&hash, int64(binary.LittleEndian.Uint64(buf[:])))
+		mp.mtx.Unlock()
+	}
+
+	return accepted, failed, nil
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestDumpLoad ensures the transactions in the pool can be dumped and loaded
+// again along with the times they were added and the fee deltas, and that
+// loading revalidates them.
+func TestDumpLoad(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// Add a chain of transactions to the pool, which are written in an
+	// order which allows them to be loaded again regardless of the order
+	// of the pool.
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	added := time.Unix(1600000000, 0)
+	for i, tx := range chainedTxns {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"transaction %v", err)
+		}
+		harness.txPool.pool[*tx.Hash()].Added = added.Add(
+			time.Duration(i) * time.Minute)
+	}
+	unbroadcast := chainedTxns[2]
+	if !harness.txPool.AddUnbroadcastTx(unbroadcast.Hash()) {
+		t.Fatal("AddUnbroadcastTx: transaction in the pool not added")
+	}
+	unknown := chainhash.Hash{0x01}
+	harness.txPool.PrioritiseTransaction(chainedTxns[1].Hash(), 1000)
+	harness.txPool.PrioritiseTransaction(&unknown, -2000)
+
+	var buf bytes.Buffer
+	n, err := harness.txPool.Dump(&buf)
+	if err != nil {
+		t.Fatalf("Dump: %v", err)
+	}
+	if n != len(chainedTxns) {
+		t.Fatalf("Dump: wrote %d transactions, want %d", n,
+			len(chainedTxns))
+	}
+	dump := buf.Bytes()
+
+	// Loading the transactions while they are still in the pool doesn't
+	// add anything.
+	accepted, failed, err := harness.txPool.Load(bytes.NewReader(dump), nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if accepted != 0 || failed != len(chainedTxns) {
+		t.Fatalf("Load: accepted %d and failed %d transactions, want "+
+			"0 and %d", accepted, failed, len(chainedTxns))
+	}
+
+	// Loading the transactions into the emptied pool restores them along
+	// with the times they were added, the unbroadcast set, which no longer
+	// holds the transactions removed from the pool, and the fee deltas,
+	// which replace those set in the mean time.
+	harness.txPool.RemoveTransaction(chainedTxns[0], true,
+		RemovalReasonBlock)
+	if n := harness.txPool.UnbroadcastCount(); n != 0 {
+		t.Fatalf("%d unbroadcast transactions left in the emptied pool",
+			n)
+	}
+	harness.txPool.PrioritiseTransaction(&unknown, 500)
+	accepted, failed, err = harness.txPool.Load(bytes.NewReader(dump), nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if accepted != len(chainedTxns) || failed != 0 {
+		t.Fatalf("Load: accepted %d and failed %d transactions, want "+
+			"%d and 0", accepted, failed, len(chainedTxns))
+	}
+	for i, tx := range chainedTxns {
+		testPoolMembership(tc, tx, false, true)
+		want := added.Add(time.Duration(i) * time.Minute)
+		if got := harness.txPool.pool[*tx.Hash()].Added; !got.Equal(want) {
+			t.Fatalf("Load: transaction %d added at %v, want %v",
+				i, got, want)
+		}
+	}
+	txns := harness.txPool.UnbroadcastTxns()
+	if len(txns) != 1 || *txns[0].Tx.Hash() != *unbroadcast.Hash() {
+		t.Fatalf("Load: restored %d unbroadcast transactions, want %v",
+			len(txns), unbroadcast.Hash())
+	}
+	feeDeltas := harness.txPool.FeeDeltas()
+	if len(feeDeltas) != 2 || feeDeltas[unknown] != -2000 ||
+		harness.txPool.pool[*chainedTxns[1].Hash()].FeeDelta != 1000 {
+
+		t.Fatalf("Load: restored fee deltas %v", feeDeltas)
+	}
+
+	// Dumps of version 2 don't include the fee deltas, which are written
+	// last.
+	const feeDeltasLen = 1 + 2*(chainhash.HashSize+8)
+	dumpV2 := append([]byte(nil), dump[:len(dump)-feeDeltasLen]...)
+	dumpV2[0] = 2
+	harness.txPool.RemoveTransaction(chainedTxns[0], true,
+		RemovalReasonBlock)
+	accepted, failed, err = harness.txPool.Load(bytes.NewReader(dumpV2),
+		nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if accepted != len(chainedTxns) || failed != 0 {
+		t.Fatalf("Load: accepted %d and failed %d transactions of "+
+			"version 2 dump, want %d and 0", accepted, failed,
+			len(chainedTxns))
+	}
+
+	// Transactions which have been in the pool for longer than the expiry
+	// are not restored.
+	harness.txPool.RemoveTransaction(chainedTxns[0], true,
+		RemovalReasonBlock)
+	harness.txPool.cfg.Policy.Expiry = time.Hour
+	accepted, failed, err = harness.txPool.Load(bytes.NewReader(dump), nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if accepted != 0 || failed != len(chainedTxns) {
+		t.Fatalf("Load: accepted %d and failed %d expired transactions, "+
+			"want 0 and %d", accepted, failed, len(chainedTxns))
+	}
+	harness.txPool.cfg.Policy.Expiry = 0
+
+	// Transactions which are no longer valid are not restored, along with
+	// the transactions spending them.
+	harness.txPool.RemoveTransaction(chainedTxns[0], true,
+		RemovalReasonBlock)
+	harness.chain.utxos.LookupEntry(outputs[0].outPoint).Spend()
+	accepted, failed, err = harness.txPool.Load(bytes.NewReader(dump), nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if accepted != 0 || failed != len(chainedTxns) {
+		t.Fatalf("Load: accepted %d and failed %d transactions, want "+
+			"0 and %d", accepted, failed, len(chainedTxns))
+	}
+	for _, tx := range chainedTxns {
+		testPoolMembership(tc, tx, false, false)
+	}
+
+	// Loading is cancelled when the interrupt channel is closed.
+	interrupt := make(chan struct{})
+	close(interrupt)
+	_, _, err = harness.txPool.Load(bytes.NewReader(dump), interrupt)
+	if !IsInterruptRequested(err) {
+		t.Fatalf("Load: unexpected error with closed interrupt "+
+			"channel: %v", err)
+	}
+
+	// Dumps of an unknown version are rejected.
+	dump[0] = dumpVersion + 1
+	_, _, err = harness.txPool.Load(bytes.NewReader(dump), nil)
+	if err == nil {
+		t.Fatal("Load: loaded dump of unknown version")
+	}
+}
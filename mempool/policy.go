@@ -19,9 +19,15 @@ const (
 	// that are considered standard in a pay-to-script-hash script.
 	maxStandardP2SHSigOps = 15
 
-	// maxStandardTxCost is the max weight permitted by any transaction
-	// according to the current default policy.
-	maxStandardTxWeight = 400000
+	// DefaultMaxStandardTxWeight is the default max weight permitted by
+	// any transaction for it to be considered standard.
+	DefaultMaxStandardTxWeight = 400000
+
+	// DefaultMaxDataCarrierSize is the default max size of a null data
+	// output script, which only carries data, for it to be considered
+	// standard.  It allows a single push of txscript.MaxDataCarrierSize
+	// bytes after the OP_RETURN.
+	DefaultMaxDataCarrierSize = txscript.MaxDataCarrierSize + 3
 
 	// maxStandardSigScriptSize is the maximum size allowed for a
 	// transaction input signature script to be considered standard.  This
@@ -268,23 +274,41 @@ func isDust(txOut *wire.TxOut, minRelayTxFee btcutil.Amount) bool {
 	return txOut.Value*1000/(3*int64(totalSize)) < int64(minRelayTxFee)
 }
 
+// isNullDataScript returns whether or not the passed output script only carries
+// data, which is the case when it is an OP_RETURN followed by pushes of any
+// size.  Unlike txscript.GetScriptClass, it does not limit the size of the
+// pushes so the size can be limited by policy instead.
+func isNullDataScript(pkScript []byte) bool {
+	return len(pkScript) > 0 && pkScript[0] == txscript.OP_RETURN &&
+		txscript.IsPushOnlyScript(pkScript[1:])
+}
+
+// dustRelayFee returns the fee rate used to determine whether transaction
+// outputs are dust under the policy.
+func (p *Policy) dustRelayFee() btcutil.Amount {
+	if p.DustRelayFee > 0 {
+		return p.DustRelayFee
+	}
+	return p.MinRelayTxFee
+}
+
 // checkTransactionStandard performs a series of checks on a transaction to
-// ensure it is a "standard" transaction.  A standard transaction is one that
-// conforms to several additional limiting cases over what is considered a
-// "sane" transaction such as having a version in the supported range, being
-// finalized, conforming to more stringent size constraints, having scripts
-// of recognized forms, and not containing "dust" outputs (those that are
-// so small it costs more to process them than they are worth).
+// ensure it is a "standard" transaction under the passed policy.  A standard
+// transaction is one that conforms to several additional limiting cases over
+// what is considered a "sane" transaction such as having a version in the
+// supported range, being finalized, conforming to more stringent size
+// constraints, having scripts of recognized forms, and not containing "dust"
+// outputs (those that are so small it costs more to process them than they are
+// worth).
 func checkTransactionStandard(tx *btcutil.Tx, height int32,
-	medianTimePast time.Time, minRelayTxFee btcutil.Amount,
-	maxTxVersion int32) error {
+	medianTimePast time.Time, policy *Policy) error {
 
 	// The transaction must be a currently supported version.
 	msgTx := tx.MsgTx()
-	if msgTx.Version > maxTxVersion || msgTx.Version < 1 {
+	if msgTx.Version > policy.MaxTxVersion || msgTx.Version < 1 {
 		str := fmt.Sprintf("transaction version %d is not in the "+
 			"valid range of %d-%d", msgTx.Version, 1,
-			maxTxVersion)
+			policy.MaxTxVersion)
 		return txRuleError(wire.RejectNonstandard, str)
 	}
 
@@ -300,9 +324,12 @@ func checkTransactionStandard(tx *btcutil.Tx, height int32,
 	// size of a transaction.  This also helps mitigate CPU exhaustion
 	// attacks.
 	txWeight := blockchain.GetTransactionWeight(tx)
-	if txWeight > maxStandardTxWeight {
+	if policy.MaxStandardTxWeight > 0 &&
+		txWeight > policy.MaxStandardTxWeight {
+
 		str := fmt.Sprintf("weight of transaction %v is larger than max "+
-			"allowed weight of %v", txWeight, maxStandardTxWeight)
+			"allowed weight of %v", txWeight,
+			policy.MaxStandardTxWeight)
 		return txRuleError(wire.RejectNonstandard, str)
 	}
 
@@ -331,8 +358,12 @@ func checkTransactionStandard(tx *btcutil.Tx, height int32,
 	// None of the output public key scripts can be a non-standard script or
 	// be "dust" (except when the script is a null data script).
 	numNullDataOutputs := 0
+	dustRelayFee := policy.dustRelayFee()
 	for i, txOut := range msgTx.TxOut {
 		scriptClass := txscript.GetScriptClass(txOut.PkScript)
+		if isNullDataScript(txOut.PkScript) {
+			scriptClass = txscript.NullDataTy
+		}
 		err := checkPkScriptStandard(txOut.PkScript, scriptClass)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
@@ -346,12 +377,30 @@ func checkTransactionStandard(tx *btcutil.Tx, height int32,
 			return txRuleError(rejectCode, str)
 		}
 
+		switch {
+		case scriptClass == txscript.MultiSigTy &&
+			policy.RejectBareMultisig:
+
+			str := fmt.Sprintf("transaction output %d: bare "+
+				"multi-signature script", i)
+			return txRuleError(wire.RejectNonstandard, str)
+
+		case scriptClass == txscript.NullDataTy &&
+			len(txOut.PkScript) > policy.MaxDataCarrierSize:
+
+			str := fmt.Sprintf("transaction output %d: nulldata "+
+				"script size of %d bytes is larger than max "+
+				"allowed size of %d bytes", i,
+				len(txOut.PkScript), policy.MaxDataCarrierSize)
+			return txRuleError(wire.RejectNonstandard, str)
+		}
+
 		// Accumulate the number of outputs which only carry data.  For
 		// all other script types, ensure the output value is not
 		// "dust".
 		if scriptClass == txscript.NullDataTy {
 			numNullDataOutputs++
-		} else if isDust(txOut, minRelayTxFee) {
+		} else if isDust(txOut, dustRelayFee) {
 			str := fmt.Sprintf("transaction output %d: payment "+
 				"of %d is dust", i, txOut.Value)
 			return txRuleError(wire.RejectDust, str)
@@ -41,13 +41,13 @@ func TestCalcMinRequiredTxRelayFee(t *testing.T) {
 		},
 		{
 			"max standard tx size with default minimum relay fee",
-			maxStandardTxWeight / 4,
+			DefaultMaxStandardTxWeight / 4,
 			DefaultMinRelayTxFee,
 			100000,
 		},
 		{
 			"max standard tx size with max satoshi relay fee",
-			maxStandardTxWeight / 4,
+			DefaultMaxStandardTxWeight / 4,
 			btcutil.MaxSatoshi,
 			btcutil.MaxSatoshi,
 		},
@@ -305,11 +305,43 @@ func TestCheckTransactionStandard(t *testing.T) {
 		Value:    100000000, // 1 BTC
 		PkScript: dummyPkScript,
 	}
+	maxNullDataScript, err := txscript.NullDataScript(bytes.Repeat(
+		[]byte{0x01}, txscript.MaxDataCarrierSize))
+	if err != nil {
+		t.Fatalf("NullDataScript: unexpected error: %v", err)
+	}
+	bigNullDataScript, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).
+		AddData(bytes.Repeat([]byte{0x01}, 200)).Script()
+	if err != nil {
+		t.Fatalf("NewScriptBuilder: unexpected error: %v", err)
+	}
+	bareMultiSigScript, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_1).
+		AddData(append([]byte{0x02}, bytes.Repeat([]byte{0x01}, 32)...)).
+		AddOp(txscript.OP_1).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	if err != nil {
+		t.Fatalf("NewScriptBuilder: unexpected error: %v", err)
+	}
+
+	// The default policy is used by the tests which don't specify one.
+	defaultPolicy := Policy{
+		MaxTxVersion:        1,
+		MinRelayTxFee:       DefaultMinRelayTxFee,
+		MaxStandardTxWeight: DefaultMaxStandardTxWeight,
+		MaxDataCarrierSize:  DefaultMaxDataCarrierSize,
+	}
+	adjustedPolicy := func(adjust func(*Policy)) *Policy {
+		policy := defaultPolicy
+		adjust(&policy)
+		return &policy
+	}
 
 	tests := []struct {
 		name       string
 		tx         wire.MsgTx
 		height     int32
+		policy     *Policy
 		isStandard bool
 		code       wire.RejectCode
 	}{
@@ -360,7 +392,7 @@ func TestCheckTransactionStandard(t *testing.T) {
 				TxOut: []*wire.TxOut{{
 					Value: 0,
 					PkScript: bytes.Repeat([]byte{0x00},
-						(maxStandardTxWeight/4)+1),
+						(DefaultMaxStandardTxWeight/4)+1),
 				}},
 				LockTime: 0,
 			},
@@ -464,13 +496,132 @@ func TestCheckTransactionStandard(t *testing.T) {
 			height:     300000,
 			isStandard: true,
 		},
+		{
+			name: "Nulldata output of default max size (standard)",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{{
+					Value:    0,
+					PkScript: maxNullDataScript,
+				}},
+				LockTime: 0,
+			},
+			height:     300000,
+			isStandard: true,
+		},
+		{
+			name: "Nulldata output larger than default max size",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{{
+					Value:    0,
+					PkScript: bigNullDataScript,
+				}},
+				LockTime: 0,
+			},
+			height:     300000,
+			isStandard: false,
+			code:       wire.RejectNonstandard,
+		},
+		{
+			name: "Nulldata output within raised max size (standard)",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{{
+					Value:    0,
+					PkScript: bigNullDataScript,
+				}},
+				LockTime: 0,
+			},
+			height: 300000,
+			policy: adjustedPolicy(func(p *Policy) {
+				p.MaxDataCarrierSize = len(bigNullDataScript)
+			}),
+			isStandard: true,
+		},
+		{
+			name: "Nulldata output with data carrier size of zero",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{{
+					Value:    0,
+					PkScript: []byte{txscript.OP_RETURN},
+				}},
+				LockTime: 0,
+			},
+			height: 300000,
+			policy: adjustedPolicy(func(p *Policy) {
+				p.MaxDataCarrierSize = 0
+			}),
+			isStandard: false,
+			code:       wire.RejectNonstandard,
+		},
+		{
+			name: "Bare multisig output (standard)",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{{
+					Value:    100000000,
+					PkScript: bareMultiSigScript,
+				}},
+				LockTime: 0,
+			},
+			height:     300000,
+			isStandard: true,
+		},
+		{
+			name: "Bare multisig output rejected by policy",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{{
+					Value:    100000000,
+					PkScript: bareMultiSigScript,
+				}},
+				LockTime: 0,
+			},
+			height: 300000,
+			policy: adjustedPolicy(func(p *Policy) {
+				p.RejectBareMultisig = true
+			}),
+			isStandard: false,
+			code:       wire.RejectNonstandard,
+		},
+		{
+			name: "Dust output under raised dust relay fee",
+			tx: wire.MsgTx{
+				Version: 1,
+				TxIn:    []*wire.TxIn{&dummyTxIn},
+				TxOut: []*wire.TxOut{{
+					Value:    1000,
+					PkScript: dummyPkScript,
+				}},
+				LockTime: 0,
+			},
+			height: 300000,
+			policy: adjustedPolicy(func(p *Policy) {
+				p.DustRelayFee = 3000
+			}),
+			isStandard: false,
+			code:       wire.RejectDust,
+		},
 	}
 
 	pastMedianTime := time.Now()
 	for _, test := range tests {
+		policy := test.policy
+		if policy == nil {
+			policy = &defaultPolicy
+		}
+
 		// Ensure standardness is as expected.
 		err := checkTransactionStandard(btcutil.NewTx(&test.tx),
-			test.height, pastMedianTime, DefaultMinRelayTxFee, 1)
+			test.height, pastMedianTime, policy)
 		if err == nil && test.isStandard {
 			// Test passes since function returned standard for a
 			// transaction which is intended to be standard.
@@ -0,0 +1,103 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// setFeeDelta sets the fee delta of the transaction with the passed hash and
+// updates the statistics which depend on its modified fee when it is in the
+// pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) setFeeDelta(hash *chainhash.Hash, feeDelta int64) {
+	if feeDelta == 0 {
+		delete(mp.feeDeltas, *hash)
+	} else {
+		mp.feeDeltas[*hash] = feeDelta
+	}
+
+	txD, ok := mp.pool[*hash]
+	if !ok || txD.FeeDelta == feeDelta {
+		return
+	}
+	txD.FeeDelta = feeDelta
+
+	// The package statistics of the transaction along with its ancestors
+	// and descendants include its modified fee, and so do the chunks of its
+	// cluster.
+	related := mp.txAncestors(txD.Tx, nil)
+	for descHash, descendant := range mp.txDescendants(txD.Tx, nil) {
+		related[descHash] = descendant
+	}
+	related[*hash] = txD.Tx
+	mp.updatePackageStats(related)
+	mp.setCluster(mp.clusters[*hash].linearization)
+	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+}
+
+// PrioritiseTransaction adds the passed fee delta in satoshi to the fee delta
+// of the transaction with the passed hash.  The fee of a transaction is
+// modified by its fee delta when it is selected for inclusion in new blocks and
+// when the pool evicts transactions, but the transaction does not actually pay
+// it.  Fee deltas may be set for transactions which are not in the pool yet, in
+// which case they apply once the transaction is added.  The fee delta of a
+// transaction is cleared once it is included in a block.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) PrioritiseTransaction(hash *chainhash.Hash, delta int64) {
+	mp.mtx.Lock()
+	feeDelta := mp.feeDeltas[*hash] + delta
+	mp.setFeeDelta(hash, feeDelta)
+	mp.mtx.Unlock()
+
+	log.Debugf("Fee delta of transaction %v set to %d", hash, feeDelta)
+}
+
+// FeeDeltas returns the fee deltas of transactions, both in and not in the
+// pool, keyed by their hashes.  See PrioritiseTransaction for details.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FeeDeltas() map[chainhash.Hash]int64 {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	feeDeltas := make(map[chainhash.Hash]int64, len(mp.feeDeltas))
+	for hash, feeDelta := range mp.feeDeltas {
+		feeDeltas[hash] = feeDelta
+	}
+	return feeDeltas
+}
+
+// PrioritisedTransactions returns the fee deltas of transactions, both in and
+// not in the pool, as a fully populated btcjson result keyed by the hashes of
+// the transactions.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) PrioritisedTransactions() map[string]*btcjson.PrioritisedTransactionResult {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	result := make(map[string]*btcjson.PrioritisedTransactionResult,
+		len(mp.feeDeltas))
+	for hash, feeDelta := range mp.feeDeltas {
+		entry := &btcjson.PrioritisedTransactionResult{
+			FeeDelta: feeDelta,
+		}
+		if txD, ok := mp.pool[hash]; ok {
+			modifiedFee := txD.ModifiedFee()
+			entry.InMempool = true
+			entry.ModifiedFee = &modifiedFee
+		}
+		result[hash.String()] = entry
+	}
+
+	return result
+}
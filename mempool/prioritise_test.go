@@ -0,0 +1,119 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestPrioritiseTransaction ensures fee deltas modify the fees of transactions
+// in the pool along with the statistics which depend on them, that they apply
+// to transactions added after they are set, and that they are cleared once the
+// transactions are mined.
+func TestPrioritiseTransaction(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	txPool := harness.txPool
+
+	// The fee delta of a transaction which is not in the pool yet applies
+	// once it is added.
+	parent := ctx.addSignedTx(outputs[:1], 1, 1000, false, false)
+	child, err := harness.CreateSignedTx([]spendableOutput{
+		txOutToSpendableOut(parent, 0),
+	}, 1, 5000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	txPool.PrioritiseTransaction(child.Hash(), 500)
+	_, err = txPool.ProcessTransaction(child, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	parentDesc := txPool.pool[*parent.Hash()]
+	childDesc := txPool.pool[*child.Hash()]
+	if childDesc.Fee != 5000 || childDesc.FeeDelta != 500 {
+		t.Fatalf("child has fee %d and fee delta %d, want 5000 and 500",
+			childDesc.Fee, childDesc.FeeDelta)
+	}
+
+	// Fee deltas add up and update the package statistics and chunks of
+	// the transactions.  The child pays for its parent, so they form a
+	// chunk.
+	txPool.PrioritiseTransaction(parent.Hash(), 2000)
+	txPool.PrioritiseTransaction(parent.Hash(), -500)
+	if parentDesc.Fee != 1000 || parentDesc.FeeDelta != 1500 ||
+		parentDesc.ModifiedFee() != 2500 {
+
+		t.Fatalf("parent has fee %d, fee delta %d, and modified fee "+
+			"%d, want 1000, 1500, and 2500", parentDesc.Fee,
+			parentDesc.FeeDelta, parentDesc.ModifiedFee())
+	}
+	const packageFee = 1000 + 1500 + 5000 + 500
+	if parentDesc.DescendantFee != packageFee ||
+		childDesc.AncestorFee != packageFee {
+
+		t.Fatalf("parent has descendant fee %d and child has ancestor "+
+			"fee %d, want %d", parentDesc.DescendantFee,
+			childDesc.AncestorFee, packageFee)
+	}
+	if parentDesc.ChunkFee != packageFee || childDesc.ChunkFee != packageFee {
+		t.Fatalf("chunk fees %d and %d, want %d", parentDesc.ChunkFee,
+			childDesc.ChunkFee, packageFee)
+	}
+	for _, desc := range txPool.MiningDescs() {
+		if *desc.Tx.Hash() == *parent.Hash() && desc.FeeDelta != 1500 {
+			t.Fatalf("mining descriptor has fee delta %d, want 1500",
+				desc.FeeDelta)
+		}
+	}
+
+	// Fee deltas are kept for transactions which are not in the pool, and
+	// they are dropped once they add up to zero.
+	unknown := chainhash.Hash{0x01}
+	txPool.PrioritiseTransaction(&unknown, 100)
+	txPool.PrioritiseTransaction(parent.Hash(), -1500)
+	if parentDesc.FeeDelta != 0 || parentDesc.DescendantFee != 6500 {
+		t.Fatalf("parent has fee delta %d and descendant fee %d, want "+
+			"0 and 6500", parentDesc.FeeDelta,
+			parentDesc.DescendantFee)
+	}
+	feeDeltas := txPool.FeeDeltas()
+	if len(feeDeltas) != 2 || feeDeltas[*child.Hash()] != 500 ||
+		feeDeltas[unknown] != 100 {
+
+		t.Fatalf("got fee deltas %v, want %v: 500 and %v: 100",
+			feeDeltas, child.Hash(), unknown)
+	}
+	prioritised := txPool.PrioritisedTransactions()
+	childEntry := prioritised[child.Hash().String()]
+	if childEntry == nil || !childEntry.InMempool ||
+		childEntry.ModifiedFee == nil || *childEntry.ModifiedFee != 5500 {
+
+		t.Fatalf("got entry %+v for the child, want modified fee 5500",
+			childEntry)
+	}
+	unknownEntry := prioritised[unknown.String()]
+	if unknownEntry == nil || unknownEntry.InMempool ||
+		unknownEntry.ModifiedFee != nil || unknownEntry.FeeDelta != 100 {
+
+		t.Fatalf("got entry %+v for the unknown transaction",
+			unknownEntry)
+	}
+
+	// The fee delta of a mined transaction is cleared.
+	txPool.RemoveTransaction(child, false, RemovalReasonBlock)
+	feeDeltas = txPool.FeeDeltas()
+	if _, ok := feeDeltas[*child.Hash()]; ok || len(feeDeltas) != 1 {
+		t.Fatalf("got fee deltas %v after mining the child", feeDeltas)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"math"
+	"time"
+
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// DefaultMaxPoolSize is the default maximum total serialized size in
+	// bytes of the transactions in the pool.
+	DefaultMaxPoolSize = 300000000
+
+	// rollingFeeHalfLife is the half-life of the minimum fee rate of the
+	// pool after it was raised by evicting transactions.  The minimum fee
+	// rate decays faster when the pool is less full.
+	rollingFeeHalfLife = time.Hour * 12
+)
+
+// trimToSize evicts the chunk with the lowest fee rate in the pool until the
+// pool no longer exceeds its maximum size.  Since the chunks of a cluster are
+// ordered by decreasing fee rate, this is the last chunk of one of the
+// clusters, which includes the descendants of its transactions.  The minimum
+// fee rate of the pool is raised above the fee rate of every chunk which is
+// evicted, so transactions which would be evicted right away are no longer
+// accepted.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) trimToSize() {
+	maxSize := mp.cfg.Policy.MaxPoolSize
+	if maxSize <= 0 {
+		return
+	}
+
+	var numEvicted int
+	for mp.poolSize > maxSize {
+		worst := mp.worstChunk()
+		if worst == nil {
+			break
+		}
+
+		// Raise the minimum fee rate above the fee rate of the evicted
+		// chunk by the minimum relay fee, which is also the minimum
+		// increase required to replace transactions.
+		chunkRate := worst.fee * 1000 / worst.vsize
+		rollingMinFee := float64(chunkRate +
+			int64(mp.cfg.Policy.MinRelayTxFee))
+		if rollingMinFee > mp.rollingMinFee {
+			mp.rollingMinFee = rollingMinFee
+			mp.lastRollingFeeUpdate = time.Now()
+			mp.rollingFeeBumpHeight = mp.cfg.BestHeight()
+		}
+
+		// Removing a transaction changes the chunks of its cluster, so
+		// the transactions to evict are copied first.  They are
+		// removed in reverse order so each one is removed before the
+		// transactions it spends.
+		txns := make([]*TxDesc, len(worst.txns))
+		copy(txns, worst.txns)
+		log.Debugf("Evicting chunk of %d %s (fee_rate=%v sat/kb) to "+
+			"stay within the maximum pool size", len(txns),
+			pickNoun(len(txns), "transaction", "transactions"),
+			chunkRate)
+		for i := len(txns) - 1; i >= 0; i-- {
+			mp.removeTransaction(txns[i].Tx, true,
+				RemovalReasonSizeLimit)
+		}
+		numEvicted += len(txns)
+	}
+
+	if numEvicted > 0 {
+		log.Infof("Evicted %d transactions to stay within the maximum "+
+			"pool size (minimum fee rate %v)", numEvicted,
+			mp.minFeeRate())
+	}
+}
+
+// minFeeRate returns the minimum fee rate per kilobyte which is required for
+// transactions to be accepted into the pool.  It is the minimum relay fee
+// unless transactions were evicted from the pool because it exceeded its
+// maximum size, in which case it is raised above the fee rate of the evicted
+// transactions.  The raised fee rate decays with a half-life once a new block
+// has been connected, which happens faster when the pool is less full.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) minFeeRate() btcutil.Amount {
+	minRelayTxFee := mp.cfg.Policy.MinRelayTxFee
+	if mp.rollingMinFee == 0 {
+		return minRelayTxFee
+	}
+
+	now := time.Now()
+	if mp.cfg.BestHeight() > mp.rollingFeeBumpHeight &&
+		now.Sub(mp.lastRollingFeeUpdate) > time.Second*10 {
+
+		halfLife := rollingFeeHalfLife
+		if mp.poolSize < mp.cfg.Policy.MaxPoolSize/4 {
+			halfLife /= 4
+		} else if mp.poolSize < mp.cfg.Policy.MaxPoolSize/2 {
+			halfLife /= 2
+		}
+		elapsed := now.Sub(mp.lastRollingFeeUpdate)
+		mp.rollingMinFee /= math.Pow(2, float64(elapsed)/float64(halfLife))
+		mp.lastRollingFeeUpdate = now
+
+		if mp.rollingMinFee < float64(minRelayTxFee)/2 {
+			mp.rollingMinFee = 0
+			return minRelayTxFee
+		}
+	}
+
+	if rollingMinFee := btcutil.Amount(mp.rollingMinFee); rollingMinFee > minRelayTxFee {
+		return rollingMinFee
+	}
+	return minRelayTxFee
+}
+
+// MinFee returns the minimum fee rate per kilobyte which is currently required
+// for transactions to be accepted into the pool.  It is raised above the
+// minimum relay fee while the pool is full.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MinFee() btcutil.Amount {
+	// The minimum fee rate decays as it is queried.
+	mp.mtx.Lock()
+	minFee := mp.minFeeRate()
+	mp.mtx.Unlock()
+
+	return minFee
+}
+
+// Size returns the total serialized size in bytes of the transactions in the
+// main pool.  It does not include the orphan pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Size() int64 {
+	mp.mtx.RLock()
+	size := mp.poolSize
+	mp.mtx.RUnlock()
+
+	return size
+}
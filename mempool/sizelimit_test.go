@@ -0,0 +1,108 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestPoolSizeLimit ensures the transactions with the lowest fee rates are
+// evicted when the pool exceeds its maximum size and that the minimum fee rate
+// of the pool is raised above theirs until it decays again.
+func TestPoolSizeLimit(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	txPool := harness.txPool
+
+	independent := ctx.independentOutputs(outputs, 5)
+	spend := func(i uint32, fee btcutil.Amount) *btcutil.Tx {
+		return ctx.createSignedTx(independent[i], fee)
+	}
+
+	// Fill the pool up to its maximum size, leaving room for the small
+	// differences in the sizes of the signatures.
+	low := spend(0, 500)
+	high := spend(1, 2000)
+	for _, tx := range []*btcutil.Tx{low, high} {
+		_, err := txPool.ProcessTransaction(tx, false, false, 0)
+		if err != nil {
+			t.Fatalf("unable to process transaction: %v", err)
+		}
+	}
+	txPool.cfg.Policy.MaxPoolSize = txPool.Size() + 10
+	if minFee := txPool.MinFee(); minFee != txPool.cfg.Policy.MinRelayTxFee {
+		t.Fatalf("unexpected minimum fee rate %v before eviction",
+			minFee)
+	}
+
+	// Adding a transaction with a higher fee rate evicts the one with the
+	// lowest fee rate and raises the minimum fee rate above it.
+	higher := spend(2, 5000)
+	if _, err := txPool.ProcessTransaction(higher, false, false, 0); err != nil {
+		t.Fatalf("unable to process transaction: %v", err)
+	}
+	testPoolMembership(ctx, low, false, false)
+	testPoolMembership(ctx, high, false, true)
+	testPoolMembership(ctx, higher, false, true)
+	if txPool.Size() > txPool.cfg.Policy.MaxPoolSize {
+		t.Fatalf("pool size %d exceeds the maximum of %d",
+			txPool.Size(), txPool.cfg.Policy.MaxPoolSize)
+	}
+	lowRate := btcutil.Amount(500 * 1000 / GetTxVirtualSize(low))
+	wantMinFee := lowRate + txPool.cfg.Policy.MinRelayTxFee
+	if minFee := txPool.MinFee(); minFee != wantMinFee {
+		t.Fatalf("minimum fee rate after eviction is %v, want %v",
+			minFee, wantMinFee)
+	}
+
+	// Transactions below the raised minimum fee rate are rejected.
+	_, err = txPool.ProcessTransaction(spend(3, 600), false, false, 0)
+	if err == nil || !strings.Contains(err.Error(), "minimum fee rate") {
+		t.Fatalf("expected transaction below the minimum fee rate to "+
+			"be rejected, got %v", err)
+	}
+
+	// Transactions above the minimum fee rate which have the lowest fee
+	// rate in the pool are evicted right away.
+	lowest := spend(4, 1500)
+	_, err = txPool.ProcessTransaction(lowest, false, false, 0)
+	if err == nil || !strings.Contains(err.Error(), "mempool is full") {
+		t.Fatalf("expected transaction with the lowest fee rate to be "+
+			"evicted, got %v", err)
+	}
+	testPoolMembership(ctx, lowest, false, false)
+
+	// Evicting it raises the minimum fee rate above its fee rate.
+	lowestRate := btcutil.Amount(1500 * 1000 / GetTxVirtualSize(lowest))
+	wantMinFee = lowestRate + txPool.cfg.Policy.MinRelayTxFee
+	if minFee := txPool.MinFee(); minFee != wantMinFee {
+		t.Fatalf("minimum fee rate after the second eviction is %v, "+
+			"want %v", minFee, wantMinFee)
+	}
+
+	// The minimum fee rate doesn't decay until a new block is connected.
+	txPool.mtx.Lock()
+	txPool.lastRollingFeeUpdate = time.Now().Add(-rollingFeeHalfLife * 10)
+	txPool.mtx.Unlock()
+	if minFee := txPool.MinFee(); minFee != wantMinFee {
+		t.Fatalf("minimum fee rate decayed to %v before a new block",
+			minFee)
+	}
+	harness.chain.SetHeight(harness.chain.BestHeight() + 1)
+	if minFee := txPool.MinFee(); minFee != txPool.cfg.Policy.MinRelayTxFee {
+		t.Fatalf("minimum fee rate is %v after decaying, want %v",
+			minFee, txPool.cfg.Policy.MinRelayTxFee)
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/blockchain"
+)
+
+// RemovalReason describes why a transaction was removed from the pool.
+type RemovalReason int
+
+const (
+	// RemovalReasonBlock indicates the transaction was included in a block
+	// connected to the main chain.
+	RemovalReasonBlock RemovalReason = iota
+
+	// RemovalReasonConflict indicates the transaction, or one of its
+	// ancestors, spent an output which is spent by a transaction of a block
+	// connected to the main chain.
+	RemovalReasonConflict
+
+	// RemovalReasonReorg indicates the transaction of a block disconnected
+	// from the main chain, or one which spends it, could not be added back
+	// to the pool.
+	RemovalReasonReorg
+
+	// RemovalReasonSizeLimit indicates the transaction was evicted because
+	// the pool exceeded its maximum size.
+	RemovalReasonSizeLimit
+
+	// RemovalReasonExpiry indicates the transaction stayed in the pool for
+	// longer than it is allowed to.
+	RemovalReasonExpiry
+
+	// RemovalReasonReplaced indicates the transaction, or one of its
+	// ancestors, was replaced by a transaction which pays a higher fee.
+	RemovalReasonReplaced
+
+	// RemovalReasonRejected indicates the transaction was removed right
+	// after it was added because it, or the package it was added with, was
+	// rejected.
+	RemovalReasonRejected
+)
+
+// removalReasonStrings is a map of removal reasons back to the names used for
+// them by external services.
+var removalReasonStrings = map[RemovalReason]string{
+	RemovalReasonBlock:     "block",
+	RemovalReasonConflict:  "conflict",
+	RemovalReasonReorg:     "reorg",
+	RemovalReasonSizeLimit: "sizelimit",
+	RemovalReasonExpiry:    "expiry",
+	RemovalReasonReplaced:  "replaced",
+	RemovalReasonRejected:  "rejected",
+}
+
+// String returns the RemovalReason in human-readable form.
+func (r RemovalReason) String() string {
+	if s, ok := removalReasonStrings[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown RemovalReason (%d)", int(r))
+}
+
+// TxEventType identifies the kind of a transaction event.
+type TxEventType int
+
+const (
+	// TxEventAdded indicates a transaction was added to the pool.
+	TxEventAdded TxEventType = iota
+
+	// TxEventRemoved indicates a transaction was removed from the pool.
+	TxEventRemoved
+
+	// TxEventReplaced indicates transactions in the pool were replaced.
+	// It follows the events of the removal of the replaced transactions
+	// and the addition of the replacement.
+	TxEventReplaced
+)
+
+// txEventTypeStrings is a map of transaction event types back to their constant
+// names for pretty printing.
+var txEventTypeStrings = map[TxEventType]string{
+	TxEventAdded:    "TxEventAdded",
+	TxEventRemoved:  "TxEventRemoved",
+	TxEventReplaced: "TxEventReplaced",
+}
+
+// String returns the TxEventType in human-readable form.
+func (t TxEventType) String() string {
+	if s, ok := txEventTypeStrings[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown TxEventType (%d)", int(t))
+}
+
+// TxEvent describes a change of the transactions in the pool.
+//
+// Sequence numbers increase by one for every event of the pool, so applying
+// the events in order to a copy of the pool taken at the start of the
+// subscription keeps it in sync with the pool.
+type TxEvent struct {
+	Sequence uint64
+	Type     TxEventType
+
+	// TxDesc is a copy of the descriptor of the transaction which was
+	// added to or removed from the pool as of that time, which includes
+	// its fee.  It is nil for TxEventReplaced events.
+	TxDesc *TxDesc
+
+	// VSize is the virtual size of the transaction which was added to or
+	// removed from the pool.
+	VSize int64
+
+	// Reason is why the transaction was removed from the pool.  It is only
+	// set for TxEventRemoved events.
+	Reason RemovalReason
+
+	// Replacement describes the replacement of transactions for
+	// TxEventReplaced events.
+	Replacement *TxReplacement
+}
+
+// TxEventSubscription is a subscription to the transactions which are added to,
+// removed from, and replaced in the pool.  The events are delivered on the
+// buffered channel C in order.
+type TxEventSubscription struct {
+	C <-chan *TxEvent
+
+	// Snapshot holds copies of the descriptors of the transactions which
+	// were in the pool when the subscription started, if requested, and
+	// Sequence is the sequence number of the last event before then.
+	Snapshot []*TxDesc
+	Sequence uint64
+
+	pool    *TxPool
+	c       chan *TxEvent
+	policy  blockchain.SlowConsumerPolicy
+	dropped uint64 // Atomic access only.
+
+	// quit is closed when the subscription ends to release a publisher
+	// which waits for room in the buffer.
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+// Dropped returns the number of events which were discarded because the
+// buffer of the subscription was full.
+//
+// This function is safe for concurrent access.
+func (s *TxEventSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe ends the subscription and closes its channel.  Events which are
+// still buffered may be received until the channel is closed.
+//
+// This function is safe for concurrent access.
+func (s *TxEventSubscription) Unsubscribe() {
+	s.quitOnce.Do(func() { close(s.quit) })
+	s.pool.subscriptionsLock.Lock()
+	s.pool.removeSubscription(s)
+	s.pool.subscriptionsLock.Unlock()
+}
+
+// deliver hands the passed event to the subscriber according to the slow
+// consumer policy of the subscription.  It returns false when the subscription
+// has to end.
+func (s *TxEventSubscription) deliver(event *TxEvent) bool {
+	select {
+	case s.c <- event:
+		return true
+	default:
+	}
+
+	switch s.policy {
+	case blockchain.PolicyDropOldest:
+		select {
+		case <-s.c:
+		default:
+		}
+		select {
+		case s.c <- event:
+			atomic.AddUint64(&s.dropped, 1)
+			return true
+		default:
+		}
+
+	case blockchain.PolicyBlock:
+		select {
+		case s.c <- event:
+			return true
+		case <-s.quit:
+			return false
+		}
+
+	case blockchain.PolicyClose:
+		atomic.AddUint64(&s.dropped, 1)
+		return false
+	}
+
+	atomic.AddUint64(&s.dropped, 1)
+	return true
+}
+
+// SubscribeTxEvents returns a subscription which receives an event for every
+// transaction added to or removed from the pool and for every replacement of
+// transactions.  Up to bufferSize events are buffered for the subscriber
+// before the passed slow consumer policy applies.  When the snapshot flag is
+// set, the subscription also holds the transactions in the pool at the time it
+// started, so the subscriber can mirror the pool by applying the events to
+// them.
+//
+// Since events are published with the mempool lock held, a subscriber with the
+// PolicyBlock policy must not call into the pool from the goroutine which
+// receives the events.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) SubscribeTxEvents(bufferSize int,
+	policy blockchain.SlowConsumerPolicy, snapshot bool) *TxEventSubscription {
+
+	c := make(chan *TxEvent, bufferSize)
+	s := &TxEventSubscription{
+		C:      c,
+		pool:   mp,
+		c:      c,
+		policy: policy,
+		quit:   make(chan struct{}),
+	}
+
+	// Events are only published with the mempool lock held for writes, so
+	// holding it for reads keeps the snapshot consistent with the
+	// sequence number.
+	mp.mtx.RLock()
+	if snapshot {
+		s.Snapshot = make([]*TxDesc, 0, len(mp.pool))
+		for _, txD := range mp.pool {
+			desc := *txD
+			s.Snapshot = append(s.Snapshot, &desc)
+		}
+	}
+	mp.subscriptionsLock.Lock()
+	s.Sequence = mp.eventSeq
+	mp.subscriptions = append(mp.subscriptions, s)
+	mp.subscriptionsLock.Unlock()
+	mp.mtx.RUnlock()
+
+	return s
+}
+
+// removeSubscription stops publishing events to the passed subscription and
+// closes its channel unless that already happened.
+//
+// This function MUST be called with the subscriptions lock held.
+func (mp *TxPool) removeSubscription(s *TxEventSubscription) {
+	for i, sub := range mp.subscriptions {
+		if sub != s {
+			continue
+		}
+		copy(mp.subscriptions[i:], mp.subscriptions[i+1:])
+		mp.subscriptions[len(mp.subscriptions)-1] = nil
+		mp.subscriptions = mp.subscriptions[:len(mp.subscriptions)-1]
+		s.quitOnce.Do(func() { close(s.quit) })
+		close(s.c)
+		return
+	}
+}
+
+// publishTxEvent publishes an event of the passed type under the next sequence
+// number.  The descriptor is copied for TxEventAdded and TxEventRemoved events,
+// while the replacement is only passed for TxEventReplaced events.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) publishTxEvent(typ TxEventType, txD *TxDesc,
+	reason RemovalReason, replacement *TxReplacement) {
+
+	mp.subscriptionsLock.Lock()
+	defer mp.subscriptionsLock.Unlock()
+
+	mp.eventSeq++
+	if len(mp.subscriptions) == 0 {
+		return
+	}
+
+	event := &TxEvent{
+		Sequence: mp.eventSeq,
+		Type:     typ,
+		Reason:   reason,
+	}
+	if txD != nil {
+		desc := *txD
+		event.TxDesc = &desc
+		event.VSize = GetTxVirtualSize(txD.Tx)
+	}
+	if replacement != nil {
+		// The replacement is still in the pool, so its descriptor is
+		// copied as its package statistics change.
+		r := *replacement
+		desc := *r.Replacement
+		r.Replacement = &desc
+		event.Replacement = &r
+	}
+
+	var ended []*TxEventSubscription
+	for _, s := range mp.subscriptions {
+		if !s.deliver(event) {
+			ended = append(ended, s)
+		}
+	}
+	for _, s := range ended {
+		log.Debugf("Ending mempool subscription with policy %v which "+
+			"fell behind", s.policy)
+		mp.removeSubscription(s)
+	}
+}
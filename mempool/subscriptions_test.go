@@ -0,0 +1,177 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestTxEventSubscriptions ensures subscribers receive the transactions added
+// to, removed from, and replaced in the pool in order along with a snapshot of
+// the pool at the time they subscribed.
+func TestTxEventSubscriptions(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	ctx := &testContext{t, harness}
+	txPool := harness.txPool
+
+	independent := ctx.independentOutputs(outputs, 2)
+
+	parent := ctx.addSignedTx([]spendableOutput{
+		independent[0],
+	}, 1, 1000, true, false)
+
+	sub := txPool.SubscribeTxEvents(10, blockchain.PolicyDropNewest, true)
+	if len(sub.Snapshot) != 1 || *sub.Snapshot[0].Tx.Hash() != *parent.Hash() {
+		t.Fatalf("unexpected snapshot %v", sub.Snapshot)
+	}
+	closeFull := txPool.SubscribeTxEvents(0, blockchain.PolicyClose, false)
+	if closeFull.Snapshot != nil {
+		t.Fatal("snapshot taken without being requested")
+	}
+	unsubscribed := txPool.SubscribeTxEvents(10, blockchain.PolicyBlock, false)
+	unsubscribed.Unsubscribe()
+	if _, ok := <-unsubscribed.C; ok {
+		t.Fatal("channel of ended subscription not closed")
+	}
+
+	nextEvent := func(typ TxEventType) *TxEvent {
+		t.Helper()
+
+		select {
+		case event := <-sub.C:
+			if event.Type != typ {
+				t.Fatalf("got event %v, want %v", event.Type, typ)
+			}
+			sub.Sequence++
+			if event.Sequence != sub.Sequence {
+				t.Fatalf("got event sequence %d, want %d",
+					event.Sequence, sub.Sequence)
+			}
+			return event
+		default:
+			t.Fatalf("no %v event", typ)
+		}
+		return nil
+	}
+
+	// Adding a transaction reports it along with its fee and size.
+	child := ctx.addSignedTx([]spendableOutput{
+		txOutToSpendableOut(parent, 0),
+	}, 1, 1000, false, false)
+	event := nextEvent(TxEventAdded)
+	if *event.TxDesc.Tx.Hash() != *child.Hash() ||
+		event.TxDesc.Fee != 1000 ||
+		event.VSize != GetTxVirtualSize(child) {
+
+		t.Fatalf("unexpected added event %+v", event)
+	}
+
+	// The subscription without room in its buffer ended.
+	if _, ok := <-closeFull.C; ok {
+		t.Fatal("channel of subscription which fell behind not closed")
+	}
+	if closeFull.Dropped() != 1 {
+		t.Fatalf("dropped %d events, want 1", closeFull.Dropped())
+	}
+
+	// Replacing the parent removes it along with the child before adding
+	// the replacement.
+	replacement, err := harness.CreateSignedTx([]spendableOutput{
+		independent[0],
+	}, 1, 10000, false)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = txPool.ProcessTransaction(replacement, false, false, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept replacement %v",
+			err)
+	}
+	removed := map[chainhash.Hash]struct{}{
+		*parent.Hash(): {},
+		*child.Hash():  {},
+	}
+	for i := 0; i < 2; i++ {
+		event := nextEvent(TxEventRemoved)
+		if event.Reason != RemovalReasonReplaced {
+			t.Fatalf("got removal reason %v, want %v", event.Reason,
+				RemovalReasonReplaced)
+		}
+		if _, ok := removed[*event.TxDesc.Tx.Hash()]; !ok {
+			t.Fatalf("unexpected removal of %v",
+				event.TxDesc.Tx.Hash())
+		}
+		delete(removed, *event.TxDesc.Tx.Hash())
+	}
+	event = nextEvent(TxEventAdded)
+	if *event.TxDesc.Tx.Hash() != *replacement.Hash() {
+		t.Fatalf("added %v, want the replacement", event.TxDesc.Tx.Hash())
+	}
+	event = nextEvent(TxEventReplaced)
+	if *event.Replacement.Replacement.Tx.Hash() != *replacement.Hash() ||
+		len(event.Replacement.Replaced) != 2 {
+
+		t.Fatalf("unexpected replacement %+v", event.Replacement)
+	}
+
+	// Removing a mined transaction reports the block as the reason.
+	txPool.RemoveTransaction(replacement, true, RemovalReasonBlock)
+	event = nextEvent(TxEventRemoved)
+	if *event.TxDesc.Tx.Hash() != *replacement.Hash() ||
+		event.Reason != RemovalReasonBlock {
+
+		t.Fatalf("unexpected removed event %+v", event)
+	}
+
+	// No events are received once the subscription ended.
+	sub.Unsubscribe()
+	ctx.addSignedTx([]spendableOutput{
+		independent[1],
+	}, 1, 1000, false, false)
+	for event := range sub.C {
+		t.Fatalf("unexpected event after unsubscribing %+v", event)
+	}
+	if sub.Dropped() != 0 {
+		t.Fatalf("dropped %d events from subscription with room",
+			sub.Dropped())
+	}
+}
+
+// TestRemovalReasonStringer tests the stringized output for the RemovalReason
+// type.
+func TestRemovalReasonStringer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   RemovalReason
+		want string
+	}{
+		{RemovalReasonBlock, "block"},
+		{RemovalReasonConflict, "conflict"},
+		{RemovalReasonReorg, "reorg"},
+		{RemovalReasonSizeLimit, "sizelimit"},
+		{RemovalReasonExpiry, "expiry"},
+		{RemovalReasonReplaced, "replaced"},
+		{RemovalReasonRejected, "rejected"},
+		{0xffff, "Unknown RemovalReason (65535)"},
+	}
+
+	for i, test := range tests {
+		result := test.in.String()
+		if result != test.want {
+			t.Errorf("String #%d\n got: %s want: %s", i, result,
+				test.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// AddUnbroadcastTx adds the passed transaction to the set of transactions which
+// were submitted locally, such as through the RPC server, and which no peer has
+// requested yet.  Those transactions should be rebroadcast periodically until a
+// peer requests them, which shows they propagated to the network.  It returns
+// false when the transaction is not in the pool, in which case it is not
+// added.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) AddUnbroadcastTx(hash *chainhash.Hash) bool {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	if !mp.isTransactionInPool(hash) {
+		return false
+	}
+	mp.unbroadcast[*hash] = struct{}{}
+	return true
+}
+
+// RemoveUnbroadcastTx removes the passed transaction from the set of locally
+// submitted transactions which no peer has requested yet.  It should be called
+// once a peer requests the transaction.  Transactions which are removed from
+// the pool are also removed from the set.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) RemoveUnbroadcastTx(hash *chainhash.Hash) {
+	mp.mtx.Lock()
+	if _, ok := mp.unbroadcast[*hash]; ok {
+		log.Debugf("Removing transaction %v which was requested by a "+
+			"peer from the unbroadcast set", hash)
+		delete(mp.unbroadcast, *hash)
+	}
+	mp.mtx.Unlock()
+}
+
+// UnbroadcastTxns returns the descriptors of the locally submitted transactions
+// in the pool which no peer has requested yet.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) UnbroadcastTxns() []*TxDesc {
+	mp.mtx.RLock()
+	descs := make([]*TxDesc, 0, len(mp.unbroadcast))
+	for hash := range mp.unbroadcast {
+		descs = append(descs, mp.pool[hash])
+	}
+	mp.mtx.RUnlock()
+
+	return descs
+}
+
+// UnbroadcastCount returns the number of locally submitted transactions in the
+// pool which no peer has requested yet.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) UnbroadcastCount() int {
+	mp.mtx.RLock()
+	count := len(mp.unbroadcast)
+	mp.mtx.RUnlock()
+
+	return count
+}
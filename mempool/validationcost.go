@@ -0,0 +1,87 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// sigCheckCostUnits is the number of validation cost units charged for
+	// each signature verification.  A cost unit roughly corresponds to a
+	// microsecond of validation on common hardware.
+	sigCheckCostUnits = 50
+
+	// scriptBytesPerCostUnit is the number of signature script and witness
+	// bytes which are charged a single validation cost unit.
+	scriptBytesPerCostUnit = 64
+
+	// hashBytesPerCostUnit is the number of bytes hashed to compute
+	// signature hashes which are charged a single validation cost unit.
+	hashBytesPerCostUnit = 1024
+
+	// witnessSigHashBytes is the approximate number of bytes hashed for each
+	// signature of a witness input.  The BIP0143 and BIP0341 signature
+	// hashes reuse the midstate of the transaction wide hashes, so unlike
+	// legacy inputs, the amount hashed doesn't grow with the size of the
+	// transaction.
+	witnessSigHashBytes = 256
+)
+
+// ValidationCost is an estimate of the work required to validate the scripts
+// of a transaction.  It is derived from the transaction alone, without the
+// outputs it spends, so it is available for transactions which are rejected
+// before their inputs are known.
+type ValidationCost struct {
+	// SigChecks is the estimated number of signature verifications.  Each
+	// input is assumed to require at least one.
+	SigChecks int64
+
+	// ScriptBytes is the total size of the signature scripts and witnesses
+	// which are executed.
+	ScriptBytes int64
+
+	// HashBytes is the estimated number of bytes hashed to compute the
+	// signature hashes.  Each signature of a legacy input hashes the whole
+	// transaction, which makes it quadratic in the number of inputs.
+	HashBytes int64
+}
+
+// Units returns the validation cost expressed in a single number of cost units
+// which roughly correspond to microseconds of validation.
+func (c ValidationCost) Units() int64 {
+	return c.SigChecks*sigCheckCostUnits +
+		c.ScriptBytes/scriptBytesPerCostUnit +
+		c.HashBytes/hashBytesPerCostUnit
+}
+
+// EstimateValidationCost returns an estimate of the work required to validate
+// the scripts of the passed transaction.
+func EstimateValidationCost(tx *btcutil.Tx) ValidationCost {
+	msgTx := tx.MsgTx()
+	strippedSize := int64(msgTx.SerializeSizeStripped())
+
+	var cost ValidationCost
+	for _, txIn := range msgTx.TxIn {
+		sigChecks := int64(txscript.GetSigOpCount(txIn.SignatureScript))
+		if sigChecks == 0 {
+			sigChecks = 1
+		}
+		cost.SigChecks += sigChecks
+
+		cost.ScriptBytes += int64(len(txIn.SignatureScript))
+		for _, item := range txIn.Witness {
+			cost.ScriptBytes += int64(len(item))
+		}
+
+		if len(txIn.Witness) == 0 {
+			cost.HashBytes += sigChecks * strippedSize
+		} else {
+			cost.HashBytes += sigChecks * witnessSigHashBytes
+		}
+	}
+	return cost
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// costTestTx returns a transaction with the passed number of inputs which
+// either use the passed signature script or a witness with a signature and a
+// public key.
+func costTestTx(numInputs int, sigScript []byte, witness bool) *btcutil.Tx {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	for i := 0; i < numInputs; i++ {
+		prevOut := wire.NewOutPoint(&chainhash.Hash{}, uint32(i))
+		txIn := wire.NewTxIn(prevOut, sigScript, nil)
+		if witness {
+			txIn.Witness = wire.TxWitness{
+				bytes.Repeat([]byte{0x30}, 72),
+				bytes.Repeat([]byte{0x02}, 33),
+			}
+		}
+		msgTx.AddTxIn(txIn)
+	}
+	msgTx.AddTxOut(wire.NewTxOut(1000, []byte{txscript.OP_TRUE}))
+	return btcutil.NewTx(msgTx)
+}
+
+// TestEstimateValidationCost ensures the validation cost estimate accounts for
+// the signature verifications and the script bytes of each input, and that the
+// hashing cost of legacy inputs grows quadratically while witness inputs only
+// grow linearly.
+func TestEstimateValidationCost(t *testing.T) {
+	p2pkhSigScript := bytes.Repeat([]byte{0x01}, 107)
+
+	legacy := EstimateValidationCost(costTestTx(100, p2pkhSigScript, false))
+	if legacy.SigChecks != 100 {
+		t.Fatalf("unexpected legacy sig checks - got %d, want 100",
+			legacy.SigChecks)
+	}
+	if legacy.ScriptBytes != 100*107 {
+		t.Fatalf("unexpected legacy script bytes - got %d, want %d",
+			legacy.ScriptBytes, 100*107)
+	}
+
+	// Doubling the number of legacy inputs must more than double the cost
+	// since every signature hashes the whole transaction.
+	legacy2 := EstimateValidationCost(costTestTx(200, p2pkhSigScript, false))
+	if legacy2.HashBytes < 4*legacy.HashBytes-legacy.HashBytes/10 {
+		t.Fatalf("legacy hash bytes did not grow quadratically - got "+
+			"%d for 100 inputs and %d for 200 inputs",
+			legacy.HashBytes, legacy2.HashBytes)
+	}
+
+	// Doubling the number of witness inputs must only double the hashing
+	// cost.
+	witness := EstimateValidationCost(costTestTx(100, nil, true))
+	witness2 := EstimateValidationCost(costTestTx(200, nil, true))
+	if witness.ScriptBytes != 100*(72+33) {
+		t.Fatalf("unexpected witness script bytes - got %d, want %d",
+			witness.ScriptBytes, 100*(72+33))
+	}
+	if witness2.HashBytes != 2*witness.HashBytes {
+		t.Fatalf("witness hash bytes did not grow linearly - got %d "+
+			"for 100 inputs and %d for 200 inputs",
+			witness.HashBytes, witness2.HashBytes)
+	}
+	if witness2.Units() >= legacy2.Units() {
+		t.Fatalf("witness cost %d is not below legacy cost %d",
+			witness2.Units(), legacy2.Units())
+	}
+
+	// Signature operations in signature scripts are counted as additional
+	// signature verifications.
+	multisig := EstimateValidationCost(costTestTx(1,
+		[]byte{txscript.OP_CHECKMULTISIG}, false))
+	if multisig.SigChecks != txscript.MaxPubKeysPerMultiSig {
+		t.Fatalf("unexpected multisig sig checks - got %d, want %d",
+			multisig.SigChecks, txscript.MaxPubKeysPerMultiSig)
+	}
+}
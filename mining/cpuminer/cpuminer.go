@@ -188,10 +188,14 @@ func (m *CPUMiner) submitBlock(block *btcutil.Block) bool {
 		return false
 	}
 
-	// The block was accepted.
-	coinbaseTx := block.MsgBlock().Transactions[0].TxOut[0]
+	// The block was accepted.  The amount is the total of the coinbase
+	// outputs since it may be split among several payouts.
+	var amount int64
+	for _, txOut := range msgBlock.Transactions[0].TxOut {
+		amount += txOut.Value
+	}
 	log.Infof("Block submitted via CPU miner accepted (hash %s, "+
-		"amount %v)", block.Hash(), btcutil.Amount(coinbaseTx.Value))
+		"amount %v)", block.Hash(), btcutil.Amount(amount))
 	return true
 }
 
@@ -6,7 +6,6 @@ package mining
 
 import (
 	"bytes"
-	"container/heap"
 	"fmt"
 	"time"
 
@@ -51,6 +50,29 @@ type TxDesc struct {
 
 	// FeePerKB is the fee the transaction pays in Satoshi per 1000 bytes.
 	FeePerKB int64
+
+	// FeeDelta is the amount added to the fee of the transaction when it
+	// is considered for inclusion in new blocks, which allows operators to
+	// prioritize or deprioritize transactions.  The transaction does not
+	// actually pay it, so it is not collected by the coinbase.
+	FeeDelta int64
+
+	// AncestorCount, AncestorVSize, and AncestorFee are the number, total
+	// virtual size, and total modified fee of the transaction along with
+	// all of its unconfirmed ancestors in the source pool.  Their ratio is the fee
+	// rate the transaction effectively pays when its ancestors are mined
+	// for its fee, which is known as child-pays-for-parent (CPFP).  They
+	// are zero when the source pool does not track ancestors.
+	AncestorCount int
+	AncestorVSize int64
+	AncestorFee   int64
+}
+
+// ModifiedFee returns the fee of the transaction along with its fee delta,
+// which is the fee it is considered to pay when it is selected for inclusion in
+// new blocks.
+func (d *TxDesc) ModifiedFee() int64 {
+	return d.Fee + d.FeeDelta
 }
 
 // TxSource represents a source of transactions to consider for inclusion in
@@ -72,117 +94,6 @@ type TxSource interface {
 	HaveTransaction(hash *chainhash.Hash) bool
 }
 
-// txPrioItem houses a transaction along with extra information that allows the
-// transaction to be prioritized and track dependencies on other transactions
-// which have not been mined into a block yet.
-type txPrioItem struct {
-	tx       *btcutil.Tx
-	fee      int64
-	priority float64
-	feePerKB int64
-
-	// dependsOn holds a map of transaction hashes which this one depends
-	// on.  It will only be set when the transaction references other
-	// transactions in the source pool and hence must come after them in
-	// a block.
-	dependsOn map[chainhash.Hash]struct{}
-}
-
-// txPriorityQueueLessFunc describes a function that can be used as a compare
-// function for a transaction priority queue (txPriorityQueue).
-type txPriorityQueueLessFunc func(*txPriorityQueue, int, int) bool
-
-// txPriorityQueue implements a priority queue of txPrioItem elements that
-// supports an arbitrary compare function as defined by txPriorityQueueLessFunc.
-type txPriorityQueue struct {
-	lessFunc txPriorityQueueLessFunc
-	items    []*txPrioItem
-}
-
-// Len returns the number of items in the priority queue.  It is part of the
-// heap.Interface implementation.
-func (pq *txPriorityQueue) Len() int {
-	return len(pq.items)
-}
-
-// Less returns whether the item in the priority queue with index i should sort
-// before the item with index j by deferring to the assigned less function.  It
-// is part of the heap.Interface implementation.
-func (pq *txPriorityQueue) Less(i, j int) bool {
-	return pq.lessFunc(pq, i, j)
-}
-
-// Swap swaps the items at the passed indices in the priority queue.  It is
-// part of the heap.Interface implementation.
-func (pq *txPriorityQueue) Swap(i, j int) {
-	pq.items[i], pq.items[j] = pq.items[j], pq.items[i]
-}
-
-// Push pushes the passed item onto the priority queue.  It is part of the
-// heap.Interface implementation.
-func (pq *txPriorityQueue) Push(x interface{}) {
-	pq.items = append(pq.items, x.(*txPrioItem))
-}
-
-// Pop removes the highest priority item (according to Less) from the priority
-// queue and returns it.  It is part of the heap.Interface implementation.
-func (pq *txPriorityQueue) Pop() interface{} {
-	n := len(pq.items)
-	item := pq.items[n-1]
-	pq.items[n-1] = nil
-	pq.items = pq.items[0 : n-1]
-	return item
-}
-
-// SetLessFunc sets the compare function for the priority queue to the provided
-// function.  It also invokes heap.Init on the priority queue using the new
-// function so it can immediately be used with heap.Push/Pop.
-func (pq *txPriorityQueue) SetLessFunc(lessFunc txPriorityQueueLessFunc) {
-	pq.lessFunc = lessFunc
-	heap.Init(pq)
-}
-
-// txPQByPriority sorts a txPriorityQueue by transaction priority and then fees
-// per kilobyte.
-func txPQByPriority(pq *txPriorityQueue, i, j int) bool {
-	// Using > here so that pop gives the highest priority item as opposed
-	// to the lowest.  Sort by priority first, then fee.
-	if pq.items[i].priority == pq.items[j].priority {
-		return pq.items[i].feePerKB > pq.items[j].feePerKB
-	}
-	return pq.items[i].priority > pq.items[j].priority
-
-}
-
-// txPQByFee sorts a txPriorityQueue by fees per kilobyte and then transaction
-// priority.
-func txPQByFee(pq *txPriorityQueue, i, j int) bool {
-	// Using > here so that pop gives the highest fee item as opposed
-	// to the lowest.  Sort by fee first, then priority.
-	if pq.items[i].feePerKB == pq.items[j].feePerKB {
-		return pq.items[i].priority > pq.items[j].priority
-	}
-	return pq.items[i].feePerKB > pq.items[j].feePerKB
-}
-
-// newTxPriorityQueue returns a new transaction priority queue that reserves the
-// passed amount of space for the elements.  The new priority queue uses either
-// the txPQByPriority or the txPQByFee compare function depending on the
-// sortByFee parameter and is already initialized for use with heap.Push/Pop.
-// The priority queue can grow larger than the reserved space, but extra copies
-// of the underlying array can be avoided by reserving a sane value.
-func newTxPriorityQueue(reserve int, sortByFee bool) *txPriorityQueue {
-	pq := &txPriorityQueue{
-		items: make([]*txPrioItem, 0, reserve),
-	}
-	if sortByFee {
-		pq.SetLessFunc(txPQByFee)
-	} else {
-		pq.SetLessFunc(txPQByPriority)
-	}
-	return pq
-}
-
 // BlockTemplate houses a block that has yet to be solved along with additional
 // details about the fees and the number of signature operations for each
 // transaction in the block.
@@ -248,9 +159,13 @@ func standardCoinbaseScript(nextBlockHeight int32, extraNonce uint64) ([]byte, e
 // based on the passed block height to the provided address.  When the address
 // is nil, the coinbase transaction will instead be redeemable by anyone.
 //
+// The coinbase transaction also has an output for each of the passed payouts
+// when the address is not nil.  Their values are zero until the value of the
+// coinbase is split among the outputs by splitCoinbaseValue.
+//
 // See the comment for NewBlockTemplate for more information about why the nil
 // address handling is useful.
-func createCoinbaseTx(params *chaincfg.Params, coinbaseScript []byte, nextBlockHeight int32, addr btcutil.Address) (*btcutil.Tx, error) {
+func createCoinbaseTx(params *chaincfg.Params, coinbaseScript []byte, nextBlockHeight int32, addr btcutil.Address, payouts []CoinbasePayout) (*btcutil.Tx, error) {
 	// Create the script to pay to the provided payment address if one was
 	// specified.  Otherwise create a script that allows the coinbase to be
 	// redeemable by anyone.
@@ -283,9 +198,56 @@ func createCoinbaseTx(params *chaincfg.Params, coinbaseScript []byte, nextBlockH
 		Value:    blockchain.CalcBlockSubsidy(nextBlockHeight, params),
 		PkScript: pkScript,
 	})
+	if addr != nil {
+		for _, payout := range payouts {
+			pkScript, err := txscript.PayToAddrScript(payout.Address)
+			if err != nil {
+				return nil, err
+			}
+			tx.AddTxOut(&wire.TxOut{PkScript: pkScript})
+		}
+	}
 	return btcutil.NewTx(tx), nil
 }
 
+// splitCoinbaseValue splits the value of the passed coinbase transaction, which
+// must have been created by createCoinbaseTx with the passed payouts, among its
+// outputs.  The total value of the coinbase must be held by the first output,
+// which pays to the address of the template.  Each payout is paid its
+// percentage of the total value rounded down, and the remainder is left in the
+// first output.  An error is returned when the outputs don't match the payouts
+// or the values of the outputs don't add up to the total value.
+func splitCoinbaseValue(tx *wire.MsgTx, payouts []CoinbasePayout) error {
+	if len(tx.TxOut) != len(payouts)+1 {
+		return fmt.Errorf("coinbase has %d outputs for %d payouts",
+			len(tx.TxOut), len(payouts))
+	}
+
+	total := tx.TxOut[0].Value
+	remaining := total
+	for i, payout := range payouts {
+		value := int64(float64(total) * payout.Percent / 100)
+		if value < 0 || value > remaining {
+			return fmt.Errorf("coinbase payout of %v%% to %s exceeds "+
+				"the remaining value %v", payout.Percent,
+				payout.Address, btcutil.Amount(remaining))
+		}
+		tx.TxOut[i+1].Value = value
+		remaining -= value
+	}
+	tx.TxOut[0].Value = remaining
+
+	var sum int64
+	for _, txOut := range tx.TxOut {
+		sum += txOut.Value
+	}
+	if sum != total {
+		return fmt.Errorf("coinbase outputs pay %v instead of %v",
+			btcutil.Amount(sum), btcutil.Amount(total))
+	}
+	return nil
+}
+
 // spendTransaction updates the passed view by marking the inputs to the passed
 // transaction as spent.  It also adds all outputs in the passed transaction
 // which are not provably unspendable as available unspent transaction outputs.
@@ -301,19 +263,6 @@ func spendTransaction(utxoView *blockchain.UtxoViewpoint, tx *btcutil.Tx, height
 	return nil
 }
 
-// logSkippedDeps logs any dependencies which are also skipped as a result of
-// skipping a transaction while generating a block template at the trace level.
-func logSkippedDeps(tx *btcutil.Tx, deps map[chainhash.Hash]*txPrioItem) {
-	if deps == nil {
-		return
-	}
-
-	for _, item := range deps {
-		log.Tracef("Skipping tx %s since it depends on %s\n",
-			item.tx.Hash(), tx.Hash())
-	}
-}
-
 // MinimumMedianTime returns the minimum allowed timestamp for a block building
 // on the end of the provided best chain.  In particular, it is one second after
 // the median timestamp of the last several blocks per the chain consensus
@@ -353,6 +302,10 @@ type BlkTmplGenerator struct {
 	timeSource  blockchain.MedianTimeSource
 	sigCache    *txscript.SigCache
 	hashCache   *txscript.HashCache
+
+	// templateHook is invoked with every newly generated template when it
+	// is set.
+	templateHook func(*BlockTemplate)
 }
 
 // NewBlkTmplGenerator returns a new block template generator for the given
@@ -387,60 +340,78 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // coinbase which will replace the one generated for the block template.  Thus
 // the need to have configured address can be avoided.
 //
-// The transactions selected and included are prioritized according to several
-// factors.  First, each transaction has a priority calculated based on its
-// value, age of inputs, and size.  Transactions which consist of larger
-// amounts, older inputs, and small sizes have the highest priority.  Second, a
-// fee per kilobyte is calculated for each transaction.  Transactions with a
-// higher fee per kilobyte are preferred.  Finally, the block generation related
-// policy settings are all taken into account.
+// When the coinbase pays to an address, each of the outputs of the
+// CoinbasePayouts policy setting is paid its fixed percentage of the value of
+// the coinbase, which is the block subsidy along with the fees of the selected
+// transactions, and the remainder is paid to the address.
 //
-// Transactions which only spend outputs from other transactions already in the
-// block chain are immediately added to a priority queue which either
-// prioritizes based on the priority (then fee per kilobyte) or the fee per
-// kilobyte (then priority) depending on whether or not the BlockPrioritySize
-// policy setting allots space for high-priority transactions.  Transactions
-// which spend outputs from other transactions in the source pool are added to a
-// dependency map so they can be added to the priority queue once the
-// transactions they depend on have been included.
+// The transactions are selected by the fee rate of their packages.  The package
+// of a transaction consists of the transaction along with its ancestors in the
+// source pool which have not been included in the block yet, since they all
+// have to be included before it.  The transaction whose package pays the
+// highest fee per kilobyte is selected repeatedly, and its package is added to
+// the block as a whole when it fits.  The packages of the descendants of the
+// added transactions no longer contain them, so their fee rates are updated
+// accordingly.  This allows a transaction with a high fee to pay for its
+// parents (child-pays-for-parent, or CPFP), which captures considerably more
+// fees than selecting transactions by their individual fee rates.
 //
-// Once the high-priority area (if configured) has been filled with
-// transactions, or the priority falls below what is considered high-priority,
-// the priority queue is updated to prioritize by fees per kilobyte (then
-// priority).
+// When the fee per kilobyte of a package drops below the TxMinFreeFee policy
+// setting, the package will be skipped unless the BlockMinWeight policy
+// setting is nonzero, in which case the block will be filled with the
+// low-fee/free packages until the block weight reaches that minimum weight.
 //
-// When the fees per kilobyte drop below the TxMinFreeFee policy setting, the
-// transaction will be skipped unless the BlockMinSize policy setting is
-// nonzero, in which case the block will be filled with the low-fee/free
-// transactions until the block size reaches that minimum size.
+// Any packages which would cause the block to exceed the BlockMaxWeight or
+// BlockMaxSigOpCost policy settings are skipped.  The BlockReservedWeight and
+// BlockReservedSigOpCost policy settings count towards those limits in place of
+// the block header and the coinbase transaction when they are higher.
 //
-// Any transactions which would cause the block to exceed the BlockMaxSize
-// policy setting, exceed the maximum allowed signature operations per block, or
-// otherwise cause the block to be invalid are skipped.
+// Transactions are selected by their fees modified by their fee deltas, which
+// allows operators to prioritize transactions.  Since the fee deltas aren't
+// actually paid, the coinbase only collects the fees.
+//
+// Transactions which would otherwise cause the block to be invalid are skipped
+// along with their descendants.
 //
 // Given the above, a block generated by this function is of the following form:
 //
-//   -----------------------------------  --  --
-//  |      Coinbase Transaction         |   |   |
-//  |-----------------------------------|   |   |
-//  |                                   |   |   | ----- policy.BlockPrioritySize
-//  |   High-priority Transactions      |   |   |
-//  |                                   |   |   |
-//  |-----------------------------------|   | --
-//  |                                   |   |
+//   -----------------------------------  --
+//  |      Coinbase Transaction         |   |
+//  |-----------------------------------|   |
 //  |                                   |   |
-//  |                                   |   |--- policy.BlockMaxSize
-//  |  Transactions prioritized by fee  |   |
-//  |  until <= policy.TxMinFreeFee     |   |
 //  |                                   |   |
+//  |  Packages prioritized by fee      |   |
+//  |  until <= policy.TxMinFreeFee     |   |--- policy.BlockMaxWeight
 //  |                                   |   |
 //  |                                   |   |
 //  |-----------------------------------|   |
-//  |  Low-fee/Non high-priority (free) |   |
-//  |  transactions (while block size   |   |
-//  |  <= policy.BlockMinSize)          |   |
+//  |  Low-fee/free packages (while     |   |
+//  |  block weight <=                  |   |
+//  |  policy.BlockMinWeight)           |   |
 //   -----------------------------------  --
 func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*BlockTemplate, error) {
+	template, err := g.newBlockTemplate(payToAddress, g.policy)
+	if err != nil {
+		return nil, err
+	}
+	if g.templateHook != nil {
+		g.templateHook(template)
+	}
+	return template, nil
+}
+
+// NewBlockTemplateWithPolicy returns a new block template like NewBlockTemplate,
+// except that the passed policy is used instead of the policy of the generator.
+// This allows callers such as the getblocktemplate RPC to honor requests for
+// templates within lower limits.  The template hook is not invoked for the
+// returned template since it does not follow the policy of the generator.
+func (g *BlkTmplGenerator) NewBlockTemplateWithPolicy(payToAddress btcutil.Address, policy *Policy) (*BlockTemplate, error) {
+	return g.newBlockTemplate(payToAddress, policy)
+}
+
+// newBlockTemplate returns a new block template using the passed policy.  See
+// NewBlockTemplate for details.
+func (g *BlkTmplGenerator) newBlockTemplate(payToAddress btcutil.Address, policy *Policy) (*BlockTemplate, error) {
 	// Extend the most recently known best block.
 	best := g.chain.BestSnapshot()
 	nextBlockHeight := best.Height + 1
@@ -459,52 +430,35 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress btcutil.Address) (*Bloc
 		return nil, err
 	}
 	coinbaseTx, err := createCoinbaseTx(g.chainParams, coinbaseScript,
-		nextBlockHeight, payToAddress)
+		nextBlockHeight, payToAddress, policy.CoinbasePayouts)
 	if err != nil {
 		return nil, err
 	}
 	coinbaseSigOpCost := int64(blockchain.CountSigOps(coinbaseTx)) * blockchain.WitnessScaleFactor
 
-	// Get the current source transactions and create a priority queue to
-	// hold the transactions which are ready for inclusion into a block
-	// along with some priority related and fee metadata.  Reserve the same
-	// number of items that are available for the priority queue.  Also,
-	// choose the initial sort order for the priority queue based on whether
-	// or not there is an area allocated for high-priority transactions.
+	// Query the version bits state to see if segwit has been activated, if
+	// so then this means that we'll include any transactions with witness
+	// data in the mempool, and also add the witness commitment as an
+	// OP_RETURN output in the coinbase transaction.
+	segwitState, err := g.chain.ThresholdState(chaincfg.DeploymentSegwit)
+	if err != nil {
+		return nil, err
+	}
+	segwitActive := segwitState == blockchain.ThresholdActive
+
+	// Get the current source transactions and create a candidate for each
+	// transaction which may be included in the block.  The candidates are
+	// also kept by hash, so the candidates they depend on can be linked up
+	// below.  Also create a utxo view to house all of the outputs from the
+	// main chain the candidates spend so multiple lookups can be avoided.
 	sourceTxns := g.txSource.MiningDescs()
-	sortedByFee := g.policy.BlockPrioritySize == 0
-	priorityQueue := newTxPriorityQueue(len(sourceTxns), sortedByFee)
-
-	// Create a slice to hold the transactions to be included in the
-	// generated block with reserved space.  Also create a utxo view to
-	// house all of the input transactions so multiple lookups can be
-	// avoided.
-	blockTxns := make([]*btcutil.Tx, 0, len(sourceTxns))
-	blockTxns = append(blockTxns, coinbaseTx)
+	candidates := make([]*packageTx, 0, len(sourceTxns))
+	candidatesByHash := make(map[chainhash.Hash]*packageTx, len(sourceTxns))
 	blockUtxos := blockchain.NewUtxoViewpoint()
 
-	// dependers is used to track transactions which depend on another
-	// transaction in the source pool.  This, in conjunction with the
-	// dependsOn map kept with each dependent transaction helps quickly
-	// determine which dependent transactions are now eligible for inclusion
-	// in the block once each transaction has been included.
-	dependers := make(map[chainhash.Hash]map[chainhash.Hash]*txPrioItem)
-
-	// Create slices to hold the fees and number of signature operations
-	// for each of the selected transactions and add an entry for the
-	// coinbase.  This allows the code below to simply append details about
-	// a transaction as it is selected for inclusion in the final block.
-	// However, since the total fees aren't known yet, use a dummy value for
-	// the coinbase fee which will be updated later.
-	txFees := make([]int64, 0, len(sourceTxns))
-	txSigOpCosts := make([]int64, 0, len(sourceTxns))
-	txFees = append(txFees, -1) // Updated once known
-	txSigOpCosts = append(txSigOpCosts, coinbaseSigOpCost)
-
 	log.Debugf("Considering %d transactions for inclusion to new block",
 		len(sourceTxns))
 
-mempoolLoop:
 	for _, txDesc := range sourceTxns {
 		// A block can't have more than one coinbase or contain
 		// non-finalized transactions.
@@ -520,6 +474,14 @@ mempoolLoop:
 			continue
 		}
 
+		// If segregated witness has not been activated yet, then we
+		// shouldn't include any witness transactions in the block.
+		if !segwitActive && tx.HasWitness() {
+			log.Tracef("Skipping witness tx %s since segwit is not "+
+				"active", tx.Hash())
+			continue
+		}
+
 		// Fetch all of the utxos referenced by the this transaction.
 		// NOTE: This intentionally does not fetch inputs from the
 		// mempool since a transaction which depends on other
@@ -532,272 +494,203 @@ mempoolLoop:
 			continue
 		}
 
-		// Setup dependencies for any transactions which reference
-		// other transactions in the mempool so they can be properly
-		// ordered below.
-		prioItem := &txPrioItem{tx: tx}
-		for _, txIn := range tx.MsgTx().TxIn {
-			originHash := &txIn.PreviousOutPoint.Hash
-			entry := utxos.LookupEntry(txIn.PreviousOutPoint)
-			if entry == nil || entry.IsSpent() {
-				if !g.txSource.HaveTransaction(originHash) {
-					log.Tracef("Skipping tx %s because it "+
-						"references unspent output %s "+
-						"which is not available",
-						tx.Hash(), txIn.PreviousOutPoint)
-					continue mempoolLoop
-				}
-
-				// The transaction is referencing another
-				// transaction in the source pool, so setup an
-				// ordering dependency.
-				deps, exists := dependers[*originHash]
-				if !exists {
-					deps = make(map[chainhash.Hash]*txPrioItem)
-					dependers[*originHash] = deps
-				}
-				deps[*prioItem.tx.Hash()] = prioItem
-				if prioItem.dependsOn == nil {
-					prioItem.dependsOn = make(
-						map[chainhash.Hash]struct{})
-				}
-				prioItem.dependsOn[*originHash] = struct{}{}
-
-				// Skip the check below. We already know the
-				// referenced transaction is available.
-				continue
-			}
-		}
-
-		// Calculate the final transaction priority using the input
-		// value age sum as well as the adjusted transaction size.  The
-		// formula is: sum(inputValue * inputAge) / adjustedTxSize
-		prioItem.priority = CalcPriority(tx.MsgTx(), utxos,
-			nextBlockHeight)
-
-		// Calculate the fee in Satoshi/kB.
-		prioItem.feePerKB = txDesc.FeePerKB
-		prioItem.fee = txDesc.Fee
-
-		// Add the transaction to the priority queue to mark it ready
-		// for inclusion in the block unless it has dependencies.
-		if prioItem.dependsOn == nil {
-			heap.Push(priorityQueue, prioItem)
-		}
-
 		// Merge the referenced outputs from the input transactions to
 		// this transaction into the block utxo view.  This allows the
 		// code below to avoid a second lookup.
 		mergeUtxoView(blockUtxos, utxos)
-	}
-
-	log.Tracef("Priority queue len %d, dependers len %d",
-		priorityQueue.Len(), len(dependers))
 
-	// The starting block size is the size of the block header plus the max
-	// possible transaction count size, plus the size of the coinbase
-	// transaction.
-	blockWeight := uint32((blockHeaderOverhead * blockchain.WitnessScaleFactor) +
-		blockchain.GetTransactionWeight(coinbaseTx))
-	blockSigOpCost := coinbaseSigOpCost
-	totalFees := int64(0)
-
-	// Query the version bits state to see if segwit has been activated, if
-	// so then this means that we'll include any transactions with witness
-	// data in the mempool, and also add the witness commitment as an
-	// OP_RETURN output in the coinbase transaction.
-	segwitState, err := g.chain.ThresholdState(chaincfg.DeploymentSegwit)
-	if err != nil {
-		return nil, err
+		weight := blockchain.GetTransactionWeight(tx)
+		candidate := &packageTx{
+			tx:       tx,
+			hash:     *tx.Hash(),
+			fee:      txDesc.ModifiedFee(),
+			feeDelta: txDesc.FeeDelta,
+			weight:   weight,
+			vsize: (weight + (blockchain.WitnessScaleFactor - 1)) /
+				blockchain.WitnessScaleFactor,
+			hasWitness: tx.HasWitness(),
+			index:      -1,
+		}
+		candidates = append(candidates, candidate)
+		candidatesByHash[candidate.hash] = candidate
 	}
-	segwitActive := segwitState == blockchain.ThresholdActive
-
-	witnessIncluded := false
-
-	// Choose which transactions make it into the block.
-	for priorityQueue.Len() > 0 {
-		// Grab the highest priority (or highest fee per kilobyte
-		// depending on the sort order) transaction.
-		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
-		tx := prioItem.tx
 
-		switch {
-		// If segregated witness has not been activated yet, then we
-		// shouldn't include any witness transactions in the block.
-		case !segwitActive && tx.HasWitness():
-			continue
-
-		// Otherwise, Keep track of if we've included a transaction
-		// with witness data or not. If so, then we'll need to include
-		// the witness commitment as the last output in the coinbase
-		// transaction.
-		case segwitActive && !witnessIncluded && tx.HasWitness():
-			// If we're about to include a transaction bearing
-			// witness data, then we'll also need to include a
-			// witness commitment in the coinbase transaction.
-			// Therefore, we account for the additional weight
-			// within the block with a model coinbase tx with a
-			// witness commitment.
-			coinbaseCopy := btcutil.NewTx(coinbaseTx.MsgTx().Copy())
-			coinbaseCopy.MsgTx().TxIn[0].Witness = [][]byte{
-				bytes.Repeat([]byte("a"),
-					blockchain.CoinbaseWitnessDataLen),
+	// Setup dependencies for any candidates which reference other
+	// candidates so they can be properly ordered below.  Candidates which
+	// reference outputs which are neither in the main chain nor created by
+	// another candidate are excluded along with their descendants.
+	for _, candidate := range candidates {
+		parents := make(map[*packageTx]struct{})
+		for _, txIn := range candidate.tx.MsgTx().TxIn {
+			entry := blockUtxos.LookupEntry(txIn.PreviousOutPoint)
+			if entry != nil && !entry.IsSpent() {
+				continue
 			}
-			coinbaseCopy.MsgTx().AddTxOut(&wire.TxOut{
-				PkScript: bytes.Repeat([]byte("a"),
-					blockchain.CoinbaseWitnessPkScriptLength),
-			})
-
-			// In order to accurately account for the weight
-			// addition due to this coinbase transaction, we'll add
-			// the difference of the transaction before and after
-			// the addition of the commitment to the block weight.
-			weightDiff := blockchain.GetTransactionWeight(coinbaseCopy) -
-				blockchain.GetTransactionWeight(coinbaseTx)
 
-			blockWeight += uint32(weightDiff)
-
-			witnessIncluded = true
-		}
-
-		// Grab any transactions which depend on this one.
-		deps := dependers[*tx.Hash()]
-
-		// Enforce maximum block size.  Also check for overflow.
-		txWeight := uint32(blockchain.GetTransactionWeight(tx))
-		blockPlusTxWeight := blockWeight + txWeight
-		if blockPlusTxWeight < blockWeight ||
-			blockPlusTxWeight >= g.policy.BlockMaxWeight {
-
-			log.Tracef("Skipping tx %s because it would exceed "+
-				"the max block weight", tx.Hash())
-			logSkippedDeps(tx, deps)
-			continue
+			parent, ok := candidatesByHash[txIn.PreviousOutPoint.Hash]
+			if !ok {
+				log.Tracef("Skipping tx %s because it references "+
+					"unspent output %s which is not available",
+					candidate.hash, txIn.PreviousOutPoint)
+				candidate.excluded = true
+				continue
+			}
+			if _, ok := parents[parent]; ok {
+				continue
+			}
+			parents[parent] = struct{}{}
+			candidate.parents = append(candidate.parents, parent)
+			parent.children = append(parent.children, candidate)
 		}
+	}
 
-		// Enforce maximum signature operation cost per block.  Also
-		// check for overflow.
-		sigOpCost, err := blockchain.GetSigOpCost(tx, false,
-			blockUtxos, true, segwitActive)
+	// Calculate the signature operation cost of the candidates up front,
+	// since the packages are limited by it as a whole.  The cost depends on
+	// the outputs the candidates spend, including the outputs of other
+	// candidates, so they are looked up in a separate view which also
+	// contains the outputs of all candidates.
+	sigOpUtxos := blockchain.NewUtxoViewpoint()
+	mergeUtxoView(sigOpUtxos, blockUtxos)
+	for _, candidate := range candidates {
+		sigOpUtxos.AddTxOuts(candidate.tx, nextBlockHeight)
+	}
+	for _, candidate := range candidates {
+		sigOpCost, err := blockchain.GetSigOpCost(candidate.tx, false,
+			sigOpUtxos, true, segwitActive)
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
-				"GetSigOpCost: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
-		}
-		if blockSigOpCost+int64(sigOpCost) < blockSigOpCost ||
-			blockSigOpCost+int64(sigOpCost) > blockchain.MaxBlockSigOpsCost {
-			log.Tracef("Skipping tx %s because it would "+
-				"exceed the maximum sigops per block", tx.Hash())
-			logSkippedDeps(tx, deps)
+				"GetSigOpCost: %v", candidate.hash, err)
+			candidate.excluded = true
 			continue
 		}
+		candidate.sigOpCost = int64(sigOpCost)
+	}
 
-		// Skip free transactions once the block is larger than the
-		// minimum block size.
-		if sortedByFee &&
-			prioItem.feePerKB < int64(g.policy.TxMinFreeFee) &&
-			blockPlusTxWeight >= g.policy.BlockMinWeight {
-
-			log.Tracef("Skipping tx %s with feePerKB %d "+
-				"< TxMinFreeFee %d and block weight %d >= "+
-				"minBlockWeight %d", tx.Hash(), prioItem.feePerKB,
-				g.policy.TxMinFreeFee, blockPlusTxWeight,
-				g.policy.BlockMinWeight)
-			logSkippedDeps(tx, deps)
-			continue
-		}
+	// If we're about to include a transaction bearing witness data, then
+	// we'll also need to include a witness commitment in the coinbase
+	// transaction.  Therefore, we account for the additional weight within
+	// the block with a model coinbase tx with a witness commitment.
+	coinbaseCopy := btcutil.NewTx(coinbaseTx.MsgTx().Copy())
+	coinbaseCopy.MsgTx().TxIn[0].Witness = [][]byte{
+		bytes.Repeat([]byte("a"), blockchain.CoinbaseWitnessDataLen),
+	}
+	coinbaseCopy.MsgTx().AddTxOut(&wire.TxOut{
+		PkScript: bytes.Repeat([]byte("a"),
+			blockchain.CoinbaseWitnessPkScriptLength),
+	})
 
-		// Prioritize by fee per kilobyte once the block is larger than
-		// the priority size or there are no more high-priority
-		// transactions.
-		if !sortedByFee && (blockPlusTxWeight >= g.policy.BlockPrioritySize ||
-			prioItem.priority <= MinHighPriority) {
-
-			log.Tracef("Switching to sort by fees per "+
-				"kilobyte blockSize %d >= BlockPrioritySize "+
-				"%d || priority %.2f <= minHighPriority %.2f",
-				blockPlusTxWeight, g.policy.BlockPrioritySize,
-				prioItem.priority, MinHighPriority)
-
-			sortedByFee = true
-			priorityQueue.SetLessFunc(txPQByFee)
-
-			// Put the transaction back into the priority queue and
-			// skip it so it is re-priortized by fees if it won't
-			// fit into the high-priority section or the priority
-			// is too low.  Otherwise this transaction will be the
-			// final one in the high-priority section, so just fall
-			// though to the code below so it is added now.
-			if blockPlusTxWeight > g.policy.BlockPrioritySize ||
-				prioItem.priority < MinHighPriority {
-
-				heap.Push(priorityQueue, prioItem)
-				continue
-			}
-		}
+	maxSigOpCost := int64(blockchain.MaxBlockSigOpsCost)
+	if policy.BlockMaxSigOpCost > 0 && policy.BlockMaxSigOpCost < maxSigOpCost {
+		maxSigOpCost = policy.BlockMaxSigOpCost
+	}
 
-		// Ensure the transaction inputs pass all of the necessary
-		// preconditions before allowing it to be added to the block.
-		_, err = blockchain.CheckTransactionInputs(tx, nextBlockHeight,
-			blockUtxos, g.chainParams)
-		if err != nil {
-			log.Tracef("Skipping tx %s due to error in "+
-				"CheckTransactionInputs: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
-		}
-		err = blockchain.ValidateTransactionScripts(tx, blockUtxos,
-			txscript.StandardVerifyFlags, g.sigCache,
-			g.hashCache)
-		if err != nil {
-			log.Tracef("Skipping tx %s due to error in "+
-				"ValidateTransactionScripts: %v", tx.Hash(), err)
-			logSkippedDeps(tx, deps)
-			continue
-		}
+	// Reserve the weight and signature operation cost of the policy for the
+	// block header and the coinbase transaction when they exceed those the
+	// coinbase transaction actually takes up, so miners can add to it.
+	coinbaseWeight := blockHeaderOverhead*blockchain.WitnessScaleFactor +
+		blockchain.GetTransactionWeight(coinbaseTx)
+	reservedWeight := coinbaseWeight
+	if int64(policy.BlockReservedWeight) > reservedWeight {
+		reservedWeight = int64(policy.BlockReservedWeight)
+	}
+	reservedSigOpCost := coinbaseSigOpCost
+	if policy.BlockReservedSigOpCost > reservedSigOpCost {
+		reservedSigOpCost = policy.BlockReservedSigOpCost
+	}
 
-		// Spend the transaction inputs in the block utxo view and add
-		// an entry for it to ensure any transactions which reference
-		// this one have it available as an input and can ensure they
-		// aren't double spending.
-		spendTransaction(blockUtxos, tx, nextBlockHeight)
-
-		// Add the transaction to the block, increment counters, and
-		// save the fees and signature operation counts to the block
-		// template.
-		blockTxns = append(blockTxns, tx)
-		blockWeight += txWeight
-		blockSigOpCost += int64(sigOpCost)
-		totalFees += prioItem.fee
-		txFees = append(txFees, prioItem.fee)
-		txSigOpCosts = append(txSigOpCosts, int64(sigOpCost))
-
-		log.Tracef("Adding tx %s (priority %.2f, feePerKB %.2f)",
-			prioItem.tx.Hash(), prioItem.priority, prioItem.feePerKB)
-
-		// Add transactions which depend on this one (and also do not
-		// have any other unsatisified dependencies) to the priority
-		// queue.
-		for _, item := range deps {
-			// Add the transaction to the priority queue if there
-			// are no more dependencies after this one.
-			delete(item.dependsOn, *tx.Hash())
-			if len(item.dependsOn) == 0 {
-				heap.Push(priorityQueue, item)
+	// Choose which transactions make it into the block.  The starting block
+	// weight is the weight of the block header plus the max possible
+	// transaction count size, plus the weight of the coinbase transaction,
+	// unless more is reserved.
+	selector := &packageSelector{
+		blockWeight:    reservedWeight,
+		blockSigOpCost: reservedSigOpCost,
+		maxWeight:      int64(policy.BlockMaxWeight),
+		maxSigOpCost:   maxSigOpCost,
+		minWeight:      int64(policy.BlockMinWeight),
+		minFeePerKB:    int64(policy.TxMinFreeFee),
+		witnessCommitmentWeight: blockchain.GetTransactionWeight(coinbaseCopy) -
+			blockchain.GetTransactionWeight(coinbaseTx),
+		accept: func(candidate *packageTx) bool {
+			// Ensure the transaction inputs pass all of the
+			// necessary preconditions before allowing it to be
+			// added to the block.
+			tx := candidate.tx
+			_, err := blockchain.CheckTransactionInputs(tx,
+				nextBlockHeight, blockUtxos, g.chainParams)
+			if err != nil {
+				log.Tracef("Skipping tx %s due to error in "+
+					"CheckTransactionInputs: %v", tx.Hash(), err)
+				return false
 			}
-		}
+			err = blockchain.ValidateTransactionScripts(tx, blockUtxos,
+				txscript.StandardVerifyFlags, g.sigCache,
+				g.hashCache)
+			if err != nil {
+				log.Tracef("Skipping tx %s due to error in "+
+					"ValidateTransactionScripts: %v", tx.Hash(),
+					err)
+				return false
+			}
+
+			// Spend the transaction inputs in the block utxo view
+			// and add an entry for it to ensure any transactions
+			// which reference this one have it available as an
+			// input and can ensure they aren't double spending.
+			spendTransaction(blockUtxos, tx, nextBlockHeight)
+
+			log.Tracef("Adding tx %s (fee %d, package feePerKB %d)",
+				tx.Hash(), candidate.fee, candidate.feePerKB())
+			return true
+		},
+	}
+	selected := selector.selectPackages(candidates)
+
+	// Create slices to hold the selected transactions along with their
+	// fees and number of signature operations, and add an entry for the
+	// coinbase.  Since the total fees aren't known until all transactions
+	// are added, use a dummy value for the coinbase fee which is updated
+	// below.
+	blockTxns := make([]*btcutil.Tx, 0, len(selected)+1)
+	txFees := make([]int64, 0, len(selected)+1)
+	txSigOpCosts := make([]int64, 0, len(selected)+1)
+	blockTxns = append(blockTxns, coinbaseTx)
+	txFees = append(txFees, -1) // Updated once known
+	txSigOpCosts = append(txSigOpCosts, coinbaseSigOpCost)
+	totalFees := int64(0)
+	for _, candidate := range selected {
+		// The fee deltas of the transactions aren't actually paid.
+		fee := candidate.fee - candidate.feeDelta
+		blockTxns = append(blockTxns, candidate.tx)
+		totalFees += fee
+		txFees = append(txFees, fee)
+		txSigOpCosts = append(txSigOpCosts, candidate.sigOpCost)
 	}
+	blockWeight := selector.blockWeight - (reservedWeight - coinbaseWeight)
+	blockSigOpCost := selector.blockSigOpCost -
+		(reservedSigOpCost - coinbaseSigOpCost)
+	witnessIncluded := selector.witnessIncluded
 
 	// Now that the actual transactions have been selected, update the
 	// block weight for the real transaction count and coinbase value with
 	// the total fees accordingly.
 	blockWeight -= wire.MaxVarIntPayload -
-		(uint32(wire.VarIntSerializeSize(uint64(len(blockTxns)))) *
+		(int64(wire.VarIntSerializeSize(uint64(len(blockTxns)))) *
 			blockchain.WitnessScaleFactor)
 	coinbaseTx.MsgTx().TxOut[0].Value += totalFees
 	txFees[0] = -totalFees
 
+	// Split the value of the coinbase, which is the subsidy along with the
+	// fees, among the payouts when it pays to an address.  This happens
+	// before the witness commitment output is added below.
+	if payToAddress != nil {
+		err := splitCoinbaseValue(coinbaseTx.MsgTx(),
+			policy.CoinbasePayouts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// If segwit is active and we included transactions with witness data,
 	// then we'll need to include a commitment to the witness data in an
 	// OP_RETURN output within the coinbase transaction.
@@ -895,6 +788,14 @@ mempoolLoop:
 	}, nil
 }
 
+// SetTemplateHook sets a function which is invoked with every block template
+// generated by NewBlockTemplate before it is returned.  The hook must not
+// modify the template and may be invoked concurrently when templates are
+// generated concurrently.  It must be set before any templates are generated.
+func (g *BlkTmplGenerator) SetTemplateHook(hook func(*BlockTemplate)) {
+	g.templateHook = hook
+}
+
 // UpdateBlockTime updates the timestamp in the header of the passed block to
 // the current time while taking into account the median time of the last
 // several blocks to ensure the new time is after that time per the chain
@@ -964,3 +865,12 @@ func (g *BlkTmplGenerator) BestSnapshot() *blockchain.BestState {
 func (g *BlkTmplGenerator) TxSource() TxSource {
 	return g.txSource
 }
+
+// Policy returns the policy the generator generates block templates with.  The
+// returned policy must be treated as immutable since it is shared by all
+// callers.
+//
+// This function is safe for concurrent access.
+func (g *BlkTmplGenerator) Policy() *Policy {
+	return g.policy
+}
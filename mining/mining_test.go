@@ -5,106 +5,108 @@
 package mining
 
 import (
-	"container/heap"
-	"math/rand"
+	"bytes"
 	"testing"
 
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcutil"
 )
 
-// TestTxFeePrioHeap ensures the priority queue for transaction fees and
-// priorities works as expected.
-func TestTxFeePrioHeap(t *testing.T) {
-	// Create some fake priority items that exercise the expected sort
-	// edge conditions.
-	testItems := []*txPrioItem{
-		{feePerKB: 5678, priority: 3},
-		{feePerKB: 5678, priority: 1},
-		{feePerKB: 5678, priority: 1}, // Duplicate fee and prio
-		{feePerKB: 5678, priority: 5},
-		{feePerKB: 5678, priority: 2},
-		{feePerKB: 1234, priority: 3},
-		{feePerKB: 1234, priority: 1},
-		{feePerKB: 1234, priority: 5},
-		{feePerKB: 1234, priority: 5}, // Duplicate fee and prio
-		{feePerKB: 1234, priority: 2},
-		{feePerKB: 10000, priority: 0}, // Higher fee, smaller prio
-		{feePerKB: 0, priority: 10000}, // Higher prio, lower fee
-	}
+// TestCoinbasePayouts ensures the value of the coinbase is split among the
+// payouts by their percentages with the remainder paid to the address of the
+// template.
+func TestCoinbasePayouts(t *testing.T) {
+	t.Parallel()
 
-	// Add random data in addition to the edge conditions already manually
-	// specified.
-	randSeed := rand.Int63()
-	defer func() {
-		if t.Failed() {
-			t.Logf("Random numbers using seed: %v", randSeed)
+	params := &chaincfg.RegressionNetParams
+	newAddr := func(b byte) btcutil.Address {
+		addr, err := btcutil.NewAddressPubKeyHash(
+			bytes.Repeat([]byte{b}, 20), params)
+		if err != nil {
+			t.Fatalf("unable to create address: %v", err)
 		}
-	}()
-	prng := rand.New(rand.NewSource(randSeed))
-	for i := 0; i < 1000; i++ {
-		testItems = append(testItems, &txPrioItem{
-			feePerKB: int64(prng.Float64() * btcutil.SatoshiPerBitcoin),
-			priority: prng.Float64() * 100,
-		})
+		return addr
 	}
-
-	// Test sorting by fee per KB then priority.
-	var highest *txPrioItem
-	priorityQueue := newTxPriorityQueue(len(testItems), true)
-	for i := 0; i < len(testItems); i++ {
-		prioItem := testItems[i]
-		if highest == nil {
-			highest = prioItem
-		}
-		if prioItem.feePerKB >= highest.feePerKB &&
-			prioItem.priority > highest.priority {
-
-			highest = prioItem
-		}
-		heap.Push(priorityQueue, prioItem)
+	payToAddr := newAddr(0x01)
+	payouts := []CoinbasePayout{
+		{Address: newAddr(0x02), Percent: 2.5},
+		{Address: newAddr(0x03), Percent: 10},
 	}
+	const fees = 12345
+	subsidy := int64(50 * btcutil.SatoshiPerBitcoin)
+	total := subsidy + fees
 
-	for i := 0; i < len(testItems); i++ {
-		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
-		if prioItem.feePerKB >= highest.feePerKB &&
-			prioItem.priority > highest.priority {
-
-			t.Fatalf("fee sort: item (fee per KB: %v, "+
-				"priority: %v) higher than than prev "+
-				"(fee per KB: %v, priority %v)",
-				prioItem.feePerKB, prioItem.priority,
-				highest.feePerKB, highest.priority)
-		}
-		highest = prioItem
+	tests := []struct {
+		name    string
+		addr    btcutil.Address
+		payouts []CoinbasePayout
+		values  []int64
+	}{
+		{"no payouts", payToAddr, nil, []int64{total}},
+		{"payouts", payToAddr, payouts, []int64{
+			total - total*25/1000 - total/10, total * 25 / 1000,
+			total / 10,
+		}},
+		{"anyone can spend", nil, payouts, []int64{total}},
 	}
 
-	// Test sorting by priority then fee per KB.
-	highest = nil
-	priorityQueue = newTxPriorityQueue(len(testItems), false)
-	for i := 0; i < len(testItems); i++ {
-		prioItem := testItems[i]
-		if highest == nil {
-			highest = prioItem
+	for _, test := range tests {
+		tx, err := createCoinbaseTx(params, []byte{0x51, 0x51}, 1,
+			test.addr, test.payouts)
+		if err != nil {
+			t.Errorf("%s: createCoinbaseTx: unexpected error: %v",
+				test.name, err)
+			continue
 		}
-		if prioItem.priority >= highest.priority &&
-			prioItem.feePerKB > highest.feePerKB {
-
-			highest = prioItem
+		msgTx := tx.MsgTx()
+		if msgTx.TxOut[0].Value != subsidy {
+			t.Errorf("%s: coinbase pays %d, want subsidy %d",
+				test.name, msgTx.TxOut[0].Value, subsidy)
+			continue
+		}
+		msgTx.TxOut[0].Value += fees
+		if test.addr != nil {
+			err := splitCoinbaseValue(msgTx, test.payouts)
+			if err != nil {
+				t.Errorf("%s: splitCoinbaseValue: unexpected "+
+					"error: %v", test.name, err)
+				continue
+			}
+		}
+		if len(msgTx.TxOut) != len(test.values) {
+			t.Errorf("%s: coinbase has %d outputs, want %d",
+				test.name, len(msgTx.TxOut), len(test.values))
+			continue
+		}
+		for i, txOut := range msgTx.TxOut {
+			if txOut.Value != test.values[i] {
+				t.Errorf("%s: output %d pays %d, want %d",
+					test.name, i, txOut.Value, test.values[i])
+			}
+			if i == 0 {
+				continue
+			}
+			pkScript, err := txscript.PayToAddrScript(
+				test.payouts[i-1].Address)
+			if err != nil {
+				t.Fatalf("unable to create script: %v", err)
+			}
+			if !bytes.Equal(txOut.PkScript, pkScript) {
+				t.Errorf("%s: output %d pays to script %x, "+
+					"want %x", test.name, i, txOut.PkScript,
+					pkScript)
+			}
 		}
-		heap.Push(priorityQueue, prioItem)
 	}
 
-	for i := 0; i < len(testItems); i++ {
-		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
-		if prioItem.priority >= highest.priority &&
-			prioItem.feePerKB > highest.feePerKB {
-
-			t.Fatalf("priority sort: item (fee per KB: %v, "+
-				"priority: %v) higher than than prev "+
-				"(fee per KB: %v, priority %v)",
-				prioItem.feePerKB, prioItem.priority,
-				highest.feePerKB, highest.priority)
-		}
-		highest = prioItem
+	// Coinbases without an output for each payout are rejected.
+	tx, err := createCoinbaseTx(params, []byte{0x51, 0x51}, 1, payToAddr,
+		payouts[:1])
+	if err != nil {
+		t.Fatalf("createCoinbaseTx: unexpected error: %v", err)
+	}
+	if err := splitCoinbaseValue(tx.MsgTx(), payouts); err == nil {
+		t.Fatal("coinbase without output for each payout split")
 	}
 }
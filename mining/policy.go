@@ -17,6 +17,19 @@ const (
 	UnminedHeight = 0x7fffffff
 )
 
+// CoinbasePayout describes an output of the coinbase transaction of generated
+// block templates which is paid a fixed percentage of the value of the
+// coinbase, which is the block subsidy along with the fees of the transactions
+// in the block.
+type CoinbasePayout struct {
+	// Address is the address the output pays to.
+	Address btcutil.Address
+
+	// Percent is the percentage of the value of the coinbase paid to the
+	// output.
+	Percent float64
+}
+
 // Policy houses the policy (configuration parameters) which is used to control
 // the generation of block templates.  See the documentation for
 // NewBlockTemplate for more details on each of these parameters are used.
@@ -29,6 +42,22 @@ type Policy struct {
 	// generating a block template.
 	BlockMaxWeight uint32
 
+	// BlockMaxSigOpCost is the maximum signature operation cost to be used
+	// when generating a block template.  Zero uses the maximum allowed by
+	// the consensus rules.
+	BlockMaxSigOpCost int64
+
+	// BlockReservedWeight is the weight reserved in block templates for the
+	// block header, the transaction count, and the coinbase transaction,
+	// which leaves room for miners to add to the coinbase.  The actual
+	// weight is reserved when it is higher.
+	BlockReservedWeight uint32
+
+	// BlockReservedSigOpCost is the signature operation cost reserved in
+	// block templates for the coinbase transaction.  The actual cost is
+	// reserved when it is higher.
+	BlockReservedSigOpCost int64
+
 	// BlockMinWeight is the minimum block size to be used when generating
 	// a block template.
 	BlockMinSize uint32
@@ -39,12 +68,22 @@ type Policy struct {
 
 	// BlockPrioritySize is the size in bytes for high-priority / low-fee
 	// transactions to be used when generating a block template.
+	//
+	// Deprecated: Block templates are filled by the fee rate of the
+	// packages of transactions, so this setting no longer has any effect.
 	BlockPrioritySize uint32
 
 	// TxMinFreeFee is the minimum fee in Satoshi/1000 bytes that is
 	// required for a transaction to be treated as free for mining purposes
 	// (block template generation).
 	TxMinFreeFee btcutil.Amount
+
+	// CoinbasePayouts are the outputs which are paid a fixed percentage of
+	// the value of the coinbase of block templates which pay to an
+	// address, such as an operator fee.  The remainder is paid to the
+	// address of the template.  The percentages must add up to less than
+	// 100.
+	CoinbasePayouts []CoinbasePayout
 }
 
 // minInt is a helper function to return the minimum of two ints.  This avoids
@@ -0,0 +1,346 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// maxConsecutivePackageFailures is the number of packages in a row
+	// which may fail to fit into a nearly full block before no more
+	// packages are considered.
+	maxConsecutivePackageFailures = 1000
+
+	// nearlyFullBlockWeight is the remaining weight below which a block is
+	// considered nearly full, so packages which fail to fit count towards
+	// maxConsecutivePackageFailures.
+	nearlyFullBlockWeight = 4000
+)
+
+// packageTx houses a transaction which is a candidate for inclusion in a block
+// template along with the package formed by it and its ancestors which have not
+// been included in the block yet.  The fee of the transaction includes its fee
+// delta, which it does not actually pay, so packages are selected by their
+// modified fees.
+type packageTx struct {
+	tx         *btcutil.Tx
+	hash       chainhash.Hash
+	fee        int64
+	feeDelta   int64
+	vsize      int64
+	weight     int64
+	sigOpCost  int64
+	hasWitness bool
+
+	// parents and children are the candidates which the transaction spends
+	// and which spend the transaction respectively.
+	parents  []*packageTx
+	children []*packageTx
+
+	// order is the position of the transaction in a topological order of
+	// all candidates, so every transaction comes after its ancestors.
+	order int
+
+	// ancestorFee, ancestorVSize, ancestorWeight, and ancestorSigOpCost
+	// are the totals of the transaction along with its ancestors which
+	// have not been included in the block yet.  The package is selected as
+	// a whole by its fee rate, which allows a transaction to pay for its
+	// ancestors (child-pays-for-parent, or CPFP).
+	ancestorFee       int64
+	ancestorVSize     int64
+	ancestorWeight    int64
+	ancestorSigOpCost int64
+
+	// included is set once the transaction is added to the block, and
+	// excluded is set when it can't be added to the block at all.
+	included bool
+	excluded bool
+
+	// index is the index of the transaction in the package queue, or -1
+	// when it is not queued.
+	index int
+}
+
+// feePerKB returns the fee rate in satoshi per 1000 virtual bytes of the
+// package formed by the transaction along with its ancestors which have not
+// been included in the block yet.
+func (p *packageTx) feePerKB() int64 {
+	return p.ancestorFee * 1000 / p.ancestorVSize
+}
+
+// packageQueue implements a priority queue of candidates ordered by the fee
+// rate of their packages.  Ties are broken by the smaller package and then by
+// the topological order, so the selection is deterministic.
+type packageQueue []*packageTx
+
+// Len returns the number of candidates in the queue.  It is part of the
+// heap.Interface implementation.
+func (pq packageQueue) Len() int {
+	return len(pq)
+}
+
+// Less returns whether the candidate with index i should be selected before
+// the candidate with index j.  It is part of the heap.Interface
+// implementation.
+func (pq packageQueue) Less(i, j int) bool {
+	rateI, rateJ := pq[i].feePerKB(), pq[j].feePerKB()
+	if rateI != rateJ {
+		return rateI > rateJ
+	}
+	if pq[i].ancestorVSize != pq[j].ancestorVSize {
+		return pq[i].ancestorVSize < pq[j].ancestorVSize
+	}
+	return pq[i].order < pq[j].order
+}
+
+// Swap swaps the candidates at the passed indices in the queue.  It is part of
+// the heap.Interface implementation.
+func (pq packageQueue) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+	pq[i].index = i
+	pq[j].index = j
+}
+
+// Push pushes the passed candidate onto the queue.  It is part of the
+// heap.Interface implementation.
+func (pq *packageQueue) Push(x interface{}) {
+	item := x.(*packageTx)
+	item.index = len(*pq)
+	*pq = append(*pq, item)
+}
+
+// Pop removes the candidate which is selected next from the queue and returns
+// it.  It is part of the heap.Interface implementation.
+func (pq *packageQueue) Pop() interface{} {
+	old := *pq
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*pq = old[:n-1]
+	return item
+}
+
+// remove removes the passed candidate from the queue if it is queued.
+func (pq *packageQueue) remove(item *packageTx) {
+	if item.index >= 0 {
+		heap.Remove(pq, item.index)
+	}
+}
+
+// forEachPending invokes the passed function with each of the passed
+// transactions along with their descendants, or ancestors when the ancestors
+// flag is set, which are neither included in the block nor excluded from it.
+// Every transaction is visited once.
+func forEachPending(txns []*packageTx, ancestors bool, f func(*packageTx)) {
+	visited := make(map[*packageTx]struct{})
+	queue := append([]*packageTx(nil), txns...)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if _, ok := visited[next]; ok || next.included || next.excluded {
+			continue
+		}
+		visited[next] = struct{}{}
+		f(next)
+
+		if ancestors {
+			queue = append(queue, next.parents...)
+		} else {
+			queue = append(queue, next.children...)
+		}
+	}
+}
+
+// initPackages orders the passed candidates topologically and computes the
+// package formed by each candidate along with its ancestors.  Candidates which
+// are already excluded exclude their descendants as well.  It returns the
+// candidates which are not excluded in topological order.
+func initPackages(candidates []*packageTx) []*packageTx {
+	// Order the candidates by repeatedly taking those whose parents were
+	// all taken already.
+	pendingParents := make(map[*packageTx]int, len(candidates))
+	var ready []*packageTx
+	for _, candidate := range candidates {
+		pendingParents[candidate] = len(candidate.parents)
+		if len(candidate.parents) == 0 {
+			ready = append(ready, candidate)
+		}
+	}
+	ordered := make([]*packageTx, 0, len(candidates))
+	for len(ready) > 0 {
+		next := ready[0]
+		ready = ready[1:]
+		for _, parent := range next.parents {
+			if parent.excluded {
+				next.excluded = true
+			}
+		}
+		next.order = len(ordered)
+		ordered = append(ordered, next)
+		for _, child := range next.children {
+			pendingParents[child]--
+			if pendingParents[child] == 0 {
+				ready = append(ready, child)
+			}
+		}
+	}
+
+	remaining := ordered[:0]
+	for _, candidate := range ordered {
+		if candidate.excluded {
+			continue
+		}
+		candidate.ancestorFee = 0
+		candidate.ancestorVSize = 0
+		candidate.ancestorWeight = 0
+		candidate.ancestorSigOpCost = 0
+		forEachPending([]*packageTx{candidate}, true, func(tx *packageTx) {
+			candidate.ancestorFee += tx.fee
+			candidate.ancestorVSize += tx.vsize
+			candidate.ancestorWeight += tx.weight
+			candidate.ancestorSigOpCost += tx.sigOpCost
+		})
+		remaining = append(remaining, candidate)
+	}
+	return remaining
+}
+
+// packageSelector selects the packages of transactions to include in a block
+// template.
+type packageSelector struct {
+	// blockWeight and blockSigOpCost are the weight and signature
+	// operation cost of the block so far.
+	blockWeight    int64
+	blockSigOpCost int64
+
+	// maxWeight and maxSigOpCost are the limits of the block, which the
+	// weight must stay below and the signature operation cost must not
+	// exceed.
+	maxWeight    int64
+	maxSigOpCost int64
+
+	// Packages paying a fee rate below minFeePerKB are only included while
+	// the block weight stays below minWeight.
+	minWeight   int64
+	minFeePerKB int64
+
+	// witnessCommitmentWeight is the weight the witness commitment adds to
+	// the coinbase transaction once a transaction with witness data is
+	// included.
+	witnessCommitmentWeight int64
+	witnessIncluded         bool
+
+	// accept is invoked with each transaction of a selected package in
+	// order before it is included.  It returns false when the transaction
+	// can't be included, which excludes it along with its descendants.
+	accept func(*packageTx) bool
+}
+
+// selectPackages repeatedly selects the candidate whose package formed by it
+// along with its ancestors which have not been included yet pays the highest
+// fee rate, and includes the package in the block when it fits.  The packages
+// of the descendants of the included transactions are updated accordingly, so
+// their fee rates reflect only the ancestors they still have to pay for.  The
+// included transactions are returned in the order they are added to the block.
+func (s *packageSelector) selectPackages(candidates []*packageTx) []*packageTx {
+	candidates = initPackages(candidates)
+	pq := make(packageQueue, 0, len(candidates))
+	for _, candidate := range candidates {
+		heap.Push(&pq, candidate)
+	}
+
+	var selected []*packageTx
+	var failures int
+	for pq.Len() > 0 {
+		best := heap.Pop(&pq).(*packageTx)
+		var pkg []*packageTx
+		var hasWitness bool
+		forEachPending([]*packageTx{best}, true, func(tx *packageTx) {
+			pkg = append(pkg, tx)
+			hasWitness = hasWitness || tx.hasWitness
+		})
+		sort.Slice(pkg, func(i, j int) bool {
+			return pkg[i].order < pkg[j].order
+		})
+
+		weight := best.ancestorWeight
+		if hasWitness && !s.witnessIncluded {
+			weight += s.witnessCommitmentWeight
+		}
+		if s.blockWeight+weight >= s.maxWeight ||
+			s.blockSigOpCost+best.ancestorSigOpCost > s.maxSigOpCost {
+
+			log.Tracef("Skipping tx %s since its package of %d "+
+				"transactions would exceed the block limits",
+				best.hash, len(pkg))
+
+			// Stop once the block is nearly full and packages keep
+			// failing to fit.
+			failures++
+			if failures > maxConsecutivePackageFailures &&
+				s.blockWeight > s.maxWeight-nearlyFullBlockWeight {
+
+				break
+			}
+			continue
+		}
+
+		// Skip packages paying a low fee rate once the block is larger
+		// than the minimum block weight.
+		if best.feePerKB() < s.minFeePerKB &&
+			s.blockWeight+weight >= s.minWeight {
+
+			log.Tracef("Skipping tx %s since its package pays %d "+
+				"sat/kvB < %d and the block weight %d >= %d",
+				best.hash, best.feePerKB(), s.minFeePerKB,
+				s.blockWeight+weight, s.minWeight)
+			continue
+		}
+		failures = 0
+
+		for _, tx := range pkg {
+			if !s.accept(tx) {
+				// The remaining transactions of the package which
+				// don't depend on the rejected one stay candidates.
+				forEachPending([]*packageTx{tx}, false,
+					func(desc *packageTx) {
+						desc.excluded = true
+						pq.remove(desc)
+					})
+				break
+			}
+
+			tx.included = true
+			pq.remove(tx)
+			s.blockWeight += tx.weight
+			s.blockSigOpCost += tx.sigOpCost
+			if tx.hasWitness && !s.witnessIncluded {
+				s.blockWeight += s.witnessCommitmentWeight
+				s.witnessIncluded = true
+			}
+			selected = append(selected, tx)
+
+			// The descendants of the transaction no longer pay
+			// for it.
+			forEachPending(tx.children, false, func(desc *packageTx) {
+				desc.ancestorFee -= tx.fee
+				desc.ancestorVSize -= tx.vsize
+				desc.ancestorWeight -= tx.weight
+				desc.ancestorSigOpCost -= tx.sigOpCost
+				if desc.index >= 0 {
+					heap.Fix(&pq, desc.index)
+				}
+			})
+		}
+	}
+
+	return selected
+}
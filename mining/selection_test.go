@@ -0,0 +1,390 @@
+// Copyright (c) 2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining
+
+import (
+	"container/heap"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestPackageQueue ensures the priority queue of candidates orders them by the
+// fee rate of their packages, then by the size of their packages, and then by
+// their topological order.
+func TestPackageQueue(t *testing.T) {
+	t.Parallel()
+
+	// Create some candidates that exercise the expected sort edge
+	// conditions.
+	testItems := []*packageTx{
+		{ancestorFee: 5678, ancestorVSize: 1000, order: 3},
+		{ancestorFee: 5678, ancestorVSize: 1000, order: 1},
+		{ancestorFee: 11356, ancestorVSize: 2000, order: 2}, // Same rate
+		{ancestorFee: 1234, ancestorVSize: 1000, order: 0},
+		{ancestorFee: 0, ancestorVSize: 100, order: 4}, // Free
+	}
+
+	// Add random data in addition to the edge conditions already manually
+	// specified.
+	randSeed := rand.Int63()
+	defer func() {
+		if t.Failed() {
+			t.Logf("Random numbers using seed: %v", randSeed)
+		}
+	}()
+	prng := rand.New(rand.NewSource(randSeed))
+	for i := 0; i < 1000; i++ {
+		testItems = append(testItems, &packageTx{
+			ancestorFee:   prng.Int63n(btcutil.SatoshiPerBitcoin),
+			ancestorVSize: prng.Int63n(100000) + 1,
+			order:         len(testItems),
+		})
+	}
+
+	pq := make(packageQueue, 0, len(testItems))
+	for _, item := range testItems {
+		heap.Push(&pq, item)
+	}
+
+	// Remove a candidate from the middle of the queue, which must not be
+	// popped afterwards.
+	removed := testItems[len(testItems)/2]
+	pq.remove(removed)
+	if removed.index != -1 {
+		t.Fatalf("removed candidate has index %d", removed.index)
+	}
+
+	var prev *packageTx
+	for pq.Len() > 0 {
+		item := heap.Pop(&pq).(*packageTx)
+		if item == removed {
+			t.Fatal("removed candidate popped from the queue")
+		}
+		if prev != nil {
+			prevRate, rate := prev.feePerKB(), item.feePerKB()
+			switch {
+			case rate > prevRate,
+				rate == prevRate &&
+					item.ancestorVSize < prev.ancestorVSize,
+				rate == prevRate &&
+					item.ancestorVSize == prev.ancestorVSize &&
+					item.order < prev.order:
+
+				t.Fatalf("item (fee per KB %d, size %d, order %d) "+
+					"popped after (fee per KB %d, size %d, "+
+					"order %d)", rate, item.ancestorVSize,
+					item.order, prevRate, prev.ancestorVSize,
+					prev.order)
+			}
+		}
+		prev = item
+	}
+}
+
+// testCandidate describes a candidate for the tests which is created by
+// newTestCandidates.
+type testCandidate struct {
+	name      string
+	fee       int64
+	vsize     int64
+	sigOpCost int64
+	parents   []string
+}
+
+// newTestCandidates returns candidates for the passed descriptions in the same
+// order along with a map of them by name.  Their weight is four times their
+// virtual size.
+func newTestCandidates(descs []testCandidate) ([]*packageTx, map[string]*packageTx) {
+	candidates := make([]*packageTx, 0, len(descs))
+	byName := make(map[string]*packageTx, len(descs))
+	for _, desc := range descs {
+		candidate := &packageTx{
+			hash:      chainhash.HashH([]byte(desc.name)),
+			fee:       desc.fee,
+			vsize:     desc.vsize,
+			weight:    desc.vsize * 4,
+			sigOpCost: desc.sigOpCost,
+			index:     -1,
+		}
+		for _, name := range desc.parents {
+			parent := byName[name]
+			candidate.parents = append(candidate.parents, parent)
+			parent.children = append(parent.children, candidate)
+		}
+		candidates = append(candidates, candidate)
+		byName[desc.name] = candidate
+	}
+	return candidates, byName
+}
+
+// TestSelectPackages ensures packages are selected by their fee rates, that
+// children pay for their parents, and that the block limits and rejected
+// transactions are taken into account.
+func TestSelectPackages(t *testing.T) {
+	t.Parallel()
+
+	// The package of e along with its parent d pays the highest fee rate,
+	// followed by the package of b along with its parent a, which pays
+	// the lowest fee rate on its own.
+	descs := []testCandidate{
+		{name: "a", fee: 100, vsize: 1000},
+		{name: "b", fee: 50000, vsize: 200, parents: []string{"a"}},
+		{name: "c", fee: 20000, vsize: 1000, sigOpCost: 100},
+		{name: "d", fee: 30000, vsize: 1000},
+		{name: "e", fee: 100000, vsize: 500, parents: []string{"d"}},
+		{name: "f", fee: 1000, vsize: 100, parents: []string{"e"}},
+	}
+
+	tests := []struct {
+		name         string
+		maxWeight    int64
+		maxSigOpCost int64
+		minFeePerKB  int64
+		reject       string
+		want         []string
+	}{
+		{
+			name:         "all transactions",
+			maxWeight:    100000,
+			maxSigOpCost: 1000,
+			want:         []string{"d", "e", "a", "b", "c", "f"},
+		},
+		{
+			name:         "rejected transaction",
+			maxWeight:    100000,
+			maxSigOpCost: 1000,
+			reject:       "e",
+			want:         []string{"d", "a", "b", "c"},
+		},
+		{
+			name:         "weight limit",
+			maxWeight:    10500,
+			maxSigOpCost: 1000,
+			want:         []string{"d", "e", "c", "f"},
+		},
+		{
+			name:         "signature operation limit",
+			maxWeight:    100000,
+			maxSigOpCost: 50,
+			want:         []string{"d", "e", "a", "b", "f"},
+		},
+		{
+			name:         "minimum fee rate",
+			maxWeight:    100000,
+			maxSigOpCost: 1000,
+			minFeePerKB:  25000,
+			want:         []string{"d", "e", "a", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		candidates, byName := newTestCandidates(descs)
+		names := make(map[*packageTx]string, len(byName))
+		for name, candidate := range byName {
+			names[candidate] = name
+		}
+
+		selector := &packageSelector{
+			maxWeight:    test.maxWeight,
+			maxSigOpCost: test.maxSigOpCost,
+			minFeePerKB:  test.minFeePerKB,
+			accept: func(candidate *packageTx) bool {
+				return names[candidate] != test.reject
+			},
+		}
+		selected := selector.selectPackages(candidates)
+
+		var got []string
+		for _, candidate := range selected {
+			got = append(got, names[candidate])
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got %v, want %v", test.name, got,
+					test.want)
+				break
+			}
+		}
+	}
+}
+
+// loadMempoolSnapshot loads the snapshot of a mempool from the passed file in
+// the testdata directory and returns its transactions as candidates ordered by
+// hash.  The snapshot is in the format of the result of the verbose
+// getrawmempool RPC, of which only the sizes, fees, and dependencies are used.
+func loadMempoolSnapshot(t *testing.T, filename string) []*packageTx {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", filename))
+	if err != nil {
+		t.Fatalf("unable to read snapshot %s: %v", filename, err)
+	}
+	var snapshot map[string]btcjson.GetRawMempoolVerboseResult
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatalf("unable to decode snapshot %s: %v", filename, err)
+	}
+
+	txids := make([]string, 0, len(snapshot))
+	for txid := range snapshot {
+		txids = append(txids, txid)
+	}
+	sort.Strings(txids)
+
+	candidates := make([]*packageTx, 0, len(txids))
+	byTxID := make(map[string]*packageTx, len(txids))
+	for _, txid := range txids {
+		entry := snapshot[txid]
+		hash, err := chainhash.NewHashFromStr(txid)
+		if err != nil {
+			t.Fatalf("invalid txid %s in snapshot %s: %v", txid,
+				filename, err)
+		}
+		fee, err := btcutil.NewAmount(entry.Fee)
+		if err != nil {
+			t.Fatalf("invalid fee of %s in snapshot %s: %v", txid,
+				filename, err)
+		}
+		candidate := &packageTx{
+			hash:   *hash,
+			fee:    int64(fee),
+			vsize:  int64(entry.Vsize),
+			weight: int64(entry.Weight),
+			index:  -1,
+		}
+		candidates = append(candidates, candidate)
+		byTxID[txid] = candidate
+	}
+	for _, txid := range txids {
+		candidate := byTxID[txid]
+		for _, depend := range snapshot[txid].Depends {
+			parent, ok := byTxID[depend]
+			if !ok {
+				t.Fatalf("%s depends on %s which is not in "+
+					"snapshot %s", txid, depend, filename)
+			}
+			candidate.parents = append(candidate.parents, parent)
+			parent.children = append(parent.children, candidate)
+		}
+	}
+	return candidates
+}
+
+// selectByFeeRate returns the total fee of the transactions selected from the
+// passed candidates by their individual fee rates while the block weight stays
+// below the passed maximum, which is how block templates were filled before
+// transactions were selected by the fee rates of their packages.  A
+// transaction is only considered once all of its parents are included.
+func selectByFeeRate(candidates []*packageTx, maxWeight int64) int64 {
+	included := make(map[*packageTx]struct{})
+	var ready []*packageTx
+	for _, candidate := range candidates {
+		if len(candidate.parents) == 0 {
+			ready = append(ready, candidate)
+		}
+	}
+
+	var weight, fees int64
+	for len(ready) > 0 {
+		sort.SliceStable(ready, func(i, j int) bool {
+			return ready[i].fee*1000/ready[i].vsize >
+				ready[j].fee*1000/ready[j].vsize
+		})
+		next := ready[0]
+		ready = ready[1:]
+		if weight+next.weight >= maxWeight {
+			continue
+		}
+		weight += next.weight
+		fees += next.fee
+		included[next] = struct{}{}
+
+	nextChild:
+		for _, child := range next.children {
+			for _, parent := range child.parents {
+				if _, ok := included[parent]; !ok {
+					continue nextChild
+				}
+			}
+			ready = append(ready, child)
+		}
+	}
+	return fees
+}
+
+// TestSelectPackagesRevenue ensures selecting packages by their fee rates
+// collects more fees from snapshots of mempools with transactions paying for
+// their parents than selecting transactions by their individual fee rates, and
+// that the selected transactions form a valid block.
+func TestSelectPackagesRevenue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		filename  string
+		maxWeight int64
+	}{
+		// Independent transactions along with parents paying low fee
+		// rates whose children pay high fee rates for them.
+		{filename: "mempool-cpfp.json", maxWeight: 200000},
+
+		// Independent transactions along with chains of transactions
+		// paying varying fee rates and children of several parents.
+		{filename: "mempool-chains.json", maxWeight: 160000},
+	}
+
+	for _, test := range tests {
+		oldFees := selectByFeeRate(loadMempoolSnapshot(t, test.filename),
+			test.maxWeight)
+
+		candidates := loadMempoolSnapshot(t, test.filename)
+		selector := &packageSelector{
+			maxWeight:    test.maxWeight,
+			maxSigOpCost: blockchain.MaxBlockSigOpsCost,
+			accept:       func(*packageTx) bool { return true },
+		}
+		selected := selector.selectPackages(candidates)
+
+		var weight, fees int64
+		included := make(map[*packageTx]struct{})
+		for _, candidate := range selected {
+			for _, parent := range candidate.parents {
+				if _, ok := included[parent]; !ok {
+					t.Fatalf("%s: %v selected before its parent "+
+						"%v", test.filename, candidate.hash,
+						parent.hash)
+				}
+			}
+			included[candidate] = struct{}{}
+			weight += candidate.weight
+			fees += candidate.fee
+		}
+		if weight != selector.blockWeight || weight >= test.maxWeight {
+			t.Fatalf("%s: selected weight %d, block weight %d, max "+
+				"weight %d", test.filename, weight,
+				selector.blockWeight, test.maxWeight)
+		}
+
+		t.Logf("%s: %d of %d transactions selected, fees %d with "+
+			"packages vs %d by individual fee rates", test.filename,
+			len(selected), len(candidates), fees, oldFees)
+		if fees <= oldFees {
+			t.Errorf("%s: selecting packages collects %d in fees, "+
+				"want more than %d collected by individual fee "+
+				"rates", test.filename, fees, oldFees)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package stratum
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+)
+
+const (
+	// maxMessageSize is the maximum size of a message a client may send.
+	maxMessageSize = 16 * 1024
+
+	// clientIdleTimeout is the duration after which clients which don't
+	// send any messages are disconnected.
+	clientIdleTimeout = 10 * time.Minute
+
+	// clientWriteTimeout is the duration after which writing a message to
+	// a client fails.
+	clientWriteTimeout = 10 * time.Second
+
+	// retargetShares and retargetInterval are the number of shares and the
+	// duration after which the difficulty of a client is retargeted,
+	// whichever comes first.
+	retargetShares   = 30
+	retargetInterval = time.Minute
+
+	// maxRetargetDeviation is the factor by which the share rate of a
+	// client must deviate from the target share rate before its
+	// difficulty is changed.
+	maxRetargetDeviation = 2
+
+	// minDifficulty is the minimum difficulty of shares.
+	minDifficulty = 0.001
+)
+
+// Error is an error which is returned to clients in response to a request.  It
+// is serialized as an array of the error code, the message, and a traceback
+// which is always null.
+type Error struct {
+	Code    int
+	Message string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// MarshalJSON returns the error serialized as it is sent to clients.
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Code, e.Message, nil})
+}
+
+// These are the errors returned to clients.
+var (
+	ErrOther          = &Error{20, "Other/Unknown"}
+	ErrJobNotFound    = &Error{21, "Job not found"}
+	ErrDuplicateShare = &Error{22, "Duplicate share"}
+	ErrLowDifficulty  = &Error{23, "Low difficulty share"}
+	ErrUnauthorized   = &Error{24, "Unauthorized worker"}
+	ErrNotSubscribed  = &Error{25, "Not subscribed"}
+)
+
+// otherError returns an error with the code of ErrOther and the passed message.
+func otherError(message string) *Error {
+	return &Error{ErrOther.Code, message}
+}
+
+// request is a request sent by a client.
+type request struct {
+	ID     interface{}     `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// response is a response to a request sent to a client.
+type response struct {
+	ID     interface{} `json:"id"`
+	Result interface{} `json:"result"`
+	Error  *Error      `json:"error"`
+}
+
+// notification is a notification sent to a client.
+type notification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// client houses the state of a connection from a miner.
+type client struct {
+	server      *Server
+	conn        net.Conn
+	extraNonce1 []byte
+
+	writeMtx sync.Mutex
+
+	// The following fields are protected by the mutex.
+	mtx        sync.Mutex
+	subscribed bool
+	workers    map[string]struct{}
+
+	// difficulty is the difficulty of the shares the client submits.
+	// Since shares for work handed out before the difficulty was raised
+	// may still arrive, shares meeting prevDifficulty are accepted as well
+	// until the client is handed out a new job.
+	difficulty     float64
+	prevDifficulty float64
+
+	// shares is the number of shares the client submitted since its
+	// difficulty was last retargeted at lastRetarget.
+	shares       int
+	lastRetarget time.Time
+}
+
+// newClient returns a client for the passed connection which is assigned the
+// passed extra nonce.
+func newClient(s *Server, conn net.Conn, extraNonce1 []byte) *client {
+	return &client{
+		server:       s,
+		conn:         conn,
+		extraNonce1:  extraNonce1,
+		workers:      make(map[string]struct{}),
+		difficulty:   s.cfg.InitialDifficulty,
+		lastRetarget: time.Now(),
+	}
+}
+
+// String returns the address of the client.
+func (c *client) String() string {
+	return c.conn.RemoteAddr().String()
+}
+
+// send writes the passed message to the client.
+//
+// This function is safe for concurrent access.
+func (c *client) send(msg interface{}) error {
+	serialized, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	serialized = append(serialized, '\n')
+
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(clientWriteTimeout))
+	_, err = c.conn.Write(serialized)
+	return err
+}
+
+// notify sends the notification with the passed method and parameters to the
+// client.  Failures are logged and close the connection, which ends the read
+// loop of the client.
+func (c *client) notify(method string, params ...interface{}) {
+	err := c.send(&notification{Method: method, Params: params})
+	if err != nil {
+		log.Debugf("Unable to send %s to %s: %v", method, c, err)
+		c.conn.Close()
+	}
+}
+
+// sendJob hands out the passed job to the client.  The clean jobs flag tells the
+// client to abandon the work of previous jobs.
+func (c *client) sendJob(j *job, cleanJobs bool) {
+	c.mtx.Lock()
+	subscribed := c.subscribed
+	c.prevDifficulty = 0
+	c.mtx.Unlock()
+
+	if subscribed {
+		c.notify("mining.notify", j.notifyParams(cleanJobs)...)
+	}
+}
+
+// run reads and handles the requests of the client until its connection is
+// closed.  It must be run as a goroutine.
+func (c *client) run() {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxMessageSize)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(clientIdleTimeout))
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req request
+		if err := json.Unmarshal(line, &req); err != nil {
+			log.Debugf("Malformed message from %s: %v", c, err)
+			break
+		}
+		result, rerr := c.handleRequest(&req)
+		err := c.send(&response{ID: req.ID, Result: result, Error: rerr})
+		if err != nil {
+			log.Debugf("Unable to send response to %s: %v", c, err)
+			break
+		}
+
+		// The difficulty and the current job are sent once the client
+		// subscribed.
+		if req.Method == "mining.subscribe" && rerr == nil {
+			c.mtx.Lock()
+			difficulty := c.difficulty
+			c.mtx.Unlock()
+			c.notify("mining.set_difficulty", difficulty)
+			if j := c.server.currentJob(); j != nil {
+				c.sendJob(j, true)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Debugf("Unable to read from %s: %v", c, err)
+	}
+	c.conn.Close()
+}
+
+// handleRequest handles the passed request and returns the result to respond
+// with.
+func (c *client) handleRequest(req *request) (interface{}, *Error) {
+	var params []interface{}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, otherError("Invalid parameters")
+		}
+	}
+
+	switch req.Method {
+	case "mining.subscribe":
+		return c.handleSubscribe()
+	case "mining.authorize":
+		return c.handleAuthorize(params)
+	case "mining.submit":
+		return c.handleSubmit(params)
+	}
+	return nil, otherError("Unsupported method '" + req.Method + "'")
+}
+
+// handleSubscribe handles mining.subscribe requests, which assign the extra
+// nonce to the client.
+func (c *client) handleSubscribe() (interface{}, *Error) {
+	c.mtx.Lock()
+	c.subscribed = true
+	c.mtx.Unlock()
+
+	subscriptionID := hex.EncodeToString(c.extraNonce1)
+	return []interface{}{
+		[][]string{
+			{"mining.set_difficulty", subscriptionID},
+			{"mining.notify", subscriptionID},
+		},
+		hex.EncodeToString(c.extraNonce1),
+		extraNonce2Size,
+	}, nil
+}
+
+// handleAuthorize handles mining.authorize requests.  Since all shares are paid
+// to the mining addresses of the server, any worker is authorized.
+func (c *client) handleAuthorize(params []interface{}) (interface{}, *Error) {
+	if len(params) < 1 {
+		return nil, otherError("Missing worker name")
+	}
+	worker, ok := params[0].(string)
+	if !ok {
+		return nil, otherError("Invalid worker name")
+	}
+
+	c.mtx.Lock()
+	c.workers[worker] = struct{}{}
+	c.mtx.Unlock()
+
+	log.Debugf("Authorized worker %s on %s", worker, c)
+	return true, nil
+}
+
+// parseUint32 parses the passed hex-encoded parameter as a 32-bit value.
+func parseUint32(param string) (uint32, bool) {
+	value, err := strconv.ParseUint(param, 16, 32)
+	return uint32(value), err == nil
+}
+
+// handleSubmit handles mining.submit requests, which submit a share for a job.
+func (c *client) handleSubmit(params []interface{}) (interface{}, *Error) {
+	if len(params) < 5 {
+		return nil, otherError("Missing parameters")
+	}
+	var strParams [5]string
+	for i := range strParams {
+		param, ok := params[i].(string)
+		if !ok {
+			return nil, otherError("Invalid parameters")
+		}
+		strParams[i] = param
+	}
+	worker, jobID := strParams[0], strParams[1]
+
+	c.mtx.Lock()
+	subscribed := c.subscribed
+	_, authorized := c.workers[worker]
+	difficulty := c.difficulty
+	if c.prevDifficulty != 0 && c.prevDifficulty < difficulty {
+		difficulty = c.prevDifficulty
+	}
+	c.mtx.Unlock()
+	if !subscribed {
+		return nil, ErrNotSubscribed
+	}
+	if !authorized {
+		return nil, ErrUnauthorized
+	}
+
+	j := c.server.job(jobID)
+	if j == nil {
+		return nil, ErrJobNotFound
+	}
+	extraNonce2, err := hex.DecodeString(strParams[2])
+	if err != nil || len(extraNonce2) != extraNonce2Size {
+		return nil, otherError("Invalid extranonce2 size")
+	}
+	nTime, ok := parseUint32(strParams[3])
+	if !ok {
+		return nil, otherError("Invalid ntime")
+	}
+	maxTime := time.Now().Add(time.Second * blockchain.MaxTimeOffsetSeconds)
+	if blockTime := time.Unix(int64(nTime), 0); blockTime.Before(j.minTime) ||
+		blockTime.After(maxTime) {
+
+		return nil, otherError("Ntime out of range")
+	}
+	nonce, ok := parseUint32(strParams[4])
+	if !ok {
+		return nil, otherError("Invalid nonce")
+	}
+
+	extraNonce := make([]byte, 0, extraNonceSize)
+	extraNonce = append(extraNonce, c.extraNonce1...)
+	extraNonce = append(extraNonce, extraNonce2...)
+	if j.recordSubmission(extraNonce, nTime, nonce) {
+		return nil, ErrDuplicateShare
+	}
+	msgBlock, err := j.solve(extraNonce, nTime, nonce)
+	if err != nil {
+		log.Errorf("Unable to build block for job %s: %v", j.id, err)
+		return nil, otherError("Unable to build block")
+	}
+
+	// Blocks are submitted even when they don't meet the share difficulty,
+	// which happens on networks with a very low difficulty.
+	hash := msgBlock.BlockHash()
+	hashNum := blockchain.HashToBig(&hash)
+	isBlock := hashNum.Cmp(blockchain.CompactToBig(msgBlock.Header.Bits)) <= 0
+	if isBlock {
+		c.server.submitBlock(msgBlock, worker)
+	} else if hashNum.Cmp(shareTarget(difficulty)) > 0 {
+		return nil, ErrLowDifficulty
+	}
+
+	log.Tracef("Accepted share %s for job %s from worker %s on %s", hash,
+		j.id, worker, c)
+	c.retarget(time.Now(), true)
+	return true, nil
+}
+
+// nextDifficulty returns the difficulty which lets a client which submitted the
+// passed number of shares over the passed duration submit a share every target
+// interval.  The difficulty is only changed when the share rate deviates from
+// the target share rate by more than maxRetargetDeviation.
+func nextDifficulty(difficulty float64, shares int, elapsed, target time.Duration) float64 {
+	// A client which did not submit any shares is treated as if it just
+	// submitted one, so its difficulty is lowered.
+	if shares == 0 {
+		shares = 1
+	}
+	if elapsed <= 0 {
+		elapsed = time.Millisecond
+	}
+
+	ratio := float64(target) * float64(shares) / float64(elapsed)
+	if ratio >= 1.0/maxRetargetDeviation && ratio <= maxRetargetDeviation {
+		return difficulty
+	}
+	return math.Max(difficulty*ratio, minDifficulty)
+}
+
+// retarget retargets the difficulty of the client once it submitted enough
+// shares or enough time passed since the last retarget.  The share flag
+// indicates the client just submitted a share.
+func (c *client) retarget(now time.Time, share bool) {
+	c.mtx.Lock()
+	if share {
+		c.shares++
+	}
+	elapsed := now.Sub(c.lastRetarget)
+	if !c.subscribed || (c.shares < retargetShares &&
+		elapsed < retargetInterval) {
+
+		c.mtx.Unlock()
+		return
+	}
+	difficulty := nextDifficulty(c.difficulty, c.shares, elapsed,
+		c.server.cfg.TargetShareInterval)
+	c.shares = 0
+	c.lastRetarget = now
+	if difficulty == c.difficulty {
+		c.mtx.Unlock()
+		return
+	}
+	if c.prevDifficulty == 0 || c.difficulty < c.prevDifficulty {
+		c.prevDifficulty = c.difficulty
+	}
+	log.Debugf("Retargeted difficulty of %s from %g to %g", c,
+		c.difficulty, difficulty)
+	c.difficulty = difficulty
+	c.mtx.Unlock()
+
+	// The current job is handed out again, so the client applies the new
+	// difficulty right away.
+	c.notify("mining.set_difficulty", difficulty)
+	if j := c.server.currentJob(); j != nil {
+		c.notify("mining.notify", j.notifyParams(false)...)
+	}
+}
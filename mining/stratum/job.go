@@ -0,0 +1,244 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package stratum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// extraNonce1Size is the size of the extra nonce assigned to each
+	// client by the server.
+	extraNonce1Size = 4
+
+	// extraNonce2Size is the size of the extra nonce each client rolls
+	// itself.
+	extraNonce2Size = 4
+
+	// extraNonceSize is the size of the complete extra nonce in the
+	// signature script of the coinbase transaction.
+	extraNonceSize = extraNonce1Size + extraNonce2Size
+)
+
+var (
+	// diff1Target is the target of a share with a difficulty of one, which
+	// is the highest target of the main network.
+	diff1Target = new(big.Int).Lsh(big.NewInt(0xffff), 208)
+)
+
+// job houses a block template which is handed out to clients as work along
+// with the values sent to them in mining.notify.
+type job struct {
+	id       string
+	template *mining.BlockTemplate
+	height   int32
+
+	// coinbase1 and coinbase2 are the serialized coinbase transaction
+	// without witness data before and after the extra nonce.
+	coinbase1 []byte
+	coinbase2 []byte
+
+	// merkleBranch are the hashes the hash of the coinbase transaction is
+	// combined with in order to calculate the merkle root.
+	merkleBranch []*chainhash.Hash
+
+	// minTime is the earliest timestamp of a block built from the job per
+	// the chain consensus rules.
+	minTime time.Time
+
+	// submissions tracks the shares which were submitted for the job, so
+	// duplicate shares are rejected.
+	submissionsMtx sync.Mutex
+	submissions    map[string]struct{}
+}
+
+// coinbaseScript returns the signature script of the coinbase transaction of a
+// block at the passed height with room for the extra nonce.  The offset of the
+// extra nonce in the script is returned as well.
+func coinbaseScript(height int32) ([]byte, int, error) {
+	heightScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(height)).Script()
+	if err != nil {
+		return nil, 0, err
+	}
+	script, err := txscript.NewScriptBuilder().AddInt64(int64(height)).
+		AddData(make([]byte, extraNonceSize)).
+		AddData([]byte(mining.CoinbaseFlags)).Script()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(script) > blockchain.MaxCoinbaseScriptLen {
+		return nil, 0, fmt.Errorf("coinbase transaction script length "+
+			"of %d is out of range (min: %d, max: %d)",
+			len(script), blockchain.MinCoinbaseScriptLen,
+			blockchain.MaxCoinbaseScriptLen)
+	}
+
+	// The extra nonce follows the height and its data push opcode.
+	return script, len(heightScript) + 1, nil
+}
+
+// merkleRoot returns the merkle root which results from combining the passed
+// coinbase transaction hash with the merkle branch.
+func merkleRoot(coinbaseHash *chainhash.Hash, branch []*chainhash.Hash) *chainhash.Hash {
+	root := coinbaseHash
+	for _, hash := range branch {
+		root = blockchain.HashMerkleBranches(root, hash)
+	}
+	return root
+}
+
+// encodePrevHash returns the previous block hash the way it is sent to
+// clients, which is the hash in internal byte order with the bytes of each
+// 32-bit word reversed.
+func encodePrevHash(hash *chainhash.Hash) string {
+	var swapped [chainhash.HashSize]byte
+	for i := 0; i < chainhash.HashSize; i += 4 {
+		binary.BigEndian.PutUint32(swapped[i:],
+			binary.LittleEndian.Uint32(hash[i:]))
+	}
+	return hex.EncodeToString(swapped[:])
+}
+
+// newJob returns a job with the passed id which hands out the passed block
+// template as work.  The template is not modified.
+func newJob(id string, template *mining.BlockTemplate, minTime time.Time) (*job, error) {
+	msgBlock := template.Block
+	if len(msgBlock.Transactions) == 0 {
+		return nil, fmt.Errorf("block template has no coinbase " +
+			"transaction")
+	}
+
+	// Replace the signature script of the coinbase transaction with one
+	// which has room for the extra nonce and split its serialization
+	// around the extra nonce.
+	script, offset, err := coinbaseScript(template.Height)
+	if err != nil {
+		return nil, err
+	}
+	coinbase := msgBlock.Transactions[0].Copy()
+	coinbase.TxIn[0].SignatureScript = script
+	var buf bytes.Buffer
+	buf.Grow(coinbase.SerializeSizeStripped())
+	if err := coinbase.SerializeNoWitness(&buf); err != nil {
+		return nil, err
+	}
+	serialized := buf.Bytes()
+
+	// The signature script follows the version, the input count, the
+	// previous outpoint, and the script length.
+	offset += 4 + wire.VarIntSerializeSize(1) + 36 +
+		wire.VarIntSerializeSize(uint64(len(script)))
+
+	txns := make([]*btcutil.Tx, 0, len(msgBlock.Transactions))
+	for _, tx := range msgBlock.Transactions {
+		txns = append(txns, btcutil.NewTx(tx))
+	}
+
+	return &job{
+		id:           id,
+		template:     template,
+		height:       template.Height,
+		coinbase1:    serialized[:offset],
+		coinbase2:    serialized[offset+extraNonceSize:],
+		merkleBranch: blockchain.BuildMerkleBranch(txns),
+		minTime:      minTime,
+		submissions:  make(map[string]struct{}),
+	}, nil
+}
+
+// notifyParams returns the parameters of the mining.notify notification which
+// hands out the job.
+func (j *job) notifyParams(cleanJobs bool) []interface{} {
+	header := &j.template.Block.Header
+	branch := make([]string, 0, len(j.merkleBranch))
+	for _, hash := range j.merkleBranch {
+		branch = append(branch, hex.EncodeToString(hash[:]))
+	}
+	return []interface{}{
+		j.id,
+		encodePrevHash(&header.PrevBlock),
+		hex.EncodeToString(j.coinbase1),
+		hex.EncodeToString(j.coinbase2),
+		branch,
+		fmt.Sprintf("%08x", uint32(header.Version)),
+		fmt.Sprintf("%08x", header.Bits),
+		fmt.Sprintf("%08x", uint32(header.Timestamp.Unix())),
+		cleanJobs,
+	}
+}
+
+// recordSubmission records the share with the passed values and returns
+// whether it was submitted before.
+//
+// This function is safe for concurrent access.
+func (j *job) recordSubmission(extraNonce []byte, nTime, nonce uint32) bool {
+	key := fmt.Sprintf("%x:%08x:%08x", extraNonce, nTime, nonce)
+
+	j.submissionsMtx.Lock()
+	defer j.submissionsMtx.Unlock()
+
+	if _, ok := j.submissions[key]; ok {
+		return true
+	}
+	j.submissions[key] = struct{}{}
+	return false
+}
+
+// solve returns the block built from the job with the passed complete extra
+// nonce, timestamp, and nonce.
+func (j *job) solve(extraNonce []byte, nTime, nonce uint32) (*wire.MsgBlock, error) {
+	serialized := make([]byte, 0, len(j.coinbase1)+len(extraNonce)+
+		len(j.coinbase2))
+	serialized = append(serialized, j.coinbase1...)
+	serialized = append(serialized, extraNonce...)
+	serialized = append(serialized, j.coinbase2...)
+	var coinbase wire.MsgTx
+	err := coinbase.DeserializeNoWitness(bytes.NewReader(serialized))
+	if err != nil {
+		return nil, err
+	}
+
+	// The witness of the coinbase transaction holds the witness nonce the
+	// witness commitment commits to, if any.
+	templateBlock := j.template.Block
+	coinbase.TxIn[0].Witness = templateBlock.Transactions[0].TxIn[0].Witness
+	coinbaseHash := coinbase.TxHash()
+
+	header := templateBlock.Header
+	header.MerkleRoot = *merkleRoot(&coinbaseHash, j.merkleBranch)
+	header.Timestamp = time.Unix(int64(nTime), 0)
+	header.Nonce = nonce
+
+	msgBlock := &wire.MsgBlock{
+		Header:       header,
+		Transactions: make([]*wire.MsgTx, 0, len(templateBlock.Transactions)),
+	}
+	msgBlock.Transactions = append(msgBlock.Transactions, &coinbase)
+	msgBlock.Transactions = append(msgBlock.Transactions,
+		templateBlock.Transactions[1:]...)
+	return msgBlock, nil
+}
+
+// shareTarget returns the target the hash of a share with the passed difficulty
+// must not exceed.
+func shareTarget(difficulty float64) *big.Int {
+	target, _ := new(big.Float).Quo(new(big.Float).SetInt(diff1Target),
+		big.NewFloat(difficulty)).Int(nil)
+	return target
+}
@@ -0,0 +1,247 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package stratum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// createTestTxns returns the passed number of distinct transactions, the first
+// of which is a coinbase transaction for a block at the passed height.
+func createTestTxns(numTxns int, height int32) []*wire.MsgTx {
+	script, err := txscript.NewScriptBuilder().AddInt64(int64(height)).
+		Script()
+	if err != nil {
+		panic(err)
+	}
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: script,
+		Sequence:        wire.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(&wire.TxOut{
+		Value:    blockchain.CalcBlockSubsidy(height, &chaincfg.RegressionNetParams),
+		PkScript: []byte{txscript.OP_TRUE},
+	})
+	coinbase.TxIn[0].Witness = wire.TxWitness{make([]byte, 32)}
+
+	txns := []*wire.MsgTx{coinbase}
+	for i := 1; i < numTxns; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Index: uint32(i)},
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+		tx.AddTxOut(&wire.TxOut{
+			Value:    int64(i),
+			PkScript: []byte{txscript.OP_TRUE},
+		})
+		txns = append(txns, tx)
+	}
+	return txns
+}
+
+// createTestTemplate returns a block template for the regression test network
+// with the passed number of transactions.
+func createTestTemplate(numTxns int) *mining.BlockTemplate {
+	const height = 1000
+	params := &chaincfg.RegressionNetParams
+	msgBlock := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   0x20000000,
+			PrevBlock: chainhash.Hash{0x01, 0x02, 0x03},
+			Timestamp: time.Unix(time.Now().Unix(), 0),
+			Bits:      params.PowLimitBits,
+		},
+		Transactions: createTestTxns(numTxns, height),
+	}
+	block := btcutil.NewBlock(msgBlock)
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	return &mining.BlockTemplate{
+		Block:  msgBlock,
+		Height: height,
+	}
+}
+
+// TestMerkleBranch ensures the merkle root calculated from the merkle branch and
+// the hash of any coinbase transaction matches the merkle root of the block.
+func TestMerkleBranch(t *testing.T) {
+	t.Parallel()
+
+	for numTxns := 1; numTxns <= 12; numTxns++ {
+		msgTxns := createTestTxns(numTxns, 1000)
+		branch := blockchain.BuildMerkleBranch(btcutil.NewBlock(
+			&wire.MsgBlock{Transactions: msgTxns}).Transactions())
+
+		// Replace the coinbase transaction after calculating the branch.
+		msgTxns[0].TxIn[0].SignatureScript = []byte{0x01, 0x02}
+		txns := btcutil.NewBlock(&wire.MsgBlock{
+			Transactions: msgTxns,
+		}).Transactions()
+		merkles := blockchain.BuildMerkleTreeStore(txns, false)
+		want := merkles[len(merkles)-1]
+		got := merkleRoot(txns[0].Hash(), branch)
+		if !got.IsEqual(want) {
+			t.Errorf("merkle root for %d transactions: got %v, want %v",
+				numTxns, got, want)
+		}
+	}
+}
+
+// TestEncodePrevHash ensures the previous block hash is sent with the bytes of
+// each 32-bit word reversed.
+func TestEncodePrevHash(t *testing.T) {
+	t.Parallel()
+
+	var hash chainhash.Hash
+	for i := range hash {
+		hash[i] = byte(i)
+	}
+	want := "03020100070605040b0a09080f0e0d0c" +
+		"13121110171615141b1a19181f1e1d1c"
+	if got := encodePrevHash(&hash); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+// TestShareTarget ensures the target of shares is scaled by their difficulty.
+func TestShareTarget(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		difficulty float64
+		want       *big.Int
+	}{
+		{1, diff1Target},
+		{2, new(big.Int).Rsh(diff1Target, 1)},
+		{0.5, new(big.Int).Lsh(diff1Target, 1)},
+		{65536, new(big.Int).Lsh(big.NewInt(0xffff), 192)},
+	}
+	for _, test := range tests {
+		if got := shareTarget(test.difficulty); got.Cmp(test.want) != 0 {
+			t.Errorf("target for difficulty %g: got %x, want %x",
+				test.difficulty, got, test.want)
+		}
+	}
+}
+
+// TestNextDifficulty ensures the difficulty of clients is retargeted to their
+// share rate.
+func TestNextDifficulty(t *testing.T) {
+	t.Parallel()
+
+	const target = 10 * time.Second
+	tests := []struct {
+		name       string
+		difficulty float64
+		shares     int
+		elapsed    time.Duration
+		want       float64
+	}{
+		{"too many shares", 1024, 30, time.Minute, 5120},
+		{"on target", 1024, 6, time.Minute, 1024},
+		{"within deviation", 1024, 12, time.Minute, 1024},
+		{"at lower deviation", 1024, 3, time.Minute, 1024},
+		{"too few shares", 1024, 2, 2 * time.Minute, 1024.0 / 6},
+		{"no shares", 1024, 0, time.Minute, 1024.0 / 6},
+		{"minimum", minDifficulty, 0, time.Hour, minDifficulty},
+		{"no time passed", 1, 30, 0, 300000},
+	}
+	for _, test := range tests {
+		got := nextDifficulty(test.difficulty, test.shares, test.elapsed,
+			target)
+		if math.Abs(got-test.want) > test.want*1e-9 {
+			t.Errorf("%s: got %g, want %g", test.name, got, test.want)
+		}
+	}
+}
+
+// TestNewJob ensures jobs split the coinbase transaction around the extra nonce
+// and build blocks with valid merkle roots from submitted shares.
+func TestNewJob(t *testing.T) {
+	t.Parallel()
+
+	template := createTestTemplate(5)
+	minTime := template.Block.Header.Timestamp.Add(-time.Hour)
+	j, err := newJob("1", template, minTime)
+	if err != nil {
+		t.Fatalf("newJob: unexpected error: %v", err)
+	}
+
+	// The coinbase transaction reassembled with an extra nonce holds the
+	// extra nonce in its signature script following the height.
+	extraNonce := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	var serialized []byte
+	serialized = append(serialized, j.coinbase1...)
+	serialized = append(serialized, extraNonce...)
+	serialized = append(serialized, j.coinbase2...)
+	var coinbase wire.MsgTx
+	err = coinbase.DeserializeNoWitness(bytes.NewReader(serialized))
+	if err != nil {
+		t.Fatalf("unable to deserialize coinbase: %v", err)
+	}
+	script, offset, err := coinbaseScript(template.Height)
+	if err != nil {
+		t.Fatalf("coinbaseScript: unexpected error: %v", err)
+	}
+	sigScript := coinbase.TxIn[0].SignatureScript
+	if len(sigScript) != len(script) ||
+		!bytes.Equal(sigScript[offset:offset+extraNonceSize], extraNonce) {
+
+		t.Fatalf("unexpected coinbase signature script %x", sigScript)
+	}
+	if !bytes.HasPrefix(sigScript, template.Block.Transactions[0].TxIn[0].SignatureScript) {
+		t.Fatalf("coinbase signature script %x does not start with the "+
+			"height", sigScript)
+	}
+
+	// The solved block has a valid merkle root and keeps the witness of
+	// the coinbase transaction along with all other transactions.
+	msgBlock, err := j.solve(extraNonce, uint32(minTime.Unix()), 42)
+	if err != nil {
+		t.Fatalf("solve: unexpected error: %v", err)
+	}
+	block := btcutil.NewBlock(msgBlock)
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	if !msgBlock.Header.MerkleRoot.IsEqual(merkles[len(merkles)-1]) {
+		t.Fatalf("block has merkle root %v, want %v",
+			msgBlock.Header.MerkleRoot, merkles[len(merkles)-1])
+	}
+	if msgBlock.Header.Nonce != 42 ||
+		!msgBlock.Header.Timestamp.Equal(minTime) {
+
+		t.Fatalf("unexpected block header %+v", msgBlock.Header)
+	}
+	if len(msgBlock.Transactions) != 5 ||
+		len(msgBlock.Transactions[0].TxIn[0].Witness) != 1 {
+
+		t.Fatalf("block lost transactions or the coinbase witness")
+	}
+
+	// The notification carries the job.
+	params := j.notifyParams(true)
+	if params[0] != "1" || params[2] != hex.EncodeToString(j.coinbase1) ||
+		len(params[4].([]string)) != 3 || params[6] != "207fffff" ||
+		params[8] != true {
+
+		t.Fatalf("unexpected notify parameters %v", params)
+	}
+}
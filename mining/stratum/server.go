@@ -0,0 +1,409 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package stratum
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// jobPollInterval is the interval at which the best chain and the
+	// transaction source are checked for changes which require a new job.
+	jobPollInterval = time.Second
+
+	// jobRefreshInterval is the minimum duration between jobs which only
+	// add new transactions.  New blocks always result in a new job right
+	// away.
+	jobRefreshInterval = 30 * time.Second
+
+	// maxJobs is the maximum number of jobs shares are accepted for.  Jobs
+	// for previous blocks are dropped right away.
+	maxJobs = 16
+)
+
+// Config is a descriptor containing the stratum server configuration.
+type Config struct {
+	// ChainParams identifies which chain parameters the stratum server is
+	// associated with.
+	ChainParams *chaincfg.Params
+
+	// BlockTemplateGenerator identifies the instance to use in order to
+	// generate the block templates handed out to clients as work.
+	BlockTemplateGenerator *mining.BlkTmplGenerator
+
+	// MiningAddrs is a list of payment addresses to use for the generated
+	// blocks.  Each job will randomly choose one of them.
+	MiningAddrs []btcutil.Address
+
+	// ProcessBlock defines the function to call with any solved blocks.
+	// It typically must run the provided block through the same set of
+	// rules and handling as any other block coming from the network.
+	ProcessBlock func(*btcutil.Block, blockchain.BehaviorFlags) (bool, error)
+
+	// IsCurrent defines the function to use to obtain whether or not the
+	// block chain is current.  No work is handed out while the chain is
+	// not current since any solved blocks would be on a side chain and end
+	// up orphaned anyways.
+	IsCurrent func() bool
+
+	// Listeners defines a slice of listeners for which the stratum server
+	// will take ownership of and accept connections.  Since the stratum
+	// server takes ownership of these listeners, they will be closed when
+	// the stratum server is stopped.
+	Listeners []net.Listener
+
+	// InitialDifficulty is the share difficulty clients start with before
+	// it is adjusted to their hash rate.
+	InitialDifficulty float64
+
+	// TargetShareInterval is the interval at which each client should
+	// submit shares.  The difficulty of the shares of each client is
+	// adjusted to achieve it.
+	TargetShareInterval time.Duration
+
+	// MaxClients is the maximum number of clients which may be connected
+	// at the same time.
+	MaxClients int
+}
+
+// Server provides a stratum server which hands out block templates as work to
+// miners, such as ASICs, which connect to it directly.  Shares submitted by
+// the miners are validated against a difficulty which is adjusted to the hash
+// rate of each miner, and shares which solve a block are submitted to the
+// chain.  All blocks pay to the mining addresses of the server.
+type Server struct {
+	started         int32
+	shutdown        int32
+	cfg             Config
+	submitBlockLock sync.Mutex
+	wg              sync.WaitGroup
+	quit            chan struct{}
+
+	// The following fields are protected by the mutex.
+	mtx             sync.Mutex
+	clients         map[*client]struct{}
+	jobs            map[string]*job
+	jobIDs          []string
+	curJob          *job
+	nextJobID       uint64
+	nextExtraNonce1 uint32
+}
+
+// currentJob returns the job which is handed out to clients, or nil if there is
+// none yet.
+//
+// This function is safe for concurrent access.
+func (s *Server) currentJob() *job {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.curJob
+}
+
+// connectedClients returns the clients which are currently connected.
+//
+// This function is safe for concurrent access.
+func (s *Server) connectedClients() []*client {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// job returns the job with the passed id, or nil if shares for it are no
+// longer accepted.
+//
+// This function is safe for concurrent access.
+func (s *Server) job(id string) *job {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.jobs[id]
+}
+
+// addJob creates a job which hands out the passed block template and hands it
+// out to all clients.  Jobs for previous blocks are dropped and clients are
+// told to abandon them.
+//
+// This function is safe for concurrent access.
+func (s *Server) addJob(template *mining.BlockTemplate, minTime time.Time) (*job, error) {
+	s.mtx.Lock()
+	j, err := newJob(fmt.Sprintf("%x", s.nextJobID), template, minTime)
+	if err != nil {
+		s.mtx.Unlock()
+		return nil, err
+	}
+	s.nextJobID++
+
+	prevBlock := &template.Block.Header.PrevBlock
+	cleanJobs := s.curJob == nil ||
+		!s.curJob.template.Block.Header.PrevBlock.IsEqual(prevBlock)
+	if cleanJobs {
+		s.jobs = make(map[string]*job)
+		s.jobIDs = s.jobIDs[:0]
+	}
+	if len(s.jobIDs) == maxJobs {
+		delete(s.jobs, s.jobIDs[0])
+		s.jobIDs = s.jobIDs[1:]
+	}
+	s.jobs[j.id] = j
+	s.jobIDs = append(s.jobIDs, j.id)
+	s.curJob = j
+	s.mtx.Unlock()
+
+	clients := s.connectedClients()
+	log.Debugf("Handing out job %s for block height %d to %d clients "+
+		"(clean %v)", j.id, j.height, len(clients), cleanJobs)
+	for _, c := range clients {
+		c.sendJob(j, cleanJobs)
+	}
+	return j, nil
+}
+
+// generateJob generates a new block template and hands it out to clients as a
+// new job.  Nothing is handed out when the best chain changes while the
+// template is generated.
+func (s *Server) generateJob() (*job, error) {
+	// Choose a payment address at random.
+	payToAddr := s.cfg.MiningAddrs[rand.Intn(len(s.cfg.MiningAddrs))]
+
+	g := s.cfg.BlockTemplateGenerator
+	template, err := g.NewBlockTemplate(payToAddr)
+	if err != nil {
+		return nil, err
+	}
+	best := g.BestSnapshot()
+	if !best.Hash.IsEqual(&template.Block.Header.PrevBlock) {
+		return nil, nil
+	}
+	return s.addJob(template, mining.MinimumMedianTime(best))
+}
+
+// jobHandler hands out new jobs to clients when the best chain changes or when
+// new transactions are available, and retargets the difficulty of clients
+// which don't submit shares.  It must be run as a goroutine.
+func (s *Server) jobHandler() {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	var prevHash chainhash.Hash
+	var lastTxUpdate, lastJob time.Time
+out:
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			for _, c := range s.connectedClients() {
+				c.retarget(now, false)
+			}
+
+			// No work is handed out while the chain is not current.
+			if !s.cfg.IsCurrent() {
+				continue
+			}
+
+			// A new job is needed when the best chain changed, or
+			// when new transactions are available and enough time
+			// passed since the last job.
+			g := s.cfg.BlockTemplateGenerator
+			txUpdate := g.TxSource().LastUpdated()
+			if g.BestSnapshot().Hash == prevHash &&
+				(txUpdate.Equal(lastTxUpdate) ||
+					now.Sub(lastJob) < jobRefreshInterval) {
+
+				continue
+			}
+
+			j, err := s.generateJob()
+			if err != nil {
+				log.Errorf("Unable to generate stratum job: %v", err)
+				continue
+			}
+			if j == nil {
+				continue
+			}
+			prevHash = j.template.Block.Header.PrevBlock
+			lastTxUpdate = txUpdate
+			lastJob = now
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.wg.Done()
+	log.Tracef("Stratum job handler done")
+}
+
+// submitBlock submits the passed block solved by the passed worker to the
+// chain.
+func (s *Server) submitBlock(msgBlock *wire.MsgBlock, worker string) bool {
+	s.submitBlockLock.Lock()
+	defer s.submitBlockLock.Unlock()
+
+	// Process this block using the same rules as blocks coming from other
+	// nodes.  This will in turn relay it to the network like normal.
+	block := btcutil.NewBlock(msgBlock)
+	isOrphan, err := s.cfg.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		// Anything other than a rule violation is an unexpected error,
+		// so log that error as an internal error.
+		if _, ok := err.(blockchain.RuleError); !ok {
+			log.Errorf("Unexpected error while processing "+
+				"block submitted via stratum: %v", err)
+			return false
+		}
+
+		log.Infof("Block submitted via stratum by worker %s rejected: "+
+			"%v", worker, err)
+		return false
+	}
+	if isOrphan {
+		log.Infof("Block submitted via stratum by worker %s is an "+
+			"orphan", worker)
+		return false
+	}
+
+	// The block was accepted.  The amount is the total of the coinbase
+	// outputs since it may be split among several payouts.
+	var amount int64
+	for _, txOut := range msgBlock.Transactions[0].TxOut {
+		amount += txOut.Value
+	}
+	log.Infof("Block submitted via stratum by worker %s accepted (hash %s, "+
+		"amount %v)", worker, block.Hash(), btcutil.Amount(amount))
+	return true
+}
+
+// handleConn registers a client for the passed connection and handles its
+// requests until the connection is closed.  It must be run as a goroutine.
+func (s *Server) handleConn(conn net.Conn) {
+	s.mtx.Lock()
+	if atomic.LoadInt32(&s.shutdown) != 0 {
+		s.mtx.Unlock()
+		conn.Close()
+		s.wg.Done()
+		return
+	}
+	extraNonce1 := make([]byte, extraNonce1Size)
+	binary.BigEndian.PutUint32(extraNonce1, s.nextExtraNonce1)
+	s.nextExtraNonce1++
+	c := newClient(s, conn, extraNonce1)
+	s.clients[c] = struct{}{}
+	s.mtx.Unlock()
+
+	log.Debugf("New stratum client %s", c)
+	c.run()
+	log.Debugf("Stratum client %s disconnected", c)
+
+	s.mtx.Lock()
+	delete(s.clients, c)
+	s.mtx.Unlock()
+	s.wg.Done()
+}
+
+// listenHandler accepts connections on the passed listener.  It must be run as
+// a goroutine.
+func (s *Server) listenHandler(listener net.Listener) {
+	log.Infof("Stratum server listening on %s", listener.Addr())
+	for atomic.LoadInt32(&s.shutdown) == 0 {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Only log the error if not forcibly shutting down.
+			if atomic.LoadInt32(&s.shutdown) == 0 {
+				log.Errorf("Can't accept connection: %v", err)
+			}
+			continue
+		}
+
+		// Limit the number of clients to max allowed.
+		s.mtx.Lock()
+		numClients := len(s.clients)
+		s.mtx.Unlock()
+		if numClients >= s.cfg.MaxClients {
+			log.Infof("Max stratum clients exceeded [%d] - "+
+				"disconnecting client %s", s.cfg.MaxClients,
+				conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		s.wg.Add(1)
+		go s.handleConn(conn)
+	}
+
+	s.wg.Done()
+	log.Tracef("Stratum listener done for %s", listener.Addr())
+}
+
+// Start begins accepting connections from clients and handing out work to
+// them.
+func (s *Server) Start() {
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return
+	}
+
+	log.Trace("Starting stratum server")
+	for _, listener := range s.cfg.Listeners {
+		s.wg.Add(1)
+		go s.listenHandler(listener)
+	}
+	s.wg.Add(1)
+	go s.jobHandler()
+}
+
+// Stop gracefully shuts down the stratum server by closing its listeners and
+// disconnecting all clients.
+func (s *Server) Stop() {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		log.Infof("Stratum server is already in the process of " +
+			"shutting down")
+		return
+	}
+
+	log.Infof("Stratum server shutting down")
+	for _, listener := range s.cfg.Listeners {
+		if err := listener.Close(); err != nil {
+			log.Errorf("Problem shutting down stratum: %v", err)
+		}
+	}
+	close(s.quit)
+	s.mtx.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mtx.Unlock()
+	s.wg.Wait()
+	log.Infof("Stratum server shutdown complete")
+}
+
+// New returns a new instance of a stratum server for the provided
+// configuration.  Use Start to begin accepting connections from clients.
+func New(cfg *Config) *Server {
+	return &Server{
+		cfg:             *cfg,
+		quit:            make(chan struct{}),
+		clients:         make(map[*client]struct{}),
+		jobs:            make(map[string]*job),
+		nextExtraNonce1: rand.Uint32(),
+	}
+}
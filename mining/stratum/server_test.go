@@ -0,0 +1,249 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package stratum
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+)
+
+// testMessage is a response or notification received by a test client.
+type testMessage struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	Result json.RawMessage   `json:"result"`
+	Error  []interface{}     `json:"error"`
+}
+
+// testClient is a client connected to a stratum server in tests.
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int
+}
+
+// send sends a request with the passed method and parameters to the server.
+func (c *testClient) send(method string, params ...interface{}) {
+	c.t.Helper()
+
+	c.nextID++
+	serialized, err := json.Marshal(map[string]interface{}{
+		"id":     c.nextID,
+		"method": method,
+		"params": params,
+	})
+	if err != nil {
+		c.t.Fatalf("unable to marshal request: %v", err)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Write(append(serialized, '\n')); err != nil {
+		c.t.Fatalf("unable to send request: %v", err)
+	}
+}
+
+// receive returns the next message from the server.
+func (c *testClient) receive() *testMessage {
+	c.t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		c.t.Fatalf("unable to receive message: %v", err)
+	}
+	var msg testMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		c.t.Fatalf("unable to unmarshal message %s: %v", line, err)
+	}
+	return &msg
+}
+
+// expectResult sends the passed request and ensures the server responds with
+// the passed result.
+func (c *testClient) expectResult(want string, method string, params ...interface{}) {
+	c.t.Helper()
+
+	c.send(method, params...)
+	msg := c.receive()
+	if msg.Error != nil || string(msg.Result) != want {
+		c.t.Fatalf("%s: got result %s and error %v, want %s", method,
+			msg.Result, msg.Error, want)
+	}
+}
+
+// expectError sends the passed request and ensures the server responds with an
+// error with the passed code.
+func (c *testClient) expectError(code int, method string, params ...interface{}) {
+	c.t.Helper()
+
+	c.send(method, params...)
+	msg := c.receive()
+	if len(msg.Error) != 3 || msg.Error[0] != float64(code) {
+		c.t.Fatalf("%s: got error %v, want code %d", method,
+			msg.Error, code)
+	}
+}
+
+// TestSession ensures clients subscribe and authorize workers, receive work,
+// and submit shares which are validated and submitted to the chain when they
+// solve a block.
+func TestSession(t *testing.T) {
+	t.Parallel()
+
+	processed := make(chan *btcutil.Block, 1)
+	s := New(&Config{
+		ChainParams: &chaincfg.RegressionNetParams,
+		ProcessBlock: func(block *btcutil.Block, _ blockchain.BehaviorFlags) (bool, error) {
+			processed <- block
+			return false, nil
+		},
+		InitialDifficulty:   1,
+		TargetShareInterval: 10 * time.Second,
+		MaxClients:          1,
+	})
+	template := createTestTemplate(3)
+	minTime := template.Block.Header.Timestamp.Add(-time.Hour)
+	if _, err := s.addJob(template, minTime); err != nil {
+		t.Fatalf("addJob: unexpected error: %v", err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	s.wg.Add(1)
+	go s.handleConn(serverConn)
+	c := &testClient{t: t, conn: clientConn, reader: bufio.NewReader(clientConn)}
+	defer func() {
+		clientConn.Close()
+		s.wg.Wait()
+	}()
+
+	// Shares are rejected until the client subscribed.
+	c.expectError(25, "mining.submit", "worker", "0", "00000000",
+		"00000000", "00000000")
+
+	// Subscribing assigns the extra nonce and is followed by the difficulty
+	// and the current job.
+	c.send("mining.subscribe", "test/1.0")
+	msg := c.receive()
+	var result []json.RawMessage
+	if err := json.Unmarshal(msg.Result, &result); err != nil ||
+		len(result) != 3 || string(result[2]) != "4" {
+
+		t.Fatalf("unexpected subscribe result %s", msg.Result)
+	}
+	var extraNonce1Hex string
+	if err := json.Unmarshal(result[1], &extraNonce1Hex); err != nil {
+		t.Fatalf("unexpected extranonce1 %s", result[1])
+	}
+	extraNonce1, err := hex.DecodeString(extraNonce1Hex)
+	if err != nil || len(extraNonce1) != extraNonce1Size {
+		t.Fatalf("unexpected extranonce1 %s", extraNonce1Hex)
+	}
+	if msg := c.receive(); msg.Method != "mining.set_difficulty" ||
+		len(msg.Params) != 1 || string(msg.Params[0]) != "1" {
+
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	msg = c.receive()
+	if msg.Method != "mining.notify" || len(msg.Params) != 9 {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	var jobID string
+	if err := json.Unmarshal(msg.Params[0], &jobID); err != nil {
+		t.Fatalf("unexpected job id %s", msg.Params[0])
+	}
+	nTime := fmt.Sprintf("%08x", template.Block.Header.Timestamp.Unix())
+
+	// Shares are rejected until the worker is authorized.
+	c.expectError(24, "mining.submit", "worker", jobID, "00000000", nTime,
+		"00000000")
+	c.expectResult("true", "mining.authorize", "worker", "password")
+
+	// Shares for unknown jobs, with invalid extra nonces, and with
+	// timestamps out of range are rejected.
+	c.expectError(21, "mining.submit", "worker", "ff", "00000000", nTime,
+		"00000000")
+	c.expectError(20, "mining.submit", "worker", jobID, "0000", nTime,
+		"00000000")
+	c.expectError(20, "mining.submit", "worker", jobID, "00000000",
+		fmt.Sprintf("%08x", minTime.Unix()-1), "00000000")
+	c.expectError(20, "mining.unknown")
+
+	// Find a nonce which solves the block on the regression test network
+	// and one which doesn't meet the network target nor the share
+	// difficulty.
+	j := s.job(jobID)
+	extraNonce2 := []byte{0, 0, 0, 1}
+	extraNonce := append(append([]byte(nil), extraNonce1...), extraNonce2...)
+	target := blockchain.CompactToBig(template.Block.Header.Bits)
+	var solvedNonce, lowNonce *uint32
+	for nonce := uint32(0); solvedNonce == nil || lowNonce == nil; nonce++ {
+		msgBlock, err := j.solve(extraNonce,
+			uint32(template.Block.Header.Timestamp.Unix()), nonce)
+		if err != nil {
+			t.Fatalf("solve: unexpected error: %v", err)
+		}
+		hash := msgBlock.BlockHash()
+		nonce := nonce
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			solvedNonce = &nonce
+		} else {
+			lowNonce = &nonce
+		}
+	}
+
+	c.expectError(23, "mining.submit", "worker", jobID,
+		hex.EncodeToString(extraNonce2), nTime,
+		fmt.Sprintf("%08x", *lowNonce))
+	c.expectResult("true", "mining.submit", "worker", jobID,
+		hex.EncodeToString(extraNonce2), nTime,
+		fmt.Sprintf("%08x", *solvedNonce))
+	select {
+	case block := <-processed:
+		merkles := blockchain.BuildMerkleTreeStore(block.Transactions(),
+			false)
+		header := &block.MsgBlock().Header
+		if !header.MerkleRoot.IsEqual(merkles[len(merkles)-1]) ||
+			header.Nonce != *solvedNonce {
+
+			t.Fatalf("unexpected block header %+v", header)
+		}
+	default:
+		t.Fatal("solved block was not processed")
+	}
+	c.expectError(22, "mining.submit", "worker", jobID,
+		hex.EncodeToString(extraNonce2), nTime,
+		fmt.Sprintf("%08x", *solvedNonce))
+
+	// New jobs for the next block are handed out and replace the previous
+	// jobs.
+	next := createTestTemplate(1)
+	next.Block.Header.PrevBlock = template.Block.BlockHash()
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.addJob(next, minTime)
+		done <- err
+	}()
+	msg = c.receive()
+	if msg.Method != "mining.notify" || len(msg.Params) != 9 ||
+		string(msg.Params[8]) != "true" {
+
+		t.Fatalf("unexpected message %+v", msg)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("addJob: unexpected error: %v", err)
+	}
+	c.expectError(21, "mining.submit", "worker", jobID,
+		hex.EncodeToString(extraNonce2), nTime, "00000001")
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package sv2
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// maxMessageSize is the maximum size of the payload of a message a
+	// client may send.  The largest message clients send is a solution
+	// with a coinbase transaction of up to 64 KiB.
+	maxMessageSize = 128 * 1024
+
+	// clientHandshakeTimeout is the duration after which clients which
+	// don't complete the handshake and set up the connection are
+	// disconnected.
+	clientHandshakeTimeout = 30 * time.Second
+
+	// clientWriteTimeout is the duration after which writing a message to
+	// a client fails.
+	clientWriteTimeout = 10 * time.Second
+)
+
+// message describes the messages exchanged with clients.
+type message interface {
+	encode() ([]byte, error)
+	decode(payload []byte) error
+}
+
+// client houses the state of a connection from a pool or a job declarator.
+type client struct {
+	server *Server
+	conn   net.Conn
+	noise  *noiseConn
+
+	// The following fields are protected by the mutex.
+	mtx sync.Mutex
+
+	// constraints are the constraints of the coinbase outputs the client
+	// adds, or nil if the client did not announce them yet.
+	constraints *msgCoinbaseOutputConstraints
+
+	// curTemplate is the template which was last handed out to the client
+	// at lastTemplate.
+	curTemplate  *template
+	lastTemplate time.Time
+
+	// lastTxUpdate is the time the transaction source was last updated
+	// when a template was last considered for the client.
+	lastTxUpdate time.Time
+}
+
+// newClient returns a client for the passed connection.
+func newClient(s *Server, conn net.Conn) *client {
+	return &client{
+		server: s,
+		conn:   conn,
+	}
+}
+
+// String returns the address of the client.
+func (c *client) String() string {
+	return c.conn.RemoteAddr().String()
+}
+
+// send writes the passed message with the passed type to the client.
+//
+// This function is safe for concurrent access.
+func (c *client) send(msgType uint8, msg message) error {
+	payload, err := msg.encode()
+	if err != nil {
+		return err
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(clientWriteTimeout))
+	return c.noise.writeMessage(msgType, payload)
+}
+
+// provideTemplate hands out the passed template to the client.  Future
+// templates are followed by the SetNewPrevHash message which makes them the
+// current template.  Failures are logged and close the connection, which ends
+// the read loop of the client.
+func (c *client) provideTemplate(t *template, future bool, now time.Time) {
+	c.mtx.Lock()
+	c.curTemplate = t
+	c.lastTemplate = now
+	c.lastTxUpdate = t.txUpdate
+	c.mtx.Unlock()
+
+	msg, err := t.newTemplateMsg(future)
+	if err != nil {
+		log.Errorf("Unable to create template %d: %v", t.id, err)
+		return
+	}
+	log.Debugf("Handing out template %d for block height %d to %s "+
+		"(future %v)", t.id, t.template.Height, c, future)
+	err = c.send(msgTypeNewTemplate, msg)
+	if err == nil && future {
+		err = c.send(msgTypeSetNewPrevHash, t.setNewPrevHashMsg())
+	}
+	if err != nil {
+		log.Debugf("Unable to send template to %s: %v", c, err)
+		c.conn.Close()
+	}
+}
+
+// setupConnection performs the handshake and handles the SetupConnection
+// message the client sends first.
+func (c *client) setupConnection() error {
+	s := c.server
+	c.conn.SetDeadline(time.Now().Add(clientHandshakeTimeout))
+	noise, err := respondHandshake(c.conn, s.staticKey, &s.staticEll,
+		s.certificate)
+	if err != nil {
+		return fmt.Errorf("handshake failed: %v", err)
+	}
+	c.noise = noise
+
+	msgType, payload, err := noise.readMessage(maxMessageSize)
+	if err != nil {
+		return err
+	}
+	if msgType != msgTypeSetupConnection {
+		return fmt.Errorf("expected SetupConnection, got message type "+
+			"%#02x", msgType)
+	}
+	var setup msgSetupConnection
+	if err := setup.decode(payload); err != nil {
+		return err
+	}
+
+	var errorCode string
+	switch {
+	case setup.protocol != protocolTemplateDistribution:
+		errorCode = errCodeUnsupportedProtocol
+	case setup.minVersion > protocolVersion ||
+		setup.maxVersion < protocolVersion:
+		errorCode = errCodeVersionMismatch
+	}
+	if errorCode != "" {
+		c.send(msgTypeSetupConnectionError,
+			&msgSetupConnectionError{errorCode: errorCode})
+		return fmt.Errorf("connection setup rejected: %s", errorCode)
+	}
+	err = c.send(msgTypeSetupConnectionSuccess,
+		&msgSetupConnectionSuccess{usedVersion: protocolVersion})
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Set up connection from %s (vendor %q, firmware %q)", c,
+		setup.vendor, setup.firmware)
+	c.conn.SetDeadline(time.Time{})
+	return nil
+}
+
+// run performs the handshake and handles the messages of the client until its
+// connection is closed.  It must be run as a goroutine.
+func (c *client) run() {
+	if err := c.setupConnection(); err != nil {
+		log.Debugf("Unable to set up connection from %s: %v", c, err)
+		c.conn.Close()
+		return
+	}
+
+	for {
+		msgType, payload, err := c.noise.readMessage(maxMessageSize)
+		if err != nil {
+			log.Debugf("Unable to read from %s: %v", c, err)
+			break
+		}
+		if err := c.handleMessage(msgType, payload); err != nil {
+			log.Debugf("Unable to handle message of type %#02x from "+
+				"%s: %v", msgType, c, err)
+			break
+		}
+	}
+	c.conn.Close()
+}
+
+// handleMessage handles the passed message with the passed type.  Messages of
+// unknown types are ignored.
+func (c *client) handleMessage(msgType uint8, payload []byte) error {
+	switch msgType {
+	case msgTypeCoinbaseOutputConstraints:
+		var msg msgCoinbaseOutputConstraints
+		if err := msg.decode(payload); err != nil {
+			return err
+		}
+		c.handleCoinbaseOutputConstraints(&msg)
+
+	case msgTypeRequestTransactionData:
+		var msg msgRequestTransactionData
+		if err := msg.decode(payload); err != nil {
+			return err
+		}
+		return c.handleRequestTransactionData(&msg)
+
+	case msgTypeSubmitSolution:
+		var msg msgSubmitSolution
+		if err := msg.decode(payload); err != nil {
+			return err
+		}
+		c.handleSubmitSolution(&msg)
+
+	default:
+		log.Debugf("Ignoring message of unknown type %#02x from %s",
+			msgType, c)
+	}
+	return nil
+}
+
+// handleCoinbaseOutputConstraints handles CoinbaseOutputConstraints messages.
+// Clients which change their constraints are handed out a new template right
+// away.
+func (c *client) handleCoinbaseOutputConstraints(msg *msgCoinbaseOutputConstraints) {
+	log.Debugf("Client %s adds coinbase outputs of up to %d bytes and %d "+
+		"signature operations", c, msg.maxAdditionalSize,
+		msg.maxAdditionalSigOps)
+
+	c.mtx.Lock()
+	changed := c.constraints == nil || *c.constraints != *msg
+	c.constraints = msg
+	if changed {
+		c.curTemplate = nil
+	}
+	c.mtx.Unlock()
+
+	if changed && c.server.cfg.IsCurrent() {
+		c.server.updateClient(c, time.Now(), nil)
+	}
+}
+
+// handleRequestTransactionData handles RequestTransactionData messages, which
+// request the transactions of a template.
+func (c *client) handleRequestTransactionData(msg *msgRequestTransactionData) error {
+	t := c.server.template(msg.templateID)
+	if t == nil {
+		return c.send(msgTypeRequestTransactionDataError,
+			&msgRequestTransactionDataError{
+				templateID: msg.templateID,
+				errorCode:  errCodeTemplateIDNotFound,
+			})
+	}
+	reply, err := t.transactionDataMsg()
+	if err != nil {
+		return err
+	}
+	return c.send(msgTypeRequestTransactionDataSuccess, reply)
+}
+
+// handleSubmitSolution handles SubmitSolution messages, which submit a solved
+// block built from a template.
+func (c *client) handleSubmitSolution(msg *msgSubmitSolution) {
+	t := c.server.template(msg.templateID)
+	if t == nil {
+		log.Infof("Solution submitted by %s for unknown template %d", c,
+			msg.templateID)
+		return
+	}
+	msgBlock, err := t.solve(msg)
+	if err != nil {
+		log.Infof("Invalid solution submitted by %s for template %d: %v",
+			c, msg.templateID, err)
+		return
+	}
+	c.server.submitBlock(msgBlock, c)
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package sv2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	// frameHeaderSize is the size of the header of each frame, which
+	// consists of the extension type, the message type, and the length of
+	// the payload.
+	frameHeaderSize = 6
+
+	// maxFrameLen is the maximum length of the payload of a frame, which
+	// is limited by its 24-bit length field.
+	maxFrameLen = 1<<24 - 1
+)
+
+var (
+	// errShortPayload is returned when the payload of a message ends
+	// before all of its fields are decoded.
+	errShortPayload = errors.New("message payload too short")
+
+	// errSequenceTooLong is returned when a sequence has more elements
+	// than its length prefix can encode.
+	errSequenceTooLong = errors.New("sequence too long")
+)
+
+// encoder serializes the fields of messages using the binary encoding of the
+// Stratum V2 protocol, which encodes integers in little-endian byte order and
+// prefixes variable length fields with their length.
+type encoder struct {
+	buf []byte
+	err error
+}
+
+// u8 appends the passed 8-bit value.
+func (e *encoder) u8(v uint8) {
+	e.buf = append(e.buf, v)
+}
+
+// boolean appends the passed value as a single byte.
+func (e *encoder) boolean(v bool) {
+	if v {
+		e.u8(1)
+		return
+	}
+	e.u8(0)
+}
+
+// u16 appends the passed 16-bit value.
+func (e *encoder) u16(v uint16) {
+	e.buf = append(e.buf, byte(v), byte(v>>8))
+}
+
+// u24 appends the passed value as a 24-bit value.
+func (e *encoder) u24(v uint32) {
+	e.buf = append(e.buf, byte(v), byte(v>>8), byte(v>>16))
+}
+
+// u32 appends the passed 32-bit value.
+func (e *encoder) u32(v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+// u64 appends the passed 64-bit value.
+func (e *encoder) u64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+// u256 appends the passed 256-bit value.
+func (e *encoder) u256(v *chainhash.Hash) {
+	e.buf = append(e.buf, v[:]...)
+}
+
+// bytes appends the passed bytes prefixed with their length, which is encoded
+// with the passed number of bytes.  An error is recorded when the length does
+// not fit.
+func (e *encoder) bytes(v []byte, lenSize int) {
+	if uint64(len(v)) >= 1<<(8*uint(lenSize)) {
+		e.err = fmt.Errorf("field of %d bytes exceeds its %d-byte "+
+			"length prefix", len(v), lenSize)
+		return
+	}
+	switch lenSize {
+	case 1:
+		e.u8(uint8(len(v)))
+	case 2:
+		e.u16(uint16(len(v)))
+	case 3:
+		e.u24(uint32(len(v)))
+	}
+	e.buf = append(e.buf, v...)
+}
+
+// decoder deserializes the fields of messages encoded by an encoder.  The first
+// error is recorded and all later reads return zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+// next returns the next n bytes of the payload.
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	if len(d.buf) < n {
+		d.err = errShortPayload
+		return make([]byte, n)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+// u8 reads an 8-bit value.
+func (d *decoder) u8() uint8 {
+	return d.next(1)[0]
+}
+
+// boolean reads a single byte boolean value.
+func (d *decoder) boolean() bool {
+	v := d.u8()
+	if v > 1 && d.err == nil {
+		d.err = fmt.Errorf("invalid boolean value %d", v)
+	}
+	return v == 1
+}
+
+// u16 reads a 16-bit value.
+func (d *decoder) u16() uint16 {
+	return binary.LittleEndian.Uint16(d.next(2))
+}
+
+// u24 reads a 24-bit value.
+func (d *decoder) u24() uint32 {
+	b := d.next(3)
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+// u32 reads a 32-bit value.
+func (d *decoder) u32() uint32 {
+	return binary.LittleEndian.Uint32(d.next(4))
+}
+
+// u64 reads a 64-bit value.
+func (d *decoder) u64() uint64 {
+	return binary.LittleEndian.Uint64(d.next(8))
+}
+
+// u256 reads a 256-bit value.
+func (d *decoder) u256() chainhash.Hash {
+	var v chainhash.Hash
+	copy(v[:], d.next(chainhash.HashSize))
+	return v
+}
+
+// bytes reads bytes prefixed with their length, which is encoded with the
+// passed number of bytes.  The returned slice is a copy.
+func (d *decoder) bytes(lenSize int) []byte {
+	var n uint32
+	switch lenSize {
+	case 1:
+		n = uint32(d.u8())
+	case 2:
+		n = uint32(d.u16())
+	case 3:
+		n = d.u24()
+	}
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.next(int(n)))
+	return b
+}
+
+// encodeFrameHeader returns the header of a frame which holds a message of the
+// passed type with a payload of the passed length.
+func encodeFrameHeader(msgType uint8, payloadLen int) []byte {
+	var e encoder
+	e.u16(0)
+	e.u8(msgType)
+	e.u24(uint32(payloadLen))
+	return e.buf
+}
+
+// decodeFrameHeader returns the message type and the payload length of the
+// passed frame header.
+func decodeFrameHeader(header []byte) (uint8, int, error) {
+	d := decoder{buf: header}
+	extensionType := d.u16()
+	msgType := d.u8()
+	payloadLen := d.u24()
+	if d.err != nil {
+		return 0, 0, d.err
+	}
+
+	// Extensions are not supported, but the bit which marks messages
+	// addressed to a channel may be set.
+	if extensionType&0x7fff != 0 {
+		return 0, 0, fmt.Errorf("unsupported extension type %d",
+			extensionType&0x7fff)
+	}
+	return msgType, int(payloadLen), nil
+}
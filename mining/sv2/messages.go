@@ -0,0 +1,357 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package sv2
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// These constants define the types of the messages of the common and template
+// distribution protocols.
+const (
+	msgTypeSetupConnection               = 0x00
+	msgTypeSetupConnectionSuccess        = 0x01
+	msgTypeSetupConnectionError          = 0x02
+	msgTypeCoinbaseOutputConstraints     = 0x70
+	msgTypeNewTemplate                   = 0x71
+	msgTypeSetNewPrevHash                = 0x72
+	msgTypeRequestTransactionData        = 0x73
+	msgTypeRequestTransactionDataSuccess = 0x74
+	msgTypeRequestTransactionDataError   = 0x75
+	msgTypeSubmitSolution                = 0x76
+)
+
+const (
+	// protocolTemplateDistribution identifies the template distribution
+	// protocol in SetupConnection.
+	protocolTemplateDistribution = 2
+
+	// protocolVersion is the version of the protocol spoken by the server.
+	protocolVersion = 2
+)
+
+// These constants define the error codes sent to clients.
+const (
+	errCodeUnsupportedProtocol = "unsupported-protocol"
+	errCodeVersionMismatch     = "protocol-version-mismatch"
+	errCodeTemplateIDNotFound  = "template-id-not-found"
+)
+
+// msgSetupConnection is sent by clients to set up the connection once the
+// handshake is complete.
+type msgSetupConnection struct {
+	protocol        uint8
+	minVersion      uint16
+	maxVersion      uint16
+	flags           uint32
+	endpointHost    string
+	endpointPort    uint16
+	vendor          string
+	hardwareVersion string
+	firmware        string
+	deviceID        string
+}
+
+// encode returns the serialized message.
+func (m *msgSetupConnection) encode() ([]byte, error) {
+	var e encoder
+	e.u8(m.protocol)
+	e.u16(m.minVersion)
+	e.u16(m.maxVersion)
+	e.u32(m.flags)
+	e.bytes([]byte(m.endpointHost), 1)
+	e.u16(m.endpointPort)
+	e.bytes([]byte(m.vendor), 1)
+	e.bytes([]byte(m.hardwareVersion), 1)
+	e.bytes([]byte(m.firmware), 1)
+	e.bytes([]byte(m.deviceID), 1)
+	return e.buf, e.err
+}
+
+// decode deserializes the passed payload into the message.
+func (m *msgSetupConnection) decode(payload []byte) error {
+	d := decoder{buf: payload}
+	m.protocol = d.u8()
+	m.minVersion = d.u16()
+	m.maxVersion = d.u16()
+	m.flags = d.u32()
+	m.endpointHost = string(d.bytes(1))
+	m.endpointPort = d.u16()
+	m.vendor = string(d.bytes(1))
+	m.hardwareVersion = string(d.bytes(1))
+	m.firmware = string(d.bytes(1))
+	m.deviceID = string(d.bytes(1))
+	return d.err
+}
+
+// msgSetupConnectionSuccess is sent in reply to an accepted SetupConnection.
+type msgSetupConnectionSuccess struct {
+	usedVersion uint16
+	flags       uint32
+}
+
+// encode returns the serialized message.
+func (m *msgSetupConnectionSuccess) encode() ([]byte, error) {
+	var e encoder
+	e.u16(m.usedVersion)
+	e.u32(m.flags)
+	return e.buf, e.err
+}
+
+// decode deserializes the passed payload into the message.
+func (m *msgSetupConnectionSuccess) decode(payload []byte) error {
+	d := decoder{buf: payload}
+	m.usedVersion = d.u16()
+	m.flags = d.u32()
+	return d.err
+}
+
+// msgSetupConnectionError is sent in reply to a rejected SetupConnection.
+type msgSetupConnectionError struct {
+	flags     uint32
+	errorCode string
+}
+
+// encode returns the serialized message.
+func (m *msgSetupConnectionError) encode() ([]byte, error) {
+	var e encoder
+	e.u32(m.flags)
+	e.bytes([]byte(m.errorCode), 1)
+	return e.buf, e.err
+}
+
+// decode deserializes the passed payload into the message.
+func (m *msgSetupConnectionError) decode(payload []byte) error {
+	d := decoder{buf: payload}
+	m.flags = d.u32()
+	m.errorCode = string(d.bytes(1))
+	return d.err
+}
+
+// msgCoinbaseOutputConstraints is sent by clients to announce the size and the
+// signature operations of the outputs they add to the coinbase transaction, so
+// templates leave room for them.
+type msgCoinbaseOutputConstraints struct {
+	maxAdditionalSize   uint32
+	maxAdditionalSigOps uint16
+}
+
+// encode returns the serialized message.
+func (m *msgCoinbaseOutputConstraints) encode() ([]byte, error) {
+	var e encoder
+	e.u32(m.maxAdditionalSize)
+	e.u16(m.maxAdditionalSigOps)
+	return e.buf, e.err
+}
+
+// decode deserializes the passed payload into the message.
+func (m *msgCoinbaseOutputConstraints) decode(payload []byte) error {
+	d := decoder{buf: payload}
+	m.maxAdditionalSize = d.u32()
+	m.maxAdditionalSigOps = d.u16()
+	return d.err
+}
+
+// msgNewTemplate hands out a block template.  Future templates are built on
+// the previous block announced by the next SetNewPrevHash.
+type msgNewTemplate struct {
+	templateID               uint64
+	future                   bool
+	version                  uint32
+	coinbaseTxVersion        uint32
+	coinbasePrefix           []byte
+	coinbaseTxInputSequence  uint32
+	coinbaseTxValueRemaining uint64
+	coinbaseTxOutputsCount   uint32
+	coinbaseTxOutputs        []byte
+	coinbaseTxLockTime       uint32
+	merklePath               []chainhash.Hash
+}
+
+// encode returns the serialized message.
+func (m *msgNewTemplate) encode() ([]byte, error) {
+	var e encoder
+	e.u64(m.templateID)
+	e.boolean(m.future)
+	e.u32(m.version)
+	e.u32(m.coinbaseTxVersion)
+	e.bytes(m.coinbasePrefix, 1)
+	e.u32(m.coinbaseTxInputSequence)
+	e.u64(m.coinbaseTxValueRemaining)
+	e.u32(m.coinbaseTxOutputsCount)
+	e.bytes(m.coinbaseTxOutputs, 2)
+	e.u32(m.coinbaseTxLockTime)
+	if len(m.merklePath) > 0xff {
+		e.err = errSequenceTooLong
+	}
+	e.u8(uint8(len(m.merklePath)))
+	for i := range m.merklePath {
+		e.u256(&m.merklePath[i])
+	}
+	return e.buf, e.err
+}
+
+// decode deserializes the passed payload into the message.
+func (m *msgNewTemplate) decode(payload []byte) error {
+	d := decoder{buf: payload}
+	m.templateID = d.u64()
+	m.future = d.boolean()
+	m.version = d.u32()
+	m.coinbaseTxVersion = d.u32()
+	m.coinbasePrefix = d.bytes(1)
+	m.coinbaseTxInputSequence = d.u32()
+	m.coinbaseTxValueRemaining = d.u64()
+	m.coinbaseTxOutputsCount = d.u32()
+	m.coinbaseTxOutputs = d.bytes(2)
+	m.coinbaseTxLockTime = d.u32()
+	m.merklePath = make([]chainhash.Hash, d.u8())
+	for i := range m.merklePath {
+		m.merklePath[i] = d.u256()
+	}
+	return d.err
+}
+
+// msgSetNewPrevHash announces the previous block the future template with the
+// passed id is built on, which makes it the current template.
+type msgSetNewPrevHash struct {
+	templateID      uint64
+	prevHash        chainhash.Hash
+	headerTimestamp uint32
+	nBits           uint32
+	target          chainhash.Hash
+}
+
+// encode returns the serialized message.
+func (m *msgSetNewPrevHash) encode() ([]byte, error) {
+	var e encoder
+	e.u64(m.templateID)
+	e.u256(&m.prevHash)
+	e.u32(m.headerTimestamp)
+	e.u32(m.nBits)
+	e.u256(&m.target)
+	return e.buf, e.err
+}
+
+// decode deserializes the passed payload into the message.
+func (m *msgSetNewPrevHash) decode(payload []byte) error {
+	d := decoder{buf: payload}
+	m.templateID = d.u64()
+	m.prevHash = d.u256()
+	m.headerTimestamp = d.u32()
+	m.nBits = d.u32()
+	m.target = d.u256()
+	return d.err
+}
+
+// msgRequestTransactionData is sent by clients to request the transactions of
+// the template with the passed id.
+type msgRequestTransactionData struct {
+	templateID uint64
+}
+
+// encode returns the serialized message.
+func (m *msgRequestTransactionData) encode() ([]byte, error) {
+	var e encoder
+	e.u64(m.templateID)
+	return e.buf, e.err
+}
+
+// decode deserializes the passed payload into the message.
+func (m *msgRequestTransactionData) decode(payload []byte) error {
+	d := decoder{buf: payload}
+	m.templateID = d.u64()
+	return d.err
+}
+
+// msgRequestTransactionDataSuccess carries the transactions of a template other
+// than the coinbase transaction along with the witness reserved value of the
+// coinbase transaction, if any.
+type msgRequestTransactionDataSuccess struct {
+	templateID      uint64
+	excessData      []byte
+	transactionList [][]byte
+}
+
+// encode returns the serialized message.
+func (m *msgRequestTransactionDataSuccess) encode() ([]byte, error) {
+	var e encoder
+	e.u64(m.templateID)
+	e.bytes(m.excessData, 2)
+	if len(m.transactionList) > 0xffff {
+		e.err = errSequenceTooLong
+	}
+	e.u16(uint16(len(m.transactionList)))
+	for _, tx := range m.transactionList {
+		e.bytes(tx, 3)
+	}
+	return e.buf, e.err
+}
+
+// decode deserializes the passed payload into the message.
+func (m *msgRequestTransactionDataSuccess) decode(payload []byte) error {
+	d := decoder{buf: payload}
+	m.templateID = d.u64()
+	m.excessData = d.bytes(2)
+	m.transactionList = make([][]byte, 0, d.u16())
+	for i := 0; i < cap(m.transactionList) && d.err == nil; i++ {
+		m.transactionList = append(m.transactionList, d.bytes(3))
+	}
+	return d.err
+}
+
+// msgRequestTransactionDataError is sent in reply to a request for the
+// transactions of an unknown template.
+type msgRequestTransactionDataError struct {
+	templateID uint64
+	errorCode  string
+}
+
+// encode returns the serialized message.
+func (m *msgRequestTransactionDataError) encode() ([]byte, error) {
+	var e encoder
+	e.u64(m.templateID)
+	e.bytes([]byte(m.errorCode), 1)
+	return e.buf, e.err
+}
+
+// decode deserializes the passed payload into the message.
+func (m *msgRequestTransactionDataError) decode(payload []byte) error {
+	d := decoder{buf: payload}
+	m.templateID = d.u64()
+	m.errorCode = string(d.bytes(1))
+	return d.err
+}
+
+// msgSubmitSolution is sent by clients once a block built from the template
+// with the passed id is solved.
+type msgSubmitSolution struct {
+	templateID      uint64
+	version         uint32
+	headerTimestamp uint32
+	headerNonce     uint32
+	coinbaseTx      []byte
+}
+
+// encode returns the serialized message.
+func (m *msgSubmitSolution) encode() ([]byte, error) {
+	var e encoder
+	e.u64(m.templateID)
+	e.u32(m.version)
+	e.u32(m.headerTimestamp)
+	e.u32(m.headerNonce)
+	e.bytes(m.coinbaseTx, 2)
+	return e.buf, e.err
+}
+
+// decode deserializes the passed payload into the message.
+func (m *msgSubmitSolution) decode(payload []byte) error {
+	d := decoder{buf: payload}
+	m.templateID = d.u64()
+	m.version = d.u32()
+	m.headerTimestamp = d.u32()
+	m.headerNonce = d.u32()
+	m.coinbaseTx = d.bytes(2)
+	return d.err
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package sv2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// TestMessages ensures messages are serialized as defined by the protocol and
+// deserialize to the original messages.
+func TestMessages(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		msg     message
+		decoded message
+		encoded string
+	}{
+		{
+			name: "SetupConnection",
+			msg: &msgSetupConnection{
+				protocol:     protocolTemplateDistribution,
+				minVersion:   2,
+				maxVersion:   2,
+				flags:        1,
+				endpointHost: "127.0.0.1",
+				endpointPort: 8442,
+				vendor:       "btcd",
+			},
+			decoded: &msgSetupConnection{},
+			encoded: "02" + "0200" + "0200" + "01000000" +
+				"09" + hex.EncodeToString([]byte("127.0.0.1")) +
+				"fa20" + "04" + hex.EncodeToString([]byte("btcd")) +
+				"00" + "00" + "00",
+		},
+		{
+			name:    "SetupConnection.Success",
+			msg:     &msgSetupConnectionSuccess{usedVersion: 2, flags: 3},
+			decoded: &msgSetupConnectionSuccess{},
+			encoded: "0200" + "03000000",
+		},
+		{
+			name: "SetupConnection.Error",
+			msg: &msgSetupConnectionError{
+				errorCode: errCodeUnsupportedProtocol,
+			},
+			decoded: &msgSetupConnectionError{},
+			encoded: "00000000" + "14" +
+				hex.EncodeToString([]byte(errCodeUnsupportedProtocol)),
+		},
+		{
+			name: "CoinbaseOutputConstraints",
+			msg: &msgCoinbaseOutputConstraints{
+				maxAdditionalSize:   100,
+				maxAdditionalSigOps: 4,
+			},
+			decoded: &msgCoinbaseOutputConstraints{},
+			encoded: "64000000" + "0400",
+		},
+		{
+			name: "NewTemplate",
+			msg: &msgNewTemplate{
+				templateID:               1,
+				future:                   true,
+				version:                  0x20000000,
+				coinbaseTxVersion:        2,
+				coinbasePrefix:           []byte{0x02, 0xe8, 0x03},
+				coinbaseTxInputSequence:  0xffffffff,
+				coinbaseTxValueRemaining: 5000000000,
+				coinbaseTxOutputsCount:   1,
+				coinbaseTxOutputs:        []byte{0x00, 0x01, 0x6a},
+				coinbaseTxLockTime:       0,
+				merklePath:               []chainhash.Hash{{0x01}},
+			},
+			decoded: &msgNewTemplate{},
+			encoded: "0100000000000000" + "01" + "00000020" +
+				"02000000" + "03" + "02e803" + "ffffffff" +
+				"00f2052a01000000" + "01000000" + "0300" +
+				"00016a" + "00000000" + "01" + "01" +
+				strings.Repeat("00", 31),
+		},
+		{
+			name: "SetNewPrevHash",
+			msg: &msgSetNewPrevHash{
+				templateID:      1,
+				prevHash:        chainhash.Hash{0x02},
+				headerTimestamp: 3,
+				nBits:           0x207fffff,
+				target:          chainhash.Hash{0x04},
+			},
+			decoded: &msgSetNewPrevHash{},
+			encoded: "0100000000000000" + "02" +
+				strings.Repeat("00", 31) + "03000000" + "ffff7f20" +
+				"04" + strings.Repeat("00", 31),
+		},
+		{
+			name:    "RequestTransactionData",
+			msg:     &msgRequestTransactionData{templateID: 5},
+			decoded: &msgRequestTransactionData{},
+			encoded: "0500000000000000",
+		},
+		{
+			name: "RequestTransactionData.Success",
+			msg: &msgRequestTransactionDataSuccess{
+				templateID:      5,
+				excessData:      []byte{0xaa},
+				transactionList: [][]byte{{0x01, 0x02}, {}},
+			},
+			decoded: &msgRequestTransactionDataSuccess{},
+			encoded: "0500000000000000" + "0100" + "aa" + "0200" +
+				"020000" + "0102" + "000000",
+		},
+		{
+			name: "RequestTransactionData.Error",
+			msg: &msgRequestTransactionDataError{
+				templateID: 5,
+				errorCode:  errCodeTemplateIDNotFound,
+			},
+			decoded: &msgRequestTransactionDataError{},
+			encoded: "0500000000000000" + "15" +
+				hex.EncodeToString([]byte(errCodeTemplateIDNotFound)),
+		},
+		{
+			name: "SubmitSolution",
+			msg: &msgSubmitSolution{
+				templateID:      5,
+				version:         0x20000000,
+				headerTimestamp: 6,
+				headerNonce:     7,
+				coinbaseTx:      []byte{0x01},
+			},
+			decoded: &msgSubmitSolution{},
+			encoded: "0500000000000000" + "00000020" + "06000000" +
+				"07000000" + "0100" + "01",
+		},
+	}
+
+	for _, test := range tests {
+		encoded, err := test.msg.encode()
+		if err != nil {
+			t.Errorf("%s: encode: unexpected error: %v", test.name, err)
+			continue
+		}
+		want, err := hex.DecodeString(test.encoded)
+		if err != nil {
+			t.Errorf("%s: invalid test data: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(encoded, want) {
+			t.Errorf("%s: got %x, want %x", test.name, encoded, want)
+			continue
+		}
+		if err := test.decoded.decode(encoded); err != nil {
+			t.Errorf("%s: decode: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.decoded, test.msg) {
+			t.Errorf("%s: decoded %+v, want %+v", test.name,
+				test.decoded, test.msg)
+			continue
+		}
+
+		// Truncated payloads are rejected.
+		if len(encoded) > 0 {
+			err = test.decoded.decode(encoded[:len(encoded)-1])
+			if err == nil {
+				t.Errorf("%s: truncated payload decoded", test.name)
+			}
+		}
+	}
+}
+
+// TestEncodeLimits ensures fields which exceed their length prefixes are not
+// serialized.
+func TestEncodeLimits(t *testing.T) {
+	t.Parallel()
+
+	setup := &msgSetupConnection{vendor: strings.Repeat("a", 256)}
+	if _, err := setup.encode(); err == nil {
+		t.Fatal("vendor exceeding 255 bytes encoded")
+	}
+	solution := &msgSubmitSolution{coinbaseTx: make([]byte, 1<<16)}
+	if _, err := solution.encode(); err == nil {
+		t.Fatal("coinbase transaction exceeding 64 KiB encoded")
+	}
+	tmplMsg := &msgNewTemplate{merklePath: make([]chainhash.Hash, 256)}
+	if _, err := tmplMsg.encode(); err == nil {
+		t.Fatal("merkle path exceeding 255 hashes encoded")
+	}
+}
@@ -0,0 +1,402 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package sv2
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// protocolName is the name of the Noise protocol which secures the
+	// connections to clients.
+	protocolName = "Noise_NX_Secp256k1+EllSwift_ChaChaPoly_SHA256"
+
+	// macSize is the size of the Poly1305 authentication tag appended to
+	// each encrypted message.
+	macSize = 16
+
+	// maxChunkLen is the maximum length of an encrypted chunk of the
+	// payload of a frame including its authentication tag.
+	maxChunkLen = 65535
+
+	// encryptedHeaderSize is the size of the encrypted header of a frame.
+	encryptedHeaderSize = frameHeaderSize + macSize
+
+	// certificateSize is the size of the certificate sent by the responder
+	// during the handshake, which consists of the version, the validity
+	// period and the signature.
+	certificateSize = 2 + 4 + 4 + btcec.SchnorrSignatureSize
+
+	// handshakeResponseSize is the size of the message the responder sends
+	// in reply to the ephemeral key of the initiator, which consists of
+	// the ephemeral key of the responder, the encrypted static key of the
+	// responder and the encrypted certificate.
+	handshakeResponseSize = btcec.EllSwiftEncodingSize +
+		btcec.EllSwiftEncodingSize + macSize + certificateSize + macSize
+)
+
+// cipherState houses a key along with the nonce of the next message encrypted
+// or decrypted with it.
+type cipherState struct {
+	aead  cipher.AEAD
+	nonce uint64
+}
+
+// newCipherState returns a cipher state using the passed key.
+func newCipherState(key []byte) (*cipherState, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &cipherState{aead: aead}, nil
+}
+
+// nextNonce returns the nonce of the next message and advances the counter.
+func (c *cipherState) nextNonce() []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.nonce)
+	c.nonce++
+	return nonce[:]
+}
+
+// encrypt returns the passed plaintext encrypted and authenticated along with
+// the passed associated data.
+func (c *cipherState) encrypt(ad, plaintext []byte) []byte {
+	return c.aead.Seal(nil, c.nextNonce(), plaintext, ad)
+}
+
+// decrypt returns the plaintext of the passed ciphertext once it is
+// authenticated along with the passed associated data.
+func (c *cipherState) decrypt(ad, ciphertext []byte) ([]byte, error) {
+	return c.aead.Open(nil, c.nextNonce(), ciphertext, ad)
+}
+
+// hkdf returns the two keys the Noise protocol derives from the passed chaining
+// key and input key material.
+func hkdf(chainingKey, ikm []byte) ([32]byte, [32]byte) {
+	hmacSum := func(key []byte, data ...[]byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		for _, d := range data {
+			mac.Write(d)
+		}
+		return mac.Sum(nil)
+	}
+
+	var out1, out2 [32]byte
+	tempKey := hmacSum(chainingKey, ikm)
+	copy(out1[:], hmacSum(tempKey, []byte{0x01}))
+	copy(out2[:], hmacSum(tempKey, out1[:], []byte{0x02}))
+	return out1, out2
+}
+
+// symmetricState houses the state shared by both parties during the handshake,
+// which is the hash of the handshake transcript, the chaining key and the key
+// used to encrypt the handshake messages once it is established.
+type symmetricState struct {
+	h      [32]byte
+	ck     [32]byte
+	cipher *cipherState
+}
+
+// newSymmetricState returns the symmetric state at the start of a handshake.
+func newSymmetricState() *symmetricState {
+	s := &symmetricState{h: sha256.Sum256([]byte(protocolName))}
+	s.ck = s.h
+	return s
+}
+
+// mixHash mixes the passed data into the hash of the handshake transcript.
+func (s *symmetricState) mixHash(data []byte) {
+	h := sha256.New()
+	h.Write(s.h[:])
+	h.Write(data)
+	copy(s.h[:], h.Sum(nil))
+}
+
+// mixKey mixes the passed input key material into the chaining key and
+// replaces the key used to encrypt the handshake messages.
+func (s *symmetricState) mixKey(ikm []byte) error {
+	ck, key := hkdf(s.ck[:], ikm)
+	cs, err := newCipherState(key[:])
+	if err != nil {
+		return err
+	}
+	s.ck = ck
+	s.cipher = cs
+	return nil
+}
+
+// encryptAndHash returns the passed handshake payload encrypted with the hash
+// of the transcript as associated data and mixes the result into the hash.
+func (s *symmetricState) encryptAndHash(plaintext []byte) []byte {
+	ciphertext := plaintext
+	if s.cipher != nil {
+		ciphertext = s.cipher.encrypt(s.h[:], plaintext)
+	}
+	s.mixHash(ciphertext)
+	return ciphertext
+}
+
+// decryptAndHash returns the plaintext of the passed handshake payload and
+// mixes the ciphertext into the hash of the transcript.
+func (s *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	plaintext := ciphertext
+	if s.cipher != nil {
+		var err error
+		plaintext, err = s.cipher.decrypt(s.h[:], ciphertext)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// split returns the cipher states which secure the messages sent by the
+// initiator and the responder once the handshake is complete.
+func (s *symmetricState) split() (*cipherState, *cipherState, error) {
+	key1, key2 := hkdf(s.ck[:], nil)
+	initiator, err := newCipherState(key1[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	responder, err := newCipherState(key2[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return initiator, responder, nil
+}
+
+// certificate is sent by the responder during the handshake to prove its static
+// key was signed by the authority key clients are configured with.
+type certificate struct {
+	version       uint16
+	validFrom     uint32
+	notValidAfter uint32
+	signature     [btcec.SchnorrSignatureSize]byte
+}
+
+// sigHash returns the hash of the certificate for the passed x-only static key
+// which is signed by the authority key.
+func (c *certificate) sigHash(staticKey []byte) [32]byte {
+	var e encoder
+	e.u16(c.version)
+	e.u32(c.validFrom)
+	e.u32(c.notValidAfter)
+	e.buf = append(e.buf, staticKey...)
+	return sha256.Sum256(e.buf)
+}
+
+// newCertificate returns a certificate for the passed x-only static key signed
+// by the passed authority key which is valid from the passed time on.
+func newCertificate(authorityKey *btcec.PrivateKey, staticKey []byte, validFrom time.Time) (*certificate, error) {
+	cert := &certificate{
+		validFrom:     uint32(validFrom.Unix()),
+		notValidAfter: ^uint32(0),
+	}
+	var auxRand [32]byte
+	if _, err := rand.Read(auxRand[:]); err != nil {
+		return nil, err
+	}
+	hash := cert.sigHash(staticKey)
+	sig, err := btcec.SignSchnorr(authorityKey, hash[:], auxRand[:])
+	if err != nil {
+		return nil, err
+	}
+	cert.signature = sig
+	return cert, nil
+}
+
+// encode returns the serialized certificate.
+func (c *certificate) encode() []byte {
+	var e encoder
+	e.u16(c.version)
+	e.u32(c.validFrom)
+	e.u32(c.notValidAfter)
+	e.buf = append(e.buf, c.signature[:]...)
+	return e.buf
+}
+
+// decodeCertificate returns the certificate serialized in the passed bytes.
+func decodeCertificate(b []byte) (*certificate, error) {
+	if len(b) != certificateSize {
+		return nil, fmt.Errorf("certificate has %d bytes, want %d",
+			len(b), certificateSize)
+	}
+	d := decoder{buf: b}
+	cert := &certificate{
+		version:       d.u16(),
+		validFrom:     d.u32(),
+		notValidAfter: d.u32(),
+	}
+	copy(cert.signature[:], d.next(btcec.SchnorrSignatureSize))
+	return cert, d.err
+}
+
+// verify returns whether the certificate is valid at the passed time for the
+// passed x-only static key and x-only authority public key.
+func (c *certificate) verify(authorityPubKey, staticKey []byte, now time.Time) bool {
+	if c.version != 0 {
+		return false
+	}
+	unixNow := now.Unix()
+	if unixNow < int64(c.validFrom) || unixNow > int64(c.notValidAfter) {
+		return false
+	}
+	hash := c.sigHash(staticKey)
+	return btcec.VerifySchnorr(authorityPubKey, hash[:], c.signature[:])
+}
+
+// xOnly returns the 32-byte x-only encoding of the passed public key.
+func xOnly(pubKey *btcec.PublicKey) []byte {
+	var x [32]byte
+	pubKey.X.FillBytes(x[:])
+	return x[:]
+}
+
+// noiseConn is a connection secured by the Noise protocol which exchanges
+// framed messages.
+type noiseConn struct {
+	conn io.ReadWriter
+	recv *cipherState
+
+	// sendMtx protects the send cipher state and serializes the frames
+	// written to the connection.
+	sendMtx sync.Mutex
+	send    *cipherState
+}
+
+// respondHandshake performs the handshake with the initiator of the passed
+// connection using the passed static key and its encoding along with its
+// serialized certificate and returns the secured connection.
+func respondHandshake(conn io.ReadWriter, staticKey *btcec.PrivateKey,
+	staticEll *[btcec.EllSwiftEncodingSize]byte, cert []byte) (*noiseConn, error) {
+
+	// -> e
+	var theirEphemeral [btcec.EllSwiftEncodingSize]byte
+	if _, err := io.ReadFull(conn, theirEphemeral[:]); err != nil {
+		return nil, err
+	}
+	s := newSymmetricState()
+	s.mixHash(theirEphemeral[:])
+	s.mixHash(nil)
+
+	// <- e, ee, s, es, certificate
+	ephemeralKey, ephemeralEll, err := btcec.NewEllSwiftPrivateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	msg := make([]byte, 0, handshakeResponseSize)
+	msg = append(msg, ephemeralEll[:]...)
+	s.mixHash(ephemeralEll[:])
+	ee, err := btcec.EllSwiftXDH(&theirEphemeral, &ephemeralEll,
+		ephemeralKey, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mixKey(ee[:]); err != nil {
+		return nil, err
+	}
+	msg = append(msg, s.encryptAndHash(staticEll[:])...)
+	es, err := btcec.EllSwiftXDH(&theirEphemeral, staticEll, staticKey,
+		false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mixKey(es[:]); err != nil {
+		return nil, err
+	}
+	msg = append(msg, s.encryptAndHash(cert)...)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	recv, send, err := s.split()
+	if err != nil {
+		return nil, err
+	}
+	return &noiseConn{conn: conn, recv: recv, send: send}, nil
+}
+
+// readMessage reads the next frame from the connection and returns the type
+// and the payload of the message it holds.  Messages with a payload longer
+// than the passed maximum length are rejected.
+func (c *noiseConn) readMessage(maxLen int) (uint8, []byte, error) {
+	var encHeader [encryptedHeaderSize]byte
+	if _, err := io.ReadFull(c.conn, encHeader[:]); err != nil {
+		return 0, nil, err
+	}
+	header, err := c.recv.decrypt(nil, encHeader[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	msgType, payloadLen, err := decodeFrameHeader(header)
+	if err != nil {
+		return 0, nil, err
+	}
+	if payloadLen > maxLen {
+		return 0, nil, fmt.Errorf("message of type %#02x has a payload "+
+			"of %d bytes which exceeds the maximum of %d", msgType,
+			payloadLen, maxLen)
+	}
+
+	// The payload is encrypted in chunks which each carry their own
+	// authentication tag.
+	payload := make([]byte, 0, payloadLen)
+	chunk := make([]byte, maxChunkLen)
+	for remaining := payloadLen; remaining > 0; {
+		n := remaining
+		if n > maxChunkLen-macSize {
+			n = maxChunkLen - macSize
+		}
+		if _, err := io.ReadFull(c.conn, chunk[:n+macSize]); err != nil {
+			return 0, nil, err
+		}
+		plaintext, err := c.recv.decrypt(nil, chunk[:n+macSize])
+		if err != nil {
+			return 0, nil, err
+		}
+		payload = append(payload, plaintext...)
+		remaining -= n
+	}
+	return msgType, payload, nil
+}
+
+// writeMessage writes a frame holding a message with the passed type and
+// payload to the connection.
+//
+// This function is safe for concurrent access.
+func (c *noiseConn) writeMessage(msgType uint8, payload []byte) error {
+	if len(payload) > maxFrameLen {
+		return errors.New("message payload too long")
+	}
+
+	c.sendMtx.Lock()
+	defer c.sendMtx.Unlock()
+
+	frame := c.send.encrypt(nil, encodeFrameHeader(msgType, len(payload)))
+	for len(payload) > 0 {
+		n := len(payload)
+		if n > maxChunkLen-macSize {
+			n = maxChunkLen - macSize
+		}
+		frame = append(frame, c.send.encrypt(nil, payload[:n])...)
+		payload = payload[n:]
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package sv2
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+)
+
+// initiateHandshake performs the handshake with the responder of the passed
+// connection as the initiator and returns the secured connection.  The
+// certificate of the responder must be signed by the passed x-only authority
+// public key.
+func initiateHandshake(conn io.ReadWriter, authorityPubKey []byte) (*noiseConn, error) {
+	// -> e
+	ephemeralKey, ephemeralEll, err := btcec.NewEllSwiftPrivateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	s := newSymmetricState()
+	s.mixHash(ephemeralEll[:])
+	s.mixHash(nil)
+	if _, err := conn.Write(ephemeralEll[:]); err != nil {
+		return nil, err
+	}
+
+	// <- e, ee, s, es, certificate
+	var msg [handshakeResponseSize]byte
+	if _, err := io.ReadFull(conn, msg[:]); err != nil {
+		return nil, err
+	}
+	var theirEphemeral, theirStatic [btcec.EllSwiftEncodingSize]byte
+	copy(theirEphemeral[:], msg[:btcec.EllSwiftEncodingSize])
+	s.mixHash(theirEphemeral[:])
+	ee, err := btcec.EllSwiftXDH(&ephemeralEll, &theirEphemeral,
+		ephemeralKey, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mixKey(ee[:]); err != nil {
+		return nil, err
+	}
+	offset := btcec.EllSwiftEncodingSize
+	static, err := s.decryptAndHash(msg[offset : offset+
+		btcec.EllSwiftEncodingSize+macSize])
+	if err != nil {
+		return nil, err
+	}
+	copy(theirStatic[:], static)
+	es, err := btcec.EllSwiftXDH(&ephemeralEll, &theirStatic, ephemeralKey,
+		true)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mixKey(es[:]); err != nil {
+		return nil, err
+	}
+	offset += btcec.EllSwiftEncodingSize + macSize
+	certBytes, err := s.decryptAndHash(msg[offset:])
+	if err != nil {
+		return nil, err
+	}
+	cert, err := decodeCertificate(certBytes)
+	if err != nil {
+		return nil, err
+	}
+	var staticKey [32]byte
+	btcec.EllSwiftDecode(&theirStatic).FillBytes(staticKey[:])
+	if !cert.verify(authorityPubKey, staticKey[:], time.Now()) {
+		return nil, errors.New("invalid certificate")
+	}
+
+	send, recv, err := s.split()
+	if err != nil {
+		return nil, err
+	}
+	return &noiseConn{conn: conn, recv: recv, send: send}, nil
+}
+
+// TestHandshake ensures both parties of a handshake derive the same keys and
+// that certificates signed by other authorities are rejected.
+func TestHandshake(t *testing.T) {
+	t.Parallel()
+
+	authorityKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate authority key: %v", err)
+	}
+	staticKey, staticEll, err := btcec.NewEllSwiftPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate static key: %v", err)
+	}
+	cert, err := newCertificate(authorityKey, xOnly(staticKey.PubKey()),
+		time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("newCertificate: unexpected error: %v", err)
+	}
+
+	var conns []net.Conn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	handshake := func(authorityPubKey []byte) (*noiseConn, *noiseConn, error) {
+		initiatorConn, responderConn := net.Pipe()
+		conns = append(conns, initiatorConn, responderConn)
+		type result struct {
+			conn *noiseConn
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			conn, err := respondHandshake(responderConn, staticKey,
+				&staticEll, cert.encode())
+			done <- result{conn, err}
+		}()
+		initiator, err := initiateHandshake(initiatorConn,
+			authorityPubKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		r := <-done
+		return initiator, r.conn, r.err
+	}
+
+	initiator, responder, err := handshake(xOnly(authorityKey.PubKey()))
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+
+	// Messages are exchanged in both directions.
+	go initiator.writeMessage(msgTypeSetupConnection, []byte("ping"))
+	msgType, payload, err := responder.readMessage(maxMessageSize)
+	if err != nil || msgType != msgTypeSetupConnection ||
+		string(payload) != "ping" {
+
+		t.Fatalf("unexpected message type %d payload %q error %v",
+			msgType, payload, err)
+	}
+	go responder.writeMessage(msgTypeSetupConnectionSuccess, []byte("pong"))
+	msgType, payload, err = initiator.readMessage(maxMessageSize)
+	if err != nil || msgType != msgTypeSetupConnectionSuccess ||
+		string(payload) != "pong" {
+
+		t.Fatalf("unexpected message type %d payload %q error %v",
+			msgType, payload, err)
+	}
+
+	// Certificates signed by another authority are rejected.
+	otherKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	if _, _, err := handshake(xOnly(otherKey.PubKey())); err == nil {
+		t.Fatal("certificate of another authority accepted")
+	}
+}
+
+// TestCertificate ensures certificates are only valid within their validity
+// period and for the static key they were signed for.
+func TestCertificate(t *testing.T) {
+	t.Parallel()
+
+	authorityKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate authority key: %v", err)
+	}
+	staticKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate static key: %v", err)
+	}
+	validFrom := time.Unix(time.Now().Unix(), 0)
+	cert, err := newCertificate(authorityKey, xOnly(staticKey.PubKey()),
+		validFrom)
+	if err != nil {
+		t.Fatalf("newCertificate: unexpected error: %v", err)
+	}
+	decoded, err := decodeCertificate(cert.encode())
+	if err != nil {
+		t.Fatalf("decodeCertificate: unexpected error: %v", err)
+	}
+	if *decoded != *cert {
+		t.Fatalf("decoded certificate %+v, want %+v", decoded, cert)
+	}
+
+	authority := xOnly(authorityKey.PubKey())
+	static := xOnly(staticKey.PubKey())
+	if !cert.verify(authority, static, validFrom) {
+		t.Fatal("valid certificate rejected")
+	}
+	if cert.verify(authority, static, validFrom.Add(-time.Second)) {
+		t.Fatal("certificate accepted before its validity period")
+	}
+	if cert.verify(static, static, validFrom) {
+		t.Fatal("certificate accepted for another authority")
+	}
+	if cert.verify(authority, authority, validFrom) {
+		t.Fatal("certificate accepted for another static key")
+	}
+	if _, err := decodeCertificate(cert.encode()[1:]); err == nil {
+		t.Fatal("truncated certificate decoded")
+	}
+}
+
+// TestFraming ensures messages are split into encrypted chunks which are
+// reassembled by the receiver and that tampered frames are rejected.
+func TestFraming(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{0x42}, 32)
+	newConn := func(conn io.ReadWriter) *noiseConn {
+		send, err := newCipherState(key)
+		if err != nil {
+			t.Fatalf("newCipherState: unexpected error: %v", err)
+		}
+		recv, err := newCipherState(key)
+		if err != nil {
+			t.Fatalf("newCipherState: unexpected error: %v", err)
+		}
+		return &noiseConn{conn: conn, recv: recv, send: send}
+	}
+
+	tests := []struct {
+		name       string
+		payloadLen int
+		wireLen    int
+	}{
+		{"empty", 0, encryptedHeaderSize},
+		{"single chunk", 100, encryptedHeaderSize + 100 + macSize},
+		{"full chunk", maxChunkLen - macSize,
+			encryptedHeaderSize + maxChunkLen},
+		{"two chunks", maxChunkLen, encryptedHeaderSize + maxChunkLen +
+			macSize + macSize},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		conn := newConn(&buf)
+		payload := bytes.Repeat([]byte{0x01}, test.payloadLen)
+		if err := conn.writeMessage(msgTypeNewTemplate, payload); err != nil {
+			t.Fatalf("%s: writeMessage: unexpected error: %v",
+				test.name, err)
+		}
+		if buf.Len() != test.wireLen {
+			t.Fatalf("%s: frame has %d bytes, want %d", test.name,
+				buf.Len(), test.wireLen)
+		}
+		msgType, got, err := conn.readMessage(maxChunkLen * 2)
+		if err != nil || msgType != msgTypeNewTemplate ||
+			!bytes.Equal(got, payload) {
+
+			t.Fatalf("%s: unexpected message type %d of %d bytes, "+
+				"error %v", test.name, msgType, len(got), err)
+		}
+	}
+
+	// Tampered frames and frames which exceed the maximum length are
+	// rejected.
+	var buf bytes.Buffer
+	conn := newConn(&buf)
+	if err := conn.writeMessage(msgTypeNewTemplate, []byte("data")); err != nil {
+		t.Fatalf("writeMessage: unexpected error: %v", err)
+	}
+	buf.Bytes()[encryptedHeaderSize] ^= 0x01
+	if _, _, err := conn.readMessage(maxMessageSize); err == nil {
+		t.Fatal("tampered frame accepted")
+	}
+	buf.Reset()
+	conn = newConn(&buf)
+	if err := conn.writeMessage(msgTypeNewTemplate, []byte("data")); err != nil {
+		t.Fatalf("writeMessage: unexpected error: %v", err)
+	}
+	if _, _, err := conn.readMessage(3); err == nil {
+		t.Fatal("frame exceeding the maximum length accepted")
+	}
+}
@@ -0,0 +1,432 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package sv2
+
+import (
+	"crypto/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// templatePollInterval is the interval at which the best chain and the
+	// transaction source are checked for changes which require new
+	// templates.
+	templatePollInterval = time.Second
+
+	// certificateBackdate is the duration the validity of the certificate
+	// of the static key is backdated by, so clients with clocks which are
+	// slightly behind accept it.
+	certificateBackdate = time.Hour
+)
+
+// Config is a descriptor containing the template provider configuration.
+type Config struct {
+	// ChainParams identifies which chain parameters the template provider
+	// is associated with.
+	ChainParams *chaincfg.Params
+
+	// BlockTemplateGenerator identifies the instance to use in order to
+	// generate the block templates handed out to clients.
+	BlockTemplateGenerator *mining.BlkTmplGenerator
+
+	// ProcessBlock defines the function to call with any solved blocks.
+	// It typically must run the provided block through the same set of
+	// rules and handling as any other block coming from the network.
+	ProcessBlock func(*btcutil.Block, blockchain.BehaviorFlags) (bool, error)
+
+	// IsCurrent defines the function to use to obtain whether or not the
+	// block chain is current.  No templates are handed out while the chain
+	// is not current since any solved blocks would be on a side chain and
+	// end up orphaned anyways.
+	IsCurrent func() bool
+
+	// Listeners defines a slice of listeners for which the template
+	// provider will take ownership of and accept connections.  Since the
+	// template provider takes ownership of these listeners, they will be
+	// closed when the template provider is stopped.
+	Listeners []net.Listener
+
+	// AuthorityKey is the key which signs the static key of the template
+	// provider.  Clients are configured with its public key in order to
+	// authenticate the template provider.
+	AuthorityKey *btcec.PrivateKey
+
+	// TemplateInterval is the minimum duration between templates which
+	// only add new transactions.  New blocks always result in new
+	// templates right away.
+	TemplateInterval time.Duration
+
+	// FeeDelta is the minimum amount by which the fees of a template must
+	// exceed the fees of the previous template handed out to a client for
+	// the same block.
+	FeeDelta btcutil.Amount
+
+	// MaxClients is the maximum number of clients which may be connected
+	// at the same time.
+	MaxClients int
+}
+
+// Server provides a Stratum V2 template provider, which implements the
+// template distribution protocol in order to hand out block templates to
+// pools and job declarators.  Clients build the coinbase transactions of the
+// blocks themselves and submit solved blocks back to the template provider,
+// which submits them to the chain.
+type Server struct {
+	started         int32
+	shutdown        int32
+	cfg             Config
+	staticKey       *btcec.PrivateKey
+	staticEll       [btcec.EllSwiftEncodingSize]byte
+	certificate     []byte
+	submitBlockLock sync.Mutex
+	wg              sync.WaitGroup
+	quit            chan struct{}
+
+	// The following fields are protected by the mutex.
+	mtx            sync.Mutex
+	clients        map[*client]struct{}
+	templates      map[uint64]*template
+	prevHash       chainhash.Hash
+	nextTemplateID uint64
+}
+
+// connectedClients returns the clients which are currently connected.
+//
+// This function is safe for concurrent access.
+func (s *Server) connectedClients() []*client {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// template returns the template with the passed id, or nil if it is unknown or
+// was built on a previous block.
+//
+// This function is safe for concurrent access.
+func (s *Server) template(id uint64) *template {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.templates[id]
+}
+
+// addTemplate creates a template with a new id for the passed block template.
+// Templates built on previous blocks are dropped.
+//
+// This function is safe for concurrent access.
+func (s *Server) addTemplate(blockTemplate *mining.BlockTemplate, txUpdate time.Time) (*template, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	t, err := newTemplate(s.nextTemplateID, blockTemplate, txUpdate)
+	if err != nil {
+		return nil, err
+	}
+	s.nextTemplateID++
+
+	if !s.prevHash.IsEqual(t.prevHash()) {
+		s.templates = make(map[uint64]*template)
+		s.prevHash = *t.prevHash()
+	}
+	s.templates[t.id] = t
+	return t, nil
+}
+
+// generateTemplate generates a new block template which leaves room for
+// coinbase outputs within the passed constraints.
+func (s *Server) generateTemplate(constraints msgCoinbaseOutputConstraints) (*template, error) {
+	g := s.cfg.BlockTemplateGenerator
+	txUpdate := g.TxSource().LastUpdated()
+
+	// Reduce the limits of the policy of the generator by the weight and
+	// the signature operation cost of the outputs of clients.
+	policy := *g.Policy()
+	additionalWeight := int64(constraints.maxAdditionalSize) *
+		blockchain.WitnessScaleFactor
+	if additionalWeight > int64(policy.BlockMaxWeight) {
+		additionalWeight = int64(policy.BlockMaxWeight)
+	}
+	policy.BlockMaxWeight -= uint32(additionalWeight)
+	maxSigOpCost := int64(blockchain.MaxBlockSigOpsCost)
+	if policy.BlockMaxSigOpCost > 0 && policy.BlockMaxSigOpCost < maxSigOpCost {
+		maxSigOpCost = policy.BlockMaxSigOpCost
+	}
+	maxSigOpCost -= int64(constraints.maxAdditionalSigOps) *
+		blockchain.WitnessScaleFactor
+	if maxSigOpCost < 1 {
+		maxSigOpCost = 1
+	}
+	policy.BlockMaxSigOpCost = maxSigOpCost
+
+	// A nil address results in a coinbase output which clients replace.
+	blockTemplate, err := g.NewBlockTemplateWithPolicy(nil, &policy)
+	if err != nil {
+		return nil, err
+	}
+	return s.addTemplate(blockTemplate, txUpdate)
+}
+
+// updateClient hands out a new template to the passed client when the best
+// chain changed, or when new transactions raised the fees by at least the fee
+// delta and enough time passed since its last template.  The passed cache
+// holds the templates generated in the current round by their constraints, so
+// clients with the same constraints share templates.  It may be nil.
+func (s *Server) updateClient(c *client, now time.Time, cache map[msgCoinbaseOutputConstraints]*template) {
+	g := s.cfg.BlockTemplateGenerator
+	bestHash := g.BestSnapshot().Hash
+	txUpdate := g.TxSource().LastUpdated()
+
+	c.mtx.Lock()
+	constraints, curTemplate := c.constraints, c.curTemplate
+	lastTemplate, lastTxUpdate := c.lastTemplate, c.lastTxUpdate
+	c.mtx.Unlock()
+
+	// No templates are handed out before the client announced the
+	// constraints of its coinbase outputs.
+	if constraints == nil {
+		return
+	}
+	newTip := curTemplate == nil || !curTemplate.prevHash().IsEqual(&bestHash)
+	if !newTip && (txUpdate.Equal(lastTxUpdate) ||
+		now.Sub(lastTemplate) < s.cfg.TemplateInterval) {
+
+		return
+	}
+
+	t := cache[*constraints]
+	if t == nil {
+		var err error
+		t, err = s.generateTemplate(*constraints)
+		if err != nil {
+			log.Errorf("Unable to generate template: %v", err)
+			return
+		}
+		if cache != nil {
+			cache[*constraints] = t
+		}
+	}
+
+	// Nothing is handed out when the best chain changed while the template
+	// was generated.
+	if !t.prevHash().IsEqual(&bestHash) {
+		return
+	}
+
+	// Templates which don't raise the fees enough are not worth the
+	// bandwidth.
+	if !newTip && t.fees < curTemplate.fees+int64(s.cfg.FeeDelta) {
+		c.mtx.Lock()
+		c.lastTxUpdate = t.txUpdate
+		c.mtx.Unlock()
+		return
+	}
+
+	c.provideTemplate(t, newTip, now)
+}
+
+// templateHandler hands out new templates to clients when the best chain
+// changes or when new transactions are available.  It must be run as a
+// goroutine.
+func (s *Server) templateHandler() {
+	ticker := time.NewTicker(templatePollInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			// No templates are handed out while the chain is not
+			// current.
+			if !s.cfg.IsCurrent() {
+				continue
+			}
+
+			now := time.Now()
+			cache := make(map[msgCoinbaseOutputConstraints]*template)
+			for _, c := range s.connectedClients() {
+				s.updateClient(c, now, cache)
+			}
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.wg.Done()
+	log.Tracef("Template provider handler done")
+}
+
+// submitBlock submits the passed block solved by the passed client to the
+// chain.
+func (s *Server) submitBlock(msgBlock *wire.MsgBlock, c *client) bool {
+	s.submitBlockLock.Lock()
+	defer s.submitBlockLock.Unlock()
+
+	// Process this block using the same rules as blocks coming from other
+	// nodes.  This will in turn relay it to the network like normal.
+	block := btcutil.NewBlock(msgBlock)
+	isOrphan, err := s.cfg.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		// Anything other than a rule violation is an unexpected error,
+		// so log that error as an internal error.
+		if _, ok := err.(blockchain.RuleError); !ok {
+			log.Errorf("Unexpected error while processing "+
+				"block submitted by %s: %v", c, err)
+			return false
+		}
+
+		log.Infof("Block submitted by %s rejected: %v", c, err)
+		return false
+	}
+	if isOrphan {
+		log.Infof("Block submitted by %s is an orphan", c)
+		return false
+	}
+
+	// The block was accepted.
+	log.Infof("Block submitted by %s accepted (hash %s)", c, block.Hash())
+	return true
+}
+
+// handleConn registers a client for the passed connection and handles its
+// messages until the connection is closed.  It must be run as a goroutine.
+func (s *Server) handleConn(conn net.Conn) {
+	s.mtx.Lock()
+	if atomic.LoadInt32(&s.shutdown) != 0 {
+		s.mtx.Unlock()
+		conn.Close()
+		s.wg.Done()
+		return
+	}
+	c := newClient(s, conn)
+	s.clients[c] = struct{}{}
+	s.mtx.Unlock()
+
+	log.Debugf("New template provider client %s", c)
+	c.run()
+	log.Debugf("Template provider client %s disconnected", c)
+
+	s.mtx.Lock()
+	delete(s.clients, c)
+	s.mtx.Unlock()
+	s.wg.Done()
+}
+
+// listenHandler accepts connections on the passed listener.  It must be run as
+// a goroutine.
+func (s *Server) listenHandler(listener net.Listener) {
+	log.Infof("Template provider listening on %s", listener.Addr())
+	for atomic.LoadInt32(&s.shutdown) == 0 {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Only log the error if not forcibly shutting down.
+			if atomic.LoadInt32(&s.shutdown) == 0 {
+				log.Errorf("Can't accept connection: %v", err)
+			}
+			continue
+		}
+
+		// Limit the number of clients to max allowed.
+		s.mtx.Lock()
+		numClients := len(s.clients)
+		s.mtx.Unlock()
+		if numClients >= s.cfg.MaxClients {
+			log.Infof("Max template provider clients exceeded [%d] "+
+				"- disconnecting client %s", s.cfg.MaxClients,
+				conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		s.wg.Add(1)
+		go s.handleConn(conn)
+	}
+
+	s.wg.Done()
+	log.Tracef("Template provider listener done for %s", listener.Addr())
+}
+
+// Start begins accepting connections from clients and handing out templates to
+// them.
+func (s *Server) Start() {
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return
+	}
+
+	log.Trace("Starting template provider")
+	for _, listener := range s.cfg.Listeners {
+		s.wg.Add(1)
+		go s.listenHandler(listener)
+	}
+	s.wg.Add(1)
+	go s.templateHandler()
+}
+
+// Stop gracefully shuts down the template provider by closing its listeners
+// and disconnecting all clients.
+func (s *Server) Stop() {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		log.Infof("Template provider is already in the process of " +
+			"shutting down")
+		return
+	}
+
+	log.Infof("Template provider shutting down")
+	for _, listener := range s.cfg.Listeners {
+		if err := listener.Close(); err != nil {
+			log.Errorf("Problem shutting down template provider: %v",
+				err)
+		}
+	}
+	close(s.quit)
+	s.mtx.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mtx.Unlock()
+	s.wg.Wait()
+	log.Infof("Template provider shutdown complete")
+}
+
+// New returns a new instance of a template provider for the provided
+// configuration.  A new static key is generated and signed by the authority
+// key.  Use Start to begin accepting connections from clients.
+func New(cfg *Config) (*Server, error) {
+	staticKey, staticEll, err := btcec.NewEllSwiftPrivateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := newCertificate(cfg.AuthorityKey,
+		xOnly(staticKey.PubKey()), time.Now().Add(-certificateBackdate))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		cfg:         *cfg,
+		staticKey:   staticKey,
+		staticEll:   staticEll,
+		certificate: cert.encode(),
+		quit:        make(chan struct{}),
+		clients:     make(map[*client]struct{}),
+		templates:   make(map[uint64]*template),
+	}, nil
+}
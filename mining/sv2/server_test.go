@@ -0,0 +1,346 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package sv2
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// createTestTemplate returns a block template for the regression test network
+// with the passed number of transactions.  The coinbase transaction carries a
+// witness commitment.
+func createTestTemplate(numTxns int) *mining.BlockTemplate {
+	const height = 1000
+	params := &chaincfg.RegressionNetParams
+	script, err := txscript.NewScriptBuilder().AddInt64(height).Script()
+	if err != nil {
+		panic(err)
+	}
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: script,
+		Sequence:        wire.MaxTxInSequenceNum,
+		Witness:         wire.TxWitness{make([]byte, 32)},
+	})
+	coinbase.AddTxOut(&wire.TxOut{
+		Value:    blockchain.CalcBlockSubsidy(height, params) + 1000,
+		PkScript: []byte{txscript.OP_TRUE},
+	})
+	coinbase.AddTxOut(&wire.TxOut{
+		PkScript: append([]byte{txscript.OP_RETURN, 0x24, 0xaa, 0x21,
+			0xa9, 0xed}, make([]byte, 32)...),
+	})
+
+	msgBlock := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   0x20000000,
+			PrevBlock: chainhash.Hash{0x01, 0x02, 0x03},
+			Timestamp: time.Unix(time.Now().Unix(), 0),
+			Bits:      params.PowLimitBits,
+		},
+		Transactions: []*wire.MsgTx{coinbase},
+	}
+	for i := 1; i < numTxns; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Index: uint32(i)},
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+		tx.AddTxOut(&wire.TxOut{
+			Value:    int64(i),
+			PkScript: []byte{txscript.OP_TRUE},
+		})
+		msgBlock.AddTransaction(tx)
+	}
+	block := btcutil.NewBlock(msgBlock)
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions(), false)
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	return &mining.BlockTemplate{
+		Block:  msgBlock,
+		Fees:   []int64{-1000},
+		Height: height,
+	}
+}
+
+// testClient is a client connected to a template provider in tests.
+type testClient struct {
+	t     *testing.T
+	conn  net.Conn
+	noise *noiseConn
+}
+
+// send sends the passed message with the passed type to the server.
+func (c *testClient) send(msgType uint8, msg message) {
+	c.t.Helper()
+
+	payload, err := msg.encode()
+	if err != nil {
+		c.t.Fatalf("unable to encode message: %v", err)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if err := c.noise.writeMessage(msgType, payload); err != nil {
+		c.t.Fatalf("unable to send message: %v", err)
+	}
+}
+
+// receive reads the next message from the server, ensures it has the passed
+// type, and decodes it into the passed message.
+func (c *testClient) receive(msgType uint8, msg message) {
+	c.t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	gotType, payload, err := c.noise.readMessage(maxFrameLen)
+	if err != nil {
+		c.t.Fatalf("unable to receive message: %v", err)
+	}
+	if gotType != msgType {
+		c.t.Fatalf("got message type %#02x, want %#02x", gotType,
+			msgType)
+	}
+	if err := msg.decode(payload); err != nil {
+		c.t.Fatalf("unable to decode message: %v", err)
+	}
+}
+
+// connectTestClient connects a test client to the passed server, performs the
+// handshake, and sends the passed SetupConnection message.
+func connectTestClient(t *testing.T, s *Server, authorityKey *btcec.PrivateKey,
+	setup *msgSetupConnection) *testClient {
+
+	serverConn, clientConn := net.Pipe()
+	s.wg.Add(1)
+	go s.handleConn(serverConn)
+
+	clientConn.SetDeadline(time.Now().Add(5 * time.Second))
+	noise, err := initiateHandshake(clientConn,
+		xOnly(authorityKey.PubKey()))
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	c := &testClient{t: t, conn: clientConn, noise: noise}
+	c.send(msgTypeSetupConnection, setup)
+	return c
+}
+
+// newTestServer returns a template provider which passes processed blocks to
+// the passed channel along with its authority key.
+func newTestServer(t *testing.T, processed chan *btcutil.Block) (*Server, *btcec.PrivateKey) {
+	authorityKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate authority key: %v", err)
+	}
+	s, err := New(&Config{
+		ChainParams: &chaincfg.RegressionNetParams,
+		ProcessBlock: func(block *btcutil.Block, _ blockchain.BehaviorFlags) (bool, error) {
+			processed <- block
+			return false, nil
+		},
+		IsCurrent:        func() bool { return false },
+		AuthorityKey:     authorityKey,
+		TemplateInterval: 30 * time.Second,
+		FeeDelta:         1000,
+		MaxClients:       1,
+	})
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	return s, authorityKey
+}
+
+// TestSetupConnection ensures connections for other protocols or versions are
+// rejected.
+func TestSetupConnection(t *testing.T) {
+	t.Parallel()
+
+	s, authorityKey := newTestServer(t, nil)
+	tests := []struct {
+		name  string
+		setup msgSetupConnection
+		want  string
+	}{
+		{
+			name: "mining protocol",
+			setup: msgSetupConnection{
+				protocol:   0,
+				minVersion: 2,
+				maxVersion: 2,
+			},
+			want: errCodeUnsupportedProtocol,
+		},
+		{
+			name: "future version",
+			setup: msgSetupConnection{
+				protocol:   protocolTemplateDistribution,
+				minVersion: 3,
+				maxVersion: 4,
+			},
+			want: errCodeVersionMismatch,
+		},
+	}
+	for _, test := range tests {
+		c := connectTestClient(t, s, authorityKey, &test.setup)
+		var reply msgSetupConnectionError
+		c.receive(msgTypeSetupConnectionError, &reply)
+		if reply.errorCode != test.want {
+			t.Fatalf("%s: got error code %q, want %q", test.name,
+				reply.errorCode, test.want)
+		}
+		c.conn.Close()
+	}
+	s.wg.Wait()
+}
+
+// TestSession ensures clients receive templates along with their transactions
+// and submit solutions which are submitted to the chain.
+func TestSession(t *testing.T) {
+	t.Parallel()
+
+	processed := make(chan *btcutil.Block, 1)
+	s, authorityKey := newTestServer(t, processed)
+	c := connectTestClient(t, s, authorityKey, &msgSetupConnection{
+		protocol:   protocolTemplateDistribution,
+		minVersion: 2,
+		maxVersion: 3,
+		vendor:     "test",
+	})
+	defer func() {
+		c.conn.Close()
+		s.wg.Wait()
+	}()
+	var success msgSetupConnectionSuccess
+	c.receive(msgTypeSetupConnectionSuccess, &success)
+	if success.usedVersion != protocolVersion {
+		t.Fatalf("got used version %d, want %d", success.usedVersion,
+			protocolVersion)
+	}
+	c.send(msgTypeCoinbaseOutputConstraints,
+		&msgCoinbaseOutputConstraints{maxAdditionalSize: 100})
+
+	// Hand out a future template followed by the previous block hash.
+	tmpl, err := s.addTemplate(createTestTemplate(3), time.Now())
+	if err != nil {
+		t.Fatalf("addTemplate: unexpected error: %v", err)
+	}
+	clients := s.connectedClients()
+	if len(clients) != 1 {
+		t.Fatalf("got %d clients, want 1", len(clients))
+	}
+	go clients[0].provideTemplate(tmpl, true, time.Now())
+	var tmplMsg msgNewTemplate
+	c.receive(msgTypeNewTemplate, &tmplMsg)
+	msgBlock := tmpl.template.Block
+	coinbase := msgBlock.Transactions[0]
+	if tmplMsg.templateID != tmpl.id || !tmplMsg.future ||
+		tmplMsg.version != uint32(msgBlock.Header.Version) ||
+		!bytes.Equal(tmplMsg.coinbasePrefix,
+			coinbase.TxIn[0].SignatureScript) ||
+		tmplMsg.coinbaseTxValueRemaining != uint64(coinbase.TxOut[0].Value) ||
+		tmplMsg.coinbaseTxOutputsCount != 1 ||
+		len(tmplMsg.merklePath) != 2 {
+
+		t.Fatalf("unexpected template %+v", tmplMsg)
+	}
+	var prevHash msgSetNewPrevHash
+	c.receive(msgTypeSetNewPrevHash, &prevHash)
+	if prevHash.templateID != tmpl.id ||
+		prevHash.prevHash != msgBlock.Header.PrevBlock ||
+		prevHash.nBits != msgBlock.Header.Bits ||
+		prevHash.target[len(prevHash.target)-1] != 0x7f {
+
+		t.Fatalf("unexpected previous block hash %+v", prevHash)
+	}
+
+	// The transactions of known templates are sent on request.
+	c.send(msgTypeRequestTransactionData,
+		&msgRequestTransactionData{templateID: tmpl.id})
+	var txData msgRequestTransactionDataSuccess
+	c.receive(msgTypeRequestTransactionDataSuccess, &txData)
+	if len(txData.transactionList) != 2 ||
+		!bytes.Equal(txData.excessData, make([]byte, 32)) {
+
+		t.Fatalf("unexpected transaction data %+v", txData)
+	}
+	c.send(msgTypeRequestTransactionData,
+		&msgRequestTransactionData{templateID: tmpl.id + 1})
+	var txDataErr msgRequestTransactionDataError
+	c.receive(msgTypeRequestTransactionDataError, &txDataErr)
+	if txDataErr.errorCode != errCodeTemplateIDNotFound {
+		t.Fatalf("unexpected error code %q", txDataErr.errorCode)
+	}
+
+	// Build a coinbase transaction paying to the output of the client from
+	// the template and find a nonce which solves the block on the
+	// regression test network.
+	var clientCoinbase wire.MsgTx
+	clientCoinbase.Version = int32(tmplMsg.coinbaseTxVersion)
+	clientCoinbase.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex),
+		SignatureScript: append(tmplMsg.coinbasePrefix, 0x00),
+		Sequence:        tmplMsg.coinbaseTxInputSequence,
+	})
+	clientCoinbase.AddTxOut(&wire.TxOut{
+		Value:    int64(tmplMsg.coinbaseTxValueRemaining),
+		PkScript: []byte{txscript.OP_TRUE, txscript.OP_TRUE},
+	})
+	clientCoinbase.AddTxOut(coinbase.TxOut[1])
+	clientCoinbase.LockTime = tmplMsg.coinbaseTxLockTime
+	var buf bytes.Buffer
+	if err := clientCoinbase.SerializeNoWitness(&buf); err != nil {
+		t.Fatalf("unable to serialize coinbase: %v", err)
+	}
+	solution := &msgSubmitSolution{
+		templateID:      tmpl.id,
+		version:         tmplMsg.version,
+		headerTimestamp: prevHash.headerTimestamp,
+		coinbaseTx:      buf.Bytes(),
+	}
+	target := blockchain.CompactToBig(prevHash.nBits)
+	for ; ; solution.headerNonce++ {
+		block, err := tmpl.solve(solution)
+		if err != nil {
+			t.Fatalf("solve: unexpected error: %v", err)
+		}
+		hash := block.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			break
+		}
+	}
+	c.send(msgTypeSubmitSolution, solution)
+	select {
+	case block := <-processed:
+		merkles := blockchain.BuildMerkleTreeStore(block.Transactions(),
+			false)
+		msgBlock := block.MsgBlock()
+		if !msgBlock.Header.MerkleRoot.IsEqual(merkles[len(merkles)-1]) ||
+			msgBlock.Header.Nonce != solution.headerNonce ||
+			len(msgBlock.Transactions) != 3 {
+
+			t.Fatalf("unexpected block %+v", msgBlock.Header)
+		}
+
+		// The witness reserved value of the template is filled in.
+		witness := msgBlock.Transactions[0].TxIn[0].Witness
+		if len(witness) != 1 || !bytes.Equal(witness[0], make([]byte, 32)) {
+			t.Fatalf("unexpected coinbase witness %x", witness)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("solved block was not processed")
+	}
+}
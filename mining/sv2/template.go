@@ -0,0 +1,195 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package sv2
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// template houses a block template which is handed out to clients along with
+// the values derived from it.
+type template struct {
+	id       uint64
+	template *mining.BlockTemplate
+
+	// fees is the total amount of fees paid by the transactions of the
+	// template.
+	fees int64
+
+	// merklePath are the hashes the hash of the coinbase transaction is
+	// combined with in order to calculate the merkle root.
+	merklePath []*chainhash.Hash
+
+	// txUpdate is the time the transaction source was last updated when
+	// the template was generated.
+	txUpdate time.Time
+}
+
+// newTemplate returns a template with the passed id which hands out the passed
+// block template.  The block template is not modified.
+func newTemplate(id uint64, blockTemplate *mining.BlockTemplate, txUpdate time.Time) (*template, error) {
+	msgBlock := blockTemplate.Block
+	if len(msgBlock.Transactions) == 0 {
+		return nil, fmt.Errorf("block template has no coinbase " +
+			"transaction")
+	}
+	txns := make([]*btcutil.Tx, 0, len(msgBlock.Transactions))
+	for _, tx := range msgBlock.Transactions {
+		txns = append(txns, btcutil.NewTx(tx))
+	}
+
+	// The first fee is the negated sum of the fees of all transactions.
+	var fees int64
+	if len(blockTemplate.Fees) > 0 {
+		fees = -blockTemplate.Fees[0]
+	}
+	return &template{
+		id:         id,
+		template:   blockTemplate,
+		fees:       fees,
+		merklePath: blockchain.BuildMerkleBranch(txns),
+		txUpdate:   txUpdate,
+	}, nil
+}
+
+// prevHash returns the hash of the block the template builds on.
+func (t *template) prevHash() *chainhash.Hash {
+	return &t.template.Block.Header.PrevBlock
+}
+
+// newTemplateMsg returns the NewTemplate message which hands out the template.
+// Clients replace the first output of the coinbase transaction, which claims
+// the subsidy and the fees, with their own outputs.
+func (t *template) newTemplateMsg(future bool) (*msgNewTemplate, error) {
+	msgBlock := t.template.Block
+	coinbase := msgBlock.Transactions[0]
+	prefix, err := txscript.NewScriptBuilder().
+		AddInt64(int64(t.template.Height)).Script()
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs bytes.Buffer
+	for _, txOut := range coinbase.TxOut[1:] {
+		if err := wire.WriteTxOut(&outputs, 0, 0, txOut); err != nil {
+			return nil, err
+		}
+	}
+	merklePath := make([]chainhash.Hash, 0, len(t.merklePath))
+	for _, hash := range t.merklePath {
+		merklePath = append(merklePath, *hash)
+	}
+
+	return &msgNewTemplate{
+		templateID:               t.id,
+		future:                   future,
+		version:                  uint32(msgBlock.Header.Version),
+		coinbaseTxVersion:        uint32(coinbase.Version),
+		coinbasePrefix:           prefix,
+		coinbaseTxInputSequence:  coinbase.TxIn[0].Sequence,
+		coinbaseTxValueRemaining: uint64(coinbase.TxOut[0].Value),
+		coinbaseTxOutputsCount:   uint32(len(coinbase.TxOut) - 1),
+		coinbaseTxOutputs:        outputs.Bytes(),
+		coinbaseTxLockTime:       coinbase.LockTime,
+		merklePath:               merklePath,
+	}, nil
+}
+
+// setNewPrevHashMsg returns the SetNewPrevHash message which makes the template
+// the current template of clients it was handed out to as a future template.
+func (t *template) setNewPrevHashMsg() *msgSetNewPrevHash {
+	header := &t.template.Block.Header
+
+	// The target is encoded as a little-endian 256-bit number.
+	var target chainhash.Hash
+	targetBytes := blockchain.CompactToBig(header.Bits).Bytes()
+	for i, b := range targetBytes {
+		target[len(targetBytes)-1-i] = b
+	}
+
+	return &msgSetNewPrevHash{
+		templateID:      t.id,
+		prevHash:        header.PrevBlock,
+		headerTimestamp: uint32(header.Timestamp.Unix()),
+		nBits:           header.Bits,
+		target:          target,
+	}
+}
+
+// transactionDataMsg returns the RequestTransactionData.Success message which
+// carries the transactions of the template.
+func (t *template) transactionDataMsg() (*msgRequestTransactionDataSuccess, error) {
+	msgBlock := t.template.Block
+	msg := &msgRequestTransactionDataSuccess{
+		templateID:      t.id,
+		transactionList: make([][]byte, 0, len(msgBlock.Transactions)-1),
+	}
+
+	// The witness reserved value of the coinbase transaction the witness
+	// commitment commits to is sent as excess data.
+	witness := msgBlock.Transactions[0].TxIn[0].Witness
+	if len(witness) > 0 {
+		msg.excessData = witness[0]
+	}
+
+	for _, tx := range msgBlock.Transactions[1:] {
+		var buf bytes.Buffer
+		buf.Grow(tx.SerializeSize())
+		if err := tx.Serialize(&buf); err != nil {
+			return nil, err
+		}
+		msg.transactionList = append(msg.transactionList, buf.Bytes())
+	}
+	return msg, nil
+}
+
+// solve returns the block built from the template with the header fields and
+// the coinbase transaction of the passed solution.
+func (t *template) solve(solution *msgSubmitSolution) (*wire.MsgBlock, error) {
+	var coinbase wire.MsgTx
+	err := coinbase.Deserialize(bytes.NewReader(solution.coinbaseTx))
+	if err != nil {
+		return nil, err
+	}
+	if !blockchain.IsCoinBaseTx(&coinbase) {
+		return nil, fmt.Errorf("transaction %v is not a coinbase",
+			coinbase.TxHash())
+	}
+
+	// Clients may submit the coinbase transaction without its witness, in
+	// which case the witness reserved value of the template is used.
+	templateBlock := t.template.Block
+	if len(coinbase.TxIn[0].Witness) == 0 {
+		coinbase.TxIn[0].Witness = templateBlock.Transactions[0].TxIn[0].Witness
+	}
+
+	root := coinbase.TxHash()
+	for _, hash := range t.merklePath {
+		root = *blockchain.HashMerkleBranches(&root, hash)
+	}
+	header := templateBlock.Header
+	header.Version = int32(solution.version)
+	header.MerkleRoot = root
+	header.Timestamp = time.Unix(int64(solution.headerTimestamp), 0)
+	header.Nonce = solution.headerNonce
+
+	msgBlock := &wire.MsgBlock{
+		Header:       header,
+		Transactions: make([]*wire.MsgTx, 0, len(templateBlock.Transactions)),
+	}
+	msgBlock.Transactions = append(msgBlock.Transactions, &coinbase)
+	msgBlock.Transactions = append(msgBlock.Transactions,
+		templateBlock.Transactions[1:]...)
+	return msgBlock, nil
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package muhash implements the MuHash3072 rolling set hash.
+
+MuHash Overview
+
+MuHash3072 hashes a set of byte strings to a 256-bit digest which does not
+depend on the order the elements are added in.  Elements may be added to and
+removed from the set incrementally, and the states of two sets may be combined,
+so the hash of a large set such as the unspent transaction output set can be
+maintained as it changes instead of being recomputed from scratch.  The state of
+a hash can be serialized, so such a hash can be persisted along with the set.
+
+Each element is hashed with SHA256, expanded to a 3072-bit number with ChaCha20,
+and multiplied into a numerator modulo the prime 2^3072 - 1103717 when it is
+added, or into a denominator when it is removed.  The digest is the SHA256 of
+the little-endian serialization of the numerator divided by the denominator.
+
+The implementation produces the same digests as the MuHash3072 implementation
+of Bitcoin Core, which uses it for the muhash of the unspent transaction output
+set.
+*/
+package muhash
@@ -0,0 +1,192 @@
+// Copyright (c) 2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package muhash
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"math/bits"
+)
+
+const (
+	// numBytes is the size in bytes of the 3072-bit numbers the elements
+	// are mapped to.
+	numBytes = 384
+
+	// DigestSize is the size in bytes of the digest of a set.
+	DigestSize = sha256.Size
+
+	// SerializedSize is the size in bytes of the serialized state of the
+	// hash of a set.
+	SerializedSize = 2 * numBytes
+)
+
+// prime is the modulus 2^3072 - 1103717 of the multiplicative group the hash
+// is computed in.
+var prime = func() *big.Int {
+	p := new(big.Int).Lsh(big.NewInt(1), numBytes*8)
+	return p.Sub(p, big.NewInt(1103717))
+}()
+
+// MuHash3072 is the state of the hash of a set.  The zero value is not usable,
+// use New to create a hash of the empty set.
+//
+// It is not safe for concurrent access.
+type MuHash3072 struct {
+	numerator   *big.Int
+	denominator *big.Int
+}
+
+// New returns the state of the hash of the empty set.
+func New() *MuHash3072 {
+	return &MuHash3072{
+		numerator:   big.NewInt(1),
+		denominator: big.NewInt(1),
+	}
+}
+
+// Add adds the passed element to the set.
+func (h *MuHash3072) Add(element []byte) {
+	h.numerator.Mul(h.numerator, toNum3072(element))
+	h.numerator.Mod(h.numerator, prime)
+}
+
+// Remove removes the passed element from the set.  The element is not required
+// to have been added before, which allows the hash of the difference of two
+// sets to be computed.
+func (h *MuHash3072) Remove(element []byte) {
+	h.denominator.Mul(h.denominator, toNum3072(element))
+	h.denominator.Mod(h.denominator, prime)
+}
+
+// Combine adds all elements of the set described by the passed state to the set
+// and removes the elements which were removed from it.
+func (h *MuHash3072) Combine(other *MuHash3072) {
+	h.numerator.Mul(h.numerator, other.numerator)
+	h.numerator.Mod(h.numerator, prime)
+	h.denominator.Mul(h.denominator, other.denominator)
+	h.denominator.Mod(h.denominator, prime)
+}
+
+// Digest returns the digest of the set.  It does not modify the state, so more
+// elements may be added and removed afterwards.
+func (h *MuHash3072) Digest() [DigestSize]byte {
+	inverse := new(big.Int).ModInverse(h.denominator, prime)
+	result := inverse.Mul(inverse, h.numerator)
+	result.Mod(result, prime)
+
+	var serialized [numBytes]byte
+	putNum3072(serialized[:], result)
+	return sha256.Sum256(serialized[:])
+}
+
+// Serialize returns the serialized state of the hash, which allows the hash of
+// a set to be stored and maintained further once it is deserialized.  It is the
+// numerator followed by the denominator as little-endian numbers.
+func (h *MuHash3072) Serialize() [SerializedSize]byte {
+	var serialized [SerializedSize]byte
+	putNum3072(serialized[:numBytes], h.numerator)
+	putNum3072(serialized[numBytes:], h.denominator)
+	return serialized
+}
+
+// Deserialize returns the state of the hash of a set from its serialization as
+// returned by Serialize.
+func Deserialize(serialized []byte) (*MuHash3072, error) {
+	if len(serialized) != SerializedSize {
+		return nil, errors.New("serialized muhash state has the wrong " +
+			"length")
+	}
+	h := &MuHash3072{
+		numerator:   getNum3072(serialized[:numBytes]),
+		denominator: getNum3072(serialized[numBytes:]),
+	}
+
+	// Both numbers are nonzero elements of the group.
+	for _, n := range []*big.Int{h.numerator, h.denominator} {
+		if n.Sign() == 0 || n.Cmp(prime) >= 0 {
+			return nil, errors.New("serialized muhash state is " +
+				"not in the group")
+		}
+	}
+	return h, nil
+}
+
+// putNum3072 serializes the passed 3072-bit number to the passed buffer as a
+// little-endian number.
+func putNum3072(dst []byte, n *big.Int) {
+	be := n.Bytes()
+	for i, b := range be {
+		dst[len(be)-1-i] = b
+	}
+}
+
+// getNum3072 returns the 3072-bit number the passed buffer holds as a
+// little-endian number.
+func getNum3072(src []byte) *big.Int {
+	var be [numBytes]byte
+	for i, b := range src {
+		be[len(src)-1-i] = b
+	}
+	return new(big.Int).SetBytes(be[:])
+}
+
+// toNum3072 maps the passed element to a 3072-bit number by expanding its
+// SHA256 hash with ChaCha20 and interpreting the key stream as a little-endian
+// number.
+func toNum3072(element []byte) *big.Int {
+	key := sha256.Sum256(element)
+
+	// Generate the key stream and reverse it to the big-endian byte order
+	// expected by big.Int.
+	var stream [numBytes]byte
+	var block [64]byte
+	for counter := uint32(0); counter < numBytes/64; counter++ {
+		chacha20Block(&key, counter, &block)
+		copy(stream[counter*64:], block[:])
+	}
+	for i, j := 0, numBytes-1; i < j; i, j = i+1, j-1 {
+		stream[i], stream[j] = stream[j], stream[i]
+	}
+	return new(big.Int).SetBytes(stream[:])
+}
+
+// chacha20Block computes the ChaCha20 block for the passed key and block
+// counter with an all zero nonce as defined by RFC 7539.
+func chacha20Block(key *[32]byte, counter uint32, out *[64]byte) {
+	var s, x [16]uint32
+	s[0], s[1], s[2], s[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	for i := 0; i < 8; i++ {
+		s[4+i] = binary.LittleEndian.Uint32(key[i*4:])
+	}
+	s[12] = counter
+
+	qr := func(a, b, c, d int) {
+		x[a] += x[b]
+		x[d] = bits.RotateLeft32(x[d]^x[a], 16)
+		x[c] += x[d]
+		x[b] = bits.RotateLeft32(x[b]^x[c], 12)
+		x[a] += x[b]
+		x[d] = bits.RotateLeft32(x[d]^x[a], 8)
+		x[c] += x[d]
+		x[b] = bits.RotateLeft32(x[b]^x[c], 7)
+	}
+	x = s
+	for i := 0; i < 10; i++ {
+		qr(0, 4, 8, 12)
+		qr(1, 5, 9, 13)
+		qr(2, 6, 10, 14)
+		qr(3, 7, 11, 15)
+		qr(0, 5, 10, 15)
+		qr(1, 6, 11, 12)
+		qr(2, 7, 8, 13)
+		qr(3, 4, 9, 14)
+	}
+	for i := range x {
+		binary.LittleEndian.PutUint32(out[i*4:], x[i]+s[i])
+	}
+}
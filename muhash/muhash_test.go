@@ -0,0 +1,91 @@
+// Copyright (c) 2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package muhash
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// element returns a 32-byte element whose first byte is the passed value.
+func element(b byte) []byte {
+	e := make([]byte, 32)
+	e[0] = b
+	return e
+}
+
+// reversedHex returns the hex encoding of the passed digest in reverse byte
+// order the way Bitcoin Core displays it.
+func reversedHex(digest [DigestSize]byte) string {
+	for i, j := 0, len(digest)-1; i < j; i, j = i+1, j-1 {
+		digest[i], digest[j] = digest[j], digest[i]
+	}
+	return hex.EncodeToString(digest[:])
+}
+
+// TestMuHash3072 ensures the digests match the ones of Bitcoin Core and do not
+// depend on the order elements are added and removed in.
+func TestMuHash3072(t *testing.T) {
+	// This mirrors the test vector of the MuHash3072 unit tests of Bitcoin
+	// Core.
+	h := New()
+	h.Add(element(0))
+	h.Add(element(1))
+	h.Remove(element(2))
+	want := "10d312b100cbd32ada024a6646e40d3482fcff103668d2625f10002a607d5863"
+	if got := reversedHex(h.Digest()); got != want {
+		t.Fatalf("digest %s, want %s", got, want)
+	}
+
+	// The same set built in another order and by combining partial sets
+	// has the same digest.
+	other := New()
+	other.Remove(element(2))
+	other.Add(element(1))
+	partial := New()
+	partial.Add(element(0))
+	other.Combine(partial)
+	if other.Digest() != h.Digest() {
+		t.Fatal("digest depends on the order of the elements")
+	}
+
+	// Adding and removing an element restores the digest of the set.
+	empty := New().Digest()
+	h = New()
+	h.Add(element(7))
+	if h.Digest() == empty {
+		t.Fatal("digest of non-empty set matches the empty set")
+	}
+	h.Remove(element(7))
+	if h.Digest() != empty {
+		t.Fatal("digest not restored after removing the element")
+	}
+}
+
+// TestMuHash3072Serialize ensures the serialized state of a hash restores it
+// so it can be maintained further, and that invalid states are rejected.
+func TestMuHash3072Serialize(t *testing.T) {
+	h := New()
+	h.Add(element(0))
+	h.Remove(element(2))
+	serialized := h.Serialize()
+	restored, err := Deserialize(serialized[:])
+	if err != nil {
+		t.Fatalf("Deserialize: unexpected error: %v", err)
+	}
+	h.Add(element(1))
+	restored.Add(element(1))
+	if restored.Digest() != h.Digest() {
+		t.Fatal("digest of the restored state does not match")
+	}
+
+	if _, err := Deserialize(serialized[1:]); err == nil {
+		t.Error("Deserialize: truncated state was not rejected")
+	}
+	var zero [SerializedSize]byte
+	if _, err := Deserialize(zero[:]); err == nil {
+		t.Error("Deserialize: zero state was not rejected")
+	}
+}
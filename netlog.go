@@ -0,0 +1,163 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/peer"
+)
+
+const (
+	// netLogQueueSize is the maximum number of records queued to be written
+	// to the network log.  Records are dropped when the queue is full so
+	// the peers are never blocked by the network log.
+	netLogQueueSize = 10000
+
+	// netLogFlushInterval is the interval at which the buffered records
+	// are flushed to the network log file.
+	netLogFlushInterval = time.Second
+)
+
+// netLogRecord is a record of a message sent to or received from a peer which
+// is queued to be written to the network log.
+type netLogRecord struct {
+	peerID   int32
+	peerAddr string
+	rec      peer.TapRecord
+}
+
+// netLogger writes a line for every message sent to and received from peers
+// to a file.  It implements the peer.MessageTap interface.
+type netLogger struct {
+	dropped uint64 // Atomic counter, must be 64-bit aligned.
+
+	file    *os.File
+	w       *bufio.Writer
+	records chan netLogRecord
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Ensure netLogger implements the peer.MessageTap interface.
+var _ peer.MessageTap = (*netLogger)(nil)
+
+// newNetLogger returns a new network logger which appends to the file at the
+// passed path.
+func newNetLogger(path string) (*netLogger, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY,
+		0600)
+	if err != nil {
+		return nil, err
+	}
+	return &netLogger{
+		file:    file,
+		w:       bufio.NewWriter(file),
+		records: make(chan netLogRecord, netLogQueueSize),
+		quit:    make(chan struct{}),
+	}, nil
+}
+
+// TapMessage queues a record of the passed message to be written to the
+// network log.  The record is dropped when the queue is full.
+//
+// This is part of the peer.MessageTap interface.
+func (l *netLogger) TapMessage(p *peer.Peer, rec *peer.TapRecord) {
+	record := netLogRecord{
+		peerID:   p.ID(),
+		peerAddr: p.Addr(),
+		rec:      *rec,
+	}
+
+	// The message and its payload are not logged, so don't retain them.
+	record.rec.Payload = nil
+	record.rec.Msg = nil
+
+	select {
+	case l.records <- record:
+	default:
+		atomic.AddUint64(&l.dropped, 1)
+	}
+}
+
+// writeRecord writes the line of the passed record to the network log.
+func (l *netLogger) writeRecord(record *netLogRecord) {
+	rec := &record.rec
+	command := rec.Command
+	if command == "" {
+		command = "-"
+	}
+	fmt.Fprintf(l.w, "%s %d %s %s %s %d",
+		rec.Time.UTC().Format(time.RFC3339Nano), record.peerID,
+		record.peerAddr, rec.Direction, command, rec.Size)
+	if rec.Err != nil {
+		fmt.Fprintf(l.w, " err=%q", rec.Err.Error())
+	}
+	l.w.WriteByte('\n')
+}
+
+// writeHandler writes the queued records to the network log file and flushes
+// it periodically.  It must be run as a goroutine.
+func (l *netLogger) writeHandler() {
+	flushTicker := time.NewTicker(netLogFlushInterval)
+	defer flushTicker.Stop()
+
+out:
+	for {
+		select {
+		case record := <-l.records:
+			l.writeRecord(&record)
+
+		case <-flushTicker.C:
+			if err := l.w.Flush(); err != nil {
+				srvrLog.Errorf("Unable to write network log: %v",
+					err)
+			}
+
+		case <-l.quit:
+			break out
+		}
+	}
+
+	// Write the remaining queued records before closing the file.
+	for {
+		select {
+		case record := <-l.records:
+			l.writeRecord(&record)
+			continue
+		default:
+		}
+		break
+	}
+	if err := l.w.Flush(); err != nil {
+		srvrLog.Errorf("Unable to write network log: %v", err)
+	}
+	if err := l.file.Close(); err != nil {
+		srvrLog.Errorf("Unable to close network log: %v", err)
+	}
+	if dropped := atomic.LoadUint64(&l.dropped); dropped > 0 {
+		srvrLog.Warnf("Dropped %d network log records because the "+
+			"log could not keep up", dropped)
+	}
+	l.wg.Done()
+}
+
+// Start begins writing the network log.
+func (l *netLogger) Start() {
+	l.wg.Add(1)
+	go l.writeHandler()
+}
+
+// Stop writes the remaining records, closes the network log file, and waits
+// for the write handler to exit.
+func (l *netLogger) Stop() {
+	close(l.quit)
+	l.wg.Wait()
+}
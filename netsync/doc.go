@@ -6,8 +6,21 @@
 Package netsync implements a concurrency safe block syncing protocol. The
 SyncManager communicates with connected peers to perform an initial block
 download, keep the chain and unconfirmed transaction pool in sync, and announce
-new blocks connected to the chain. Currently the sync manager selects a single
-sync peer that it downloads all blocks from until it is up to date with the
-longest chain the sync peer is aware of.
+new blocks connected to the chain. The sync manager selects a single sync peer
+that it downloads the headers and blocks from until it is up to date with the
+longest chain the sync peer is aware of. The headers up to the next checkpoint
+are pre-synchronized first, verifying their proof of work without storing them,
+and are only downloaded again and stored once they are proven to lead to the
+checkpoint. While the headers up to the next checkpoint are known, the blocks
+are downloaded from all sync candidate peers in parallel instead, with a limited
+window of blocks in flight and the blocks of peers which stall the download
+reassigned to other peers. The missing parents of orphan blocks are requested
+from the peer which sent the orphan and, when they do not arrive in time, from
+additional sync candidate peers.
+
+The progress of the synchronization, including the heights of the best header
+and block, the sync peer, and estimates of the verification progress and the
+time remaining, is published periodically to the subscribers registered with
+SubscribeProgress.
 */
 package netsync
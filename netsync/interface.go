@@ -38,4 +38,22 @@ type Config struct {
 	MaxPeers           int
 
 	FeeEstimator *mempool.FeeEstimator
+
+	// MaxPeerValidationCost is the maximum decaying validation cost, in
+	// the cost units of mempool.EstimateValidationCost, a peer may cause
+	// by relaying transactions which are rejected.  Each rejected
+	// transaction relayed while the cost exceeds it increases the ban
+	// score of the peer.  Zero disables validation cost budgeting.
+	MaxPeerValidationCost uint32
+
+	// ForkHeaderHandler is an optional handler which is invoked with the
+	// responses to headers requested through RequestForkHeader.
+	ForkHeaderHandler ForkHeaderHandler
 }
+
+// ForkHeaderHandler is the signature of the handler invoked when a peer
+// responds to a header requested through RequestForkHeader.  The header is nil
+// when the peer does not know the requested block.  The handler is invoked
+// from the sync manager's goroutine, so it must not call back into the sync
+// manager synchronously.
+type ForkHeaderHandler func(peer *peer.Peer, hash *chainhash.Hash, header *wire.BlockHeader)
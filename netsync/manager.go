@@ -6,6 +6,9 @@ package netsync
 
 import (
 	"container/list"
+	"errors"
+	"fmt"
+	"math"
 	"math/rand"
 	"net"
 	"sync"
@@ -15,6 +18,7 @@ import (
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/connmgr"
 	"github.com/btcsuite/btcd/database"
 	"github.com/btcsuite/btcd/mempool"
 	peerpkg "github.com/btcsuite/btcd/peer"
@@ -23,11 +27,6 @@ import (
 )
 
 const (
-	// minInFlightBlocks is the minimum number of blocks that should be
-	// in the request queue for headers-first mode before requesting
-	// more.
-	minInFlightBlocks = 10
-
 	// maxRejectedTxns is the maximum number of rejected transactions
 	// hashes to store in memory.
 	maxRejectedTxns = 1000
@@ -47,6 +46,15 @@ const (
 	// stallSampleInterval the interval at which we will check to see if our
 	// sync has stalled.
 	stallSampleInterval = 30 * time.Second
+
+	// validationCostBanScore is the decaying ban score reported for each
+	// rejected transaction relayed by a peer whose wasted validation cost
+	// exceeds the budget.
+	validationCostBanScore = 10
+
+	// validationCostBanReason is the category of misbehavior reported for
+	// peers which exceed their validation cost budget.
+	validationCostBanReason = "excessive validation cost"
 )
 
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
@@ -57,6 +65,14 @@ type newPeerMsg struct {
 	peer *peerpkg.Peer
 }
 
+// rejectedOrphan is an orphan transaction which the memory pool rejected once
+// its parents arrived along with the tag of the peer which relayed it.
+type rejectedOrphan struct {
+	tx  *btcutil.Tx
+	tag mempool.Tag
+	err error
+}
+
 // blockMsg packages a bitcoin block message and the peer it came from together
 // so the block handler has access to that information.
 type blockMsg struct {
@@ -84,6 +100,13 @@ type donePeerMsg struct {
 	peer *peerpkg.Peer
 }
 
+// requestTimeoutMsg signifies a request sent to a peer which was not answered
+// by its deadline to the block handler.
+type requestTimeoutMsg struct {
+	peer    *peerpkg.Peer
+	timeout *peerpkg.RequestTimeout
+}
+
 // txMsg packages a bitcoin tx message and the peer it came from together
 // so the block handler has access to that information.
 type txMsg struct {
@@ -92,6 +115,22 @@ type txMsg struct {
 	reply chan struct{}
 }
 
+// requestBlockMsg is a message type to be sent across the message channel for
+// requesting a specific block from a peer outside of the regular sync process.
+type requestBlockMsg struct {
+	hash  *chainhash.Hash
+	peer  *peerpkg.Peer
+	reply chan error
+}
+
+// requestForkHeaderMsg is a message type to be sent across the message channel
+// for requesting the header of a specific block from a peer.
+type requestForkHeaderMsg struct {
+	hash  *chainhash.Hash
+	peer  *peerpkg.Peer
+	reply chan error
+}
+
 // getSyncPeerMsg is a message type to be sent across the message channel for
 // retrieving the current sync peer.
 type getSyncPeerMsg struct {
@@ -145,6 +184,16 @@ type peerSyncState struct {
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
 	requestedBlocks map[chainhash.Hash]struct{}
+
+	// requestedForkHeader is the hash of the block header requested from
+	// the peer through RequestForkHeader, if any.
+	requestedForkHeader *chainhash.Hash
+
+	// validationCost is the cumulative validation cost of all transactions
+	// relayed by the peer, while wastedValidationCost decays the cost of
+	// the ones which were rejected over time.
+	validationCost       int64
+	wastedValidationCost connmgr.DynamicBanScore
 }
 
 // SyncManager is used to communicate block related messages with peers. The
@@ -172,22 +221,55 @@ type SyncManager struct {
 	peerStates       map[*peerpkg.Peer]*peerSyncState
 	lastProgressTime time.Time
 
-	// The following fields are used for headers-first mode.
+	// The following fields are used for headers-first mode.  The headers
+	// up to the next checkpoint are pre-synchronized before they are added
+	// to the header list, and the blocks of the headers in the header list
+	// are downloaded by the block scheduler while fetchingBlocks is set.
 	headersFirstMode bool
+	presync          *headersPresync
 	headerList       *list.List
-	startHeader      *list.Element
+	fetchingBlocks   bool
+	blockScheduler   *blockScheduler
 	nextCheckpoint   *chaincfg.Checkpoint
 
+	// orphanParents tracks the requests of the missing parents of the
+	// orphan blocks.
+	orphanParents *orphanParentTracker
+
+	// snapshotBlocks tracks the download of the blocks before a loaded
+	// utxo snapshot which are validated in the background.
+	snapshotBlocks *snapshotFetcher
+
+	// progress publishes the sync progress sampled at syncRate to the
+	// subscribers.  The rate is only accessed from the blockHandler
+	// thread.
+	progress *progressPublisher
+	syncRate syncRate
+
 	// An optional fee estimator.
 	feeEstimator *mempool.FeeEstimator
+
+	// An optional handler for headers requested through RequestForkHeader.
+	forkHeaderHandler ForkHeaderHandler
+
+	// maxPeerValidationCost is the validation cost budget of each peer.
+	maxPeerValidationCost uint32
+
+	// rejectedOrphans holds the orphan transactions the memory pool
+	// rejected once their parents arrived until the peers which relayed
+	// them are charged by the blockHandler thread.
+	rejectedOrphansMtx sync.Mutex
+	rejectedOrphans    []rejectedOrphan
 }
 
 // resetHeaderState sets the headers-first mode state to values appropriate for
 // syncing from a new peer.
 func (sm *SyncManager) resetHeaderState(newestHash *chainhash.Hash, newestHeight int32) {
 	sm.headersFirstMode = false
+	sm.presync = nil
 	sm.headerList.Init()
-	sm.startHeader = nil
+	sm.fetchingBlocks = false
+	sm.blockScheduler.reset()
 
 	// When there is a next checkpoint, add an entry for the latest known
 	// block into the header pool.  This allows the next downloaded header
@@ -337,7 +419,9 @@ func (sm *SyncManager) startSync() {
 
 			bestPeer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
 			sm.headersFirstMode = true
-			log.Infof("Downloading headers for blocks %d to "+
+			sm.presync = newHeadersPresync(sm.chainParams,
+				sm.nextCheckpoint, &best.Hash, best.Height, best.Bits)
+			log.Infof("Pre-synchronizing headers for blocks %d to "+
 				"%d from peer %s", best.Height+1,
 				sm.nextCheckpoint.Height, bestPeer.Addr())
 		} else {
@@ -486,12 +570,81 @@ func (sm *SyncManager) handleDonePeerMsg(peer *peerpkg.Peer) {
 	log.Infof("Lost peer %s", peer)
 
 	sm.clearRequestedState(state)
+	sm.blockScheduler.removePeer(peer)
+	sm.orphanParents.removePeer(peer)
+	sm.snapshotBlocks.removePeer(peer)
 
 	if peer == sm.syncPeer {
 		// Update the sync peer. The server has already disconnected the
 		// peer before signaling to the sync manager.
 		sm.updateSyncPeer(false)
+		return
+	}
+
+	// Reassign the blocks which were requested from the peer.
+	if sm.fetchingBlocks {
+		sm.fetchHeaderBlocks()
+	}
+}
+
+// handleRequestTimeoutMsg deals with requests which a peer did not answer by
+// their deadline.  The blocks and transactions which were not delivered are
+// removed from the requested maps so they are fetched from other peers, and
+// when the stalled peer is the sync peer, a new sync peer is selected right
+// away rather than waiting for the peer to be disconnected.  It is invoked from
+// the syncHandler goroutine.
+func (sm *SyncManager) handleRequestTimeoutMsg(msg *requestTimeoutMsg) {
+	peer := msg.peer
+	state, exists := sm.peerStates[peer]
+	if !exists {
+		log.Tracef("Received request timeout for unknown peer %s", peer)
+		return
+	}
+
+	log.Debugf("Peer %s did not answer %s request from %v in time", peer,
+		msg.timeout.Command, msg.timeout.Sent)
+
+	var stalledSync bool
+	switch msg.timeout.Command {
+	case wire.CmdGetData:
+		for _, iv := range msg.timeout.InvList {
+			switch iv.Type {
+			case wire.InvTypeBlock, wire.InvTypeWitnessBlock,
+				wire.InvTypeFilteredBlock,
+				wire.InvTypeFilteredWitnessBlock:
+
+				delete(state.requestedBlocks, iv.Hash)
+				delete(sm.requestedBlocks, iv.Hash)
+				sm.blockScheduler.removeRequest(&iv.Hash, peer)
+				stalledSync = true
+
+			case wire.InvTypeTx, wire.InvTypeWitnessTx:
+				delete(state.requestedTxns, iv.Hash)
+				delete(sm.requestedTxns, iv.Hash)
+			}
+		}
+
+	case wire.CmdGetHeaders:
+		state.requestedForkHeader = nil
+		stalledSync = true
+	}
+
+	if !stalledSync {
+		return
+	}
+
+	// The peer is about to be disconnected, so make sure it isn't selected
+	// as the sync peer or to download blocks from again.
+	state.syncCandidate = false
+	if peer != sm.syncPeer {
+		// Reassign the blocks which were not delivered.
+		if sm.fetchingBlocks {
+			sm.fetchHeaderBlocks()
+		}
+		return
 	}
+	sm.clearRequestedState(state)
+	sm.updateSyncPeer(false)
 }
 
 // clearRequestedState wipes all expected transactions and blocks from the sync
@@ -568,6 +721,7 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	// memory pool, orphan handling, etc.
 	acceptedTxs, err := sm.txMemPool.ProcessTransaction(tmsg.tx,
 		true, true, mempool.Tag(peer.ID()))
+	sm.chargeValidationCost(peer, state, tmsg.tx, err)
 
 	// Remove transaction from request maps. Either the mempool/chain
 	// already knows about it and as such we shouldn't have any more
@@ -604,6 +758,84 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
 }
 
+// chargeValidationCost attributes the validation cost of the passed transaction
+// relayed by the peer to it.  The cost of rejected transactions is added to the
+// decaying wasted validation cost of the peer, and once it exceeds the budget,
+// the ban score of the peer is increased for each further rejected transaction.
+// This prevents peers from cheaply burning CPU with transactions which are
+// crafted to be rejected only after expensive validation.
+func (sm *SyncManager) chargeValidationCost(peer *peerpkg.Peer,
+	state *peerSyncState, tx *btcutil.Tx, err error) {
+
+	units := mempool.EstimateValidationCost(tx).Units()
+	state.validationCost += units
+	sm.chargeWastedValidationCost(peer, state, units, err)
+}
+
+// chargeWastedValidationCost adds the passed validation cost of a transaction
+// relayed by the peer to its wasted validation cost when it was rejected with
+// the passed error, and increases the ban score of the peer once the wasted
+// validation cost exceeds the budget.
+func (sm *SyncManager) chargeWastedValidationCost(peer *peerpkg.Peer,
+	state *peerSyncState, units int64, err error) {
+
+	// Only transactions which were rejected for violating the rules are
+	// considered wasted.  Duplicates and transactions with insufficient
+	// fees are rejected before their scripts are validated.
+	if _, ok := err.(mempool.RuleError); !ok || sm.maxPeerValidationCost == 0 {
+		return
+	}
+	switch code, _ := mempool.ErrToRejectErr(err); code {
+	case wire.RejectDuplicate, wire.RejectInsufficientFee:
+		return
+	}
+
+	if units > math.MaxUint32 {
+		units = math.MaxUint32
+	}
+	wasted := state.wastedValidationCost.Increase(0, uint32(units))
+	if wasted <= sm.maxPeerValidationCost {
+		return
+	}
+
+	reason := fmt.Sprintf("%s: %d units wasted on rejected transactions "+
+		"exceeds budget of %d (%d units relayed in total)",
+		validationCostBanReason, wasted, sm.maxPeerValidationCost,
+		state.validationCost)
+	peer.AddBanScore(0, validationCostBanScore, reason)
+}
+
+// chargeRejectedOrphans charges the peers which relayed the orphan transactions
+// the memory pool rejected since the last call for their wasted validation
+// cost, since the orphans turned out to be invalid once their parents arrived.
+// The rejected orphans are not requested again until a new block has been
+// processed.
+func (sm *SyncManager) chargeRejectedOrphans() {
+	sm.rejectedOrphansMtx.Lock()
+	rejected := sm.rejectedOrphans
+	sm.rejectedOrphans = nil
+	sm.rejectedOrphansMtx.Unlock()
+
+	for _, orphan := range rejected {
+		txHash := orphan.tx.Hash()
+		sm.rejectedTxns[*txHash] = struct{}{}
+		sm.limitMap(sm.rejectedTxns, maxRejectedTxns)
+
+		for peer, state := range sm.peerStates {
+			if mempool.Tag(peer.ID()) != orphan.tag {
+				continue
+			}
+
+			log.Debugf("Rejected orphan transaction %v from %s: %v",
+				txHash, peer, orphan.err)
+			units := mempool.EstimateValidationCost(orphan.tx).Units()
+			sm.chargeWastedValidationCost(peer, state, units,
+				orphan.err)
+			break
+		}
+	}
+}
+
 // current returns true if we believe we are synced with our peers, false if we
 // still have blocks to check
 func (sm *SyncManager) current() bool {
@@ -650,6 +882,66 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
+	// Remove block from request maps. Either chain will know about it and
+	// so we shouldn't have any more instances of trying to fetch it, or we
+	// will fail the insert and thus we'll retry next time we get an inv.
+	delete(state.requestedBlocks, *blockHash)
+	delete(sm.requestedBlocks, *blockHash)
+
+	// The blocks before a loaded utxo snapshot are validated in order in
+	// the background rather than processed.
+	if sm.snapshotBlocks.deliver(bmsg) {
+		sm.validateSnapshotBlocks()
+		return
+	}
+
+	// Blocks which are not downloaded by the block scheduler are processed
+	// right away.
+	if !sm.fetchingBlocks || !sm.blockScheduler.delivered(blockHash,
+		bmsg.block.MsgBlock().SerializeSize(), time.Now()) {
+
+		sm.processPeerBlock(bmsg)
+		return
+	}
+
+	// The blocks of headers-first mode are downloaded from multiple peers
+	// in parallel, so they may arrive out of order.  Buffer the blocks
+	// which arrive ahead of the next block to be connected until the
+	// blocks before them arrived.
+	firstNodeEl := sm.headerList.Front()
+	if firstNodeEl == nil ||
+		!blockHash.IsEqual(firstNodeEl.Value.(*headerNode).hash) {
+
+		sm.blockScheduler.buffer(bmsg)
+		sm.fetchHeaderBlocks()
+		return
+	}
+
+	// Connect the block along with the buffered blocks which follow it and
+	// request more blocks in their place.
+	for bmsg != nil {
+		sm.processPeerBlock(bmsg)
+		sm.blockScheduler.blockConnected()
+		if !sm.fetchingBlocks {
+			return
+		}
+
+		bmsg = nil
+		if firstNodeEl = sm.headerList.Front(); firstNodeEl != nil {
+			firstNode := firstNodeEl.Value.(*headerNode)
+			bmsg = sm.blockScheduler.take(firstNode.hash)
+		}
+	}
+	sm.fetchHeaderBlocks()
+}
+
+// processPeerBlock processes the passed block received from a peer, which may
+// have been buffered by the block scheduler until the blocks before it arrived,
+// and updates the sync state accordingly.
+func (sm *SyncManager) processPeerBlock(bmsg *blockMsg) {
+	peer := bmsg.peer
+	blockHash := bmsg.block.Hash()
+
 	// When in headers-first mode, if the block matches the hash of the
 	// first header in the list of headers that are being fetched, it's
 	// eligible for less validation since the headers have already been
@@ -674,12 +966,6 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 	}
 
-	// Remove block from request maps. Either chain will know about it and
-	// so we shouldn't have any more instances of trying to fetch it, or we
-	// will fail the insert and thus we'll retry next time we get an inv.
-	delete(state.requestedBlocks, *blockHash)
-	delete(sm.requestedBlocks, *blockHash)
-
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
 	_, isOrphan, err := sm.chain.ProcessBlock(bmsg.block, behaviorFlags)
@@ -742,15 +1028,11 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 		}
 
 		orphanRoot := sm.chain.GetOrphanRoot(blockHash)
-		locator, err := sm.chain.LatestBlockLocator()
-		if err != nil {
-			log.Warnf("Failed to get block locator for the "+
-				"latest block: %v", err)
-		} else {
-			peer.PushGetBlocksMsg(locator, orphanRoot)
-		}
+		sm.requestOrphanParents(orphanRoot, []*peerpkg.Peer{peer})
 	} else {
-		if peer == sm.syncPeer {
+		// Blocks downloaded from any peer in headers-first mode are
+		// progress of the sync as well.
+		if peer == sm.syncPeer || behaviorFlags&blockchain.BFFastAdd != 0 {
 			sm.lastProgressTime = time.Now()
 		}
 
@@ -786,34 +1068,41 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	}
 
 	// This is headers-first mode, so if the block is not a checkpoint
-	// request more blocks using the header list when the request queue is
-	// getting short.
+	// the block scheduler requests more blocks using the header list.
 	if !isCheckpointBlock {
-		if sm.startHeader != nil &&
-			len(state.requestedBlocks) < minInFlightBlocks {
-			sm.fetchHeaderBlocks()
-		}
 		return
 	}
 
-	// This is headers-first mode and the block is a checkpoint.  When
-	// there is a next checkpoint, get the next round of headers by asking
-	// for headers starting from the block after this one up to the next
-	// checkpoint.
+	// This is headers-first mode and the block is a checkpoint, so all of
+	// the blocks up to it were fetched.  Since the blocks may have been
+	// downloaded from other peers, the following requests are sent to the
+	// sync peer.
+	sm.fetchingBlocks = false
+	syncPeer := sm.syncPeer
+	if syncPeer == nil {
+		return
+	}
+
+	// When there is a next checkpoint, get the next round of headers by
+	// asking for headers starting from the block after this one up to the
+	// next checkpoint.
 	prevHeight := sm.nextCheckpoint.Height
 	prevHash := sm.nextCheckpoint.Hash
 	sm.nextCheckpoint = sm.findNextHeaderCheckpoint(prevHeight)
 	if sm.nextCheckpoint != nil {
 		locator := blockchain.BlockLocator([]*chainhash.Hash{prevHash})
-		err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
+		err := syncPeer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
 		if err != nil {
 			log.Warnf("Failed to send getheaders message to "+
-				"peer %s: %v", peer.Addr(), err)
+				"peer %s: %v", syncPeer.Addr(), err)
 			return
 		}
-		log.Infof("Downloading headers for blocks %d to %d from "+
-			"peer %s", prevHeight+1, sm.nextCheckpoint.Height,
-			sm.syncPeer.Addr())
+		sm.presync = newHeadersPresync(sm.chainParams,
+			sm.nextCheckpoint, prevHash, prevHeight,
+			bmsg.block.MsgBlock().Header.Bits)
+		log.Infof("Pre-synchronizing headers for blocks %d to %d "+
+			"from peer %s", prevHeight+1, sm.nextCheckpoint.Height,
+			syncPeer.Addr())
 		return
 	}
 
@@ -824,81 +1113,335 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	sm.headerList.Init()
 	log.Infof("Reached the final checkpoint -- switching to normal mode")
 	locator := blockchain.BlockLocator([]*chainhash.Hash{blockHash})
-	err = peer.PushGetBlocksMsg(locator, &zeroHash)
+	err = syncPeer.PushGetBlocksMsg(locator, &zeroHash)
 	if err != nil {
 		log.Warnf("Failed to send getblocks message to peer %s: %v",
-			peer.Addr(), err)
+			syncPeer.Addr(), err)
 		return
 	}
 }
 
-// fetchHeaderBlocks creates and sends a request to the syncPeer for the next
-// list of blocks to be downloaded based on the current list of headers.
+// fetchHeaderBlocks has the block scheduler assign the blocks of the list of
+// headers within the download window which still need to be downloaded to the
+// sync candidate peers which have them and sends the requests.
 func (sm *SyncManager) fetchHeaderBlocks() {
-	// Nothing to do if there is no start header.
-	if sm.startHeader == nil {
-		log.Warnf("fetchHeaderBlocks called with no start header")
+	// Nothing to do if the headers of the next checkpoint did not arrive.
+	if !sm.fetchingBlocks {
+		log.Warnf("fetchHeaderBlocks called while not fetching blocks")
 		return
 	}
 
-	// Build up a getdata request for the list of blocks the headers
-	// describe.  The size hint will be limited to wire.MaxInvPerMsg by
-	// the function, so no need to double check it here.
-	gdmsg := wire.NewMsgGetDataSizeHint(uint(sm.headerList.Len()))
-	numRequested := 0
-	for e := sm.startHeader; e != nil; e = e.Next() {
-		node, ok := e.Value.(*headerNode)
-		if !ok {
-			log.Warn("Header list node type is not a headerNode")
+	peers := make([]downloadPeer, 0, len(sm.peerStates))
+	for peer, state := range sm.peerStates {
+		if !state.syncCandidate {
 			continue
 		}
-
-		iv := wire.NewInvVect(wire.InvTypeBlock, node.hash)
+		height := peer.LastBlock()
+		if startHeight := peer.StartingHeight(); startHeight > height {
+			height = startHeight
+		}
+		peers = append(peers, downloadPeer{peer: peer, height: height})
+	}
+	have := func(hash *chainhash.Hash) bool {
+		iv := wire.NewInvVect(wire.InvTypeBlock, hash)
 		haveInv, err := sm.haveInventory(iv)
 		if err != nil {
 			log.Warnf("Unexpected failure when checking for "+
 				"existing inventory during header block "+
 				"fetch: %v", err)
 		}
-		if !haveInv {
-			syncPeerState := sm.peerStates[sm.syncPeer]
+		return haveInv
+	}
 
-			sm.requestedBlocks[*node.hash] = struct{}{}
-			syncPeerState.requestedBlocks[*node.hash] = struct{}{}
+	assigned := sm.blockScheduler.schedule(sm.headerList, peers, have,
+		time.Now())
+	for peer, hashes := range assigned {
+		state := sm.peerStates[peer]
+		gdmsg := wire.NewMsgGetDataSizeHint(uint(len(hashes)))
+		for _, hash := range hashes {
+			sm.requestedBlocks[*hash] = struct{}{}
+			state.requestedBlocks[*hash] = struct{}{}
 
 			// If we're fetching from a witness enabled peer
 			// post-fork, then ensure that we receive all the
 			// witness data in the blocks.
-			if sm.syncPeer.IsWitnessEnabled() {
+			iv := wire.NewInvVect(wire.InvTypeBlock, hash)
+			if peer.IsWitnessEnabled() {
 				iv.Type = wire.InvTypeWitnessBlock
 			}
-
 			gdmsg.AddInvVect(iv)
-			numRequested++
 		}
-		sm.startHeader = e.Next()
-		if numRequested >= wire.MaxInvPerMsg {
+		peer.QueueMessage(gdmsg, nil)
+	}
+}
+
+// handleBlockStallCheck disconnects the peer which stalls the parallel download
+// of the blocks in headers-first mode by holding back the next block to be
+// connected and reassigns the blocks which were requested from it.
+func (sm *SyncManager) handleBlockStallCheck() {
+	if atomic.LoadInt32(&sm.shutdown) != 0 || !sm.fetchingBlocks {
+		return
+	}
+
+	firstNodeEl := sm.headerList.Front()
+	if firstNodeEl == nil {
+		return
+	}
+	firstNode := firstNodeEl.Value.(*headerNode)
+	peer := sm.blockScheduler.stalledPeer(firstNode.hash, time.Now())
+	if peer == nil {
+		return
+	}
+
+	log.Infof("Peer %s is stalling the download of block %v -- "+
+		"disconnecting", peer, firstNode.hash)
+	sm.blockScheduler.removePeer(peer)
+	if state, exists := sm.peerStates[peer]; exists {
+		state.syncCandidate = false
+		sm.clearRequestedState(state)
+		state.requestedBlocks = make(map[chainhash.Hash]struct{})
+	}
+	peer.Disconnect()
+
+	if peer == sm.syncPeer {
+		sm.updateSyncPeer(false)
+		return
+	}
+	sm.fetchHeaderBlocks()
+}
+
+// requestOrphanParents requests the blocks from the latest known block up to the
+// orphan block with the passed hash, which must be the root of an orphan chain,
+// from the passed peers.
+func (sm *SyncManager) requestOrphanParents(root *chainhash.Hash, peers []*peerpkg.Peer) {
+	locator, err := sm.chain.LatestBlockLocator()
+	if err != nil {
+		log.Warnf("Failed to get block locator for the latest block: %v",
+			err)
+		return
+	}
+
+	now := time.Now()
+	for _, peer := range peers {
+		peer.PushGetBlocksMsg(locator, root)
+		sm.orphanParents.requested(root, peer, now)
+	}
+}
+
+// handleOrphanParentCheck requests the missing parents of the orphan blocks
+// which did not arrive in time from other peers.
+func (sm *SyncManager) handleOrphanParentCheck() {
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	roots := sm.chain.OrphanRoots()
+	sm.orphanParents.prune(roots)
+	if len(roots) == 0 {
+		return
+	}
+
+	candidates := make([]*peerpkg.Peer, 0, len(sm.peerStates))
+	for peer, state := range sm.peerStates {
+		if state.syncCandidate {
+			candidates = append(candidates, peer)
+		}
+	}
+
+	now := time.Now()
+	for _, root := range roots {
+		peers := sm.orphanParents.peersToAsk(root, candidates, now)
+		if len(peers) == 0 {
+			continue
+		}
+		log.Debugf("Requesting the missing parents of orphan block %v "+
+			"from %d peers", root, len(peers))
+		sm.requestOrphanParents(root, peers)
+	}
+}
+
+// fetchSnapshotBlocks requests the next blocks before the loaded utxo snapshot
+// which need to be validated in the background from the sync candidate peers.
+// The blocks are only requested once the chain is current so the background
+// validation does not slow down the sync of the tip.
+func (sm *SyncManager) fetchSnapshotBlocks() {
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+	sv := sm.chain.SnapshotValidation()
+	if sv == nil || sv.Failed {
+		sm.snapshotBlocks.reset()
+		return
+	}
+	if !sm.current() {
+		return
+	}
+
+	peers := make([]*peerpkg.Peer, 0, len(sm.peerStates))
+	for peer, state := range sm.peerStates {
+		if state.syncCandidate {
+			peers = append(peers, peer)
+		}
+	}
+	if len(peers) == 0 {
+		return
+	}
+
+	now := time.Now()
+	hashes := sm.chain.SnapshotValidationBlocks(maxSnapshotBlocksInFlight)
+	needed := sm.snapshotBlocks.toRequest(hashes, now)
+	if len(needed) == 0 {
+		return
+	}
+	gdmsgs := make(map[*peerpkg.Peer]*wire.MsgGetData)
+	for i := range needed {
+		hash := &needed[i]
+		peer := peers[i%len(peers)]
+		gdmsg, ok := gdmsgs[peer]
+		if !ok {
+			gdmsg = wire.NewMsgGetData()
+			gdmsgs[peer] = gdmsg
+		}
+		iv := wire.NewInvVect(wire.InvTypeBlock, hash)
+		if peer.IsWitnessEnabled() {
+			iv.Type = wire.InvTypeWitnessBlock
+		}
+		gdmsg.AddInvVect(iv)
+		sm.peerStates[peer].requestedBlocks[*hash] = struct{}{}
+		sm.snapshotBlocks.requested(hash, peer, now)
+	}
+	for peer, gdmsg := range gdmsgs {
+		peer.QueueMessage(gdmsg, nil)
+	}
+	log.Debugf("Requested %d blocks before the utxo snapshot at height "+
+		"%d from %d peers", len(needed), sv.Height, len(gdmsgs))
+}
+
+// validateSnapshotBlocks validates the buffered blocks before the loaded utxo
+// snapshot which are next in line and requests more blocks in their place.
+// Peers which deliver invalid blocks are disconnected.
+func (sm *SyncManager) validateSnapshotBlocks() {
+	for {
+		hashes := sm.chain.SnapshotValidationBlocks(1)
+		if len(hashes) == 0 {
+			break
+		}
+		bmsg := sm.snapshotBlocks.take(&hashes[0])
+		if bmsg == nil {
 			break
 		}
+
+		err := sm.chain.ValidateSnapshotBlock(bmsg.block)
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(blockchain.RuleError); ok {
+			log.Infof("Rejected block %v before the utxo snapshot "+
+				"from %s: %v -- disconnecting", hashes[0],
+				bmsg.peer, err)
+			bmsg.peer.Disconnect()
+			break
+		}
+		log.Errorf("Failed to validate block %v before the utxo "+
+			"snapshot: %v", hashes[0], err)
+		break
 	}
-	if len(gdmsg.InvList) > 0 {
-		sm.syncPeer.QueueMessage(gdmsg, nil)
+	sm.fetchSnapshotBlocks()
+}
+
+// sampleProgress returns the current progress of the synchronization of the
+// chain with the network.
+func (sm *SyncManager) sampleProgress() *SyncProgress {
+	now := time.Now()
+	best := sm.chain.BestSnapshot()
+	progress := &SyncProgress{
+		Time:          now,
+		HeadersHeight: best.Height,
+		BlockHeight:   best.Height,
+		BlockHash:     best.Hash,
+		TargetHeight:  best.Height,
+		Current:       sm.current(),
+	}
+	if sm.headersFirstMode {
+		if e := sm.headerList.Back(); e != nil {
+			node := e.Value.(*headerNode)
+			if node.height > progress.HeadersHeight {
+				progress.HeadersHeight = node.height
+			}
+		}
+		if sm.presync != nil {
+			progress.PresyncHeight = sm.presync.lastHeight
+		}
 	}
+
+	// Use the height announced by the sync peer as the target, falling
+	// back to the best sync candidate.
+	if sm.syncPeer != nil {
+		progress.SyncPeerID = sm.syncPeer.ID()
+		progress.SyncPeerAddr = sm.syncPeer.Addr()
+		if height := sm.syncPeer.LastBlock(); height > progress.TargetHeight {
+			progress.TargetHeight = height
+		}
+	} else {
+		for peer, state := range sm.peerStates {
+			height := peer.LastBlock()
+			if state.syncCandidate && height > progress.TargetHeight {
+				progress.TargetHeight = height
+			}
+		}
+	}
+	if progress.HeadersHeight > progress.TargetHeight {
+		progress.TargetHeight = progress.HeadersHeight
+	}
+
+	progress.BlocksPerSecond = sm.syncRate.update(best.Height, now)
+	progress.Progress, progress.ETA = estimateProgress(best.Height,
+		progress.TargetHeight, progress.BlocksPerSecond)
+	return progress
+}
+
+// handleProgressSample publishes the current sync progress to the subscribers.
+func (sm *SyncManager) handleProgressSample() {
+	sm.progress.publish(sm.sampleProgress())
 }
 
 // handleHeadersMsg handles block header messages from all peers.  Headers are
 // requested when performing a headers-first sync.
 func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	peer := hmsg.peer
-	_, exists := sm.peerStates[peer]
+	state, exists := sm.peerStates[peer]
 	if !exists {
 		log.Warnf("Received headers message from unknown peer %s", peer)
 		return
 	}
 
-	// The remote peer is misbehaving if we didn't request headers.
+	// Hand the response to a fork header request to the handler.  The
+	// request asks for a single header, so an empty response means the
+	// peer does not know the block.
 	msg := hmsg.headers
 	numHeaders := len(msg.Headers)
+	if requested := state.requestedForkHeader; requested != nil &&
+		numHeaders <= 1 {
+
+		state.requestedForkHeader = nil
+		var header *wire.BlockHeader
+		if numHeaders == 1 {
+			header = msg.Headers[0]
+			if header.BlockHash() != *requested {
+				log.Warnf("Got unrequested fork header %v from "+
+					"%s -- disconnecting", header.BlockHash(),
+					peer.Addr())
+				peer.Disconnect()
+				return
+			}
+		}
+		if sm.forkHeaderHandler != nil {
+			sm.forkHeaderHandler(peer, requested, header)
+		}
+		return
+	}
+
+	// The remote peer is misbehaving if we didn't request headers.
 	if !sm.headersFirstMode {
 		log.Warnf("Got %d unrequested headers from %s -- "+
 			"disconnecting", numHeaders, peer.Addr())
@@ -911,6 +1454,13 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
+	// Pre-synchronize the headers up to the next checkpoint before they
+	// are downloaded again to be stored.
+	if sm.presync != nil && !sm.presync.complete {
+		sm.handlePresyncHeaders(peer, msg.Headers)
+		return
+	}
+
 	// Process all of the received headers ensuring each one connects to the
 	// previous and that checkpoints match.
 	receivedCheckpoint := false
@@ -929,15 +1479,25 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		}
 
 		// Ensure the header properly connects to the previous one and
-		// add it to the list of headers.
+		// matches the pre-synchronized headers, and add it to the list
+		// of headers.
 		node := headerNode{hash: &blockHash}
 		prevNode := prevNodeEl.Value.(*headerNode)
 		if prevNode.hash.IsEqual(&blockHeader.PrevBlock) {
 			node.height = prevNode.height + 1
-			e := sm.headerList.PushBack(&node)
-			if sm.startHeader == nil {
-				sm.startHeader = e
+			if sm.presync != nil {
+				err := sm.presync.verify(node.height, node.hash)
+				if err != nil {
+					log.Warnf("Received block header "+
+						"from peer %s which does not "+
+						"match the pre-synchronized "+
+						"headers: %v -- disconnecting",
+						peer.Addr(), err)
+					peer.Disconnect()
+					return
+				}
 			}
+			sm.headerList.PushBack(&node)
 		} else {
 			log.Warnf("Received block header that does not "+
 				"properly connect to the chain from peer %s "+
@@ -975,9 +1535,11 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		// the next header links properly, it must be removed before
 		// fetching the blocks.
 		sm.headerList.Remove(sm.headerList.Front())
+		sm.presync = nil
 		log.Infof("Received %v block headers: Fetching blocks",
 			sm.headerList.Len())
 		sm.progressLogger.SetLastLogTime(time.Now())
+		sm.fetchingBlocks = true
 		sm.fetchHeaderBlocks()
 		return
 	}
@@ -994,6 +1556,47 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	}
 }
 
+// handlePresyncHeaders pre-synchronizes the passed headers received from the
+// passed peer and requests the next batch of headers.  Once the headers reached
+// the next checkpoint, all of them are requested again to be stored.
+func (sm *SyncManager) handlePresyncHeaders(peer *peerpkg.Peer, headers []*wire.BlockHeader) {
+	complete, err := sm.presync.processHeaders(headers)
+	if err != nil {
+		log.Warnf("Failed to pre-synchronize headers from peer %s: %v "+
+			"-- disconnecting", peer.Addr(), err)
+		peer.Disconnect()
+		return
+	}
+
+	// Request the next batch of headers to pre-synchronize starting from
+	// the last pre-synchronized header.
+	if !complete {
+		lastHash := sm.presync.lastHash
+		locator := blockchain.BlockLocator([]*chainhash.Hash{&lastHash})
+		err := peer.PushGetHeadersMsg(locator, sm.nextCheckpoint.Hash)
+		if err != nil {
+			log.Warnf("Failed to send getheaders message to "+
+				"peer %s: %v", peer.Addr(), err)
+		}
+		return
+	}
+
+	// The headers lead to the checkpoint, so download them again starting
+	// from the last header in the list, which is the block the
+	// pre-synchronization started from.  The request may be identical to
+	// the one which started the pre-synchronization, so it is queued
+	// directly since the peer would filter it as a duplicate otherwise.
+	log.Infof("Pre-synchronized headers for blocks %d to %d with %v "+
+		"cumulative work from peer %s -- downloading headers",
+		sm.presync.startHeight+1, sm.presync.lastHeight,
+		sm.presync.work, peer.Addr())
+	startNode := sm.headerList.Back().Value.(*headerNode)
+	gmsg := wire.NewMsgGetHeaders()
+	gmsg.HashStop = *sm.nextCheckpoint.Hash
+	gmsg.AddBlockLocatorHash(startNode.hash)
+	peer.QueueMessage(gmsg, nil)
+}
+
 // haveInventory returns whether or not the inventory represented by the passed
 // inventory vector is known.  This includes checking all of the various places
 // inventory can be when it is in different states such as blocks that are part
@@ -1160,14 +1763,8 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 				// up to the root of the orphan that just came
 				// in.
 				orphanRoot := sm.chain.GetOrphanRoot(&iv.Hash)
-				locator, err := sm.chain.LatestBlockLocator()
-				if err != nil {
-					log.Errorf("PEER: Failed to get block "+
-						"locator for the latest block: "+
-						"%v", err)
-					continue
-				}
-				peer.PushGetBlocksMsg(locator, orphanRoot)
+				sm.requestOrphanParents(orphanRoot,
+					[]*peerpkg.Peer{peer})
 				continue
 			}
 
@@ -1245,6 +1842,53 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 	}
 }
 
+// handleRequestBlockMsg requests the block from the peer, outside of the
+// regular sync process, unless it is already being requested.  This is used to
+// fetch blocks of stale forks which would otherwise never be downloaded.
+func (sm *SyncManager) handleRequestBlockMsg(msg *requestBlockMsg) error {
+	state, exists := sm.peerStates[msg.peer]
+	if !exists {
+		return errors.New("peer is not connected")
+	}
+	if !msg.peer.IsWitnessEnabled() {
+		return errors.New("peer does not serve witness data")
+	}
+	if _, exists := sm.requestedBlocks[*msg.hash]; exists {
+		return nil
+	}
+
+	sm.requestedBlocks[*msg.hash] = struct{}{}
+	sm.limitMap(sm.requestedBlocks, maxRequestedBlocks)
+	state.requestedBlocks[*msg.hash] = struct{}{}
+
+	gdmsg := wire.NewMsgGetData()
+	gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeWitnessBlock, msg.hash))
+	msg.peer.QueueMessage(gdmsg, nil)
+	return nil
+}
+
+// handleRequestForkHeaderMsg requests the header of the block from the peer.
+// Only one such request may be outstanding per peer and none are made during
+// the headers-first initial download since the responses could not be told
+// apart.
+func (sm *SyncManager) handleRequestForkHeaderMsg(msg *requestForkHeaderMsg) error {
+	state, exists := sm.peerStates[msg.peer]
+	if !exists {
+		return errors.New("peer is not connected")
+	}
+	if sm.headersFirstMode {
+		return errors.New("headers-first sync in progress")
+	}
+	if state.requestedForkHeader != nil {
+		return errors.New("header request already in progress")
+	}
+
+	// A getheaders request without block locators asks for the header of
+	// the stop hash only, regardless of the chain it is part of.
+	state.requestedForkHeader = msg.hash
+	return msg.peer.PushGetHeadersMsg(nil, msg.hash)
+}
+
 // limitMap is a helper function for maps that require a maximum limit by
 // evicting a random transaction if adding a new value would cause it to
 // overflow the maximum allowed.
@@ -1272,6 +1916,16 @@ func (sm *SyncManager) limitMap(m map[chainhash.Hash]struct{}, limit int) {
 func (sm *SyncManager) blockHandler() {
 	stallTicker := time.NewTicker(stallSampleInterval)
 	defer stallTicker.Stop()
+	blockStallTicker := time.NewTicker(blockStallCheckInterval)
+	defer blockStallTicker.Stop()
+	orphanParentTicker := time.NewTicker(orphanParentCheckInterval)
+	defer orphanParentTicker.Stop()
+	progressTicker := time.NewTicker(syncProgressInterval)
+	defer progressTicker.Stop()
+	snapshotTicker := time.NewTicker(snapshotFetchInterval)
+	defer snapshotTicker.Stop()
+
+	sm.handleProgressSample()
 
 out:
 	for {
@@ -1298,6 +1952,15 @@ out:
 			case *donePeerMsg:
 				sm.handleDonePeerMsg(msg.peer)
 
+			case *requestTimeoutMsg:
+				sm.handleRequestTimeoutMsg(msg)
+
+			case *requestBlockMsg:
+				msg.reply <- sm.handleRequestBlockMsg(msg)
+
+			case *requestForkHeaderMsg:
+				msg.reply <- sm.handleRequestForkHeaderMsg(msg)
+
 			case getSyncPeerMsg:
 				var peerID int32
 				if sm.syncPeer != nil {
@@ -1332,9 +1995,25 @@ out:
 					"handler: %T", msg)
 			}
 
+			// Charge the peers which relayed orphans that were
+			// rejected while handling the message or elsewhere.
+			sm.chargeRejectedOrphans()
+
 		case <-stallTicker.C:
 			sm.handleStallSample()
 
+		case <-blockStallTicker.C:
+			sm.handleBlockStallCheck()
+
+		case <-orphanParentTicker.C:
+			sm.handleOrphanParentCheck()
+
+		case <-progressTicker.C:
+			sm.handleProgressSample()
+
+		case <-snapshotTicker.C:
+			sm.fetchSnapshotBlocks()
+
 		case <-sm.quit:
 			break out
 		}
@@ -1376,6 +2055,14 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			break
 		}
 
+		// Register block with the fee estimator, if it exists.  This
+		// must happen before its transactions are removed from the
+		// transaction pool so they are not considered to have left it
+		// without being mined.
+		if sm.feeEstimator != nil {
+			sm.feeEstimator.RegisterBlock(block)
+		}
+
 		// Remove all of the transactions (except the coinbase) in the
 		// connected block from the transaction pool.  Secondly, remove any
 		// transactions which are now double spends as a result of these
@@ -1384,7 +2071,8 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 		// transaction are NOT removed recursively because they are still
 		// valid.
 		for _, tx := range block.Transactions()[1:] {
-			sm.txMemPool.RemoveTransaction(tx, false)
+			sm.txMemPool.RemoveTransaction(tx, false,
+				mempool.RemovalReasonBlock)
 			sm.txMemPool.RemoveDoubleSpends(tx)
 			sm.txMemPool.RemoveOrphan(tx)
 			sm.peerNotifier.TransactionConfirmed(tx)
@@ -1392,20 +2080,6 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 			sm.peerNotifier.AnnounceNewTransactions(acceptedTxs)
 		}
 
-		// Register block with the fee estimator, if it exists.
-		if sm.feeEstimator != nil {
-			err := sm.feeEstimator.RegisterBlock(block)
-
-			// If an error is somehow generated then the fee estimator
-			// has entered an invalid state. Since it doesn't know how
-			// to recover, create a new one.
-			if err != nil {
-				sm.feeEstimator = mempool.NewFeeEstimator(
-					mempool.DefaultEstimateFeeMaxRollback,
-					mempool.DefaultEstimateFeeMinRegisteredBlocks)
-			}
-		}
-
 	// A block has been disconnected from the main block chain.
 	case blockchain.NTBlockDisconnected:
 		block, ok := notification.Data.(*btcutil.Block)
@@ -1423,17 +2097,29 @@ func (sm *SyncManager) handleBlockchainNotification(notification *blockchain.Not
 				// Remove the transaction and all transactions
 				// that depend on it if it wasn't accepted into
 				// the transaction pool.
-				sm.txMemPool.RemoveTransaction(tx, true)
+				sm.txMemPool.RemoveTransaction(tx, true,
+					mempool.RemovalReasonReorg)
 			}
 		}
-
-		// Rollback previous block recorded by the fee estimator.
-		if sm.feeEstimator != nil {
-			sm.feeEstimator.Rollback(block.Hash())
-		}
 	}
 }
 
+// OrphanRejected informs the sync manager that an orphan transaction relayed by
+// the peer with the ID of the passed tag was rejected by the memory pool once
+// its parents arrived, so the peer can be charged for it.  It is safe for
+// concurrent access and may be called with the memory pool lock held.
+func (sm *SyncManager) OrphanRejected(tx *btcutil.Tx, tag mempool.Tag, err error) {
+	sm.rejectedOrphansMtx.Lock()
+	if len(sm.rejectedOrphans) < maxRejectedTxns {
+		sm.rejectedOrphans = append(sm.rejectedOrphans, rejectedOrphan{
+			tx:  tx,
+			tag: tag,
+			err: err,
+		})
+	}
+	sm.rejectedOrphansMtx.Unlock()
+}
+
 // NewPeer informs the sync manager of a newly active peer.
 func (sm *SyncManager) NewPeer(peer *peerpkg.Peer) {
 	// Ignore if we are shutting down.
@@ -1492,6 +2178,31 @@ func (sm *SyncManager) QueueHeaders(headers *wire.MsgHeaders, peer *peerpkg.Peer
 	sm.msgChan <- &headersMsg{headers: headers, peer: peer}
 }
 
+// RequestBlock requests the block with the passed hash from the peer even
+// though it was not announced by it.  The block is processed like any other
+// block once it arrives.
+func (sm *SyncManager) RequestBlock(hash *chainhash.Hash, peer *peerpkg.Peer) error {
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return errors.New("sync manager is shutting down")
+	}
+
+	reply := make(chan error, 1)
+	sm.msgChan <- &requestBlockMsg{hash: hash, peer: peer, reply: reply}
+	return <-reply
+}
+
+// RequestForkHeader requests the header of the block with the passed hash from
+// the peer.  The response is delivered to the configured ForkHeaderHandler.
+func (sm *SyncManager) RequestForkHeader(hash *chainhash.Hash, peer *peerpkg.Peer) error {
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return errors.New("sync manager is shutting down")
+	}
+
+	reply := make(chan error, 1)
+	sm.msgChan <- &requestForkHeaderMsg{hash: hash, peer: peer, reply: reply}
+	return <-reply
+}
+
 // DonePeer informs the blockmanager that a peer has disconnected.
 func (sm *SyncManager) DonePeer(peer *peerpkg.Peer) {
 	// Ignore if we are shutting down.
@@ -1502,6 +2213,17 @@ func (sm *SyncManager) DonePeer(peer *peerpkg.Peer) {
 	sm.msgChan <- &donePeerMsg{peer: peer}
 }
 
+// RequestTimedOut informs the sync manager that a peer did not answer a request
+// by its deadline so the requested data can be fetched from other peers.
+func (sm *SyncManager) RequestTimedOut(peer *peerpkg.Peer, timeout *peerpkg.RequestTimeout) {
+	// Ignore if we are shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+
+	sm.msgChan <- &requestTimeoutMsg{peer: peer, timeout: timeout}
+}
+
 // Start begins the core block handler which processes block and inv messages.
 func (sm *SyncManager) Start() {
 	// Already started?
@@ -1529,6 +2251,25 @@ func (sm *SyncManager) Stop() error {
 	return nil
 }
 
+// SubscribeProgress returns a subscription to the progress of the
+// synchronization of the chain with the network, which is published
+// periodically.  The subscription immediately receives the latest progress.
+// The caller must cancel it with Unsubscribe once it is no longer needed.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) SubscribeProgress() *ProgressSubscription {
+	return sm.progress.subscribe()
+}
+
+// SyncProgress returns the latest published progress of the synchronization of
+// the chain with the network.  It returns nil when the sync manager was not
+// started yet.
+//
+// This function is safe for concurrent access.
+func (sm *SyncManager) SyncProgress() *SyncProgress {
+	return sm.progress.latestProgress()
+}
+
 // SyncPeerID returns the ID of the current sync peer, or 0 if there is none.
 func (sm *SyncManager) SyncPeerID() int32 {
 	reply := make(chan int32)
@@ -1580,6 +2321,14 @@ func New(config *Config) (*SyncManager, error) {
 		headerList:      list.New(),
 		quit:            make(chan struct{}),
 		feeEstimator:    config.FeeEstimator,
+
+		forkHeaderHandler:     config.ForkHeaderHandler,
+		maxPeerValidationCost: config.MaxPeerValidationCost,
+		blockScheduler: newBlockScheduler(blockDownloadWindow,
+			maxInFlightBlocksPerPeer),
+		orphanParents:  newOrphanParentTracker(),
+		snapshotBlocks: newSnapshotFetcher(),
+		progress:       newProgressPublisher(),
 	}
 
 	best := sm.chain.BestSnapshot()
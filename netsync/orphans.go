@@ -0,0 +1,120 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+)
+
+const (
+	// orphanParentRequestInterval is the time the peers asked for the
+	// missing parents of an orphan block are given to deliver them before
+	// they are requested from other peers.
+	orphanParentRequestInterval = 15 * time.Second
+
+	// orphanParentCheckInterval is the interval at which the orphan blocks
+	// are checked for missing parents which need to be requested again.
+	orphanParentCheckInterval = 5 * time.Second
+
+	// maxOrphanParentPeers is the maximum number of peers the missing
+	// parents of an orphan block are requested from at a time.
+	maxOrphanParentPeers = 3
+)
+
+// orphanParentRequest tracks the requests of the missing parents of an orphan
+// block.
+type orphanParentRequest struct {
+	asked       map[*peerpkg.Peer]struct{}
+	lastRequest time.Time
+}
+
+// orphanParentTracker tracks the peers the missing parents of the orphan blocks
+// were requested from so they can be requested from other peers when they do
+// not arrive in time.  This keeps a single unresponsive or misbehaving peer
+// from stalling the connection of the orphan blocks, which is common on
+// networks with frequent reorganizations or flaky peers.
+//
+// The tracker is not safe for concurrent access.  It is only used from the
+// blockHandler goroutine of the sync manager.
+type orphanParentTracker struct {
+	requests map[chainhash.Hash]*orphanParentRequest
+}
+
+// newOrphanParentTracker returns a new empty orphan parent tracker.
+func newOrphanParentTracker() *orphanParentTracker {
+	return &orphanParentTracker{
+		requests: make(map[chainhash.Hash]*orphanParentRequest),
+	}
+}
+
+// requested records that the missing parents of the orphan block with the
+// passed hash, which must be the root of an orphan chain, were requested from
+// the passed peer at the passed time.
+func (t *orphanParentTracker) requested(root *chainhash.Hash, peer *peerpkg.Peer, now time.Time) {
+	req, ok := t.requests[*root]
+	if !ok {
+		req = &orphanParentRequest{
+			asked: make(map[*peerpkg.Peer]struct{}),
+		}
+		t.requests[*root] = req
+	}
+	req.asked[peer] = struct{}{}
+	req.lastRequest = now
+}
+
+// peersToAsk returns the peers among the passed candidates the missing parents
+// of the orphan block with the passed hash should be requested from as of the
+// passed time.  No peers are returned while the previous request is within
+// orphanParentRequestInterval.  Otherwise, up to maxOrphanParentPeers peers
+// which were not asked yet are returned, starting over with all candidates
+// once every one of them was asked.
+func (t *orphanParentTracker) peersToAsk(root *chainhash.Hash, candidates []*peerpkg.Peer, now time.Time) []*peerpkg.Peer {
+	req, ok := t.requests[*root]
+	if ok && now.Sub(req.lastRequest) < orphanParentRequestInterval {
+		return nil
+	}
+
+	var peers []*peerpkg.Peer
+	for pass := 0; pass < 2 && len(peers) == 0; pass++ {
+		for _, peer := range candidates {
+			if len(peers) == maxOrphanParentPeers {
+				break
+			}
+			if ok && pass == 0 {
+				if _, asked := req.asked[peer]; asked {
+					continue
+				}
+			}
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// removePeer forgets the passed peer was asked for any missing parents so
+// they are requested from other peers.
+func (t *orphanParentTracker) removePeer(peer *peerpkg.Peer) {
+	for _, req := range t.requests {
+		delete(req.asked, peer)
+	}
+}
+
+// prune forgets the requests of the orphan blocks which are not among the
+// passed roots of the orphan chains, since they either were connected, expired,
+// or were evicted.
+func (t *orphanParentTracker) prune(roots []*chainhash.Hash) {
+	keep := make(map[chainhash.Hash]struct{}, len(roots))
+	for _, root := range roots {
+		keep[*root] = struct{}{}
+	}
+	for hash := range t.requests {
+		if _, ok := keep[hash]; !ok {
+			delete(t.requests, hash)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+)
+
+// TestOrphanParentTracker ensures the missing parents of orphan blocks are
+// requested from other peers once the previous request is overdue, up to the
+// per request limit, and the tracker forgets peers and connected orphans.
+func TestOrphanParentTracker(t *testing.T) {
+	tracker := newOrphanParentTracker()
+	candidates := make([]*peerpkg.Peer, 0, 5)
+	for i := 0; i < 5; i++ {
+		candidates = append(candidates, new(peerpkg.Peer))
+	}
+	root := &chainhash.Hash{0x01}
+	now := time.Unix(1000, 0)
+
+	// The parents of an orphan which was not requested yet are requested
+	// from as many peers as allowed.
+	peers := tracker.peersToAsk(root, candidates, now)
+	if len(peers) != maxOrphanParentPeers {
+		t.Fatalf("asked %d peers, want %d", len(peers),
+			maxOrphanParentPeers)
+	}
+	for _, peer := range peers {
+		tracker.requested(root, peer, now)
+	}
+
+	// No peers are asked until the request is overdue, and then only the
+	// peers which were not asked yet.
+	if peers := tracker.peersToAsk(root, candidates, now.Add(time.Second)); len(peers) != 0 {
+		t.Fatalf("asked %d peers before the request was overdue",
+			len(peers))
+	}
+	later := now.Add(orphanParentRequestInterval)
+	peers = tracker.peersToAsk(root, candidates, later)
+	if len(peers) != 2 || peers[0] != candidates[3] ||
+		peers[1] != candidates[4] {
+
+		t.Fatalf("unexpected peers asked after the request was overdue")
+	}
+	for _, peer := range peers {
+		tracker.requested(root, peer, later)
+	}
+
+	// Once all peers were asked, all of them are asked again, while peers
+	// which were removed are asked again right away.
+	later = later.Add(orphanParentRequestInterval)
+	tracker.removePeer(candidates[1])
+	peers = tracker.peersToAsk(root, candidates, later)
+	if len(peers) != 1 || peers[0] != candidates[1] {
+		t.Fatalf("removed peer was not asked again")
+	}
+	tracker.requested(root, candidates[1], later)
+	later = later.Add(orphanParentRequestInterval)
+	if peers := tracker.peersToAsk(root, candidates, later); len(peers) != maxOrphanParentPeers {
+		t.Fatalf("asked %d peers after all were asked, want %d",
+			len(peers), maxOrphanParentPeers)
+	}
+
+	// Orphans which are no longer roots are forgotten.
+	tracker.prune(nil)
+	if len(tracker.requests) != 0 {
+		t.Fatal("requests of connected orphans were not pruned")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// presyncCommitmentInterval is the interval of the heights of the headers whose
+// hashes are remembered while the headers are pre-synchronized.  The headers
+// which are downloaded again to be stored must match them, which bounds the
+// number of headers a peer can have stored before it is caught serving a
+// different chain the second time around.
+const presyncCommitmentInterval = 500
+
+// headersPresync tracks the pre-synchronization of the headers from the best
+// block up to the next checkpoint in headers-first mode.  The headers are
+// downloaded twice.  While they are pre-synchronized, they are only checked to
+// connect, to have a permitted difficulty, and to have valid proof of work,
+// their work is accumulated, and nothing but a small commitment to them is
+// kept in memory.  Only once they are proven to lead to the checkpoint are they
+// downloaded again and stored, while ensuring they match the commitment.  This
+// prevents peers from consuming memory by sending headers of low-work chains
+// which do not lead to the checkpoint.
+type headersPresync struct {
+	params      *chaincfg.Params
+	checkpoint  *chaincfg.Checkpoint
+	startHeight int32
+
+	// The following fields track the last pre-synchronized header.
+	lastHash   chainhash.Hash
+	lastHeight int32
+	lastBits   uint32
+
+	// work is the cumulative work of the pre-synchronized headers.
+	work *big.Int
+
+	// commitments are the hashes of the pre-synchronized headers at the
+	// heights which are multiples of presyncCommitmentInterval.
+	commitments []chainhash.Hash
+
+	// complete is set once the headers reached the checkpoint.
+	complete bool
+}
+
+// newHeadersPresync returns a pre-synchronization of the headers which follow
+// the block with the passed hash, height, and difficulty bits up to the passed
+// checkpoint.
+func newHeadersPresync(params *chaincfg.Params, checkpoint *chaincfg.Checkpoint,
+	hash *chainhash.Hash, height int32, bits uint32) *headersPresync {
+
+	return &headersPresync{
+		params:      params,
+		checkpoint:  checkpoint,
+		startHeight: height,
+		lastHash:    *hash,
+		lastHeight:  height,
+		lastBits:    bits,
+		work:        new(big.Int),
+	}
+}
+
+// processHeaders checks the passed headers which must follow the last
+// pre-synchronized header and accumulates their work.  It returns whether the
+// headers reached the checkpoint, in which case the pre-synchronization is
+// complete, and an error when the headers do not connect, violate the
+// difficulty rules, have invalid proof of work, or do not match the checkpoint.
+func (p *headersPresync) processHeaders(headers []*wire.BlockHeader) (bool, error) {
+	for _, header := range headers {
+		if p.complete {
+			break
+		}
+
+		if header.PrevBlock != p.lastHash {
+			return false, fmt.Errorf("header %v does not connect to "+
+				"the previous header %v", header.BlockHash(),
+				p.lastHash)
+		}
+		height := p.lastHeight + 1
+		if !blockchain.IsPermittedDifficultyTransition(p.params, height,
+			p.lastBits, header.Bits) {
+
+			return false, fmt.Errorf("header %v at height %d has "+
+				"difficulty bits %08x which may not follow %08x",
+				header.BlockHash(), height, header.Bits, p.lastBits)
+		}
+		err := blockchain.CheckHeaderProofOfWork(header, p.params.PowLimit)
+		if err != nil {
+			return false, err
+		}
+
+		hash := header.BlockHash()
+		if height == p.checkpoint.Height {
+			if hash != *p.checkpoint.Hash {
+				return false, fmt.Errorf("header %v at height %d "+
+					"does not match checkpoint %v", hash,
+					height, p.checkpoint.Hash)
+			}
+			p.complete = true
+		}
+		if height%presyncCommitmentInterval == 0 {
+			p.commitments = append(p.commitments, hash)
+		}
+
+		p.work.Add(p.work, blockchain.CalcWork(header.Bits))
+		p.lastHash = hash
+		p.lastHeight = height
+		p.lastBits = header.Bits
+	}
+
+	return p.complete, nil
+}
+
+// verify ensures the passed hash of the header at the passed height, which is
+// downloaded again to be stored after the pre-synchronization completed,
+// matches the commitment to the pre-synchronized headers.
+func (p *headersPresync) verify(height int32, hash *chainhash.Hash) error {
+	if height%presyncCommitmentInterval != 0 {
+		return nil
+	}
+
+	// The commitments start with the first multiple of the interval after
+	// the start height.
+	i := int(height/presyncCommitmentInterval -
+		p.startHeight/presyncCommitmentInterval - 1)
+	if i < 0 || i >= len(p.commitments) {
+		return fmt.Errorf("no pre-synchronized header at height %d",
+			height)
+	}
+	if p.commitments[i] != *hash {
+		return fmt.Errorf("header %v at height %d does not match the "+
+			"pre-synchronized header %v", hash, height,
+			p.commitments[i])
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// solveHeader sets the nonce of the passed header so that its hash satisfies
+// the target of its difficulty bits, or does not when valid is false.
+func solveHeader(header *wire.BlockHeader, valid bool) {
+	target := blockchain.CompactToBig(header.Bits)
+	for {
+		hash := header.BlockHash()
+		if (blockchain.HashToBig(&hash).Cmp(target) <= 0) == valid {
+			return
+		}
+		header.Nonce++
+	}
+}
+
+// testHeaderChain returns a chain of n headers with valid proof of work on the
+// regression test network which extends the genesis block.
+func testHeaderChain(n int) []*wire.BlockHeader {
+	params := &chaincfg.RegressionNetParams
+	prevHash := *params.GenesisHash
+	headers := make([]*wire.BlockHeader, 0, n)
+	for i := 0; i < n; i++ {
+		header := &wire.BlockHeader{
+			Version:   1,
+			PrevBlock: prevHash,
+			Timestamp: params.GenesisBlock.Header.Timestamp.Add(
+				time.Duration(i+1) * time.Minute),
+			Bits: params.PowLimitBits,
+		}
+		solveHeader(header, true)
+		headers = append(headers, header)
+		prevHash = header.BlockHash()
+	}
+	return headers
+}
+
+// TestHeadersPresync ensures headers are pre-synchronized up to the checkpoint
+// and the headers downloaded again must match them.
+func TestHeadersPresync(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	headers := testHeaderChain(1200)
+	lastHash := headers[len(headers)-1].BlockHash()
+	checkpoint := &chaincfg.Checkpoint{Height: 1200, Hash: &lastHash}
+	newPresync := func() *headersPresync {
+		return newHeadersPresync(params, checkpoint, params.GenesisHash,
+			0, params.PowLimitBits)
+	}
+
+	// The headers reach the checkpoint in the last batch.
+	p := newPresync()
+	for i := 0; i < len(headers); i += 500 {
+		end := i + 500
+		if end > len(headers) {
+			end = len(headers)
+		}
+		complete, err := p.processHeaders(headers[i:end])
+		if err != nil {
+			t.Fatalf("processHeaders: %v", err)
+		}
+		if complete != (end == len(headers)) {
+			t.Fatalf("complete %v after %d headers", complete, end)
+		}
+	}
+	wantWork := blockchain.CalcWork(params.PowLimitBits)
+	wantWork.Mul(wantWork, big.NewInt(int64(len(headers))))
+	if p.work.Cmp(wantWork) != 0 {
+		t.Fatalf("cumulative work %v, want %v", p.work, wantWork)
+	}
+	if len(p.commitments) != 2 {
+		t.Fatalf("got %d commitments, want 2", len(p.commitments))
+	}
+
+	// The headers downloaded again must match the commitments.
+	for i, header := range headers {
+		hash := header.BlockHash()
+		if err := p.verify(int32(i+1), &hash); err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+	}
+	otherHash := chainhash.Hash{0x01}
+	if err := p.verify(500, &otherHash); err == nil {
+		t.Fatal("verify accepted a different header")
+	}
+	if err := p.verify(1500, &otherHash); err == nil {
+		t.Fatal("verify accepted a header past the checkpoint")
+	}
+
+	// Headers which do not connect, have invalid proof of work, or do not
+	// match the checkpoint are rejected.
+	p = newPresync()
+	if _, err := p.processHeaders(headers[1:]); err == nil {
+		t.Fatal("processHeaders accepted headers which do not connect")
+	}
+
+	invalid := *headers[0]
+	solveHeader(&invalid, false)
+	p = newPresync()
+	if _, err := p.processHeaders([]*wire.BlockHeader{&invalid}); err == nil {
+		t.Fatal("processHeaders accepted invalid proof of work")
+	}
+
+	otherCheckpoint := &chaincfg.Checkpoint{Height: 1200, Hash: &otherHash}
+	p = newHeadersPresync(params, otherCheckpoint, params.GenesisHash, 0,
+		params.PowLimitBits)
+	if _, err := p.processHeaders(headers); err == nil {
+		t.Fatal("processHeaders accepted headers not matching the " +
+			"checkpoint")
+	}
+}
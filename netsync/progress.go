@@ -0,0 +1,207 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+const (
+	// syncProgressInterval is the interval at which the sync progress is
+	// published to the subscribers.
+	syncProgressInterval = 2 * time.Second
+
+	// syncRateSmoothing is the weight of the latest sample in the moving
+	// average of the rate blocks are connected at.
+	syncRateSmoothing = 0.2
+)
+
+// SyncProgress describes the progress of the synchronization of the chain with
+// the network at a point in time.
+type SyncProgress struct {
+	// Time is the time the progress was sampled at.
+	Time time.Time
+
+	// HeadersHeight is the height of the best known header, which is ahead
+	// of the best block in headers-first mode.
+	HeadersHeight int32
+
+	// PresyncHeight is the height of the last header pre-synchronized up
+	// to the next checkpoint.  It is zero when headers are not being
+	// pre-synchronized.
+	PresyncHeight int32
+
+	// BlockHeight and BlockHash identify the best block of the chain.
+	BlockHeight int32
+	BlockHash   chainhash.Hash
+
+	// TargetHeight is the height of the best block announced by the sync
+	// peer, or by the best sync candidate when there is no sync peer.  It
+	// is never below the height of the best block.
+	TargetHeight int32
+
+	// Progress is an estimate of the fraction of the chain up to the
+	// target height which has been verified in the range [0, 1].
+	Progress float64
+
+	// SyncPeerID and SyncPeerAddr identify the current sync peer.  The ID
+	// is zero and the address empty when there is no sync peer.
+	SyncPeerID   int32
+	SyncPeerAddr string
+
+	// BlocksPerSecond is the moving average of the rate blocks are
+	// connected at.
+	BlocksPerSecond float64
+
+	// ETA is the estimated time remaining until the target height is
+	// reached.  It is zero when the chain is current or the rate blocks
+	// are connected at is unknown.
+	ETA time.Duration
+
+	// Current reports whether the sync manager believes the chain is
+	// current as compared to the rest of the network.
+	Current bool
+}
+
+// ProgressSubscription is a subscription to the sync progress published by the
+// sync manager.  The progress is delivered on C.  A subscriber which falls
+// behind only receives the latest progress, so the sync manager is never
+// blocked by slow subscribers.
+type ProgressSubscription struct {
+	// C delivers the published sync progress.  It is closed when the
+	// subscription is cancelled.
+	C <-chan *SyncProgress
+
+	c         chan *SyncProgress
+	publisher *progressPublisher
+}
+
+// Unsubscribe cancels the subscription and closes its channel.  It is safe to
+// call it more than once.
+func (s *ProgressSubscription) Unsubscribe() {
+	s.publisher.unsubscribe(s)
+}
+
+// progressPublisher holds the latest sync progress and publishes new progress
+// to the subscribers.  It is safe for concurrent access.
+type progressPublisher struct {
+	mtx         sync.Mutex
+	latest      *SyncProgress
+	subscribers map[*ProgressSubscription]struct{}
+}
+
+// newProgressPublisher returns a new progress publisher without subscribers.
+func newProgressPublisher() *progressPublisher {
+	return &progressPublisher{
+		subscribers: make(map[*ProgressSubscription]struct{}),
+	}
+}
+
+// subscribe returns a new subscription which immediately receives the latest
+// progress, if any.
+func (p *progressPublisher) subscribe() *ProgressSubscription {
+	c := make(chan *SyncProgress, 1)
+	sub := &ProgressSubscription{C: c, c: c, publisher: p}
+
+	p.mtx.Lock()
+	p.subscribers[sub] = struct{}{}
+	if p.latest != nil {
+		c <- p.latest
+	}
+	p.mtx.Unlock()
+	return sub
+}
+
+// unsubscribe removes the passed subscription and closes its channel.
+func (p *progressPublisher) unsubscribe(sub *ProgressSubscription) {
+	p.mtx.Lock()
+	if _, ok := p.subscribers[sub]; ok {
+		delete(p.subscribers, sub)
+		close(sub.c)
+	}
+	p.mtx.Unlock()
+}
+
+// publish records the passed progress as the latest one and delivers it to
+// all subscribers, replacing any progress a subscriber did not receive yet.
+func (p *progressPublisher) publish(progress *SyncProgress) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.latest = progress
+	for sub := range p.subscribers {
+		select {
+		case <-sub.c:
+		default:
+		}
+		sub.c <- progress
+	}
+}
+
+// latestProgress returns the latest published progress or nil when none was
+// published yet.
+func (p *progressPublisher) latestProgress() *SyncProgress {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.latest
+}
+
+// syncRate tracks the moving average of the rate blocks are connected at.
+//
+// It is not safe for concurrent access.  It is only used from the blockHandler
+// goroutine of the sync manager.
+type syncRate struct {
+	lastTime   time.Time
+	lastHeight int32
+	rate       float64
+}
+
+// update adds a sample of the passed height of the best block at the passed
+// time and returns the updated rate in blocks per second.  The rate decays
+// towards zero while no blocks are connected.  Reorganizations to lower heights
+// restart the measurement.
+func (r *syncRate) update(height int32, now time.Time) float64 {
+	if r.lastTime.IsZero() || height < r.lastHeight {
+		r.lastTime, r.lastHeight, r.rate = now, height, 0
+		return r.rate
+	}
+
+	elapsed := now.Sub(r.lastTime).Seconds()
+	if elapsed <= 0 {
+		return r.rate
+	}
+	sample := float64(height-r.lastHeight) / elapsed
+	if r.rate == 0 {
+		r.rate = sample
+	} else {
+		r.rate += syncRateSmoothing * (sample - r.rate)
+	}
+	r.lastTime, r.lastHeight = now, height
+	return r.rate
+}
+
+// estimateProgress returns the fraction of the chain up to the passed target
+// height which is verified at the passed block height along with the estimated
+// time remaining at the passed rate in blocks per second.  The time remaining
+// is zero when the target is reached or the rate is unknown.
+func estimateProgress(blockHeight, targetHeight int32, rate float64) (float64, time.Duration) {
+	if targetHeight <= 0 || blockHeight >= targetHeight {
+		return 1, 0
+	}
+	progress := float64(blockHeight) / float64(targetHeight)
+	if blockHeight < 0 {
+		progress = 0
+	}
+
+	var eta time.Duration
+	if rate > 0 {
+		remaining := float64(targetHeight - blockHeight)
+		eta = time.Duration(remaining / rate * float64(time.Second))
+	}
+	return progress, eta
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+)
+
+// TestProgressPublisher ensures subscribers receive the latest progress without
+// blocking the publisher and subscriptions can be cancelled.
+func TestProgressPublisher(t *testing.T) {
+	p := newProgressPublisher()
+	if p.latestProgress() != nil {
+		t.Fatal("progress before the first publication")
+	}
+
+	// A subscriber which does not keep up only receives the latest
+	// progress.
+	sub := p.subscribe()
+	first, second := &SyncProgress{BlockHeight: 1}, &SyncProgress{BlockHeight: 2}
+	p.publish(first)
+	p.publish(second)
+	if got := <-sub.C; got != second {
+		t.Fatalf("received height %d, want 2", got.BlockHeight)
+	}
+
+	// New subscribers receive the latest progress right away.
+	late := p.subscribe()
+	if got := <-late.C; got != second || p.latestProgress() != second {
+		t.Fatal("latest progress not delivered to new subscriber")
+	}
+
+	// Cancelled subscriptions are closed and no longer receive progress.
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	if _, ok := <-sub.C; ok {
+		t.Fatal("cancelled subscription not closed")
+	}
+	p.publish(first)
+	if got := <-late.C; got != first {
+		t.Fatal("progress not delivered after cancellation of another " +
+			"subscription")
+	}
+	late.Unsubscribe()
+}
+
+// TestSyncRateEstimate ensures the rate blocks are connected at is averaged
+// and the progress and remaining time are estimated from it.
+func TestSyncRateEstimate(t *testing.T) {
+	var r syncRate
+	start := time.Unix(1000, 0)
+	if rate := r.update(100, start); rate != 0 {
+		t.Fatalf("rate %v without samples, want 0", rate)
+	}
+	if rate := r.update(200, start.Add(10*time.Second)); rate != 10 {
+		t.Fatalf("rate %v, want 10", rate)
+	}
+	if rate := r.update(200, start.Add(20*time.Second)); rate != 8 {
+		t.Fatalf("rate %v after no progress, want 8", rate)
+	}
+	if rate := r.update(150, start.Add(30*time.Second)); rate != 0 {
+		t.Fatalf("rate %v after reorganization, want 0", rate)
+	}
+
+	progress, eta := estimateProgress(200, 1000, 8)
+	if progress != 0.2 || eta != 100*time.Second {
+		t.Fatalf("estimated %v with %v remaining, want 0.2 with 100s",
+			progress, eta)
+	}
+	if progress, eta := estimateProgress(200, 1000, 0); progress != 0.2 || eta != 0 {
+		t.Fatalf("estimated %v with %v remaining at unknown rate",
+			progress, eta)
+	}
+	if progress, eta := estimateProgress(1000, 1000, 8); progress != 1 || eta != 0 {
+		t.Fatalf("estimated %v with %v remaining at target", progress,
+			eta)
+	}
+}
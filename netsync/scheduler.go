@@ -0,0 +1,338 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+)
+
+const (
+	// blockDownloadWindow is the maximum number of blocks, starting with
+	// the next block to be connected, which are downloaded in parallel in
+	// headers-first mode.  Since blocks which arrive ahead of the ones
+	// before them are buffered in memory until they can be connected, it
+	// also bounds the memory used by the download.
+	blockDownloadWindow = 256
+
+	// maxInFlightBlocksPerPeer is the maximum number of blocks requested
+	// from a single peer at a time in headers-first mode.
+	maxInFlightBlocksPerPeer = 64
+
+	// minInFlightBlocksPerPeer is the number of blocks a peer is allowed to
+	// have in flight regardless of how slow it is.
+	minInFlightBlocksPerPeer = 1
+
+	// initialInFlightBlocksPerPeer is the number of blocks a peer is
+	// allowed to have in flight before its throughput was measured.
+	initialInFlightBlocksPerPeer = 16
+
+	// inFlightTarget is the time it should take a peer to deliver all of
+	// the blocks it has in flight at its measured throughput.  The number
+	// of blocks requested from a peer is sized accordingly, so fast peers
+	// have enough blocks in flight to stay busy while slow peers are not
+	// handed more blocks than they can deliver before they would be
+	// considered to stall the download.
+	inFlightTarget = 2 * time.Second
+
+	// throughputWeight is the weight of a new sample in the exponentially
+	// weighted moving averages of the throughput of the peers and the size
+	// of the blocks.
+	throughputWeight = 0.25
+
+	// minBlockStallTimeout is the initial time a peer is given to deliver
+	// the next block to be connected while other peers deliver the blocks
+	// after it before it is considered to stall the download.
+	minBlockStallTimeout = 2 * time.Second
+
+	// maxBlockStallTimeout is the maximum the block stall timeout grows to
+	// when the network is slow enough for peers to stall repeatedly.
+	maxBlockStallTimeout = 64 * time.Second
+
+	// blockStallCheckInterval is the interval at which the parallel block
+	// download is checked for peers which stall it.
+	blockStallCheckInterval = time.Second
+)
+
+// downloadPeer is a peer blocks may be downloaded from along with the height of
+// the best block it is known to have.
+type downloadPeer struct {
+	peer   *peerpkg.Peer
+	height int32
+}
+
+// blockRequest is a block which was requested from a peer.
+type blockRequest struct {
+	peer *peerpkg.Peer
+	sent time.Time
+}
+
+// peerThroughput tracks the sustained rate at which a peer delivers the blocks
+// requested from it.
+type peerThroughput struct {
+	// bytesPerSec is the moving average of the throughput of the peer.  It
+	// is zero until the first block from the peer arrived.
+	bytesPerSec float64
+
+	// lastDelivery is the time the last block from the peer arrived.
+	lastDelivery time.Time
+}
+
+// blockScheduler schedules the download of the blocks of headers-first mode
+// from multiple peers in parallel.  The blocks within a window starting with
+// the next block to be connected are spread across the peers which have them,
+// with a limit on the blocks in flight per peer which is sized according to
+// the measured throughput of the peer.  Blocks which arrive out of order are
+// buffered until the blocks before them arrived, and a peer which holds back
+// the next block to be connected while the other peers deliver the blocks
+// after it is reported as stalling so its blocks can be reassigned.
+//
+// The scheduler is not safe for concurrent access.  It is only used from the
+// blockHandler goroutine of the sync manager.
+type blockScheduler struct {
+	window       int
+	maxPerPeer   int
+	stallTimeout time.Duration
+	requests     map[chainhash.Hash]*blockRequest
+	inFlight     map[*peerpkg.Peer]int
+	downloaded   map[chainhash.Hash]*blockMsg
+
+	// throughput holds the measured throughput of the peers and
+	// avgBlockSize the moving average of the size of the downloaded
+	// blocks.  They are kept across resets since they describe the peers
+	// rather than the download.
+	throughput   map[*peerpkg.Peer]*peerThroughput
+	avgBlockSize float64
+}
+
+// newBlockScheduler returns a block scheduler which downloads at most window
+// blocks at a time with at most maxPerPeer of them in flight per peer.
+func newBlockScheduler(window, maxPerPeer int) *blockScheduler {
+	s := &blockScheduler{
+		window:     window,
+		maxPerPeer: maxPerPeer,
+		throughput: make(map[*peerpkg.Peer]*peerThroughput),
+	}
+	s.reset()
+	return s
+}
+
+// reset forgets all requested and buffered blocks.  It is used when the
+// headers-first state is reset in preparation for a new sync peer.
+func (s *blockScheduler) reset() {
+	s.stallTimeout = minBlockStallTimeout
+	s.requests = make(map[chainhash.Hash]*blockRequest)
+	s.inFlight = make(map[*peerpkg.Peer]int)
+	s.downloaded = make(map[chainhash.Hash]*blockMsg)
+}
+
+// delivered forgets the request of the block with the passed hash regardless of
+// the peer it was requested from and updates the throughput of the peer with
+// the passed size of the block which arrived at the passed time.  It returns
+// whether the block was requested by the scheduler.
+func (s *blockScheduler) delivered(hash *chainhash.Hash, size int, now time.Time) bool {
+	req, ok := s.requests[*hash]
+	if !ok {
+		return false
+	}
+	s.removeRequest(hash, req.peer)
+	s.recordDelivery(req, size, now)
+	return true
+}
+
+// recordDelivery updates the throughput of the peer the passed request was
+// sent to with the passed size of the requested block which arrived at the
+// passed time.  Since the blocks in flight are delivered one after the other,
+// the time the block took is measured from the later of the time it was
+// requested and the time the previous block from the peer arrived.
+func (s *blockScheduler) recordDelivery(req *blockRequest, size int, now time.Time) {
+	if s.avgBlockSize == 0 {
+		s.avgBlockSize = float64(size)
+	} else {
+		s.avgBlockSize += throughputWeight * (float64(size) - s.avgBlockSize)
+	}
+
+	tp, ok := s.throughput[req.peer]
+	if !ok {
+		tp = new(peerThroughput)
+		s.throughput[req.peer] = tp
+	}
+	start := req.sent
+	if tp.lastDelivery.After(start) {
+		start = tp.lastDelivery
+	}
+	tp.lastDelivery = now
+
+	// Treat blocks which arrived within the same millisecond as taking a
+	// millisecond so the rate stays finite.
+	elapsed := now.Sub(start)
+	if elapsed < time.Millisecond {
+		elapsed = time.Millisecond
+	}
+	rate := float64(size) / elapsed.Seconds()
+	if tp.bytesPerSec == 0 {
+		tp.bytesPerSec = rate
+	} else {
+		tp.bytesPerSec += throughputWeight * (rate - tp.bytesPerSec)
+	}
+}
+
+// peerLimit returns the maximum number of blocks which may be in flight from
+// the passed peer.  It is the number of blocks of the average size the peer
+// delivers within the in flight target at its measured throughput, limited to
+// the per peer maximum.
+func (s *blockScheduler) peerLimit(peer *peerpkg.Peer) int {
+	tp, ok := s.throughput[peer]
+	if !ok || tp.bytesPerSec == 0 || s.avgBlockSize == 0 {
+		if initialInFlightBlocksPerPeer < s.maxPerPeer {
+			return initialInFlightBlocksPerPeer
+		}
+		return s.maxPerPeer
+	}
+
+	limit := int(tp.bytesPerSec * inFlightTarget.Seconds() / s.avgBlockSize)
+	if limit < minInFlightBlocksPerPeer {
+		limit = minInFlightBlocksPerPeer
+	}
+	if limit > s.maxPerPeer {
+		limit = s.maxPerPeer
+	}
+	return limit
+}
+
+// removeRequest forgets the request of the block with the passed hash when it
+// was requested from the passed peer, so the block is scheduled again unless
+// it was delivered.
+func (s *blockScheduler) removeRequest(hash *chainhash.Hash, peer *peerpkg.Peer) {
+	req, ok := s.requests[*hash]
+	if !ok || req.peer != peer {
+		return
+	}
+	delete(s.requests, *hash)
+	s.inFlight[peer]--
+	if s.inFlight[peer] <= 0 {
+		delete(s.inFlight, peer)
+	}
+}
+
+// removePeer forgets the throughput of the passed peer along with all requests
+// of blocks from it so they are scheduled again from other peers.
+func (s *blockScheduler) removePeer(peer *peerpkg.Peer) {
+	delete(s.throughput, peer)
+	if s.inFlight[peer] == 0 {
+		return
+	}
+	for hash, req := range s.requests {
+		if req.peer == peer {
+			delete(s.requests, hash)
+		}
+	}
+	delete(s.inFlight, peer)
+}
+
+// buffer holds the passed block which arrived ahead of the blocks before it
+// until it can be connected.
+func (s *blockScheduler) buffer(bmsg *blockMsg) {
+	s.downloaded[*bmsg.block.Hash()] = bmsg
+}
+
+// take removes and returns the buffered block with the passed hash.  It
+// returns nil when the block was not buffered.
+func (s *blockScheduler) take(hash *chainhash.Hash) *blockMsg {
+	bmsg, ok := s.downloaded[*hash]
+	if !ok {
+		return nil
+	}
+	delete(s.downloaded, *hash)
+	return bmsg
+}
+
+// blockConnected records that a block downloaded by the scheduler was
+// connected and gradually shrinks the stall timeout back towards its minimum
+// while the download makes progress.
+func (s *blockScheduler) blockConnected() {
+	s.stallTimeout = s.stallTimeout * 85 / 100
+	if s.stallTimeout < minBlockStallTimeout {
+		s.stallTimeout = minBlockStallTimeout
+	}
+}
+
+// schedule assigns the blocks of the passed list of headers within the download
+// window which are neither requested, buffered, nor already known according to
+// the have function to the passed peers.  Each block is assigned to the peer
+// with the fewest blocks in flight relative to its limit among the ones which
+// have it and did not reach their limit, which favors the peers expected to
+// deliver it first.  The front of the list must be the next block to be
+// connected.  The assigned blocks are recorded as requested at the passed time
+// and returned by peer in the order of the list.
+func (s *blockScheduler) schedule(headers *list.List, peers []downloadPeer,
+	have func(*chainhash.Hash) bool, now time.Time) map[*peerpkg.Peer][]*chainhash.Hash {
+
+	limits := make(map[*peerpkg.Peer]int, len(peers))
+	for _, p := range peers {
+		limits[p.peer] = s.peerLimit(p.peer)
+	}
+
+	assigned := make(map[*peerpkg.Peer][]*chainhash.Hash)
+	i := 0
+	for e := headers.Front(); e != nil && i < s.window; e = e.Next() {
+		i++
+		node := e.Value.(*headerNode)
+		if _, ok := s.requests[*node.hash]; ok {
+			continue
+		}
+		if _, ok := s.downloaded[*node.hash]; ok {
+			continue
+		}
+
+		// Choose the least loaded peer which has the block.  Since the
+		// heights of the headers increase along the list, there is
+		// nothing left to assign when no peer can take the block.
+		var best *peerpkg.Peer
+		bestInFlight, bestLimit := 1, 1
+		for _, p := range peers {
+			if p.height < node.height {
+				continue
+			}
+			n, limit := s.inFlight[p.peer], limits[p.peer]
+			if n < limit && n*bestLimit < bestInFlight*limit {
+				best, bestInFlight, bestLimit = p.peer, n, limit
+			}
+		}
+		if best == nil {
+			break
+		}
+
+		if have(node.hash) {
+			continue
+		}
+		s.requests[*node.hash] = &blockRequest{peer: best, sent: now}
+		s.inFlight[best]++
+		assigned[best] = append(assigned[best], node.hash)
+	}
+	return assigned
+}
+
+// stalledPeer returns the peer which stalls the download as of the passed time
+// by holding back the block with the passed hash, which must be the next block
+// to be connected, for longer than the stall timeout while blocks after it
+// were already delivered.  The stall timeout is doubled each time a peer is
+// reported so the download does not drop peers one after the other on a slow
+// network.  It returns nil when the download is not stalled.
+func (s *blockScheduler) stalledPeer(next *chainhash.Hash, now time.Time) *peerpkg.Peer {
+	req, ok := s.requests[*next]
+	if !ok || len(s.downloaded) == 0 || now.Sub(req.sent) <= s.stallTimeout {
+		return nil
+	}
+
+	s.stallTimeout *= 2
+	if s.stallTimeout > maxBlockStallTimeout {
+		s.stallTimeout = maxBlockStallTimeout
+	}
+	return req.peer
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"container/list"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testHeaderList returns a list of headers for the blocks at heights 1 through
+// n along with the blocks, whose hashes the headers refer to.
+func testHeaderList(n int) (*list.List, []*btcutil.Block) {
+	headers := list.New()
+	blocks := make([]*btcutil.Block, 0, n)
+	for i := 1; i <= n; i++ {
+		block := btcutil.NewBlock(wire.NewMsgBlock(&wire.BlockHeader{
+			Nonce: uint32(i),
+		}))
+		headers.PushBack(&headerNode{height: int32(i), hash: block.Hash()})
+		blocks = append(blocks, block)
+	}
+	return headers, blocks
+}
+
+// TestBlockScheduler ensures the block scheduler spreads the blocks within the
+// download window across the peers which have them, respects the per peer
+// limit, buffers blocks, and reassigns the blocks of removed peers.
+func TestBlockScheduler(t *testing.T) {
+	headers, blocks := testHeaderList(20)
+	s := newBlockScheduler(10, 4)
+
+	peerA, peerB, peerC := new(peerpkg.Peer), new(peerpkg.Peer),
+		new(peerpkg.Peer)
+	peers := []downloadPeer{
+		{peer: peerC, height: 3},
+		{peer: peerA, height: 20},
+		{peer: peerB, height: 20},
+	}
+	have := func(hash *chainhash.Hash) bool {
+		return hash.IsEqual(blocks[1].Hash())
+	}
+	now := time.Unix(1000, 0)
+
+	// The first ten headers are in the window.  The second block is known
+	// already and the third peer only has the first three blocks.
+	assigned := s.schedule(headers, peers, have, now)
+	if n := len(assigned[peerA]) + len(assigned[peerB]) +
+		len(assigned[peerC]); n != 9 {
+		t.Fatalf("assigned %d blocks, want 9", n)
+	}
+	if len(assigned[peerC]) != 1 || !assigned[peerC][0].IsEqual(blocks[0].Hash()) {
+		t.Fatalf("unexpected blocks assigned to third peer: %v",
+			assigned[peerC])
+	}
+	if len(assigned[peerA]) != 4 || len(assigned[peerB]) != 4 {
+		t.Fatalf("per peer limit not respected: %d, %d",
+			len(assigned[peerA]), len(assigned[peerB]))
+	}
+	if _, ok := s.requests[*blocks[1].Hash()]; ok {
+		t.Fatal("known block was requested")
+	}
+
+	// Nothing is assigned while the peers are at their limits.
+	if assigned := s.schedule(headers, peers, have, now); len(assigned) != 0 {
+		t.Fatalf("assigned blocks to busy peers: %v", assigned)
+	}
+
+	// A delivered block which is buffered is not assigned again, while the
+	// slot it freed up is used for the next block in the window.
+	last := assigned[peerA][len(assigned[peerA])-1]
+	if !s.delivered(last, 1000, now) || s.delivered(last, 1000, now) {
+		t.Fatal("unexpected delivery state")
+	}
+	bmsg := &blockMsg{block: blocks[8], peer: peerA}
+	s.buffer(bmsg)
+	if assigned := s.schedule(headers, peers, have, now); len(assigned) != 0 {
+		t.Fatalf("assigned blocks outside of the window: %v", assigned)
+	}
+
+	// Removing a peer reassigns its blocks to the least loaded peers.
+	s.removePeer(peerB)
+	assigned = s.schedule(headers, peers, have, now)
+	if len(assigned[peerA]) != 1 || len(assigned[peerB]) != 3 {
+		t.Fatalf("reassigned %d and %d blocks, want 1 and 3",
+			len(assigned[peerA]), len(assigned[peerB]))
+	}
+
+	if s.take(last) != bmsg || s.take(last) != nil {
+		t.Fatal("unexpected buffered block")
+	}
+}
+
+// TestBlockSchedulerStall ensures the peer which holds back the next block to be
+// connected while blocks after it were delivered is reported as stalling and
+// the stall timeout adapts.
+func TestBlockSchedulerStall(t *testing.T) {
+	headers, blocks := testHeaderList(4)
+	s := newBlockScheduler(4, 1)
+
+	peers := make([]downloadPeer, 0, 4)
+	for i := 0; i < 4; i++ {
+		peers = append(peers, downloadPeer{peer: new(peerpkg.Peer),
+			height: 4})
+	}
+	have := func(*chainhash.Hash) bool { return false }
+	start := time.Unix(1000, 0)
+	assigned := s.schedule(headers, peers, have, start)
+	if len(assigned) != 4 {
+		t.Fatalf("assigned blocks to %d peers, want 4", len(assigned))
+	}
+	var staller *peerpkg.Peer
+	for peer, hashes := range assigned {
+		if hashes[0].IsEqual(blocks[0].Hash()) {
+			staller = peer
+		}
+	}
+
+	// The download is not stalled until blocks after the next one arrived.
+	next := blocks[0].Hash()
+	late := start.Add(minBlockStallTimeout + time.Second)
+	if peer := s.stalledPeer(next, late); peer != nil {
+		t.Fatalf("stalled without delivered blocks")
+	}
+	s.delivered(blocks[1].Hash(), 1000, start)
+	s.buffer(&blockMsg{block: blocks[1]})
+	if peer := s.stalledPeer(next, start.Add(time.Second)); peer != nil {
+		t.Fatalf("stalled before the timeout")
+	}
+	if peer := s.stalledPeer(next, late); peer != staller {
+		t.Fatalf("stalling peer %p, want %p", peer, staller)
+	}
+	if s.stallTimeout != 2*minBlockStallTimeout {
+		t.Fatalf("stall timeout %v, want %v", s.stallTimeout,
+			2*minBlockStallTimeout)
+	}
+
+	// The stall timeout shrinks back as blocks are connected and is reset
+	// along with the scheduler.
+	for i := 0; i < 10; i++ {
+		s.blockConnected()
+	}
+	if s.stallTimeout != minBlockStallTimeout {
+		t.Fatalf("stall timeout %v, want %v", s.stallTimeout,
+			minBlockStallTimeout)
+	}
+	s.reset()
+	if len(s.requests) != 0 || len(s.inFlight) != 0 ||
+		len(s.downloaded) != 0 {
+
+		t.Fatal("scheduler state not reset")
+	}
+}
+
+// TestBlockSchedulerThroughput ensures the number of blocks in flight per peer
+// is sized according to the measured throughput of the peers.
+func TestBlockSchedulerThroughput(t *testing.T) {
+	headers, _ := testHeaderList(200)
+	s := newBlockScheduler(200, 32)
+
+	fast, slow, unknown := new(peerpkg.Peer), new(peerpkg.Peer),
+		new(peerpkg.Peer)
+	have := func(*chainhash.Hash) bool { return false }
+	start := time.Unix(1000, 0)
+
+	// Peers start out with the initial limit before their throughput is
+	// known.
+	if limit := s.peerLimit(unknown); limit != initialInFlightBlocksPerPeer {
+		t.Fatalf("initial limit %d, want %d", limit,
+			initialInFlightBlocksPerPeer)
+	}
+
+	// The fast peer delivers 100 KB blocks at 1 MB/s and the slow peer at
+	// 25 KB/s, so 20 and 0.5 blocks fit in the in flight target of the
+	// peers.
+	const blockSize = 100000
+	assigned := s.schedule(headers, []downloadPeer{
+		{peer: fast, height: 200},
+		{peer: slow, height: 200},
+	}, have, start)
+	for i, hash := range assigned[fast][:4] {
+		delivery := start.Add(time.Duration(i+1) * 100 * time.Millisecond)
+		if !s.delivered(hash, blockSize, delivery) {
+			t.Fatal("requested block not delivered")
+		}
+	}
+	if !s.delivered(assigned[slow][0], blockSize, start.Add(4*time.Second)) {
+		t.Fatal("requested block not delivered")
+	}
+	if limit := s.peerLimit(fast); limit != 20 {
+		t.Fatalf("fast peer limit %d, want 20", limit)
+	}
+	if limit := s.peerLimit(slow); limit != minInFlightBlocksPerPeer {
+		t.Fatalf("slow peer limit %d, want %d", limit,
+			minInFlightBlocksPerPeer)
+	}
+
+	// The fast peer receives enough blocks to stay busy while the slow peer
+	// only receives a single block at a time.
+	s.reset()
+	assigned = s.schedule(headers, []downloadPeer{
+		{peer: fast, height: 200},
+		{peer: slow, height: 200},
+		{peer: unknown, height: 200},
+	}, have, start)
+	if len(assigned[fast]) != 20 || len(assigned[slow]) != 1 ||
+		len(assigned[unknown]) != initialInFlightBlocksPerPeer {
+
+		t.Fatalf("assigned %d, %d and %d blocks, want 20, 1 and %d",
+			len(assigned[fast]), len(assigned[slow]),
+			len(assigned[unknown]), initialInFlightBlocksPerPeer)
+	}
+
+	// The throughput of removed peers is forgotten.
+	s.removePeer(fast)
+	if _, ok := s.throughput[fast]; ok {
+		t.Fatal("throughput of removed peer not forgotten")
+	}
+}
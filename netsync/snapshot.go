@@ -0,0 +1,119 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+)
+
+const (
+	// snapshotBlockRequestTimeout is the time a peer is given to deliver a
+	// block before the utxo snapshot which was requested from it before
+	// the block is requested again.
+	snapshotBlockRequestTimeout = 30 * time.Second
+
+	// snapshotFetchInterval is the interval at which the blocks before the
+	// utxo snapshot which still need to be validated are requested.
+	snapshotFetchInterval = 5 * time.Second
+
+	// maxSnapshotBlocksInFlight is the maximum number of blocks before the
+	// utxo snapshot which are requested or buffered at a time.
+	maxSnapshotBlocksInFlight = 64
+)
+
+// snapshotBlockRequest tracks the request of a block before the utxo snapshot.
+type snapshotBlockRequest struct {
+	peer *peerpkg.Peer
+	time time.Time
+}
+
+// snapshotFetcher tracks the download of the blocks before a loaded utxo
+// snapshot, which are validated in the background once the chain is current.
+// The blocks are requested from multiple peers in parallel and buffered until
+// the blocks before them were validated since they have to be validated in
+// order.
+//
+// The fetcher is not safe for concurrent access.  It is only used from the
+// blockHandler goroutine of the sync manager.
+type snapshotFetcher struct {
+	requests map[chainhash.Hash]*snapshotBlockRequest
+	blocks   map[chainhash.Hash]*blockMsg
+}
+
+// newSnapshotFetcher returns a new snapshot fetcher without any requests.
+func newSnapshotFetcher() *snapshotFetcher {
+	return &snapshotFetcher{
+		requests: make(map[chainhash.Hash]*snapshotBlockRequest),
+		blocks:   make(map[chainhash.Hash]*blockMsg),
+	}
+}
+
+// toRequest returns the hashes among the passed hashes of the next blocks to
+// be validated which need to be requested as of the passed time.  Blocks which
+// were delivered already or were requested within
+// snapshotBlockRequestTimeout are skipped.
+func (f *snapshotFetcher) toRequest(hashes []chainhash.Hash, now time.Time) []chainhash.Hash {
+	var needed []chainhash.Hash
+	for _, hash := range hashes {
+		if _, ok := f.blocks[hash]; ok {
+			continue
+		}
+		req, ok := f.requests[hash]
+		if ok && now.Sub(req.time) < snapshotBlockRequestTimeout {
+			continue
+		}
+		needed = append(needed, hash)
+	}
+	return needed
+}
+
+// requested records that the block with the passed hash was requested from the
+// passed peer at the passed time.
+func (f *snapshotFetcher) requested(hash *chainhash.Hash, peer *peerpkg.Peer, now time.Time) {
+	f.requests[*hash] = &snapshotBlockRequest{peer: peer, time: now}
+}
+
+// deliver buffers the passed block when it was requested by the fetcher from
+// the peer which sent it and reports whether it did.
+func (f *snapshotFetcher) deliver(bmsg *blockMsg) bool {
+	hash := bmsg.block.Hash()
+	req, ok := f.requests[*hash]
+	if !ok || req.peer != bmsg.peer {
+		return false
+	}
+	delete(f.requests, *hash)
+	f.blocks[*hash] = bmsg
+	return true
+}
+
+// take removes the buffered block with the passed hash from the fetcher and
+// returns it or nil when it was not delivered yet.
+func (f *snapshotFetcher) take(hash *chainhash.Hash) *blockMsg {
+	bmsg, ok := f.blocks[*hash]
+	if !ok {
+		return nil
+	}
+	delete(f.blocks, *hash)
+	return bmsg
+}
+
+// removePeer removes the requests of the passed peer so the blocks are
+// requested from other peers right away.
+func (f *snapshotFetcher) removePeer(peer *peerpkg.Peer) {
+	for hash, req := range f.requests {
+		if req.peer == peer {
+			delete(f.requests, hash)
+		}
+	}
+}
+
+// reset removes all of the requests and buffered blocks.
+func (f *snapshotFetcher) reset() {
+	f.requests = make(map[chainhash.Hash]*snapshotBlockRequest)
+	f.blocks = make(map[chainhash.Hash]*blockMsg)
+}
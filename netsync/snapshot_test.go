@@ -0,0 +1,78 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package netsync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	peerpkg "github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestSnapshotFetcher ensures the blocks before a utxo snapshot are requested
+// again once their request is overdue or the peer is gone, and only blocks
+// requested from the peer which sent them are buffered.
+func TestSnapshotFetcher(t *testing.T) {
+	fetcher := newSnapshotFetcher()
+	peer1, peer2 := new(peerpkg.Peer), new(peerpkg.Peer)
+	blocks := make([]*btcutil.Block, 3)
+	hashes := make([]chainhash.Hash, 3)
+	for i := range blocks {
+		blocks[i] = btcutil.NewBlock(&wire.MsgBlock{
+			Header: wire.BlockHeader{Nonce: uint32(i)},
+		})
+		hashes[i] = *blocks[i].Hash()
+	}
+	now := time.Unix(1000, 0)
+
+	// All blocks need to be requested at first.
+	if needed := fetcher.toRequest(hashes, now); len(needed) != 3 {
+		t.Fatalf("got %d blocks to request, want 3", len(needed))
+	}
+	fetcher.requested(&hashes[0], peer1, now)
+	fetcher.requested(&hashes[1], peer1, now)
+	fetcher.requested(&hashes[2], peer2, now)
+	if needed := fetcher.toRequest(hashes, now.Add(time.Second)); len(needed) != 0 {
+		t.Fatalf("got %d blocks to request before the requests were "+
+			"overdue", len(needed))
+	}
+
+	// Blocks are only accepted from the peer they were requested from.
+	if fetcher.deliver(&blockMsg{block: blocks[0], peer: peer2}) {
+		t.Fatal("accepted block from the wrong peer")
+	}
+	if !fetcher.deliver(&blockMsg{block: blocks[0], peer: peer1}) {
+		t.Fatal("did not accept requested block")
+	}
+
+	// The blocks of removed peers are requested again right away, while
+	// delivered blocks are not requested again.
+	fetcher.removePeer(peer1)
+	needed := fetcher.toRequest(hashes, now.Add(time.Second))
+	if len(needed) != 1 || needed[0] != hashes[1] {
+		t.Fatalf("unexpected blocks to request after removing peer: %v",
+			needed)
+	}
+	later := now.Add(snapshotBlockRequestTimeout)
+	if needed := fetcher.toRequest(hashes, later); len(needed) != 2 {
+		t.Fatalf("got %d blocks to request after the requests were "+
+			"overdue, want 2", len(needed))
+	}
+
+	// Delivered blocks are handed out once.
+	if bmsg := fetcher.take(&hashes[0]); bmsg == nil || bmsg.peer != peer1 {
+		t.Fatal("did not take delivered block")
+	}
+	if bmsg := fetcher.take(&hashes[0]); bmsg != nil {
+		t.Fatal("took delivered block twice")
+	}
+	fetcher.reset()
+	if len(fetcher.requests) != 0 || len(fetcher.blocks) != 0 {
+		t.Fatal("reset did not remove requests")
+	}
+}
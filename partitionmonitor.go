@@ -0,0 +1,358 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+const (
+	// partitionCheckInterval is the interval at which the partition monitor
+	// samples the outbound peers and the best block.
+	partitionCheckInterval = time.Minute
+
+	// partitionAlertRepeat is the interval at which an alert is raised again
+	// while the condition it describes still holds.
+	partitionAlertRepeat = time.Hour
+
+	// partitionWebhookTimeout is the maximum time to wait for a webhook to
+	// accept an alert.
+	partitionWebhookTimeout = 10 * time.Second
+
+	// partitionMinOutbound is the minimum number of outbound peers before
+	// their concentration in a single network group is alerted on.  Fewer
+	// peers are normal while the node is starting up.
+	partitionMinOutbound = 3
+
+	// partitionMinGroupsBeforeDrop is the minimum number of distinct network
+	// groups of the outbound peers before a drop in their number is
+	// considered a sudden loss of diversity.
+	partitionMinGroupsBeforeDrop = 4
+
+	// partitionStaleTipBlocks is the number of target block intervals
+	// without a new block after which the tip is considered stale.  Since
+	// blocks are found by a Poisson process, the probability of such a gap
+	// occurring by chance is e^-12, or about once in 160,000 blocks.
+	partitionStaleTipBlocks = 12
+)
+
+// Kinds of partition alerts.
+const (
+	partitionAlertConcentration = "netgroup-concentration"
+	partitionAlertStaleTip      = "stale-tip"
+	partitionAlertDiversityLoss = "outbound-diversity-loss"
+)
+
+// Severities of partition alerts.
+const (
+	partitionSeverityWarning  = "warning"
+	partitionSeverityCritical = "critical"
+)
+
+// partitionRemediations are the remediations suggested for each kind of
+// partition alert.
+var partitionRemediations = map[string]string{
+	partitionAlertConcentration: "Connect to trusted peers in other " +
+		"networks with the addnode RPC or --addpeer, check whether the " +
+		"known addresses are dominated by a single network (consider " +
+		"--asmap), and verify the best block against an independent source.",
+	partitionAlertStaleTip: "Compare the best block with an independent " +
+		"source such as a trusted node, check the outbound peers with " +
+		"getpeerinfo for a shared network, and connect to trusted peers " +
+		"with the addnode RPC.",
+	partitionAlertDiversityLoss: "Check getpeerinfo for the remaining " +
+		"outbound peers, look for local network problems or an attack " +
+		"forcing the disconnections, and connect to trusted peers with " +
+		"the addnode RPC.",
+}
+
+// partitionMonitor periodically checks for conditions which suggest the node
+// is partitioned from the rest of the network or eclipsed by its peers:
+//
+//   - all outbound peers are in the same network group, or AS when an asmap is
+//     configured
+//   - no new block for far longer than expected from the target block interval
+//   - a sudden loss of most of the distinct network groups of the outbound
+//     peers
+//
+// Alerts are raised when a condition starts to hold, repeated while it holds,
+// and resolved once it no longer does.  They are logged, sent to the websocket
+// clients registered for them, and posted to the configured webhooks.
+type partitionMonitor struct {
+	params   *chaincfg.Params
+	webhooks []string
+	client   *http.Client
+
+	// checkPeers is false when the peers are chosen by the operator, in
+	// which case their network groups are not alerted on.
+	checkPeers bool
+
+	// The following functions report the state of the node and deliver
+	// alerts.  They query the server by default, but are exposed here to
+	// allow the tests to replace them.
+	outboundGroups func() map[string]int
+	bestTime       func() (time.Time, error)
+	isCurrent      func() bool
+	notify         func(*btcjson.PartitionAlert)
+	now            func() time.Time
+
+	// The following fields are only accessed by the monitor goroutine.
+	raised       map[string]time.Time
+	wasCurrent   bool
+	prevGroups   int
+	groupsBefore int
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newPartitionMonitor returns a partition monitor for the passed server which
+// posts alerts to the passed webhooks.
+func newPartitionMonitor(s *server, webhooks []string) *partitionMonitor {
+	m := &partitionMonitor{
+		params:     s.chainParams,
+		webhooks:   webhooks,
+		client:     &http.Client{Timeout: partitionWebhookTimeout},
+		checkPeers: len(cfg.ConnectPeers) == 0,
+		outboundGroups: func() map[string]int {
+			replyChan := make(chan map[string]int, 1)
+			select {
+			case s.query <- getOutboundGroupsMsg{reply: replyChan}:
+			case <-s.quit:
+				return nil
+			}
+			return <-replyChan
+		},
+		bestTime: func() (time.Time, error) {
+			best := s.chain.BestSnapshot()
+			header, err := s.chain.HeaderByHash(&best.Hash)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return header.Timestamp, nil
+		},
+		isCurrent: func() bool {
+			return s.syncManager.IsCurrent()
+		},
+		notify: func(alert *btcjson.PartitionAlert) {
+			if s.rpcServer != nil {
+				s.rpcServer.ntfnMgr.NotifyPartitionAlert(alert)
+			}
+		},
+		now:    time.Now,
+		raised: make(map[string]time.Time),
+		quit:   make(chan struct{}),
+	}
+	return m
+}
+
+// Start begins monitoring for partitions.
+func (m *partitionMonitor) Start() {
+	m.wg.Add(1)
+	go m.monitorHandler()
+}
+
+// Stop stops monitoring for partitions and waits for the pending webhooks to
+// finish.
+func (m *partitionMonitor) Stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+
+// monitorHandler checks for partitions at every interval and delivers the
+// resulting alerts.  It must be run as a goroutine.
+func (m *partitionMonitor) monitorHandler() {
+	ticker := time.NewTicker(partitionCheckInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			for _, alert := range m.check() {
+				m.deliver(alert)
+			}
+
+		case <-m.quit:
+			break out
+		}
+	}
+	m.wg.Done()
+}
+
+// update raises or resolves the alert of the passed kind depending on whether
+// its condition holds and appends the resulting alert, if any, to the passed
+// alerts.  An alert whose condition still holds is raised again once the
+// repeat interval has passed.
+func (m *partitionMonitor) update(alerts []btcjson.PartitionAlert, kind string,
+	holds bool, severity, detail string, now time.Time) []btcjson.PartitionAlert {
+
+	lastRaised, active := m.raised[kind]
+	switch {
+	case holds && (!active || now.Sub(lastRaised) >= partitionAlertRepeat):
+		m.raised[kind] = now
+		return append(alerts, btcjson.PartitionAlert{
+			Kind:        kind,
+			Severity:    severity,
+			Time:        now.Unix(),
+			Detail:      detail,
+			Remediation: partitionRemediations[kind],
+		})
+
+	case !holds && active:
+		delete(m.raised, kind)
+		return append(alerts, btcjson.PartitionAlert{
+			Kind:     kind,
+			Severity: severity,
+			Time:     now.Unix(),
+			Detail:   detail,
+			Resolved: true,
+		})
+	}
+	return alerts
+}
+
+// check samples the state of the node and returns the alerts which are raised
+// or resolved as a result.
+func (m *partitionMonitor) check() []btcjson.PartitionAlert {
+	now := m.now()
+	var alerts []btcjson.PartitionAlert
+
+	if m.checkPeers {
+		groups := m.outboundGroups()
+		var numPeers int
+		keys := make([]string, 0, len(groups))
+		for key, count := range groups {
+			numPeers += count
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		// Alert when all of the outbound peers are in the same network
+		// group.
+		concentrated := numPeers >= partitionMinOutbound && len(keys) == 1
+		detail := fmt.Sprintf("%d outbound peers are in %d network "+
+			"groups", numPeers, len(keys))
+		if concentrated {
+			detail = fmt.Sprintf("all %d outbound peers are in "+
+				"network group %s", numPeers, keys[0])
+		}
+		alerts = m.update(alerts, partitionAlertConcentration,
+			concentrated, partitionSeverityWarning, detail, now)
+
+		// Alert when most of the distinct network groups of the
+		// outbound peers were lost since the previous sample.  The
+		// alert is resolved once more than half of the groups from
+		// before the drop are regained.
+		if m.prevGroups >= partitionMinGroupsBeforeDrop &&
+			len(keys)*2 <= m.prevGroups {
+
+			m.groupsBefore = m.prevGroups
+		}
+		lost := m.groupsBefore > 0 && len(keys)*2 <= m.groupsBefore
+		detail = fmt.Sprintf("outbound peers are in %d network groups",
+			len(keys))
+		if lost {
+			detail = fmt.Sprintf("outbound peers dropped from %d to "+
+				"%d network groups (%s)", m.groupsBefore, len(keys),
+				strings.Join(keys, ", "))
+		} else {
+			m.groupsBefore = 0
+		}
+		alerts = m.update(alerts, partitionAlertDiversityLoss, lost,
+			partitionSeverityWarning, detail, now)
+		m.prevGroups = len(keys)
+	}
+
+	// Alert when no block was received for far longer than expected from
+	// the target block interval.  This is only done once the node has been
+	// current since the tip is naturally old while syncing, and not on
+	// networks where blocks are only generated on demand.
+	if m.isCurrent() {
+		m.wasCurrent = true
+	}
+	if m.wasCurrent && !m.params.GenerateSupported {
+		tipTime, err := m.bestTime()
+		if err != nil {
+			return alerts
+		}
+		age := now.Sub(tipTime)
+		target := m.params.TargetTimePerBlock
+		stale := age >= target*partitionStaleTipBlocks
+		detail := fmt.Sprintf("the best block is %v old", age.Round(
+			time.Second))
+		if stale {
+			prob := math.Exp(-float64(age) / float64(target))
+			detail = fmt.Sprintf("no new block for %v, which happens "+
+				"by chance with probability %.2g given the target "+
+				"block interval of %v", age.Round(time.Second),
+				prob, target)
+		}
+		alerts = m.update(alerts, partitionAlertStaleTip, stale,
+			partitionSeverityCritical, detail, now)
+	}
+
+	return alerts
+}
+
+// deliver logs the passed alert, sends it to the registered websocket clients
+// and posts it to the configured webhooks.
+func (m *partitionMonitor) deliver(alert btcjson.PartitionAlert) {
+	if alert.Resolved {
+		srvrLog.Infof("Partition alert %s resolved: %s", alert.Kind,
+			alert.Detail)
+	} else {
+		srvrLog.Warnf("Partition alert %s (%s): %s -- %s", alert.Kind,
+			alert.Severity, alert.Detail, alert.Remediation)
+	}
+
+	if m.notify != nil {
+		m.notify(&alert)
+	}
+
+	if len(m.webhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(&alert)
+	if err != nil {
+		srvrLog.Errorf("Unable to marshal partition alert: %v", err)
+		return
+	}
+	for _, webhook := range m.webhooks {
+		m.wg.Add(1)
+		go func(webhook string) {
+			defer m.wg.Done()
+			if err := m.postWebhook(webhook, body); err != nil {
+				srvrLog.Warnf("Unable to post partition alert to "+
+					"%s: %v", webhook, err)
+			}
+		}(webhook)
+	}
+}
+
+// postWebhook posts the passed JSON encoded alert to the passed webhook.
+func (m *partitionMonitor) postWebhook(webhook string, body []byte) error {
+	resp, err := m.client.Post(webhook, "application/json",
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// TestPartitionMonitor ensures the partition monitor raises, repeats and
+// resolves alerts as the state of the node changes.
+func TestPartitionMonitor(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	groups := map[string]int{"1.2": 2, "3.4": 2, "5.6": 2, "7.8": 2}
+	tipTime := now
+	current := false
+	m := &partitionMonitor{
+		params:         &chaincfg.MainNetParams,
+		checkPeers:     true,
+		outboundGroups: func() map[string]int { return groups },
+		bestTime:       func() (time.Time, error) { return tipTime, nil },
+		isCurrent:      func() bool { return current },
+		now:            func() time.Time { return now },
+		raised:         make(map[string]time.Time),
+	}
+
+	type wantAlert struct {
+		kind     string
+		resolved bool
+	}
+	check := func(desc string, want ...wantAlert) {
+		t.Helper()
+		alerts := m.check()
+		if len(alerts) != len(want) {
+			t.Fatalf("%s: got %d alerts, want %d: %+v", desc,
+				len(alerts), len(want), alerts)
+		}
+		for i, alert := range alerts {
+			if alert.Kind != want[i].kind ||
+				alert.Resolved != want[i].resolved {
+
+				t.Fatalf("%s: alert #%d is %s (resolved %v), want "+
+					"%s (resolved %v)", desc, i, alert.Kind,
+					alert.Resolved, want[i].kind, want[i].resolved)
+			}
+			if !alert.Resolved && alert.Remediation == "" {
+				t.Fatalf("%s: alert #%d has no remediation", desc, i)
+			}
+		}
+	}
+
+	// Diverse peers and an old tip while syncing are not alerted on.
+	tipTime = now.Add(-24 * time.Hour)
+	check("syncing")
+
+	// Losing most of the network groups at once raises an alert, which is
+	// resolved once more than half of them are regained.
+	current = true
+	tipTime = now
+	groups = map[string]int{"1.2": 3, "3.4": 2}
+	check("diversity loss", wantAlert{partitionAlertDiversityLoss, false})
+	now = now.Add(partitionCheckInterval)
+	check("diversity loss ongoing")
+	groups = map[string]int{"1.2": 3, "3.4": 2, "5.6": 1}
+	check("diversity regained", wantAlert{partitionAlertDiversityLoss, true})
+
+	// All outbound peers in one group raises an alert which is repeated
+	// while the condition holds.
+	groups = map[string]int{"1.2": 3}
+	check("concentrated", wantAlert{partitionAlertConcentration, false})
+	now = now.Add(partitionCheckInterval)
+	check("concentrated ongoing")
+	now = now.Add(partitionAlertRepeat)
+	tipTime = now
+	check("concentrated repeat", wantAlert{partitionAlertConcentration, false})
+
+	// Too few peers to judge resolve the concentration alert.
+	groups = map[string]int{"1.2": 2}
+	check("few peers", wantAlert{partitionAlertConcentration, true})
+
+	// A tip far older than the expected block interval raises an alert
+	// once the node has been current, even though it no longer is.
+	current = false
+	groups = map[string]int{"1.2": 3, "3.4": 2}
+	now = now.Add(partitionStaleTipBlocks * 10 * time.Minute)
+	check("stale tip", wantAlert{partitionAlertStaleTip, false})
+	tipTime = now
+	check("new block", wantAlert{partitionAlertStaleTip, true})
+
+	// Stale tips are not alerted on for networks where blocks are generated
+	// on demand.
+	m.params = &chaincfg.RegressionNetParams
+	now = now.Add(24 * time.Hour)
+	check("regtest stale tip")
+}
+
+// TestPartitionWebhook ensures alerts are posted to webhooks as JSON and
+// rejections are reported.
+func TestPartitionWebhook(t *testing.T) {
+	var got btcjson.PartitionAlert
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			err = json.Unmarshal(body, &got)
+		}
+		if err != nil || r.Method != http.MethodPost ||
+			r.Header.Get("Content-Type") != "application/json" {
+
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	m := &partitionMonitor{client: srv.Client()}
+	alert := btcjson.PartitionAlert{
+		Kind:        partitionAlertStaleTip,
+		Severity:    partitionSeverityCritical,
+		Time:        1600000000,
+		Detail:      "detail",
+		Remediation: partitionRemediations[partitionAlertStaleTip],
+	}
+	body, err := json.Marshal(&alert)
+	if err != nil {
+		t.Fatalf("unable to marshal alert: %v", err)
+	}
+	if err := m.postWebhook(srv.URL, body); err != nil {
+		t.Fatalf("postWebhook: %v", err)
+	}
+	if got != alert {
+		t.Fatalf("posted alert is %+v, want %+v", got, alert)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := m.postWebhook(srv.URL, body); err == nil {
+		t.Fatal("postWebhook: rejected alert reported as posted")
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// FilterSource provides the committed filters (BIP0157 and BIP0158) and the
+// chain data needed to natively serve getcfilters, getcfheaders, and
+// getcfcheckpt requests.  The block hashes passed to the filter lookups are
+// always ones returned by HeightToHashRange.
+type FilterSource interface {
+	// IsCurrent returns whether the source is synced well enough to serve
+	// filters.  Requests are ignored while it returns false.
+	IsCurrent() bool
+
+	// SupportsFilterType returns whether filters of the passed type are
+	// maintained by the source.  Requests for other filter types are
+	// ignored.
+	SupportsFilterType(filterType wire.FilterType) bool
+
+	// HeightToHashRange returns the hashes of the main chain blocks from
+	// the passed start height up to and including the passed stop hash.
+	// An error must be returned when the stop hash is not in the main
+	// chain, is below the start height, or the range exceeds maxResults.
+	HeightToHashRange(startHeight int32, stopHash *chainhash.Hash,
+		maxResults int) ([]chainhash.Hash, error)
+
+	// FiltersByBlockHashes returns the serialized filters of the passed
+	// type for the passed blocks.  A nil entry indicates a missing filter.
+	FiltersByBlockHashes(blockHashes []*chainhash.Hash,
+		filterType wire.FilterType) ([][]byte, error)
+
+	// FilterHashesByBlockHashes returns the serialized filter hashes of the
+	// passed type for the passed blocks.  A nil entry indicates a missing
+	// filter hash.
+	FilterHashesByBlockHashes(blockHashes []*chainhash.Hash,
+		filterType wire.FilterType) ([][]byte, error)
+
+	// FilterHeaderByBlockHash returns the serialized filter header of the
+	// passed type for the passed block.  A nil result indicates a missing
+	// filter header.
+	FilterHeaderByBlockHash(blockHash *chainhash.Hash,
+		filterType wire.FilterType) ([]byte, error)
+
+	// FilterCheckpoints returns the filter headers of the passed type at
+	// each wire.CFCheckptInterval blocks of the main chain up to the
+	// passed stop hash.
+	FilterCheckpoints(stopHash *chainhash.Hash,
+		filterType wire.FilterType) ([]chainhash.Hash, error)
+}
+
+// cfiltersResponse returns the cfilter messages which answer the passed
+// getcfilters request using the passed filter source.
+func cfiltersResponse(source FilterSource,
+	msg *wire.MsgGetCFilters) ([]*wire.MsgCFilter, error) {
+
+	if !source.SupportsFilterType(msg.FilterType) {
+		return nil, fmt.Errorf("unknown filter type %v", msg.FilterType)
+	}
+
+	hashes, err := source.HeightToHashRange(int32(msg.StartHeight),
+		&msg.StopHash, wire.MaxGetCFiltersReqRange)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create []*chainhash.Hash from []chainhash.Hash to pass to
+	// FiltersByBlockHashes.
+	hashPtrs := make([]*chainhash.Hash, len(hashes))
+	for i := range hashes {
+		hashPtrs[i] = &hashes[i]
+	}
+
+	filters, err := source.FiltersByBlockHashes(hashPtrs, msg.FilterType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve cfilters: %v", err)
+	}
+	if len(filters) != len(hashes) {
+		return nil, fmt.Errorf("filter source returned %d cfilters for "+
+			"%d blocks", len(filters), len(hashes))
+	}
+
+	filterMsgs := make([]*wire.MsgCFilter, 0, len(filters))
+	for i, filterBytes := range filters {
+		if len(filterBytes) == 0 {
+			return nil, fmt.Errorf("could not obtain cfilter for %v",
+				hashes[i])
+		}
+
+		filterMsgs = append(filterMsgs, wire.NewMsgCFilter(
+			msg.FilterType, &hashes[i], filterBytes,
+		))
+	}
+	return filterMsgs, nil
+}
+
+// cfheadersResponse returns the cfheaders message which answers the passed
+// getcfheaders request using the passed filter source.
+func cfheadersResponse(source FilterSource,
+	msg *wire.MsgGetCFHeaders) (*wire.MsgCFHeaders, error) {
+
+	if !source.SupportsFilterType(msg.FilterType) {
+		return nil, fmt.Errorf("unknown filter type %v", msg.FilterType)
+	}
+
+	startHeight := int32(msg.StartHeight)
+	maxResults := wire.MaxCFHeadersPerMsg
+
+	// If StartHeight is positive, fetch the predecessor block hash so we
+	// can populate the PrevFilterHeader field.
+	if msg.StartHeight > 0 {
+		startHeight--
+		maxResults++
+	}
+
+	hashList, err := source.HeightToHashRange(startHeight, &msg.StopHash,
+		maxResults)
+	if err != nil {
+		return nil, err
+	}
+
+	// This is possible if StartHeight is one greater that the height of
+	// StopHash, and we pull a valid range of hashes including the previous
+	// filter header.
+	if len(hashList) == 0 || (msg.StartHeight > 0 && len(hashList) == 1) {
+		return nil, fmt.Errorf("no results")
+	}
+
+	// Create []*chainhash.Hash from []chainhash.Hash to pass to
+	// FilterHashesByBlockHashes.
+	hashPtrs := make([]*chainhash.Hash, len(hashList))
+	for i := range hashList {
+		hashPtrs[i] = &hashList[i]
+	}
+
+	filterHashes, err := source.FilterHashesByBlockHashes(hashPtrs,
+		msg.FilterType)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve cfilter hashes: %v",
+			err)
+	}
+	if len(filterHashes) != len(hashList) {
+		return nil, fmt.Errorf("filter source returned %d cfilter "+
+			"hashes for %d blocks", len(filterHashes), len(hashList))
+	}
+
+	headersMsg := wire.NewMsgCFHeaders()
+
+	// Populate the PrevFilterHeader field.
+	if msg.StartHeight > 0 {
+		prevBlockHash := &hashList[0]
+
+		headerBytes, err := source.FilterHeaderByBlockHash(prevBlockHash,
+			msg.FilterType)
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve cfilter "+
+				"header: %v", err)
+		}
+		if len(headerBytes) == 0 {
+			return nil, fmt.Errorf("could not obtain cfilter header "+
+				"for %v", prevBlockHash)
+		}
+
+		err = headersMsg.PrevFilterHeader.SetBytes(headerBytes)
+		if err != nil {
+			return nil, fmt.Errorf("committed filter header "+
+				"deserialize failed: %v", err)
+		}
+
+		hashList = hashList[1:]
+		filterHashes = filterHashes[1:]
+	}
+
+	// Populate HeaderHashes.
+	for i, hashBytes := range filterHashes {
+		if len(hashBytes) == 0 {
+			return nil, fmt.Errorf("could not obtain cfilter hash "+
+				"for %v", hashList[i])
+		}
+
+		filterHash, err := chainhash.NewHash(hashBytes)
+		if err != nil {
+			return nil, fmt.Errorf("committed filter hash "+
+				"deserialize failed: %v", err)
+		}
+
+		headersMsg.AddCFHash(filterHash)
+	}
+
+	headersMsg.FilterType = msg.FilterType
+	headersMsg.StopHash = msg.StopHash
+	return headersMsg, nil
+}
+
+// cfcheckptResponse returns the cfcheckpt message which answers the passed
+// getcfcheckpt request using the passed filter source.
+func cfcheckptResponse(source FilterSource,
+	msg *wire.MsgGetCFCheckpt) (*wire.MsgCFCheckpt, error) {
+
+	if !source.SupportsFilterType(msg.FilterType) {
+		return nil, fmt.Errorf("unknown filter type %v", msg.FilterType)
+	}
+
+	filterHeaders, err := source.FilterCheckpoints(&msg.StopHash,
+		msg.FilterType)
+	if err != nil {
+		return nil, err
+	}
+
+	checkptMsg := wire.NewMsgCFCheckpt(msg.FilterType, &msg.StopHash,
+		len(filterHeaders))
+	for i := range filterHeaders {
+		checkptMsg.AddCFHeader(&filterHeaders[i])
+	}
+	return checkptMsg, nil
+}
+
+// handleGetCFilters serves the passed getcfilters request from the filter
+// source of the peer config.  Requests which can't be answered are logged and
+// otherwise ignored.
+func (p *Peer) handleGetCFilters(msg *wire.MsgGetCFilters) {
+	source := p.cfg.FilterSource
+	if !source.IsCurrent() {
+		return
+	}
+
+	filterMsgs, err := cfiltersResponse(source, msg)
+	if err != nil {
+		log.Debugf("Unable to serve getcfilters request from %s: %v",
+			p, err)
+		return
+	}
+	for _, filterMsg := range filterMsgs {
+		p.QueueMessage(filterMsg, nil)
+	}
+}
+
+// handleGetCFHeaders serves the passed getcfheaders request from the filter
+// source of the peer config.  Requests which can't be answered are logged and
+// otherwise ignored.
+func (p *Peer) handleGetCFHeaders(msg *wire.MsgGetCFHeaders) {
+	source := p.cfg.FilterSource
+	if !source.IsCurrent() {
+		return
+	}
+
+	headersMsg, err := cfheadersResponse(source, msg)
+	if err != nil {
+		log.Debugf("Unable to serve getcfheaders request from %s: %v",
+			p, err)
+		return
+	}
+	p.QueueMessage(headersMsg, nil)
+}
+
+// handleGetCFCheckpt serves the passed getcfcheckpt request from the filter
+// source of the peer config.  Requests which can't be answered are logged and
+// otherwise ignored.
+func (p *Peer) handleGetCFCheckpt(msg *wire.MsgGetCFCheckpt) {
+	source := p.cfg.FilterSource
+	if !source.IsCurrent() {
+		return
+	}
+
+	checkptMsg, err := cfcheckptResponse(source, msg)
+	if err != nil {
+		log.Debugf("Unable to serve getcfcheckpt request from %s: %v",
+			p, err)
+		return
+	}
+	p.QueueMessage(checkptMsg, nil)
+}
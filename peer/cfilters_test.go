@@ -0,0 +1,231 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// mockFilterSource implements the FilterSource interface for a chain of blocks
+// whose hashes, filters, filter hashes, and filter headers are all derived from
+// their heights.
+type mockFilterSource struct {
+	numBlocks int32
+	missing   map[chainhash.Hash]struct{}
+}
+
+// blockHash returns the mock hash of the block at the passed height.
+func (m *mockFilterSource) blockHash(height int32) chainhash.Hash {
+	return chainhash.DoubleHashH([]byte{'b', byte(height)})
+}
+
+// height returns the height of the block with the passed hash.
+func (m *mockFilterSource) height(hash *chainhash.Hash) (int32, bool) {
+	for height := int32(0); height < m.numBlocks; height++ {
+		if m.blockHash(height) == *hash {
+			return height, true
+		}
+	}
+	return 0, false
+}
+
+// lookup returns the mock data with the passed prefix for each passed block.
+func (m *mockFilterSource) lookup(prefix byte,
+	hashes []*chainhash.Hash) [][]byte {
+
+	results := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		if _, ok := m.missing[*hash]; ok {
+			continue
+		}
+		height, _ := m.height(hash)
+		data := chainhash.DoubleHashH([]byte{prefix, byte(height)})
+		results[i] = data[:]
+	}
+	return results
+}
+
+func (m *mockFilterSource) IsCurrent() bool { return true }
+
+func (m *mockFilterSource) SupportsFilterType(filterType wire.FilterType) bool {
+	return filterType == wire.GCSFilterRegular
+}
+
+func (m *mockFilterSource) HeightToHashRange(startHeight int32,
+	stopHash *chainhash.Hash, maxResults int) ([]chainhash.Hash, error) {
+
+	stopHeight, ok := m.height(stopHash)
+	if !ok {
+		return nil, errors.New("unknown stop hash")
+	}
+	if stopHeight < startHeight {
+		return nil, errors.New("stop hash below start height")
+	}
+	if int(stopHeight-startHeight+1) > maxResults {
+		return nil, errors.New("too many results")
+	}
+	hashes := make([]chainhash.Hash, 0, stopHeight-startHeight+1)
+	for height := startHeight; height <= stopHeight; height++ {
+		hashes = append(hashes, m.blockHash(height))
+	}
+	return hashes, nil
+}
+
+func (m *mockFilterSource) FiltersByBlockHashes(hashes []*chainhash.Hash,
+	_ wire.FilterType) ([][]byte, error) {
+
+	return m.lookup('f', hashes), nil
+}
+
+func (m *mockFilterSource) FilterHashesByBlockHashes(hashes []*chainhash.Hash,
+	_ wire.FilterType) ([][]byte, error) {
+
+	return m.lookup('h', hashes), nil
+}
+
+func (m *mockFilterSource) FilterHeaderByBlockHash(hash *chainhash.Hash,
+	_ wire.FilterType) ([]byte, error) {
+
+	return m.lookup('H', []*chainhash.Hash{hash})[0], nil
+}
+
+func (m *mockFilterSource) FilterCheckpoints(stopHash *chainhash.Hash,
+	_ wire.FilterType) ([]chainhash.Hash, error) {
+
+	if _, ok := m.height(stopHash); !ok {
+		return nil, errors.New("unknown stop hash")
+	}
+	return []chainhash.Hash{chainhash.DoubleHashH([]byte{'c'})}, nil
+}
+
+// TestCFiltersResponse ensures getcfilters requests are answered with one
+// cfilter message per requested block and invalid requests are rejected.
+func TestCFiltersResponse(t *testing.T) {
+	source := &mockFilterSource{numBlocks: 10}
+	stopHash := source.blockHash(5)
+
+	msgs, err := cfiltersResponse(source, wire.NewMsgGetCFilters(
+		wire.GCSFilterRegular, 3, &stopHash))
+	if err != nil {
+		t.Fatalf("cfiltersResponse: unexpected error: %v", err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("cfiltersResponse: unexpected number of messages - "+
+			"got %d, want 3", len(msgs))
+	}
+	for i, msg := range msgs {
+		height := int32(i + 3)
+		wantHash := source.blockHash(height)
+		if msg.BlockHash != wantHash {
+			t.Fatalf("cfiltersResponse #%d: unexpected block hash - "+
+				"got %v, want %v", i, msg.BlockHash, wantHash)
+		}
+		wantFilter := chainhash.DoubleHashH([]byte{'f', byte(height)})
+		if !bytes.Equal(msg.Data, wantFilter[:]) {
+			t.Fatalf("cfiltersResponse #%d: unexpected filter", i)
+		}
+	}
+
+	// Ensure unknown filter types, unknown stop hashes, and missing
+	// filters are rejected.
+	unknownHash := chainhash.DoubleHashH([]byte{'u'})
+	source.missing = map[chainhash.Hash]struct{}{source.blockHash(4): {}}
+	tests := []struct {
+		name string
+		msg  *wire.MsgGetCFilters
+	}{
+		{"unknown filter type", wire.NewMsgGetCFilters(1, 3, &stopHash)},
+		{"unknown stop hash", wire.NewMsgGetCFilters(
+			wire.GCSFilterRegular, 3, &unknownHash)},
+		{"missing filter", wire.NewMsgGetCFilters(
+			wire.GCSFilterRegular, 3, &stopHash)},
+	}
+	for _, test := range tests {
+		if _, err := cfiltersResponse(source, test.msg); err == nil {
+			t.Fatalf("%s: did not receive expected error", test.name)
+		}
+	}
+}
+
+// TestCFHeadersResponse ensures getcfheaders requests are answered with the
+// filter hashes of the requested blocks along with the filter header of the
+// block before the range.
+func TestCFHeadersResponse(t *testing.T) {
+	source := &mockFilterSource{numBlocks: 10}
+	stopHash := source.blockHash(5)
+
+	tests := []struct {
+		name        string
+		startHeight uint32
+		wantPrev    chainhash.Hash
+		wantHashes  int
+	}{
+		{"from genesis", 0, chainhash.Hash{}, 6},
+		{"from height 3", 3,
+			chainhash.DoubleHashH([]byte{'H', 2}), 3},
+	}
+	for _, test := range tests {
+		msg, err := cfheadersResponse(source, wire.NewMsgGetCFHeaders(
+			wire.GCSFilterRegular, test.startHeight, &stopHash))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if msg.PrevFilterHeader != test.wantPrev {
+			t.Fatalf("%s: unexpected previous filter header - got "+
+				"%v, want %v", test.name, msg.PrevFilterHeader,
+				test.wantPrev)
+		}
+		if len(msg.FilterHashes) != test.wantHashes {
+			t.Fatalf("%s: unexpected number of filter hashes - got "+
+				"%d, want %d", test.name, len(msg.FilterHashes),
+				test.wantHashes)
+		}
+		for i, filterHash := range msg.FilterHashes {
+			height := int32(test.startHeight) + int32(i)
+			want := chainhash.DoubleHashH([]byte{'h', byte(height)})
+			if *filterHash != want {
+				t.Fatalf("%s #%d: unexpected filter hash", test.name,
+					i)
+			}
+		}
+		if msg.StopHash != stopHash {
+			t.Fatalf("%s: unexpected stop hash", test.name)
+		}
+	}
+
+	// Ensure a start height one past the stop hash yields no response.
+	if _, err := cfheadersResponse(source, wire.NewMsgGetCFHeaders(
+		wire.GCSFilterRegular, 6, &stopHash)); err == nil {
+		t.Fatal("cfheadersResponse: did not receive expected error")
+	}
+}
+
+// TestCFCheckptResponse ensures getcfcheckpt requests are answered with the
+// filter headers returned by the source.
+func TestCFCheckptResponse(t *testing.T) {
+	source := &mockFilterSource{numBlocks: 10}
+	stopHash := source.blockHash(9)
+
+	msg, err := cfcheckptResponse(source, wire.NewMsgGetCFCheckpt(
+		wire.GCSFilterRegular, &stopHash))
+	if err != nil {
+		t.Fatalf("cfcheckptResponse: unexpected error: %v", err)
+	}
+	want := chainhash.DoubleHashH([]byte{'c'})
+	if len(msg.FilterHeaders) != 1 || *msg.FilterHeaders[0] != want {
+		t.Fatalf("cfcheckptResponse: unexpected filter headers %v",
+			msg.FilterHeaders)
+	}
+
+	if _, err := cfcheckptResponse(source, wire.NewMsgGetCFCheckpt(1,
+		&stopHash)); err == nil {
+		t.Fatal("cfcheckptResponse: did not receive expected error")
+	}
+}
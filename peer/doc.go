@@ -20,7 +20,7 @@ A quick overview of the major features peer provides are as follows:
    communications via the peer-to-peer protocol
  - Full duplex reading and writing of bitcoin protocol messages
  - Automatic handling of the initial handshake process including protocol
-   version negotiation
+   version negotiation and signalling support for addrv2 messages (BIP0155)
  - Asynchronous message queuing of outbound messages with optional channel for
    notification when the message is actually sent
  - Flexible peer configuration
@@ -35,13 +35,22 @@ A quick overview of the major features peer provides are as follows:
  - Inventory message batching and send trickling with known inventory detection
    and avoidance
  - Automatic periodic keep-alive pinging and pong responses
+ - Stall detection with a deadline for each outstanding request, such as the
+   blocks and transactions requested with getdata, and notification of the
+   requests which timed out so they can be requested from other peers
  - Random nonce generation and self connection detection
  - Proper handling of bloom filter related commands when the caller does not
    specify the related flag to signal support
    - Disconnects the peer when the protocol version is high enough
    - Does not invoke the related callbacks for older protocol versions
+ - Optional native serving of committed filters (BIP0157 and BIP0158) from a
+   pluggable filter source
+ - Optional message tap which receives the time, direction, and size of every
+   message read from and written to the peer for traffic capture and protocol
+   debugging
  - Snapshottable peer statistics such as the total number of bytes read and
-   written, the remote address, user agent, and negotiated protocol version
+   written, the remote address, user agent, negotiated protocol version, ping
+   latency percentiles, and estimated clock offset
  - Helper functions pushing addresses, getblocks, getheaders, and reject
    messages
    - These could all be sent manually via the standard message output function,
@@ -100,6 +109,14 @@ channel which will be notified when the message is actually sent can optionally
 be specified.  There are certain message types which are better sent using other
 functions which provide additional functionality.
 
+Queued messages are sent in priority order.  Blocks and block announcements are
+sent before transactions, which in turn are sent before address relay and
+pings, so a peer which is slow to drain transaction announcements does not delay
+block announcements.  Messages of the same priority are sent in the order they
+were queued.  The SendQueueLen and IsBackpressured functions expose how far the
+peer is lagging behind for each priority so callers can hold back messages which
+may be deferred.
+
 Of special interest are inventory messages.  Rather than manually sending MsgInv
 messages via Queuemessage, the inventory vectors should be queued using the
 QueueInventory function.  It employs batching and trickling along with
@@ -128,11 +145,24 @@ appropriate reject message based on the provided parameters as well as
 optionally provides a flag to cause it to block until the message is actually
 sent.
 
+Serving Committed Filters
+
+Peers which advertise the committed filter service need to answer getcfilters,
+getcfheaders, and getcfcheckpt requests.  Rather than handling those messages
+through the listeners, the FilterSource field of the Config struct can be set to
+an implementation of the FilterSource interface which provides the filters,
+filter hashes, filter headers, and block hashes.  The peer then validates the
+requests, builds the cfilter, cfheaders, and cfcheckpt responses, and queues
+them for the remote peer.
+
 Peer Statistics
 
 A snapshot of the current peer statistics can be obtained with the StatsSnapshot
 function.  This includes statistics such as the total number of bytes read and
-written, the remote address, user agent, and negotiated protocol version.
+written, the remote address, user agent, and negotiated protocol version.  It
+also includes the minimum, median, 90th percentile, and maximum round trip times
+of the most recent pings, and the clock offset of the peer estimated from the
+time it reported during the handshake and its median round trip time.
 
 Logging
 
@@ -0,0 +1,74 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"sort"
+	"time"
+)
+
+// pingLatencySamples is the number of the most recent ping round trip times
+// used to compute the latency statistics of a peer.
+const pingLatencySamples = 32
+
+// LatencyStats summarizes the round trip times of the most recent pings which
+// were answered by a peer.  All durations are zero when no ping has been
+// answered yet.
+type LatencyStats struct {
+	// Samples is the number of round trip times the statistics are
+	// computed from.
+	Samples int
+
+	// Min, Median, P90, and Max are the minimum, median, 90th percentile,
+	// and maximum round trip times.
+	Min    time.Duration
+	Median time.Duration
+	P90    time.Duration
+	Max    time.Duration
+}
+
+// latencyTracker keeps a rolling window of the most recent ping round trip
+// times of a peer.
+type latencyTracker struct {
+	samples [pingLatencySamples]time.Duration
+	next    int
+	count   int
+}
+
+// add records the passed round trip time, replacing the oldest one once the
+// window is full.
+func (t *latencyTracker) add(rtt time.Duration) {
+	t.samples[t.next] = rtt
+	t.next = (t.next + 1) % len(t.samples)
+	if t.count < len(t.samples) {
+		t.count++
+	}
+}
+
+// stats returns the statistics of the round trip times in the window.
+func (t *latencyTracker) stats() LatencyStats {
+	if t.count == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := make([]time.Duration, t.count)
+	copy(sorted, t.samples[:t.count])
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	// Use the nearest rank method for the percentiles.
+	percentile := func(p int) time.Duration {
+		rank := (p*t.count + 99) / 100
+		return sorted[rank-1]
+	}
+	return LatencyStats{
+		Samples: t.count,
+		Min:     sorted[0],
+		Median:  percentile(50),
+		P90:     percentile(90),
+		Max:     sorted[t.count-1],
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLatencyTracker ensures the latency tracker computes the statistics of
+// the most recent round trip times.
+func TestLatencyTracker(t *testing.T) {
+	var tracker latencyTracker
+	if stats := tracker.stats(); stats != (LatencyStats{}) {
+		t.Fatalf("unexpected stats without samples: %+v", stats)
+	}
+
+	// Add 1ms through 10ms in reverse order.
+	for i := 10; i > 0; i-- {
+		tracker.add(time.Duration(i) * time.Millisecond)
+	}
+	want := LatencyStats{
+		Samples: 10,
+		Min:     time.Millisecond,
+		Median:  5 * time.Millisecond,
+		P90:     9 * time.Millisecond,
+		Max:     10 * time.Millisecond,
+	}
+	if stats := tracker.stats(); stats != want {
+		t.Fatalf("wrong stats - got %+v, want %+v", stats, want)
+	}
+
+	// Fill the window with 100ms samples so the earlier samples are
+	// replaced.
+	for i := 0; i < pingLatencySamples; i++ {
+		tracker.add(100 * time.Millisecond)
+	}
+	want = LatencyStats{
+		Samples: pingLatencySamples,
+		Min:     100 * time.Millisecond,
+		Median:  100 * time.Millisecond,
+		P90:     100 * time.Millisecond,
+		Max:     100 * time.Millisecond,
+	}
+	if stats := tracker.stats(); stats != want {
+		t.Fatalf("wrong stats after wrap - got %+v, want %+v", stats,
+			want)
+	}
+}
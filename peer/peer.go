@@ -28,7 +28,7 @@ import (
 
 const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
-	MaxProtocolVersion = wire.FeeFilterVersion
+	MaxProtocolVersion = wire.AddrV2Version
 
 	// DefaultTrickleInterval is the min time between attempts to send an
 	// inv message to a peer.
@@ -61,8 +61,8 @@ const (
 	idleTimeout = 5 * time.Minute
 
 	// stallTickInterval is the interval of time between each check for
-	// stalled peers.
-	stallTickInterval = 15 * time.Second
+	// requests which have exceeded their deadline.
+	stallTickInterval = time.Second
 
 	// stallResponseTimeout is the base maximum amount of time messages that
 	// expect a response will wait before disconnecting the peer for
@@ -106,6 +106,9 @@ type MessageListeners struct {
 	// OnAddr is invoked when a peer receives an addr bitcoin message.
 	OnAddr func(p *Peer, msg *wire.MsgAddr)
 
+	// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message.
+	OnAddrV2 func(p *Peer, msg *wire.MsgAddrV2)
+
 	// OnPing is invoked when a peer receives a ping bitcoin message.
 	OnPing func(p *Peer, msg *wire.MsgPing)
 
@@ -186,6 +189,20 @@ type MessageListeners struct {
 	// message.
 	OnMerkleBlock func(p *Peer, msg *wire.MsgMerkleBlock)
 
+	// OnSendTxRcncl is invoked when a peer receives a sendtxrcncl bitcoin
+	// message.
+	OnSendTxRcncl func(p *Peer, msg *wire.MsgSendTxRcncl)
+
+	// OnReqRecon is invoked when a peer receives a reqrecon bitcoin message.
+	OnReqRecon func(p *Peer, msg *wire.MsgReqRecon)
+
+	// OnSketch is invoked when a peer receives a sketch bitcoin message.
+	OnSketch func(p *Peer, msg *wire.MsgSketch)
+
+	// OnReconcilDiff is invoked when a peer receives a reconcildiff bitcoin
+	// message.
+	OnReconcilDiff func(p *Peer, msg *wire.MsgReconcilDiff)
+
 	// OnVersion is invoked when a peer receives a version bitcoin message.
 	// The caller may return a reject message in which case the message will
 	// be sent to the peer and the peer will be disconnected.
@@ -201,6 +218,10 @@ type MessageListeners struct {
 	// message.
 	OnSendHeaders func(p *Peer, msg *wire.MsgSendHeaders)
 
+	// OnSendAddrV2 is invoked when a peer receives a sendaddrv2 bitcoin
+	// message during version negotiation.
+	OnSendAddrV2 func(p *Peer, msg *wire.MsgSendAddrV2)
+
 	// OnRead is invoked when a peer receives a bitcoin message.  It
 	// consists of the number of bytes read, the message, and whether or not
 	// an error in the read occurred.  Typically, callers will opt to use
@@ -275,6 +296,47 @@ type Config struct {
 	// TrickleInterval is the duration of the ticker which trickles down the
 	// inventory to a peer.
 	TrickleInterval time.Duration
+
+	// V2Transport specifies whether or not the BIP0324 encrypted transport
+	// should be used for the connection.  Outbound peers attempt the v2
+	// handshake and fail when the remote peer does not support it, in
+	// which case V2HandshakeFailed reports true so the caller can
+	// reconnect using the v1 transport.  Inbound peers accept both v2 and
+	// v1 connections.
+	V2Transport bool
+
+	// RateLimits specifies the maximum number of messages per command the
+	// remote peer is allowed to send within an interval.  Messages beyond
+	// the limit are dropped and reported through AddBanScore.  This field
+	// can be omitted in which case no rate limits are enforced.
+	RateLimits map[string]RateLimit
+
+	// AddBanScore is invoked when the remote peer misbehaves in a way that
+	// is detected by the peer itself, such as exceeding a rate limit or
+	// sending an oversized message, with the persistent and decaying ban
+	// score increases and a reason.  This field can be omitted in which
+	// case misbehavior is only logged.
+	AddBanScore func(p *Peer, persistent, transient uint32, reason string)
+
+	// OnRequestTimeout is invoked for each outstanding request, such as
+	// the blocks and transactions requested with getdata or a getheaders
+	// request, which the remote peer did not answer by its deadline.  The
+	// peer is disconnected for stalling right after.  It is invoked from
+	// the stall handler of the peer and therefore must not block.  This
+	// field can be omitted in which case the peer is only disconnected.
+	OnRequestTimeout func(p *Peer, timeout *RequestTimeout)
+
+	// FilterSource provides the committed filters used to natively serve
+	// getcfilters, getcfheaders, and getcfcheckpt requests.  When it is
+	// set, those requests are answered by the peer and the related
+	// listeners are not invoked.  This field can be omitted in which case
+	// the requests are passed to the listeners.
+	FilterSource FilterSource
+
+	// MessageTap receives a record of every message read from or written
+	// to the peer, such as for capturing traffic for debugging.  This field
+	// can be omitted in which case no records are made.
+	MessageTap MessageTap
 }
 
 // minUint32 is a helper function to return the minimum of two uint32s.
@@ -379,6 +441,8 @@ type StatsSnap struct {
 	LastPingNonce  uint64
 	LastPingTime   time.Time
 	LastPingMicros int64
+	PingLatency    LatencyStats
+	ClockOffset    time.Duration
 }
 
 // HashFunc is a function which returns a block hash, height and error
@@ -447,6 +511,12 @@ type Peer struct {
 
 	conn net.Conn
 
+	// v1Reader is what messages of the v1 transport are read from.  It is
+	// the connection unless the bytes read while detecting an inbound peer
+	// which uses the v1 transport are replayed before it.  It is set once
+	// the transport is negotiated, before any messages are read.
+	v1Reader io.Reader
+
 	// These fields are set at creation time and never modified, so they are
 	// safe to read from concurrently without a mutex.
 	addr    string
@@ -462,11 +532,18 @@ type Peer struct {
 	advertisedProtoVer   uint32 // protocol version advertised by remote
 	protocolVersion      uint32 // negotiated protocol version
 	sendHeadersPreferred bool   // peer sent a sendheaders message
+	sendAddrV2           bool   // peer sent a sendaddrv2 message
 	verAckReceived       bool
 	witnessEnabled       bool
+	v2HandshakeFailed    bool
 
 	wireEncoding wire.MessageEncoding
 
+	// v2 houses the state of the encrypted transport.  It is nil when the
+	// connection uses the v1 transport and is only set during transport
+	// negotiation before any messages are exchanged.
+	v2 *v2Transport
+
 	knownInventory     *mruInventoryMap
 	prevGetBlocksMtx   sync.Mutex
 	prevGetBlocksBegin *chainhash.Hash
@@ -486,9 +563,13 @@ type Peer struct {
 	lastPingNonce      uint64    // Set to nonce if we have a pending ping.
 	lastPingTime       time.Time // Time we sent last ping.
 	lastPingMicros     int64     // Time for last ping to return.
+	pingLatency        latencyTracker
+	remoteTime         time.Time // Time the peer reported in its version.
+	remoteTimeRecv     time.Time // Time the version was received.
 
 	stallControl  chan stallControlMsg
 	outputQueue   chan outMsg
+	sendQueueLens [numSendPriorities]int32 // atomic
 	sendQueue     chan outMsg
 	sendDoneQueue chan struct{}
 	outputInvChan chan *wire.InvVect
@@ -570,6 +651,8 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 		LastPingNonce:  p.lastPingNonce,
 		LastPingMicros: p.lastPingMicros,
 		LastPingTime:   p.lastPingTime,
+		PingLatency:    p.pingLatency.stats(),
+		ClockOffset:    p.clockOffset(),
 	}
 
 	p.statsMtx.RUnlock()
@@ -789,6 +872,45 @@ func (p *Peer) TimeOffset() int64 {
 	return timeOffset
 }
 
+// PingLatency returns the statistics of the round trip times of the most
+// recent pings answered by the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) PingLatency() LatencyStats {
+	p.statsMtx.RLock()
+	stats := p.pingLatency.stats()
+	p.statsMtx.RUnlock()
+
+	return stats
+}
+
+// ClockOffset returns the estimated offset of the clock of the peer from the
+// local clock.  Unlike TimeOffset, it has sub-second precision and accounts
+// for the time the version message of the peer was in transit, which is
+// estimated as half the median ping round trip time.  Negative values indicate
+// the clock of the peer is behind the local clock.
+//
+// This function is safe for concurrent access.
+func (p *Peer) ClockOffset() time.Duration {
+	p.statsMtx.RLock()
+	offset := p.clockOffset()
+	p.statsMtx.RUnlock()
+
+	return offset
+}
+
+// clockOffset returns the estimated offset of the clock of the peer from the
+// local clock.
+//
+// This function MUST be called with the stats mutex held (for reads).
+func (p *Peer) clockOffset() time.Duration {
+	if p.remoteTimeRecv.IsZero() {
+		return 0
+	}
+	transit := p.pingLatency.stats().Median / 2
+	return p.remoteTime.Sub(p.remoteTimeRecv) + transit
+}
+
 // StartingHeight returns the last known height the peer reported during the
 // initial negotiation phase.
 //
@@ -813,6 +935,19 @@ func (p *Peer) WantsHeaders() bool {
 	return sendHeadersPreferred
 }
 
+// WantsAddrV2 returns if the peer signalled support for addrv2 messages during
+// version negotiation and therefore must be sent addrv2 messages instead of
+// addr messages.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsAddrV2() bool {
+	p.flagsMtx.Lock()
+	sendAddrV2 := p.sendAddrV2
+	p.flagsMtx.Unlock()
+
+	return sendAddrV2
+}
+
 // IsWitnessEnabled returns true if the peer has signalled that it supports
 // segregated witness.
 //
@@ -825,6 +960,31 @@ func (p *Peer) IsWitnessEnabled() bool {
 	return witnessEnabled
 }
 
+// V2Transport returns whether or not the connection to the peer uses the
+// BIP0324 encrypted transport.
+//
+// This function is safe for concurrent access.
+func (p *Peer) V2Transport() bool {
+	p.flagsMtx.Lock()
+	v2 := p.v2 != nil
+	p.flagsMtx.Unlock()
+
+	return v2
+}
+
+// V2HandshakeFailed returns whether or not an outbound attempt to establish
+// the BIP0324 encrypted transport with the peer failed.  Callers may use this
+// to reconnect to the peer using the v1 transport.
+//
+// This function is safe for concurrent access.
+func (p *Peer) V2HandshakeFailed() bool {
+	p.flagsMtx.Lock()
+	failed := p.v2HandshakeFailed
+	p.flagsMtx.Unlock()
+
+	return failed
+}
+
 // PushAddrMsg sends an addr message to the connected peer using the provided
 // addresses.  This function is useful over manually sending the message via
 // QueueMessage since it automatically limits the addresses to the maximum
@@ -861,6 +1021,41 @@ func (p *Peer) PushAddrMsg(addresses []*wire.NetAddress) ([]*wire.NetAddress, er
 	return msg.AddrList, nil
 }
 
+// PushAddrV2Msg sends an addrv2 message to the connected peer using the
+// provided addresses.  It behaves like PushAddrMsg, but is able to relay the
+// addresses of networks which can't be encoded in an addr message, such as Tor
+// v3, I2P, and CJDNS.  It must only be used for peers which want addrv2
+// messages as reported by WantsAddrV2.
+//
+// This function is safe for concurrent access.
+func (p *Peer) PushAddrV2Msg(addresses []*wire.NetAddressV2) ([]*wire.NetAddressV2, error) {
+	addressCount := len(addresses)
+
+	// Nothing to send.
+	if addressCount == 0 {
+		return nil, nil
+	}
+
+	msg := wire.NewMsgAddrV2()
+	msg.AddrList = make([]*wire.NetAddressV2, addressCount)
+	copy(msg.AddrList, addresses)
+
+	// Randomize the addresses sent if there are more than the maximum allowed.
+	if addressCount > wire.MaxAddrPerMsg {
+		// Shuffle the address list.
+		for i := 0; i < wire.MaxAddrPerMsg; i++ {
+			j := i + rand.Intn(addressCount-i)
+			msg.AddrList[i], msg.AddrList[j] = msg.AddrList[j], msg.AddrList[i]
+		}
+
+		// Truncate it to the maximum size.
+		msg.AddrList = msg.AddrList[:wire.MaxAddrPerMsg]
+	}
+
+	p.QueueMessage(msg, nil)
+	return msg.AddrList, nil
+}
+
 // PushGetBlocksMsg sends a getblocks message for the provided block locator
 // and stop hash.  It will ignore back-to-back duplicate requests.
 //
@@ -1013,9 +1208,11 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 	if p.ProtocolVersion() > wire.BIP0031Version {
 		p.statsMtx.Lock()
 		if p.lastPingNonce != 0 && msg.Nonce == p.lastPingNonce {
-			p.lastPingMicros = time.Since(p.lastPingTime).Nanoseconds()
+			rtt := time.Since(p.lastPingTime)
+			p.lastPingMicros = rtt.Nanoseconds()
 			p.lastPingMicros /= 1000 // convert to usec.
 			p.lastPingNonce = 0
+			p.pingLatency.add(rtt)
 		}
 		p.statsMtx.Unlock()
 	}
@@ -1023,12 +1220,21 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 
 // readMessage reads the next bitcoin message from the peer with logging.
 func (p *Peer) readMessage(encoding wire.MessageEncoding) (wire.Message, []byte, error) {
-	n, msg, buf, err := wire.ReadMessageWithEncodingN(p.conn,
-		p.ProtocolVersion(), p.cfg.ChainParams.Net, encoding)
+	var n int
+	var msg wire.Message
+	var buf []byte
+	var err error
+	if p.v2 != nil {
+		n, msg, buf, err = p.v2.readMessage(p.ProtocolVersion(), encoding)
+	} else {
+		n, msg, buf, err = wire.ReadMessageWithEncodingN(p.v1Reader,
+			p.ProtocolVersion(), p.cfg.ChainParams.Net, encoding)
+	}
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
 	if p.cfg.Listeners.OnRead != nil {
 		p.cfg.Listeners.OnRead(p, n, msg, err)
 	}
+	p.tapMessage(TapInbound, n, msg, buf, err)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -1086,15 +1292,36 @@ func (p *Peer) writeMessage(msg wire.Message, enc wire.MessageEncoding) error {
 	}))
 
 	// Write the message to the peer.
-	n, err := wire.WriteMessageWithEncodingN(p.conn, msg,
-		p.ProtocolVersion(), p.cfg.ChainParams.Net, enc)
+	var n int
+	var err error
+	if p.v2 != nil {
+		n, err = p.v2.writeMessage(msg, p.ProtocolVersion(), enc)
+	} else {
+		n, err = wire.WriteMessageWithEncodingN(p.conn, msg,
+			p.ProtocolVersion(), p.cfg.ChainParams.Net, enc)
+	}
 	atomic.AddUint64(&p.bytesSent, uint64(n))
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
 	}
+	p.tapMessage(TapOutbound, n, msg, nil, err)
 	return err
 }
 
+// AddBanScore reports misbehavior of the remote peer through the AddBanScore
+// callback of the peer config, or only logs it when no callback is provided.
+// It allows misbehavior detected by other subsystems, such as the sync
+// manager, to be reported without access to the caller of the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) AddBanScore(persistent, transient uint32, reason string) {
+	if p.cfg.AddBanScore == nil {
+		log.Debugf("Misbehaving peer %s: %s", p, reason)
+		return
+	}
+	p.cfg.AddBanScore(p, persistent, transient, reason)
+}
+
 // isAllowedReadError returns whether or not the passed error is allowed without
 // disconnecting the peer.  In particular, regression tests need to be allowed
 // to send malformed messages without the peer being disconnected.
@@ -1146,45 +1373,6 @@ func (p *Peer) shouldHandleReadError(err error) bool {
 	return true
 }
 
-// maybeAddDeadline potentially adds a deadline for the appropriate expected
-// response for the passed wire protocol command to the pending responses map.
-func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd string) {
-	// Setup a deadline for each message being sent that expects a response.
-	//
-	// NOTE: Pings are intentionally ignored here since they are typically
-	// sent asynchronously and as a result of a long backlock of messages,
-	// such as is typical in the case of initial block download, the
-	// response won't be received in time.
-	deadline := time.Now().Add(stallResponseTimeout)
-	switch msgCmd {
-	case wire.CmdVersion:
-		// Expects a verack message.
-		pendingResponses[wire.CmdVerAck] = deadline
-
-	case wire.CmdMemPool:
-		// Expects an inv message.
-		pendingResponses[wire.CmdInv] = deadline
-
-	case wire.CmdGetBlocks:
-		// Expects an inv message.
-		pendingResponses[wire.CmdInv] = deadline
-
-	case wire.CmdGetData:
-		// Expects a block, merkleblock, tx, or notfound message.
-		pendingResponses[wire.CmdBlock] = deadline
-		pendingResponses[wire.CmdMerkleBlock] = deadline
-		pendingResponses[wire.CmdTx] = deadline
-		pendingResponses[wire.CmdNotFound] = deadline
-
-	case wire.CmdGetHeaders:
-		// Expects a headers message.  Use a longer deadline since it
-		// can take a while for the remote peer to load all of the
-		// headers.
-		deadline = time.Now().Add(stallResponseTimeout * 3)
-		pendingResponses[wire.CmdHeaders] = deadline
-	}
-}
-
 // stallHandler handles stall detection for the peer.  This entails keeping
 // track of expected responses and assigning them deadlines while accounting for
 // the time spent in callbacks.  It must be run as a goroutine.
@@ -1203,10 +1391,9 @@ func (p *Peer) stallHandler() {
 	// 因此, 接收给定消息的响应的截止日期也必须考虑到处理时间.
 	var handlerActive bool
 	var handlersStartTime time.Time
-	var deadlineOffset time.Duration
 
-	// pendingResponses tracks the expected response deadline times.
-	pendingResponses := make(map[string]time.Time)
+	// requests tracks the deadlines of the outstanding requests.
+	requests := newRequestManager(stallResponseTimeout)
 
 	// stallTicker is used to periodically check pending responses that have
 	// exceeded the expected deadline and disconnect the peer due to
@@ -1223,32 +1410,14 @@ out:
 		case msg := <-p.stallControl:
 			switch msg.command {
 			case sccSendMessage:
-				// Add a deadline for the expected response
-				// message if needed.
-				p.maybeAddDeadline(pendingResponses,
-					msg.message.Command())
+				// Add deadlines for the expected responses if
+				// needed.
+				requests.sent(msg.message, time.Now())
 
 			case sccReceiveMessage:
-				// Remove received messages from the expected
-				// response map.  Since certain commands expect
-				// one of a group of responses, remove
-				// everything in the expected group accordingly.
-				switch msgCmd := msg.message.Command(); msgCmd {
-				case wire.CmdBlock:
-					fallthrough
-				case wire.CmdMerkleBlock:
-					fallthrough
-				case wire.CmdTx:
-					fallthrough
-				case wire.CmdNotFound:
-					delete(pendingResponses, wire.CmdBlock)
-					delete(pendingResponses, wire.CmdMerkleBlock)
-					delete(pendingResponses, wire.CmdTx)
-					delete(pendingResponses, wire.CmdNotFound)
-
-				default:
-					delete(pendingResponses, msgCmd)
-				}
+				// Remove the requests answered by received
+				// messages.
+				requests.received(msg.message, time.Now())
 
 			case sccHandlerStart:
 				// Warn on unbalanced callback signalling.
@@ -1273,8 +1442,7 @@ out:
 
 				// Extend active deadlines by the time it took
 				// to execute the callback.
-				duration := time.Since(handlersStartTime)
-				deadlineOffset += duration
+				requests.extend(time.Since(handlersStartTime))
 				handlerActive = false
 
 			default:
@@ -1283,31 +1451,33 @@ out:
 			}
 
 		case <-stallTicker.C:
-			// Calculate the offset to apply to the deadline based
-			// on how long the handlers have taken to execute since
-			// the last tick.
+			// Calculate the offset to apply to the deadlines based
+			// on how long the active handler has taken to execute.
 			now := time.Now()
-			offset := deadlineOffset
+			var offset time.Duration
 			if handlerActive {
-				offset += now.Sub(handlersStartTime)
+				offset = now.Sub(handlersStartTime)
 			}
 
 			// Disconnect the peer if any of the pending responses
 			// don't arrive by their adjusted deadline.
-			for command, deadline := range pendingResponses {
-				if now.Before(deadline.Add(offset)) {
-					continue
-				}
-
+			timeouts := requests.expired(now, offset)
+			if len(timeouts) == 0 {
+				continue
+			}
+			for _, timeout := range timeouts {
 				log.Debugf("Peer %s appears to be stalled or "+
 					"misbehaving, %s timeout -- "+
-					"disconnecting", p, command)
-				p.Disconnect()
-				break
+					"disconnecting", p, timeout.Command)
+				if p.cfg.OnRequestTimeout != nil {
+					p.cfg.OnRequestTimeout(p, timeout)
+				}
 			}
+			p.Disconnect()
 
-			// Reset the deadline offset for the next tick.
-			deadlineOffset = 0
+			// Stop tracking the timed out requests so they are
+			// only reported once.
+			requests = newRequestManager(stallResponseTimeout)
 
 		case <-p.inQuit:
 			// The stall handler can exit once both the input and
@@ -1352,6 +1522,8 @@ func (p *Peer) inHandler() {
 		p.Disconnect()
 	})
 
+	limiter := newRateLimiter(p.cfg.RateLimits)
+
 out:
 	for atomic.LoadInt32(&p.disconnect) == 0 {
 		// Read a message and stop the idle timer as soon as the read
@@ -1359,6 +1531,14 @@ out:
 		// needed.
 		rmsg, buf, err := p.readMessage(p.wireEncoding)
 		idleTimer.Stop()
+		if err == wire.ErrUnknownMessage {
+			// Newer protocol versions introduce new messages, so
+			// ones which aren't understood are ignored rather than
+			// treated as malformed.
+			log.Debugf("Ignoring unknown message from %s", p)
+			idleTimer.Reset(idleTimeout)
+			continue
+		}
 		if err != nil {
 			// In order to allow regression tests with malformed messages, don't
 			// disconnect the peer when we're in regression test mode and the
@@ -1373,6 +1553,14 @@ out:
 			// local peer is not forcibly disconnecting and the
 			// remote peer has not disconnected.
 			if p.shouldHandleReadError(err) {
+				if isOversizedMsgError(err) {
+					p.AddBanScore(oversizedMsgBanScore, 0,
+						"oversized message")
+				} else if _, ok := err.(*wire.MessageError); ok {
+					p.AddBanScore(malformedMsgBanScore, 0,
+						"malformed message")
+				}
+
 				errMsg := fmt.Sprintf("Can't read message from %s: %v", p, err)
 				if err != io.ErrUnexpectedEOF {
 					log.Errorf(errMsg)
@@ -1390,9 +1578,22 @@ out:
 			}
 			break out
 		}
-		atomic.StoreInt64(&p.lastRecv, time.Now().Unix())
+		now := time.Now()
+		atomic.StoreInt64(&p.lastRecv, now.Unix())
 		p.stallControl <- stallControlMsg{sccReceiveMessage, rmsg}
 
+		// Drop messages which exceed the rate limit for their command
+		// without handling them.
+		if limit, ok := limiter.allow(rmsg.Command(), now); !ok {
+			log.Debugf("Dropping %s message from %s -- rate limit of "+
+				"%d per %v exceeded", rmsg.Command(), p, limit.Count,
+				limit.Interval)
+			p.AddBanScore(0, limit.BanScore, fmt.Sprintf("%s rate "+
+				"limit exceeded", rmsg.Command()))
+			idleTimer.Reset(idleTimeout)
+			continue
+		}
+
 		// Handle each supported message type.
 		p.stallControl <- stallControlMsg{sccHandlerStart, rmsg}
 		switch msg := rmsg.(type) {
@@ -1420,6 +1621,17 @@ out:
 				p.cfg.Listeners.OnAddr(p, msg)
 			}
 
+		case *wire.MsgAddrV2:
+			if p.cfg.Listeners.OnAddrV2 != nil {
+				p.cfg.Listeners.OnAddrV2(p, msg)
+			}
+
+		case *wire.MsgSendAddrV2:
+			// BIP0155 requires sendaddrv2 to be sent before verack,
+			// so it is ignored once negotiation has finished.
+			log.Debugf("Ignoring sendaddrv2 message received after "+
+				"verack from %v", p)
+
 		case *wire.MsgPing:
 			p.handlePingMsg(msg)
 			if p.cfg.Listeners.OnPing != nil {
@@ -1483,17 +1695,23 @@ out:
 			}
 
 		case *wire.MsgGetCFilters:
-			if p.cfg.Listeners.OnGetCFilters != nil {
+			if p.cfg.FilterSource != nil {
+				p.handleGetCFilters(msg)
+			} else if p.cfg.Listeners.OnGetCFilters != nil {
 				p.cfg.Listeners.OnGetCFilters(p, msg)
 			}
 
 		case *wire.MsgGetCFHeaders:
-			if p.cfg.Listeners.OnGetCFHeaders != nil {
+			if p.cfg.FilterSource != nil {
+				p.handleGetCFHeaders(msg)
+			} else if p.cfg.Listeners.OnGetCFHeaders != nil {
 				p.cfg.Listeners.OnGetCFHeaders(p, msg)
 			}
 
 		case *wire.MsgGetCFCheckpt:
-			if p.cfg.Listeners.OnGetCFCheckpt != nil {
+			if p.cfg.FilterSource != nil {
+				p.handleGetCFCheckpt(msg)
+			} else if p.cfg.Listeners.OnGetCFCheckpt != nil {
 				p.cfg.Listeners.OnGetCFCheckpt(p, msg)
 			}
 
@@ -1532,6 +1750,26 @@ out:
 				p.cfg.Listeners.OnMerkleBlock(p, msg)
 			}
 
+		case *wire.MsgSendTxRcncl:
+			if p.cfg.Listeners.OnSendTxRcncl != nil {
+				p.cfg.Listeners.OnSendTxRcncl(p, msg)
+			}
+
+		case *wire.MsgReqRecon:
+			if p.cfg.Listeners.OnReqRecon != nil {
+				p.cfg.Listeners.OnReqRecon(p, msg)
+			}
+
+		case *wire.MsgSketch:
+			if p.cfg.Listeners.OnSketch != nil {
+				p.cfg.Listeners.OnSketch(p, msg)
+			}
+
+		case *wire.MsgReconcilDiff:
+			if p.cfg.Listeners.OnReconcilDiff != nil {
+				p.cfg.Listeners.OnReconcilDiff(p, msg)
+			}
+
 		case *wire.MsgReject:
 			if p.cfg.Listeners.OnReject != nil {
 				p.cfg.Listeners.OnReject(p, msg)
@@ -1575,7 +1813,7 @@ out:
 // 因此我们可以确保服务器和 peer 处理程序不会阻塞我们发送消息.
 // 然后, 该数据将传递到 outHandler 进行实际写入.
 func (p *Peer) queueHandler() {
-	pendingMsgs := list.New()
+	pendingMsgs := newPriorityQueue(&p.sendQueueLens)
 	invSendQueue := list.New()
 	trickleTicker := time.NewTicker(p.cfg.TrickleInterval)
 	defer trickleTicker.Stop()
@@ -1587,6 +1825,10 @@ func (p *Peer) queueHandler() {
 	// message's done channel.  To avoid such confusion we keep a different
 	// flag and pendingMsgs only contains messages that we have not yet
 	// passed to outHandler.
+	//
+	// The pending messages are split into lanes by priority so a peer
+	// which is slow to drain transaction announcements does not delay
+	// block announcements.
 
 	// 我们保留 waiting 标志, 以便知道是否有消息入队到 outHandler.
 	// 我们可以使用列表的开头来表示此信息, 但是对于在清理时是否获取到该列表,
@@ -1596,11 +1838,11 @@ func (p *Peer) queueHandler() {
 	waiting := false
 
 	// To avoid duplication below.
-	queuePacket := func(msg outMsg, list *list.List, waiting bool) bool {
+	queuePacket := func(msg outMsg, queue *priorityQueue, waiting bool) bool {
 		if !waiting {
 			p.sendQueue <- msg
 		} else {
-			list.PushBack(msg)
+			queue.push(msg)
 		}
 		// we are always waiting now.
 		return true
@@ -1616,16 +1858,15 @@ out:
 		case <-p.sendDoneQueue:
 			// No longer waiting if there are no more messages
 			// in the pending messages queue.
-			next := pendingMsgs.Front()
-			if next == nil {
+			next, ok := pendingMsgs.pop()
+			if !ok {
 				waiting = false
 				continue
 			}
 
 			// Notify the outHandler about the next item to
 			// asynchronously send.
-			val := pendingMsgs.Remove(next)
-			p.sendQueue <- val.(outMsg)
+			p.sendQueue <- next
 
 		case iv := <-p.outputInvChan:
 			// No handshake?  They'll find out soon enough.
@@ -1654,6 +1895,14 @@ out:
 				continue
 			}
 
+			// Hold the inventory back while the peer is slow to
+			// drain the previous announcements rather than piling
+			// up more inv messages.  It is announced once the
+			// backlog shrinks.
+			if p.IsBackpressured(SendPriorityNormal) {
+				continue
+			}
+
 			// Create and send as many inv messages as needed to
 			// drain the inventory send queue.
 			invMsg := wire.NewMsgInvSizeHint(uint(invSendQueue.Len()))
@@ -1690,9 +1939,7 @@ out:
 
 	// Drain any wait channels before we go away so we don't leave something
 	// waiting for us.
-	for e := pendingMsgs.Front(); e != nil; e = pendingMsgs.Front() {
-		val := pendingMsgs.Remove(e)
-		msg := val.(outMsg)
+	for msg, ok := pendingMsgs.pop(); ok; msg, ok = pendingMsgs.pop() {
 		if msg.doneChan != nil {
 			msg.doneChan <- struct{}{}
 		}
@@ -1964,7 +2211,9 @@ func (p *Peer) readRemoteVersionMsg() error {
 	p.statsMtx.Lock()
 	p.lastBlock = msg.LastBlock
 	p.startingHeight = msg.LastBlock
-	p.timeOffset = msg.Timestamp.Unix() - time.Now().Unix()
+	p.remoteTime = msg.Timestamp
+	p.remoteTimeRecv = time.Now()
+	p.timeOffset = msg.Timestamp.Unix() - p.remoteTimeRecv.Unix()
 	p.statsMtx.Unlock()
 
 	// Set the peer's ID, user agent, and potentially the flag which
@@ -2019,27 +2268,56 @@ func (p *Peer) readRemoteVersionMsg() error {
 	return nil
 }
 
-// readRemoteVerAckMsg waits for the next message to arrive from the remote
-// peer. If this message is not a verack message, then an error is returned.
-// This method is to be used as part of the version negotiation upon a new
-// connection.
+// readRemoteVerAckMsg waits for the verack message from the remote peer.  The
+// sendaddrv2 message may precede it when the negotiated protocol version
+// supports it, and messages which aren't known are ignored since newer
+// protocol versions send them during negotiation.  Any other message results
+// in an error.  This method is to be used as part of the version negotiation
+// upon a new connection.
 func (p *Peer) readRemoteVerAckMsg() error {
-	// Read the next message from the wire.
-	remoteMsg, _, err := p.readMessage(wire.LatestEncoding)
-	if err != nil {
-		return err
-	}
+	var msg *wire.MsgVerAck
+	for msg == nil {
+		// Read the next message from the wire.
+		remoteMsg, _, err := p.readMessage(wire.LatestEncoding)
+		if err == wire.ErrUnknownMessage {
+			log.Debugf("Ignoring unknown message from %s during "+
+				"negotiation", p)
+			continue
+		}
+		if err != nil {
+			return err
+		}
 
-	// It should be a verack message, otherwise send a reject message to the
-	// peer explaining why.
-	msg, ok := remoteMsg.(*wire.MsgVerAck)
-	if !ok {
-		reason := "a verack message must follow version"
-		rejectMsg := wire.NewMsgReject(
-			msg.Command(), wire.RejectMalformed, reason,
-		)
-		_ = p.writeMessage(rejectMsg, wire.LatestEncoding)
-		return errors.New(reason)
+		switch m := remoteMsg.(type) {
+		case *wire.MsgVerAck:
+			msg = m
+
+		case *wire.MsgSendAddrV2:
+			if p.ProtocolVersion() < wire.AddrV2Version {
+				log.Debugf("Ignoring sendaddrv2 message from %s "+
+					"with protocol version %d", p,
+					p.ProtocolVersion())
+				continue
+			}
+
+			p.flagsMtx.Lock()
+			p.sendAddrV2 = true
+			p.flagsMtx.Unlock()
+
+			if p.cfg.Listeners.OnSendAddrV2 != nil {
+				p.cfg.Listeners.OnSendAddrV2(p, m)
+			}
+
+		default:
+			// It should be a verack message, otherwise send a
+			// reject message to the peer explaining why.
+			reason := "a verack message must follow version"
+			rejectMsg := wire.NewMsgReject(
+				remoteMsg.Command(), wire.RejectMalformed, reason,
+			)
+			_ = p.writeMessage(rejectMsg, wire.LatestEncoding)
+			return errors.New(reason)
+		}
 	}
 
 	p.flagsMtx.Lock()
@@ -2125,14 +2403,63 @@ func (p *Peer) writeLocalVersionMsg() error {
 	return p.writeMessage(localVerMsg, wire.LatestEncoding)
 }
 
+// writeSendAddrV2Msg signals support for addrv2 messages to the remote peer
+// when the negotiated protocol version supports them.  BIP0155 requires it to
+// be sent after the version message but before the verack message.
+func (p *Peer) writeSendAddrV2Msg() error {
+	if p.ProtocolVersion() < wire.AddrV2Version {
+		return nil
+	}
+
+	return p.writeMessage(wire.NewMsgSendAddrV2(), wire.LatestEncoding)
+}
+
+// negotiateTransport performs the BIP0324 handshake with the peer when the v2
+// transport is enabled and returns what messages of the v1 transport are read
+// from.  Inbound connections from peers which use the v1 transport are
+// detected and continue to use it by replaying the bytes read during the
+// detection, while a failed handshake with an outbound peer is recorded so the
+// caller is able to reconnect using the v1 transport.
+func (p *Peer) negotiateTransport() (io.Reader, error) {
+	if !p.cfg.V2Transport {
+		return p.conn, nil
+	}
+
+	t := newV2Transport(p.conn, p.cfg.ChainParams.Net, !p.inbound)
+	err := t.handshake()
+	atomic.AddUint64(&p.bytesReceived, uint64(t.bytesRead))
+	atomic.AddUint64(&p.bytesSent, uint64(t.bytesWritten))
+	switch {
+	case err == errV1Transport:
+		log.Debugf("Peer %s is using the v1 transport", p)
+		return newV1ReplayConn(p.conn, t.v1Prefix), nil
+
+	case err != nil:
+		if !p.inbound {
+			p.flagsMtx.Lock()
+			p.v2HandshakeFailed = true
+			p.flagsMtx.Unlock()
+		}
+		return nil, fmt.Errorf("v2 handshake failed: %v", err)
+	}
+
+	log.Debugf("Established v2 transport with %s (session id %x)", p,
+		t.sessionID)
+	p.flagsMtx.Lock()
+	p.v2 = t
+	p.flagsMtx.Unlock()
+	return p.conn, nil
+}
+
 // negotiateInboundProtocol performs the negotiation protocol for an inbound
 // peer. The events should occur in the following order, otherwise an error is
 // returned:
 //
 //   1. Remote peer sends their version.
 //   2. We send our version.
-//   3. We send our verack.
-//   4. Remote peer sends their verack.
+//   3. We send our sendaddrv2 if the negotiated version supports it.
+//   4. We send our verack.
+//   5. Remote peer sends their verack, optionally preceded by sendaddrv2.
 func (p *Peer) negotiateInboundProtocol() error {
 	if err := p.readRemoteVersionMsg(); err != nil {
 		return err
@@ -2142,6 +2469,10 @@ func (p *Peer) negotiateInboundProtocol() error {
 		return err
 	}
 
+	if err := p.writeSendAddrV2Msg(); err != nil {
+		return err
+	}
+
 	err := p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
 	if err != nil {
 		return err
@@ -2156,8 +2487,9 @@ func (p *Peer) negotiateInboundProtocol() error {
 //
 //   1. We send our version.
 //   2. Remote peer sends their version.
-//   3. Remote peer sends their verack.
-//   4. We send our verack.
+//   3. Remote peer sends their verack, optionally preceded by sendaddrv2.
+//   4. We send our sendaddrv2 if the negotiated version supports it.
+//   5. We send our verack.
 func (p *Peer) negotiateOutboundProtocol() error {
 	if err := p.writeLocalVersionMsg(); err != nil {
 		return err
@@ -2171,6 +2503,10 @@ func (p *Peer) negotiateOutboundProtocol() error {
 		return err
 	}
 
+	if err := p.writeSendAddrV2Msg(); err != nil {
+		return err
+	}
+
 	return p.writeMessage(wire.NewMsgVerAck(), wire.LatestEncoding)
 }
 
@@ -2178,7 +2514,30 @@ func (p *Peer) negotiateOutboundProtocol() error {
 func (p *Peer) start() error {
 	log.Tracef("Starting peer %s", p)
 
+	// Negotiate the transport and then the protocol within the specified
+	// negotiateTimeout.
+	timeout := time.After(negotiateTimeout)
 	negotiateErr := make(chan error, 1)
+	v1Reader := make(chan io.Reader, 1)
+	go func() {
+		r, err := p.negotiateTransport()
+		if err != nil {
+			negotiateErr <- err
+			return
+		}
+		v1Reader <- r
+	}()
+	select {
+	case err := <-negotiateErr:
+		p.Disconnect()
+		return err
+	case r := <-v1Reader:
+		p.v1Reader = r
+	case <-timeout:
+		p.Disconnect()
+		return errors.New("protocol negotiation timeout")
+	}
+
 	go func() {
 		if p.inbound {
 			negotiateErr <- p.negotiateInboundProtocol()
@@ -2186,15 +2545,13 @@ func (p *Peer) start() error {
 			negotiateErr <- p.negotiateOutboundProtocol()
 		}
 	}()
-
-	// Negotiate the protocol within the specified negotiateTimeout.
 	select {
 	case err := <-negotiateErr:
 		if err != nil {
 			p.Disconnect()
 			return err
 		}
-	case <-time.After(negotiateTimeout):
+	case <-timeout:
 		p.Disconnect()
 		return errors.New("protocol negotiation timeout")
 	}
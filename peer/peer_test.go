@@ -6,6 +6,7 @@
 package peer_test
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"net"
@@ -432,6 +433,18 @@ func TestPeerListeners(t *testing.T) {
 			OnMerkleBlock: func(p *peer.Peer, msg *wire.MsgMerkleBlock) {
 				ok <- msg
 			},
+			OnSendTxRcncl: func(p *peer.Peer, msg *wire.MsgSendTxRcncl) {
+				ok <- msg
+			},
+			OnReqRecon: func(p *peer.Peer, msg *wire.MsgReqRecon) {
+				ok <- msg
+			},
+			OnSketch: func(p *peer.Peer, msg *wire.MsgSketch) {
+				ok <- msg
+			},
+			OnReconcilDiff: func(p *peer.Peer, msg *wire.MsgReconcilDiff) {
+				ok <- msg
+			},
 			OnVersion: func(p *peer.Peer, msg *wire.MsgVersion) *wire.MsgReject {
 				ok <- msg
 				return nil
@@ -584,6 +597,22 @@ func TestPeerListeners(t *testing.T) {
 			wire.NewMsgMerkleBlock(wire.NewBlockHeader(1,
 				&chainhash.Hash{}, &chainhash.Hash{}, 1, 1)),
 		},
+		{
+			"OnSendTxRcncl",
+			wire.NewMsgSendTxRcncl(wire.TxReconciliationVersion, 1),
+		},
+		{
+			"OnReqRecon",
+			wire.NewMsgReqRecon(1, 8191),
+		},
+		{
+			"OnSketch",
+			wire.NewMsgSketch([]byte{0x01, 0x00, 0x00, 0x00}),
+		},
+		{
+			"OnReconcilDiff",
+			wire.NewMsgReconcilDiff(true, []uint32{1}),
+		},
 		// only one version message is allowed
 		// only one verack message is allowed
 		{
@@ -917,7 +946,323 @@ func TestDuplicateVersionMsg(t *testing.T) {
 	}
 }
 
+// TestV2TransportPeers ensures peers negotiate the encrypted v2 transport when
+// both sides enable it and that inbound peers with the v2 transport enabled
+// still accept peers which only speak the v1 transport.
+func TestV2TransportPeers(t *testing.T) {
+	tests := []struct {
+		name      string
+		inboundV2 bool
+		outbound  bool
+		wantV2    bool
+	}{
+		{name: "both v2", inboundV2: true, outbound: true, wantV2: true},
+		{name: "v1 outbound", inboundV2: true, outbound: false},
+		{name: "v1 inbound", inboundV2: false, outbound: false},
+	}
+
+	for _, test := range tests {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("%s: unable to listen: %v", test.name, err)
+		}
+
+		verack := make(chan struct{}, 2)
+		peerCfg := peer.Config{
+			Listeners: peer.MessageListeners{
+				OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+					verack <- struct{}{}
+				},
+			},
+			UserAgentName:    "peer",
+			UserAgentVersion: "1.0",
+			ChainParams:      &chaincfg.MainNetParams,
+		}
+		inCfg, outCfg := peerCfg, peerCfg
+		inCfg.V2Transport = test.inboundV2
+		outCfg.V2Transport = test.outbound
+
+		inPeer := peer.NewInboundPeer(&inCfg)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			inPeer.AssociateConnection(conn)
+		}()
+
+		outPeer, err := peer.NewOutboundPeer(&outCfg,
+			listener.Addr().String())
+		if err != nil {
+			t.Fatalf("%s: NewOutboundPeer: unexpected err: %v",
+				test.name, err)
+		}
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("%s: unable to dial: %v", test.name, err)
+		}
+		outPeer.AssociateConnection(conn)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second * 5):
+				t.Fatalf("%s: verack timeout", test.name)
+			}
+		}
+		if inPeer.V2Transport() != test.wantV2 {
+			t.Errorf("%s: inbound peer V2Transport - got %v, want %v",
+				test.name, inPeer.V2Transport(), test.wantV2)
+		}
+		if outPeer.V2Transport() != test.wantV2 {
+			t.Errorf("%s: outbound peer V2Transport - got %v, want %v",
+				test.name, outPeer.V2Transport(), test.wantV2)
+		}
+
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+		inPeer.WaitForDisconnect()
+		outPeer.WaitForDisconnect()
+		listener.Close()
+	}
+}
+
+// TestV2TransportHandshakeFailure ensures an outbound peer which attempts the
+// v2 transport with a peer that does not support it reports the failed
+// handshake so the connection can be retried using the v1 transport.
+func TestV2TransportHandshakeFailure(t *testing.T) {
+	inConn, outConn := pipe(
+		&conn{raddr: "10.0.0.1:8333"},
+		&conn{raddr: "10.0.0.2:8333"},
+	)
+
+	// Simulate a v1 peer which disconnects upon receiving data that is not
+	// a valid message.
+	go func() {
+		wire.ReadMessage(inConn, wire.ProtocolVersion, wire.MainNet)
+		inConn.Close()
+		outConn.Close()
+	}()
+
+	outPeer, err := peer.NewOutboundPeer(&peer.Config{
+		ChainParams: &chaincfg.MainNetParams,
+		V2Transport: true,
+	}, "10.0.0.2:8333")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err: %v", err)
+	}
+	outPeer.AssociateConnection(outConn)
+
+	disconnected := make(chan struct{})
+	go func() {
+		outPeer.WaitForDisconnect()
+		close(disconnected)
+	}()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second * 5):
+		t.Fatal("peer did not disconnect")
+	}
+	if !outPeer.V2HandshakeFailed() {
+		t.Fatal("V2HandshakeFailed did not report the failed handshake")
+	}
+}
+
 func init() {
 	// Allow self connection when running the tests.
 	peer.TstAllowSelfConns()
 }
+
+// TestPeerAddrV2 ensures peers which negotiate a protocol version supporting
+// BIP0155 signal support for addrv2 messages during negotiation and are able
+// to relay addresses which can't be encoded in addr messages, while peers with
+// an older protocol version don't.
+func TestPeerAddrV2(t *testing.T) {
+	tests := []struct {
+		name       string
+		pver       uint32
+		wantAddrV2 bool
+	}{
+		{"max protocol version", peer.MaxProtocolVersion, true},
+		{"before addrv2", wire.FeeFilterVersion, false},
+	}
+
+	for _, test := range tests {
+		verack := make(chan struct{}, 2)
+		sendAddrV2 := make(chan struct{}, 2)
+		addrV2 := make(chan *wire.MsgAddrV2, 1)
+		listeners := peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+			OnSendAddrV2: func(p *peer.Peer, msg *wire.MsgSendAddrV2) {
+				sendAddrV2 <- struct{}{}
+			},
+			OnAddrV2: func(p *peer.Peer, msg *wire.MsgAddrV2) {
+				addrV2 <- msg
+			},
+		}
+		inCfg := &peer.Config{
+			Listeners:       listeners,
+			ChainParams:     &chaincfg.MainNetParams,
+			ProtocolVersion: test.pver,
+			TrickleInterval: time.Second * 10,
+		}
+		outCfg := &peer.Config{
+			Listeners:       listeners,
+			ChainParams:     &chaincfg.MainNetParams,
+			TrickleInterval: time.Second * 10,
+		}
+
+		inConn, outConn := pipe(
+			&conn{raddr: "10.0.0.1:8333"},
+			&conn{raddr: "10.0.0.2:8333"},
+		)
+		inPeer := peer.NewInboundPeer(inCfg)
+		inPeer.AssociateConnection(inConn)
+		outPeer, err := peer.NewOutboundPeer(outCfg, "10.0.0.2:8333")
+		if err != nil {
+			t.Fatalf("%s: NewOutboundPeer: unexpected err %v", test.name,
+				err)
+		}
+		outPeer.AssociateConnection(outConn)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-verack:
+			case <-time.After(time.Second):
+				t.Fatalf("%s: verack timeout", test.name)
+			}
+		}
+
+		if inPeer.WantsAddrV2() != test.wantAddrV2 ||
+			outPeer.WantsAddrV2() != test.wantAddrV2 {
+
+			t.Fatalf("%s: wrong WantsAddrV2 - got %v (inbound) and %v "+
+				"(outbound), want %v", test.name,
+				inPeer.WantsAddrV2(), outPeer.WantsAddrV2(),
+				test.wantAddrV2)
+		}
+		if !test.wantAddrV2 {
+			inPeer.Disconnect()
+			outPeer.Disconnect()
+			continue
+		}
+		if len(sendAddrV2) != 2 {
+			t.Fatalf("%s: wrong number of sendaddrv2 messages - got "+
+				"%d, want 2", test.name, len(sendAddrV2))
+		}
+
+		// Relay a Tor v3 address which can't be encoded in an addr
+		// message.
+		na := wire.NewNetAddressV2(wire.NetworkTorV3,
+			bytes.Repeat([]byte{0x01}, 32), 8333, wire.SFNodeNetwork)
+		sent, err := outPeer.PushAddrV2Msg([]*wire.NetAddressV2{na})
+		if err != nil || len(sent) != 1 {
+			t.Fatalf("%s: PushAddrV2Msg: unexpected result %v, %v",
+				test.name, sent, err)
+		}
+		select {
+		case msg := <-addrV2:
+			if len(msg.AddrList) != 1 ||
+				msg.AddrList[0].String() != na.String() {
+
+				t.Fatalf("%s: wrong addrv2 addresses - got %v, "+
+					"want %v", test.name, msg.AddrList, na)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: addrv2 timeout", test.name)
+		}
+
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+	}
+}
+
+// chanTap is a peer.MessageTap which sends copies of the tapped records to a
+// channel.
+type chanTap chan peer.TapRecord
+
+// TapMessage sends a copy of the passed record to the channel.
+func (c chanTap) TapMessage(p *peer.Peer, rec *peer.TapRecord) {
+	c <- *rec
+}
+
+// TestPeerMessageTap ensures the message tap of a peer receives a record of
+// every message read from and written to the peer.
+func TestPeerMessageTap(t *testing.T) {
+	tap := make(chanTap, 100)
+	verack := make(chan struct{}, 1)
+	inCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+		},
+		ChainParams:     &chaincfg.MainNetParams,
+		TrickleInterval: time.Second * 10,
+		MessageTap:      tap,
+	}
+	outCfg := &peer.Config{
+		ChainParams:     &chaincfg.MainNetParams,
+		TrickleInterval: time.Second * 10,
+	}
+
+	inConn, outConn := pipe(
+		&conn{raddr: "10.0.0.1:8333"},
+		&conn{raddr: "10.0.0.2:8333"},
+	)
+	inPeer := peer.NewInboundPeer(inCfg)
+	inPeer.AssociateConnection(inConn)
+	outPeer, err := peer.NewOutboundPeer(outCfg, "10.0.0.2:8333")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err %v", err)
+	}
+	outPeer.AssociateConnection(outConn)
+	defer inPeer.Disconnect()
+	defer outPeer.Disconnect()
+
+	select {
+	case <-verack:
+	case <-time.After(time.Second):
+		t.Fatal("verack timeout")
+	}
+
+	// Wait for the records of the version and verack messages in both
+	// directions.
+	want := map[string]bool{
+		"in " + wire.CmdVersion:  true,
+		"out " + wire.CmdVersion: true,
+		"in " + wire.CmdVerAck:   true,
+		"out " + wire.CmdVerAck:  true,
+	}
+	for len(want) > 0 {
+		var rec peer.TapRecord
+		select {
+		case rec = <-tap:
+		case <-time.After(time.Second):
+			t.Fatalf("tap timeout - missing records %v", want)
+		}
+		delete(want, rec.Direction.String()+" "+rec.Command)
+
+		if rec.Err != nil || rec.Msg == nil || rec.Time.IsZero() {
+			t.Fatalf("unexpected record %+v", rec)
+		}
+		if rec.Msg.Command() != rec.Command {
+			t.Fatalf("mismatched command - got %s, want %s",
+				rec.Command, rec.Msg.Command())
+		}
+		var buf bytes.Buffer
+		wire.WriteMessage(&buf, rec.Msg, inPeer.ProtocolVersion(),
+			wire.MainNet)
+		if rec.Size != buf.Len() {
+			t.Fatalf("%s %s: wrong size - got %d, want %d",
+				rec.Direction, rec.Command, rec.Size, buf.Len())
+		}
+		wantPayload := rec.Direction == peer.TapInbound
+		if (rec.Payload != nil) != wantPayload {
+			t.Fatalf("%s %s: unexpected payload %x", rec.Direction,
+				rec.Command, rec.Payload)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// oversizedMsgBanScore is the persistent ban score reported when a peer
+	// sends a message which exceeds the maximum allowed payload size.
+	oversizedMsgBanScore = 100
+
+	// malformedMsgBanScore is the persistent ban score reported when a peer
+	// sends a message which can't be decoded.
+	malformedMsgBanScore = 10
+)
+
+// RateLimit describes the maximum number of messages of a single command a
+// peer is allowed to send within an interval.  Each message beyond the limit
+// is dropped without being handled and the ban score is reported through the
+// AddBanScore callback of the peer config.
+type RateLimit struct {
+	// Count is the number of messages allowed within the interval.
+	Count uint32
+
+	// Interval is the duration of the window the messages are counted in.
+	Interval time.Duration
+
+	// BanScore is the decaying ban score reported for each message which
+	// exceeds the limit.
+	BanScore uint32
+}
+
+// DefaultRateLimits returns the default per-command rate limits.  The limits
+// are generous enough to never be hit by well-behaved peers, including ones
+// which are syncing the chain from the local peer.
+func DefaultRateLimits() map[string]RateLimit {
+	return map[string]RateLimit{
+		wire.CmdAddr:       {Count: 20, Interval: time.Minute, BanScore: 10},
+		wire.CmdAddrV2:     {Count: 20, Interval: time.Minute, BanScore: 10},
+		wire.CmdGetAddr:    {Count: 3, Interval: time.Minute, BanScore: 10},
+		wire.CmdPing:       {Count: 20, Interval: time.Minute, BanScore: 10},
+		wire.CmdMemPool:    {Count: 3, Interval: time.Minute, BanScore: 34},
+		wire.CmdGetData:    {Count: 6000, Interval: time.Minute, BanScore: 10},
+		wire.CmdGetHeaders: {Count: 600, Interval: time.Minute, BanScore: 10},
+		wire.CmdGetBlocks:  {Count: 600, Interval: time.Minute, BanScore: 10},
+	}
+}
+
+// rateWindow tracks the number of messages received within the current window
+// of a rate limit.
+type rateWindow struct {
+	start time.Time
+	count uint32
+}
+
+// rateLimiter enforces per-command rate limits using fixed windows.  It is
+// only accessed from the input handler of a peer and therefore does not
+// require locking.
+type rateLimiter struct {
+	limits  map[string]RateLimit
+	windows map[string]*rateWindow
+}
+
+// newRateLimiter returns a new rate limiter enforcing the passed limits.
+// Limits with a zero count or interval are ignored.
+func newRateLimiter(limits map[string]RateLimit) *rateLimiter {
+	r := &rateLimiter{
+		limits:  make(map[string]RateLimit, len(limits)),
+		windows: make(map[string]*rateWindow, len(limits)),
+	}
+	for cmd, limit := range limits {
+		if limit.Count == 0 || limit.Interval <= 0 {
+			continue
+		}
+		r.limits[cmd] = limit
+	}
+	return r
+}
+
+// allow records a message with the passed command received at the passed time
+// and returns whether it is within the rate limit for the command along with
+// the limit itself.
+func (r *rateLimiter) allow(cmd string, now time.Time) (RateLimit, bool) {
+	limit, ok := r.limits[cmd]
+	if !ok {
+		return limit, true
+	}
+
+	window, ok := r.windows[cmd]
+	if !ok || now.Sub(window.start) >= limit.Interval {
+		window = &rateWindow{start: now}
+		r.windows[cmd] = window
+	}
+	window.count++
+	return limit, window.count <= limit.Count
+}
+
+// isOversizedMsgError returns whether the passed read error was caused by a
+// message exceeding the maximum allowed payload size.
+func isOversizedMsgError(err error) bool {
+	msgErr, ok := err.(*wire.MessageError)
+	if !ok {
+		return false
+	}
+	return strings.HasPrefix(msgErr.Description, "message payload is too large") ||
+		strings.HasPrefix(msgErr.Description, "payload exceeds max length")
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestRateLimiter ensures the rate limiter allows the configured number of
+// messages per window, drops the messages beyond it, and ignores commands
+// without a limit.
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(map[string]RateLimit{
+		wire.CmdPing:    {Count: 2, Interval: time.Minute, BanScore: 10},
+		wire.CmdGetAddr: {Count: 0, Interval: time.Minute, BanScore: 10},
+	})
+
+	start := time.Unix(1600000000, 0)
+	tests := []struct {
+		name    string
+		cmd     string
+		offset  time.Duration
+		allowed bool
+	}{
+		{"first ping", wire.CmdPing, 0, true},
+		{"second ping", wire.CmdPing, time.Second, true},
+		{"third ping", wire.CmdPing, 2 * time.Second, false},
+		{"fourth ping", wire.CmdPing, 59 * time.Second, false},
+		{"ping in next window", wire.CmdPing, time.Minute, true},
+		{"disabled limit", wire.CmdGetAddr, time.Minute, true},
+		{"no limit", wire.CmdAddr, time.Minute, true},
+	}
+
+	for _, test := range tests {
+		limit, allowed := limiter.allow(test.cmd, start.Add(test.offset))
+		if allowed != test.allowed {
+			t.Fatalf("%s: unexpected result - got %v, want %v",
+				test.name, allowed, test.allowed)
+		}
+		if !allowed && limit.BanScore != 10 {
+			t.Fatalf("%s: unexpected ban score - got %d, want 10",
+				test.name, limit.BanScore)
+		}
+	}
+}
+
+// TestOversizedMsgError ensures oversized messages are detected from the
+// errors returned when reading them.
+func TestOversizedMsgError(t *testing.T) {
+	pver := wire.ProtocolVersion
+	btcnet := wire.MainNet
+
+	// Encode a ping message and modify the payload length in its header so
+	// it exceeds the maximum payload of a ping.
+	var buf bytes.Buffer
+	if _, err := wire.WriteMessageN(&buf, wire.NewMsgPing(1), pver,
+		btcnet); err != nil {
+		t.Fatalf("WriteMessageN: unexpected error: %v", err)
+	}
+	oversized := buf.Bytes()
+	oversized[16] = 0xff
+
+	_, _, err := wire.ReadMessage(bytes.NewReader(oversized), pver, btcnet)
+	if !isOversizedMsgError(err) {
+		t.Fatalf("isOversizedMsgError: unexpected result for %v", err)
+	}
+	if isOversizedMsgError(io.EOF) {
+		t.Fatal("isOversizedMsgError: unexpected result for EOF")
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// RequestTimeout describes a request sent to the remote peer which was not
+// answered by its deadline.  It is delivered through the OnRequestTimeout
+// callback of the peer config right before the peer is disconnected for
+// stalling, so the caller can request the data from other peers right away.
+type RequestTimeout struct {
+	// Command is the command of the request which timed out, such as
+	// wire.CmdGetData or wire.CmdGetHeaders.
+	Command string
+
+	// InvList houses the inventory vectors which were requested but
+	// neither delivered nor reported as not found.  It is only set for
+	// getdata requests.
+	InvList []*wire.InvVect
+
+	// Sent is the time the oldest of the timed out requests was sent.
+	Sent time.Time
+}
+
+// requestKind groups the inventory types requested with getdata by the kind of
+// message which answers them.
+type requestKind uint8
+
+const (
+	// requestBlock is answered by a block or merkleblock message.
+	requestBlock requestKind = iota
+
+	// requestTx is answered by a tx message.
+	requestTx
+)
+
+// itemKey identifies a single item requested with getdata.
+type itemKey struct {
+	kind requestKind
+	hash chainhash.Hash
+}
+
+// pendingRequest houses a request which is waiting for a response along with
+// its deadline.
+type pendingRequest struct {
+	command  string
+	sent     time.Time
+	deadline time.Time
+	inv      *wire.InvVect
+}
+
+// requestManager tracks the deadlines of all outstanding requests sent to a
+// peer.  Each item requested with getdata and each getheaders request has its
+// own deadline, while requests which are answered by a single message, such
+// as version, are tracked by the command of the expected response.
+//
+// requestManager is only accessed from the stall handler of a peer and
+// therefore does not require locking.
+type requestManager struct {
+	timeout time.Duration
+
+	// responses tracks the requests which are answered by a single message
+	// keyed by the command of the expected response.
+	responses map[string]*pendingRequest
+
+	// headers tracks the outstanding getheaders requests in the order they
+	// were sent.  Each headers message answers the oldest of them.
+	headers []*pendingRequest
+
+	// items tracks the items requested with getdata which were neither
+	// delivered nor reported as not found.
+	items map[itemKey]*pendingRequest
+
+	// lastItemProgress is the last time one of the items requested with
+	// getdata was delivered.  A peer which keeps delivering items is not
+	// considered stalled even when a large batch of items takes longer
+	// than the timeout to deliver.
+	lastItemProgress time.Time
+
+	// numBlocks and numTxns are the number of outstanding items of each
+	// kind.  They allow received messages to be ignored without hashing
+	// them when there are no outstanding items of their kind.
+	numBlocks int
+	numTxns   int
+}
+
+// newRequestManager returns a new request manager which assigns the passed
+// timeout to requests.
+func newRequestManager(timeout time.Duration) *requestManager {
+	return &requestManager{
+		timeout:   timeout,
+		responses: make(map[string]*pendingRequest),
+		items:     make(map[itemKey]*pendingRequest),
+	}
+}
+
+// invItemKey returns the key of the passed inventory vector along with whether
+// it refers to a kind of item the request manager tracks.
+func invItemKey(iv *wire.InvVect) (itemKey, bool) {
+	switch iv.Type {
+	case wire.InvTypeBlock, wire.InvTypeWitnessBlock,
+		wire.InvTypeFilteredBlock, wire.InvTypeFilteredWitnessBlock:
+		return itemKey{requestBlock, iv.Hash}, true
+
+	case wire.InvTypeTx, wire.InvTypeWitnessTx:
+		return itemKey{requestTx, iv.Hash}, true
+	}
+	return itemKey{}, false
+}
+
+// addItem starts tracking the passed item requested with getdata.
+func (r *requestManager) addItem(iv *wire.InvVect, now time.Time) {
+	key, ok := invItemKey(iv)
+	if !ok {
+		return
+	}
+	if _, ok := r.items[key]; ok {
+		return
+	}
+
+	r.items[key] = &pendingRequest{
+		command:  wire.CmdGetData,
+		sent:     now,
+		deadline: now.Add(r.timeout),
+		inv:      iv,
+	}
+	if key.kind == requestBlock {
+		r.numBlocks++
+	} else {
+		r.numTxns++
+	}
+}
+
+// removeItem stops tracking the passed item and returns whether it was being
+// tracked.
+func (r *requestManager) removeItem(key itemKey) bool {
+	if _, ok := r.items[key]; !ok {
+		return false
+	}
+
+	delete(r.items, key)
+	if key.kind == requestBlock {
+		r.numBlocks--
+	} else {
+		r.numTxns--
+	}
+	return true
+}
+
+// deliverItem stops tracking the passed item when it was delivered and records
+// the progress.
+func (r *requestManager) deliverItem(key itemKey, now time.Time) {
+	if r.removeItem(key) {
+		r.lastItemProgress = now
+	}
+}
+
+// sent records the passed message sent to the remote peer at the passed time
+// and adds deadlines for the responses it expects.
+//
+// NOTE: Pings are intentionally ignored here since they are typically sent
+// asynchronously and as a result of a long backlock of messages, such as is
+// typical in the case of initial block download, the response won't be
+// received in time.
+func (r *requestManager) sent(msg wire.Message, now time.Time) {
+	request := &pendingRequest{
+		command:  msg.Command(),
+		sent:     now,
+		deadline: now.Add(r.timeout),
+	}
+
+	switch m := msg.(type) {
+	case *wire.MsgVersion:
+		// Expects a verack message.
+		r.responses[wire.CmdVerAck] = request
+
+	case *wire.MsgMemPool, *wire.MsgGetBlocks:
+		// Expects an inv message.
+		r.responses[wire.CmdInv] = request
+
+	case *wire.MsgGetData:
+		// Expects a block, merkleblock, tx, or notfound message for
+		// each item.
+		for _, iv := range m.InvList {
+			r.addItem(iv, now)
+		}
+
+	case *wire.MsgGetHeaders:
+		// Expects a headers message.  Use a longer deadline since it
+		// can take a while for the remote peer to load all of the
+		// headers.
+		request.deadline = now.Add(r.timeout * 3)
+		r.headers = append(r.headers, request)
+	}
+}
+
+// received records the passed message received from the remote peer at the
+// passed time and removes the deadlines of the requests it answers.
+func (r *requestManager) received(msg wire.Message, now time.Time) {
+	switch m := msg.(type) {
+	case *wire.MsgBlock:
+		if r.numBlocks > 0 {
+			r.deliverItem(itemKey{requestBlock, m.BlockHash()}, now)
+		}
+
+	case *wire.MsgMerkleBlock:
+		if r.numBlocks > 0 {
+			r.deliverItem(itemKey{requestBlock, m.Header.BlockHash()},
+				now)
+		}
+
+	case *wire.MsgTx:
+		if r.numTxns > 0 {
+			r.deliverItem(itemKey{requestTx, m.TxHash()}, now)
+		}
+
+	case *wire.MsgNotFound:
+		for _, iv := range m.InvList {
+			if key, ok := invItemKey(iv); ok {
+				r.deliverItem(key, now)
+			}
+		}
+
+	case *wire.MsgHeaders:
+		if len(r.headers) > 0 {
+			r.headers[0] = nil
+			r.headers = r.headers[1:]
+		}
+
+	default:
+		delete(r.responses, msg.Command())
+	}
+}
+
+// extend moves the deadlines of all outstanding requests forward by the passed
+// duration.  It is used to account for the time spent in callbacks, since new
+// messages aren't read until the previous one is finished processing.
+func (r *requestManager) extend(d time.Duration) {
+	for _, request := range r.responses {
+		request.deadline = request.deadline.Add(d)
+	}
+	for _, request := range r.headers {
+		request.deadline = request.deadline.Add(d)
+	}
+	for _, request := range r.items {
+		request.deadline = request.deadline.Add(d)
+	}
+	if !r.lastItemProgress.IsZero() {
+		r.lastItemProgress = r.lastItemProgress.Add(d)
+	}
+}
+
+// expired returns the requests which were not answered by their deadline
+// adjusted by the passed offset as of the passed time.  The items requested
+// with getdata are grouped into a single timeout.
+func (r *requestManager) expired(now time.Time, offset time.Duration) []*RequestTimeout {
+	isExpired := func(request *pendingRequest) bool {
+		return !now.Before(request.deadline.Add(offset))
+	}
+
+	var timeouts []*RequestTimeout
+	for _, request := range r.responses {
+		if isExpired(request) {
+			timeouts = append(timeouts, &RequestTimeout{
+				Command: request.command,
+				Sent:    request.sent,
+			})
+		}
+	}
+	if len(r.headers) > 0 && isExpired(r.headers[0]) {
+		timeouts = append(timeouts, &RequestTimeout{
+			Command: wire.CmdGetHeaders,
+			Sent:    r.headers[0].sent,
+		})
+	}
+
+	// Items are only considered stalled once the peer has also stopped
+	// delivering any other items.
+	progressDeadline := r.lastItemProgress.Add(r.timeout + offset)
+	if len(r.items) == 0 || now.Before(progressDeadline) {
+		return timeouts
+	}
+	var itemTimeout *RequestTimeout
+	for _, request := range r.items {
+		if !isExpired(request) {
+			continue
+		}
+		if itemTimeout == nil {
+			itemTimeout = &RequestTimeout{
+				Command: wire.CmdGetData,
+				Sent:    request.sent,
+			}
+			timeouts = append(timeouts, itemTimeout)
+		}
+		itemTimeout.InvList = append(itemTimeout.InvList, request.inv)
+		if request.sent.Before(itemTimeout.Sent) {
+			itemTimeout.Sent = request.sent
+		}
+	}
+	return timeouts
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestRequestManagerItems ensures the items requested with getdata are tracked
+// individually, are removed once delivered or reported as not found, and only
+// time out once the peer stops delivering items.
+func TestRequestManagerItems(t *testing.T) {
+	timeout := 30 * time.Second
+	r := newRequestManager(timeout)
+	start := time.Unix(1600000000, 0)
+
+	block1 := wire.NewMsgBlock(&wire.BlockHeader{Nonce: 1})
+	block2 := wire.NewMsgBlock(&wire.BlockHeader{Nonce: 2})
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxOut(wire.NewTxOut(1, nil))
+	missingTx := chainhash.DoubleHashH([]byte("missing"))
+
+	block1Hash := block1.BlockHash()
+	block2Hash := block2.BlockHash()
+	txHash := tx.TxHash()
+	getData := wire.NewMsgGetData()
+	getData.AddInvVect(wire.NewInvVect(wire.InvTypeWitnessBlock, &block1Hash))
+	getData.AddInvVect(wire.NewInvVect(wire.InvTypeWitnessBlock, &block2Hash))
+	getData.AddInvVect(wire.NewInvVect(wire.InvTypeWitnessTx, &txHash))
+	getData.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &missingTx))
+	r.sent(getData, start)
+
+	// Deliver the first block and report the missing transaction as not
+	// found.
+	r.received(block1, start.Add(10*time.Second))
+	notFound := wire.NewMsgNotFound()
+	notFound.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &missingTx))
+	r.received(notFound, start.Add(10*time.Second))
+	if len(r.items) != 2 || r.numBlocks != 1 || r.numTxns != 1 {
+		t.Fatalf("unexpected outstanding items - got %d items, %d "+
+			"blocks, %d txns, want 2 items, 1 block, 1 txn",
+			len(r.items), r.numBlocks, r.numTxns)
+	}
+
+	// The remaining items must not time out while the peer is still
+	// making progress.
+	if timeouts := r.expired(start.Add(timeout), 0); len(timeouts) != 0 {
+		t.Fatalf("unexpected timeouts while making progress: %v",
+			timeouts)
+	}
+
+	// Once the peer stops delivering items, the remaining ones time out
+	// together.
+	timeouts := r.expired(start.Add(10*time.Second+timeout), 0)
+	if len(timeouts) != 1 {
+		t.Fatalf("unexpected number of timeouts - got %d, want 1",
+			len(timeouts))
+	}
+	if timeouts[0].Command != wire.CmdGetData {
+		t.Fatalf("unexpected timeout command - got %s, want %s",
+			timeouts[0].Command, wire.CmdGetData)
+	}
+	if !timeouts[0].Sent.Equal(start) {
+		t.Fatalf("unexpected sent time - got %v, want %v",
+			timeouts[0].Sent, start)
+	}
+	want := map[chainhash.Hash]struct{}{block2Hash: {}, txHash: {}}
+	if len(timeouts[0].InvList) != len(want) {
+		t.Fatalf("unexpected number of timed out items - got %d, "+
+			"want %d", len(timeouts[0].InvList), len(want))
+	}
+	for _, iv := range timeouts[0].InvList {
+		if _, ok := want[iv.Hash]; !ok {
+			t.Fatalf("unexpected timed out item %v", iv)
+		}
+	}
+
+	// Deliver the remaining items and ensure nothing times out anymore.
+	r.received(block2, start.Add(time.Minute))
+	r.received(tx, start.Add(time.Minute))
+	if timeouts := r.expired(start.Add(time.Hour), 0); len(timeouts) != 0 {
+		t.Fatalf("unexpected timeouts after delivery: %v", timeouts)
+	}
+}
+
+// TestRequestManagerResponses ensures requests which are answered by a single
+// message are tracked until answered and deadlines are extended by the time
+// spent in callbacks.
+func TestRequestManagerResponses(t *testing.T) {
+	timeout := 30 * time.Second
+	r := newRequestManager(timeout)
+	start := time.Unix(1600000000, 0)
+
+	r.sent(&wire.MsgVersion{}, start)
+	r.sent(wire.NewMsgGetHeaders(), start)
+	r.sent(wire.NewMsgGetHeaders(), start.Add(time.Second))
+	r.sent(wire.NewMsgPing(1), start)
+
+	// The version request times out after the timeout, while getheaders
+	// requests get three times as long.
+	timeouts := r.expired(start.Add(timeout), 0)
+	if len(timeouts) != 1 || timeouts[0].Command != wire.CmdVersion {
+		t.Fatalf("unexpected timeouts: %v", timeouts)
+	}
+
+	// Extending the deadlines and applying an offset must push them back.
+	r.extend(5 * time.Second)
+	if timeouts := r.expired(start.Add(timeout), 0); len(timeouts) != 0 {
+		t.Fatalf("unexpected timeouts after extend: %v", timeouts)
+	}
+	if timeouts := r.expired(start.Add(timeout+5*time.Second),
+		time.Second); len(timeouts) != 0 {
+		t.Fatalf("unexpected timeouts with offset: %v", timeouts)
+	}
+
+	// Answer the version and the first getheaders request.  Only the
+	// second getheaders request remains.
+	r.received(&wire.MsgVerAck{}, start.Add(time.Second))
+	r.received(wire.NewMsgHeaders(), start.Add(time.Second))
+	if timeouts := r.expired(start.Add(3*timeout+5*time.Second),
+		0); len(timeouts) != 0 {
+		t.Fatalf("unexpected timeouts after responses: %v", timeouts)
+	}
+	timeouts = r.expired(start.Add(3*timeout+6*time.Second), 0)
+	if len(timeouts) != 1 || timeouts[0].Command != wire.CmdGetHeaders ||
+		!timeouts[0].Sent.Equal(start.Add(time.Second)) {
+
+		t.Fatalf("unexpected timeouts: %v", timeouts)
+	}
+}
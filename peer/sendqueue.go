@@ -0,0 +1,154 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"container/list"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// sendQueueHighWater is the number of messages waiting in a single priority
+// lane of the send queue at which the lane is considered backpressured.
+const sendQueueHighWater = 50
+
+// SendPriority identifies the priority lane of the send queue a message is
+// placed in.  Messages waiting in a lane are always sent before any messages
+// waiting in lanes of lower priority, while messages within the same lane are
+// sent in the order they were queued.
+type SendPriority int
+
+// These constants define the priority lanes of the send queue from the
+// highest to the lowest priority.
+const (
+	// SendPriorityHigh is used for blocks and block announcements as well
+	// as the messages needed to sync them.
+	SendPriorityHigh SendPriority = iota
+
+	// SendPriorityNormal is used for transactions and transaction
+	// announcements along with all other messages without a specific
+	// priority.
+	SendPriorityNormal
+
+	// SendPriorityLow is used for address relay and pings.
+	SendPriorityLow
+
+	// numSendPriorities is the number of priority lanes.
+	numSendPriorities
+)
+
+// Map of send priorities back to their constant names for pretty printing.
+var sendPriorityStrings = map[SendPriority]string{
+	SendPriorityHigh:   "SendPriorityHigh",
+	SendPriorityNormal: "SendPriorityNormal",
+	SendPriorityLow:    "SendPriorityLow",
+}
+
+// String returns the SendPriority in human-readable form.
+func (p SendPriority) String() string {
+	if s, ok := sendPriorityStrings[p]; ok {
+		return s
+	}
+	return "Unknown SendPriority"
+}
+
+// hasBlockInv returns whether any of the passed inventory vectors refers to a
+// block.
+func hasBlockInv(invList []*wire.InvVect) bool {
+	for _, iv := range invList {
+		switch iv.Type {
+		case wire.InvTypeBlock, wire.InvTypeWitnessBlock,
+			wire.InvTypeFilteredBlock, wire.InvTypeFilteredWitnessBlock:
+			return true
+		}
+	}
+	return false
+}
+
+// messagePriority returns the priority lane the passed message is sent in.
+func messagePriority(msg wire.Message) SendPriority {
+	switch m := msg.(type) {
+	case *wire.MsgBlock, *wire.MsgMerkleBlock, *wire.MsgHeaders,
+		*wire.MsgGetHeaders, *wire.MsgGetBlocks:
+		return SendPriorityHigh
+
+	case *wire.MsgInv:
+		if hasBlockInv(m.InvList) {
+			return SendPriorityHigh
+		}
+
+	case *wire.MsgGetData:
+		if hasBlockInv(m.InvList) {
+			return SendPriorityHigh
+		}
+
+	case *wire.MsgAddr, *wire.MsgGetAddr, *wire.MsgPing, *wire.MsgPong:
+		return SendPriorityLow
+	}
+
+	return SendPriorityNormal
+}
+
+// priorityQueue houses the messages waiting to be sent in one lane per
+// priority.  The number of messages waiting in each lane is mirrored to the
+// passed counters so it can be queried concurrently.
+//
+// priorityQueue is only accessed from the queue handler of a peer and therefore
+// does not require locking.
+type priorityQueue struct {
+	lanes [numSendPriorities]*list.List
+	lens  *[numSendPriorities]int32
+}
+
+// newPriorityQueue returns a new empty priority queue which mirrors the number
+// of waiting messages per lane to the passed counters.
+func newPriorityQueue(lens *[numSendPriorities]int32) *priorityQueue {
+	q := &priorityQueue{lens: lens}
+	for i := range q.lanes {
+		q.lanes[i] = list.New()
+	}
+	return q
+}
+
+// push adds the passed message to the end of the lane for its priority.
+func (q *priorityQueue) push(msg outMsg) {
+	priority := messagePriority(msg.msg)
+	q.lanes[priority].PushBack(msg)
+	atomic.AddInt32(&q.lens[priority], 1)
+}
+
+// pop removes and returns the first message of the highest priority lane which
+// is not empty.  It returns false when all lanes are empty.
+func (q *priorityQueue) pop() (outMsg, bool) {
+	for priority, lane := range q.lanes {
+		if e := lane.Front(); e != nil {
+			atomic.AddInt32(&q.lens[priority], -1)
+			return lane.Remove(e).(outMsg), true
+		}
+	}
+	return outMsg{}, false
+}
+
+// SendQueueLen returns the number of messages with the passed priority which
+// are waiting to be sent to the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) SendQueueLen(priority SendPriority) int {
+	if priority < 0 || priority >= numSendPriorities {
+		return 0
+	}
+	return int(atomic.LoadInt32(&p.sendQueueLens[priority]))
+}
+
+// IsBackpressured returns whether the peer is draining the messages with the
+// passed priority slower than they are queued.  Callers producing messages
+// which can be deferred or dropped, such as announcements, should hold them
+// back while the lane is backpressured.
+//
+// This function is safe for concurrent access.
+func (p *Peer) IsBackpressured(priority SendPriority) bool {
+	return p.SendQueueLen(priority) >= sendQueueHighWater
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestMessagePriority ensures messages are assigned to the expected priority
+// lanes.
+func TestMessagePriority(t *testing.T) {
+	blockInv := wire.NewMsgInv()
+	blockInv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &chainhash.Hash{}))
+	blockInv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &chainhash.Hash{}))
+	txInv := wire.NewMsgInv()
+	txInv.AddInvVect(wire.NewInvVect(wire.InvTypeTx, &chainhash.Hash{}))
+	blockGetData := wire.NewMsgGetData()
+	blockGetData.AddInvVect(wire.NewInvVect(wire.InvTypeWitnessBlock,
+		&chainhash.Hash{}))
+
+	tests := []struct {
+		name string
+		msg  wire.Message
+		want SendPriority
+	}{
+		{"block", &wire.MsgBlock{}, SendPriorityHigh},
+		{"headers", wire.NewMsgHeaders(), SendPriorityHigh},
+		{"block inv", blockInv, SendPriorityHigh},
+		{"block getdata", blockGetData, SendPriorityHigh},
+		{"tx", wire.NewMsgTx(wire.TxVersion), SendPriorityNormal},
+		{"tx inv", txInv, SendPriorityNormal},
+		{"tx getdata", wire.NewMsgGetData(), SendPriorityNormal},
+		{"feefilter", wire.NewMsgFeeFilter(1000), SendPriorityNormal},
+		{"addr", wire.NewMsgAddr(), SendPriorityLow},
+		{"ping", wire.NewMsgPing(1), SendPriorityLow},
+		{"pong", wire.NewMsgPong(1), SendPriorityLow},
+	}
+
+	for _, test := range tests {
+		got := messagePriority(test.msg)
+		if got != test.want {
+			t.Errorf("%s: unexpected priority - got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestPriorityQueue ensures the priority queue returns messages from higher
+// priority lanes first, keeps the order within a lane, and tracks the number
+// of messages waiting in each lane.
+func TestPriorityQueue(t *testing.T) {
+	var lens [numSendPriorities]int32
+	queue := newPriorityQueue(&lens)
+
+	ping := wire.NewMsgPing(1)
+	tx1 := wire.NewMsgTx(1)
+	tx2 := wire.NewMsgTx(2)
+	block := &wire.MsgBlock{}
+	for _, msg := range []wire.Message{ping, tx1, tx2, block} {
+		queue.push(outMsg{msg: msg})
+	}
+
+	wantLens := [numSendPriorities]int32{1, 2, 1}
+	if lens != wantLens {
+		t.Fatalf("unexpected lane lengths - got %v, want %v", lens,
+			wantLens)
+	}
+
+	for i, want := range []wire.Message{block, tx1, tx2, ping} {
+		msg, ok := queue.pop()
+		if !ok {
+			t.Fatalf("pop #%d: unexpected empty queue", i)
+		}
+		if msg.msg != want {
+			t.Fatalf("pop #%d: unexpected message %v", i,
+				msg.msg.Command())
+		}
+	}
+	if _, ok := queue.pop(); ok {
+		t.Fatal("pop: unexpected message from empty queue")
+	}
+	if lens != [numSendPriorities]int32{} {
+		t.Fatalf("unexpected lane lengths after draining: %v", lens)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TapDirection identifies whether a tapped message was received from or sent
+// to the remote peer.
+type TapDirection uint8
+
+const (
+	// TapInbound indicates the message was received from the remote peer.
+	TapInbound TapDirection = iota
+
+	// TapOutbound indicates the message was sent to the remote peer.
+	TapOutbound
+)
+
+// Map of tap directions back to their constant names for pretty printing.
+var tapDirectionStrings = map[TapDirection]string{
+	TapInbound:  "in",
+	TapOutbound: "out",
+}
+
+// String returns the TapDirection in human-readable form.
+func (d TapDirection) String() string {
+	if s, ok := tapDirectionStrings[d]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown TapDirection (%d)", uint8(d))
+}
+
+// TapRecord describes a single message read from or written to a peer.
+type TapRecord struct {
+	// Time is the time the message finished being read or written.
+	Time time.Time
+
+	// Direction identifies whether the message was received or sent.
+	Direction TapDirection
+
+	// Command is the command of the message.  It is empty when a message
+	// could not be read.
+	Command string
+
+	// Size is the number of bytes read or written including the message
+	// header.
+	Size int
+
+	// Msg is the message.  It is nil when a message could not be read.
+	Msg wire.Message
+
+	// Payload is the raw payload of inbound messages.  It is nil for
+	// outbound messages.
+	Payload []byte
+
+	// Err is the error which occurred while reading or writing the
+	// message, if any.
+	Err error
+}
+
+// MessageTap is the interface used to capture every message read from or
+// written to a peer along with the time and size of the message.
+//
+// TapMessage is invoked from the goroutines which read from and write to the
+// peer, so implementations must return quickly and must not block.  The
+// record and its payload must not be modified or retained after it returns
+// unless they are copied.
+type MessageTap interface {
+	TapMessage(p *Peer, rec *TapRecord)
+}
+
+// tapMessage passes a record of the passed message to the message tap of the
+// peer config, if any.
+func (p *Peer) tapMessage(dir TapDirection, n int, msg wire.Message,
+	payload []byte, err error) {
+
+	if p.cfg.MessageTap == nil {
+		return
+	}
+	rec := TapRecord{
+		Time:      time.Now(),
+		Direction: dir,
+		Size:      n,
+		Msg:       msg,
+		Payload:   payload,
+		Err:       err,
+	}
+	if msg != nil {
+		rec.Command = msg.Command()
+	}
+	p.cfg.MessageTap.TapMessage(p, &rec)
+}
@@ -0,0 +1,558 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// v2RekeyInterval is the number of messages encrypted with the same
+	// key before the BIP0324 ciphers switch to a new key.
+	v2RekeyInterval = 224
+
+	// v2LengthFieldLen is the size of the encrypted packet length field.
+	v2LengthFieldLen = 3
+
+	// v2HeaderLen is the size of the encrypted packet header which houses
+	// the ignore bit.
+	v2HeaderLen = 1
+
+	// v2TagLen is the size of the authentication tag of a packet.
+	v2TagLen = 16
+
+	// v2GarbageTermLen is the size of the garbage terminators.
+	v2GarbageTermLen = 16
+
+	// v2MaxGarbageLen is the maximum amount of garbage either side is
+	// allowed to send before its garbage terminator.
+	v2MaxGarbageLen = 4095
+
+	// v2IgnoreBit is the bit of the packet header which marks decoy
+	// packets that must be ignored by the receiver.
+	v2IgnoreBit = 0x80
+
+	// v2CommandSize is the size of long form message commands.
+	v2CommandSize = wire.CommandSize
+
+	// v2MaxContentsLen is the maximum size of the contents of a packet.
+	v2MaxContentsLen = 1 + v2CommandSize + wire.MaxMessagePayload
+)
+
+var (
+	// errV1Transport is returned by the responder side of the v2
+	// handshake when the remote peer started a v1 connection.
+	errV1Transport = errors.New("remote peer uses v1 transport")
+
+	// v2ShortIDs maps BIP0324 short message IDs to their commands.  Index 0
+	// is reserved to signal a long form command.
+	v2ShortIDs = []string{
+		"",
+		wire.CmdAddr,
+		wire.CmdBlock,
+		"blocktxn",
+		"cmpctblock",
+		wire.CmdFeeFilter,
+		wire.CmdFilterAdd,
+		wire.CmdFilterClear,
+		wire.CmdFilterLoad,
+		wire.CmdGetBlocks,
+		"getblocktxn",
+		wire.CmdGetData,
+		wire.CmdGetHeaders,
+		wire.CmdHeaders,
+		wire.CmdInv,
+		wire.CmdMemPool,
+		wire.CmdMerkleBlock,
+		wire.CmdNotFound,
+		wire.CmdPing,
+		wire.CmdPong,
+		"sendcmpct",
+		wire.CmdTx,
+		wire.CmdGetCFilters,
+		wire.CmdCFilter,
+		wire.CmdGetCFHeaders,
+		wire.CmdCFHeaders,
+		wire.CmdGetCFCheckpt,
+		wire.CmdCFCheckpt,
+		wire.CmdAddrV2,
+	}
+
+	// v2CommandIDs is the reverse mapping of v2ShortIDs.
+	v2CommandIDs = func() map[string]byte {
+		ids := make(map[string]byte, len(v2ShortIDs))
+		for id, cmd := range v2ShortIDs[1:] {
+			ids[cmd] = byte(id + 1)
+		}
+		return ids
+	}()
+)
+
+// fsChaCha20 is the forward secure ChaCha20 stream cipher used to encrypt
+// the length field of v2 packets.  It rekeys itself every v2RekeyInterval
+// chunks.
+type fsChaCha20 struct {
+	key          [32]byte
+	chunkCounter uint64
+
+	// cipher is the stream cipher of the current key.  It is nil until the
+	// first chunk of a key is processed.
+	cipher *chacha20.Cipher
+}
+
+// newFSChaCha20 returns a new forward secure ChaCha20 cipher using the passed
+// initial key.
+func newFSChaCha20(key []byte) *fsChaCha20 {
+	c := &fsChaCha20{}
+	copy(c.key[:], key)
+	return c
+}
+
+// crypt encrypts or decrypts the passed chunk in place.
+func (c *fsChaCha20) crypt(chunk []byte) {
+	if c.cipher == nil {
+		var nonce [chacha20.NonceSize]byte
+		binary.LittleEndian.PutUint64(nonce[4:],
+			c.chunkCounter/v2RekeyInterval)
+
+		// Creating the cipher only fails for keys and nonces of the
+		// wrong size.
+		c.cipher, _ = chacha20.NewUnauthenticatedCipher(c.key[:],
+			nonce[:])
+	}
+	c.cipher.XORKeyStream(chunk, chunk)
+	if (c.chunkCounter+1)%v2RekeyInterval == 0 {
+		var zeroes [32]byte
+		c.cipher.XORKeyStream(c.key[:], zeroes[:])
+		c.cipher = nil
+	}
+	c.chunkCounter++
+}
+
+// fsChaCha20Poly1305 is the forward secure AEAD used to encrypt the contents
+// of v2 packets.  It rekeys itself every v2RekeyInterval packets.
+type fsChaCha20Poly1305 struct {
+	key           [32]byte
+	packetCounter uint64
+}
+
+// newFSChaCha20Poly1305 returns a new forward secure ChaCha20Poly1305 AEAD
+// using the passed initial key.
+func newFSChaCha20Poly1305(key []byte) *fsChaCha20Poly1305 {
+	c := &fsChaCha20Poly1305{}
+	copy(c.key[:], key)
+	return c
+}
+
+// crypt seals or opens the passed text depending on the decrypt flag and
+// advances the cipher to the next packet.
+func (c *fsChaCha20Poly1305) crypt(aad, text []byte, decrypt bool) ([]byte, error) {
+	aead, err := chacha20poly1305.New(c.key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [12]byte
+	binary.LittleEndian.PutUint32(nonce[:4],
+		uint32(c.packetCounter%v2RekeyInterval))
+	binary.LittleEndian.PutUint64(nonce[4:], c.packetCounter/v2RekeyInterval)
+
+	var ret []byte
+	if decrypt {
+		ret, err = aead.Open(nil, nonce[:], text, aad)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		ret = aead.Seal(nil, nonce[:], text, aad)
+	}
+
+	if (c.packetCounter+1)%v2RekeyInterval == 0 {
+		binary.LittleEndian.PutUint32(nonce[:4], 0xffffffff)
+		var zeroes [32]byte
+		newKey := aead.Seal(nil, nonce[:], zeroes[:], nil)
+		copy(c.key[:], newKey[:32])
+	}
+	c.packetCounter++
+	return ret, nil
+}
+
+// v2Transport houses the state of a BIP0324 encrypted connection.
+type v2Transport struct {
+	conn      io.ReadWriter
+	net       wire.BitcoinNet
+	initiator bool
+
+	sendL *fsChaCha20
+	sendP *fsChaCha20Poly1305
+	recvL *fsChaCha20
+	recvP *fsChaCha20Poly1305
+
+	sendGarbageTerm [v2GarbageTermLen]byte
+	recvGarbageTerm [v2GarbageTermLen]byte
+	sessionID       [32]byte
+
+	// v1Prefix houses the bytes read by a responder which detected a v1
+	// connection so they can be replayed to the v1 message reader.
+	v1Prefix []byte
+
+	// bytesRead and bytesWritten track the number of bytes exchanged
+	// during the handshake.
+	bytesRead    int
+	bytesWritten int
+}
+
+// newV2Transport returns a new v2 transport for the passed connection.  The
+// handshake must be performed before any messages are exchanged.
+func newV2Transport(conn io.ReadWriter, net wire.BitcoinNet, initiator bool) *v2Transport {
+	return &v2Transport{
+		conn:      conn,
+		net:       net,
+		initiator: initiator,
+	}
+}
+
+// readFull reads exactly len(buf) bytes from the connection while keeping
+// track of the number of bytes read.
+func (t *v2Transport) readFull(buf []byte) error {
+	n, err := io.ReadFull(t.conn, buf)
+	t.bytesRead += n
+	return err
+}
+
+// write writes the passed bytes to the connection while keeping track of the
+// number of bytes written.
+func (t *v2Transport) write(buf []byte) error {
+	n, err := t.conn.Write(buf)
+	t.bytesWritten += n
+	return err
+}
+
+// v1VersionPrefix returns the bytes a v1 peer sends first on the passed network,
+// which is the network magic followed by the version command.
+func v1VersionPrefix(net wire.BitcoinNet) []byte {
+	var prefix [4 + v2CommandSize]byte
+	binary.LittleEndian.PutUint32(prefix[:4], uint32(net))
+	copy(prefix[4:], wire.CmdVersion)
+	return prefix[:]
+}
+
+// initializeCiphers derives the session keys from the ECDH shared secret and
+// sets up the packet ciphers and garbage terminators for the local side.
+func (t *v2Transport) initializeCiphers(sharedSecret []byte) error {
+	var magic [4]byte
+	binary.LittleEndian.PutUint32(magic[:], uint32(t.net))
+	salt := append([]byte("bitcoin_v2_shared_secret"), magic[:]...)
+
+	expand := func(info string, n int) ([]byte, error) {
+		out := make([]byte, n)
+		r := hkdf.New(sha256.New, sharedSecret, salt, []byte(info))
+		if _, err := io.ReadFull(r, out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	keys := make(map[string][]byte)
+	for _, info := range []string{"initiator_L", "initiator_P",
+		"responder_L", "responder_P", "session_id"} {
+
+		key, err := expand(info, 32)
+		if err != nil {
+			return err
+		}
+		keys[info] = key
+	}
+	terms, err := expand("garbage_terminators", 2*v2GarbageTermLen)
+	if err != nil {
+		return err
+	}
+
+	sendPrefix, recvPrefix := "initiator_", "responder_"
+	sendTerm, recvTerm := terms[:v2GarbageTermLen], terms[v2GarbageTermLen:]
+	if !t.initiator {
+		sendPrefix, recvPrefix = recvPrefix, sendPrefix
+		sendTerm, recvTerm = recvTerm, sendTerm
+	}
+	t.sendL = newFSChaCha20(keys[sendPrefix+"L"])
+	t.sendP = newFSChaCha20Poly1305(keys[sendPrefix+"P"])
+	t.recvL = newFSChaCha20(keys[recvPrefix+"L"])
+	t.recvP = newFSChaCha20Poly1305(keys[recvPrefix+"P"])
+	copy(t.sendGarbageTerm[:], sendTerm)
+	copy(t.recvGarbageTerm[:], recvTerm)
+	copy(t.sessionID[:], keys["session_id"])
+	return nil
+}
+
+// handshake performs the BIP0324 handshake with the remote peer.  When the
+// local side is the responder and the remote peer turns out to speak the v1
+// protocol, errV1Transport is returned and the bytes read so far are
+// available via the v1Prefix field.
+func (t *v2Transport) handshake() error {
+	var theirEll [btcec.EllSwiftEncodingSize]byte
+	if !t.initiator {
+		// Look at the first bytes sent by the initiator in order to
+		// detect v1 connections.
+		prefix := v1VersionPrefix(t.net)
+		if err := t.readFull(theirEll[:len(prefix)]); err != nil {
+			return err
+		}
+		if bytes.Equal(theirEll[:len(prefix)], prefix) {
+			t.v1Prefix = theirEll[:len(prefix)]
+			return errV1Transport
+		}
+	}
+
+	// Send our public key followed by a random amount of garbage.
+	privKey, ourEll, err := btcec.NewEllSwiftPrivateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	var garbageLen [2]byte
+	if _, err := rand.Read(garbageLen[:]); err != nil {
+		return err
+	}
+	garbage := make([]byte, binary.LittleEndian.Uint16(garbageLen[:])%
+		(v2MaxGarbageLen+1))
+	if _, err := rand.Read(garbage); err != nil {
+		return err
+	}
+	if err := t.write(append(ourEll[:], garbage...)); err != nil {
+		return err
+	}
+
+	// Read the remainder of the remote public key.
+	if t.initiator {
+		err = t.readFull(theirEll[:])
+	} else {
+		err = t.readFull(theirEll[len(v1VersionPrefix(t.net)):])
+	}
+	if err != nil {
+		return err
+	}
+
+	// Derive the shared secret and session keys.
+	initEll, respEll := &ourEll, &theirEll
+	if !t.initiator {
+		initEll, respEll = respEll, initEll
+	}
+	secret, err := btcec.EllSwiftXDH(initEll, respEll, privKey,
+		t.initiator)
+	if err != nil {
+		return err
+	}
+	if err := t.initializeCiphers(secret[:]); err != nil {
+		return err
+	}
+
+	// Send our garbage terminator along with the version packet which
+	// authenticates our garbage.
+	packet, err := t.encryptPacket(nil, garbage, false)
+	if err != nil {
+		return err
+	}
+	if err := t.write(append(t.sendGarbageTerm[:], packet...)); err != nil {
+		return err
+	}
+
+	// Scan for the remote garbage terminator.
+	var theirGarbage []byte
+	buf := make([]byte, 1)
+	for {
+		if err := t.readFull(buf); err != nil {
+			return err
+		}
+		theirGarbage = append(theirGarbage, buf[0])
+		if len(theirGarbage) < v2GarbageTermLen {
+			continue
+		}
+		tail := theirGarbage[len(theirGarbage)-v2GarbageTermLen:]
+		if bytes.Equal(tail, t.recvGarbageTerm[:]) {
+			theirGarbage = theirGarbage[:len(theirGarbage)-v2GarbageTermLen]
+			break
+		}
+		if len(theirGarbage) >= v2MaxGarbageLen+v2GarbageTermLen {
+			return errors.New("v2 garbage terminator not found")
+		}
+	}
+
+	// Read the version packet while skipping any decoy packets.  Only the
+	// first packet authenticates the remote garbage.
+	aad := theirGarbage
+	for {
+		_, ignore, err := t.readPacket(aad)
+		if err != nil {
+			return err
+		}
+		aad = nil
+		if !ignore {
+			break
+		}
+	}
+
+	return nil
+}
+
+// encryptPacket returns the encrypted packet for the passed contents.
+func (t *v2Transport) encryptPacket(contents, aad []byte, ignore bool) ([]byte, error) {
+	if len(contents) > v2MaxContentsLen {
+		return nil, fmt.Errorf("v2 packet contents of %d bytes exceed "+
+			"the maximum of %d bytes", len(contents), v2MaxContentsLen)
+	}
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(contents)))
+	t.sendL.crypt(length[:v2LengthFieldLen])
+
+	plaintext := make([]byte, 0, v2HeaderLen+len(contents))
+	if ignore {
+		plaintext = append(plaintext, v2IgnoreBit)
+	} else {
+		plaintext = append(plaintext, 0)
+	}
+	plaintext = append(plaintext, contents...)
+	ciphertext, err := t.sendP.crypt(aad, plaintext, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(length[:v2LengthFieldLen], ciphertext...), nil
+}
+
+// readPacket reads and decrypts the next packet from the connection.  It
+// returns the packet contents and whether or not the ignore bit was set.
+func (t *v2Transport) readPacket(aad []byte) ([]byte, bool, error) {
+	var length [4]byte
+	if err := t.readFull(length[:v2LengthFieldLen]); err != nil {
+		return nil, false, err
+	}
+	t.recvL.crypt(length[:v2LengthFieldLen])
+	contentsLen := binary.LittleEndian.Uint32(length[:])
+	if contentsLen > v2MaxContentsLen {
+		return nil, false, fmt.Errorf("v2 packet contents of %d bytes "+
+			"exceed the maximum of %d bytes", contentsLen,
+			v2MaxContentsLen)
+	}
+
+	ciphertext := make([]byte, v2HeaderLen+int(contentsLen)+
+		v2TagLen)
+	if err := t.readFull(ciphertext); err != nil {
+		return nil, false, err
+	}
+	plaintext, err := t.recvP.crypt(aad, ciphertext, true)
+	if err != nil {
+		return nil, false, errors.New("v2 packet authentication failed")
+	}
+
+	return plaintext[v2HeaderLen:], plaintext[0]&v2IgnoreBit != 0, nil
+}
+
+// readMessage reads the next non-decoy packet from the connection and
+// decodes it into a bitcoin message.  It returns the number of bytes read in
+// addition to the decoded message and its raw payload.
+func (t *v2Transport) readMessage(pver uint32, enc wire.MessageEncoding) (int, wire.Message, []byte, error) {
+	t.bytesRead = 0
+	for {
+		contents, ignore, err := t.readPacket(nil)
+		if err != nil {
+			return t.bytesRead, nil, nil, err
+		}
+		if ignore {
+			continue
+		}
+		if len(contents) == 0 {
+			return t.bytesRead, nil, nil, errors.New("empty v2 " +
+				"message packet")
+		}
+
+		var command string
+		payload := contents[1:]
+		if id := contents[0]; id != 0 {
+			if int(id) >= len(v2ShortIDs) {
+				return t.bytesRead, nil, nil, fmt.Errorf("unknown "+
+					"v2 short message id %d", id)
+			}
+			command = v2ShortIDs[id]
+		} else {
+			if len(payload) < v2CommandSize {
+				return t.bytesRead, nil, nil, errors.New("v2 " +
+					"message packet too short for command")
+			}
+			command = string(bytes.TrimRight(payload[:v2CommandSize],
+				"\x00"))
+			payload = payload[v2CommandSize:]
+		}
+
+		msg, err := wire.DecodeMessagePayload(command, payload, pver, enc)
+		return t.bytesRead, msg, payload, err
+	}
+}
+
+// writeMessage encodes the passed message into a packet and writes it to the
+// connection.  It returns the number of bytes written.
+func (t *v2Transport) writeMessage(msg wire.Message, pver uint32, enc wire.MessageEncoding) (int, error) {
+	payload, err := wire.EncodeMessagePayload(msg, pver, enc)
+	if err != nil {
+		return 0, err
+	}
+
+	var contents []byte
+	if id, ok := v2CommandIDs[msg.Command()]; ok {
+		contents = make([]byte, 0, 1+len(payload))
+		contents = append(contents, id)
+	} else {
+		cmd := msg.Command()
+		if len(cmd) > v2CommandSize {
+			return 0, fmt.Errorf("command [%s] is too long [max %v]",
+				cmd, v2CommandSize)
+		}
+		contents = make([]byte, 1+v2CommandSize, 1+v2CommandSize+
+			len(payload))
+		copy(contents[1:], cmd)
+	}
+	contents = append(contents, payload...)
+
+	packet, err := t.encryptPacket(contents, nil, false)
+	if err != nil {
+		return 0, err
+	}
+	return t.conn.Write(packet)
+}
+
+// v1ReplayConn is a connection which first replays bytes that were already
+// read from the underlying connection while detecting the transport version.
+type v1ReplayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+// Read reads from the replayed bytes followed by the underlying connection.
+//
+// This is part of the net.Conn interface.
+func (c *v1ReplayConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// newV1ReplayConn returns a connection which returns prefix before any data
+// read from conn.
+func newV1ReplayConn(conn net.Conn, prefix []byte) net.Conn {
+	return &v1ReplayConn{
+		Conn: conn,
+		r:    io.MultiReader(bytes.NewReader(prefix), conn),
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// tcpPipe returns both ends of a loopback TCP connection.  Unlike net.Pipe,
+// the connection is buffered which the v2 handshake relies on since both
+// sides write before reading.
+func tcpPipe(t *testing.T) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		accepted <- conn
+	}()
+
+	outConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	inConn := <-accepted
+	if inConn == nil {
+		t.Fatalf("unable to accept connection")
+	}
+	return inConn, outConn
+}
+
+// TestFSChaCha20 ensures the forward secure ciphers used by the v2 transport
+// stay in sync across rekeys and actually switch keys.
+func TestFSChaCha20(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	enc, dec := newFSChaCha20(key), newFSChaCha20(key)
+	aeadEnc, aeadDec := newFSChaCha20Poly1305(key), newFSChaCha20Poly1305(key)
+
+	initialKey := enc.key
+	for i := 0; i < 3*v2RekeyInterval+5; i++ {
+		length := []byte{byte(i), byte(i >> 8), 0}
+		chunk := append([]byte(nil), length...)
+		enc.crypt(chunk)
+		dec.crypt(chunk)
+		if !bytes.Equal(chunk, length) {
+			t.Fatalf("chunk %d: length mismatch - got %x, want %x",
+				i, chunk, length)
+		}
+
+		aad := []byte{byte(i)}
+		plaintext := bytes.Repeat([]byte{byte(i)}, i%50)
+		ciphertext, err := aeadEnc.crypt(aad, plaintext, false)
+		if err != nil {
+			t.Fatalf("packet %d: unexpected encrypt error: %v", i, err)
+		}
+		got, err := aeadDec.crypt(aad, ciphertext, true)
+		if err != nil {
+			t.Fatalf("packet %d: unexpected decrypt error: %v", i, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatalf("packet %d: plaintext mismatch - got %x, want %x",
+				i, got, plaintext)
+		}
+	}
+	if enc.key == initialKey || aeadEnc.key == initialKey {
+		t.Fatal("ciphers did not rekey")
+	}
+
+	// Tampering with a packet must be detected.
+	ciphertext, err := aeadEnc.crypt(nil, []byte("hello"), false)
+	if err != nil {
+		t.Fatalf("unexpected encrypt error: %v", err)
+	}
+	ciphertext[0] ^= 0x01
+	if _, err := aeadDec.crypt(nil, ciphertext, true); err == nil {
+		t.Fatal("tampered packet was not rejected")
+	}
+}
+
+// TestV2TransportVectors ensures the ElligatorSwift key exchange, the key
+// derivation, and the packet encryption including the rekeying of the forward
+// secure ciphers produce the expected results for the packet encoding test
+// vectors published with BIP0324.
+func TestV2TransportVectors(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata",
+		"packet_encoding_test_vectors.csv"))
+	if err != nil {
+		t.Fatalf("unable to open test vectors: %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("unable to read test vectors: %v", err)
+	}
+	if len(records) < 2 {
+		t.Fatal("no test vectors")
+	}
+
+	hexToBytes := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatalf("invalid hex in test vectors: %v", err)
+		}
+		return b
+	}
+	atoi := func(s string) int {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			t.Fatalf("invalid number in test vectors: %v", err)
+		}
+		return n
+	}
+	check := func(i int, name string, got []byte, want string) {
+		if hex.EncodeToString(got) != want {
+			t.Fatalf("vector #%d: %s mismatch - got %x, want %s", i,
+				name, got, want)
+		}
+	}
+
+	header := records[0]
+	for i, record := range records[1:] {
+		row := make(map[string]string, len(header))
+		for j, field := range header {
+			row[field] = record[j]
+		}
+
+		// Ensure the ElligatorSwift encodings decode to the expected x
+		// coordinates and that the ECDH results in the expected shared
+		// secret.
+		privKey, pubKey := btcec.PrivKeyFromBytes(btcec.S256(),
+			hexToBytes(row["in_priv_ours"]))
+		var ellOurs, ellTheirs [btcec.EllSwiftEncodingSize]byte
+		copy(ellOurs[:], hexToBytes(row["in_ellswift_ours"]))
+		copy(ellTheirs[:], hexToBytes(row["in_ellswift_theirs"]))
+		var x [32]byte
+		pubKey.X.FillBytes(x[:])
+		check(i, "x ours", x[:], row["mid_x_ours"])
+		btcec.EllSwiftDecode(&ellOurs).FillBytes(x[:])
+		check(i, "decoded x ours", x[:], row["mid_x_ours"])
+		btcec.EllSwiftDecode(&ellTheirs).FillBytes(x[:])
+		check(i, "decoded x theirs", x[:], row["mid_x_theirs"])
+		xShared, err := btcec.EllSwiftECDHXOnly(&ellTheirs, privKey)
+		if err != nil {
+			t.Fatalf("vector #%d: unexpected ECDH error: %v", i, err)
+		}
+		check(i, "shared x", xShared[:], row["mid_x_shared"])
+
+		initiating := row["in_initiating"] == "1"
+		initEll, respEll := &ellOurs, &ellTheirs
+		if !initiating {
+			initEll, respEll = respEll, initEll
+		}
+		secret, err := btcec.EllSwiftXDH(initEll, respEll, privKey,
+			initiating)
+		if err != nil {
+			t.Fatalf("vector #%d: unexpected XDH error: %v", i, err)
+		}
+		check(i, "shared secret", secret[:], row["mid_shared_secret"])
+
+		// Ensure the derived keys, garbage terminators, and session id
+		// are the expected ones.
+		transport := newV2Transport(nil, wire.MainNet, initiating)
+		if err := transport.initializeCiphers(secret[:]); err != nil {
+			t.Fatalf("vector #%d: unable to initialize ciphers: %v",
+				i, err)
+		}
+		initL, initP := transport.sendL.key, transport.sendP.key
+		respL, respP := transport.recvL.key, transport.recvP.key
+		if !initiating {
+			initL, respL = respL, initL
+			initP, respP = respP, initP
+		}
+		check(i, "initiator L key", initL[:], row["mid_initiator_l"])
+		check(i, "initiator P key", initP[:], row["mid_initiator_p"])
+		check(i, "responder L key", respL[:], row["mid_responder_l"])
+		check(i, "responder P key", respP[:], row["mid_responder_p"])
+		check(i, "send garbage terminator", transport.sendGarbageTerm[:],
+			row["mid_send_garbage_terminator"])
+		check(i, "receive garbage terminator",
+			transport.recvGarbageTerm[:],
+			row["mid_recv_garbage_terminator"])
+		check(i, "session id", transport.sessionID[:],
+			row["out_session_id"])
+
+		// Encrypt the packet at the requested index, which rekeys the
+		// ciphers for the vectors past the rekey interval.
+		for j := 0; j < atoi(row["in_idx"]); j++ {
+			if _, err := transport.encryptPacket(nil, nil, false); err != nil {
+				t.Fatalf("vector #%d: unexpected encrypt error: %v",
+					i, err)
+			}
+		}
+		contents := bytes.Repeat(hexToBytes(row["in_contents"]),
+			atoi(row["in_multiply"]))
+		ciphertext, err := transport.encryptPacket(contents,
+			hexToBytes(row["in_aad"]), row["in_ignore"] == "1")
+		if err != nil {
+			t.Fatalf("vector #%d: unexpected encrypt error: %v", i, err)
+		}
+		got := hex.EncodeToString(ciphertext)
+		if want := row["out_ciphertext"]; want != "" && got != want {
+			t.Fatalf("vector #%d: ciphertext mismatch - got %s, want %s",
+				i, got, want)
+		}
+		want := row["out_ciphertext_endswith"]
+		if want != "" && !strings.HasSuffix(got, want) {
+			t.Fatalf("vector #%d: ciphertext does not end with %s", i,
+				want)
+		}
+	}
+}
+
+// TestV2Transport ensures two v2 transports complete the handshake and are
+// able to exchange messages using both short and long form commands.
+func TestV2Transport(t *testing.T) {
+	inConn, outConn := tcpPipe(t)
+	defer inConn.Close()
+	defer outConn.Close()
+
+	net := wire.MainNet
+	initiator := newV2Transport(outConn, net, true)
+	responder := newV2Transport(inConn, net, false)
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- responder.handshake()
+	}()
+	if err := initiator.handshake(); err != nil {
+		t.Fatalf("initiator handshake failed: %v", err)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("responder handshake failed: %v", err)
+	}
+	if initiator.sessionID != responder.sessionID {
+		t.Fatalf("session id mismatch - got %x and %x",
+			initiator.sessionID, responder.sessionID)
+	}
+
+	pver := wire.ProtocolVersion
+	msgs := []wire.Message{
+		wire.NewMsgPing(1),
+		wire.NewMsgVerAck(),
+		wire.NewMsgSendHeaders(),
+		wire.NewMsgFeeFilter(1000),
+	}
+	for i := 0; i < v2RekeyInterval+10; i++ {
+		msgs = append(msgs, wire.NewMsgPong(uint64(i)))
+	}
+	go func() {
+		for _, msg := range msgs {
+			_, err := initiator.writeMessage(msg, pver,
+				wire.LatestEncoding)
+			if err != nil {
+				errChan <- err
+				return
+			}
+		}
+		errChan <- nil
+	}()
+	for i, want := range msgs {
+		_, msg, _, err := responder.readMessage(pver, wire.LatestEncoding)
+		if err != nil {
+			t.Fatalf("message %d: unexpected read error: %v", i, err)
+		}
+		if !reflect.DeepEqual(msg, want) {
+			t.Fatalf("message %d: mismatch - got %v, want %v", i,
+				msg, want)
+		}
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+}
+
+// TestV2TransportV1Fallback ensures a v2 responder detects peers using the v1
+// transport and replays the bytes it consumed while doing so.
+func TestV2TransportV1Fallback(t *testing.T) {
+	inConn, outConn := tcpPipe(t)
+	defer inConn.Close()
+	defer outConn.Close()
+
+	net := wire.MainNet
+	verMsg := wire.NewMsgVersion(&wire.NetAddress{}, &wire.NetAddress{}, 1, 0)
+	go wire.WriteMessage(outConn, verMsg, wire.ProtocolVersion, net)
+
+	responder := newV2Transport(inConn, net, false)
+	err := responder.handshake()
+	if err != errV1Transport {
+		t.Fatalf("unexpected handshake result - got %v, want %v", err,
+			errV1Transport)
+	}
+	replay := newV1ReplayConn(inConn, responder.v1Prefix)
+	msg, _, err := wire.ReadMessage(replay, wire.ProtocolVersion, net)
+	if err != nil {
+		t.Fatalf("unable to read replayed message: %v", err)
+	}
+	if _, ok := msg.(*wire.MsgVersion); !ok {
+		t.Fatalf("unexpected replayed message type %T", msg)
+	}
+}
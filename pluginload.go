@@ -0,0 +1,26 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build linux,cgo darwin,cgo freebsd,cgo
+
+package main
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// loadPlugins opens the Go plugins built with -buildmode=plugin at the passed
+// paths.  Opening a plugin runs the init functions of its packages, which are
+// expected to register the plugins they implement via plugins.Register.
+func loadPlugins(paths []string) error {
+	for _, path := range paths {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("unable to load plugin %s: %v", path,
+				err)
+		}
+		srvrLog.Infof("Loaded plugin %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// +build !linux,!darwin,!freebsd !cgo
+
+package main
+
+import (
+	"errors"
+)
+
+// loadPlugins returns an error when any plugins are passed since Go plugins are
+// not supported on this platform or without cgo.  Plugins may be compiled into
+// btcd instead.
+func loadPlugins(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	return errors.New("loading Go plugins is not supported on this " +
+		"platform -- compile the plugins into btcd instead")
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package plugins implements a registry of in-process plugins which are notified
+about the lifecycle of btcd.
+
+Plugins allow integrators to embed custom logic, such as metrics exporters,
+compliance filters, or mirrors of the chain, into btcd without patching the
+server.  A plugin implements the Plugin interface, typically by embedding Base
+and overriding the hooks it is interested in, and registers itself via Register
+from the init function of its package:
+
+	type mirror struct {
+		plugins.Base
+	}
+
+	func (m *mirror) Name() string { return "mirror" }
+
+	func (m *mirror) OnBlockConnected(block *btcutil.Block) {
+		// Hand the block off to a goroutine started by OnStart.
+	}
+
+	func init() {
+		if err := plugins.Register(&mirror{}); err != nil {
+			panic(err)
+		}
+	}
+
+There are two ways to add a plugin to btcd.  It may be compiled in by adding a
+file with a blank import of the package of the plugin to the main package,
+ideally behind a build tag so the plugin is only included when desired.  It may
+also be built as a Go plugin with -buildmode=plugin and loaded at startup via
+the --plugin option on platforms which support Go plugins, in which case it must
+be built against the exact same version of btcd.  Registered plugins may be
+turned off without rebuilding via the --disableplugin option.
+
+The hooks are invoked synchronously from the goroutines which handle the
+respective events, so they must not block and must be safe for concurrent
+access.  A plugin which fails to start or panics in a hook is disabled and the
+node keeps running.
+*/
+package plugins
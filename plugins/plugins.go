@@ -0,0 +1,269 @@
+// Copyright (c) 2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package plugins
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btclog"
+	"github.com/btcsuite/btcutil"
+)
+
+// Plugin is the interface of the plugins which run in the btcd process and are
+// notified about the lifecycle of the node.  Plugins are registered via
+// Register, typically from the init function of the package which implements
+// them.
+//
+// The hooks are invoked synchronously from the goroutines which handle the
+// respective events, so they must not block and must be safe for concurrent
+// access.  Long running work should be handed off to goroutines started by
+// OnStart.  A plugin which panics in a hook is disabled rather than bringing
+// down the node.
+type Plugin interface {
+	// Name returns the unique name of the plugin.  It is used to register
+	// the plugin, to disable it, and to identify it in the logs.
+	Name() string
+
+	// OnStart is invoked when the node starts with access to the chain and
+	// the mempool.  A plugin which returns an error is disabled.
+	OnStart(host *Host) error
+
+	// OnBlockConnected is invoked when a block is connected to the main
+	// chain.
+	OnBlockConnected(block *btcutil.Block)
+
+	// OnTxAccepted is invoked when a transaction is accepted into the
+	// mempool.
+	OnTxAccepted(tx *btcutil.Tx)
+
+	// OnPeerConnected is invoked when the version handshake with a peer
+	// completed and the peer was added to the peers of the node.
+	OnPeerConnected(p *peer.Peer)
+
+	// OnShutdown is invoked when the node shuts down.  No other hooks are
+	// invoked afterwards.
+	OnShutdown()
+}
+
+// Host provides the plugins access to the node when they are started.
+type Host struct {
+	// ChainParams are the parameters of the network the node is on.
+	ChainParams *chaincfg.Params
+
+	// Chain is the block chain of the node.
+	Chain *blockchain.BlockChain
+
+	// TxPool is the mempool of the node.
+	TxPool *mempool.TxPool
+
+	// DataDir is the data directory of the node for the active network.
+	DataDir string
+
+	// Logger is the logger of the plugin subsystem.
+	Logger btclog.Logger
+}
+
+var (
+	// registryMtx protects the registry.
+	registryMtx sync.Mutex
+
+	// registry are the registered plugins in the order they were
+	// registered.
+	registry []Plugin
+)
+
+// Register adds the passed plugin to the plugins which are run by the node.  It
+// is typically called from the init function of the package which implements
+// the plugin, which is compiled into btcd by importing it from a file added to
+// the main package, or which is built as a Go plugin loaded via the --plugin
+// option.  An error is returned when a plugin with the same name is already
+// registered.
+func Register(p Plugin) error {
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+
+	for _, registered := range registry {
+		if registered.Name() == p.Name() {
+			return fmt.Errorf("plugin %q is already registered",
+				p.Name())
+		}
+	}
+	registry = append(registry, p)
+	return nil
+}
+
+// Registered returns the registered plugins in the order they were
+// registered.
+func Registered() []Plugin {
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+
+	plugins := make([]Plugin, len(registry))
+	copy(plugins, registry)
+	return plugins
+}
+
+// Base provides no-op implementations of the hooks of the Plugin interface, so
+// plugins which embed it only need to implement Name and the hooks they are
+// interested in.
+type Base struct{}
+
+// OnStart does nothing.
+func (Base) OnStart(*Host) error { return nil }
+
+// OnBlockConnected does nothing.
+func (Base) OnBlockConnected(*btcutil.Block) {}
+
+// OnTxAccepted does nothing.
+func (Base) OnTxAccepted(*btcutil.Tx) {}
+
+// OnPeerConnected does nothing.
+func (Base) OnPeerConnected(*peer.Peer) {}
+
+// OnShutdown does nothing.
+func (Base) OnShutdown() {}
+
+// The states of the plugins of a manager.
+const (
+	// pluginIdle is the state of a plugin which was not started yet.
+	pluginIdle int32 = iota
+
+	// pluginRunning is the state of a plugin which started successfully.
+	// Only running plugins are notified about events.
+	pluginRunning
+
+	// pluginDisabled is the state of a plugin which failed to start,
+	// panicked, or was shut down.
+	pluginDisabled
+)
+
+// runningPlugin is a plugin run by a manager along with its state.
+type runningPlugin struct {
+	Plugin
+	state int32 // Atomic
+}
+
+// Manager dispatches the lifecycle events of the node to a set of plugins.
+type Manager struct {
+	plugins  []*runningPlugin
+	started  int32
+	shutdown int32
+}
+
+// NewManager returns a manager which dispatches the lifecycle events of the
+// node to the passed plugins in the passed order.
+func NewManager(plugins []Plugin) *Manager {
+	m := &Manager{plugins: make([]*runningPlugin, 0, len(plugins))}
+	for _, p := range plugins {
+		m.plugins = append(m.plugins, &runningPlugin{Plugin: p})
+	}
+	return m
+}
+
+// Names returns the names of the plugins of the manager which are running.
+func (m *Manager) Names() []string {
+	names := make([]string, 0, len(m.plugins))
+	for _, p := range m.plugins {
+		if atomic.LoadInt32(&p.state) == pluginRunning {
+			names = append(names, p.Name())
+		}
+	}
+	return names
+}
+
+// call invokes the passed hook of the passed plugin when the plugin is in the
+// passed state.  The plugin is disabled when the hook panics.  It returns
+// whether the hook was invoked and completed.
+func (m *Manager) call(p *runningPlugin, state int32, hook string, f func()) (completed bool) {
+	if atomic.LoadInt32(&p.state) != state {
+		return false
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.StoreInt32(&p.state, pluginDisabled)
+			log.Errorf("Plugin %s panicked in %s and is disabled: "+
+				"%v\n%s", p.Name(), hook, r, debug.Stack())
+			completed = false
+		}
+	}()
+	f()
+	return true
+}
+
+// Start invokes the OnStart hook of the plugins.  The plugins whose hook fails
+// are disabled, while the other ones are notified about events from then on.
+func (m *Manager) Start(host *Host) {
+	if atomic.AddInt32(&m.started, 1) != 1 {
+		return
+	}
+
+	for _, p := range m.plugins {
+		var err error
+		completed := m.call(p, pluginIdle, "OnStart", func() {
+			err = p.OnStart(host)
+		})
+		if !completed {
+			continue
+		}
+		if err != nil {
+			atomic.StoreInt32(&p.state, pluginDisabled)
+			log.Errorf("Plugin %s failed to start and is disabled: "+
+				"%v", p.Name(), err)
+			continue
+		}
+		atomic.CompareAndSwapInt32(&p.state, pluginIdle, pluginRunning)
+		log.Infof("Started plugin %s", p.Name())
+	}
+}
+
+// BlockConnected invokes the OnBlockConnected hook of the running plugins.
+func (m *Manager) BlockConnected(block *btcutil.Block) {
+	for _, p := range m.plugins {
+		m.call(p, pluginRunning, "OnBlockConnected", func() {
+			p.OnBlockConnected(block)
+		})
+	}
+}
+
+// TxAccepted invokes the OnTxAccepted hook of the running plugins.
+func (m *Manager) TxAccepted(tx *btcutil.Tx) {
+	for _, p := range m.plugins {
+		m.call(p, pluginRunning, "OnTxAccepted", func() {
+			p.OnTxAccepted(tx)
+		})
+	}
+}
+
+// PeerConnected invokes the OnPeerConnected hook of the running plugins.
+func (m *Manager) PeerConnected(sp *peer.Peer) {
+	for _, p := range m.plugins {
+		m.call(p, pluginRunning, "OnPeerConnected", func() {
+			p.OnPeerConnected(sp)
+		})
+	}
+}
+
+// Shutdown invokes the OnShutdown hook of the running plugins in the reverse
+// order they were started in and disables them, so no further hooks are
+// invoked.
+func (m *Manager) Shutdown() {
+	if atomic.AddInt32(&m.shutdown, 1) != 1 {
+		return
+	}
+
+	for i := len(m.plugins) - 1; i >= 0; i-- {
+		p := m.plugins[i]
+		m.call(p, pluginRunning, "OnShutdown", p.OnShutdown)
+		atomic.StoreInt32(&p.state, pluginDisabled)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package plugins
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// testPlugin is a plugin which records the hooks it was invoked with.
+type testPlugin struct {
+	Base
+	name     string
+	startErr error
+	panicOn  string
+	events   *[]string
+}
+
+func (p *testPlugin) Name() string { return p.name }
+
+func (p *testPlugin) record(hook string) {
+	*p.events = append(*p.events, p.name+"."+hook)
+	if p.panicOn == hook {
+		panic("test panic")
+	}
+}
+
+func (p *testPlugin) OnStart(*Host) error {
+	p.record("OnStart")
+	return p.startErr
+}
+
+func (p *testPlugin) OnBlockConnected(*btcutil.Block) {
+	p.record("OnBlockConnected")
+}
+
+func (p *testPlugin) OnShutdown() {
+	p.record("OnShutdown")
+}
+
+// TestManager ensures the manager dispatches the hooks to the running plugins
+// only and disables plugins which fail to start or panic.
+func TestManager(t *testing.T) {
+	var events []string
+	m := NewManager([]Plugin{
+		&testPlugin{name: "a", events: &events},
+		&testPlugin{name: "b", events: &events,
+			startErr: errors.New("test error")},
+		&testPlugin{name: "c", events: &events,
+			panicOn: "OnBlockConnected"},
+		&testPlugin{name: "d", events: &events},
+	})
+
+	// Hooks are not invoked before the plugins are started.
+	block := btcutil.NewBlock(wire.NewMsgBlock(&wire.BlockHeader{}))
+	m.BlockConnected(block)
+	if len(events) != 0 {
+		t.Fatalf("hooks invoked before start: %v", events)
+	}
+
+	m.Start(&Host{})
+	m.BlockConnected(block)
+	m.BlockConnected(block)
+	m.TxAccepted(btcutil.NewTx(wire.NewMsgTx(wire.TxVersion)))
+	if got, want := m.Names(), []string{"a", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("running plugins %v, want %v", got, want)
+	}
+	m.Shutdown()
+	m.BlockConnected(block)
+
+	want := []string{
+		"a.OnStart", "b.OnStart", "c.OnStart", "d.OnStart",
+		"a.OnBlockConnected", "c.OnBlockConnected", "d.OnBlockConnected",
+		"a.OnBlockConnected", "d.OnBlockConnected",
+		"d.OnShutdown", "a.OnShutdown",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("got events %v, want %v", events, want)
+	}
+}
+
+// TestRegister ensures plugins are registered in order and duplicate names are
+// rejected.
+func TestRegister(t *testing.T) {
+	defer func(saved []Plugin) { registry = saved }(registry)
+	registry = nil
+
+	var events []string
+	for _, name := range []string{"x", "y"} {
+		if err := Register(&testPlugin{name: name, events: &events}); err != nil {
+			t.Fatalf("Register %s: %v", name, err)
+		}
+	}
+	if err := Register(&testPlugin{name: "x", events: &events}); err == nil {
+		t.Fatal("Register accepted a duplicate name")
+	}
+
+	registered := Registered()
+	if len(registered) != 2 || registered[0].Name() != "x" ||
+		registered[1].Name() != "y" {
+
+		t.Fatalf("unexpected registered plugins %v", registered)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// prevOutStatus describes where the output referenced by a transaction input
+// was resolved from.
+type prevOutStatus string
+
+// These constants define the possible statuses of a resolved previous output.
+const (
+	// prevOutMempool indicates the output was created by a transaction in
+	// the memory pool.
+	prevOutMempool prevOutStatus = "mempool"
+
+	// prevOutUnspent indicates the output is in the UTXO set.
+	prevOutUnspent prevOutStatus = "unspent"
+
+	// prevOutSpent indicates the output was created by a transaction in the
+	// main chain, but has already been spent.  It can only be resolved when
+	// the transaction index is enabled.
+	prevOutSpent prevOutStatus = "spent"
+
+	// prevOutMissing indicates the output could not be found.
+	prevOutMissing prevOutStatus = "missing"
+)
+
+// resolvedPrevOut houses the output referenced by a transaction input along
+// with where it was resolved from.  The output and the remaining fields are
+// only set when the status is not prevOutMissing.
+type resolvedPrevOut struct {
+	outPoint   wire.OutPoint
+	status     prevOutStatus
+	txOut      *wire.TxOut
+	height     int32
+	isCoinBase bool
+}
+
+// prevOutFetcher resolves the outputs referenced by the inputs of arbitrary
+// transactions, such as ones constructed externally which are neither in the
+// chain nor the memory pool, so their values and scripts are available for
+// fee computation and signing.
+type prevOutFetcher struct {
+	chain     *blockchain.BlockChain
+	txMemPool *mempool.TxPool
+	db        database.DB
+
+	// txIndex is used to resolve already spent outputs.  It may be nil in
+	// which case spent outputs are reported as missing.
+	txIndex *indexers.TxIndex
+}
+
+// fetchTxByIndex loads the transaction with the passed hash using the
+// transaction index along with the height of the block which contains it.  A
+// nil transaction is returned when the transaction is not in the index.
+func (f *prevOutFetcher) fetchTxByIndex(outPoint *wire.OutPoint) (*wire.MsgTx, int32, error) {
+	blockRegion, err := f.txIndex.TxBlockRegion(&outPoint.Hash)
+	if err != nil || blockRegion == nil {
+		return nil, 0, err
+	}
+
+	var txBytes []byte
+	err = f.db.View(func(dbTx database.Tx) error {
+		var err error
+		txBytes, err = dbTx.FetchBlockRegion(blockRegion)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var msgTx wire.MsgTx
+	if err := msgTx.Deserialize(bytes.NewReader(txBytes)); err != nil {
+		return nil, 0, err
+	}
+
+	// The block might have been disconnected since the index was queried,
+	// in which case the transaction is treated as not found.
+	height, err := f.chain.BlockHeightByHash(blockRegion.Hash)
+	if err != nil {
+		return nil, 0, nil
+	}
+	return &msgTx, height, nil
+}
+
+// fetchPrevOut resolves the output referenced by the passed outpoint by
+// checking the memory pool first, then the UTXO set, and finally the
+// transaction index for outputs which have already been spent.
+func (f *prevOutFetcher) fetchPrevOut(outPoint wire.OutPoint) (*resolvedPrevOut, error) {
+	prevOut := &resolvedPrevOut{outPoint: outPoint, status: prevOutMissing}
+
+	if tx, err := f.txMemPool.FetchTransaction(&outPoint.Hash); err == nil {
+		txOuts := tx.MsgTx().TxOut
+		if outPoint.Index < uint32(len(txOuts)) {
+			prevOut.status = prevOutMempool
+			prevOut.txOut = txOuts[outPoint.Index]
+		}
+		return prevOut, nil
+	}
+
+	entry, err := f.chain.FetchUtxoEntry(outPoint)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && !entry.IsSpent() {
+		prevOut.status = prevOutUnspent
+		prevOut.txOut = wire.NewTxOut(entry.Amount(), entry.PkScript())
+		prevOut.height = entry.BlockHeight()
+		prevOut.isCoinBase = entry.IsCoinBase()
+		return prevOut, nil
+	}
+
+	if f.txIndex == nil {
+		return prevOut, nil
+	}
+	msgTx, height, err := f.fetchTxByIndex(&outPoint)
+	if err != nil {
+		return nil, err
+	}
+	if msgTx != nil && outPoint.Index < uint32(len(msgTx.TxOut)) {
+		prevOut.status = prevOutSpent
+		prevOut.txOut = msgTx.TxOut[outPoint.Index]
+		prevOut.height = height
+		prevOut.isCoinBase = blockchain.IsCoinBaseTx(msgTx)
+	}
+	return prevOut, nil
+}
+
+// FetchPrevOuts resolves the outputs referenced by all inputs of the passed
+// transaction in the order of the inputs.  Outputs which can't be found are
+// reported with the prevOutMissing status rather than an error so callers can
+// still make use of the outputs which were found.  Coinbase transactions
+// don't reference any outputs and therefore return an empty slice.
+func (f *prevOutFetcher) FetchPrevOuts(tx *wire.MsgTx) ([]*resolvedPrevOut, error) {
+	if blockchain.IsCoinBaseTx(tx) {
+		return nil, nil
+	}
+
+	prevOuts := make([]*resolvedPrevOut, 0, len(tx.TxIn))
+	for _, txIn := range tx.TxIn {
+		prevOut, err := f.fetchPrevOut(txIn.PreviousOutPoint)
+		if err != nil {
+			return nil, err
+		}
+		prevOuts = append(prevOuts, prevOut)
+	}
+	return prevOuts, nil
+}
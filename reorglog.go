@@ -0,0 +1,189 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+)
+
+// reorgRecordSize is the size of a serialized reorg record.
+const reorgRecordSize = 8 + 3*(chainhash.HashSize+4) + 4*4
+
+// reorgLogBucketName is the name of the database bucket used to persist the
+// reorg log.  The records are keyed by their big endian sequence number so
+// they are iterated in the order they were made.
+var reorgLogBucketName = []byte("reorglog")
+
+// reorgRecord describes a reorganization of the main chain performed by the
+// node.
+type reorgRecord struct {
+	ID uint64
+	blockchain.Reorganization
+}
+
+// serialize returns the serialized reorg record.  The ID is not part of the
+// record since it is used as the key.
+func (r *reorgRecord) serialize() []byte {
+	serialized := make([]byte, reorgRecordSize)
+	binary.LittleEndian.PutUint64(serialized, uint64(r.Time.Unix()))
+	offset := 8
+	for _, block := range []struct {
+		hash   *chainhash.Hash
+		height int32
+	}{
+		{&r.ForkHash, r.ForkHeight},
+		{&r.OldTipHash, r.OldTipHeight},
+		{&r.NewTipHash, r.NewTipHeight},
+	} {
+		copy(serialized[offset:], block.hash[:])
+		offset += chainhash.HashSize
+		binary.LittleEndian.PutUint32(serialized[offset:],
+			uint32(block.height))
+		offset += 4
+	}
+	for _, count := range []int{r.DetachedBlocks, r.AttachedBlocks,
+		r.DetachedTxns, r.AttachedTxns} {
+
+		binary.LittleEndian.PutUint32(serialized[offset:], uint32(count))
+		offset += 4
+	}
+	return serialized
+}
+
+// deserializeReorgRecord returns the reorg record with the passed ID described
+// by the passed serialized bytes.
+func deserializeReorgRecord(id uint64, serialized []byte) (*reorgRecord, error) {
+	if len(serialized) != reorgRecordSize {
+		return nil, errors.New("malformed reorg record")
+	}
+	r := &reorgRecord{ID: id}
+	r.Time = time.Unix(int64(binary.LittleEndian.Uint64(serialized)), 0)
+	offset := 8
+	for _, block := range []struct {
+		hash   *chainhash.Hash
+		height *int32
+	}{
+		{&r.ForkHash, &r.ForkHeight},
+		{&r.OldTipHash, &r.OldTipHeight},
+		{&r.NewTipHash, &r.NewTipHeight},
+	} {
+		copy(block.hash[:], serialized[offset:])
+		offset += chainhash.HashSize
+		*block.height = int32(binary.LittleEndian.Uint32(
+			serialized[offset:]))
+		offset += 4
+	}
+	for _, count := range []*int{&r.DetachedBlocks, &r.AttachedBlocks,
+		&r.DetachedTxns, &r.AttachedTxns} {
+
+		*count = int(binary.LittleEndian.Uint32(serialized[offset:]))
+		offset += 4
+	}
+	return r, nil
+}
+
+// reorgLog persists every reorganization of the main chain performed by the
+// node to the database so they can be inspected after the fact.
+type reorgLog struct {
+	db database.DB
+
+	mtx    sync.Mutex
+	nextID uint64
+}
+
+// newReorgLog returns a new reorg log which persists its records to the
+// passed database and is subscribed to the notifications of the passed chain.
+func newReorgLog(chain *blockchain.BlockChain, db database.DB) (*reorgLog, error) {
+	l := &reorgLog{db: db, nextID: 1}
+	err := db.Update(func(dbTx database.Tx) error {
+		bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+			reorgLogBucketName)
+		if err != nil {
+			return err
+		}
+		cursor := bucket.Cursor()
+		if cursor.Last() {
+			l.nextID = binary.BigEndian.Uint64(cursor.Key()) + 1
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	chain.Subscribe(l.handleBlockchainNotification)
+	return l, nil
+}
+
+// handleBlockchainNotification persists the reorganizations of the main
+// chain.
+func (l *reorgLog) handleBlockchainNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTReorganization {
+		return
+	}
+	reorg, ok := notification.Data.(*blockchain.Reorganization)
+	if !ok {
+		srvrLog.Warnf("Reorganization notification is not a " +
+			"reorganization.")
+		return
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	record := reorgRecord{ID: l.nextID, Reorganization: *reorg}
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], record.ID)
+	err := l.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(reorgLogBucketName)
+		return bucket.Put(key[:], record.serialize())
+	})
+	if err != nil {
+		srvrLog.Errorf("Unable to persist reorganization from %v to %v: "+
+			"%v", reorg.OldTipHash, reorg.NewTipHash, err)
+		return
+	}
+	l.nextID++
+}
+
+// Records returns up to count records starting after skipping the passed
+// number of records along with the total number of records.  The records are
+// ordered from the most recent to the oldest unless reverse is set.
+//
+// This function is safe for concurrent access.
+func (l *reorgLog) Records(skip, count int, reverse bool) ([]*reorgRecord, int, error) {
+	var records []*reorgRecord
+	var total int
+	err := l.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(reorgLogBucketName)
+		cursor := bucket.Cursor()
+		first, next := cursor.Last, cursor.Prev
+		if reverse {
+			first, next = cursor.First, cursor.Next
+		}
+		for ok := first(); ok; ok = next() {
+			total++
+			if total <= skip || len(records) >= count {
+				continue
+			}
+			id := binary.BigEndian.Uint64(cursor.Key())
+			record, err := deserializeReorgRecord(id, cursor.Value())
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestReorgRecordSerialization ensures reorg records survive a round trip
+// through their serialized form.
+func TestReorgRecordSerialization(t *testing.T) {
+	want := &reorgRecord{
+		ID: 7,
+		Reorganization: blockchain.Reorganization{
+			ForkHash:       chainhash.Hash{0x01},
+			ForkHeight:     100,
+			OldTipHash:     chainhash.Hash{0x02},
+			OldTipHeight:   102,
+			NewTipHash:     chainhash.Hash{0x03},
+			NewTipHeight:   103,
+			DetachedBlocks: 2,
+			AttachedBlocks: 3,
+			DetachedTxns:   250,
+			AttachedTxns:   300,
+			Time:           time.Unix(1600000000, 0),
+		},
+	}
+
+	serialized := want.serialize()
+	got, err := deserializeReorgRecord(want.ID, serialized)
+	if err != nil {
+		t.Fatalf("unexpected deserialize error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mismatched record - got %+v, want %+v", got, want)
+	}
+
+	if _, err := deserializeReorgRecord(1, serialized[:20]); err == nil {
+		t.Fatal("truncated record was not rejected")
+	}
+}
+
+// TestReorgLogRecords ensures the reorg log persists reorganization
+// notifications and pages through them in the requested order.
+func TestReorgLogRecords(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "reorglog")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", filepath.Join(dbPath, "db"),
+		wire.MainNet)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+	err = db.Update(func(dbTx database.Tx) error {
+		_, err := dbTx.Metadata().CreateBucket(reorgLogBucketName)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unable to create bucket: %v", err)
+	}
+
+	l := &reorgLog{db: db, nextID: 1}
+	for i := 0; i < 5; i++ {
+		l.handleBlockchainNotification(&blockchain.Notification{
+			Type: blockchain.NTReorganization,
+			Data: &blockchain.Reorganization{
+				ForkHeight: int32(i),
+				Time:       time.Unix(1600000000, 0),
+			},
+		})
+	}
+
+	tests := []struct {
+		name    string
+		skip    int
+		count   int
+		reverse bool
+		want    []uint64
+	}{
+		{"most recent first", 0, 100, false, []uint64{5, 4, 3, 2, 1}},
+		{"oldest first", 0, 100, true, []uint64{1, 2, 3, 4, 5}},
+		{"skip and count", 1, 2, false, []uint64{4, 3}},
+		{"skip past end", 5, 2, true, nil},
+	}
+	for _, test := range tests {
+		records, total, err := l.Records(test.skip, test.count,
+			test.reverse)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if total != 5 {
+			t.Fatalf("%s: wrong total - got %d, want 5", test.name,
+				total)
+		}
+		var ids []uint64
+		for _, r := range records {
+			if r.ForkHeight != int32(r.ID-1) {
+				t.Fatalf("%s: record %d has wrong fork height %d",
+					test.name, r.ID, r.ForkHeight)
+			}
+			ids = append(ids, r.ID)
+		}
+		if !reflect.DeepEqual(ids, test.want) {
+			t.Fatalf("%s: wrong records - got %v, want %v",
+				test.name, ids, test.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/gcs"
+	"github.com/btcsuite/btcutil/gcs/builder"
+)
+
+// addUnspent adds the passed outpoint to the unspent outputs of the rescan
+// along with its output script.  A nil script means the script is not known,
+// which disables skipping blocks by their committed filters until the outpoint
+// is spent.
+func (r *rescanKeys) addUnspent(op wire.OutPoint, pkScript []byte) {
+	r.unspent[op] = struct{}{}
+	if pkScript != nil {
+		r.unspentScripts[op] = pkScript
+	}
+	r.filterScripts = nil
+}
+
+// removeUnspent removes the passed outpoint from the unspent outputs of the
+// rescan.
+func (r *rescanKeys) removeUnspent(op wire.OutPoint) {
+	delete(r.unspent, op)
+	delete(r.unspentScripts, op)
+	r.filterScripts = nil
+}
+
+// matchScripts returns the scripts which appear in the committed filter of any
+// block which is relevant to the rescan, which are the scripts paying to the
+// addresses and the scripts of the unspent outputs.  It returns false when the
+// lookups can't be expressed as scripts, such as when the script of one of the
+// unspent outputs is not known.
+func (r *rescanKeys) matchScripts(params *chaincfg.Params) ([][]byte, bool) {
+	if len(r.unspentScripts) != len(r.unspent) {
+		return nil, false
+	}
+	if r.filterScripts != nil {
+		return r.filterScripts, true
+	}
+
+	scripts := make([][]byte, 0, len(r.addrs)+len(r.unspentScripts))
+	for addrStr := range r.addrs {
+		addr, err := btcutil.DecodeAddress(addrStr, params)
+		if err != nil {
+			return nil, false
+		}
+
+		// Public keys are matched against every output which contains
+		// them, such as bare multisig outputs, which can't be derived
+		// from the key alone.
+		if _, ok := addr.(*btcutil.AddressPubKey); ok {
+			return nil, false
+		}
+		pkScript, err := txscript.PayToAddrScript(addr)
+		if err != nil {
+			return nil, false
+		}
+		scripts = append(scripts, pkScript)
+	}
+	for _, pkScript := range r.unspentScripts {
+		scripts = append(scripts, pkScript)
+	}
+	r.filterScripts = scripts
+	return scripts, true
+}
+
+// mayMatchFilter returns whether the block with the passed hash and serialized
+// committed filter may contain transactions relevant to the rescan.  It errs on
+// the side of reading the block, so it returns true whenever the filter is not
+// available or can't be matched against the lookups.
+func (r *rescanKeys) mayMatchFilter(blockHash *chainhash.Hash,
+	filterBytes []byte, params *chaincfg.Params) bool {
+
+	if len(filterBytes) == 0 {
+		return true
+	}
+	scripts, ok := r.matchScripts(params)
+	if !ok {
+		return true
+	}
+	if len(scripts) == 0 {
+		return false
+	}
+
+	filter, err := gcs.FromNBytes(builder.DefaultP, builder.DefaultM,
+		filterBytes)
+	if err != nil {
+		rpcsLog.Debugf("Unable to decode filter for block %v: %v",
+			blockHash, err)
+		return true
+	}
+	if filter.N() == 0 {
+		return false
+	}
+	match, err := filter.MatchAny(builder.DeriveKey(blockHash), scripts)
+	if err != nil {
+		rpcsLog.Debugf("Unable to match filter for block %v: %v",
+			blockHash, err)
+		return true
+	}
+	return match
+}
+
+// fetchRescanFilters returns the serialized regular committed filters of the
+// blocks with the passed hashes.  It returns nil when the filter index is not
+// enabled or the filters could not be loaded, in which case all of the blocks
+// are read.
+func fetchRescanFilters(cfIndex *indexers.CfIndex,
+	hashList []chainhash.Hash) [][]byte {
+
+	if cfIndex == nil || len(hashList) == 0 {
+		return nil
+	}
+
+	hashes := make([]*chainhash.Hash, len(hashList))
+	for i := range hashList {
+		hashes[i] = &hashList[i]
+	}
+	filters, err := cfIndex.FiltersByBlockHashes(hashes,
+		wire.GCSFilterRegular)
+	if err != nil {
+		rpcsLog.Debugf("Unable to fetch filters for rescan: %v", err)
+		return nil
+	}
+	return filters
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/gcs/builder"
+)
+
+// TestRescanFilterMatch ensures the lookups of a rescan are matched against the
+// committed filters of blocks as expected.
+func TestRescanFilterMatch(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	newAddr := func(b byte) btcutil.Address {
+		var hash [20]byte
+		hash[0] = b
+		addr, err := btcutil.NewAddressPubKeyHash(hash[:], params)
+		if err != nil {
+			t.Fatalf("unable to create address: %v", err)
+		}
+		return addr
+	}
+	paidAddr, spentAddr, otherAddr := newAddr(1), newAddr(2), newAddr(3)
+	paidScript, _ := txscript.PayToAddrScript(paidAddr)
+	spentScript, _ := txscript.PayToAddrScript(spentAddr)
+
+	// Create a block which pays to one address and spends an output which
+	// paid to another one.
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(1000, paidScript))
+	block := wire.NewMsgBlock(&wire.BlockHeader{})
+	block.AddTransaction(tx)
+	blockHash := block.BlockHash()
+	filter, err := builder.BuildBasicFilter(block, [][]byte{spentScript})
+	if err != nil {
+		t.Fatalf("unable to build filter: %v", err)
+	}
+	filterBytes, err := filter.NBytes()
+	if err != nil {
+		t.Fatalf("unable to serialize filter: %v", err)
+	}
+
+	newLookups := func(addrs ...btcutil.Address) *rescanKeys {
+		lookups := &rescanKeys{
+			addrs:          map[string]struct{}{},
+			unspent:        map[wire.OutPoint]struct{}{},
+			unspentScripts: map[wire.OutPoint][]byte{},
+		}
+		for _, addr := range addrs {
+			lookups.addrs[addr.String()] = struct{}{}
+		}
+		return lookups
+	}
+
+	tests := []struct {
+		name    string
+		lookups *rescanKeys
+		filter  []byte
+		match   bool
+	}{
+		{
+			name:    "paid address",
+			lookups: newLookups(paidAddr),
+			filter:  filterBytes,
+			match:   true,
+		},
+		{
+			name:    "spent address",
+			lookups: newLookups(spentAddr),
+			filter:  filterBytes,
+			match:   true,
+		},
+		{
+			name:    "unrelated address",
+			lookups: newLookups(otherAddr),
+			filter:  filterBytes,
+			match:   false,
+		},
+		{
+			name:    "no lookups",
+			lookups: newLookups(),
+			filter:  filterBytes,
+			match:   false,
+		},
+		{
+			name:    "missing filter",
+			lookups: newLookups(otherAddr),
+			filter:  nil,
+			match:   true,
+		},
+	}
+
+	for _, test := range tests {
+		match := test.lookups.mayMatchFilter(&blockHash, test.filter,
+			params)
+		if match != test.match {
+			t.Errorf("%s: unexpected match: got %v, want %v",
+				test.name, match, test.match)
+		}
+	}
+
+	// Ensure an unspent output with an unknown script disables skipping
+	// blocks until it is spent, and one with a known script is matched.
+	lookups := newLookups(otherAddr)
+	unknown := wire.OutPoint{Hash: chainhash.Hash{1}}
+	lookups.addUnspent(unknown, nil)
+	if !lookups.mayMatchFilter(&blockHash, filterBytes, params) {
+		t.Fatal("block skipped with unknown unspent output script")
+	}
+	lookups.removeUnspent(unknown)
+	if lookups.mayMatchFilter(&blockHash, filterBytes, params) {
+		t.Fatal("unrelated block not skipped after removing output")
+	}
+	lookups.addUnspent(wire.OutPoint{Hash: chainhash.Hash{2}}, spentScript)
+	if !lookups.mayMatchFilter(&blockHash, filterBytes, params) {
+		t.Fatal("block spending unspent output skipped")
+	}
+}
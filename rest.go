@@ -0,0 +1,569 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// restDefaultHeaders is the number of headers returned by the headers
+	// endpoint when no count is given.
+	restDefaultHeaders = 5
+
+	// restMaxHeaders is the maximum number of headers which can be
+	// requested from the headers endpoint at once.
+	restMaxHeaders = 2000
+
+	// restMaxOutPoints is the maximum number of outpoints which can be
+	// looked up by the getutxos endpoint at once.
+	restMaxOutPoints = 15
+)
+
+// restFormat identifies the format of the response to a REST request, which is
+// given by the extension of the requested path.
+type restFormat int
+
+const (
+	// restFormatBinary is the raw serialized data.
+	restFormatBinary restFormat = iota
+
+	// restFormatHex is the hex-encoded serialized data followed by a
+	// newline.
+	restFormatHex
+
+	// restFormatJSON is the JSON object of the matching RPC.
+	restFormatJSON
+)
+
+// restFormats maps the extensions of REST paths to the response formats.
+var restFormats = map[string]restFormat{
+	"bin":  restFormatBinary,
+	"hex":  restFormatHex,
+	"json": restFormatJSON,
+}
+
+// errRESTFormat is returned when a REST path does not end with the extension
+// of a supported response format.
+var errRESTFormat = errors.New("output format not found (available: " +
+	".bin, .hex, .json)")
+
+// parseRESTPath splits the passed REST path, which must end with the extension
+// of the response format, into the parameter and the response format.
+func parseRESTPath(path string) (string, restFormat, error) {
+	i := strings.LastIndexByte(path, '.')
+	if i < 0 {
+		return "", 0, errRESTFormat
+	}
+	format, ok := restFormats[path[i+1:]]
+	if !ok {
+		return "", 0, errRESTFormat
+	}
+	return path[:i], format, nil
+}
+
+// parseRESTOutPoints parses outpoints in the form <txid>-<n> as passed to the
+// getutxos endpoint.
+func parseRESTOutPoints(fields []string) ([]wire.OutPoint, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("Error: empty request")
+	}
+	if len(fields) > restMaxOutPoints {
+		return nil, fmt.Errorf("Error: max outpoints exceeded (max: %d, "+
+			"tried: %d)", restMaxOutPoints, len(fields))
+	}
+
+	outPoints := make([]wire.OutPoint, 0, len(fields))
+	for _, field := range fields {
+		sep := strings.IndexByte(field, '-')
+		if sep < 0 {
+			return nil, errors.New("Parse error")
+		}
+		hash, err := chainhash.NewHashFromStr(field[:sep])
+		if err != nil {
+			return nil, errors.New("Parse error")
+		}
+		index, err := strconv.ParseUint(field[sep+1:], 10, 32)
+		if err != nil {
+			return nil, errors.New("Parse error")
+		}
+		outPoints = append(outPoints, wire.OutPoint{
+			Hash:  *hash,
+			Index: uint32(index),
+		})
+	}
+	return outPoints, nil
+}
+
+// restUTXOs houses the unspent outputs found by the getutxos endpoint.
+type restUTXOs struct {
+	chainHeight int32
+	chainTip    chainhash.Hash
+
+	// found reports for each of the requested outpoints whether it is
+	// unspent, and entries holds the unspent outputs in the same order.
+	found   []bool
+	entries []*blockchain.UtxoEntry
+}
+
+// restUTXOJSON is a JSON object of an unspent output returned by the getutxos
+// endpoint.
+type restUTXOJSON struct {
+	Height       int32                      `json:"height"`
+	Value        float64                    `json:"value"`
+	ScriptPubKey btcjson.ScriptPubKeyResult `json:"scriptPubKey"`
+}
+
+// restUTXOsJSON is the JSON object returned by the getutxos endpoint.  The
+// bitmap holds a 1 for each of the requested outpoints which is unspent and a
+// 0 for the others.
+type restUTXOsJSON struct {
+	ChainHeight  int32          `json:"chainHeight"`
+	ChainTipHash string         `json:"chaintipHash"`
+	Bitmap       string         `json:"bitmap"`
+	UTXOs        []restUTXOJSON `json:"utxos"`
+}
+
+// bitmap returns the found outpoints packed into a bitmap with the bit of the
+// first outpoint in the least significant bit of the first byte.
+func (u *restUTXOs) bitmap() []byte {
+	bitmap := make([]byte, (len(u.found)+7)/8)
+	for i, found := range u.found {
+		if found {
+			bitmap[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return bitmap
+}
+
+// serialize writes the unspent outputs in the binary format of the reference
+// implementation, which is:
+//
+//	<chain height><chain tip><bitmap><num utxos>[<version><height><txout>]...
+//
+//	Field         Type      Size
+//	chain height  int32     4 bytes
+//	chain tip     Hash      32 bytes
+//	bitmap        VarBytes  variable
+//	num utxos     VarInt    variable
+//	version       uint32    4 bytes (always zero)
+//	height        uint32    4 bytes
+//	txout         TxOut     variable
+func (u *restUTXOs) serialize(w io.Writer) error {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(u.chainHeight))
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(u.chainTip[:]); err != nil {
+		return err
+	}
+	if err := wire.WriteVarBytes(w, 0, u.bitmap()); err != nil {
+		return err
+	}
+	err := wire.WriteVarInt(w, 0, uint64(len(u.entries)))
+	if err != nil {
+		return err
+	}
+	for _, entry := range u.entries {
+		binary.LittleEndian.PutUint32(buf[:], 0)
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint32(buf[:], uint32(entry.BlockHeight()))
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+		txOut := wire.NewTxOut(entry.Amount(), entry.PkScript())
+		if err := wire.WriteTxOut(w, 0, 0, txOut); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toJSON returns the JSON object of the unspent outputs.  The addresses of the
+// scripts are encoded for the passed network.
+func (u *restUTXOs) toJSON(params *chaincfg.Params) *restUTXOsJSON {
+	bitmap := make([]byte, len(u.found))
+	for i, found := range u.found {
+		bitmap[i] = '0'
+		if found {
+			bitmap[i] = '1'
+		}
+	}
+
+	result := &restUTXOsJSON{
+		ChainHeight:  u.chainHeight,
+		ChainTipHash: u.chainTip.String(),
+		Bitmap:       string(bitmap),
+		UTXOs:        make([]restUTXOJSON, 0, len(u.entries)),
+	}
+	for _, entry := range u.entries {
+		// Ignore the errors since the scripts which don't parse are
+		// still returned, just without any further information.
+		pkScript := entry.PkScript()
+		disbuf, _ := txscript.DisasmString(pkScript)
+		scriptClass, addrs, reqSigs, _ := txscript.ExtractPkScriptAddrs(
+			pkScript, params)
+		addresses := make([]string, len(addrs))
+		for i, addr := range addrs {
+			addresses[i] = addr.EncodeAddress()
+		}
+
+		result.UTXOs = append(result.UTXOs, restUTXOJSON{
+			Height: entry.BlockHeight(),
+			Value:  btcutil.Amount(entry.Amount()).ToBTC(),
+			ScriptPubKey: btcjson.ScriptPubKeyResult{
+				Asm:       disbuf,
+				Hex:       hex.EncodeToString(pkScript),
+				ReqSigs:   int32(reqSigs),
+				Type:      scriptClass.String(),
+				Addresses: addresses,
+			},
+		})
+	}
+	return result
+}
+
+// restError responds to a REST request with the passed status code and plain
+// text error message.
+func restError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s\r\n", message)
+}
+
+// restRPCError responds to a REST request with an error returned by an RPC
+// handler.  Unknown blocks and transactions result in a 404 and invalid
+// parameters in a 400 status code.
+func restRPCError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	message := err.Error()
+	if rpcErr, ok := err.(*btcjson.RPCError); ok {
+		message = rpcErr.Message
+		// ErrRPCNoTxInfo shares the code of ErrRPCBlockNotFound.
+		switch rpcErr.Code {
+		case btcjson.ErrRPCBlockNotFound:
+			status = http.StatusNotFound
+
+		case btcjson.ErrRPCDecodeHexString, btcjson.ErrRPCInvalidParameter:
+			status = http.StatusBadRequest
+		}
+	}
+	restError(w, status, message)
+}
+
+// writeRESTData responds to a REST request with the passed serialized data in
+// the binary or hex format.
+func writeRESTData(w http.ResponseWriter, format restFormat, data []byte) {
+	if format == restFormatHex {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%x\n", data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
+
+// writeRESTJSON responds to a REST request with the passed JSON object.
+func writeRESTJSON(w http.ResponseWriter, result interface{}) {
+	marshalled, err := json.Marshal(result)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal REST reply: %v", err)
+		restError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(marshalled, '\n'))
+}
+
+// writeRESTResult responds to a REST request with the passed result of an RPC
+// handler in the passed format.  The handlers return the serialized data as a
+// hex-encoded string when the verbose result is not requested.
+func writeRESTResult(w http.ResponseWriter, format restFormat, result interface{}) {
+	if format == restFormatJSON {
+		writeRESTJSON(w, result)
+		return
+	}
+	data, err := hex.DecodeString(result.(string))
+	if err != nil {
+		restError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeRESTData(w, format, data)
+}
+
+// handleREST serves the REST interface, which provides the public data of the
+// chain in the binary, hex, or JSON format of the reference implementation
+// without the overhead of JSON-RPC.  The following endpoints are served:
+//
+//	/rest/tx/<txid>.<bin|hex|json>
+//	/rest/block/<hash>.<bin|hex|json>
+//	/rest/block/notxdetails/<hash>.<bin|hex|json>
+//	/rest/headers/<hash>.<bin|hex|json>?count=<count>
+//	/rest/headers/<count>/<hash>.<bin|hex|json>
+//	/rest/chaininfo.json
+//	/rest/getutxos[/checkmempool]/<txid>-<n>/<txid>-<n>/....<bin|hex|json>
+//
+// The REST interface does not require authentication.
+func (s *rpcServer) handleREST(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		restError(w, http.StatusMethodNotAllowed,
+			"Only GET requests are supported")
+		return
+	}
+	if s.cfg.Standby.IsStandby() {
+		restError(w, http.StatusServiceUnavailable,
+			"Node is in standby mode")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/rest/")
+	switch {
+	case strings.HasPrefix(path, "tx/"):
+		s.restTx(w, strings.TrimPrefix(path, "tx/"))
+
+	case strings.HasPrefix(path, "block/notxdetails/"):
+		s.restBlock(w, strings.TrimPrefix(path, "block/notxdetails/"),
+			false)
+
+	case strings.HasPrefix(path, "block/"):
+		s.restBlock(w, strings.TrimPrefix(path, "block/"), true)
+
+	case strings.HasPrefix(path, "headers/"):
+		s.restHeaders(w, strings.TrimPrefix(path, "headers/"),
+			r.URL.Query().Get("count"))
+
+	case strings.HasPrefix(path, "chaininfo"):
+		s.restChainInfo(w, path)
+
+	case strings.HasPrefix(path, "getutxos/"):
+		s.restGetUTXOs(w, strings.TrimPrefix(path, "getutxos/"))
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// restTx serves a transaction from the memory pool or, when the transaction
+// index is enabled, from the main chain.
+func (s *rpcServer) restTx(w http.ResponseWriter, path string) {
+	txid, format, err := parseRESTPath(path)
+	if err != nil {
+		restError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var verbose int
+	if format == restFormatJSON {
+		verbose = 1
+	}
+	cmd := &btcjson.GetRawTransactionCmd{Txid: txid, Verbose: &verbose}
+	result, err := handleGetRawTransaction(s, cmd, nil)
+	if err != nil {
+		restRPCError(w, err)
+		return
+	}
+	writeRESTResult(w, format, result)
+}
+
+// restBlock serves a block.  The JSON object includes the details of the
+// transactions when txDetails is set and only their hashes otherwise.
+func (s *rpcServer) restBlock(w http.ResponseWriter, path string, txDetails bool) {
+	hash, format, err := parseRESTPath(path)
+	if err != nil {
+		restError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	verbose := format == restFormatJSON
+	cmd := &btcjson.GetBlockCmd{
+		Hash:      hash,
+		Verbose:   &verbose,
+		VerboseTx: &txDetails,
+	}
+	result, err := handleGetBlock(s, cmd, nil)
+	if err != nil {
+		restRPCError(w, err)
+		return
+	}
+	writeRESTResult(w, format, result)
+}
+
+// restHeaders serves the headers of up to the requested number of blocks of the
+// main chain starting at the block with the requested hash.  The count is
+// either part of the path or passed as a query parameter.  No headers are
+// returned when the block is not part of the main chain.
+func (s *rpcServer) restHeaders(w http.ResponseWriter, path, countStr string) {
+	param, format, err := parseRESTPath(path)
+	if err != nil {
+		restError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	hashStr := param
+	if sep := strings.IndexByte(param, '/'); sep >= 0 {
+		countStr, hashStr = param[:sep], param[sep+1:]
+	}
+
+	count := restDefaultHeaders
+	if countStr != "" {
+		count, err = strconv.Atoi(countStr)
+		if err != nil || count < 1 || count > restMaxHeaders {
+			restError(w, http.StatusBadRequest, fmt.Sprintf("Header "+
+				"count is invalid or out of acceptable range "+
+				"(1-%d): %s", restMaxHeaders, countStr))
+			return
+		}
+	}
+	hash, err := chainhash.NewHashFromStr(hashStr)
+	if err != nil {
+		restError(w, http.StatusBadRequest, "Invalid hash: "+hashStr)
+		return
+	}
+
+	chain := s.cfg.Chain
+	hashes := make([]*chainhash.Hash, 0, count)
+	if height, err := chain.BlockHeightByHash(hash); err == nil {
+		best := chain.BestSnapshot()
+		for ; height <= best.Height && len(hashes) < count; height++ {
+			hash, err := chain.BlockHashByHeight(height)
+			if err != nil {
+				break
+			}
+			hashes = append(hashes, hash)
+		}
+	}
+
+	if format == restFormatJSON {
+		verbose := true
+		results := make([]interface{}, 0, len(hashes))
+		for _, hash := range hashes {
+			cmd := &btcjson.GetBlockHeaderCmd{
+				Hash:    hash.String(),
+				Verbose: &verbose,
+			}
+			result, err := handleGetBlockHeader(s, cmd, nil)
+			if err != nil {
+				restRPCError(w, err)
+				return
+			}
+			results = append(results, result)
+		}
+		writeRESTJSON(w, results)
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, hash := range hashes {
+		header, err := chain.HeaderByHash(hash)
+		if err != nil {
+			restError(w, http.StatusNotFound, hash.String()+
+				" not found")
+			return
+		}
+		if err := header.Serialize(&buf); err != nil {
+			restError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	writeRESTData(w, format, buf.Bytes())
+}
+
+// restChainInfo serves the state of the chain as returned by the
+// getblockchaininfo RPC, which is only available in the JSON format.
+func (s *rpcServer) restChainInfo(w http.ResponseWriter, path string) {
+	param, format, err := parseRESTPath(path)
+	if err != nil || param != "chaininfo" || format != restFormatJSON {
+		restError(w, http.StatusNotFound, "output format not found "+
+			"(available: json)")
+		return
+	}
+
+	result, err := handleGetBlockChainInfo(s, nil, nil)
+	if err != nil {
+		restRPCError(w, err)
+		return
+	}
+	writeRESTJSON(w, result)
+}
+
+// restGetUTXOs serves the requested outputs which are unspent in the main
+// chain or, when the path starts with checkmempool, in the main chain combined
+// with the memory pool.  Outputs created by transactions in the memory pool
+// have a height of 0x7fffffff.
+func (s *rpcServer) restGetUTXOs(w http.ResponseWriter, path string) {
+	param, format, err := parseRESTPath(path)
+	if err != nil {
+		restError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	fields := strings.Split(param, "/")
+	checkMempool := fields[0] == "checkmempool"
+	if checkMempool {
+		fields = fields[1:]
+	}
+	outPoints, err := parseRESTOutPoints(fields)
+	if err != nil {
+		restError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	best := s.cfg.Chain.BestSnapshot()
+	utxos := restUTXOs{
+		chainHeight: best.Height,
+		chainTip:    best.Hash,
+		found:       make([]bool, len(outPoints)),
+	}
+	for i, outPoint := range outPoints {
+		var entry *blockchain.UtxoEntry
+		if checkMempool {
+			var spend *btcutil.Tx
+			entry, spend, err = s.cfg.TxMemPool.FetchUtxoEntry(outPoint)
+			if spend != nil {
+				entry = nil
+			}
+		} else {
+			entry, err = s.cfg.Chain.FetchUtxoEntry(outPoint)
+		}
+		if err != nil {
+			restError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if entry == nil || entry.IsSpent() {
+			continue
+		}
+		utxos.found[i] = true
+		utxos.entries = append(utxos.entries, entry)
+	}
+
+	if format == restFormatJSON {
+		writeRESTJSON(w, utxos.toJSON(s.cfg.ChainParams))
+		return
+	}
+	var buf bytes.Buffer
+	if err := utxos.serialize(&buf); err != nil {
+		restError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeRESTData(w, format, buf.Bytes())
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestParseRESTPath ensures REST paths are split into the parameter and the
+// response format given by their extension.
+func TestParseRESTPath(t *testing.T) {
+	tests := []struct {
+		path      string
+		param     string
+		format    restFormat
+		wantError bool
+	}{
+		{path: "abcd.bin", param: "abcd", format: restFormatBinary},
+		{path: "abcd.hex", param: "abcd", format: restFormatHex},
+		{path: "5/abcd.json", param: "5/abcd", format: restFormatJSON},
+		{path: "chaininfo.json", param: "chaininfo",
+			format: restFormatJSON},
+		{path: "abcd", wantError: true},
+		{path: "abcd.xml", wantError: true},
+		{path: "abcd.json.", wantError: true},
+	}
+	for _, test := range tests {
+		param, format, err := parseRESTPath(test.path)
+		if test.wantError {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.path, err)
+			continue
+		}
+		if param != test.param || format != test.format {
+			t.Errorf("%q: got parameter %q and format %d, want %q "+
+				"and %d", test.path, param, format, test.param,
+				test.format)
+		}
+	}
+}
+
+// TestParseRESTOutPoints ensures the outpoints passed to the getutxos endpoint
+// are parsed and that malformed ones and too many of them are rejected.
+func TestParseRESTOutPoints(t *testing.T) {
+	const txid = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+	hash, err := chainhash.NewHashFromStr(txid)
+	if err != nil {
+		t.Fatalf("NewHashFromStr: unexpected error: %v", err)
+	}
+
+	outPoints, err := parseRESTOutPoints([]string{txid + "-0", txid + "-7"})
+	if err != nil {
+		t.Fatalf("parseRESTOutPoints: unexpected error: %v", err)
+	}
+	want := []wire.OutPoint{{Hash: *hash, Index: 0}, {Hash: *hash, Index: 7}}
+	if len(outPoints) != len(want) || outPoints[0] != want[0] ||
+		outPoints[1] != want[1] {
+
+		t.Fatalf("got outpoints %v, want %v", outPoints, want)
+	}
+
+	tooMany := make([]string, restMaxOutPoints+1)
+	for i := range tooMany {
+		tooMany[i] = txid + "-0"
+	}
+	invalid := [][]string{
+		nil,
+		{txid},
+		{"zz-0"},
+		{txid + "-"},
+		{txid + "--1"},
+		{txid + "-4294967296"},
+		tooMany,
+	}
+	for _, fields := range invalid {
+		if _, err := parseRESTOutPoints(fields); err == nil {
+			t.Errorf("%v: expected an error", fields)
+		}
+	}
+}
+
+// TestRESTUTXOs ensures the result of the getutxos endpoint is serialized in
+// the binary format of the reference implementation and converted to the
+// matching JSON object.
+func TestRESTUTXOs(t *testing.T) {
+	pkScript := append([]byte{0x76, 0xa9, 0x14}, make([]byte, 20)...)
+	pkScript = append(pkScript, 0x88, 0xac)
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil, nil))
+	msgTx.AddTxOut(wire.NewTxOut(5000000000, pkScript))
+	msgTx.AddTxOut(wire.NewTxOut(1000, pkScript))
+	tx := btcutil.NewTx(msgTx)
+	view := blockchain.NewUtxoViewpoint()
+	view.AddTxOut(tx, 0, 100)
+	view.AddTxOut(tx, 1, mining.UnminedHeight)
+
+	utxos := restUTXOs{
+		chainHeight: 200,
+		chainTip:    chainhash.Hash{0x01},
+		found:       make([]bool, 10),
+		entries: []*blockchain.UtxoEntry{
+			view.LookupEntry(wire.OutPoint{Hash: *tx.Hash(), Index: 0}),
+			view.LookupEntry(wire.OutPoint{Hash: *tx.Hash(), Index: 1}),
+		},
+	}
+	utxos.found[0] = true
+	utxos.found[9] = true
+
+	var buf bytes.Buffer
+	if err := utxos.serialize(&buf); err != nil {
+		t.Fatalf("serialize: unexpected error: %v", err)
+	}
+	want := "c8000000" + // chain height
+		"01" + strings.Repeat("00", 31) + // chain tip
+		"020102" + // bitmap
+		"02" + // num utxos
+		"00000000" + "64000000" + // version and height
+		"00f2052a01000000" + "19" + hex.EncodeToString(pkScript) +
+		"00000000" + "ffffff7f" + // version and unmined height
+		"e803000000000000" + "19" + hex.EncodeToString(pkScript)
+	if got := hex.EncodeToString(buf.Bytes()); got != want {
+		t.Fatalf("serialized utxos %s, want %s", got, want)
+	}
+
+	result := utxos.toJSON(&chaincfg.MainNetParams)
+	if result.ChainHeight != 200 || result.Bitmap != "1000000001" ||
+		result.ChainTipHash != utxos.chainTip.String() {
+
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if len(result.UTXOs) != 2 || result.UTXOs[0].Height != 100 ||
+		result.UTXOs[0].Value != 50 ||
+		result.UTXOs[0].ScriptPubKey.Type != "pubkeyhash" ||
+		result.UTXOs[1].Height != mining.UnminedHeight {
+
+		t.Fatalf("unexpected utxos %+v", result.UTXOs)
+	}
+}
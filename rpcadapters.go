@@ -208,8 +208,8 @@ func (cm *rpcConnManager) BroadcastMessage(msg wire.Message) {
 }
 
 // AddRebroadcastInventory adds the provided inventory to the list of
-// inventories to be rebroadcast at random intervals until they show up in a
-// block.
+// inventories to be rebroadcast at random intervals until a peer requests
+// them.
 //
 // This function is safe for concurrent access and is part of the
 // rpcserverConnManager interface implementation.
@@ -268,6 +268,24 @@ func (b *rpcSyncMgr) SyncPeerID() int32 {
 	return b.syncMgr.SyncPeerID()
 }
 
+// RequestBlock requests the block with the passed hash from the peer even
+// though it was not announced by the peer.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) RequestBlock(hash *chainhash.Hash, p *peer.Peer) error {
+	return b.syncMgr.RequestBlock(hash, p)
+}
+
+// SyncProgress returns the latest progress of the synchronization of the chain
+// with the network.
+//
+// This function is safe for concurrent access and is part of the
+// rpcserverSyncManager interface implementation.
+func (b *rpcSyncMgr) SyncProgress() *netsync.SyncProgress {
+	return b.syncMgr.SyncProgress()
+}
+
 // LocateBlocks returns the hashes of the blocks after the first known block in
 // the provided locators until the provided stop hash or the current tip is
 // reached, up to a max of wire.MaxBlockHeadersPerMsg hashes.
@@ -0,0 +1,147 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/btcjson"
+)
+
+// maxRPCAuthorizationLifetime is the maximum time before its expiration at
+// which a request authorization is accepted.  Limiting it bounds the number of
+// authorizations which have to be remembered to reject replays.
+const maxRPCAuthorizationLifetime = 10 * time.Minute
+
+// rpcThresholdCmds are the destructive commands which require authorization
+// from the threshold of admin keys when threshold authorization is enabled.
+var rpcThresholdCmds = map[string]struct{}{
+	"addcheckpoint":    {},
+	"backupdatabase":   {},
+	"dumptxoutset":     {},
+	"invalidateblock":  {},
+	"node":             {},
+	"promotestandby":   {},
+	"reconsiderblock":  {},
+	"reloadrpcroles":   {},
+	"setrpcrole":       {},
+	"setscriptworkers": {},
+	"stop":             {},
+}
+
+// rpcAuthorizer verifies that the destructive requests are signed by at least
+// the threshold of the configured admin keys, so a single compromised RPC
+// credential is not enough to disrupt a node.
+type rpcAuthorizer struct {
+	keys      []*btcec.PublicKey
+	threshold int
+
+	// seen holds the hashes of the authorizations which have been used
+	// along with their expiration time so they can't be replayed.
+	mtx  sync.Mutex
+	seen map[[32]byte]time.Time
+
+	// now returns the current time and is exposed to allow the tests to
+	// replace it.
+	now func() time.Time
+}
+
+// newRPCAuthorizer returns an authorizer which requires the signatures of the
+// passed number of distinct keys out of the passed admin keys.
+func newRPCAuthorizer(keys []*btcec.PublicKey, threshold int) *rpcAuthorizer {
+	return &rpcAuthorizer{
+		keys:      keys,
+		threshold: threshold,
+		seen:      make(map[[32]byte]time.Time),
+		now:       time.Now,
+	}
+}
+
+// authorize returns an error when the passed request is for a destructive
+// command and is not authorized by enough distinct admin keys.  An accepted
+// authorization can't be used again.
+func (a *rpcAuthorizer) authorize(request *btcjson.Request) *btcjson.RPCError {
+	if _, ok := rpcThresholdCmds[request.Method]; !ok {
+		return nil
+	}
+
+	auth := request.Authorization
+	if auth == nil {
+		return rpcAuthorizationError("method requires authorization "+
+			"from %d of %d admin keys", a.threshold, len(a.keys))
+	}
+	now := a.now()
+	expires := time.Unix(auth.Expires, 0)
+	if !expires.After(now) {
+		return rpcAuthorizationError("authorization expired at %v",
+			expires.UTC())
+	}
+	if expires.Sub(now) > maxRPCAuthorizationLifetime {
+		return rpcAuthorizationError("authorization expires more than "+
+			"%v in the future", maxRPCAuthorizationLifetime)
+	}
+
+	// Count the distinct admin keys which signed the request.
+	hash := btcjson.RequestAuthorizationHash(request.Method, request.Params,
+		auth.Expires, auth.Nonce)
+	signed := make([]bool, len(a.keys))
+	numSigned := 0
+	for _, sigHex := range auth.Signatures {
+		sigBytes, err := hex.DecodeString(sigHex)
+		if err != nil {
+			return rpcAuthorizationError("malformed signature %q",
+				sigHex)
+		}
+		sig, err := btcec.ParseDERSignature(sigBytes, btcec.S256())
+		if err != nil {
+			return rpcAuthorizationError("malformed signature %q: %v",
+				sigHex, err)
+		}
+		for i, key := range a.keys {
+			if !signed[i] && sig.Verify(hash[:], key) {
+				signed[i] = true
+				numSigned++
+				break
+			}
+		}
+	}
+	if numSigned < a.threshold {
+		return rpcAuthorizationError("authorization has valid "+
+			"signatures from %d of the %d required admin keys",
+			numSigned, a.threshold)
+	}
+
+	// Reject replays of the authorization while it is still valid and
+	// forget the ones which expired.
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	for seenHash, seenExpires := range a.seen {
+		if !seenExpires.After(now) {
+			delete(a.seen, seenHash)
+		}
+	}
+	if _, ok := a.seen[hash]; ok {
+		return rpcAuthorizationError("authorization has already " +
+			"been used")
+	}
+	a.seen[hash] = expires
+
+	rpcsLog.Debugf("Request for %s authorized by %d admin keys",
+		request.Method, numSigned)
+	return nil
+}
+
+// rpcAuthorizationError returns an RPC error for a request which is not
+// properly authorized.
+func rpcAuthorizationError(format string, args ...interface{}) *btcjson.RPCError {
+	return &btcjson.RPCError{
+		Code:    btcjson.ErrRPCInvalidParams.Code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
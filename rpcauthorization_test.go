@@ -0,0 +1,149 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/btcjson"
+)
+
+// TestRPCAuthorizer ensures destructive requests are only accepted when they
+// are signed by the threshold of distinct admin keys and that authorizations
+// can't be replayed.
+func TestRPCAuthorizer(t *testing.T) {
+	privKeys := make([]*btcec.PrivateKey, 3)
+	pubKeys := make([]*btcec.PublicKey, 3)
+	for i := range privKeys {
+		privKey, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			t.Fatalf("unable to generate key: %v", err)
+		}
+		privKeys[i] = privKey
+		pubKeys[i] = privKey.PubKey()
+	}
+	outsider, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+
+	now := time.Unix(1600000000, 0)
+	authorizer := newRPCAuthorizer(pubKeys, 2)
+	authorizer.now = func() time.Time { return now }
+
+	newRequest := func(method string, expires time.Time, nonce uint64,
+		signers ...*btcec.PrivateKey) *btcjson.Request {
+
+		request, err := btcjson.NewRequest(1, method,
+			[]interface{}{"00"})
+		if err != nil {
+			t.Fatalf("unable to create request: %v", err)
+		}
+		auth := &btcjson.RequestAuthorization{
+			Expires: expires.Unix(),
+			Nonce:   nonce,
+		}
+		hash := btcjson.RequestAuthorizationHash(method,
+			request.Params, auth.Expires, auth.Nonce)
+		for _, signer := range signers {
+			sig, err := signer.Sign(hash[:])
+			if err != nil {
+				t.Fatalf("unable to sign: %v", err)
+			}
+			auth.Signatures = append(auth.Signatures,
+				hex.EncodeToString(sig.Serialize()))
+		}
+		request.Authorization = auth
+		return request
+	}
+	expires := now.Add(time.Minute)
+
+	tests := []struct {
+		name    string
+		request *btcjson.Request
+		valid   bool
+	}{
+		{
+			name:    "non-destructive method",
+			request: &btcjson.Request{Method: "getblockcount"},
+			valid:   true,
+		},
+		{
+			name:    "missing authorization",
+			request: &btcjson.Request{Method: "stop"},
+			valid:   false,
+		},
+		{
+			name: "threshold met",
+			request: newRequest("invalidateblock", expires, 1,
+				privKeys[0], privKeys[2]),
+			valid: true,
+		},
+		{
+			name: "replayed authorization",
+			request: newRequest("invalidateblock", expires, 1,
+				privKeys[0], privKeys[2]),
+			valid: false,
+		},
+		{
+			name: "same request with new nonce",
+			request: newRequest("invalidateblock", expires, 2,
+				privKeys[0], privKeys[2]),
+			valid: true,
+		},
+		{
+			name: "duplicate signer",
+			request: newRequest("stop", expires, 3, privKeys[1],
+				privKeys[1]),
+			valid: false,
+		},
+		{
+			name: "unknown signer",
+			request: newRequest("stop", expires, 4, privKeys[1],
+				outsider),
+			valid: false,
+		},
+		{
+			name: "expired",
+			request: newRequest("stop", now, 5, privKeys[0],
+				privKeys[1]),
+			valid: false,
+		},
+		{
+			name: "expires too late",
+			request: newRequest("stop",
+				now.Add(maxRPCAuthorizationLifetime+time.Second), 6,
+				privKeys[0], privKeys[1]),
+			valid: false,
+		},
+	}
+
+	for _, test := range tests {
+		err := authorizer.authorize(test.request)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected result: %v", test.name, err)
+		}
+	}
+
+	// Ensure signatures for one method do not authorize another.
+	request := newRequest("stop", expires, 7, privKeys[0], privKeys[1])
+	request.Method = "invalidateblock"
+	if err := authorizer.authorize(request); err == nil {
+		t.Fatal("authorization for stop accepted for invalidateblock")
+	}
+}
+
+// TestRPCThresholdCmds ensures all commands which require threshold
+// authorization are handled by the RPC server.
+func TestRPCThresholdCmds(t *testing.T) {
+	for method := range rpcThresholdCmds {
+		if _, ok := rpcHandlers[method]; !ok {
+			t.Errorf("threshold command %q has no RPC handler", method)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcjson"
+)
+
+// rpcMaxBatchSize is the maximum number of requests in a JSON-RPC batch.
+const rpcMaxBatchSize = 1000
+
+// isRPCBatch returns whether the passed message is a JSON array, which holds a
+// batch of JSON-RPC requests rather than a single one.
+func isRPCBatch(msg []byte) bool {
+	msg = bytes.TrimLeft(msg, " \t\r\n")
+	return len(msg) > 0 && msg[0] == '['
+}
+
+// parseRPCBatch splits the passed batch into its requests.  The returned error
+// is suitable for use in a reply with a null id when the batch is malformed,
+// empty, or holds more than rpcMaxBatchSize requests.
+func parseRPCBatch(msg []byte) ([]json.RawMessage, *btcjson.RPCError) {
+	var requests []json.RawMessage
+	if err := json.Unmarshal(msg, &requests); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCParse.Code,
+			Message: "Failed to parse request: " + err.Error(),
+		}
+	}
+	switch {
+	case len(requests) == 0:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidRequest.Code,
+			Message: "Empty batch",
+		}
+
+	case len(requests) > rpcMaxBatchSize:
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidRequest.Code,
+			Message: fmt.Sprintf("Batch of %d requests exceeds the "+
+				"maximum of %d", len(requests), rpcMaxBatchSize),
+		}
+	}
+	return requests, nil
+}
+
+// runRPCBatch handles the passed requests of a batch with the passed function,
+// which returns the marshalled reply to a request or nil when no reply is due,
+// such as for notifications.  At most parallelism requests are handled at a
+// time.  It returns the marshalled array of the replies in the order of the
+// requests, or nil when no reply is due to any of them.
+func runRPCBatch(requests []json.RawMessage, parallelism int,
+	handle func(request json.RawMessage) []byte) []byte {
+
+	replies := make([][]byte, len(requests))
+	if parallelism <= 1 {
+		for i, request := range requests {
+			replies[i] = handle(request)
+		}
+	} else {
+		sem := makeSemaphore(parallelism)
+		var wg sync.WaitGroup
+		for i, request := range requests {
+			sem.acquire()
+			wg.Add(1)
+			go func(i int, request json.RawMessage) {
+				replies[i] = handle(request)
+				sem.release()
+				wg.Done()
+			}(i, request)
+		}
+		wg.Wait()
+	}
+
+	var buf bytes.Buffer
+	for _, reply := range replies {
+		if reply == nil {
+			continue
+		}
+		if buf.Len() == 0 {
+			buf.WriteByte('[')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.Write(reply)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
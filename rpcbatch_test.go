@@ -0,0 +1,102 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+)
+
+// TestParseRPCBatch ensures batches are told apart from single requests and
+// that malformed, empty, and oversized batches are rejected.
+func TestParseRPCBatch(t *testing.T) {
+	if isRPCBatch([]byte(`{"method":"getinfo","params":[],"id":1}`)) {
+		t.Fatalf("single request was taken for a batch")
+	}
+	if !isRPCBatch([]byte(" \n[{\"method\":\"getinfo\"}]")) {
+		t.Fatalf("batch was taken for a single request")
+	}
+
+	requests, jsonErr := parseRPCBatch([]byte(`[{"id":1}, 2, {"id":3}]`))
+	if jsonErr != nil || len(requests) != 3 {
+		t.Fatalf("parseRPCBatch: got %d requests (%v), want 3",
+			len(requests), jsonErr)
+	}
+
+	oversized := "[" + strings.Repeat("{},", rpcMaxBatchSize) + "{}]"
+	tests := []struct {
+		name     string
+		batch    string
+		wantCode btcjson.RPCErrorCode
+	}{
+		{"malformed", `[{"id":1}`, btcjson.ErrRPCParse.Code},
+		{"empty", `[]`, btcjson.ErrRPCInvalidRequest.Code},
+		{"oversized", oversized, btcjson.ErrRPCInvalidRequest.Code},
+	}
+	for _, test := range tests {
+		_, jsonErr := parseRPCBatch([]byte(test.batch))
+		if jsonErr == nil || jsonErr.Code != test.wantCode {
+			t.Errorf("%s: got error %v, want code %d", test.name,
+				jsonErr, test.wantCode)
+		}
+	}
+}
+
+// TestRunRPCBatch ensures the replies of a batch are returned in the order of
+// the requests regardless of the order they complete in, that requests without
+// replies are left out, and that the parallelism is bounded.
+func TestRunRPCBatch(t *testing.T) {
+	requests := []json.RawMessage{
+		json.RawMessage(`30`), json.RawMessage(`0`),
+		json.RawMessage(`20`), json.RawMessage(`-1`),
+		json.RawMessage(`10`),
+	}
+	for _, parallelism := range []int{1, 2, 5} {
+		var running, maxRunning int32
+		reply := runRPCBatch(requests, parallelism,
+			func(request json.RawMessage) []byte {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					highest := atomic.LoadInt32(&maxRunning)
+					if n <= highest || atomic.CompareAndSwapInt32(
+						&maxRunning, highest, n) {
+
+						break
+					}
+				}
+
+				var ms int
+				json.Unmarshal(request, &ms)
+				if ms < 0 {
+					return nil
+				}
+				time.Sleep(time.Duration(ms) * time.Millisecond)
+				return request
+			})
+
+		if string(reply) != "[30,0,20,10]" {
+			t.Errorf("parallelism %d: got reply %s, want "+
+				"[30,0,20,10]", parallelism, reply)
+		}
+		if maxRunning > int32(parallelism) {
+			t.Errorf("parallelism %d: %d requests ran concurrently",
+				parallelism, maxRunning)
+		}
+	}
+
+	reply := runRPCBatch(requests[3:4], 1, func(json.RawMessage) []byte {
+		return nil
+	})
+	if reply != nil {
+		t.Errorf("got reply %s for batch of notifications, want none",
+			reply)
+	}
+}
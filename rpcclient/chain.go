@@ -481,6 +481,170 @@ func (c *Client) GetBlockHeaderVerbose(blockHash *chainhash.Hash) (*btcjson.GetB
 	return c.GetBlockHeaderVerboseAsync(blockHash).Receive()
 }
 
+// FutureGetBlockStatsResult is a future promise to deliver the result of a
+// GetBlockStatsAsync RPC invocation (or an applicable error).
+type FutureGetBlockStatsResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// statistics of the block.
+func (r FutureGetBlockStatsResult) Receive() (*btcjson.GetBlockStatsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats btcjson.GetBlockStatsResult
+	err = json.Unmarshal(res, &stats)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetBlockStatsAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetBlockStats for the blocking version and more details.
+func (c *Client) GetBlockStatsAsync(hashOrHeight interface{}, stats *[]string) FutureGetBlockStatsResult {
+	switch v := hashOrHeight.(type) {
+	case *chainhash.Hash:
+		hashOrHeight = v.String()
+	case int:
+		hashOrHeight = int64(v)
+	case int32:
+		hashOrHeight = int64(v)
+	}
+	cmd := btcjson.NewGetBlockStatsCmd(hashOrHeight, stats)
+	return c.sendCmd(cmd)
+}
+
+// GetBlockStats returns statistics about the transactions of a block of the
+// main chain, which is identified by either its *chainhash.Hash or its height.
+// Only the statistics with the passed names are returned unless stats is nil.
+func (c *Client) GetBlockStats(hashOrHeight interface{}, stats *[]string) (*btcjson.GetBlockStatsResult, error) {
+	return c.GetBlockStatsAsync(hashOrHeight, stats).Receive()
+}
+
+// FutureGetChainTipsResult is a future promise to deliver the result of a
+// GetChainTipsAsync RPC invocation (or an applicable error).
+type FutureGetChainTipsResult chan *response
+
+// Receive waits for the response promised by the future and returns the known
+// chain tips.
+func (r FutureGetChainTipsResult) Receive() ([]btcjson.GetChainTipsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var tips []btcjson.GetChainTipsResult
+	err = json.Unmarshal(res, &tips)
+	if err != nil {
+		return nil, err
+	}
+	return tips, nil
+}
+
+// GetChainTipsAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetChainTips for the blocking version and more details.
+func (c *Client) GetChainTipsAsync() FutureGetChainTipsResult {
+	cmd := btcjson.NewGetChainTipsCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetChainTips returns the tip of the main chain along with the tips of all
+// known forks from it ordered by height.
+func (c *Client) GetChainTips() ([]btcjson.GetChainTipsResult, error) {
+	return c.GetChainTipsAsync().Receive()
+}
+
+// FutureGetChainTxStatsResult is a future promise to deliver the result of a
+// GetChainTxStatsAsync RPC invocation (or an applicable error).
+type FutureGetChainTxStatsResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// transaction statistics of the chain.
+func (r FutureGetChainTxStatsResult) Receive() (*btcjson.GetChainTxStatsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats btcjson.GetChainTxStatsResult
+	err = json.Unmarshal(res, &stats)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetChainTxStatsAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetChainTxStats for the blocking version and more details.
+func (c *Client) GetChainTxStatsAsync(nBlocks *int32, blockHash *chainhash.Hash) FutureGetChainTxStatsResult {
+	var hash *string
+	if blockHash != nil {
+		hash = btcjson.String(blockHash.String())
+	}
+	cmd := btcjson.NewGetChainTxStatsCmd(nBlocks, hash)
+	return c.sendCmd(cmd)
+}
+
+// GetChainTxStats returns statistics about the number of transactions in the
+// main chain up to the passed block and in the window of nBlocks blocks ending
+// with it.  A nil block hash selects the tip of the main chain and a nil number
+// of blocks a window of about a month.
+func (c *Client) GetChainTxStats(nBlocks *int32, blockHash *chainhash.Hash) (*btcjson.GetChainTxStatsResult, error) {
+	return c.GetChainTxStatsAsync(nBlocks, blockHash).Receive()
+}
+
+// FutureGetDeploymentInfoResult is a future promise to deliver the result of a
+// GetDeploymentInfoAsync RPC invocation (or an applicable error).
+type FutureGetDeploymentInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// parameters and the status of the deployments.
+func (r FutureGetDeploymentInfoResult) Receive() (*btcjson.GetDeploymentInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var info btcjson.GetDeploymentInfoResult
+	err = json.Unmarshal(res, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetDeploymentInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetDeploymentInfo for the blocking version and more details.
+func (c *Client) GetDeploymentInfoAsync(blockHash *chainhash.Hash) FutureGetDeploymentInfoResult {
+	var hash *string
+	if blockHash != nil {
+		hash = btcjson.String(blockHash.String())
+	}
+	cmd := btcjson.NewGetDeploymentInfoCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// GetDeploymentInfo returns the parameters and the status of the soft-fork
+// deployments as of the block after the passed block of the main chain, or
+// after the tip of the main chain when it is nil.
+func (c *Client) GetDeploymentInfo(blockHash *chainhash.Hash) (*btcjson.GetDeploymentInfoResult, error) {
+	return c.GetDeploymentInfoAsync(blockHash).Receive()
+}
+
 // FutureGetMempoolEntryResult is a future promise to deliver the result of a
 // GetMempoolEntryAsync RPC invocation (or an applicable error).
 type FutureGetMempoolEntryResult chan *response
@@ -612,6 +776,113 @@ func (c *Client) GetRawMempoolVerbose() (map[string]btcjson.GetRawMempoolVerbose
 	return c.GetRawMempoolVerboseAsync().Receive()
 }
 
+// FuturePrioritiseTransactionResult is a future promise to deliver the result
+// of a PrioritiseTransactionAsync RPC invocation (or an applicable error).
+type FuturePrioritiseTransactionResult chan *response
+
+// Receive waits for the response promised by the future and returns an error if
+// the fee delta could not be applied.
+func (r FuturePrioritiseTransactionResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// PrioritiseTransactionAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See PrioritiseTransaction for the blocking version and more details.
+func (c *Client) PrioritiseTransactionAsync(txHash *chainhash.Hash, feeDelta int64) FuturePrioritiseTransactionResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := btcjson.NewPrioritiseTransactionCmd(hash, feeDelta)
+	return c.sendCmd(cmd)
+}
+
+// PrioritiseTransaction adds the passed fee delta in satoshi to the fee the
+// server uses for the transaction with the passed hash when selecting
+// transactions for new blocks and evicting transactions from its memory pool.
+// The transaction does not have to be in the memory pool yet.
+func (c *Client) PrioritiseTransaction(txHash *chainhash.Hash, feeDelta int64) error {
+	return c.PrioritiseTransactionAsync(txHash, feeDelta).Receive()
+}
+
+// FutureGetPrioritisedTransactionsResult is a future promise to deliver the
+// result of a GetPrioritisedTransactionsAsync RPC invocation (or an applicable
+// error).
+type FutureGetPrioritisedTransactionsResult chan *response
+
+// Receive waits for the response promised by the future and returns a map of
+// transaction hashes to the fee deltas set for them.
+func (r FutureGetPrioritisedTransactionsResult) Receive() (map[string]btcjson.PrioritisedTransactionResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var prioritised map[string]btcjson.PrioritisedTransactionResult
+	err = json.Unmarshal(res, &prioritised)
+	if err != nil {
+		return nil, err
+	}
+	return prioritised, nil
+}
+
+// GetPrioritisedTransactionsAsync returns an instance of a type that can be
+// used to get the result of the RPC at some future time by invoking the
+// Receive function on the returned instance.
+//
+// See GetPrioritisedTransactions for the blocking version and more details.
+func (c *Client) GetPrioritisedTransactionsAsync() FutureGetPrioritisedTransactionsResult {
+	cmd := btcjson.NewGetPrioritisedTransactionsCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetPrioritisedTransactions returns a map of transaction hashes to the fee
+// deltas set for them with PrioritiseTransaction.
+func (c *Client) GetPrioritisedTransactions() (map[string]btcjson.PrioritisedTransactionResult, error) {
+	return c.GetPrioritisedTransactionsAsync().Receive()
+}
+
+// FutureGetZMQNotificationsResult is a future promise to deliver the result of
+// a GetZMQNotificationsAsync RPC invocation (or an applicable error).
+type FutureGetZMQNotificationsResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// enabled ZMQ notifications.
+func (r FutureGetZMQNotificationsResult) Receive() ([]btcjson.GetZMQNotificationsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []btcjson.GetZMQNotificationsResult
+	err = json.Unmarshal(res, &notifications)
+	if err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// GetZMQNotificationsAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetZMQNotifications for the blocking version and more details.
+func (c *Client) GetZMQNotificationsAsync() FutureGetZMQNotificationsResult {
+	cmd := btcjson.NewGetZMQNotificationsCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetZMQNotifications returns the ZMQ notifications enabled on the server
+// along with the addresses they are published on.
+func (c *Client) GetZMQNotifications() ([]btcjson.GetZMQNotificationsResult, error) {
+	return c.GetZMQNotificationsAsync().Receive()
+}
+
 // FutureEstimateFeeResult is a future promise to deliver the result of a
 // EstimateFeeAsync RPC invocation (or an applicable error).
 type FutureEstimateFeeResult chan *response
@@ -649,6 +920,42 @@ func (c *Client) EstimateFee(numBlocks int64) (float64, error) {
 	return c.EstimateFeeAsync(numBlocks).Receive()
 }
 
+// FutureEstimateSmartFeeResult is a future promise to deliver the result of a
+// EstimateSmartFeeAsync RPC invocation (or an applicable error).
+type FutureEstimateSmartFeeResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// estimated fee rate along with the number of blocks it is for.
+func (r FutureEstimateSmartFeeResult) Receive() (*btcjson.EstimateSmartFeeResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result btcjson.EstimateSmartFeeResult
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// EstimateSmartFeeAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See EstimateSmartFee for the blocking version and more details.
+func (c *Client) EstimateSmartFeeAsync(confTarget int64, mode *btcjson.EstimateSmartFeeMode) FutureEstimateSmartFeeResult {
+	cmd := btcjson.NewEstimateSmartFeeCmd(confTarget, mode)
+	return c.sendCmd(cmd)
+}
+
+// EstimateSmartFee requests the server to estimate a fee rate in bitcoins per
+// kilobyte for a transaction to be mined within confTarget blocks.
+func (c *Client) EstimateSmartFee(confTarget int64, mode *btcjson.EstimateSmartFeeMode) (*btcjson.EstimateSmartFeeResult, error) {
+	return c.EstimateSmartFeeAsync(confTarget, mode).Receive()
+}
+
 // FutureVerifyChainResult is a future promise to deliver the result of a
 // VerifyChainAsync, VerifyChainLevelAsyncRPC, or VerifyChainBlocksAsync
 // invocation (or an applicable error).
@@ -787,6 +1094,129 @@ func (c *Client) GetTxOut(txHash *chainhash.Hash, index uint32, mempool bool) (*
 	return c.GetTxOutAsync(txHash, index, mempool).Receive()
 }
 
+// FutureGetTxOutSetInfoResult is a future promise to deliver the result of a
+// GetTxOutSetInfoAsync RPC invocation (or an applicable error).
+type FutureGetTxOutSetInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// statistics of the unspent transaction output set.
+func (r FutureGetTxOutSetInfoResult) Receive() (*btcjson.GetTxOutSetInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var info btcjson.GetTxOutSetInfoResult
+	err = json.Unmarshal(res, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetTxOutSetInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetTxOutSetInfo for the blocking version and more details.
+func (c *Client) GetTxOutSetInfoAsync(hashType *string) FutureGetTxOutSetInfoResult {
+	cmd := btcjson.NewGetTxOutSetInfoCmd(hashType)
+	return c.sendCmd(cmd)
+}
+
+// GetTxOutSetInfo returns the statistics of the unspent transaction output set
+// as of the tip of the main chain along with its hash of the passed type, which
+// is one of hash_serialized_3, muhash, and none.  A nil hash type selects
+// hash_serialized_3.
+func (c *Client) GetTxOutSetInfo(hashType *string) (*btcjson.GetTxOutSetInfoResult, error) {
+	return c.GetTxOutSetInfoAsync(hashType).Receive()
+}
+
+// FutureScanTxOutSetResult is a future promise to deliver the result of a
+// ScanTxOutSetAsync RPC invocation (or an applicable error).
+type FutureScanTxOutSetResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// unspent transaction outputs found by the scan.
+func (r FutureScanTxOutSetResult) Receive() (*btcjson.ScanTxOutSetResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result btcjson.ScanTxOutSetResult
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ScanTxOutSetAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See ScanTxOutSet for the blocking version and more details.
+func (c *Client) ScanTxOutSetAsync(scanObjects []btcjson.ScanObject) FutureScanTxOutSetResult {
+	cmd := btcjson.NewScanTxOutSetCmd("start", &scanObjects)
+	return c.sendCmd(cmd)
+}
+
+// ScanTxOutSet scans the unspent transaction output set for the outputs whose
+// scripts are described by the passed output descriptors.  The scan in progress
+// can be queried and aborted with the status and abort actions of the
+// scantxoutset RPC.
+func (c *Client) ScanTxOutSet(scanObjects []btcjson.ScanObject) (*btcjson.ScanTxOutSetResult, error) {
+	return c.ScanTxOutSetAsync(scanObjects).Receive()
+}
+
+// FutureGetTxSpendingPrevOutResult is a future promise to deliver the result of
+// a GetTxSpendingPrevOutAsync RPC invocation (or an applicable error).
+type FutureGetTxSpendingPrevOutResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// spending transactions of the requested outputs.
+func (r FutureGetTxSpendingPrevOutResult) Receive() ([]btcjson.GetTxSpendingPrevOutResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an array of gettxspendingprevout result objects.
+	var results []btcjson.GetTxSpendingPrevOutResult
+	err = json.Unmarshal(res, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// GetTxSpendingPrevOutAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetTxSpendingPrevOut for the blocking version and more details.
+func (c *Client) GetTxSpendingPrevOutAsync(outpoints []wire.OutPoint) FutureGetTxSpendingPrevOutResult {
+	outputs := make([]btcjson.TransactionInput, 0, len(outpoints))
+	for _, outpoint := range outpoints {
+		outputs = append(outputs, btcjson.TransactionInput{
+			Txid: outpoint.Hash.String(),
+			Vout: outpoint.Index,
+		})
+	}
+
+	cmd := btcjson.NewGetTxSpendingPrevOutCmd(outputs)
+	return c.sendCmd(cmd)
+}
+
+// GetTxSpendingPrevOut returns the transactions which spend the passed
+// outpoints.  Spends in the main chain are only found when the server runs
+// with the spent output index.
+func (c *Client) GetTxSpendingPrevOut(outpoints []wire.OutPoint) ([]btcjson.GetTxSpendingPrevOutResult, error) {
+	return c.GetTxSpendingPrevOutAsync(outpoints).Receive()
+}
+
 // FutureRescanBlocksResult is a future promise to deliver the result of a
 // RescanBlocksAsync RPC invocation (or an applicable error).
 //
@@ -874,6 +1304,39 @@ func (c *Client) InvalidateBlock(blockHash *chainhash.Hash) error {
 	return c.InvalidateBlockAsync(blockHash).Receive()
 }
 
+// FutureReconsiderBlockResult is a future promise to deliver the result of a
+// ReconsiderBlockAsync RPC invocation (or an applicable error).
+type FutureReconsiderBlockResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the block could not be reconsidered.
+func (r FutureReconsiderBlockResult) Receive() error {
+	_, err := receiveFuture(r)
+
+	return err
+}
+
+// ReconsiderBlockAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See ReconsiderBlock for the blocking version and more details.
+func (c *Client) ReconsiderBlockAsync(blockHash *chainhash.Hash) FutureReconsiderBlockResult {
+	hash := ""
+	if blockHash != nil {
+		hash = blockHash.String()
+	}
+
+	cmd := btcjson.NewReconsiderBlockCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// ReconsiderBlock removes the invalid status of a block which was previously
+// invalidated with InvalidateBlock.
+func (c *Client) ReconsiderBlock(blockHash *chainhash.Hash) error {
+	return c.ReconsiderBlockAsync(blockHash).Receive()
+}
+
 // FutureGetCFilterResult is a future promise to deliver the result of a
 // GetCFilterAsync RPC invocation (or an applicable error).
 type FutureGetCFilterResult chan *response
@@ -471,3 +471,991 @@ func (c *Client) VersionAsync() FutureVersionResult {
 func (c *Client) Version() (map[string]btcjson.VersionResult, error) {
 	return c.VersionAsync().Receive()
 }
+
+// FutureImportXpubAccountResult is a future promise to deliver the error
+// result of an ImportXpubAccountAsync RPC invocation.
+type FutureImportXpubAccountResult chan *response
+
+// Receive waits for and returns the error response promised by the future.
+func (r FutureImportXpubAccountResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// ImportXpubAccountAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See ImportXpubAccount for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ImportXpubAccountAsync(name, xpub string, addrType *string,
+	gapLimit *uint32) FutureImportXpubAccountResult {
+
+	cmd := btcjson.NewImportXpubAccountCmd(name, xpub, addrType, gapLimit)
+	return c.sendCmd(cmd)
+}
+
+// ImportXpubAccount registers a named watch-only account which tracks the
+// addresses of the passed type derived from the passed extended public key.
+// The server must have the address index enabled.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ImportXpubAccount(name, xpub string, addrType *string,
+	gapLimit *uint32) error {
+
+	return c.ImportXpubAccountAsync(name, xpub, addrType, gapLimit).Receive()
+}
+
+// FutureRemoveXpubAccountResult is a future promise to deliver the error
+// result of a RemoveXpubAccountAsync RPC invocation.
+type FutureRemoveXpubAccountResult chan *response
+
+// Receive waits for and returns the error response promised by the future.
+func (r FutureRemoveXpubAccountResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// RemoveXpubAccountAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See RemoveXpubAccount for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) RemoveXpubAccountAsync(name string) FutureRemoveXpubAccountResult {
+	cmd := btcjson.NewRemoveXpubAccountCmd(name)
+	return c.sendCmd(cmd)
+}
+
+// RemoveXpubAccount removes the watch-only account with the passed name.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) RemoveXpubAccount(name string) error {
+	return c.RemoveXpubAccountAsync(name).Receive()
+}
+
+// FutureListXpubAccountsResult is a future promise to deliver the result of a
+// ListXpubAccountsAsync RPC invocation (or an applicable error).
+type FutureListXpubAccountsResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// registered watch-only accounts.
+func (r FutureListXpubAccountsResult) Receive() ([]btcjson.XpubAccountResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []btcjson.XpubAccountResult
+	err = json.Unmarshal(res, &accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// ListXpubAccountsAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See ListXpubAccounts for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ListXpubAccountsAsync() FutureListXpubAccountsResult {
+	cmd := btcjson.NewListXpubAccountsCmd()
+	return c.sendCmd(cmd)
+}
+
+// ListXpubAccounts returns the registered watch-only accounts.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ListXpubAccounts() ([]btcjson.XpubAccountResult, error) {
+	return c.ListXpubAccountsAsync().Receive()
+}
+
+// FutureGetXpubAccountBalanceResult is a future promise to deliver the result
+// of a GetXpubAccountBalanceAsync RPC invocation (or an applicable error).
+type FutureGetXpubAccountBalanceResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// balances of the watch-only account.
+func (r FutureGetXpubAccountBalanceResult) Receive() (*btcjson.GetXpubAccountBalanceResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var balance btcjson.GetXpubAccountBalanceResult
+	err = json.Unmarshal(res, &balance)
+	if err != nil {
+		return nil, err
+	}
+
+	return &balance, nil
+}
+
+// GetXpubAccountBalanceAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetXpubAccountBalance for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetXpubAccountBalanceAsync(name string, minConf *int) FutureGetXpubAccountBalanceResult {
+	cmd := btcjson.NewGetXpubAccountBalanceCmd(name, minConf)
+	return c.sendCmd(cmd)
+}
+
+// GetXpubAccountBalance returns the confirmed and unconfirmed balances and the
+// received total of the watch-only account with the passed name.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetXpubAccountBalance(name string, minConf *int) (*btcjson.GetXpubAccountBalanceResult, error) {
+	return c.GetXpubAccountBalanceAsync(name, minConf).Receive()
+}
+
+// FutureListXpubAccountUnspentResult is a future promise to deliver the result
+// of a ListXpubAccountUnspentAsync RPC invocation (or an applicable error).
+type FutureListXpubAccountUnspentResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// unspent outputs of the watch-only account.
+func (r FutureListXpubAccountUnspentResult) Receive() ([]btcjson.XpubAccountUnspentResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var unspent []btcjson.XpubAccountUnspentResult
+	err = json.Unmarshal(res, &unspent)
+	if err != nil {
+		return nil, err
+	}
+
+	return unspent, nil
+}
+
+// ListXpubAccountUnspentAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See ListXpubAccountUnspent for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ListXpubAccountUnspentAsync(name string, minConf *int) FutureListXpubAccountUnspentResult {
+	cmd := btcjson.NewListXpubAccountUnspentCmd(name, minConf)
+	return c.sendCmd(cmd)
+}
+
+// ListXpubAccountUnspent returns the unspent outputs of the watch-only account
+// with the passed name.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ListXpubAccountUnspent(name string, minConf *int) ([]btcjson.XpubAccountUnspentResult, error) {
+	return c.ListXpubAccountUnspentAsync(name, minConf).Receive()
+}
+
+// FutureListReorgsResult is a future promise to deliver the result of a
+// ListReorgsAsync RPC invocation (or an applicable error).
+type FutureListReorgsResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// requested reorganizations along with the total number of persisted
+// reorganizations.
+func (r FutureListReorgsResult) Receive() (*btcjson.ListReorgsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var reorgs btcjson.ListReorgsResult
+	err = json.Unmarshal(res, &reorgs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reorgs, nil
+}
+
+// ListReorgsAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See ListReorgs for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ListReorgsAsync(skip, count *int, reverse *bool) FutureListReorgsResult {
+	cmd := btcjson.NewListReorgsCmd(skip, count, reverse)
+	return c.sendCmd(cmd)
+}
+
+// ListReorgs returns the reorganizations of the main chain performed by the
+// server.  They are ordered from the most recent to the oldest unless reverse
+// is set.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ListReorgs(skip, count *int, reverse *bool) (*btcjson.ListReorgsResult, error) {
+	return c.ListReorgsAsync(skip, count, reverse).Receive()
+}
+
+// FutureGetCheckpointsResult is a future promise to deliver the result of a
+// GetCheckpointsAsync RPC invocation (or an applicable error).
+type FutureGetCheckpointsResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// checkpoint mode along with the checkpoints of the server.
+func (r FutureGetCheckpointsResult) Receive() (*btcjson.GetCheckpointsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoints btcjson.GetCheckpointsResult
+	err = json.Unmarshal(res, &checkpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	return &checkpoints, nil
+}
+
+// GetCheckpointsAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetCheckpoints for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetCheckpointsAsync() FutureGetCheckpointsResult {
+	cmd := btcjson.NewGetCheckpointsCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetCheckpoints returns how blocks which conflict with the checkpoints are
+// handled by the server along with the checkpoints its chain is validated
+// against.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetCheckpoints() (*btcjson.GetCheckpointsResult, error) {
+	return c.GetCheckpointsAsync().Receive()
+}
+
+// FutureAddCheckpointResult is a future promise to deliver the error result of
+// an AddCheckpointAsync RPC invocation.
+type FutureAddCheckpointResult chan *response
+
+// Receive waits for and returns the error response promised by the future.
+func (r FutureAddCheckpointResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// AddCheckpointAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See AddCheckpoint for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) AddCheckpointAsync(height int32, hash *chainhash.Hash) FutureAddCheckpointResult {
+	cmd := btcjson.NewAddCheckpointCmd(height, hash.String(), nil)
+	return c.sendCmd(cmd)
+}
+
+// AddCheckpoint adds a local checkpoint the chain of the server is validated
+// against.  The checkpoint is not persisted across restarts of the server.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) AddCheckpoint(height int32, hash *chainhash.Hash) error {
+	return c.AddCheckpointAsync(height, hash).Receive()
+}
+
+// PersistCheckpointAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function
+// on the returned instance.
+//
+// See PersistCheckpoint for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) PersistCheckpointAsync(height int32, hash *chainhash.Hash) FutureAddCheckpointResult {
+	cmd := btcjson.NewAddCheckpointCmd(height, hash.String(),
+		btcjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// PersistCheckpoint adds a local checkpoint the chain of the server is
+// validated against and appends it to the checkpoint file of the server so it
+// is loaded again on restart.  The server must be configured with a checkpoint
+// file.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) PersistCheckpoint(height int32, hash *chainhash.Hash) error {
+	return c.PersistCheckpointAsync(height, hash).Receive()
+}
+
+// FutureGetMempoolPackageResult is a future promise to deliver the result of a
+// GetMempoolPackageAsync RPC invocation (or an applicable error).
+type FutureGetMempoolPackageResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// dependency graph of the package of the requested transaction.
+func (r FutureGetMempoolPackageResult) Receive() (*btcjson.GetMempoolPackageResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkg btcjson.GetMempoolPackageResult
+	err = json.Unmarshal(res, &pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkg, nil
+}
+
+// GetMempoolPackageAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetMempoolPackage for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetMempoolPackageAsync(txHash *chainhash.Hash) FutureGetMempoolPackageResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := btcjson.NewGetMempoolPackageCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolPackage returns the dependency graph of the package formed by the
+// passed memory pool transaction along with all of its unconfirmed ancestors
+// and descendants.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetMempoolPackage(txHash *chainhash.Hash) (*btcjson.GetMempoolPackageResult, error) {
+	return c.GetMempoolPackageAsync(txHash).Receive()
+}
+
+// FutureGetMempoolClusterResult is a future promise to deliver the result of a
+// GetMempoolClusterAsync RPC invocation (or an applicable error).
+type FutureGetMempoolClusterResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// cluster of the requested transaction.
+func (r FutureGetMempoolClusterResult) Receive() (*btcjson.GetMempoolClusterResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var cluster btcjson.GetMempoolClusterResult
+	err = json.Unmarshal(res, &cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cluster, nil
+}
+
+// GetMempoolClusterAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetMempoolCluster for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetMempoolClusterAsync(txHash *chainhash.Hash) FutureGetMempoolClusterResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := btcjson.NewGetMempoolClusterCmd(hash)
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolCluster returns the cluster formed by the passed memory pool
+// transaction along with all unconfirmed transactions connected to it through
+// spends, split into the chunks it is mined and evicted in.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetMempoolCluster(txHash *chainhash.Hash) (*btcjson.GetMempoolClusterResult, error) {
+	return c.GetMempoolClusterAsync(txHash).Receive()
+}
+
+// FutureGetMempoolDiagramResult is a future promise to deliver the result of a
+// GetMempoolDiagramAsync RPC invocation (or an applicable error).
+type FutureGetMempoolDiagramResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// feerate diagram of the memory pool.
+func (r FutureGetMempoolDiagramResult) Receive() ([]btcjson.FeeRateDiagramPointResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var diagram []btcjson.FeeRateDiagramPointResult
+	err = json.Unmarshal(res, &diagram)
+	if err != nil {
+		return nil, err
+	}
+
+	return diagram, nil
+}
+
+// GetMempoolDiagramAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetMempoolDiagram for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetMempoolDiagramAsync() FutureGetMempoolDiagramResult {
+	cmd := btcjson.NewGetMempoolDiagramCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetMempoolDiagram returns the feerate diagram of the memory pool, which is
+// the cumulative fee and virtual size of the chunks of all clusters in order of
+// decreasing fee rate.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetMempoolDiagram() ([]btcjson.FeeRateDiagramPointResult, error) {
+	return c.GetMempoolDiagramAsync().Receive()
+}
+
+// FutureGetTimeInfoResult is a future promise to deliver the result of a
+// GetTimeInfoAsync RPC invocation (or an applicable error).
+type FutureGetTimeInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the offset
+// the local clock of the server is adjusted by along with its time samples.
+func (r FutureGetTimeInfoResult) Receive() (*btcjson.GetTimeInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeInfo btcjson.GetTimeInfoResult
+	err = json.Unmarshal(res, &timeInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &timeInfo, nil
+}
+
+// GetTimeInfoAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetTimeInfo for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetTimeInfoAsync() FutureGetTimeInfoResult {
+	cmd := btcjson.NewGetTimeInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetTimeInfo returns the offset the local clock of the server is adjusted by
+// based on the clocks of its peers along with the time samples it is derived
+// from.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetTimeInfo() (*btcjson.GetTimeInfoResult, error) {
+	return c.GetTimeInfoAsync().Receive()
+}
+
+// FutureLogTraceResult is a future promise to deliver the result of a
+// LogTraceAsync RPC invocation (or an applicable error).
+type FutureLogTraceResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// current targets of the selective trace logging.
+func (r FutureLogTraceResult) Receive() ([]btcjson.LogTraceTargetResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []btcjson.LogTraceTargetResult
+	err = json.Unmarshal(res, &targets)
+	if err != nil {
+		return nil, err
+	}
+
+	return targets, nil
+}
+
+// LogTraceAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See LogTrace for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) LogTraceAsync(action string, target *string) FutureLogTraceResult {
+	cmd := btcjson.NewLogTraceCmd(action, target)
+	return c.sendCmd(cmd)
+}
+
+// LogTrace performs the passed action (add, remove, clear, or list) on the
+// targets of the selective trace logging of the server and returns the
+// resulting targets.  The target is only used by the add and remove actions.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) LogTrace(action string, target *string) ([]btcjson.LogTraceTargetResult, error) {
+	return c.LogTraceAsync(action, target).Receive()
+}
+
+// GetTxOutMempoolViewAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See GetTxOutMempoolView for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetTxOutMempoolViewAsync(txHash *chainhash.Hash, index uint32) FutureGetTxOutResult {
+	hash := ""
+	if txHash != nil {
+		hash = txHash.String()
+	}
+
+	cmd := &btcjson.GetTxOutCmd{
+		Txid:                 hash,
+		Vout:                 index,
+		IncludeMempool:       btcjson.Bool(true),
+		IncludeMempoolSpends: btcjson.Bool(true),
+	}
+	return c.sendCmd(cmd)
+}
+
+// GetTxOutMempoolView returns the transaction output info from the combined
+// view of the main chain and the mempool.  Outputs created by transactions in
+// the mempool are flagged as unconfirmed, and nil is returned for outputs which
+// are spent either in the main chain or by a transaction in the mempool.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetTxOutMempoolView(txHash *chainhash.Hash, index uint32) (*btcjson.GetTxOutResult, error) {
+	return c.GetTxOutMempoolViewAsync(txHash, index).Receive()
+}
+
+// FutureValidateBlockResult is a future promise to deliver the result of a
+// ValidateBlockAsync RPC invocation (or an applicable error).
+type FutureValidateBlockResult chan *response
+
+// Receive waits for the response promised by the future and returns the result
+// of validating the block.
+func (r FutureValidateBlockResult) Receive() (*btcjson.ValidateBlockResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a validateblock result object.
+	var result btcjson.ValidateBlockResult
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ValidateBlockAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See ValidateBlock for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ValidateBlockAsync(block *btcutil.Block, checkPoW bool) FutureValidateBlockResult {
+	blockHex := ""
+	if block != nil {
+		blockBytes, err := block.Bytes()
+		if err != nil {
+			return newFutureError(err)
+		}
+		blockHex = hex.EncodeToString(blockBytes)
+	}
+
+	cmd := btcjson.NewValidateBlockCmd(blockHex, &checkPoW)
+	return c.sendCmd(cmd)
+}
+
+// ValidateBlock fully validates the passed block as if it were connected to the
+// tip of the main chain without the server storing or relaying it.  The proof
+// of work of the block is only checked when checkPoW is true, which allows
+// unsolved block templates to be validated.  A block which violates a
+// consensus rule is reported in the result rather than as an error.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ValidateBlock(block *btcutil.Block, checkPoW bool) (*btcjson.ValidateBlockResult, error) {
+	return c.ValidateBlockAsync(block, checkPoW).Receive()
+}
+
+// FutureGetOrphanBlockInfoResult is a future promise to deliver the result of a
+// GetOrphanBlockInfoAsync RPC invocation (or an applicable error).
+type FutureGetOrphanBlockInfoResult chan *response
+
+// Receive waits for the response promised by the future and returns the state
+// of the orphan block pool of the server.
+func (r FutureGetOrphanBlockInfoResult) Receive() (*btcjson.GetOrphanBlockInfoResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphanInfo btcjson.GetOrphanBlockInfoResult
+	err = json.Unmarshal(res, &orphanInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &orphanInfo, nil
+}
+
+// GetOrphanBlockInfoAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetOrphanBlockInfo for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetOrphanBlockInfoAsync() FutureGetOrphanBlockInfoResult {
+	cmd := btcjson.NewGetOrphanBlockInfoCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetOrphanBlockInfo returns the state of the orphan block pool of the server
+// along with the number of orphan blocks which went through it.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetOrphanBlockInfo() (*btcjson.GetOrphanBlockInfoResult, error) {
+	return c.GetOrphanBlockInfoAsync().Receive()
+}
+
+// FutureGetSyncProgressResult is a future promise to deliver the result of a
+// GetSyncProgressAsync RPC invocation (or an applicable error).
+type FutureGetSyncProgressResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// progress of the synchronization of the chain of the server with the network.
+func (r FutureGetSyncProgressResult) Receive() (*btcjson.GetSyncProgressResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var progress btcjson.GetSyncProgressResult
+	err = json.Unmarshal(res, &progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &progress, nil
+}
+
+// GetSyncProgressAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetSyncProgress for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetSyncProgressAsync() FutureGetSyncProgressResult {
+	cmd := btcjson.NewGetSyncProgressCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetSyncProgress returns the progress of the synchronization of the chain of
+// the server with the network, including the heights of the best header and
+// block, the sync peer, and estimates of the verification progress and the time
+// remaining.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetSyncProgress() (*btcjson.GetSyncProgressResult, error) {
+	return c.GetSyncProgressAsync().Receive()
+}
+
+// FutureListAttestationsResult is a future promise to deliver the result of a
+// ListAttestationsAsync RPC invocation (or an applicable error).
+type FutureListAttestationsResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// attestations of the chain state signed by the server.
+func (r FutureListAttestationsResult) Receive() (*btcjson.ListAttestationsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var attestations btcjson.ListAttestationsResult
+	err = json.Unmarshal(res, &attestations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attestations, nil
+}
+
+// ListAttestationsAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See ListAttestations for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ListAttestationsAsync(skip, count int, reverse bool) FutureListAttestationsResult {
+	cmd := btcjson.NewListAttestationsCmd(&skip, &count, &reverse)
+	return c.sendCmd(cmd)
+}
+
+// ListAttestations returns up to count attestations of the chain state signed
+// by the server after skipping the passed number of attestations, along with
+// the public key they are signed with.  The attestations are ordered from the
+// most recent to the oldest unless reverse is set.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ListAttestations(skip, count int, reverse bool) (*btcjson.ListAttestationsResult, error) {
+	return c.ListAttestationsAsync(skip, count, reverse).Receive()
+}
+
+// FutureBackupDatabaseResult is a future promise to deliver the result of a
+// BackupDatabaseAsync RPC invocation (or an applicable error).
+type FutureBackupDatabaseResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// description of the database backup written by the server.
+func (r FutureBackupDatabaseResult) Receive() (*btcjson.BackupDatabaseResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result btcjson.BackupDatabaseResult
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// BackupDatabaseAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See BackupDatabase for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) BackupDatabaseAsync(path string) FutureBackupDatabaseResult {
+	cmd := btcjson.NewBackupDatabaseCmd(path)
+	return c.sendCmd(cmd)
+}
+
+// BackupDatabase makes the server write a consistent backup of its block
+// database to the file at the passed path, which is relative to the data
+// directory of the server unless absolute.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) BackupDatabase(path string) (*btcjson.BackupDatabaseResult, error) {
+	return c.BackupDatabaseAsync(path).Receive()
+}
+
+// FutureGetDatabaseStatsResult is a future promise to deliver the result of a
+// GetDatabaseStatsAsync RPC invocation (or an applicable error).
+type FutureGetDatabaseStatsResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// counters which describe the activity of the block database of the server.
+func (r FutureGetDatabaseStatsResult) Receive() (*btcjson.GetDatabaseStatsResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result btcjson.GetDatabaseStatsResult
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// GetDatabaseStatsAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See GetDatabaseStats for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetDatabaseStatsAsync() FutureGetDatabaseStatsResult {
+	cmd := btcjson.NewGetDatabaseStatsCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetDatabaseStats returns counters which describe the activity of the block
+// database of the server since it started.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetDatabaseStats() (*btcjson.GetDatabaseStatsResult, error) {
+	return c.GetDatabaseStatsAsync().Receive()
+}
+
+// FutureDumpTxOutSetResult is a future promise to deliver the result of a
+// DumpTxOutSetAsync RPC invocation (or an applicable error).
+type FutureDumpTxOutSetResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// description of the utxo set snapshot written by the server.
+func (r FutureDumpTxOutSetResult) Receive() (*btcjson.DumpTxOutSetResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result btcjson.DumpTxOutSetResult
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// DumpTxOutSetAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See DumpTxOutSet for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) DumpTxOutSetAsync(path string) FutureDumpTxOutSetResult {
+	cmd := btcjson.NewDumpTxOutSetCmd(path)
+	return c.sendCmd(cmd)
+}
+
+// DumpTxOutSet makes the server write a snapshot of its unspent transaction
+// output set as of its best block to the file at the passed path, which is
+// relative to the data directory of the server unless absolute.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) DumpTxOutSet(path string) (*btcjson.DumpTxOutSetResult, error) {
+	return c.DumpTxOutSetAsync(path).Receive()
+}
+
+// FutureGetRPCRolesResult is a future promise to deliver the result of a
+// GetRPCRolesAsync RPC invocation (or an applicable error).
+type FutureGetRPCRolesResult chan *response
+
+// Receive waits for the response promised by the future and returns the roles
+// of the RPC server.
+func (r FutureGetRPCRolesResult) Receive() ([]btcjson.RPCRoleResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []btcjson.RPCRoleResult
+	err = json.Unmarshal(res, &roles)
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetRPCRolesAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See GetRPCRoles for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetRPCRolesAsync() FutureGetRPCRolesResult {
+	cmd := btcjson.NewGetRPCRolesCmd()
+	return c.sendCmd(cmd)
+}
+
+// GetRPCRoles returns the roles of the RPC server along with the methods they
+// may call and the users assigned to them.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) GetRPCRoles() ([]btcjson.RPCRoleResult, error) {
+	return c.GetRPCRolesAsync().Receive()
+}
+
+// FutureSetRPCRoleResult is a future promise to deliver the result of a
+// SetRPCRoleAsync RPC invocation (or an applicable error).
+type FutureSetRPCRoleResult chan *response
+
+// Receive waits for and returns the error response promised by the future.
+func (r FutureSetRPCRoleResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// SetRPCRoleAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See SetRPCRole for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) SetRPCRoleAsync(role string, methods []string, rateLimit int,
+	persist bool) FutureSetRPCRoleResult {
+
+	cmd := btcjson.NewSetRPCRoleCmd(role, methods, &rateLimit, &persist)
+	return c.sendCmd(cmd)
+}
+
+// SetRPCRole creates or replaces a role of the RPC server which may call the
+// passed methods up to rateLimit times per minute for each of its users, or
+// without a limit when it is zero.  The role is also written to the role file
+// of the server when persist is true.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) SetRPCRole(role string, methods []string, rateLimit int,
+	persist bool) error {
+
+	return c.SetRPCRoleAsync(role, methods, rateLimit, persist).Receive()
+}
+
+// FutureReloadRPCRolesResult is a future promise to deliver the result of a
+// ReloadRPCRolesAsync RPC invocation (or an applicable error).
+type FutureReloadRPCRolesResult chan *response
+
+// Receive waits for and returns the error response promised by the future.
+func (r FutureReloadRPCRolesResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// ReloadRPCRolesAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See ReloadRPCRoles for the blocking version and more details.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ReloadRPCRolesAsync() FutureReloadRPCRolesResult {
+	cmd := btcjson.NewReloadRPCRolesCmd()
+	return c.sendCmd(cmd)
+}
+
+// ReloadRPCRoles makes the server reload the roles and users of its role file.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) ReloadRPCRoles() error {
+	return c.ReloadRPCRolesAsync().Receive()
+}
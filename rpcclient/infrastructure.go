@@ -282,6 +282,17 @@ func (c *Client) trackRegisteredNtfns(cmd interface{}) {
 
 		}
 
+	case *btcjson.NotifyReplacementsCmd:
+		c.ntfnState.notifyReplacements = true
+		c.ntfnState.notifyWatchedOnly = bcmd.WatchedOnly != nil &&
+			*bcmd.WatchedOnly
+
+	case *btcjson.NotifyPartitionAlertsCmd:
+		c.ntfnState.notifyPartitions = true
+
+	case *btcjson.NotifyRawBlocksCmd:
+		c.ntfnState.notifyRawBlocks = bcmd
+
 	case *btcjson.NotifySpentCmd:
 		for _, op := range bcmd.OutPoints {
 			c.ntfnState.notifySpent[op] = struct{}{}
@@ -556,6 +567,34 @@ func (c *Client) reregisterNtfns() error {
 		}
 	}
 
+	// Reregister notifyreplacements if needed.
+	if stateCopy.notifyReplacements {
+		log.Debugf("Reregistering [notifyreplacements] (watchedonly=%v)",
+			stateCopy.notifyWatchedOnly)
+		err := c.NotifyReplacements(stateCopy.notifyWatchedOnly)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Reregister notifypartitionalerts if needed.
+	if stateCopy.notifyPartitions {
+		log.Debugf("Reregistering [notifypartitionalerts]")
+		err := c.NotifyPartitionAlerts()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Reregister notifyrawblocks with the previous parameters if needed.
+	if cmd := stateCopy.notifyRawBlocks; cmd != nil {
+		log.Debugf("Reregistering [notifyrawblocks]")
+		err := FutureNotifyRawBlocksResult(c.sendCmd(cmd)).Receive()
+		if err != nil {
+			return err
+		}
+	}
+
 	// Reregister the combination of all previously registered notifyspent
 	// outpoints in one command if needed.
 	nslen := len(stateCopy.notifySpent)
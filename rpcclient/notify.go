@@ -7,10 +7,12 @@ package rpcclient
 
 import (
 	"bytes"
+	"compress/flate"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"time"
 
 	"github.com/btcsuite/btcd/btcjson"
@@ -35,6 +37,10 @@ type notificationState struct {
 	notifyBlocks       bool
 	notifyNewTx        bool
 	notifyNewTxVerbose bool
+	notifyReplacements bool
+	notifyWatchedOnly  bool
+	notifyPartitions   bool
+	notifyRawBlocks    *btcjson.NotifyRawBlocksCmd
 	notifyReceived     map[string]struct{}
 	notifySpent        map[btcjson.OutPoint]struct{}
 }
@@ -45,6 +51,10 @@ func (s *notificationState) Copy() *notificationState {
 	stateCopy.notifyBlocks = s.notifyBlocks
 	stateCopy.notifyNewTx = s.notifyNewTx
 	stateCopy.notifyNewTxVerbose = s.notifyNewTxVerbose
+	stateCopy.notifyReplacements = s.notifyReplacements
+	stateCopy.notifyWatchedOnly = s.notifyWatchedOnly
+	stateCopy.notifyPartitions = s.notifyPartitions
+	stateCopy.notifyRawBlocks = s.notifyRawBlocks
 	stateCopy.notifyReceived = make(map[string]struct{})
 	for addr := range s.notifyReceived {
 		stateCopy.notifyReceived[addr] = struct{}{}
@@ -179,6 +189,26 @@ type NotificationHandlers struct {
 	// made to register for the notification and the function is non-nil.
 	OnTxAcceptedVerbose func(txDetails *btcjson.TxRawResult)
 
+	// OnTxReplaced is invoked when transactions in the memory pool are
+	// replaced.  It will only be invoked if a preceding call to
+	// NotifyReplacements has been made to register for the notification
+	// and the function is non-nil.
+	OnTxReplaced func(replacement *btcjson.TxReplacement)
+
+	// OnPartitionAlert is invoked when the server detects a condition
+	// which suggests it is partitioned from the network or eclipsed by its
+	// peers, and again once the condition no longer holds.  It will only
+	// be invoked if a preceding call to NotifyPartitionAlerts has been made
+	// to register for the notification and the function is non-nil.
+	OnPartitionAlert func(alert *btcjson.PartitionAlert)
+
+	// OnRawBlockConnected is invoked when a block is connected to the main
+	// chain with the full deserialized block.  It will only be invoked if a
+	// preceding call to NotifyRawBlocks has been made to register for the
+	// notification and the function is non-nil.
+	OnRawBlockConnected func(hash *chainhash.Hash, height int32,
+		block *wire.MsgBlock)
+
 	// OnBtcdConnected is invoked when a wallet connects or disconnects from
 	// btcd.
 	//
@@ -409,6 +439,58 @@ func (c *Client) handleNotification(ntfn *rawNotification) {
 
 		c.ntfnHandlers.OnTxAcceptedVerbose(rawTx)
 
+	// OnTxReplaced
+	case btcjson.TxReplacedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnTxReplaced == nil {
+			return
+		}
+
+		replacement, err := parseTxReplacedNtfnParams(ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid tx replaced "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnTxReplaced(replacement)
+
+	// OnPartitionAlert
+	case btcjson.PartitionAlertNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnPartitionAlert == nil {
+			return
+		}
+
+		alert, err := parsePartitionAlertNtfnParams(ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid partition alert "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnPartitionAlert(alert)
+
+	// OnRawBlockConnected
+	case btcjson.RawBlockConnectedNtfnMethod:
+		// Ignore the notification if the client is not interested in
+		// it.
+		if c.ntfnHandlers.OnRawBlockConnected == nil {
+			return
+		}
+
+		hash, height, block, err := parseRawBlockConnectedNtfnParams(
+			ntfn.Params)
+		if err != nil {
+			log.Warnf("Received invalid raw block connected "+
+				"notification: %v", err)
+			return
+		}
+
+		c.ntfnHandlers.OnRawBlockConnected(hash, height, block)
+
 	// OnBtcdConnected
 	case btcjson.BtcdConnectedNtfnMethod:
 		// Ignore the notification if the client is not interested in
@@ -775,6 +857,106 @@ func parseTxAcceptedVerboseNtfnParams(params []json.RawMessage) (*btcjson.TxRawR
 	return &rawTx, nil
 }
 
+// parseTxReplacedNtfnParams parses out the replacement of mempool transactions
+// from the parameters of a txreplaced notification.
+func parseTxReplacedNtfnParams(params []json.RawMessage) (*btcjson.TxReplacement,
+	error) {
+
+	if len(params) != 1 {
+		return nil, wrongNumParams(len(params))
+	}
+
+	// Unmarshal first parameter as a tx replacement object.
+	var replacement btcjson.TxReplacement
+	err := json.Unmarshal(params[0], &replacement)
+	if err != nil {
+		return nil, err
+	}
+
+	return &replacement, nil
+}
+
+// parsePartitionAlertNtfnParams parses out the alert from the parameters of a
+// partitionalert notification.
+func parsePartitionAlertNtfnParams(params []json.RawMessage) (*btcjson.PartitionAlert,
+	error) {
+
+	if len(params) != 1 {
+		return nil, wrongNumParams(len(params))
+	}
+
+	// Unmarshal first parameter as a partition alert object.
+	var alert btcjson.PartitionAlert
+	err := json.Unmarshal(params[0], &alert)
+	if err != nil {
+		return nil, err
+	}
+
+	return &alert, nil
+}
+
+// parseRawBlockConnectedNtfnParams parses out the hash, height and block from
+// the parameters of a rawblockconnected notification.
+func parseRawBlockConnectedNtfnParams(params []json.RawMessage) (*chainhash.Hash,
+	int32, *wire.MsgBlock, error) {
+
+	if len(params) != 4 {
+		return nil, 0, nil, wrongNumParams(len(params))
+	}
+
+	// Unmarshal first parameter as a string.
+	var blockHashStr string
+	if err := json.Unmarshal(params[0], &blockHashStr); err != nil {
+		return nil, 0, nil, err
+	}
+
+	// Unmarshal second parameter as an integer.
+	var blockHeight int32
+	if err := json.Unmarshal(params[1], &blockHeight); err != nil {
+		return nil, 0, nil, err
+	}
+
+	// Unmarshal third parameter as a string.
+	var compression string
+	if err := json.Unmarshal(params[2], &compression); err != nil {
+		return nil, 0, nil, err
+	}
+
+	// Unmarshal fourth parameter as a string.
+	var blockHex string
+	if err := json.Unmarshal(params[3], &blockHex); err != nil {
+		return nil, 0, nil, err
+	}
+
+	hash, err := chainhash.NewHashFromStr(blockHashStr)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	serialized, err := hex.DecodeString(blockHex)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	switch compression {
+	case btcjson.RawBlockCompressionNone:
+	case btcjson.RawBlockCompressionDeflate:
+		r := flate.NewReader(bytes.NewReader(serialized))
+		serialized, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+	default:
+		return nil, 0, nil, fmt.Errorf("unsupported compression %q",
+			compression)
+	}
+
+	var block wire.MsgBlock
+	if err := block.Deserialize(bytes.NewReader(serialized)); err != nil {
+		return nil, 0, nil, err
+	}
+
+	return hash, blockHeight, &block, nil
+}
+
 // parseBtcdConnectedNtfnParams parses out the connection status of btcd
 // and btcwallet from the parameters of a btcdconnected notification.
 func parseBtcdConnectedNtfnParams(params []json.RawMessage) (bool, error) {
@@ -1037,6 +1219,158 @@ func (c *Client) NotifyNewTransactions(verbose bool) error {
 	return c.NotifyNewTransactionsAsync(verbose).Receive()
 }
 
+// FutureNotifyReplacementsResult is a future promise to deliver the result of
+// a NotifyReplacementsAsync RPC invocation (or an applicable error).
+type FutureNotifyReplacementsResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the registration was not successful.
+func (r FutureNotifyReplacementsResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// NotifyReplacementsAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See NotifyReplacements for the blocking version and more details.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+func (c *Client) NotifyReplacementsAsync(watchedOnly bool) FutureNotifyReplacementsResult {
+	// Not supported in HTTP POST mode.
+	if c.config.HTTPPostMode {
+		return newFutureError(ErrWebsocketsRequired)
+	}
+
+	// Ignore the notification if the client is not interested in
+	// notifications.
+	if c.ntfnHandlers == nil {
+		return newNilFutureResult()
+	}
+
+	cmd := btcjson.NewNotifyReplacementsCmd(&watchedOnly)
+	return c.sendCmd(cmd)
+}
+
+// NotifyReplacements registers the client to receive notifications every time
+// transactions in the memory pool are replaced.  When watchedOnly is true, only
+// the replacements which pay to or spend from the addresses and outpoints
+// watched by the client are notified.  The notifications are delivered to the
+// notification handlers associated with the client.  Calling this function has
+// no effect if there are no notification handlers and will result in an error
+// if the client is configured to run in HTTP POST mode.
+//
+// The notifications delivered as a result of this call will be via
+// OnTxReplaced.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+func (c *Client) NotifyReplacements(watchedOnly bool) error {
+	return c.NotifyReplacementsAsync(watchedOnly).Receive()
+}
+
+// FutureNotifyPartitionAlertsResult is a future promise to deliver the result
+// of a NotifyPartitionAlertsAsync RPC invocation (or an applicable error).
+type FutureNotifyPartitionAlertsResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the registration was not successful.
+func (r FutureNotifyPartitionAlertsResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// NotifyPartitionAlertsAsync returns an instance of a type that can be used to
+// get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See NotifyPartitionAlerts for the blocking version and more details.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+func (c *Client) NotifyPartitionAlertsAsync() FutureNotifyPartitionAlertsResult {
+	// Not supported in HTTP POST mode.
+	if c.config.HTTPPostMode {
+		return newFutureError(ErrWebsocketsRequired)
+	}
+
+	// Ignore the notification if the client is not interested in
+	// notifications.
+	if c.ntfnHandlers == nil {
+		return newNilFutureResult()
+	}
+
+	cmd := btcjson.NewNotifyPartitionAlertsCmd()
+	return c.sendCmd(cmd)
+}
+
+// NotifyPartitionAlerts registers the client to receive notifications when the
+// server detects a condition which suggests it is partitioned from the network
+// or eclipsed by its peers, and when such a condition is resolved.  The
+// notifications are delivered to the notification handlers associated with the
+// client.  Calling this function has no effect if there are no notification
+// handlers and will result in an error if the client is configured to run in
+// HTTP POST mode.
+//
+// The notifications delivered as a result of this call will be via
+// OnPartitionAlert.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+func (c *Client) NotifyPartitionAlerts() error {
+	return c.NotifyPartitionAlertsAsync().Receive()
+}
+
+// FutureNotifyRawBlocksResult is a future promise to deliver the result of a
+// NotifyRawBlocksAsync RPC invocation (or an applicable error).
+type FutureNotifyRawBlocksResult chan *response
+
+// Receive waits for the response promised by the future and returns an error
+// if the registration was not successful.
+func (r FutureNotifyRawBlocksResult) Receive() error {
+	_, err := receiveFuture(r)
+	return err
+}
+
+// NotifyRawBlocksAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See NotifyRawBlocks for the blocking version and more details.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+func (c *Client) NotifyRawBlocksAsync(compression string, maxQueue int) FutureNotifyRawBlocksResult {
+	// Not supported in HTTP POST mode.
+	if c.config.HTTPPostMode {
+		return newFutureError(ErrWebsocketsRequired)
+	}
+
+	// Ignore the notification if the client is not interested in
+	// notifications.
+	if c.ntfnHandlers == nil {
+		return newNilFutureResult()
+	}
+
+	cmd := btcjson.NewNotifyRawBlocksCmd(&compression, &maxQueue)
+	return c.sendCmd(cmd)
+}
+
+// NotifyRawBlocks registers the client to receive the full serialized blocks
+// connected to the main chain, compressed with the passed scheme, which is
+// either btcjson.RawBlockCompressionNone or btcjson.RawBlockCompressionDeflate.
+// The server disconnects the client when more than maxQueue blocks are waiting
+// to be sent to it, so the client must keep up with the chain.  The
+// notifications are delivered to the notification handlers associated with
+// the client.  Calling this function has no effect if there are no
+// notification handlers and will result in an error if the client is
+// configured to run in HTTP POST mode.
+//
+// The notifications delivered as a result of this call will be via
+// OnRawBlockConnected.
+//
+// NOTE: This is a btcd extension and requires a websocket connection.
+func (c *Client) NotifyRawBlocks(compression string, maxQueue int) error {
+	return c.NotifyRawBlocksAsync(compression, maxQueue).Receive()
+}
+
 // FutureNotifyReceivedResult is a future promise to deliver the result of a
 // NotifyReceivedAsync RPC invocation (or an applicable error).
 //
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -195,7 +196,7 @@ func (r FutureDecodeRawTransactionResult) Receive() (*btcjson.TxRawResult, error
 // See DecodeRawTransaction for the blocking version and more details.
 func (c *Client) DecodeRawTransactionAsync(serializedTx []byte) FutureDecodeRawTransactionResult {
 	txHex := hex.EncodeToString(serializedTx)
-	cmd := btcjson.NewDecodeRawTransactionCmd(txHex)
+	cmd := btcjson.NewDecodeRawTransactionCmd(txHex, nil)
 	return c.sendCmd(cmd)
 }
 
@@ -205,6 +206,51 @@ func (c *Client) DecodeRawTransaction(serializedTx []byte) (*btcjson.TxRawResult
 	return c.DecodeRawTransactionAsync(serializedTx).Receive()
 }
 
+// FutureDecodeRawTransactionPrevOutsResult is a future promise to deliver the
+// result of a DecodeRawTransactionPrevOutsAsync RPC invocation (or an
+// applicable error).
+type FutureDecodeRawTransactionPrevOutsResult chan *response
+
+// Receive waits for the response promised by the future and returns information
+// about a transaction given its serialized bytes along with the outputs
+// referenced by its inputs.
+func (r FutureDecodeRawTransactionPrevOutsResult) Receive() (*btcjson.TxRawDecodeResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a decoderawtransaction result object.
+	var decodeResult btcjson.TxRawDecodeResult
+	err = json.Unmarshal(res, &decodeResult)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decodeResult, nil
+}
+
+// DecodeRawTransactionPrevOutsAsync returns an instance of a type that can be
+// used to get the result of the RPC at some future time by invoking the Receive
+// function on the returned instance.
+//
+// See DecodeRawTransactionPrevOuts for the blocking version and more details.
+func (c *Client) DecodeRawTransactionPrevOutsAsync(serializedTx []byte) FutureDecodeRawTransactionPrevOutsResult {
+	txHex := hex.EncodeToString(serializedTx)
+	cmd := btcjson.NewDecodeRawTransactionCmd(txHex, btcjson.Bool(true))
+	return c.sendCmd(cmd)
+}
+
+// DecodeRawTransactionPrevOuts returns information about a transaction given
+// its serialized bytes along with the value and script of the output referenced
+// by each of its inputs, and the fee when all of them could be resolved.  The
+// transaction does not need to be in the chain or the memory pool.
+//
+// NOTE: This is a btcd extension.
+func (c *Client) DecodeRawTransactionPrevOuts(serializedTx []byte) (*btcjson.TxRawDecodeResult, error) {
+	return c.DecodeRawTransactionPrevOutsAsync(serializedTx).Receive()
+}
+
 // FutureCreateRawTransactionResult is a future promise to deliver the result
 // of a CreateRawTransactionAsync RPC invocation (or an applicable error).
 type FutureCreateRawTransactionResult chan *response
@@ -336,6 +382,107 @@ func (c *Client) SendRawTransaction(tx *wire.MsgTx, allowHighFees bool) (*chainh
 	return c.SendRawTransactionAsync(tx, allowHighFees).Receive()
 }
 
+// FutureSubmitPackageResult is a future promise to deliver the result of a
+// SubmitPackageAsync RPC invocation (or an applicable error).
+type FutureSubmitPackageResult chan *response
+
+// Receive waits for the response promised by the future and returns the
+// results of the transactions of the submitted package.
+func (r FutureSubmitPackageResult) Receive() (*btcjson.SubmitPackageResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as a submitpackage result object.
+	var result btcjson.SubmitPackageResult
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// SubmitPackageAsync returns an instance of a type that can be used to get the
+// result of the RPC at some future time by invoking the Receive function on the
+// returned instance.
+//
+// See SubmitPackage for the blocking version and more details.
+func (c *Client) SubmitPackageAsync(txns []*wire.MsgTx) FutureSubmitPackageResult {
+	rawTxs := make([]string, 0, len(txns))
+	for _, tx := range txns {
+		// Serialize the transaction and convert to hex string.
+		buf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
+		if err := tx.Serialize(buf); err != nil {
+			return newFutureError(err)
+		}
+		rawTxs = append(rawTxs, hex.EncodeToString(buf.Bytes()))
+	}
+
+	cmd := btcjson.NewSubmitPackageCmd(rawTxs)
+	return c.sendCmd(cmd)
+}
+
+// SubmitPackage submits a package of a child transaction along with its
+// unconfirmed parents to the server, which accepts all of them or none and
+// then relays them to the network.  The child must be the last transaction and
+// every transaction must come after the ones it spends.
+func (c *Client) SubmitPackage(txns []*wire.MsgTx) (*btcjson.SubmitPackageResult, error) {
+	return c.SubmitPackageAsync(txns).Receive()
+}
+
+// FutureTestMempoolAcceptResult is a future promise to deliver the result of a
+// TestMempoolAcceptAsync RPC invocation (or an applicable error).
+type FutureTestMempoolAcceptResult chan *response
+
+// Receive waits for the response promised by the future and returns whether the
+// checked transaction would be accepted to the memory pool.
+func (r FutureTestMempoolAcceptResult) Receive() (*btcjson.TestMempoolAcceptResult, error) {
+	res, err := receiveFuture(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal result as an array of testmempoolaccept result objects.
+	var results []btcjson.TestMempoolAcceptResult
+	err = json.Unmarshal(res, &results)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != 1 {
+		return nil, fmt.Errorf("expected 1 result, got %d",
+			len(results))
+	}
+
+	return &results[0], nil
+}
+
+// TestMempoolAcceptAsync returns an instance of a type that can be used to get
+// the result of the RPC at some future time by invoking the Receive function on
+// the returned instance.
+//
+// See TestMempoolAccept for the blocking version and more details.
+func (c *Client) TestMempoolAcceptAsync(tx *wire.MsgTx, maxFeeRate *float64) FutureTestMempoolAcceptResult {
+	// Serialize the transaction and convert to hex string.
+	buf := bytes.NewBuffer(make([]byte, 0, tx.SerializeSize()))
+	if err := tx.Serialize(buf); err != nil {
+		return newFutureError(err)
+	}
+
+	cmd := btcjson.NewTestMempoolAcceptCmd(
+		[]string{hex.EncodeToString(buf.Bytes())}, maxFeeRate)
+	return c.sendCmd(cmd)
+}
+
+// TestMempoolAccept returns whether the passed transaction would be accepted to
+// the memory pool of the server without submitting it.  Transactions paying a
+// fee rate above the passed max fee rate in BTC/kB are not allowed, and nil uses
+// the default of the server.
+func (c *Client) TestMempoolAccept(tx *wire.MsgTx, maxFeeRate *float64) (*btcjson.TestMempoolAcceptResult, error) {
+	return c.TestMempoolAcceptAsync(tx, maxFeeRate).Receive()
+}
+
 // FutureSignRawTransactionResult is a future promise to deliver the result
 // of one of the SignRawTransactionAsync family of RPC invocations (or an
 // applicable error).
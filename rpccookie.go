@@ -0,0 +1,63 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// rpcCookieUser is the username of the credentials in the RPC
+	// authentication cookie.  It matches the one of Bitcoin Core, so tools
+	// which read its cookie work with btcd as well.
+	rpcCookieUser = "__cookie__"
+
+	// defaultRPCCookieFilename is the name of the RPC authentication cookie
+	// in the data directory.
+	defaultRPCCookieFilename = ".cookie"
+
+	// rpcCookiePassBytes is the number of random bytes of the password of
+	// the RPC authentication cookie.
+	rpcCookiePassBytes = 32
+)
+
+// writeRPCCookie generates random credentials and writes them to the passed
+// file in the form user:password, which only the current user may read.  The
+// file is replaced atomically, so readers never see a partial cookie.  It
+// returns the credentials of the cookie as a user of the admin role.
+func writeRPCCookie(file string) (rpcUserConfig, error) {
+	randomBytes := make([]byte, rpcCookiePassBytes)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return rpcUserConfig{}, err
+	}
+	user := rpcUserConfig{
+		User: rpcCookieUser,
+		Pass: hex.EncodeToString(randomBytes),
+		Role: rpcRoleAdmin,
+	}
+
+	tmpFile := file + ".tmp"
+	content := []byte(user.User + ":" + user.Pass)
+	if err := ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return rpcUserConfig{}, err
+	}
+	if err := os.Rename(tmpFile, file); err != nil {
+		os.Remove(tmpFile)
+		return rpcUserConfig{}, err
+	}
+	return user, nil
+}
+
+// removeRPCCookie removes the passed RPC authentication cookie, so stale
+// credentials are not left behind once the RPC server stopped.
+func removeRPCCookie(file string) {
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		rpcsLog.Warnf("Unable to remove the RPC authentication cookie "+
+			"%s: %v", file, err)
+	}
+}
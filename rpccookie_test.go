@@ -0,0 +1,73 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestRPCCookie ensures the RPC authentication cookie holds fresh credentials
+// of the admin role which only the current user may read, and that it is
+// removed again.
+func TestRPCCookie(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpccookie")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, defaultRPCCookieFilename)
+
+	first, err := writeRPCCookie(file)
+	if err != nil {
+		t.Fatalf("writeRPCCookie: unexpected error: %v", err)
+	}
+	second, err := writeRPCCookie(file)
+	if err != nil {
+		t.Fatalf("writeRPCCookie: unexpected error: %v", err)
+	}
+	if first.Pass == second.Pass || len(second.Pass) != 2*rpcCookiePassBytes {
+		t.Fatalf("got passwords %q and %q, want distinct passwords "+
+			"of %d bytes", first.Pass, second.Pass, rpcCookiePassBytes)
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unable to read cookie: %v", err)
+	}
+	parts := strings.SplitN(string(content), ":", 2)
+	if len(parts) != 2 || parts[0] != rpcCookieUser || parts[1] != second.Pass {
+		t.Fatalf("got cookie %q, want %s:%s", content, rpcCookieUser,
+			second.Pass)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("unable to stat cookie: %v", err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Fatalf("got cookie permissions %v, want 0600", perm)
+		}
+	}
+
+	roles, err := newRPCRoles([]rpcUserConfig{second}, "")
+	if err != nil {
+		t.Fatalf("newRPCRoles: unexpected error: %v", err)
+	}
+	key := rpcBasicAuthKey(parts[0], parts[1])
+	if err := roles.authorize(key, "stop"); err != nil {
+		t.Fatalf("authorize: unexpected error for cookie: %v", err)
+	}
+
+	removeRPCCookie(file)
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("cookie was not removed: %v", err)
+	}
+	removeRPCCookie(file)
+}
@@ -0,0 +1,473 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+)
+
+// Names of the built-in roles of the credentials specified with the rpcuser
+// and rpclimituser options.  They can't be defined in the role file.
+const (
+	rpcRoleAdmin   = "admin"
+	rpcRoleLimited = "limited"
+)
+
+// Method patterns of roles which stand for a set of methods rather than a
+// single one.
+const (
+	// rpcMethodsAll allows all methods.
+	rpcMethodsAll = "*"
+
+	// rpcMethodsLimited allows the methods of the built-in limited role.
+	rpcMethodsLimited = "@limited"
+)
+
+var (
+	// errRPCUnknownCredentials is returned when credentials are no longer
+	// known, which happens when they are removed while a websocket client
+	// which authenticated with them is still connected.
+	errRPCUnknownCredentials = errors.New("credentials are not known")
+
+	// errRPCMethodForbidden is returned when the role of the credentials
+	// does not allow the requested method.
+	errRPCMethodForbidden = errors.New("role not authorized for this method")
+
+	// errRPCRateLimited is returned when the credentials exceeded the rate
+	// limit of their role.
+	errRPCRateLimited = errors.New("rate limit exceeded")
+)
+
+// rpcRoleConfig is a role as it is defined in the role file.
+type rpcRoleConfig struct {
+	Name      string   `json:"name"`
+	Methods   []string `json:"methods"`
+	RateLimit int      `json:"ratelimit,omitempty"`
+}
+
+// rpcUserConfig is a user as it is defined in the role file.
+type rpcUserConfig struct {
+	User string `json:"user"`
+	Pass string `json:"pass"`
+	Role string `json:"role"`
+}
+
+// rpcRoleFile is the content of the role file.
+type rpcRoleFile struct {
+	Roles []rpcRoleConfig `json:"roles"`
+	Users []rpcUserConfig `json:"users"`
+}
+
+// rpcRole is a set of methods which may be called with the credentials of the
+// users it is assigned to, at most as often as its rate limit allows.
+type rpcRole struct {
+	rpcRoleConfig
+
+	// allowed holds the methods the role allows.  It is nil when the role
+	// allows all methods.
+	allowed map[string]struct{}
+	builtIn bool
+}
+
+// newRPCRole returns the role of the passed definition after ensuring its
+// methods are known.
+func newRPCRole(c rpcRoleConfig) (*rpcRole, error) {
+	if c.RateLimit < 0 {
+		return nil, fmt.Errorf("role %s has a negative rate limit",
+			c.Name)
+	}
+	role := &rpcRole{
+		rpcRoleConfig: c,
+		allowed:       make(map[string]struct{}, len(c.Methods)),
+	}
+	for _, method := range c.Methods {
+		switch method {
+		case rpcMethodsAll:
+			role.allowed = nil
+			return role, nil
+
+		case rpcMethodsLimited:
+			for limited := range rpcLimited {
+				role.allowed[limited] = struct{}{}
+			}
+
+		default:
+			if _, err := btcjson.MethodUsageFlags(method); err != nil {
+				return nil, fmt.Errorf("role %s allows unknown "+
+					"method %s", c.Name, method)
+			}
+			role.allowed[method] = struct{}{}
+		}
+	}
+	return role, nil
+}
+
+// allows returns whether the role allows the passed method.
+func (r *rpcRole) allows(method string) bool {
+	if r.allowed == nil {
+		return true
+	}
+	_, ok := r.allowed[method]
+	return ok
+}
+
+// rpcRateLimiter is a token bucket which allows bursts of up to a minute worth
+// of requests.
+type rpcRateLimiter struct {
+	mtx    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// allow returns whether a request is allowed at the passed time under the
+// passed limit of requests per minute and takes a token if it is.
+func (l *rpcRateLimiter) allow(now time.Time, limit int) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.last.IsZero() {
+		l.tokens = float64(limit)
+	} else {
+		elapsed := now.Sub(l.last).Minutes()
+		l.tokens += elapsed * float64(limit)
+		if l.tokens > float64(limit) {
+			l.tokens = float64(limit)
+		}
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// rpcUser is a set of credentials along with the role assigned to them.
+type rpcUser struct {
+	name    string
+	role    *rpcRole
+	limiter *rpcRateLimiter
+}
+
+// rpcAuthKey returns the key which identifies the credentials of the passed
+// HTTP Authorization header.
+func rpcAuthKey(authhdr string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(authhdr))
+}
+
+// rpcBasicAuthKey returns the key which identifies the passed username and
+// password.
+func rpcBasicAuthKey(user, pass string) [sha256.Size]byte {
+	login := user + ":" + pass
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
+	return rpcAuthKey(auth)
+}
+
+// rpcBuiltInUsers returns the users of the credentials specified with the
+// rpcuser and rpclimituser options of the passed config.
+func rpcBuiltInUsers(c *config) []rpcUserConfig {
+	var users []rpcUserConfig
+	if c.RPCUser != "" && c.RPCPass != "" {
+		users = append(users, rpcUserConfig{
+			User: c.RPCUser,
+			Pass: c.RPCPass,
+			Role: rpcRoleAdmin,
+		})
+	}
+	if c.RPCLimitUser != "" && c.RPCLimitPass != "" {
+		users = append(users, rpcUserConfig{
+			User: c.RPCLimitUser,
+			Pass: c.RPCLimitPass,
+			Role: rpcRoleLimited,
+		})
+	}
+	return users
+}
+
+// rpcRoles maps the credentials of RPC clients to the roles which determine the
+// methods they may call and how often.  Besides the built-in admin and limited
+// roles of the rpcuser and rpclimituser credentials, roles and users may be
+// defined in a role file, which can be reloaded at runtime.
+type rpcRoles struct {
+	file     string
+	builtIns []rpcUserConfig
+
+	mtx   sync.RWMutex
+	roles map[string]*rpcRole
+	users map[[sha256.Size]byte]*rpcUser
+
+	// now returns the current time and is exposed to allow the tests to
+	// replace it.
+	now func() time.Time
+}
+
+// newRPCRoles returns the roles of the passed built-in users along with the
+// roles and users defined in the passed role file, if any.
+func newRPCRoles(builtIns []rpcUserConfig, file string) (*rpcRoles, error) {
+	r := &rpcRoles{
+		file:     file,
+		builtIns: builtIns,
+		now:      time.Now,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// readRPCRoleFile reads the passed role file.  A missing file defines no roles
+// or users.
+func readRPCRoleFile(file string) (*rpcRoleFile, error) {
+	var f rpcRoleFile
+	if file == "" {
+		return &f, nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return &f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("malformed role file %s: %v", file, err)
+	}
+	return &f, nil
+}
+
+// writeRPCRoleFile replaces the passed role file with the passed content.
+func writeRPCRoleFile(file string, f *rpcRoleFile) error {
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile := file + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+// load replaces the roles and users with the built-in ones and the ones of the
+// role file.  The rate limits of users whose credentials did not change carry
+// over.  Nothing changes when the role file is invalid.
+//
+// This function is safe for concurrent access.
+func (r *rpcRoles) load() error {
+	f, err := readRPCRoleFile(r.file)
+	if err != nil {
+		return err
+	}
+
+	roles := map[string]*rpcRole{
+		rpcRoleAdmin: {
+			rpcRoleConfig: rpcRoleConfig{
+				Name:    rpcRoleAdmin,
+				Methods: []string{rpcMethodsAll},
+			},
+			builtIn: true,
+		},
+	}
+	limited, _ := newRPCRole(rpcRoleConfig{
+		Name:    rpcRoleLimited,
+		Methods: []string{rpcMethodsLimited},
+	})
+	limited.builtIn = true
+	roles[rpcRoleLimited] = limited
+	for _, c := range f.Roles {
+		if _, ok := roles[c.Name]; ok || c.Name == "" {
+			return fmt.Errorf("role file %s redefines role %q",
+				r.file, c.Name)
+		}
+		role, err := newRPCRole(c)
+		if err != nil {
+			return err
+		}
+		roles[c.Name] = role
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	users := make(map[[sha256.Size]byte]*rpcUser)
+	names := make(map[string]struct{})
+	configs := make([]rpcUserConfig, 0, len(r.builtIns)+len(f.Users))
+	configs = append(configs, r.builtIns...)
+	for _, c := range append(configs, f.Users...) {
+		role, ok := roles[c.Role]
+		if !ok {
+			return fmt.Errorf("user %s has unknown role %q", c.User,
+				c.Role)
+		}
+		if c.User == "" || c.Pass == "" {
+			return fmt.Errorf("user %q of role %s needs a username "+
+				"and a password", c.User, c.Role)
+		}
+		if _, ok := names[c.User]; ok {
+			return fmt.Errorf("user %s is defined more than once",
+				c.User)
+		}
+		names[c.User] = struct{}{}
+
+		key := rpcBasicAuthKey(c.User, c.Pass)
+		user := &rpcUser{
+			name:    c.User,
+			role:    role,
+			limiter: &rpcRateLimiter{},
+		}
+		if old, ok := r.users[key]; ok {
+			user.limiter = old.limiter
+		}
+		users[key] = user
+	}
+	r.roles = roles
+	r.users = users
+	return nil
+}
+
+// authenticate returns whether the passed key identifies known credentials.
+//
+// This function is safe for concurrent access.
+func (r *rpcRoles) authenticate(key [sha256.Size]byte) bool {
+	r.mtx.RLock()
+	_, ok := r.users[key]
+	r.mtx.RUnlock()
+	return ok
+}
+
+// authorize returns an error when the credentials identified by the passed key
+// may not call the passed method, either because their role does not allow it
+// or because they exceeded its rate limit.  Every authorized call counts
+// towards the rate limit.
+//
+// This function is safe for concurrent access.
+func (r *rpcRoles) authorize(key [sha256.Size]byte, method string) error {
+	r.mtx.RLock()
+	user, ok := r.users[key]
+	var role *rpcRole
+	if ok {
+		role = user.role
+	}
+	r.mtx.RUnlock()
+	if !ok {
+		return errRPCUnknownCredentials
+	}
+	if !role.allows(method) {
+		return errRPCMethodForbidden
+	}
+	if role.RateLimit > 0 && !user.limiter.allow(r.now(), role.RateLimit) {
+		rpcsLog.Debugf("RPC user %s exceeded the rate limit of role %s",
+			user.name, role.Name)
+		return errRPCRateLimited
+	}
+	return nil
+}
+
+// setRole adds or replaces the role with the passed definition.  When persist
+// is set, the role is also written to the role file, so it is kept across
+// restarts.  Built-in roles can't be changed.
+//
+// This function is safe for concurrent access.
+func (r *rpcRoles) setRole(c rpcRoleConfig, persist bool) error {
+	if c.Name == "" {
+		return errors.New("role name must not be empty")
+	}
+	role, err := newRPCRole(c)
+	if err != nil {
+		return err
+	}
+	r.mtx.RLock()
+	old, ok := r.roles[c.Name]
+	r.mtx.RUnlock()
+	if ok && old.builtIn {
+		return fmt.Errorf("built-in role %s can't be changed", c.Name)
+	}
+
+	if persist {
+		f, err := readRPCRoleFile(r.file)
+		if err != nil {
+			return err
+		}
+		replaced := false
+		for i := range f.Roles {
+			if f.Roles[i].Name == c.Name {
+				f.Roles[i] = c
+				replaced = true
+			}
+		}
+		if !replaced {
+			f.Roles = append(f.Roles, c)
+		}
+		if err := writeRPCRoleFile(r.file, f); err != nil {
+			return err
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.roles[c.Name] = role
+	for _, user := range r.users {
+		if user.role.Name == c.Name {
+			user.role = role
+		}
+	}
+	return nil
+}
+
+// rolesResult returns the roles along with the names of their users sorted by
+// name.
+//
+// This function is safe for concurrent access.
+func (r *rpcRoles) rolesResult() []btcjson.RPCRoleResult {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	users := make(map[string][]string, len(r.roles))
+	for _, user := range r.users {
+		users[user.role.Name] = append(users[user.role.Name], user.name)
+	}
+	results := make([]btcjson.RPCRoleResult, 0, len(r.roles))
+	for _, role := range r.roles {
+		names := users[role.Name]
+		if names == nil {
+			names = []string{}
+		}
+		sort.Strings(names)
+		results = append(results, btcjson.RPCRoleResult{
+			Name:      role.Name,
+			Methods:   role.Methods,
+			RateLimit: role.RateLimit,
+			BuiltIn:   role.builtIn,
+			Users:     names,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// rpcRoleError returns the RPC error of a request which the passed error of
+// authorize rejected.
+func rpcRoleError(err error) *btcjson.RPCError {
+	code := btcjson.ErrRPCInvalidParams.Code
+	if err == errRPCRateLimited {
+		code = btcjson.ErrRPCMisc
+	}
+	return &btcjson.RPCError{
+		Code:    code,
+		Message: err.Error(),
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testRPCRoleFile is a role file which defines a monitoring role limited to a
+// few methods and a rate limit along with a user of it.
+const testRPCRoleFile = `{
+  "roles": [
+    {"name": "monitor", "methods": ["getbestblock", "getblockcount"], "ratelimit": 2}
+  ],
+  "users": [
+    {"user": "grafana", "pass": "secret", "role": "monitor"}
+  ]
+}`
+
+// testRPCBuiltIns are the users of the rpcuser and rpclimituser options used in
+// the tests.
+var testRPCBuiltIns = []rpcUserConfig{
+	{User: "admin", Pass: "pass", Role: rpcRoleAdmin},
+	{User: "limited", Pass: "pass", Role: rpcRoleLimited},
+}
+
+// newTestRPCRoles returns the roles of the built-in test users and the passed
+// role file content, which is written to a temporary directory that the
+// returned function removes.
+func newTestRPCRoles(t *testing.T, content string) (*rpcRoles, func()) {
+	dir, err := ioutil.TempDir("", "rpcroles")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	file := filepath.Join(dir, "rpcroles.json")
+	err = ioutil.WriteFile(file, []byte(content), 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("unable to write role file: %v", err)
+	}
+	r, err := newRPCRoles(testRPCBuiltIns, file)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("newRPCRoles: unexpected error: %v", err)
+	}
+	return r, func() { os.RemoveAll(dir) }
+}
+
+// TestRPCRoleFile ensures invalid role files are rejected and that a missing
+// role file only leaves the built-in roles.
+func TestRPCRoleFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"malformed", `{"roles": [`},
+		{"unknown method",
+			`{"roles": [{"name": "r", "methods": ["nosuchmethod"]}]}`},
+		{"negative rate limit",
+			`{"roles": [{"name": "r", "methods": ["*"], "ratelimit": -1}]}`},
+		{"built-in role",
+			`{"roles": [{"name": "admin", "methods": ["getinfo"]}]}`},
+		{"unknown role",
+			`{"users": [{"user": "u", "pass": "p", "role": "nosuchrole"}]}`},
+		{"missing password",
+			`{"users": [{"user": "u", "role": "limited"}]}`},
+		{"duplicate user",
+			`{"users": [{"user": "admin", "pass": "p", "role": "limited"}]}`},
+	}
+
+	dir, err := ioutil.TempDir("", "rpcroles")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "rpcroles.json")
+
+	r, err := newRPCRoles(testRPCBuiltIns, file)
+	if err != nil {
+		t.Fatalf("newRPCRoles: unexpected error for missing file: %v",
+			err)
+	}
+	if roles := r.rolesResult(); len(roles) != 2 {
+		t.Fatalf("got %d roles for missing file, want 2", len(roles))
+	}
+
+	for _, test := range tests {
+		err := ioutil.WriteFile(file, []byte(test.content), 0600)
+		if err != nil {
+			t.Fatalf("unable to write role file: %v", err)
+		}
+		if _, err := newRPCRoles(testRPCBuiltIns, file); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+// TestRPCRolesAuthorize ensures requests are only authorized for the methods of
+// the role of the credentials and within its rate limit.
+func TestRPCRolesAuthorize(t *testing.T) {
+	r, cleanup := newTestRPCRoles(t, testRPCRoleFile)
+	defer cleanup()
+	now := time.Unix(1600000000, 0)
+	r.now = func() time.Time { return now }
+
+	admin := rpcBasicAuthKey("admin", "pass")
+	limited := rpcBasicAuthKey("limited", "pass")
+	monitor := rpcBasicAuthKey("grafana", "secret")
+	tests := []struct {
+		name    string
+		key     [32]byte
+		method  string
+		wantErr error
+	}{
+		{"admin", admin, "stop", nil},
+		{"limited allowed", limited, "getbestblock", nil},
+		{"limited forbidden", limited, "stop", errRPCMethodForbidden},
+		{"monitor allowed", monitor, "getblockcount", nil},
+		{"monitor forbidden", monitor, "getinfo", errRPCMethodForbidden},
+		{"monitor second request", monitor, "getbestblock", nil},
+		{"monitor rate limited", monitor, "getbestblock",
+			errRPCRateLimited},
+		{"wrong password", rpcBasicAuthKey("grafana", "wrong"),
+			"getbestblock", errRPCUnknownCredentials},
+	}
+	for _, test := range tests {
+		if err := r.authorize(test.key, test.method); err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", test.name, err,
+				test.wantErr)
+		}
+	}
+
+	// A rate limit of two requests per minute refills a token every 30
+	// seconds.
+	now = now.Add(30 * time.Second)
+	if err := r.authorize(monitor, "getbestblock"); err != nil {
+		t.Errorf("authorize after refill: unexpected error: %v", err)
+	}
+	if err := r.authorize(monitor, "getbestblock"); err != errRPCRateLimited {
+		t.Errorf("authorize after refill: got error %v, want %v", err,
+			errRPCRateLimited)
+	}
+}
+
+// TestRPCRolesSetRole ensures roles changed at runtime apply to their users
+// right away, are persisted on request, and that built-in roles can't be
+// changed.
+func TestRPCRolesSetRole(t *testing.T) {
+	r, cleanup := newTestRPCRoles(t, testRPCRoleFile)
+	defer cleanup()
+	monitor := rpcBasicAuthKey("grafana", "secret")
+
+	err := r.setRole(rpcRoleConfig{
+		Name:    rpcRoleAdmin,
+		Methods: []string{"getinfo"},
+	}, false)
+	if err == nil {
+		t.Fatalf("setRole: expected error for built-in role")
+	}
+	err = r.setRole(rpcRoleConfig{
+		Name:    "monitor",
+		Methods: []string{"nosuchmethod"},
+	}, false)
+	if err == nil {
+		t.Fatalf("setRole: expected error for unknown method")
+	}
+
+	err = r.setRole(rpcRoleConfig{
+		Name:    "monitor",
+		Methods: []string{rpcMethodsLimited},
+	}, false)
+	if err != nil {
+		t.Fatalf("setRole: unexpected error: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := r.authorize(monitor, "getinfo"); err != nil {
+			t.Fatalf("authorize: unexpected error: %v", err)
+		}
+	}
+
+	// Roles which are not persisted are lost on reload.
+	if err := r.load(); err != nil {
+		t.Fatalf("load: unexpected error: %v", err)
+	}
+	if err := r.authorize(monitor, "getinfo"); err != errRPCMethodForbidden {
+		t.Fatalf("authorize after reload: got error %v, want %v", err,
+			errRPCMethodForbidden)
+	}
+
+	err = r.setRole(rpcRoleConfig{
+		Name:    "auditor",
+		Methods: []string{"getrpcroles"},
+	}, true)
+	if err != nil {
+		t.Fatalf("setRole: unexpected error: %v", err)
+	}
+	if err := r.load(); err != nil {
+		t.Fatalf("load: unexpected error: %v", err)
+	}
+	roles := r.rolesResult()
+	if len(roles) != 4 || roles[1].Name != "auditor" ||
+		roles[3].Name != "monitor" || roles[3].Users[0] != "grafana" {
+
+		t.Fatalf("got roles %+v after persisting role", roles)
+	}
+}
+
+// TestRPCRolesReload ensures credentials which are removed from the role file
+// are rejected after a reload, while the rate limits of unchanged credentials
+// carry over.
+func TestRPCRolesReload(t *testing.T) {
+	r, cleanup := newTestRPCRoles(t, testRPCRoleFile)
+	defer cleanup()
+	now := time.Unix(1600000000, 0)
+	r.now = func() time.Time { return now }
+	monitor := rpcBasicAuthKey("grafana", "secret")
+
+	for i := 0; i < 2; i++ {
+		if err := r.authorize(monitor, "getbestblock"); err != nil {
+			t.Fatalf("authorize: unexpected error: %v", err)
+		}
+	}
+	if err := r.load(); err != nil {
+		t.Fatalf("load: unexpected error: %v", err)
+	}
+	if err := r.authorize(monitor, "getbestblock"); err != errRPCRateLimited {
+		t.Fatalf("authorize after reload: got error %v, want %v", err,
+			errRPCRateLimited)
+	}
+
+	// An invalid role file leaves the roles unchanged.
+	err := ioutil.WriteFile(r.file, []byte(`{"users": [{}]}`), 0600)
+	if err != nil {
+		t.Fatalf("unable to write role file: %v", err)
+	}
+	if err := r.load(); err == nil {
+		t.Fatalf("load: expected error for invalid role file")
+	}
+	if !r.authenticate(monitor) {
+		t.Fatalf("credentials were removed by invalid role file")
+	}
+
+	err = ioutil.WriteFile(r.file, []byte(`{}`), 0600)
+	if err != nil {
+		t.Fatalf("unable to write role file: %v", err)
+	}
+	if err := r.load(); err != nil {
+		t.Fatalf("load: unexpected error: %v", err)
+	}
+	if r.authenticate(monitor) {
+		t.Fatalf("removed credentials are still accepted")
+	}
+	if err := r.authorize(monitor, "getbestblock"); err != errRPCUnknownCredentials {
+		t.Fatalf("authorize after removal: got error %v, want %v", err,
+			errRPCUnknownCredentials)
+	}
+	if !r.authenticate(rpcBasicAuthKey("admin", "pass")) {
+		t.Fatalf("built-in credentials were removed")
+	}
+}
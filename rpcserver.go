@@ -8,7 +8,6 @@ package main
 import (
 	"bytes"
 	"crypto/sha256"
-	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -21,6 +20,8 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -37,10 +38,12 @@ import (
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/mining/cpuminer"
+	"github.com/btcsuite/btcd/netsync"
 	"github.com/btcsuite/btcd/peer"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
 	"github.com/btcsuite/websocket"
 )
 
@@ -126,53 +129,110 @@ type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{},
 // This is set by init because help references rpcHandlers and thus causes
 // a dependency loop.
 var rpcHandlers map[string]commandHandler
+
+// correlatedCommandHandler describes a callback function used to handle a
+// specific command which also propagates the correlation id supplied by the
+// client.
+type correlatedCommandHandler func(*rpcServer, interface{}, string, <-chan struct{}) (interface{}, error)
+
+// rpcCorrelatedHandlers maps the commands which propagate the correlation id
+// supplied by the client to their handlers.  They take precedence over the
+// handlers in rpcHandlers, which still houses the plain variants.
+var rpcCorrelatedHandlers = map[string]correlatedCommandHandler{
+	"sendrawtransaction": handleSendRawTransactionCorrelated,
+}
 var rpcHandlersBeforeInit = map[string]commandHandler{
-	"addnode":               handleAddNode,
-	"createrawtransaction":  handleCreateRawTransaction,
-	"debuglevel":            handleDebugLevel,
-	"decoderawtransaction":  handleDecodeRawTransaction,
-	"decodescript":          handleDecodeScript,
-	"estimatefee":           handleEstimateFee,
-	"generate":              handleGenerate,
-	"getaddednodeinfo":      handleGetAddedNodeInfo,
-	"getbestblock":          handleGetBestBlock,
-	"getbestblockhash":      handleGetBestBlockHash,
-	"getblock":              handleGetBlock,
-	"getblockchaininfo":     handleGetBlockChainInfo,
-	"getblockcount":         handleGetBlockCount,
-	"getblockhash":          handleGetBlockHash,
-	"getblockheader":        handleGetBlockHeader,
-	"getblocktemplate":      handleGetBlockTemplate,
-	"getcfilter":            handleGetCFilter,
-	"getcfilterheader":      handleGetCFilterHeader,
-	"getconnectioncount":    handleGetConnectionCount,
-	"getcurrentnet":         handleGetCurrentNet,
-	"getdifficulty":         handleGetDifficulty,
-	"getgenerate":           handleGetGenerate,
-	"gethashespersec":       handleGetHashesPerSec,
-	"getheaders":            handleGetHeaders,
-	"getinfo":               handleGetInfo,
-	"getmempoolinfo":        handleGetMempoolInfo,
-	"getmininginfo":         handleGetMiningInfo,
-	"getnettotals":          handleGetNetTotals,
-	"getnetworkhashps":      handleGetNetworkHashPS,
-	"getpeerinfo":           handleGetPeerInfo,
-	"getrawmempool":         handleGetRawMempool,
-	"getrawtransaction":     handleGetRawTransaction,
-	"gettxout":              handleGetTxOut,
-	"help":                  handleHelp,
-	"node":                  handleNode,
-	"ping":                  handlePing,
-	"searchrawtransactions": handleSearchRawTransactions,
-	"sendrawtransaction":    handleSendRawTransaction,
-	"setgenerate":           handleSetGenerate,
-	"stop":                  handleStop,
-	"submitblock":           handleSubmitBlock,
-	"uptime":                handleUptime,
-	"validateaddress":       handleValidateAddress,
-	"verifychain":           handleVerifyChain,
-	"verifymessage":         handleVerifyMessage,
-	"version":               handleVersion,
+	"addcheckpoint":              handleAddCheckpoint,
+	"addnode":                    handleAddNode,
+	"backupdatabase":             handleBackupDatabase,
+	"createrawtransaction":       handleCreateRawTransaction,
+	"debuglevel":                 handleDebugLevel,
+	"dumptxoutset":               handleDumpTxOutSet,
+	"decoderawtransaction":       handleDecodeRawTransaction,
+	"decodescript":               handleDecodeScript,
+	"estimatefee":                handleEstimateFee,
+	"estimatesmartfee":           handleEstimateSmartFee,
+	"generate":                   handleGenerate,
+	"getaddednodeinfo":           handleGetAddedNodeInfo,
+	"getbestblock":               handleGetBestBlock,
+	"getcheckpoints":             handleGetCheckpoints,
+	"getbestblockhash":           handleGetBestBlockHash,
+	"getblock":                   handleGetBlock,
+	"getblockchaininfo":          handleGetBlockChainInfo,
+	"getblockfrompeer":           handleGetBlockFromPeer,
+	"getblockcount":              handleGetBlockCount,
+	"getblockhash":               handleGetBlockHash,
+	"getblockheader":             handleGetBlockHeader,
+	"getblockstats":              handleGetBlockStats,
+	"getblocktemplate":           handleGetBlockTemplate,
+	"getcfilter":                 handleGetCFilter,
+	"getcfilterheader":           handleGetCFilterHeader,
+	"getchaintips":               handleGetChainTips,
+	"getchaintxstats":            handleGetChainTxStats,
+	"getconnectioncount":         handleGetConnectionCount,
+	"getcurrentnet":              handleGetCurrentNet,
+	"getdatabasestats":           handleGetDatabaseStats,
+	"getdeploymentinfo":          handleGetDeploymentInfo,
+	"getdifficulty":              handleGetDifficulty,
+	"getgenerate":                handleGetGenerate,
+	"gethashespersec":            handleGetHashesPerSec,
+	"getheaders":                 handleGetHeaders,
+	"getinfo":                    handleGetInfo,
+	"getmempoolcluster":          handleGetMempoolCluster,
+	"getmempooldiagram":          handleGetMempoolDiagram,
+	"getmempoolinfo":             handleGetMempoolInfo,
+	"getmempoolpackage":          handleGetMempoolPackage,
+	"getmininginfo":              handleGetMiningInfo,
+	"getnettotals":               handleGetNetTotals,
+	"getnetworkhashps":           handleGetNetworkHashPS,
+	"getorphanblockinfo":         handleGetOrphanBlockInfo,
+	"getpeerinfo":                handleGetPeerInfo,
+	"getprioritisedtransactions": handleGetPrioritisedTransactions,
+	"getrawmempool":              handleGetRawMempool,
+	"getrawtransaction":          handleGetRawTransaction,
+	"getrpcroles":                handleGetRPCRoles,
+	"getstandbyinfo":             handleGetStandbyInfo,
+	"getscriptvalidationinfo":    handleGetScriptValidationInfo,
+	"getsyncprogress":            handleGetSyncProgress,
+	"gettimeinfo":                handleGetTimeInfo,
+	"gettxout":                   handleGetTxOut,
+	"gettxoutsetinfo":            handleGetTxOutSetInfo,
+	"gettxspendingprevout":       handleGetTxSpendingPrevOut,
+	"getwitnessupgradeinfo":      handleGetWitnessUpgradeInfo,
+	"getzmqnotifications":        handleGetZMQNotifications,
+	"getxpubaccountbalance":      handleGetXpubAccountBalance,
+	"help":                       handleHelp,
+	"importxpubaccount":          handleImportXpubAccount,
+	"invalidateblock":            handleInvalidateBlock,
+	"listattestations":           handleListAttestations,
+	"listreorgs":                 handleListReorgs,
+	"listtemplatecomparisons":    handleListTemplateComparisons,
+	"listxpubaccounts":           handleListXpubAccounts,
+	"listxpubaccountunspent":     handleListXpubAccountUnspent,
+	"logtrace":                   handleLogTrace,
+	"node":                       handleNode,
+	"ping":                       handlePing,
+	"prioritisetransaction":      handlePrioritiseTransaction,
+	"promotestandby":             handlePromoteStandby,
+	"reconsiderblock":            handleReconsiderBlock,
+	"reloadrpcroles":             handleReloadRPCRoles,
+	"removexpubaccount":          handleRemoveXpubAccount,
+	"scantxoutset":               handleScanTxOutSet,
+	"searchrawtransactions":      handleSearchRawTransactions,
+	"sendrawtransaction":         handleSendRawTransaction,
+	"setgenerate":                handleSetGenerate,
+	"setrpcrole":                 handleSetRPCRole,
+	"setscriptworkers":           handleSetScriptWorkers,
+	"stop":                       handleStop,
+	"submitblock":                handleSubmitBlock,
+	"submitpackage":              handleSubmitPackage,
+	"testmempoolaccept":          handleTestMempoolAccept,
+	"uptime":                     handleUptime,
+	"validateaddress":            handleValidateAddress,
+	"validateblock":              handleValidateBlock,
+	"verifychain":                handleVerifyChain,
+	"verifymessage":              handleVerifyMessage,
+	"version":                    handleVersion,
 }
 
 // list of commands that we recognize, but for which btcd has no support because
@@ -195,7 +255,6 @@ var rpcAskWallet = map[string]struct{}{
 	"getreceivedbyaccount":   {},
 	"getreceivedbyaddress":   {},
 	"gettransaction":         {},
-	"gettxoutsetinfo":        {},
 	"getunconfirmedbalance":  {},
 	"getwalletinfo":          {},
 	"importprivkey":          {},
@@ -226,13 +285,10 @@ var rpcAskWallet = map[string]struct{}{
 // Commands that are currently unimplemented, but should ultimately be.
 var rpcUnimplemented = map[string]struct{}{
 	"estimatepriority": {},
-	"getchaintips":     {},
 	"getmempoolentry":  {},
 	"getnetworkinfo":   {},
 	"getwork":          {},
-	"invalidateblock":  {},
 	"preciousblock":    {},
-	"reconsiderblock":  {},
 }
 
 // Commands that are available to a limited user
@@ -251,34 +307,74 @@ var rpcLimited = map[string]struct{}{
 	"help": {},
 
 	// HTTP/S-only commands
-	"createrawtransaction":  {},
-	"decoderawtransaction":  {},
-	"decodescript":          {},
-	"estimatefee":           {},
-	"getbestblock":          {},
-	"getbestblockhash":      {},
-	"getblock":              {},
-	"getblockcount":         {},
-	"getblockhash":          {},
-	"getblockheader":        {},
-	"getcfilter":            {},
-	"getcfilterheader":      {},
-	"getcurrentnet":         {},
-	"getdifficulty":         {},
-	"getheaders":            {},
-	"getinfo":               {},
-	"getnettotals":          {},
-	"getnetworkhashps":      {},
-	"getrawmempool":         {},
-	"getrawtransaction":     {},
-	"gettxout":              {},
-	"searchrawtransactions": {},
-	"sendrawtransaction":    {},
-	"submitblock":           {},
-	"uptime":                {},
-	"validateaddress":       {},
-	"verifymessage":         {},
-	"version":               {},
+	"createrawtransaction":       {},
+	"decoderawtransaction":       {},
+	"decodescript":               {},
+	"estimatefee":                {},
+	"estimatesmartfee":           {},
+	"getbestblock":               {},
+	"getbestblockhash":           {},
+	"getblock":                   {},
+	"getblockcount":              {},
+	"getblockhash":               {},
+	"getblockheader":             {},
+	"getblockstats":              {},
+	"getcfilter":                 {},
+	"getcfilterheader":           {},
+	"getchaintips":               {},
+	"getchaintxstats":            {},
+	"getcurrentnet":              {},
+	"getdatabasestats":           {},
+	"getdeploymentinfo":          {},
+	"getcheckpoints":             {},
+	"getdifficulty":              {},
+	"getheaders":                 {},
+	"getinfo":                    {},
+	"getmempoolcluster":          {},
+	"getmempooldiagram":          {},
+	"getmempoolpackage":          {},
+	"getnettotals":               {},
+	"getnetworkhashps":           {},
+	"getorphanblockinfo":         {},
+	"getprioritisedtransactions": {},
+	"getrawmempool":              {},
+	"getrawtransaction":          {},
+	"getscriptvalidationinfo":    {},
+	"getsyncprogress":            {},
+	"gettxout":                   {},
+	"gettxspendingprevout":       {},
+	"listattestations":           {},
+	"listreorgs":                 {},
+	"listtemplatecomparisons":    {},
+	"searchrawtransactions":      {},
+	"sendrawtransaction":         {},
+	"submitblock":                {},
+	"submitpackage":              {},
+	"testmempoolaccept":          {},
+	"uptime":                     {},
+	"validateaddress":            {},
+	"verifymessage":              {},
+	"version":                    {},
+}
+
+// Commands that may be serviced while the server is running as a hot standby
+// that has not yet been promoted.
+var rpcStandbyAllowed = map[string]struct{}{
+	"getbestblock":       {},
+	"getbestblockhash":   {},
+	"getblockchaininfo":  {},
+	"getblockcount":      {},
+	"getconnectioncount": {},
+	"getinfo":            {},
+	"getmempoolinfo":     {},
+	"getpeerinfo":        {},
+	"getstandbyinfo":     {},
+	"help":               {},
+	"ping":               {},
+	"promotestandby":     {},
+	"stop":               {},
+	"uptime":             {},
+	"version":            {},
 }
 
 // builderScript is a convenience function which is used for hard-coded scripts
@@ -335,14 +431,35 @@ type gbtWorkState struct {
 	template      *mining.BlockTemplate
 	notifyMap     map[chainhash.Hash]map[int64]chan struct{}
 	timeSource    blockchain.MedianTimeSource
+
+	// tweakedTemplates holds the templates generated for requests which
+	// lower the limits of the template as defined by BIP 0022, keyed by
+	// their limits.  They are discarded whenever a new template is
+	// generated, so they share the long poll ID of the current template.
+	tweakedTemplates map[gbtTemplateLimits]*mining.BlockTemplate
+
+	// pendingTxUpdate is the last time the memory pool was updated when
+	// the update happened too soon after the last template was generated
+	// to notify long poll clients right away.  The mempoolTimer notifies
+	// them once enough time has passed.
+	pendingTxUpdate time.Time
+	mempoolTimer    *time.Timer
+}
+
+// gbtTemplateLimits houses the limits of a block template generated for the
+// getblocktemplate RPC.
+type gbtTemplateLimits struct {
+	weight    int64
+	sigOpCost int64
 }
 
 // newGbtWorkState returns a new instance of a gbtWorkState with all internal
 // fields initialized and ready to use.
 func newGbtWorkState(timeSource blockchain.MedianTimeSource) *gbtWorkState {
 	return &gbtWorkState{
-		notifyMap:  make(map[chainhash.Hash]map[int64]chan struct{}),
-		timeSource: timeSource,
+		notifyMap:        make(map[chainhash.Hash]map[int64]chan struct{}),
+		timeSource:       timeSource,
+		tweakedTemplates: make(map[gbtTemplateLimits]*mining.BlockTemplate),
 	}
 }
 
@@ -359,6 +476,43 @@ func handleAskWallet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (
 	return nil, ErrRPCNoWallet
 }
 
+// handleAddCheckpoint implements the addcheckpoint command.
+func handleAddCheckpoint(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.AddCheckpointCmd)
+	hash, err := chainhash.NewHashFromStr(c.Hash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Hash)
+	}
+
+	persist := c.Persist != nil && *c.Persist
+	if persist && s.cfg.CheckpointFile == "" {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "A checkpoint file must be configured to persist checkpoints (--checkpointfile)",
+		}
+	}
+
+	checkpoint := chaincfg.Checkpoint{
+		Height: c.Height,
+		Hash:   hash,
+	}
+	err = s.cfg.Chain.AddCheckpoint(checkpoint)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	if persist {
+		err := appendCheckpointFile(s.cfg.CheckpointFile, checkpoint)
+		if err != nil {
+			context := "Failed to persist checkpoint"
+			return nil, internalRPCError(err.Error(), context)
+		}
+	}
+	return nil, nil
+}
+
 // handleAddNode handles addnode commands.
 func handleAddNode(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.AddNodeCmd)
@@ -508,6 +662,38 @@ func messageToHex(msg wire.Message) (string, error) {
 	return hex.EncodeToString(buf.Bytes()), nil
 }
 
+// handleBackupDatabase implements the backupdatabase command.
+func handleBackupDatabase(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.BackupDatabaseCmd)
+
+	// Relative paths are relative to the data directory.
+	path := cleanAndExpandPath(c.Path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cfg.DataDir, path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("%s already exists", path),
+		}
+	}
+
+	if err := s.cfg.DB.BackupToPath(path); err != nil {
+		context := "Failed to back up the database"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		context := "Failed to back up the database"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	return &btcjson.BackupDatabaseResult{
+		Path: path,
+		Size: fi.Size(),
+	}, nil
+}
+
 // handleCreateRawTransaction handles createrawtransaction commands.
 func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.CreateRawTransactionCmd)
@@ -634,6 +820,114 @@ func handleDebugLevel(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return "Done.", nil
 }
 
+// handleDumpTxOutSet implements the dumptxoutset command.
+func handleDumpTxOutSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.DumpTxOutSetCmd)
+
+	// Relative paths are relative to the data directory.  The snapshot is
+	// written to a temporary file first so an interrupted dump does not
+	// leave a truncated snapshot behind.
+	path := cleanAndExpandPath(c.Path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cfg.DataDir, path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("%s already exists", path),
+		}
+	}
+	tmpPath := path + ".incomplete"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+
+	snapshot, err := s.cfg.Chain.DumpUtxoSnapshot(f, closeChan)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		context := "Failed to dump the UTXO set"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	return &btcjson.DumpTxOutSetResult{
+		CoinsWritten: snapshot.Utxos,
+		BaseHash:     snapshot.Hash.String(),
+		BaseHeight:   snapshot.Height,
+		Path:         path,
+		TxOutSetHash: snapshot.MuHash.String(),
+	}, nil
+}
+
+// handleLogTrace implements the logtrace command.
+func handleLogTrace(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.LogTraceCmd)
+
+	var target *traceTarget
+	switch c.Action {
+	case "add", "remove":
+		if c.Target == nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "A target is required to " + c.Action,
+			}
+		}
+		var err error
+		target, err = parseTraceTarget(*c.Target, s.cfg.ChainParams)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: err.Error(),
+			}
+		}
+	case "clear", "list":
+	default:
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid action -- must be add, remove, clear, " +
+				"or list",
+		}
+	}
+
+	switch c.Action {
+	case "add":
+		logTraceTargets.Add(target)
+		rpcsLog.Infof("Added log trace target %s", target.key())
+	case "remove":
+		if !logTraceTargets.Remove(target) {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "No log trace target " + target.key(),
+			}
+		}
+		rpcsLog.Infof("Removed log trace target %s", target.key())
+	case "clear":
+		logTraceTargets.Clear()
+		rpcsLog.Infof("Removed all log trace targets")
+	}
+
+	targets := logTraceTargets.Targets()
+	results := make([]btcjson.LogTraceTargetResult, 0, len(targets))
+	for _, target := range targets {
+		results = append(results, btcjson.LogTraceTargetResult{
+			Kind:         target.Kind,
+			Target:       target.Value,
+			Messages:     target.Messages,
+			Transactions: target.Txns,
+		})
+	}
+	return results, nil
+}
+
 // witnessToHex formats the passed witness stack as a slice of hex-encoded
 // strings to be used in a JSON response.
 func witnessToHex(witness wire.TxWitness) []string {
@@ -804,9 +1098,94 @@ func handleDecodeRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 		Vin:      createVinList(&mtx),
 		Vout:     createVoutList(&mtx, s.cfg.ChainParams, nil),
 	}
+	if c.IncludePrevOuts != nil && *c.IncludePrevOuts {
+		prevOuts, fee, err := createPrevOutList(s, &mtx)
+		if err != nil {
+			return nil, err
+		}
+		txReply.PrevOuts = prevOuts
+		txReply.Fee = fee
+	}
 	return txReply, nil
 }
 
+// createPrevOutList returns a slice of JSON objects for the outputs referenced
+// by the inputs of the passed transaction along with the fee paid by the
+// transaction.  The fee is nil when any of the outputs could not be resolved.
+func createPrevOutList(s *rpcServer, mtx *wire.MsgTx) ([]btcjson.PrevOutResult, *float64, error) {
+	fetcher := prevOutFetcher{
+		chain:     s.cfg.Chain,
+		txMemPool: s.cfg.TxMemPool,
+		db:        s.cfg.DB,
+		txIndex:   s.cfg.TxIndex,
+	}
+	prevOuts, err := fetcher.FetchPrevOuts(mtx)
+	if err != nil {
+		context := "Failed to fetch previous outputs"
+		return nil, nil, internalRPCError(err.Error(), context)
+	}
+
+	// There is no fee to compute for coinbase transactions.
+	if len(prevOuts) == 0 {
+		return nil, nil, nil
+	}
+
+	var totalIn int64
+	haveAll := true
+	prevOutList := make([]btcjson.PrevOutResult, 0, len(prevOuts))
+	for _, prevOut := range prevOuts {
+		entry := btcjson.PrevOutResult{
+			Txid:   prevOut.outPoint.Hash.String(),
+			Vout:   prevOut.outPoint.Index,
+			Status: string(prevOut.status),
+		}
+		if prevOut.status == prevOutMissing {
+			haveAll = false
+			prevOutList = append(prevOutList, entry)
+			continue
+		}
+
+		// The disassembled string will contain [error] inline if the
+		// script doesn't fully parse, so ignore the error here.
+		pkScript := prevOut.txOut.PkScript
+		disbuf, _ := txscript.DisasmString(pkScript)
+
+		// Ignore the error here since an error means the script
+		// couldn't parse and there is no additional information about
+		// it anyways.
+		scriptClass, addrs, reqSigs, _ := txscript.ExtractPkScriptAddrs(
+			pkScript, s.cfg.ChainParams)
+		addresses := make([]string, len(addrs))
+		for i, addr := range addrs {
+			addresses[i] = addr.EncodeAddress()
+		}
+
+		entry.Value = btcutil.Amount(prevOut.txOut.Value).ToBTC()
+		entry.ScriptPubKey = &btcjson.ScriptPubKeyResult{
+			Asm:       disbuf,
+			Hex:       hex.EncodeToString(pkScript),
+			ReqSigs:   int32(reqSigs),
+			Type:      scriptClass.String(),
+			Addresses: addresses,
+		}
+		entry.Height = prevOut.height
+		entry.Coinbase = prevOut.isCoinBase
+		prevOutList = append(prevOutList, entry)
+
+		totalIn += prevOut.txOut.Value
+	}
+
+	if !haveAll {
+		return prevOutList, nil, nil
+	}
+	var totalOut int64
+	for _, txOut := range mtx.TxOut {
+		totalOut += txOut.Value
+	}
+	fee := btcutil.Amount(totalIn - totalOut).ToBTC()
+	return prevOutList, &fee, nil
+}
+
 // handleDecodeScript handles decodescript commands.
 func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.DecodeScriptCmd)
@@ -877,6 +1256,56 @@ func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return float64(feeRate), nil
 }
 
+// handleEstimateSmartFee handles estimatesmartfee commands.
+func handleEstimateSmartFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.EstimateSmartFeeCmd)
+
+	if s.cfg.FeeEstimator == nil {
+		return nil, errors.New("Fee estimation disabled")
+	}
+
+	if c.ConfTarget < 1 || c.ConfTarget > mempool.MaxEstimateTarget {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid conf_target, must be "+
+				"between 1 and %d", mempool.MaxEstimateTarget),
+		}
+	}
+
+	var conservative bool
+	switch *c.EstimateMode {
+	case btcjson.EstimateModeConservative:
+		conservative = true
+	case btcjson.EstimateModeEconomical:
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid estimate_mode parameter",
+		}
+	}
+
+	feeRate, blocks, err := s.cfg.FeeEstimator.EstimateSmartFee(
+		uint32(c.ConfTarget), conservative)
+	if err != nil {
+		return &btcjson.EstimateSmartFeeResult{
+			Errors: []string{err.Error()},
+			Blocks: int64(blocks),
+		}, nil
+	}
+
+	// Transactions below the minimum fee rate of the mempool, which is at
+	// least the minimum relay fee, would not be accepted at all.
+	rate := float64(feeRate)
+	if minFee := s.cfg.TxMemPool.MinFee().ToBTC(); minFee > rate {
+		rate = minFee
+	}
+
+	return &btcjson.EstimateSmartFeeResult{
+		FeeRate: &rate,
+		Blocks:  int64(blocks),
+	}, nil
+}
+
 // handleGenerate handles generate commands.
 func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if there are no addresses to pay the
@@ -1076,6 +1505,15 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		return err
 	})
 	if err != nil {
+		// Point out blocks of stale forks whose header is known, but
+		// which have not been downloaded.
+		if _, ok := s.cfg.ForkArchive.Block(hash); ok {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCBlockNotFound,
+				Message: "Block not available (header only) -- " +
+					"use getblockfrompeer to download it",
+			}
+		}
 		return nil, &btcjson.RPCError{
 			Code:    btcjson.ErrRPCBlockNotFound,
 			Message: "Block not found",
@@ -1097,18 +1535,26 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		return nil, internalRPCError(err.Error(), context)
 	}
 
-	// Get the block height from chain.
+	// Get the block height from chain.  Blocks of stale forks are not part
+	// of the main chain, so their height is taken from the fork archive
+	// and they have no confirmations as in the reference implementation.
+	best := s.cfg.Chain.BestSnapshot()
 	blockHeight, err := s.cfg.Chain.BlockHeightByHash(hash)
+	confirmations := int64(1 + best.Height - blockHeight)
 	if err != nil {
-		context := "Failed to obtain block height"
-		return nil, internalRPCError(err.Error(), context)
+		forkBlock, ok := s.cfg.ForkArchive.Block(hash)
+		if !ok {
+			context := "Failed to obtain block height"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		blockHeight = forkBlock.Height
+		confirmations = -1
 	}
 	blk.SetHeight(blockHeight)
-	best := s.cfg.Chain.BestSnapshot()
 
 	// Get next block hash unless there are none.
 	var nextHashString string
-	if blockHeight < best.Height {
+	if confirmations > 1 {
 		nextHash, err := s.cfg.Chain.BlockHashByHeight(blockHeight + 1)
 		if err != nil {
 			context := "No next block"
@@ -1127,7 +1573,7 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		PreviousHash:  blockHeader.PrevBlock.String(),
 		Nonce:         blockHeader.Nonce,
 		Time:          blockHeader.Timestamp.Unix(),
-		Confirmations: int64(1 + best.Height - blockHeight),
+		Confirmations: confirmations,
 		Height:        int64(blockHeight),
 		Size:          int32(len(blkBytes)),
 		StrippedSize:  int32(blk.MsgBlock().SerializeSizeStripped()),
@@ -1182,6 +1628,22 @@ func softForkStatus(state blockchain.ThresholdState) (string, error) {
 	}
 }
 
+// softForkName converts a deployment ID into the human readable name of the
+// soft-fork it deploys.
+func softForkName(deployment int) (string, error) {
+	switch deployment {
+	case chaincfg.DeploymentTestDummy:
+		return "dummy", nil
+	case chaincfg.DeploymentCSV:
+		return "csv", nil
+	case chaincfg.DeploymentSegwit:
+		return "segwit", nil
+	default:
+		return "", fmt.Errorf("unknown deployment %v detected",
+			deployment)
+	}
+}
+
 // handleGetBlockChainInfo implements the getblockchaininfo command.
 func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Obtain a snapshot of the current best known blockchain state. We'll
@@ -1189,6 +1651,7 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 	params := s.cfg.ChainParams
 	chain := s.cfg.Chain
 	chainSnapshot := chain.BestSnapshot()
+	prunedHeight := chain.PrunedHeight()
 
 	chainInfo := &btcjson.GetBlockChainInfoResult{
 		Chain:         params.Name,
@@ -1197,12 +1660,18 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 		BestBlockHash: chainSnapshot.Hash.String(),
 		Difficulty:    getDifficultyRatio(chainSnapshot.Bits, params),
 		MedianTime:    chainSnapshot.MedianTime.Unix(),
-		Pruned:        false,
+		Pruned:        cfg.PruneDepth != 0 || prunedHeight != 0,
 		SoftForks: &btcjson.SoftForks{
 			Bip9SoftForks: make(map[string]*btcjson.Bip9SoftForkDescription),
 		},
 	}
 
+	// Report the height of the oldest block which is still available once
+	// blocks have been pruned.
+	if prunedHeight != 0 {
+		chainInfo.PruneHeight = prunedHeight + 1
+	}
+
 	// Next, populate the response with information describing the current
 	// status of soft-forks deployed via the super-majority block
 	// signalling mechanism.
@@ -1239,35 +1708,26 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 
 	// Finally, query the BIP0009 version bits state for all currently
 	// defined BIP0009 soft-fork deployments.
-	for deployment, deploymentDetails := range params.Deployments {
+	for deployment := range params.Deployments {
 		// Map the integer deployment ID into a human readable
 		// fork-name.
-		var forkName string
-		switch deployment {
-		case chaincfg.DeploymentTestDummy:
-			forkName = "dummy"
-
-		case chaincfg.DeploymentCSV:
-			forkName = "csv"
-
-		case chaincfg.DeploymentSegwit:
-			forkName = "segwit"
-
-		default:
+		forkName, err := softForkName(deployment)
+		if err != nil {
 			return nil, &btcjson.RPCError{
-				Code: btcjson.ErrRPCInternal.Code,
-				Message: fmt.Sprintf("Unknown deployment %v "+
-					"detected", deployment),
+				Code:    btcjson.ErrRPCInternal.Code,
+				Message: err.Error(),
 			}
 		}
 
 		// Query the chain for the current status of the deployment as
 		// identified by its deployment ID.
-		deploymentStatus, err := chain.ThresholdState(uint32(deployment))
+		deploymentInfo, err := chain.DeploymentInfo(uint32(deployment))
 		if err != nil {
 			context := "Failed to obtain deployment status"
 			return nil, internalRPCError(err.Error(), context)
 		}
+		deploymentStatus := deploymentInfo.State
+		deploymentDetails := &deploymentInfo.Deployment
 
 		// Attempt to convert the current deployment status into a
 		// human readable string. If the status is unrecognized, then a
@@ -1288,12 +1748,68 @@ func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan str
 			Bit:        deploymentDetails.BitNumber,
 			StartTime2: int64(deploymentDetails.StartTime),
 			Timeout:    int64(deploymentDetails.ExpireTime),
+			Since:      deploymentInfo.Since,
+
+			MinActivationHeight: int32(deploymentDetails.MinActivationHeight),
 		}
 	}
 
 	return chainInfo, nil
 }
 
+// handleGetBlockFromPeer implements the getblockfrompeer command.
+func handleGetBlockFromPeer(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockFromPeerCmd)
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+
+	var p *peer.Peer
+	for _, sp := range s.cfg.ConnMgr.ConnectedPeers() {
+		if sp.ToPeer().ID() == c.PeerID {
+			p = sp.ToPeer()
+			break
+		}
+	}
+	if p == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Peer does not exist",
+		}
+	}
+
+	// Nothing to do when the block is already available.
+	haveBlock, err := s.cfg.Chain.HaveBlock(hash)
+	if err != nil {
+		context := "Failed to check for block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if haveBlock {
+		return nil, nil
+	}
+
+	// Headers of unknown forks can only be backfilled by the fork archive.
+	if s.cfg.ForkArchive != nil {
+		err = s.cfg.ForkArchive.FetchFromPeer(hash, p)
+	} else if _, err = s.cfg.Chain.HeaderByHash(hash); err == nil {
+		err = s.cfg.SyncMgr.RequestBlock(hash, p)
+	} else {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "Block header missing -- the fork archive " +
+				"must be enabled (--forkarchive) to backfill it",
+		}
+	}
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: fmt.Sprintf("Unable to fetch block: %v", err),
+		}
+	}
+	return nil, nil
+}
+
 // handleGetBlockCount implements the getblockcount command.
 func handleGetBlockCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	best := s.cfg.Chain.BestSnapshot()
@@ -1382,6 +1898,112 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 	return blockHeaderReply, nil
 }
 
+// handleGetBlockStats implements the getblockstats command.
+func handleGetBlockStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockStatsCmd)
+
+	// The block is identified by either its hash or its height in the main
+	// chain.
+	var hash *chainhash.Hash
+	switch v := c.HashOrHeight.Value.(type) {
+	case int64:
+		var err error
+		if v == int64(int32(v)) {
+			hash, err = s.cfg.Chain.BlockHashByHeight(int32(v))
+		}
+		if hash == nil || err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCOutOfRange,
+				Message: "Block number out of range",
+			}
+		}
+
+	case string:
+		var err error
+		hash, err = chainhash.NewHashFromStr(v)
+		if err != nil {
+			return nil, rpcDecodeHexError(v)
+		}
+
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "The block must be identified by its hash or height",
+		}
+	}
+
+	if !s.cfg.Chain.MainChainHasBlock(hash) {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block is not in the main chain",
+		}
+	}
+	stats, err := s.cfg.Chain.BlockStatsByHash(hash)
+	if err != nil {
+		context := "Failed to obtain block statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	result := &btcjson.GetBlockStatsResult{
+		AvgFee:             stats.AvgFee,
+		AvgFeeRate:         stats.AvgFeeRate,
+		AvgTxSize:          stats.AvgTxSize,
+		BlockHash:          stats.Hash.String(),
+		FeeRatePercentiles: stats.FeeRatePercentiles[:],
+		Height:             int64(stats.Height),
+		Ins:                int64(stats.Inputs),
+		MaxFee:             stats.MaxFee,
+		MaxFeeRate:         stats.MaxFeeRate,
+		MaxTxSize:          stats.MaxTxSize,
+		MedianFee:          stats.MedianFee,
+		MedianTime:         stats.MedianTime.Unix(),
+		MinFee:             stats.MinFee,
+		MinFeeRate:         stats.MinFeeRate,
+		MinTxSize:          stats.MinTxSize,
+		Outs:               int64(stats.Outputs),
+		SegWitTotalSize:    stats.SegwitTotalSize,
+		SegWitTotalWeight:  stats.SegwitTotalWeight,
+		SegWitTxs:          int64(stats.SegwitTxs),
+		Subsidy:            stats.Subsidy,
+		Time:               stats.Time.Unix(),
+		TotalOut:           stats.TotalOut,
+		TotalSize:          stats.TotalSize,
+		TotalWeight:        stats.TotalWeight,
+		TotalFee:           stats.TotalFee,
+		Txs:                int64(stats.Txs),
+		UTXOIncrease:       stats.UtxoIncrease,
+		UTXOSizeIncrease:   stats.UtxoSizeIncrease,
+	}
+	if c.Stats == nil || len(*c.Stats) == 0 {
+		return result, nil
+	}
+
+	// Only the selected statistics are returned, so pick them from the
+	// marshalled result by their names.
+	marshalled, err := json.Marshal(result)
+	if err != nil {
+		context := "Failed to marshal block statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(marshalled, &all); err != nil {
+		context := "Failed to unmarshal block statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	selected := make(map[string]json.RawMessage, len(*c.Stats))
+	for _, stat := range *c.Stats {
+		value, ok := all[stat]
+		if !ok {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Invalid selected statistic " + stat,
+			}
+		}
+		selected[stat] = value
+	}
+	return selected, nil
+}
+
 // encodeTemplateID encodes the passed details into an ID that can be used to
 // uniquely identify a block template.
 func encodeTemplateID(prevHash *chainhash.Hash, lastGenerated time.Time) string {
@@ -1474,7 +2096,9 @@ func (state *gbtWorkState) NotifyBlockConnected(blockHash *chainhash.Hash) {
 // NotifyMempoolTx uses the new last updated time for the transaction memory
 // pool to notify any long poll clients with a new block template when their
 // existing block template is stale due to enough time passing and the contents
-// of the memory pool changing.
+// of the memory pool changing.  When the memory pool changes before enough time
+// has passed since the last template was generated, the clients are notified
+// once it has, so they don't have to wait for further changes.
 func (state *gbtWorkState) NotifyMempoolTx(lastUpdated time.Time) {
 	go func() {
 		state.Lock()
@@ -1486,15 +2110,39 @@ func (state *gbtWorkState) NotifyMempoolTx(lastUpdated time.Time) {
 			return
 		}
 
-		if time.Now().After(state.lastGenerated.Add(time.Second *
-			gbtRegenerateSeconds)) {
-
+		regenerateTime := state.lastGenerated.Add(time.Second *
+			gbtRegenerateSeconds)
+		if time.Now().After(regenerateTime) {
 			state.notifyLongPollers(state.prevHash, lastUpdated)
+			return
 		}
+
+		// Notify the clients once enough time has passed unless a
+		// notification is already pending.
+		state.pendingTxUpdate = lastUpdated
+		if state.mempoolTimer != nil {
+			return
+		}
+		state.mempoolTimer = time.AfterFunc(time.Until(regenerateTime),
+			state.notifyPendingTxUpdate)
 	}()
 }
 
-// templateUpdateChan returns a channel that will be closed once the block
+// notifyPendingTxUpdate notifies any long poll clients about the changes to
+// the memory pool which happened too soon after the last template was
+// generated to notify them right away.  It is invoked by the mempool timer.
+func (state *gbtWorkState) notifyPendingTxUpdate() {
+	state.Lock()
+	defer state.Unlock()
+
+	state.mempoolTimer = nil
+	if state.prevHash == nil {
+		return
+	}
+	state.notifyLongPollers(state.prevHash, state.pendingTxUpdate)
+}
+
+// templateUpdateChan returns a channel that will be closed once the block
 // template associated with the passed previous hash and last generated time
 // is stale.  The function will return existing channels for duplicate
 // parameters which allows multiple clients to wait for the same block template
@@ -1544,7 +2192,9 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 	// Generate a new block template when the current best block has
 	// changed or the transactions in the memory pool have been updated and
 	// it has been at least gbtRegenerateSecond since the last template was
-	// generated.
+	// generated.  A template without a payment address is also regenerated
+	// when the caller requires a full coinbase and coinbase payouts are
+	// configured, since the payouts add outputs to the coinbase.
 	var msgBlock *wire.MsgBlock
 	var targetDifficulty string
 	latestHash := &s.cfg.Chain.BestSnapshot().Hash
@@ -1553,7 +2203,9 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		!state.prevHash.IsEqual(latestHash) ||
 		(state.lastTxUpdate != lastTxUpdate &&
 			time.Now().After(state.lastGenerated.Add(time.Second*
-				gbtRegenerateSeconds))) {
+				gbtRegenerateSeconds))) ||
+		(!useCoinbaseValue && !template.ValidPayAddress &&
+			len(generator.Policy().CoinbasePayouts) > 0) {
 
 		// Reset the previous best hash the block template was generated
 		// against so any errors below cause the next invocation to try
@@ -1590,8 +2242,11 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		minTimestamp := mining.MinimumMedianTime(best)
 
 		// Update work state to ensure another block template isn't
-		// generated until needed.
+		// generated until needed.  The templates generated within
+		// lower limits are regenerated along with it when requested.
 		state.template = template
+		state.tweakedTemplates = make(
+			map[gbtTemplateLimits]*mining.BlockTemplate)
 		state.lastGenerated = time.Now()
 		state.lastTxUpdate = lastTxUpdate
 		state.prevHash = latestHash
@@ -1657,17 +2312,109 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 	return nil
 }
 
-// blockTemplateResult returns the current block template associated with the
+// templateTweakLimits returns the limits of the block template for the passed
+// request.  They are the limits of the passed policy, except for those which
+// the request lowers through the template tweaking fields sigoplimit and
+// sizelimit defined by BIP 0022.  The returned flag indicates whether the
+// request lowers any of the limits.
+func templateTweakLimits(policy *mining.Policy, request *btcjson.TemplateRequest) (gbtTemplateLimits, bool) {
+	limits := gbtTemplateLimits{
+		weight:    int64(policy.BlockMaxWeight),
+		sigOpCost: blockchain.MaxBlockSigOpsCost,
+	}
+	if policy.BlockMaxSigOpCost > 0 &&
+		policy.BlockMaxSigOpCost < limits.sigOpCost {
+
+		limits.sigOpCost = policy.BlockMaxSigOpCost
+	}
+	if request == nil {
+		return limits, false
+	}
+
+	// The serialized size of a block never exceeds its weight, so a size
+	// limit is honored by limiting the weight of the template to it.
+	var tweaked bool
+	sizeLimit, ok := request.SizeLimit.(int64)
+	if ok && sizeLimit > 0 && sizeLimit < limits.weight {
+		limits.weight = sizeLimit
+		tweaked = true
+	}
+	sigOpLimit, ok := request.SigOpLimit.(int64)
+	if ok && sigOpLimit > 0 && sigOpLimit < limits.sigOpCost {
+		limits.sigOpCost = sigOpLimit
+		tweaked = true
+	}
+	return limits, tweaked
+}
+
+// requestedTemplateResult returns the block template associated with the state
+// for the passed request as a btcjson.GetBlockTemplateResult that is ready to
+// be encoded to JSON and returned to the caller.  When the request lowers the
+// limits of the template, a template within the requested limits is generated
+// from the same transactions unless one was already generated for the current
+// template.
+//
+// This function MUST be called with the state locked.
+func (state *gbtWorkState) requestedTemplateResult(s *rpcServer, request *btcjson.TemplateRequest, useCoinbaseValue bool, submitOld *bool) (*btcjson.GetBlockTemplateResult, error) {
+	generator := s.cfg.Generator
+	limits, tweaked := templateTweakLimits(generator.Policy(), request)
+	if !tweaked {
+		return state.blockTemplateResult(state.template,
+			useCoinbaseValue, submitOld)
+	}
+
+	template, ok := state.tweakedTemplates[limits]
+	if !ok || (!useCoinbaseValue && !template.ValidPayAddress) {
+		var payAddr btcutil.Address
+		if !useCoinbaseValue {
+			payAddr = cfg.miningAddrs[rand.Intn(len(cfg.miningAddrs))]
+		}
+
+		policy := *generator.Policy()
+		policy.BlockMaxWeight = uint32(limits.weight)
+		policy.BlockMaxSigOpCost = limits.sigOpCost
+		var err error
+		template, err = generator.NewBlockTemplateWithPolicy(payAddr,
+			&policy)
+		if err != nil {
+			return nil, internalRPCError("Failed to create new "+
+				"block template: "+err.Error(), "")
+		}
+		state.tweakedTemplates[limits] = template
+
+		rpcsLog.Debugf("Generated block template with weight limit %d "+
+			"and signature operation cost limit %d", limits.weight,
+			limits.sigOpCost)
+	} else {
+		generator.UpdateBlockTime(template.Block)
+		template.Block.Header.Nonce = 0
+	}
+
+	result, err := state.blockTemplateResult(template, useCoinbaseValue,
+		submitOld)
+	if err != nil {
+		return nil, err
+	}
+	result.WeightLimit = limits.weight
+	result.SigOpLimit = limits.sigOpCost
+	if sizeLimit, ok := request.SizeLimit.(int64); ok &&
+		sizeLimit > 0 && sizeLimit < result.SizeLimit {
+
+		result.SizeLimit = sizeLimit
+	}
+	return result, nil
+}
+
+// blockTemplateResult returns the passed block template associated with the
 // state as a btcjson.GetBlockTemplateResult that is ready to be encoded to JSON
 // and returned to the caller.
 //
 // This function MUST be called with the state locked.
-func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld *bool) (*btcjson.GetBlockTemplateResult, error) {
+func (state *gbtWorkState) blockTemplateResult(template *mining.BlockTemplate, useCoinbaseValue bool, submitOld *bool) (*btcjson.GetBlockTemplateResult, error) {
 	// Ensure the timestamps are still in valid range for the template.
 	// This should really only ever happen if the local clock is changed
 	// after the template is generated, but it's important to avoid serving
 	// invalid block templates.
-	template := state.template
 	msgBlock := template.Block
 	header := &msgBlock.Header
 	adjustedTime := state.timeSource.AdjustedTime()
@@ -1812,7 +2559,7 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 // has passed without finding a solution.
 //
 // See https://en.bitcoin.it/wiki/BIP_0022 for more details.
-func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbaseValue bool, closeChan <-chan struct{}) (interface{}, error) {
+func handleGetBlockTemplateLongPoll(s *rpcServer, request *btcjson.TemplateRequest, useCoinbaseValue bool, closeChan <-chan struct{}) (interface{}, error) {
 	state := s.gbtWorkState
 	state.Lock()
 	// The state unlock is intentionally not deferred here since it needs to
@@ -1826,9 +2573,10 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 
 	// Just return the current block template if the long poll ID provided by
 	// the caller is invalid.
-	prevHash, lastGenerated, err := decodeTemplateID(longPollID)
+	prevHash, lastGenerated, err := decodeTemplateID(request.LongPollID)
 	if err != nil {
-		result, err := state.blockTemplateResult(useCoinbaseValue, nil)
+		result, err := state.requestedTemplateResult(s, request,
+			useCoinbaseValue, nil)
 		if err != nil {
 			state.Unlock()
 			return nil, err
@@ -1849,8 +2597,8 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 		// old block template depending on whether or not a solution has
 		// already been found and added to the block chain.
 		submitOld := prevHash.IsEqual(prevTemplateHash)
-		result, err := state.blockTemplateResult(useCoinbaseValue,
-			&submitOld)
+		result, err := state.requestedTemplateResult(s, request,
+			useCoinbaseValue, &submitOld)
 		if err != nil {
 			state.Unlock()
 			return nil, err
@@ -1890,7 +2638,8 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 	// block template depending on whether or not a solution has already
 	// been found and added to the block chain.
 	submitOld := prevHash.IsEqual(&state.template.Block.Header.PrevBlock)
-	result, err := state.blockTemplateResult(useCoinbaseValue, &submitOld)
+	result, err := state.requestedTemplateResult(s, request,
+		useCoinbaseValue, &submitOld)
 	if err != nil {
 		return nil, err
 	}
@@ -1963,7 +2712,7 @@ func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateReques
 	// client to be notified when block template referenced by the ID should
 	// be replaced with a new one.
 	if request != nil && request.LongPollID != "" {
-		return handleGetBlockTemplateLongPoll(s, request.LongPollID,
+		return handleGetBlockTemplateLongPoll(s, request,
 			useCoinbaseValue, closeChan)
 	}
 
@@ -1981,7 +2730,7 @@ func handleGetBlockTemplateRequest(s *rpcServer, request *btcjson.TemplateReques
 	if err := state.updateBlockTemplate(s, useCoinbaseValue); err != nil {
 		return nil, err
 	}
-	return state.blockTemplateResult(useCoinbaseValue, nil)
+	return state.requestedTemplateResult(s, request, useCoinbaseValue, nil)
 }
 
 // chainErrToGBTErrString converts an error returned from btcchain to a string
@@ -2081,7 +2830,7 @@ func chainErrToGBTErrString(err error) string {
 	case blockchain.ErrInvalidAncestorBlock:
 		return "bad-prevblk"
 	case blockchain.ErrPrevBlockNotBest:
-		return "inconclusive-not-best-prvblk"
+		return "inconclusive-not-best-prevblk"
 	}
 
 	return "rejected: " + err.Error()
@@ -2123,14 +2872,39 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *btcjson.TemplateReque
 	}
 	block := btcutil.NewBlock(&msgBlock)
 
-	// Ensure the block is building from the expected previous block.
-	expectedPrevHash := s.cfg.Chain.BestSnapshot().Hash
+	// Reject proposals of blocks which are already known as duplicates
+	// while reporting whether they are known to be valid, known to be
+	// invalid, or neither.
+	chain := s.cfg.Chain
+	switch {
+	case chain.MainChainHasBlock(block.Hash()):
+		return "duplicate", nil
+	case chain.IsKnownInvalid(block.Hash()):
+		return "duplicate-invalid", nil
+	}
+	haveBlock, err := chain.HaveBlock(block.Hash())
+	if err != nil {
+		context := "Failed to look up block proposal"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if haveBlock {
+		return "duplicate-inconclusive", nil
+	}
+
+	// Ensure the block is building from the expected previous block.  A
+	// block building on an invalid block is invalid itself, while a block
+	// building on any other block can't be validated since only blocks
+	// building on the current best block are.
+	expectedPrevHash := chain.BestSnapshot().Hash
 	prevHash := &block.MsgBlock().Header.PrevBlock
 	if !expectedPrevHash.IsEqual(prevHash) {
-		return "bad-prevblk", nil
+		if chain.IsKnownInvalid(prevHash) {
+			return "bad-prevblk", nil
+		}
+		return "inconclusive-not-best-prevblk", nil
 	}
 
-	if err := s.cfg.Chain.CheckConnectBlockTemplate(block); err != nil {
+	if err := chain.CheckConnectBlockTemplate(block); err != nil {
 		if _, ok := err.(blockchain.RuleError); !ok {
 			errStr := fmt.Sprintf("Failed to process block proposal: %v", err)
 			rpcsLog.Error(errStr)
@@ -2234,6 +3008,135 @@ func handleGetCFilterHeader(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return hash.String(), nil
 }
 
+// handleGetChainTips implements the getchaintips command.
+func handleGetChainTips(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	tips := s.cfg.Chain.ChainTips()
+	results := make([]btcjson.GetChainTipsResult, 0, len(tips))
+	for _, tip := range tips {
+		results = append(results, btcjson.GetChainTipsResult{
+			Height:    tip.Height,
+			Hash:      tip.Hash.String(),
+			BranchLen: tip.BranchLen,
+			Status:    tip.Status.String(),
+		})
+	}
+
+	// The tips of the stale forks retained by the fork archive, if any, are
+	// reported as well unless the chain knows them, in which case the tips
+	// of the chain already cover their branches.
+	for _, tip := range s.cfg.ForkArchive.ChainTips() {
+		if _, err := s.cfg.Chain.HeaderByHash(&tip.Hash); err == nil {
+			continue
+		}
+		results = append(results, btcjson.GetChainTipsResult{
+			Height:    tip.Height,
+			Hash:      tip.Hash.String(),
+			BranchLen: tip.BranchLen,
+			Status:    tip.Status,
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Height > results[j].Height
+	})
+	return results, nil
+}
+
+// handleGetChainTxStats implements the getchaintxstats command.
+func handleGetChainTxStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetChainTxStatsCmd)
+	chain := s.cfg.Chain
+
+	// The window ends with the tip of the main chain unless a block is
+	// given.
+	best := chain.BestSnapshot()
+	hash, height := &best.Hash, best.Height
+	if c.BlockHash != nil {
+		var err error
+		hash, err = chainhash.NewHashFromStr(*c.BlockHash)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.BlockHash)
+		}
+		height, err = chain.BlockHeightByHash(hash)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCBlockNotFound,
+				Message: "Block is not in the main chain",
+			}
+		}
+	}
+
+	// The window defaults to about a month of blocks, but may not extend to
+	// the genesis block.
+	var windowBlocks int32
+	if c.NBlocks != nil {
+		windowBlocks = *c.NBlocks
+		if windowBlocks < 0 || (windowBlocks > 0 && windowBlocks >= height) {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: "Invalid block count: should be between " +
+					"0 and the block's height - 1",
+			}
+		}
+	} else {
+		month := 30 * 24 * time.Hour
+		windowBlocks = int32(month / s.cfg.ChainParams.TargetTimePerBlock)
+		if windowBlocks > height-1 {
+			windowBlocks = height - 1
+		}
+		if windowBlocks < 0 {
+			windowBlocks = 0
+		}
+	}
+
+	stats, err := chain.ChainTxStats(hash, windowBlocks)
+	if err != nil {
+		context := "Failed to obtain chain transaction statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	result := &btcjson.GetChainTxStatsResult{
+		Time:                   stats.Time.Unix(),
+		TxCount:                int64(stats.TxCount),
+		WindowFinalBlockHash:   stats.Hash.String(),
+		WindowFinalBlockHeight: stats.Height,
+		WindowBlockCount:       stats.WindowBlocks,
+	}
+	if stats.WindowBlocks > 0 {
+		txCount := int64(stats.WindowTxCount)
+		interval := int64(stats.WindowInterval / time.Second)
+		result.WindowTxCount = &txCount
+		result.WindowInterval = &interval
+		if interval > 0 {
+			txRate := float64(txCount) / float64(interval)
+			result.TxRate = &txRate
+		}
+	}
+	return result, nil
+}
+
+// handleGetCheckpoints implements the getcheckpoints command.
+func handleGetCheckpoints(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	builtin := make(map[int32]*chainhash.Hash)
+	for _, checkpoint := range s.cfg.ChainParams.Checkpoints {
+		builtin[checkpoint.Height] = checkpoint.Hash
+	}
+
+	checkpoints := s.cfg.Chain.Checkpoints()
+	results := make([]btcjson.CheckpointResult, 0, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		hash, ok := builtin[checkpoint.Height]
+		results = append(results, btcjson.CheckpointResult{
+			Height: checkpoint.Height,
+			Hash:   checkpoint.Hash.String(),
+			Local:  !ok || !hash.IsEqual(checkpoint.Hash),
+		})
+	}
+	return &btcjson.GetCheckpointsResult{
+		Mode:        s.cfg.Chain.CheckpointMode().String(),
+		Checkpoints: results,
+	}, nil
+}
+
 // handleGetConnectionCount implements the getconnectioncount command.
 func handleGetConnectionCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return s.cfg.ConnMgr.ConnectedCount(), nil
@@ -2244,6 +3147,115 @@ func handleGetCurrentNet(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return s.cfg.ChainParams.Net, nil
 }
 
+// handleGetDatabaseStats implements the getdatabasestats command.
+func handleGetDatabaseStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	stats := s.cfg.DB.Stats()
+	return &btcjson.GetDatabaseStatsResult{
+		MetadataCacheHits:    stats.MetadataCacheHits,
+		MetadataCacheMisses:  stats.MetadataCacheMisses,
+		MetadataBytesRead:    stats.MetadataBytesRead,
+		MetadataBytesWritten: stats.MetadataBytesWritten,
+		BlockFileHits:        stats.BlockFileHits,
+		BlockFileMisses:      stats.BlockFileMisses,
+		BlockBytesRead:       stats.BlockBytesRead,
+		BlockBytesWritten:    stats.BlockBytesWritten,
+		OpenFiles:            stats.OpenFiles,
+	}, nil
+}
+
+// handleGetDeploymentInfo implements the getdeploymentinfo command.
+func handleGetDeploymentInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetDeploymentInfoCmd)
+	chain := s.cfg.Chain
+	params := s.cfg.ChainParams
+
+	// The deployments are described as of the block after the tip of the
+	// main chain unless a block is given.
+	best := chain.BestSnapshot()
+	hash, height := &best.Hash, best.Height
+	if c.BlockHash != nil {
+		var err error
+		hash, err = chainhash.NewHashFromStr(*c.BlockHash)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.BlockHash)
+		}
+		height, err = chain.BlockHeightByHash(hash)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCBlockNotFound,
+				Message: "Block is not in the main chain",
+			}
+		}
+	}
+
+	// The soft-forks deployed via the super-majority block signalling
+	// mechanism are buried at fixed heights.
+	deployments := map[string]*btcjson.DeploymentDescription{
+		"bip34": {Type: "buried", Height: params.BIP0034Height},
+		"bip66": {Type: "buried", Height: params.BIP0066Height},
+		"bip65": {Type: "buried", Height: params.BIP0065Height},
+	}
+	for _, d := range deployments {
+		d.Active = height+1 >= d.Height
+	}
+
+	for deployment := range params.Deployments {
+		forkName, err := softForkName(deployment)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInternal.Code,
+				Message: err.Error(),
+			}
+		}
+
+		info, err := chain.DeploymentInfoByHash(hash, uint32(deployment))
+		if err != nil {
+			context := "Failed to obtain deployment status"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		status, err := softForkStatus(info.State)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInternal.Code,
+				Message: err.Error(),
+			}
+		}
+
+		bip9 := &btcjson.Bip9DeploymentDescription{
+			Bit:                 info.Deployment.BitNumber,
+			StartTime:           int64(info.Deployment.StartTime),
+			Timeout:             int64(info.Deployment.ExpireTime),
+			MinActivationHeight: int32(info.Deployment.MinActivationHeight),
+			Status:              status,
+			Since:               info.Since,
+		}
+		if info.Stats != nil {
+			bip9.Statistics = &btcjson.Bip9DeploymentStatistics{
+				Period:    info.Stats.Period,
+				Threshold: info.Stats.Threshold,
+				Elapsed:   info.Stats.Elapsed,
+				Count:     info.Stats.Count,
+				Possible:  info.Stats.Possible,
+			}
+		}
+		description := &btcjson.DeploymentDescription{
+			Type:   "bip9",
+			Active: info.State == blockchain.ThresholdActive,
+			Bip9:   bip9,
+		}
+		if description.Active {
+			description.Height = info.Since
+		}
+		deployments[forkName] = description
+	}
+
+	return &btcjson.GetDeploymentInfoResult{
+		Hash:        hash.String(),
+		Height:      height,
+		Deployments: deployments,
+	}, nil
+}
+
 // handleGetDifficulty implements the getdifficulty command.
 func handleGetDifficulty(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	best := s.cfg.Chain.BestSnapshot()
@@ -2315,28 +3327,134 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 		Difficulty:      getDifficultyRatio(best.Bits, s.cfg.ChainParams),
 		TestNet:         cfg.TestNet3,
 		RelayFee:        cfg.minRelayTxFee.ToBTC(),
+		Errors:          s.cfg.TimeSource.Warning(),
 	}
 
 	return ret, nil
 }
 
-// handleGetMempoolInfo implements the getmempoolinfo command.
-func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	mempoolTxns := s.cfg.TxMemPool.TxDescs()
+// feeRateDiagramResult converts the passed feerate diagram to the points
+// returned by the RPC server.
+func feeRateDiagramResult(diagram []mempool.FeeratePoint) []btcjson.FeeRateDiagramPointResult {
+	result := make([]btcjson.FeeRateDiagramPointResult, 0, len(diagram))
+	for _, point := range diagram {
+		result = append(result, btcjson.FeeRateDiagramPointResult{
+			VSize: point.VSize,
+			Fee:   btcutil.Amount(point.Fee).ToBTC(),
+		})
+	}
+	return result
+}
+
+// handleGetMempoolCluster implements the getmempoolcluster command.
+func handleGetMempoolCluster(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolClusterCmd)
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	cluster, err := s.cfg.TxMemPool.Cluster(txHash)
+	if err != nil {
+		return nil, rpcNoTxInfoError(txHash)
+	}
+
+	result := &btcjson.GetMempoolClusterResult{
+		TxID:    txHash.String(),
+		TxCount: int64(len(cluster.Linearization)),
+		Chunks:  make([]btcjson.MempoolClusterChunkResult, 0, len(cluster.Chunks)),
+		Diagram: feeRateDiagramResult(cluster.Diagram),
+	}
+	var fee int64
+	for _, chunk := range cluster.Chunks {
+		txIDs := make([]string, 0, len(chunk.Txns))
+		for _, hash := range chunk.Txns {
+			txIDs = append(txIDs, hash.String())
+		}
 
-	var numBytes int64
-	for _, txD := range mempoolTxns {
-		numBytes += int64(txD.Tx.MsgTx().SerializeSize())
+		// Fee rates are in satoshi per virtual byte.
+		result.Chunks = append(result.Chunks, btcjson.MempoolClusterChunkResult{
+			Fee:     btcutil.Amount(chunk.Fee).ToBTC(),
+			VSize:   chunk.VSize,
+			FeeRate: float64(chunk.Fee) / float64(chunk.VSize),
+			TxIDs:   txIDs,
+		})
+		fee += chunk.Fee
+		result.VSize += chunk.VSize
 	}
+	result.Fee = btcutil.Amount(fee).ToBTC()
+	return result, nil
+}
 
+// handleGetMempoolDiagram implements the getmempooldiagram command.
+func handleGetMempoolDiagram(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return feeRateDiagramResult(s.cfg.TxMemPool.FeerateDiagram()), nil
+}
+
+// handleGetMempoolInfo implements the getmempoolinfo command.
+func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	ret := &btcjson.GetMempoolInfoResult{
-		Size:  int64(len(mempoolTxns)),
-		Bytes: numBytes,
+		Size:             int64(s.cfg.TxMemPool.Count()),
+		Bytes:            s.cfg.TxMemPool.Size(),
+		MaxMempool:       int64(cfg.MaxMempool) * 1000000,
+		MempoolMinFee:    s.cfg.TxMemPool.MinFee().ToBTC(),
+		MinRelayTxFee:    cfg.minRelayTxFee.ToBTC(),
+		UnbroadcastCount: int64(s.cfg.TxMemPool.UnbroadcastCount()),
 	}
 
 	return ret, nil
 }
 
+// handleGetMempoolPackage implements the getmempoolpackage command.
+func handleGetMempoolPackage(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolPackageCmd)
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	graph, err := s.cfg.TxMemPool.PackageGraph(txHash)
+	if err != nil {
+		return nil, rpcNoTxInfoError(txHash)
+	}
+
+	// Fee rates are in satoshi per virtual byte.
+	feeRate := func(fee, vsize int64) float64 {
+		if vsize == 0 {
+			return 0
+		}
+		return float64(fee) / float64(vsize)
+	}
+	result := &btcjson.GetMempoolPackageResult{
+		TxID:  txHash.String(),
+		Nodes: make([]btcjson.MempoolPackageNodeResult, 0, len(graph.Nodes)),
+		Edges: make([]btcjson.MempoolPackageEdgeResult, 0, len(graph.Edges)),
+	}
+	for _, node := range graph.Nodes {
+		result.Nodes = append(result.Nodes, btcjson.MempoolPackageNodeResult{
+			TxID:            node.Tx.Hash().String(),
+			Relation:        node.Relation.String(),
+			Fee:             btcutil.Amount(node.Fee).ToBTC(),
+			VSize:           node.VSize,
+			FeeRate:         feeRate(node.Fee, node.VSize),
+			AncestorFee:     btcutil.Amount(node.AncestorFee).ToBTC(),
+			AncestorVSize:   node.AncestorVSize,
+			AncestorFeeRate: feeRate(node.AncestorFee, node.AncestorVSize),
+			Time:            node.Added.Unix(),
+			Height:          int64(node.Height),
+		})
+	}
+	for _, edge := range graph.Edges {
+		result.Edges = append(result.Edges, btcjson.MempoolPackageEdgeResult{
+			Parent: edge.Parent.String(),
+			Vout:   edge.Vout,
+			Child:  edge.Child.String(),
+			Vin:    edge.Vin,
+		})
+	}
+	return result, nil
+}
+
 // handleGetMiningInfo implements the getmininginfo command. We only return the
 // fields that are not related to wallet functionality.
 func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -2478,6 +3596,23 @@ func handleGetNetworkHashPS(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	return hashesPerSec.Int64(), nil
 }
 
+// handleGetOrphanBlockInfo implements the getorphanblockinfo command.
+func handleGetOrphanBlockInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	stats := s.cfg.Chain.OrphanStats()
+	return &btcjson.GetOrphanBlockInfoResult{
+		Count:     stats.Count,
+		Bytes:     stats.Bytes,
+		MaxCount:  stats.MaxCount,
+		MaxBytes:  stats.MaxBytes,
+		Expiry:    int64(stats.Expiry.Seconds()),
+		Roots:     len(s.cfg.Chain.OrphanRoots()),
+		Added:     stats.Added,
+		Connected: stats.Connected,
+		Expired:   stats.Expired,
+		Evicted:   stats.Evicted,
+	}, nil
+}
+
 // handleGetPeerInfo implements the getpeerinfo command.
 func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	peers := s.cfg.ConnMgr.ConnectedPeers()
@@ -2517,6 +3652,28 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return infos, nil
 }
 
+// handleGetPrioritisedTransactions implements the getprioritisedtransactions
+// command.
+func handleGetPrioritisedTransactions(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return s.cfg.TxMemPool.PrioritisedTransactions(), nil
+}
+
+// handleGetZMQNotifications implements the getzmqnotifications command.
+func handleGetZMQNotifications(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	endpoints := zmqEndpoints(cfg)
+	notifications := make([]btcjson.GetZMQNotificationsResult, 0,
+		len(endpoints))
+	for _, endpoint := range endpoints {
+		notifications = append(notifications,
+			btcjson.GetZMQNotificationsResult{
+				Type:    "pub" + endpoint.Topic,
+				Address: endpoint.Address,
+				HWM:     endpoint.HWM,
+			})
+	}
+	return notifications, nil
+}
+
 // handleGetRawMempool implements the getrawmempool command.
 func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetRawMempoolCmd)
@@ -2656,84 +3813,567 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 	return *rawTxn, nil
 }
 
-// handleGetTxOut handles gettxout commands.
-func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	c := cmd.(*btcjson.GetTxOutCmd)
+// handleGetRPCRoles implements the getrpcroles command.
+func handleGetRPCRoles(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return s.roles.rolesResult(), nil
+}
 
-	// Convert the provided transaction hash hex to a Hash.
-	txHash, err := chainhash.NewHashFromStr(c.Txid)
-	if err != nil {
-		return nil, rpcDecodeHexError(c.Txid)
+// handleGetStandbyInfo implements the getstandbyinfo command.
+func handleGetStandbyInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.Standby == nil {
+		return &btcjson.GetStandbyInfoResult{}, nil
 	}
 
-	// If requested and the tx is available in the mempool try to fetch it
-	// from there, otherwise attempt to fetch from the block database.
-	var bestBlockHash string
-	var confirmations int32
-	var value int64
-	var pkScript []byte
-	var isCoinbase bool
-	includeMempool := true
-	if c.IncludeMempool != nil {
-		includeMempool = *c.IncludeMempool
+	status := s.cfg.Standby.Status()
+	result := &btcjson.GetStandbyInfoResult{
+		Standby:             status.Standby,
+		Primary:             status.Primary,
+		PrimaryReachable:    status.PrimaryReachable,
+		ConsecutiveFailures: status.ConsecutiveFailures,
+		PromotionReason:     status.PromotionReason,
 	}
-	// TODO: This is racy.  It should attempt to fetch it directly and check
-	// the error.
-	if includeMempool && s.cfg.TxMemPool.HaveTransaction(txHash) {
-		tx, err := s.cfg.TxMemPool.FetchTransaction(txHash)
-		if err != nil {
-			return nil, rpcNoTxInfoError(txHash)
-		}
+	if !status.LastCheck.IsZero() {
+		result.LastCheck = status.LastCheck.Unix()
+	}
+	if !status.PromotedAt.IsZero() {
+		result.PromotedAt = status.PromotedAt.Unix()
+	}
+	return result, nil
+}
 
-		mtx := tx.MsgTx()
-		if c.Vout > uint32(len(mtx.TxOut)-1) {
-			return nil, &btcjson.RPCError{
-				Code: btcjson.ErrRPCInvalidTxVout,
-				Message: "Output index number (vout) does not " +
-					"exist for transaction.",
-			}
-		}
+// handleGetScriptValidationInfo implements the getscriptvalidationinfo command.
+func handleGetScriptValidationInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	stats := s.cfg.Chain.ScriptValidationStats()
+	return &btcjson.GetScriptValidationInfoResult{
+		Workers:     stats.Workers,
+		Schedule:    stats.Schedule.String(),
+		PinnedCPUs:  stats.PinnedCPUs,
+		QueueDepth:  stats.QueueDepth,
+		BusyWorkers: stats.BusyWorkers,
+		Batches:     stats.Batches,
+		Inputs:      stats.Inputs,
+	}, nil
+}
 
-		txOut := mtx.TxOut[c.Vout]
-		if txOut == nil {
-			errStr := fmt.Sprintf("Output index: %d for txid: %s "+
-				"does not exist", c.Vout, txHash)
-			return nil, internalRPCError(errStr, "")
-		}
+// handleGetSyncProgress implements the getsyncprogress command.
+func handleGetSyncProgress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	progress := s.cfg.SyncMgr.SyncProgress()
+	if progress == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Sync progress is not available yet",
+		}
+	}
+
+	return &btcjson.GetSyncProgressResult{
+		Time:            progress.Time.Unix(),
+		HeadersHeight:   progress.HeadersHeight,
+		PresyncHeight:   progress.PresyncHeight,
+		BlockHeight:     progress.BlockHeight,
+		BlockHash:       progress.BlockHash.String(),
+		TargetHeight:    progress.TargetHeight,
+		Progress:        progress.Progress,
+		SyncPeerID:      progress.SyncPeerID,
+		SyncPeer:        progress.SyncPeerAddr,
+		BlocksPerSecond: progress.BlocksPerSecond,
+		ETA:             int64(progress.ETA.Seconds()),
+		Current:         progress.Current,
+	}, nil
+}
 
-		best := s.cfg.Chain.BestSnapshot()
-		bestBlockHash = best.Hash.String()
-		confirmations = 0
-		value = txOut.Value
-		pkScript = txOut.PkScript
-		isCoinbase = blockchain.IsCoinBaseTx(mtx)
-	} else {
-		out := wire.OutPoint{Hash: *txHash, Index: c.Vout}
-		entry, err := s.cfg.Chain.FetchUtxoEntry(out)
-		if err != nil {
-			return nil, rpcNoTxInfoError(txHash)
-		}
+// handleGetTimeInfo implements the gettimeinfo command.
+func handleGetTimeInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	timeSource := s.cfg.TimeSource
+	samples := timeSource.Samples()
+	result := &btcjson.GetTimeInfoResult{
+		LocalTime:     time.Now().Unix(),
+		AdjustedTime:  timeSource.AdjustedTime().Unix(),
+		Offset:        int64(timeSource.Offset().Seconds()),
+		MaxAdjustment: int64(timeSource.MaxAdjustment().Seconds()),
+		Warning:       timeSource.Warning(),
+		Samples:       make([]btcjson.TimeSampleResult, 0, len(samples)),
+	}
+	for _, sample := range samples {
+		result.Samples = append(result.Samples, btcjson.TimeSampleResult{
+			Source:  sample.ID,
+			Offset:  sample.Offset.Seconds(),
+			Added:   sample.Added.Unix(),
+			Outlier: sample.Outlier,
+		})
+	}
+	return result, nil
+}
 
-		// To match the behavior of the reference client, return nil
-		// (JSON null) if the transaction output is spent by another
-		// transaction already in the main chain.  Mined transactions
-		// that are spent by a mempool transaction are not affected by
-		// this.
-		if entry == nil || entry.IsSpent() {
-			return nil, nil
-		}
+// witnessUpgradeVersionResults converts the passed witness upgrade counters to
+// their RPC result representation ordered by version.
+func witnessUpgradeVersionResults(counters map[int]witnessUpgradeCounts) []btcjson.WitnessUpgradeVersionResult {
+	results := make([]btcjson.WitnessUpgradeVersionResult, 0, len(counters))
+	for _, version := range sortedVersions(counters) {
+		counts := counters[version]
+		results = append(results, btcjson.WitnessUpgradeVersionResult{
+			Version:        version,
+			MempoolOutputs: counts.MempoolOutputs,
+			MempoolInputs:  counts.MempoolInputs,
+			BlockOutputs:   counts.BlockOutputs,
+			BlockInputs:    counts.BlockInputs,
+			LastSeen:       counts.LastSeen.Unix(),
+		})
+	}
+	return results
+}
 
-		best := s.cfg.Chain.BestSnapshot()
-		bestBlockHash = best.Hash.String()
-		confirmations = 1 + best.Height - entry.BlockHeight()
-		value = entry.Amount()
-		pkScript = entry.PkScript()
-		isCoinbase = entry.IsCoinBase()
+// handleGetWitnessUpgradeInfo implements the getwitnessupgradeinfo command.
+func handleGetWitnessUpgradeInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.WitnessTelemetry == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Witness upgrade telemetry must be enabled (--witnesstelemetry)",
+		}
+	}
+
+	report := s.cfg.WitnessTelemetry.Report()
+	samples := make([]btcjson.WitnessUpgradeSampleResult, 0,
+		len(report.Samples))
+	for _, sample := range report.Samples {
+		source := "mempool"
+		if sample.InBlock {
+			source = "block"
+		}
+		samples = append(samples, btcjson.WitnessUpgradeSampleResult{
+			Kind:    sample.Kind,
+			Version: sample.Version,
+			TxID:    sample.TxHash.String(),
+			Index:   sample.Index,
+			Source:  source,
+			Height:  sample.Height,
+			Time:    sample.Seen.Unix(),
+		})
 	}
 
-	// Disassemble script into single line printable format.
-	// The disassembled string will contain [error] inline if the script
-	// doesn't fully parse, so ignore the error here.
+	return &btcjson.GetWitnessUpgradeInfoResult{
+		WitnessVersions: witnessUpgradeVersionResults(report.WitnessVersions),
+		TapLeafVersions: witnessUpgradeVersionResults(report.TapLeafVersions),
+		Samples:         samples,
+	}, nil
+}
+
+// errRPCXpubAccountsDisabled is returned by the xpub account commands when the
+// address index is disabled.
+var errRPCXpubAccountsDisabled = &btcjson.RPCError{
+	Code:    btcjson.ErrRPCMisc,
+	Message: "Address index must be enabled (--addrindex)",
+}
+
+// xpubAccountRPCError converts an error returned by the xpub account manager
+// to an RPC error.
+func xpubAccountRPCError(err error, context string) error {
+	if err == errXpubAccountNotFound || err == errXpubAccountExists {
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	return internalRPCError(err.Error(), context)
+}
+
+// handleGetXpubAccountBalance implements the getxpubaccountbalance command.
+func handleGetXpubAccountBalance(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.XpubAccounts == nil {
+		return nil, errRPCXpubAccountsDisabled
+	}
+
+	c := cmd.(*btcjson.GetXpubAccountBalanceCmd)
+	minConf := int32(1)
+	if c.MinConf != nil && *c.MinConf >= 0 {
+		minConf = int32(*c.MinConf)
+	}
+	scan, err := s.cfg.XpubAccounts.Scan(c.Name, minConf)
+	if err != nil {
+		return nil, xpubAccountRPCError(err, "Failed to scan xpub account")
+	}
+
+	return &btcjson.GetXpubAccountBalanceResult{
+		Name:             c.Name,
+		Confirmed:        btcutil.Amount(scan.Confirmed).ToBTC(),
+		Unconfirmed:      btcutil.Amount(scan.Unconfirmed).ToBTC(),
+		Received:         btcutil.Amount(scan.Received).ToBTC(),
+		UnspentCount:     len(scan.Utxos),
+		NextReceiveIndex: scan.NextIndex[xpubBranchExternal],
+		NextChangeIndex:  scan.NextIndex[xpubBranchInternal],
+	}, nil
+}
+
+// handleImportXpubAccount implements the importxpubaccount command.
+func handleImportXpubAccount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.XpubAccounts == nil {
+		return nil, errRPCXpubAccountsDisabled
+	}
+
+	c := cmd.(*btcjson.ImportXpubAccountCmd)
+	addrType := xpubAddrP2PKH
+	if c.AddrType != nil {
+		addrType = *c.AddrType
+	}
+	var gapLimit uint32
+	if c.GapLimit != nil {
+		gapLimit = *c.GapLimit
+	}
+	err := s.cfg.XpubAccounts.AddAccount(c.Name, c.XPub, addrType, gapLimit)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+// handleListAttestations implements the listattestations command.
+func handleListAttestations(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.Attestor == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Attestations must be enabled (--attestinterval)",
+		}
+	}
+
+	c := cmd.(*btcjson.ListAttestationsCmd)
+	var skip int
+	if c.Skip != nil && *c.Skip > 0 {
+		skip = *c.Skip
+	}
+	count := 100
+	if c.Count != nil {
+		count = *c.Count
+		if count < 0 {
+			count = 0
+		}
+	}
+	var reverse bool
+	if c.Reverse != nil {
+		reverse = *c.Reverse
+	}
+
+	records, total, err := s.cfg.Attestor.Records(skip, count, reverse)
+	if err != nil {
+		context := "Failed to load attestations"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	attestations := make([]btcjson.AttestationResult, 0, len(records))
+	for _, r := range records {
+		message := r.message(s.cfg.ChainParams.Net)
+		attestations = append(attestations, btcjson.AttestationResult{
+			ID:          r.ID,
+			Time:        r.Time.Unix(),
+			Hash:        r.State.Hash.String(),
+			Height:      r.State.Height,
+			UtxoMuHash:  r.State.MuHash.String(),
+			TxOuts:      r.State.TxOuts,
+			TotalAmount: btcutil.Amount(r.State.TotalAmount).ToBTC(),
+			Message:     hex.EncodeToString(message[:]),
+			Signature:   hex.EncodeToString(r.Signature),
+		})
+	}
+	pubKey := s.cfg.Attestor.PubKey().SerializeCompressed()
+	return &btcjson.ListAttestationsResult{
+		PubKey:       hex.EncodeToString(pubKey),
+		Total:        total,
+		Attestations: attestations,
+	}, nil
+}
+
+// handleListReorgs implements the listreorgs command.
+func handleListReorgs(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ListReorgsCmd)
+	var skip int
+	if c.Skip != nil && *c.Skip > 0 {
+		skip = *c.Skip
+	}
+	count := 100
+	if c.Count != nil {
+		count = *c.Count
+		if count < 0 {
+			count = 0
+		}
+	}
+	var reverse bool
+	if c.Reverse != nil {
+		reverse = *c.Reverse
+	}
+
+	records, total, err := s.cfg.ReorgLog.Records(skip, count, reverse)
+	if err != nil {
+		context := "Failed to load reorg log"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	reorgs := make([]btcjson.ReorgResult, 0, len(records))
+	for _, r := range records {
+		reorgs = append(reorgs, btcjson.ReorgResult{
+			ID:             r.ID,
+			Time:           r.Time.Unix(),
+			ForkHash:       r.ForkHash.String(),
+			ForkHeight:     r.ForkHeight,
+			OldTipHash:     r.OldTipHash.String(),
+			OldTipHeight:   r.OldTipHeight,
+			NewTipHash:     r.NewTipHash.String(),
+			NewTipHeight:   r.NewTipHeight,
+			Depth:          r.DetachedBlocks,
+			AttachedBlocks: r.AttachedBlocks,
+			DetachedTxns:   r.DetachedTxns,
+			AttachedTxns:   r.AttachedTxns,
+		})
+	}
+	return &btcjson.ListReorgsResult{
+		Total:  total,
+		Reorgs: reorgs,
+	}, nil
+}
+
+// handleListTemplateComparisons implements the listtemplatecomparisons
+// command.
+func handleListTemplateComparisons(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.TemplateComparer == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Template comparisons must be enabled (--templatecompare)",
+		}
+	}
+
+	c := cmd.(*btcjson.ListTemplateComparisonsCmd)
+	var skip int
+	if c.Skip != nil && *c.Skip > 0 {
+		skip = *c.Skip
+	}
+	count := 100
+	if c.Count != nil {
+		count = *c.Count
+		if count < 0 {
+			count = 0
+		}
+	}
+	var reverse bool
+	if c.Reverse != nil {
+		reverse = *c.Reverse
+	}
+
+	records, total, err := s.cfg.TemplateComparer.Records(skip, count,
+		reverse)
+	if err != nil {
+		context := "Failed to load template comparisons"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	comparisons := make([]btcjson.TemplateComparisonResult, 0, len(records))
+	for _, r := range records {
+		comparisons = append(comparisons, btcjson.TemplateComparisonResult{
+			ID:           r.ID,
+			Hash:         r.Hash.String(),
+			Height:       r.Height,
+			Time:         r.Time.Unix(),
+			BlockTime:    r.BlockTime.Unix(),
+			TemplateTime: r.TemplateTime.Unix(),
+			TemplateAge:  r.Time.Unix() - r.TemplateTime.Unix(),
+			TemplateTxns: r.TemplateTxns,
+			BlockTxns:    r.BlockTxns,
+			SharedTxns:   r.SharedTxns,
+			MissingTxns:  r.TemplateTxns - r.SharedTxns,
+			ExtraTxns:    r.BlockTxns - r.SharedTxns,
+			TemplateFees: r.TemplateFees,
+			BlockFees:    r.BlockFees,
+			FeeDiff:      r.BlockFees - r.TemplateFees,
+			MissedFees:   r.MissedFees,
+		})
+	}
+	return &btcjson.ListTemplateComparisonsResult{
+		Total:       total,
+		Comparisons: comparisons,
+	}, nil
+}
+
+// handleListXpubAccounts implements the listxpubaccounts command.
+func handleListXpubAccounts(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.XpubAccounts == nil {
+		return nil, errRPCXpubAccountsDisabled
+	}
+
+	accounts := s.cfg.XpubAccounts.Accounts()
+	results := make([]btcjson.XpubAccountResult, 0, len(accounts))
+	for _, account := range accounts {
+		results = append(results, btcjson.XpubAccountResult{
+			Name:     account.Name,
+			XPub:     account.XPub,
+			AddrType: account.AddrType,
+			GapLimit: account.GapLimit,
+			Created:  account.Created.Unix(),
+		})
+	}
+	return results, nil
+}
+
+// handleListXpubAccountUnspent implements the listxpubaccountunspent command.
+func handleListXpubAccountUnspent(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.XpubAccounts == nil {
+		return nil, errRPCXpubAccountsDisabled
+	}
+
+	c := cmd.(*btcjson.ListXpubAccountUnspentCmd)
+	minConf := int32(1)
+	if c.MinConf != nil && *c.MinConf >= 0 {
+		minConf = int32(*c.MinConf)
+	}
+	scan, err := s.cfg.XpubAccounts.Scan(c.Name, minConf)
+	if err != nil {
+		return nil, xpubAccountRPCError(err, "Failed to scan xpub account")
+	}
+
+	results := make([]btcjson.XpubAccountUnspentResult, 0, len(scan.Utxos))
+	for _, utxo := range scan.Utxos {
+		results = append(results, btcjson.XpubAccountUnspentResult{
+			TxID:          utxo.OutPoint.Hash.String(),
+			Vout:          utxo.OutPoint.Index,
+			Address:       utxo.Address.EncodeAddress(),
+			Branch:        utxo.Branch,
+			Index:         utxo.Index,
+			Amount:        btcutil.Amount(utxo.Amount).ToBTC(),
+			ScriptPubKey:  hex.EncodeToString(utxo.PkScript),
+			Confirmations: int64(utxo.Confirmations),
+		})
+	}
+	return results, nil
+}
+
+// handleReloadRPCRoles implements the reloadrpcroles command.
+func handleReloadRPCRoles(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if err := s.roles.load(); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Failed to reload the RPC role file: " + err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+// handleRemoveXpubAccount implements the removexpubaccount command.
+func handleRemoveXpubAccount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.XpubAccounts == nil {
+		return nil, errRPCXpubAccountsDisabled
+	}
+
+	c := cmd.(*btcjson.RemoveXpubAccountCmd)
+	if err := s.cfg.XpubAccounts.RemoveAccount(c.Name); err != nil {
+		return nil, xpubAccountRPCError(err, "Failed to remove xpub account")
+	}
+	return nil, nil
+}
+
+// handleGetTxOut handles gettxout commands.
+func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetTxOutCmd)
+
+	// Convert the provided transaction hash hex to a Hash.
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+
+	// If requested and the tx is available in the mempool try to fetch it
+	// from there, otherwise attempt to fetch from the block database.
+	var bestBlockHash string
+	var confirmations int32
+	var value int64
+	var pkScript []byte
+	var isCoinbase bool
+	var unconfirmed bool
+	includeMempool := true
+	if c.IncludeMempool != nil {
+		includeMempool = *c.IncludeMempool
+	}
+	var includeMempoolSpends bool
+	if c.IncludeMempoolSpends != nil {
+		includeMempoolSpends = *c.IncludeMempoolSpends
+	}
+	if includeMempoolSpends {
+		// Look up the output in the combined view of the main chain
+		// and the mempool, so outputs which are spent by transactions
+		// in the mempool are treated as spent.
+		out := wire.OutPoint{Hash: *txHash, Index: c.Vout}
+		entry, spend, err := s.cfg.TxMemPool.FetchUtxoEntry(out)
+		if err != nil {
+			return nil, rpcNoTxInfoError(txHash)
+		}
+		unconfirmed = entry != nil &&
+			entry.BlockHeight() == mining.UnminedHeight
+		if entry == nil || spend != nil ||
+			(unconfirmed && !includeMempool) {
+
+			return nil, nil
+		}
+
+		best := s.cfg.Chain.BestSnapshot()
+		bestBlockHash = best.Hash.String()
+		if !unconfirmed {
+			confirmations = 1 + best.Height - entry.BlockHeight()
+		}
+		value = entry.Amount()
+		pkScript = entry.PkScript()
+		isCoinbase = entry.IsCoinBase()
+	} else if includeMempool && s.cfg.TxMemPool.HaveTransaction(txHash) {
+		// TODO: This is racy.  It should attempt to fetch it directly
+		// and check the error.
+		tx, err := s.cfg.TxMemPool.FetchTransaction(txHash)
+		if err != nil {
+			return nil, rpcNoTxInfoError(txHash)
+		}
+
+		mtx := tx.MsgTx()
+		if c.Vout > uint32(len(mtx.TxOut)-1) {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidTxVout,
+				Message: "Output index number (vout) does not " +
+					"exist for transaction.",
+			}
+		}
+
+		txOut := mtx.TxOut[c.Vout]
+		if txOut == nil {
+			errStr := fmt.Sprintf("Output index: %d for txid: %s "+
+				"does not exist", c.Vout, txHash)
+			return nil, internalRPCError(errStr, "")
+		}
+
+		best := s.cfg.Chain.BestSnapshot()
+		bestBlockHash = best.Hash.String()
+		confirmations = 0
+		unconfirmed = true
+		value = txOut.Value
+		pkScript = txOut.PkScript
+		isCoinbase = blockchain.IsCoinBaseTx(mtx)
+	} else {
+		out := wire.OutPoint{Hash: *txHash, Index: c.Vout}
+		entry, err := s.cfg.Chain.FetchUtxoEntry(out)
+		if err != nil {
+			return nil, rpcNoTxInfoError(txHash)
+		}
+
+		// To match the behavior of the reference client, return nil
+		// (JSON null) if the transaction output is spent by another
+		// transaction already in the main chain.  Mined transactions
+		// that are spent by a mempool transaction are not affected by
+		// this.
+		if entry == nil || entry.IsSpent() {
+			return nil, nil
+		}
+
+		best := s.cfg.Chain.BestSnapshot()
+		bestBlockHash = best.Hash.String()
+		confirmations = 1 + best.Height - entry.BlockHeight()
+		value = entry.Amount()
+		pkScript = entry.PkScript()
+		isCoinbase = entry.IsCoinBase()
+	}
+
+	// Disassemble script into single line printable format.
+	// The disassembled string will contain [error] inline if the script
+	// doesn't fully parse, so ignore the error here.
 	disbuf, _ := txscript.DisasmString(pkScript)
 
 	// Get further info about the script.
@@ -2757,11 +4397,102 @@ func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 			Type:      scriptClass.String(),
 			Addresses: addresses,
 		},
-		Coinbase: isCoinbase,
+		Coinbase:    isCoinbase,
+		Unconfirmed: unconfirmed,
 	}
 	return txOutReply, nil
 }
 
+// handleGetTxOutSetInfo implements the gettxoutsetinfo command.
+func handleGetTxOutSetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetTxOutSetInfoCmd)
+
+	hashType := blockchain.UtxoSetHashSerialized
+	if c.HashType != nil {
+		switch *c.HashType {
+		case "hash_serialized_3":
+		case "muhash":
+			hashType = blockchain.UtxoSetHashMuHash
+		case "none":
+			hashType = blockchain.UtxoSetHashNone
+		default:
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("'%s' is not a valid hash_type",
+					*c.HashType),
+			}
+		}
+	}
+
+	// The statistics are computed by reading the entire utxo set unless
+	// they are maintained incrementally, which does not apply to the
+	// serialized hash.
+	stats, err := s.cfg.Chain.UtxoSetStats(hashType, closeChan)
+	if err != nil {
+		context := "Failed to compute the UTXO set statistics"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	result := &btcjson.GetTxOutSetInfoResult{
+		Height:       stats.Height,
+		BestBlock:    stats.Hash.String(),
+		Transactions: int64(stats.Transactions),
+		TxOuts:       int64(stats.TxOuts),
+		BogoSize:     int64(stats.BogoSize),
+		TotalAmount:  btcutil.Amount(stats.TotalAmount).ToBTC(),
+	}
+	switch hashType {
+	case blockchain.UtxoSetHashSerialized:
+		result.HashSerialized = stats.Digest.String()
+	case blockchain.UtxoSetHashMuHash:
+		result.MuHash = stats.Digest.String()
+	}
+	return result, nil
+}
+
+// handleGetTxSpendingPrevOut implements the gettxspendingprevout command.
+func handleGetTxSpendingPrevOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetTxSpendingPrevOutCmd)
+	if len(c.Outputs) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid parameter, outputs are missing",
+		}
+	}
+
+	// Look up the spends of the outputs in the memory pool first and in
+	// the main chain when the spent output index is enabled.
+	results := make([]btcjson.GetTxSpendingPrevOutResult, 0, len(c.Outputs))
+	for _, output := range c.Outputs {
+		txHash, err := chainhash.NewHashFromStr(output.Txid)
+		if err != nil {
+			return nil, rpcDecodeHexError(output.Txid)
+		}
+		result := btcjson.GetTxSpendingPrevOutResult{
+			Txid: output.Txid,
+			Vout: output.Vout,
+		}
+
+		outpoint := wire.OutPoint{Hash: *txHash, Index: output.Vout}
+		if tx := s.cfg.TxMemPool.CheckSpend(outpoint); tx != nil {
+			result.SpendingTxid = tx.Hash().String()
+		} else if s.cfg.SpendIndex != nil {
+			entry, err := s.cfg.SpendIndex.SpendingTx(&outpoint)
+			if err != nil {
+				context := "Failed to look up spending transaction"
+				return nil, internalRPCError(err.Error(), context)
+			}
+			if entry != nil {
+				result.SpendingTxid = entry.TxHash.String()
+				result.SpendingHeight = entry.Height
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
 // handleHelp implements the help command.
 func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.HelpCmd)
@@ -2801,6 +4532,30 @@ func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return help, nil
 }
 
+// handleInvalidateBlock implements the invalidateblock command.
+func handleInvalidateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.InvalidateBlockCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if _, err := s.cfg.Chain.HeaderByHash(hash); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	if err := s.cfg.Chain.InvalidateBlock(hash); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Failed to invalidate block: " + err.Error(),
+		}
+	}
+	return nil, nil
+}
+
 // handlePing implements the ping command.
 func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Ask server to ping \o_
@@ -2814,6 +4569,49 @@ func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return nil, nil
 }
 
+// handlePrioritiseTransaction implements the prioritisetransaction command.
+func handlePrioritiseTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.PrioritiseTransactionCmd)
+
+	txHash, err := chainhash.NewHashFromStr(c.Txid)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Txid)
+	}
+	if c.Dummy != 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Priority is no longer supported, dummy argument must be zero or null",
+		}
+	}
+
+	s.cfg.TxMemPool.PrioritiseTransaction(txHash, c.FeeDelta)
+	return true, nil
+}
+
+// handleReconsiderBlock implements the reconsiderblock command.
+func handleReconsiderBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ReconsiderBlockCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if _, err := s.cfg.Chain.HeaderByHash(hash); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+
+	if err := s.cfg.Chain.ReconsiderBlock(hash); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Failed to reconsider block: " + err.Error(),
+		}
+	}
+	return nil, nil
+}
+
 // retrievedTx represents a transaction that was either loaded from the
 // transaction memory pool or from the database.  When a transaction is loaded
 // from the database, it is loaded with the raw serialized bytes while the
@@ -3035,6 +4833,148 @@ func fetchMempoolTxnsForAddress(s *rpcServer, addr btcutil.Address, numToSkip, n
 	return mpTxns[numToSkip:rangeEnd], numToSkip
 }
 
+// handlePromoteStandby implements the promotestandby command.
+func handlePromoteStandby(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if s.cfg.Standby == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: errNotStandby.Error(),
+		}
+	}
+	if err := s.cfg.Standby.Promote("promotestandby RPC"); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+// handleScanTxOutSet implements the scantxoutset command.
+func handleScanTxOutSet(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ScanTxOutSetCmd)
+
+	switch c.Action {
+	case "status":
+		progress, ok := s.txOutSetScan.progress()
+		if !ok {
+			return nil, nil
+		}
+		return &btcjson.ScanTxOutSetStatusResult{Progress: progress}, nil
+
+	case "abort":
+		return s.txOutSetScan.abort(), nil
+
+	case "start":
+
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid action '%s'", c.Action),
+		}
+	}
+	if c.ScanObjects == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "scanobjects argument is required for the start action",
+		}
+	}
+
+	// Expand the descriptors to the scripts to scan for.
+	descs := make(map[string]string)
+	for _, obj := range *c.ScanObjects {
+		rng := [2]uint32{0, defaultScanRangeEnd}
+		if obj.Range != nil {
+			rng = *obj.Range
+			if rng[0] > rng[1] || rng[1] >= hdkeychain.HardenedKeyStart ||
+				rng[1]-rng[0] >= maxScanRangeSize {
+
+				return nil, &btcjson.RPCError{
+					Code: btcjson.ErrRPCInvalidParameter,
+					Message: fmt.Sprintf("Invalid range of "+
+						"descriptor %s", obj.Desc),
+				}
+			}
+		}
+		scripts, err := expandDescriptor(obj.Desc, rng,
+			s.cfg.ChainParams)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: err.Error(),
+			}
+		}
+		for _, script := range scripts {
+			descs[string(script.pkScript)] = script.desc
+		}
+	}
+
+	abortChan, ok := s.txOutSetScan.start()
+	if !ok {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: "Scan already in progress, use action " +
+				"\"abort\" or \"status\"",
+		}
+	}
+	defer s.txOutSetScan.finish()
+
+	// The scan is aborted as well when the request is.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-closeChan:
+			s.txOutSetScan.abort()
+		case <-done:
+		}
+	}()
+
+	result := &btcjson.ScanTxOutSetResult{
+		Success:  true,
+		Unspents: []btcjson.ScanTxOutSetUnspent{},
+	}
+	var totalAmount int64
+	hash, height, err := s.cfg.Chain.ScanUtxoSet(
+		func(outpoint *wire.OutPoint, entry *blockchain.UtxoEntry) error {
+			result.TxOuts++
+			s.txOutSetScan.setPosition(outpoint)
+
+			desc, ok := descs[string(entry.PkScript())]
+			if !ok {
+				return nil
+			}
+			totalAmount += entry.Amount()
+			result.Unspents = append(result.Unspents,
+				btcjson.ScanTxOutSetUnspent{
+					TxID:         outpoint.Hash.String(),
+					Vout:         outpoint.Index,
+					ScriptPubKey: hex.EncodeToString(entry.PkScript()),
+					Desc:         desc,
+					Amount:       btcutil.Amount(entry.Amount()).ToBTC(),
+					Coinbase:     entry.IsCoinBase(),
+					Height:       entry.BlockHeight(),
+				})
+			return nil
+		}, abortChan)
+	if err != nil {
+		select {
+		case <-abortChan:
+			result.Success = false
+		default:
+		}
+		if result.Success || hash == nil {
+			context := "Failed to scan the UTXO set"
+			return nil, internalRPCError(err.Error(), context)
+		}
+	}
+
+	result.Height = height
+	result.BestBlock = hash.String()
+	result.TotalAmount = btcutil.Amount(totalAmount).ToBTC()
+	return result, nil
+}
+
 // handleSearchRawTransactions implements the searchrawtransactions command.
 func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if the address index is not enabled.
@@ -3299,8 +5239,43 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 	return srtList, nil
 }
 
+// txRuleRPCError maps the passed mempool rule error to the appropriate RPC
+// error, matching bitcoind's behavior.
+func txRuleRPCError(ruleErr mempool.RuleError) *btcjson.RPCError {
+	code := btcjson.ErrRPCTxError
+	if txRuleErr, ok := ruleErr.Err.(mempool.TxRuleError); ok {
+		errDesc := txRuleErr.Description
+		switch {
+		case strings.Contains(
+			strings.ToLower(errDesc), "orphan transaction",
+		):
+			code = btcjson.ErrRPCTxError
+
+		case strings.Contains(
+			strings.ToLower(errDesc), "transaction already exists",
+		):
+			code = btcjson.ErrRPCTxAlreadyInChain
+
+		default:
+			code = btcjson.ErrRPCTxRejected
+		}
+	}
+
+	return &btcjson.RPCError{
+		Code:    code,
+		Message: "TX rejected: " + ruleErr.Error(),
+	}
+}
+
 // handleSendRawTransaction implements the sendrawtransaction command.
 func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return handleSendRawTransactionCorrelated(s, cmd, "", closeChan)
+}
+
+// handleSendRawTransactionCorrelated implements the sendrawtransaction command
+// while propagating the correlation id supplied by the client through mempool
+// acceptance and relay.
+func handleSendRawTransactionCorrelated(s *rpcServer, cmd interface{}, correlationID string, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.SendRawTransactionCmd)
 	// Deserialize and send off to tx relay
 	hexStr := c.HexTx
@@ -3322,7 +5297,8 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 
 	// Use 0 for the tag to represent local node.
 	tx := btcutil.NewTx(&msgTx)
-	acceptedTxs, err := s.cfg.TxMemPool.ProcessTransaction(tx, false, false, 0)
+	acceptedTxs, err := s.cfg.TxMemPool.ProcessCorrelatedTransaction(tx,
+		false, false, 0, correlationID)
 	if err != nil {
 		// When the error is a rule error, it means the transaction was
 		// simply rejected as opposed to something actually going wrong,
@@ -3330,8 +5306,8 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 		// so log it as an actual error and return.
 		ruleErr, ok := err.(mempool.RuleError)
 		if !ok {
-			rpcsLog.Errorf("Failed to process transaction %v: %v",
-				tx.Hash(), err)
+			rpcsLog.Errorf("Failed to process transaction %v%s: %v",
+				tx.Hash(), correlationSuffix(correlationID), err)
 
 			return nil, &btcjson.RPCError{
 				Code:    btcjson.ErrRPCTxError,
@@ -3339,33 +5315,10 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 			}
 		}
 
-		rpcsLog.Debugf("Rejected transaction %v: %v", tx.Hash(), err)
-
-		// We'll then map the rule error to the appropriate RPC error,
-		// matching bitcoind's behavior.
-		code := btcjson.ErrRPCTxError
-		if txRuleErr, ok := ruleErr.Err.(mempool.TxRuleError); ok {
-			errDesc := txRuleErr.Description
-			switch {
-			case strings.Contains(
-				strings.ToLower(errDesc), "orphan transaction",
-			):
-				code = btcjson.ErrRPCTxError
+		rpcsLog.Debugf("Rejected transaction %v%s: %v", tx.Hash(),
+			correlationSuffix(correlationID), err)
 
-			case strings.Contains(
-				strings.ToLower(errDesc), "transaction already exists",
-			):
-				code = btcjson.ErrRPCTxAlreadyInChain
-
-			default:
-				code = btcjson.ErrRPCTxRejected
-			}
-		}
-
-		return nil, &btcjson.RPCError{
-			Code:    code,
-			Message: "TX rejected: " + err.Error(),
-		}
+		return nil, txRuleRPCError(ruleErr)
 	}
 
 	// When the transaction was accepted it should be the first item in the
@@ -3376,29 +5329,167 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 	// Also, since an error is being returned to the caller, ensure the
 	// transaction is removed from the memory pool.
 	if len(acceptedTxs) == 0 || !acceptedTxs[0].Tx.Hash().IsEqual(tx.Hash()) {
-		s.cfg.TxMemPool.RemoveTransaction(tx, true)
+		s.cfg.TxMemPool.RemoveTransaction(tx, true,
+			mempool.RemovalReasonRejected)
 
 		errStr := fmt.Sprintf("transaction %v is not in accepted list",
 			tx.Hash())
 		return nil, internalRPCError(errStr, "")
 	}
 
-	// Generate and relay inventory vectors for all newly accepted
-	// transactions into the memory pool due to the original being
-	// accepted.
-	s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
+	// Generate and relay inventory vectors for all newly accepted
+	// transactions into the memory pool due to the original being
+	// accepted.
+	s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
+
+	// Notify both websocket and getblocktemplate long poll clients of all
+	// newly accepted transactions.
+	s.NotifyNewTransactions(acceptedTxs)
+
+	// Keep track of all the sendrawtransaction request txns so that they
+	// can be rebroadcast until a peer requests them.
+	txD := acceptedTxs[0]
+	iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
+	s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
+
+	return tx.Hash().String(), nil
+}
+
+// handleSubmitPackage implements the submitpackage command.
+func handleSubmitPackage(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SubmitPackageCmd)
+	if len(c.RawTxs) == 0 || len(c.RawTxs) > mempool.MaxPackageCount {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Array must contain between 1 and "+
+				"%d transactions", mempool.MaxPackageCount),
+		}
+	}
+
+	// Deserialize the transactions of the package.
+	txns := make([]*btcutil.Tx, 0, len(c.RawTxs))
+	for _, hexStr := range c.RawTxs {
+		if len(hexStr)%2 != 0 {
+			hexStr = "0" + hexStr
+		}
+		serializedTx, err := hex.DecodeString(hexStr)
+		if err != nil {
+			return nil, rpcDecodeHexError(hexStr)
+		}
+		var msgTx wire.MsgTx
+		err = msgTx.Deserialize(bytes.NewReader(serializedTx))
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCDeserialization,
+				Message: "TX decode failed: " + err.Error(),
+			}
+		}
+		txns = append(txns, btcutil.NewTx(&msgTx))
+	}
+
+	child := txns[len(txns)-1]
+	acceptedTxs, err := s.cfg.TxMemPool.ProcessPackage(txns)
+	if err != nil {
+		// When the error is a rule error, it means the package was
+		// simply rejected as opposed to something actually going wrong,
+		// so log it as such.
+		ruleErr, ok := err.(mempool.RuleError)
+		if !ok {
+			rpcsLog.Errorf("Failed to process package with child "+
+				"%v: %v", child.Hash(), err)
+
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCTxError,
+				Message: "TX rejected: " + err.Error(),
+			}
+		}
+
+		rpcsLog.Debugf("Rejected package with child %v: %v",
+			child.Hash(), err)
+
+		return nil, txRuleRPCError(ruleErr)
+	}
+
+	// Generate and relay inventory vectors for all newly accepted
+	// transactions and notify both websocket and getblocktemplate long poll
+	// clients of them.
+	s.cfg.ConnMgr.RelayTransactions(acceptedTxs)
+	s.NotifyNewTransactions(acceptedTxs)
+
+	accepted := make(map[chainhash.Hash]*mempool.TxDesc, len(acceptedTxs))
+	for _, txD := range acceptedTxs {
+		accepted[*txD.Tx.Hash()] = txD
+	}
+
+	result := &btcjson.SubmitPackageResult{
+		PackageMsg: "success",
+		TxResults:  make(map[string]btcjson.SubmitPackageTxResult, len(txns)),
+	}
+	for _, tx := range txns {
+		txResult := btcjson.SubmitPackageTxResult{
+			TxID:  tx.Hash().String(),
+			VSize: mempool.GetTxVirtualSize(tx),
+		}
+		if txD, ok := accepted[*tx.Hash()]; ok {
+			fee := btcutil.Amount(txD.Fee).ToBTC()
+			txResult.Fee = &fee
+
+			// Keep track of the newly accepted transactions so
+			// they can be rebroadcast until a peer requests
+			// them.
+			iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
+			s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
+		}
+		result.TxResults[tx.WitnessHash().String()] = txResult
+	}
+
+	return result, nil
+}
+
+// handleSetScriptWorkers implements the setscriptworkers command.
+func handleSetScriptWorkers(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SetScriptWorkersCmd)
+	if c.Workers < 1 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "The number of workers must be at least 1",
+		}
+	}
 
-	// Notify both websocket and getblocktemplate long poll clients of all
-	// newly accepted transactions.
-	s.NotifyNewTransactions(acceptedTxs)
+	err := s.cfg.Chain.SetScriptValidationWorkers(c.Workers)
+	if err != nil {
+		return nil, internalRPCError(err.Error(),
+			"Failed to set the script validation workers")
+	}
+	return nil, nil
+}
 
-	// Keep track of all the sendrawtransaction request txns so that they
-	// can be rebroadcast if they don't make their way into a block.
-	txD := acceptedTxs[0]
-	iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
-	s.cfg.ConnMgr.AddRebroadcastInventory(iv, txD)
+// handleSetRPCRole implements the setrpcrole command.
+func handleSetRPCRole(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SetRPCRoleCmd)
+	persist := c.Persist != nil && *c.Persist
+	if persist && cfg.RPCRoleFile == "" {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCMisc,
+			Message: "A role file must be configured to persist " +
+				"roles (--rpcrolefile)",
+		}
+	}
 
-	return tx.Hash().String(), nil
+	role := rpcRoleConfig{
+		Name:    c.Role,
+		Methods: c.Methods,
+	}
+	if c.RateLimit != nil {
+		role.RateLimit = *c.RateLimit
+	}
+	if err := s.roles.setRole(role, persist); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
 }
 
 // handleSetGenerate implements the setgenerate command.
@@ -3479,6 +5570,82 @@ func handleSubmitBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return nil, nil
 }
 
+// handleTestMempoolAccept implements the testmempoolaccept command.
+func handleTestMempoolAccept(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.TestMempoolAcceptCmd)
+	if len(c.RawTxs) != 1 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Array must contain exactly one transaction",
+		}
+	}
+	maxFeeRate, err := btcutil.NewAmount(*c.MaxFeeRate)
+	if err != nil || maxFeeRate < 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid maxfeerate",
+		}
+	}
+
+	hexStr := c.RawTxs[0]
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	serializedTx, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+	var msgTx wire.MsgTx
+	err = msgTx.Deserialize(bytes.NewReader(serializedTx))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "TX decode failed: " + err.Error(),
+		}
+	}
+
+	tx := btcutil.NewTx(&msgTx)
+	checkResult, err := s.cfg.TxMemPool.CheckTransaction(tx)
+	if err != nil {
+		context := fmt.Sprintf("Failed to check transaction %v",
+			tx.Hash())
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	result := btcjson.TestMempoolAcceptResult{
+		Txid:         tx.Hash().String(),
+		Wtxid:        tx.WitnessHash().String(),
+		Allowed:      checkResult.Allowed,
+		RejectReason: checkResult.RejectReason,
+	}
+	if !checkResult.Allowed {
+		return []btcjson.TestMempoolAcceptResult{result}, nil
+	}
+
+	// Reject transactions paying a fee rate above the max fee rate, which
+	// usually means the fee was miscalculated.
+	feeRate := checkResult.Fee * 1000 / checkResult.VSize
+	if maxFeeRate > 0 && feeRate > int64(maxFeeRate) {
+		result.Allowed = false
+		result.RejectReason = "max-fee-exceeded"
+		return []btcjson.TestMempoolAcceptResult{result}, nil
+	}
+
+	result.VSize = checkResult.VSize
+	result.Fees = &btcjson.TestMempoolAcceptFees{
+		Base: btcutil.Amount(checkResult.Fee).ToBTC(),
+	}
+	result.SigOpCost = int64(checkResult.SigOpCost)
+	if len(checkResult.Replaced) > 0 {
+		result.Replaced = make([]string, 0, len(checkResult.Replaced))
+		for _, hash := range checkResult.Replaced {
+			result.Replaced = append(result.Replaced, hash.String())
+		}
+	}
+
+	return []btcjson.TestMempoolAcceptResult{result}, nil
+}
+
 // handleUptime implements the uptime command.
 func handleUptime(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return time.Now().Unix() - s.cfg.StartupTime, nil
@@ -3501,6 +5668,58 @@ func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struc
 	return result, nil
 }
 
+// handleValidateBlock implements the validateblock command.
+func handleValidateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ValidateBlockCmd)
+
+	// Deserialize the block.
+	hexStr := c.HexBlock
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + c.HexBlock
+	}
+	serializedBlock, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+	block, err := btcutil.NewBlockFromBytes(serializedBlock)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "Block decode failed: " + err.Error(),
+		}
+	}
+
+	// Fully validate connecting the block to the tip of the main chain
+	// without storing or relaying it.
+	flags := blockchain.BFNone
+	if c.CheckPoW != nil && !*c.CheckPoW {
+		flags |= blockchain.BFNoPoWCheck
+	}
+	result := &btcjson.ValidateBlockResult{
+		Hash:  block.Hash().String(),
+		Valid: true,
+	}
+	err = s.cfg.Chain.CheckConnectBlock(block, flags)
+	if err != nil {
+		ruleErr, ok := err.(blockchain.RuleError)
+		if !ok {
+			errStr := fmt.Sprintf("Failed to validate block: %v", err)
+			rpcsLog.Error(errStr)
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCVerify,
+				Message: errStr,
+			}
+		}
+
+		result.Valid = false
+		result.RejectReason = chainErrToGBTErrString(err)
+		result.Rule = ruleErr.ErrorCode.String()
+		result.Message = ruleErr.Description
+	}
+
+	return result, nil
+}
+
 func verifyChain(s *rpcServer, level, depth int32) error {
 	best := s.cfg.Chain.BestSnapshot()
 	finishHeight := best.Height - depth
@@ -3635,8 +5854,9 @@ type rpcServer struct {
 	started                int32
 	shutdown               int32
 	cfg                    rpcserverConfig
-	authsha                [sha256.Size]byte
-	limitauthsha           [sha256.Size]byte
+	roles                  *rpcRoles
+	cookieFile             string
+	authorizer             *rpcAuthorizer
 	ntfnMgr                *wsNotificationManager
 	numClients             int32
 	statusLines            map[int]string
@@ -3645,6 +5865,7 @@ type rpcServer struct {
 	gbtWorkState           *gbtWorkState
 	helpCacher             *helpCacher
 	requestProcessShutdown chan struct{}
+	txOutSetScan           txOutSetScan
 	quit                   chan int
 }
 
@@ -3721,6 +5942,9 @@ func (s *rpcServer) Stop() error {
 	s.ntfnMgr.WaitForShutdown()
 	close(s.quit)
 	s.wg.Wait()
+	if s.cookieFile != "" {
+		removeRPCCookie(s.cookieFile)
+	}
 	rpcsLog.Infof("RPC server shutdown complete")
 	return nil
 }
@@ -3746,6 +5970,12 @@ func (s *rpcServer) NotifyNewTransactions(txns []*mempool.TxDesc) {
 	}
 }
 
+// NotifyTxReplaced notifies websocket clients of the passed replacement of
+// transactions in the mempool.
+func (s *rpcServer) NotifyTxReplaced(r *mempool.TxReplacement) {
+	s.ntfnMgr.NotifyTxReplaced(r)
+}
+
 // limitConnections responds with a 503 service unavailable and returns true if
 // adding another client would exceed the maximum allow RPC clients.
 //
@@ -3782,55 +6012,43 @@ func (s *rpcServer) decrementClients() {
 
 // checkAuth checks the HTTP Basic authentication supplied by a wallet
 // or RPC client in the HTTP request r.  If the supplied authentication
-// does not match the username and password expected, a non-nil error is
+// does not match the credentials of any user, a non-nil error is
 // returned.
 //
-// This check is time-constant.
-//
-// The first bool return value signifies auth success (true if successful) and
-// the second bool return value specifies whether the user can change the state
-// of the server (true) or whether the user is limited (false). The second is
-// always false if the first is.
-func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, bool, error) {
+// The bool return value signifies auth success (true if successful) and the
+// key identifies the credentials, whose role determines the methods the client
+// may call.
+func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, [sha256.Size]byte, error) {
 	authhdr := r.Header["Authorization"]
 	if len(authhdr) <= 0 {
 		if require {
 			rpcsLog.Warnf("RPC authentication failure from %s",
 				r.RemoteAddr)
-			return false, false, errors.New("auth failure")
+			return false, [sha256.Size]byte{}, errors.New("auth failure")
 		}
 
-		return false, false, nil
-	}
-
-	authsha := sha256.Sum256([]byte(authhdr[0]))
-
-	// Check for limited auth first as in environments with limited users, those
-	// are probably expected to have a higher volume of calls
-	limitcmp := subtle.ConstantTimeCompare(authsha[:], s.limitauthsha[:])
-	if limitcmp == 1 {
-		return true, false, nil
+		return false, [sha256.Size]byte{}, nil
 	}
 
-	// Check for admin-level auth
-	cmp := subtle.ConstantTimeCompare(authsha[:], s.authsha[:])
-	if cmp == 1 {
-		return true, true, nil
+	authKey := rpcAuthKey(authhdr[0])
+	if s.roles.authenticate(authKey) {
+		return true, authKey, nil
 	}
 
-	// Request's auth doesn't match either user
+	// Request's auth doesn't match any user
 	rpcsLog.Warnf("RPC authentication failure from %s", r.RemoteAddr)
-	return false, false, errors.New("auth failure")
+	return false, [sha256.Size]byte{}, errors.New("auth failure")
 }
 
 // parsedRPCCmd represents a JSON-RPC request object that has been parsed into
 // a known concrete command along with any error that might have happened while
 // parsing it.
 type parsedRPCCmd struct {
-	id     interface{}
-	method string
-	cmd    interface{}
-	err    *btcjson.RPCError
+	id            interface{}
+	method        string
+	cmd           interface{}
+	correlationID string
+	err           *btcjson.RPCError
 }
 
 // standardCmdResult checks that a parsed command is a standard Bitcoin JSON-RPC
@@ -3838,6 +6056,25 @@ type parsedRPCCmd struct {
 // commands which are not recognized or not implemented will return an error
 // suitable for use in replies.
 func (s *rpcServer) standardCmdResult(cmd *parsedRPCCmd, closeChan <-chan struct{}) (interface{}, error) {
+	// Only a restricted set of commands are serviced until a hot standby
+	// has been promoted.
+	if s.cfg.Standby.IsStandby() {
+		if _, ok := rpcStandbyAllowed[cmd.method]; !ok {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCMisc,
+				Message: "node is in standby mode",
+			}
+		}
+	}
+
+	if cmd.correlationID != "" {
+		rpcsLog.Debugf("Processing command <%s>%s", cmd.method,
+			correlationSuffix(cmd.correlationID))
+	}
+	if handler, ok := rpcCorrelatedHandlers[cmd.method]; ok {
+		return handler(s, cmd.cmd, cmd.correlationID, closeChan)
+	}
+
 	handler, ok := rpcHandlers[cmd.method]
 	if ok {
 		goto handled
@@ -3867,6 +6104,14 @@ func parseCmd(request *btcjson.Request) *parsedRPCCmd {
 	parsedCmd.id = request.ID
 	parsedCmd.method = request.Method
 
+	// Reject correlation ids which could be used to forge log entries.
+	if err := validateCorrelationID(request.CorrelationID); err != nil {
+		parsedCmd.err = btcjson.NewRPCError(
+			btcjson.ErrRPCInvalidRequest.Code, err.Error())
+		return &parsedCmd
+	}
+	parsedCmd.correlationID = request.CorrelationID
+
 	cmd, err := btcjson.UnmarshalCmd(request)
 	if err != nil {
 		// When the error is because the method is not registered,
@@ -3905,53 +6150,19 @@ func createMarshalledReply(id, result interface{}, replyErr error) ([]byte, erro
 	return btcjson.MarshalResponse(id, result, jsonErr)
 }
 
-// jsonRPCRead handles reading and responding to RPC messages.
-func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin bool) {
-	if atomic.LoadInt32(&s.shutdown) != 0 {
-		return
-	}
-
-	// Read and close the JSON-RPC request body from the caller.
-	body, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		errCode := http.StatusBadRequest
-		http.Error(w, fmt.Sprintf("%d error reading JSON message: %v",
-			errCode, err), errCode)
-		return
-	}
-
-	// Unfortunately, the http server doesn't provide the ability to
-	// change the read deadline for the new connection and having one breaks
-	// long polling.  However, not having a read deadline on the initial
-	// connection would mean clients can connect and idle forever.  Thus,
-	// hijack the connecton from the HTTP server, clear the read deadline,
-	// and handle writing the response manually.
-	hj, ok := w.(http.Hijacker)
-	if !ok {
-		errMsg := "webserver doesn't support hijacking"
-		rpcsLog.Warnf(errMsg)
-		errCode := http.StatusInternalServerError
-		http.Error(w, strconv.Itoa(errCode)+" "+errMsg, errCode)
-		return
-	}
-	conn, buf, err := hj.Hijack()
-	if err != nil {
-		rpcsLog.Warnf("Failed to hijack HTTP connection: %v", err)
-		errCode := http.StatusInternalServerError
-		http.Error(w, strconv.Itoa(errCode)+" "+err.Error(), errCode)
-		return
-	}
-	defer conn.Close()
-	defer buf.Flush()
-	conn.SetReadDeadline(timeZeroVal)
+// processRequest parses, authorizes, and executes the JSON-RPC request in the
+// passed message on behalf of the credentials identified by the passed key.  It
+// returns the marshalled reply along with the correlation id of the request,
+// which falls back to the passed one.  No reply is returned for notifications.
+func (s *rpcServer) processRequest(msg []byte, authKey [sha256.Size]byte,
+	correlationID string, closeChan <-chan struct{}) ([]byte, string) {
 
-	// Attempt to parse the raw body into a JSON-RPC request.
+	// Attempt to parse the raw message into a JSON-RPC request.
 	var responseID interface{}
 	var jsonErr error
 	var result interface{}
 	var request btcjson.Request
-	if err := json.Unmarshal(body, &request); err != nil {
+	if err := json.Unmarshal(msg, &request); err != nil {
 		jsonErr = &btcjson.RPCError{
 			Code:    btcjson.ErrRPCParse.Code,
 			Message: "Failed to parse request: " + err.Error(),
@@ -3977,30 +6188,28 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 		// RPC quirks can be enabled by the user to avoid compatibility issues
 		// with software relying on Core's behavior.
 		if request.ID == nil && !(cfg.RPCQuirks && request.Jsonrpc == "") {
-			return
+			return nil, ""
 		}
 
 		// The parse was at least successful enough to have an ID so
 		// set it for the response.
 		responseID = request.ID
 
-		// Setup a close notifier.  Since the connection is hijacked,
-		// the CloseNotifer on the ResponseWriter is not available.
-		closeChan := make(chan struct{}, 1)
-		go func() {
-			_, err := conn.Read(make([]byte, 1))
-			if err != nil {
-				close(closeChan)
-			}
-		}()
-
-		// Check if the user is limited and set error if method unauthorized
-		if !isAdmin {
-			if _, ok := rpcLimited[request.Method]; !ok {
-				jsonErr = &btcjson.RPCError{
-					Code:    btcjson.ErrRPCInvalidParams.Code,
-					Message: "limited user not authorized for this method",
-				}
+		if request.CorrelationID == "" {
+			request.CorrelationID = correlationID
+		}
+
+		// Check if the role of the user allows the method and set
+		// error if method unauthorized or the rate limit is exceeded
+		if err := s.roles.authorize(authKey, request.Method); err != nil {
+			jsonErr = rpcRoleError(err)
+		}
+
+		// Require the destructive methods to be authorized by the
+		// admin keys when threshold authorization is enabled.
+		if jsonErr == nil && s.authorizer != nil {
+			if err := s.authorizer.authorize(&request); err != nil {
+				jsonErr = err
 			}
 		}
 
@@ -4017,12 +6226,106 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 	}
 
 	// Marshal the response.
-	msg, err := createMarshalledReply(responseID, result, jsonErr)
+	reply, err := createMarshalledReply(responseID, result, jsonErr)
 	if err != nil {
 		rpcsLog.Errorf("Failed to marshal reply: %v", err)
+		return nil, ""
+	}
+	return reply, request.CorrelationID
+}
+
+// jsonRPCRead handles reading and responding to RPC messages.
+func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, authKey [sha256.Size]byte) {
+	if atomic.LoadInt32(&s.shutdown) != 0 {
+		return
+	}
+
+	// Read and close the JSON-RPC request body from the caller.
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		errCode := http.StatusBadRequest
+		http.Error(w, fmt.Sprintf("%d error reading JSON message: %v",
+			errCode, err), errCode)
+		return
+	}
+
+	// Unfortunately, the http server doesn't provide the ability to
+	// change the read deadline for the new connection and having one breaks
+	// long polling.  However, not having a read deadline on the initial
+	// connection would mean clients can connect and idle forever.  Thus,
+	// hijack the connecton from the HTTP server, clear the read deadline,
+	// and handle writing the response manually.
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		errMsg := "webserver doesn't support hijacking"
+		rpcsLog.Warnf(errMsg)
+		errCode := http.StatusInternalServerError
+		http.Error(w, strconv.Itoa(errCode)+" "+errMsg, errCode)
+		return
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		rpcsLog.Warnf("Failed to hijack HTTP connection: %v", err)
+		errCode := http.StatusInternalServerError
+		http.Error(w, strconv.Itoa(errCode)+" "+err.Error(), errCode)
+		return
+	}
+	defer conn.Close()
+	defer buf.Flush()
+	conn.SetReadDeadline(timeZeroVal)
+
+	// Setup a close notifier.  Since the connection is hijacked, the
+	// CloseNotifer on the ResponseWriter is not available.
+	closeChan := make(chan struct{}, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		if err != nil {
+			close(closeChan)
+		}
+	}()
+
+	// Requests which do not specify a correlation id fall back to the one
+	// of the HTTP headers.
+	headerCorrelationID := r.Header.Get(correlationIDHeader)
+
+	// Process the request, or every request of a batch, which is a JSON
+	// array of requests whose replies are returned in an array in the same
+	// order.
+	var msg []byte
+	var correlationID string
+	if isRPCBatch(body) {
+		requests, jsonErr := parseRPCBatch(body)
+		if jsonErr != nil {
+			msg, err = createMarshalledReply(nil, nil, jsonErr)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal reply: %v", err)
+				return
+			}
+		} else {
+			msg = runRPCBatch(requests, cfg.RPCBatchParallelism,
+				func(request json.RawMessage) []byte {
+					reply, _ := s.processRequest(request,
+						authKey, headerCorrelationID,
+						closeChan)
+					return reply
+				})
+		}
+	} else {
+		msg, correlationID = s.processRequest(body, authKey,
+			headerCorrelationID, closeChan)
+	}
+
+	// No response is due to notifications.
+	if msg == nil {
 		return
 	}
 
+	// Echo the correlation id so the client can match the response.
+	if correlationID != "" && validateCorrelationID(correlationID) == nil {
+		w.Header().Set(correlationIDHeader, correlationID)
+	}
+
 	// Write the response.
 	err = s.writeHTTPResponseHeaders(r, w.Header(), http.StatusOK, buf)
 	if err != nil {
@@ -4073,19 +6376,19 @@ func (s *rpcServer) Start() {
 		// Keep track of the number of connected clients.
 		s.incrementClients()
 		defer s.decrementClients()
-		_, isAdmin, err := s.checkAuth(r, true)
+		_, authKey, err := s.checkAuth(r, true)
 		if err != nil {
 			jsonAuthFail(w)
 			return
 		}
 
 		// Read and respond to the request.
-		s.jsonRPCRead(w, r, isAdmin)
+		s.jsonRPCRead(w, r, authKey)
 	})
 
 	// Websocket endpoint.
 	rpcServeMux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		authenticated, isAdmin, err := s.checkAuth(r, false)
+		authenticated, authKey, err := s.checkAuth(r, false)
 		if err != nil {
 			jsonAuthFail(w)
 			return
@@ -4102,9 +6405,27 @@ func (s *rpcServer) Start() {
 			http.Error(w, "400 Bad Request.", http.StatusBadRequest)
 			return
 		}
-		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin)
+		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, authKey)
 	})
 
+	// REST endpoint, which does not require authentication.
+	if cfg.REST {
+		rpcServeMux.HandleFunc("/rest/", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Connection", "close")
+			r.Close = true
+
+			// Limit the number of connections to max allowed.
+			if s.limitConnections(w, r.RemoteAddr) {
+				return
+			}
+
+			// Keep track of the number of connected clients.
+			s.incrementClients()
+			defer s.decrementClients()
+			s.handleREST(w, r)
+		})
+	}
+
 	for _, listener := range s.cfg.Listeners {
 		s.wg.Add(1)
 		go func(listener net.Listener) {
@@ -4215,8 +6536,8 @@ type rpcserverConnManager interface {
 	BroadcastMessage(msg wire.Message)
 
 	// AddRebroadcastInventory adds the provided inventory to the list of
-	// inventories to be rebroadcast at random intervals until they show up
-	// in a block.
+	// inventories to be rebroadcast at random intervals until a peer
+	// requests them.
 	AddRebroadcastInventory(iv *wire.InvVect, data interface{})
 
 	// RelayTransactions generates and relays inventory vectors for all of
@@ -4244,11 +6565,19 @@ type rpcserverSyncManager interface {
 	// used to sync from or 0 if there is none.
 	SyncPeerID() int32
 
+	// SyncProgress returns the latest progress of the synchronization of
+	// the chain with the network or nil when none is available yet.
+	SyncProgress() *netsync.SyncProgress
+
 	// LocateHeaders returns the headers of the blocks after the first known
 	// block in the provided locators until the provided stop hash or the
 	// current tip is reached, up to a max of wire.MaxBlockHeadersPerMsg
 	// hashes.
 	LocateHeaders(locators []*chainhash.Hash, hashStop *chainhash.Hash) []wire.BlockHeader
+
+	// RequestBlock requests the block with the passed hash from the peer
+	// even though it was not announced by the peer.
+	RequestBlock(hash *chainhash.Hash, peer *peer.Peer) error
 }
 
 // rpcserverConfig is a descriptor containing the RPC server configuration.
@@ -4274,7 +6603,7 @@ type rpcserverConfig struct {
 
 	// These fields allow the RPC server to interface with the local block
 	// chain data and state.
-	TimeSource  blockchain.MedianTimeSource
+	TimeSource  *blockchain.TimeManager
 	Chain       *blockchain.BlockChain
 	ChainParams *chaincfg.Params
 	DB          database.DB
@@ -4292,13 +6621,47 @@ type rpcserverConfig struct {
 
 	// These fields define any optional indexes the RPC server can make use
 	// of to provide additional data when queried.
-	TxIndex   *indexers.TxIndex
-	AddrIndex *indexers.AddrIndex
-	CfIndex   *indexers.CfIndex
+	TxIndex    *indexers.TxIndex
+	AddrIndex  *indexers.AddrIndex
+	CfIndex    *indexers.CfIndex
+	SpendIndex *indexers.SpendIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
 	FeeEstimator *mempool.FeeEstimator
+
+	// Standby tracks the hot standby state of the server.  It will be nil
+	// if the server is not configured as a standby.
+	Standby *standbyManager
+
+	// WitnessTelemetry tracks the use of unknown witness and tap leaf
+	// versions.  It will be nil if witness upgrade telemetry is disabled.
+	WitnessTelemetry *witnessTelemetry
+
+	// ForkArchive retains recently seen blocks and headers of stale forks.
+	// It will be nil if the fork archive is disabled.
+	ForkArchive *forkArchive
+
+	// ReorgLog persists the reorganizations of the main chain.
+	ReorgLog *reorgLog
+
+	// Attestor signs attestations of the chain state.  It will be nil if
+	// attestations are disabled.
+	Attestor *attestor
+
+	// TemplateComparer compares the connected blocks with the block
+	// templates of the node.  It will be nil if template comparisons are
+	// disabled.
+	TemplateComparer *templateComparer
+
+	// CheckpointFile is the path of the file checkpoints added via the
+	// addcheckpoint command are persisted to.  It is empty if no checkpoint
+	// file is configured.
+	CheckpointFile string
+
+	// XpubAccounts tracks watch-only xpub accounts.  It will be nil if the
+	// address index is disabled.
+	XpubAccounts *xpubAccountManager
 }
 
 // newRPCServer returns a new instance of the rpcServer struct.
@@ -4311,15 +6674,29 @@ func newRPCServer(config *rpcserverConfig) (*rpcServer, error) {
 		requestProcessShutdown: make(chan struct{}),
 		quit:                   make(chan int),
 	}
-	if cfg.RPCUser != "" && cfg.RPCPass != "" {
-		login := cfg.RPCUser + ":" + cfg.RPCPass
-		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-		rpc.authsha = sha256.Sum256([]byte(auth))
+	builtIns := rpcBuiltInUsers(cfg)
+	if cfg.RPCCookie {
+		cookie, err := writeRPCCookie(cfg.RPCCookieFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to write the RPC "+
+				"authentication cookie: %v", err)
+		}
+		rpcsLog.Infof("Wrote the RPC authentication cookie to %s",
+			cfg.RPCCookieFile)
+		builtIns = append(builtIns, cookie)
+		rpc.cookieFile = cfg.RPCCookieFile
+	}
+	roles, err := newRPCRoles(builtIns, cfg.RPCRoleFile)
+	if err != nil {
+		if rpc.cookieFile != "" {
+			removeRPCCookie(rpc.cookieFile)
+		}
+		return nil, err
 	}
-	if cfg.RPCLimitUser != "" && cfg.RPCLimitPass != "" {
-		login := cfg.RPCLimitUser + ":" + cfg.RPCLimitPass
-		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-		rpc.limitauthsha = sha256.Sum256([]byte(auth))
+	rpc.roles = roles
+	if cfg.RPCAdminThreshold > 0 {
+		rpc.authorizer = newRPCAuthorizer(cfg.rpcAdminKeys,
+			cfg.RPCAdminThreshold)
 	}
 	rpc.ntfnMgr = newWsNotificationManager(&rpc)
 	rpc.cfg.Chain.Subscribe(rpc.handleBlockchainNotification)
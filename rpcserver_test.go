@@ -0,0 +1,105 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/mining"
+)
+
+// TestTemplateTweakLimits ensures the template tweaking fields of
+// getblocktemplate requests only lower the limits of the policy.
+func TestTemplateTweakLimits(t *testing.T) {
+	policy := &mining.Policy{BlockMaxWeight: 3000000}
+	defaults := gbtTemplateLimits{
+		weight:    3000000,
+		sigOpCost: blockchain.MaxBlockSigOpsCost,
+	}
+
+	tests := []struct {
+		name    string
+		request *btcjson.TemplateRequest
+		want    gbtTemplateLimits
+		tweaked bool
+	}{
+		{
+			name: "no request",
+			want: defaults,
+		},
+		{
+			name:    "no tweaks",
+			request: &btcjson.TemplateRequest{},
+			want:    defaults,
+		},
+		{
+			name: "boolean tweaks",
+			request: &btcjson.TemplateRequest{
+				SigOpLimit: true,
+				SizeLimit:  false,
+			},
+			want: defaults,
+		},
+		{
+			name: "higher limits",
+			request: &btcjson.TemplateRequest{
+				SigOpLimit: int64(100000),
+				SizeLimit:  int64(4000000),
+			},
+			want: defaults,
+		},
+		{
+			name: "lower size limit",
+			request: &btcjson.TemplateRequest{
+				SizeLimit: int64(500000),
+			},
+			want: gbtTemplateLimits{
+				weight:    500000,
+				sigOpCost: blockchain.MaxBlockSigOpsCost,
+			},
+			tweaked: true,
+		},
+		{
+			name: "lower limits",
+			request: &btcjson.TemplateRequest{
+				SigOpLimit: int64(20000),
+				SizeLimit:  int64(1000000),
+			},
+			want: gbtTemplateLimits{
+				weight:    1000000,
+				sigOpCost: 20000,
+			},
+			tweaked: true,
+		},
+		{
+			name: "non-positive limits",
+			request: &btcjson.TemplateRequest{
+				SigOpLimit: int64(0),
+				SizeLimit:  int64(-1),
+			},
+			want: defaults,
+		},
+	}
+
+	for _, test := range tests {
+		limits, tweaked := templateTweakLimits(policy, test.request)
+		if limits != test.want || tweaked != test.tweaked {
+			t.Errorf("%s: got limits %+v (tweaked %v), want %+v "+
+				"(tweaked %v)", test.name, limits, tweaked,
+				test.want, test.tweaked)
+		}
+	}
+
+	// The signature operation cost limit of the policy applies when it is
+	// lower than the consensus limit.
+	policy.BlockMaxSigOpCost = 40000
+	limits, tweaked := templateTweakLimits(policy, nil)
+	if limits.sigOpCost != 40000 || tweaked {
+		t.Errorf("got limits %+v (tweaked %v) for policy limiting "+
+			"signature operations", limits, tweaked)
+	}
+}
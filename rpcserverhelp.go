@@ -29,11 +29,38 @@ var helpDescsEnUS = map[string]string{
 	"debuglevel--result0":    "The string 'Done.'",
 	"debuglevel--result1":    "The list of subsystems",
 
+	// DumpTxOutSetCmd help.
+	"dumptxoutset--synopsis": "Writes a snapshot of the unspent transaction output set as of the best block to a file, which nodes that know the snapshot can load with --loadsnapshot.  " +
+		"The snapshot can only be created once the blocks before a loaded snapshot have been validated.",
+	"dumptxoutset-path": "The path of the file to create, relative to the data directory unless absolute",
+
+	// DumpTxOutSetResult help.
+	"dumptxoutsetresult-coins_written": "The number of unspent transaction outputs written to the snapshot",
+	"dumptxoutsetresult-base_hash":     "The hash of the block the snapshot is the one as of",
+	"dumptxoutsetresult-base_height":   "The height of the block the snapshot is the one as of",
+	"dumptxoutsetresult-path":          "The absolute path of the snapshot file",
+	"dumptxoutsetresult-txoutset_hash": "The MuHash3072 of the unspent transaction output set as of the block",
+
+	// AddCheckpointCmd help.
+	"addcheckpoint--synopsis": "Adds a local checkpoint the chain is validated against, replacing any checkpoint at the same height.  Checkpoints added this way are not persisted across restarts unless persist is set.",
+	"addcheckpoint-height":    "The height of the checkpoint block",
+	"addcheckpoint-hash":      "The hash of the checkpoint block",
+	"addcheckpoint-persist":   "Also append the checkpoint to the checkpoint file (--checkpointfile) so it is loaded on start up",
+
 	// AddNodeCmd help.
 	"addnode--synopsis": "Attempts to add or remove a persistent peer.",
 	"addnode-addr":      "IP address and port of the peer to operate on",
 	"addnode-subcmd":    "'add' to add a persistent peer, 'remove' to remove a persistent peer, or 'onetry' to try a single connection to a peer",
 
+	// BackupDatabaseCmd help.
+	"backupdatabase--synopsis": "Writes a consistent backup of the block database, including all blocks, indexes, and chain state, to a file while the node keeps running.  " +
+		"The backup can be restored with the restoredb command of dbtool while the node is stopped.",
+	"backupdatabase-path": "The path of the file to create, relative to the data directory unless absolute",
+
+	// BackupDatabaseResult help.
+	"backupdatabaseresult-path": "The absolute path of the backup file",
+	"backupdatabaseresult-size": "The size of the backup file in bytes",
+
 	// NodeCmd help.
 	"node--synopsis":     "Attempts to add or remove a peer.",
 	"node-subcmd":        "'disconnect' to remove all matching non-persistent peers, 'remove' to remove a persistent peer, or 'connect' to connect to a peer",
@@ -99,10 +126,22 @@ var helpDescsEnUS = map[string]string{
 	"txrawdecoderesult-locktime": "The transaction lock time",
 	"txrawdecoderesult-vin":      "The transaction inputs as JSON objects",
 	"txrawdecoderesult-vout":     "The transaction outputs as JSON objects",
+	"txrawdecoderesult-prevouts": "The outputs referenced by the transaction inputs (only present if includeprevouts is true)",
+	"txrawdecoderesult-fee":      "The fee paid by the transaction in BTC (only present if includeprevouts is true and all referenced outputs were found)",
+
+	// PrevOutResult help.
+	"prevoutresult-txid":         "The hash of the transaction which created the output",
+	"prevoutresult-vout":         "The index of the output",
+	"prevoutresult-status":       "Where the output was found: 'mempool', 'unspent', 'spent' (requires --txindex), or 'missing'",
+	"prevoutresult-value":        "The value of the output in BTC",
+	"prevoutresult-scriptPubKey": "The public key script of the output as a JSON object",
+	"prevoutresult-height":       "The height of the block which contains the transaction that created the output (not present for mempool outputs)",
+	"prevoutresult-coinbase":     "Whether or not the output was created by a coinbase transaction",
 
 	// DecodeRawTransactionCmd help.
-	"decoderawtransaction--synopsis": "Returns a JSON object representing the provided serialized, hex-encoded transaction.",
-	"decoderawtransaction-hextx":     "Serialized, hex-encoded transaction",
+	"decoderawtransaction--synopsis":       "Returns a JSON object representing the provided serialized, hex-encoded transaction.",
+	"decoderawtransaction-hextx":           "Serialized, hex-encoded transaction",
+	"decoderawtransaction-includeprevouts": "Resolve the outputs referenced by the inputs from the memory pool, the UTXO set, and the transaction index to report their values and scripts along with the fee",
 
 	// DecodeScriptResult help.
 	"decodescriptresult-asm":       "Disassembly of the script",
@@ -124,6 +163,17 @@ var helpDescsEnUS = map[string]string{
 	"estimatefee--result0": "Estimated fee per kilobyte in satoshis for a block to " +
 		"be mined in the next NumBlocks blocks.",
 
+	// EstimateSmartFeeCmd help.
+	"estimatesmartfee--synopsis": "Estimate the fee rate in BTC per kilobyte required for a transaction to be mined " +
+		"within a certain number of blocks, based on the confirmation times of the transactions seen in the memory pool.",
+	"estimatesmartfee-conftarget":   "The number of blocks within which the transaction should be mined (1 to 1008)",
+	"estimatesmartfee-estimatemode": "Whether the estimate may follow short term drops in the fee market (ECONOMICAL) or takes a longer history into account (CONSERVATIVE)",
+
+	// EstimateSmartFeeResult help.
+	"estimatesmartfeeresult-feerate": "The estimated fee rate in BTC per kilobyte, which is at least the minimum fee rate of the memory pool",
+	"estimatesmartfeeresult-errors":  "Errors encountered while estimating the fee rate",
+	"estimatesmartfeeresult-blocks":  "The number of blocks the estimate is for, which may differ from the requested target when there is not enough data",
+
 	// GenerateCmd help
 	"generate--synopsis": "Generates a set number of blocks (simnet or regtest only) and returns a JSON\n" +
 		" array of their hashes.",
@@ -185,6 +235,13 @@ var helpDescsEnUS = map[string]string{
 	"getblockchaininforesult-softforks":            "The status of the super-majority soft-forks",
 	"getblockchaininforesult-unifiedsoftforks":     "The status of the super-majority soft-forks used by bitcoind on or after v0.19.0",
 
+	// GetBlockFromPeerCmd help.
+	"getblockfrompeer--synopsis": "Requests a block from the specified peer, such as a block of a stale fork which was never downloaded.\n" +
+		"When the header of the block is not known, the headers of the fork are backfilled from the peer first, which requires the fork archive (--forkarchive).\n" +
+		"The request is made asynchronously, so use getblock to check whether the block has arrived.",
+	"getblockfrompeer-blockhash": "The hash of the block to request",
+	"getblockfrompeer-peerid":    "The id of the peer to request the block from as returned by getpeerinfo",
+
 	// SoftForkDescription help.
 	"softforkdescription-reject":  "The current activation status of the softfork",
 	"softforkdescription-version": "The block version that signals enforcement of this softfork",
@@ -272,6 +329,42 @@ var helpDescsEnUS = map[string]string{
 	"getblockheader--condition1": "verbose=true",
 	"getblockheader--result0":    "The block header hash",
 
+	// GetBlockStatsCmd help.
+	"getblockstats--synopsis":    "Returns statistics about the transactions of a block of the main chain given its hash or height.\nThe statistics exclude the coinbase transaction unless noted otherwise, and the block along with its spend journal entry must be available, so they can't be obtained for pruned blocks.",
+	"getblockstats-hashorheight": "The hash or height of the block",
+	"hashorheight-value":         "The hash or height of the block",
+	"getblockstats-stats":        "The names of the statistics to return, which are all returned when not specified",
+
+	// GetBlockStatsResult help.
+	"getblockstatsresult-avgfee":              "The average fee of the transactions in satoshi",
+	"getblockstatsresult-avgfeerate":          "The average fee rate of the transactions in satoshi per virtual byte",
+	"getblockstatsresult-avgtxsize":           "The average serialized size of the transactions",
+	"getblockstatsresult-blockhash":           "The hash of the block",
+	"getblockstatsresult-feerate_percentiles": "The fee rates at the 10th, 25th, 50th, 75th, and 90th percentiles of the transaction weight in satoshi per virtual byte",
+	"getblockstatsresult-height":              "The height of the block",
+	"getblockstatsresult-ins":                 "The number of inputs",
+	"getblockstatsresult-maxfee":              "The highest fee of the transactions in satoshi",
+	"getblockstatsresult-maxfeerate":          "The highest fee rate of the transactions in satoshi per virtual byte",
+	"getblockstatsresult-maxtxsize":           "The largest serialized size of the transactions",
+	"getblockstatsresult-medianfee":           "The median fee of the transactions in satoshi",
+	"getblockstatsresult-mediantime":          "The median time of the block and the blocks before it in seconds since 1 Jan 1970 GMT",
+	"getblockstatsresult-minfee":              "The lowest fee of the transactions in satoshi",
+	"getblockstatsresult-minfeerate":          "The lowest fee rate of the transactions in satoshi per virtual byte",
+	"getblockstatsresult-mintxsize":           "The smallest serialized size of the transactions",
+	"getblockstatsresult-outs":                "The number of outputs including the ones of the coinbase transaction",
+	"getblockstatsresult-swtotal_size":        "The total serialized size of the transactions with witness data",
+	"getblockstatsresult-swtotal_weight":      "The total weight of the transactions with witness data",
+	"getblockstatsresult-swtxs":               "The number of transactions with witness data",
+	"getblockstatsresult-subsidy":             "The block subsidy in satoshi",
+	"getblockstatsresult-time":                "The block time in seconds since 1 Jan 1970 GMT",
+	"getblockstatsresult-total_out":           "The total amount of the outputs in satoshi",
+	"getblockstatsresult-total_size":          "The total serialized size of the transactions",
+	"getblockstatsresult-total_weight":        "The total weight of the transactions",
+	"getblockstatsresult-totalfee":            "The total fee of the transactions in satoshi",
+	"getblockstatsresult-txs":                 "The number of transactions including the coinbase transaction",
+	"getblockstatsresult-utxo_increase":       "The change in the number of unspent transaction outputs",
+	"getblockstatsresult-utxo_size_inc":       "The change in the serialized size of the unspent transaction outputs",
+
 	// GetBlockHeaderVerboseResult help.
 	"getblockheaderverboseresult-hash":              "The hash of the block (same as provided)",
 	"getblockheaderverboseresult-confirmations":     "The number of confirmations",
@@ -356,6 +449,42 @@ var helpDescsEnUS = map[string]string{
 	"getcfilterheader-hash":       "The hash of the block",
 	"getcfilterheader--result0":   "The block's gcs filter header",
 
+	// GetChainTipsCmd help.
+	"getchaintips--synopsis": "Returns information about the tip of the main chain and the tips of all known forks from it ordered by height, including the stale forks retained by the fork archive (--forkarchive).",
+
+	// GetChainTipsResult help.
+	"getchaintipsresult-height":    "The height of the chain tip",
+	"getchaintipsresult-hash":      "The hash of the chain tip",
+	"getchaintipsresult-branchlen": "The number of blocks of the fork that are not in the main chain (0 for the main chain)",
+	"getchaintipsresult-status":    "The status of the chain tip (active, valid-fork, valid-headers, headers-only, or invalid)",
+
+	// GetChainTxStatsCmd help.
+	"getchaintxstats--synopsis": "Returns statistics about the number of transactions in the main chain up to a block and in a window of blocks ending with it.\nThe blocks in the window and after the block must be available, so the statistics can't be obtained for pruned blocks.",
+	"getchaintxstats-nblocks":   "The number of blocks in the window, which defaults to about a month of blocks",
+	"getchaintxstats-blockhash": "The hash of the block which ends the window, which defaults to the tip of the main chain",
+
+	// GetChainTxStatsResult help.
+	"getchaintxstatsresult-time":                      "The block time of the final block of the window in seconds since 1 Jan 1970 GMT",
+	"getchaintxstatsresult-txcount":                   "The total number of transactions in the main chain up to and including the final block of the window",
+	"getchaintxstatsresult-window_final_block_hash":   "The hash of the final block of the window",
+	"getchaintxstatsresult-window_final_block_height": "The height of the final block of the window",
+	"getchaintxstatsresult-window_block_count":        "The number of blocks in the window",
+	"getchaintxstatsresult-window_tx_count":           "The number of transactions in the window (only if the window is not empty)",
+	"getchaintxstatsresult-window_interval":           "The elapsed time in the window in seconds (only if the window is not empty)",
+	"getchaintxstatsresult-txrate":                    "The average number of transactions per second in the window (only if the window spans some time)",
+
+	// GetCheckpointsCmd help.
+	"getcheckpoints--synopsis": "Returns how blocks which conflict with the checkpoints are handled along with the checkpoints the chain is validated against.",
+
+	// CheckpointResult help.
+	"checkpointresult-height": "The height of the checkpoint block",
+	"checkpointresult-hash":   "The hash of the checkpoint block",
+	"checkpointresult-local":  "Whether the checkpoint was added locally rather than being built in",
+
+	// GetCheckpointsResult help.
+	"getcheckpointsresult-mode":        "How blocks which conflict with the checkpoints are handled (enforce, advisory, or disabled)",
+	"getcheckpointsresult-checkpoints": "The checkpoints ordered by height",
+
 	// GetConnectionCountCmd help.
 	"getconnectioncount--synopsis": "Returns the number of active connections to other peers.",
 	"getconnectioncount--result0":  "The number of connections",
@@ -364,6 +493,32 @@ var helpDescsEnUS = map[string]string{
 	"getcurrentnet--synopsis": "Get bitcoin network the server is running on.",
 	"getcurrentnet--result0":  "The network identifer",
 
+	// GetDatabaseStatsCmd help.
+	"getdatabasestats--synopsis": "Returns counters which describe the activity of the block database since the node started.",
+
+	// GetDatabaseStatsResult help.
+	"getdatabasestatsresult-metadatacachehits":    "The number of metadata lookups answered by the cache of recently written metadata",
+	"getdatabasestatsresult-metadatacachemisses":  "The number of metadata lookups which consulted the underlying metadata store",
+	"getdatabasestatsresult-metadatabytesread":    "The number of bytes of values read from the underlying metadata store by lookups",
+	"getdatabasestatsresult-metadatabyteswritten": "The number of bytes of keys and values written to the underlying metadata store",
+	"getdatabasestatsresult-blockfilehits":        "The number of block reads from block files which were already open",
+	"getdatabasestatsresult-blockfilemisses":      "The number of block reads which had to open the block file",
+	"getdatabasestatsresult-blockbytesread":       "The number of bytes of block data read",
+	"getdatabasestatsresult-blockbyteswritten":    "The number of bytes of block data written",
+	"getdatabasestatsresult-openfiles":            "The number of block files which are currently open",
+
+	// GetDeploymentInfoCmd help.
+	"getdeploymentinfo--synopsis": "Returns the parameters and the status of the soft-fork deployments as of the block after a block of the main chain.",
+	"getdeploymentinfo-blockhash": "The hash of the block, which defaults to the tip of the main chain",
+
+	// GetDeploymentInfoResult help.
+	"getdeploymentinforesult-hash":               "The hash of the block the deployments are described after",
+	"getdeploymentinforesult-height":             "The height of the block the deployments are described after",
+	"getdeploymentinforesult-deployments":        "The deployments keyed by their names",
+	"getdeploymentinforesult-deployments--key":   "name",
+	"getdeploymentinforesult-deployments--value": "An object with the type (buried or bip9), the activation height when known, whether the deployment is active, and for bip9 deployments the bip9 object with the bit, start_time, timeout, min_activation_height, status, since, and the statistics of the current window while started",
+	"getdeploymentinforesult-deployments--desc":  "The parameters and the status of a deployment",
+
 	// GetDifficultyCmd help.
 	"getdifficulty--synopsis": "Returns the proof-of-work difficulty as a multiple of the minimum difficulty.",
 	"getdifficulty--result0":  "The difficulty",
@@ -419,8 +574,64 @@ var helpDescsEnUS = map[string]string{
 	"getmempoolinfo--synopsis": "Returns memory pool information",
 
 	// GetMempoolInfoResult help.
-	"getmempoolinforesult-bytes": "Size in bytes of the mempool",
-	"getmempoolinforesult-size":  "Number of transactions in the mempool",
+	"getmempoolinforesult-bytes":            "Size in bytes of the mempool",
+	"getmempoolinforesult-size":             "Number of transactions in the mempool",
+	"getmempoolinforesult-maxmempool":       "Maximum size in bytes of the mempool",
+	"getmempoolinforesult-mempoolminfee":    "Minimum fee rate in BTC/kB for transactions to be accepted, which is raised above the minimum relay fee while the mempool is full",
+	"getmempoolinforesult-minrelaytxfee":    "Minimum fee rate in BTC/kB for transactions to be relayed",
+	"getmempoolinforesult-unbroadcastcount": "Number of locally submitted transactions in the mempool which no peer has requested yet and which are rebroadcast until one does",
+
+	// GetMempoolClusterCmd help.
+	"getmempoolcluster--synopsis": "Returns the cluster formed by a memory pool transaction along with all unconfirmed transactions connected to it through spends, split into the chunks it is mined and evicted in.",
+	"getmempoolcluster-txid":      "The hash of the transaction",
+
+	// GetMempoolDiagramCmd help.
+	"getmempooldiagram--synopsis": "Returns the feerate diagram of the memory pool, which is the cumulative fee and virtual size of the chunks of all clusters in order of decreasing fee rate.",
+
+	// FeeRateDiagramPointResult help.
+	"feeratediagrampointresult-vsize": "The total virtual size of the chunks up to this point",
+	"feeratediagrampointresult-fee":   "The total fee of the chunks up to this point in bitcoins",
+
+	// MempoolClusterChunkResult help.
+	"mempoolclusterchunkresult-fee":     "The total fee of the transactions of the chunk in bitcoins",
+	"mempoolclusterchunkresult-vsize":   "The total virtual size of the transactions of the chunk",
+	"mempoolclusterchunkresult-feerate": "The fee rate of the chunk in satoshi per virtual byte",
+	"mempoolclusterchunkresult-txids":   "The hashes of the transactions of the chunk in the order they are mined in",
+
+	// GetMempoolClusterResult help.
+	"getmempoolclusterresult-txid":    "The hash of the requested transaction",
+	"getmempoolclusterresult-txcount": "The number of transactions in the cluster",
+	"getmempoolclusterresult-fee":     "The total fee of the transactions of the cluster in bitcoins",
+	"getmempoolclusterresult-vsize":   "The total virtual size of the transactions of the cluster",
+	"getmempoolclusterresult-chunks":  "The chunks of the cluster in order of decreasing fee rate, which is the order they are mined in",
+	"getmempoolclusterresult-diagram": "The feerate diagram of the chunks, starting at zero",
+
+	// GetMempoolPackageCmd help.
+	"getmempoolpackage--synopsis": "Returns the dependency graph of the package formed by a memory pool transaction along with all of its unconfirmed ancestors and descendants.",
+	"getmempoolpackage-txid":      "The hash of the transaction",
+
+	// MempoolPackageNodeResult help.
+	"mempoolpackagenoderesult-txid":            "The hash of the transaction",
+	"mempoolpackagenoderesult-relation":        "How the transaction is related to the requested transaction (self, ancestor, or descendant)",
+	"mempoolpackagenoderesult-fee":             "Transaction fee in bitcoins",
+	"mempoolpackagenoderesult-vsize":           "The virtual size of the transaction",
+	"mempoolpackagenoderesult-feerate":         "The fee rate of the transaction in satoshi per virtual byte",
+	"mempoolpackagenoderesult-ancestorfee":     "The fee of the transaction and all of its unconfirmed ancestors in bitcoins",
+	"mempoolpackagenoderesult-ancestorvsize":   "The virtual size of the transaction and all of its unconfirmed ancestors",
+	"mempoolpackagenoderesult-ancestorfeerate": "The fee rate of the transaction and all of its unconfirmed ancestors in satoshi per virtual byte",
+	"mempoolpackagenoderesult-time":            "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"mempoolpackagenoderesult-height":          "Block height when transaction entered the pool",
+
+	// MempoolPackageEdgeResult help.
+	"mempoolpackageedgeresult-parent": "The hash of the transaction whose output is spent",
+	"mempoolpackageedgeresult-vout":   "The index of the spent output",
+	"mempoolpackageedgeresult-child":  "The hash of the spending transaction",
+	"mempoolpackageedgeresult-vin":    "The index of the spending input",
+
+	// GetMempoolPackageResult help.
+	"getmempoolpackageresult-txid":  "The hash of the requested transaction",
+	"getmempoolpackageresult-nodes": "The transactions of the package ordered such that every transaction follows the transactions it depends on",
+	"getmempoolpackageresult-edges": "The spends between the transactions of the package",
 
 	// GetMiningInfoResult help.
 	"getmininginforesult-blocks":             "Height of the latest best block",
@@ -479,14 +690,61 @@ var helpDescsEnUS = map[string]string{
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
 
+	// GetPrioritisedTransactionsCmd help.
+	"getprioritisedtransactions--synopsis":       "Returns the fee deltas set with prioritisetransaction, including those of transactions which are not in the memory pool.",
+	"getprioritisedtransactions--result0--desc":  "Fee deltas keyed by the hashes of the transactions",
+	"getprioritisedtransactions--result0--key":   "The hash of the transaction",
+	"getprioritisedtransactions--result0--value": "Object describing the fee delta of the transaction",
+
+	// GetZMQNotificationsCmd help.
+	"getzmqnotifications--synopsis": "Returns the enabled ZMQ notifications along with the addresses they are published on.",
+
+	// GetZMQNotificationsResult help.
+	"getzmqnotificationsresult-type":    "The type of the notification (pubhashblock, pubhashtx, pubrawblock, pubrawtx, or pubsequence)",
+	"getzmqnotificationsresult-address": "The address the notification is published on",
+	"getzmqnotificationsresult-hwm":     "The maximum number of messages queued for a subscriber",
+
+	// GetRPCRolesCmd help.
+	"getrpcroles--synopsis": "Returns the roles of the RPC server along with the methods they may call and the users assigned to them.",
+
+	// RPCRoleResult help.
+	"rpcroleresult-name":      "The name of the role",
+	"rpcroleresult-methods":   "The methods the role may call (* for all methods, @limited for the methods of limited users)",
+	"rpcroleresult-ratelimit": "The maximum number of requests per minute of each user of the role (0 for no limit)",
+	"rpcroleresult-builtin":   "Whether the role is the admin or limited role of the rpcuser and rpclimituser options",
+	"rpcroleresult-users":     "The users assigned to the role",
+
+	// SetRPCRoleCmd help.
+	"setrpcrole--synopsis": "Creates or replaces a role of the RPC server.  Users assigned to the role are subject to the new methods and rate limit right away.  The built-in admin and limited roles can't be changed.",
+	"setrpcrole-role":      "The name of the role",
+	"setrpcrole-methods":   "The methods the role may call (* for all methods, @limited for the methods of limited users)",
+	"setrpcrole-ratelimit": "The maximum number of requests per minute of each user of the role (0 for no limit)",
+	"setrpcrole-persist":   "Whether to also write the role to the role file, so it survives restarts",
+
+	// ReloadRPCRolesCmd help.
+	"reloadrpcroles--synopsis": "Reloads the roles and users of the role file.  Users which are no longer in it are rejected from their next request on, including over websockets.",
+
+	// PrioritisedTransactionResult help.
+	"prioritisedtransactionresult-fee_delta":    "The fee delta of the transaction in satoshi",
+	"prioritisedtransactionresult-in_mempool":   "Whether the transaction is in the memory pool",
+	"prioritisedtransactionresult-modified_fee": "The fee of the transaction including the fee delta in satoshi, only set when it is in the memory pool",
+
 	// GetRawMempoolVerboseResult help.
 	"getrawmempoolverboseresult-size":             "Transaction size in bytes",
 	"getrawmempoolverboseresult-fee":              "Transaction fee in bitcoins",
+	"getrawmempoolverboseresult-modifiedfee":      "Transaction fee with the fee delta set by prioritisetransaction in bitcoins, which is used for mining and eviction",
 	"getrawmempoolverboseresult-time":             "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
 	"getrawmempoolverboseresult-height":           "Block height when transaction entered the pool",
 	"getrawmempoolverboseresult-startingpriority": "Priority when transaction entered the pool",
 	"getrawmempoolverboseresult-currentpriority":  "Current priority",
+	"getrawmempoolverboseresult-descendantcount":  "Number of transactions in the pool along with this one which depend on it",
+	"getrawmempoolverboseresult-descendantsize":   "Total virtual size of this transaction along with its descendants in the pool",
+	"getrawmempoolverboseresult-descendantfees":   "Total modified fee of this transaction along with its descendants in the pool in bitcoins",
+	"getrawmempoolverboseresult-ancestorcount":    "Number of transactions in the pool along with this one which it depends on",
+	"getrawmempoolverboseresult-ancestorsize":     "Total virtual size of this transaction along with its ancestors in the pool",
+	"getrawmempoolverboseresult-ancestorfees":     "Total modified fee of this transaction along with its ancestors in the pool in bitcoins",
 	"getrawmempoolverboseresult-depends":          "Unconfirmed transactions used as inputs for this transaction",
+	"getrawmempoolverboseresult-correlationid":    "The correlation id supplied by the client which submitted the transaction, if any",
 	"getrawmempoolverboseresult-vsize":            "The virtual size of a transaction",
 	"getrawmempoolverboseresult-weight":           "The transaction's weight (between vsize*4-3 and vsize*4)",
 
@@ -512,12 +770,39 @@ var helpDescsEnUS = map[string]string{
 	"gettxoutresult-scriptPubKey":  "The public key script used to pay coins as a JSON object",
 	"gettxoutresult-version":       "The transaction version",
 	"gettxoutresult-coinbase":      "Whether or not the transaction is a coinbase",
+	"gettxoutresult-unconfirmed":   "Whether the output is created by a transaction in the mempool (btcd extension)",
 
 	// GetTxOutCmd help.
-	"gettxout--synopsis":      "Returns information about an unspent transaction output..",
-	"gettxout-txid":           "The hash of the transaction",
-	"gettxout-vout":           "The index of the output",
-	"gettxout-includemempool": "Include the mempool when true",
+	"gettxout--synopsis":            "Returns information about an unspent transaction output..",
+	"gettxout-txid":                 "The hash of the transaction",
+	"gettxout-vout":                 "The index of the output",
+	"gettxout-includemempool":       "Include the mempool when true",
+	"gettxout-includemempoolspends": "Treat outputs spent by transactions in the mempool as spent and return null for them (btcd extension)",
+
+	// GetTxOutSetInfoCmd help.
+	"gettxoutsetinfo--synopsis": "Returns statistics about the unspent transaction output set.\n" +
+		"The entire set is read unless the statistics are maintained as blocks are connected with --utxosetstats, which does not apply to the serialized hash.",
+	"gettxoutsetinfo-hashtype": "The hash to compute of the set: hash_serialized_3, muhash, or none",
+
+	// GetTxOutSetInfoResult help.
+	"gettxoutsetinforesult-height":            "The height of the block the set is as of",
+	"gettxoutsetinforesult-bestblock":         "The hash of the block the set is as of",
+	"gettxoutsetinforesult-transactions":      "The number of transactions with unspent outputs, omitted when the set is not read",
+	"gettxoutsetinforesult-txouts":            "The number of unspent transaction outputs",
+	"gettxoutsetinforesult-bogosize":          "A meaningless metric for the size of the set",
+	"gettxoutsetinforesult-hash_serialized_3": "The serialized hash of the set, only present for the hash_serialized_3 hash type",
+	"gettxoutsetinforesult-muhash":            "The MuHash3072 of the set, only present for the muhash hash type",
+	"gettxoutsetinforesult-total_amount":      "The total amount of the unspent outputs in BTC",
+
+	// GetTxSpendingPrevOutCmd help.
+	"gettxspendingprevout--synopsis": "Returns the transactions in the memory pool which spend the passed outputs, and those in the main chain when the spent output index is enabled with --spendindex.",
+	"gettxspendingprevout-outputs":   "The outputs to look up the spending transactions of",
+
+	// GetTxSpendingPrevOutResult help.
+	"gettxspendingprevoutresult-txid":           "The hash of the transaction of the output",
+	"gettxspendingprevoutresult-vout":           "The index of the output",
+	"gettxspendingprevoutresult-spendingtxid":   "The hash of the transaction which spends the output, omitted when no spend was found",
+	"gettxspendingprevoutresult-spendingheight": "The height of the block containing the spending transaction, omitted when it is in the memory pool (btcd extension)",
 
 	// HelpCmd help.
 	"help--synopsis":   "Returns a list of all commands or help for a specified command.",
@@ -527,10 +812,59 @@ var helpDescsEnUS = map[string]string{
 	"help--result0":    "List of commands",
 	"help--result1":    "Help for specified command",
 
+	// InvalidateBlockCmd help.
+	"invalidateblock--synopsis": "Permanently marks a block and all of its descendants as invalid and reorganizes the chain away from it.\n" +
+		"The block remains invalid across restarts until it is reconsidered with reconsiderblock.",
+	"invalidateblock-blockhash": "The hash of the block to invalidate",
+
 	// PingCmd help.
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// PrioritiseTransactionCmd help.
+	"prioritisetransaction--synopsis": "Adds a fee delta to the fee of a transaction which is used when selecting transactions for new blocks and evicting transactions from the memory pool.\n" +
+		"The transaction does not actually pay the fee delta and it may be set before the transaction is in the memory pool. It is cleared once the transaction is included in a block.",
+	"prioritisetransaction-txid":     "The hash of the transaction",
+	"prioritisetransaction-dummy":    "Unused, must be zero or null for compatibility with Bitcoin Core",
+	"prioritisetransaction-feedelta": "The fee delta in satoshi to add to the fee of the transaction, which may be negative",
+	"prioritisetransaction--result0": "Always true",
+
+	// ReconsiderBlockCmd help.
+	"reconsiderblock--synopsis": "Removes the invalid status of a block, its ancestors, and its descendants, which were marked invalid with invalidateblock.\n" +
+		"The chain is reorganized to the valid chain with the most work, which marks blocks which actually violate the rules invalid again.",
+	"reconsiderblock-blockhash": "The hash of the block to reconsider",
+
+	// ScanTxOutSetCmd help.
+	"scantxoutset--synopsis": "Scans the unspent transaction output set for the outputs whose scripts are described by the passed output descriptors.\n" +
+		"The supported descriptors are addr, raw, pk, pkh, wpkh, sh(wpkh), and combo with hex-encoded public keys or extended public keys followed by an unhardened derivation path.\n" +
+		"Only one scan may be in progress at a time, which can be queried and aborted with the status and abort actions.",
+	"scantxoutset-action":      "The action to execute: start a scan, abort the scan in progress, or return the status of the scan in progress",
+	"scantxoutset-scanobjects": "The output descriptors to scan for, required for the start action.  Ranged descriptors are expanded to the child indexes 0 through 1000 unless a range is given",
+	"scantxoutset--condition0": "action=start",
+	"scantxoutset--condition1": "action=status, null when no scan is in progress",
+	"scantxoutset--condition2": "action=abort",
+	"scantxoutset--result2":    "Whether a scan was in progress and is aborted",
+
+	// ScanTxOutSetResult help.
+	"scantxoutsetresult-success":      "Whether the scan was completed, false when it was aborted",
+	"scantxoutsetresult-txouts":       "The number of unspent transaction outputs scanned",
+	"scantxoutsetresult-height":       "The height of the block the set is as of",
+	"scantxoutsetresult-bestblock":    "The hash of the block the set is as of",
+	"scantxoutsetresult-unspents":     "The unspent outputs found",
+	"scantxoutsetresult-total_amount": "The total amount of the unspent outputs found in BTC",
+
+	// ScanTxOutSetUnspent help.
+	"scantxoutsetunspent-txid":         "The hash of the transaction",
+	"scantxoutsetunspent-vout":         "The index of the output",
+	"scantxoutsetunspent-scriptPubKey": "The hex-encoded public key script of the output",
+	"scantxoutsetunspent-desc":         "The output descriptor the output matches",
+	"scantxoutsetunspent-amount":       "The amount of the output in BTC",
+	"scantxoutsetunspent-coinbase":     "Whether the output is created by a coinbase transaction",
+	"scantxoutsetunspent-height":       "The height of the block containing the transaction",
+
+	// ScanTxOutSetStatusResult help.
+	"scantxoutsetstatusresult-progress": "The progress of the scan in percent",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
@@ -560,6 +894,250 @@ var helpDescsEnUS = map[string]string{
 	"setgenerate-generate":     "Use true to enable generation, false to disable it",
 	"setgenerate-genproclimit": "The number of processors (cores) to limit generation to or -1 for default",
 
+	// GetOrphanBlockInfoCmd help.
+	"getorphanblockinfo--synopsis": "Returns the state of the orphan block pool, which holds blocks whose parents did not arrive yet, along with the number of orphan blocks which went through it.",
+
+	// GetOrphanBlockInfoResult help.
+	"getorphanblockinforesult-count":     "The number of orphan blocks in the pool",
+	"getorphanblockinforesult-bytes":     "The total serialized size of the orphan blocks in the pool",
+	"getorphanblockinforesult-maxcount":  "The maximum number of orphan blocks kept in the pool",
+	"getorphanblockinforesult-maxbytes":  "The maximum total serialized size of the orphan blocks kept in the pool",
+	"getorphanblockinforesult-expiry":    "The time orphan blocks are kept before they expire in seconds",
+	"getorphanblockinforesult-roots":     "The number of orphan block chains whose missing parents are being requested",
+	"getorphanblockinforesult-added":     "The number of orphan blocks added to the pool",
+	"getorphanblockinforesult-connected": "The number of orphan blocks removed from the pool since their parents arrived",
+	"getorphanblockinforesult-expired":   "The number of orphan blocks removed from the pool since they expired",
+	"getorphanblockinforesult-evicted":   "The number of orphan blocks evicted from the pool to make room for new ones",
+
+	// GetStandbyInfoCmd help.
+	"getstandbyinfo--synopsis": "Returns the hot standby state of the server.",
+
+	// GetStandbyInfoResult help.
+	"getstandbyinforesult-standby":             "Whether or not the server is acting as a standby which has not been promoted",
+	"getstandbyinforesult-primary":             "The address of the primary being followed",
+	"getstandbyinforesult-primaryreachable":    "Whether or not the last health check of the primary succeeded",
+	"getstandbyinforesult-consecutivefailures": "The number of consecutive failed health checks of the primary",
+	"getstandbyinforesult-lastcheck":           "The time of the last health check in seconds since 1 Jan 1970 GMT",
+	"getstandbyinforesult-promotedat":          "The time the standby was promoted in seconds since 1 Jan 1970 GMT",
+	"getstandbyinforesult-promotionreason":     "The reason the standby was promoted",
+
+	// GetScriptValidationInfoCmd help.
+	"getscriptvalidationinfo--synopsis": "Returns the configuration of the goroutines which validate the scripts of blocks along with their activity.",
+
+	// GetScriptValidationInfoResult help.
+	"getscriptvalidationinforesult-workers":     "The number of goroutines which validate scripts besides the ones requesting the validations",
+	"getscriptvalidationinforesult-schedule":    "How the goroutines are scheduled (pool or perblock)",
+	"getscriptvalidationinforesult-pinnedcpus":  "The CPUs the goroutines are pinned to (only when they are pinned)",
+	"getscriptvalidationinforesult-queuedepth":  "The number of inputs which are waiting to be validated",
+	"getscriptvalidationinforesult-busyworkers": "The number of goroutines which are validating inputs, including the ones requesting the validations",
+	"getscriptvalidationinforesult-batches":     "The number of validations requested since the node started",
+	"getscriptvalidationinforesult-inputs":      "The number of inputs validated since the node started",
+
+	// SetScriptWorkersCmd help.
+	"setscriptworkers--synopsis": "Changes the number of goroutines which validate the scripts of blocks.  With the pool schedule, goroutines which are busy when the number is lowered stop once they finish their current block.",
+	"setscriptworkers-workers":   "The new number of goroutines",
+
+	// GetSyncProgressCmd help.
+	"getsyncprogress--synopsis": "Returns the progress of the synchronization of the chain with the network as last sampled by the sync manager, which samples it every few seconds.",
+
+	// GetSyncProgressResult help.
+	"getsyncprogressresult-time":            "The time the progress was sampled at in seconds since 1 Jan 1970 GMT",
+	"getsyncprogressresult-headersheight":   "The height of the best known header",
+	"getsyncprogressresult-presyncheight":   "The height of the last header pre-synchronized up to the next checkpoint (only while headers are pre-synchronized)",
+	"getsyncprogressresult-blockheight":     "The height of the best block",
+	"getsyncprogressresult-blockhash":       "The hash of the best block",
+	"getsyncprogressresult-targetheight":    "The height of the best block announced by the sync peer",
+	"getsyncprogressresult-progress":        "An estimate of the fraction of the chain up to the target height which has been verified",
+	"getsyncprogressresult-syncpeerid":      "The id of the sync peer (only when there is a sync peer)",
+	"getsyncprogressresult-syncpeer":        "The address of the sync peer (only when there is a sync peer)",
+	"getsyncprogressresult-blockspersecond": "The moving average of the rate blocks are connected at",
+	"getsyncprogressresult-eta":             "The estimated time remaining until the target height is reached in seconds, or 0 when unknown",
+	"getsyncprogressresult-current":         "Whether the chain is believed to be current as compared to the rest of the network",
+
+	// GetTimeInfoCmd help.
+	"gettimeinfo--synopsis": "Returns the offset the local clock is adjusted by based on the clocks of the peers along with the time samples it is derived from.",
+
+	// TimeSampleResult help.
+	"timesampleresult-source":  "The address of the peer the sample was taken from",
+	"timesampleresult-offset":  "The offset of the clock of the peer from the local clock in seconds",
+	"timesampleresult-added":   "The time the sample was added in seconds since 1 Jan 1970 GMT",
+	"timesampleresult-outlier": "Whether the sample is far off from the other samples and therefore ignored",
+
+	// GetTimeInfoResult help.
+	"gettimeinforesult-localtime":     "The local time in seconds since 1 Jan 1970 GMT",
+	"gettimeinforesult-adjustedtime":  "The local time adjusted by the offset in seconds since 1 Jan 1970 GMT",
+	"gettimeinforesult-offset":        "The offset the local clock is adjusted by in seconds",
+	"gettimeinforesult-maxadjustment": "The maximum offset in either direction the local clock is adjusted by in seconds",
+	"gettimeinforesult-warning":       "A warning about the local clock when most of the peers disagree with it",
+	"gettimeinforesult-samples":       "The time samples ordered by the time they were added",
+
+	// GetWitnessUpgradeInfoCmd help.
+	"getwitnessupgradeinfo--synopsis": "Returns the usage of witness versions and tap leaf versions not known to the current consensus rules " +
+		"observed in relayed transactions and connected blocks.",
+
+	// WitnessUpgradeVersionResult help.
+	"witnessupgradeversionresult-version":        "The witness or tap leaf version",
+	"witnessupgradeversionresult-mempooloutputs": "The number of outputs paying to the version in transactions accepted to the memory pool",
+	"witnessupgradeversionresult-mempoolinputs":  "The number of inputs spending the version in transactions accepted to the memory pool",
+	"witnessupgradeversionresult-blockoutputs":   "The number of outputs paying to the version in connected blocks",
+	"witnessupgradeversionresult-blockinputs":    "The number of inputs spending the version in connected blocks",
+	"witnessupgradeversionresult-lastseen":       "The time the version was last observed in seconds since 1 Jan 1970 GMT",
+
+	// WitnessUpgradeSampleResult help.
+	"witnessupgradesampleresult-kind":    "The kind of observation (output, input, tapleaf)",
+	"witnessupgradesampleresult-version": "The witness or tap leaf version",
+	"witnessupgradesampleresult-txid":    "The hash of the transaction",
+	"witnessupgradesampleresult-index":   "The index of the output or input",
+	"witnessupgradesampleresult-source":  "Where the transaction was observed (mempool, block)",
+	"witnessupgradesampleresult-height":  "The height of the block containing the transaction",
+	"witnessupgradesampleresult-time":    "The time of the observation in seconds since 1 Jan 1970 GMT",
+
+	// GetWitnessUpgradeInfoResult help.
+	"getwitnessupgradeinforesult-witnessversions": "Usage of unknown witness versions",
+	"getwitnessupgradeinforesult-tapleafversions": "Usage of unknown tap leaf versions in taproot script path spends",
+	"getwitnessupgradeinforesult-samples":         "The most recent observations ordered from oldest to newest",
+
+	// GetXpubAccountBalanceCmd help.
+	"getxpubaccountbalance--synopsis": "Returns the balances of a watch-only xpub account computed from the address index, the unspent transaction outputs, and the memory pool.",
+	"getxpubaccountbalance-name":      "The name of the account",
+	"getxpubaccountbalance-minconf":   "The minimum number of confirmations of outputs counted towards the confirmed balance and received total",
+
+	// GetXpubAccountBalanceResult help.
+	"getxpubaccountbalanceresult-name":             "The name of the account",
+	"getxpubaccountbalanceresult-confirmed":        "The total of the unspent outputs of the account with at least minconf confirmations in BTC",
+	"getxpubaccountbalanceresult-unconfirmed":      "The net change of the balance by transactions in the memory pool in BTC",
+	"getxpubaccountbalanceresult-received":         "The total of all outputs ever paid to the account with at least minconf confirmations in BTC",
+	"getxpubaccountbalanceresult-unspentcount":     "The number of outputs returned by listxpubaccountunspent with the same minconf",
+	"getxpubaccountbalanceresult-nextreceiveindex": "The index of the first unused address of the external branch",
+	"getxpubaccountbalanceresult-nextchangeindex":  "The index of the first unused address of the internal branch",
+
+	// ImportXpubAccountCmd help.
+	"importxpubaccount--synopsis": "Registers a named watch-only account which tracks the addresses derived from the external (0) and internal (1) branches of an extended public key.",
+	"importxpubaccount-name":      "The unique name of the account",
+	"importxpubaccount-xpub":      "The extended public key of the account for the current network",
+	"importxpubaccount-addrtype":  "The type of the addresses derived from the keys of the account",
+	"importxpubaccount-gaplimit":  "The number of consecutive unused addresses after which the scan of a branch stops",
+
+	// ListAttestationsCmd help.
+	"listattestations--synopsis": "Returns the attestations of the chain state signed by the node, which are persisted in the database.  " +
+		"Each attestation commits to the best block and the MuHash3072 of the unspent transaction output set as of that block.",
+	"listattestations-skip":    "The number of leading attestations to leave out of the result",
+	"listattestations-count":   "The maximum number of attestations to return",
+	"listattestations-reverse": "Return the attestations from the oldest to the most recent instead of from the most recent to the oldest",
+
+	// ListAttestationsResult help.
+	"listattestationsresult-pubkey":       "The hex-encoded compressed public key the attestations are signed with",
+	"listattestationsresult-total":        "The total number of persisted attestations",
+	"listattestationsresult-attestations": "The requested attestations",
+
+	// AttestationResult help.
+	"attestationresult-id":          "The sequence number of the attestation",
+	"attestationresult-time":        "The time the attestation was signed in seconds since 1 Jan 1970 GMT",
+	"attestationresult-hash":        "The hash of the best block the attestation is for",
+	"attestationresult-height":      "The height of the best block the attestation is for",
+	"attestationresult-utxomuhash":  "The MuHash3072 of the unspent transaction output set as of the block, as reported by gettxoutsetinfo in Bitcoin Core",
+	"attestationresult-txouts":      "The number of unspent transaction outputs as of the block",
+	"attestationresult-totalamount": "The total amount of the unspent transaction outputs as of the block in BTC",
+	"attestationresult-message":     "The hex-encoded double SHA-256 hash of the signed message",
+	"attestationresult-signature":   "The hex-encoded compact signature of the message which recovers to the public key",
+
+	// ListReorgsCmd help.
+	// LogTraceCmd help.
+	"logtrace--synopsis": "Manages the targets of the selective trace logging.  " +
+		"The trace and debug messages of all subsystems which mention one of the targets are logged at the info level " +
+		"regardless of the log level of the subsystem.",
+	"logtrace-action": "The action to perform (add, remove, clear, or list)",
+	"logtrace-target": "The target to add or remove in the form <kind>:<value> where kind is peer, tx, or addr (eg. peer:1.2.3.4, tx:<txid>, addr:<address>)",
+
+	// LogTraceTargetResult help.
+	"logtracetargetresult-kind":         "The kind of the target (peer, tx, or addr)",
+	"logtracetargetresult-target":       "The value log messages are matched against",
+	"logtracetargetresult-messages":     "The number of log messages which matched the target",
+	"logtracetargetresult-transactions": "The number of transactions paying to an address target which are traced along with it",
+
+	"listreorgs--synopsis": "Returns the reorganizations of the main chain performed by the node, which are persisted in the database.",
+	"listreorgs-skip":      "The number of leading reorganizations to leave out of the result",
+	"listreorgs-count":     "The maximum number of reorganizations to return",
+	"listreorgs-reverse":   "Return the reorganizations from the oldest to the most recent instead of from the most recent to the oldest",
+
+	// ListReorgsResult help.
+	"listreorgsresult-total":  "The total number of persisted reorganizations",
+	"listreorgsresult-reorgs": "The requested reorganizations",
+
+	// ReorgResult help.
+	"reorgresult-id":             "The sequence number of the reorganization",
+	"reorgresult-time":           "The time the reorganization completed in seconds since 1 Jan 1970 GMT",
+	"reorgresult-forkhash":       "The hash of the last block the old and new main chains have in common",
+	"reorgresult-forkheight":     "The height of the last block the old and new main chains have in common",
+	"reorgresult-oldtiphash":     "The hash of the tip of the main chain before the reorganization",
+	"reorgresult-oldtipheight":   "The height of the tip of the main chain before the reorganization",
+	"reorgresult-newtiphash":     "The hash of the tip of the main chain after the reorganization",
+	"reorgresult-newtipheight":   "The height of the tip of the main chain after the reorganization",
+	"reorgresult-depth":          "The number of blocks disconnected from the main chain",
+	"reorgresult-attachedblocks": "The number of blocks connected to the main chain",
+	"reorgresult-detachedtxns":   "The number of transactions in the disconnected blocks",
+	"reorgresult-attachedtxns":   "The number of transactions in the connected blocks",
+
+	// ListTemplateComparisonsCmd help.
+	"listtemplatecomparisons--synopsis": "Returns the comparisons of the blocks connected to the main chain with the most recent block template the node generated on top of the same parent, which are persisted in the database.",
+	"listtemplatecomparisons-skip":      "The number of leading comparisons to leave out of the result",
+	"listtemplatecomparisons-count":     "The maximum number of comparisons to return",
+	"listtemplatecomparisons-reverse":   "Return the comparisons from the oldest to the most recent instead of from the most recent to the oldest",
+
+	// ListTemplateComparisonsResult help.
+	"listtemplatecomparisonsresult-total":       "The total number of persisted comparisons",
+	"listtemplatecomparisonsresult-comparisons": "The requested comparisons",
+
+	// TemplateComparisonResult help.
+	"templatecomparisonresult-id":           "The sequence number of the comparison",
+	"templatecomparisonresult-hash":         "The hash of the block",
+	"templatecomparisonresult-height":       "The height of the block",
+	"templatecomparisonresult-time":         "The time the block was connected in seconds since 1 Jan 1970 GMT",
+	"templatecomparisonresult-blocktime":    "The timestamp in the header of the block in seconds since 1 Jan 1970 GMT",
+	"templatecomparisonresult-templatetime": "The time the template was generated in seconds since 1 Jan 1970 GMT",
+	"templatecomparisonresult-templateage":  "The number of seconds between generating the template and connecting the block",
+	"templatecomparisonresult-templatetxns": "The number of transactions in the template excluding the coinbase",
+	"templatecomparisonresult-blocktxns":    "The number of transactions in the block excluding the coinbase",
+	"templatecomparisonresult-sharedtxns":   "The number of transactions in both the template and the block",
+	"templatecomparisonresult-missingtxns":  "The number of transactions in the template which are not in the block",
+	"templatecomparisonresult-extratxns":    "The number of transactions in the block which are not in the template",
+	"templatecomparisonresult-templatefees": "The total fees of the template in satoshi",
+	"templatecomparisonresult-blockfees":    "The total fees claimed by the coinbase of the block in satoshi",
+	"templatecomparisonresult-feediff":      "The fees of the block minus the fees of the template in satoshi",
+	"templatecomparisonresult-missedfees":   "The fees of the transactions in the template which are not in the block in satoshi",
+
+	// ListXpubAccountsCmd help.
+	"listxpubaccounts--synopsis": "Returns the registered watch-only xpub accounts.",
+
+	// XpubAccountResult help.
+	"xpubaccountresult-name":     "The name of the account",
+	"xpubaccountresult-xpub":     "The extended public key of the account",
+	"xpubaccountresult-addrtype": "The type of the addresses derived from the keys of the account",
+	"xpubaccountresult-gaplimit": "The number of consecutive unused addresses after which the scan of a branch stops",
+	"xpubaccountresult-created":  "The time the account was registered in seconds since 1 Jan 1970 GMT",
+
+	// ListXpubAccountUnspentCmd help.
+	"listxpubaccountunspent--synopsis": "Returns the outputs paying to a watch-only xpub account which are neither spent in the main chain nor by a transaction in the memory pool.",
+	"listxpubaccountunspent-name":      "The name of the account",
+	"listxpubaccountunspent-minconf":   "The minimum number of confirmations of the returned outputs (0 includes outputs of transactions in the memory pool)",
+
+	// XpubAccountUnspentResult help.
+	"xpubaccountunspentresult-txid":          "The hash of the transaction",
+	"xpubaccountunspentresult-vout":          "The index of the output",
+	"xpubaccountunspentresult-address":       "The address the output pays to",
+	"xpubaccountunspentresult-branch":        "The branch of the address (0 for external, 1 for internal)",
+	"xpubaccountunspentresult-index":         "The index of the address on its branch",
+	"xpubaccountunspentresult-amount":        "The value of the output in BTC",
+	"xpubaccountunspentresult-scriptPubKey":  "The hex-encoded public key script of the output",
+	"xpubaccountunspentresult-confirmations": "The number of confirmations of the transaction",
+
+	// RemoveXpubAccountCmd help.
+	"removexpubaccount--synopsis": "Removes a registered watch-only xpub account.",
+	"removexpubaccount-name":      "The name of the account",
+
+	// PromoteStandbyCmd help.
+	"promotestandby--synopsis": "Promotes a hot standby so that it begins serving RPC and P2P clients.",
+
 	// StopCmd help.
 	"stop--synopsis": "Shutdown btcd.",
 	"stop--result0":  "The string 'btcd stopping.'",
@@ -575,6 +1153,42 @@ var helpDescsEnUS = map[string]string{
 	"submitblock--condition1": "Block rejected",
 	"submitblock--result1":    "The reason the block was rejected",
 
+	// SubmitPackageCmd help.
+	"submitpackage--synopsis": "Submits a package of a child transaction along with its unconfirmed parents to the memory pool.\n" +
+		"The transactions are accepted together or not at all, which allows the child to pay for parents whose fee is too low for them to be accepted on their own.",
+	"submitpackage-rawtxs": "Serialized, hex-encoded transactions of the package, ordered such that the child is last and every transaction comes after the ones it spends",
+
+	// SubmitPackageTxResult help.
+	"submitpackagetxresult-txid":  "The hash of the transaction",
+	"submitpackagetxresult-vsize": "The virtual size of the transaction",
+	"submitpackagetxresult-fee":   "The fee of the transaction in BTC, only set when the transaction was not in the memory pool yet",
+
+	// SubmitPackageResult help.
+	"submitpackageresult-package_msg":       "The result of the package validation",
+	"submitpackageresult-tx-results":        "The results of the transactions of the package",
+	"submitpackageresult-tx-results--key":   "wtxid",
+	"submitpackageresult-tx-results--value": "An object describing the transaction",
+	"submitpackageresult-tx-results--desc":  "The results of the transactions keyed by their witness hashes",
+
+	// TestMempoolAcceptCmd help.
+	"testmempoolaccept--synopsis": "Returns whether a transaction would be accepted to the memory pool without submitting it.\n" +
+		"The transaction goes through the same checks as transactions submitted with sendrawtransaction, but the memory pool is not changed.",
+	"testmempoolaccept-rawtxs":     "Serialized, hex-encoded transactions to check, which must contain exactly one transaction",
+	"testmempoolaccept-maxfeerate": "Reject transactions whose fee rate is higher than this in BTC/kB, which disables the check when 0",
+
+	// TestMempoolAcceptFees help.
+	"testmempoolacceptfees-base": "The fee of the transaction in BTC",
+
+	// TestMempoolAcceptResult help.
+	"testmempoolacceptresult-txid":          "The hash of the transaction",
+	"testmempoolacceptresult-wtxid":         "The witness hash of the transaction",
+	"testmempoolacceptresult-allowed":       "Whether the transaction would be accepted to the memory pool",
+	"testmempoolacceptresult-vsize":         "The virtual size of the transaction, only set when it is allowed",
+	"testmempoolacceptresult-fees":          "The fees of the transaction, only set when it is allowed",
+	"testmempoolacceptresult-sigopcost":     "The cost of the signature operations of the transaction, only set when it is allowed",
+	"testmempoolacceptresult-replaced":      "The hashes of the transactions in the memory pool which the transaction would replace, only set when it is allowed",
+	"testmempoolacceptresult-reject-reason": "The reason the transaction would be rejected, only set when it is not allowed",
+
 	// ValidateAddressResult help.
 	"validateaddresschainresult-isvalid": "Whether or not the address is valid",
 	"validateaddresschainresult-address": "The bitcoin address (only when isvalid is true)",
@@ -583,6 +1197,18 @@ var helpDescsEnUS = map[string]string{
 	"validateaddress--synopsis": "Verify an address is valid.",
 	"validateaddress-address":   "Bitcoin address to validate",
 
+	// ValidateBlockCmd help.
+	"validateblock--synopsis": "Fully validates a block against the consensus rules as if it were connected to the tip of the main chain, without storing or relaying it.",
+	"validateblock-hexblock":  "Serialized, hex-encoded block",
+	"validateblock-checkpow":  "Whether to check the proof of work of the block, which is not solved yet when assembling it",
+
+	// ValidateBlockResult help.
+	"validateblockresult-hash":         "The hash of the block",
+	"validateblockresult-valid":        "Whether the block passed validation",
+	"validateblockresult-rejectreason": "The BIP 22 reject reason of the violated rule, such as bad-txnmrklroot (only when valid is false)",
+	"validateblockresult-rule":         "The code of the violated rule, such as ErrBadMerkleRoot (only when valid is false)",
+	"validateblockresult-message":      "The description of the violation (only when valid is false)",
+
 	// VerifyChainCmd help.
 	"verifychain--synopsis": "Verifies the block chain database.\n" +
 		"The actual checks performed by the checklevel parameter are implementation specific.\n" +
@@ -619,6 +1245,29 @@ var helpDescsEnUS = map[string]string{
 	// StopNotifyNewTransactionsCmd help.
 	"stopnotifynewtransactions--synopsis": "Stop sending either a txaccepted or a txacceptedverbose notification when a new transaction is accepted into the mempool.",
 
+	// NotifyReplacementsCmd help.
+	"notifyreplacements--synopsis":   "Send a txreplaced notification when transactions in the mempool are replaced.",
+	"notifyreplacements-watchedonly": "Only notify replacements which pay to or spend from the addresses and outpoints watched by the caller",
+
+	// StopNotifyReplacementsCmd help.
+	"stopnotifyreplacements--synopsis": "Stop sending txreplaced notifications when transactions in the mempool are replaced.",
+
+	// NotifyPartitionAlertsCmd help.
+	"notifypartitionalerts--synopsis": "Send a partitionalert notification when a condition which suggests the node is partitioned from the network or eclipsed by its peers is detected or no longer holds.",
+
+	// StopNotifyPartitionAlertsCmd help.
+	"stopnotifypartitionalerts--synopsis": "Stop sending partitionalert notifications.",
+
+	// NotifyRawBlocksCmd help.
+	"notifyrawblocks--synopsis": "Send a rawblockconnected notification with the serialized block when a block is connected to the main chain.  " +
+		"The blocks are queued in a bounded queue and the client is disconnected when it falls further behind than the queue allows.  " +
+		"Registering again replaces the previous registration.",
+	"notifyrawblocks-compression": "The compression scheme of the serialized blocks (none or deflate)",
+	"notifyrawblocks-maxqueue":    "The maximum number of blocks which may be queued before the client is disconnected as a slow consumer (1 to 64)",
+
+	// StopNotifyRawBlocksCmd help.
+	"stopnotifyrawblocks--synopsis": "Stop sending rawblockconnected notifications.",
+
 	// NotifyReceivedCmd help.
 	"notifyreceived--synopsis": "Send a recvtx notification when a transaction added to mempool or appears in a newly-attached block contains a txout pkScript sending to any of the passed addresses.\n" +
 		"Matching outpoints are automatically registered for redeemingtx notifications.",
@@ -688,52 +1337,97 @@ var helpDescsEnUS = map[string]string{
 // This information is used to generate the help.  Each result type must be a
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
-	"addnode":               nil,
-	"createrawtransaction":  {(*string)(nil)},
-	"debuglevel":            {(*string)(nil), (*string)(nil)},
-	"decoderawtransaction":  {(*btcjson.TxRawDecodeResult)(nil)},
-	"decodescript":          {(*btcjson.DecodeScriptResult)(nil)},
-	"estimatefee":           {(*float64)(nil)},
-	"generate":              {(*[]string)(nil)},
-	"getaddednodeinfo":      {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
-	"getbestblock":          {(*btcjson.GetBestBlockResult)(nil)},
-	"getbestblockhash":      {(*string)(nil)},
-	"getblock":              {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
-	"getblockcount":         {(*int64)(nil)},
-	"getblockhash":          {(*string)(nil)},
-	"getblockheader":        {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
-	"getblocktemplate":      {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
-	"getblockchaininfo":     {(*btcjson.GetBlockChainInfoResult)(nil)},
-	"getcfilter":            {(*string)(nil)},
-	"getcfilterheader":      {(*string)(nil)},
-	"getconnectioncount":    {(*int32)(nil)},
-	"getcurrentnet":         {(*uint32)(nil)},
-	"getdifficulty":         {(*float64)(nil)},
-	"getgenerate":           {(*bool)(nil)},
-	"gethashespersec":       {(*float64)(nil)},
-	"getheaders":            {(*[]string)(nil)},
-	"getinfo":               {(*btcjson.InfoChainResult)(nil)},
-	"getmempoolinfo":        {(*btcjson.GetMempoolInfoResult)(nil)},
-	"getmininginfo":         {(*btcjson.GetMiningInfoResult)(nil)},
-	"getnettotals":          {(*btcjson.GetNetTotalsResult)(nil)},
-	"getnetworkhashps":      {(*int64)(nil)},
-	"getpeerinfo":           {(*[]btcjson.GetPeerInfoResult)(nil)},
-	"getrawmempool":         {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
-	"getrawtransaction":     {(*string)(nil), (*btcjson.TxRawResult)(nil)},
-	"gettxout":              {(*btcjson.GetTxOutResult)(nil)},
-	"node":                  nil,
-	"help":                  {(*string)(nil), (*string)(nil)},
-	"ping":                  nil,
-	"searchrawtransactions": {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
-	"sendrawtransaction":    {(*string)(nil)},
-	"setgenerate":           nil,
-	"stop":                  {(*string)(nil)},
-	"submitblock":           {nil, (*string)(nil)},
-	"uptime":                {(*int64)(nil)},
-	"validateaddress":       {(*btcjson.ValidateAddressChainResult)(nil)},
-	"verifychain":           {(*bool)(nil)},
-	"verifymessage":         {(*bool)(nil)},
-	"version":               {(*map[string]btcjson.VersionResult)(nil)},
+	"addcheckpoint":              nil,
+	"addnode":                    nil,
+	"backupdatabase":             {(*btcjson.BackupDatabaseResult)(nil)},
+	"createrawtransaction":       {(*string)(nil)},
+	"debuglevel":                 {(*string)(nil), (*string)(nil)},
+	"dumptxoutset":               {(*btcjson.DumpTxOutSetResult)(nil)},
+	"decoderawtransaction":       {(*btcjson.TxRawDecodeResult)(nil)},
+	"decodescript":               {(*btcjson.DecodeScriptResult)(nil)},
+	"estimatefee":                {(*float64)(nil)},
+	"estimatesmartfee":           {(*btcjson.EstimateSmartFeeResult)(nil)},
+	"generate":                   {(*[]string)(nil)},
+	"getaddednodeinfo":           {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
+	"getbestblock":               {(*btcjson.GetBestBlockResult)(nil)},
+	"getbestblockhash":           {(*string)(nil)},
+	"getblock":                   {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
+	"getblockcount":              {(*int64)(nil)},
+	"getblockhash":               {(*string)(nil)},
+	"getblockheader":             {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getblockstats":              {(*btcjson.GetBlockStatsResult)(nil)},
+	"getblocktemplate":           {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
+	"getblockchaininfo":          {(*btcjson.GetBlockChainInfoResult)(nil)},
+	"getblockfrompeer":           nil,
+	"getcfilter":                 {(*string)(nil)},
+	"getcfilterheader":           {(*string)(nil)},
+	"getchaintips":               {(*[]btcjson.GetChainTipsResult)(nil)},
+	"getchaintxstats":            {(*btcjson.GetChainTxStatsResult)(nil)},
+	"getcheckpoints":             {(*btcjson.GetCheckpointsResult)(nil)},
+	"getconnectioncount":         {(*int32)(nil)},
+	"getcurrentnet":              {(*uint32)(nil)},
+	"getdatabasestats":           {(*btcjson.GetDatabaseStatsResult)(nil)},
+	"getdeploymentinfo":          {(*btcjson.GetDeploymentInfoResult)(nil)},
+	"getdifficulty":              {(*float64)(nil)},
+	"getgenerate":                {(*bool)(nil)},
+	"gethashespersec":            {(*float64)(nil)},
+	"getheaders":                 {(*[]string)(nil)},
+	"getinfo":                    {(*btcjson.InfoChainResult)(nil)},
+	"getmempoolinfo":             {(*btcjson.GetMempoolInfoResult)(nil)},
+	"getmempoolcluster":          {(*btcjson.GetMempoolClusterResult)(nil)},
+	"getmempooldiagram":          {(*[]btcjson.FeeRateDiagramPointResult)(nil)},
+	"getmempoolpackage":          {(*btcjson.GetMempoolPackageResult)(nil)},
+	"getmininginfo":              {(*btcjson.GetMiningInfoResult)(nil)},
+	"getnettotals":               {(*btcjson.GetNetTotalsResult)(nil)},
+	"getnetworkhashps":           {(*int64)(nil)},
+	"getorphanblockinfo":         {(*btcjson.GetOrphanBlockInfoResult)(nil)},
+	"getpeerinfo":                {(*[]btcjson.GetPeerInfoResult)(nil)},
+	"getprioritisedtransactions": {(*map[string]btcjson.PrioritisedTransactionResult)(nil)},
+	"getzmqnotifications":        {(*[]btcjson.GetZMQNotificationsResult)(nil)},
+	"getrawmempool":              {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
+	"getrawtransaction":          {(*string)(nil), (*btcjson.TxRawResult)(nil)},
+	"getrpcroles":                {(*[]btcjson.RPCRoleResult)(nil)},
+	"getstandbyinfo":             {(*btcjson.GetStandbyInfoResult)(nil)},
+	"getscriptvalidationinfo":    {(*btcjson.GetScriptValidationInfoResult)(nil)},
+	"getsyncprogress":            {(*btcjson.GetSyncProgressResult)(nil)},
+	"gettimeinfo":                {(*btcjson.GetTimeInfoResult)(nil)},
+	"gettxout":                   {(*btcjson.GetTxOutResult)(nil)},
+	"gettxoutsetinfo":            {(*btcjson.GetTxOutSetInfoResult)(nil)},
+	"gettxspendingprevout":       {(*[]btcjson.GetTxSpendingPrevOutResult)(nil)},
+	"getwitnessupgradeinfo":      {(*btcjson.GetWitnessUpgradeInfoResult)(nil)},
+	"getxpubaccountbalance":      {(*btcjson.GetXpubAccountBalanceResult)(nil)},
+	"importxpubaccount":          nil,
+	"invalidateblock":            nil,
+	"listattestations":           {(*btcjson.ListAttestationsResult)(nil)},
+	"listreorgs":                 {(*btcjson.ListReorgsResult)(nil)},
+	"listtemplatecomparisons":    {(*btcjson.ListTemplateComparisonsResult)(nil)},
+	"listxpubaccounts":           {(*[]btcjson.XpubAccountResult)(nil)},
+	"listxpubaccountunspent":     {(*[]btcjson.XpubAccountUnspentResult)(nil)},
+	"logtrace":                   {(*[]btcjson.LogTraceTargetResult)(nil)},
+	"node":                       nil,
+	"help":                       {(*string)(nil), (*string)(nil)},
+	"ping":                       nil,
+	"prioritisetransaction":      {(*bool)(nil)},
+	"promotestandby":             nil,
+	"reconsiderblock":            nil,
+	"reloadrpcroles":             nil,
+	"removexpubaccount":          nil,
+	"scantxoutset":               {(*btcjson.ScanTxOutSetResult)(nil), (*btcjson.ScanTxOutSetStatusResult)(nil), (*bool)(nil)},
+	"searchrawtransactions":      {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
+	"sendrawtransaction":         {(*string)(nil)},
+	"setgenerate":                nil,
+	"setrpcrole":                 nil,
+	"setscriptworkers":           nil,
+	"stop":                       {(*string)(nil)},
+	"submitblock":                {nil, (*string)(nil)},
+	"submitpackage":              {(*btcjson.SubmitPackageResult)(nil)},
+	"testmempoolaccept":          {(*[]btcjson.TestMempoolAcceptResult)(nil)},
+	"uptime":                     {(*int64)(nil)},
+	"validateaddress":            {(*btcjson.ValidateAddressChainResult)(nil)},
+	"validateblock":              {(*btcjson.ValidateBlockResult)(nil)},
+	"verifychain":                {(*bool)(nil)},
+	"verifymessage":              {(*bool)(nil)},
+	"version":                    {(*map[string]btcjson.VersionResult)(nil)},
 
 	// Websocket commands.
 	"loadtxfilter":              nil,
@@ -742,6 +1436,12 @@ var rpcResultTypes = map[string][]interface{}{
 	"stopnotifyblocks":          nil,
 	"notifynewtransactions":     nil,
 	"stopnotifynewtransactions": nil,
+	"notifyreplacements":        nil,
+	"stopnotifyreplacements":    nil,
+	"notifypartitionalerts":     nil,
+	"stopnotifypartitionalerts": nil,
+	"notifyrawblocks":           nil,
+	"stopnotifyrawblocks":       nil,
 	"notifyreceived":            nil,
 	"stopnotifyreceived":        nil,
 	"notifyspent":               nil,
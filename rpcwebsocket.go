@@ -7,16 +7,16 @@ package main
 
 import (
 	"bytes"
+	"compress/flate"
 	"container/list"
 	"crypto/sha256"
-	"crypto/subtle"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
@@ -25,6 +25,7 @@ import (
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
@@ -39,6 +40,16 @@ const (
 	// handler since notifications have their own queuing mechanism
 	// independent of the send channel buffer.
 	websocketSendBufferSize = 50
+
+	// defaultRawBlockQueue is the default number of connected blocks which
+	// may be queued for a client streaming raw blocks before it is
+	// disconnected as a slow consumer.
+	defaultRawBlockQueue = 8
+
+	// maxRawBlockQueue is the maximum number of connected blocks a client
+	// streaming raw blocks may request to be queued.  It bounds the memory
+	// a single client can hold on to.
+	maxRawBlockQueue = 64
 )
 
 type semaphore chan struct{}
@@ -67,13 +78,19 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 	"help":                      handleWebsocketHelp,
 	"notifyblocks":              handleNotifyBlocks,
 	"notifynewtransactions":     handleNotifyNewTransactions,
+	"notifypartitionalerts":     handleNotifyPartitionAlerts,
+	"notifyrawblocks":           handleNotifyRawBlocks,
 	"notifyreceived":            handleNotifyReceived,
+	"notifyreplacements":        handleNotifyReplacements,
 	"notifyspent":               handleNotifySpent,
 	"session":                   handleSession,
 	"stopnotifyblocks":          handleStopNotifyBlocks,
 	"stopnotifynewtransactions": handleStopNotifyNewTransactions,
+	"stopnotifypartitionalerts": handleStopNotifyPartitionAlerts,
+	"stopnotifyrawblocks":       handleStopNotifyRawBlocks,
 	"stopnotifyspent":           handleStopNotifySpent,
 	"stopnotifyreceived":        handleStopNotifyReceived,
+	"stopnotifyreplacements":    handleStopNotifyReplacements,
 	"rescan":                    handleRescan,
 	"rescanblocks":              handleRescanBlocks,
 }
@@ -84,7 +101,7 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 // server handler which runs each new connection in a new goroutine thereby
 // satisfying the requirement.
 func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
-	authenticated bool, isAdmin bool) {
+	authenticated bool, authKey [sha256.Size]byte) {
 
 	// Clear the read deadline that was set before the websocket hijacked
 	// the connection.
@@ -103,7 +120,7 @@ func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
 	// Create a new websocket client to handle the new websocket connection
 	// and wait for it to shutdown.  Once it has shutdown (and hence
 	// disconnected), remove it and any notifications it registered for.
-	client, err := newWebsocketClient(s, conn, remoteAddr, authenticated, isAdmin)
+	client, err := newWebsocketClient(s, conn, remoteAddr, authenticated, authKey)
 	if err != nil {
 		rpcsLog.Errorf("Failed to serve client %s: %v", remoteAddr, err)
 		conn.Close()
@@ -246,6 +263,33 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *btcutil.Tx, isNew bool) {
 	}
 }
 
+// NotifyTxReplaced passes a replacement of transactions in the mempool to the
+// notification manager for replacement notification processing.
+func (m *wsNotificationManager) NotifyTxReplaced(r *mempool.TxReplacement) {
+	// As NotifyTxReplaced will be called by mempool and the RPC server
+	// may no longer be running, use a select statement to unblock
+	// enqueuing the notification once the RPC server has begun
+	// shutting down.
+	select {
+	case m.queueNotification <- (*notificationTxReplaced)(r):
+	case <-m.quit:
+	}
+}
+
+// NotifyPartitionAlert passes an alert raised or resolved by the partition
+// monitor to the notification manager for partition alert notification
+// processing.
+func (m *wsNotificationManager) NotifyPartitionAlert(alert *btcjson.PartitionAlert) {
+	// As NotifyPartitionAlert will be called by the partition monitor and
+	// the RPC server may no longer be running, use a select statement to
+	// unblock enqueuing the notification once the RPC server has begun
+	// shutting down.
+	select {
+	case m.queueNotification <- (*notificationPartitionAlert)(alert):
+	case <-m.quit:
+	}
+}
+
 // wsClientFilter tracks relevant addresses for each websocket client for
 // the `rescanblocks` extension. It is modified by the `loadtxfilter` command.
 //
@@ -451,6 +495,8 @@ type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *btcutil.Tx
 }
+type notificationTxReplaced mempool.TxReplacement
+type notificationPartitionAlert btcjson.PartitionAlert
 
 // Notification control requests
 type notificationRegisterClient wsClient
@@ -459,6 +505,12 @@ type notificationRegisterBlocks wsClient
 type notificationUnregisterBlocks wsClient
 type notificationRegisterNewMempoolTxs wsClient
 type notificationUnregisterNewMempoolTxs wsClient
+type notificationRegisterReplacements wsClient
+type notificationUnregisterReplacements wsClient
+type notificationRegisterPartitionAlerts wsClient
+type notificationUnregisterPartitionAlerts wsClient
+type notificationRegisterRawBlocks wsRawBlockStream
+type notificationUnregisterRawBlocks wsClient
 type notificationRegisterSpent struct {
 	wsc *wsClient
 	ops []*wire.OutPoint
@@ -491,6 +543,9 @@ func (m *wsNotificationManager) notificationHandler() {
 	// since it is quite a bit more efficient than using the entire struct.
 	blockNotifications := make(map[chan struct{}]*wsClient)
 	txNotifications := make(map[chan struct{}]*wsClient)
+	replacementNotifications := make(map[chan struct{}]*wsClient)
+	partitionNotifications := make(map[chan struct{}]*wsClient)
+	rawBlockStreams := make(map[chan struct{}]*wsRawBlockStream)
 	watchedOutPoints := make(map[wire.OutPoint]map[chan struct{}]*wsClient)
 	watchedAddrs := make(map[string]map[chan struct{}]*wsClient)
 
@@ -521,6 +576,10 @@ out:
 					m.notifyFilteredBlockConnected(blockNotifications,
 						block)
 				}
+				if len(rawBlockStreams) != 0 {
+					m.notifyRawBlockConnected(rawBlockStreams,
+						block)
+				}
 
 			case *notificationBlockDisconnected:
 				block := (*btcutil.Block)(n)
@@ -539,6 +598,19 @@ out:
 				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
 				m.notifyRelevantTxAccepted(n.tx, clients)
 
+			case *notificationTxReplaced:
+				if len(replacementNotifications) != 0 {
+					m.notifyTxReplaced(replacementNotifications,
+						watchedOutPoints, watchedAddrs,
+						(*mempool.TxReplacement)(n))
+				}
+
+			case *notificationPartitionAlert:
+				if len(partitionNotifications) != 0 {
+					m.notifyPartitionAlert(partitionNotifications,
+						(*btcjson.PartitionAlert)(n))
+				}
+
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
 				blockNotifications[wsc.quit] = wsc
@@ -557,6 +629,12 @@ out:
 				// the client itself.
 				delete(blockNotifications, wsc.quit)
 				delete(txNotifications, wsc.quit)
+				delete(replacementNotifications, wsc.quit)
+				delete(partitionNotifications, wsc.quit)
+				if stream, ok := rawBlockStreams[wsc.quit]; ok {
+					close(stream.quit)
+					delete(rawBlockStreams, wsc.quit)
+				}
 				for k := range wsc.spentRequests {
 					op := k
 					m.removeSpentRequest(watchedOutPoints, wsc, &op)
@@ -586,6 +664,38 @@ out:
 				wsc := (*wsClient)(n)
 				delete(txNotifications, wsc.quit)
 
+			case *notificationRegisterReplacements:
+				wsc := (*wsClient)(n)
+				replacementNotifications[wsc.quit] = wsc
+
+			case *notificationUnregisterReplacements:
+				wsc := (*wsClient)(n)
+				delete(replacementNotifications, wsc.quit)
+
+			case *notificationRegisterPartitionAlerts:
+				wsc := (*wsClient)(n)
+				partitionNotifications[wsc.quit] = wsc
+
+			case *notificationUnregisterPartitionAlerts:
+				wsc := (*wsClient)(n)
+				delete(partitionNotifications, wsc.quit)
+
+			case *notificationRegisterRawBlocks:
+				stream := (*wsRawBlockStream)(n)
+				wsc := stream.wsc
+				if old, ok := rawBlockStreams[wsc.quit]; ok {
+					close(old.quit)
+				}
+				rawBlockStreams[wsc.quit] = stream
+				go stream.streamHandler()
+
+			case *notificationUnregisterRawBlocks:
+				wsc := (*wsClient)(n)
+				if stream, ok := rawBlockStreams[wsc.quit]; ok {
+					close(stream.quit)
+					delete(rawBlockStreams, wsc.quit)
+				}
+
 			default:
 				rpcsLog.Warn("Unhandled notification type")
 			}
@@ -868,6 +978,292 @@ func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClie
 	}
 }
 
+// RegisterReplacementUpdates requests notifications to the passed websocket
+// client when transactions in the memory pool are replaced.
+func (m *wsNotificationManager) RegisterReplacementUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterReplacements)(wsc)
+}
+
+// UnregisterReplacementUpdates removes notifications to the passed websocket
+// client when transactions in the memory pool are replaced.
+func (m *wsNotificationManager) UnregisterReplacementUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterReplacements)(wsc)
+}
+
+// RegisterPartitionAlerts requests notifications to the passed websocket
+// client when partition alerts are raised or resolved.
+func (m *wsNotificationManager) RegisterPartitionAlerts(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterPartitionAlerts)(wsc)
+}
+
+// UnregisterPartitionAlerts removes notifications to the passed websocket
+// client when partition alerts are raised or resolved.
+func (m *wsNotificationManager) UnregisterPartitionAlerts(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterPartitionAlerts)(wsc)
+}
+
+// notifyPartitionAlert notifies websocket clients that have registered for
+// partition alerts of the passed alert.
+func (m *wsNotificationManager) notifyPartitionAlert(clients map[chan struct{}]*wsClient,
+	alert *btcjson.PartitionAlert) {
+
+	ntfn := btcjson.NewPartitionAlertNtfn(*alert)
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal partition alert "+
+			"notification: %v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
+// RegisterRawBlocks requests the passed raw block stream to be fed with the
+// blocks connected to the main chain.  It replaces any stream the client of the
+// stream registered before.
+func (m *wsNotificationManager) RegisterRawBlocks(stream *wsRawBlockStream) {
+	m.queueNotification <- (*notificationRegisterRawBlocks)(stream)
+}
+
+// UnregisterRawBlocks stops the raw block stream of the passed websocket
+// client.
+func (m *wsNotificationManager) UnregisterRawBlocks(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterRawBlocks)(wsc)
+}
+
+// notifyRawBlockConnected queues the passed block connected to the main chain
+// to the passed raw block streams.  Clients whose stream is already holding
+// the maximum number of blocks they requested to be queued are disconnected
+// as slow consumers rather than letting their queue grow without bound.
+func (*wsNotificationManager) notifyRawBlockConnected(streams map[chan struct{}]*wsRawBlockStream,
+	block *btcutil.Block) {
+
+	for _, stream := range streams {
+		select {
+		case stream.queue <- block:
+		default:
+			rpcsLog.Warnf("Disconnecting websocket client %s which "+
+				"fell %d blocks behind the raw block stream",
+				stream.wsc.addr, cap(stream.queue))
+			stream.wsc.Disconnect()
+		}
+	}
+}
+
+// wsRawBlockStream streams the serialized blocks connected to the main chain
+// to a websocket client.  Unlike other notifications, which are queued without
+// bound, the blocks are queued in a bounded queue and the next block is only
+// serialized once the previous one was written to the connection.  This
+// applies backpressure to clients which read slowly and bounds the memory
+// they hold on to.
+type wsRawBlockStream struct {
+	wsc         *wsClient
+	compression string
+	queue       chan *btcutil.Block
+	quit        chan struct{}
+}
+
+// newWSRawBlockStream returns a new raw block stream to the passed websocket
+// client which compresses the blocks with the passed compression scheme and
+// queues up to the passed number of blocks.
+func newWSRawBlockStream(wsc *wsClient, compression string,
+	maxQueue int) *wsRawBlockStream {
+
+	return &wsRawBlockStream{
+		wsc:         wsc,
+		compression: compression,
+		queue:       make(chan *btcutil.Block, maxQueue),
+		quit:        make(chan struct{}),
+	}
+}
+
+// encodeRawBlock returns the hex-encoded serialized passed block compressed
+// with the passed compression scheme.
+func encodeRawBlock(block *btcutil.Block, compression string) (string, error) {
+	serialized, err := block.Bytes()
+	if err != nil {
+		return "", err
+	}
+
+	switch compression {
+	case btcjson.RawBlockCompressionNone:
+	case btcjson.RawBlockCompressionDeflate:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write(serialized); err != nil {
+			return "", err
+		}
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+		serialized = buf.Bytes()
+	default:
+		return "", fmt.Errorf("unsupported compression %q", compression)
+	}
+	return hex.EncodeToString(serialized), nil
+}
+
+// streamHandler sends the queued blocks to the client one at a time until the
+// stream or the client is stopped.  It must be run as a goroutine.
+func (s *wsRawBlockStream) streamHandler() {
+	sent := make(chan bool, 1)
+	for {
+		var block *btcutil.Block
+		select {
+		case block = <-s.queue:
+		case <-s.quit:
+			return
+		case <-s.wsc.quit:
+			return
+		}
+
+		encoded, err := encodeRawBlock(block, s.compression)
+		if err != nil {
+			rpcsLog.Errorf("Failed to serialize block %v: %v",
+				block.Hash(), err)
+			continue
+		}
+		ntfn := btcjson.NewRawBlockConnectedNtfn(block.Hash().String(),
+			block.Height(), s.compression, encoded)
+		marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal raw block connected "+
+				"notification: %v", err)
+			continue
+		}
+
+		// Wait for the block to be written before serializing the next
+		// one.
+		s.wsc.SendMessage(marshalledJSON, sent)
+		if !<-sent {
+			return
+		}
+	}
+}
+
+// newReplacementTx returns the description of the passed transaction of a
+// mempool replacement for the txreplaced notification.
+func newReplacementTx(txD *mempool.TxDesc) btcjson.ReplacementTx {
+	return btcjson.ReplacementTx{
+		TxID:    txD.Tx.Hash().String(),
+		Hex:     txHexString(txD.Tx.MsgTx()),
+		VSize:   mempool.GetTxVirtualSize(txD.Tx),
+		Fee:     btcutil.Amount(txD.Fee).ToBTC(),
+		FeeRate: btcutil.Amount(txD.FeePerKB).ToBTC(),
+	}
+}
+
+// watchedByReplacement returns the addresses and outpoints watched by the
+// passed websocket client which are paid or spent by the transactions of the
+// passed replacement.  Addresses and outpoints are watched through the
+// notifyreceived and notifyspent requests and the loaded transaction filter.
+func (m *wsNotificationManager) watchedByReplacement(wsc *wsClient,
+	ops map[wire.OutPoint]map[chan struct{}]*wsClient,
+	addrs map[string]map[chan struct{}]*wsClient,
+	r *mempool.TxReplacement) ([]string, []btcjson.OutPoint) {
+
+	wsc.Lock()
+	filter := wsc.filterData
+	wsc.Unlock()
+	if filter != nil {
+		filter.mu.Lock()
+		defer filter.mu.Unlock()
+	}
+
+	watchedAddrs := make(map[string]struct{})
+	watchedOps := make(map[wire.OutPoint]struct{})
+	txDescs := append([]*mempool.TxDesc{r.Replacement}, r.Replaced...)
+	for _, txD := range txDescs {
+		msgTx := txD.Tx.MsgTx()
+		for _, txIn := range msgTx.TxIn {
+			op := txIn.PreviousOutPoint
+			_, ok := ops[op][wsc.quit]
+			if ok || (filter != nil && filter.existsUnspentOutPoint(&op)) {
+				watchedOps[op] = struct{}{}
+			}
+		}
+		for _, txOut := range msgTx.TxOut {
+			_, txAddrs, _, err := txscript.ExtractPkScriptAddrs(
+				txOut.PkScript, m.server.cfg.ChainParams)
+			if err != nil {
+				continue
+			}
+			for _, a := range txAddrs {
+				encoded := a.EncodeAddress()
+				_, ok := addrs[encoded][wsc.quit]
+				if ok || (filter != nil && filter.existsAddress(a)) {
+					watchedAddrs[encoded] = struct{}{}
+				}
+			}
+		}
+	}
+
+	addrList := make([]string, 0, len(watchedAddrs))
+	for a := range watchedAddrs {
+		addrList = append(addrList, a)
+	}
+	sort.Strings(addrList)
+	opList := make([]btcjson.OutPoint, 0, len(watchedOps))
+	for op := range watchedOps {
+		opList = append(opList, btcjson.OutPoint{
+			Hash:  op.Hash.String(),
+			Index: op.Index,
+		})
+	}
+	sort.Slice(opList, func(i, j int) bool {
+		if opList[i].Hash != opList[j].Hash {
+			return opList[i].Hash < opList[j].Hash
+		}
+		return opList[i].Index < opList[j].Index
+	})
+	return addrList, opList
+}
+
+// notifyTxReplaced notifies websocket clients that have registered for
+// replacement updates when transactions in the memory pool are replaced.  Each
+// client is told which of the addresses and outpoints it watches are affected
+// by the replacement, and clients which only asked for replacements affecting
+// them are skipped when there are none.
+func (m *wsNotificationManager) notifyTxReplaced(clients map[chan struct{}]*wsClient,
+	ops map[wire.OutPoint]map[chan struct{}]*wsClient,
+	addrs map[string]map[chan struct{}]*wsClient, r *mempool.TxReplacement) {
+
+	replacement := btcjson.TxReplacement{
+		Replacement:  newReplacementTx(r.Replacement),
+		Replaced:     make([]btcjson.ReplacementTx, 0, len(r.Replaced)),
+		FeeDelta:     btcutil.Amount(r.FeeDelta).ToBTC(),
+		FeeRateDelta: btcutil.Amount(r.FeeRateDelta).ToBTC(),
+	}
+	for _, txD := range r.Replaced {
+		replacement.Replaced = append(replacement.Replaced,
+			newReplacementTx(txD))
+	}
+
+	for _, wsc := range clients {
+		replacement.WatchedAddresses, replacement.WatchedOutPoints =
+			m.watchedByReplacement(wsc, ops, addrs, r)
+		if wsc.watchedReplacementsOnly &&
+			len(replacement.WatchedAddresses) == 0 &&
+			len(replacement.WatchedOutPoints) == 0 {
+
+			continue
+		}
+
+		ntfn := btcjson.NewTxReplacedNtfn(replacement)
+		marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal tx replaced "+
+				"notification: %v", err)
+			return
+		}
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // RegisterSpentRequests requests a notification when each of the passed
 // outpoints is confirmed spent (contained in a block connected to the main
 // chain) for the passed websocket client.  The request is automatically
@@ -1264,9 +1660,9 @@ type wsClient struct {
 	// and therefore is allowed to communicated over the websocket.
 	authenticated bool
 
-	// isAdmin specifies whether a client may change the state of the server;
-	// false means its access is only to the limited set of RPC calls.
-	isAdmin bool
+	// authKey identifies the credentials the client authenticated with,
+	// whose role determines the RPC calls it may make.
+	authKey [sha256.Size]byte
 
 	// sessionID is a random ID generated for each client when connected.
 	// These IDs may be queried by a client using the session RPC.  A change
@@ -1277,6 +1673,11 @@ type wsClient struct {
 	// information about all new transactions.
 	verboseTxUpdates bool
 
+	// watchedReplacementsOnly specifies whether a client has requested
+	// replacement notifications only for the replacements which affect
+	// the addresses and outpoints it watches.
+	watchedReplacementsOnly bool
+
 	// addrRequests is a set of addresses the caller has requested to be
 	// notified about.  It is maintained here so all requests can be removed
 	// when a wallet disconnects.  Owned by the notification manager.
@@ -1323,6 +1724,38 @@ out:
 			break out
 		}
 
+		// Batches of requests are only accepted once the client is
+		// authenticated.  They are serviced as a whole, so the array of
+		// replies is sent once all requests of the batch are serviced.
+		if isRPCBatch(msg) {
+			if !c.authenticated {
+				rpcsLog.Warnf("Unauthenticated websocket message " +
+					"received")
+				break out
+			}
+			requests, jsonErr := parseRPCBatch(msg)
+			if jsonErr != nil {
+				reply, err := createMarshalledReply(nil, nil, jsonErr)
+				if err != nil {
+					rpcsLog.Errorf("Failed to marshal parse "+
+						"failure reply: %v", err)
+					continue
+				}
+				c.SendMessage(reply, nil)
+				continue
+			}
+			c.serviceRequestSem.acquire()
+			go func() {
+				reply := runRPCBatch(requests,
+					cfg.RPCBatchParallelism, c.batchReply)
+				if reply != nil {
+					c.SendMessage(reply, nil)
+				}
+				c.serviceRequestSem.release()
+			}()
+			continue
+		}
+
 		var request btcjson.Request
 		err = json.Unmarshal(msg, &request)
 		if err != nil {
@@ -1384,7 +1817,8 @@ out:
 			c.SendMessage(reply, nil)
 			continue
 		}
-		rpcsLog.Debugf("Received command <%s> from %s", cmd.method, c.addr)
+		rpcsLog.Debugf("Received command <%s> from %s%s", cmd.method,
+			c.addr, correlationSuffix(cmd.correlationID))
 
 		// Check auth.  The client is immediately disconnected if the
 		// first request of an unauthentiated websocket client is not
@@ -1402,17 +1836,14 @@ out:
 			break out
 		case !c.authenticated:
 			// Check credentials.
-			login := authCmd.Username + ":" + authCmd.Passphrase
-			auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-			authSha := sha256.Sum256([]byte(auth))
-			cmp := subtle.ConstantTimeCompare(authSha[:], c.server.authsha[:])
-			limitcmp := subtle.ConstantTimeCompare(authSha[:], c.server.limitauthsha[:])
-			if cmp != 1 && limitcmp != 1 {
+			authKey := rpcBasicAuthKey(authCmd.Username,
+				authCmd.Passphrase)
+			if !c.server.roles.authenticate(authKey) {
 				rpcsLog.Warnf("Auth failure.")
 				break out
 			}
 			c.authenticated = true
-			c.isAdmin = cmp == 1
+			c.authKey = authKey
 
 			// Marshal and send response.
 			reply, err := createMarshalledReply(cmd.id, nil, nil)
@@ -1425,24 +1856,18 @@ out:
 			continue
 		}
 
-		// Check if the client is using limited RPC credentials and
-		// error when not authorized to call this RPC.
-		if !c.isAdmin {
-			if _, ok := rpcLimited[request.Method]; !ok {
-				jsonErr := &btcjson.RPCError{
-					Code:    btcjson.ErrRPCInvalidParams.Code,
-					Message: "limited user not authorized for this method",
-				}
-				// Marshal and send response.
-				reply, err := createMarshalledReply(request.ID, nil, jsonErr)
-				if err != nil {
-					rpcsLog.Errorf("Failed to marshal parse failure "+
-						"reply: %v", err)
-					continue
-				}
-				c.SendMessage(reply, nil)
+		// Check if the client is authorized to make this RPC and error
+		// when it is not.
+		if jsonErr := c.authorizeRequest(&request); jsonErr != nil {
+			// Marshal and send response.
+			reply, err := createMarshalledReply(request.ID, nil, jsonErr)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal authorization "+
+					"failure reply: %v", err)
 				continue
 			}
+			c.SendMessage(reply, nil)
+			continue
 		}
 
 		// Asynchronously handle the request.  A semaphore is used to
@@ -1478,10 +1903,78 @@ out:
 	rpcsLog.Tracef("Websocket client input handler done for %s", c.addr)
 }
 
-// serviceRequest services a parsed RPC request by looking up and executing the
-// appropriate RPC handler.  The response is marshalled and sent to the
-// websocket client.
-func (c *wsClient) serviceRequest(r *parsedRPCCmd) {
+// authorizeRequest returns an error suitable for use in replies when the role
+// of the client's credentials does not allow the passed request, or when the
+// request is not authorized by the admin keys while threshold authorization is
+// enabled.
+func (c *wsClient) authorizeRequest(request *btcjson.Request) *btcjson.RPCError {
+	if err := c.server.roles.authorize(c.authKey, request.Method); err != nil {
+		return rpcRoleError(err)
+	}
+	if c.server.authorizer != nil {
+		return c.server.authorizer.authorize(request)
+	}
+	return nil
+}
+
+// batchReply parses, authorizes, and services the passed request of a batch and
+// returns the marshalled reply, or nil when no reply is due to the request.
+// Unlike single requests, authenticate requests in a batch are answered with
+// an error rather than disconnecting the client.
+func (c *wsClient) batchReply(msg json.RawMessage) []byte {
+	var request btcjson.Request
+	if err := json.Unmarshal(msg, &request); err != nil {
+		jsonErr := &btcjson.RPCError{
+			Code:    btcjson.ErrRPCParse.Code,
+			Message: "Failed to parse request: " + err.Error(),
+		}
+		return c.marshalReply(nil, "", nil, jsonErr)
+	}
+
+	// No reply is due to notifications, as with single requests.
+	if request.ID == nil && !(cfg.RPCQuirks && request.Jsonrpc == "") {
+		return nil
+	}
+
+	cmd := parseCmd(&request)
+	if cmd.err != nil {
+		return c.marshalReply(cmd.id, cmd.method, nil, cmd.err)
+	}
+	if _, ok := cmd.cmd.(*btcjson.AuthenticateCmd); ok {
+		jsonErr := &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidRequest.Code,
+			Message: "The authenticate command may not be batched",
+		}
+		return c.marshalReply(cmd.id, cmd.method, nil, jsonErr)
+	}
+	if jsonErr := c.authorizeRequest(&request); jsonErr != nil {
+		return c.marshalReply(cmd.id, cmd.method, nil, jsonErr)
+	}
+	rpcsLog.Debugf("Received command <%s> from %s in batch%s", cmd.method,
+		c.addr, correlationSuffix(cmd.correlationID))
+
+	return c.requestReply(cmd)
+}
+
+// marshalReply returns the marshalled reply with the passed id, result, and
+// error to a request for the passed method, or nil when it can't be
+// marshalled.
+func (c *wsClient) marshalReply(id interface{}, method string,
+	result interface{}, replyErr error) []byte {
+
+	reply, err := createMarshalledReply(id, result, replyErr)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal reply for <%s> command: %v",
+			method, err)
+		return nil
+	}
+	return reply
+}
+
+// requestReply services a parsed RPC request by looking up and executing the
+// appropriate RPC handler and returns the marshalled reply, or nil when it
+// can't be marshalled.
+func (c *wsClient) requestReply(r *parsedRPCCmd) []byte {
 	var (
 		result interface{}
 		err    error
@@ -1495,13 +1988,16 @@ func (c *wsClient) serviceRequest(r *parsedRPCCmd) {
 	} else {
 		result, err = c.server.standardCmdResult(r, nil)
 	}
-	reply, err := createMarshalledReply(r.id, result, err)
-	if err != nil {
-		rpcsLog.Errorf("Failed to marshal reply for <%s> "+
-			"command: %v", r.method, err)
-		return
+	return c.marshalReply(r.id, r.method, result, err)
+}
+
+// serviceRequest services a parsed RPC request by looking up and executing the
+// appropriate RPC handler.  The response is marshalled and sent to the
+// websocket client.
+func (c *wsClient) serviceRequest(r *parsedRPCCmd) {
+	if reply := c.requestReply(r); reply != nil {
+		c.SendMessage(reply, nil)
 	}
-	c.SendMessage(reply, nil)
 }
 
 // notificationQueueHandler handles the queuing of outgoing notifications for
@@ -1709,7 +2205,7 @@ func (c *wsClient) WaitForShutdown() {
 // incoming and outgoing messages in separate goroutines complete with queuing
 // and asynchrous handling for long-running operations.
 func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
-	remoteAddr string, authenticated bool, isAdmin bool) (*wsClient, error) {
+	remoteAddr string, authenticated bool, authKey [sha256.Size]byte) (*wsClient, error) {
 
 	sessionID, err := wire.RandomUint64()
 	if err != nil {
@@ -1720,7 +2216,7 @@ func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
 		conn:              conn,
 		addr:              remoteAddr,
 		authenticated:     authenticated,
-		isAdmin:           isAdmin,
+		authKey:           authKey,
 		sessionID:         sessionID,
 		server:            server,
 		addrRequests:      make(map[string]struct{}),
@@ -1882,6 +2378,87 @@ func handleStopNotifyNewTransactions(wsc *wsClient, icmd interface{}) (interface
 	return nil, nil
 }
 
+// handleNotifyReplacements implements the notifyreplacements command extension
+// for websocket connections.
+func handleNotifyReplacements(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	cmd, ok := icmd.(*btcjson.NotifyReplacementsCmd)
+	if !ok {
+		return nil, btcjson.ErrRPCInternal
+	}
+
+	wsc.watchedReplacementsOnly = cmd.WatchedOnly != nil && *cmd.WatchedOnly
+	wsc.server.ntfnMgr.RegisterReplacementUpdates(wsc)
+	return nil, nil
+}
+
+// handleStopNotifyReplacements implements the stopnotifyreplacements command
+// extension for websocket connections.
+func handleStopNotifyReplacements(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterReplacementUpdates(wsc)
+	return nil, nil
+}
+
+// handleNotifyPartitionAlerts implements the notifypartitionalerts command
+// extension for websocket connections.
+func handleNotifyPartitionAlerts(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.RegisterPartitionAlerts(wsc)
+	return nil, nil
+}
+
+// handleStopNotifyPartitionAlerts implements the stopnotifypartitionalerts
+// command extension for websocket connections.
+func handleStopNotifyPartitionAlerts(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterPartitionAlerts(wsc)
+	return nil, nil
+}
+
+// handleNotifyRawBlocks implements the notifyrawblocks command extension for
+// websocket connections.
+func handleNotifyRawBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	cmd, ok := icmd.(*btcjson.NotifyRawBlocksCmd)
+	if !ok {
+		return nil, btcjson.ErrRPCInternal
+	}
+
+	compression := btcjson.RawBlockCompressionNone
+	if cmd.Compression != nil {
+		compression = *cmd.Compression
+	}
+	switch compression {
+	case btcjson.RawBlockCompressionNone, btcjson.RawBlockCompressionDeflate:
+	default:
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("unsupported compression %q -- "+
+				"supported are %q and %q", compression,
+				btcjson.RawBlockCompressionNone,
+				btcjson.RawBlockCompressionDeflate),
+		}
+	}
+	maxQueue := defaultRawBlockQueue
+	if cmd.MaxQueue != nil {
+		maxQueue = *cmd.MaxQueue
+	}
+	if maxQueue < 1 || maxQueue > maxRawBlockQueue {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("maxqueue must be between 1 and "+
+				"%d", maxRawBlockQueue),
+		}
+	}
+
+	stream := newWSRawBlockStream(wsc, compression, maxQueue)
+	wsc.server.ntfnMgr.RegisterRawBlocks(stream)
+	return nil, nil
+}
+
+// handleStopNotifyRawBlocks implements the stopnotifyrawblocks command
+// extension for websocket connections.
+func handleStopNotifyRawBlocks(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterRawBlocks(wsc)
+	return nil, nil
+}
+
 // handleNotifyReceived implements the notifyreceived command extension for
 // websocket connections.
 func handleNotifyReceived(wsc *wsClient, icmd interface{}) (interface{}, error) {
@@ -1979,6 +2556,13 @@ func deserializeOutpoints(serializedOuts []btcjson.OutPoint) ([]*wire.OutPoint,
 type rescanKeys struct {
 	addrs   map[string]struct{}
 	unspent map[wire.OutPoint]struct{}
+
+	// unspentScripts holds the output scripts of the unspent outputs
+	// which are known.  filterScripts caches the scripts which are
+	// matched against the committed filters of blocks and is reset
+	// whenever the unspent outputs change.
+	unspentScripts map[wire.OutPoint][]byte
+	filterScripts  [][]byte
 }
 
 // unspentSlice returns a slice of currently-unspent outpoints for the rescan
@@ -2038,7 +2622,7 @@ func rescanBlock(wsc *wsClient, lookups *rescanKeys, blk *btcutil.Block) {
 			// If it spends an outpoint, we'll dispatch a spend
 			// notification for the transaction.
 			if _, ok := lookups.unspent[txin.PreviousOutPoint]; ok {
-				delete(lookups.unspent, txin.PreviousOutPoint)
+				lookups.removeUnspent(txin.PreviousOutPoint)
 
 				if spentNotified {
 					continue
@@ -2113,7 +2697,7 @@ func rescanBlock(wsc *wsClient, lookups *rescanKeys, blk *btcutil.Block) {
 					Hash:  *tx.Hash(),
 					Index: uint32(txOutIdx),
 				}
-				lookups.unspent[outpoint] = struct{}{}
+				lookups.addUnspent(outpoint, txout.PkScript)
 
 				if recvNotified {
 					continue
@@ -2330,11 +2914,17 @@ func scanBlockChunks(wsc *wsClient, cmd *btcjson.RescanCmd, lookups *rescanKeys,
 	*btcutil.Block, *chainhash.Hash, error) {
 
 	// lastBlock and lastBlockHash track the previously-rescanned block.
-	// They equal nil when no previous blocks have been rescanned.
+	// They equal nil when no previous blocks have been rescanned.  The
+	// last block is only loaded once the rescan finishes when it was
+	// skipped due to its committed filter.
 	var (
 		lastBlock     *btcutil.Block
 		lastBlockHash *chainhash.Hash
+		lastSkipped   bool
+		numSkipped    int
 	)
+	cfIndex := wsc.server.cfg.CfIndex
+	params := wsc.server.cfg.ChainParams
 
 	// A ticker is created to wait at least 10 seconds before notifying the
 	// websocket client of the current progress completed by the rescan.
@@ -2408,8 +2998,55 @@ fetchRange:
 			break
 		}
 
+		// Fetch the committed filters of the blocks in the range when
+		// the filter index is enabled so the blocks which can't contain
+		// any relevant transactions are not read from disk.
+		filters := fetchRescanFilters(cfIndex, hashList)
+
 	loopHashList:
 		for i := range hashList {
+			// Skip the block when its filter shows it is irrelevant.
+			// The first block of a range is always read to ensure it
+			// connects to the last block of the previous range.
+			hash := &hashList[i]
+			if i < len(filters) && (i != 0 || lastBlockHash == nil) &&
+				!lookups.mayMatchFilter(hash, filters[i], params) &&
+				chain.MainChainHasBlock(hash) {
+
+				height := minBlock + int32(i)
+				select {
+				case <-wsc.quit:
+					rpcsLog.Debugf("Stopped rescan at height %v "+
+						"for disconnected client", height)
+					return nil, nil, nil
+				default:
+				}
+				lastBlockHash = hash
+				lastSkipped = true
+				numSkipped++
+
+				// Periodically notify the client of the progress
+				// completed just like for the blocks which are
+				// read.
+				select {
+				case <-ticker.C:
+				default:
+					continue
+				}
+				header, err := chain.HeaderByHash(hash)
+				if err != nil {
+					continue
+				}
+				err = queueRescanProgress(wsc, hash, height,
+					header.Timestamp)
+				if err == ErrClientQuit {
+					rpcsLog.Debugf("Stopped rescan at height %v "+
+						"for disconnected client", height)
+					return nil, nil, nil
+				}
+				continue
+			}
+
 			blk, err := chain.BlockByHash(&hashList[i])
 			if err != nil {
 				// Only handle reorgs if a block could not be
@@ -2455,6 +3092,7 @@ fetchRange:
 				if len(hashList) == 0 {
 					break fetchRange
 				}
+				filters = fetchRescanFilters(cfIndex, hashList)
 				goto loopHashList
 			}
 			if i == 0 && lastBlockHash != nil {
@@ -2477,6 +3115,7 @@ fetchRange:
 				rescanBlock(wsc, lookups, blk)
 				lastBlock = blk
 				lastBlockHash = blk.Hash()
+				lastSkipped = false
 			}
 
 			// Periodically notify the client of the progress
@@ -2488,18 +3127,9 @@ fetchRange:
 				continue
 			}
 
-			n := btcjson.NewRescanProgressNtfn(
-				hashList[i].String(), blk.Height(),
-				blk.MsgBlock().Header.Timestamp.Unix(),
-			)
-			mn, err := btcjson.MarshalCmd(nil, n)
-			if err != nil {
-				rpcsLog.Errorf("Failed to marshal rescan "+
-					"progress notification: %v", err)
-				continue
-			}
-
-			if err = wsc.QueueNotification(mn); err == ErrClientQuit {
+			err = queueRescanProgress(wsc, &hashList[i], blk.Height(),
+				blk.MsgBlock().Header.Timestamp)
+			if err == ErrClientQuit {
 				// Finished if the client disconnected.
 				rpcsLog.Debugf("Stopped rescan at height %v "+
 					"for disconnected client", blk.Height())
@@ -2510,9 +3140,45 @@ fetchRange:
 		minBlock += int32(len(hashList))
 	}
 
+	if numSkipped > 0 {
+		rpcsLog.Debugf("Skipped %d blocks during rescan due to their "+
+			"committed filters", numSkipped)
+	}
+
+	// Load the last block when it was skipped since the caller reports
+	// it to the client.
+	if lastSkipped {
+		blk, err := chain.BlockByHash(lastBlockHash)
+		if err != nil {
+			return nil, nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCBlockNotFound,
+				Message: "Error getting block: " + err.Error(),
+			}
+		}
+		lastBlock = blk
+	}
+
 	return lastBlock, lastBlockHash, nil
 }
 
+// queueRescanProgress queues a rescan progress notification for the block with
+// the passed hash, height, and timestamp to the websocket client.  Only
+// ErrClientQuit is returned since failing to marshal the notification is not
+// fatal to the rescan.
+func queueRescanProgress(wsc *wsClient, hash *chainhash.Hash, height int32,
+	timestamp time.Time) error {
+
+	n := btcjson.NewRescanProgressNtfn(hash.String(), height,
+		timestamp.Unix())
+	mn, err := btcjson.MarshalCmd(nil, n)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal rescan progress "+
+			"notification: %v", err)
+		return nil
+	}
+	return wsc.QueueNotification(mn)
+}
+
 // handleRescan implements the rescan command extension for websocket
 // connections.
 //
@@ -2549,17 +3215,26 @@ func handleRescan(wsc *wsClient, icmd interface{}) (interface{}, error) {
 
 	// Build lookup maps.
 	lookups := rescanKeys{
-		addrs:   map[string]struct{}{},
-		unspent: map[wire.OutPoint]struct{}{},
+		addrs:          map[string]struct{}{},
+		unspent:        map[wire.OutPoint]struct{}{},
+		unspentScripts: map[wire.OutPoint][]byte{},
 	}
 	for _, addrStr := range cmd.Addresses {
 		lookups.addrs[addrStr] = struct{}{}
 	}
-	for _, outpoint := range outpoints {
-		lookups.unspent[*outpoint] = struct{}{}
-	}
 
+	// The scripts of the outpoints which are still unspent are looked up
+	// so the blocks which spend them can be found by their committed
+	// filters.
 	chain := wsc.server.cfg.Chain
+	for _, outpoint := range outpoints {
+		var pkScript []byte
+		entry, err := chain.FetchUtxoEntry(*outpoint)
+		if err == nil && entry != nil && !entry.IsSpent() {
+			pkScript = entry.PkScript()
+		}
+		lookups.addUnspent(*outpoint, pkScript)
+	}
 
 	minBlockHash, err := chainhash.NewHashFromStr(cmd.BeginBlock)
 	if err != nil {
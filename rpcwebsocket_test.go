@@ -0,0 +1,81 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestEncodeRawBlock ensures blocks streamed to websocket clients decode to
+// the original block with every supported compression scheme and that unknown
+// schemes are rejected.
+func TestEncodeRawBlock(t *testing.T) {
+	block := btcutil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	want, err := block.Bytes()
+	if err != nil {
+		t.Fatalf("unable to serialize block: %v", err)
+	}
+
+	tests := []struct {
+		compression string
+		decompress  func([]byte) ([]byte, error)
+	}{
+		{
+			compression: btcjson.RawBlockCompressionNone,
+			decompress: func(b []byte) ([]byte, error) {
+				return b, nil
+			},
+		},
+		{
+			compression: btcjson.RawBlockCompressionDeflate,
+			decompress: func(b []byte) ([]byte, error) {
+				return ioutil.ReadAll(flate.NewReader(bytes.NewReader(b)))
+			},
+		},
+	}
+	for _, test := range tests {
+		encoded, err := encodeRawBlock(block, test.compression)
+		if err != nil {
+			t.Errorf("encodeRawBlock(%s): %v", test.compression, err)
+			continue
+		}
+		compressed, err := hex.DecodeString(encoded)
+		if err != nil {
+			t.Errorf("encodeRawBlock(%s): invalid hex: %v",
+				test.compression, err)
+			continue
+		}
+		serialized, err := test.decompress(compressed)
+		if err != nil {
+			t.Errorf("encodeRawBlock(%s): unable to decompress: %v",
+				test.compression, err)
+			continue
+		}
+		if !bytes.Equal(serialized, want) {
+			t.Errorf("encodeRawBlock(%s): mismatched block",
+				test.compression)
+			continue
+		}
+		var msgBlock wire.MsgBlock
+		err = msgBlock.Deserialize(bytes.NewReader(serialized))
+		if err != nil {
+			t.Errorf("encodeRawBlock(%s): unable to deserialize: %v",
+				test.compression, err)
+		}
+	}
+
+	if _, err := encodeRawBlock(block, "zstd"); err == nil {
+		t.Error("encodeRawBlock: unsupported compression was not rejected")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// numaNodeCPUListPath is the path of the file which lists the CPUs of a NUMA
+// node on Linux.
+const numaNodeCPUListPath = "/sys/devices/system/node/node%d/cpulist"
+
+// parseCPUList returns the CPUs described by the passed list of CPUs and
+// inclusive ranges of CPUs, such as "0-3,8,10-11", which is the format used by
+// the kernel to list the CPUs of a NUMA node.
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	seen := make(map[int]struct{})
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("malformed CPU list %q", list)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last < first {
+				return nil, fmt.Errorf("malformed CPU list %q",
+					list)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			if _, ok := seen[cpu]; ok {
+				continue
+			}
+			seen[cpu] = struct{}{}
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// numaNodeCPUs returns the CPUs of the passed NUMA node as reported by the
+// kernel.
+func numaNodeCPUs(node int) ([]int, error) {
+	if node < 0 {
+		return nil, fmt.Errorf("invalid NUMA node %d", node)
+	}
+	list, err := ioutil.ReadFile(fmt.Sprintf(numaNodeCPUListPath, node))
+	if err != nil {
+		return nil, err
+	}
+	return parseCPUList(string(list))
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseCPUList ensures CPU lists in the format used by the kernel are
+// parsed correctly and malformed lists are rejected.
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		list string
+		want []int
+	}{
+		{list: "0", want: []int{0}},
+		{list: "0-3,8,10-11\n", want: []int{0, 1, 2, 3, 8, 10, 11}},
+		{list: "4-5,5-6", want: []int{4, 5, 6}},
+		{list: "", want: nil},
+		{list: "3-1", want: nil},
+		{list: "a", want: nil},
+		{list: "-1", want: nil},
+		{list: "0,,1", want: nil},
+	}
+	for _, test := range tests {
+		cpus, err := parseCPUList(test.list)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("parseCPUList(%q): malformed list was "+
+					"not rejected", test.list)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCPUList(%q): unexpected error: %v",
+				test.list, err)
+			continue
+		}
+		if !reflect.DeepEqual(cpus, test.want) {
+			t.Errorf("parseCPUList(%q): got %v, want %v", test.list,
+				cpus, test.want)
+		}
+	}
+}
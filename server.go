@@ -6,6 +6,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/rand"
 	"crypto/tls"
@@ -14,6 +15,8 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
@@ -32,11 +35,16 @@ import (
 	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/mining"
 	"github.com/btcsuite/btcd/mining/cpuminer"
+	"github.com/btcsuite/btcd/mining/stratum"
+	"github.com/btcsuite/btcd/mining/sv2"
 	"github.com/btcsuite/btcd/netsync"
 	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/plugins"
+	"github.com/btcsuite/btcd/txrecon"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/base58"
 	"github.com/btcsuite/btcutil/bloom"
 )
 
@@ -60,6 +68,28 @@ const (
 	// connectionRetryInterval 是在连接到持久 peer 时重试之间等待的基本时间.
 	// 它通过重试次数进行调整, 以使存在重试退避.
 	connectionRetryInterval = time.Second * 5
+
+	// clockOffsetCheckInterval is the interval at which the time samples
+	// of the connected peers are refined with their clock offsets.
+	clockOffsetCheckInterval = time.Minute * 10
+
+	// mempoolFileName is the name of the file in the data directory the
+	// memory pool is saved to on shutdown.
+	mempoolFileName = "mempool.dat"
+
+	// sv2AuthorityKeyFilename is the name of the file in the data directory
+	// which holds the hex encoded private key the static keys of the
+	// Stratum V2 template provider are signed with.
+	sv2AuthorityKeyFilename = "sv2_authority.key"
+
+	// maxV1OnlyAddrs is the maximum number of addresses of peers which
+	// failed the v2 transport handshake that are remembered.
+	maxV1OnlyAddrs = 1000
+
+	// v1OnlyAddrExpiry is the amount of time the v1 transport is used for a
+	// peer which failed the v2 transport handshake before the v2 transport
+	// is attempted again.
+	v1OnlyAddrExpiry = time.Hour * 24
 )
 
 var (
@@ -126,14 +156,6 @@ type broadcastMsg struct {
 	excludePeers []*serverPeer
 }
 
-// broadcastInventoryAdd is a type used to declare that the InvVect it contains
-// needs to be added to the rebroadcast map
-type broadcastInventoryAdd relayMsg
-
-// broadcastInventoryDel is a type used to declare that the InvVect it contains
-// needs to be removed from the rebroadcast map
-type broadcastInventoryDel *wire.InvVect
-
 // relayMsg packages an inventory vector along with the newly discovered
 // inventory so the relay has access to that information.
 //
@@ -192,13 +214,6 @@ func (ps *peerState) forAllPeers(closure func(sp *serverPeer)) {
 	ps.forAllOutboundPeers(closure)
 }
 
-// cfHeaderKV is a tuple of a filter header and its associated block hash. The
-// struct is used to cache cfcheckpt responses.
-type cfHeaderKV struct {
-	blockHash    chainhash.Hash
-	filterHeader chainhash.Hash
-}
-
 // server provides a bitcoin server for handling communications to and from
 // bitcoin peers.
 type server struct {
@@ -211,47 +226,59 @@ type server struct {
 	shutdownSched int32
 	startupTime   int64
 
-	chainParams          *chaincfg.Params
-	addrManager          *addrmgr.AddrManager
-	connManager          *connmgr.ConnManager
-	sigCache             *txscript.SigCache
-	hashCache            *txscript.HashCache
-	rpcServer            *rpcServer
-	syncManager          *netsync.SyncManager
-	chain                *blockchain.BlockChain
-	txMemPool            *mempool.TxPool
-	cpuMiner             *cpuminer.CPUMiner
-	modifyRebroadcastInv chan interface{}
-	newPeers             chan *serverPeer
-	donePeers            chan *serverPeer
-	banPeers             chan *serverPeer
-	query                chan interface{}
-	relayInv             chan relayMsg
-	broadcast            chan broadcastMsg
-	peerHeightsUpdate    chan updatePeerHeightsMsg
-	wg                   sync.WaitGroup
-	quit                 chan struct{}
-	nat                  NAT
-	db                   database.DB
-	timeSource           blockchain.MedianTimeSource
-	services             wire.ServiceFlag
+	chainParams       *chaincfg.Params
+	addrManager       *addrmgr.AddrManager
+	connManager       *connmgr.ConnManager
+	sigCache          *txscript.SigCache
+	hashCache         *txscript.HashCache
+	rpcServer         *rpcServer
+	syncManager       *netsync.SyncManager
+	chain             *blockchain.BlockChain
+	txMemPool         *mempool.TxPool
+	cpuMiner          *cpuminer.CPUMiner
+	stratumServer     *stratum.Server
+	sv2Server         *sv2.Server
+	newPeers          chan *serverPeer
+	donePeers         chan *serverPeer
+	banPeers          chan *serverPeer
+	query             chan interface{}
+	relayInv          chan relayMsg
+	broadcast         chan broadcastMsg
+	peerHeightsUpdate chan updatePeerHeightsMsg
+	wg                sync.WaitGroup
+	quit              chan struct{}
+	nat               NAT
+	db                database.DB
+	timeSource        *blockchain.TimeManager
+	services          wire.ServiceFlag
 
 	// The following fields are used for optional indexes.  They will be nil
 	// if the associated index is not enabled.  These fields are set during
 	// initial creation of the server and never changed afterwards, so they
 	// do not need to be protected for concurrent access.
-	txIndex   *indexers.TxIndex
-	addrIndex *indexers.AddrIndex
-	cfIndex   *indexers.CfIndex
+	txIndex         *indexers.TxIndex
+	addrIndex       *indexers.AddrIndex
+	cfIndex         *indexers.CfIndex
+	utreexoIndex    *indexers.UtreexoIndex
+	utxoScriptIndex *indexers.UtxoScriptIndex
+	spendIndex      *indexers.SpendIndex
 
 	// The fee estimator keeps track of how long transactions are left in
 	// the mempool before they are mined into blocks.
 	feeEstimator *mempool.FeeEstimator
 
-	// cfCheckptCaches stores a cached slice of filter headers for cfcheckpt
-	// messages for each filter type.
-	cfCheckptCaches    map[wire.FilterType][]cfHeaderKV
-	cfCheckptCachesMtx sync.RWMutex
+	// mempoolLoaded is set once the memory pool saved on the last shutdown
+	// has been loaded, so it is only saved again on shutdown when loading
+	// was not interrupted.
+	mempoolLoaded bool
+
+	// cfilterSource serves committed filters to peers.  It is nil if the
+	// committed filter index is not enabled.
+	cfilterSource peer.FilterSource
+
+	// netLog writes a line for every message sent to and received from
+	// peers.  It is nil if the network log is disabled.
+	netLog *netLogger
 
 	// agentBlacklist is a list of blacklisted substrings by which to filter
 	// user agents.
@@ -260,6 +287,61 @@ type server struct {
 	// agentWhitelist is a list of whitelisted user agent substrings, no
 	// whitelisting will be applied if the list is empty or nil.
 	agentWhitelist []string
+
+	// standby tracks the hot standby state of the server.  It is nil when
+	// the server is not configured as a standby.
+	standby *standbyManager
+
+	// v1OnlyAddrs houses the addresses of outbound peers which failed the
+	// v2 transport handshake along with the time they expire so later
+	// connections to them use the v1 transport instead.  It is limited to
+	// maxV1OnlyAddrs entries.
+	v1OnlyAddrs    map[string]time.Time
+	v1OnlyAddrsMtx sync.Mutex
+
+	// witnessTelemetry tracks the use of unknown witness and tap leaf
+	// versions.  It is nil when witness upgrade telemetry is disabled.
+	witnessTelemetry *witnessTelemetry
+
+	// forkArchive retains recently seen blocks and headers of stale forks.
+	// It is nil when the fork archive is disabled.
+	forkArchive *forkArchive
+
+	// plugins dispatches the lifecycle events of the node to the
+	// registered plugins.
+	plugins *plugins.Manager
+
+	// reorgLog persists the reorganizations of the main chain.
+	reorgLog *reorgLog
+
+	// attestor periodically signs attestations of the chain state.  It
+	// will be nil if attestations are disabled.
+	attestor *attestor
+
+	// templateComparer compares the connected blocks with the block
+	// templates generated by the node.  It will be nil if template
+	// comparisons are disabled.
+	templateComparer *templateComparer
+
+	// xpubAccounts tracks watch-only xpub accounts.  It will be nil if the
+	// address index is disabled.
+	xpubAccounts *xpubAccountManager
+
+	// partitionMonitor raises alerts about signs of a network partition or
+	// eclipse attack.  It will be nil if partition alerts are disabled.
+	partitionMonitor *partitionMonitor
+
+	// grpcServer serves the gRPC interface.  It will be nil if it is
+	// disabled.
+	grpcServer *grpcServer
+
+	// zmqNotifier publishes ZMQ notifications.  It will be nil if they are
+	// disabled.
+	zmqNotifier *zmqNotifier
+
+	// healthServer serves the health endpoints.  It will be nil if they
+	// are disabled.
+	healthServer *healthServer
 }
 
 // serverPeer extends the peer to maintain state shared by the server and
@@ -283,6 +365,13 @@ type serverPeer struct {
 	knownAddresses map[string]struct{}
 	banScore       connmgr.DynamicBanScore
 	quit           chan struct{}
+
+	// The following fields track the BIP0330 transaction reconciliation
+	// state.  txRecon is nil until reconciliation has been negotiated.
+	reconMtx  sync.Mutex
+	reconSalt uint64
+	txRecon   *txrecon.State
+
 	// The following chans are used to sync blockmanager and server.
 	txProcessed    chan struct{}
 	blockProcessed chan struct{}
@@ -327,6 +416,24 @@ func (sp *serverPeer) addressKnown(na *wire.NetAddress) bool {
 	return exists
 }
 
+// addKnownAddressesV2 adds the given addresses to the set of known addresses
+// to the peer to prevent sending duplicate addresses.
+func (sp *serverPeer) addKnownAddressesV2(addresses []*wire.NetAddressV2) {
+	sp.addressesMtx.Lock()
+	for _, na := range addresses {
+		sp.knownAddresses[na.String()] = struct{}{}
+	}
+	sp.addressesMtx.Unlock()
+}
+
+// addressKnownV2 true if the given address is already known to the peer.
+func (sp *serverPeer) addressKnownV2(na *wire.NetAddressV2) bool {
+	sp.addressesMtx.RLock()
+	_, exists := sp.knownAddresses[na.String()]
+	sp.addressesMtx.RUnlock()
+	return exists
+}
+
 // setDisableRelayTx toggles relaying of transactions for the given peer.
 // It is safe for concurrent access.
 func (sp *serverPeer) setDisableRelayTx(disable bool) {
@@ -347,8 +454,17 @@ func (sp *serverPeer) relayTxDisabled() bool {
 }
 
 // pushAddrMsg sends an addr message to the connected peer using the provided
-// addresses.
+// addresses.  An addrv2 message is sent instead when the peer wants them.
 func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
+	if sp.WantsAddrV2() {
+		addrs := make([]*wire.NetAddressV2, 0, len(addresses))
+		for _, addr := range addresses {
+			addrs = append(addrs, wire.NetAddressV2FromLegacy(addr))
+		}
+		sp.pushAddrV2Msg(addrs)
+		return
+	}
+
 	// Filter addresses already known to the peer.
 	addrs := make([]*wire.NetAddress, 0, len(addresses))
 	for _, addr := range addresses {
@@ -365,6 +481,25 @@ func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
 	sp.addKnownAddresses(known)
 }
 
+// pushAddrV2Msg sends an addrv2 message to the connected peer using the
+// provided addresses.
+func (sp *serverPeer) pushAddrV2Msg(addresses []*wire.NetAddressV2) {
+	// Filter addresses already known to the peer.
+	addrs := make([]*wire.NetAddressV2, 0, len(addresses))
+	for _, addr := range addresses {
+		if !sp.addressKnownV2(addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	known, err := sp.PushAddrV2Msg(addrs)
+	if err != nil {
+		peerLog.Errorf("Can't push address message to %s: %v", sp.Peer, err)
+		sp.Disconnect()
+		return
+	}
+	sp.addKnownAddressesV2(known)
+}
+
 // addBanScore increases the persistent and decaying ban score fields by the
 // values passed as parameters. If the resulting score exceeds half of the ban
 // threshold, a warning is logged including the reason provided. Further, if
@@ -484,6 +619,13 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) *wire.MsgRej
 // to kick start communication with them.
 func (sp *serverPeer) OnVerAck(_ *peer.Peer, _ *wire.MsgVerAck) {
 	sp.server.AddPeer(sp)
+
+	// Pull the mempool contents from the primary when running as a hot
+	// standby so it is ready to take over.
+	sp.requestPrimaryMempool()
+
+	// Offer to reconcile transactions instead of flooding them.
+	sp.sendTxRcncl()
 }
 
 // OnMemPool is invoked when a peer receives a mempool bitcoin message.
@@ -500,12 +642,6 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 		return
 	}
 
-	// A decaying ban score increase is applied to prevent flooding.
-	// The ban score accumulates and passes the ban threshold if a burst of
-	// mempool messages comes from a peer. The score decays each minute to
-	// half of its value.
-	sp.addBanScore(0, 33, "mempool")
-
 	// Generate inventory message with the available transactions in the
 	// transaction memory pool.  Limit it to the max allowed inventory
 	// per message.  The NewMsgInvSizeHint function automatically limits
@@ -551,6 +687,7 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx) {
 	tx := btcutil.NewTx(msg)
 	iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
 	sp.AddKnownInventory(iv)
+	sp.removeReconTx(tx.Hash())
 
 	// Queue the transaction up to be handled by the sync manager and
 	// intentionally block further receives until the transaction is fully
@@ -592,6 +729,16 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 // accordingly.  We pass the message down to blockmanager which will call
 // QueueMessage with any appropriate responses.
 func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
+	// Transactions announced by the peer no longer need to be reconciled
+	// with it.
+	if sp.reconState() != nil {
+		for _, invVect := range msg.InvList {
+			if invVect.Type == wire.InvTypeTx {
+				sp.removeReconTx(&invVect.Hash)
+			}
+		}
+	}
+
 	if !cfg.BlocksOnly {
 		if len(msg.InvList) > 0 {
 			sp.server.syncManager.QueueInv(msg, sp.Peer)
@@ -666,8 +813,14 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 		switch iv.Type {
 		case wire.InvTypeWitnessTx:
 			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
+			if err == nil {
+				sp.server.RemoveRebroadcastInventory(iv)
+			}
 		case wire.InvTypeTx:
 			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan, wire.BaseEncoding)
+			if err == nil {
+				sp.server.RemoveRebroadcastInventory(iv)
+			}
 		case wire.InvTypeWitnessBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan, wire.WitnessEncoding)
 		case wire.InvTypeBlock:
@@ -767,339 +920,131 @@ func (sp *serverPeer) OnGetHeaders(_ *peer.Peer, msg *wire.MsgGetHeaders) {
 	// over with the genesis block if unknown block locators are provided.
 	//
 	// This mirrors the behavior in the reference implementation.
+	//
+	// The headers are located into a reusable response which is returned to
+	// the pool once it has been sent.
 	chain := sp.server.chain
-	headers := chain.LocateHeaders(msg.BlockLocatorHashes, &msg.HashStop)
+	resp := headersResponsePool.Get().(*headersResponse)
+	resp.headers = chain.LocateHeadersInto(msg.BlockLocatorHashes,
+		&msg.HashStop, resp.headers[:0])
 
 	// Send found headers to the requesting peer.
-	blockHeaders := make([]*wire.BlockHeader, len(headers))
-	for i := range headers {
-		blockHeaders[i] = &headers[i]
+	resp.msg.Headers = resp.msg.Headers[:0]
+	for i := range resp.headers {
+		resp.msg.Headers = append(resp.msg.Headers, &resp.headers[i])
 	}
-	sp.QueueMessage(&wire.MsgHeaders{Headers: blockHeaders}, nil)
+	sp.QueueMessage(&resp.msg, resp.done)
+	go func() {
+		<-resp.done
+		headersResponsePool.Put(resp)
+	}()
 }
 
-// OnGetCFilters is invoked when a peer receives a getcfilters bitcoin message.
-func (sp *serverPeer) OnGetCFilters(_ *peer.Peer, msg *wire.MsgGetCFilters) {
-	// Ignore getcfilters requests if not in sync.
-	if !sp.server.syncManager.IsCurrent() {
-		return
-	}
-
-	// We'll also ensure that the remote party is requesting a set of
-	// filters that we actually currently maintain.
-	switch msg.FilterType {
-	case wire.GCSFilterRegular:
-		break
-
-	default:
-		peerLog.Debug("Filter request for unknown filter: %v",
-			msg.FilterType)
-		return
-	}
-
-	hashes, err := sp.server.chain.HeightToHashRange(
-		int32(msg.StartHeight), &msg.StopHash, wire.MaxGetCFiltersReqRange,
-	)
-	if err != nil {
-		peerLog.Debugf("Invalid getcfilters request: %v", err)
-		return
-	}
-
-	// Create []*chainhash.Hash from []chainhash.Hash to pass to
-	// FiltersByBlockHashes.
-	hashPtrs := make([]*chainhash.Hash, len(hashes))
-	for i := range hashes {
-		hashPtrs[i] = &hashes[i]
-	}
-
-	filters, err := sp.server.cfIndex.FiltersByBlockHashes(
-		hashPtrs, msg.FilterType,
-	)
-	if err != nil {
-		peerLog.Errorf("Error retrieving cfilters: %v", err)
-		return
-	}
-
-	for i, filterBytes := range filters {
-		if len(filterBytes) == 0 {
-			peerLog.Warnf("Could not obtain cfilter for %v",
-				hashes[i])
-			return
-		}
-
-		filterMsg := wire.NewMsgCFilter(
-			msg.FilterType, &hashes[i], filterBytes,
-		)
-		sp.QueueMessage(filterMsg, nil)
-	}
+// headersResponse is a reusable response to a getheaders request.  The headers
+// are located into a buffer preallocated for the maximum number of headers per
+// message, so serving headers to many syncing peers doesn't allocate.
+type headersResponse struct {
+	headers []wire.BlockHeader
+	msg     wire.MsgHeaders
+	done    chan struct{}
 }
 
-// OnGetCFHeaders is invoked when a peer receives a getcfheader bitcoin message.
-func (sp *serverPeer) OnGetCFHeaders(_ *peer.Peer, msg *wire.MsgGetCFHeaders) {
-	// Ignore getcfilterheader requests if not in sync.
-	if !sp.server.syncManager.IsCurrent() {
-		return
-	}
-
-	// We'll also ensure that the remote party is requesting a set of
-	// headers for filters that we actually currently maintain.
-	switch msg.FilterType {
-	case wire.GCSFilterRegular:
-		break
-
-	default:
-		peerLog.Debug("Filter request for unknown headers for "+
-			"filter: %v", msg.FilterType)
-		return
-	}
-
-	startHeight := int32(msg.StartHeight)
-	maxResults := wire.MaxCFHeadersPerMsg
-
-	// If StartHeight is positive, fetch the predecessor block hash so we
-	// can populate the PrevFilterHeader field.
-	if msg.StartHeight > 0 {
-		startHeight--
-		maxResults++
-	}
-
-	// Fetch the hashes from the block index.
-	hashList, err := sp.server.chain.HeightToHashRange(
-		startHeight, &msg.StopHash, maxResults,
-	)
-	if err != nil {
-		peerLog.Debugf("Invalid getcfheaders request: %v", err)
-	}
-
-	// This is possible if StartHeight is one greater that the height of
-	// StopHash, and we pull a valid range of hashes including the previous
-	// filter header.
-	if len(hashList) == 0 || (msg.StartHeight > 0 && len(hashList) == 1) {
-		peerLog.Debug("No results for getcfheaders request")
-		return
-	}
-
-	// Create []*chainhash.Hash from []chainhash.Hash to pass to
-	// FilterHeadersByBlockHashes.
-	hashPtrs := make([]*chainhash.Hash, len(hashList))
-	for i := range hashList {
-		hashPtrs[i] = &hashList[i]
-	}
-
-	// Fetch the raw filter hash bytes from the database for all blocks.
-	filterHashes, err := sp.server.cfIndex.FilterHashesByBlockHashes(
-		hashPtrs, msg.FilterType,
-	)
-	if err != nil {
-		peerLog.Errorf("Error retrieving cfilter hashes: %v", err)
-		return
-	}
-
-	// Generate cfheaders message and send it.
-	headersMsg := wire.NewMsgCFHeaders()
-
-	// Populate the PrevFilterHeader field.
-	if msg.StartHeight > 0 {
-		prevBlockHash := &hashList[0]
-
-		// Fetch the raw committed filter header bytes from the
-		// database.
-		headerBytes, err := sp.server.cfIndex.FilterHeaderByBlockHash(
-			prevBlockHash, msg.FilterType)
-		if err != nil {
-			peerLog.Errorf("Error retrieving CF header: %v", err)
-			return
-		}
-		if len(headerBytes) == 0 {
-			peerLog.Warnf("Could not obtain CF header for %v", prevBlockHash)
-			return
-		}
-
-		// Deserialize the hash into PrevFilterHeader.
-		err = headersMsg.PrevFilterHeader.SetBytes(headerBytes)
-		if err != nil {
-			peerLog.Warnf("Committed filter header deserialize "+
-				"failed: %v", err)
-			return
-		}
-
-		hashList = hashList[1:]
-		filterHashes = filterHashes[1:]
-	}
-
-	// Populate HeaderHashes.
-	for i, hashBytes := range filterHashes {
-		if len(hashBytes) == 0 {
-			peerLog.Warnf("Could not obtain CF hash for %v", hashList[i])
-			return
-		}
-
-		// Deserialize the hash.
-		filterHash, err := chainhash.NewHash(hashBytes)
-		if err != nil {
-			peerLog.Warnf("Committed filter hash deserialize "+
-				"failed: %v", err)
-			return
+// headersResponsePool is the pool of responses to getheaders requests.
+var headersResponsePool = sync.Pool{
+	New: func() interface{} {
+		return &headersResponse{
+			headers: make([]wire.BlockHeader, 0,
+				wire.MaxBlockHeadersPerMsg),
+			msg: wire.MsgHeaders{
+				Headers: make([]*wire.BlockHeader, 0,
+					wire.MaxBlockHeadersPerMsg),
+			},
+			done: make(chan struct{}, 1),
 		}
-
-		headersMsg.AddCFHash(filterHash)
-	}
-
-	headersMsg.FilterType = msg.FilterType
-	headersMsg.StopHash = msg.StopHash
-
-	sp.QueueMessage(headersMsg, nil)
+	},
 }
 
-// OnGetCFCheckpt is invoked when a peer receives a getcfcheckpt bitcoin message.
-func (sp *serverPeer) OnGetCFCheckpt(_ *peer.Peer, msg *wire.MsgGetCFCheckpt) {
-	// Ignore getcfcheckpt requests if not in sync.
-	if !sp.server.syncManager.IsCurrent() {
-		return
-	}
-
-	// We'll also ensure that the remote party is requesting a set of
-	// checkpoints for filters that we actually currently maintain.
-	switch msg.FilterType {
-	case wire.GCSFilterRegular:
-		break
-
-	default:
-		peerLog.Debug("Filter request for unknown checkpoints for "+
-			"filter: %v", msg.FilterType)
-		return
-	}
-
-	// Now that we know the client is fetching a filter that we know of,
-	// we'll fetch the block hashes et each check point interval so we can
-	// compare against our cache, and create new check points if necessary.
-	blockHashes, err := sp.server.chain.IntervalBlockHashes(
-		&msg.StopHash, wire.CFCheckptInterval,
-	)
-	if err != nil {
-		peerLog.Debugf("Invalid getcfilters request: %v", err)
-		return
-	}
+// cfilterSource implements the peer.FilterSource interface using the chain and
+// the committed filter index of the server so peers natively serve getcfilters,
+// getcfheaders, and getcfcheckpt requests.
+type cfilterSource struct {
+	server *server
+}
 
-	checkptMsg := wire.NewMsgCFCheckpt(
-		msg.FilterType, &msg.StopHash, len(blockHashes),
-	)
+// Ensure cfilterSource implements the peer.FilterSource interface.
+var _ peer.FilterSource = (*cfilterSource)(nil)
 
-	// Fetch the current existing cache so we can decide if we need to
-	// extend it or if its adequate as is.
-	sp.server.cfCheckptCachesMtx.RLock()
-	checkptCache := sp.server.cfCheckptCaches[msg.FilterType]
+// IsCurrent returns whether the chain is synced well enough to serve filters.
+//
+// This is part of the peer.FilterSource interface.
+func (cs *cfilterSource) IsCurrent() bool {
+	return cs.server.syncManager.IsCurrent()
+}
 
-	// If the set of block hashes is beyond the current size of the cache,
-	// then we'll expand the size of the cache and also retain the write
-	// lock.
-	var updateCache bool
-	if len(blockHashes) > len(checkptCache) {
-		// Now that we know we'll need to modify the size of the cache,
-		// we'll release the read lock and grab the write lock to
-		// possibly expand the cache size.
-		sp.server.cfCheckptCachesMtx.RUnlock()
+// SupportsFilterType returns whether filters of the passed type are maintained
+// by the committed filter index.
+//
+// This is part of the peer.FilterSource interface.
+func (cs *cfilterSource) SupportsFilterType(filterType wire.FilterType) bool {
+	return filterType == wire.GCSFilterRegular
+}
 
-		sp.server.cfCheckptCachesMtx.Lock()
-		defer sp.server.cfCheckptCachesMtx.Unlock()
+// HeightToHashRange returns the hashes of the main chain blocks from the passed
+// start height up to and including the passed stop hash.
+//
+// This is part of the peer.FilterSource interface.
+func (cs *cfilterSource) HeightToHashRange(startHeight int32,
+	stopHash *chainhash.Hash, maxResults int) ([]chainhash.Hash, error) {
 
-		// Now that we have the write lock, we'll check again as it's
-		// possible that the cache has already been expanded.
-		checkptCache = sp.server.cfCheckptCaches[msg.FilterType]
+	return cs.server.chain.HeightToHashRange(startHeight, stopHash,
+		maxResults)
+}
 
-		// If we still need to expand the cache, then We'll mark that
-		// we need to update the cache for below and also expand the
-		// size of the cache in place.
-		if len(blockHashes) > len(checkptCache) {
-			updateCache = true
+// FiltersByBlockHashes returns the serialized filters of the passed type for
+// the passed blocks.
+//
+// This is part of the peer.FilterSource interface.
+func (cs *cfilterSource) FiltersByBlockHashes(blockHashes []*chainhash.Hash,
+	filterType wire.FilterType) ([][]byte, error) {
 
-			additionalLength := len(blockHashes) - len(checkptCache)
-			newEntries := make([]cfHeaderKV, additionalLength)
+	return cs.server.cfIndex.FiltersByBlockHashes(blockHashes, filterType)
+}
 
-			peerLog.Infof("Growing size of checkpoint cache from %v to %v "+
-				"block hashes", len(checkptCache), len(blockHashes))
+// FilterHashesByBlockHashes returns the serialized filter hashes of the passed
+// type for the passed blocks.
+//
+// This is part of the peer.FilterSource interface.
+func (cs *cfilterSource) FilterHashesByBlockHashes(blockHashes []*chainhash.Hash,
+	filterType wire.FilterType) ([][]byte, error) {
 
-			checkptCache = append(
-				sp.server.cfCheckptCaches[msg.FilterType],
-				newEntries...,
-			)
-		}
-	} else {
-		// Otherwise, we'll hold onto the read lock for the remainder
-		// of this method.
-		defer sp.server.cfCheckptCachesMtx.RUnlock()
+	return cs.server.cfIndex.FilterHashesByBlockHashes(blockHashes,
+		filterType)
+}
 
-		peerLog.Tracef("Serving stale cache of size %v",
-			len(checkptCache))
-	}
+// FilterHeaderByBlockHash returns the serialized filter header of the passed
+// type for the passed block.
+//
+// This is part of the peer.FilterSource interface.
+func (cs *cfilterSource) FilterHeaderByBlockHash(blockHash *chainhash.Hash,
+	filterType wire.FilterType) ([]byte, error) {
 
-	// Now that we know the cache is of an appropriate size, we'll iterate
-	// backwards until the find the block hash. We do this as it's possible
-	// a re-org has occurred so items in the db are now in the main china
-	// while the cache has been partially invalidated.
-	var forkIdx int
-	for forkIdx = len(blockHashes); forkIdx > 0; forkIdx-- {
-		if checkptCache[forkIdx-1].blockHash == blockHashes[forkIdx-1] {
-			break
-		}
-	}
+	return cs.server.cfIndex.FilterHeaderByBlockHash(blockHash, filterType)
+}
 
-	// Now that we know the how much of the cache is relevant for this
-	// query, we'll populate our check point message with the cache as is.
-	// Shortly below, we'll populate the new elements of the cache.
-	for i := 0; i < forkIdx; i++ {
-		checkptMsg.AddCFHeader(&checkptCache[i].filterHeader)
-	}
+// FilterCheckpoints returns the filter headers of the passed type at each
+// checkpoint interval of the main chain up to the passed stop hash.  The
+// headers are recorded by the committed filter index as blocks are connected.
+//
+// This is part of the peer.FilterSource interface.
+func (cs *cfilterSource) FilterCheckpoints(stopHash *chainhash.Hash,
+	filterType wire.FilterType) ([]chainhash.Hash, error) {
 
-	// We'll now collect the set of hashes that are beyond our cache so we
-	// can look up the filter headers to populate the final cache.
-	blockHashPtrs := make([]*chainhash.Hash, 0, len(blockHashes)-forkIdx)
-	for i := forkIdx; i < len(blockHashes); i++ {
-		blockHashPtrs = append(blockHashPtrs, &blockHashes[i])
-	}
-	filterHeaders, err := sp.server.cfIndex.FilterHeadersByBlockHashes(
-		blockHashPtrs, msg.FilterType,
-	)
+	s := cs.server
+	stopHeight, err := s.chain.BlockHeightByHash(stopHash)
 	if err != nil {
-		peerLog.Errorf("Error retrieving cfilter headers: %v", err)
-		return
-	}
-
-	// Now that we have the full set of filter headers, we'll add them to
-	// the checkpoint message, and also update our cache in line.
-	for i, filterHeaderBytes := range filterHeaders {
-		if len(filterHeaderBytes) == 0 {
-			peerLog.Warnf("Could not obtain CF header for %v",
-				blockHashPtrs[i])
-			return
-		}
-
-		filterHeader, err := chainhash.NewHash(filterHeaderBytes)
-		if err != nil {
-			peerLog.Warnf("Committed filter header deserialize "+
-				"failed: %v", err)
-			return
-		}
-
-		checkptMsg.AddCFHeader(filterHeader)
-
-		// If the new main chain is longer than what's in the cache,
-		// then we'll override it beyond the fork point.
-		if updateCache {
-			checkptCache[forkIdx+i] = cfHeaderKV{
-				blockHash:    blockHashes[forkIdx+i],
-				filterHeader: *filterHeader,
-			}
-		}
-	}
-
-	// Finally, we'll update the cache if we need to, and send the final
-	// message back to the requesting peer.
-	if updateCache {
-		sp.server.cfCheckptCaches[msg.FilterType] = checkptCache
+		return nil, err
 	}
-
-	sp.QueueMessage(checkptMsg, nil)
+	return s.cfIndex.FilterCheckpoints(stopHeight, filterType)
 }
 
 // enforceNodeBloomFlag disconnects the peer if the server is not configured to
@@ -1241,6 +1186,13 @@ func (sp *serverPeer) OnGetAddr(_ *peer.Peer, msg *wire.MsgGetAddr) {
 	}
 	sp.sentAddrs = true
 
+	// Peers which want addrv2 messages are also sent the addresses which
+	// can't be encoded in addr messages.
+	if sp.WantsAddrV2() {
+		sp.pushAddrV2Msg(sp.server.addrManager.AddressCacheV2())
+		return
+	}
+
 	// Get the current known addresses from the address manager.
 	addrCache := sp.server.addrManager.AddressCache()
 
@@ -1298,6 +1250,50 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 	sp.server.addrManager.AddAddresses(msg.AddrList, sp.NA())
 }
 
+// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message and is
+// used to notify the server about advertised addresses, including the ones of
+// networks which can't be encoded in addr messages such as Tor v3, I2P, and
+// CJDNS.
+func (sp *serverPeer) OnAddrV2(_ *peer.Peer, msg *wire.MsgAddrV2) {
+	// Ignore addresses when running on the simulation test network.  This
+	// helps prevent the network from becoming another public test network
+	// since it will not be able to learn about other peers that have not
+	// specifically been provided.
+	if cfg.SimNet {
+		return
+	}
+
+	// A message that has no addresses is invalid.
+	if len(msg.AddrList) == 0 {
+		peerLog.Errorf("Command [%s] from %s does not contain any addresses",
+			msg.Command(), sp.Peer)
+		sp.Disconnect()
+		return
+	}
+
+	for _, na := range msg.AddrList {
+		// Don't add more address if we're disconnecting.
+		if !sp.Connected() {
+			return
+		}
+
+		// Set the timestamp to 5 days ago if it's more than 24 hours
+		// in the future so this address is one of the first to be
+		// removed when space is needed.
+		now := time.Now()
+		if na.Timestamp.After(now.Add(time.Minute * 10)) {
+			na.Timestamp = now.Add(-1 * time.Hour * 24 * 5)
+		}
+	}
+
+	// Add addresses to known addresses for this peer.
+	sp.addKnownAddressesV2(msg.AddrList)
+
+	// Add addresses to server address manager.  Addresses of unknown
+	// networks are ignored by the address manager.
+	sp.server.addrManager.AddAddressesV2(msg.AddrList, sp.NA())
+}
+
 // OnRead is invoked when a peer receives a message and it is used to update
 // the bytes received by the server.
 func (sp *serverPeer) OnRead(_ *peer.Peer, bytesRead int, msg wire.Message, err error) {
@@ -1329,14 +1325,18 @@ func randomUint16Number(max uint16) uint16 {
 }
 
 // AddRebroadcastInventory adds 'iv' to the list of inventories to be
-// rebroadcasted at random intervals until they show up in a block.
+// rebroadcasted at random intervals until a peer requests them.  Only
+// transactions are rebroadcast, which are tracked by the unbroadcast set of the
+// mempool so they are also forgotten once they leave it.
 func (s *server) AddRebroadcastInventory(iv *wire.InvVect, data interface{}) {
 	// Ignore if shutting down.
 	if atomic.LoadInt32(&s.shutdown) != 0 {
 		return
 	}
 
-	s.modifyRebroadcastInv <- broadcastInventoryAdd{invVect: iv, data: data}
+	if iv.Type == wire.InvTypeTx || iv.Type == wire.InvTypeWitnessTx {
+		s.txMemPool.AddUnbroadcastTx(&iv.Hash)
+	}
 }
 
 // RemoveRebroadcastInventory removes 'iv' from the list of items to be
@@ -1347,7 +1347,9 @@ func (s *server) RemoveRebroadcastInventory(iv *wire.InvVect) {
 		return
 	}
 
-	s.modifyRebroadcastInv <- broadcastInventoryDel(iv)
+	if iv.Type == wire.InvTypeTx || iv.Type == wire.InvTypeWitnessTx {
+		s.txMemPool.RemoveUnbroadcastTx(&iv.Hash)
+	}
 }
 
 // relayTransactions generates and relays inventory vectors for all of the
@@ -1368,6 +1370,29 @@ func (s *server) AnnounceNewTransactions(txns []*mempool.TxDesc) {
 	// transactions.
 	s.relayTransactions(txns)
 
+	// Notify the plugins about the newly accepted transactions.
+	for _, txD := range txns {
+		s.plugins.TxAccepted(txD.Tx)
+	}
+
+	// Inspect the transactions for the use of unknown witness versions.
+	if s.witnessTelemetry != nil {
+		txs := make([]*btcutil.Tx, 0, len(txns))
+		for _, txD := range txns {
+			txs = append(txs, txD.Tx)
+		}
+		s.witnessTelemetry.ObserveTxs(txs)
+	}
+
+	// Trace the transactions which pay to the traced addresses.
+	if logTraceTargets.Active() {
+		txs := make([]*btcutil.Tx, 0, len(txns))
+		for _, txD := range txns {
+			txs = append(txs, txD.Tx)
+		}
+		logTraceTargets.ObserveTxns(txs, s.chainParams)
+	}
+
 	// Notify both websocket and getblocktemplate long poll clients of all
 	// newly accepted transactions.
 	if s.rpcServer != nil {
@@ -1627,7 +1652,7 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	if sp.Inbound() {
 		state.inboundPeers[sp.ID()] = sp
 	} else {
-		state.outboundGroups[addrmgr.GroupKey(sp.NA())]++
+		state.outboundGroups[s.addrManager.GroupKey(sp.NA())]++
 		if sp.persistent {
 			state.persistentPeers[sp.ID()] = sp
 		} else {
@@ -1671,10 +1696,18 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 			sp.QueueMessage(wire.NewMsgGetAddr(), nil)
 		}
 
-		// Mark the address as a known good address.
-		s.addrManager.Good(sp.NA())
+		// Mark the address as a known good address along with the
+		// time the version handshake took as the latency of the
+		// connection.
+		s.addrManager.GoodEvent(sp.NA(), addrmgr.AddressEvent{
+			Reason:  addrmgr.ReasonHandshake,
+			Latency: time.Since(sp.TimeConnected()),
+		})
 	}
 
+	// Notify the plugins about the new peer.
+	s.plugins.PeerConnected(sp.Peer)
+
 	return true
 }
 
@@ -1702,9 +1735,20 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 		}
 	}
 
+	// The time sample of the peer no longer reflects a connected peer.
+	s.timeSource.RemoveTimeSample(sp.Addr())
+
+	// Lower the chance of selecting the address of an outbound peer again
+	// when it disconnected before completing the version handshake.
+	if !cfg.SimNet && !sp.Inbound() && !sp.VerAckReceived() && sp.NA() != nil {
+		s.addrManager.AttemptEvent(sp.NA(), addrmgr.AddressEvent{
+			Reason: addrmgr.ReasonHandshakeFailed,
+		})
+	}
+
 	if _, ok := list[sp.ID()]; ok {
 		if !sp.Inbound() && sp.VersionKnown() {
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		}
 		delete(list, sp.ID())
 		srvrLog.Debugf("Removed peer %s", sp)
@@ -1724,11 +1768,27 @@ func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
 	srvrLog.Infof("Banned peer %s (%s) for %v", host, direction,
 		cfg.BanDuration)
 	state.banned[host] = time.Now().Add(cfg.BanDuration)
+
+	// Lower the chance of selecting the address of a misbehaving outbound
+	// peer again.
+	if !sp.Inbound() && sp.NA() != nil {
+		s.addrManager.AttemptEvent(sp.NA(), addrmgr.AddressEvent{
+			Reason: addrmgr.ReasonMisbehavior,
+		})
+	}
 }
 
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
 // known to have it.  It is invoked from the peerHandler goroutine.
 func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
+	// Keep track of how the relay of transactions submitted with a
+	// correlation id is scheduled so it can be traced in the logs.
+	var correlationID string
+	if txD, ok := msg.data.(*mempool.TxDesc); ok {
+		correlationID = txD.CorrelationID
+	}
+	var numAnnounced, numReconciled int
+
 	state.forAllPeers(func(sp *serverPeer) {
 		if !sp.Connected() {
 			return
@@ -1783,6 +1843,15 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 					return
 				}
 			}
+
+			// Queue the transaction for the next reconciliation
+			// round rather than announcing it when the peer
+			// supports transaction reconciliation.
+			if sp.addReconTx(txD.Tx) {
+				numReconciled++
+				return
+			}
+			numAnnounced++
 		}
 
 		// Queue the inventory to be relayed with the next batch.
@@ -1790,6 +1859,13 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 		// have the inventory.
 		sp.QueueInventory(msg.invVect)
 	})
+
+	if correlationID != "" {
+		srvrLog.Debugf("Scheduled relay of transaction %v%s to %d peers "+
+			"by announcement and %d peers by reconciliation",
+			msg.invVect.Hash, correlationSuffix(correlationID),
+			numAnnounced, numReconciled)
+	}
 }
 
 // handleBroadcastMsg deals with broadcasting messages to peers.  It is invoked
@@ -1823,6 +1899,10 @@ type getOutboundGroup struct {
 	reply chan int
 }
 
+type getOutboundGroupsMsg struct {
+	reply chan map[string]int
+}
+
 type getAddedNodesMsg struct {
 	reply chan []*serverPeer
 }
@@ -1900,7 +1980,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		found := disconnectPeer(state.persistentPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 
 		if found {
@@ -1915,6 +1995,14 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		} else {
 			msg.reply <- 0
 		}
+	case getOutboundGroupsMsg:
+		groups := make(map[string]int, len(state.outboundGroups))
+		for key, count := range state.outboundGroups {
+			if count > 0 {
+				groups[key] = count
+			}
+		}
+		msg.reply <- groups
 	// Request a list of the persistent (added) peers.
 	case getAddedNodesMsg:
 		// Respond with a slice of the relevant peers.
@@ -1936,7 +2024,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 		if found {
 			// If there are multiple outbound connections to the same
@@ -1944,7 +2032,7 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 			// peers are found.
 			for found {
 				found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
-					state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+					state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 				})
 			}
 			msg.reply <- nil
@@ -1981,7 +2069,7 @@ func disconnectPeer(peerList map[int32]*serverPeer, compareFunc func(*serverPeer
 
 // newPeerConfig returns the configuration for the given serverPeer.
 func newPeerConfig(sp *serverPeer) *peer.Config {
-	return &peer.Config{
+	cfg := &peer.Config{
 		Listeners: peer.MessageListeners{
 			OnVersion:      sp.OnVersion,
 			OnVerAck:       sp.OnVerAck,
@@ -1993,17 +2081,19 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnGetData:      sp.OnGetData,
 			OnGetBlocks:    sp.OnGetBlocks,
 			OnGetHeaders:   sp.OnGetHeaders,
-			OnGetCFilters:  sp.OnGetCFilters,
-			OnGetCFHeaders: sp.OnGetCFHeaders,
-			OnGetCFCheckpt: sp.OnGetCFCheckpt,
 			OnFeeFilter:    sp.OnFeeFilter,
 			OnFilterAdd:    sp.OnFilterAdd,
 			OnFilterClear:  sp.OnFilterClear,
 			OnFilterLoad:   sp.OnFilterLoad,
 			OnGetAddr:      sp.OnGetAddr,
 			OnAddr:         sp.OnAddr,
+			OnAddrV2:       sp.OnAddrV2,
 			OnRead:         sp.OnRead,
 			OnWrite:        sp.OnWrite,
+			OnSendTxRcncl:  sp.OnSendTxRcncl,
+			OnReqRecon:     sp.OnReqRecon,
+			OnSketch:       sp.OnSketch,
+			OnReconcilDiff: sp.OnReconcilDiff,
 
 			// Note: The reference client currently bans peers that send alerts
 			// not signed with its key.  We could verify against their key, but
@@ -2022,14 +2112,85 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 		DisableRelayTx:    cfg.BlocksOnly,
 		ProtocolVersion:   peer.MaxProtocolVersion,
 		TrickleInterval:   cfg.TrickleInterval,
-	}
-}
+		V2Transport:       cfg.V2Transport,
+		RateLimits:        cfg.rateLimits,
+		AddBanScore: func(_ *peer.Peer, persistent, transient uint32,
+			reason string) {
 
-// inboundPeerConnected is invoked by the connection manager when a new inbound
+			sp.addBanScore(persistent, transient, reason)
+		},
+		OnRequestTimeout: func(p *peer.Peer, timeout *peer.RequestTimeout) {
+			sp.server.syncManager.RequestTimedOut(p, timeout)
+		},
+		FilterSource: sp.server.cfilterSource,
+	}
+	if sp.server.netLog != nil {
+		cfg.MessageTap = sp.server.netLog
+	}
+	return cfg
+}
+
+// isV1OnlyAddr returns whether or not a previous attempt to use the v2
+// transport with the peer at the passed address failed and has not expired
+// yet.
+func (s *server) isV1OnlyAddr(addr string) bool {
+	s.v1OnlyAddrsMtx.Lock()
+	defer s.v1OnlyAddrsMtx.Unlock()
+
+	expiry, ok := s.v1OnlyAddrs[addr]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expiry) {
+		delete(s.v1OnlyAddrs, addr)
+		return false
+	}
+	return true
+}
+
+// addV1OnlyAddr remembers the peer at the passed address failed the v2
+// transport handshake.  Expired addresses are removed when the limit of
+// remembered addresses is reached, and the address which expires first is
+// evicted when none expired.
+func (s *server) addV1OnlyAddr(addr string) {
+	s.v1OnlyAddrsMtx.Lock()
+	defer s.v1OnlyAddrsMtx.Unlock()
+
+	now := time.Now()
+	if _, ok := s.v1OnlyAddrs[addr]; !ok &&
+		len(s.v1OnlyAddrs) >= maxV1OnlyAddrs {
+
+		var oldestAddr string
+		var oldestExpiry time.Time
+		for a, expiry := range s.v1OnlyAddrs {
+			if now.After(expiry) {
+				delete(s.v1OnlyAddrs, a)
+				continue
+			}
+			if oldestAddr == "" || expiry.Before(oldestExpiry) {
+				oldestAddr, oldestExpiry = a, expiry
+			}
+		}
+		if len(s.v1OnlyAddrs) >= maxV1OnlyAddrs {
+			delete(s.v1OnlyAddrs, oldestAddr)
+		}
+	}
+	s.v1OnlyAddrs[addr] = now.Add(v1OnlyAddrExpiry)
+}
+
+// inboundPeerConnected is invoked by the connection manager when a new inbound
 // connection is established.  It initializes a new inbound server peer
 // instance, associates it with the connection, and starts a goroutine to wait
 // for disconnection.
 func (s *server) inboundPeerConnected(conn net.Conn) {
+	// Hot standby instances do not serve inbound peers until promoted.
+	if s.standby.IsStandby() {
+		srvrLog.Debugf("Rejecting inbound connection from %s while in "+
+			"standby mode", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
 	sp := newServerPeer(s, false)
 	sp.isWhitelisted = isWhitelisted(conn.RemoteAddr())
 	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp))
@@ -2044,7 +2205,11 @@ func (s *server) inboundPeerConnected(conn net.Conn) {
 // manager of the attempt.
 func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	sp := newServerPeer(s, c.Permanent)
-	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
+	peerCfg := newPeerConfig(sp)
+	if peerCfg.V2Transport && s.isV1OnlyAddr(c.Addr.String()) {
+		peerCfg.V2Transport = false
+	}
+	p, err := peer.NewOutboundPeer(peerCfg, c.Addr.String())
 	if err != nil {
 		srvrLog.Debugf("Cannot create outbound peer %s: %v", c.Addr, err)
 		if c.Permanent {
@@ -2068,6 +2233,13 @@ func (s *server) peerDoneHandler(sp *serverPeer) {
 	sp.WaitForDisconnect()
 	s.donePeers <- sp
 
+	// Remember peers which do not support the v2 transport so the next
+	// connection attempt falls back to the v1 transport.
+	if sp.V2HandshakeFailed() {
+		srvrLog.Debugf("Falling back to v1 transport for peer %s", sp)
+		s.addV1OnlyAddr(sp.Addr())
+	}
+
 	// Only tell sync manager we are gone if we ever told it we existed.
 	if sp.VerAckReceived() {
 		s.syncManager.DonePeer(sp.Peer)
@@ -2256,38 +2428,74 @@ func (s *server) UpdatePeerHeights(latestBlkHash *chainhash.Hash, latestHeight i
 	}
 }
 
-// rebroadcastHandler keeps track of user submitted inventories that we have
-// sent out but have not yet made it into a block. We periodically rebroadcast
-// them in case our peers restarted or otherwise lost track of them.
-func (s *server) rebroadcastHandler() {
-	// Wait 5 min before first tx rebroadcast.
-	timer := time.NewTimer(5 * time.Minute)
-	pendingInvs := make(map[wire.InvVect]interface{})
+// clockOffsetHandler periodically replaces the time samples of the connected
+// peers, which are taken from the timestamp of their version message, with
+// their clock offsets as estimated from the ping round trips, so the time
+// manager uses the most accurate offsets available.  It must be run as a
+// goroutine.
+func (s *server) clockOffsetHandler() {
+	ticker := time.NewTicker(clockOffsetCheckInterval)
+	defer ticker.Stop()
 
 out:
 	for {
 		select {
-		case riv := <-s.modifyRebroadcastInv:
-			switch msg := riv.(type) {
-			// Incoming InvVects are added to our map of RPC txs.
-			case broadcastInventoryAdd:
-				pendingInvs[*msg.invVect] = msg.data
-
-			// When an InvVect has been added to a block, we can
-			// now remove it, if it was present.
-			case broadcastInventoryDel:
-				if _, ok := pendingInvs[*msg]; ok {
-					delete(pendingInvs, *msg)
+		case <-ticker.C:
+			replyChan := make(chan []*serverPeer)
+			select {
+			case s.query <- getPeersMsg{reply: replyChan}:
+			case <-s.quit:
+				break out
+			}
+			peers := <-replyChan
+
+			for _, sp := range peers {
+				if sp.VerAckReceived() {
+					s.timeSource.UpdateTimeSample(sp.Addr(),
+						sp.ClockOffset())
 				}
 			}
 
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.wg.Done()
+}
+
+// spendJournalMigrationHandler migrates any spend journal entries that are
+// still stored in the legacy format in the background.  It must be run as a
+// goroutine.
+func (s *server) spendJournalMigrationHandler() {
+	if err := s.chain.MigrateSpendJournal(s.quit); err != nil {
+		srvrLog.Errorf("Unable to migrate spend journal: %v", err)
+	}
+
+	s.wg.Done()
+}
+
+// rebroadcastHandler periodically rebroadcasts the user submitted transactions
+// in the unbroadcast set of the mempool, which no peer has requested yet, in
+// case our peers restarted or otherwise lost track of them.
+func (s *server) rebroadcastHandler() {
+	// Wait 5 min before first tx rebroadcast.
+	timer := time.NewTimer(5 * time.Minute)
+
+out:
+	for {
+		select {
 		case <-timer.C:
-			// Any inventory we have has not made it into a block
-			// yet. We periodically resubmit them until they have.
-			for iv, data := range pendingInvs {
-				ivCopy := iv
-				s.RelayInventory(&ivCopy, data)
+			// Any transaction left in the set has not been
+			// requested by a peer yet.  We periodically resubmit
+			// them until one does.
+			txns := s.txMemPool.UnbroadcastTxns()
+			if len(txns) > 0 {
+				srvrLog.Debugf("Rebroadcasting %d unbroadcast %s",
+					len(txns), pickNoun(uint64(len(txns)),
+						"transaction", "transactions"))
 			}
+			s.relayTransactions(txns)
 
 			// Process at a random time up to 30mins (in seconds)
 			// in the future.
@@ -2300,17 +2508,6 @@ out:
 	}
 
 	timer.Stop()
-
-	// Drain channels before exiting so nothing is left waiting around
-	// to send.
-cleanup:
-	for {
-		select {
-		case <-s.modifyRebroadcastInv:
-		default:
-			break cleanup
-		}
-	}
 	s.wg.Done()
 }
 
@@ -2326,30 +2523,91 @@ func (s *server) Start() {
 	// Server startup time. Used for the uptime command for uptime calculation.
 	s.startupTime = time.Now().Unix()
 
+	// Start the network log before any peers are connected.
+	if s.netLog != nil {
+		s.netLog.Start()
+	}
+
 	// Start the peer handler which in turn starts the address and block
 	// managers.
 	s.wg.Add(1)
 	go s.peerHandler()
 
+	if s.healthServer != nil {
+		s.healthServer.Start()
+	}
+
+	if s.partitionMonitor != nil {
+		s.partitionMonitor.Start()
+	}
+
+	s.wg.Add(1)
+	go s.clockOffsetHandler()
+
+	s.wg.Add(1)
+	go s.spendJournalMigrationHandler()
+
 	if s.nat != nil {
 		s.wg.Add(1)
 		go s.upnpUpdateThread()
 	}
 
+	if s.standby != nil {
+		s.standby.Start()
+	}
+
+	if s.witnessTelemetry != nil {
+		s.witnessTelemetry.Start()
+	}
+
+	if s.forkArchive != nil {
+		s.forkArchive.Start()
+	}
+
+	if s.attestor != nil {
+		s.attestor.Start()
+	}
+
+	s.plugins.Start(&plugins.Host{
+		ChainParams: s.chainParams,
+		Chain:       s.chain,
+		TxPool:      s.txMemPool,
+		DataDir:     cfg.DataDir,
+		Logger:      plugLog,
+	})
+
 	if !cfg.DisableRPC {
 		s.wg.Add(1)
 
 		// Start the rebroadcastHandler, which ensures user tx received by
-		// the RPC server are rebroadcast until being included in a block.
+		// the RPC server are rebroadcast until a peer requests them.
 		go s.rebroadcastHandler()
 
 		s.rpcServer.Start()
 	}
 
+	if s.grpcServer != nil {
+		s.grpcServer.Start()
+	}
+
+	if s.zmqNotifier != nil {
+		s.zmqNotifier.Start()
+	}
+
 	// Start the CPU miner if generation is enabled.
 	if cfg.Generate {
 		s.cpuMiner.Start()
 	}
+
+	// Start the stratum server if it is enabled.
+	if s.stratumServer != nil {
+		s.stratumServer.Start()
+	}
+
+	// Start the Stratum V2 template provider if it is enabled.
+	if s.sv2Server != nil {
+		s.sv2Server.Start()
+	}
 }
 
 // Stop gracefully shuts down the server by stopping and disconnecting all
@@ -2366,6 +2624,57 @@ func (s *server) Stop() error {
 	// Stop the CPU miner if needed
 	s.cpuMiner.Stop()
 
+	// Stop the stratum server if needed.
+	if s.stratumServer != nil {
+		s.stratumServer.Stop()
+	}
+
+	// Stop the Stratum V2 template provider if needed.
+	if s.sv2Server != nil {
+		s.sv2Server.Stop()
+	}
+
+	// Stop health checking the primary when running as a standby.
+	if s.standby != nil {
+		s.standby.Stop()
+	}
+
+	// Stop collecting witness upgrade telemetry.
+	if s.witnessTelemetry != nil {
+		s.witnessTelemetry.Stop()
+	}
+
+	if s.forkArchive != nil {
+		s.forkArchive.Stop()
+	}
+
+	// Stop signing attestations of the chain state.
+	if s.attestor != nil {
+		s.attestor.Stop()
+	}
+
+	s.plugins.Shutdown()
+
+	// Stop monitoring for partitions.
+	if s.partitionMonitor != nil {
+		s.partitionMonitor.Stop()
+	}
+
+	// Stop serving the health endpoints.
+	if s.healthServer != nil {
+		s.healthServer.Stop()
+	}
+
+	// Stop publishing ZMQ notifications.
+	if s.zmqNotifier != nil {
+		s.zmqNotifier.Stop()
+	}
+
+	// Stop serving the gRPC interface.
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
+
 	// Shutdown the RPC server if it's not disabled.
 	if !cfg.DisableRPC {
 		s.rpcServer.Stop()
@@ -2379,6 +2688,13 @@ func (s *server) Stop() error {
 		return nil
 	})
 
+	// Save the memory pool so it can be restored on the next start.
+	if s.mempoolLoaded {
+		if err := saveMempool(s.txMemPool, mempoolFilePath()); err != nil {
+			srvrLog.Errorf("Unable to save mempool: %v", err)
+		}
+	}
+
 	// Signal the remaining goroutines to quit.
 	close(s.quit)
 	return nil
@@ -2387,6 +2703,12 @@ func (s *server) Stop() error {
 // WaitForShutdown blocks until the main listener and peer handlers are stopped.
 func (s *server) WaitForShutdown() {
 	s.wg.Wait()
+
+	// Stop the network log once all peers are disconnected so their final
+	// messages are captured.
+	if s.netLog != nil {
+		s.netLog.Stop()
+	}
 }
 
 // ScheduleShutdown schedules a server shutdown after the specified duration.
@@ -2534,27 +2856,14 @@ func setupRPCListeners() ([]net.Listener, error) {
 	// Setup TLS if not disabled.
 	listenFunc := net.Listen
 	if !cfg.DisableTLS {
-		// Generate the TLS cert and key file if both don't already
-		// exist.
-		if !fileExists(cfg.RPCKey) && !fileExists(cfg.RPCCert) {
-			err := genCertPair(cfg.RPCCert, cfg.RPCKey)
-			if err != nil {
-				return nil, err
-			}
-		}
-		keypair, err := tls.LoadX509KeyPair(cfg.RPCCert, cfg.RPCKey)
+		tlsConfig, err := rpcTLSConfig()
 		if err != nil {
 			return nil, err
 		}
 
-		tlsConfig := tls.Config{
-			Certificates: []tls.Certificate{keypair},
-			MinVersion:   tls.VersionTLS12,
-		}
-
 		// Change the standard net.Listen function to the tls one.
 		listenFunc = func(net string, laddr string) (net.Listener, error) {
-			return tls.Listen(net, laddr, &tlsConfig)
+			return tls.Listen(net, laddr, tlsConfig)
 		}
 	}
 
@@ -2576,6 +2885,49 @@ func setupRPCListeners() ([]net.Listener, error) {
 	return listeners, nil
 }
 
+// rpcTLSConfig returns the TLS configuration of the RPC server, which is also
+// used by the gRPC server.  The certificate and key files are generated if
+// neither of them exists.
+func rpcTLSConfig() (*tls.Config, error) {
+	if !fileExists(cfg.RPCKey) && !fileExists(cfg.RPCCert) {
+		err := genCertPair(cfg.RPCCert, cfg.RPCKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keypair, err := tls.LoadX509KeyPair(cfg.RPCCert, cfg.RPCKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{keypair},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// setupMiningListeners returns a slice of listeners that are configured for use
+// with a mining server, such as the stratum server, for the passed listen
+// addresses.
+func setupMiningListeners(addrs []string) ([]net.Listener, error) {
+	netAddrs, err := parseListeners(addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	listeners := make([]net.Listener, 0, len(netAddrs))
+	for _, addr := range netAddrs {
+		listener, err := net.Listen(addr.Network(), addr.String())
+		if err != nil {
+			minrLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
 // newServer returns a new btcd server configured to listen on addr for the
 // bitcoin network type specified by chainParams.  Use start to begin accepting
 // connections from peers.
@@ -2590,8 +2942,40 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	if cfg.NoCFilters {
 		services &^= wire.SFNodeCF
 	}
+	if cfg.V2Transport {
+		services |= wire.SFNodeP2PV2
+	}
+	if cfg.PruneDepth != 0 {
+		services &^= wire.SFNodeNetwork
+		services |= wire.SFNodeNetworkLimited
+	}
 
 	amgr := addrmgr.New(cfg.DataDir, btcdLookup)
+	if cfg.ASMap != "" {
+		asmap, err := addrmgr.LoadASMap(cfg.ASMap)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load asmap %s: %v",
+				cfg.ASMap, err)
+		}
+		srvrLog.Infof("Grouping peer addresses by AS using asmap %s "+
+			"(checksum %s)", cfg.ASMap, asmap.Checksum())
+		amgr.SetASMap(asmap)
+	}
+	if cfg.AddrStore == "leveldb" {
+		storePath := filepath.Join(cfg.DataDir, "peers.ldb")
+		store, err := addrmgr.OpenLevelDBStore(storePath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open address store %s: %v",
+				storePath, err)
+		}
+		amgr.SetStore(store)
+	}
+	amgr.SetScoreWeights(addrmgr.ScoreWeights{
+		LastSuccess:       cfg.AddrScoreSuccess,
+		Latency:           cfg.AddrScoreLatency,
+		Services:          cfg.AddrScoreServices,
+		PreferredServices: wire.SFNodeNetwork | wire.SFNodeWitness,
+	})
 
 	var listeners []net.Listener
 	var nat NAT
@@ -2614,26 +2998,25 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	}
 
 	s := server{
-		chainParams:          chainParams,
-		addrManager:          amgr,
-		newPeers:             make(chan *serverPeer, cfg.MaxPeers),
-		donePeers:            make(chan *serverPeer, cfg.MaxPeers),
-		banPeers:             make(chan *serverPeer, cfg.MaxPeers),
-		query:                make(chan interface{}),
-		relayInv:             make(chan relayMsg, cfg.MaxPeers),
-		broadcast:            make(chan broadcastMsg, cfg.MaxPeers),
-		quit:                 make(chan struct{}),
-		modifyRebroadcastInv: make(chan interface{}),
-		peerHeightsUpdate:    make(chan updatePeerHeightsMsg),
-		nat:                  nat,
-		db:                   db,
-		timeSource:           blockchain.NewMedianTime(),
-		services:             services,
-		sigCache:             txscript.NewSigCache(cfg.SigCacheMaxSize),
-		hashCache:            txscript.NewHashCache(cfg.SigCacheMaxSize),
-		cfCheckptCaches:      make(map[wire.FilterType][]cfHeaderKV),
-		agentBlacklist:       agentBlacklist,
-		agentWhitelist:       agentWhitelist,
+		chainParams:       chainParams,
+		addrManager:       amgr,
+		newPeers:          make(chan *serverPeer, cfg.MaxPeers),
+		donePeers:         make(chan *serverPeer, cfg.MaxPeers),
+		banPeers:          make(chan *serverPeer, cfg.MaxPeers),
+		query:             make(chan interface{}),
+		relayInv:          make(chan relayMsg, cfg.MaxPeers),
+		broadcast:         make(chan broadcastMsg, cfg.MaxPeers),
+		quit:              make(chan struct{}),
+		peerHeightsUpdate: make(chan updatePeerHeightsMsg),
+		nat:               nat,
+		db:                db,
+		timeSource:        blockchain.NewTimeManager(cfg.MaxTimeAdjustment),
+		services:          services,
+		sigCache:          txscript.NewSigCache(cfg.SigCacheMaxSize),
+		hashCache:         txscript.NewHashCache(cfg.SigCacheMaxSize),
+		v1OnlyAddrs:       make(map[string]time.Time),
+		agentBlacklist:    agentBlacklist,
+		agentWhitelist:    agentWhitelist,
 	}
 
 	// Create the transaction and address indexes if needed.
@@ -2672,6 +3055,22 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		indxLog.Info("Committed filter index is enabled")
 		s.cfIndex = indexers.NewCfIndex(db, chainParams)
 		indexes = append(indexes, s.cfIndex)
+		s.cfilterSource = &cfilterSource{server: &s}
+	}
+	if cfg.UtreexoIndex {
+		indxLog.Info("Utreexo index is enabled")
+		s.utreexoIndex = indexers.NewUtreexoIndex(db)
+		indexes = append(indexes, s.utreexoIndex)
+	}
+	if cfg.UtxoScriptIndex {
+		indxLog.Info("Unspent output by script index is enabled")
+		s.utxoScriptIndex = indexers.NewUtxoScriptIndex(db)
+		indexes = append(indexes, s.utxoScriptIndex)
+	}
+	if cfg.SpendIndex {
+		indxLog.Info("Spent output index is enabled")
+		s.spendIndex = indexers.NewSpendIndex(db)
+		indexes = append(indexes, s.spendIndex)
 	}
 
 	// Create an index manager if any of the optional indexes are enabled.
@@ -2680,28 +3079,55 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		indexManager = indexers.NewManager(db, indexes)
 	}
 
-	// Merge given checkpoints with the default ones unless they are disabled.
-	var checkpoints []chaincfg.Checkpoint
-	if !cfg.DisableCheckpoints {
-		checkpoints = mergeCheckpoints(s.chainParams.Checkpoints, cfg.addCheckpoints)
-	}
+	// Merge given checkpoints with the default ones.  They are ignored by
+	// the chain when the checkpoints are disabled.
+	checkpoints := mergeCheckpoints(s.chainParams.Checkpoints, cfg.addCheckpoints)
 
 	// Create a new block chain instance with the appropriate configuration.
 	var err error
 	s.chain, err = blockchain.New(&blockchain.Config{
-		DB:           s.db,
-		Interrupt:    interrupt,
-		ChainParams:  s.chainParams,
-		Checkpoints:  checkpoints,
-		TimeSource:   s.timeSource,
-		SigCache:     s.sigCache,
-		IndexManager: indexManager,
-		HashCache:    s.hashCache,
+		DB:             s.db,
+		Interrupt:      interrupt,
+		ChainParams:    s.chainParams,
+		Checkpoints:    checkpoints,
+		CheckpointMode: cfg.checkpointMode,
+		TimeSource:     s.timeSource,
+		SigCache:       s.sigCache,
+		IndexManager:   indexManager,
+		HashCache:      s.hashCache,
+
+		MaxOrphanBlocks:      cfg.MaxOrphanBlocks,
+		MaxOrphanBlockBytes:  int64(cfg.MaxOrphanBlockMem) * 1024 * 1024,
+		OrphanBlockExpiry:    cfg.OrphanBlockExpiry,
+		UtxoCacheMaxSize:     uint64(cfg.UtxoCacheMaxSize) * 1024 * 1024,
+		PruneDepth:           cfg.PruneDepth,
+		MaintainUtxoSetStats: cfg.UtxoSetStats,
+
+		ScriptValidationWorkers: cfg.ScriptWorkers,
+		ScriptSchedule:          cfg.scriptSchedule,
+		ScriptWorkerCPUs:        cfg.scriptCPUs,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	// Add the checkpoints from the checkpoint file, which are validated
+	// against the blocks already in the main chain.
+	err = addFileCheckpoints(s.chain, cfg.CheckpointFile,
+		cfg.fileCheckpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the utxo set snapshot into a new chain as requested.  The
+	// option is ignored once the chain has been extended, so it can be
+	// left in the configuration file.
+	if cfg.LoadSnapshot != "" {
+		if err := loadUtxoSnapshot(s.chain, cfg.LoadSnapshot, interrupt); err != nil {
+			return nil, err
+		}
+	}
+
 	// Search for a FeeEstimator state in the database. If none can be found
 	// or if it cannot be loaded, create a new one.
 	db.Update(func(tx database.Tx) error {
@@ -2725,11 +3151,16 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	})
 
 	// If no feeEstimator has been found, or if the one that has been found
-	// is behind somehow, create a new one and start over.
-	if s.feeEstimator == nil || s.feeEstimator.LastKnownHeight() != s.chain.BestSnapshot().Height {
-		s.feeEstimator = mempool.NewFeeEstimator(
-			mempool.DefaultEstimateFeeMaxRollback,
-			mempool.DefaultEstimateFeeMinRegisteredBlocks)
+	// is ahead of the main chain or too far behind it, create a new one and
+	// start over.
+	if s.feeEstimator != nil {
+		lag := s.chain.BestSnapshot().Height - s.feeEstimator.LastKnownHeight()
+		if lag < 0 || lag > mempool.EstimateFeeMaxLag {
+			s.feeEstimator = nil
+		}
+	}
+	if s.feeEstimator == nil {
+		s.feeEstimator = mempool.NewFeeEstimator()
 	}
 
 	txC := mempool.Config{
@@ -2738,11 +3169,25 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 			AcceptNonStd:         cfg.RelayNonStd,
 			FreeTxRelayLimit:     cfg.FreeTxRelayLimit,
 			MaxOrphanTxs:         cfg.MaxOrphanTxs,
-			MaxOrphanTxSize:      defaultMaxOrphanTxSize,
-			MaxSigOpCostPerTx:    blockchain.MaxBlockSigOpsCost / 4,
+			MaxOrphanTxWeight:    defaultMaxOrphanTxWeight,
+			MaxOrphanWeight:      cfg.MaxOrphanWeight,
+			OrphanTTL:            cfg.OrphanTxExpiry,
+			MaxSigOpCostPerTx:    cfg.MaxTxSigOpCost,
 			MinRelayTxFee:        cfg.minRelayTxFee,
+			DustRelayFee:         cfg.dustRelayFee,
+			MaxStandardTxWeight:  cfg.MaxStdTxWeight,
+			MaxDataCarrierSize:   cfg.DataCarrierSize,
+			RejectBareMultisig:   cfg.RejectBareMultisig,
 			MaxTxVersion:         2,
 			RejectReplacement:    cfg.RejectReplacement,
+			FullReplacement:      cfg.MempoolFullRBF,
+			MaxAncestors:         cfg.LimitAncestorCount,
+			MaxAncestorVSize:     int64(cfg.LimitAncestorSize) * 1000,
+			MaxDescendants:       cfg.LimitDescendantCount,
+			MaxDescendantVSize:   int64(cfg.LimitDescendantSize) * 1000,
+			MaxClusterCount:      cfg.LimitClusterCount,
+			MaxPoolSize:          int64(cfg.MaxMempool) * 1000000,
+			Expiry:               cfg.MempoolExpiry,
 		},
 		ChainParams:    chainParams,
 		FetchUtxoView:  s.chain.FetchUtxoView,
@@ -2756,21 +3201,128 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		HashCache:          s.hashCache,
 		AddrIndex:          s.addrIndex,
 		FeeEstimator:       s.feeEstimator,
+		OrphanRejected: func(tx *btcutil.Tx, tag mempool.Tag, err error) {
+			if s.syncManager != nil {
+				s.syncManager.OrphanRejected(tx, tag, err)
+			}
+		},
+		TxReplaced: func(r *mempool.TxReplacement) {
+			if s.rpcServer != nil {
+				s.rpcServer.NotifyTxReplaced(r)
+			}
+		},
 	}
 	s.txMemPool = mempool.New(&txC)
 
+	// Restore the memory pool saved on the last shutdown.
+	if !cfg.NoPersistMempool {
+		err := loadMempool(s.txMemPool, mempoolFilePath(), interrupt)
+		if err != nil && !mempool.IsInterruptRequested(err) {
+			srvrLog.Errorf("Unable to load mempool: %v", err)
+		}
+		s.mempoolLoaded = !mempool.IsInterruptRequested(err)
+	}
+
+	if cfg.NetLog != "" {
+		s.netLog, err = newNetLogger(cfg.NetLog)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.WitnessTelemetry {
+		s.witnessTelemetry = newWitnessTelemetry(s.chain,
+			s.txMemPool.FetchTransaction)
+	}
+
+	s.reorgLog, err = newReorgLog(s.chain, db)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.AttestInterval > 0 {
+		keyFile := filepath.Join(cfg.DataDir, attestationKeyFilename)
+		key, err := loadPrivateKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.attestor, err = newAttestor(s.chain, db, chainParams.Net, key,
+			cfg.AttestInterval)
+		if err != nil {
+			return nil, err
+		}
+		srvrLog.Infof("Signing chain state attestations every %v with "+
+			"public key %x", cfg.AttestInterval,
+			key.PubKey().SerializeCompressed())
+	}
+
+	if s.addrIndex != nil {
+		s.xpubAccounts, err = newXpubAccountManager(db, s.chain,
+			s.addrIndex, s.txMemPool, chainParams)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Load the Go plugins and run the registered plugins which are not
+	// disabled.
+	if err := loadPlugins(cfg.Plugins); err != nil {
+		return nil, err
+	}
+	var enabledPlugins []plugins.Plugin
+	for _, p := range plugins.Registered() {
+		var disabled bool
+		for _, name := range cfg.DisablePlugins {
+			if p.Name() == name {
+				disabled = true
+				break
+			}
+		}
+		if disabled {
+			srvrLog.Infof("Plugin %s is disabled", p.Name())
+			continue
+		}
+		enabledPlugins = append(enabledPlugins, p)
+	}
+	s.plugins = plugins.NewManager(enabledPlugins)
+	if len(enabledPlugins) > 0 {
+		s.chain.Subscribe(func(n *blockchain.Notification) {
+			if n.Type == blockchain.NTBlockConnected {
+				s.plugins.BlockConnected(n.Data.(*btcutil.Block))
+			}
+		})
+	}
+
+	var forkHeaderHandler netsync.ForkHeaderHandler
+	if cfg.ForkArchive {
+		s.forkArchive, err = newForkArchive(s.chain, db,
+			chainParams.PowLimit, cfg.ForkArchiveSize,
+			cfg.ForkArchiveBlocks)
+		if err != nil {
+			return nil, err
+		}
+		forkHeaderHandler = s.forkArchive.HandleForkHeader
+	}
+
 	s.syncManager, err = netsync.New(&netsync.Config{
 		PeerNotifier:       &s,
 		Chain:              s.chain,
 		TxMemPool:          s.txMemPool,
 		ChainParams:        s.chainParams,
-		DisableCheckpoints: cfg.DisableCheckpoints,
+		DisableCheckpoints: cfg.checkpointMode != blockchain.CheckpointEnforce,
 		MaxPeers:           cfg.MaxPeers,
 		FeeEstimator:       s.feeEstimator,
+		ForkHeaderHandler:  forkHeaderHandler,
+
+		MaxPeerValidationCost: cfg.MaxValidationCost,
 	})
 	if err != nil {
 		return nil, err
 	}
+	if s.forkArchive != nil {
+		s.forkArchive.requestBlock = s.syncManager.RequestBlock
+		s.forkArchive.requestHeader = s.syncManager.RequestForkHeader
+	}
 
 	// Create the mining policy and block template generator based on the
 	// configuration options.
@@ -2778,16 +3330,29 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	// NOTE: The CPU miner relies on the mempool, so the mempool has to be
 	// created before calling the function to create the CPU miner.
 	policy := mining.Policy{
-		BlockMinWeight:    cfg.BlockMinWeight,
-		BlockMaxWeight:    cfg.BlockMaxWeight,
-		BlockMinSize:      cfg.BlockMinSize,
-		BlockMaxSize:      cfg.BlockMaxSize,
-		BlockPrioritySize: cfg.BlockPrioritySize,
-		TxMinFreeFee:      cfg.minRelayTxFee,
+		BlockMinWeight:         cfg.BlockMinWeight,
+		BlockMaxWeight:         cfg.BlockMaxWeight,
+		BlockMinSize:           cfg.BlockMinSize,
+		BlockMaxSize:           cfg.BlockMaxSize,
+		BlockPrioritySize:      cfg.BlockPrioritySize,
+		BlockMaxSigOpCost:      cfg.BlockMaxSigOpCost,
+		BlockReservedWeight:    cfg.BlockReservedWeight,
+		BlockReservedSigOpCost: cfg.BlockReservedSigOps,
+		TxMinFreeFee:           cfg.minRelayTxFee,
+		CoinbasePayouts:        cfg.coinbasePayouts,
 	}
 	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy,
 		s.chainParams, s.txMemPool, s.chain, s.timeSource,
 		s.sigCache, s.hashCache)
+	if cfg.TemplateCompare {
+		s.templateComparer, err = newTemplateComparer(s.chain, db,
+			s.chainParams)
+		if err != nil {
+			return nil, err
+		}
+		blockTemplateGenerator.SetTemplateHook(
+			s.templateComparer.ObserveTemplate)
+	}
 	s.cpuMiner = cpuminer.New(&cpuminer.Config{
 		ChainParams:            chainParams,
 		BlockTemplateGenerator: blockTemplateGenerator,
@@ -2797,6 +3362,73 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		IsCurrent:              s.syncManager.IsCurrent,
 	})
 
+	// Setup the stratum server when stratum listen addresses are
+	// configured, so miners can connect to it directly.
+	if len(cfg.StratumListeners) > 0 {
+		stratumListeners, err := setupMiningListeners(
+			cfg.StratumListeners)
+		if err != nil {
+			return nil, err
+		}
+		if len(stratumListeners) == 0 {
+			return nil, errors.New("MINR: No valid stratum listen " +
+				"address")
+		}
+
+		s.stratumServer = stratum.New(&stratum.Config{
+			ChainParams:            chainParams,
+			BlockTemplateGenerator: blockTemplateGenerator,
+			MiningAddrs:            cfg.miningAddrs,
+			ProcessBlock:           s.syncManager.ProcessBlock,
+			IsCurrent:              s.syncManager.IsCurrent,
+			Listeners:              stratumListeners,
+			InitialDifficulty:      cfg.StratumDifficulty,
+			TargetShareInterval:    cfg.StratumShareInterval,
+			MaxClients:             cfg.StratumMaxClients,
+		})
+	}
+
+	// Setup the Stratum V2 template provider when its listen addresses are
+	// configured, so pools and job declarators can request templates.
+	if len(cfg.SV2Listeners) > 0 {
+		keyFile := filepath.Join(cfg.DataDir, sv2AuthorityKeyFilename)
+		authorityKey, err := loadPrivateKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		sv2Listeners, err := setupMiningListeners(cfg.SV2Listeners)
+		if err != nil {
+			return nil, err
+		}
+		if len(sv2Listeners) == 0 {
+			return nil, errors.New("MINR: No valid Stratum V2 listen " +
+				"address")
+		}
+
+		s.sv2Server, err = sv2.New(&sv2.Config{
+			ChainParams:            chainParams,
+			BlockTemplateGenerator: blockTemplateGenerator,
+			ProcessBlock:           s.syncManager.ProcessBlock,
+			IsCurrent:              s.syncManager.IsCurrent,
+			Listeners:              sv2Listeners,
+			AuthorityKey:           authorityKey,
+			TemplateInterval:       cfg.SV2Interval,
+			FeeDelta:               btcutil.Amount(cfg.SV2FeeDelta),
+			MaxClients:             cfg.SV2MaxClients,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Clients are configured with the x-only authority public key
+		// encoded with base58check behind a two byte version.
+		var pubKey [32]byte
+		authorityKey.PubKey().X.FillBytes(pubKey[:])
+		minrLog.Infof("Stratum V2 template provider authority public "+
+			"key is %s", base58.CheckEncode(append([]byte{0},
+			pubKey[:]...), 1))
+	}
+
 	// Only setup a function to return new addresses to connect to when
 	// not running in connect-only mode.  The simulation network is always
 	// in connect-only mode since it is only intended to connect to
@@ -2806,19 +3438,31 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	var newAddressFunc func() (net.Addr, error)
 	if !cfg.SimNet && len(cfg.ConnectPeers) == 0 {
 		newAddressFunc = func() (net.Addr, error) {
+			// Only the primary is followed while in standby mode.
+			if s.standby.IsStandby() {
+				return nil, errors.New("standby mode")
+			}
+
 			for tries := 0; tries < 100; tries++ {
 				addr := s.addrManager.GetAddress()
 				if addr == nil {
 					break
 				}
 
+				// Addresses of networks which can't be
+				// represented by a wire.NetAddress, such as
+				// Tor v3 and I2P, are only relayed for now.
+				if addr.NetAddress() == nil {
+					continue
+				}
+
 				// Address will not be invalid, local or unroutable
 				// because addrmanager rejects those on addition.
 				// Just check that we don't already have an address
 				// in the same group so that we are not connecting
 				// to the same network segment at the expense of
 				// others.
-				key := addrmgr.GroupKey(addr.NetAddress())
+				key := s.addrManager.GroupKey(addr.NetAddress())
 				if s.OutboundGroupCount(key) != 0 {
 					continue
 				}
@@ -2836,7 +3480,10 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 				}
 
 				// Mark an attempt for the valid address.
-				s.addrManager.Attempt(addr.NetAddress())
+				s.addrManager.AttemptEvent(addr.NetAddress(),
+					addrmgr.AddressEvent{
+						Reason: addrmgr.ReasonConnecting,
+					})
 
 				addrString := addrmgr.NetAddressKey(addr.NetAddress())
 				return addrStringToNetAddr(addrString)
@@ -2870,6 +3517,21 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 	if len(permanentPeers) == 0 {
 		permanentPeers = cfg.AddPeers
 	}
+
+	// Setup the hot standby state and follow the primary as a persistent
+	// peer when configured as a standby.
+	if cfg.Standby {
+		s.standby, err = newStandbyManager(cfg.StandbyPrimary,
+			cfg.StandbyCheckInterval, cfg.StandbyMaxFailures,
+			func(addr net.Addr) (net.Conn, error) {
+				return cfg.dial(addr.Network(), addr.String(),
+					standbyDialTimeout)
+			})
+		if err != nil {
+			return nil, err
+		}
+		permanentPeers = append(permanentPeers, cfg.StandbyPrimary)
+	}
 	for _, addr := range permanentPeers {
 		netAddr, err := addrStringToNetAddr(addr)
 		if err != nil {
@@ -2894,21 +3556,30 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}
 
 		s.rpcServer, err = newRPCServer(&rpcserverConfig{
-			Listeners:    rpcListeners,
-			StartupTime:  s.startupTime,
-			ConnMgr:      &rpcConnManager{&s},
-			SyncMgr:      &rpcSyncMgr{&s, s.syncManager},
-			TimeSource:   s.timeSource,
-			Chain:        s.chain,
-			ChainParams:  chainParams,
-			DB:           db,
-			TxMemPool:    s.txMemPool,
-			Generator:    blockTemplateGenerator,
-			CPUMiner:     s.cpuMiner,
-			TxIndex:      s.txIndex,
-			AddrIndex:    s.addrIndex,
-			CfIndex:      s.cfIndex,
-			FeeEstimator: s.feeEstimator,
+			Listeners:        rpcListeners,
+			StartupTime:      s.startupTime,
+			ConnMgr:          &rpcConnManager{&s},
+			SyncMgr:          &rpcSyncMgr{&s, s.syncManager},
+			TimeSource:       s.timeSource,
+			Chain:            s.chain,
+			ChainParams:      chainParams,
+			DB:               db,
+			TxMemPool:        s.txMemPool,
+			Generator:        blockTemplateGenerator,
+			CPUMiner:         s.cpuMiner,
+			TxIndex:          s.txIndex,
+			AddrIndex:        s.addrIndex,
+			CfIndex:          s.cfIndex,
+			SpendIndex:       s.spendIndex,
+			FeeEstimator:     s.feeEstimator,
+			Standby:          s.standby,
+			WitnessTelemetry: s.witnessTelemetry,
+			ForkArchive:      s.forkArchive,
+			ReorgLog:         s.reorgLog,
+			Attestor:         s.attestor,
+			TemplateComparer: s.templateComparer,
+			CheckpointFile:   cfg.CheckpointFile,
+			XpubAccounts:     s.xpubAccounts,
 		})
 		if err != nil {
 			return nil, err
@@ -2921,6 +3592,67 @@ func newServer(listenAddrs, agentBlacklist, agentWhitelist []string,
 		}()
 	}
 
+	if len(cfg.GRPCListeners) > 0 {
+		var tlsConfig *tls.Config
+		if !cfg.DisableTLS {
+			tlsConfig, err = rpcTLSConfig()
+			if err != nil {
+				return nil, err
+			}
+		}
+		netAddrs, err := parseListeners(cfg.GRPCListeners)
+		if err != nil {
+			return nil, err
+		}
+		listeners := make([]net.Listener, 0, len(netAddrs))
+		for _, addr := range netAddrs {
+			listener, err := net.Listen(addr.Network(), addr.String())
+			if err != nil {
+				for _, l := range listeners {
+					l.Close()
+				}
+				return nil, fmt.Errorf("unable to listen on %s for "+
+					"the gRPC interface: %v", addr, err)
+			}
+			listeners = append(listeners, listener)
+		}
+		s.grpcServer = newGRPCServer(s.rpcServer, listeners, tlsConfig)
+	}
+
+	if endpoints := zmqEndpoints(cfg); len(endpoints) > 0 {
+		s.zmqNotifier, err = newZMQNotifier(s.chain, s.txMemPool,
+			endpoints)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.HealthListeners) > 0 {
+		netAddrs, err := parseListeners(cfg.HealthListeners)
+		if err != nil {
+			return nil, err
+		}
+		listeners := make([]net.Listener, 0, len(netAddrs))
+		for _, addr := range netAddrs {
+			listener, err := net.Listen(addr.Network(), addr.String())
+			if err != nil {
+				for _, l := range listeners {
+					l.Close()
+				}
+				return nil, fmt.Errorf("unable to listen on %s for "+
+					"the health endpoints: %v", addr, err)
+			}
+			listeners = append(listeners, listener)
+		}
+		s.healthServer = newHealthServer(&s, listeners,
+			cfg.HealthMaxTipAge, cfg.HealthMinPeers)
+	}
+
+	if !cfg.NoPartitionAlerts {
+		s.partitionMonitor = newPartitionMonitor(&s,
+			cfg.PartitionWebhooks)
+	}
+
 	return &s, nil
 }
 
@@ -3243,3 +3975,82 @@ func (sp *serverPeer) HasUndesiredUserAgent(blacklistedAgents,
 
 	return true
 }
+
+// mempoolFilePath returns the path of the file the memory pool is saved to on
+// shutdown.
+func mempoolFilePath() string {
+	return filepath.Join(cfg.DataDir, mempoolFileName)
+}
+
+// loadMempool loads the transactions saved to the file at the passed path into
+// the passed memory pool.  It is not an error for the file to not exist.
+func loadMempool(txMemPool *mempool.TxPool, path string, interrupt <-chan struct{}) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	srvrLog.Infof("Loading mempool from %s", path)
+	accepted, failed, err := txMemPool.Load(bufio.NewReader(f), interrupt)
+	if err != nil {
+		return err
+	}
+	srvrLog.Infof("Loaded %d mempool transactions (%d no longer valid)",
+		accepted, failed)
+	return nil
+}
+
+// saveMempool saves the transactions in the passed memory pool to the file at
+// the passed path.  They are written to a temporary file first, which replaces
+// the file once it is complete, so the existing file is kept intact when the
+// node crashes while saving.
+func saveMempool(txMemPool *mempool.TxPool, path string) error {
+	tmpPath := path + ".new"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	n, err := txMemPool.Dump(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	srvrLog.Infof("Saved %d mempool transactions to %s", n, path)
+	return nil
+}
+
+// loadUtxoSnapshot loads the utxo set snapshot in the file at the passed path
+// into the passed chain when it only has the genesis block.
+func loadUtxoSnapshot(chain *blockchain.BlockChain, path string, interrupt <-chan struct{}) error {
+	if best := chain.BestSnapshot(); best.Height != 0 {
+		srvrLog.Infof("Not loading utxo snapshot %s since the chain is "+
+			"at height %d", path, best.Height)
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = chain.LoadUtxoSnapshot(f, interrupt)
+	return err
+}
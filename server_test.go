@@ -0,0 +1,64 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestV1OnlyAddrs ensures the addresses of peers which failed the v2 transport
+// handshake are remembered until they expire and are limited in number.
+func TestV1OnlyAddrs(t *testing.T) {
+	s := &server{v1OnlyAddrs: make(map[string]time.Time)}
+
+	const addr = "10.0.0.1:8333"
+	if s.isV1OnlyAddr(addr) {
+		t.Fatal("unknown address is v1 only")
+	}
+	s.addV1OnlyAddr(addr)
+	if !s.isV1OnlyAddr(addr) {
+		t.Fatal("added address is not v1 only")
+	}
+
+	// Expired addresses use the v2 transport again and are forgotten.
+	s.v1OnlyAddrs[addr] = time.Now().Add(-time.Second)
+	if s.isV1OnlyAddr(addr) {
+		t.Fatal("expired address is v1 only")
+	}
+	if _, ok := s.v1OnlyAddrs[addr]; ok {
+		t.Fatal("expired address is not removed")
+	}
+
+	// The address which expires first is evicted once the limit is
+	// reached.
+	now := time.Now()
+	for i := 0; i < maxV1OnlyAddrs; i++ {
+		a := fmt.Sprintf("10.1.%d.%d:8333", i/256, i%256)
+		s.v1OnlyAddrs[a] = now.Add(time.Hour + time.Duration(i)*time.Second)
+	}
+	s.addV1OnlyAddr(addr)
+	if len(s.v1OnlyAddrs) != maxV1OnlyAddrs {
+		t.Fatalf("got %d addresses, want %d", len(s.v1OnlyAddrs),
+			maxV1OnlyAddrs)
+	}
+	if s.isV1OnlyAddr("10.1.0.0:8333") || !s.isV1OnlyAddr(addr) ||
+		!s.isV1OnlyAddr("10.1.0.1:8333") {
+
+		t.Fatal("address which expires first is not evicted")
+	}
+
+	// Expired addresses are removed before any other address is evicted.
+	s.v1OnlyAddrs["10.1.0.2:8333"] = now.Add(-time.Second)
+	s.v1OnlyAddrs["10.1.0.3:8333"] = now.Add(-time.Second)
+	s.addV1OnlyAddr("10.2.0.0:8333")
+	if len(s.v1OnlyAddrs) != maxV1OnlyAddrs-1 ||
+		!s.isV1OnlyAddr("10.1.0.1:8333") {
+
+		t.Fatalf("got %d addresses, want %d", len(s.v1OnlyAddrs),
+			maxV1OnlyAddrs-1)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// defaultStandbyCheckInterval is the default interval between health
+	// checks of the primary when running in standby mode.
+	defaultStandbyCheckInterval = time.Second * 10
+
+	// defaultStandbyMaxFailures is the default number of consecutive failed
+	// health checks of the primary before a standby promotes itself.
+	defaultStandbyMaxFailures = 3
+
+	// standbyDialTimeout is the maximum amount of time a single health check
+	// waits for a connection to the primary to be established.
+	standbyDialTimeout = time.Second * 5
+)
+
+// errNotStandby is returned when attempting to promote a node that is not
+// running in standby mode or has already been promoted.
+var errNotStandby = errors.New("node is not in standby mode")
+
+// standbyStatus houses information about the current state of a standby
+// instance as returned by the standbyManager.
+type standbyStatus struct {
+	Standby             bool
+	Primary             string
+	PrimaryReachable    bool
+	ConsecutiveFailures int
+	LastCheck           time.Time
+	PromotedAt          time.Time
+	PromotionReason     string
+}
+
+// standbyManager tracks the state of a hot standby instance.  A standby
+// follows the configured primary as its only peer so the chain, caches, and
+// mempool are kept warm, while refusing inbound peers, new outbound peers and
+// most RPC requests.  Once promoted, either explicitly or because the primary
+// failed too many consecutive health checks, the node resumes normal operation.
+type standbyManager struct {
+	active int32 // atomic
+
+	primary       string
+	primaryAddr   net.Addr
+	checkInterval time.Duration
+	maxFailures   int
+	dial          func(net.Addr) (net.Conn, error)
+
+	mtx                 sync.Mutex
+	primaryReachable    bool
+	consecutiveFailures int
+	lastCheck           time.Time
+	promotedAt          time.Time
+	promotionReason     string
+
+	promoted chan struct{}
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// newStandbyManager returns a new standby manager which health checks the
+// provided primary address using the given dial function.
+func newStandbyManager(primary string, checkInterval time.Duration,
+	maxFailures int, dial func(net.Addr) (net.Conn, error)) (*standbyManager, error) {
+
+	primaryAddr, err := addrStringToNetAddr(primary)
+	if err != nil {
+		return nil, err
+	}
+
+	return &standbyManager{
+		active:        1,
+		primary:       primary,
+		primaryAddr:   primaryAddr,
+		checkInterval: checkInterval,
+		maxFailures:   maxFailures,
+		dial:          dial,
+		promoted:      make(chan struct{}),
+		quit:          make(chan struct{}),
+	}, nil
+}
+
+// IsStandby returns whether or not the node is still acting as a standby.  It
+// is safe to call on a nil manager in which case false is returned.
+//
+// This function is safe for concurrent access.
+func (m *standbyManager) IsStandby() bool {
+	if m == nil {
+		return false
+	}
+	return atomic.LoadInt32(&m.active) == 1
+}
+
+// IsPrimary returns whether or not the passed address refers to the primary
+// being followed.
+func (m *standbyManager) IsPrimary(addr string) bool {
+	if m == nil {
+		return false
+	}
+	return addr == m.primaryAddr.String()
+}
+
+// Promoted returns a channel that is closed once the standby is promoted.
+func (m *standbyManager) Promoted() <-chan struct{} {
+	return m.promoted
+}
+
+// Promote takes the node out of standby mode so that it begins serving RPC and
+// P2P clients.  The reason is recorded and reported via Status.  An error is
+// returned if the node has already been promoted.
+//
+// This function is safe for concurrent access.
+func (m *standbyManager) Promote(reason string) error {
+	if !atomic.CompareAndSwapInt32(&m.active, 1, 0) {
+		return errNotStandby
+	}
+
+	m.mtx.Lock()
+	m.promotedAt = time.Now()
+	m.promotionReason = reason
+	m.mtx.Unlock()
+
+	srvrLog.Warnf("Promoting standby to primary: %s", reason)
+	close(m.promoted)
+	return nil
+}
+
+// Status returns a snapshot of the current standby state.
+//
+// This function is safe for concurrent access.
+func (m *standbyManager) Status() *standbyStatus {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return &standbyStatus{
+		Standby:             m.IsStandby(),
+		Primary:             m.primary,
+		PrimaryReachable:    m.primaryReachable,
+		ConsecutiveFailures: m.consecutiveFailures,
+		LastCheck:           m.lastCheck,
+		PromotedAt:          m.promotedAt,
+		PromotionReason:     m.promotionReason,
+	}
+}
+
+// checkPrimary attempts a single connection to the primary and updates the
+// health state accordingly.  It returns whether the maximum number of
+// consecutive failures has been reached.
+func (m *standbyManager) checkPrimary() bool {
+	reachable := false
+	conn, err := m.dial(m.primaryAddr)
+	if err == nil {
+		conn.Close()
+		reachable = true
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.lastCheck = time.Now()
+	m.primaryReachable = reachable
+	if reachable {
+		m.consecutiveFailures = 0
+		return false
+	}
+
+	m.consecutiveFailures++
+	srvrLog.Warnf("Standby health check of primary %s failed (%d/%d): %v",
+		m.primary, m.consecutiveFailures, m.maxFailures, err)
+	return m.consecutiveFailures >= m.maxFailures
+}
+
+// healthCheckHandler periodically checks whether the primary is reachable and
+// promotes the standby once it has failed too many consecutive checks.  It
+// must be run as a goroutine.
+func (m *standbyManager) healthCheckHandler() {
+	ticker := time.NewTicker(m.checkInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			if m.checkPrimary() {
+				m.Promote("primary failed health checks")
+				break out
+			}
+
+		case <-m.promoted:
+			break out
+
+		case <-m.quit:
+			break out
+		}
+	}
+
+	m.wg.Done()
+}
+
+// Start begins health checking the primary.
+func (m *standbyManager) Start() {
+	srvrLog.Infof("Running in standby mode following primary %s", m.primary)
+
+	m.wg.Add(1)
+	go m.healthCheckHandler()
+}
+
+// Stop halts health checking and waits for the handler to finish.
+func (m *standbyManager) Stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+
+// shouldRequestMempool returns whether the contents of the mempool of the passed
+// outbound peer should be requested, which is only the case for the primary
+// while in standby mode.
+//
+// The primary answers mempool requests only when it advertises bloom filtering
+// and disconnects the standby otherwise, so the request is not sent to a
+// primary without it.  The mempool of the standby is then only populated with
+// the transactions relayed after connecting.
+func (m *standbyManager) shouldRequestMempool(addr string, services wire.ServiceFlag) bool {
+	if !m.IsStandby() || !m.IsPrimary(addr) {
+		return false
+	}
+	if services&wire.SFNodeBloom != wire.SFNodeBloom {
+		srvrLog.Warnf("Primary %s does not serve mempool requests since "+
+			"it does not advertise bloom filtering -- the mempool "+
+			"is only populated with newly relayed transactions",
+			addr)
+		return false
+	}
+	return true
+}
+
+// requestPrimaryMempool asks the primary to announce the contents of its
+// mempool so the standby mempool is populated before a failover.  It is a no-op
+// for peers other than the primary.
+func (sp *serverPeer) requestPrimaryMempool() {
+	standby := sp.server.standby
+	if sp.Inbound() || !standby.shouldRequestMempool(sp.Addr(), sp.Services()) {
+		return
+	}
+
+	srvrLog.Infof("Requesting mempool contents from primary %s", sp)
+	sp.QueueMessage(wire.NewMsgMemPool(), nil)
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestStandbyPromote ensures a standby follows only its primary, requests the
+// mempool of the primary only while in standby mode, and is promoted once.
+func TestStandbyPromote(t *testing.T) {
+	const primary = "10.0.0.1:8333"
+	services := wire.SFNodeNetwork | wire.SFNodeBloom
+
+	// A node which is not configured as a standby never acts as one.
+	var none *standbyManager
+	if none.IsStandby() || none.IsPrimary(primary) ||
+		none.shouldRequestMempool(primary, services) {
+
+		t.Fatal("nil standby manager acts as a standby")
+	}
+	s := &rpcServer{}
+	_, err := handlePromoteStandby(s, &btcjson.PromoteStandbyCmd{}, nil)
+	if jerr, ok := err.(*btcjson.RPCError); !ok ||
+		jerr.Code != btcjson.ErrRPCMisc {
+
+		t.Fatalf("promotestandby without a standby: got error %v, "+
+			"want code %d", err, btcjson.ErrRPCMisc)
+	}
+
+	m, err := newStandbyManager(primary, time.Hour, 3, nil)
+	if err != nil {
+		t.Fatalf("newStandbyManager: unexpected error: %v", err)
+	}
+	if !m.IsStandby() || !m.IsPrimary(primary) ||
+		m.IsPrimary("10.0.0.2:8333") {
+
+		t.Fatal("standby does not follow its primary")
+	}
+
+	// The mempool is only requested from a primary which serves mempool
+	// requests, which requires bloom filtering.
+	if !m.shouldRequestMempool(primary, services) {
+		t.Fatal("mempool is not requested from the primary")
+	}
+	if m.shouldRequestMempool("10.0.0.2:8333", services) {
+		t.Fatal("mempool is requested from a peer other than the primary")
+	}
+	if m.shouldRequestMempool(primary, wire.SFNodeNetwork) {
+		t.Fatal("mempool is requested from a primary without bloom " +
+			"filtering")
+	}
+
+	if err := m.Promote("test"); err != nil {
+		t.Fatalf("Promote: unexpected error: %v", err)
+	}
+	select {
+	case <-m.Promoted():
+	default:
+		t.Fatal("promoted channel is not closed")
+	}
+	status := m.Status()
+	if m.IsStandby() || status.Standby || status.PromotionReason != "test" ||
+		status.PromotedAt.IsZero() {
+
+		t.Fatalf("unexpected status after promotion: %+v", status)
+	}
+	if m.shouldRequestMempool(primary, services) {
+		t.Fatal("mempool is requested after promotion")
+	}
+	if err := m.Promote("again"); err != errNotStandby {
+		t.Fatalf("Promote: got error %v, want %v", err, errNotStandby)
+	}
+	if reason := m.Status().PromotionReason; reason != "test" {
+		t.Fatalf("promotion reason changed to %q", reason)
+	}
+}
+
+// TestStandbyHealthCheck ensures the failures of the health checks of the
+// primary are counted until it is reachable again and that the standby
+// promotes itself once too many consecutive checks failed.
+func TestStandbyHealthCheck(t *testing.T) {
+	var reachable int32 = 1
+	dial := func(net.Addr) (net.Conn, error) {
+		if atomic.LoadInt32(&reachable) == 0 {
+			return nil, errors.New("unreachable")
+		}
+		conn, remote := net.Pipe()
+		remote.Close()
+		return conn, nil
+	}
+	m, err := newStandbyManager("10.0.0.1:8333", time.Millisecond*10, 2,
+		dial)
+	if err != nil {
+		t.Fatalf("newStandbyManager: unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		reachable bool
+		failures  int
+		promote   bool
+	}{
+		{reachable: true, failures: 0},
+		{reachable: false, failures: 1},
+		{reachable: true, failures: 0},
+		{reachable: false, failures: 1},
+		{reachable: false, failures: 2, promote: true},
+	}
+	for i, test := range tests {
+		var flag int32
+		if test.reachable {
+			flag = 1
+		}
+		atomic.StoreInt32(&reachable, flag)
+		promote := m.checkPrimary()
+		status := m.Status()
+		if promote != test.promote ||
+			status.PrimaryReachable != test.reachable ||
+			status.ConsecutiveFailures != test.failures ||
+			status.LastCheck.IsZero() {
+
+			t.Fatalf("check #%d: got promote %v and status %+v, want "+
+				"promote %v, reachable %v, and %d failures", i,
+				promote, status, test.promote, test.reachable,
+				test.failures)
+		}
+	}
+	if !m.IsStandby() {
+		t.Fatal("standby promoted without running the health checks")
+	}
+
+	// Running the health checks against the unreachable primary promotes
+	// the standby.
+	m.Start()
+	defer m.Stop()
+	select {
+	case <-m.Promoted():
+	case <-time.After(time.Second * 5):
+		t.Fatal("standby was not promoted")
+	}
+	status := m.Status()
+	if status.Standby || status.PromotionReason != "primary failed health checks" {
+		t.Fatalf("unexpected status after promotion: %+v", status)
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcutil"
+)
+
+// templateComparisonRecordSize is the size of a serialized template
+// comparison record.
+const templateComparisonRecordSize = 3*8 + chainhash.HashSize + 4 + 3*4 + 3*8
+
+// templateComparisonBucketName is the name of the database bucket used to
+// persist the template comparisons.  The records are keyed by their big endian
+// sequence number so they are iterated in the order they were made.
+var templateComparisonBucketName = []byte("templatecomparisons")
+
+// templateComparisonRecord describes how a block connected to the main chain
+// differs from the most recent block template the node generated for the same
+// parent.
+type templateComparisonRecord struct {
+	ID uint64
+
+	// Hash and Height identify the block.  Time is when the block was
+	// connected and BlockTime is the timestamp of its header.
+	Hash      chainhash.Hash
+	Height    int32
+	Time      time.Time
+	BlockTime time.Time
+
+	// TemplateTime is when the template was generated.
+	TemplateTime time.Time
+
+	// TemplateTxns and BlockTxns are the number of transactions in the
+	// template and the block excluding the coinbase, and SharedTxns is the
+	// number of those which are in both.
+	TemplateTxns int
+	BlockTxns    int
+	SharedTxns   int
+
+	// TemplateFees and BlockFees are the total fees of the template and
+	// the block.  The fees of the block are the ones claimed by its
+	// coinbase.  MissedFees are the fees of the template transactions which
+	// are not in the block.
+	TemplateFees int64
+	BlockFees    int64
+	MissedFees   int64
+}
+
+// serialize returns the serialized template comparison record.  The ID is not
+// part of the record since it is used as the key.
+func (r *templateComparisonRecord) serialize() []byte {
+	serialized := make([]byte, templateComparisonRecordSize)
+	offset := 0
+	for _, t := range []time.Time{r.Time, r.BlockTime, r.TemplateTime} {
+		binary.LittleEndian.PutUint64(serialized[offset:],
+			uint64(t.Unix()))
+		offset += 8
+	}
+	copy(serialized[offset:], r.Hash[:])
+	offset += chainhash.HashSize
+	binary.LittleEndian.PutUint32(serialized[offset:], uint32(r.Height))
+	offset += 4
+	for _, count := range []int{r.TemplateTxns, r.BlockTxns, r.SharedTxns} {
+		binary.LittleEndian.PutUint32(serialized[offset:], uint32(count))
+		offset += 4
+	}
+	for _, fees := range []int64{r.TemplateFees, r.BlockFees, r.MissedFees} {
+		binary.LittleEndian.PutUint64(serialized[offset:], uint64(fees))
+		offset += 8
+	}
+	return serialized
+}
+
+// deserializeTemplateComparisonRecord returns the template comparison record
+// with the passed ID described by the passed serialized bytes.
+func deserializeTemplateComparisonRecord(id uint64, serialized []byte) (*templateComparisonRecord, error) {
+	if len(serialized) != templateComparisonRecordSize {
+		return nil, errors.New("malformed template comparison record")
+	}
+	r := &templateComparisonRecord{ID: id}
+	offset := 0
+	for _, t := range []*time.Time{&r.Time, &r.BlockTime, &r.TemplateTime} {
+		*t = time.Unix(int64(binary.LittleEndian.Uint64(
+			serialized[offset:])), 0)
+		offset += 8
+	}
+	copy(r.Hash[:], serialized[offset:])
+	offset += chainhash.HashSize
+	r.Height = int32(binary.LittleEndian.Uint32(serialized[offset:]))
+	offset += 4
+	for _, count := range []*int{&r.TemplateTxns, &r.BlockTxns,
+		&r.SharedTxns} {
+
+		*count = int(binary.LittleEndian.Uint32(serialized[offset:]))
+		offset += 4
+	}
+	for _, fees := range []*int64{&r.TemplateFees, &r.BlockFees,
+		&r.MissedFees} {
+
+		*fees = int64(binary.LittleEndian.Uint64(serialized[offset:]))
+		offset += 8
+	}
+	return r, nil
+}
+
+// templateSummary holds the parts of a block template which are compared
+// against the blocks that are actually mined.
+type templateSummary struct {
+	prevBlock chainhash.Hash
+	height    int32
+	time      time.Time
+	fees      map[chainhash.Hash]int64
+	totalFees int64
+}
+
+// templateComparer compares every block connected to the main chain to the
+// most recent block template the node generated on top of the same parent and
+// persists the results to the database.  This allows miners to quantify how
+// the templates of the node fare against what the network actually mines:
+// the difference in fees, the transactions which were left out or included
+// unexpectedly, and how old the template was when the block arrived.
+type templateComparer struct {
+	db          database.DB
+	chainParams *chaincfg.Params
+
+	mtx      sync.Mutex
+	nextID   uint64
+	template *templateSummary
+}
+
+// newTemplateComparer returns a new template comparer which persists its
+// records to the passed database and is subscribed to the notifications of the
+// passed chain.  The templates are passed to it via ObserveTemplate.
+func newTemplateComparer(chain *blockchain.BlockChain, db database.DB,
+	chainParams *chaincfg.Params) (*templateComparer, error) {
+
+	c := &templateComparer{db: db, chainParams: chainParams, nextID: 1}
+	err := db.Update(func(dbTx database.Tx) error {
+		bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+			templateComparisonBucketName)
+		if err != nil {
+			return err
+		}
+		cursor := bucket.Cursor()
+		if cursor.Last() {
+			c.nextID = binary.BigEndian.Uint64(cursor.Key()) + 1
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	chain.Subscribe(c.handleBlockchainNotification)
+	return c, nil
+}
+
+// ObserveTemplate records the passed block template as the most recent one.
+//
+// This function is safe for concurrent access.
+func (c *templateComparer) ObserveTemplate(template *mining.BlockTemplate) {
+	summary := &templateSummary{
+		prevBlock: template.Block.Header.PrevBlock,
+		height:    template.Height,
+		time:      time.Now(),
+		fees:      make(map[chainhash.Hash]int64, len(template.Fees)),
+	}
+	for i, tx := range template.Block.Transactions {
+		// The first transaction is the coinbase.
+		if i == 0 || i >= len(template.Fees) {
+			continue
+		}
+		summary.fees[tx.TxHash()] = template.Fees[i]
+		summary.totalFees += template.Fees[i]
+	}
+
+	c.mtx.Lock()
+	c.template = summary
+	c.mtx.Unlock()
+}
+
+// compare returns the comparison of the passed block with the passed template,
+// which must have been built on top of the same parent.
+func (c *templateComparer) compare(template *templateSummary,
+	block *btcutil.Block) *templateComparisonRecord {
+
+	msgBlock := block.MsgBlock()
+	record := &templateComparisonRecord{
+		Hash:         *block.Hash(),
+		Height:       block.Height(),
+		Time:         time.Unix(time.Now().Unix(), 0),
+		BlockTime:    msgBlock.Header.Timestamp,
+		TemplateTime: time.Unix(template.time.Unix(), 0),
+		TemplateTxns: len(template.fees),
+		TemplateFees: template.totalFees,
+		MissedFees:   template.totalFees,
+	}
+	for i, tx := range block.Transactions() {
+		if i == 0 {
+			continue
+		}
+		record.BlockTxns++
+		if fee, ok := template.fees[*tx.Hash()]; ok {
+			record.SharedTxns++
+			record.MissedFees -= fee
+		}
+	}
+
+	// The fees of the block are derived from its coinbase since the outputs
+	// spent by it are no longer available.  Coinbases may claim less than
+	// they are allowed to.
+	var claimed int64
+	for _, txOut := range msgBlock.Transactions[0].TxOut {
+		claimed += txOut.Value
+	}
+	subsidy := blockchain.CalcBlockSubsidy(block.Height(), c.chainParams)
+	if claimed > subsidy {
+		record.BlockFees = claimed - subsidy
+	}
+	return record
+}
+
+// handleBlockchainNotification compares the blocks connected to the main chain
+// to the most recent template and persists the comparison.
+func (c *templateComparer) handleBlockchainNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockConnected {
+		return
+	}
+	block, ok := notification.Data.(*btcutil.Block)
+	if !ok {
+		srvrLog.Warnf("Chain connected notification is not a block.")
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	template := c.template
+	if template == nil || template.height != block.Height() ||
+		template.prevBlock != block.MsgBlock().Header.PrevBlock {
+
+		return
+	}
+	record := c.compare(template, block)
+	record.ID = c.nextID
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], record.ID)
+	err := c.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(templateComparisonBucketName)
+		return bucket.Put(key[:], record.serialize())
+	})
+	if err != nil {
+		srvrLog.Errorf("Unable to persist template comparison for block "+
+			"%v: %v", block.Hash(), err)
+		return
+	}
+	c.nextID++
+
+	// The template is stale now that its parent is no longer the tip.
+	c.template = nil
+}
+
+// Records returns up to count records starting after skipping the passed
+// number of records along with the total number of records.  The records are
+// ordered from the most recent to the oldest unless reverse is set.
+//
+// This function is safe for concurrent access.
+func (c *templateComparer) Records(skip, count int, reverse bool) ([]*templateComparisonRecord, int, error) {
+	var records []*templateComparisonRecord
+	var total int
+	err := c.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(templateComparisonBucketName)
+		cursor := bucket.Cursor()
+		first, next := cursor.Last, cursor.Prev
+		if reverse {
+			first, next = cursor.First, cursor.Next
+		}
+		for ok := first(); ok; ok = next() {
+			total++
+			if total <= skip || len(records) >= count {
+				continue
+			}
+			id := binary.BigEndian.Uint64(cursor.Key())
+			record, err := deserializeTemplateComparisonRecord(id,
+				cursor.Value())
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
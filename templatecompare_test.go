@@ -0,0 +1,169 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/database"
+	_ "github.com/btcsuite/btcd/database/ffldb"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestTemplateComparisonRecordSerialization ensures template comparison
+// records survive a round trip through their serialized form.
+func TestTemplateComparisonRecordSerialization(t *testing.T) {
+	want := &templateComparisonRecord{
+		ID:           3,
+		Hash:         chainhash.Hash{0x01},
+		Height:       700000,
+		Time:         time.Unix(1600000100, 0),
+		BlockTime:    time.Unix(1600000090, 0),
+		TemplateTime: time.Unix(1600000040, 0),
+		TemplateTxns: 2500,
+		BlockTxns:    2600,
+		SharedTxns:   2400,
+		TemplateFees: 25000000,
+		BlockFees:    26000000,
+		MissedFees:   400000,
+	}
+
+	serialized := want.serialize()
+	got, err := deserializeTemplateComparisonRecord(want.ID, serialized)
+	if err != nil {
+		t.Fatalf("unexpected deserialize error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mismatched record - got %+v, want %+v", got, want)
+	}
+
+	if _, err := deserializeTemplateComparisonRecord(1, serialized[:20]); err == nil {
+		t.Fatal("truncated record was not rejected")
+	}
+}
+
+// TestTemplateComparer ensures connected blocks are compared with the most
+// recent template built on top of the same parent and that the comparisons are
+// persisted.
+func TestTemplateComparer(t *testing.T) {
+	dbPath, err := ioutil.TempDir("", "templatecompare")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", filepath.Join(dbPath, "db"),
+		wire.MainNet)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+	err = db.Update(func(dbTx database.Tx) error {
+		_, err := dbTx.Metadata().CreateBucket(
+			templateComparisonBucketName)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unable to create bucket: %v", err)
+	}
+	c := &templateComparer{
+		db:          db,
+		chainParams: &chaincfg.MainNetParams,
+		nextID:      1,
+	}
+
+	// newTx returns a unique transaction.
+	newTx := func(n byte) *wire.MsgTx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{n}},
+			nil, nil))
+		tx.AddTxOut(wire.NewTxOut(1000, nil))
+		return tx
+	}
+	newCoinbase := func(value int64) *wire.MsgTx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{
+			Index: wire.MaxPrevOutIndex,
+		}, nil, nil))
+		tx.AddTxOut(wire.NewTxOut(value, nil))
+		return tx
+	}
+	parent := chainhash.Hash{0xff}
+	txA, txB, txC := newTx(1), newTx(2), newTx(3)
+
+	// The template includes transactions A and B while the block includes
+	// transactions B and C.
+	subsidy := blockchain.CalcBlockSubsidy(100, &chaincfg.MainNetParams)
+	templateBlock := wire.NewMsgBlock(&wire.BlockHeader{PrevBlock: parent})
+	templateBlock.AddTransaction(newCoinbase(subsidy + 500))
+	templateBlock.AddTransaction(txA)
+	templateBlock.AddTransaction(txB)
+	c.ObserveTemplate(&mining.BlockTemplate{
+		Block:  templateBlock,
+		Fees:   []int64{-500, 300, 200},
+		Height: 100,
+	})
+
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{
+		PrevBlock: parent,
+		Timestamp: time.Unix(1600000000, 0),
+	})
+	msgBlock.AddTransaction(newCoinbase(subsidy + 700))
+	msgBlock.AddTransaction(txB)
+	msgBlock.AddTransaction(txC)
+	block := btcutil.NewBlock(msgBlock)
+	block.SetHeight(100)
+
+	// A block at another height is not compared.
+	otherBlock := btcutil.NewBlock(msgBlock)
+	otherBlock.SetHeight(101)
+	for _, b := range []*btcutil.Block{otherBlock, block, block} {
+		c.handleBlockchainNotification(&blockchain.Notification{
+			Type: blockchain.NTBlockConnected,
+			Data: b,
+		})
+	}
+
+	// Only the first connection of the block is compared since the
+	// template is stale afterwards.
+	records, total, err := c.Records(0, 100, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 1 || len(records) != 1 {
+		t.Fatalf("wrong number of records - got %d, want 1", total)
+	}
+	got := records[0]
+	want := &templateComparisonRecord{
+		ID:           1,
+		Hash:         *block.Hash(),
+		Height:       100,
+		Time:         got.Time,
+		BlockTime:    time.Unix(1600000000, 0),
+		TemplateTime: got.TemplateTime,
+		TemplateTxns: 2,
+		BlockTxns:    2,
+		SharedTxns:   1,
+		TemplateFees: 500,
+		BlockFees:    700,
+		MissedFees:   300,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mismatched comparison - got %+v, want %+v", got, want)
+	}
+	if got.Time.Before(got.TemplateTime) {
+		t.Fatalf("block connected at %v before the template was "+
+			"generated at %v", got.Time, got.TemplateTime)
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btclog"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// traceKindPeer identifies trace targets which match the log messages
+	// about a peer by its address.
+	traceKindPeer = "peer"
+
+	// traceKindTx identifies trace targets which match the log messages
+	// about a transaction by its hash.
+	traceKindTx = "tx"
+
+	// traceKindAddr identifies trace targets which match the log messages
+	// about a bitcoin address as well as about the transactions paying to
+	// it.
+	traceKindAddr = "addr"
+
+	// maxTraceAddrTxns is the maximum number of transactions paying to the
+	// traced bitcoin addresses which are traced along with them.  The
+	// oldest transaction is no longer traced once it is reached.
+	maxTraceAddrTxns = 1000
+)
+
+// traceTarget is a target of the selective trace logging.
+type traceTarget struct {
+	kind  string
+	value string
+
+	// messages is the number of log messages which matched the target.
+	messages uint64
+
+	// txns are the hashes of the transactions paying to the target when
+	// it is a bitcoin address.
+	txns []string
+}
+
+// traceTargets is the set of targets of the selective trace logging.  Trace
+// and debug log messages of all subsystems which mention one of the targets are
+// logged at the info level regardless of the log level of the subsystem, so
+// all of the log messages about a specific peer, transaction, or address can be
+// seen without raising the log level of all subsystems.
+type traceTargets struct {
+	active  int32 // Atomic, whether there are any targets.
+	mtx     sync.RWMutex
+	targets map[string]*traceTarget
+}
+
+// newTraceTargets returns a new empty set of trace targets.
+func newTraceTargets() *traceTargets {
+	return &traceTargets{targets: make(map[string]*traceTarget)}
+}
+
+// logTraceTargets are the targets of the selective trace logging of all
+// subsystem loggers.
+var logTraceTargets = newTraceTargets()
+
+// parseTraceTarget parses a trace target in the form of <kind>:<value>, such as
+// peer:1.2.3.4, tx:<txid>, or addr:<address>.
+func parseTraceTarget(target string, params *chaincfg.Params) (*traceTarget, error) {
+	parts := strings.SplitN(target, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("trace target %q is not in the form "+
+			"<kind>:<value>", target)
+	}
+
+	kind, value := parts[0], parts[1]
+	switch kind {
+	case traceKindPeer:
+	case traceKindTx:
+		hash, err := chainhash.NewHashFromStr(value)
+		if err != nil || len(value) != chainhash.MaxHashStringSize {
+			return nil, fmt.Errorf("trace target %q is not a "+
+				"transaction hash", target)
+		}
+		value = hash.String()
+	case traceKindAddr:
+		addr, err := btcutil.DecodeAddress(value, params)
+		if err != nil || !addr.IsForNet(params) {
+			return nil, fmt.Errorf("trace target %q is not an "+
+				"address for %s", target, params.Name)
+		}
+		value = addr.EncodeAddress()
+	default:
+		return nil, fmt.Errorf("trace target %q has unknown kind %q -- "+
+			"supported kinds are %s, %s, and %s", target, kind,
+			traceKindPeer, traceKindTx, traceKindAddr)
+	}
+
+	return &traceTarget{kind: kind, value: value}, nil
+}
+
+// key returns the key of the target in the set of targets.
+func (t *traceTarget) key() string {
+	return t.kind + ":" + t.value
+}
+
+// Add adds the passed target to the set.  Adding an existing target does
+// nothing.
+//
+// This function is safe for concurrent access.
+func (tt *traceTargets) Add(target *traceTarget) {
+	tt.mtx.Lock()
+	if _, ok := tt.targets[target.key()]; !ok {
+		tt.targets[target.key()] = target
+	}
+	atomic.StoreInt32(&tt.active, 1)
+	tt.mtx.Unlock()
+}
+
+// Remove removes the passed target from the set and returns whether it was
+// part of it.
+//
+// This function is safe for concurrent access.
+func (tt *traceTargets) Remove(target *traceTarget) bool {
+	tt.mtx.Lock()
+	defer tt.mtx.Unlock()
+
+	if _, ok := tt.targets[target.key()]; !ok {
+		return false
+	}
+	delete(tt.targets, target.key())
+	if len(tt.targets) == 0 {
+		atomic.StoreInt32(&tt.active, 0)
+	}
+	return true
+}
+
+// Clear removes all targets from the set.
+//
+// This function is safe for concurrent access.
+func (tt *traceTargets) Clear() {
+	tt.mtx.Lock()
+	tt.targets = make(map[string]*traceTarget)
+	atomic.StoreInt32(&tt.active, 0)
+	tt.mtx.Unlock()
+}
+
+// Active returns whether there are any targets.
+//
+// This function is safe for concurrent access.
+func (tt *traceTargets) Active() bool {
+	return atomic.LoadInt32(&tt.active) == 1
+}
+
+// Match returns the key of the first target the passed log message mentions or
+// an empty string when there is none.
+//
+// This function is safe for concurrent access.
+func (tt *traceTargets) Match(msg string) string {
+	tt.mtx.RLock()
+	defer tt.mtx.RUnlock()
+
+	for key, target := range tt.targets {
+		match := strings.Contains(msg, target.value)
+		for i := 0; !match && i < len(target.txns); i++ {
+			match = strings.Contains(msg, target.txns[i])
+		}
+		if match {
+			atomic.AddUint64(&target.messages, 1)
+			return key
+		}
+	}
+	return ""
+}
+
+// ObserveTxns starts tracing the passed transactions which pay to one of the
+// bitcoin address targets, so the log messages about them are elevated along
+// with the ones about the address.
+//
+// This function is safe for concurrent access.
+func (tt *traceTargets) ObserveTxns(txns []*btcutil.Tx, params *chaincfg.Params) {
+	if !tt.Active() {
+		return
+	}
+
+	tt.mtx.Lock()
+	defer tt.mtx.Unlock()
+
+	for _, tx := range txns {
+		for _, txOut := range tx.MsgTx().TxOut {
+			_, addrs, _, _ := txscript.ExtractPkScriptAddrs(
+				txOut.PkScript, params)
+			for _, addr := range addrs {
+				key := traceKindAddr + ":" + addr.EncodeAddress()
+				target, ok := tt.targets[key]
+				if !ok {
+					continue
+				}
+				if len(target.txns) == maxTraceAddrTxns {
+					target.txns = target.txns[1:]
+				}
+				target.txns = append(target.txns, tx.Hash().String())
+			}
+		}
+	}
+}
+
+// traceTargetInfo is the state of a trace target returned by Targets.
+type traceTargetInfo struct {
+	Kind     string
+	Value    string
+	Messages uint64
+	Txns     int
+}
+
+// Targets returns the state of the targets ordered by kind and value.
+//
+// This function is safe for concurrent access.
+func (tt *traceTargets) Targets() []traceTargetInfo {
+	tt.mtx.RLock()
+	infos := make([]traceTargetInfo, 0, len(tt.targets))
+	for _, target := range tt.targets {
+		infos = append(infos, traceTargetInfo{
+			Kind:     target.kind,
+			Value:    target.value,
+			Messages: atomic.LoadUint64(&target.messages),
+			Txns:     len(target.txns),
+		})
+	}
+	tt.mtx.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Kind != infos[j].Kind {
+			return infos[i].Kind < infos[j].Kind
+		}
+		return infos[i].Value < infos[j].Value
+	})
+	return infos
+}
+
+// traceLogger is a btclog.Logger which logs the trace and debug messages which
+// mention one of the trace targets at the info level when the log level of the
+// wrapped logger would otherwise drop them.
+type traceLogger struct {
+	btclog.Logger
+	targets *traceTargets
+}
+
+// newTraceLogger returns a logger which elevates the trace and debug messages
+// of the passed logger which mention one of the passed targets.
+func newTraceLogger(logger btclog.Logger, targets *traceTargets) btclog.Logger {
+	return &traceLogger{Logger: logger, targets: targets}
+}
+
+// elevate logs the passed message at the info level when the wrapped logger
+// drops messages of the passed level and the message mentions one of the trace
+// targets.  Formatting the message is deferred until it is known that there
+// are targets, so there is no overhead when selective trace logging is not
+// used.
+func (l *traceLogger) elevate(level btclog.Level, msg func() string) {
+	if l.Logger.Level() <= level || !l.targets.Active() {
+		return
+	}
+
+	text := msg()
+	if key := l.targets.Match(text); key != "" {
+		l.Logger.Infof("[%s %s] %s", level, key, text)
+	}
+}
+
+// Tracef formats the message according to the format specifier and writes it
+// to the log with LevelTrace or elevates it when it mentions a trace target.
+func (l *traceLogger) Tracef(format string, params ...interface{}) {
+	l.Logger.Tracef(format, params...)
+	l.elevate(btclog.LevelTrace, func() string {
+		return fmt.Sprintf(format, params...)
+	})
+}
+
+// Debugf formats the message according to the format specifier and writes it
+// to the log with LevelDebug or elevates it when it mentions a trace target.
+func (l *traceLogger) Debugf(format string, params ...interface{}) {
+	l.Logger.Debugf(format, params...)
+	l.elevate(btclog.LevelDebug, func() string {
+		return fmt.Sprintf(format, params...)
+	})
+}
+
+// Trace formats the message using the default formats for its operands and
+// writes it to the log with LevelTrace or elevates it when it mentions a
+// trace target.
+func (l *traceLogger) Trace(v ...interface{}) {
+	l.Logger.Trace(v...)
+	l.elevate(btclog.LevelTrace, func() string {
+		return fmt.Sprint(v...)
+	})
+}
+
+// Debug formats the message using the default formats for its operands and
+// writes it to the log with LevelDebug or elevates it when it mentions a trace
+// target.
+func (l *traceLogger) Debug(v ...interface{}) {
+	l.Logger.Debug(v...)
+	l.elevate(btclog.LevelDebug, func() string {
+		return fmt.Sprint(v...)
+	})
+}
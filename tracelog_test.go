@@ -0,0 +1,111 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btclog"
+)
+
+// TestParseTraceTarget ensures trace targets are parsed and normalized as
+// expected and that malformed targets are rejected.
+func TestParseTraceTarget(t *testing.T) {
+	const txid = "0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098"
+	tests := []struct {
+		in      string
+		wantKey string
+		wantErr bool
+	}{
+		{in: "peer:1.2.3.4:8333", wantKey: "peer:1.2.3.4:8333"},
+		{in: "tx:" + txid, wantKey: "tx:" + txid},
+		{
+			in:      "addr:1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+			wantKey: "addr:1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		},
+		{in: "peer", wantErr: true},
+		{in: "peer:", wantErr: true},
+		{in: "tx:1234", wantErr: true},
+		{in: "addr:mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", wantErr: true},
+		{in: "block:" + txid, wantErr: true},
+	}
+
+	for _, test := range tests {
+		target, err := parseTraceTarget(test.in, &chaincfg.MainNetParams)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: unexpected error %v", test.in, err)
+			continue
+		}
+		if err == nil && target.key() != test.wantKey {
+			t.Errorf("%q: got key %q, want %q", test.in, target.key(),
+				test.wantKey)
+		}
+	}
+}
+
+// TestTraceLogger ensures only the trace and debug messages which mention one
+// of the trace targets are elevated.
+func TestTraceLogger(t *testing.T) {
+	var buf bytes.Buffer
+	backend := btclog.NewBackend(&buf)
+	logger := backend.Logger("TEST")
+	logger.SetLevel(btclog.LevelInfo)
+
+	targets := newTraceTargets()
+	log := newTraceLogger(logger, targets)
+
+	// Nothing is elevated without targets.
+	log.Debugf("Received inv from %s", "1.2.3.4:8333")
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected log output %q", buf.String())
+	}
+
+	target, err := parseTraceTarget("peer:1.2.3.4:8333",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("parseTraceTarget: %v", err)
+	}
+	targets.Add(target)
+	if !targets.Active() {
+		t.Fatal("targets are not active after adding a target")
+	}
+
+	log.Debugf("Received inv from %s", "1.2.3.4:8333")
+	log.Tracef("Received inv from %s", "5.6.7.8:8333")
+	log.Trace("Sending ping to ", "1.2.3.4:8333")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d elevated messages, want 2: %q", len(lines),
+			buf.String())
+	}
+	if !strings.Contains(lines[0], "[INF] TEST: [DBG peer:1.2.3.4:8333] "+
+		"Received inv from 1.2.3.4:8333") {
+		t.Fatalf("unexpected elevated message %q", lines[0])
+	}
+
+	infos := targets.Targets()
+	if len(infos) != 1 || infos[0].Messages != 2 {
+		t.Fatalf("unexpected targets %+v", infos)
+	}
+
+	// Messages are not logged twice when the level of the logger already
+	// includes them.
+	buf.Reset()
+	logger.SetLevel(btclog.LevelDebug)
+	log.Debugf("Received inv from %s", "1.2.3.4:8333")
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Fatalf("unexpected log output %q", buf.String())
+	}
+
+	if !targets.Remove(target) || targets.Active() {
+		t.Fatal("targets are active after removing the only target")
+	}
+	if targets.Remove(target) {
+		t.Fatal("removed unknown target")
+	}
+}
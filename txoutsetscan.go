@@ -0,0 +1,97 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// defaultScanRangeEnd is the last child index a ranged descriptor is
+	// expanded to by the scantxoutset RPC unless a range is given.
+	defaultScanRangeEnd = 1000
+
+	// maxScanRangeSize is the maximum number of child indexes a ranged
+	// descriptor is expanded to by the scantxoutset RPC.
+	maxScanRangeSize = 1000000
+)
+
+// txOutSetScan tracks the scan of the unspent transaction output set which is
+// started by the scantxoutset RPC.  Only one scan may be in progress at a time,
+// so other requests can query its progress and abort it.
+//
+// The zero value is ready to use and it is safe for concurrent access.
+type txOutSetScan struct {
+	mtx sync.Mutex
+
+	// abortChan is closed to abort the scan in progress.  It is nil when
+	// no scan is in progress and aborted is set once it is closed.
+	abortChan chan struct{}
+	aborted   bool
+
+	// position holds the first two bytes of the hash of the transaction
+	// the scan is at.  Since the set is scanned in the order of the
+	// outpoints, it indicates the progress of the scan.  It must be
+	// accessed atomically.
+	position uint32
+}
+
+// start marks a scan in progress and returns the channel which is closed when
+// it is to be aborted.  It returns false when another scan is in progress.
+func (s *txOutSetScan) start() (<-chan struct{}, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.abortChan != nil {
+		return nil, false
+	}
+	s.abortChan = make(chan struct{})
+	s.aborted = false
+	atomic.StoreUint32(&s.position, 0)
+	return s.abortChan, true
+}
+
+// finish marks the scan in progress as finished.
+func (s *txOutSetScan) finish() {
+	s.mtx.Lock()
+	s.abortChan = nil
+	s.mtx.Unlock()
+}
+
+// abort aborts the scan in progress.  It returns false when no scan is in
+// progress.
+func (s *txOutSetScan) abort() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.abortChan == nil {
+		return false
+	}
+	if !s.aborted {
+		close(s.abortChan)
+		s.aborted = true
+	}
+	return true
+}
+
+// setPosition records the passed outpoint as the position of the scan in
+// progress.
+func (s *txOutSetScan) setPosition(outpoint *wire.OutPoint) {
+	position := uint32(outpoint.Hash[0])<<8 | uint32(outpoint.Hash[1])
+	atomic.StoreUint32(&s.position, position)
+}
+
+// progress returns the progress of the scan in progress in percent.  It returns
+// false when no scan is in progress.
+func (s *txOutSetScan) progress() (float64, bool) {
+	s.mtx.Lock()
+	inProgress := s.abortChan != nil
+	s.mtx.Unlock()
+	if !inProgress {
+		return 0, false
+	}
+	return float64(atomic.LoadUint32(&s.position)) * 100 / (1 << 16), true
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestTxOutSetScan ensures only one scan of the utxo set may be in progress at
+// a time and that its progress is reported until it is finished or aborted.
+func TestTxOutSetScan(t *testing.T) {
+	var scan txOutSetScan
+	if _, ok := scan.progress(); ok {
+		t.Fatal("progress reported without a scan in progress")
+	}
+	if scan.abort() {
+		t.Fatal("aborted without a scan in progress")
+	}
+
+	abortChan, ok := scan.start()
+	if !ok {
+		t.Fatal("unable to start a scan")
+	}
+	if _, ok := scan.start(); ok {
+		t.Fatal("started a second scan while one is in progress")
+	}
+	scan.setPosition(&wire.OutPoint{Hash: [32]byte{0x40}})
+	if progress, ok := scan.progress(); !ok || progress != 25 {
+		t.Fatalf("got progress %v (%v), want 25", progress, ok)
+	}
+
+	// Aborting closes the channel once, however often it is requested.
+	if !scan.abort() || !scan.abort() {
+		t.Fatal("scan in progress was not aborted")
+	}
+	select {
+	case <-abortChan:
+	default:
+		t.Fatal("abort channel was not closed")
+	}
+	scan.finish()
+	if _, ok := scan.progress(); ok {
+		t.Fatal("progress reported after the scan finished")
+	}
+
+	if _, ok := scan.start(); !ok {
+		t.Fatal("unable to start a scan after the previous one finished")
+	}
+	if progress, _ := scan.progress(); progress != 0 {
+		t.Fatalf("got progress %v of a new scan, want 0", progress)
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package txrecon implements set reconciliation based transaction relay as
+defined by BIP0330 (Erlay).
+
+Overview
+
+Rather than announcing every transaction to every peer, peers which support
+reconciliation periodically compare the sets of transactions they would have
+announced to each other.  Each side summarizes its set in a sketch of short
+transaction ids whose size only depends on the expected size of the set
+difference.  Combining both sketches reveals the transactions only one side
+has, which are then announced through regular inventory messages.
+
+The sketches are PinSketch BCH sketches over GF(2^32) which are compatible
+with the minisketch library used by other implementations.
+
+When the set difference exceeds the capacity of a sketch, the reconciliation
+round fails and both sides fall back to announcing their whole snapshot.
+*/
+package txrecon
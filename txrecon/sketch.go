@@ -0,0 +1,382 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txrecon
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// fieldModulus is the low part of the irreducible polynomial
+	// x^32 + x^7 + x^3 + x^2 + 1 which defines the GF(2^32) field the
+	// sketch elements live in.  It is the same field as used by minisketch
+	// for 32-bit elements.
+	fieldModulus = 0x8d
+
+	// elementSize is the size of a serialized sketch element in bytes.
+	elementSize = 4
+)
+
+var (
+	// ErrDecodeFailed is returned when a sketch holds more elements than
+	// its capacity so the elements can't be recovered.
+	ErrDecodeFailed = errors.New("sketch decoding failed")
+
+	// ErrInvalidSketch is returned when serialized sketch data is malformed.
+	ErrInvalidSketch = errors.New("invalid sketch data")
+)
+
+// gfMul returns the product of a and b in GF(2^32).
+func gfMul(a, b uint32) uint32 {
+	var r uint32
+	for b != 0 {
+		if b&1 != 0 {
+			r ^= a
+		}
+		b >>= 1
+		carry := a & 0x80000000
+		a <<= 1
+		if carry != 0 {
+			a ^= fieldModulus
+		}
+	}
+	return r
+}
+
+// gfSqr returns the square of a in GF(2^32).
+func gfSqr(a uint32) uint32 {
+	return gfMul(a, a)
+}
+
+// gfInv returns the multiplicative inverse of a in GF(2^32), which is
+// a^(2^32-2).  The inverse of 0 is defined as 0.
+func gfInv(a uint32) uint32 {
+	// 2^32-2 consists of 31 one bits followed by a zero bit.
+	r := uint32(1)
+	for i := 0; i < 31; i++ {
+		r = gfMul(gfSqr(r), a)
+	}
+	return gfSqr(r)
+}
+
+// Sketch is a PinSketch of a set of non-zero 32-bit elements.  It consists of
+// the odd power sums of the elements in GF(2^32) and is able to recover up to
+// capacity elements.  Since addition in the field is XOR, adding an element
+// twice removes it, so combining the sketches of two sets yields the sketch
+// of their symmetric difference.
+type Sketch struct {
+	sums []uint32
+}
+
+// NewSketch returns a new empty sketch with the passed capacity.
+func NewSketch(capacity int) *Sketch {
+	return &Sketch{sums: make([]uint32, capacity)}
+}
+
+// Capacity returns the maximum number of elements that can be recovered from
+// the sketch.
+func (s *Sketch) Capacity() int {
+	return len(s.sums)
+}
+
+// Add adds the passed element to the sketch or removes it when it was already
+// added.  Zero elements are ignored since they can't be represented.
+func (s *Sketch) Add(element uint32) {
+	if element == 0 {
+		return
+	}
+	sqr := gfSqr(element)
+	power := element
+	for i := range s.sums {
+		s.sums[i] ^= power
+		power = gfMul(power, sqr)
+	}
+}
+
+// Merge combines the passed sketch into the receiver so it represents the
+// symmetric difference of both sets.  The sketches must have the same
+// capacity.
+func (s *Sketch) Merge(other *Sketch) error {
+	if len(other.sums) != len(s.sums) {
+		return errors.New("sketch capacity mismatch")
+	}
+	for i := range s.sums {
+		s.sums[i] ^= other.sums[i]
+	}
+	return nil
+}
+
+// Serialize returns the serialized sketch which consists of each odd power
+// sum encoded as a 32-bit little-endian integer.
+func (s *Sketch) Serialize() []byte {
+	data := make([]byte, len(s.sums)*elementSize)
+	for i, sum := range s.sums {
+		binary.LittleEndian.PutUint32(data[i*elementSize:], sum)
+	}
+	return data
+}
+
+// DeserializeSketch returns the sketch represented by the passed serialized
+// data.
+func DeserializeSketch(data []byte) (*Sketch, error) {
+	if len(data)%elementSize != 0 {
+		return nil, ErrInvalidSketch
+	}
+	s := NewSketch(len(data) / elementSize)
+	for i := range s.sums {
+		s.sums[i] = binary.LittleEndian.Uint32(data[i*elementSize:])
+	}
+	return s, nil
+}
+
+// Decode recovers the elements represented by the sketch.  ErrDecodeFailed is
+// returned when the sketch holds more elements than its capacity.
+func (s *Sketch) Decode() ([]uint32, error) {
+	// Expand the odd power sums into the full syndrome sequence using
+	// s_2i = s_i^2 which holds in fields of characteristic 2.
+	syndromes := make([]uint32, 2*len(s.sums))
+	for i := range syndromes {
+		power := i + 1
+		if power%2 == 1 {
+			syndromes[i] = s.sums[power/2]
+		} else {
+			syndromes[i] = gfSqr(syndromes[power/2-1])
+		}
+	}
+
+	locator := berlekampMassey(syndromes)
+	numElements := len(locator) - 1
+	if numElements == 0 {
+		return nil, nil
+	}
+	if numElements > len(s.sums) || locator[numElements] == 0 {
+		return nil, ErrDecodeFailed
+	}
+
+	// The locator polynomial has the inverses of the elements as roots, so
+	// reversing its coefficients yields a polynomial whose roots are the
+	// elements themselves.
+	poly := make(polynomial, len(locator))
+	for i := range locator {
+		poly[i] = locator[len(locator)-1-i]
+	}
+	poly.makeMonic()
+
+	roots, ok := findRoots(poly)
+	if !ok || len(roots) != numElements {
+		return nil, ErrDecodeFailed
+	}
+	return roots, nil
+}
+
+// polynomial is a polynomial over GF(2^32) with the coefficients ordered from
+// the lowest to the highest degree.
+type polynomial []uint32
+
+// degree returns the degree of the polynomial or -1 for the zero polynomial.
+func (p polynomial) degree() int {
+	for i := len(p) - 1; i >= 0; i-- {
+		if p[i] != 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// trim returns the polynomial without leading zero coefficients.
+func (p polynomial) trim() polynomial {
+	return p[:p.degree()+1]
+}
+
+// makeMonic scales the polynomial so its leading coefficient is one.
+func (p polynomial) makeMonic() {
+	d := p.degree()
+	if d < 0 || p[d] == 1 {
+		return
+	}
+	inv := gfInv(p[d])
+	for i := 0; i <= d; i++ {
+		p[i] = gfMul(p[i], inv)
+	}
+}
+
+// mod returns the remainder of the division of p by the monic polynomial m.
+func (p polynomial) mod(m polynomial) polynomial {
+	r := append(polynomial(nil), p...).trim()
+	dm := m.degree()
+	for d := r.degree(); d >= dm; d = r.degree() {
+		coef := r[d]
+		shift := d - dm
+		for i := 0; i <= dm; i++ {
+			r[shift+i] ^= gfMul(coef, m[i])
+		}
+		r = r.trim()
+	}
+	return r
+}
+
+// div returns the quotient of the division of p by the monic polynomial m.
+func (p polynomial) div(m polynomial) polynomial {
+	r := append(polynomial(nil), p...).trim()
+	dm := m.degree()
+	if r.degree() < dm {
+		return nil
+	}
+	q := make(polynomial, r.degree()-dm+1)
+	for d := r.degree(); d >= dm; d = r.degree() {
+		coef := r[d]
+		shift := d - dm
+		q[shift] = coef
+		for i := 0; i <= dm; i++ {
+			r[shift+i] ^= gfMul(coef, m[i])
+		}
+		r = r.trim()
+	}
+	return q
+}
+
+// mulMod returns a*b mod m for the monic polynomial m.
+func mulMod(a, b, m polynomial) polynomial {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	prod := make(polynomial, len(a)+len(b)-1)
+	for i, ac := range a {
+		if ac == 0 {
+			continue
+		}
+		for j, bc := range b {
+			prod[i+j] ^= gfMul(ac, bc)
+		}
+	}
+	return prod.mod(m)
+}
+
+// gcd returns the monic greatest common divisor of a and b.
+func gcd(a, b polynomial) polynomial {
+	a = append(polynomial(nil), a...).trim()
+	b = append(polynomial(nil), b...).trim()
+	for b.degree() >= 0 {
+		b.makeMonic()
+		a, b = b, a.mod(b)
+	}
+	a.makeMonic()
+	return a
+}
+
+// berlekampMassey returns the shortest linear feedback shift register which
+// generates the passed syndromes, which is the error locator polynomial.
+func berlekampMassey(syndromes []uint32) polynomial {
+	c := polynomial{1}
+	b := polynomial{1}
+	l, m := 0, 1
+	bCoef := uint32(1)
+	for n := range syndromes {
+		// Compute the discrepancy.
+		d := syndromes[n]
+		for i := 1; i <= l && i < len(c); i++ {
+			d ^= gfMul(c[i], syndromes[n-i])
+		}
+		if d == 0 {
+			m++
+			continue
+		}
+
+		coef := gfMul(d, gfInv(bCoef))
+		t := append(polynomial(nil), c...)
+		if need := len(b) + m; len(c) < need {
+			c = append(c, make(polynomial, need-len(c))...)
+		}
+		for i, bc := range b {
+			c[i+m] ^= gfMul(coef, bc)
+		}
+		if 2*l <= n {
+			l = n + 1 - l
+			b = t
+			bCoef = d
+			m = 1
+		} else {
+			m++
+		}
+	}
+	if len(c) < l+1 {
+		c = append(c, make(polynomial, l+1-len(c))...)
+	}
+	return c[:l+1]
+}
+
+// findRoots returns the roots of the passed monic polynomial.  It returns
+// false when the polynomial does not split into distinct linear factors over
+// GF(2^32).
+func findRoots(poly polynomial) ([]uint32, bool) {
+	// A polynomial splits into distinct linear factors over GF(2^32) if and
+	// only if it divides x^(2^32) - x.
+	x := polynomial{0, 1}.mod(poly)
+	xPow := x
+	for i := 0; i < 32; i++ {
+		xPow = mulMod(xPow, xPow, poly)
+	}
+	diff := make(polynomial, len(x))
+	copy(diff, x)
+	if len(xPow) > len(diff) {
+		diff = append(diff, make(polynomial, len(xPow)-len(diff))...)
+	}
+	for i, coef := range xPow {
+		diff[i] ^= coef
+	}
+	if diff.degree() >= 0 {
+		return nil, false
+	}
+
+	roots := make([]uint32, 0, poly.degree())
+	splitRoots(poly, 1, &roots)
+	return roots, true
+}
+
+// splitRoots appends the roots of the passed monic polynomial, which must
+// split into distinct linear factors, to roots using the Berlekamp trace
+// algorithm.
+func splitRoots(poly polynomial, randomizer uint32, roots *[]uint32) {
+	switch poly.degree() {
+	case 0:
+		return
+	case 1:
+		// x + c has the root c in characteristic 2.
+		*roots = append(*roots, poly[0])
+		return
+	}
+
+	// The trace Tr(a*x) = sum (a*x)^(2^i) for i in [0, 32) maps half of the
+	// field elements to 0 and the others to 1, so gcd(poly, Tr(a*x)) is a
+	// non-trivial factor for a suitable a.
+	for a := randomizer; ; a = a*0x9e3779b9 + 1 {
+		if a == 0 {
+			continue
+		}
+		term := polynomial{0, a}.mod(poly)
+		trace := append(polynomial(nil), term...)
+		for i := 1; i < 32; i++ {
+			term = mulMod(term, term, poly)
+			if len(term) > len(trace) {
+				trace = append(trace, make(polynomial,
+					len(term)-len(trace))...)
+			}
+			for j, coef := range term {
+				trace[j] ^= coef
+			}
+		}
+
+		factor := gcd(poly, trace)
+		d := factor.degree()
+		if d <= 0 || d >= poly.degree() {
+			continue
+		}
+		next := a*0x9e3779b9 + 1
+		splitRoots(factor, next, roots)
+		splitRoots(poly.div(factor), next, roots)
+		return
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txrecon
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// sortedElements returns a sorted copy of the passed elements.
+func sortedElements(elements []uint32) []uint32 {
+	sorted := append([]uint32(nil), elements...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// TestGFInv ensures field inversion produces the multiplicative inverse.
+func TestGFInv(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		a := rng.Uint32() | 1
+		if got := gfMul(a, gfInv(a)); got != 1 {
+			t.Fatalf("%x * inv(%x) = %x, want 1", a, a, got)
+		}
+	}
+}
+
+// TestSketchDecode ensures sketches recover the symmetric difference of two
+// sets up to their capacity and fail to decode beyond it.
+func TestSketchDecode(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	tests := []struct {
+		capacity int
+		shared   int
+		diff     int
+		valid    bool
+	}{
+		{capacity: 1, shared: 10, diff: 0, valid: true},
+		{capacity: 1, shared: 10, diff: 1, valid: true},
+		{capacity: 8, shared: 50, diff: 8, valid: true},
+		{capacity: 20, shared: 100, diff: 13, valid: true},
+		{capacity: 64, shared: 0, diff: 64, valid: true},
+		{capacity: 8, shared: 10, diff: 9, valid: false},
+		{capacity: 16, shared: 10, diff: 40, valid: false},
+	}
+
+	for i, test := range tests {
+		a, b := NewSketch(test.capacity), NewSketch(test.capacity)
+		for j := 0; j < test.shared; j++ {
+			element := rng.Uint32() | 1
+			a.Add(element)
+			b.Add(element)
+		}
+		var want []uint32
+		for j := 0; j < test.diff; j++ {
+			element := rng.Uint32() | 1
+			if j%2 == 0 {
+				a.Add(element)
+			} else {
+				b.Add(element)
+			}
+			want = append(want, element)
+		}
+
+		// Round trip one of the sketches through its serialization.
+		b, err := DeserializeSketch(b.Serialize())
+		if err != nil {
+			t.Fatalf("#%d: unexpected deserialize error: %v", i, err)
+		}
+		if err := a.Merge(b); err != nil {
+			t.Fatalf("#%d: unexpected merge error: %v", i, err)
+		}
+		got, err := a.Decode()
+		if !test.valid {
+			if err != ErrDecodeFailed {
+				t.Errorf("#%d: unexpected decode result - got %v, "+
+					"want %v", i, err, ErrDecodeFailed)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: unexpected decode error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(sortedElements(got), sortedElements(want)) {
+			t.Errorf("#%d: mismatched elements - got %x, want %x", i,
+				sortedElements(got), sortedElements(want))
+		}
+	}
+}
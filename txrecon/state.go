@@ -0,0 +1,282 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txrecon
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/aead/siphash"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// DefaultQ is the default coefficient used to estimate the size of the
+	// set difference from the sizes of both sets.
+	DefaultQ = 0.25
+
+	// QPrecision is the value a coefficient of 1 is scaled to when it is
+	// transmitted in a reqrecon message.
+	QPrecision = (2 << 14) - 1
+
+	// MaxCapacity is the maximum sketch capacity that is created or
+	// decoded.  Differences larger than this fall back to flooding.
+	MaxCapacity = 256
+
+	// MaxSetSize is the maximum number of transactions which are queued for
+	// reconciliation with a single peer.  Transactions beyond this limit
+	// are expected to be announced through flooding.
+	MaxSetSize = 3000
+
+	// saltTag is the tag of the hash used to derive the short id key from
+	// the salts of both peers.
+	saltTag = "Tx Relay Salting"
+)
+
+// ErrProtocolViolation is returned when the remote peer sends a
+// reconciliation message which is not expected in the current state.
+var ErrProtocolViolation = errors.New("unexpected reconciliation message")
+
+// State houses the reconciliation state with a single peer.  The outbound side
+// of a connection is the initiator which periodically requests sketches,
+// while the inbound side responds to those requests.
+//
+// The transactions which would otherwise be announced to the peer are added
+// to a reconciliation set.  At the start of a round, the set is moved to a
+// snapshot, so transactions arriving while the round is in progress are
+// reconciled in the next one.
+//
+// State is safe for concurrent access.
+type State struct {
+	mtx       sync.Mutex
+	initiator bool
+	key       [siphash.KeySize]byte
+	set       map[uint32]chainhash.Hash
+	setIndex  map[chainhash.Hash]uint32
+	snapshot  map[uint32]chainhash.Hash
+}
+
+// NewState returns a new reconciliation state for a peer using the passed
+// salts of both sides.  The initiator flag must be set for outbound peers.
+func NewState(initiator bool, localSalt, remoteSalt uint64) *State {
+	minSalt, maxSalt := localSalt, remoteSalt
+	if minSalt > maxSalt {
+		minSalt, maxSalt = maxSalt, minSalt
+	}
+	var salts [16]byte
+	binary.LittleEndian.PutUint64(salts[:8], minSalt)
+	binary.LittleEndian.PutUint64(salts[8:], maxSalt)
+
+	tagHash := sha256.Sum256([]byte(saltTag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	h.Write(salts[:])
+
+	s := &State{
+		initiator: initiator,
+		set:       make(map[uint32]chainhash.Hash),
+		setIndex:  make(map[chainhash.Hash]uint32),
+	}
+	copy(s.key[:], h.Sum(nil))
+	return s
+}
+
+// IsInitiator returns whether the local side initiates reconciliation rounds.
+func (s *State) IsInitiator() bool {
+	return s.initiator
+}
+
+// ShortID returns the 32-bit short id of the transaction with the passed
+// witness hash as defined by BIP0330.
+func (s *State) ShortID(wtxid *chainhash.Hash) uint32 {
+	return uint32(1 + siphash.Sum64(wtxid[:], &s.key)%0xffffffff)
+}
+
+// AddTx adds the transaction to the reconciliation set.  It returns false when
+// the set is full, in which case the transaction must be announced by other
+// means.
+func (s *State) AddTx(txid, wtxid *chainhash.Hash) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, ok := s.setIndex[*txid]; ok {
+		return true
+	}
+	if len(s.set) >= MaxSetSize {
+		return false
+	}
+	shortID := s.ShortID(wtxid)
+	s.set[shortID] = *txid
+	s.setIndex[*txid] = shortID
+	return true
+}
+
+// RemoveTx removes the transaction with the passed hash from the
+// reconciliation set.  It is used when the peer is already known to have the
+// transaction.
+func (s *State) RemoveTx(txid *chainhash.Hash) {
+	s.mtx.Lock()
+	if shortID, ok := s.setIndex[*txid]; ok {
+		delete(s.set, shortID)
+		delete(s.setIndex, *txid)
+	}
+	s.mtx.Unlock()
+}
+
+// SetSize returns the number of transactions awaiting reconciliation.
+func (s *State) SetSize() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return len(s.set)
+}
+
+// takeSnapshot moves the reconciliation set to the snapshot.
+//
+// This function MUST be called with the state lock held.
+func (s *State) takeSnapshot() {
+	s.snapshot = s.set
+	s.set = make(map[uint32]chainhash.Hash)
+	s.setIndex = make(map[chainhash.Hash]uint32)
+}
+
+// sketch returns a sketch of the snapshot with the passed capacity.
+//
+// This function MUST be called with the state lock held.
+func (s *State) sketch(capacity int) *Sketch {
+	sketch := NewSketch(capacity)
+	for shortID := range s.snapshot {
+		sketch.Add(shortID)
+	}
+	return sketch
+}
+
+// snapshotTxs returns the transaction hashes of the whole snapshot.
+//
+// This function MUST be called with the state lock held.
+func (s *State) snapshotTxs() []*chainhash.Hash {
+	txs := make([]*chainhash.Hash, 0, len(s.snapshot))
+	for shortID := range s.snapshot {
+		txHash := s.snapshot[shortID]
+		txs = append(txs, &txHash)
+	}
+	return txs
+}
+
+// InitiateReconciliation starts a new reconciliation round and returns the
+// reqrecon message to send to the peer.  It returns false when the local side
+// is not the initiator or a round is already in progress.
+func (s *State) InitiateReconciliation() (*wire.MsgReqRecon, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if !s.initiator || s.snapshot != nil {
+		return nil, false
+	}
+	s.takeSnapshot()
+	setSize := len(s.snapshot)
+	if setSize > 0xffff {
+		setSize = 0xffff
+	}
+	q := DefaultQ * QPrecision
+	return wire.NewMsgReqRecon(uint16(setSize), uint16(q)), true
+}
+
+// HandleReqRecon handles a reconciliation request from the initiator and
+// returns the sketch to send in response.
+func (s *State) HandleReqRecon(msg *wire.MsgReqRecon) (*wire.MsgSketch, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.initiator || s.snapshot != nil {
+		return nil, ErrProtocolViolation
+	}
+	s.takeSnapshot()
+
+	// Estimate the size of the set difference as described by BIP0330.
+	local, remote := len(s.snapshot), int(msg.SetSize)
+	diff, min := local-remote, remote
+	if diff < 0 {
+		diff, min = -diff, local
+	}
+	q := float64(msg.Q) / QPrecision
+	capacity := diff + int(q*float64(min)) + 1
+	if capacity > MaxCapacity {
+		capacity = MaxCapacity
+	}
+
+	return wire.NewMsgSketch(s.sketch(capacity).Serialize()), nil
+}
+
+// HandleSketch handles the sketch sent by the responder.  It returns the
+// reconcildiff message to send in response and the transactions to announce
+// to the peer.  When the difference can't be decoded, the round fails and the
+// whole snapshot is returned for announcement.
+func (s *State) HandleSketch(msg *wire.MsgSketch) (*wire.MsgReconcilDiff,
+	[]*chainhash.Hash, error) {
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if !s.initiator || s.snapshot == nil {
+		return nil, nil, ErrProtocolViolation
+	}
+	remote, err := DeserializeSketch(msg.SketchData)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { s.snapshot = nil }()
+
+	// A prefix of a sketch is a valid sketch of a smaller capacity, so
+	// larger sketches are truncated rather than rejected.
+	if remote.Capacity() > MaxCapacity {
+		remote.sums = remote.sums[:MaxCapacity]
+	}
+	sketch := s.sketch(remote.Capacity())
+	sketch.Merge(remote)
+	diff, err := sketch.Decode()
+	if err != nil || remote.Capacity() == 0 {
+		return wire.NewMsgReconcilDiff(false, nil), s.snapshotTxs(), nil
+	}
+
+	var announce []*chainhash.Hash
+	var ask []uint32
+	for _, shortID := range diff {
+		txHash, ok := s.snapshot[shortID]
+		if !ok {
+			ask = append(ask, shortID)
+			continue
+		}
+		announce = append(announce, &txHash)
+	}
+	return wire.NewMsgReconcilDiff(true, ask), announce, nil
+}
+
+// HandleReconcilDiff handles the reconciliation result sent by the initiator
+// and returns the transactions to announce to the peer.
+func (s *State) HandleReconcilDiff(msg *wire.MsgReconcilDiff) ([]*chainhash.Hash, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.initiator || s.snapshot == nil {
+		return nil, ErrProtocolViolation
+	}
+	defer func() { s.snapshot = nil }()
+
+	if !msg.Success {
+		return s.snapshotTxs(), nil
+	}
+	announce := make([]*chainhash.Hash, 0, len(msg.AskShortIDs))
+	for _, shortID := range msg.AskShortIDs {
+		if txHash, ok := s.snapshot[shortID]; ok {
+			announce = append(announce, &txHash)
+		}
+	}
+	return announce, nil
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txrecon
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// fakeTx returns distinct fake transaction and witness hashes for the passed
+// index.
+func fakeTx(i int) (*chainhash.Hash, *chainhash.Hash) {
+	txid := chainhash.DoubleHashH([]byte{byte(i), byte(i >> 8), 0})
+	wtxid := chainhash.DoubleHashH([]byte{byte(i), byte(i >> 8), 1})
+	return &txid, &wtxid
+}
+
+// hashSet returns the passed hashes as a set.
+func hashSet(hashes []*chainhash.Hash) map[chainhash.Hash]struct{} {
+	set := make(map[chainhash.Hash]struct{}, len(hashes))
+	for _, hash := range hashes {
+		set[*hash] = struct{}{}
+	}
+	return set
+}
+
+// reconcile runs a full reconciliation round between the passed initiator and
+// responder and returns the transactions each side announces.
+func reconcile(t *testing.T, initiator, responder *State) (map[chainhash.Hash]struct{},
+	map[chainhash.Hash]struct{}, bool) {
+
+	reqRecon, ok := initiator.InitiateReconciliation()
+	if !ok {
+		t.Fatal("unable to initiate reconciliation")
+	}
+	if _, ok := initiator.InitiateReconciliation(); ok {
+		t.Fatal("initiated reconciliation while a round is in progress")
+	}
+	sketch, err := responder.HandleReqRecon(reqRecon)
+	if err != nil {
+		t.Fatalf("unexpected reqrecon error: %v", err)
+	}
+	reconcilDiff, initAnnounce, err := initiator.HandleSketch(sketch)
+	if err != nil {
+		t.Fatalf("unexpected sketch error: %v", err)
+	}
+	respAnnounce, err := responder.HandleReconcilDiff(reconcilDiff)
+	if err != nil {
+		t.Fatalf("unexpected reconcildiff error: %v", err)
+	}
+	return hashSet(initAnnounce), hashSet(respAnnounce), reconcilDiff.Success
+}
+
+// TestReconciliation ensures two peers running a reconciliation round only
+// announce the transactions the other side is missing and fall back to
+// announcing their whole set when the difference is too large.
+func TestReconciliation(t *testing.T) {
+	initiator := NewState(true, 1, 2)
+	responder := NewState(false, 2, 1)
+	txid, wtxid := fakeTx(0)
+	if initiator.ShortID(wtxid) != responder.ShortID(wtxid) {
+		t.Fatal("short ids of both sides differ")
+	}
+
+	// Messages which are not expected in the current state must be
+	// rejected.
+	if _, err := initiator.HandleReqRecon(nil); err != ErrProtocolViolation {
+		t.Fatalf("unexpected reqrecon result - got %v, want %v", err,
+			ErrProtocolViolation)
+	}
+	if _, err := responder.HandleReconcilDiff(nil); err != ErrProtocolViolation {
+		t.Fatalf("unexpected reconcildiff result - got %v, want %v",
+			err, ErrProtocolViolation)
+	}
+
+	// Both sides share 100 transactions while the initiator has 3 and the
+	// responder 4 transactions the other side is missing.
+	wantInit := make(map[chainhash.Hash]struct{})
+	wantResp := make(map[chainhash.Hash]struct{})
+	for i := 0; i < 107; i++ {
+		txid, wtxid = fakeTx(i)
+		switch {
+		case i < 100:
+			initiator.AddTx(txid, wtxid)
+			responder.AddTx(txid, wtxid)
+		case i < 103:
+			initiator.AddTx(txid, wtxid)
+			wantInit[*txid] = struct{}{}
+		default:
+			responder.AddTx(txid, wtxid)
+			wantResp[*txid] = struct{}{}
+		}
+	}
+
+	// Transactions the peer is known to have must not be announced.
+	txid, _ = fakeTx(100)
+	initiator.RemoveTx(txid)
+	delete(wantInit, *txid)
+
+	gotInit, gotResp, success := reconcile(t, initiator, responder)
+	if !success {
+		t.Fatal("reconciliation failed")
+	}
+	if len(gotInit) != len(wantInit) || len(gotResp) != len(wantResp) {
+		t.Fatalf("unexpected number of announcements - got %d/%d, "+
+			"want %d/%d", len(gotInit), len(gotResp), len(wantInit),
+			len(wantResp))
+	}
+	for hash := range wantInit {
+		if _, ok := gotInit[hash]; !ok {
+			t.Fatalf("initiator did not announce %v", hash)
+		}
+	}
+	for hash := range wantResp {
+		if _, ok := gotResp[hash]; !ok {
+			t.Fatalf("responder did not announce %v", hash)
+		}
+	}
+	if initiator.SetSize() != 0 || responder.SetSize() != 0 {
+		t.Fatal("sets were not cleared by the reconciliation round")
+	}
+
+	// A difference far beyond the estimated capacity fails and falls back
+	// to announcing everything.
+	for i := 200; i < 250; i++ {
+		txid, wtxid = fakeTx(i)
+		responder.AddTx(txid, wtxid)
+	}
+	txid, wtxid = fakeTx(300)
+	initiator.AddTx(txid, wtxid)
+	responder.AddTx(txid, wtxid)
+	// Understate the initiator's set difference so the capacity of the
+	// sketch is too low.
+	reqRecon, _ := initiator.InitiateReconciliation()
+	reqRecon.SetSize = 41
+	reqRecon.Q = 0
+	sketch, err := responder.HandleReqRecon(reqRecon)
+	if err != nil {
+		t.Fatalf("unexpected reqrecon error: %v", err)
+	}
+	reconcilDiff, initAnnounce, err := initiator.HandleSketch(sketch)
+	if err != nil {
+		t.Fatalf("unexpected sketch error: %v", err)
+	}
+	if reconcilDiff.Success {
+		t.Fatal("reconciliation unexpectedly succeeded")
+	}
+	respAnnounce, err := responder.HandleReconcilDiff(reconcilDiff)
+	if err != nil {
+		t.Fatalf("unexpected reconcildiff error: %v", err)
+	}
+	if len(initAnnounce) != 1 || len(respAnnounce) != 51 {
+		t.Fatalf("unexpected number of fallback announcements - got "+
+			"%d/%d, want 1/51", len(initAnnounce), len(respAnnounce))
+	}
+}
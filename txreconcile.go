@@ -0,0 +1,187 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/txrecon"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// reconRequestInterval is the interval at which reconciliation rounds are
+// initiated with outbound peers that support transaction reconciliation.
+const reconRequestInterval = time.Second * 8
+
+// reconState returns the transaction reconciliation state of the peer or nil
+// when reconciliation has not been negotiated.
+func (sp *serverPeer) reconState() *txrecon.State {
+	sp.reconMtx.Lock()
+	defer sp.reconMtx.Unlock()
+
+	return sp.txRecon
+}
+
+// sendTxRcncl announces support for transaction reconciliation to the peer
+// when it is enabled and the peer wants transactions relayed.
+func (sp *serverPeer) sendTxRcncl() {
+	if !cfg.TxReconciliation || cfg.BlocksOnly || sp.relayTxDisabled() {
+		return
+	}
+
+	salt, err := wire.RandomUint64()
+	if err != nil {
+		peerLog.Errorf("Unable to generate reconciliation salt: %v", err)
+		return
+	}
+	sp.reconMtx.Lock()
+	sp.reconSalt = salt
+	sp.reconMtx.Unlock()
+
+	sp.QueueMessage(wire.NewMsgSendTxRcncl(wire.TxReconciliationVersion,
+		salt), nil)
+}
+
+// addReconTx adds the transaction to the reconciliation set of the peer in
+// place of announcing it.  It returns false when the transaction must be
+// announced through an inventory message instead.
+func (sp *serverPeer) addReconTx(tx *btcutil.Tx) bool {
+	state := sp.reconState()
+	if state == nil {
+		return false
+	}
+	return state.AddTx(tx.Hash(), tx.WitnessHash())
+}
+
+// removeReconTx removes the transaction from the reconciliation set of the
+// peer since the peer is known to have it.
+func (sp *serverPeer) removeReconTx(txHash *chainhash.Hash) {
+	if state := sp.reconState(); state != nil {
+		state.RemoveTx(txHash)
+	}
+}
+
+// announceReconciledTxs announces the passed transactions to the peer as the
+// result of a reconciliation round.
+func (sp *serverPeer) announceReconciledTxs(txHashes []*chainhash.Hash) {
+	for _, txHash := range txHashes {
+		sp.QueueInventory(wire.NewInvVect(wire.InvTypeTx, txHash))
+	}
+}
+
+// reconHandler periodically initiates reconciliation rounds with the peer.  It
+// must be run as a goroutine.
+func (sp *serverPeer) reconHandler(state *txrecon.State) {
+	ticker := time.NewTicker(reconRequestInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if msg, ok := state.InitiateReconciliation(); ok {
+				sp.QueueMessage(msg, nil)
+			}
+
+		case <-sp.quit:
+			return
+		}
+	}
+}
+
+// OnSendTxRcncl is invoked when a peer receives a sendtxrcncl bitcoin message
+// and is used to set up transaction reconciliation with the peer.  The
+// outbound side of the connection initiates the reconciliation rounds.
+func (sp *serverPeer) OnSendTxRcncl(_ *peer.Peer, msg *wire.MsgSendTxRcncl) {
+	// Reconciliation is only used when it was offered by both sides.
+	sp.reconMtx.Lock()
+	defer sp.reconMtx.Unlock()
+	if sp.reconSalt == 0 || msg.Version < wire.TxReconciliationVersion {
+		peerLog.Debugf("Ignoring sendtxrcncl from %v", sp)
+		return
+	}
+	if sp.txRecon != nil {
+		peerLog.Debugf("Peer %v sent duplicate sendtxrcncl -- "+
+			"disconnecting", sp)
+		sp.Disconnect()
+		return
+	}
+
+	sp.txRecon = txrecon.NewState(!sp.Inbound(), sp.reconSalt, msg.Salt)
+	peerLog.Debugf("Using transaction reconciliation with %v", sp)
+	if sp.txRecon.IsInitiator() {
+		go sp.reconHandler(sp.txRecon)
+	}
+}
+
+// OnReqRecon is invoked when a peer receives a reqrecon bitcoin message and is
+// used to respond with a sketch of the transactions queued for the peer.
+func (sp *serverPeer) OnReqRecon(_ *peer.Peer, msg *wire.MsgReqRecon) {
+	state := sp.reconState()
+	if state == nil {
+		peerLog.Debugf("Peer %v sent reqrecon without negotiating "+
+			"reconciliation -- disconnecting", sp)
+		sp.Disconnect()
+		return
+	}
+
+	sketch, err := state.HandleReqRecon(msg)
+	if err != nil {
+		peerLog.Debugf("Invalid reqrecon from %v: %v -- disconnecting",
+			sp, err)
+		sp.Disconnect()
+		return
+	}
+	sp.QueueMessage(sketch, nil)
+}
+
+// OnSketch is invoked when a peer receives a sketch bitcoin message and is used
+// to finish a reconciliation round initiated by the local side.
+func (sp *serverPeer) OnSketch(_ *peer.Peer, msg *wire.MsgSketch) {
+	state := sp.reconState()
+	if state == nil {
+		peerLog.Debugf("Peer %v sent sketch without negotiating "+
+			"reconciliation -- disconnecting", sp)
+		sp.Disconnect()
+		return
+	}
+
+	reconcilDiff, announce, err := state.HandleSketch(msg)
+	if err != nil {
+		peerLog.Debugf("Invalid sketch from %v: %v -- disconnecting",
+			sp, err)
+		sp.Disconnect()
+		return
+	}
+	if !reconcilDiff.Success {
+		peerLog.Debugf("Reconciliation with %v failed -- announcing "+
+			"%d transactions", sp, len(announce))
+	}
+	sp.QueueMessage(reconcilDiff, nil)
+	sp.announceReconciledTxs(announce)
+}
+
+// OnReconcilDiff is invoked when a peer receives a reconcildiff bitcoin message
+// and is used to announce the transactions the peer is missing.
+func (sp *serverPeer) OnReconcilDiff(_ *peer.Peer, msg *wire.MsgReconcilDiff) {
+	state := sp.reconState()
+	if state == nil {
+		peerLog.Debugf("Peer %v sent reconcildiff without negotiating "+
+			"reconciliation -- disconnecting", sp)
+		sp.Disconnect()
+		return
+	}
+
+	announce, err := state.HandleReconcilDiff(msg)
+	if err != nil {
+		peerLog.Debugf("Invalid reconcildiff from %v: %v -- "+
+			"disconnecting", sp, err)
+		sp.Disconnect()
+		return
+	}
+	sp.announceReconciledTxs(announce)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// benchSpendTx returns a transaction which spends an output with the passed
+// public key script and amount using the passed signature script and witness
+// functions to fill in the input.
+func benchSpendTx(b *testing.B, pkScript []byte, amount int64,
+	signFn func(tx *wire.MsgTx) error) *wire.MsgTx {
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{0x01}},
+		nil, nil))
+	tx.AddTxOut(wire.NewTxOut(amount-1000, pkScript))
+	if err := signFn(tx); err != nil {
+		b.Fatalf("unable to sign transaction: %v", err)
+	}
+	return tx
+}
+
+// benchExecute executes the input of the passed transaction against the passed
+// public key script with a signature cache, so the benchmark measures the
+// script engine rather than signature verification.
+func benchExecute(b *testing.B, tx *wire.MsgTx, pkScript []byte, amount int64) {
+	const flags = StandardVerifyFlags
+	sigCache := NewSigCache(10)
+	hashCache := NewTxSigHashes(tx)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm, err := NewEngine(pkScript, tx, 0, flags, sigCache,
+			hashCache, amount)
+		if err != nil {
+			b.Fatalf("failed to create script engine: %v", err)
+		}
+		if err := vm.Execute(); err != nil {
+			b.Fatalf("failed to execute script: %v", err)
+		}
+		vm.Release()
+	}
+}
+
+// BenchmarkExecuteP2PKH benchmarks the execution of a pay-to-pubkey-hash input.
+func BenchmarkExecuteP2PKH(b *testing.B) {
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		b.Fatalf("unable to generate key: %v", err)
+	}
+	pubKey := privKey.PubKey().SerializeCompressed()
+	addr, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(pubKey),
+		&chaincfg.MainNetParams)
+	if err != nil {
+		b.Fatalf("unable to create address: %v", err)
+	}
+	pkScript, err := PayToAddrScript(addr)
+	if err != nil {
+		b.Fatalf("unable to create script: %v", err)
+	}
+
+	const amount = 100000
+	tx := benchSpendTx(b, pkScript, amount, func(tx *wire.MsgTx) error {
+		sigScript, err := SignatureScript(tx, 0, pkScript, SigHashAll,
+			privKey, true)
+		tx.TxIn[0].SignatureScript = sigScript
+		return err
+	})
+	benchExecute(b, tx, pkScript, amount)
+}
+
+// BenchmarkExecuteP2WPKH benchmarks the execution of a pay-to-witness-pubkey-hash
+// input.
+func BenchmarkExecuteP2WPKH(b *testing.B) {
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		b.Fatalf("unable to generate key: %v", err)
+	}
+	pubKey := privKey.PubKey().SerializeCompressed()
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(
+		btcutil.Hash160(pubKey), &chaincfg.MainNetParams)
+	if err != nil {
+		b.Fatalf("unable to create address: %v", err)
+	}
+	pkScript, err := PayToAddrScript(addr)
+	if err != nil {
+		b.Fatalf("unable to create script: %v", err)
+	}
+
+	const amount = 100000
+	tx := benchSpendTx(b, pkScript, amount, func(tx *wire.MsgTx) error {
+		witness, err := WitnessSignature(tx, NewTxSigHashes(tx), 0,
+			amount, pkScript, SigHashAll, privKey, true)
+		tx.TxIn[0].Witness = witness
+		return err
+	})
+	benchExecute(b, tx, pkScript, amount)
+}
+
+// BenchmarkExecuteP2SHMultiSig benchmarks the execution of a 2-of-3 multisig
+// input nested in pay-to-script-hash.
+func BenchmarkExecuteP2SHMultiSig(b *testing.B) {
+	privKeys := make([]*btcec.PrivateKey, 3)
+	pubKeys := make([]*btcutil.AddressPubKey, 3)
+	for i := range privKeys {
+		privKey, err := btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			b.Fatalf("unable to generate key: %v", err)
+		}
+		pubKey, err := btcutil.NewAddressPubKey(
+			privKey.PubKey().SerializeCompressed(),
+			&chaincfg.MainNetParams)
+		if err != nil {
+			b.Fatalf("unable to create address: %v", err)
+		}
+		privKeys[i], pubKeys[i] = privKey, pubKey
+	}
+	redeemScript, err := MultiSigScript(pubKeys, 2)
+	if err != nil {
+		b.Fatalf("unable to create script: %v", err)
+	}
+	addr, err := btcutil.NewAddressScriptHash(redeemScript,
+		&chaincfg.MainNetParams)
+	if err != nil {
+		b.Fatalf("unable to create address: %v", err)
+	}
+	pkScript, err := PayToAddrScript(addr)
+	if err != nil {
+		b.Fatalf("unable to create script: %v", err)
+	}
+
+	const amount = 100000
+	tx := benchSpendTx(b, pkScript, amount, func(tx *wire.MsgTx) error {
+		builder := NewScriptBuilder().AddOp(OP_FALSE)
+		for _, privKey := range privKeys[:2] {
+			sig, err := RawTxInSignature(tx, 0, redeemScript,
+				SigHashAll, privKey)
+			if err != nil {
+				return err
+			}
+			builder.AddData(sig)
+		}
+		sigScript, err := builder.AddData(redeemScript).Script()
+		tx.TxIn[0].SignatureScript = sigScript
+		return err
+	})
+	benchExecute(b, tx, pkScript, amount)
+}
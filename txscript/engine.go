@@ -13,6 +13,7 @@ import (
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btclog"
 )
 
 // ScriptFlags is a bitmask defining additional operations or tests that will be
@@ -269,7 +270,7 @@ func (vm *Engine) verifyWitnessProgram(witness [][]byte) error {
 			if err != nil {
 				return err
 			}
-			pops, err := parseScript(pkScript)
+			pops, err := parsePooledScript(pkScript)
 			if err != nil {
 				return err
 			}
@@ -310,7 +311,7 @@ func (vm *Engine) verifyWitnessProgram(witness [][]byte) error {
 			// With all the validity checks passed, parse the
 			// script into individual op-codes so w can execute it
 			// as the next script.
-			pops, err := parseScript(witnessScript)
+			pops, err := parsePooledScript(witnessScript)
 			if err != nil {
 				return err
 			}
@@ -473,14 +474,18 @@ func (vm *Engine) Step() (done bool, err error) {
 				"end of script reached in conditional execution")
 		}
 
-		// Alt stack doesn't persist.
-		_ = vm.astack.DropN(vm.astack.Depth())
+		// Alt stack doesn't persist.  Avoid dropping zero items since
+		// that creates an error.
+		if depth := vm.astack.Depth(); depth > 0 {
+			_ = vm.astack.DropN(depth)
+		}
 
 		vm.numOps = 0 // number of ops is per script.
 		vm.scriptOff = 0
 		if vm.scriptIdx == 0 && vm.bip16 {
 			vm.scriptIdx++
-			vm.savedFirstStack = vm.GetStack()
+			vm.savedFirstStack = append(vm.savedFirstStack[:0],
+				vm.dstack.stk...)
 		} else if vm.scriptIdx == 1 && vm.bip16 {
 			// Put us past the end for CheckErrorCondition()
 			vm.scriptIdx++
@@ -492,7 +497,7 @@ func (vm *Engine) Step() (done bool, err error) {
 			}
 
 			script := vm.savedFirstStack[len(vm.savedFirstStack)-1]
-			pops, err := parseScript(script)
+			pops, err := parsePooledScript(script)
 			if err != nil {
 				return false, err
 			}
@@ -528,33 +533,41 @@ func (vm *Engine) Step() (done bool, err error) {
 // Execute will execute all scripts in the script engine and return either nil
 // for successful validation or an error if one occurred.
 func (vm *Engine) Execute() (err error) {
+	// Only create the closures which trace the execution when tracing is
+	// enabled since they would otherwise be allocated for every opcode.
+	trace := log.Level() <= btclog.LevelTrace
+
 	done := false
 	for !done {
-		log.Tracef("%v", newLogClosure(func() string {
-			dis, err := vm.DisasmPC()
-			if err != nil {
-				return fmt.Sprintf("stepping (%v)", err)
-			}
-			return fmt.Sprintf("stepping %v", dis)
-		}))
+		if trace {
+			log.Tracef("%v", newLogClosure(func() string {
+				dis, err := vm.DisasmPC()
+				if err != nil {
+					return fmt.Sprintf("stepping (%v)", err)
+				}
+				return fmt.Sprintf("stepping %v", dis)
+			}))
+		}
 
 		done, err = vm.Step()
 		if err != nil {
 			return err
 		}
-		log.Tracef("%v", newLogClosure(func() string {
-			var dstr, astr string
-
-			// if we're tracing, dump the stacks.
-			if vm.dstack.Depth() != 0 {
-				dstr = "Stack:\n" + vm.dstack.String()
-			}
-			if vm.astack.Depth() != 0 {
-				astr = "AltStack:\n" + vm.astack.String()
-			}
-
-			return dstr + astr
-		}))
+		if trace {
+			log.Tracef("%v", newLogClosure(func() string {
+				var dstr, astr string
+
+				// if we're tracing, dump the stacks.
+				if vm.dstack.Depth() != 0 {
+					dstr = "Stack:\n" + vm.dstack.String()
+				}
+				if vm.astack.Depth() != 0 {
+					astr = "AltStack:\n" + vm.astack.String()
+				}
+
+				return dstr + astr
+			}))
+		}
 	}
 
 	return vm.CheckErrorCondition(true)
@@ -817,8 +830,11 @@ func getStack(stack *stack) [][]byte {
 // setStack sets the stack to the contents of the array where the last item in
 // the array is the top item in the stack.
 func setStack(stack *stack, data [][]byte) {
-	// This can not error. Only errors are for invalid arguments.
-	_ = stack.DropN(stack.Depth())
+	// This can not error. Only errors are for invalid arguments, so
+	// dropping zero items is avoided.
+	if depth := stack.Depth(); depth > 0 {
+		_ = stack.DropN(depth)
+	}
 
 	for i := range data {
 		stack.PushByteArray(data[i])
@@ -882,8 +898,11 @@ func NewEngine(scriptPubKey []byte, tx *wire.MsgTx, txIdx int, flags ScriptFlags
 	// it possible to have a situation where P2SH would not be a soft fork
 	// when it should be. The same goes for segwit which will pull in
 	// additional scripts for execution from the witness stack.
-	vm := Engine{flags: flags, sigCache: sigCache, hashCache: hashCache,
-		inputAmount: inputAmount}
+	vm := newPooledEngine()
+	vm.flags = flags
+	vm.sigCache = sigCache
+	vm.hashCache = hashCache
+	vm.inputAmount = inputAmount
 	if vm.hasFlag(ScriptVerifyCleanStack) && (!vm.hasFlag(ScriptBip16) &&
 		!vm.hasFlag(ScriptVerifyWitness)) {
 		return nil, scriptError(ErrInvalidFlags,
@@ -902,7 +921,8 @@ func NewEngine(scriptPubKey []byte, tx *wire.MsgTx, txIdx int, flags ScriptFlags
 	// with a pay-to-script-hash transaction, there will be ultimately be
 	// a third script to execute.
 	scripts := [][]byte{scriptSig, scriptPubKey}
-	vm.scripts = make([][]parsedOpcode, len(scripts))
+	vm.scripts = append(vm.scripts[:0], make([][]parsedOpcode,
+		len(scripts))...)
 	for i, scr := range scripts {
 		if len(scr) > MaxScriptSize {
 			str := fmt.Sprintf("script size %d is larger than max "+
@@ -910,7 +930,7 @@ func NewEngine(scriptPubKey []byte, tx *wire.MsgTx, txIdx int, flags ScriptFlags
 			return nil, scriptError(ErrScriptTooBig, str)
 		}
 		var err error
-		vm.scripts[i], err = parseScript(scr)
+		vm.scripts[i], err = parsePooledScript(scr)
 		if err != nil {
 			return nil, err
 		}
@@ -1000,5 +1020,5 @@ func NewEngine(scriptPubKey []byte, tx *wire.MsgTx, txIdx int, flags ScriptFlags
 	vm.tx = *tx
 	vm.txIdx = txIdx
 
-	return &vm, nil
+	return vm, nil
 }
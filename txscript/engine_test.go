@@ -425,3 +425,56 @@ func TestCheckSignatureEncoding(t *testing.T) {
 		}
 	}
 }
+
+// TestEngineRelease ensures engines which reuse the buffers of released engines
+// do not inherit any of their state.
+func TestEngineRelease(t *testing.T) {
+	tx := &wire.MsgTx{
+		Version: 1,
+		TxIn: []*wire.TxIn{{
+			PreviousOutPoint: wire.OutPoint{Index: 0},
+			SignatureScript:  mustParseShortForm("1 0 IF 2 TOALTSTACK"),
+			Sequence:         4294967295,
+		}},
+		TxOut: []*wire.TxOut{{Value: 1000000000}},
+	}
+
+	// Leave an engine in the middle of a conditional with items on both
+	// of its stacks before releasing it.
+	pkScript := mustParseShortForm("ENDIF")
+	vm, err := NewEngine(pkScript, tx, 0, ScriptVerifyMinimalData, nil,
+		nil, -1)
+	if err != nil {
+		t.Fatalf("failed to create script engine: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := vm.Step(); err != nil {
+			t.Fatalf("failed to step: %v", err)
+		}
+	}
+	if len(vm.condStack) == 0 || vm.dstack.Depth() == 0 {
+		t.Fatal("engine state not set up")
+	}
+	vm.Release()
+
+	// Engines created afterwards start out clean regardless of whether
+	// they reuse the released buffers.
+	tx.TxIn[0].SignatureScript = mustParseShortForm("1")
+	for i := 0; i < 10; i++ {
+		vm, err := NewEngine(mustParseShortForm("DROP 1"), tx, 0, 0,
+			nil, nil, -1)
+		if err != nil {
+			t.Fatalf("failed to create script engine: %v", err)
+		}
+		if vm.dstack.Depth() != 0 || vm.astack.Depth() != 0 ||
+			len(vm.condStack) != 0 || vm.dstack.verifyMinimalData ||
+			vm.scriptIdx != 0 || vm.numOps != 0 {
+
+			t.Fatal("engine inherited the state of a released engine")
+		}
+		if err := vm.Execute(); err != nil {
+			t.Fatalf("failed to execute script: %v", err)
+		}
+		vm.Release()
+	}
+}
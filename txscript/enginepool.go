@@ -0,0 +1,144 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package txscript
+
+import (
+	"sync"
+)
+
+const (
+	// maxPooledStackItems is the maximum capacity of the stacks of a
+	// released engine which are kept for reuse.  Larger stacks are only
+	// needed by unusual scripts, so they are left to the garbage collector
+	// rather than pinning their memory in the pool.
+	maxPooledStackItems = 128
+
+	// maxPooledCondItems is the maximum capacity of the condition stack of
+	// a released engine which is kept for reuse.
+	maxPooledCondItems = 32
+)
+
+// parsedOpcodeClasses are the capacities of the size classes of the pooled
+// slices of parsed opcodes.  Since a script is parsed into at most one opcode
+// per byte, the slice for a script is taken from the smallest class which is
+// at least as large as the script.
+var parsedOpcodeClasses = [...]int{32, 128, 512, 2048, MaxScriptSize}
+
+// parsedOpcodePools hold the slices of parsed opcodes of each size class.
+var parsedOpcodePools [len(parsedOpcodeClasses)]sync.Pool
+
+// enginePool holds released engines along with the buffers they allocated, so
+// the engines created for later validations can reuse them.
+var enginePool = sync.Pool{
+	New: func() interface{} { return new(Engine) },
+}
+
+// parsedOpcodeClass returns the index of the smallest size class of parsed
+// opcode slices with at least the passed capacity.  It returns -1 when the
+// capacity is larger than all of the classes.
+func parsedOpcodeClass(capacity int) int {
+	for i, classCap := range parsedOpcodeClasses {
+		if capacity <= classCap {
+			return i
+		}
+	}
+	return -1
+}
+
+// getParsedOpcodes returns an empty slice of parsed opcodes with at least the
+// passed capacity, which is taken from the pool of its size class when
+// possible.
+func getParsedOpcodes(capacity int) []parsedOpcode {
+	class := parsedOpcodeClass(capacity)
+	if class < 0 {
+		return make([]parsedOpcode, 0, capacity)
+	}
+	if pops, ok := parsedOpcodePools[class].Get().(*[]parsedOpcode); ok {
+		return (*pops)[:0]
+	}
+	return make([]parsedOpcode, 0, parsedOpcodeClasses[class])
+}
+
+// putParsedOpcodes returns the passed slice of parsed opcodes to the pool of
+// its size class.  Slices which were not taken from a pool are ignored.  The
+// slice must not be used afterwards.
+func putParsedOpcodes(pops []parsedOpcode) {
+	class := parsedOpcodeClass(cap(pops))
+	if class < 0 || cap(pops) != parsedOpcodeClasses[class] {
+		return
+	}
+
+	// Clear the opcodes so the pool does not keep the scripts they refer
+	// to alive.
+	pops = pops[:cap(pops)]
+	for i := range pops {
+		pops[i] = parsedOpcode{}
+	}
+	pops = pops[:0]
+	parsedOpcodePools[class].Put(&pops)
+}
+
+// parsePooledScript is the same as parseScript except that the parsed opcodes
+// are stored in a slice taken from the pools, which must be returned with
+// putParsedOpcodes once it is no longer used.
+func parsePooledScript(script []byte) ([]parsedOpcode, error) {
+	pops, err := parseScriptInto(getParsedOpcodes(len(script)), script,
+		&opcodeArray)
+	if err != nil {
+		putParsedOpcodes(pops)
+		return nil, err
+	}
+	return pops, nil
+}
+
+// clearStack removes all items from the passed stack and returns it for reuse
+// when its capacity does not exceed the passed maximum.  Otherwise it returns
+// nil.
+func clearStack(stk [][]byte, maxItems int) [][]byte {
+	if cap(stk) > maxItems {
+		return nil
+	}
+	stk = stk[:cap(stk)]
+	for i := range stk {
+		stk[i] = nil
+	}
+	return stk[:0]
+}
+
+// newPooledEngine returns an engine with all fields set to their zero values
+// other than the buffers it reuses from an engine which was released.
+func newPooledEngine() *Engine {
+	return enginePool.Get().(*Engine)
+}
+
+// Release returns the engine along with the buffers it uses to a pool, so they
+// are reused by engines which are created later instead of being allocated
+// again.  Calling it is optional, but it reduces the allocations when many
+// scripts are executed, such as while validating blocks and transactions.
+//
+// The engine must not be used in any way after it was released.
+func (vm *Engine) Release() {
+	for i, pops := range vm.scripts {
+		putParsedOpcodes(pops)
+		vm.scripts[i] = nil
+	}
+	scripts := vm.scripts[:0]
+	dstack := clearStack(vm.dstack.stk, maxPooledStackItems)
+	astack := clearStack(vm.astack.stk, maxPooledStackItems)
+	savedFirstStack := clearStack(vm.savedFirstStack, maxPooledStackItems)
+	condStack := vm.condStack[:0]
+	if cap(condStack) > maxPooledCondItems {
+		condStack = nil
+	}
+
+	*vm = Engine{
+		scripts:         scripts,
+		dstack:          stack{stk: dstack},
+		astack:          stack{stk: astack},
+		condStack:       condStack,
+		savedFirstStack: savedFirstStack,
+	}
+	enginePool.Put(vm)
+}
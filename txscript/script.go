@@ -195,7 +195,14 @@ func IsPushOnlyScript(script []byte) bool {
 // template list for testing purposes.  When there are parse errors, it returns
 // the list of parsed opcodes up to the point of failure along with the error.
 func parseScriptTemplate(script []byte, opcodes *[256]opcode) ([]parsedOpcode, error) {
-	retScript := make([]parsedOpcode, 0, len(script))
+	return parseScriptInto(make([]parsedOpcode, 0, len(script)), script,
+		opcodes)
+}
+
+// parseScriptInto is the same as parseScriptTemplate except that the parsed
+// opcodes are appended to the passed slice, which allows its memory to be
+// reused.
+func parseScriptInto(retScript []parsedOpcode, script []byte, opcodes *[256]opcode) ([]parsedOpcode, error) {
 	for i := 0; i < len(script); {
 		instr := script[i]
 		op := &opcodes[instr]
@@ -0,0 +1,38 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package utreexo implements a hash-based dynamic accumulator for sets such as
+the unspent transaction output set.
+
+Overview
+
+The accumulator commits to a set of leaf hashes with a forest of perfect binary
+Merkle trees, with at most one tree of each height, so a set of n leaves is
+represented by the roots of popcount(n) trees.  The trees are laid out from the
+highest to the lowest, which makes the leaves of the forest occupy positions
+0 through n-1, and the tree of height h exists when bit h of n is set.
+
+Anyone holding the roots, represented by a Stump, can verify a Proof that a leaf
+is part of the set, add leaves and delete leaves given their proofs.  This
+allows stateless clients which do not store the set itself to follow changes to
+it.  A Forest holds the whole set and produces the proofs.
+
+Leaves are added as a new tree of height zero which is merged with the existing
+trees of the same height like a binary counter.  A leaf is deleted by moving the
+last leaf of the forest into its position: the tree of the last leaf is split
+into the subtrees along its path, which become the roots of the lower heights,
+and the path of the moved leaf is rehashed.  Deleting a leaf therefore requires
+the proofs of both the deleted and the last leaf, which are combined into a
+Deletion.  Since a deletion is fully described by its position and leaves, a
+Forest can also undo it, which is needed to follow chain reorganizations.
+
+The parent of two nodes is the SHA512/256 hash of the concatenation of the left
+and right child.  The hashes of the leaves are up to the user of the package.
+
+Note that the layout of the forest and the deletion algorithm are specific to
+this package, so the roots and proofs are not compatible with other utreexo
+implementations.
+*/
+package utreexo
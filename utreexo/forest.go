@@ -0,0 +1,192 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package utreexo
+
+import (
+	"math/bits"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Forest holds all of the nodes of the accumulator, which allows it to prove
+// any of its leaves.  The leaves must be unique.
+//
+// The nodes are stored by height.  The node at index i of height h covers the
+// leaves at positions i*2^h through (i+1)*2^h-1, and exists when all of those
+// leaves do, since the trees of the forest are aligned to their size.
+//
+// A Forest is not safe for concurrent access.
+type Forest struct {
+	levels    [][]chainhash.Hash
+	positions map[chainhash.Hash]uint64
+}
+
+// NewForest returns an empty forest.
+func NewForest() *Forest {
+	return &Forest{
+		levels:    [][]chainhash.Hash{nil},
+		positions: make(map[chainhash.Hash]uint64),
+	}
+}
+
+// NumLeaves returns the number of leaves of the forest.
+func (f *Forest) NumLeaves() uint64 {
+	return uint64(len(f.levels[0]))
+}
+
+// Leaf returns the leaf at the passed position, which must be part of the
+// forest.
+func (f *Forest) Leaf(position uint64) chainhash.Hash {
+	return f.levels[0][position]
+}
+
+// Contains returns whether the passed leaf is part of the forest.
+func (f *Forest) Contains(leaf *chainhash.Hash) bool {
+	_, ok := f.positions[*leaf]
+	return ok
+}
+
+// Stump returns the number of leaves and the roots of the forest.
+func (f *Forest) Stump() Stump {
+	numLeaves := f.NumLeaves()
+	s := Stump{
+		NumLeaves: numLeaves,
+		Roots:     make([]chainhash.Hash, 0, bits.OnesCount64(numLeaves)),
+	}
+	for h := len(f.levels) - 1; h >= 0; h-- {
+		if numLeaves>>uint(h)&1 == 1 {
+			level := f.levels[h]
+			s.Roots = append(s.Roots, level[len(level)-1])
+		}
+	}
+	return s
+}
+
+// setLeaf sets the leaf at the passed position and rehashes its path.
+func (f *Forest) setLeaf(position uint64, leaf *chainhash.Hash) {
+	f.levels[0][position] = *leaf
+	f.positions[*leaf] = position
+	for h := 1; h < len(f.levels); h++ {
+		i := position >> uint(h)
+		if i >= uint64(len(f.levels[h])) {
+			break
+		}
+		below := f.levels[h-1]
+		f.levels[h][i] = parentHash(&below[2*i], &below[2*i+1])
+	}
+}
+
+// truncate removes the nodes covering positions beyond the passed number of
+// leaves.
+func (f *Forest) truncate(numLeaves uint64) {
+	for h := range f.levels {
+		f.levels[h] = f.levels[h][:numLeaves>>uint(h)]
+	}
+	for len(f.levels) > 1 && len(f.levels[len(f.levels)-1]) == 0 {
+		f.levels = f.levels[:len(f.levels)-1]
+	}
+}
+
+// Add adds the passed leaf to the forest and returns its position.
+func (f *Forest) Add(leaf *chainhash.Hash) uint64 {
+	position := f.NumLeaves()
+	f.levels[0] = append(f.levels[0], *leaf)
+	f.positions[*leaf] = position
+
+	// Add the parents which are complete with the new leaf.
+	for h := 0; len(f.levels[h])%2 == 0; h++ {
+		if h+1 == len(f.levels) {
+			f.levels = append(f.levels, nil)
+		}
+		below := f.levels[h]
+		n := len(below)
+		f.levels[h+1] = append(f.levels[h+1],
+			parentHash(&below[n-2], &below[n-1]))
+	}
+	return position
+}
+
+// prove returns the proof of the leaf at the passed position.
+func (f *Forest) prove(position uint64) Proof {
+	height, _ := treeOf(f.NumLeaves(), position)
+	proof := Proof{
+		Position: position,
+		Siblings: make([]chainhash.Hash, height),
+	}
+	for h := range proof.Siblings {
+		proof.Siblings[h] = f.levels[h][(position>>uint(h))^1]
+	}
+	return proof
+}
+
+// Prove returns the proof of the passed leaf against the current roots of the
+// forest.
+func (f *Forest) Prove(leaf *chainhash.Hash) (*Proof, error) {
+	position, ok := f.positions[*leaf]
+	if !ok {
+		return nil, ErrUnknownLeaf
+	}
+	proof := f.prove(position)
+	return &proof, nil
+}
+
+// Delete deletes the passed leaf from the forest and returns the deletion,
+// which applies it to a stump of the forest before the deletion and allows it
+// to be undone.
+func (f *Forest) Delete(leaf *chainhash.Hash) (*Deletion, error) {
+	position, ok := f.positions[*leaf]
+	if !ok {
+		return nil, ErrUnknownLeaf
+	}
+	lastPos := f.NumLeaves() - 1
+	d := &Deletion{
+		Leaf:  *leaf,
+		Proof: f.prove(position),
+		Last:  f.levels[0][lastPos],
+	}
+	if position != lastPos {
+		d.LastProof = f.prove(lastPos)
+	}
+
+	delete(f.positions, *leaf)
+	f.truncate(lastPos)
+	if position != lastPos {
+		f.setLeaf(position, &d.Last)
+	}
+	return d, nil
+}
+
+// UndoDelete reverses the passed deletion, which must be the most recent
+// change to the forest which was not undone.
+func (f *Forest) UndoDelete(d *Deletion) error {
+	position := d.Proof.Position
+	numLeaves := f.NumLeaves()
+	switch {
+	case position == numLeaves && d.Last == d.Leaf:
+		f.Add(&d.Leaf)
+		return nil
+
+	case position >= numLeaves || f.levels[0][position] != d.Last:
+		return ErrInvalidProof
+	}
+
+	// Move the leaf which took the position of the deleted one back to the
+	// end of the forest.
+	f.Add(&d.Last)
+	f.setLeaf(position, &d.Leaf)
+	return nil
+}
+
+// UndoAdd reverses the addition of the passed leaf, which must be the most
+// recent change to the forest which was not undone.
+func (f *Forest) UndoAdd(leaf *chainhash.Hash) error {
+	numLeaves := f.NumLeaves()
+	if numLeaves == 0 || f.levels[0][numLeaves-1] != *leaf {
+		return ErrUnknownLeaf
+	}
+	delete(f.positions, *leaf)
+	f.truncate(numLeaves - 1)
+	return nil
+}
@@ -0,0 +1,288 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package utreexo
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// maxTreeHeight is the maximum height of a tree of the forest.  A forest of
+// 2^64-1 leaves has a tree of every height below it.
+const maxTreeHeight = 64
+
+var (
+	// ErrInvalidProof is returned when a proof does not commit the leaf it
+	// is for to the roots of the accumulator.
+	ErrInvalidProof = errors.New("invalid utreexo proof")
+
+	// ErrUnknownLeaf is returned when a leaf which is not part of a forest
+	// is proven or deleted.
+	ErrUnknownLeaf = errors.New("leaf is not part of the forest")
+)
+
+// parentHash returns the hash of the parent of the passed left and right
+// nodes.
+func parentHash(left, right *chainhash.Hash) chainhash.Hash {
+	var buf [chainhash.HashSize * 2]byte
+	copy(buf[:chainhash.HashSize], left[:])
+	copy(buf[chainhash.HashSize:], right[:])
+	return chainhash.Hash(sha512.Sum512_256(buf[:]))
+}
+
+// treeOf returns the height of the tree the leaf at the passed position of a
+// forest with the passed number of leaves is part of.  It returns false when
+// the position is not part of the forest.
+func treeOf(numLeaves, position uint64) (uint8, bool) {
+	if position >= numLeaves {
+		return 0, false
+	}
+
+	// The trees are laid out from the highest to the lowest, so the tree
+	// of the position is the highest one it is not beyond.
+	var start uint64
+	for h := maxTreeHeight - 1; h >= 0; h-- {
+		size := uint64(1) << uint(h)
+		if numLeaves&size == 0 {
+			continue
+		}
+		if position < start+size {
+			return uint8(h), true
+		}
+		start += size
+	}
+	return 0, false
+}
+
+// Proof proves a leaf is part of the forest.  The siblings are the hashes of
+// the siblings of the nodes on the path from the leaf to the root of its tree,
+// starting at the leaf, so their number is the height of the tree.
+type Proof struct {
+	Position uint64
+	Siblings []chainhash.Hash
+}
+
+// root returns the root of the tree the passed leaf is part of according to
+// the proof, considering only the passed number of siblings.
+func (p *Proof) root(leaf *chainhash.Hash, height uint8) chainhash.Hash {
+	node := *leaf
+	for i := uint8(0); i < height; i++ {
+		if p.Position>>i&1 == 1 {
+			node = parentHash(&p.Siblings[i], &node)
+		} else {
+			node = parentHash(&node, &p.Siblings[i])
+		}
+	}
+	return node
+}
+
+// SerializeSize returns the number of bytes it would take to serialize the
+// proof.
+func (p *Proof) SerializeSize() int {
+	return 8 + 1 + len(p.Siblings)*chainhash.HashSize
+}
+
+// Serialize encodes the proof to the passed writer.
+func (p *Proof) Serialize(w io.Writer) error {
+	var buf [9]byte
+	binary.LittleEndian.PutUint64(buf[:8], p.Position)
+	buf[8] = byte(len(p.Siblings))
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	for i := range p.Siblings {
+		if _, err := w.Write(p.Siblings[i][:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deserialize decodes a proof from the passed reader.
+func (p *Proof) Deserialize(r io.Reader) error {
+	var buf [9]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return err
+	}
+	p.Position = binary.LittleEndian.Uint64(buf[:8])
+	if buf[8] >= maxTreeHeight {
+		return ErrInvalidProof
+	}
+	p.Siblings = make([]chainhash.Hash, buf[8])
+	for i := range p.Siblings {
+		if _, err := io.ReadFull(r, p.Siblings[i][:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletion describes the deletion of a leaf from the forest along with the
+// proofs needed to apply it to the roots.  The last leaf of the forest is moved
+// into the position of the deleted leaf.  When the deleted leaf is the last
+// one, Last is the same as Leaf and LastProof is empty.
+type Deletion struct {
+	Leaf      chainhash.Hash
+	Proof     Proof
+	Last      chainhash.Hash
+	LastProof Proof
+}
+
+// SerializeSize returns the number of bytes it would take to serialize the
+// deletion.
+func (d *Deletion) SerializeSize() int {
+	return chainhash.HashSize*2 + d.Proof.SerializeSize() +
+		d.LastProof.SerializeSize()
+}
+
+// Serialize encodes the deletion to the passed writer.
+func (d *Deletion) Serialize(w io.Writer) error {
+	if _, err := w.Write(d.Leaf[:]); err != nil {
+		return err
+	}
+	if err := d.Proof.Serialize(w); err != nil {
+		return err
+	}
+	if _, err := w.Write(d.Last[:]); err != nil {
+		return err
+	}
+	return d.LastProof.Serialize(w)
+}
+
+// Deserialize decodes a deletion from the passed reader.
+func (d *Deletion) Deserialize(r io.Reader) error {
+	if _, err := io.ReadFull(r, d.Leaf[:]); err != nil {
+		return err
+	}
+	if err := d.Proof.Deserialize(r); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r, d.Last[:]); err != nil {
+		return err
+	}
+	return d.LastProof.Deserialize(r)
+}
+
+// Stump is the state of the accumulator held by a client which does not store
+// the set: the number of leaves and the roots of the trees of the forest,
+// ordered from the highest tree to the lowest.
+type Stump struct {
+	NumLeaves uint64
+	Roots     []chainhash.Hash
+}
+
+// rootIndex returns the index in the roots of the tree of the passed height,
+// which must exist.  It is the number of higher trees.
+func (s *Stump) rootIndex(height uint8) int {
+	return bits.OnesCount64(s.NumLeaves>>height) - 1
+}
+
+// Verify returns whether the passed proof proves the passed leaf is part of
+// the forest.
+func (s *Stump) Verify(leaf *chainhash.Hash, proof *Proof) error {
+	height, ok := treeOf(s.NumLeaves, proof.Position)
+	if !ok || len(proof.Siblings) != int(height) {
+		return ErrInvalidProof
+	}
+	root := proof.root(leaf, height)
+	if root != s.Roots[s.rootIndex(height)] {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// Add adds the passed leaf to the accumulator.
+func (s *Stump) Add(leaf *chainhash.Hash) {
+	node := *leaf
+	for h := uint(0); s.NumLeaves>>h&1 == 1; h++ {
+		last := len(s.Roots) - 1
+		node = parentHash(&s.Roots[last], &node)
+		s.Roots = s.Roots[:last]
+	}
+	s.Roots = append(s.Roots, node)
+	s.NumLeaves++
+}
+
+// Delete verifies the proofs of the passed deletion and deletes the leaf from
+// the accumulator.  The accumulator is not modified when the proofs are not
+// valid.
+func (s *Stump) Delete(d *Deletion) error {
+	lastPos := s.NumLeaves - 1
+	if err := s.Verify(&d.Leaf, &d.Proof); err != nil {
+		return err
+	}
+	lastProof := &d.LastProof
+	if d.Proof.Position == lastPos {
+		if d.Last != d.Leaf {
+			return ErrInvalidProof
+		}
+		lastProof = &d.Proof
+	} else {
+		if lastProof.Position != lastPos {
+			return ErrInvalidProof
+		}
+		if err := s.Verify(&d.Last, lastProof); err != nil {
+			return err
+		}
+	}
+
+	// Split the tree of the last leaf, which is the lowest one, into the
+	// left siblings along its path.  They become the roots of all of the
+	// lower heights since the position of the last leaf in its tree has
+	// all bits set.
+	s.Roots = s.Roots[:len(s.Roots)-1]
+	for h := len(lastProof.Siblings) - 1; h >= 0; h-- {
+		s.Roots = append(s.Roots, lastProof.Siblings[h])
+	}
+	s.NumLeaves--
+	if d.Proof.Position == lastPos {
+		return nil
+	}
+
+	// Move the last leaf into the position of the deleted one.  When the
+	// deleted leaf was part of the tree which was split, its new tree is
+	// the subtree of its lower siblings, which did not change.
+	height, _ := treeOf(s.NumLeaves, d.Proof.Position)
+	root := d.Proof.root(&d.Last, height)
+	s.Roots[s.rootIndex(height)] = root
+	return nil
+}
+
+// Serialize encodes the stump to the passed writer.  The number of roots is
+// implied by the number of leaves.
+func (s *Stump) Serialize(w io.Writer) error {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], s.NumLeaves)
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	for i := range s.Roots {
+		if _, err := w.Write(s.Roots[i][:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deserialize decodes a stump from the passed reader.
+func (s *Stump) Deserialize(r io.Reader) error {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return err
+	}
+	s.NumLeaves = binary.LittleEndian.Uint64(buf[:])
+	s.Roots = make([]chainhash.Hash, bits.OnesCount64(s.NumLeaves))
+	for i := range s.Roots {
+		if _, err := io.ReadFull(r, s.Roots[i][:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
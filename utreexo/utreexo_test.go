@@ -0,0 +1,220 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package utreexo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// testLeaf returns a unique leaf for the passed number.
+func testLeaf(n uint64) chainhash.Hash {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], n)
+	return chainhash.HashH(buf[:])
+}
+
+// TestStumpRoots ensures the roots of small forests are the expected trees.
+func TestStumpRoots(t *testing.T) {
+	leaves := make([]chainhash.Hash, 7)
+	for i := range leaves {
+		leaves[i] = testLeaf(uint64(i))
+	}
+	var s Stump
+	for i := range leaves {
+		s.Add(&leaves[i])
+	}
+
+	// Seven leaves are a tree of four, a tree of two and a single leaf.
+	p01 := parentHash(&leaves[0], &leaves[1])
+	p23 := parentHash(&leaves[2], &leaves[3])
+	want := []chainhash.Hash{
+		parentHash(&p01, &p23),
+		parentHash(&leaves[4], &leaves[5]),
+		leaves[6],
+	}
+	if s.NumLeaves != 7 || !reflect.DeepEqual(s.Roots, want) {
+		t.Fatalf("unexpected stump: %+v", s)
+	}
+	f := NewForest()
+	for i := range leaves {
+		f.Add(&leaves[i])
+	}
+	if got := f.Stump(); !reflect.DeepEqual(got, s) {
+		t.Fatalf("forest stump %+v does not match %+v", got, s)
+	}
+}
+
+// TestForest ensures the proofs of a forest verify against its roots, stumps
+// follow the forest when applying additions and deletions, and the forest is
+// restored when the changes are undone.
+func TestForest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	f := NewForest()
+	var s Stump
+	var leaves []chainhash.Hash
+	var next uint64
+
+	type change struct {
+		add      *chainhash.Hash
+		deletion *Deletion
+		before   Stump
+	}
+	var changes []change
+	for i := 0; i < 2000; i++ {
+		before := f.Stump()
+		if len(leaves) == 0 || rng.Intn(3) != 0 {
+			leaf := testLeaf(next)
+			next++
+			f.Add(&leaf)
+			s.Add(&leaf)
+			leaves = append(leaves, leaf)
+			changes = append(changes, change{add: &leaf, before: before})
+		} else {
+			idx := rng.Intn(len(leaves))
+			leaf := leaves[idx]
+			leaves[idx] = leaves[len(leaves)-1]
+			leaves = leaves[:len(leaves)-1]
+
+			d, err := f.Delete(&leaf)
+			if err != nil {
+				t.Fatalf("Delete #%d: %v", i, err)
+			}
+			if err := s.Delete(d); err != nil {
+				t.Fatalf("Stump.Delete #%d: %v", i, err)
+			}
+			if f.Contains(&leaf) {
+				t.Fatalf("Delete #%d: leaf still in forest", i)
+			}
+			changes = append(changes, change{deletion: d, before: before})
+		}
+		if got := f.Stump(); !reflect.DeepEqual(got, s) {
+			t.Fatalf("change #%d: forest stump %+v does not match "+
+				"%+v", i, got, s)
+		}
+
+		// Prove a random leaf.
+		if len(leaves) > 0 {
+			leaf := leaves[rng.Intn(len(leaves))]
+			proof, err := f.Prove(&leaf)
+			if err != nil {
+				t.Fatalf("Prove #%d: %v", i, err)
+			}
+			if err := s.Verify(&leaf, proof); err != nil {
+				t.Fatalf("Verify #%d: %v", i, err)
+			}
+			other := testLeaf(next + 1)
+			if err := s.Verify(&other, proof); err != ErrInvalidProof {
+				t.Fatalf("Verify #%d: accepted wrong leaf", i)
+			}
+		}
+	}
+
+	// Undo all of the changes in reverse order.
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := &changes[i]
+		var err error
+		if c.add != nil {
+			err = f.UndoAdd(c.add)
+		} else {
+			err = f.UndoDelete(c.deletion)
+		}
+		if err != nil {
+			t.Fatalf("undo #%d: %v", i, err)
+		}
+		if got := f.Stump(); !reflect.DeepEqual(got, c.before) {
+			t.Fatalf("undo #%d: stump %+v, want %+v", i, got,
+				c.before)
+		}
+	}
+	if f.NumLeaves() != 0 || len(f.positions) != 0 {
+		t.Fatalf("forest not empty after undoing all changes")
+	}
+}
+
+// TestStumpDeleteInvalid ensures deletions with invalid proofs are rejected
+// without modifying the stump.
+func TestStumpDeleteInvalid(t *testing.T) {
+	f := NewForest()
+	for i := uint64(0); i < 11; i++ {
+		leaf := testLeaf(i)
+		f.Add(&leaf)
+	}
+	s := f.Stump()
+	leaf := testLeaf(3)
+	d, err := f.Delete(&leaf)
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := f.Delete(&leaf); err != ErrUnknownLeaf {
+		t.Fatalf("Delete: deleted leaf twice")
+	}
+
+	tests := []struct {
+		name   string
+		modify func(d *Deletion)
+	}{
+		{"wrong leaf", func(d *Deletion) { d.Leaf[0] ^= 1 }},
+		{"wrong last leaf", func(d *Deletion) { d.Last[0] ^= 1 }},
+		{"wrong sibling", func(d *Deletion) { d.Proof.Siblings[1][0] ^= 1 }},
+		{"wrong position", func(d *Deletion) { d.Proof.Position++ }},
+		{"wrong last position", func(d *Deletion) { d.LastProof.Position-- }},
+		{"short proof", func(d *Deletion) {
+			d.Proof.Siblings = d.Proof.Siblings[:2]
+		}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := d.Serialize(&buf); err != nil {
+			t.Fatalf("%s: Serialize: %v", test.name, err)
+		}
+		if buf.Len() != d.SerializeSize() {
+			t.Fatalf("%s: serialized %d bytes, want %d", test.name,
+				buf.Len(), d.SerializeSize())
+		}
+		var bad Deletion
+		if err := bad.Deserialize(&buf); err != nil {
+			t.Fatalf("%s: Deserialize: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(&bad, d) {
+			t.Fatalf("%s: round trip mismatch", test.name)
+		}
+		test.modify(&bad)
+
+		sCopy := Stump{
+			NumLeaves: s.NumLeaves,
+			Roots:     append([]chainhash.Hash(nil), s.Roots...),
+		}
+		if err := sCopy.Delete(&bad); err != ErrInvalidProof {
+			t.Fatalf("%s: Delete: got %v, want %v", test.name, err,
+				ErrInvalidProof)
+		}
+		if !reflect.DeepEqual(sCopy, s) {
+			t.Fatalf("%s: stump modified by rejected deletion",
+				test.name)
+		}
+	}
+
+	if err := s.Delete(d); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := s.Serialize(&buf); err != nil {
+		t.Fatalf("Stump.Serialize: %v", err)
+	}
+	var s2 Stump
+	if err := s2.Deserialize(&buf); err != nil {
+		t.Fatalf("Stump.Deserialize: %v", err)
+	}
+	if !reflect.DeepEqual(s2, f.Stump()) {
+		t.Fatalf("stump round trip %+v does not match %+v", s2,
+			f.Stump())
+	}
+}
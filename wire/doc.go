@@ -145,7 +145,9 @@ Errors returned by this package are either the raw errors provided by underlying
 calls to read/write from streams such as io.EOF, io.ErrUnexpectedEOF, and
 io.ErrShortWrite, or of type wire.MessageError.  This allows the caller to
 differentiate between general IO errors and malformed messages through type
-assertions.
+assertions.  Messages with a command which is not known to this package are
+reported with the wire.ErrUnknownMessage error so callers are able to ignore
+them.
 
 Bitcoin Improvement Proposals
 
@@ -158,5 +160,6 @@ This package includes spec changes outlined by the following BIPs:
 	BIP0111	(https://github.com/bitcoin/bips/blob/master/bip-0111.mediawiki)
 	BIP0130 (https://github.com/bitcoin/bips/blob/master/bip-0130.mediawiki)
 	BIP0133 (https://github.com/bitcoin/bips/blob/master/bip-0133.mediawiki)
+	BIP0155 (https://github.com/bitcoin/bips/blob/master/bip-0155.mediawiki)
 */
 package wire
@@ -8,6 +8,12 @@ import (
 	"fmt"
 )
 
+// ErrUnknownMessage is the error returned when reading a message with a valid
+// header, but a command which is not known to this package.  Peers are
+// expected to ignore such messages since newer protocol versions introduce
+// new messages, some of which are sent during version negotiation.
+var ErrUnknownMessage = messageError("ReadMessage", "unknown message")
+
 // MessageError describes an issue with a message.
 // An example of some potential issues are messages from the wrong bitcoin
 // network, invalid commands, mismatched checksums, and exceeding max payloads.
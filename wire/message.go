@@ -57,6 +57,12 @@ const (
 	CmdCFilter      = "cfilter"
 	CmdCFHeaders    = "cfheaders"
 	CmdCFCheckpt    = "cfcheckpt"
+	CmdSendTxRcncl  = "sendtxrcncl"
+	CmdReqRecon     = "reqrecon"
+	CmdSketch       = "sketch"
+	CmdReconcilDiff = "reconcildiff"
+	CmdSendAddrV2   = "sendaddrv2"
+	CmdAddrV2       = "addrv2"
 )
 
 // MessageEncoding represents the wire message encoding format to be used.
@@ -191,6 +197,24 @@ func makeEmptyMessage(command string) (Message, error) {
 	case CmdCFCheckpt:
 		msg = &MsgCFCheckpt{}
 
+	case CmdSendTxRcncl:
+		msg = &MsgSendTxRcncl{}
+
+	case CmdReqRecon:
+		msg = &MsgReqRecon{}
+
+	case CmdSketch:
+		msg = &MsgSketch{}
+
+	case CmdReconcilDiff:
+		msg = &MsgReconcilDiff{}
+
+	case CmdSendAddrV2:
+		msg = &MsgSendAddrV2{}
+
+	case CmdAddrV2:
+		msg = &MsgAddrV2{}
+
 	default:
 		return nil, fmt.Errorf("unhandled command [%s]", command)
 	}
@@ -228,7 +252,7 @@ func readMessageHeader(r io.Reader) (int, *messageHeader, error) {
 	readElements(hr, &hdr.magic, &command, &hdr.length, &hdr.checksum)
 
 	// Strip trailing zeros from command string.
-	hdr.command = string(bytes.TrimRight(command[:], string(0)))
+	hdr.command = string(bytes.TrimRight(command[:], "\x00"))
 
 	return n, &hdr, nil
 }
@@ -346,12 +370,88 @@ func WriteMessageWithEncodingN(w io.Writer, msg Message, pver uint32,
 	return totalBytes, err
 }
 
+// EncodeMessagePayload serializes the payload of the passed message using the
+// provided protocol version and message encoding while enforcing both the
+// overall and per message type maximum payload sizes.  Unlike
+// WriteMessageWithEncodingN, no message header is produced which makes it
+// suitable for transports that frame messages differently such as the BIP0324
+// encrypted transport.
+func EncodeMessagePayload(msg Message, pver uint32,
+	encoding MessageEncoding) ([]byte, error) {
+
+	var bw bytes.Buffer
+	err := msg.BtcEncode(&bw, pver, encoding)
+	if err != nil {
+		return nil, err
+	}
+	payload := bw.Bytes()
+	lenp := len(payload)
+
+	// Enforce maximum overall message payload.
+	if lenp > MaxMessagePayload {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload is %d bytes",
+			lenp, MaxMessagePayload)
+		return nil, messageError("EncodeMessagePayload", str)
+	}
+
+	// Enforce maximum message payload based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(lenp) > mpl {
+		str := fmt.Sprintf("message payload is too large - encoded "+
+			"%d bytes, but maximum message payload size for "+
+			"messages of type [%s] is %d.", lenp, msg.Command(), mpl)
+		return nil, messageError("EncodeMessagePayload", str)
+	}
+
+	return payload, nil
+}
+
+// DecodeMessagePayload creates a message of the appropriate concrete type for
+// the passed command and decodes the provided payload into it.  It is the
+// counterpart to EncodeMessagePayload for transports which do not use the
+// standard message header.
+func DecodeMessagePayload(command string, payload []byte, pver uint32,
+	enc MessageEncoding) (Message, error) {
+
+	// Check for malformed commands.
+	if !utf8.ValidString(command) {
+		str := fmt.Sprintf("invalid command %v", []byte(command))
+		return nil, messageError("DecodeMessagePayload", str)
+	}
+
+	// Create struct of appropriate message type based on the command.
+	msg, err := makeEmptyMessage(command)
+	if err != nil {
+		return nil, ErrUnknownMessage
+	}
+
+	// Check for maximum length based on the message type.
+	mpl := msg.MaxPayloadLength(pver)
+	if uint32(len(payload)) > mpl {
+		str := fmt.Sprintf("payload exceeds max length - indicates "+
+			"%v bytes, but max payload size for messages of "+
+			"type [%v] is %v.", len(payload), command, mpl)
+		return nil, messageError("DecodeMessagePayload", str)
+	}
+
+	// Unmarshal message.  NOTE: This must be a *bytes.Buffer since the
+	// MsgVersion BtcDecode function requires it.
+	err = msg.BtcDecode(bytes.NewBuffer(payload), pver, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
 // ReadMessageWithEncodingN reads, validates, and parses the next bitcoin Message
 // from r for the provided protocol version and bitcoin network.  It returns the
 // number of bytes read in addition to the parsed Message and raw bytes which
 // comprise the message.  This function is the same as ReadMessageN except it
 // allows the caller to specify which message encoding is to to consult when
-// decoding wire messages.
+// decoding wire messages.  ErrUnknownMessage is returned after discarding the
+// payload of messages with a command which is not known to this package.
 
 // ReadMessageWithEncodingN 从 r 读取, 验证和解析下一个提供的协议版本和比特币网络的下一个比特币消息.
 // 除了已解析的消息和构成消息的原始字节外, 它还返回读取的字节数.
@@ -394,8 +494,7 @@ func ReadMessageWithEncodingN(r io.Reader, pver uint32, btcnet BitcoinNet,
 	msg, err := makeEmptyMessage(command)
 	if err != nil {
 		discardInput(r, hdr.length)
-		return totalBytes, nil, nil, messageError("ReadMessage",
-			err.Error())
+		return totalBytes, nil, nil, ErrUnknownMessage
 	}
 
 	// Check for maximum length based on the message type as a malicious client
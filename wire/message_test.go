@@ -76,6 +76,13 @@ func TestMessage(t *testing.T) {
 		[]byte("payload"))
 	msgCFHeaders := NewMsgCFHeaders()
 	msgCFCheckpt := NewMsgCFCheckpt(GCSFilterRegular, &chainhash.Hash{}, 0)
+	msgSendTxRcncl := NewMsgSendTxRcncl(TxReconciliationVersion, 0x0123456789)
+	msgReqRecon := NewMsgReqRecon(10, 8191)
+	msgSketch := NewMsgSketch([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06,
+		0x07, 0x08})
+	msgReconcilDiff := NewMsgReconcilDiff(true, []uint32{1, 2})
+	msgSendAddrV2 := NewMsgSendAddrV2()
+	msgAddrV2 := NewMsgAddrV2()
 
 	tests := []struct {
 		in     Message    // Value to encode
@@ -111,6 +118,12 @@ func TestMessage(t *testing.T) {
 		{msgCFilter, msgCFilter, pver, MainNet, 65},
 		{msgCFHeaders, msgCFHeaders, pver, MainNet, 90},
 		{msgCFCheckpt, msgCFCheckpt, pver, MainNet, 58},
+		{msgSendTxRcncl, msgSendTxRcncl, pver, MainNet, 36},
+		{msgReqRecon, msgReqRecon, pver, MainNet, 28},
+		{msgSketch, msgSketch, pver, MainNet, 33},
+		{msgReconcilDiff, msgReconcilDiff, pver, MainNet, 34},
+		{msgSendAddrV2, msgSendAddrV2, pver, MainNet, 24},
+		{msgAddrV2, msgAddrV2, pver, MainNet, 25},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -0,0 +1,143 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestAddrV2 tests the MsgAddrV2 and MsgSendAddrV2 API.
+func TestAddrV2(t *testing.T) {
+	pver := ProtocolVersion
+	enc := BaseEncoding
+
+	// Ensure the commands are the expected values.
+	msg := NewMsgAddrV2()
+	if cmd := msg.Command(); cmd != "addrv2" {
+		t.Errorf("NewMsgAddrV2: wrong command - got %v want addrv2", cmd)
+	}
+	if cmd := NewMsgSendAddrV2().Command(); cmd != "sendaddrv2" {
+		t.Errorf("NewMsgSendAddrV2: wrong command - got %v want "+
+			"sendaddrv2", cmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	// Num addresses (varInt) + max allowed addresses.
+	wantPayload := uint32(9 + 1000*(4+9+1+9+512+2))
+	if maxPayload := msg.MaxPayloadLength(pver); maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length - got %v, "+
+			"want %v", maxPayload, wantPayload)
+	}
+
+	// Ensure the address list is limited.
+	na := NewNetAddressV2(NetworkTorV3, make([]byte, 32), 8333, 0)
+	for i := 0; i < MaxAddrPerMsg; i++ {
+		if err := msg.AddAddress(na); err != nil {
+			t.Fatalf("AddAddress: %v", err)
+		}
+	}
+	if err := msg.AddAddress(na); err == nil {
+		t.Errorf("AddAddress: expected error on too many addresses")
+	}
+	msg.ClearAddresses()
+	if len(msg.AddrList) != 0 {
+		t.Errorf("ClearAddresses: address list is not empty")
+	}
+
+	// Older protocol versions must fail since the messages didn't exist
+	// yet.
+	var buf bytes.Buffer
+	oldPver := AddrV2Version - 1
+	if err := msg.BtcEncode(&buf, oldPver, enc); err == nil {
+		t.Errorf("encode of MsgAddrV2 passed for old protocol version")
+	}
+	if err := msg.BtcDecode(&buf, oldPver, enc); err == nil {
+		t.Errorf("decode of MsgAddrV2 passed for old protocol version")
+	}
+	if err := NewMsgSendAddrV2().BtcEncode(&buf, oldPver, enc); err == nil {
+		t.Errorf("encode of MsgSendAddrV2 passed for old protocol " +
+			"version")
+	}
+}
+
+// TestAddrV2Wire tests the MsgAddrV2 wire encode and decode including
+// addresses of networks which can't be encoded in the addr message as well as
+// unknown networks.
+func TestAddrV2Wire(t *testing.T) {
+	ts := time.Unix(0x495fab29, 0) // 2009-01-03 12:15:05 -0600 CST
+	msg := NewMsgAddrV2()
+	msg.AddAddresses(
+		&NetAddressV2{
+			Timestamp: ts,
+			Services:  SFNodeNetwork,
+			NetworkID: NetworkIPv4,
+			Addr:      []byte{127, 0, 0, 1},
+			Port:      8333,
+		},
+		&NetAddressV2{
+			Timestamp: ts,
+			Services:  SFNodeNetwork,
+			NetworkID: NetworkI2P,
+			Addr:      bytes.Repeat([]byte{0xaa}, 32),
+			Port:      0,
+		},
+		&NetAddressV2{
+			Timestamp: ts,
+			Services:  0,
+			NetworkID: NetworkID(0x42),
+			Addr:      []byte{0x01, 0x02},
+			Port:      1,
+		},
+	)
+
+	encoded := []byte{0x03} // Varint for number of addresses
+	encoded = append(encoded,
+		0x29, 0xab, 0x5f, 0x49, 0x01, 0x01, // Timestamp, services, IPv4
+		0x04, 0x7f, 0x00, 0x00, 0x01, 0x20, 0x8d, // 127.0.0.1:8333
+	)
+	encoded = append(encoded,
+		0x29, 0xab, 0x5f, 0x49, 0x01, 0x05, 0x20, // I2P, 32 bytes
+	)
+	encoded = append(encoded, bytes.Repeat([]byte{0xaa}, 32)...)
+	encoded = append(encoded, 0x00, 0x00) // Port 0
+	encoded = append(encoded,
+		0x29, 0xab, 0x5f, 0x49, 0x00, 0x42, // Unknown network
+		0x02, 0x01, 0x02, 0x00, 0x01, // 2 bytes, port 1
+	)
+
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, ProtocolVersion, BaseEncoding); err != nil {
+		t.Fatalf("BtcEncode: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), encoded) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(encoded))
+	}
+
+	var readMsg MsgAddrV2
+	rbuf := bytes.NewReader(encoded)
+	err := readMsg.BtcDecode(rbuf, ProtocolVersion, BaseEncoding)
+	if err != nil {
+		t.Fatalf("BtcDecode: %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(&readMsg),
+			spew.Sdump(msg))
+	}
+
+	// Messages with too many addresses must be rejected.
+	buf.Reset()
+	WriteVarInt(&buf, ProtocolVersion, MaxAddrPerMsg+1)
+	err = readMsg.BtcDecode(&buf, ProtocolVersion, BaseEncoding)
+	if _, ok := err.(*MessageError); !ok {
+		t.Fatalf("BtcDecode: unexpected error for too many addresses "+
+			"- got %v, want *MessageError", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MaxReconcilDiffShortIDs is the maximum number of short transaction IDs
+// allowed per reconcildiff message.
+const MaxReconcilDiffShortIDs = MaxSketchCapacity
+
+// MsgReconcilDiff implements the Message interface and represents a bitcoin
+// reconcildiff message.  It concludes a transaction set reconciliation round
+// as defined by BIP0330.  When the reconciliation succeeded, it houses the
+// short IDs of the transactions the initiator is missing.
+type MsgReconcilDiff struct {
+	Success     bool
+	AskShortIDs []uint32
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgReconcilDiff) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	success, err := binarySerializer.Uint8(r)
+	if err != nil {
+		return err
+	}
+	msg.Success = success != 0
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Limit to max short IDs per message.
+	if count > MaxReconcilDiffShortIDs {
+		str := fmt.Sprintf("too many short ids for message "+
+			"[count %v, max %v]", count, MaxReconcilDiffShortIDs)
+		return messageError("MsgReconcilDiff.BtcDecode", str)
+	}
+
+	msg.AskShortIDs = make([]uint32, 0, count)
+	for i := uint64(0); i < count; i++ {
+		shortID, err := binarySerializer.Uint32(r, binary.LittleEndian)
+		if err != nil {
+			return err
+		}
+		msg.AskShortIDs = append(msg.AskShortIDs, shortID)
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgReconcilDiff) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	count := len(msg.AskShortIDs)
+	if count > MaxReconcilDiffShortIDs {
+		str := fmt.Sprintf("too many short ids for message "+
+			"[count %v, max %v]", count, MaxReconcilDiffShortIDs)
+		return messageError("MsgReconcilDiff.BtcEncode", str)
+	}
+
+	var success uint8
+	if msg.Success {
+		success = 1
+	}
+	if err := binarySerializer.PutUint8(w, success); err != nil {
+		return err
+	}
+
+	if err := WriteVarInt(w, pver, uint64(count)); err != nil {
+		return err
+	}
+	for _, shortID := range msg.AskShortIDs {
+		err := binarySerializer.PutUint32(w, binary.LittleEndian, shortID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgReconcilDiff) Command() string {
+	return CmdReconcilDiff
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgReconcilDiff) MaxPayloadLength(pver uint32) uint32 {
+	// Success flag 1 byte + num short ids (varInt) + max allowed short
+	// ids.
+	return 1 + MaxVarIntPayload + MaxReconcilDiffShortIDs*4
+}
+
+// NewMsgReconcilDiff returns a new bitcoin reconcildiff message that conforms
+// to the Message interface.  See MsgReconcilDiff for details.
+func NewMsgReconcilDiff(success bool, askShortIDs []uint32) *MsgReconcilDiff {
+	return &MsgReconcilDiff{
+		Success:     success,
+		AskShortIDs: askShortIDs,
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestReconcilDiffWire tests the MsgReconcilDiff wire encode and decode.
+func TestReconcilDiffWire(t *testing.T) {
+	tests := []struct {
+		in  *MsgReconcilDiff // Message to encode
+		out *MsgReconcilDiff // Expected decoded message
+		buf []byte           // Wire encoding
+	}{
+		// Failed reconciliation.
+		{
+			NewMsgReconcilDiff(false, nil),
+			NewMsgReconcilDiff(false, []uint32{}),
+			[]byte{0x00, 0x00},
+		},
+		// Successful reconciliation asking for two transactions.
+		{
+			NewMsgReconcilDiff(true, []uint32{0x01020304, 0xffffffff}),
+			NewMsgReconcilDiff(true, []uint32{0x01020304, 0xffffffff}),
+			[]byte{
+				0x01,                   // Success
+				0x02,                   // Varint for number of short ids
+				0x04, 0x03, 0x02, 0x01, // Short id 1
+				0xff, 0xff, 0xff, 0xff, // Short id 2
+			},
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.BtcEncode(&buf, ProtocolVersion, BaseEncoding)
+		if err != nil {
+			t.Errorf("BtcEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("BtcEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgReconcilDiff
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.BtcDecode(rbuf, ProtocolVersion, BaseEncoding)
+		if err != nil {
+			t.Errorf("BtcDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.out) {
+			t.Errorf("BtcDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(msg), spew.Sdump(test.out))
+			continue
+		}
+	}
+}
+
+// TestReconcilDiffWireErrors performs negative tests against wire encode and
+// decode of MsgReconcilDiff to confirm error paths work correctly.
+func TestReconcilDiffWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	wireErr := &MessageError{}
+
+	baseDiff := NewMsgReconcilDiff(true, []uint32{0x01020304})
+	baseDiffEncoded := []byte{0x01, 0x01, 0x04, 0x03, 0x02, 0x01}
+
+	// Message that forces an error by having more than the max allowed
+	// short ids.
+	maxDiff := NewMsgReconcilDiff(true,
+		make([]uint32, MaxReconcilDiffShortIDs+1))
+	maxDiffEncoded := []byte{0x01, 0xfd, 0x01, 0x20} // Varint 8193
+
+	tests := []struct {
+		in       *MsgReconcilDiff // Value to encode
+		buf      []byte           // Wire encoding
+		max      int              // Max size of fixed buffer to induce errors
+		writeErr error            // Expected write error
+		readErr  error            // Expected read error
+	}{
+		// Force error in success flag.
+		{baseDiff, baseDiffEncoded, 0, io.ErrShortWrite, io.EOF},
+		// Force error in short id count.
+		{baseDiff, baseDiffEncoded, 1, io.ErrShortWrite, io.EOF},
+		// Force error in short id.
+		{baseDiff, baseDiffEncoded, 2, io.ErrShortWrite, io.EOF},
+		// Force error with greater than max short ids.
+		{maxDiff, maxDiffEncoded, 4, wireErr, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.BtcEncode(w, pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("BtcEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// Decode from wire format.
+		var msg MsgReconcilDiff
+		r := newFixedReader(test.max, test.buf)
+		err = msg.BtcDecode(r, pver, BaseEncoding)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+	}
+}
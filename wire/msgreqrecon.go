@@ -0,0 +1,64 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// MsgReqRecon implements the Message interface and represents a bitcoin
+// reqrecon message.  It is sent by the initiator of a transaction set
+// reconciliation round as defined by BIP0330 and houses the size of the
+// reconciliation set of the initiator along with the coefficient used to
+// estimate the set difference, encoded as q * 32767.
+type MsgReqRecon struct {
+	SetSize uint16
+	Q       uint16
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgReqRecon) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	var err error
+	msg.SetSize, err = binarySerializer.Uint16(r, binary.LittleEndian)
+	if err != nil {
+		return err
+	}
+	msg.Q, err = binarySerializer.Uint16(r, binary.LittleEndian)
+	return err
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgReqRecon) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	err := binarySerializer.PutUint16(w, binary.LittleEndian, msg.SetSize)
+	if err != nil {
+		return err
+	}
+	return binarySerializer.PutUint16(w, binary.LittleEndian, msg.Q)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgReqRecon) Command() string {
+	return CmdReqRecon
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgReqRecon) MaxPayloadLength(pver uint32) uint32 {
+	// Set size 2 bytes + q 2 bytes.
+	return 4
+}
+
+// NewMsgReqRecon returns a new bitcoin reqrecon message that conforms to the
+// Message interface.  See MsgReqRecon for details.
+func NewMsgReqRecon(setSize, q uint16) *MsgReqRecon {
+	return &MsgReqRecon{
+		SetSize: setSize,
+		Q:       q,
+	}
+}
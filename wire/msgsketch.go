@@ -0,0 +1,65 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// MaxSketchCapacity is the maximum capacity of a reconciliation sketch.  Each
+// element of a sketch occupies 4 bytes.
+const MaxSketchCapacity = 2 << 12
+
+// MsgSketch implements the Message interface and represents a bitcoin sketch
+// message.  It is sent by the responder of a transaction set reconciliation
+// round as defined by BIP0330 and houses the serialized sketch of the short
+// transaction IDs in its reconciliation set.
+type MsgSketch struct {
+	SketchData []byte
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSketch) BtcDecode(r io.Reader, pver uint32, enc MessageEncoding) error {
+	var err error
+	msg.SketchData, err = ReadVarBytes(r, pver, MaxSketchCapacity*4,
+		"sketch data")
+	return err
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSketch) BtcEncode(w io.Writer, pver uint32, enc MessageEncoding) error {
+	size := len(msg.SketchData)
+	if size > MaxSketchCapacity*4 {
+		str := fmt.Sprintf("sketch data size too large for message "+
+			"[size %v, max %v]", size, MaxSketchCapacity*4)
+		return messageError("MsgSketch.BtcEncode", str)
+	}
+
+	return WriteVarBytes(w, pver, msg.SketchData)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSketch) Command() string {
+	return CmdSketch
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSketch) MaxPayloadLength(pver uint32) uint32 {
+	return uint32(VarIntSerializeSize(MaxSketchCapacity*4)) +
+		MaxSketchCapacity*4
+}
+
+// NewMsgSketch returns a new bitcoin sketch message that conforms to the
+// Message interface.  See MsgSketch for details.
+func NewMsgSketch(sketchData []byte) *MsgSketch {
+	return &MsgSketch{
+		SketchData: sketchData,
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// MaxNetAddressV2Size is the maximum size of the address of a NetAddressV2 as
+// defined by BIP0155.  Addresses of unknown networks may use any size up to
+// this limit.
+const MaxNetAddressV2Size = 512
+
+// NetworkID identifies the network of an address relayed with the addrv2
+// message (MsgAddrV2) as defined by BIP0155.
+type NetworkID uint8
+
+const (
+	// NetworkIPv4 identifies a 4 byte IPv4 address.
+	NetworkIPv4 NetworkID = 1
+
+	// NetworkIPv6 identifies a 16 byte IPv6 address.
+	NetworkIPv6 NetworkID = 2
+
+	// NetworkTorV2 identifies a 10 byte Tor v2 hidden service address.
+	NetworkTorV2 NetworkID = 3
+
+	// NetworkTorV3 identifies the 32 byte ed25519 public key of a Tor v3
+	// hidden service.
+	NetworkTorV3 NetworkID = 4
+
+	// NetworkI2P identifies the 32 byte SHA256 hash of an I2P destination.
+	NetworkI2P NetworkID = 5
+
+	// NetworkCJDNS identifies a 16 byte CJDNS address in fc00::/8.
+	NetworkCJDNS NetworkID = 6
+)
+
+// networkAddrSizes maps the known network IDs to the size of their addresses.
+var networkAddrSizes = map[NetworkID]int{
+	NetworkIPv4:  4,
+	NetworkIPv6:  16,
+	NetworkTorV2: 10,
+	NetworkTorV3: 32,
+	NetworkI2P:   32,
+	NetworkCJDNS: 16,
+}
+
+// Map of network IDs back to their constant names for pretty printing.
+var networkIDStrings = map[NetworkID]string{
+	NetworkIPv4:  "IPv4",
+	NetworkIPv6:  "IPv6",
+	NetworkTorV2: "TorV2",
+	NetworkTorV3: "TorV3",
+	NetworkI2P:   "I2P",
+	NetworkCJDNS: "CJDNS",
+}
+
+// String returns the NetworkID in human-readable form.
+func (n NetworkID) String() string {
+	if s, ok := networkIDStrings[n]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown NetworkID (%d)", uint8(n))
+}
+
+var (
+	// onionCatPrefix is the IPv6 prefix used to encode Tor v2 addresses
+	// in the legacy 16 byte address field.
+	onionCatPrefix = []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
+
+	// torV3Version is the version byte of Tor v3 hidden service addresses.
+	torV3Version = byte(0x03)
+
+	// addrEncoding is the encoding used for the host names of Tor and I2P
+	// addresses.
+	addrEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").
+			WithPadding(base32.NoPadding)
+)
+
+// NetAddressV2 defines information about a peer on the network as relayed by
+// the addrv2 message (MsgAddrV2).  Unlike NetAddress, it is able to represent
+// the addresses of networks which don't fit in 16 bytes, such as Tor v3 and
+// I2P.
+type NetAddressV2 struct {
+	// Last time the address was seen.  This is encoded as a uint32 on the
+	// wire and therefore is limited to 2106.
+	Timestamp time.Time
+
+	// Bitfield which identifies the services supported by the address.
+	Services ServiceFlag
+
+	// NetworkID identifies the network of the address.
+	NetworkID NetworkID
+
+	// Addr is the address in the format of its network.
+	Addr []byte
+
+	// Port the peer is using.  This is encoded in big endian on the wire
+	// which differs from most everything else.
+	Port uint16
+}
+
+// HasService returns whether the specified service is supported by the address.
+func (na *NetAddressV2) HasService(service ServiceFlag) bool {
+	return na.Services&service == service
+}
+
+// AddService adds service as a supported service by the peer generating the
+// message.
+func (na *NetAddressV2) AddService(service ServiceFlag) {
+	na.Services |= service
+}
+
+// IsKnownNetwork returns whether the address belongs to one of the networks
+// defined by BIP0155 and has the size defined for that network.  Addresses
+// which don't must be ignored rather than treated as an error.
+func (na *NetAddressV2) IsKnownNetwork() bool {
+	size, ok := networkAddrSizes[na.NetworkID]
+	if !ok || len(na.Addr) != size {
+		return false
+	}
+
+	// CJDNS addresses always start with 0xfc.
+	return na.NetworkID != NetworkCJDNS || na.Addr[0] == 0xfc
+}
+
+// IsLegacy returns whether the address can be represented by a NetAddress and
+// therefore relayed with the addr message (MsgAddr).
+func (na *NetAddressV2) IsLegacy() bool {
+	switch na.NetworkID {
+	case NetworkIPv4, NetworkIPv6, NetworkTorV2:
+		return na.IsKnownNetwork()
+	}
+	return false
+}
+
+// ToLegacy returns the NetAddress representation of the address.  Tor v2
+// addresses are encoded with the OnionCat prefix.  It returns nil when the
+// address can't be represented by a NetAddress.
+func (na *NetAddressV2) ToLegacy() *NetAddress {
+	if !na.IsLegacy() {
+		return nil
+	}
+
+	var ip net.IP
+	switch na.NetworkID {
+	case NetworkIPv4:
+		ip = net.IPv4(na.Addr[0], na.Addr[1], na.Addr[2], na.Addr[3])
+
+	case NetworkIPv6:
+		ip = make(net.IP, net.IPv6len)
+		copy(ip, na.Addr)
+
+	case NetworkTorV2:
+		ip = make(net.IP, 0, net.IPv6len)
+		ip = append(ip, onionCatPrefix...)
+		ip = append(ip, na.Addr...)
+	}
+
+	return &NetAddress{
+		Timestamp: na.Timestamp,
+		Services:  na.Services,
+		IP:        ip,
+		Port:      na.Port,
+	}
+}
+
+// Host returns the host name of the address.  It is the IP address for IPv4,
+// IPv6, and CJDNS addresses, the .onion address for Tor addresses, and the
+// .b32.i2p address for I2P addresses.
+func (na *NetAddressV2) Host() string {
+	if !na.IsKnownNetwork() {
+		return fmt.Sprintf("unknown-%d:%x", uint8(na.NetworkID), na.Addr)
+	}
+
+	switch na.NetworkID {
+	case NetworkTorV2:
+		return addrEncoding.EncodeToString(na.Addr) + ".onion"
+
+	case NetworkTorV3:
+		checksum := TorV3Checksum(na.Addr)
+		data := make([]byte, 0, len(na.Addr)+3)
+		data = append(data, na.Addr...)
+		data = append(data, checksum[:]...)
+		data = append(data, torV3Version)
+		return addrEncoding.EncodeToString(data) + ".onion"
+
+	case NetworkI2P:
+		return addrEncoding.EncodeToString(na.Addr) + ".b32.i2p"
+	}
+
+	return net.IP(na.Addr).String()
+}
+
+// String returns the address in the form of host:port for IPv4, Tor, and I2P
+// addresses or [host]:port for IPv6 and CJDNS addresses.
+func (na *NetAddressV2) String() string {
+	port := strconv.FormatUint(uint64(na.Port), 10)
+	return net.JoinHostPort(na.Host(), port)
+}
+
+// TorV3Checksum returns the checksum which is part of the .onion address of the
+// Tor v3 hidden service with the passed public key.
+func TorV3Checksum(pubKey []byte) [2]byte {
+	h := sha3.New256()
+	h.Write([]byte(".onion checksum"))
+	h.Write(pubKey)
+	h.Write([]byte{torV3Version})
+
+	var checksum [2]byte
+	copy(checksum[:], h.Sum(nil))
+	return checksum
+}
+
+// NewNetAddressV2 returns a new NetAddressV2 using the provided network ID,
+// address, port, and supported services with defaults for the remaining
+// fields.
+func NewNetAddressV2(networkID NetworkID, addr []byte, port uint16,
+	services ServiceFlag) *NetAddressV2 {
+
+	return &NetAddressV2{
+		Timestamp: time.Unix(time.Now().Unix(), 0),
+		Services:  services,
+		NetworkID: networkID,
+		Addr:      addr,
+		Port:      port,
+	}
+}
+
+// NetAddressV2FromLegacy returns the NetAddressV2 representation of the passed
+// NetAddress.  IPv6 addresses with the OnionCat prefix are converted to Tor v2
+// addresses.
+func NetAddressV2FromLegacy(na *NetAddress) *NetAddressV2 {
+	nav2 := &NetAddressV2{
+		Timestamp: na.Timestamp,
+		Services:  na.Services,
+		Port:      na.Port,
+	}
+
+	if ip4 := na.IP.To4(); ip4 != nil {
+		nav2.NetworkID = NetworkIPv4
+		nav2.Addr = []byte(ip4)
+		return nav2
+	}
+
+	ip := na.IP.To16()
+	if ip == nil {
+		ip = net.IPv6zero
+	}
+	if bytes.HasPrefix(ip, onionCatPrefix) {
+		nav2.NetworkID = NetworkTorV2
+		nav2.Addr = append([]byte(nil), ip[len(onionCatPrefix):]...)
+		return nav2
+	}
+
+	nav2.NetworkID = NetworkIPv6
+	nav2.Addr = append([]byte(nil), ip...)
+	return nav2
+}
+
+// ParseNetAddressV2Host returns the network ID and address of the passed
+// .onion or .b32.i2p host name.  It returns false when the host is neither.
+// The checksum and version of Tor v3 addresses are verified.
+func ParseNetAddressV2Host(host string) (NetworkID, []byte, bool) {
+	host = strings.ToLower(host)
+
+	var networkID NetworkID
+	var encoded string
+	switch {
+	case strings.HasSuffix(host, ".onion"):
+		encoded = strings.TrimSuffix(host, ".onion")
+		networkID = NetworkTorV2
+		if len(encoded) != 16 {
+			networkID = NetworkTorV3
+		}
+
+	case strings.HasSuffix(host, ".b32.i2p"):
+		encoded = strings.TrimSuffix(host, ".b32.i2p")
+		networkID = NetworkI2P
+
+	default:
+		return 0, nil, false
+	}
+
+	data, err := addrEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, nil, false
+	}
+
+	size := networkAddrSizes[networkID]
+	if networkID == NetworkTorV3 {
+		// Tor v3 addresses are followed by a 2 byte checksum and the
+		// version byte.
+		if len(data) != size+3 || data[size+2] != torV3Version {
+			return 0, nil, false
+		}
+		checksum := TorV3Checksum(data[:size])
+		if !bytes.Equal(checksum[:], data[size:size+2]) {
+			return 0, nil, false
+		}
+		data = data[:size]
+	}
+	if len(data) != size {
+		return 0, nil, false
+	}
+
+	return networkID, data, true
+}
+
+// readNetAddressV2 reads an encoded NetAddressV2 from r.
+func readNetAddressV2(r io.Reader, pver uint32, na *NetAddressV2) error {
+	err := readElement(r, (*uint32Time)(&na.Timestamp))
+	if err != nil {
+		return err
+	}
+
+	// Services are encoded as a variable length integer in the addrv2
+	// message.
+	services, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	na.Services = ServiceFlag(services)
+
+	networkID, err := binarySerializer.Uint8(r)
+	if err != nil {
+		return err
+	}
+	na.NetworkID = NetworkID(networkID)
+
+	na.Addr, err = ReadVarBytes(r, pver, MaxNetAddressV2Size, "addrv2 addr")
+	if err != nil {
+		return err
+	}
+
+	// Sigh.  Bitcoin protocol mixes little and big endian.
+	na.Port, err = binarySerializer.Uint16(r, bigEndian)
+	return err
+}
+
+// writeNetAddressV2 serializes a NetAddressV2 to w.
+func writeNetAddressV2(w io.Writer, pver uint32, na *NetAddressV2) error {
+	if len(na.Addr) > MaxNetAddressV2Size {
+		str := fmt.Sprintf("address too long [len %v, max %v]",
+			len(na.Addr), MaxNetAddressV2Size)
+		return messageError("writeNetAddressV2", str)
+	}
+
+	err := writeElement(w, uint32(na.Timestamp.Unix()))
+	if err != nil {
+		return err
+	}
+	if err := WriteVarInt(w, pver, uint64(na.Services)); err != nil {
+		return err
+	}
+	if err := binarySerializer.PutUint8(w, uint8(na.NetworkID)); err != nil {
+		return err
+	}
+	if err := WriteVarBytes(w, pver, na.Addr); err != nil {
+		return err
+	}
+
+	// Sigh.  Bitcoin protocol mixes little and big endian.
+	return binary.Write(w, bigEndian, na.Port)
+}
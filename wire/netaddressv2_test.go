@@ -0,0 +1,222 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestNetAddressV2Legacy ensures addresses are converted between NetAddress and
+// NetAddressV2 as expected.
+func TestNetAddressV2Legacy(t *testing.T) {
+	ts := time.Unix(0x495fab29, 0)
+	tests := []struct {
+		name     string
+		ip       net.IP
+		netID    NetworkID
+		addr     []byte
+		host     string
+		isLegacy bool
+	}{
+		{
+			name:  "ipv4",
+			ip:    net.ParseIP("127.0.0.1"),
+			netID: NetworkIPv4,
+			addr:  []byte{127, 0, 0, 1},
+			host:  "127.0.0.1",
+		},
+		{
+			name:  "ipv6",
+			ip:    net.ParseIP("2001:db8::1"),
+			netID: NetworkIPv6,
+			addr: []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0x01},
+			host: "2001:db8::1",
+		},
+		{
+			name:  "onioncat tor v2",
+			ip:    net.ParseIP("fd87:d87e:eb43:2b:b0a6:1d5b:eb43:6e5c"),
+			netID: NetworkTorV2,
+			addr: []byte{0x00, 0x2b, 0xb0, 0xa6, 0x1d, 0x5b, 0xeb, 0x43,
+				0x6e, 0x5c},
+			host: "aav3bjq5lpvug3s4.onion",
+		},
+	}
+
+	for _, test := range tests {
+		na := NewNetAddressTimestamp(ts, SFNodeNetwork, test.ip, 8333)
+		nav2 := NetAddressV2FromLegacy(na)
+		if nav2.NetworkID != test.netID {
+			t.Errorf("%s: wrong network - got %v, want %v",
+				test.name, nav2.NetworkID, test.netID)
+			continue
+		}
+		if !bytes.Equal(nav2.Addr, test.addr) {
+			t.Errorf("%s: wrong address - got %x, want %x",
+				test.name, nav2.Addr, test.addr)
+			continue
+		}
+		if host := nav2.Host(); host != test.host {
+			t.Errorf("%s: wrong host - got %s, want %s", test.name,
+				host, test.host)
+			continue
+		}
+
+		legacy := nav2.ToLegacy()
+		if legacy == nil || !legacy.IP.Equal(test.ip) ||
+			legacy.Port != 8333 || !legacy.Timestamp.Equal(ts) ||
+			legacy.Services != SFNodeNetwork {
+
+			t.Errorf("%s: wrong legacy address - got %v, want %v",
+				test.name, spew.Sdump(legacy), spew.Sdump(na))
+			continue
+		}
+	}
+
+	// Addresses which don't fit in 16 bytes can't be converted.
+	torV3 := NewNetAddressV2(NetworkTorV3, make([]byte, 32), 8333, 0)
+	if torV3.IsLegacy() || torV3.ToLegacy() != nil {
+		t.Errorf("tor v3 address converted to legacy address")
+	}
+	cjdns := NewNetAddressV2(NetworkCJDNS, append([]byte{0xfc},
+		make([]byte, 15)...), 8333, 0)
+	if cjdns.IsLegacy() || cjdns.ToLegacy() != nil {
+		t.Errorf("cjdns address converted to legacy address")
+	}
+}
+
+// TestNetAddressV2Hosts ensures the host names of Tor v3 and I2P addresses
+// round trip through ParseNetAddressV2Host and that invalid host names are
+// rejected.
+func TestNetAddressV2Hosts(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+
+	tests := []struct {
+		netID  NetworkID
+		suffix string
+	}{
+		{NetworkTorV3, ".onion"},
+		{NetworkI2P, ".b32.i2p"},
+	}
+	for _, test := range tests {
+		na := NewNetAddressV2(test.netID, key, 8333, 0)
+		if !na.IsKnownNetwork() {
+			t.Errorf("%v: address is not of a known network",
+				test.netID)
+			continue
+		}
+		host := na.Host()
+		if !strings.HasSuffix(host, test.suffix) {
+			t.Errorf("%v: wrong host suffix - got %s, want %s",
+				test.netID, host, test.suffix)
+			continue
+		}
+
+		netID, addr, ok := ParseNetAddressV2Host(strings.ToUpper(host))
+		if !ok || netID != test.netID || !bytes.Equal(addr, key) {
+			t.Errorf("%v: failed to parse host %s - got %v %x %v",
+				test.netID, host, netID, addr, ok)
+			continue
+		}
+	}
+
+	// Tor v3 host names have 56 characters.
+	torV3Host := NewNetAddressV2(NetworkTorV3, key, 0, 0).Host()
+	if len(torV3Host) != 56+len(".onion") {
+		t.Errorf("wrong tor v3 host length - got %d, want %d",
+			len(torV3Host), 56+len(".onion"))
+	}
+
+	// Corrupting the checksum must cause the host to be rejected.
+	corrupt := []byte(torV3Host)
+	if corrupt[53] == 'a' {
+		corrupt[53] = 'b'
+	} else {
+		corrupt[53] = 'a'
+	}
+	if _, _, ok := ParseNetAddressV2Host(string(corrupt)); ok {
+		t.Errorf("parsed tor v3 host %s with a bad checksum", corrupt)
+	}
+	for _, host := range []string{"127.0.0.1", "example.com",
+		"abc.onion", "abc.b32.i2p"} {
+
+		if _, _, ok := ParseNetAddressV2Host(host); ok {
+			t.Errorf("parsed invalid host %s", host)
+		}
+	}
+
+	// Addresses with the wrong size for their network or an unknown network
+	// are not of a known network.
+	invalid := []*NetAddressV2{
+		NewNetAddressV2(NetworkTorV3, make([]byte, 31), 0, 0),
+		NewNetAddressV2(NetworkCJDNS, make([]byte, 16), 0, 0),
+		NewNetAddressV2(NetworkID(0x42), make([]byte, 8), 0, 0),
+	}
+	for _, na := range invalid {
+		if na.IsKnownNetwork() {
+			t.Errorf("address %v is of a known network", na)
+		}
+	}
+}
+
+// TestNetAddressV2Wire tests the NetAddressV2 wire encode and decode.
+func TestNetAddressV2Wire(t *testing.T) {
+	na := NetAddressV2{
+		Timestamp: time.Unix(0x495fab29, 0), // 2009-01-03 12:15:05 -0600 CST
+		Services:  SFNodeNetwork | SFNodeWitness,
+		NetworkID: NetworkIPv4,
+		Addr:      []byte{127, 0, 0, 1},
+		Port:      8333,
+	}
+	naEncoded := []byte{
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x09,                         // Services (varint)
+		0x01,                         // Network ID
+		0x04, 0x7f, 0x00, 0x00, 0x01, // Address
+		0x20, 0x8d, // Port 8333 in big-endian
+	}
+
+	var buf bytes.Buffer
+	if err := writeNetAddressV2(&buf, ProtocolVersion, &na); err != nil {
+		t.Fatalf("writeNetAddressV2: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), naEncoded) {
+		t.Fatalf("writeNetAddressV2\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(naEncoded))
+	}
+
+	var readNa NetAddressV2
+	rbuf := bytes.NewReader(naEncoded)
+	if err := readNetAddressV2(rbuf, ProtocolVersion, &readNa); err != nil {
+		t.Fatalf("readNetAddressV2: %v", err)
+	}
+	if !reflect.DeepEqual(&readNa, &na) {
+		t.Fatalf("readNetAddressV2\n got: %s want: %s",
+			spew.Sdump(readNa), spew.Sdump(na))
+	}
+
+	// Addresses over the maximum size must be rejected.
+	na.Addr = make([]byte, MaxNetAddressV2Size+1)
+	if err := writeNetAddressV2(&buf, ProtocolVersion, &na); err == nil {
+		t.Fatalf("writeNetAddressV2 accepted oversized address")
+	}
+	buf.Reset()
+	buf.Write(naEncoded[:6])
+	WriteVarInt(&buf, ProtocolVersion, MaxNetAddressV2Size+1)
+	buf.Write(make([]byte, MaxNetAddressV2Size+1+2))
+	if err := readNetAddressV2(&buf, ProtocolVersion, &readNa); err == nil {
+		t.Fatalf("readNetAddressV2 accepted oversized address")
+	}
+}
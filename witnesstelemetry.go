@@ -0,0 +1,465 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+const (
+	// maxWitnessTelemetrySamples is the maximum number of individual
+	// observations retained by the witness upgrade telemetry.  Once the
+	// limit is reached the oldest samples are replaced.
+	maxWitnessTelemetrySamples = 100
+
+	// taprootWitnessVersion is the witness version of taproot outputs.
+	taprootWitnessVersion = 1
+
+	// taprootProgramLen is the length of a taproot witness program.
+	taprootProgramLen = 32
+
+	// taprootAnnexTag is the first byte of the optional annex which is the
+	// last element of a taproot witness stack.
+	taprootAnnexTag = 0x50
+
+	// tapLeafMask extracts the leaf version from the first byte of a
+	// taproot control block.
+	tapLeafMask = 0xfe
+
+	// tapLeafVersionTapscript is the leaf version of BIP0342 tapscript, which
+	// is the only leaf version that is currently defined.
+	tapLeafVersionTapscript = 0xc0
+)
+
+// Kinds of observations made by the witness upgrade telemetry.
+const (
+	witnessObsOutput  = "output"
+	witnessObsInput   = "input"
+	witnessObsTapLeaf = "tapleaf"
+)
+
+// witnessUpgradeCounts houses the number of times an unknown witness or tap
+// leaf version was observed along with when it was last seen.
+type witnessUpgradeCounts struct {
+	MempoolOutputs uint64
+	MempoolInputs  uint64
+	BlockOutputs   uint64
+	BlockInputs    uint64
+	LastSeen       time.Time
+}
+
+// witnessUpgradeSample describes a single observation of an unknown witness
+// or tap leaf version.
+type witnessUpgradeSample struct {
+	Kind    string
+	Version int
+	TxHash  chainhash.Hash
+	Index   uint32
+	InBlock bool
+	Height  int32
+	Seen    time.Time
+}
+
+// witnessUpgradeReport is a snapshot of the data collected by the witness
+// upgrade telemetry.
+type witnessUpgradeReport struct {
+	WitnessVersions map[int]witnessUpgradeCounts
+	TapLeafVersions map[int]witnessUpgradeCounts
+	Samples         []witnessUpgradeSample
+}
+
+// witnessTelemetryItem is a transaction or block queued for inspection by the
+// witness upgrade telemetry.
+type witnessTelemetryItem struct {
+	tx    *btcutil.Tx
+	block *btcutil.Block
+}
+
+// witnessTelemetry tracks the use of witness versions and tap leaf versions
+// which are not known to the current consensus rules in relayed transactions
+// and connected blocks.  This provides operators with early signals of the
+// adoption of future soft forks from the vantage point of their own node.
+//
+// Observations are queued and inspected in a separate goroutine since
+// identifying the witness version of spent outputs requires looking up the
+// previous outputs, which must not be done from within chain notification
+// callbacks.
+type witnessTelemetry struct {
+	chain   *blockchain.BlockChain
+	fetchTx func(*chainhash.Hash) (*btcutil.Tx, error)
+
+	mtx             sync.Mutex
+	witnessVersions map[int]*witnessUpgradeCounts
+	tapLeafVersions map[int]*witnessUpgradeCounts
+	samples         []witnessUpgradeSample
+	nextSample      int
+
+	queueMtx sync.Mutex
+	queue    []witnessTelemetryItem
+	notify   chan struct{}
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// newWitnessTelemetry returns a new witness upgrade telemetry collector which
+// is subscribed to the notifications of the passed chain.  The passed function
+// is used to look up unconfirmed transactions which create the outputs spent
+// by relayed transactions.
+func newWitnessTelemetry(chain *blockchain.BlockChain,
+	fetchTx func(*chainhash.Hash) (*btcutil.Tx, error)) *witnessTelemetry {
+
+	w := &witnessTelemetry{
+		chain:           chain,
+		fetchTx:         fetchTx,
+		witnessVersions: make(map[int]*witnessUpgradeCounts),
+		tapLeafVersions: make(map[int]*witnessUpgradeCounts),
+		notify:          make(chan struct{}, 1),
+		quit:            make(chan struct{}),
+	}
+	chain.Subscribe(w.handleBlockchainNotification)
+	return w
+}
+
+// enqueue adds the passed item to the queue of items to inspect.
+func (w *witnessTelemetry) enqueue(item witnessTelemetryItem) {
+	w.queueMtx.Lock()
+	w.queue = append(w.queue, item)
+	w.queueMtx.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// ObserveTxs queues the passed transactions, which were accepted to the
+// memory pool, for inspection.  It is safe to call on a nil instance in which
+// case it does nothing.
+//
+// This function is safe for concurrent access.
+func (w *witnessTelemetry) ObserveTxs(txns []*btcutil.Tx) {
+	if w == nil {
+		return
+	}
+	for _, tx := range txns {
+		if tx.MsgTx().HasWitness() || hasWitnessOutput(tx.MsgTx()) {
+			w.enqueue(witnessTelemetryItem{tx: tx})
+		}
+	}
+}
+
+// handleBlockchainNotification queues connected blocks for inspection.
+func (w *witnessTelemetry) handleBlockchainNotification(notification *blockchain.Notification) {
+	if notification.Type != blockchain.NTBlockConnected {
+		return
+	}
+	block, ok := notification.Data.(*btcutil.Block)
+	if !ok {
+		srvrLog.Warnf("Chain connected notification is not a block.")
+		return
+	}
+	w.enqueue(witnessTelemetryItem{block: block})
+}
+
+// hasWitnessOutput returns whether or not any output of the passed transaction
+// pays to a witness program.
+func hasWitnessOutput(tx *wire.MsgTx) bool {
+	for _, txOut := range tx.TxOut {
+		if txscript.IsWitnessProgram(txOut.PkScript) {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownWitnessVersion returns the witness version of the passed script and
+// whether it is a witness program with a version not known to the current
+// consensus rules.
+func unknownWitnessVersion(pkScript []byte) (int, bool) {
+	if !txscript.IsWitnessProgram(pkScript) {
+		return 0, false
+	}
+	version, _, err := txscript.ExtractWitnessProgramInfo(pkScript)
+	if err != nil || version == 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// tapLeafVersion returns the leaf version of the passed taproot witness stack
+// and whether or not it is a script path spend.
+func tapLeafVersion(witness wire.TxWitness) (int, bool) {
+	// Remove the annex if present.
+	if len(witness) >= 2 {
+		last := witness[len(witness)-1]
+		if len(last) > 0 && last[0] == taprootAnnexTag {
+			witness = witness[:len(witness)-1]
+		}
+	}
+
+	// Key path spends consist of a single signature while script path
+	// spends end with the script followed by the control block.
+	if len(witness) < 2 {
+		return 0, false
+	}
+	controlBlock := witness[len(witness)-1]
+	if len(controlBlock) == 0 {
+		return 0, false
+	}
+	return int(controlBlock[0] & tapLeafMask), true
+}
+
+// record updates the counters for the passed observation and adds it to the
+// samples.  This function MUST be called with the mutex held.
+func (w *witnessTelemetry) record(sample witnessUpgradeSample) {
+	counters := w.witnessVersions
+	if sample.Kind == witnessObsTapLeaf {
+		counters = w.tapLeafVersions
+	}
+	counts, ok := counters[sample.Version]
+	if !ok {
+		counts = &witnessUpgradeCounts{}
+		counters[sample.Version] = counts
+	}
+	switch {
+	case sample.Kind == witnessObsOutput && sample.InBlock:
+		counts.BlockOutputs++
+	case sample.Kind == witnessObsOutput:
+		counts.MempoolOutputs++
+	case sample.InBlock:
+		counts.BlockInputs++
+	default:
+		counts.MempoolInputs++
+	}
+	counts.LastSeen = sample.Seen
+
+	if len(w.samples) < maxWitnessTelemetrySamples {
+		w.samples = append(w.samples, sample)
+		return
+	}
+	w.samples[w.nextSample] = sample
+	w.nextSample = (w.nextSample + 1) % maxWitnessTelemetrySamples
+}
+
+// inspectTx records all unknown witness and tap leaf versions used by the
+// passed transaction.  The prevScripts slice houses the public key scripts of
+// the outputs spent by the transaction inputs, where nil entries indicate the
+// script is not known.
+func (w *witnessTelemetry) inspectTx(tx *btcutil.Tx, prevScripts [][]byte,
+	inBlock bool, height int32) {
+
+	now := time.Now()
+	msgTx := tx.MsgTx()
+	var samples []witnessUpgradeSample
+	for i, txOut := range msgTx.TxOut {
+		version, ok := unknownWitnessVersion(txOut.PkScript)
+		if !ok {
+			continue
+		}
+		samples = append(samples, witnessUpgradeSample{
+			Kind:    witnessObsOutput,
+			Version: version,
+			TxHash:  *tx.Hash(),
+			Index:   uint32(i),
+			InBlock: inBlock,
+			Height:  height,
+			Seen:    now,
+		})
+	}
+	for i, txIn := range msgTx.TxIn {
+		if i >= len(prevScripts) || prevScripts[i] == nil {
+			continue
+		}
+		version, ok := unknownWitnessVersion(prevScripts[i])
+		if !ok {
+			continue
+		}
+		samples = append(samples, witnessUpgradeSample{
+			Kind:    witnessObsInput,
+			Version: version,
+			TxHash:  *tx.Hash(),
+			Index:   uint32(i),
+			InBlock: inBlock,
+			Height:  height,
+			Seen:    now,
+		})
+
+		// Look for unknown leaf versions in taproot script path spends.
+		_, program, err := txscript.ExtractWitnessProgramInfo(prevScripts[i])
+		if err != nil || version != taprootWitnessVersion ||
+			len(program) != taprootProgramLen {
+			continue
+		}
+		leafVersion, ok := tapLeafVersion(txIn.Witness)
+		if !ok || leafVersion == tapLeafVersionTapscript {
+			continue
+		}
+		samples = append(samples, witnessUpgradeSample{
+			Kind:    witnessObsTapLeaf,
+			Version: leafVersion,
+			TxHash:  *tx.Hash(),
+			Index:   uint32(i),
+			InBlock: inBlock,
+			Height:  height,
+			Seen:    now,
+		})
+	}
+	if len(samples) == 0 {
+		return
+	}
+
+	w.mtx.Lock()
+	for _, sample := range samples {
+		w.record(sample)
+	}
+	w.mtx.Unlock()
+}
+
+// mempoolPrevScripts returns the public key scripts of the outputs spent by
+// the witness inputs of the passed unconfirmed transaction.
+func (w *witnessTelemetry) mempoolPrevScripts(tx *btcutil.Tx) [][]byte {
+	prevScripts := make([][]byte, len(tx.MsgTx().TxIn))
+	for i, txIn := range tx.MsgTx().TxIn {
+		if len(txIn.Witness) == 0 {
+			continue
+		}
+		prevOut := txIn.PreviousOutPoint
+		if w.fetchTx != nil {
+			if parent, err := w.fetchTx(&prevOut.Hash); err == nil {
+				txOuts := parent.MsgTx().TxOut
+				if prevOut.Index < uint32(len(txOuts)) {
+					prevScripts[i] = txOuts[prevOut.Index].PkScript
+				}
+				continue
+			}
+		}
+		entry, err := w.chain.FetchUtxoEntry(prevOut)
+		if err != nil || entry == nil {
+			continue
+		}
+		prevScripts[i] = entry.PkScript()
+	}
+	return prevScripts
+}
+
+// inspectBlock records all unknown witness and tap leaf versions used by the
+// transactions in the passed block.
+func (w *witnessTelemetry) inspectBlock(block *btcutil.Block) {
+	// The spend journal might no longer be available if the block was
+	// disconnected in the mean time, in which case only the outputs are
+	// inspected.
+	stxos, err := w.chain.FetchSpendJournal(block)
+	if err != nil {
+		srvrLog.Debugf("Unable to fetch spend journal for block %v: %v",
+			block.Hash(), err)
+		stxos = nil
+	}
+
+	height := block.Height()
+	stxoIdx := 0
+	for i, tx := range block.Transactions() {
+		numInputs := len(tx.MsgTx().TxIn)
+		if i == 0 {
+			w.inspectTx(tx, nil, true, height)
+			continue
+		}
+		var prevScripts [][]byte
+		if stxoIdx+numInputs <= len(stxos) {
+			prevScripts = make([][]byte, numInputs)
+			for j := 0; j < numInputs; j++ {
+				prevScripts[j] = stxos[stxoIdx+j].PkScript
+			}
+		}
+		stxoIdx += numInputs
+		w.inspectTx(tx, prevScripts, true, height)
+	}
+}
+
+// queueHandler inspects the queued transactions and blocks.  It must be run
+// as a goroutine.
+func (w *witnessTelemetry) queueHandler() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.notify:
+		case <-w.quit:
+			return
+		}
+
+		w.queueMtx.Lock()
+		items := w.queue
+		w.queue = nil
+		w.queueMtx.Unlock()
+
+		for _, item := range items {
+			select {
+			case <-w.quit:
+				return
+			default:
+			}
+
+			if item.block != nil {
+				w.inspectBlock(item.block)
+				continue
+			}
+			w.inspectTx(item.tx, w.mempoolPrevScripts(item.tx), false, 0)
+		}
+	}
+}
+
+// Report returns a snapshot of the collected witness upgrade telemetry with
+// the samples ordered from oldest to newest.
+//
+// This function is safe for concurrent access.
+func (w *witnessTelemetry) Report() *witnessUpgradeReport {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	report := &witnessUpgradeReport{
+		WitnessVersions: make(map[int]witnessUpgradeCounts),
+		TapLeafVersions: make(map[int]witnessUpgradeCounts),
+		Samples:         make([]witnessUpgradeSample, 0, len(w.samples)),
+	}
+	for version, counts := range w.witnessVersions {
+		report.WitnessVersions[version] = *counts
+	}
+	for version, counts := range w.tapLeafVersions {
+		report.TapLeafVersions[version] = *counts
+	}
+	report.Samples = append(report.Samples, w.samples[w.nextSample:]...)
+	report.Samples = append(report.Samples, w.samples[:w.nextSample]...)
+	return report
+}
+
+// sortedVersions returns the versions of the passed counters in ascending
+// order.
+func sortedVersions(counters map[int]witnessUpgradeCounts) []int {
+	versions := make([]int, 0, len(counters))
+	for version := range counters {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Start begins inspecting observed transactions and connected blocks.
+func (w *witnessTelemetry) Start() {
+	w.wg.Add(1)
+	go w.queueHandler()
+}
+
+// Stop stops the telemetry and waits for the handler to exit.
+func (w *witnessTelemetry) Stop() {
+	close(w.quit)
+	w.wg.Wait()
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// witnessProgram returns a witness program script for the passed version and
+// program length.
+func witnessProgram(version byte, programLen int) []byte {
+	opVersion := byte(0x00)
+	if version > 0 {
+		opVersion = 0x50 + version
+	}
+	script := []byte{opVersion, byte(programLen)}
+	return append(script, bytes.Repeat([]byte{0x01}, programLen)...)
+}
+
+// TestWitnessTelemetry ensures the witness upgrade telemetry counts and
+// samples unknown witness and tap leaf versions.
+func TestWitnessTelemetry(t *testing.T) {
+	w := &witnessTelemetry{
+		witnessVersions: make(map[int]*witnessUpgradeCounts),
+		tapLeafVersions: make(map[int]*witnessUpgradeCounts),
+	}
+
+	// Create a transaction which pays to witness versions 0, 2 and 16 while
+	// spending a v0 output, a taproot key path, a tapscript leaf, an
+	// unknown leaf version with an annex and a witness v3 output.
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	for _, script := range [][]byte{witnessProgram(0, 20),
+		witnessProgram(2, 32), witnessProgram(16, 40)} {
+
+		msgTx.AddTxOut(wire.NewTxOut(1000, script))
+	}
+	witnesses := []wire.TxWitness{
+		{{0x30}, {0x02}},
+		{{0x30}},
+		{{0x51}, {0xc0, 0x01}},
+		{{0x51}, {0xc3, 0x01}, {taprootAnnexTag}},
+		{{0x01}},
+	}
+	for _, witness := range witnesses {
+		txIn := wire.NewTxIn(&wire.OutPoint{}, nil, witness)
+		msgTx.AddTxIn(txIn)
+	}
+	prevScripts := [][]byte{
+		witnessProgram(0, 20),
+		witnessProgram(1, 32),
+		witnessProgram(1, 32),
+		witnessProgram(1, 32),
+		witnessProgram(3, 32),
+	}
+	tx := btcutil.NewTx(msgTx)
+	w.inspectTx(tx, prevScripts, false, 0)
+	w.inspectTx(tx, nil, true, 100)
+
+	report := w.Report()
+	wantVersions := map[int]witnessUpgradeCounts{
+		1:  {MempoolInputs: 3},
+		2:  {MempoolOutputs: 1, BlockOutputs: 1},
+		3:  {MempoolInputs: 1},
+		16: {MempoolOutputs: 1, BlockOutputs: 1},
+	}
+	if len(report.WitnessVersions) != len(wantVersions) {
+		t.Fatalf("unexpected number of witness versions - got %d, "+
+			"want %d", len(report.WitnessVersions), len(wantVersions))
+	}
+	for version, want := range wantVersions {
+		got := report.WitnessVersions[version]
+		got.LastSeen = want.LastSeen
+		if got != want {
+			t.Errorf("witness version %d: got %+v, want %+v",
+				version, got, want)
+		}
+	}
+
+	if len(report.TapLeafVersions) != 1 {
+		t.Fatalf("unexpected number of tap leaf versions - got %d, "+
+			"want 1", len(report.TapLeafVersions))
+	}
+	if got := report.TapLeafVersions[0xc2]; got.MempoolInputs != 1 {
+		t.Errorf("unexpected tap leaf version 0xc2 counts: %+v", got)
+	}
+
+	// 7 observations from the mempool and 2 from the block.
+	if len(report.Samples) != 9 {
+		t.Fatalf("unexpected number of samples - got %d, want 9",
+			len(report.Samples))
+	}
+	last := report.Samples[len(report.Samples)-1]
+	if !last.InBlock || last.Height != 100 || last.Version != 16 {
+		t.Errorf("unexpected last sample: %+v", last)
+	}
+
+	// Ensure the samples are limited and remain ordered.
+	for i := 0; i < maxWitnessTelemetrySamples; i++ {
+		w.inspectTx(tx, nil, true, int32(i))
+	}
+	report = w.Report()
+	if len(report.Samples) != maxWitnessTelemetrySamples {
+		t.Fatalf("unexpected number of samples - got %d, want %d",
+			len(report.Samples), maxWitnessTelemetrySamples)
+	}
+	last = report.Samples[len(report.Samples)-1]
+	if last.Height != maxWitnessTelemetrySamples-1 {
+		t.Errorf("unexpected height of newest sample - got %d, want %d",
+			last.Height, maxWitnessTelemetrySamples-1)
+	}
+}
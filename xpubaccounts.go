@@ -0,0 +1,529 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/blockchain/indexers"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/database"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+const (
+	// defaultXpubGapLimit is the default number of consecutive unused
+	// addresses after which the scan of an account branch stops.
+	defaultXpubGapLimit = 20
+
+	// maxXpubGapLimit is the maximum gap limit of an account.
+	maxXpubGapLimit = 1000
+
+	// maxXpubBranchAddresses is the maximum number of addresses derived
+	// for a single branch of an account regardless of the gap limit.
+	maxXpubBranchAddresses = 100000
+
+	// maxXpubAccountName is the maximum length of the name of an account.
+	maxXpubAccountName = 64
+)
+
+// Address types which may be derived from the keys of an xpub account.
+const (
+	xpubAddrP2PKH      = "p2pkh"
+	xpubAddrP2WPKH     = "p2wpkh"
+	xpubAddrP2SHP2WPKH = "p2sh-p2wpkh"
+)
+
+// Branches of an xpub account as defined by BIP0044.
+const (
+	xpubBranchExternal = 0
+	xpubBranchInternal = 1
+)
+
+// xpubAccountsBucketName is the name of the database bucket used to persist
+// the registered xpub accounts.
+var xpubAccountsBucketName = []byte("xpubaccounts")
+
+var (
+	// errXpubAccountExists is returned when an account is registered with
+	// the name of an already registered account.
+	errXpubAccountExists = errors.New("xpub account already exists")
+
+	// errXpubAccountNotFound is returned when an account which is not
+	// registered is requested.
+	errXpubAccountNotFound = errors.New("xpub account not found")
+)
+
+// xpubAccount describes a named watch-only account of the addresses derived
+// from an extended public key.
+type xpubAccount struct {
+	Name     string
+	XPub     string
+	AddrType string
+	GapLimit uint32
+	Created  time.Time
+
+	// branches are the extended keys of the external and internal
+	// branches.  They are derived when the account is registered or
+	// loaded.
+	branches [2]*hdkeychain.ExtendedKey
+}
+
+// serialize returns the serialized account record.  The name is not part of
+// the record since it is used as the key.
+func (a *xpubAccount) serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := wire.WriteVarString(&buf, 0, a.XPub); err != nil {
+		return nil, err
+	}
+	if err := wire.WriteVarString(&buf, 0, a.AddrType); err != nil {
+		return nil, err
+	}
+	var scratch [8]byte
+	binary.LittleEndian.PutUint32(scratch[:4], a.GapLimit)
+	buf.Write(scratch[:4])
+	binary.LittleEndian.PutUint64(scratch[:], uint64(a.Created.Unix()))
+	buf.Write(scratch[:])
+	return buf.Bytes(), nil
+}
+
+// deserializeXpubAccount returns the account with the passed name described
+// by the passed serialized record.
+func deserializeXpubAccount(name string, serialized []byte) (*xpubAccount, error) {
+	r := bytes.NewReader(serialized)
+	xpub, err := wire.ReadVarString(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	addrType, err := wire.ReadVarString(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	var scratch [12]byte
+	if _, err := io.ReadFull(r, scratch[:]); err != nil || r.Len() != 0 {
+		return nil, errors.New("malformed xpub account record")
+	}
+	return &xpubAccount{
+		Name:     name,
+		XPub:     xpub,
+		AddrType: addrType,
+		GapLimit: binary.LittleEndian.Uint32(scratch[:4]),
+		Created:  time.Unix(int64(binary.LittleEndian.Uint64(scratch[4:])), 0),
+	}, nil
+}
+
+// deriveBranches parses the extended public key of the account and derives
+// the keys of its branches.
+func (a *xpubAccount) deriveBranches(params *chaincfg.Params) error {
+	key, err := hdkeychain.NewKeyFromString(a.XPub)
+	if err != nil {
+		return err
+	}
+	if key.IsPrivate() {
+		return errors.New("extended key must be public for a watch-only " +
+			"account")
+	}
+	if !key.IsForNet(params) {
+		return fmt.Errorf("extended key is not for %s", params.Name)
+	}
+	for i := range a.branches {
+		a.branches[i], err = key.Child(uint32(i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deriveAddress returns the address with the passed index on the passed
+// branch of the account.
+func (a *xpubAccount) deriveAddress(branch, index uint32,
+	params *chaincfg.Params) (btcutil.Address, error) {
+
+	child, err := a.branches[branch].Child(index)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := child.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	pkHash := btcutil.Hash160(pubKey.SerializeCompressed())
+
+	switch a.AddrType {
+	case xpubAddrP2PKH:
+		return btcutil.NewAddressPubKeyHash(pkHash, params)
+
+	case xpubAddrP2WPKH:
+		return btcutil.NewAddressWitnessPubKeyHash(pkHash, params)
+
+	case xpubAddrP2SHP2WPKH:
+		wpkh, err := btcutil.NewAddressWitnessPubKeyHash(pkHash, params)
+		if err != nil {
+			return nil, err
+		}
+		script, err := txscript.PayToAddrScript(wpkh)
+		if err != nil {
+			return nil, err
+		}
+		return btcutil.NewAddressScriptHash(script, params)
+	}
+
+	return nil, fmt.Errorf("unsupported address type %q", a.AddrType)
+}
+
+// xpubAccountUtxo describes an unspent output paying to an address of an
+// account.
+type xpubAccountUtxo struct {
+	OutPoint      wire.OutPoint
+	Address       btcutil.Address
+	Branch        uint32
+	Index         uint32
+	Amount        int64
+	PkScript      []byte
+	Confirmations int32
+}
+
+// xpubAccountScan is the result of scanning the addresses of an account.
+type xpubAccountScan struct {
+	// Confirmed is the total of the unspent outputs of the account with at
+	// least the requested number of confirmations.
+	Confirmed int64
+
+	// Unconfirmed is the net change of the balance of the account by the
+	// transactions in the memory pool.
+	Unconfirmed int64
+
+	// Received is the total of all outputs paid to the account with at
+	// least the requested number of confirmations.
+	Received int64
+
+	// Utxos are the outputs of the account which are unspent by both the
+	// main chain and the memory pool, including unconfirmed ones.
+	Utxos []xpubAccountUtxo
+
+	// NextIndex is the index of the first unused address of each branch.
+	NextIndex [2]uint32
+}
+
+// xpubAccountManager tracks named watch-only accounts of extended public keys
+// and computes their balances from the address index, the utxo set, and the
+// memory pool.
+type xpubAccountManager struct {
+	db        database.DB
+	chain     *blockchain.BlockChain
+	addrIndex *indexers.AddrIndex
+	txMemPool *mempool.TxPool
+	params    *chaincfg.Params
+
+	mtx      sync.RWMutex
+	accounts map[string]*xpubAccount
+}
+
+// newXpubAccountManager returns a new xpub account manager which loads the
+// previously registered accounts from the passed database.
+func newXpubAccountManager(db database.DB, chain *blockchain.BlockChain,
+	addrIndex *indexers.AddrIndex, txMemPool *mempool.TxPool,
+	params *chaincfg.Params) (*xpubAccountManager, error) {
+
+	m := &xpubAccountManager{
+		db:        db,
+		chain:     chain,
+		addrIndex: addrIndex,
+		txMemPool: txMemPool,
+		params:    params,
+		accounts:  make(map[string]*xpubAccount),
+	}
+	err := db.Update(func(dbTx database.Tx) error {
+		bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+			xpubAccountsBucketName)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			account, err := deserializeXpubAccount(string(k), v)
+			if err != nil {
+				return err
+			}
+			if err := account.deriveBranches(params); err != nil {
+				return fmt.Errorf("xpub account %q: %v",
+					account.Name, err)
+			}
+			m.accounts[account.Name] = account
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AddAccount registers a new account with the passed name for the passed
+// extended public key.  The gap limit defaults to defaultXpubGapLimit when it
+// is zero.
+//
+// This function is safe for concurrent access.
+func (m *xpubAccountManager) AddAccount(name, xpub, addrType string,
+	gapLimit uint32) error {
+
+	if name == "" || len(name) > maxXpubAccountName {
+		return fmt.Errorf("account name must be between 1 and %d "+
+			"characters", maxXpubAccountName)
+	}
+	switch addrType {
+	case xpubAddrP2PKH, xpubAddrP2WPKH, xpubAddrP2SHP2WPKH:
+	default:
+		return fmt.Errorf("unsupported address type %q", addrType)
+	}
+	if gapLimit == 0 {
+		gapLimit = defaultXpubGapLimit
+	}
+	if gapLimit > maxXpubGapLimit {
+		return fmt.Errorf("gap limit must not exceed %d", maxXpubGapLimit)
+	}
+
+	account := &xpubAccount{
+		Name:     name,
+		XPub:     xpub,
+		AddrType: addrType,
+		GapLimit: gapLimit,
+		Created:  time.Unix(time.Now().Unix(), 0),
+	}
+	if err := account.deriveBranches(m.params); err != nil {
+		return err
+	}
+	serialized, err := account.serialize()
+	if err != nil {
+		return err
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.accounts[name]; ok {
+		return errXpubAccountExists
+	}
+	err = m.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(xpubAccountsBucketName)
+		return bucket.Put([]byte(name), serialized)
+	})
+	if err != nil {
+		return err
+	}
+	m.accounts[name] = account
+	return nil
+}
+
+// RemoveAccount removes the account with the passed name.
+//
+// This function is safe for concurrent access.
+func (m *xpubAccountManager) RemoveAccount(name string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.accounts[name]; !ok {
+		return errXpubAccountNotFound
+	}
+	err := m.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(xpubAccountsBucketName)
+		return bucket.Delete([]byte(name))
+	})
+	if err != nil {
+		return err
+	}
+	delete(m.accounts, name)
+	return nil
+}
+
+// Accounts returns the registered accounts sorted by name.
+//
+// This function is safe for concurrent access.
+func (m *xpubAccountManager) Accounts() []*xpubAccount {
+	m.mtx.RLock()
+	accounts := make([]*xpubAccount, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		accounts = append(accounts, account)
+	}
+	m.mtx.RUnlock()
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Name < accounts[j].Name
+	})
+	return accounts
+}
+
+// Scan derives the addresses of both branches of the account with the passed
+// name until the gap limit of consecutive unused addresses is reached and
+// returns the balances and unspent outputs of the account.  Outputs with less
+// than minConf confirmations don't count towards the confirmed balance and
+// received total.
+//
+// This function is safe for concurrent access.
+func (m *xpubAccountManager) Scan(name string, minConf int32) (*xpubAccountScan, error) {
+	m.mtx.RLock()
+	account, ok := m.accounts[name]
+	m.mtx.RUnlock()
+	if !ok {
+		return nil, errXpubAccountNotFound
+	}
+
+	bestHeight := m.chain.BestSnapshot().Height
+	var scan xpubAccountScan
+	for branch := uint32(0); branch < uint32(len(account.branches)); branch++ {
+		var unused uint32
+		var index uint32
+		for ; unused < account.GapLimit && index < maxXpubBranchAddresses; index++ {
+			addr, err := account.deriveAddress(branch, index, m.params)
+			if err != nil {
+				// Roughly 1 in 2^127 indexes are invalid, in
+				// which case the next index is used.
+				if err == hdkeychain.ErrInvalidChild {
+					continue
+				}
+				return nil, err
+			}
+			used, err := m.scanAddress(&scan, addr, branch, index,
+				bestHeight, minConf)
+			if err != nil {
+				return nil, err
+			}
+			if !used {
+				unused++
+				continue
+			}
+			unused = 0
+			scan.NextIndex[branch] = index + 1
+		}
+	}
+
+	sort.Slice(scan.Utxos, func(i, j int) bool {
+		return scan.Utxos[i].Confirmations > scan.Utxos[j].Confirmations
+	})
+	return &scan, nil
+}
+
+// scanAddress adds the outputs paid to the passed address by the transactions
+// in the main chain and memory pool to the passed scan.  It returns whether
+// the address is used by any transaction.
+func (m *xpubAccountManager) scanAddress(scan *xpubAccountScan,
+	addr btcutil.Address, branch, index uint32, bestHeight,
+	minConf int32) (bool, error) {
+
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return false, err
+	}
+
+	var used bool
+	err = m.db.View(func(dbTx database.Tx) error {
+		regions, _, err := m.addrIndex.TxRegionsForAddress(dbTx, addr,
+			0, math.MaxUint32, false)
+		if err != nil {
+			return err
+		}
+		if len(regions) == 0 {
+			return nil
+		}
+		used = true
+		serializedTxns, err := dbTx.FetchBlockRegions(regions)
+		if err != nil {
+			return err
+		}
+		for i, serializedTx := range serializedTxns {
+			var msgTx wire.MsgTx
+			err := msgTx.Deserialize(bytes.NewReader(serializedTx))
+			if err != nil {
+				return err
+			}
+			height, err := m.chain.BlockHeightByHash(regions[i].Hash)
+			if err != nil {
+				return err
+			}
+			confs := bestHeight - height + 1
+			txHash := msgTx.TxHash()
+			for vout, txOut := range msgTx.TxOut {
+				if !bytes.Equal(txOut.PkScript, pkScript) {
+					continue
+				}
+				if confs >= minConf {
+					scan.Received += txOut.Value
+				}
+
+				op := wire.OutPoint{Hash: txHash, Index: uint32(vout)}
+				entry, err := m.chain.FetchUtxoEntry(op)
+				if err != nil {
+					return err
+				}
+				if entry == nil || entry.IsSpent() {
+					continue
+				}
+				if confs >= minConf {
+					scan.Confirmed += txOut.Value
+				}
+				if m.txMemPool.CheckSpend(op) != nil {
+					scan.Unconfirmed -= txOut.Value
+					continue
+				}
+				if confs < minConf {
+					continue
+				}
+				scan.Utxos = append(scan.Utxos, xpubAccountUtxo{
+					OutPoint:      op,
+					Address:       addr,
+					Branch:        branch,
+					Index:         index,
+					Amount:        txOut.Value,
+					PkScript:      txOut.PkScript,
+					Confirmations: confs,
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, tx := range m.addrIndex.UnconfirmedTxnsForAddress(addr) {
+		used = true
+		for vout, txOut := range tx.MsgTx().TxOut {
+			if !bytes.Equal(txOut.PkScript, pkScript) {
+				continue
+			}
+			scan.Unconfirmed += txOut.Value
+
+			op := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(vout)}
+			if m.txMemPool.CheckSpend(op) != nil {
+				scan.Unconfirmed -= txOut.Value
+				continue
+			}
+			if minConf > 0 {
+				continue
+			}
+			scan.Utxos = append(scan.Utxos, xpubAccountUtxo{
+				OutPoint: op,
+				Address:  addr,
+				Branch:   branch,
+				Index:    index,
+				Amount:   txOut.Value,
+				PkScript: txOut.PkScript,
+			})
+		}
+	}
+
+	return used, nil
+}
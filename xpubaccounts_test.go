@@ -0,0 +1,128 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+// BIP0032 test vector 1 master keys.
+const (
+	testXpub = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2g" +
+		"Z29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	testXprv = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiC" +
+		"hkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+)
+
+// TestXpubAccountSerialization ensures xpub account records round trip.
+func TestXpubAccountSerialization(t *testing.T) {
+	account := &xpubAccount{
+		Name:     "savings",
+		XPub:     testXpub,
+		AddrType: xpubAddrP2SHP2WPKH,
+		GapLimit: 50,
+		Created:  time.Unix(1600000000, 0),
+	}
+	serialized, err := account.serialize()
+	if err != nil {
+		t.Fatalf("serialize: unexpected error: %v", err)
+	}
+	got, err := deserializeXpubAccount(account.Name, serialized)
+	if err != nil {
+		t.Fatalf("deserializeXpubAccount: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, account) {
+		t.Fatalf("deserializeXpubAccount: mismatched account - got %+v, "+
+			"want %+v", got, account)
+	}
+
+	_, err = deserializeXpubAccount(account.Name,
+		serialized[:len(serialized)-1])
+	if err == nil {
+		t.Fatal("deserializeXpubAccount: did not reject truncated record")
+	}
+}
+
+// TestXpubAccountDerivation ensures the addresses of xpub accounts are derived
+// from the expected keys and that unusable extended keys are rejected.
+func TestXpubAccountDerivation(t *testing.T) {
+	params := &chaincfg.MainNetParams
+
+	rejected := []struct {
+		name string
+		key  string
+	}{
+		{name: "private key", key: testXprv},
+		{name: "malformed key", key: "xpub"},
+	}
+	for _, test := range rejected {
+		account := &xpubAccount{XPub: test.key}
+		if err := account.deriveBranches(params); err == nil {
+			t.Errorf("%s: deriveBranches did not fail", test.name)
+		}
+	}
+	account := &xpubAccount{XPub: testXpub}
+	if err := account.deriveBranches(&chaincfg.TestNet3Params); err == nil {
+		t.Error("deriveBranches did not reject key for other network")
+	}
+
+	// Derive the expected hash of m/1/5 independently of the account.
+	master, err := hdkeychain.NewKeyFromString(testXpub)
+	if err != nil {
+		t.Fatalf("NewKeyFromString: unexpected error: %v", err)
+	}
+	branch, _ := master.Child(xpubBranchInternal)
+	child, _ := branch.Child(5)
+	p2pkh, err := child.Address(params)
+	if err != nil {
+		t.Fatalf("Address: unexpected error: %v", err)
+	}
+	pkHash := p2pkh.Hash160()[:]
+	p2wpkh, _ := btcutil.NewAddressWitnessPubKeyHash(pkHash, params)
+
+	tests := []struct {
+		addrType string
+		want     string
+	}{
+		{addrType: xpubAddrP2PKH, want: p2pkh.EncodeAddress()},
+		{addrType: xpubAddrP2WPKH, want: p2wpkh.EncodeAddress()},
+	}
+	for _, test := range tests {
+		account := &xpubAccount{XPub: testXpub, AddrType: test.addrType}
+		if err := account.deriveBranches(params); err != nil {
+			t.Fatalf("%s: deriveBranches: unexpected error: %v",
+				test.addrType, err)
+		}
+		addr, err := account.deriveAddress(xpubBranchInternal, 5, params)
+		if err != nil {
+			t.Fatalf("%s: deriveAddress: unexpected error: %v",
+				test.addrType, err)
+		}
+		if addr.EncodeAddress() != test.want {
+			t.Errorf("%s: mismatched address - got %s, want %s",
+				test.addrType, addr.EncodeAddress(), test.want)
+		}
+	}
+
+	// Nested segwit addresses must be pay-to-script-hash addresses.
+	account = &xpubAccount{XPub: testXpub, AddrType: xpubAddrP2SHP2WPKH}
+	if err := account.deriveBranches(params); err != nil {
+		t.Fatalf("deriveBranches: unexpected error: %v", err)
+	}
+	addr, err := account.deriveAddress(xpubBranchExternal, 0, params)
+	if err != nil {
+		t.Fatalf("deriveAddress: unexpected error: %v", err)
+	}
+	if _, ok := addr.(*btcutil.AddressScriptHash); !ok {
+		t.Errorf("deriveAddress: got %T, want *btcutil.AddressScriptHash",
+			addr)
+	}
+}
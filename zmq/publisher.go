@@ -0,0 +1,350 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmq
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// handshakeTimeout is the maximum duration for a subscriber to complete the
+// greeting and the handshake after it connected.
+const handshakeTimeout = 10 * time.Second
+
+// subscriber is a SUB or XSUB socket connected to a publisher.
+type subscriber struct {
+	conn  net.Conn
+	queue chan [][]byte
+	quit  chan struct{}
+
+	// writeMtx serializes the messages queued for the subscriber with the
+	// replies to its heartbeats.
+	writeMtx sync.Mutex
+
+	// topics counts the subscriptions of the subscriber by the topic
+	// prefix they match, since a prefix may be subscribed to repeatedly.
+	topicsMtx sync.Mutex
+	topics    map[string]int
+}
+
+// String returns the address of the subscriber in human-readable form.
+func (s *subscriber) String() string {
+	return s.conn.RemoteAddr().String()
+}
+
+// subscribe adds a subscription to the topics which start with the passed
+// prefix.
+func (s *subscriber) subscribe(prefix []byte) {
+	s.topicsMtx.Lock()
+	s.topics[string(prefix)]++
+	s.topicsMtx.Unlock()
+}
+
+// cancel removes a subscription to the topics which start with the passed
+// prefix.
+func (s *subscriber) cancel(prefix []byte) {
+	s.topicsMtx.Lock()
+	if n := s.topics[string(prefix)]; n > 1 {
+		s.topics[string(prefix)] = n - 1
+	} else {
+		delete(s.topics, string(prefix))
+	}
+	s.topicsMtx.Unlock()
+}
+
+// matches returns whether the subscriber subscribed to the passed topic.
+func (s *subscriber) matches(topic []byte) bool {
+	s.topicsMtx.Lock()
+	defer s.topicsMtx.Unlock()
+	for prefix := range s.topics {
+		if bytes.HasPrefix(topic, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// write writes the passed frame to the subscriber.
+func (s *subscriber) write(flags byte, body []byte) error {
+	s.writeMtx.Lock()
+	defer s.writeMtx.Unlock()
+	return writeFrame(s.conn, flags, body)
+}
+
+// handshake exchanges the greetings and the READY commands with the subscriber
+// and returns the minor version of ZMTP 3 it speaks.
+func (s *subscriber) handshake() (byte, error) {
+	if _, err := s.conn.Write(greeting()); err != nil {
+		return 0, err
+	}
+	minor, err := readGreeting(s.conn)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.write(flagCommand, readyCommand(socketPub)); err != nil {
+		return 0, err
+	}
+
+	f, err := readFrame(s.conn)
+	if err != nil {
+		return 0, err
+	}
+	name, data, err := parseCommand(f.body)
+	if err != nil || !f.isCommand() || name != cmdReady {
+		return 0, fmt.Errorf("expected %s command", cmdReady)
+	}
+	props, err := parseMetadata(data)
+	if err != nil {
+		return 0, err
+	}
+	socketType := props[strings.ToLower(propSocketType)]
+	if socketType != socketSub && socketType != socketXSub {
+		reason := fmt.Sprintf("invalid socket type %s", socketType)
+		errCmd := command(cmdError, append([]byte{byte(len(reason))},
+			reason...))
+		s.write(flagCommand, errCmd)
+		return 0, fmt.Errorf("%s socket may not connect to a publisher",
+			socketType)
+	}
+	return minor, nil
+}
+
+// readHandler handles the subscriptions and heartbeats of the subscriber until
+// the connection is closed.  Subscribers speaking ZMTP 3.0 send subscriptions
+// as messages whose first byte is 1 to subscribe and 0 to cancel, while ZMTP
+// 3.1 uses commands for them.
+func (s *subscriber) readHandler() {
+	for {
+		f, err := readFrame(s.conn)
+		if err != nil {
+			log.Debugf("Failed to read from ZMQ subscriber %s: %v",
+				s, err)
+			return
+		}
+
+		if !f.isCommand() {
+			if len(f.body) == 0 || f.flags&flagMore != 0 {
+				continue
+			}
+			switch f.body[0] {
+			case 1:
+				s.subscribe(f.body[1:])
+			case 0:
+				s.cancel(f.body[1:])
+			}
+			continue
+		}
+
+		name, data, err := parseCommand(f.body)
+		if err != nil {
+			log.Debugf("Malformed command from ZMQ subscriber %s",
+				s)
+			return
+		}
+		switch name {
+		case cmdSubscribe:
+			s.subscribe(data)
+
+		case cmdCancel:
+			s.cancel(data)
+
+		case cmdPing:
+			// The PING command holds a TTL followed by a context
+			// which is echoed in the PONG command.
+			if len(data) < 2 {
+				return
+			}
+			err := s.write(flagCommand, command(cmdPong, data[2:]))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeHandler writes the queued messages to the subscriber until the
+// connection is closed.
+func (s *subscriber) writeHandler() {
+	for {
+		select {
+		case msg := <-s.queue:
+			s.writeMtx.Lock()
+			err := writeMessage(s.conn, msg)
+			s.writeMtx.Unlock()
+			if err != nil {
+				log.Debugf("Failed to write to ZMQ subscriber "+
+					"%s: %v", s, err)
+				s.conn.Close()
+				return
+			}
+
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// Publisher is a ZeroMQ PUB socket which is bound to a set of listeners.  It
+// speaks ZMTP 3.0 and 3.1 with the NULL security mechanism, so SUB and XSUB
+// sockets of ZeroMQ libraries can connect to it and subscribe to the topics of
+// its messages.
+//
+// Like a ZeroMQ PUB socket, a publisher never blocks.  Messages are queued for
+// every subscriber up to the high water mark and dropped for subscribers which
+// have that many messages queued.
+type Publisher struct {
+	started   int32
+	shutdown  int32
+	listeners []net.Listener
+	hwm       int
+	wg        sync.WaitGroup
+
+	mtx         sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+// NewPublisher returns a publisher which accepts subscribers on the passed
+// listeners and queues up to hwm messages for each of them.  The publisher
+// takes ownership of the listeners, so they are closed when it is stopped.
+func NewPublisher(listeners []net.Listener, hwm int) *Publisher {
+	return &Publisher{
+		listeners:   listeners,
+		hwm:         hwm,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Publish queues the message made of the passed frames for the subscribers
+// which subscribed to its topic, which is the first frame.
+//
+// This function is safe for concurrent access.
+func (p *Publisher) Publish(frames ...[]byte) {
+	if len(frames) == 0 {
+		return
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for s := range p.subscribers {
+		if !s.matches(frames[0]) {
+			continue
+		}
+		select {
+		case s.queue <- frames:
+		default:
+			log.Tracef("Dropping message for ZMQ subscriber %s "+
+				"which reached the high water mark", s)
+		}
+	}
+}
+
+// handleConn performs the handshake with the subscriber of the passed
+// connection and serves it until the connection is closed.  It must be run as
+// a goroutine.
+func (p *Publisher) handleConn(conn net.Conn) {
+	defer p.wg.Done()
+
+	s := &subscriber{
+		conn:   conn,
+		queue:  make(chan [][]byte, p.hwm),
+		quit:   make(chan struct{}),
+		topics: make(map[string]int),
+	}
+
+	// The subscriber is registered before the handshake, so it is
+	// disconnected when the publisher is stopped in the mean time.  No
+	// messages are queued for it until it subscribes to topics, which
+	// requires the handshake to be completed.
+	p.mtx.Lock()
+	if atomic.LoadInt32(&p.shutdown) != 0 {
+		p.mtx.Unlock()
+		conn.Close()
+		return
+	}
+	p.subscribers[s] = struct{}{}
+	p.mtx.Unlock()
+	defer func() {
+		p.mtx.Lock()
+		delete(p.subscribers, s)
+		p.mtx.Unlock()
+		close(s.quit)
+		conn.Close()
+	}()
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	minor, err := s.handshake()
+	if err != nil {
+		log.Debugf("ZMQ handshake with %s failed: %v", s, err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	log.Debugf("New ZMQ subscriber %s (ZMTP 3.%d)", s, minor)
+	p.wg.Add(1)
+	go func() {
+		s.writeHandler()
+		p.wg.Done()
+	}()
+	s.readHandler()
+	log.Debugf("ZMQ subscriber %s disconnected", s)
+}
+
+// listenHandler accepts connections on the passed listener.  It must be run as
+// a goroutine.
+func (p *Publisher) listenHandler(listener net.Listener) {
+	log.Infof("ZMQ publisher listening on %s", listener.Addr())
+	for atomic.LoadInt32(&p.shutdown) == 0 {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Only log the error if not forcibly shutting down.
+			if atomic.LoadInt32(&p.shutdown) == 0 {
+				log.Errorf("Can't accept connection: %v", err)
+			}
+			continue
+		}
+		p.wg.Add(1)
+		go p.handleConn(conn)
+	}
+
+	p.wg.Done()
+	log.Tracef("ZMQ listener done for %s", listener.Addr())
+}
+
+// Start begins accepting subscribers.
+func (p *Publisher) Start() {
+	if atomic.AddInt32(&p.started, 1) != 1 {
+		return
+	}
+
+	for _, listener := range p.listeners {
+		p.wg.Add(1)
+		go p.listenHandler(listener)
+	}
+}
+
+// Stop closes the listeners of the publisher, disconnects all subscribers, and
+// waits for them to be disconnected.
+func (p *Publisher) Stop() {
+	if atomic.AddInt32(&p.shutdown, 1) != 1 {
+		return
+	}
+
+	for _, listener := range p.listeners {
+		if err := listener.Close(); err != nil {
+			log.Errorf("Problem shutting down ZMQ publisher: %v", err)
+		}
+	}
+	p.mtx.Lock()
+	for s := range p.subscribers {
+		s.conn.Close()
+	}
+	p.mtx.Unlock()
+	p.wg.Wait()
+}
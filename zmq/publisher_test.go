@@ -0,0 +1,200 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmq
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// testSubscriber connects to the passed address and completes the handshake as
+// a socket of the passed type speaking the passed minor version of ZMTP 3.
+func testSubscriber(t *testing.T, addr string, socketType string,
+	minor byte) net.Conn {
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial: unexpected error: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	g := greeting()
+	g[11] = minor
+	if _, err := conn.Write(g); err != nil {
+		t.Fatalf("failed to write greeting: %v", err)
+	}
+	if _, err := readGreeting(conn); err != nil {
+		t.Fatalf("readGreeting: unexpected error: %v", err)
+	}
+	if err := writeFrame(conn, flagCommand, readyCommand(socketType)); err != nil {
+		t.Fatalf("failed to write READY command: %v", err)
+	}
+	f, err := readFrame(conn)
+	if err != nil {
+		t.Fatalf("readFrame: unexpected error: %v", err)
+	}
+	name, data, err := parseCommand(f.body)
+	if err != nil || name != cmdReady {
+		t.Fatalf("got command %q (%v), want %s", name, err, cmdReady)
+	}
+	props, err := parseMetadata(data)
+	if err != nil || props["socket-type"] != socketPub {
+		t.Fatalf("got metadata %v (%v), want socket type %s", props,
+			err, socketPub)
+	}
+	return conn
+}
+
+// readMessage reads a message made of multiple frames from the passed
+// connection.
+func readMessage(t *testing.T, conn net.Conn) [][]byte {
+	var msg [][]byte
+	for {
+		f, err := readFrame(conn)
+		if err != nil {
+			t.Fatalf("readFrame: unexpected error: %v", err)
+		}
+		if f.isCommand() {
+			continue
+		}
+		msg = append(msg, f.body)
+		if f.flags&flagMore == 0 {
+			return msg
+		}
+	}
+}
+
+// waitSubscribed waits until the passed number of subscribers subscribed to
+// topics of the publisher.
+func waitSubscribed(t *testing.T, p *Publisher, topic []byte, n int) {
+	for i := 0; i < 500; i++ {
+		var matches int
+		p.mtx.Lock()
+		for s := range p.subscribers {
+			if s.matches(topic) {
+				matches++
+			}
+		}
+		p.mtx.Unlock()
+		if matches == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("subscribers did not subscribe to %q", topic)
+}
+
+// TestPublisher ensures subscribers speaking ZMTP 3.0 and 3.1 receive the
+// messages of the topics they subscribed to, and that sockets which are not
+// subscribers are rejected.
+func TestPublisher(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: unexpected error: %v", err)
+	}
+	p := NewPublisher([]net.Listener{listener}, 10)
+	p.Start()
+	defer p.Stop()
+	addr := listener.Addr().String()
+
+	// A ZMTP 3.0 subscriber subscribes with a message, while a ZMTP 3.1
+	// subscriber uses a command.
+	sub30 := testSubscriber(t, addr, socketSub, 0)
+	defer sub30.Close()
+	err = writeFrame(sub30, 0, append([]byte{1}, "hash"...))
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	sub31 := testSubscriber(t, addr, socketXSub, 1)
+	defer sub31.Close()
+	err = writeFrame(sub31, flagCommand, command(cmdSubscribe,
+		[]byte("rawtx")))
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	waitSubscribed(t, p, []byte("hashtx"), 1)
+	waitSubscribed(t, p, []byte("rawtx"), 1)
+
+	// Messages are only sent to the subscribers of their topic, and long
+	// frames are used for large bodies.
+	body := bytes.Repeat([]byte{0xaa}, 300)
+	p.Publish([]byte("rawblock"), []byte{0x01})
+	p.Publish([]byte("hashtx"), []byte{0x02}, []byte{0, 0, 0, 0})
+	p.Publish([]byte("rawtx"), body, []byte{0, 0, 0, 0})
+	msg := readMessage(t, sub30)
+	if len(msg) != 3 || string(msg[0]) != "hashtx" || msg[1][0] != 0x02 {
+		t.Fatalf("ZMTP 3.0 subscriber got message %x", msg)
+	}
+	msg = readMessage(t, sub31)
+	if len(msg) != 3 || string(msg[0]) != "rawtx" ||
+		!bytes.Equal(msg[1], body) {
+
+		t.Fatalf("ZMTP 3.1 subscriber got message %x", msg)
+	}
+
+	// Heartbeats are answered with the context of the PING command.
+	ping := command(cmdPing, []byte{0x00, 0x0a, 0xbe, 0xef})
+	if err := writeFrame(sub31, flagCommand, ping); err != nil {
+		t.Fatalf("failed to write PING command: %v", err)
+	}
+	f, err := readFrame(sub31)
+	if err != nil {
+		t.Fatalf("readFrame: unexpected error: %v", err)
+	}
+	name, data, err := parseCommand(f.body)
+	if err != nil || name != cmdPong || !bytes.Equal(data, []byte{0xbe, 0xef}) {
+		t.Fatalf("got command %q with data %x, want %s with data "+
+			"beef", name, data, cmdPong)
+	}
+
+	// Canceled subscriptions no longer match.
+	err = writeFrame(sub30, 0, append([]byte{0}, "hash"...))
+	if err != nil {
+		t.Fatalf("failed to cancel subscription: %v", err)
+	}
+	waitSubscribed(t, p, []byte("hashtx"), 0)
+
+	// Other sockets, such as publishers, are rejected.
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial: unexpected error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write(greeting())
+	readGreeting(conn)
+	writeFrame(conn, flagCommand, readyCommand(socketPub))
+	if _, err := readFrame(conn); err != nil {
+		t.Fatalf("readFrame: unexpected error: %v", err)
+	}
+	f, err = readFrame(conn)
+	if err != nil {
+		t.Fatalf("readFrame: unexpected error: %v", err)
+	}
+	if name, _, _ := parseCommand(f.body); name != cmdError {
+		t.Fatalf("got command %q, want %s", name, cmdError)
+	}
+}
+
+// TestPublisherHighWaterMark ensures messages are dropped for subscribers which
+// have as many messages queued as the high water mark.
+func TestPublisherHighWaterMark(t *testing.T) {
+	p := NewPublisher(nil, 2)
+	s := &subscriber{
+		queue:  make(chan [][]byte, p.hwm),
+		topics: map[string]int{"": 1},
+	}
+	p.subscribers[s] = struct{}{}
+	for i := byte(0); i < 4; i++ {
+		p.Publish([]byte("hashblock"), []byte{i})
+	}
+	if len(s.queue) != 2 {
+		t.Fatalf("got %d queued messages, want 2", len(s.queue))
+	}
+	if msg := <-s.queue; msg[1][0] != 0 {
+		t.Fatalf("got message %x, want the first one", msg)
+	}
+}
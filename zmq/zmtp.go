@@ -0,0 +1,243 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package zmq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// greetingSize is the size of the greeting which starts every ZMTP 3.x
+	// connection.
+	greetingSize = 64
+
+	// versionMajor and versionMinor are the version of the ZMTP protocol
+	// advertised in the greeting.  Peers which support a lower minor
+	// version of ZMTP 3 are handled as well.
+	versionMajor = 3
+	versionMinor = 1
+
+	// mechanismNull is the name of the NULL security mechanism, which is
+	// the only one supported.
+	mechanismNull = "NULL"
+
+	// maxCommandSize is the maximum size of a command received from a
+	// peer.  Peers only send handshake, subscription, and heartbeat
+	// commands, which are small.
+	maxCommandSize = 4096
+
+	// maxMessageFrameSize is the maximum size of a message frame received
+	// from a peer.  Subscribers only send subscriptions, whose size is
+	// bounded by the size of the topics.
+	maxMessageFrameSize = 4096
+)
+
+// Flags of the frames of ZMTP 3.x.
+const (
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+)
+
+// Names of the commands of ZMTP 3.x which are handled.
+const (
+	cmdReady     = "READY"
+	cmdError     = "ERROR"
+	cmdSubscribe = "SUBSCRIBE"
+	cmdCancel    = "CANCEL"
+	cmdPing      = "PING"
+	cmdPong      = "PONG"
+)
+
+// propSocketType is the name of the metadata property of the READY command
+// which holds the type of the socket of the sender.
+const propSocketType = "Socket-Type"
+
+// Types of the sockets which are exchanged in the READY command.  Only
+// subscribers may connect to a publisher.
+const (
+	socketPub  = "PUB"
+	socketSub  = "SUB"
+	socketXSub = "XSUB"
+)
+
+var (
+	// errBadGreeting is returned when the greeting of a peer is not the
+	// one of ZMTP 3.x.
+	errBadGreeting = errors.New("peer did not send a ZMTP 3 greeting")
+
+	// errFrameTooLarge is returned when a peer sends a frame which exceeds
+	// the maximum size.
+	errFrameTooLarge = errors.New("frame exceeds maximum size")
+)
+
+// greeting returns the greeting of a socket using the NULL security mechanism.
+func greeting() []byte {
+	g := make([]byte, greetingSize)
+	g[0] = 0xff
+	g[9] = 0x7f
+	g[10] = versionMajor
+	g[11] = versionMinor
+	copy(g[12:32], mechanismNull)
+	return g
+}
+
+// readGreeting reads the greeting of a peer and ensures it uses ZMTP 3.x along
+// with the NULL security mechanism.  It returns the minor version of the
+// protocol spoken by the peer.
+func readGreeting(r io.Reader) (byte, error) {
+	var g [greetingSize]byte
+	if _, err := io.ReadFull(r, g[:]); err != nil {
+		return 0, err
+	}
+	if g[0] != 0xff || g[9] != 0x7f || g[10] < versionMajor {
+		return 0, errBadGreeting
+	}
+	mechanism := string(bytes.TrimRight(g[12:32], "\x00"))
+	if mechanism != mechanismNull {
+		return 0, fmt.Errorf("unsupported security mechanism %q",
+			mechanism)
+	}
+
+	// Peers which support a newer major version speak the version
+	// advertised in the greeting.
+	if g[10] > versionMajor {
+		return versionMinor, nil
+	}
+	return g[11], nil
+}
+
+// frame is a frame of ZMTP 3.x.
+type frame struct {
+	flags byte
+	body  []byte
+}
+
+// isCommand returns whether the frame is a command rather than a part of a
+// message.
+func (f *frame) isCommand() bool {
+	return f.flags&flagCommand != 0
+}
+
+// writeFrame writes a frame with the passed flags and body.  The long flag is
+// set as required by the size of the body.
+func writeFrame(w io.Writer, flags byte, body []byte) error {
+	var hdr [9]byte
+	n := 2
+	if len(body) > 255 {
+		hdr[0] = flags | flagLong
+		binary.BigEndian.PutUint64(hdr[1:], uint64(len(body)))
+		n = 9
+	} else {
+		hdr[0] = flags &^ flagLong
+		hdr[1] = byte(len(body))
+	}
+	if _, err := w.Write(hdr[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// writeMessage writes a message made of the passed frames.
+func writeMessage(w io.Writer, frames [][]byte) error {
+	for i, body := range frames {
+		var flags byte
+		if i < len(frames)-1 {
+			flags = flagMore
+		}
+		if err := writeFrame(w, flags, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFrame reads a frame from the peer.  Commands and message frames which
+// exceed their maximum size are rejected.
+func readFrame(r io.Reader) (*frame, error) {
+	var hdr [9]byte
+	if _, err := io.ReadFull(r, hdr[:2]); err != nil {
+		return nil, err
+	}
+	flags := hdr[0]
+	size := uint64(hdr[1])
+	if flags&flagLong != 0 {
+		if _, err := io.ReadFull(r, hdr[2:]); err != nil {
+			return nil, err
+		}
+		size = binary.BigEndian.Uint64(hdr[1:])
+	}
+	maxSize := uint64(maxMessageFrameSize)
+	if flags&flagCommand != 0 {
+		maxSize = maxCommandSize
+	}
+	if size > maxSize {
+		return nil, errFrameTooLarge
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &frame{flags: flags, body: body}, nil
+}
+
+// command returns the body of a command with the passed name and data.
+func command(name string, data []byte) []byte {
+	body := make([]byte, 0, 1+len(name)+len(data))
+	body = append(body, byte(len(name)))
+	body = append(body, name...)
+	return append(body, data...)
+}
+
+// parseCommand splits the body of a command into its name and data.
+func parseCommand(body []byte) (string, []byte, error) {
+	if len(body) == 0 || len(body) < 1+int(body[0]) {
+		return "", nil, errors.New("malformed command")
+	}
+	n := 1 + int(body[0])
+	return string(body[1:n]), body[n:], nil
+}
+
+// readyCommand returns the body of the READY command of a socket of the passed
+// type.
+func readyCommand(socketType string) []byte {
+	var data []byte
+	data = append(data, byte(len(propSocketType)))
+	data = append(data, propSocketType...)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(socketType)))
+	data = append(data, size[:]...)
+	data = append(data, socketType...)
+	return command(cmdReady, data)
+}
+
+// parseMetadata parses the metadata properties of a READY command.  Since the
+// names of the properties are case-insensitive, they are returned in lower
+// case.
+func parseMetadata(data []byte) (map[string]string, error) {
+	props := make(map[string]string)
+	for len(data) > 0 {
+		n := int(data[0])
+		if len(data) < 1+n+4 {
+			return nil, errors.New("malformed metadata")
+		}
+		name := strings.ToLower(string(data[1 : 1+n]))
+		data = data[1+n:]
+		size := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint64(len(data)) < uint64(size) {
+			return nil, errors.New("malformed metadata")
+		}
+		props[name] = string(data[:size])
+		data = data[size:]
+	}
+	return props, nil
+}
@@ -0,0 +1,351 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/zmq"
+	"github.com/btcsuite/btcutil"
+)
+
+// Topics of the messages published by the ZMQ notifier.  They match the ones
+// of Bitcoin Core.
+const (
+	zmqTopicHashBlock = "hashblock"
+	zmqTopicHashTx    = "hashtx"
+	zmqTopicRawBlock  = "rawblock"
+	zmqTopicRawTx     = "rawtx"
+	zmqTopicSequence  = "sequence"
+)
+
+// Labels of the messages of the sequence topic, which follow the hash of the
+// block or transaction they are about.
+const (
+	zmqSequenceConnected    = 'C'
+	zmqSequenceDisconnected = 'D'
+	zmqSequenceAdded        = 'A'
+	zmqSequenceRemoved      = 'R'
+)
+
+// zmqMempoolBuffer is the number of mempool events which are buffered for the
+// ZMQ notifier before further events are dropped.
+const zmqMempoolBuffer = 1000
+
+// zmqTCPScheme is the scheme of the addresses the ZMQ notifier binds to.  Only
+// the TCP transport of ZeroMQ is supported.
+const zmqTCPScheme = "tcp://"
+
+// zmqEndpoint is a topic which is published on an address.
+type zmqEndpoint struct {
+	Topic   string
+	Address string
+	HWM     int
+}
+
+// zmqEndpoints returns the endpoints the passed config enables in the order
+// Bitcoin Core lists them.
+func zmqEndpoints(c *config) []zmqEndpoint {
+	var endpoints []zmqEndpoint
+	for _, topic := range []struct {
+		name  string
+		addrs []string
+		hwm   int
+	}{
+		{zmqTopicHashBlock, c.ZMQPubHashBlock, c.ZMQPubHashBlockHWM},
+		{zmqTopicHashTx, c.ZMQPubHashTx, c.ZMQPubHashTxHWM},
+		{zmqTopicRawBlock, c.ZMQPubRawBlock, c.ZMQPubRawBlockHWM},
+		{zmqTopicRawTx, c.ZMQPubRawTx, c.ZMQPubRawTxHWM},
+		{zmqTopicSequence, c.ZMQPubSequence, c.ZMQPubSequenceHWM},
+	} {
+		for _, addr := range topic.addrs {
+			endpoints = append(endpoints, zmqEndpoint{
+				Topic:   topic.name,
+				Address: addr,
+				HWM:     topic.hwm,
+			})
+		}
+	}
+	return endpoints
+}
+
+// parseZMQAddress returns the interface/port of the passed ZeroMQ address,
+// which has the form tcp://host:port.  A host of * stands for all interfaces.
+func parseZMQAddress(addr string) (string, error) {
+	if !strings.HasPrefix(addr, zmqTCPScheme) {
+		return "", errors.New("only tcp:// addresses are supported")
+	}
+	host, port, err := net.SplitHostPort(addr[len(zmqTCPScheme):])
+	if err != nil {
+		return "", err
+	}
+	if host == "*" {
+		host = ""
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// zmqTopic is a topic which is published on an address.  Every message holds
+// the topic, the body, and a little endian sequence number which is counted
+// separately for every topic and address, so subscribers can detect dropped
+// messages.
+type zmqTopic struct {
+	name []byte
+	send func(frames ...[]byte)
+
+	mtx sync.Mutex
+	seq uint32
+}
+
+// publish publishes a message with the passed body under the next sequence
+// number.
+func (t *zmqTopic) publish(body []byte) {
+	t.mtx.Lock()
+	var seq [4]byte
+	binary.LittleEndian.PutUint32(seq[:], t.seq)
+	t.seq++
+	t.send(t.name, body, seq[:])
+	t.mtx.Unlock()
+}
+
+// zmqNotifier publishes the blocks and transactions of the chain and the
+// mempool on ZeroMQ PUB sockets in the format of Bitcoin Core, so software
+// written against its ZMQ interface may be used with btcd unchanged.
+//
+// The hashblock and rawblock topics announce every block connected to the main
+// chain, while the hashtx and rawtx topics announce the transactions which are
+// added to the mempool as well as those of blocks which are connected to or
+// disconnected from the main chain.  The sequence topic announces all of these
+// events along with the transactions removed from the mempool for reasons
+// other than being included in a block.
+type zmqNotifier struct {
+	txMemPool  *mempool.TxPool
+	publishers []*zmq.Publisher
+	topics     map[string][]*zmqTopic
+
+	sub *mempool.TxEventSubscription
+	wg  sync.WaitGroup
+}
+
+// newZMQNotifier returns a ZMQ notifier which binds to the addresses of the
+// passed endpoints and is subscribed to the notifications of the passed chain.
+// Topics which are published on the same address share its socket, whose high
+// water mark is the largest one of them.
+func newZMQNotifier(chain *blockchain.BlockChain, txMemPool *mempool.TxPool,
+	endpoints []zmqEndpoint) (*zmqNotifier, error) {
+
+	n := &zmqNotifier{
+		txMemPool: txMemPool,
+		topics:    make(map[string][]*zmqTopic),
+	}
+
+	var addrs []string
+	hwms := make(map[string]int)
+	for _, endpoint := range endpoints {
+		addr, err := parseZMQAddress(endpoint.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ZMQ address %s: %v",
+				endpoint.Address, err)
+		}
+		if _, ok := hwms[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+		if endpoint.HWM > hwms[addr] {
+			hwms[addr] = endpoint.HWM
+		}
+	}
+
+	publishers := make(map[string]*zmq.Publisher, len(addrs))
+	for _, addr := range addrs {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, p := range n.publishers {
+				p.Stop()
+			}
+			return nil, fmt.Errorf("unable to listen on %s for ZMQ "+
+				"notifications: %v", addr, err)
+		}
+		p := zmq.NewPublisher([]net.Listener{listener}, hwms[addr])
+		publishers[addr] = p
+		n.publishers = append(n.publishers, p)
+	}
+
+	for _, endpoint := range endpoints {
+		addr, _ := parseZMQAddress(endpoint.Address)
+		n.topics[endpoint.Topic] = append(n.topics[endpoint.Topic],
+			&zmqTopic{
+				name: []byte(endpoint.Topic),
+				send: publishers[addr].Publish,
+			})
+	}
+
+	if chain != nil {
+		chain.Subscribe(n.handleBlockchainNotification)
+	}
+	return n, nil
+}
+
+// publish publishes a message with the passed body on all addresses of the
+// passed topic.
+func (n *zmqNotifier) publish(topic string, body []byte) {
+	for _, t := range n.topics[topic] {
+		t.publish(body)
+	}
+}
+
+// has returns whether the passed topic is published on any address.
+func (n *zmqNotifier) has(topic string) bool {
+	return len(n.topics[topic]) > 0
+}
+
+// publishTx publishes the passed transaction on the hashtx and rawtx topics.
+func (n *zmqNotifier) publishTx(tx *btcutil.Tx) {
+	if n.has(zmqTopicHashTx) {
+		n.publish(zmqTopicHashTx, zmqHash(tx.Hash()))
+	}
+	if n.has(zmqTopicRawTx) {
+		serialized, err := serializeTx(tx.MsgTx())
+		if err != nil {
+			rpcsLog.Errorf("Failed to serialize transaction %v for ZMQ "+
+				"notification: %v", tx.Hash(), err)
+			return
+		}
+		n.publish(zmqTopicRawTx, serialized)
+	}
+}
+
+// publishSequence publishes a message on the sequence topic for the passed
+// hash and label.  The sequence number of the mempool is appended when it is
+// passed.
+func (n *zmqNotifier) publishSequence(hash *chainhash.Hash, label byte,
+	mempoolSeq *uint64) {
+
+	if !n.has(zmqTopicSequence) {
+		return
+	}
+	body := make([]byte, chainhash.HashSize+1, chainhash.HashSize+9)
+	copy(body, zmqHash(hash))
+	body[chainhash.HashSize] = label
+	if mempoolSeq != nil {
+		var seq [8]byte
+		binary.LittleEndian.PutUint64(seq[:], *mempoolSeq)
+		body = append(body, seq[:]...)
+	}
+	n.publish(zmqTopicSequence, body)
+}
+
+// handleBlockchainNotification publishes the blocks which are connected to and
+// disconnected from the main chain along with their transactions.  Since
+// publishing never blocks, the messages are published right away to keep them
+// in the order of the notifications.
+func (n *zmqNotifier) handleBlockchainNotification(notification *blockchain.Notification) {
+	var label byte
+	switch notification.Type {
+	case blockchain.NTBlockConnected:
+		label = zmqSequenceConnected
+	case blockchain.NTBlockDisconnected:
+		label = zmqSequenceDisconnected
+	default:
+		return
+	}
+	block, ok := notification.Data.(*btcutil.Block)
+	if !ok {
+		rpcsLog.Warnf("Chain notification is not a block.")
+		return
+	}
+
+	for _, tx := range block.Transactions() {
+		n.publishTx(tx)
+	}
+	n.publishSequence(block.Hash(), label, nil)
+	if label != zmqSequenceConnected {
+		return
+	}
+	if n.has(zmqTopicHashBlock) {
+		n.publish(zmqTopicHashBlock, zmqHash(block.Hash()))
+	}
+	if n.has(zmqTopicRawBlock) {
+		serialized, err := block.Bytes()
+		if err != nil {
+			rpcsLog.Errorf("Failed to serialize block %v for ZMQ "+
+				"notification: %v", block.Hash(), err)
+			return
+		}
+		n.publish(zmqTopicRawBlock, serialized)
+	}
+}
+
+// handleTxEvent publishes the transactions which are added to the mempool and
+// announces the ones which are removed from it for reasons other than being
+// included in a block on the sequence topic.
+func (n *zmqNotifier) handleTxEvent(event *mempool.TxEvent) {
+	switch event.Type {
+	case mempool.TxEventAdded:
+		n.publishTx(event.TxDesc.Tx)
+		n.publishSequence(event.TxDesc.Tx.Hash(), zmqSequenceAdded,
+			&event.Sequence)
+
+	case mempool.TxEventRemoved:
+		if event.Reason == mempool.RemovalReasonBlock {
+			return
+		}
+		n.publishSequence(event.TxDesc.Tx.Hash(), zmqSequenceRemoved,
+			&event.Sequence)
+	}
+}
+
+// mempoolHandler publishes the events of the mempool subscription until it
+// ends.  It must be run as a goroutine.
+func (n *zmqNotifier) mempoolHandler() {
+	for event := range n.sub.C {
+		n.handleTxEvent(event)
+	}
+	n.wg.Done()
+}
+
+// Start begins accepting subscribers and publishing the events of the mempool.
+func (n *zmqNotifier) Start() {
+	for _, p := range n.publishers {
+		p.Start()
+	}
+
+	if n.txMemPool != nil && (n.has(zmqTopicHashTx) ||
+		n.has(zmqTopicRawTx) || n.has(zmqTopicSequence)) {
+
+		n.sub = n.txMemPool.SubscribeTxEvents(zmqMempoolBuffer,
+			blockchain.PolicyDropNewest, false)
+		n.wg.Add(1)
+		go n.mempoolHandler()
+	}
+}
+
+// Stop ends the mempool subscription and disconnects all subscribers.
+func (n *zmqNotifier) Stop() {
+	if n.sub != nil {
+		n.sub.Unsubscribe()
+		n.wg.Wait()
+	}
+	for _, p := range n.publishers {
+		p.Stop()
+	}
+}
+
+// zmqHash returns the passed hash in the byte order it is displayed in, which
+// is the one of the messages of the ZMQ notifier.
+func zmqHash(hash *chainhash.Hash) []byte {
+	reversed := make([]byte, chainhash.HashSize)
+	for i := range hash {
+		reversed[i] = hash[chainhash.HashSize-1-i]
+	}
+	return reversed
+}
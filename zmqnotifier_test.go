@@ -0,0 +1,155 @@
+// Copyright (c) 2013-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/mining"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// TestParseZMQAddress ensures ZeroMQ addresses are translated to the
+// interface/port to listen on.
+func TestParseZMQAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{addr: "tcp://127.0.0.1:28332", want: "127.0.0.1:28332"},
+		{addr: "tcp://*:28332", want: ":28332"},
+		{addr: "tcp://[::1]:28332", want: "[::1]:28332"},
+		{addr: "tcp://127.0.0.1", wantErr: true},
+		{addr: "ipc:///tmp/btcd.sock", wantErr: true},
+		{addr: "127.0.0.1:28332", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseZMQAddress(test.addr)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseZMQAddress(%q): expected error", test.addr)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseZMQAddress(%q): got %q (%v), want %q",
+				test.addr, got, err, test.want)
+		}
+	}
+}
+
+// zmqMessage is a message which was published by the ZMQ notifier in a test.
+type zmqMessage struct {
+	topic string
+	body  []byte
+	seq   uint32
+}
+
+// newTestZMQNotifier returns a ZMQ notifier which publishes the passed topics
+// to the returned slice instead of sockets.
+func newTestZMQNotifier(topics ...string) (*zmqNotifier, *[]zmqMessage) {
+	var msgs []zmqMessage
+	n := &zmqNotifier{topics: make(map[string][]*zmqTopic)}
+	for _, topic := range topics {
+		n.topics[topic] = []*zmqTopic{{
+			name: []byte(topic),
+			send: func(frames ...[]byte) {
+				msgs = append(msgs, zmqMessage{
+					topic: string(frames[0]),
+					body:  frames[1],
+					seq:   binary.LittleEndian.Uint32(frames[2]),
+				})
+			},
+		}}
+	}
+	return n, &msgs
+}
+
+// TestZMQNotifier ensures the messages published for blocks and mempool events
+// match the ones of Bitcoin Core.
+func TestZMQNotifier(t *testing.T) {
+	n, msgs := newTestZMQNotifier(zmqTopicHashBlock, zmqTopicHashTx,
+		zmqTopicRawBlock, zmqTopicSequence)
+
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	block := btcutil.NewBlock(genesis)
+	rawBlock, err := block.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: unexpected error: %v", err)
+	}
+	blockHash := zmqHash(block.Hash())
+	coinbaseHash := zmqHash(block.Transactions()[0].Hash())
+	if hex.EncodeToString(blockHash) != genesis.BlockHash().String() {
+		t.Fatalf("block hash is not in display order: %x", blockHash)
+	}
+
+	n.handleBlockchainNotification(&blockchain.Notification{
+		Type: blockchain.NTBlockConnected,
+		Data: block,
+	})
+	n.handleBlockchainNotification(&blockchain.Notification{
+		Type: blockchain.NTBlockDisconnected,
+		Data: block,
+	})
+
+	tx := btcutil.NewTx(wire.NewMsgTx(wire.TxVersion))
+	txHash := zmqHash(tx.Hash())
+	n.handleTxEvent(&mempool.TxEvent{
+		Sequence: 7,
+		Type:     mempool.TxEventAdded,
+		TxDesc:   &mempool.TxDesc{TxDesc: mining.TxDesc{Tx: tx}},
+	})
+	n.handleTxEvent(&mempool.TxEvent{
+		Sequence: 8,
+		Type:     mempool.TxEventRemoved,
+		TxDesc:   &mempool.TxDesc{TxDesc: mining.TxDesc{Tx: tx}},
+		Reason:   mempool.RemovalReasonBlock,
+	})
+	n.handleTxEvent(&mempool.TxEvent{
+		Sequence: 9,
+		Type:     mempool.TxEventRemoved,
+		TxDesc:   &mempool.TxDesc{TxDesc: mining.TxDesc{Tx: tx}},
+		Reason:   mempool.RemovalReasonConflict,
+	})
+
+	mempoolSeq := func(label byte, seq uint64) []byte {
+		body := append(append([]byte(nil), txHash...), label)
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], seq)
+		return append(body, b[:]...)
+	}
+	want := []zmqMessage{
+		{zmqTopicHashTx, coinbaseHash, 0},
+		{zmqTopicSequence, append(blockHash, 'C'), 0},
+		{zmqTopicHashBlock, blockHash, 0},
+		{zmqTopicRawBlock, rawBlock, 0},
+		{zmqTopicHashTx, coinbaseHash, 1},
+		{zmqTopicSequence, append(blockHash, 'D'), 1},
+		{zmqTopicHashTx, txHash, 2},
+		{zmqTopicSequence, mempoolSeq('A', 7), 2},
+		{zmqTopicSequence, mempoolSeq('R', 9), 3},
+	}
+	if len(*msgs) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(*msgs), len(want))
+	}
+	for i, msg := range *msgs {
+		if msg.topic != want[i].topic || msg.seq != want[i].seq ||
+			!bytes.Equal(msg.body, want[i].body) {
+
+			t.Errorf("message #%d: got %s %x (seq %d), want %s %x "+
+				"(seq %d)", i, msg.topic, msg.body, msg.seq,
+				want[i].topic, want[i].body, want[i].seq)
+		}
+	}
+}